@@ -36,6 +36,9 @@ type AuthenticatorOptions struct {
 	ChannelsWarningThreshold *uint32
 	SessionCookieName        string
 	BcryptCost               int
+	PasswordPolicy           *PasswordPolicy        // Rules that local user passwords must satisfy, nil if no policy is enforced
+	LastSequence             func() (uint64, error) // Returns the database's latest sequence, recorded as the revocation point of expired channel grants
+	Clock                    base.Clock             // Source of time for session expiry, nil for the system clock
 	LogCtx                   context.Context
 }
 
@@ -77,6 +80,11 @@ func NewAuthenticator(bucket base.Bucket, channelComputer ChannelComputer, optio
 	}
 }
 
+// clock returns the authenticator's source of time.
+func (auth *Authenticator) clock() base.Clock {
+	return base.ClockOrDefault(auth.Clock)
+}
+
 func DefaultAuthenticatorOptions() AuthenticatorOptions {
 	return AuthenticatorOptions{
 		ClientPartitionWindow: base.DefaultClientPartitionWindow,
@@ -148,6 +156,10 @@ func (auth *Authenticator) getPrincipal(docID string, factory func() Principal)
 			return nil, nil, false, pkgerrors.WithStack(base.RedactErrorf("base.JSONUnmarshal() error for doc ID: %s in getPrincipal().  Error: %v", base.UD(docID), err))
 		}
 		changed := false
+		if channels := princ.Channels(); channels != nil && channels.HasExpired(time.Now()) {
+			// A time-limited channel grant has lapsed -- invalidate so the grant is revoked on rebuild:
+			princ.SetChannelInvalSeq(auth.expiredGrantInvalSeq(princ))
+		}
 		if princ.Channels() == nil && !princ.IsDeleted() {
 			// Channel list has been invalidated by a doc update -- rebuild it:
 			if err := auth.rebuildChannels(princ); err != nil {
@@ -212,6 +224,11 @@ func (auth *Authenticator) rebuildChannels(princ Principal) error {
 	// always grant access to the public document channel
 	channels.AddChannel(ch.DocumentStarChannel, 1)
 
+	// drop any time-limited grants that have lapsed
+	if expired := channels.RemoveExpired(time.Now()); len(expired) > 0 {
+		base.DebugfCtx(auth.LogCtx, base.KeyAccess, "Excluding expired channel grants for %q: %s", base.UD(princ.Name()), base.UD(expired))
+	}
+
 	channelHistory := auth.calculateHistory(princ.Name(), princ.GetChannelInvalSeq(), princ.InvalidatedChannels(), channels, princ.ChannelHistory())
 
 	if len(channelHistory) != 0 {
@@ -225,6 +242,24 @@ func (auth *Authenticator) rebuildChannels(princ Principal) error {
 	return nil
 }
 
+// Returns the sequence at which expired channel grants are treated as revoked.  Uses the database's latest sequence
+// when available so that revocations are picked up by clients that have already caught up with the feed.
+func (auth *Authenticator) expiredGrantInvalSeq(princ Principal) uint64 {
+	invalSeq := princ.Sequence()
+	if auth.LastSequence != nil {
+		if lastSeq, err := auth.LastSequence(); err != nil {
+			base.WarnfCtx(auth.LogCtx, "Unable to retrieve last sequence for expired grants of %q: %v", base.UD(princ.Name()), err)
+		} else if lastSeq > invalSeq {
+			invalSeq = lastSeq
+		}
+	}
+	// A zero inval seq would leave the channels valid
+	if invalSeq == 0 {
+		invalSeq = 1
+	}
+	return invalSeq
+}
+
 // Calculates history for either roles or channels
 func (auth *Authenticator) calculateHistory(princName string, invalSeq uint64, invalGrants ch.TimedSet, newGrants ch.TimedSet, currentHistory TimedSetHistory) TimedSetHistory {
 	// Initialize history if currently empty
@@ -496,6 +531,15 @@ func (auth *Authenticator) UpdateUserEmail(u User, email string) error {
 	return auth.casUpdatePrincipal(u, updateUserEmailCallback)
 }
 
+// ValidatePassword returns a *PasswordPolicyError if the given password doesn't satisfy the configured password
+// policy.  Empty passwords are governed by the database's allow_empty_password setting and aren't checked.
+func (auth *Authenticator) ValidatePassword(password string) error {
+	if password == "" {
+		return nil
+	}
+	return auth.PasswordPolicy.CheckPassword(password)
+}
+
 // rehashPassword will check the bcrypt cost of the given hash
 // and will reset the user's password if the configured cost has since changed
 // Callers must verify password is correct before calling this
@@ -516,11 +560,13 @@ func (auth *Authenticator) rehashPassword(user User, password string) error {
 		hashCost, costErr := bcrypt.Cost(currentUserImpl.PasswordHash_)
 		if costErr == nil && hashCost != auth.BcryptCost {
 			// the cost of the existing hash is different than the configured bcrypt cost.
-			// We'll re-hash the password to adopt the new cost:
+			// We'll re-hash the password to adopt the new cost, retaining the time the password was last changed:
+			passwordLastChanged := currentUserImpl.PasswordLastChanged_
 			err = currentUserImpl.SetPassword(password)
 			if err != nil {
 				return nil, err
 			}
+			currentUserImpl.PasswordLastChanged_ = passwordLastChanged
 			return currentUserImpl, nil
 		} else {
 			return nil, base.ErrUpdateCancel
@@ -332,6 +332,38 @@ func TestRebuildUserChannels(t *testing.T) {
 	assert.Equal(t, ch.AtSequence(ch.SetOf(t, "explicit1", "derived1", "derived2", "!"), 1), user2.Channels())
 }
 
+func TestExpiredChannelGrantRevoked(t *testing.T) {
+	bucket := base.GetTestBucket(t)
+	defer bucket.Close()
+	now := time.Now()
+	computer := mockComputer{channels: ch.TimedSet{
+		"derived1": {Sequence: 1, Expiry: uint32(now.Add(-time.Minute).Unix())},
+		"derived2": {Sequence: 1, Expiry: uint32(now.Add(time.Hour).Unix())},
+	}}
+	options := DefaultAuthenticatorOptions()
+	options.LastSequence = func() (uint64, error) { return 10, nil }
+	auth := NewAuthenticator(bucket, &computer, options)
+	user, _ := auth.NewUser("testUser", "password", ch.SetOf(t, "explicit1"))
+	require.NoError(t, auth.Save(user))
+
+	// Expired grant is excluded when the channels are computed
+	user2, err := auth.GetUser("testUser")
+	require.NoError(t, err)
+	assert.True(t, user2.Channels().Equals(ch.SetOf(t, "explicit1", "derived2", "!")))
+
+	// Once a previously valid grant lapses, it's revoked at the latest sequence
+	user2.setChannels(ch.TimedSet{
+		"explicit1": ch.NewVbSimpleSequence(1),
+		"derived1":  {Sequence: 1, Expiry: uint32(now.Add(-time.Minute).Unix())},
+	})
+	require.NoError(t, auth.Save(user2))
+	user3, err := auth.GetUser("testUser")
+	require.NoError(t, err)
+	assert.False(t, user3.CanSeeChannel("derived1"))
+	require.Contains(t, user3.ChannelHistory(), "derived1")
+	assert.Equal(t, uint64(10), user3.ChannelHistory()["derived1"].Entries[0].EndSeq)
+}
+
 func TestRebuildRoleChannels(t *testing.T) {
 
 	bucket := base.GetTestBucket(t)
@@ -427,6 +459,55 @@ func TestRoleInheritance(t *testing.T) {
 	assert.Equal(t, nil, user2.AuthorizeAllChannels(ch.SetOf(t, "britain", "dull", "hoopiest")))
 }
 
+func TestNestedRoleInheritance(t *testing.T) {
+	bucket := base.GetTestBucket(t)
+	defer bucket.Close()
+	auth := NewAuthenticator(bucket, nil, DefaultAuthenticatorOptions())
+
+	// org includes team, which includes project, which includes org
+	role, _ := auth.NewRole("org", ch.SetOf(t, "announcements"))
+	role.SetIncludedRoles(ch.TimedSet{"team": ch.NewVbSimpleSequence(0x5)})
+	require.NoError(t, auth.Save(role))
+	role, _ = auth.NewRole("team", ch.SetOf(t, "standup"))
+	role.SetIncludedRoles(ch.TimedSet{"project": ch.NewVbSimpleSequence(0x2), "nonexistent": ch.NewVbSimpleSequence(0x2)})
+	require.NoError(t, auth.Save(role))
+	role, _ = auth.NewRole("project", ch.SetOf(t, "specs"))
+	role.SetIncludedRoles(ch.TimedSet{"org": ch.NewVbSimpleSequence(0x2)})
+	require.NoError(t, auth.Save(role))
+
+	user, _ := auth.NewUser("ford", "password", nil)
+	user.(*userImpl).setRolesSince(ch.TimedSet{"org": ch.NewVbSimpleSequence(0x3)})
+	require.NoError(t, auth.Save(user))
+
+	user, err := auth.GetUser("ford")
+	require.NoError(t, err)
+	roleNames := make([]string, 0, 3)
+	for _, role := range user.(*userImpl).GetRoles() {
+		roleNames = append(roleNames, role.Name())
+	}
+	assert.ElementsMatch(t, []string{"org", "team", "project"}, roleNames)
+
+	// Inherited channels are granted from the later of the user's grant and the role's inclusion
+	assert.Equal(t, ch.TimedSet{
+		"!":             ch.NewVbSimpleSequence(0x1),
+		"announcements": ch.NewVbSimpleSequence(0x3),
+		"standup":       ch.NewVbSimpleSequence(0x5),
+		"specs":         ch.NewVbSimpleSequence(0x5),
+	}, user.InheritedChannels())
+	assert.True(t, user.CanSeeChannel("specs"))
+
+	// Adding an inclusion that leads back to the role is a cycle
+	assert.Error(t, auth.ValidateIncludedRoles("project", base.SetOf("team")))
+	assert.Error(t, auth.ValidateIncludedRoles("team", base.SetOf("team")))
+	assert.NoError(t, auth.ValidateIncludedRoles("team", base.SetOf("nonexistent")))
+	assert.NoError(t, auth.ValidateIncludedRoles("newrole", base.SetOf("org")))
+
+	// A role can't include itself
+	role, _ = auth.NewRole("narcissus", nil)
+	role.SetIncludedRoles(ch.TimedSet{"narcissus": ch.NewVbSimpleSequence(0x1)})
+	assert.Error(t, auth.Save(role))
+}
+
 func TestRegisterUser(t *testing.T) {
 	bucket := base.GetTestBucket(t)
 	defer bucket.Close()
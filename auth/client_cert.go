@@ -0,0 +1,152 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package auth
+
+import (
+	"crypto/x509"
+	"fmt"
+	"regexp"
+
+	"github.com/couchbase/sync_gateway/base"
+)
+
+// Certificate fields that ClientCertMappingRule.Field can reference.
+const (
+	ClientCertFieldCN       = "cn"        // Subject common name
+	ClientCertFieldSANDNS   = "san.dns"   // DNS name subject alternative names
+	ClientCertFieldSANEmail = "san.email" // Email address subject alternative names
+	ClientCertFieldSANURI   = "san.uri"   // URI subject alternative names
+)
+
+// ClientCertAuthConfig enables authentication on the public API using TLS client certificates.  The certificate must
+// have been verified against the CA configured via api.https.client_ca_cert_path.  Rules are tried in order, and the
+// first that matches a value of the certificate determines the user name.
+type ClientCertAuthConfig struct {
+	Rules []ClientCertMappingRule `json:"rules"`
+}
+
+// ClientCertMappingRule maps a field of a client certificate to a Sync Gateway user name.
+type ClientCertMappingRule struct {
+	Field    string `json:"field"`              // The certificate field to map: "cn", "san.dns", "san.email" or "san.uri"
+	Match    string `json:"match,omitempty"`    // Regular expression the field must match - defaults to matching any value
+	Username string `json:"username,omitempty"` // User name, which may reference submatches of Match as $1 or ${name} - defaults to the whole value
+}
+
+// Validate ensures the config's settings are valid.
+func (c *ClientCertAuthConfig) Validate() error {
+	if len(c.Rules) == 0 {
+		return fmt.Errorf("at least one rule must be provided")
+	}
+	for i, rule := range c.Rules {
+		switch rule.Field {
+		case ClientCertFieldCN, ClientCertFieldSANDNS, ClientCertFieldSANEmail, ClientCertFieldSANURI:
+		default:
+			return fmt.Errorf("rule %d: unknown field %q", i, rule.Field)
+		}
+		if rule.Match != "" {
+			if _, err := regexp.Compile(rule.Match); err != nil {
+				return fmt.Errorf("rule %d: invalid match expression: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// BuildMapper compiles the config's rules.  The config must have been validated.
+func (c *ClientCertAuthConfig) BuildMapper() *ClientCertMapper {
+	mapper := &ClientCertMapper{rules: make([]compiledClientCertRule, 0, len(c.Rules))}
+	for _, rule := range c.Rules {
+		compiled := compiledClientCertRule{field: rule.Field, username: rule.Username}
+		if rule.Match != "" {
+			compiled.match = regexp.MustCompile(rule.Match)
+		}
+		mapper.rules = append(mapper.rules, compiled)
+	}
+	return mapper
+}
+
+type compiledClientCertRule struct {
+	field    string
+	match    *regexp.Regexp
+	username string
+}
+
+// ClientCertMapper maps verified TLS client certificates to user names.
+type ClientCertMapper struct {
+	rules []compiledClientCertRule
+}
+
+// Username returns the user name for the certificate from the first rule that matches, or "" if no rule matches.
+func (m *ClientCertMapper) Username(cert *x509.Certificate) string {
+	for _, rule := range m.rules {
+		for _, value := range clientCertFieldValues(cert, rule.field) {
+			if username := rule.apply(value); username != "" {
+				return username
+			}
+		}
+	}
+	return ""
+}
+
+func (r compiledClientCertRule) apply(value string) string {
+	if value == "" {
+		return ""
+	}
+	if r.match == nil {
+		if r.username == "" {
+			return value
+		}
+		return r.username
+	}
+	submatches := r.match.FindStringSubmatchIndex(value)
+	if submatches == nil {
+		return ""
+	}
+	if r.username == "" {
+		return value
+	}
+	return string(r.match.ExpandString(nil, r.username, value, submatches))
+}
+
+func clientCertFieldValues(cert *x509.Certificate, field string) []string {
+	switch field {
+	case ClientCertFieldCN:
+		return []string{cert.Subject.CommonName}
+	case ClientCertFieldSANDNS:
+		return cert.DNSNames
+	case ClientCertFieldSANEmail:
+		return cert.EmailAddresses
+	case ClientCertFieldSANURI:
+		values := make([]string, 0, len(cert.URIs))
+		for _, uri := range cert.URIs {
+			values = append(values, uri.String())
+		}
+		return values
+	}
+	return nil
+}
+
+// AuthenticateClientCert returns the user that the mapper maps the certificate to.  Returns a nil user if no rule
+// matches, or the mapped user doesn't exist or is disabled.  The certificate must already have been verified.
+func (auth *Authenticator) AuthenticateClientCert(mapper *ClientCertMapper, cert *x509.Certificate) (User, error) {
+	username := mapper.Username(cert)
+	if username == "" {
+		base.DebugfCtx(auth.LogCtx, base.KeyAuth, "No client cert mapping rule matched cert with subject %q", base.UD(cert.Subject.String()))
+		return nil, nil
+	}
+	user, err := auth.GetUser(username)
+	if err != nil && !base.IsDocNotFoundError(err) {
+		return nil, err
+	}
+	if user == nil || user.Disabled() {
+		base.DebugfCtx(auth.LogCtx, base.KeyAuth, "Client cert mapped to unknown or disabled user %q", base.UD(username))
+		return nil, nil
+	}
+	return user, nil
+}
@@ -0,0 +1,108 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package auth
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"testing"
+
+	"github.com/couchbase/sync_gateway/base"
+	ch "github.com/couchbase/sync_gateway/channels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientCertAuthConfigValidate(t *testing.T) {
+	testCases := []struct {
+		name        string
+		config      ClientCertAuthConfig
+		expectError bool
+	}{
+		{name: "cn", config: ClientCertAuthConfig{Rules: []ClientCertMappingRule{{Field: ClientCertFieldCN}}}},
+		{name: "san with match", config: ClientCertAuthConfig{Rules: []ClientCertMappingRule{{Field: ClientCertFieldSANDNS, Match: `^(.+)\.devices\.example\.com$`, Username: "$1"}}}},
+		{name: "no rules", config: ClientCertAuthConfig{}, expectError: true},
+		{name: "unknown field", config: ClientCertAuthConfig{Rules: []ClientCertMappingRule{{Field: "serial"}}}, expectError: true},
+		{name: "invalid match", config: ClientCertAuthConfig{Rules: []ClientCertMappingRule{{Field: ClientCertFieldCN, Match: "("}}}, expectError: true},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.config.Validate()
+			if test.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestClientCertMapperUsername(t *testing.T) {
+	deviceURI, err := url.Parse("spiffe://example.com/device/sensor-9")
+	require.NoError(t, err)
+	cert := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "Sensor 7"},
+		DNSNames:       []string{"www.example.com", "sensor-7.devices.example.com"},
+		EmailAddresses: []string{"alice@example.com"},
+		URIs:           []*url.URL{deviceURI},
+	}
+
+	testCases := []struct {
+		name     string
+		rules    []ClientCertMappingRule
+		expected string
+	}{
+		{name: "whole cn", rules: []ClientCertMappingRule{{Field: ClientCertFieldCN}}, expected: "Sensor 7"},
+		{name: "san dns submatch", rules: []ClientCertMappingRule{{Field: ClientCertFieldSANDNS, Match: `^(.+)\.devices\.example\.com$`, Username: "device_$1"}}, expected: "device_sensor-7"},
+		{name: "san email named submatch", rules: []ClientCertMappingRule{{Field: ClientCertFieldSANEmail, Match: `^(?P<user>[^@]+)@example\.com$`, Username: "${user}"}}, expected: "alice"},
+		{name: "san uri", rules: []ClientCertMappingRule{{Field: ClientCertFieldSANURI, Match: `/device/(.+)$`, Username: "$1"}}, expected: "sensor-9"},
+		{name: "first matching rule wins", rules: []ClientCertMappingRule{
+			{Field: ClientCertFieldSANEmail, Match: `@other\.com$`},
+			{Field: ClientCertFieldCN, Match: `^Sensor`, Username: "fixed"},
+			{Field: ClientCertFieldSANEmail},
+		}, expected: "fixed"},
+		{name: "no match", rules: []ClientCertMappingRule{{Field: ClientCertFieldSANDNS, Match: `\.internal$`}}, expected: ""},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			config := ClientCertAuthConfig{Rules: test.rules}
+			require.NoError(t, config.Validate())
+			assert.Equal(t, test.expected, config.BuildMapper().Username(cert))
+		})
+	}
+}
+
+func TestAuthenticateClientCert(t *testing.T) {
+	bucket := base.GetTestBucket(t)
+	defer bucket.Close()
+	auth := NewAuthenticator(bucket, nil, DefaultAuthenticatorOptions())
+
+	user, err := auth.NewUser("sensor-7", "", ch.SetOf(t, "readings"))
+	require.NoError(t, err)
+	require.NoError(t, auth.Save(user))
+	disabled, err := auth.NewUser("sensor-8", "", nil)
+	require.NoError(t, err)
+	disabled.SetDisabled(true)
+	require.NoError(t, auth.Save(disabled))
+
+	config := ClientCertAuthConfig{Rules: []ClientCertMappingRule{{Field: ClientCertFieldCN}}}
+	mapper := config.BuildMapper()
+
+	authenticated, err := auth.AuthenticateClientCert(mapper, &x509.Certificate{Subject: pkix.Name{CommonName: "sensor-7"}})
+	require.NoError(t, err)
+	require.NotNil(t, authenticated)
+	assert.Equal(t, "sensor-7", authenticated.Name())
+
+	for _, cn := range []string{"sensor-8", "sensor-9", ""} {
+		authenticated, err = auth.AuthenticateClientCert(mapper, &x509.Certificate{Subject: pkix.Name{CommonName: cn}})
+		require.NoError(t, err)
+		assert.Nil(t, authenticated, "cn %q shouldn't authenticate", cn)
+	}
+}
@@ -0,0 +1,273 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/couchbase/sync_gateway/base"
+	ch "github.com/couchbase/sync_gateway/channels"
+)
+
+const (
+	// Prefix of the names of users created for guest device sessions
+	GuestDeviceUserPrefix = "_guest_device_"
+
+	// Placeholder in GuestSessionConfig.ChannelTemplate that is replaced with the device ID
+	GuestDeviceIDPlaceholder = "{deviceID}"
+
+	DefaultGuestChannelTemplate = "guest:" + GuestDeviceIDPlaceholder
+
+	DefaultGuestUserTTLSecs           = 30 * 24 * 60 * 60 // 30 days
+	DefaultGuestMaxCreationsPerSource = 10
+	DefaultGuestCreationWindowSecs    = 60
+)
+
+// Device IDs are used in both user and channel names, so are restricted to characters that are valid in both.
+var guestDeviceIDRegexp = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// GuestSessionConfig enables unauthenticated clients to obtain a session for an ephemeral user bound to a device ID.
+// The user is only granted the channel obtained by substituting the device ID into ChannelTemplate, and expires
+// UserTTLSecs after the device's most recent guest session.  Since anyone can create these users, the number created
+// from each source IP address is limited to MaxCreationsPerSource per CreationWindowSecs.
+type GuestSessionConfig struct {
+	ChannelTemplate       string  `json:"channel_template,omitempty"`         // Channel granted to the device's user - defaults to "guest:{deviceID}"
+	SessionTTLSecs        *uint32 `json:"session_ttl_secs,omitempty"`         // Time-to-live of guest sessions - defaults to the session TTL for logins
+	UserTTLSecs           *uint32 `json:"user_ttl_secs,omitempty"`            // Time after a device's most recent guest session that its user is removed - defaults to 30 days
+	MaxCreationsPerSource int     `json:"max_creations_per_source,omitempty"` // Users that can be created from a single source IP per window - defaults to 10
+	CreationWindowSecs    int     `json:"creation_window_secs,omitempty"`     // Window that MaxCreationsPerSource applies to - defaults to 60
+}
+
+// Validate ensures the config's settings are valid.
+func (c *GuestSessionConfig) Validate() error {
+	if c.ChannelTemplate != "" {
+		if !strings.Contains(c.ChannelTemplate, GuestDeviceIDPlaceholder) {
+			return fmt.Errorf("channel_template must contain %s", GuestDeviceIDPlaceholder)
+		}
+		if !ch.IsValidChannel(c.ChannelTemplate) {
+			return fmt.Errorf("channel_template %q is not a valid channel name", c.ChannelTemplate)
+		}
+	}
+	if c.SessionTTLSecs != nil && *c.SessionTTLSecs == 0 {
+		return fmt.Errorf("session_ttl_secs must be greater than zero")
+	}
+	if c.UserTTLSecs != nil && *c.UserTTLSecs == 0 {
+		return fmt.Errorf("user_ttl_secs must be greater than zero")
+	}
+	// Users are removed once expired, so must outlive the sessions that renew their expiry
+	if c.SessionTTLSecs != nil && c.UserTTLSecs != nil && *c.UserTTLSecs < *c.SessionTTLSecs {
+		return fmt.Errorf("user_ttl_secs must not be less than session_ttl_secs")
+	}
+	if c.MaxCreationsPerSource < 0 {
+		return fmt.Errorf("max_creations_per_source must not be negative")
+	}
+	if c.CreationWindowSecs < 0 {
+		return fmt.Errorf("creation_window_secs must not be negative")
+	}
+	return nil
+}
+
+// UserTTL returns the time after a device's most recent guest session that its user expires.
+func (c *GuestSessionConfig) UserTTL() time.Duration {
+	if c.UserTTLSecs == nil {
+		return DefaultGuestUserTTLSecs * time.Second
+	}
+	return time.Duration(*c.UserTTLSecs) * time.Second
+}
+
+// ChannelForDevice returns the channel granted to the given device's user.
+func (c *GuestSessionConfig) ChannelForDevice(deviceID string) string {
+	template := c.ChannelTemplate
+	if template == "" {
+		template = DefaultGuestChannelTemplate
+	}
+	return strings.ReplaceAll(template, GuestDeviceIDPlaceholder, deviceID)
+}
+
+// GuestDeviceUserName returns the name of the user for the given device ID.
+func GuestDeviceUserName(deviceID string) string {
+	return GuestDeviceUserPrefix + deviceID
+}
+
+// IsGuestDeviceUserName returns true if the given user name is that of a guest device user.
+func IsGuestDeviceUserName(name string) bool {
+	return strings.HasPrefix(name, GuestDeviceUserPrefix)
+}
+
+// GetGuestDeviceUser returns the user bound to the given device ID, creating it with access to the device's channel
+// if it doesn't exist or has expired, and extends its expiry.  Creation of users is limited per sourceIP by the given
+// limiter, if not nil.  Returns a 401 error if the device's user has been disabled, or a 429 error if the source has
+// created too many users.
+func (auth *Authenticator) GetGuestDeviceUser(deviceID string, config *GuestSessionConfig, limiter *GuestUserLimiter, sourceIP string) (User, error) {
+	if !guestDeviceIDRegexp.MatchString(deviceID) {
+		return nil, base.HTTPErrorf(http.StatusBadRequest, "Invalid device_id")
+	}
+
+	username := GuestDeviceUserName(deviceID)
+	user, err := auth.GetUser(username)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil && user.Disabled() {
+		return nil, base.HTTPErrorf(http.StatusUnauthorized, "Invalid login")
+	}
+
+	now := auth.clock().Now()
+	created := false
+	if user == nil || (!user.GuestExpiry().IsZero() && !now.Before(user.GuestExpiry())) {
+		// Expired users that haven't been removed yet are replaced, as if they had been
+		existing := user
+		user, err = auth.newGuestDeviceUser(deviceID, config)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			user.SetCas(existing.Cas())
+		}
+		created = true
+	} else if user.GuestExpiry().IsZero() {
+		// Users created through the admin API with a guest device user's name don't expire
+		return user, nil
+	}
+
+	if created && limiter != nil && !limiter.Allow(sourceIP) {
+		base.InfofCtx(auth.LogCtx, base.KeyAuth, "Rejected creation of guest device user %q - too many created by its source", base.UD(username))
+		return nil, base.HTTPErrorf(http.StatusTooManyRequests, "Too many guest users created")
+	}
+
+	user.SetGuestExpiry(now.Add(config.UserTTL()))
+	err = auth.Save(user)
+	if err == nil && created {
+		base.InfofCtx(auth.LogCtx, base.KeyAuth, "Created guest device user %q", base.UD(username))
+	}
+	if base.IsCasMismatch(err) {
+		// A concurrent request created or renewed the user, so use theirs
+		user, err = auth.GetUser(username)
+		if err == nil && (user == nil || user.Disabled()) {
+			return nil, base.HTTPErrorf(http.StatusUnauthorized, "Invalid login")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// newGuestDeviceUser returns a new, unsaved user for the given device ID.
+func (auth *Authenticator) newGuestDeviceUser(deviceID string, config *GuestSessionConfig) (User, error) {
+	// Guest device users can't log in with a password, so are given a random one in the same way as users
+	// registered on first OpenID Connect login.
+	secret, err := base.GenerateRandomSecret()
+	if err != nil {
+		return nil, err
+	}
+	return auth.NewUser(GuestDeviceUserName(deviceID), secret, base.SetOf(config.ChannelForDevice(deviceID)))
+}
+
+// DeleteExpiredGuestDeviceUser removes the named guest device user if it has expired.  Returns true if the user was
+// removed.  Users that are renewed while being checked aren't removed.
+func (auth *Authenticator) DeleteExpiredGuestDeviceUser(username string) (bool, error) {
+	if !IsGuestDeviceUserName(username) {
+		return false, nil
+	}
+	user, err := auth.GetUser(username)
+	if err != nil || user == nil {
+		return false, err
+	}
+	expiry := user.GuestExpiry()
+	if expiry.IsZero() || auth.clock().Now().Before(expiry) {
+		return false, nil
+	}
+	// Remove with CAS so that a concurrent renewal isn't lost
+	if _, err := auth.bucket.Remove(user.DocID(), user.Cas()); err != nil {
+		if base.IsCasMismatch(err) || base.IsDocNotFoundError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	base.InfofCtx(auth.LogCtx, base.KeyAuth, "Removed expired guest device user %q", base.UD(username))
+	return true, nil
+}
+
+// GuestUserLimiter limits the number of guest device users created from each source IP address within a fixed
+// window.  Like the LoginThrottle, a single GuestUserLimiter is shared by all requests to the database.
+type GuestUserLimiter struct {
+	maxCreations int
+	window       time.Duration
+
+	lock      sync.Mutex
+	sources   map[string]*guestCreations
+	lastPrune time.Time
+	now       func() time.Time // Overridden in tests
+}
+
+// guestCreations counts the users created from a single source within its current window.
+type guestCreations struct {
+	windowStart time.Time
+	count       int
+}
+
+// NewGuestUserLimiter creates a GuestUserLimiter from the given config, applying defaults to unset values.
+func NewGuestUserLimiter(config GuestSessionConfig) *GuestUserLimiter {
+	l := &GuestUserLimiter{
+		maxCreations: DefaultGuestMaxCreationsPerSource,
+		window:       DefaultGuestCreationWindowSecs * time.Second,
+		sources:      make(map[string]*guestCreations),
+		now:          time.Now,
+	}
+	if config.MaxCreationsPerSource > 0 {
+		l.maxCreations = config.MaxCreationsPerSource
+	}
+	if config.CreationWindowSecs > 0 {
+		l.window = time.Duration(config.CreationWindowSecs) * time.Second
+	}
+	return l
+}
+
+// Allow records the creation of a user from the given source IP, returning false without recording it if the source
+// has already reached the limit for its current window.  An empty sourceIP isn't limited.
+func (l *GuestUserLimiter) Allow(sourceIP string) bool {
+	if sourceIP == "" {
+		return true
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := l.now()
+	l.pruneExpired(now)
+	creations, ok := l.sources[sourceIP]
+	if !ok || now.Sub(creations.windowStart) >= l.window {
+		creations = &guestCreations{windowStart: now}
+		l.sources[sourceIP] = creations
+	}
+	if creations.count >= l.maxCreations {
+		return false
+	}
+	creations.count++
+	return true
+}
+
+// pruneExpired removes the sources whose window has ended, at most once per window, to bound memory use when users are
+// created from many sources.  Requires the lock to be held.
+func (l *GuestUserLimiter) pruneExpired(now time.Time) {
+	if now.Sub(l.lastPrune) < l.window {
+		return
+	}
+	for sourceIP, creations := range l.sources {
+		if now.Sub(creations.windowStart) >= l.window {
+			delete(l.sources, sourceIP)
+		}
+	}
+	l.lastPrune = now
+}
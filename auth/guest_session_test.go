@@ -0,0 +1,160 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package auth
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGuestSessionConfigValidate(t *testing.T) {
+	testCases := []struct {
+		name        string
+		config      GuestSessionConfig
+		expectError bool
+	}{
+		{name: "default", config: GuestSessionConfig{}},
+		{name: "custom template", config: GuestSessionConfig{ChannelTemplate: "device-{deviceID}-inbox"}},
+		{name: "template without placeholder", config: GuestSessionConfig{ChannelTemplate: "guests"}, expectError: true},
+		{name: "invalid channel", config: GuestSessionConfig{ChannelTemplate: "a,{deviceID}"}, expectError: true},
+		{name: "zero ttl", config: GuestSessionConfig{SessionTTLSecs: base.Uint32Ptr(0)}, expectError: true},
+		{name: "zero user ttl", config: GuestSessionConfig{UserTTLSecs: base.Uint32Ptr(0)}, expectError: true},
+		{name: "user ttl less than session ttl", config: GuestSessionConfig{SessionTTLSecs: base.Uint32Ptr(600), UserTTLSecs: base.Uint32Ptr(60)}, expectError: true},
+		{name: "creation limit", config: GuestSessionConfig{MaxCreationsPerSource: 5, CreationWindowSecs: 600}},
+		{name: "negative creation limit", config: GuestSessionConfig{MaxCreationsPerSource: -1}, expectError: true},
+		{name: "negative creation window", config: GuestSessionConfig{CreationWindowSecs: -1}, expectError: true},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.config.Validate()
+			if test.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	assert.Equal(t, "guest:abc", (&GuestSessionConfig{}).ChannelForDevice("abc"))
+	assert.Equal(t, "device-abc-inbox", (&GuestSessionConfig{ChannelTemplate: "device-{deviceID}-inbox"}).ChannelForDevice("abc"))
+}
+
+func TestGetGuestDeviceUser(t *testing.T) {
+	testBucket := base.GetTestBucket(t)
+	defer testBucket.Close()
+
+	clock := base.NewFakeClock(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	options := DefaultAuthenticatorOptions()
+	options.Clock = clock
+	auth := NewAuthenticator(testBucket, nil, options)
+	config := &GuestSessionConfig{UserTTLSecs: base.Uint32Ptr(3600)}
+
+	_, err := auth.GetGuestDeviceUser("bad/device", config, nil, "")
+	assert.Error(t, err)
+
+	// The user is created on first use, with access to only the device's channel
+	user, err := auth.GetGuestDeviceUser("device-1", config, nil, "")
+	require.NoError(t, err)
+	assert.Equal(t, "_guest_device_device-1", user.Name())
+	assert.True(t, IsGuestDeviceUserName(user.Name()))
+	assert.ElementsMatch(t, []string{"guest:device-1"}, user.ExplicitChannels().AllKeys())
+	assert.False(t, user.Authenticate(""))
+	assert.Equal(t, clock.Now().Add(time.Hour), user.GuestExpiry())
+
+	// Subsequent requests return the existing user, extending its expiry
+	clock.Advance(30 * time.Minute)
+	user, err = auth.GetGuestDeviceUser("device-1", config, nil, "")
+	require.NoError(t, err)
+	assert.Equal(t, "_guest_device_device-1", user.Name())
+	assert.Equal(t, clock.Now().Add(time.Hour), user.GuestExpiry())
+
+	// Disabled device users can't get a session
+	user.SetDisabled(true)
+	require.NoError(t, auth.Save(user))
+	_, err = auth.GetGuestDeviceUser("device-1", config, nil, "")
+	assert.Error(t, err)
+}
+
+func TestGuestDeviceUserExpiry(t *testing.T) {
+	testBucket := base.GetTestBucket(t)
+	defer testBucket.Close()
+
+	clock := base.NewFakeClock(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	options := DefaultAuthenticatorOptions()
+	options.Clock = clock
+	auth := NewAuthenticator(testBucket, nil, options)
+	config := &GuestSessionConfig{UserTTLSecs: base.Uint32Ptr(3600)}
+
+	_, err := auth.GetGuestDeviceUser("device-1", config, nil, "")
+	require.NoError(t, err)
+
+	// Users aren't removed before they expire
+	deleted, err := auth.DeleteExpiredGuestDeviceUser("_guest_device_device-1")
+	require.NoError(t, err)
+	assert.False(t, deleted)
+
+	// Expired users that haven't been removed are replaced, counting against the source's creation limit
+	clock.Advance(time.Hour)
+	limiter := NewGuestUserLimiter(GuestSessionConfig{MaxCreationsPerSource: 1})
+	user, err := auth.GetGuestDeviceUser("device-1", config, limiter, "192.0.2.1")
+	require.NoError(t, err)
+	assert.Equal(t, clock.Now().Add(time.Hour), user.GuestExpiry())
+	_, err = auth.GetGuestDeviceUser("device-2", config, limiter, "192.0.2.1")
+	status, _ := base.ErrorAsHTTPStatus(err)
+	assert.Equal(t, http.StatusTooManyRequests, status)
+
+	// Expired users are removed
+	clock.Advance(time.Hour)
+	deleted, err = auth.DeleteExpiredGuestDeviceUser("_guest_device_device-1")
+	require.NoError(t, err)
+	assert.True(t, deleted)
+	user, err = auth.GetUser("_guest_device_device-1")
+	require.NoError(t, err)
+	assert.Nil(t, user)
+
+	// Users that aren't guest device users, or were created through the admin API, are never removed
+	for _, username := range []string{"alice", "_guest_device_admin-created"} {
+		user, err = auth.NewUser(username, "password", nil)
+		require.NoError(t, err)
+		require.NoError(t, auth.Save(user))
+		clock.Advance(24 * time.Hour)
+		deleted, err = auth.DeleteExpiredGuestDeviceUser(username)
+		require.NoError(t, err)
+		assert.False(t, deleted)
+	}
+	user, err = auth.GetGuestDeviceUser("admin-created", config, nil, "")
+	require.NoError(t, err)
+	assert.True(t, user.GuestExpiry().IsZero())
+}
+
+func TestGuestUserLimiter(t *testing.T) {
+	limiter := NewGuestUserLimiter(GuestSessionConfig{MaxCreationsPerSource: 2, CreationWindowSecs: 60})
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+
+	assert.True(t, limiter.Allow("192.0.2.1"))
+	assert.True(t, limiter.Allow("192.0.2.1"))
+	assert.False(t, limiter.Allow("192.0.2.1"))
+
+	// Sources are limited independently, and requests without a source aren't limited
+	assert.True(t, limiter.Allow("192.0.2.2"))
+	for i := 0; i < 5; i++ {
+		assert.True(t, limiter.Allow(""))
+	}
+
+	// The limit resets once the window has passed, and sources from earlier windows are forgotten
+	now = now.Add(time.Minute)
+	assert.True(t, limiter.Allow("192.0.2.1"))
+	assert.Len(t, limiter.sources, 1)
+}
@@ -0,0 +1,361 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/go-ldap/ldap/v3"
+)
+
+const (
+	// Placeholder in LDAPConfig templates and filters that is replaced with the name the user signed in with
+	LDAPUsernamePlaceholder = "{username}"
+
+	// Placeholder in LDAPConfig.GroupFilter that is replaced with the user's distinguished name
+	LDAPUserDNPlaceholder = "{userDN}"
+
+	DefaultLDAPUserFilter         = "(uid=" + LDAPUsernamePlaceholder + ")"
+	DefaultLDAPGroupFilter        = "(member=" + LDAPUserDNPlaceholder + ")"
+	DefaultLDAPGroupNameAttribute = "cn"
+	DefaultLDAPTimeout            = 10 * time.Second
+
+	// Maximum number of groups read for a user
+	ldapGroupSizeLimit = 1000
+)
+
+// LDAPConfig configures authentication of users against an LDAP directory, such as Active Directory.  Users are
+// verified by binding to the directory with their credentials, and are granted roles based on the groups they belong to.
+//
+// The user's distinguished name is either built from UserDNTemplate, or found by searching UserSearchBase with
+// UserFilter (binding as BindDN beforehand, if set).
+type LDAPConfig struct {
+	URL                   string              `json:"url"`                                // ldap:// or ldaps:// URL of the directory server
+	StartTLS              bool                `json:"start_tls,omitempty"`                // If true, upgrades ldap:// connections to TLS using StartTLS
+	InsecureSkipTLSVerify bool                `json:"insecure_skip_tls_verify,omitempty"` // If true, the server's TLS certificate isn't verified
+	TimeoutSecs           *uint32             `json:"timeout_secs,omitempty"`             // Timeout for connecting to and each operation on the server - defaults to 10 seconds
+	BindDN                string              `json:"bind_dn,omitempty"`                  // DN of the service account used to search for users and groups
+	BindPassword          string              `json:"bind_password,omitempty"`            // Password of the service account
+	UserDNTemplate        string              `json:"user_dn_template,omitempty"`         // Template of the user's DN, e.g. "uid={username},ou=people,dc=example,dc=com"
+	UserSearchBase        string              `json:"user_search_base,omitempty"`         // Base DN to search for users, when user_dn_template isn't set
+	UserFilter            string              `json:"user_filter,omitempty"`              // Filter to search for users - defaults to "(uid={username})"
+	EmailAttribute        string              `json:"email_attribute,omitempty"`          // Attribute of the user's entry holding their email address, when searching for users
+	GroupSearchBase       string              `json:"group_search_base,omitempty"`        // Base DN to search for the user's groups - if not set, roles aren't granted from groups
+	GroupFilter           string              `json:"group_filter,omitempty"`             // Filter to search for the user's groups - defaults to "(member={userDN})"
+	GroupNameAttribute    string              `json:"group_name_attribute,omitempty"`     // Attribute of group entries holding the group name - defaults to "cn"
+	GroupRoleMapping      map[string][]string `json:"group_role_mapping,omitempty"`       // Roles granted for each group - if not set, users are granted the role with the same name as each group
+	Register              bool                `json:"register,omitempty"`                 // If true, users are created on their first successful sign-in
+}
+
+// Validate ensures the config's settings are valid.
+func (c *LDAPConfig) Validate() error {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	if u.Scheme != "ldap" && u.Scheme != "ldaps" {
+		return fmt.Errorf("url must use the ldap or ldaps scheme")
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("url must include a host")
+	}
+	if c.StartTLS && u.Scheme != "ldap" {
+		return fmt.Errorf("start_tls can only be used with the ldap scheme")
+	}
+	if c.TimeoutSecs != nil && *c.TimeoutSecs == 0 {
+		return fmt.Errorf("timeout_secs must be greater than zero")
+	}
+
+	if (c.UserDNTemplate == "") == (c.UserSearchBase == "") {
+		return fmt.Errorf("exactly one of user_dn_template or user_search_base must be set")
+	}
+	if c.UserDNTemplate != "" && !strings.Contains(c.UserDNTemplate, LDAPUsernamePlaceholder) {
+		return fmt.Errorf("user_dn_template must contain %s", LDAPUsernamePlaceholder)
+	}
+	if c.UserSearchBase != "" {
+		if !strings.Contains(c.userFilter(), LDAPUsernamePlaceholder) {
+			return fmt.Errorf("user_filter must contain %s", LDAPUsernamePlaceholder)
+		}
+		if _, err := ldap.CompileFilter(c.userFilter()); err != nil {
+			return fmt.Errorf("user_filter: %w", err)
+		}
+	}
+	if c.EmailAttribute != "" && c.UserSearchBase == "" {
+		return fmt.Errorf("email_attribute can only be used with user_search_base")
+	}
+	if c.GroupSearchBase != "" {
+		if _, err := ldap.CompileFilter(c.groupFilter()); err != nil {
+			return fmt.Errorf("group_filter: %w", err)
+		}
+	}
+	if c.BindDN != "" && c.BindPassword == "" {
+		return fmt.Errorf("bind_password must be set when bind_dn is set")
+	}
+	for group, roles := range c.GroupRoleMapping {
+		for _, role := range roles {
+			if err := ValidatePrincipalName(role); err != nil || role == "" {
+				return fmt.Errorf("group_role_mapping for group %q contains invalid role %q", group, role)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *LDAPConfig) userFilter() string {
+	if c.UserFilter == "" {
+		return DefaultLDAPUserFilter
+	}
+	return c.UserFilter
+}
+
+func (c *LDAPConfig) groupFilter() string {
+	if c.GroupFilter == "" {
+		return DefaultLDAPGroupFilter
+	}
+	return c.GroupFilter
+}
+
+func (c *LDAPConfig) groupNameAttribute() string {
+	if c.GroupNameAttribute == "" {
+		return DefaultLDAPGroupNameAttribute
+	}
+	return c.GroupNameAttribute
+}
+
+// BuildProvider prepares an LDAPProvider from this config.
+func (c *LDAPConfig) BuildProvider() *LDAPProvider {
+	timeout := DefaultLDAPTimeout
+	if c.TimeoutSecs != nil {
+		timeout = time.Duration(*c.TimeoutSecs) * time.Second
+	}
+	// The server name is needed to verify the certificate when upgrading with StartTLS
+	var serverName string
+	if u, err := url.Parse(c.URL); err == nil {
+		serverName = u.Hostname()
+	}
+	return &LDAPProvider{
+		LDAPConfig: *c,
+		tlsConfig:  &tls.Config{ServerName: serverName, InsecureSkipVerify: c.InsecureSkipTLSVerify, MinVersion: tls.VersionTLS12},
+		timeout:    timeout,
+	}
+}
+
+// LDAPProvider authenticates users against an LDAP directory.  A new connection is made for each authentication.
+type LDAPProvider struct {
+	LDAPConfig
+	tlsConfig *tls.Config
+	timeout   time.Duration
+}
+
+// Issuer identifies the provider as the source of the roles it grants, which are stored on the user in the same way
+// as roles granted by OpenID Connect providers.
+func (p *LDAPProvider) Issuer() string {
+	return p.URL
+}
+
+// ldapIdentity is the information about an authenticated user read from the directory.
+type ldapIdentity struct {
+	DN     string
+	Email  string
+	Groups []string
+}
+
+// verify checks the given credentials against the directory, returning the user's identity.  Returns a nil identity
+// if the user wasn't found or the password is incorrect, and an error if the directory couldn't be queried.
+func (p *LDAPProvider) verify(ctx context.Context, username, password string) (*ldapIdentity, error) {
+	// An empty password would be an unauthenticated bind, which servers allow without checking credentials
+	if username == "" || password == "" {
+		return nil, nil
+	}
+
+	conn, err := p.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Unbind() }()
+
+	identity := &ldapIdentity{}
+	if p.UserDNTemplate != "" {
+		identity.DN = strings.ReplaceAll(p.UserDNTemplate, LDAPUsernamePlaceholder, escapeLDAPDNValue(username))
+	} else {
+		if err := p.bindServiceAccount(conn); err != nil {
+			return nil, err
+		}
+		filter := strings.ReplaceAll(p.userFilter(), LDAPUsernamePlaceholder, ldap.EscapeFilter(username))
+		var attributes []string
+		if p.EmailAttribute != "" {
+			attributes = append(attributes, p.EmailAttribute)
+		}
+		entries, err := p.search(conn, p.UserSearchBase, filter, attributes, 2)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) != 1 {
+			base.InfofCtx(ctx, base.KeyAuth, "LDAP user search for %q found %d entries", base.UD(username), len(entries))
+			return nil, nil
+		}
+		identity.DN = entries[0].DN
+		if p.EmailAttribute != "" {
+			if emails := entries[0].GetEqualFoldAttributeValues(p.EmailAttribute); len(emails) > 0 {
+				identity.Email = emails[0]
+			}
+		}
+	}
+
+	if err := conn.Bind(identity.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if p.GroupSearchBase != "" {
+		// Search for groups as the service account if there is one, as users may not be able to read groups
+		if err := p.bindServiceAccount(conn); err != nil {
+			return nil, err
+		}
+		filter := strings.ReplaceAll(p.groupFilter(), LDAPUserDNPlaceholder, ldap.EscapeFilter(identity.DN))
+		filter = strings.ReplaceAll(filter, LDAPUsernamePlaceholder, ldap.EscapeFilter(username))
+		groupNameAttribute := p.groupNameAttribute()
+		entries, err := p.search(conn, p.GroupSearchBase, filter, []string{groupNameAttribute}, ldapGroupSizeLimit)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			identity.Groups = append(identity.Groups, entry.GetEqualFoldAttributeValues(groupNameAttribute)...)
+		}
+	}
+	return identity, nil
+}
+
+// dial connects to the directory server, upgrading the connection to TLS with StartTLS if configured.
+func (p *LDAPProvider) dial() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(p.URL, ldap.DialWithDialer(&net.Dialer{Timeout: p.timeout}), ldap.DialWithTLSConfig(p.tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(p.timeout)
+	if p.StartTLS {
+		if err := conn.StartTLS(p.tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("StartTLS failed: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+func (p *LDAPProvider) bindServiceAccount(conn *ldap.Conn) error {
+	if p.BindDN == "" {
+		return nil
+	}
+	if err := conn.Bind(p.BindDN, p.BindPassword); err != nil {
+		return fmt.Errorf("failed to bind as %s: %w", p.BindDN, err)
+	}
+	return nil
+}
+
+// search performs a subtree search, returning at most sizeLimit entries.  Referrals aren't followed.
+func (p *LDAPProvider) search(conn *ldap.Conn, baseDN, filter string, attributes []string, sizeLimit int) ([]*ldap.Entry, error) {
+	request := ldap.NewSearchRequest(baseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, sizeLimit, int(p.timeout/time.Second), false, filter, attributes, nil)
+	result, err := conn.Search(request)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		// The entries up to the size limit are still returned, leaving it to the caller to handle
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result.Entries, nil
+}
+
+// escapeLDAPDNValue escapes a value for substitution into an attribute value of a distinguished name (RFC 4514).
+func escapeLDAPDNValue(value string) string {
+	var escaped strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == 0:
+			escaped.WriteString(`\00`)
+		case strings.IndexByte(`,+"\<>;=`, c) >= 0,
+			i == 0 && (c == '#' || c == ' '),
+			i == len(value)-1 && c == ' ':
+			escaped.WriteByte('\\')
+			escaped.WriteByte(c)
+		default:
+			escaped.WriteByte(c)
+		}
+	}
+	return escaped.String()
+}
+
+// rolesForGroups returns the roles granted for the given groups.
+func (p *LDAPProvider) rolesForGroups(groups []string) base.Set {
+	roles := base.Set{}
+	for _, group := range groups {
+		if p.GroupRoleMapping == nil {
+			if IsValidPrincipalName(group) && group != "" {
+				roles.Add(group)
+			}
+			continue
+		}
+		for _, role := range p.GroupRoleMapping[group] {
+			roles.Add(role)
+		}
+	}
+	return roles
+}
+
+// AuthenticateLDAP verifies the given credentials against the LDAP directory.  Returns the user along with the
+// updates to apply to it, granting the roles mapped from the user's groups.  Returns a nil user if the credentials
+// aren't valid, or the user doesn't exist and the provider doesn't register users.
+func (auth *Authenticator) AuthenticateLDAP(provider *LDAPProvider, username, password string) (User, PrincipalConfig, error) {
+	if !IsValidPrincipalName(username) || username == "" {
+		return nil, PrincipalConfig{}, nil
+	}
+
+	identity, err := provider.verify(auth.LogCtx, username, password)
+	if err != nil || identity == nil {
+		return nil, PrincipalConfig{}, err
+	}
+
+	user, err := auth.GetUser(username)
+	if err != nil {
+		return nil, PrincipalConfig{}, err
+	}
+	if user == nil && provider.Register {
+		base.DebugfCtx(auth.LogCtx, base.KeyAuth, "Registering new LDAP user: %v with email: %v", base.UD(username), base.UD(identity.Email))
+		user, err = auth.RegisterNewUser(username, identity.Email)
+		if err != nil && !base.IsCasMismatch(err) {
+			return nil, PrincipalConfig{}, err
+		}
+	}
+	if user == nil || user.Disabled() {
+		return nil, PrincipalConfig{}, nil
+	}
+
+	now := time.Now()
+	updates := PrincipalConfig{
+		Name:           base.StringPtr(user.Name()),
+		JWTIssuer:      base.StringPtr(provider.Issuer()),
+		JWTRoles:       provider.rolesForGroups(identity.Groups),
+		JWTChannels:    base.Set{},
+		JWTLastUpdated: &now,
+	}
+	if identity.Email != "" {
+		updates.Email = &identity.Email
+	}
+	return user, updates, nil
+}
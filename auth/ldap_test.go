@@ -0,0 +1,302 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package auth
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/couchbase/sync_gateway/base"
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLDAPEscaping(t *testing.T) {
+	assert.Equal(t, `\ a\,b\=c\ `, escapeLDAPDNValue(" a,b=c "))
+	assert.Equal(t, `\#alice`, escapeLDAPDNValue("#alice"))
+}
+
+func TestLDAPConfigValidate(t *testing.T) {
+	testCases := []struct {
+		name        string
+		config      LDAPConfig
+		expectError bool
+	}{
+		{name: "dn template", config: LDAPConfig{URL: "ldap://localhost", UserDNTemplate: "uid={username},dc=example"}},
+		{name: "search", config: LDAPConfig{URL: "ldaps://localhost:636", UserSearchBase: "dc=example", BindDN: "cn=service", BindPassword: "pw"}},
+		{name: "bad scheme", config: LDAPConfig{URL: "http://localhost", UserDNTemplate: "uid={username}"}, expectError: true},
+		{name: "no user config", config: LDAPConfig{URL: "ldap://localhost"}, expectError: true},
+		{name: "both user configs", config: LDAPConfig{URL: "ldap://localhost", UserDNTemplate: "uid={username}", UserSearchBase: "dc=example"}, expectError: true},
+		{name: "template without placeholder", config: LDAPConfig{URL: "ldap://localhost", UserDNTemplate: "uid=alice"}, expectError: true},
+		{name: "invalid filter", config: LDAPConfig{URL: "ldap://localhost", UserSearchBase: "dc=example", UserFilter: "uid={username}"}, expectError: true},
+		{name: "start tls with ldaps", config: LDAPConfig{URL: "ldaps://localhost", StartTLS: true, UserDNTemplate: "uid={username}"}, expectError: true},
+		{name: "bind dn without password", config: LDAPConfig{URL: "ldap://localhost", UserSearchBase: "dc=example", BindDN: "cn=service"}, expectError: true},
+		{name: "invalid mapped role", config: LDAPConfig{URL: "ldap://localhost", UserDNTemplate: "uid={username}", GroupRoleMapping: map[string][]string{"a": {"b:c"}}}, expectError: true},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.config.Validate()
+			if test.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// testLDAPServer is a minimal in-memory directory supporting simple bind and search with and, or, not, equality and
+// presence filters.
+type testLDAPServer struct {
+	listener  net.Listener
+	passwords map[string]string              // password for each DN
+	entries   map[string]map[string][]string // attributes for each DN
+}
+
+func newTestLDAPServer(t *testing.T, passwords map[string]string, entries map[string]map[string][]string) *testLDAPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &testLDAPServer{listener: listener, passwords: passwords, entries: entries}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { _ = listener.Close() })
+	return server
+}
+
+func (s *testLDAPServer) URL() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func (s *testLDAPServer) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	reader := bufio.NewReader(conn)
+	respond := func(messageID int64, op *ber.Packet) {
+		message := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+		message.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, ""))
+		message.AppendChild(op)
+		_, _ = conn.Write(message.Bytes())
+	}
+	result := func(op ber.Tag, code int64) *ber.Packet {
+		response := ber.Encode(ber.ClassApplication, ber.TypeConstructed, op, nil, "")
+		response.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, ""))
+		response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+		response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+		return response
+	}
+
+	for {
+		message, err := ber.ReadPacket(reader)
+		if err != nil || len(message.Children) < 2 {
+			return
+		}
+		messageID, _ := message.Children[0].Value.(int64)
+		op := message.Children[1]
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn, password := op.Children[1].Value.(string), op.Children[2].Data.String()
+			if expected, ok := s.passwords[dn]; (dn == "" && password == "") || (ok && expected == password) {
+				respond(messageID, result(ldap.ApplicationBindResponse, ldap.LDAPResultSuccess))
+			} else {
+				respond(messageID, result(ldap.ApplicationBindResponse, ldap.LDAPResultInvalidCredentials))
+			}
+		case ldap.ApplicationSearchRequest:
+			baseDN, sizeLimit, filter, attributes := op.Children[0].Value.(string), op.Children[3].Value.(int64), op.Children[6], op.Children[7]
+			code := int64(ldap.LDAPResultSuccess)
+			found := int64(0)
+			for dn, entry := range s.entries {
+				if !strings.HasSuffix(dn, baseDN) || !matchTestLDAPFilter(filter, entry) {
+					continue
+				}
+				if sizeLimit > 0 && found == sizeLimit {
+					code = ldap.LDAPResultSizeLimitExceeded
+					break
+				}
+				found++
+				attributesPacket := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+				for _, attribute := range attributes.Children {
+					name := attribute.Value.(string)
+					values := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+					for _, value := range entry[name] {
+						values.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, ""))
+					}
+					attributePacket := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+					attributePacket.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+					attributePacket.AppendChild(values)
+					attributesPacket.AppendChild(attributePacket)
+				}
+				entryPacket := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "")
+				entryPacket.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, ""))
+				entryPacket.AppendChild(attributesPacket)
+				respond(messageID, entryPacket)
+			}
+			respond(messageID, result(ldap.ApplicationSearchResultDone, code))
+		case ldap.ApplicationUnbindRequest:
+			return
+		default:
+			respond(messageID, result(ldap.ApplicationExtendedResponse, ldap.LDAPResultProtocolError))
+		}
+	}
+}
+
+func matchTestLDAPFilter(filter *ber.Packet, entry map[string][]string) bool {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			if !matchTestLDAPFilter(child, entry) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, child := range filter.Children {
+			if matchTestLDAPFilter(child, entry) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return !matchTestLDAPFilter(filter.Children[0], entry)
+	case ldap.FilterEqualityMatch:
+		for _, value := range entry[filter.Children[0].Value.(string)] {
+			if strings.EqualFold(value, filter.Children[1].Value.(string)) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterPresent:
+		return len(entry[filter.Data.String()]) > 0
+	}
+	return false
+}
+
+func TestAuthenticateLDAP(t *testing.T) {
+	const (
+		aliceDN   = "uid=alice,ou=people,dc=example,dc=com"
+		bobDN     = "uid=bob,ou=people,dc=example,dc=com"
+		serviceDN = "cn=service,dc=example,dc=com"
+	)
+	server := newTestLDAPServer(t,
+		map[string]string{aliceDN: "wonderland", bobDN: "builder", serviceDN: "servicepw"},
+		map[string]map[string][]string{
+			aliceDN:                                  {"uid": {"alice"}, "mail": {"alice@example.com"}},
+			bobDN:                                    {"uid": {"bob"}},
+			"uid=dave,ou=people,dc=example,dc=com":   {"uid": {"dave"}},
+			"cn=editors,ou=groups,dc=example,dc=com": {"cn": {"editors"}, "member": {aliceDN, bobDN}},
+			"cn=admins,ou=groups,dc=example,dc=com":  {"cn": {"admins"}, "member": {aliceDN}},
+		})
+
+	testBucket := base.GetTestBucket(t)
+	defer testBucket.Close()
+	auth := NewAuthenticator(testBucket, nil, DefaultAuthenticatorOptions())
+
+	t.Run("dn template", func(t *testing.T) {
+		config := &LDAPConfig{
+			URL:             server.URL(),
+			UserDNTemplate:  "uid={username},ou=people,dc=example,dc=com",
+			GroupSearchBase: "ou=groups,dc=example,dc=com",
+			Register:        true,
+		}
+		require.NoError(t, config.Validate())
+		provider := config.BuildProvider()
+
+		user, updates, err := auth.AuthenticateLDAP(provider, "bob", "builder")
+		require.NoError(t, err)
+		require.NotNil(t, user)
+		assert.Equal(t, "bob", user.Name())
+		assert.Equal(t, server.URL(), *updates.JWTIssuer)
+		assert.Equal(t, base.SetOf("editors"), updates.JWTRoles)
+		assert.Nil(t, updates.Email)
+
+		user, _, err = auth.AuthenticateLDAP(provider, "bob", "wrong")
+		require.NoError(t, err)
+		assert.Nil(t, user)
+
+		// An empty password must not be accepted as an unauthenticated bind
+		user, _, err = auth.AuthenticateLDAP(provider, "bob", "")
+		require.NoError(t, err)
+		assert.Nil(t, user)
+	})
+
+	t.Run("search", func(t *testing.T) {
+		config := &LDAPConfig{
+			URL:              server.URL(),
+			BindDN:           serviceDN,
+			BindPassword:     "servicepw",
+			UserSearchBase:   "ou=people,dc=example,dc=com",
+			EmailAttribute:   "mail",
+			GroupSearchBase:  "ou=groups,dc=example,dc=com",
+			GroupRoleMapping: map[string][]string{"admins": {"admin", "editor"}},
+		}
+		require.NoError(t, config.Validate())
+		provider := config.BuildProvider()
+
+		// alice doesn't exist in Sync Gateway and users aren't registered
+		user, _, err := auth.AuthenticateLDAP(provider, "alice", "wonderland")
+		require.NoError(t, err)
+		assert.Nil(t, user)
+
+		existing, err := auth.NewUser("alice", "localpassword", nil)
+		require.NoError(t, err)
+		require.NoError(t, auth.Save(existing))
+
+		user, updates, err := auth.AuthenticateLDAP(provider, "alice", "wonderland")
+		require.NoError(t, err)
+		require.NotNil(t, user)
+		assert.Equal(t, base.SetOf("admin", "editor"), updates.JWTRoles)
+		require.NotNil(t, updates.Email)
+		assert.Equal(t, "alice@example.com", *updates.Email)
+
+		// Unknown users aren't found by the search
+		user, _, err = auth.AuthenticateLDAP(provider, "carol", "wonderland")
+		require.NoError(t, err)
+		assert.Nil(t, user)
+
+		// Filter values are escaped
+		user, _, err = auth.AuthenticateLDAP(provider, "al*", "wonderland")
+		require.NoError(t, err)
+		assert.Nil(t, user)
+	})
+
+	t.Run("ambiguous search", func(t *testing.T) {
+		// The filter matches every user, exceeding the search's size limit
+		config := &LDAPConfig{
+			URL:            server.URL(),
+			BindDN:         serviceDN,
+			BindPassword:   "servicepw",
+			UserSearchBase: "ou=people,dc=example,dc=com",
+			UserFilter:     "(|(uid={username})(uid=*))",
+		}
+		require.NoError(t, config.Validate())
+		user, _, err := auth.AuthenticateLDAP(config.BuildProvider(), "alice", "wonderland")
+		require.NoError(t, err)
+		assert.Nil(t, user)
+	})
+
+	t.Run("service account bind failure", func(t *testing.T) {
+		config := &LDAPConfig{
+			URL:            server.URL(),
+			BindDN:         serviceDN,
+			BindPassword:   "wrong",
+			UserSearchBase: "ou=people,dc=example,dc=com",
+		}
+		_, _, err := auth.AuthenticateLDAP(config.BuildProvider(), "alice", "wonderland")
+		assert.Error(t, err)
+	})
+}
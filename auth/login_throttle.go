@@ -0,0 +1,294 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package auth
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultLoginMaxFailures         = 5
+	DefaultLoginInitialBackoffMs    = 500
+	DefaultLoginMaxBackoffMs        = 30000
+	DefaultLoginLockoutDurationSecs = 900
+	DefaultLoginFailureWindowSecs   = 900
+)
+
+// LoginThrottleConfig configures tracking of failed password logins, per user name and per source IP address.  Each
+// failure blocks further attempts for an exponentially increasing backoff period, and reaching MaxFailures locks out
+// further attempts for LockoutDurationSecs.
+//
+// Tracking per user name lets anyone who knows a user's name lock them out, by repeatedly failing to log in as them.
+// Where that's a concern, disable TrackUsername to only throttle the sources of the failures.
+type LoginThrottleConfig struct {
+	MaxFailures         int   `json:"max_failures,omitempty"`          // Consecutive failures that trigger a lockout - defaults to 5
+	InitialBackoffMs    int   `json:"initial_backoff_ms,omitempty"`    // Backoff after the first failure, doubled on each further failure - defaults to 500
+	MaxBackoffMs        int   `json:"max_backoff_ms,omitempty"`        // Upper bound on the backoff between failures - defaults to 30000
+	LockoutDurationSecs int   `json:"lockout_duration_secs,omitempty"` // How long a lockout lasts - defaults to 900
+	FailureWindowSecs   int   `json:"failure_window_secs,omitempty"`   // Failures older than this are forgotten - defaults to 900
+	TrackUsername       *bool `json:"track_username,omitempty"`        // Whether failures are tracked per user name - defaults to true
+	TrackSourceIP       *bool `json:"track_source_ip,omitempty"`       // Whether failures are also tracked per source IP address - defaults to true
+}
+
+// Validate ensures the config's settings are valid.
+func (c *LoginThrottleConfig) Validate() error {
+	if c.MaxFailures < 0 {
+		return fmt.Errorf("max_failures must not be negative")
+	}
+	if c.InitialBackoffMs < 0 || c.MaxBackoffMs < 0 {
+		return fmt.Errorf("backoff durations must not be negative")
+	}
+	if c.InitialBackoffMs > 0 && c.MaxBackoffMs > 0 && c.InitialBackoffMs > c.MaxBackoffMs {
+		return fmt.Errorf("initial_backoff_ms must not be greater than max_backoff_ms")
+	}
+	if c.LockoutDurationSecs < 0 {
+		return fmt.Errorf("lockout_duration_secs must not be negative")
+	}
+	if c.FailureWindowSecs < 0 {
+		return fmt.Errorf("failure_window_secs must not be negative")
+	}
+	if c.TrackUsername != nil && !*c.TrackUsername && c.TrackSourceIP != nil && !*c.TrackSourceIP {
+		return fmt.Errorf("at least one of track_username or track_source_ip must be enabled")
+	}
+	return nil
+}
+
+// LoginThrottledError is returned for login attempts made while a user or source is backing off or locked out.
+type LoginThrottledError struct {
+	RetryAfter time.Duration // Time until another attempt will be allowed
+	LockedOut  bool          // True if the limit on failures was reached, false during backoff between failures
+}
+
+func (e *LoginThrottledError) Error() string {
+	if e.LockedOut {
+		return fmt.Sprintf("too many failed login attempts, locked out for %v", e.RetryAfter.Round(time.Second))
+	}
+	return fmt.Sprintf("login attempted too soon after a failure, retry in %v", e.RetryAfter.Round(time.Millisecond))
+}
+
+// loginFailures tracks the recent failed logins of a single user or source.
+type loginFailures struct {
+	key          string
+	count        int
+	lastFailure  time.Time
+	blockedUntil time.Time
+	lockedOut    bool
+}
+
+// loginFailureTracker holds the failure records of either users or sources, ordered by their most recent failure so
+// that expired records can be removed without scanning every record.
+type loginFailureTracker struct {
+	records map[string]*list.Element // Elements hold a *loginFailures
+	order   *list.List               // Least recent failure first
+}
+
+func newLoginFailureTracker() *loginFailureTracker {
+	return &loginFailureTracker{records: make(map[string]*list.Element), order: list.New()}
+}
+
+// get returns the record for the given key, or nil if there isn't one.
+func (tr *loginFailureTracker) get(key string) *loginFailures {
+	if element, ok := tr.records[key]; ok {
+		return element.Value.(*loginFailures)
+	}
+	return nil
+}
+
+// touch returns the record for the given key, creating it if needed, and moves it to the back of the order.  Callers
+// must then set its lastFailure to the current time.
+func (tr *loginFailureTracker) touch(key string) *loginFailures {
+	if element, ok := tr.records[key]; ok {
+		tr.order.MoveToBack(element)
+		return element.Value.(*loginFailures)
+	}
+	failures := &loginFailures{key: key}
+	tr.records[key] = tr.order.PushBack(failures)
+	return failures
+}
+
+func (tr *loginFailureTracker) remove(key string) {
+	if element, ok := tr.records[key]; ok {
+		tr.order.Remove(element)
+		delete(tr.records, key)
+	}
+}
+
+// pruneBefore removes the records whose most recent failure is before the given time.  Only the removed records are
+// visited, as they're at the front of the order.
+func (tr *loginFailureTracker) pruneBefore(cutoff time.Time) {
+	for element := tr.order.Front(); element != nil; element = tr.order.Front() {
+		failures := element.Value.(*loginFailures)
+		if !failures.lastFailure.Before(cutoff) {
+			return
+		}
+		tr.order.Remove(element)
+		delete(tr.records, failures.key)
+	}
+}
+
+// LoginThrottle tracks failed logins for a database.  Unlike the Authenticator, which is created per request, a
+// single LoginThrottle is shared by all requests to the database.
+type LoginThrottle struct {
+	maxFailures     int
+	initialBackoff  time.Duration
+	maxBackoff      time.Duration
+	lockoutDuration time.Duration
+	failureWindow   time.Duration
+	trackUsername   bool
+	trackSourceIP   bool
+
+	lock    sync.Mutex
+	users   *loginFailureTracker
+	sources *loginFailureTracker
+	now     func() time.Time // Overridden in tests
+}
+
+// NewLoginThrottle creates a LoginThrottle from the given config, applying defaults to unset values.
+func NewLoginThrottle(config LoginThrottleConfig) *LoginThrottle {
+	t := &LoginThrottle{
+		maxFailures:     DefaultLoginMaxFailures,
+		initialBackoff:  DefaultLoginInitialBackoffMs * time.Millisecond,
+		maxBackoff:      DefaultLoginMaxBackoffMs * time.Millisecond,
+		lockoutDuration: DefaultLoginLockoutDurationSecs * time.Second,
+		failureWindow:   DefaultLoginFailureWindowSecs * time.Second,
+		trackUsername:   config.TrackUsername == nil || *config.TrackUsername,
+		trackSourceIP:   config.TrackSourceIP == nil || *config.TrackSourceIP,
+		users:           newLoginFailureTracker(),
+		sources:         newLoginFailureTracker(),
+		now:             time.Now,
+	}
+	if config.MaxFailures > 0 {
+		t.maxFailures = config.MaxFailures
+	}
+	if config.InitialBackoffMs > 0 {
+		t.initialBackoff = time.Duration(config.InitialBackoffMs) * time.Millisecond
+	}
+	if config.MaxBackoffMs > 0 {
+		t.maxBackoff = time.Duration(config.MaxBackoffMs) * time.Millisecond
+	}
+	if config.LockoutDurationSecs > 0 {
+		t.lockoutDuration = time.Duration(config.LockoutDurationSecs) * time.Second
+	}
+	if config.FailureWindowSecs > 0 {
+		t.failureWindow = time.Duration(config.FailureWindowSecs) * time.Second
+	}
+	return t
+}
+
+// CheckLogin returns a *LoginThrottledError if login attempts for the given user or from the given source IP are
+// currently blocked.  An empty sourceIP isn't tracked.
+func (t *LoginThrottle) CheckLogin(username, sourceIP string) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := t.now()
+	var throttledErr *LoginThrottledError
+	for _, failures := range t.trackedFailures(username, sourceIP, false) {
+		if failures == nil || !now.Before(failures.blockedUntil) {
+			continue
+		}
+		retryAfter := failures.blockedUntil.Sub(now)
+		if throttledErr == nil || retryAfter > throttledErr.RetryAfter {
+			throttledErr = &LoginThrottledError{RetryAfter: retryAfter, LockedOut: failures.lockedOut}
+		}
+	}
+	if throttledErr != nil {
+		return throttledErr
+	}
+	return nil
+}
+
+// RecordFailure records a failed login for the given user and source IP.  Returns true if the failure triggered a
+// lockout of either.
+func (t *LoginThrottle) RecordFailure(username, sourceIP string) (lockedOut bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := t.now()
+	for _, failures := range t.trackedFailures(username, sourceIP, true) {
+		if failures == nil {
+			continue
+		}
+		// Forget failures that are outside the window, or from a lockout that has ended
+		if now.Sub(failures.lastFailure) > t.failureWindow || (failures.lockedOut && !now.Before(failures.blockedUntil)) {
+			*failures = loginFailures{key: failures.key}
+		}
+		failures.count++
+		failures.lastFailure = now
+		if failures.count >= t.maxFailures {
+			if !failures.lockedOut {
+				lockedOut = true
+			}
+			failures.lockedOut = true
+			failures.blockedUntil = now.Add(t.lockoutDuration)
+		} else {
+			failures.blockedUntil = now.Add(t.backoff(failures.count))
+		}
+	}
+	t.pruneExpired(now)
+	return lockedOut
+}
+
+// RecordSuccess clears the failures recorded for the given user.  Failures for the source IP are retained, so that a
+// single valid account can't be used to reset the tracking of a source guessing at other accounts.
+func (t *LoginThrottle) RecordSuccess(username string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.users.remove(username)
+}
+
+// backoff returns the time to block attempts after the given number of consecutive failures.
+func (t *LoginThrottle) backoff(failureCount int) time.Duration {
+	backoff := t.initialBackoff
+	for i := 1; i < failureCount && backoff < t.maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > t.maxBackoff {
+		backoff = t.maxBackoff
+	}
+	return backoff
+}
+
+// trackedFailures returns the failure records for the user and source, creating them and moving them to the back of
+// the order if create is true.  Entries are nil when not tracked.  Requires the lock to be held.
+func (t *LoginThrottle) trackedFailures(username, sourceIP string, create bool) []*loginFailures {
+	lookup := func(tracker *loginFailureTracker, key string) *loginFailures {
+		if create {
+			return tracker.touch(key)
+		}
+		return tracker.get(key)
+	}
+	var result []*loginFailures
+	if t.trackUsername {
+		result = append(result, lookup(t.users, username))
+	}
+	if t.trackSourceIP && sourceIP != "" {
+		result = append(result, lookup(t.sources, sourceIP))
+	}
+	return result
+}
+
+// pruneExpired removes records that can no longer block attempts or count towards a lockout, to bound memory use
+// when many names or sources are attempted.  Requires the lock to be held.
+func (t *LoginThrottle) pruneExpired(now time.Time) {
+	// A record is blocking for at most the longer of the lockout and the maximum backoff after its last failure
+	retention := t.failureWindow
+	if t.lockoutDuration > retention {
+		retention = t.lockoutDuration
+	}
+	if t.maxBackoff > retention {
+		retention = t.maxBackoff
+	}
+	cutoff := now.Add(-retention)
+	t.users.pruneBefore(cutoff)
+	t.sources.pruneBefore(cutoff)
+}
@@ -0,0 +1,156 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginThrottleConfigValidate(t *testing.T) {
+	testCases := []struct {
+		name        string
+		config      LoginThrottleConfig
+		expectError bool
+	}{
+		{name: "default", config: LoginThrottleConfig{}},
+		{name: "custom", config: LoginThrottleConfig{MaxFailures: 3, InitialBackoffMs: 100, MaxBackoffMs: 1000, LockoutDurationSecs: 60}},
+		{name: "negative max failures", config: LoginThrottleConfig{MaxFailures: -1}, expectError: true},
+		{name: "initial backoff above max", config: LoginThrottleConfig{InitialBackoffMs: 2000, MaxBackoffMs: 1000}, expectError: true},
+		{name: "negative lockout", config: LoginThrottleConfig{LockoutDurationSecs: -1}, expectError: true},
+		{name: "source ip only", config: LoginThrottleConfig{TrackUsername: base.BoolPtr(false)}},
+		{name: "nothing tracked", config: LoginThrottleConfig{TrackUsername: base.BoolPtr(false), TrackSourceIP: base.BoolPtr(false)}, expectError: true},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.config.Validate()
+			if test.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// newTestLoginThrottle returns a throttle whose clock only advances when the returned function is called.
+func newTestLoginThrottle(config LoginThrottleConfig) (*LoginThrottle, func(time.Duration)) {
+	now := time.Unix(1700000000, 0)
+	throttle := NewLoginThrottle(config)
+	throttle.now = func() time.Time { return now }
+	return throttle, func(d time.Duration) { now = now.Add(d) }
+}
+
+func requireThrottled(t *testing.T, err error, expectedRetryAfter time.Duration, expectedLockedOut bool) {
+	var throttledErr *LoginThrottledError
+	require.ErrorAs(t, err, &throttledErr)
+	assert.Equal(t, expectedRetryAfter, throttledErr.RetryAfter)
+	assert.Equal(t, expectedLockedOut, throttledErr.LockedOut)
+}
+
+func TestLoginThrottleBackoffAndLockout(t *testing.T) {
+	throttle, advance := newTestLoginThrottle(LoginThrottleConfig{MaxFailures: 4, InitialBackoffMs: 100, LockoutDurationSecs: 60})
+
+	require.NoError(t, throttle.CheckLogin("alice", "10.0.0.1"))
+
+	// Each failure doubles the backoff
+	for _, expectedBackoff := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond} {
+		assert.False(t, throttle.RecordFailure("alice", "10.0.0.1"))
+		requireThrottled(t, throttle.CheckLogin("alice", "10.0.0.1"), expectedBackoff, false)
+		advance(expectedBackoff)
+		require.NoError(t, throttle.CheckLogin("alice", "10.0.0.1"))
+	}
+
+	// Reaching max failures locks out the user, from any source
+	assert.True(t, throttle.RecordFailure("alice", "10.0.0.1"))
+	requireThrottled(t, throttle.CheckLogin("alice", "10.0.0.2"), time.Minute, true)
+
+	advance(time.Minute)
+	require.NoError(t, throttle.CheckLogin("alice", "10.0.0.2"))
+
+	// Failures after a lockout start from the beginning
+	assert.False(t, throttle.RecordFailure("alice", "10.0.0.2"))
+	requireThrottled(t, throttle.CheckLogin("alice", "10.0.0.2"), 100*time.Millisecond, false)
+}
+
+func TestLoginThrottleSourceIP(t *testing.T) {
+	throttle, advance := newTestLoginThrottle(LoginThrottleConfig{MaxFailures: 2, LockoutDurationSecs: 60})
+
+	// Failures against different users from the same source lock out the source
+	assert.False(t, throttle.RecordFailure("alice", "10.0.0.1"))
+	advance(time.Second)
+	assert.True(t, throttle.RecordFailure("bob", "10.0.0.1"))
+	requireThrottled(t, throttle.CheckLogin("carol", "10.0.0.1"), time.Minute, true)
+	require.NoError(t, throttle.CheckLogin("carol", "10.0.0.2"))
+
+	// A successful login clears the user's failures but not the source's
+	throttle.RecordSuccess("alice")
+	require.NoError(t, throttle.CheckLogin("alice", "10.0.0.2"))
+	requireThrottled(t, throttle.CheckLogin("alice", "10.0.0.1"), time.Minute, true)
+
+	// Source tracking can be disabled
+	throttle, _ = newTestLoginThrottle(LoginThrottleConfig{MaxFailures: 2, TrackSourceIP: base.BoolPtr(false)})
+	throttle.RecordFailure("alice", "10.0.0.1")
+	require.NoError(t, throttle.CheckLogin("bob", "10.0.0.1"))
+}
+
+func TestLoginThrottleUsername(t *testing.T) {
+	throttle, _ := newTestLoginThrottle(LoginThrottleConfig{MaxFailures: 2, LockoutDurationSecs: 60, TrackUsername: base.BoolPtr(false)})
+
+	// Failures from other sources can't lock out the user
+	assert.False(t, throttle.RecordFailure("alice", "10.0.0.1"))
+	assert.False(t, throttle.RecordFailure("alice", "10.0.0.2"))
+	require.NoError(t, throttle.CheckLogin("alice", "10.0.0.3"))
+
+	// The sources are still throttled
+	assert.True(t, throttle.RecordFailure("alice", "10.0.0.1"))
+	requireThrottled(t, throttle.CheckLogin("alice", "10.0.0.1"), time.Minute, true)
+}
+
+func TestLoginThrottlePruning(t *testing.T) {
+	throttle, advance := newTestLoginThrottle(LoginThrottleConfig{MaxFailures: 2, LockoutDurationSecs: 60, FailureWindowSecs: 10})
+
+	for _, name := range []string{"alice", "bob", "carol"} {
+		throttle.RecordFailure(name, "10.0.0.1")
+		throttle.RecordFailure(name, "10.0.0.1")
+		advance(time.Second)
+	}
+	assert.Equal(t, 3, throttle.users.order.Len())
+	assert.Equal(t, 1, throttle.sources.order.Len())
+
+	// Records are kept while they could still be locked out, even though their failures are outside the window
+	advance(time.Minute - 3*time.Second)
+	throttle.RecordFailure("dave", "10.0.0.2")
+	assert.Equal(t, 4, throttle.users.order.Len())
+	requireThrottled(t, throttle.CheckLogin("carol", ""), 2*time.Second, true)
+
+	// Once the lockouts have ended, the records are removed on the next failure
+	advance(3 * time.Second)
+	throttle.RecordFailure("dave", "10.0.0.2")
+	assert.Equal(t, 1, throttle.users.order.Len())
+	assert.Len(t, throttle.users.records, 1)
+	assert.NotNil(t, throttle.users.get("dave"))
+	assert.Equal(t, 1, throttle.sources.order.Len())
+	assert.NotNil(t, throttle.sources.get("10.0.0.2"))
+}
+
+func TestLoginThrottleFailureWindow(t *testing.T) {
+	throttle, advance := newTestLoginThrottle(LoginThrottleConfig{MaxFailures: 2, FailureWindowSecs: 10})
+
+	assert.False(t, throttle.RecordFailure("alice", ""))
+	advance(11 * time.Second)
+
+	// The earlier failure is outside the window, so doesn't count towards the lockout
+	assert.False(t, throttle.RecordFailure("alice", ""))
+	assert.True(t, throttle.RecordFailure("alice", ""))
+}
@@ -65,6 +65,12 @@ const (
 	// metadata sync time when half of the duration between provider metadata expiry and now is
 	// grater than 1 minute.
 	MinProviderConfigSyncInterval = time.Minute
+
+	// BackchannelLogoutEvent is the member of the events claim that identifies a back-channel logout token.
+	BackchannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+	claimEvents = "events"
+	claimNonce  = "nonce"
 )
 
 // OIDCDiscoveryRetryWait represents the wait time between provider discovery retries.
@@ -339,10 +345,7 @@ func (op *OIDCProvider) initOIDCClient(ctx context.Context) error {
 	op.client.SetConfig(verifier, metadata.endpoint())
 	op.metadata = metadata
 
-	discoveryURL := op.getDiscoveryEndpoint()
-	if err := op.startDiscoverySync(ctx, discoveryURL); err != nil {
-		base.ErrorfCtx(ctx, "failed to start OpenID Connect discovery sync: %v", err)
-	}
+	op.startDiscoverySync(ctx, op.getDiscoveryEndpoint())
 
 	return nil
 }
@@ -376,8 +379,27 @@ func GetStandardDiscoveryEndpoint(issuer string) string {
 }
 
 // DiscoverConfig initiates the initial metadata provider discovery while initializing the OpenID Connect client.
+// Metadata already cached for the discovery URL is used without being fetched, even if it has expired, as the
+// background discovery sync will refresh it.
 func (op *OIDCProvider) DiscoverConfig(ctx context.Context) (metadata ProviderMetadata, verifier *oidc.IDTokenVerifier, err error) {
 	discoveryURL := op.getDiscoveryEndpoint()
+	cachedMetadata, ok, recentErr := oidcCache.getMetadata(discoveryURL)
+	if ok && cachedMetadata.Issuer == op.Issuer {
+		base.InfofCtx(ctx, base.KeyAuth, "Using cached provider config for discovery endpoint: %s", base.UD(discoveryURL))
+		return cachedMetadata, op.generateVerifier(&cachedMetadata, ctx), nil
+	}
+	if recentErr != nil {
+		return ProviderMetadata{}, nil, fmt.Errorf("provider discovery recently failed: %w", recentErr)
+	}
+
+	defer func() {
+		if err != nil {
+			oidcCache.recordMetadataError(discoveryURL, op.Name, err)
+		} else {
+			// The time-to-live isn't known until the background discovery sync has fetched the metadata itself
+			oidcCache.recordMetadata(discoveryURL, op.Name, metadata, 0)
+		}
+	}()
 	if !op.isStandardDiscovery() {
 		base.InfofCtx(ctx, base.KeyAuth, "Fetching provider config from explicitly defined discovery endpoint: %s", base.UD(discoveryURL))
 		metadata, _, _, err = op.fetchCustomProviderConfig(ctx, discoveryURL)
@@ -531,31 +553,38 @@ func (op *OIDCProvider) fetchCustomProviderConfig(ctx context.Context, discovery
 }
 
 // runDiscoverySync runs the discovery sync by fetching the provider metadata by calling
-// fetchCustomProviderConfig. If fetchCustomProviderConfig detects any change in provider
-// config, it sets the verifier, OAuth endpoints and returns the time interval between now
-// and next discovery sync.
+// fetchCustomProviderConfig, unless another provider has already refreshed the cached metadata for
+// the discovery URL. If there's any change in provider config, it sets the verifier and OAuth endpoints.
+// Returns the time interval between now and next discovery sync. If the fetch fails, the current config
+// is retained and the next sync is retried with backoff.
 func (op *OIDCProvider) runDiscoverySync(ctx context.Context, discoveryURL string) (time.Duration, error) {
-	metadata, ttl, refresh, err := op.fetchCustomProviderConfig(ctx, discoveryURL)
-	if !refresh || err != nil {
-		return ttl, err
-	}
-	if refresh && !op.isStandardDiscovery() {
-		verifier := op.generateVerifier(&metadata, context.Background())
-		op.client.SetConfig(verifier, metadata.endpoint())
-		op.metadata = metadata
+	metadata, ttl, ok := oidcCache.getFreshMetadata(discoveryURL)
+	refresh := ok && metadata.Issuer == op.Issuer && !reflect.DeepEqual(op.metadata, metadata)
+	if !ok || metadata.Issuer != op.Issuer {
+		var err error
+		metadata, ttl, refresh, err = op.fetchCustomProviderConfig(ctx, discoveryURL)
+		if err != nil {
+			return oidcCache.recordMetadataError(discoveryURL, op.Name, err), err
+		}
+		oidcCache.recordMetadata(discoveryURL, op.Name, metadata, ttl)
 	}
-	if refresh && op.isStandardDiscovery() {
-		metadata, verifier, err := op.standardDiscovery(ctx, discoveryURL)
-		if err != nil || verifier == nil {
-			return 0, pkgerrors.Wrap(err, ErrMsgUnableToDiscoverConfig)
+
+	// Prefetch the provider's keys, so that rotated keys are known before tokens signed with them are presented
+	if metadata.JwksUri != "" {
+		if err := oidcCache.keySet(metadata.JwksUri, op.InsecureSkipVerify).refresh(ctx, MinProviderConfigSyncInterval); err != nil {
+			base.InfofCtx(ctx, base.KeyAuth, "Unable to refresh key set for OpenID Connect provider %s: %v", base.UD(op.Name), err)
 		}
-		op.client.SetConfig(verifier, metadata.endpoint())
+	}
+
+	if refresh {
+		op.client.SetConfig(op.generateVerifier(&metadata, ctx), metadata.endpoint())
 		op.metadata = metadata
 	}
 	return ttl, nil
 }
 
-// generateVerifier returns a verifier manually constructed from a key set and issuer URL.
+// generateVerifier returns a verifier manually constructed from a key set and issuer URL.  The key set is shared
+// with other providers using the same JWKS URI.
 func (op *OIDCProvider) generateVerifier(metadata *ProviderMetadata, ctx context.Context) *oidc.IDTokenVerifier {
 	signingAlgorithms := op.getSigningAlgorithms(metadata)
 	if len(signingAlgorithms.unsupportedAlgorithms) > 0 {
@@ -565,7 +594,7 @@ func (op *OIDCProvider) generateVerifier(metadata *ProviderMetadata, ctx context
 	if len(signingAlgorithms.supportedAlgorithms) > 0 {
 		config.SupportedSigningAlgs = signingAlgorithms.supportedAlgorithms
 	}
-	return oidc.NewVerifier(metadata.Issuer, oidc.NewRemoteKeySet(ctx, metadata.JwksUri), config)
+	return oidc.NewVerifier(metadata.Issuer, oidcCache.keySet(metadata.JwksUri, op.InsecureSkipVerify), config)
 }
 
 // SigningAlgorithms contains the signing algorithms which are supported
@@ -606,6 +635,8 @@ type ProviderMetadata struct {
 	ScopesSupported                   []string `json:"scopes_supported,omitempty"`
 	ClaimsSupported                   []string `json:"claims_supported,omitempty"`
 	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported,omitempty"`
+	EndSessionEndpoint                string   `json:"end_session_endpoint,omitempty"`
+	BackchannelLogoutSupported        bool     `json:"backchannel_logout_supported,omitempty"`
 }
 
 // endpoint returns the OAuth2 auth and token endpoints for the given provider.
@@ -641,6 +672,35 @@ func (op *OIDCProvider) verifyToken(ctx context.Context, token string, callbackU
 	return identity, nil
 }
 
+// EndSessionEndpoint returns the provider's end_session_endpoint used for RP-initiated logout, or an empty string if
+// the provider doesn't advertise one.  The client must have been initialized via GetClient.
+func (op *OIDCProvider) EndSessionEndpoint() string {
+	return op.metadata.EndSessionEndpoint
+}
+
+// VerifyLogoutToken verifies a back-channel logout token issued by the provider, and returns the name of the
+// Sync Gateway user identified by the token's subject.
+// See: https://openid.net/specs/openid-connect-backchannel-1_0.html#Validation
+func (op *OIDCProvider) VerifyLogoutToken(ctx context.Context, token string, callbackURLFunc OIDCCallbackURLFunc) (username string, err error) {
+	identity, err := op.verifyToken(ctx, token, callbackURLFunc)
+	if err != nil {
+		return "", err
+	}
+
+	events, _ := identity.Claims[claimEvents].(map[string]interface{})
+	if _, ok := events[BackchannelLogoutEvent]; !ok {
+		return "", fmt.Errorf("logout token does not contain the %q event", BackchannelLogoutEvent)
+	}
+	if _, ok := identity.Claims[claimNonce]; ok {
+		return "", errors.New("logout token must not contain a nonce claim")
+	}
+	// Sync Gateway sessions aren't associated with the provider's session ID, so logout is only supported by subject
+	if identity.Subject == "" {
+		return "", errors.New("logout token does not contain a subject claim")
+	}
+	return getJWTUsername(op.JWTConfigCommon, identity)
+}
+
 func (op *OIDCProvider) common() JWTConfigCommon {
 	return op.JWTConfigCommon
 }
@@ -684,17 +744,16 @@ func SetURLQueryParam(strURL, name, value string) (string, error) {
 	return uri.String(), nil
 }
 
-// startDiscoverySync starts the provider metadata discovery sync task in background.
-func (op *OIDCProvider) startDiscoverySync(ctx context.Context, discoveryURL string) error {
+// startDiscoverySync starts the provider metadata discovery sync task in background.  The first sync runs
+// immediately, to determine the time-to-live of the metadata and prefetch the provider's keys.
+func (op *OIDCProvider) startDiscoverySync(ctx context.Context, discoveryURL string) {
 	op.terminator = make(chan struct{})
-	duration, err := op.runDiscoverySync(ctx, discoveryURL)
-	if err != nil {
-		return err
-	}
 	go func() {
+		var duration time.Duration
 		for {
 			select {
 			case <-time.After(duration):
+				var err error
 				duration, err = op.runDiscoverySync(ctx, discoveryURL)
 				if err != nil {
 					base.WarnfCtx(ctx, "OpenID Connect provider discovery sync ends up in error: %v, next retry in %v", err, duration)
@@ -705,13 +764,13 @@ func (op *OIDCProvider) startDiscoverySync(ctx context.Context, discoveryURL str
 			}
 		}
 	}()
-	return nil
 }
 
 // stopDiscoverySync stops the currently running metadata discovery sync of this provider.
 func (op *OIDCProvider) stopDiscoverySync() {
 	if op.terminator != nil {
 		close(op.terminator)
+		oidcCache.removeProvider(op.getDiscoveryEndpoint(), op.Name)
 	}
 }
 
@@ -0,0 +1,393 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package auth
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/couchbase/sync_gateway/base"
+	"gopkg.in/square/go-jose.v2"
+)
+
+const (
+	// MaxProviderConfigRetryInterval is the upper bound on the backoff between retries of a failed provider metadata
+	// or key set fetch.
+	MaxProviderConfigRetryInterval = 30 * time.Minute
+
+	// ExpvarKeyOIDCProviders is the key under which the health of cached provider metadata and key sets is published
+	// on _expvar.
+	ExpvarKeyOIDCProviders = "oidc_providers"
+
+	// keySetFetchTimeout bounds the time that requests presenting tokens signed with unknown keys can wait on a key
+	// set fetch.
+	keySetFetchTimeout = 10 * time.Second
+)
+
+// KeySetMinRefetchInterval is the minimum time between fetches of a key set triggered by tokens signed with unknown
+// keys, to prevent such tokens from flooding the provider with requests.
+var KeySetMinRefetchInterval = 10 * time.Second
+
+// oidcCache is the process-wide cache of OpenID Connect provider metadata and key sets.  It's shared by all providers
+// across all databases, so that providers with the same discovery URL or JWKS URI share a single copy.  Cached values
+// are retained when refreshes fail, so that provider outages don't cause authentication failures.
+var oidcCache = newOIDCProviderCache()
+
+func init() {
+	expvar.Publish(ExpvarKeyOIDCProviders, expvar.Func(func() interface{} {
+		return oidcCache.health()
+	}))
+}
+
+// oidcCacheStatus tracks the outcome of fetches of a single cached value.
+type oidcCacheStatus struct {
+	fetchedAt           time.Time // Time of the last successful fetch, zero if never fetched
+	lastError           error     // Error from the last failed fetch, nil if the last fetch succeeded
+	lastErrorAt         time.Time
+	consecutiveFailures int
+}
+
+// recordSuccess records a successful fetch.
+func (s *oidcCacheStatus) recordSuccess(now time.Time) {
+	s.fetchedAt = now
+	s.lastError = nil
+	s.consecutiveFailures = 0
+}
+
+// recordFailure records a failed fetch, and returns the time to wait before retrying.
+func (s *oidcCacheStatus) recordFailure(now time.Time, err error) time.Duration {
+	s.lastError = err
+	s.lastErrorAt = now
+	s.consecutiveFailures++
+	return providerConfigRetryInterval(s.consecutiveFailures)
+}
+
+// recentFailure returns the last error if it happened within the current retry interval and there's no cached value
+// to fall back to, so that requests fail fast rather than waiting on a provider that's known to be unavailable.
+func (s *oidcCacheStatus) recentFailure(now time.Time) error {
+	if s.lastError == nil || !s.fetchedAt.IsZero() {
+		return nil
+	}
+	if now.Sub(s.lastErrorAt) < providerConfigRetryInterval(s.consecutiveFailures) {
+		return s.lastError
+	}
+	return nil
+}
+
+// providerConfigRetryInterval returns the time to wait before retrying after the given number of consecutive
+// failures, doubling from MinProviderConfigSyncInterval up to MaxProviderConfigRetryInterval.
+func providerConfigRetryInterval(consecutiveFailures int) time.Duration {
+	interval := MinProviderConfigSyncInterval
+	for i := 1; i < consecutiveFailures && interval < MaxProviderConfigRetryInterval; i++ {
+		interval *= 2
+	}
+	if interval > MaxProviderConfigRetryInterval {
+		interval = MaxProviderConfigRetryInterval
+	}
+	return interval
+}
+
+// OIDCCacheHealth is the health of a cached provider metadata document or key set, as published on _expvar.
+type OIDCCacheHealth struct {
+	Providers           []string   `json:"providers,omitempty"`       // Names of the providers using the value
+	Healthy             bool       `json:"healthy"`                   // True if the value has been fetched and the last fetch succeeded
+	LastSuccess         *time.Time `json:"last_success,omitempty"`    // Time of the last successful fetch
+	Expires             *time.Time `json:"expires,omitempty"`         // Time after which the value will be refreshed
+	LastError           string     `json:"last_error,omitempty"`      // Error from the last fetch, if it failed
+	LastErrorTime       *time.Time `json:"last_error_time,omitempty"` // Time of the last failed fetch
+	ConsecutiveFailures int        `json:"consecutive_failures"`      // Number of failed fetches since the last success
+}
+
+func (s *oidcCacheStatus) health() OIDCCacheHealth {
+	health := OIDCCacheHealth{
+		Healthy:             !s.fetchedAt.IsZero() && s.lastError == nil,
+		ConsecutiveFailures: s.consecutiveFailures,
+	}
+	if !s.fetchedAt.IsZero() {
+		fetchedAt := s.fetchedAt
+		health.LastSuccess = &fetchedAt
+	}
+	if s.lastError != nil {
+		lastErrorAt := s.lastErrorAt
+		health.LastError = s.lastError.Error()
+		health.LastErrorTime = &lastErrorAt
+	}
+	return health
+}
+
+// cachedProviderMetadata is the cached metadata from a single discovery URL.
+type cachedProviderMetadata struct {
+	oidcCacheStatus
+	metadata  ProviderMetadata
+	expiresAt time.Time
+	providers base.Set // Names of the providers using this discovery URL
+}
+
+// oidcProviderCache caches provider metadata by discovery URL and key sets by JWKS URI.
+type oidcProviderCache struct {
+	lock     sync.Mutex
+	metadata map[string]*cachedProviderMetadata
+	keySets  map[string]*cachedKeySet
+	now      func() time.Time // Overridden in tests
+}
+
+func newOIDCProviderCache() *oidcProviderCache {
+	return &oidcProviderCache{
+		metadata: make(map[string]*cachedProviderMetadata),
+		keySets:  make(map[string]*cachedKeySet),
+		now:      time.Now,
+	}
+}
+
+// getMetadataEntry returns the entry for the discovery URL, creating it if needed.  Requires the lock to be held.
+func (c *oidcProviderCache) getMetadataEntry(discoveryURL string) *cachedProviderMetadata {
+	entry, ok := c.metadata[discoveryURL]
+	if !ok {
+		entry = &cachedProviderMetadata{providers: base.Set{}}
+		c.metadata[discoveryURL] = entry
+	}
+	return entry
+}
+
+// getMetadata returns the cached metadata for the discovery URL, including metadata that has expired but couldn't be
+// refreshed.  Returns false if no metadata has been fetched, along with the error from the most recent fetch if it's
+// not yet time to retry.
+func (c *oidcProviderCache) getMetadata(discoveryURL string) (metadata ProviderMetadata, ok bool, recentErr error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry, found := c.metadata[discoveryURL]
+	if !found {
+		return ProviderMetadata{}, false, nil
+	}
+	if entry.fetchedAt.IsZero() {
+		return ProviderMetadata{}, false, entry.recentFailure(c.now())
+	}
+	return entry.metadata, true, nil
+}
+
+// getFreshMetadata returns the cached metadata for the discovery URL if it hasn't expired, along with the time until
+// it expires.
+func (c *oidcProviderCache) getFreshMetadata(discoveryURL string) (metadata ProviderMetadata, ttl time.Duration, ok bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry, found := c.metadata[discoveryURL]
+	if !found || entry.fetchedAt.IsZero() {
+		return ProviderMetadata{}, 0, false
+	}
+	ttl = entry.expiresAt.Sub(c.now())
+	if ttl <= 0 {
+		return ProviderMetadata{}, 0, false
+	}
+	return entry.metadata, ttl, true
+}
+
+// recordMetadata caches metadata fetched from the discovery URL by the named provider, for the given time-to-live.
+func (c *oidcProviderCache) recordMetadata(discoveryURL, providerName string, metadata ProviderMetadata, ttl time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	now := c.now()
+	entry := c.getMetadataEntry(discoveryURL)
+	entry.providers.Add(providerName)
+	entry.recordSuccess(now)
+	entry.metadata = metadata
+	entry.expiresAt = now.Add(ttl)
+}
+
+// recordMetadataError records a failed fetch from the discovery URL by the named provider.  Any cached metadata is
+// retained.  Returns the time to wait before retrying.
+func (c *oidcProviderCache) recordMetadataError(discoveryURL, providerName string, err error) time.Duration {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry := c.getMetadataEntry(discoveryURL)
+	entry.providers.Add(providerName)
+	return entry.recordFailure(c.now(), err)
+}
+
+// removeProvider removes the named provider from those reported as using the discovery URL.  Cached metadata is
+// retained, so that it can be reused when the provider's database is reloaded.
+func (c *oidcProviderCache) removeProvider(discoveryURL, providerName string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if entry, ok := c.metadata[discoveryURL]; ok {
+		delete(entry.providers, providerName)
+	}
+}
+
+// keySet returns the shared key set for the JWKS URI, creating it if needed.
+func (c *oidcProviderCache) keySet(jwksURI string, insecureSkipVerify bool) *cachedKeySet {
+	key := jwksURI
+	if insecureSkipVerify {
+		key += " (insecure)"
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	keySet, ok := c.keySets[key]
+	if !ok {
+		client := *base.GetHttpClient(insecureSkipVerify)
+		client.Timeout = keySetFetchTimeout
+		keySet = &cachedKeySet{jwksURI: jwksURI, client: &client, now: c.now}
+		c.keySets[key] = keySet
+	}
+	return keySet
+}
+
+// OIDCProvidersHealth is the health of cached provider metadata and key sets published on _expvar.
+type OIDCProvidersHealth struct {
+	Metadata map[string]OIDCCacheHealth `json:"metadata"` // Keyed by discovery URL
+	KeySets  map[string]OIDCCacheHealth `json:"key_sets"` // Keyed by JWKS URI
+}
+
+func (c *oidcProviderCache) health() OIDCProvidersHealth {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	result := OIDCProvidersHealth{
+		Metadata: make(map[string]OIDCCacheHealth, len(c.metadata)),
+		KeySets:  make(map[string]OIDCCacheHealth, len(c.keySets)),
+	}
+	for discoveryURL, entry := range c.metadata {
+		health := entry.health()
+		if !entry.fetchedAt.IsZero() {
+			expiresAt := entry.expiresAt
+			health.Expires = &expiresAt
+		}
+		health.Providers = entry.providers.ToArray()
+		sort.Strings(health.Providers)
+		result.Metadata[discoveryURL] = health
+	}
+	for key, keySet := range c.keySets {
+		result.KeySets[key] = keySet.health()
+	}
+	return result
+}
+
+// cachedKeySet implements oidc.KeySet for a remote JSON web key set.  Keys are refreshed in the background along with
+// the provider metadata, and on demand when a token is signed with an unknown key.  The cached keys are retained when
+// a refresh fails.
+type cachedKeySet struct {
+	jwksURI string
+	client  *http.Client
+	now     func() time.Time
+
+	lock          sync.Mutex
+	status        oidcCacheStatus
+	keys          []jose.JSONWebKey
+	lastAttemptAt time.Time
+	fetchLock     sync.Mutex // Held for the duration of a fetch, so that concurrent refreshes result in a single fetch
+}
+
+func (ks *cachedKeySet) VerifySignature(ctx context.Context, jwt string) ([]byte, error) {
+	jws, err := jose.ParseSigned(jwt)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: malformed jwt: %v", err)
+	}
+	keyID := ""
+	for _, signature := range jws.Signatures {
+		keyID = signature.Header.KeyID
+		break
+	}
+
+	if payload, ok := ks.verify(jws, keyID); ok {
+		return payload, nil
+	}
+
+	// The provider may have rotated its keys since the last refresh
+	if err := ks.refresh(ctx, KeySetMinRefetchInterval); err != nil {
+		return nil, fmt.Errorf("fetching keys: %w", err)
+	}
+	if payload, ok := ks.verify(jws, keyID); ok {
+		return payload, nil
+	}
+	return nil, errors.New("failed to verify id token signature")
+}
+
+// verify verifies the signature with the cached keys.
+func (ks *cachedKeySet) verify(jws *jose.JSONWebSignature, keyID string) ([]byte, bool) {
+	ks.lock.Lock()
+	keys := ks.keys
+	ks.lock.Unlock()
+	for i := range keys {
+		if keyID != "" && keys[i].KeyID != keyID {
+			continue
+		}
+		if payload, err := jws.Verify(&keys[i]); err == nil {
+			return payload, true
+		}
+	}
+	return nil, false
+}
+
+// refresh fetches the key set, unless a fetch was attempted within minInterval.  Cached keys are retained if the
+// fetch fails.
+func (ks *cachedKeySet) refresh(ctx context.Context, minInterval time.Duration) error {
+	ks.fetchLock.Lock()
+	defer ks.fetchLock.Unlock()
+
+	ks.lock.Lock()
+	if !ks.lastAttemptAt.IsZero() && ks.now().Sub(ks.lastAttemptAt) < minInterval {
+		err := ks.status.lastError
+		ks.lock.Unlock()
+		return err
+	}
+	ks.lastAttemptAt = ks.now()
+	ks.lock.Unlock()
+
+	keys, err := ks.fetch()
+
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+	if err != nil {
+		ks.status.recordFailure(ks.now(), err)
+		base.WarnfCtx(ctx, "Unable to fetch OpenID Connect key set from %s, continuing with %d cached keys: %v", base.UD(ks.jwksURI), len(ks.keys), err)
+		return err
+	}
+	ks.status.recordSuccess(ks.now())
+	ks.keys = keys
+	return nil
+}
+
+// fetch fetches the key set.  The request isn't bound to the caller's context, as the fetched keys are shared by
+// other requests.
+func (ks *cachedKeySet) fetch() ([]jose.JSONWebKey, error) {
+	req, err := http.NewRequest(http.MethodGet, ks.jwksURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := ks.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unsuccessful response: %s", resp.Status)
+	}
+	var keySet jose.JSONWebKeySet
+	if err := base.JSONUnmarshal(body, &keySet); err != nil {
+		return nil, fmt.Errorf("unable to decode keys: %w", err)
+	}
+	return keySet.Keys, nil
+}
+
+func (ks *cachedKeySet) health() OIDCCacheHealth {
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+	return ks.status.health()
+}
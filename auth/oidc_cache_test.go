@@ -0,0 +1,148 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+)
+
+func TestProviderConfigRetryInterval(t *testing.T) {
+	assert.Equal(t, MinProviderConfigSyncInterval, providerConfigRetryInterval(1))
+	assert.Equal(t, 2*MinProviderConfigSyncInterval, providerConfigRetryInterval(2))
+	assert.Equal(t, 4*MinProviderConfigSyncInterval, providerConfigRetryInterval(3))
+	assert.Equal(t, MaxProviderConfigRetryInterval, providerConfigRetryInterval(100))
+}
+
+func TestOIDCProviderCacheMetadata(t *testing.T) {
+	const discoveryURL = "https://accounts.example.com/.well-known/openid-configuration"
+	now := time.Now()
+	cache := newOIDCProviderCache()
+	cache.now = func() time.Time { return now }
+
+	// A recent failure with nothing cached fails fast until it's time to retry
+	fetchErr := errors.New("provider unavailable")
+	assert.Equal(t, MinProviderConfigSyncInterval, cache.recordMetadataError(discoveryURL, "foo", fetchErr))
+	_, ok, recentErr := cache.getMetadata(discoveryURL)
+	assert.False(t, ok)
+	assert.Equal(t, fetchErr, recentErr)
+	now = now.Add(MinProviderConfigSyncInterval)
+	_, ok, recentErr = cache.getMetadata(discoveryURL)
+	assert.False(t, ok)
+	assert.NoError(t, recentErr)
+
+	metadata := ProviderMetadata{Issuer: "https://accounts.example.com", JwksUri: "https://accounts.example.com/keys"}
+	cache.recordMetadata(discoveryURL, "foo", metadata, time.Hour)
+	cached, ttl, ok := cache.getFreshMetadata(discoveryURL)
+	require.True(t, ok)
+	assert.Equal(t, metadata, cached)
+	assert.Equal(t, time.Hour, ttl)
+
+	// Expired metadata isn't fresh, but is retained when the refresh fails
+	now = now.Add(time.Hour)
+	_, _, ok = cache.getFreshMetadata(discoveryURL)
+	assert.False(t, ok)
+	cache.recordMetadataError(discoveryURL, "bar", fetchErr)
+	cached, ok, recentErr = cache.getMetadata(discoveryURL)
+	require.True(t, ok)
+	assert.NoError(t, recentErr)
+	assert.Equal(t, metadata, cached)
+
+	health := cache.health().Metadata[discoveryURL]
+	assert.False(t, health.Healthy)
+	assert.Equal(t, []string{"bar", "foo"}, health.Providers)
+	assert.Equal(t, fetchErr.Error(), health.LastError)
+	assert.Equal(t, 1, health.ConsecutiveFailures)
+	require.NotNil(t, health.LastSuccess)
+
+	cache.removeProvider(discoveryURL, "bar")
+	cache.recordMetadata(discoveryURL, "foo", metadata, time.Hour)
+	health = cache.health().Metadata[discoveryURL]
+	assert.True(t, health.Healthy)
+	assert.Equal(t, []string{"foo"}, health.Providers)
+	assert.Equal(t, 0, health.ConsecutiveFailures)
+}
+
+func TestCachedKeySetRotation(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	var lock sync.Mutex
+	keys := []jose.JSONWebKey{{Key: oldKey.Public(), Use: "sig", Algorithm: "RS256", KeyID: "old"}}
+	fail := false
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		fetches++
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body, err := base.JSONMarshal(jose.JSONWebKeySet{Keys: keys})
+		require.NoError(t, err)
+		_, _ = w.Write(body)
+	}))
+	defer server.Close()
+
+	defaultInterval := KeySetMinRefetchInterval
+	KeySetMinRefetchInterval = 0
+	defer func() { KeySetMinRefetchInterval = defaultInterval }()
+
+	ctx := base.TestCtx(t)
+	keySet := newOIDCProviderCache().keySet(server.URL, false)
+	claims := map[string]interface{}{"sub": "alice"}
+	oldToken := CreateTestJWT(t, jose.RS256, oldKey, JWTHeaders{"kid": "old"}, claims)
+	newToken := CreateTestJWT(t, jose.RS256, newKey, JWTHeaders{"kid": "new"}, claims)
+
+	_, err = keySet.VerifySignature(ctx, oldToken)
+	require.NoError(t, err)
+	assert.True(t, keySet.health().Healthy)
+
+	// Tokens signed with cached keys are verified without a fetch
+	_, err = keySet.VerifySignature(ctx, oldToken)
+	require.NoError(t, err)
+	lock.Lock()
+	assert.Equal(t, 1, fetches)
+
+	// A token signed with a rotated key triggers a refetch
+	keys = append(keys, jose.JSONWebKey{Key: newKey.Public(), Use: "sig", Algorithm: "RS256", KeyID: "new"})
+	lock.Unlock()
+	_, err = keySet.VerifySignature(ctx, newToken)
+	require.NoError(t, err)
+
+	// Cached keys are retained when the provider is unavailable
+	lock.Lock()
+	fail = true
+	lock.Unlock()
+	assert.Error(t, keySet.refresh(ctx, 0))
+	_, err = keySet.VerifySignature(ctx, newToken)
+	require.NoError(t, err)
+	health := keySet.health()
+	assert.False(t, health.Healthy)
+	assert.Equal(t, 1, health.ConsecutiveFailures)
+
+	unknownKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, err = keySet.VerifySignature(ctx, CreateTestJWT(t, jose.RS256, unknownKey, JWTHeaders{"kid": "unknown"}, claims))
+	assert.Error(t, err)
+}
@@ -0,0 +1,127 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Names of the password policy rules, as reported by PasswordPolicyError.
+const (
+	PasswordRuleMinLength        = "min_length"
+	PasswordRuleRequireUppercase = "require_uppercase"
+	PasswordRuleRequireLowercase = "require_lowercase"
+	PasswordRuleRequireDigit     = "require_digit"
+	PasswordRuleRequireSymbol    = "require_symbol"
+	PasswordRuleDisallowCommon   = "disallow_common"
+)
+
+// PasswordPolicy defines the rules that passwords for local users must satisfy.
+type PasswordPolicy struct {
+	MinLength            int  `json:"min_length,omitempty"`             // Minimum number of characters
+	RequireUppercase     bool `json:"require_uppercase,omitempty"`      // Require at least one upper case letter
+	RequireLowercase     bool `json:"require_lowercase,omitempty"`      // Require at least one lower case letter
+	RequireDigit         bool `json:"require_digit,omitempty"`          // Require at least one digit
+	RequireSymbol        bool `json:"require_symbol,omitempty"`         // Require at least one character that isn't a letter or digit
+	DisallowCommon       bool `json:"disallow_common,omitempty"`        // Reject commonly used passwords
+	RotationIntervalDays int  `json:"rotation_interval_days,omitempty"` // Number of days after which a password expires and must be changed - 0 means passwords don't expire
+}
+
+// PasswordPolicyError is returned when a password doesn't satisfy a rule of the password policy.
+type PasswordPolicyError struct {
+	Rule   string // The name of the rule that failed
+	Reason string // A description of the rule
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return fmt.Sprintf("password doesn't satisfy the %s rule: %s", e.Rule, e.Reason)
+}
+
+// Validate ensures the policy's settings are valid.
+func (p *PasswordPolicy) Validate() error {
+	if p.MinLength < 0 {
+		return fmt.Errorf("min_length must not be negative")
+	}
+	if p.RotationIntervalDays < 0 {
+		return fmt.Errorf("rotation_interval_days must not be negative")
+	}
+	return nil
+}
+
+// CheckPassword returns a *PasswordPolicyError for the first rule the password doesn't satisfy, or nil if all rules
+// are satisfied.
+func (p *PasswordPolicy) CheckPassword(password string) error {
+	if p == nil {
+		return nil
+	}
+
+	if p.MinLength > 0 && len([]rune(password)) < p.MinLength {
+		return &PasswordPolicyError{Rule: PasswordRuleMinLength, Reason: fmt.Sprintf("must be at least %d characters", p.MinLength)}
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case !unicode.IsLetter(r):
+			hasSymbol = true
+		}
+	}
+	if p.RequireUppercase && !hasUpper {
+		return &PasswordPolicyError{Rule: PasswordRuleRequireUppercase, Reason: "must contain an upper case letter"}
+	}
+	if p.RequireLowercase && !hasLower {
+		return &PasswordPolicyError{Rule: PasswordRuleRequireLowercase, Reason: "must contain a lower case letter"}
+	}
+	if p.RequireDigit && !hasDigit {
+		return &PasswordPolicyError{Rule: PasswordRuleRequireDigit, Reason: "must contain a digit"}
+	}
+	if p.RequireSymbol && !hasSymbol {
+		return &PasswordPolicyError{Rule: PasswordRuleRequireSymbol, Reason: "must contain a character that isn't a letter or digit"}
+	}
+	if p.DisallowCommon && isCommonPassword(password) {
+		return &PasswordPolicyError{Rule: PasswordRuleDisallowCommon, Reason: "must not be a commonly used password"}
+	}
+	return nil
+}
+
+// passwordExpired returns true if a password last changed at the given time has exceeded the rotation interval.
+// Passwords with no recorded change time (set before a rotation interval was configured) don't expire.
+func (p *PasswordPolicy) passwordExpired(lastChanged time.Time) bool {
+	if p == nil || p.RotationIntervalDays == 0 || lastChanged.IsZero() {
+		return false
+	}
+	return time.Since(lastChanged) > time.Duration(p.RotationIntervalDays)*24*time.Hour
+}
+
+// commonPasswords is a list of frequently used passwords rejected by the disallow_common rule.  Comparison is
+// case-insensitive.
+var commonPasswords = map[string]struct{}{
+	"123456": {}, "123456789": {}, "12345678": {}, "12345": {}, "1234567": {}, "1234567890": {}, "111111": {},
+	"000000": {}, "123123": {}, "654321": {}, "666666": {}, "121212": {}, "password": {}, "password1": {},
+	"password123": {}, "passw0rd": {}, "p@ssw0rd": {}, "qwerty": {}, "qwerty123": {}, "qwertyuiop": {},
+	"1q2w3e4r": {}, "1qaz2wsx": {}, "zaq12wsx": {}, "abc123": {}, "iloveyou": {}, "admin": {}, "admin123": {},
+	"welcome": {}, "welcome1": {}, "letmein": {}, "monkey": {}, "dragon": {}, "sunshine": {}, "princess": {},
+	"football": {}, "baseball": {}, "master": {}, "shadow": {}, "superman": {}, "trustno1": {}, "changeme": {},
+	"secret": {}, "login": {}, "starwars": {}, "whatever": {}, "freedom": {}, "hello123": {}, "asdfghjkl": {},
+	"couchbase": {}, "syncgateway": {},
+}
+
+func isCommonPassword(password string) bool {
+	_, ok := commonPasswords[strings.ToLower(password)]
+	return ok
+}
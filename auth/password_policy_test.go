@@ -0,0 +1,84 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordPolicyCheckPassword(t *testing.T) {
+	policy := &PasswordPolicy{
+		MinLength:        8,
+		RequireUppercase: true,
+		RequireLowercase: true,
+		RequireDigit:     true,
+		RequireSymbol:    true,
+		DisallowCommon:   true,
+	}
+
+	testCases := []struct {
+		password     string
+		expectedRule string
+	}{
+		{password: "Sh0rt!", expectedRule: PasswordRuleMinLength},
+		{password: "lowercase1!", expectedRule: PasswordRuleRequireUppercase},
+		{password: "UPPERCASE1!", expectedRule: PasswordRuleRequireLowercase},
+		{password: "NoDigits!!", expectedRule: PasswordRuleRequireDigit},
+		{password: "NoSymbols12", expectedRule: PasswordRuleRequireSymbol},
+		{password: "P@ssw0rd", expectedRule: PasswordRuleDisallowCommon},
+		{password: "C0rrect-Horse"},
+	}
+	for _, test := range testCases {
+		t.Run(test.password, func(t *testing.T) {
+			err := policy.CheckPassword(test.password)
+			if test.expectedRule == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var policyErr *PasswordPolicyError
+			require.ErrorAs(t, err, &policyErr)
+			assert.Equal(t, test.expectedRule, policyErr.Rule)
+		})
+	}
+
+	// A nil policy accepts any password
+	var nilPolicy *PasswordPolicy
+	assert.NoError(t, nilPolicy.CheckPassword("a"))
+}
+
+func TestPasswordPolicyRotation(t *testing.T) {
+	bucket := base.GetTestBucket(t)
+	defer bucket.Close()
+
+	options := DefaultAuthenticatorOptions()
+	options.PasswordPolicy = &PasswordPolicy{RotationIntervalDays: 30}
+	auth := NewAuthenticator(bucket, nil, options)
+
+	user, err := auth.NewUser("alice", "letmein", nil)
+	require.NoError(t, err)
+	assert.True(t, user.Authenticate("letmein"))
+
+	// Expire the password
+	user.(*userImpl).PasswordLastChanged_ = time.Now().Add(-31 * 24 * time.Hour)
+	assert.False(t, user.Authenticate("letmein"))
+
+	// Passwords without a change time don't expire
+	user.(*userImpl).PasswordLastChanged_ = time.Time{}
+	assert.True(t, user.Authenticate("letmein"))
+
+	// Changing the password resets the rotation interval
+	user.(*userImpl).PasswordLastChanged_ = time.Now().Add(-31 * 24 * time.Hour)
+	require.NoError(t, user.SetPassword("n3wPassword"))
+	assert.True(t, user.Authenticate("n3wPassword"))
+}
@@ -84,6 +84,13 @@ type Principal interface {
 // Role is basically the same as Principal, just concrete. Users can inherit channels from Roles.
 type Role interface {
 	Principal
+
+	// The roles this role includes.  Members of this role also inherit the channels of the included roles, and of
+	// any roles those include in turn.
+	IncludedRoles() ch.TimedSet
+
+	// Sets the roles this role includes.
+	SetIncludedRoles(ch.TimedSet)
 }
 
 // A User is a Principal that can log in and have multiple Roles.
@@ -127,6 +134,10 @@ type User interface {
 	JWTLastUpdated() time.Time
 	SetJWTLastUpdated(time.Time)
 
+	// The time after which a guest device user is removed, zero for other users.
+	GuestExpiry() time.Time
+	SetGuestExpiry(time.Time)
+
 	GetRoleInvalSeq() uint64
 
 	SetRoleInvalSeq(uint64)
@@ -168,6 +179,10 @@ type User interface {
 type PrincipalConfig struct {
 	Name             *string  `json:"name,omitempty"`
 	ExplicitChannels base.Set `json:"admin_channels,omitempty"`
+	// Time at which admin channel grants lapse, keyed by channel name.  Channels not listed never expire.
+	ExplicitChannelExpiry map[string]time.Time `json:"admin_channel_expiry,omitempty"`
+	// Fields below only apply to Roles, not Users:
+	IncludedRoles base.Set `json:"included_roles,omitempty"`
 	// Fields below only apply to Users, not Roles:
 	Email             *string  `json:"email,omitempty"`
 	Disabled          *bool    `json:"disabled,omitempty"`
@@ -215,19 +230,37 @@ func (u PrincipalConfig) IsPasswordValid(allowEmptyPass bool) (isValid bool, rea
 	return true, ""
 }
 
+// ExplicitChannelExpiries returns ExplicitChannelExpiry as unix times in seconds, in the form stored on TimedSet entries.
+func (u PrincipalConfig) ExplicitChannelExpiries() map[string]uint32 {
+	if u.ExplicitChannelExpiry == nil {
+		return nil
+	}
+	expiries := make(map[string]uint32, len(u.ExplicitChannelExpiry))
+	for channel, expiry := range u.ExplicitChannelExpiry {
+		expiries[channel] = uint32(expiry.Unix())
+	}
+	return expiries
+}
+
 // Merge returns a new PrincipalConfig that represents the combination of both this and other's changes.
 // If any changes conflict, those of the other take precedence.
 func (u PrincipalConfig) Merge(other PrincipalConfig) PrincipalConfig {
+	explicitChannelExpiry := other.ExplicitChannelExpiry
+	if explicitChannelExpiry == nil {
+		explicitChannelExpiry = u.ExplicitChannelExpiry
+	}
 	return PrincipalConfig{
-		Name:              base.Coalesce(other.Name, u.Name),
-		ExplicitChannels:  base.CoalesceSets(other.ExplicitChannels, u.ExplicitChannels),
-		Email:             base.Coalesce(other.Email, u.Email),
-		Password:          base.Coalesce(other.Password, u.Password),
-		Disabled:          base.Coalesce(other.Disabled, u.Disabled),
-		ExplicitRoleNames: base.CoalesceSets(other.ExplicitRoleNames, u.ExplicitRoleNames),
-		JWTIssuer:         base.Coalesce(other.JWTIssuer, u.JWTIssuer),
-		JWTRoles:          base.CoalesceSets(other.JWTRoles, u.JWTRoles),
-		JWTChannels:       base.CoalesceSets(other.JWTChannels, u.JWTChannels),
-		JWTLastUpdated:    base.Coalesce(other.JWTLastUpdated, u.JWTLastUpdated),
+		Name:                  base.Coalesce(other.Name, u.Name),
+		ExplicitChannels:      base.CoalesceSets(other.ExplicitChannels, u.ExplicitChannels),
+		ExplicitChannelExpiry: explicitChannelExpiry,
+		IncludedRoles:         base.CoalesceSets(other.IncludedRoles, u.IncludedRoles),
+		Email:                 base.Coalesce(other.Email, u.Email),
+		Password:              base.Coalesce(other.Password, u.Password),
+		Disabled:              base.Coalesce(other.Disabled, u.Disabled),
+		ExplicitRoleNames:     base.CoalesceSets(other.ExplicitRoleNames, u.ExplicitRoleNames),
+		JWTIssuer:             base.Coalesce(other.JWTIssuer, u.JWTIssuer),
+		JWTRoles:              base.CoalesceSets(other.JWTRoles, u.JWTRoles),
+		JWTChannels:           base.CoalesceSets(other.JWTChannels, u.JWTChannels),
+		JWTLastUpdated:        base.Coalesce(other.JWTLastUpdated, u.JWTLastUpdated),
 	}
 }
@@ -0,0 +1,157 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package auth
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/couchbase/sync_gateway/base"
+)
+
+// A refresh token, issued alongside a session cookie, that can be exchanged once for a new session and refresh token.
+type RefreshToken struct {
+	Token      string        `json:"token"`
+	Username   string        `json:"username"`
+	Expiration time.Time     `json:"expiration"`
+	Ttl        time.Duration `json:"ttl"`
+	Generation string        `json:"generation,omitempty"` // The user's refresh token generation when the token was issued
+}
+
+// refreshTokenGeneration identifies the refresh tokens issued to a user since their refresh tokens were last revoked.
+// Refresh tokens aren't stored alongside sessions, so can't be found by the user's session query, and are instead
+// revoked by changing the generation.
+type refreshTokenGeneration struct {
+	Generation string `json:"generation"`
+}
+
+// CreateRefreshToken issues a refresh token for the given user, valid for ttl.
+func (auth *Authenticator) CreateRefreshToken(username string, ttl time.Duration) (*RefreshToken, error) {
+	if ttl <= 0 {
+		return nil, base.HTTPErrorf(http.StatusBadRequest, "Invalid refresh token time-to-live")
+	}
+
+	secret, err := base.GenerateRandomSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	generation, err := auth.getRefreshTokenGeneration(username)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken := &RefreshToken{
+		Token:      secret,
+		Username:   username,
+		Expiration: time.Now().Add(ttl),
+		Ttl:        ttl,
+		Generation: generation,
+	}
+	if err := auth.bucket.Set(DocIDForRefreshToken(refreshToken.Token), base.DurationToCbsExpiry(ttl), nil, refreshToken); err != nil {
+		return nil, err
+	}
+	return refreshToken, nil
+}
+
+// RedeemRefreshToken exchanges a refresh token, returning the user it was issued to.  The token is removed so that it
+// can't be used again, and the caller is expected to issue a replacement.  Returns a 401 error if the token is unknown,
+// expired, already redeemed, or the user no longer exists or is disabled.
+func (auth *Authenticator) RedeemRefreshToken(token string) (User, error) {
+	if token == "" || strings.Contains(token, ":") {
+		return nil, base.HTTPErrorf(http.StatusUnauthorized, "Invalid refresh token")
+	}
+
+	docID := DocIDForRefreshToken(token)
+	var refreshToken RefreshToken
+	cas, err := auth.bucket.Get(docID, &refreshToken)
+	if err != nil {
+		if base.IsDocNotFoundError(err) {
+			return nil, base.HTTPErrorf(http.StatusUnauthorized, "Invalid refresh token")
+		}
+		return nil, err
+	}
+
+	// Remove with CAS so that concurrent requests can't both redeem the same token
+	if _, err := auth.bucket.Remove(docID, cas); err != nil {
+		if base.IsCasMismatch(err) || base.IsDocNotFoundError(err) {
+			return nil, base.HTTPErrorf(http.StatusUnauthorized, "Invalid refresh token")
+		}
+		return nil, err
+	}
+
+	// Expiry is normally enforced by the document expiry, but check in case the document hasn't been expired yet
+	if time.Now().After(refreshToken.Expiration) {
+		return nil, base.HTTPErrorf(http.StatusUnauthorized, "Invalid refresh token")
+	}
+
+	// Tokens issued before the user's refresh tokens were revoked can't be redeemed
+	generation, err := auth.getRefreshTokenGeneration(refreshToken.Username)
+	if err != nil {
+		return nil, err
+	}
+	if refreshToken.Generation != generation {
+		base.InfofCtx(auth.LogCtx, base.KeyAuth, "Revoked refresh token redeemed for user %q", base.UD(refreshToken.Username))
+		return nil, base.HTTPErrorf(http.StatusUnauthorized, "Invalid refresh token")
+	}
+
+	user, err := auth.GetUser(refreshToken.Username)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || user.Disabled() {
+		base.InfofCtx(auth.LogCtx, base.KeyAuth, "Refresh token redeemed for missing or disabled user %q", base.UD(refreshToken.Username))
+		return nil, base.HTTPErrorf(http.StatusUnauthorized, "Invalid refresh token")
+	}
+	return user, nil
+}
+
+// DeleteRefreshToken revokes a refresh token, if it was issued to the given user.
+func (auth *Authenticator) DeleteRefreshToken(token string, username string) error {
+	if token == "" || strings.Contains(token, ":") {
+		return base.ErrNotFound
+	}
+	docID := DocIDForRefreshToken(token)
+	var refreshToken RefreshToken
+	if _, err := auth.bucket.Get(docID, &refreshToken); err != nil {
+		return err
+	}
+	if refreshToken.Username != username {
+		return base.ErrNotFound
+	}
+	return auth.bucket.Delete(docID)
+}
+
+// RevokeRefreshTokens revokes all of the refresh tokens issued to the given user.
+func (auth *Authenticator) RevokeRefreshTokens(username string) error {
+	generation, err := base.GenerateRandomSecret()
+	if err != nil {
+		return err
+	}
+	return auth.bucket.Set(docIDForRefreshTokenGeneration(username), 0, nil, refreshTokenGeneration{Generation: generation})
+}
+
+// getRefreshTokenGeneration returns the user's current refresh token generation, which is empty if their refresh
+// tokens have never been revoked.
+func (auth *Authenticator) getRefreshTokenGeneration(username string) (string, error) {
+	var generation refreshTokenGeneration
+	if _, err := auth.bucket.Get(docIDForRefreshTokenGeneration(username), &generation); err != nil && !base.IsDocNotFoundError(err) {
+		return "", err
+	}
+	return generation.Generation, nil
+}
+
+func DocIDForRefreshToken(token string) string {
+	return base.RefreshTokenPrefix + token
+}
+
+func docIDForRefreshTokenGeneration(username string) string {
+	return base.RefreshTokenGenerationPrefix + username
+}
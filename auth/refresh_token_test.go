@@ -0,0 +1,79 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package auth
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefreshToken(t *testing.T) {
+	testBucket := base.GetTestBucket(t)
+	defer testBucket.Close()
+
+	auth := NewAuthenticator(testBucket, nil, DefaultAuthenticatorOptions())
+	user, err := auth.NewUser("alice", "letmein", nil)
+	require.NoError(t, err)
+	require.NoError(t, auth.Save(user))
+
+	// Refresh tokens must have a positive TTL
+	_, err = auth.CreateRefreshToken("alice", 0)
+	assert.Error(t, err)
+
+	refreshToken, err := auth.CreateRefreshToken("alice", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", refreshToken.Username)
+	assert.False(t, strings.HasPrefix(DocIDForRefreshToken(refreshToken.Token), base.SessionPrefix))
+
+	// Redeeming returns the user, and the token can only be redeemed once
+	redeemedUser, err := auth.RedeemRefreshToken(refreshToken.Token)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", redeemedUser.Name())
+	_, err = auth.RedeemRefreshToken(refreshToken.Token)
+	assertUnauthorized(t, err)
+
+	// Tokens can only be revoked by the user they were issued to
+	refreshToken, err = auth.CreateRefreshToken("alice", time.Hour)
+	require.NoError(t, err)
+	assert.Error(t, auth.DeleteRefreshToken(refreshToken.Token, "bob"))
+	require.NoError(t, auth.DeleteRefreshToken(refreshToken.Token, "alice"))
+	_, err = auth.RedeemRefreshToken(refreshToken.Token)
+	assertUnauthorized(t, err)
+
+	// Revoking the user's refresh tokens revokes tokens issued before, but not after, the revocation
+	revokedToken, err := auth.CreateRefreshToken("alice", time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, auth.RevokeRefreshTokens("alice"))
+	_, err = auth.RedeemRefreshToken(revokedToken.Token)
+	assertUnauthorized(t, err)
+	refreshToken, err = auth.CreateRefreshToken("alice", time.Hour)
+	require.NoError(t, err)
+	_, err = auth.RedeemRefreshToken(refreshToken.Token)
+	require.NoError(t, err)
+
+	// Tokens for disabled users can't be redeemed
+	refreshToken, err = auth.CreateRefreshToken("alice", time.Hour)
+	require.NoError(t, err)
+	user.SetDisabled(true)
+	require.NoError(t, auth.Save(user))
+	_, err = auth.RedeemRefreshToken(refreshToken.Token)
+	assertUnauthorized(t, err)
+}
+
+func assertUnauthorized(t *testing.T, err error) {
+	require.Error(t, err)
+	status, _ := base.ErrorAsHTTPStatus(err)
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
@@ -27,6 +27,7 @@ import (
 type roleImpl struct {
 	Name_             string          `json:"name,omitempty"`
 	ExplicitChannels_ ch.TimedSet     `json:"admin_channels,omitempty"`
+	IncludedRoles_    ch.TimedSet     `json:"included_roles,omitempty"` // Roles whose channels are inherited by this role's members
 	Channels_         ch.TimedSet     `json:"all_channels"`
 	Sequence_         uint64          `json:"sequence"`
 	ChannelHistory_   TimedSetHistory `json:"channel_history,omitempty"`   // Added to when a previously granted channel is revoked. Calculated inside of rebuildChannels.
@@ -273,6 +274,14 @@ func (role *roleImpl) SetExplicitChannels(channels ch.TimedSet, invalSeq uint64)
 	role.SetChannelInvalSeq(invalSeq)
 }
 
+func (role *roleImpl) IncludedRoles() ch.TimedSet {
+	return role.IncludedRoles_
+}
+
+func (role *roleImpl) SetIncludedRoles(roles ch.TimedSet) {
+	role.IncludedRoles_ = roles
+}
+
 func (role *roleImpl) GetChannelInvalSeq() uint64 {
 	return role.ChannelInvalSeq
 }
@@ -301,9 +310,41 @@ func (role *roleImpl) validate() error {
 	if !IsValidPrincipalName(role.Name_) {
 		return base.HTTPErrorf(http.StatusBadRequest, "Invalid name %q", role.Name_)
 	}
+	if role.IncludedRoles_.Contains(role.Name_) {
+		return base.HTTPErrorf(http.StatusBadRequest, "Role %q can't include itself", role.Name_)
+	}
 	return role.ExplicitChannels_.Validate()
 }
 
+// ValidateIncludedRoles returns an error if making the named role include the given roles would create a cycle, i.e.
+// if the role is reachable from any of the included roles.  Included roles that don't exist yet are allowed, as with
+// a user's admin_roles.
+func (auth *Authenticator) ValidateIncludedRoles(name string, includedRoles base.Set) error {
+	visited := base.Set{}
+	pending := includedRoles.ToArray()
+	for len(pending) > 0 {
+		roleName := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if roleName == name {
+			return base.HTTPErrorf(http.StatusBadRequest, "Including roles %v in role %q would create a cycle", includedRoles.ToArray(), name)
+		}
+		if visited.Contains(roleName) {
+			continue
+		}
+		visited.Add(roleName)
+
+		role, err := auth.GetRole(roleName)
+		if err != nil {
+			return err
+		}
+		if role == nil {
+			continue
+		}
+		pending = append(pending, role.IncludedRoles().AllKeys()...)
+	}
+	return nil
+}
+
 //////// CHANNEL AUTHORIZATION:
 
 func (role *roleImpl) UnauthError(message string) error {
@@ -9,6 +9,7 @@
 package auth
 
 import (
+	"net"
 	"net/http"
 	"time"
 
@@ -23,6 +24,10 @@ type LoginSession struct {
 	Username   string        `json:"username"`
 	Expiration time.Time     `json:"expiration"`
 	Ttl        time.Duration `json:"ttl"`
+	Created    time.Time     `json:"created,omitempty"`    // When the session was created
+	LastSeen   time.Time     `json:"last_seen,omitempty"`  // When the session was last used - only updated when the session's expiration is extended
+	UserAgent  string        `json:"user_agent,omitempty"` // User-Agent of the request that created the session
+	IPAddress  string        `json:"ip_address,omitempty"` // Remote address of the request that created the session
 }
 
 const DefaultCookieName = "SyncGatewaySession"
@@ -42,7 +47,16 @@ func (auth *Authenticator) AuthenticateCookie(rq *http.Request, response http.Re
 		}
 		return nil, err
 	}
-	// Don't need to check session.Expiration, because Couchbase will have nuked the document.
+	// Only accept the cookie for the session it was issued for, not any other document found by its ID
+	if session.ID != cookie.Value {
+		return nil, base.HTTPErrorf(http.StatusUnauthorized, "Session Invalid")
+	}
+	// Couchbase removes the document once the session expires, but the expiration is also checked so that it's
+	// enforced against the authenticator's clock.
+	now := auth.clock().Now()
+	if now.After(session.Expiration) {
+		return nil, base.HTTPErrorf(http.StatusUnauthorized, "Session Invalid")
+	}
 	// update the session Expiration if 10% or more of the current expiration time has elapsed
 	// if the session does not contain a Ttl (probably created prior to upgrading SG), use
 	// default value of 24Hours
@@ -52,10 +66,11 @@ func (auth *Authenticator) AuthenticateCookie(rq *http.Request, response http.Re
 	duration := session.Ttl
 
 	// SessionTimeElapsed and tenPercentOfTtl use Nanoseconds for more precision when converting to int
-	sessionTimeElapsed := int((time.Now().Add(duration).Sub(session.Expiration)).Nanoseconds())
+	sessionTimeElapsed := int((now.Add(duration).Sub(session.Expiration)).Nanoseconds())
 	tenPercentOfTtl := int(duration.Nanoseconds()) / 10
 	if sessionTimeElapsed > tenPercentOfTtl {
-		session.Expiration = time.Now().Add(duration)
+		session.Expiration = now.Add(duration)
+		session.LastSeen = now.UTC()
 		if err = auth.bucket.Set(DocIDForSession(session.ID), base.DurationToCbsExpiry(duration), nil, session); err != nil {
 			return nil, err
 		}
@@ -72,6 +87,12 @@ func (auth *Authenticator) AuthenticateCookie(rq *http.Request, response http.Re
 }
 
 func (auth *Authenticator) CreateSession(username string, ttl time.Duration) (*LoginSession, error) {
+	return auth.CreateSessionForRequest(nil, username, ttl)
+}
+
+// CreateSessionForRequest creates a session, recording the user agent and remote address of the given request on the
+// session.  rq may be nil when the session isn't being created on behalf of the requesting client.
+func (auth *Authenticator) CreateSessionForRequest(rq *http.Request, username string, ttl time.Duration) (*LoginSession, error) {
 	ttlSec := int(ttl.Seconds())
 	if ttlSec <= 0 {
 		return nil, base.HTTPErrorf(400, "Invalid session time-to-live")
@@ -82,11 +103,21 @@ func (auth *Authenticator) CreateSession(username string, ttl time.Duration) (*L
 		return nil, err
 	}
 
+	now := auth.clock().Now()
 	session := &LoginSession{
 		ID:         secret,
 		Username:   username,
-		Expiration: time.Now().Add(ttl),
+		Expiration: now.Add(ttl),
 		Ttl:        ttl,
+		Created:    now.UTC(),
+		LastSeen:   now.UTC(),
+	}
+	if rq != nil {
+		session.UserAgent = rq.UserAgent()
+		session.IPAddress = rq.RemoteAddr
+		if host, _, err := net.SplitHostPort(rq.RemoteAddr); err == nil {
+			session.IPAddress = host
+		}
 	}
 	if err := auth.bucket.Set(DocIDForSession(session.ID), base.DurationToCbsExpiry(ttl), nil, session); err != nil {
 		return nil, err
@@ -103,6 +134,9 @@ func (auth *Authenticator) GetSession(sessionID string) (*LoginSession, error) {
 		}
 		return nil, err
 	}
+	if session.ID != sessionID {
+		return nil, nil
+	}
 	return &session, nil
 }
 
@@ -131,7 +165,7 @@ func (auth Authenticator) DeleteSessionForCookie(rq *http.Request) *http.Cookie
 
 	newCookie := *cookie
 	newCookie.Value = ""
-	newCookie.Expires = time.Now()
+	newCookie.Expires = auth.clock().Now()
 	return &newCookie
 }
 
@@ -12,6 +12,7 @@ package auth
 
 import (
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
@@ -62,6 +63,29 @@ func TestCreateSession(t *testing.T) {
 	assert.Contains(t, err.Error(), invalidSessionTTLError)
 }
 
+// CreateSessionForRequest should record the user agent and remote address of the request on the session.
+func TestCreateSessionForRequest(t *testing.T) {
+	testBucket := base.GetTestBucket(t)
+	defer testBucket.Close()
+
+	auth := NewAuthenticator(testBucket, nil, DefaultAuthenticatorOptions())
+
+	rq, err := http.NewRequest(http.MethodPost, "/db/_session", nil)
+	require.NoError(t, err)
+	rq.Header.Set("User-Agent", "CouchbaseLite/3.0")
+	rq.RemoteAddr = "10.0.0.1:54321"
+
+	session, err := auth.CreateSessionForRequest(rq, "Alice", 2*time.Hour)
+	require.NoError(t, err)
+
+	session, err = auth.GetSession(session.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "CouchbaseLite/3.0", session.UserAgent)
+	assert.Equal(t, "10.0.0.1", session.IPAddress)
+	assert.False(t, session.Created.IsZero())
+	assert.Equal(t, session.Created, session.LastSeen)
+}
+
 func TestDeleteSession(t *testing.T) {
 	base.SetUpTestLogging(t, base.LevelDebug, base.KeyAuth)
 	var username string = "Alice"
@@ -89,6 +113,42 @@ func TestDeleteSession(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+// A session cookie is only accepted for the session document that was issued for it.
+func TestAuthenticateCookieSessionID(t *testing.T) {
+	testBucket := base.GetTestBucket(t)
+	defer testBucket.Close()
+
+	auth := NewAuthenticator(testBucket, nil, DefaultAuthenticatorOptions())
+	user, err := auth.NewUser("Alice", "letmein", nil)
+	require.NoError(t, err)
+	require.NoError(t, auth.Save(user))
+
+	session, err := auth.CreateSession("Alice", 2*time.Hour)
+	require.NoError(t, err)
+
+	authenticate := func(cookieValue string) (User, error) {
+		rq, err := http.NewRequest(http.MethodGet, "/db/", nil)
+		require.NoError(t, err)
+		rq.AddCookie(&http.Cookie{Name: auth.SessionCookieName, Value: cookieValue})
+		return auth.AuthenticateCookie(rq, httptest.NewRecorder())
+	}
+
+	authenticatedUser, err := authenticate(session.ID)
+	require.NoError(t, err)
+	require.NotNil(t, authenticatedUser)
+	assert.Equal(t, "Alice", authenticatedUser.Name())
+
+	// Store a copy of the session under a different ID, which shouldn't be accepted as that session
+	const forgedID = "forged"
+	require.NoError(t, testBucket.Set(DocIDForSession(forgedID), 0, nil, session))
+	_, err = authenticate(forgedID)
+	assertUnauthorized(t, err)
+
+	forgedSession, err := auth.GetSession(forgedID)
+	require.NoError(t, err)
+	assert.Nil(t, forgedSession)
+}
+
 // Coverage for MakeSessionCookie. The MakeSessionCookie should create a cookie
 // using the sessionID, username, expiration and TTL from LoginSession provided.
 // If nil is provided instead of valid login session, nil must be returned.
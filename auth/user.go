@@ -30,6 +30,10 @@ type userImpl struct {
 	auth  *Authenticator
 	roles []Role
 
+	// inheritedRolesSince holds the sequence at which the user gained each role in roles, including roles inherited
+	// through nesting.  Populated by GetRoles.
+	inheritedRolesSince ch.TimedSet
+
 	// warnChanThresholdOnce ensures that the check for channels
 	// per user threshold is only performed exactly once.
 	warnChanThresholdOnce sync.Once
@@ -38,18 +42,20 @@ type userImpl struct {
 // Marshallable data is stored in separate struct from userImpl,
 // to work around limitations of JSON marshaling.
 type userImplBody struct {
-	Email_           string          `json:"email,omitempty"`
-	Disabled_        bool            `json:"disabled,omitempty"`
-	PasswordHash_    []byte          `json:"passwordhash_bcrypt,omitempty"`
-	OldPasswordHash_ interface{}     `json:"passwordhash,omitempty"` // For pre-beta compatibility
-	ExplicitRoles_   ch.TimedSet     `json:"explicit_roles,omitempty"`
-	JWTRoles_        ch.TimedSet     `json:"jwt_roles,omitempty"`
-	JWTChannels_     ch.TimedSet     `json:"jwt_channels,omitempty"`
-	JWTIssuer_       string          `json:"jwt_issuer,omitempty"`
-	JWTLastUpdated_  time.Time       `json:"jwt_last_updated,omitempty"`
-	RolesSince_      ch.TimedSet     `json:"rolesSince"`
-	RoleInvalSeq     uint64          `json:"role_inval_seq,omitempty"` // Sequence at which the roles were invalidated. Data remains in RolesSince_ for history calculation.
-	RoleHistory_     TimedSetHistory `json:"role_history,omitempty"`   // Added to when a previously granted role is revoked. Calculated inside of rebuildRoles.
+	Email_               string          `json:"email,omitempty"`
+	Disabled_            bool            `json:"disabled,omitempty"`
+	PasswordHash_        []byte          `json:"passwordhash_bcrypt,omitempty"`
+	OldPasswordHash_     interface{}     `json:"passwordhash,omitempty"` // For pre-beta compatibility
+	PasswordLastChanged_ time.Time       `json:"password_last_changed,omitempty"`
+	ExplicitRoles_       ch.TimedSet     `json:"explicit_roles,omitempty"`
+	JWTRoles_            ch.TimedSet     `json:"jwt_roles,omitempty"`
+	JWTChannels_         ch.TimedSet     `json:"jwt_channels,omitempty"`
+	JWTIssuer_           string          `json:"jwt_issuer,omitempty"`
+	JWTLastUpdated_      time.Time       `json:"jwt_last_updated,omitempty"`
+	GuestExpiry_         time.Time       `json:"guest_expiry,omitempty"` // Set for guest device users, which are removed once expired
+	RolesSince_          ch.TimedSet     `json:"rolesSince"`
+	RoleInvalSeq         uint64          `json:"role_inval_seq,omitempty"` // Sequence at which the roles were invalidated. Data remains in RolesSince_ for history calculation.
+	RoleHistory_         TimedSetHistory `json:"role_history,omitempty"`   // Added to when a previously granted role is revoked. Calculated inside of rebuildRoles.
 
 	OldExplicitRoles_ []string `json:"admin_roles,omitempty"` // obsolete; declared for migration
 }
@@ -224,6 +230,14 @@ func (user *userImpl) SetJWTLastUpdated(val time.Time) {
 	user.JWTLastUpdated_ = val
 }
 
+func (user *userImpl) GuestExpiry() time.Time {
+	return user.GuestExpiry_
+}
+
+func (user *userImpl) SetGuestExpiry(val time.Time) {
+	user.GuestExpiry_ = val
+}
+
 func (user *userImpl) SetRoleHistory(history TimedSetHistory) {
 	user.RoleHistory_ = history
 }
@@ -399,7 +413,7 @@ func (user *userImpl) ChannelGrantedPeriods(chanName string) ([]GrantHistorySequ
 		roleChannelHistory, ok := currentRole.ChannelHistory()[chanName]
 		if ok {
 			for _, roleChannelHistoryEntry := range roleChannelHistory.Entries {
-				roleGrantedAt := user.RolesSince_[currentRole.Name()].Sequence
+				roleGrantedAt := user.inheritedRolesSince[currentRole.Name()].Sequence
 				compareAndAddPair(roleChannelHistoryEntry.StartSeq, roleGrantedAt, roleChannelHistoryEntry.EndSeq, math.MaxUint64)
 			}
 		}
@@ -477,6 +491,12 @@ func (user *userImpl) Authenticate(password string) bool {
 			return false
 		}
 
+		// exit if the password has exceeded the password policy's rotation interval
+		if user.auth.PasswordPolicy.passwordExpired(user.PasswordLastChanged_) {
+			base.InfofCtx(user.auth.LogCtx, base.KeyAuth, "User account %q password has expired and must be changed", base.UD(user.Name_))
+			return false
+		}
+
 		// password was correct, we'll rehash the password if required
 		// e.g: in the case of bcryptCost changes
 		if err := user.auth.rehashPassword(user, password); err != nil {
@@ -503,25 +523,50 @@ func (user *userImpl) SetPassword(password string) error {
 			return fmt.Errorf("error hashing password: %w", err)
 		}
 		user.PasswordHash_ = hash
+		user.PasswordLastChanged_ = time.Now().UTC()
 	}
 	return nil
 }
 
 // ////// CHANNEL ACCESS:
 
+// GetRoles returns the user's roles, followed by any roles they include (directly or through further nesting).  The
+// flattened list is cached on the user, so nesting changes made after the user was loaded aren't reflected.
 func (user *userImpl) GetRoles() []Role {
 	if user.roles == nil {
 		roles := make([]Role, 0, len(user.RoleNames()))
-		for name := range user.RoleNames() {
+		rolesSince := make(ch.TimedSet, len(user.RoleNames()))
+		for name, since := range user.RoleNames() {
 			role, err := user.auth.GetRole(name)
 			// base.InfofCtx(user.auth.LogCtx, base.KeyAccess, "User %s role %q = %v", base.UD(user.Name_), base.UD(name), base.UD(role))
 			if err != nil {
 				panic(fmt.Sprintf("Error getting user role %q: %v", name, err))
 			} else if role != nil {
 				roles = append(roles, role)
+				rolesSince[name] = since
+			}
+		}
+
+		// Walk included roles breadth-first.  Each role is only added once, so cycles (which can only arise from
+		// concurrent updates) don't recurse.  An inherited role is granted from the later of the sequence the user
+		// gained the including role and the sequence at which it was included.
+		for i := 0; i < len(roles); i++ {
+			parentSince := rolesSince[roles[i].Name()].Sequence
+			for name, included := range roles[i].IncludedRoles() {
+				if _, found := rolesSince[name]; found {
+					continue
+				}
+				role, err := user.auth.GetRole(name)
+				if err != nil {
+					panic(fmt.Sprintf("Error getting included role %q: %v", name, err))
+				} else if role != nil {
+					roles = append(roles, role)
+					rolesSince[name] = ch.NewVbSimpleSequence(base.Max(parentSince, included.Sequence))
+				}
 			}
 		}
 		user.roles = roles
+		user.inheritedRolesSince = rolesSince
 	}
 	return user.roles
 }
@@ -563,7 +608,7 @@ func (user *userImpl) AuthorizeAnyChannel(channels base.Set) error {
 func (user *userImpl) InheritedChannels() ch.TimedSet {
 	channels := user.Channels().Copy()
 	for _, role := range user.GetRoles() {
-		roleSince := user.RoleNames()[role.Name()]
+		roleSince := user.inheritedRolesSince[role.Name()]
 		channels.AddAtSequence(role.Channels(), roleSince.Sequence)
 	}
 
@@ -13,6 +13,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"strings"
 	"time"
 
 	"github.com/couchbase/gocb/v2"
@@ -30,6 +31,8 @@ type BootstrapConnection interface {
 	InsertConfig(bucket, groupID string, value interface{}) (newCAS uint64, err error)
 	// UpdateConfig updates an existing database config for a given bucket and config group ID. updateCallback can return nil to remove the config.
 	UpdateConfig(bucket, groupID string, updateCallback func(rawBucketConfig []byte) (updatedConfig []byte, err error)) (newCAS uint64, err error)
+	// GetConfigGroupIDs returns the IDs of the config groups that have a database config in the given bucket.
+	GetConfigGroupIDs(bucket string) ([]string, error)
 }
 
 // CouchbaseCluster is a GoCBv2 implementation of BootstrapConnection
@@ -267,17 +270,64 @@ func (cc *CouchbaseCluster) UpdateConfig(location, groupID string, updateCallbac
 
 }
 
-// getBucket returns the bucket after waiting for it to be ready.
-func (cc *CouchbaseCluster) getBucket(bucketName string) (b *gocb.Bucket, teardownFn func(), err error) {
-	var connection *gocb.Cluster
+// GetConfigGroupIDs queries the bucket's default collection for database config documents, so requires either a
+// primary index, or the syncDocs index created for databases using the default collection.
+func (cc *CouchbaseCluster) GetConfigGroupIDs(location string) ([]string, error) {
+	if cc == nil {
+		return nil, errors.New("nil CouchbaseCluster")
+	}
+
+	connection, err := cc.connectForBucket(location)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = connection.Close(&gocb.ClusterCloseOptions{})
+	}()
+
+	// Escape the prefixes' underscores, which are otherwise LIKE wildcards.  The predicate on all sync docs matches the
+	// syncDocs index's filter, so that the index can be used.
+	syncDocsPattern := strings.ReplaceAll(SyncDocPrefix, "_", `\\_`)
+	prefixPattern := strings.ReplaceAll(PersistentConfigPrefixWithoutGroupID, "_", `\\_`)
+	statement := fmt.Sprintf("SELECT RAW META().id FROM `%s` WHERE META().id LIKE '%s%%' AND META().id LIKE '%s%%'",
+		location, syncDocsPattern, prefixPattern)
+	results, err := connection.Query(statement, &gocb.QueryOptions{
+		ScanConsistency: gocb.QueryScanConsistencyRequestPlus,
+		Adhoc:           true,
+		RetryStrategy:   &goCBv2FailFastRetryStrategy{},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var groupIDs []string
+	for results.Next() {
+		var docID string
+		if err := results.Row(&docID); err != nil {
+			return nil, err
+		}
+		groupIDs = append(groupIDs, strings.TrimPrefix(docID, PersistentConfigPrefixWithoutGroupID))
+	}
+	if err := results.Err(); err != nil {
+		return nil, err
+	}
+	return groupIDs, nil
+}
+
+// connectForBucket opens a cluster connection using the bucket's credentials, if set in bucket_credentials, or the
+// cluster credentials otherwise.  Callers will be responsible for closing the connection.
+func (cc *CouchbaseCluster) connectForBucket(bucketName string) (*gocb.Cluster, error) {
 	if bucketAuth, set := cc.perBucketAuth[bucketName]; set {
-		connection, err = cc.connect(bucketAuth)
+		return cc.connect(bucketAuth)
 	} else if cc.forcePerBucketAuth {
-		return nil, nil, fmt.Errorf("unable to get bucket %q since credentials are not defined in bucket_credentials", MD(bucketName).Redact())
-	} else {
-		connection, err = cc.connect(nil)
+		return nil, fmt.Errorf("unable to get bucket %q since credentials are not defined in bucket_credentials", MD(bucketName).Redact())
 	}
+	return cc.connect(nil)
+}
 
+// getBucket returns the bucket after waiting for it to be ready.
+func (cc *CouchbaseCluster) getBucket(bucketName string) (b *gocb.Bucket, teardownFn func(), err error) {
+	connection, err := cc.connectForBucket(bucketName)
 	if err != nil {
 		return nil, nil, err
 	}
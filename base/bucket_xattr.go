@@ -227,7 +227,7 @@ func (bucket *CouchbaseBucketGoCB) SubdocGetBodyAndXattr(k string, xattrKey stri
 		// TODO: We may be able to improve in the future by having this secondary op as part of the first. At present
 		// there is no support to obtain more than one xattr in a single operation however MB-28041 is filed for this.
 		if userXattrKey != "" {
-			userXattrCas, err := bucket.SubdocGetXattr(k, userXattrKey, uxv)
+			userXattrCas, err := subdocGetUserXattr(bucket, k, userXattrKey, uxv)
 			switch pkgerrors.Cause(err) {
 
 			case gocb.ErrKeyNotFound:
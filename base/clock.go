@@ -0,0 +1,209 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package base
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the source of time for sequence allocation, cache expiry, session expiry and heartbeats.  SystemClock is
+// used outside of tests.  Tests can use a FakeClock, so that expiry and heartbeat behaviour can be tested by advancing
+// the clock rather than sleeping.
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	Sleep(d time.Duration)
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer is a Clock's equivalent of time.Timer.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// Ticker is a Clock's equivalent of time.Ticker.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// SystemClock is the Clock backed by the time package.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                  { return time.Now() }
+func (systemClock) Since(t time.Time) time.Duration { return time.Since(t) }
+func (systemClock) Sleep(d time.Duration)           { time.Sleep(d) }
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+type systemTimer struct{ *time.Timer }
+
+func (t systemTimer) C() <-chan time.Time { return t.Timer.C }
+
+type systemTicker struct{ *time.Ticker }
+
+func (t systemTicker) C() <-chan time.Time { return t.Ticker.C }
+
+// ClockOrDefault returns the given clock, or SystemClock when nil.
+func ClockOrDefault(clock Clock) Clock {
+	if clock == nil {
+		return SystemClock
+	}
+	return clock
+}
+
+// FakeClock is a Clock whose time only changes when advanced.  Timers and tickers fire when the clock is advanced past
+// their deadline.  For testing use only.
+type FakeClock struct {
+	lock    sync.Mutex
+	now     time.Time
+	waiters []*fakeClockWaiter
+}
+
+// fakeClockWaiter is a timer or ticker waiting for a FakeClock to reach its deadline.
+type fakeClockWaiter struct {
+	clock    *FakeClock
+	deadline time.Time
+	period   time.Duration // Interval of a ticker, zero for timers
+	c        chan time.Time
+}
+
+var _ Clock = &FakeClock{}
+
+// NewFakeClock returns a FakeClock set to the given time.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (f *FakeClock) Now() time.Time {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.now
+}
+
+func (f *FakeClock) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+// Sleep advances the clock by d rather than blocking, so that code that waits for a duration doesn't hang a test
+// that isn't advancing the clock.
+func (f *FakeClock) Sleep(d time.Duration) {
+	if d > 0 {
+		f.Advance(d)
+	}
+}
+
+func (f *FakeClock) NewTimer(d time.Duration) Timer {
+	return &fakeTimer{f.addWaiter(d, 0)}
+}
+
+func (f *FakeClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for FakeClock.NewTicker")
+	}
+	return &fakeTicker{f.addWaiter(d, d)}
+}
+
+// Advance moves the clock forward by d, firing the timers and tickers whose deadline has been reached.  As for
+// time.Ticker, a ticker whose channel is full drops ticks.
+func (f *FakeClock) Advance(d time.Duration) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.now = f.now.Add(d)
+	remaining := f.waiters[:0]
+	for _, w := range f.waiters {
+		if w.deadline.After(f.now) {
+			remaining = append(remaining, w)
+			continue
+		}
+		select {
+		case w.c <- f.now:
+		default:
+		}
+		if w.period > 0 {
+			for !w.deadline.After(f.now) {
+				w.deadline = w.deadline.Add(w.period)
+			}
+			remaining = append(remaining, w)
+		}
+	}
+	for i := len(remaining); i < len(f.waiters); i++ {
+		f.waiters[i] = nil
+	}
+	f.waiters = remaining
+}
+
+// Waiters returns the number of timers and tickers waiting for the clock to be advanced.  Tests can wait for this to
+// reach an expected count before advancing the clock, so that a goroutine doesn't miss an advance made before it
+// started waiting.
+func (f *FakeClock) Waiters() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return len(f.waiters)
+}
+
+func (f *FakeClock) addWaiter(d, period time.Duration) *fakeClockWaiter {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	w := &fakeClockWaiter{clock: f, deadline: f.now.Add(d), period: period, c: make(chan time.Time, 1)}
+	f.waiters = append(f.waiters, w)
+	return w
+}
+
+// _removeWaiter removes the waiter, and returns whether it was waiting.  Requires the clock's lock.
+func (f *FakeClock) _removeWaiter(w *fakeClockWaiter) bool {
+	for i, waiter := range f.waiters {
+		if waiter == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTimer struct{ *fakeClockWaiter }
+
+func (t *fakeTimer) C() <-chan time.Time { return t.c }
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+	return t.clock._removeWaiter(t.fakeClockWaiter)
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+	active := t.clock._removeWaiter(t.fakeClockWaiter)
+	t.deadline = t.clock.now.Add(d)
+	t.clock.waiters = append(t.clock.waiters, t.fakeClockWaiter)
+	return active
+}
+
+type fakeTicker struct{ *fakeClockWaiter }
+
+func (t *fakeTicker) C() <-chan time.Time { return t.c }
+
+func (t *fakeTicker) Stop() {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+	t.clock._removeWaiter(t.fakeClockWaiter)
+}
@@ -0,0 +1,83 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package base
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fired returns whether a value is waiting on the channel.
+func fired(c <-chan time.Time) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestFakeClockTimer(t *testing.T) {
+	start := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+
+	timer := clock.NewTimer(time.Minute)
+	assert.Equal(t, 1, clock.Waiters())
+	clock.Advance(59 * time.Second)
+	assert.False(t, fired(timer.C()))
+	clock.Advance(time.Second)
+	assert.True(t, fired(timer.C()))
+	assert.Equal(t, start.Add(time.Minute), clock.Now())
+	assert.Equal(t, time.Minute, clock.Since(start))
+
+	// A fired timer is no longer waiting, and can be reset
+	assert.Equal(t, 0, clock.Waiters())
+	assert.False(t, timer.Stop())
+	assert.False(t, timer.Reset(time.Second))
+	assert.True(t, timer.Reset(time.Hour))
+	clock.Advance(time.Second)
+	assert.False(t, fired(timer.C()))
+	assert.True(t, timer.Stop())
+	clock.Advance(time.Hour)
+	assert.False(t, fired(timer.C()))
+
+	// Sleeping advances the clock
+	timer = clock.NewTimer(time.Second)
+	clock.Sleep(time.Second)
+	assert.True(t, fired(timer.C()))
+}
+
+func TestFakeClockTicker(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	ticker := clock.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	clock.Advance(500 * time.Millisecond)
+	assert.False(t, fired(ticker.C()))
+	clock.Advance(500 * time.Millisecond)
+	assert.True(t, fired(ticker.C()))
+
+	// Ticks are dropped while the channel is full
+	clock.Advance(time.Second)
+	clock.Advance(time.Second)
+	assert.True(t, fired(ticker.C()))
+	assert.False(t, fired(ticker.C()))
+
+	// Advancing past several intervals sends a single tick
+	clock.Advance(5 * time.Second)
+	assert.True(t, fired(ticker.C()))
+	assert.False(t, fired(ticker.C()))
+	clock.Advance(time.Second)
+	assert.True(t, fired(ticker.C()))
+
+	ticker.Stop()
+	assert.Equal(t, 0, clock.Waiters())
+}
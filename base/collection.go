@@ -68,6 +68,7 @@ func GetCouchbaseCollection(spec BucketSpec) (*Collection, error) {
 		SecurityConfig: securityConfig,
 		TimeoutsConfig: timeoutsConfig,
 		RetryStrategy:  &goCBv2FailFastRetryStrategy{},
+		Tracer:         GoCBv2RequestTracer(),
 	}
 
 	if spec.KvPoolSize > 0 {
@@ -1085,6 +1086,34 @@ func (c *Collection) GetCollectionManifest() (gocbcore.Manifest, error) {
 	return rv, nil
 }
 
+// CreateScopesAndCollections creates any of the given scopes and collections, keyed by scope name, that don't already
+// exist in the collection's bucket.  Requires the credentials used to connect to have the Manage Scopes role.
+func (c *Collection) CreateScopesAndCollections(ctx context.Context, scopes map[string][]string) error {
+	manager := c.Collection.Bucket().Collections()
+	for scopeName, collectionNames := range scopes {
+		if scopeName != DefaultScope {
+			err := manager.CreateScope(scopeName, nil)
+			if err == nil {
+				InfofCtx(ctx, KeyAll, "Created scope %s in bucket %s", MD(scopeName), MD(c.BucketName()))
+			} else if !errors.Is(err, gocb.ErrScopeExists) {
+				return fmt.Errorf("failed to create scope %s: %w", MD(scopeName).Redact(), err)
+			}
+		}
+		for _, collectionName := range collectionNames {
+			if scopeName == DefaultScope && collectionName == DefaultCollection {
+				continue
+			}
+			err := manager.CreateCollection(gocb.CollectionSpec{Name: collectionName, ScopeName: scopeName}, nil)
+			if err == nil {
+				InfofCtx(ctx, KeyAll, "Created collection %s.%s in bucket %s", MD(scopeName), MD(collectionName), MD(c.BucketName()))
+			} else if !errors.Is(err, gocb.ErrCollectionExists) {
+				return fmt.Errorf("failed to create collection %s.%s: %w", MD(scopeName).Redact(), MD(collectionName).Redact(), err)
+			}
+		}
+	}
+	return nil
+}
+
 // asCollection tries to return the given bucket as a Collection.
 func AsCollection(bucket Bucket) (*Collection, error) {
 	var underlyingBucket Bucket
@@ -62,14 +62,20 @@ func (c *Collection) IndexMetaKeyspaceID() string {
 }
 
 func (c *Collection) Query(statement string, params map[string]interface{}, consistency ConsistencyMode, adhoc bool) (resultsIterator sgbucket.QueryResultIterator, err error) {
-	logCtx := context.TODO()
+	return c.QueryContext(context.TODO(), statement, params, consistency, adhoc)
+}
 
+// QueryContext runs a query on behalf of the given context.  The context's correlation ID is used as the query's
+// client context ID, so that the query can be found in Couchbase Server's system:active_requests and
+// system:completed_requests.
+func (c *Collection) QueryContext(logCtx context.Context, statement string, params map[string]interface{}, consistency ConsistencyMode, adhoc bool) (resultsIterator sgbucket.QueryResultIterator, err error) {
 	keyspaceStatement := strings.Replace(statement, KeyspaceQueryToken, c.EscapedKeyspace(), -1)
 
 	n1qlOptions := &gocb.QueryOptions{
 		ScanConsistency: gocb.QueryScanConsistency(consistency),
 		Adhoc:           adhoc,
 		NamedParameters: params,
+		ClientContextID: CorrelationIDFromContext(logCtx),
 	}
 
 	waitTime := 10 * time.Millisecond
@@ -63,6 +63,20 @@ type N1QLStore interface {
 	waitUntilQueryServiceReady(timeout time.Duration) error
 }
 
+// contextN1QLStore is implemented by N1QLStores that can run a query on behalf of a context, identifying the query to
+// Couchbase Server with the context's correlation ID.
+type contextN1QLStore interface {
+	QueryContext(ctx context.Context, statement string, params map[string]interface{}, consistency ConsistencyMode, adhoc bool) (sgbucket.QueryResultIterator, error)
+}
+
+// QueryContext runs a query with the store on behalf of the given context, when the store supports it.
+func QueryContext(ctx context.Context, store N1QLStore, statement string, params map[string]interface{}, consistency ConsistencyMode, adhoc bool) (sgbucket.QueryResultIterator, error) {
+	if contextStore, ok := store.(contextN1QLStore); ok {
+		return contextStore.QueryContext(ctx, statement, params, consistency, adhoc)
+	}
+	return store.Query(statement, params, consistency, adhoc)
+}
+
 func ExplainQuery(store N1QLStore, statement string, params map[string]interface{}) (plan map[string]interface{}, err error) {
 	explainStatement := fmt.Sprintf("EXPLAIN %s", statement)
 	explainResults, explainErr := store.Query(explainStatement, params, RequestPlus, true)
@@ -437,10 +451,14 @@ func isTransientIndexerError(err error) bool {
 	return false
 }
 
-func SlowQueryLog(ctx context.Context, startTime time.Time, threshold time.Duration, messageFormat string, args ...interface{}) {
+// SlowQueryLog logs the query and its params, as user data, if it has run for longer than the threshold.  Returns
+// whether the query was slow.
+func SlowQueryLog(ctx context.Context, startTime time.Time, threshold time.Duration, params map[string]interface{}, messageFormat string, args ...interface{}) (slow bool) {
 	if elapsed := time.Now().Sub(startTime); elapsed > threshold {
-		InfofCtx(ctx, KeyQuery, messageFormat+" took "+elapsed.String(), args...)
+		InfofCtx(ctx, KeyQuery, messageFormat+" with params %v took "+elapsed.String(), append(args, UD(params))...)
+		return true
 	}
+	return false
 }
 
 // Converts to a format like `value1`,`value2` when quote=`
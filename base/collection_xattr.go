@@ -250,7 +250,7 @@ func (c *Collection) SubdocGetBodyAndXattr(k string, xattrKey string, userXattrK
 		// TODO: We may be able to improve in the future by having this secondary op as part of the first. At present
 		// there is no support to obtain more than one xattr in a single operation however MB-28041 is filed for this.
 		if userXattrKey != "" {
-			userXattrCas, userXattrErr := c.SubdocGetXattr(k, userXattrKey, uxv)
+			userXattrCas, userXattrErr := subdocGetUserXattr(c, k, userXattrKey, uxv)
 			switch pkgerrors.Cause(userXattrErr) {
 			case gocb.ErrDocumentNotFound:
 				// If key not found it has been deleted in between the first op and this op.
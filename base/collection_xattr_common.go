@@ -182,6 +182,44 @@ func UpdateTombstoneXattr(store SubdocXattrStore, k string, xattrKey string, exp
 
 // WriteUpdateWithXattr retrieves the existing doc from the bucket, invokes the callback to update the document, then writes the new document to the bucket.  Will repeat this process on cas
 // failure.  If previousValue/xattr/cas are provided, will use those on the first iteration instead of retrieving from the bucket.
+// subdocGetUserXattr retrieves the user xattr for the given user xattr key specification into uxv, returning the cas of
+// the document it was retrieved from.  For a composite specification each key is retrieved individually, and uxv (which
+// must be a *[]byte) is set to the composite raw user xattr built from their values.  Returns ErrXattrNotFound if none
+// of the keys exist.
+func subdocGetUserXattr(store SubdocXattrStore, k string, userXattrKey string, uxv interface{}) (cas uint64, err error) {
+	if !IsCompositeUserXattrKey(userXattrKey) {
+		return store.SubdocGetXattr(k, userXattrKey, uxv)
+	}
+
+	rawUserXattr, ok := uxv.(*[]byte)
+	if !ok {
+		return 0, fmt.Errorf("composite user xattr for key %s must be retrieved as raw bytes, not %T", UD(k), uxv)
+	}
+
+	values := make(map[string][]byte)
+	for _, key := range UserXattrKeys(userXattrKey) {
+		var value []byte
+		keyCas, err := store.SubdocGetXattr(k, key, &value)
+		if pkgerrors.Cause(err) == ErrXattrNotFound {
+			continue
+		} else if err != nil {
+			return keyCas, err
+		}
+		// The doc was mutated between retrievals - return a cas that won't match the doc's, so that the caller retries
+		if cas != 0 && keyCas != cas {
+			return 0, nil
+		}
+		cas = keyCas
+		values[key] = value
+	}
+	if len(values) == 0 {
+		return 0, ErrXattrNotFound
+	}
+
+	*rawUserXattr, err = CompositeUserXattr(values)
+	return cas, err
+}
+
 func WriteUpdateWithXattr(store SubdocXattrStore, k string, xattrKey string, userXattrKey string, exp uint32, opts *sgbucket.MutateInOptions, previous *sgbucket.BucketDocument, callback sgbucket.WriteUpdateWithXattrFunc) (casOut uint64, err error) {
 
 	var value []byte
@@ -0,0 +1,189 @@
+// Copyright 2022-Present Couchbase, Inc.
+//
+// Use of this software is governed by the Business Source License included
+// in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+// in that file, in accordance with the Business Source License, use of this
+// software will be governed by the Apache License, Version 2.0, included in
+// the file licenses/APL2.txt.
+
+package base
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// EncryptedConfigSecretPrefix prefixes the values of config secrets that have been encrypted.
+const EncryptedConfigSecretPrefix = "enc:v1:"
+
+// ConfigDataKeyLength is the length of the keys used to encrypt config secrets, which are AES-256 keys.
+const ConfigDataKeyLength = 32
+
+// ConfigKeyWrapper wraps and unwraps the data keys that encrypt secrets in persisted configs (envelope encryption), so
+// that only wrapped data keys are stored alongside the secrets.  Implementations may delegate to a KMS.
+type ConfigKeyWrapper interface {
+	// KeyID identifies the key that wraps data keys, so that data keys wrapped by a different key can be detected.
+	KeyID() string
+	// WrapKey encrypts a data key.
+	WrapKey(ctx context.Context, dataKey []byte) ([]byte, error)
+	// UnwrapKey decrypts a data key wrapped by WrapKey.
+	UnwrapKey(ctx context.Context, wrappedKey []byte) ([]byte, error)
+}
+
+// ConfigKeyWrapperFactory creates a ConfigKeyWrapper from a KMS provider's options.
+type ConfigKeyWrapperFactory func(ctx context.Context, options map[string]string) (ConfigKeyWrapper, error)
+
+var (
+	configKeyWrapperFactories     = map[string]ConfigKeyWrapperFactory{}
+	configKeyWrapperFactoriesLock sync.RWMutex
+)
+
+// RegisterConfigKeyWrapperFactory registers a KMS provider that can be selected by name to wrap the data keys that
+// encrypt config secrets.
+func RegisterConfigKeyWrapperFactory(provider string, factory ConfigKeyWrapperFactory) {
+	configKeyWrapperFactoriesLock.Lock()
+	defer configKeyWrapperFactoriesLock.Unlock()
+	configKeyWrapperFactories[provider] = factory
+}
+
+// NewConfigKeyWrapperFromProvider creates a ConfigKeyWrapper using the registered KMS provider of the given name.
+func NewConfigKeyWrapperFromProvider(ctx context.Context, provider string, options map[string]string) (ConfigKeyWrapper, error) {
+	configKeyWrapperFactoriesLock.RLock()
+	factory, ok := configKeyWrapperFactories[provider]
+	configKeyWrapperFactoriesLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown config encryption KMS provider %q", provider)
+	}
+	return factory(ctx, options)
+}
+
+// localConfigKeyWrapper wraps data keys with a locally held AES-256 key.
+type localConfigKeyWrapper struct {
+	keyID string
+	aead  cipher.AEAD
+}
+
+var _ ConfigKeyWrapper = &localConfigKeyWrapper{}
+
+// NewLocalConfigKeyWrapper returns a ConfigKeyWrapper that wraps data keys with the given AES-256 key.
+func NewLocalConfigKeyWrapper(key []byte) (ConfigKeyWrapper, error) {
+	aead, err := newConfigAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	keyHash := sha256.Sum256(key)
+	return &localConfigKeyWrapper{
+		keyID: "local:" + hex.EncodeToString(keyHash[:4]),
+		aead:  aead,
+	}, nil
+}
+
+func (w *localConfigKeyWrapper) KeyID() string {
+	return w.keyID
+}
+
+func (w *localConfigKeyWrapper) WrapKey(_ context.Context, dataKey []byte) ([]byte, error) {
+	return sealConfigValue(w.aead, dataKey)
+}
+
+func (w *localConfigKeyWrapper) UnwrapKey(_ context.Context, wrappedKey []byte) ([]byte, error) {
+	return openConfigValue(w.aead, wrappedKey)
+}
+
+// NewConfigDataKey returns a random key for encrypting config secrets.
+func NewConfigDataKey() ([]byte, error) {
+	dataKey := make([]byte, ConfigDataKeyLength)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	return dataKey, nil
+}
+
+// ConfigSecretCipher encrypts and decrypts config secrets with a data key.
+type ConfigSecretCipher struct {
+	aead cipher.AEAD
+}
+
+// NewConfigSecretCipher returns a ConfigSecretCipher using the given data key.
+func NewConfigSecretCipher(dataKey []byte) (*ConfigSecretCipher, error) {
+	aead, err := newConfigAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &ConfigSecretCipher{aead: aead}, nil
+}
+
+// Encrypt returns the encrypted form of the given secret.  Empty and already encrypted secrets are returned as-is.
+func (c *ConfigSecretCipher) Encrypt(secret string) (string, error) {
+	if secret == "" || IsEncryptedConfigSecret(secret) {
+		return secret, nil
+	}
+	sealed, err := sealConfigValue(c.aead, []byte(secret))
+	if err != nil {
+		return "", err
+	}
+	return EncryptedConfigSecretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt returns the secret encrypted by Encrypt.  Secrets that aren't encrypted are returned as-is.
+func (c *ConfigSecretCipher) Decrypt(value string) (string, error) {
+	if !IsEncryptedConfigSecret(value) {
+		return value, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, EncryptedConfigSecretPrefix))
+	if err != nil {
+		return "", fmt.Errorf("malformed encrypted config secret: %w", err)
+	}
+	secret, err := openConfigValue(c.aead, sealed)
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
+
+// IsEncryptedConfigSecret returns true if the given config value is an encrypted secret.
+func IsEncryptedConfigSecret(value string) bool {
+	return strings.HasPrefix(value, EncryptedConfigSecretPrefix)
+}
+
+func newConfigAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != ConfigDataKeyLength {
+		return nil, fmt.Errorf("config encryption key must be %d bytes, got %d", ConfigDataKeyLength, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealConfigValue encrypts plaintext, prefixing the result with the random nonce used.
+func sealConfigValue(aead cipher.AEAD, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// openConfigValue decrypts ciphertext produced by sealConfigValue.
+func openConfigValue(aead cipher.AEAD, sealed []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("encrypted config value is too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt config value: %w", err)
+	}
+	return plaintext, nil
+}
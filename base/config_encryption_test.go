@@ -0,0 +1,89 @@
+// Copyright 2022-Present Couchbase, Inc.
+//
+// Use of this software is governed by the Business Source License included
+// in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+// in that file, in accordance with the Business Source License, use of this
+// software will be governed by the Apache License, Version 2.0, included in
+// the file licenses/APL2.txt.
+
+package base
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigSecretCipher(t *testing.T) {
+	dataKey, err := NewConfigDataKey()
+	require.NoError(t, err)
+	secretCipher, err := NewConfigSecretCipher(dataKey)
+	require.NoError(t, err)
+
+	encrypted, err := secretCipher.Encrypt("password")
+	require.NoError(t, err)
+	assert.True(t, IsEncryptedConfigSecret(encrypted))
+	assert.NotContains(t, encrypted, "password")
+
+	// Encrypting is idempotent, and empty secrets aren't encrypted
+	reencrypted, err := secretCipher.Encrypt(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, encrypted, reencrypted)
+	empty, err := secretCipher.Encrypt("")
+	require.NoError(t, err)
+	assert.Equal(t, "", empty)
+
+	decrypted, err := secretCipher.Decrypt(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "password", decrypted)
+	plaintext, err := secretCipher.Decrypt("plaintext")
+	require.NoError(t, err)
+	assert.Equal(t, "plaintext", plaintext)
+
+	// A different data key can't decrypt the secret
+	otherKey, err := NewConfigDataKey()
+	require.NoError(t, err)
+	otherCipher, err := NewConfigSecretCipher(otherKey)
+	require.NoError(t, err)
+	_, err = otherCipher.Decrypt(encrypted)
+	assert.Error(t, err)
+
+	_, err = NewConfigSecretCipher([]byte("short"))
+	assert.Error(t, err)
+}
+
+func TestLocalConfigKeyWrapper(t *testing.T) {
+	ctx := context.Background()
+	key, err := NewConfigDataKey()
+	require.NoError(t, err)
+	keyWrapper, err := NewLocalConfigKeyWrapper(key)
+	require.NoError(t, err)
+
+	dataKey, err := NewConfigDataKey()
+	require.NoError(t, err)
+	wrappedKey, err := keyWrapper.WrapKey(ctx, dataKey)
+	require.NoError(t, err)
+	assert.NotEqual(t, dataKey, wrappedKey)
+	unwrappedKey, err := keyWrapper.UnwrapKey(ctx, wrappedKey)
+	require.NoError(t, err)
+	assert.Equal(t, dataKey, unwrappedKey)
+
+	// Key IDs distinguish keys
+	sameKeyWrapper, err := NewLocalConfigKeyWrapper(key)
+	require.NoError(t, err)
+	assert.Equal(t, keyWrapper.KeyID(), sameKeyWrapper.KeyID())
+	otherKeyWrapper, err := NewLocalConfigKeyWrapper(dataKey)
+	require.NoError(t, err)
+	assert.NotEqual(t, keyWrapper.KeyID(), otherKeyWrapper.KeyID())
+
+	_, err = NewConfigKeyWrapperFromProvider(ctx, "unregistered", nil)
+	assert.Error(t, err)
+	RegisterConfigKeyWrapperFactory(t.Name(), func(_ context.Context, options map[string]string) (ConfigKeyWrapper, error) {
+		return NewLocalConfigKeyWrapper([]byte(options["key"]))
+	})
+	kmsKeyWrapper, err := NewConfigKeyWrapperFromProvider(ctx, t.Name(), map[string]string{"key": string(key)})
+	require.NoError(t, err)
+	assert.Equal(t, keyWrapper.KeyID(), kmsKeyWrapper.KeyID())
+}
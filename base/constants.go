@@ -132,6 +132,11 @@ const (
 	// Intended to be used in Meta Map and related tests
 	MetaMapXattrsKey = "xattrs"
 
+	// Meta Map keys describing the previous revision of a document, for use in the sync function
+	MetaMapOldRevKey      = "oldRev"      // ID of the parent revision, or null for a new document
+	MetaMapOldChannelsKey = "oldChannels" // Channels the parent revision was assigned to, or null for a new document
+	MetaMapOldExpiryKey   = "oldExpiry"   // Current expiry of the document as unix time in seconds, or null if none
+
 	// Prefix for transaction metadata documents
 	TxnPrefix = "_txn:"
 
@@ -161,6 +166,14 @@ const (
 	SyncFnErrorMissingChannelAccess = "sg missing channel access"
 )
 
+// Codes of the machine-readable rejection reasons attached by the sync function's require* helpers.
+const (
+	SyncFnRejectionCodeMissingRole          = "missing_role"
+	SyncFnRejectionCodeAdminRequired        = "admin_required"
+	SyncFnRejectionCodeWrongUser            = "wrong_user"
+	SyncFnRejectionCodeMissingChannelAccess = "missing_channel_access"
+)
+
 const (
 	// EmptyDocument denotes an empty document in JSON form.
 	EmptyDocument = `{}`
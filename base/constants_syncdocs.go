@@ -27,12 +27,15 @@ const (
 	RolePrefix                       = SyncDocPrefix + "role:"                         // RolePrefix stores role documents keyed by role name
 	UserEmailPrefix                  = SyncDocPrefix + "useremail:"                    // UserEmailPrefix maps a user's email to a user name for UserPrefix lookups
 	SessionPrefix                    = SyncDocPrefix + "session:"                      // SessionPrefix stores user sessions keyed by session ID
+	RefreshTokenPrefix               = SyncDocPrefix + "refresh:"                      // RefreshTokenPrefix stores session refresh tokens keyed by token
+	RefreshTokenGenerationPrefix     = SyncDocPrefix + "refreshgen:"                   // RefreshTokenGenerationPrefix stores the generation of a user's refresh tokens keyed by user name
 	AttPrefix                        = SyncDocPrefix + "att:"                          // AttPrefix SG (v1) attachment data
 	Att2Prefix                       = SyncDocPrefix + "att2:"                         // Att2Prefix SG v2 attachment data
 	DCPBackfillSeqKey                = SyncDocPrefix + "dcp_backfill"                  // DCPBackfillSeqKey stores a BackfillSequences for a DCP feed
 	RepairBackupPrefix               = SyncDocPrefix + "repair:backup:"                // RepairBackupPrefix is the doc prefix used to store a backup of a repaired document
 	RepairDryRunPrefix               = SyncDocPrefix + "repair:dryrun:"                // RepairDryRunPrefix is the doc prefix used to store a repaired document in dry-run mode
 	SGRStatusPrefix                  = SyncDocPrefix + "sgrStatus:"                    // SGRStatusPrefix is the doc prefix used to store ISGR status documents
+	NodeRegistryKey                  = SyncDocPrefix + "nodes"                         // NodeRegistryKey stores the registration of each SG node using the bucket, across all config groups
 )
 
 // Sync Gateway Metadata documents that should be GroupID scoped and accessed via the "WithGroupID" helper methods below
@@ -42,6 +45,9 @@ const (
 	HeartbeaterPrefixWithoutGroupID      = SyncDocPrefix               // HeartbeaterPrefixWithoutGroupID stores a SG node heartbeat document
 	PersistentConfigPrefixWithoutGroupID = SyncDocPrefix + "dbconfig:" // PersistentConfigPrefixWithoutGroupID stores a database config
 	SyncFunctionKeyWithoutGroupID        = SyncDocPrefix + "syncdata"  // SyncFunctionKeyWithoutGroupID stores a copy of the Sync Function
+	DCPFailoverSnapshotKeyWithoutGroupID = SyncDocPrefix + "dcp_fo"    // DCPFailoverSnapshotKeyWithoutGroupID stores a DCPFailoverSnapshot for the cache feed
+	ChannelCachePreloadKeyWithoutGroupID = SyncDocPrefix + "chan_pl"   // ChannelCachePreloadKeyWithoutGroupID stores the channels to preload into the channel cache on startup
+	ConfigVersionsKeyWithoutGroupID      = SyncDocPrefix + "cfgvers"   // ConfigVersionsKeyWithoutGroupID stores the database config version run by each node
 )
 
 // SyncFunctionKeyWithGroupID returns a doc ID to use when storing the sync function
@@ -52,6 +58,30 @@ func SyncFunctionKeyWithGroupID(groupID string) string {
 	return SyncFunctionKeyWithoutGroupID
 }
 
+// DCPFailoverSnapshotKeyWithGroupID returns a doc ID to use when storing the cache feed's DCPFailoverSnapshot
+func DCPFailoverSnapshotKeyWithGroupID(groupID string) string {
+	if groupID != "" {
+		return DCPFailoverSnapshotKeyWithoutGroupID + ":" + groupID
+	}
+	return DCPFailoverSnapshotKeyWithoutGroupID
+}
+
+// ChannelCachePreloadKeyWithGroupID returns a doc ID to use when storing the channels to preload into the channel cache
+func ChannelCachePreloadKeyWithGroupID(groupID string) string {
+	if groupID != "" {
+		return ChannelCachePreloadKeyWithoutGroupID + ":" + groupID
+	}
+	return ChannelCachePreloadKeyWithoutGroupID
+}
+
+// ConfigVersionsKeyWithGroupID returns a doc ID to use when storing the database config version run by each node
+func ConfigVersionsKeyWithGroupID(groupID string) string {
+	if groupID != "" {
+		return ConfigVersionsKeyWithoutGroupID + ":" + groupID
+	}
+	return ConfigVersionsKeyWithoutGroupID
+}
+
 // DCPCheckpointPrefixWithGroupID returns a doc ID prefix to use for DCP checkpoints
 func DCPCheckpointPrefixWithGroupID(groupID string) string {
 	if groupID != "" {
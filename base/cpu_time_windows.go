@@ -0,0 +1,34 @@
+/*
+Copyright 2022-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package base
+
+import (
+	"syscall"
+	"time"
+)
+
+// ProcessCPUTime returns the total user and system CPU time used by all threads of the process.
+func ProcessCPUTime() (time.Duration, error) {
+	var creationTime, exitTime, kernelTime, userTime syscall.Filetime
+	process, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return 0, err
+	}
+	if err := syscall.GetProcessTimes(process, &creationTime, &exitTime, &kernelTime, &userTime); err != nil {
+		return 0, err
+	}
+	// Filetime.Nanoseconds is relative to 1601, so can't be used for durations - both are in units of 100ns
+	return time.Duration((filetimeTicks(kernelTime) + filetimeTicks(userTime)) * 100), nil
+}
+
+func filetimeTicks(ft syscall.Filetime) int64 {
+	return int64(ft.HighDateTime)<<32 | int64(ft.LowDateTime)
+}
@@ -56,6 +56,7 @@ type DCPClient struct {
 	dbStats                    *expvar.Map                    // Stats for database
 	agentPriority              gocbcore.DcpAgentPriority      // agentPriority specifies the priority level for a dcp stream
 	collectionIDs              []uint32                       // collectionIDs used by gocbcore, if empty, uses default collections
+	monitor                    *DCPFeedMonitor                // Tracks per-vbucket stream state, when stats are provided
 }
 
 type DCPClientOptions struct {
@@ -101,6 +102,7 @@ func NewDCPClient(ID string, callback sgbucket.FeedEventCallbackFunc, options DC
 		agentPriority:       options.AgentPriority,
 		collectionIDs:       options.CollectionIDs,
 		oneShot:             options.OneShot,
+		monitor:             GetDCPFeedMonitor(options.DbStats),
 	}
 
 	// Initialize active vbuckets
@@ -171,6 +173,9 @@ func (dc *DCPClient) close() {
 
 	// Stop workers
 	close(dc.terminator)
+	for vbNo := uint16(0); vbNo < dc.numVbuckets; vbNo++ {
+		dc.monitor.setStreamState(vbNo, DCPStreamStateClosed)
+	}
 	if dc.agent != nil {
 		agentErr := dc.agent.Close()
 		if agentErr != nil {
@@ -285,6 +290,7 @@ func (dc *DCPClient) startWorkers() {
 	for index, _ := range dc.workers {
 		options := &DCPWorkerOptions{
 			metaPersistFrequency: dc.checkpointPersistFrequency,
+			monitor:              dc.monitor,
 		}
 		dc.workers[index] = NewDCPWorker(index, dc.metadata, dc.callback, dc.onStreamEnd, dc.terminator, nil, dc.checkpointPrefix, assignedVbs[index], options)
 		dc.workers[index].Start(&dc.workersWg)
@@ -296,6 +302,7 @@ func (dc *DCPClient) openStream(vbID uint16, maxRetries uint32) (err error) {
 	logCtx := context.TODO()
 	var openStreamErr error
 	var attempts uint32
+	dc.monitor.setStreamState(vbID, DCPStreamStateOpening)
 	for {
 		// Cancel open for stopped client
 		select {
@@ -306,6 +313,7 @@ func (dc *DCPClient) openStream(vbID uint16, maxRetries uint32) (err error) {
 
 		openStreamErr = dc.openStreamRequest(vbID)
 		if openStreamErr == nil {
+			dc.monitor.setStreamState(vbID, DCPStreamStateOpen)
 			return nil
 		}
 
@@ -345,6 +353,7 @@ func (dc *DCPClient) rollback(vbID uint16) (err error) {
 		dc.dbStats.Add("dcp_rollback_count", 1)
 	}
 	dc.metadata.Rollback(vbID)
+	dc.monitor.rollback(vbID, uint64(dc.metadata.GetMeta(vbID).StartSeqNo))
 	return nil
 }
 
@@ -374,6 +383,7 @@ func (dc *DCPClient) openStreamRequest(vbID uint16) error {
 		if err == nil {
 			err = dc.verifyFailoverLog(vbID, f)
 			if err == nil {
+				dc.monitor.failoverLogReceived(vbID, f)
 				e := streamOpenEvent{
 					streamEventCommon: streamEventCommon{
 						vbID: vbID,
@@ -430,6 +440,7 @@ func (dc *DCPClient) verifyFailoverLog(vbID uint16, f []gocbcore.FailoverEntry)
 }
 
 func (dc *DCPClient) deactivateVbucket(vbID uint16) {
+	dc.monitor.setStreamState(vbID, DCPStreamStateClosed)
 	dc.activeVbucketLock.Lock()
 	delete(dc.activeVbuckets, vbID)
 	activeCount := len(dc.activeVbuckets)
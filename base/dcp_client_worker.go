@@ -38,6 +38,7 @@ type DCPWorker struct {
 	lastMetaPersistTime   time.Time
 	metaPersistFrequency  time.Duration
 	assignedVbs           []uint16
+	monitor               *DCPFeedMonitor
 }
 
 const defaultQueueLength = 10
@@ -47,6 +48,7 @@ type DCPWorkerOptions struct {
 	eventQueueLength     int
 	ignoreDeletes        bool
 	metaPersistFrequency *time.Duration
+	monitor              *DCPFeedMonitor // Tracks per-vbucket stream state, nil if not tracked
 }
 
 func NewDCPWorker(workerID int, metadata DCPMetadataStore, mutationCallback sgbucket.FeedEventCallbackFunc,
@@ -66,7 +68,7 @@ func NewDCPWorker(workerID int, metadata DCPMetadataStore, mutationCallback sgbu
 
 	eventQueue := make(chan streamEvent, queueLength)
 
-	return &DCPWorker{
+	worker := &DCPWorker{
 		ID:                    workerID,
 		eventFeed:             eventQueue,
 		terminator:            terminator,
@@ -79,6 +81,10 @@ func NewDCPWorker(workerID int, metadata DCPMetadataStore, mutationCallback sgbu
 		metaPersistFrequency:  metadataPersistFrequency,
 		assignedVbs:           assignedVbs,
 	}
+	if options != nil {
+		worker.monitor = options.monitor
+	}
+	return worker
 }
 
 // Send accepts incoming events from the DCP client and adds to the worker's buffered feed, to be processed by the main worker goroutine
@@ -153,6 +159,7 @@ func (w *DCPWorker) updateSeq(key []byte, vbID uint16, seq uint64) {
 	// TODO: update snapshot and seq in a single atomic update
 	w.checkPendingSnapshot(vbID)
 	w.metadata.UpdateSeq(vbID, seq)
+	w.monitor.updateSeq(vbID, seq)
 
 	if time.Since(w.lastMetaPersistTime) > w.metaPersistFrequency {
 		w.metadata.Persist(w.ID, w.assignedVbs)
@@ -80,6 +80,7 @@ type DCPCommon struct {
 	feedID                 string                         // Unique feed ID, used for logging
 	loggingCtx             context.Context                // Logging context, prefixes feedID
 	checkpointPrefix       string                         // DCP checkpoint key prefix
+	monitor                *DCPFeedMonitor                // Tracks per-vbucket stream state for the feed
 }
 
 func NewDCPCommon(ctx context.Context, callback sgbucket.FeedEventCallbackFunc, metaStore Bucket, maxVbNo uint16, persistCheckpoints bool, dbStats *expvar.Map, feedID, checkpointPrefix string) *DCPCommon {
@@ -99,6 +100,7 @@ func NewDCPCommon(ctx context.Context, callback sgbucket.FeedEventCallbackFunc,
 		backfill:               &newBackfillStatus,
 		feedID:                 feedID,
 		checkpointPrefix:       checkpointPrefix,
+		monitor:                GetDCPFeedMonitor(dbStats),
 	}
 
 	dcpContextID := fmt.Sprintf("%s-%s", MD(metaStore.GetName()).Redact(), feedID)
@@ -109,6 +111,7 @@ func NewDCPCommon(ctx context.Context, callback sgbucket.FeedEventCallbackFunc,
 
 func (c *DCPCommon) dataUpdate(seq uint64, event sgbucket.FeedEvent) {
 	c.updateSeq(event.VbNo, seq, true)
+	c.monitor.updateSeq(event.VbNo, seq)
 	shouldPersistCheckpoint := c.callback(event)
 	if c.persistCheckpoints && shouldPersistCheckpoint {
 		c.incrementCheckpointCount(event.VbNo)
@@ -176,6 +179,7 @@ func (c *DCPCommon) rollback(vbucketId uint16, rollbackSeq uint64) error {
 	c.dbStatsExpvars.Add("dcp_rollback_count", 1)
 	c.updateSeq(vbucketId, 0, false)
 	c.setMetaData(vbucketId, nil)
+	c.monitor.rollback(vbucketId, 0)
 
 	return nil
 }
@@ -186,6 +190,7 @@ func (c *DCPCommon) rollbackEx(vbucketId uint16, vbucketUUID uint64, rollbackSeq
 	c.dbStatsExpvars.Add("dcp_rollback_count", 1)
 	c.updateSeq(vbucketId, rollbackSeq, false)
 	c.setMetaData(vbucketId, rollbackMetaData)
+	c.monitor.rollback(vbucketId, rollbackSeq)
 	return nil
 }
 
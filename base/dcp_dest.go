@@ -60,26 +60,27 @@ type SGDest interface {
 // is done on-demand per vbucket, as a given Dest isn't expected to manage the full set of vbuckets for a bucket.
 type DCPDest struct {
 	*DCPCommon
-	feedType           destFeedType
-	stats              *expvar.Map // DCP feed stats (rollback, backfill)
-	partitionCountStat *SgwIntStat // Stat for partition count.  Stored outside the DCP feed stats map
-	metaInitComplete   []bool      // Whether metadata initialization has been completed, per vbNo
+	feedType         destFeedType
+	stats            *expvar.Map              // DCP feed stats (rollback, backfill)
+	importStats      *SharedBucketImportStats // Stats for import partition count and movement.  Stored outside the DCP feed stats map
+	metaInitComplete []bool                   // Whether metadata initialization has been completed, per vbNo
 }
 
-func NewDCPDest(ctx context.Context, callback sgbucket.FeedEventCallbackFunc, bucket Bucket, maxVbNo uint16, persistCheckpoints bool, dcpStats *expvar.Map, feedID string, importPartitionStat *SgwIntStat, checkpointPrefix string) (SGDest, context.Context) {
+func NewDCPDest(ctx context.Context, callback sgbucket.FeedEventCallbackFunc, bucket Bucket, maxVbNo uint16, persistCheckpoints bool, dcpStats *expvar.Map, feedID string, importStats *SharedBucketImportStats, checkpointPrefix string) (SGDest, context.Context) {
 
 	dcpCommon := NewDCPCommon(ctx, callback, bucket, maxVbNo, persistCheckpoints, dcpStats, feedID, checkpointPrefix)
 
 	d := &DCPDest{
-		DCPCommon:          dcpCommon,
-		stats:              dcpStats,
-		partitionCountStat: importPartitionStat,
-		metaInitComplete:   make([]bool, maxVbNo),
+		DCPCommon:        dcpCommon,
+		stats:            dcpStats,
+		importStats:      importStats,
+		metaInitComplete: make([]bool, maxVbNo),
 	}
 
-	if d.partitionCountStat != nil {
-		d.partitionCountStat.Add(1)
-		InfofCtx(d.loggingCtx, KeyDCP, "Starting sharded feed for %s.  Total partitions:%v", d.feedID, d.partitionCountStat.String())
+	if d.importStats != nil {
+		d.importStats.ImportPartitions.Add(1)
+		d.importStats.ImportPartitionsAssignedCount.Add(1)
+		InfofCtx(d.loggingCtx, KeyDCP, "Starting sharded feed for %s.  Total partitions:%v", d.feedID, d.importStats.ImportPartitions.String())
 	}
 
 	if LogDebugEnabled(KeyDCP) {
@@ -92,9 +93,16 @@ func NewDCPDest(ctx context.Context, callback sgbucket.FeedEventCallbackFunc, bu
 }
 
 func (d *DCPDest) Close() error {
-	if d.partitionCountStat != nil {
-		d.partitionCountStat.Add(-1)
-		InfofCtx(d.loggingCtx, KeyDCP, "Closing sharded feed for %s. Total partitions:%v", d.feedID, d.partitionCountStat.String())
+	if d.importStats != nil {
+		d.importStats.ImportPartitions.Add(-1)
+		d.importStats.ImportPartitionsReleasedCount.Add(1)
+		InfofCtx(d.loggingCtx, KeyDCP, "Closing sharded feed for %s. Total partitions:%v", d.feedID, d.importStats.ImportPartitions.String())
+	}
+	// Streams for this dest's vbuckets are closed, until the vbuckets are reassigned
+	for vbNo, initialized := range d.metaInitComplete {
+		if initialized {
+			d.monitor.setStreamState(uint16(vbNo), DCPStreamStateClosed)
+		}
 	}
 	DebugfCtx(d.loggingCtx, KeyDCP, "Closing DCPDest for %s", d.feedID)
 	return nil
@@ -187,6 +195,8 @@ func (d *DCPDest) OpaqueGet(partition string) (value []byte, lastSeq uint64, err
 		d.InitVbMeta(vbNo)
 		d.metaInitComplete[vbNo] = true
 	}
+	// cbgt retrieves the vbucket's metadata when opening its stream
+	d.monitor.setStreamState(vbNo, DCPStreamStateOpen)
 
 	metadata, lastSeq, err := d.getMetaData(vbNo)
 	if len(metadata) == 0 {
@@ -0,0 +1,167 @@
+// Copyright 2022-Present Couchbase, Inc.
+//
+// Use of this software is governed by the Business Source License included
+// in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+// in that file, in accordance with the Business Source License, use of this
+// software will be governed by the Apache License, Version 2.0, included in
+// the file licenses/APL2.txt.
+
+package base
+
+import (
+	"expvar"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// States of a vbucket's DCP stream, as tracked by a DCPFeedMonitor
+const (
+	DCPStreamStateOpening = "opening" // Stream is being opened, or reopened after being closed by the server
+	DCPStreamStateOpen    = "open"    // Stream is open and receiving events
+	DCPStreamStateClosed  = "closed"  // Stream has been closed, or the vbucket has been reassigned to another node
+)
+
+// dcpFeedMonitorKey is the key under which a DCPFeedMonitor is stored in a feed's stats map
+const dcpFeedMonitorKey = "dcp_vbucket_streams"
+
+// DCPFeedMonitor tracks the state of each vbucket's stream for a DCP feed.  It's stored in the feed's stats map, which
+// is passed to every DCP feed implementation, so that it can be reported without changes to the feed interfaces.
+type DCPFeedMonitor struct {
+	lock            sync.RWMutex
+	vbuckets        map[uint16]*dcpVbucketState
+	priorSnapshot   map[uint16]DCPFailoverSnapshotEntry // Positions from before the feed was restarted, yet to be checked for rollback
+	rollbackHandler DCPRollbackHandler                  // Called when a rollback is detected, if set
+}
+
+type dcpVbucketState struct {
+	state         string
+	vbUUID        uint64 // UUID of the latest entry of the vbucket's failover log, when known
+	lastSeq       uint64
+	rollbacks     uint64
+	lastEventTime time.Time
+}
+
+// DCPVbucketStatus describes the state of a vbucket's stream for a DCP feed.
+type DCPVbucketStatus struct {
+	VbNo          uint16     `json:"vb"`
+	State         string     `json:"state"`
+	LastSeq       uint64     `json:"last_seq"`                  // Last sequence processed
+	HighSeq       uint64     `json:"high_seq,omitempty"`        // Current high sequence of the vbucket, when known
+	Backlog       uint64     `json:"backlog"`                   // Estimated number of sequences still to be processed
+	Rollbacks     uint64     `json:"rollbacks"`                 // Number of rollbacks since the feed was started
+	LastEventTime *time.Time `json:"last_event_time,omitempty"` // When the last sequence was processed
+}
+
+var dcpFeedMonitorLock sync.Mutex // Synchronizes creation of DCPFeedMonitors
+
+// GetDCPFeedMonitor returns the DCPFeedMonitor stored in a feed's stats map, adding one if there isn't one already.
+// Returns nil for a nil stats map, and all DCPFeedMonitor methods are no-ops for a nil monitor.
+func GetDCPFeedMonitor(statsMap *expvar.Map) *DCPFeedMonitor {
+	if statsMap == nil {
+		return nil
+	}
+	dcpFeedMonitorLock.Lock()
+	defer dcpFeedMonitorLock.Unlock()
+	if monitor, ok := statsMap.Get(dcpFeedMonitorKey).(*DCPFeedMonitor); ok {
+		return monitor
+	}
+	monitor := &DCPFeedMonitor{vbuckets: make(map[uint16]*dcpVbucketState)}
+	statsMap.Set(dcpFeedMonitorKey, monitor)
+	return monitor
+}
+
+// _getVbucket returns the state of the vbucket, creating it if necessary.  Requires the write lock.
+func (m *DCPFeedMonitor) _getVbucket(vbNo uint16) *dcpVbucketState {
+	vbucket, ok := m.vbuckets[vbNo]
+	if !ok {
+		vbucket = &dcpVbucketState{state: DCPStreamStateOpening}
+		m.vbuckets[vbNo] = vbucket
+	}
+	return vbucket
+}
+
+// setStreamState records a change to the state of the vbucket's stream.
+func (m *DCPFeedMonitor) setStreamState(vbNo uint16, state string) {
+	if m == nil {
+		return
+	}
+	m.lock.Lock()
+	m._getVbucket(vbNo).state = state
+	m.lock.Unlock()
+}
+
+// updateSeq records the last sequence processed for the vbucket.
+func (m *DCPFeedMonitor) updateSeq(vbNo uint16, seq uint64) {
+	if m == nil {
+		return
+	}
+	m.lock.Lock()
+	vbucket := m._getVbucket(vbNo)
+	vbucket.state = DCPStreamStateOpen
+	vbucket.lastSeq = seq
+	vbucket.lastEventTime = time.Now()
+	m.lock.Unlock()
+}
+
+// rollback records a rollback of the vbucket's stream to the given sequence, notifying the rollback handler if set.
+func (m *DCPFeedMonitor) rollback(vbNo uint16, seq uint64) {
+	if m == nil {
+		return
+	}
+	m.lock.Lock()
+	vbucket := m._getVbucket(vbNo)
+	vbucket.rollbacks++
+	vbucket.lastSeq = seq
+	handler := m.rollbackHandler
+	m.lock.Unlock()
+
+	if handler != nil {
+		handler(vbNo, seq)
+	}
+}
+
+// VbucketStatus returns the state of each vbucket with a stream, sorted by vbucket number.  Backlogs are estimated
+// from the given high sequences, keyed by vbucket number, if known.
+func (m *DCPFeedMonitor) VbucketStatus(highSeqs map[uint16]uint64) []DCPVbucketStatus {
+	result := []DCPVbucketStatus{}
+	if m == nil {
+		return result
+	}
+	m.lock.RLock()
+	for vbNo, vbucket := range m.vbuckets {
+		status := DCPVbucketStatus{
+			VbNo:      vbNo,
+			State:     vbucket.state,
+			LastSeq:   vbucket.lastSeq,
+			Rollbacks: vbucket.rollbacks,
+		}
+		if !vbucket.lastEventTime.IsZero() {
+			lastEventTime := vbucket.lastEventTime
+			status.LastEventTime = &lastEventTime
+		}
+		if highSeq, ok := highSeqs[vbNo]; ok {
+			status.HighSeq = highSeq
+			if highSeq > vbucket.lastSeq {
+				status.Backlog = highSeq - vbucket.lastSeq
+			}
+		}
+		result = append(result, status)
+	}
+	m.lock.RUnlock()
+	sort.Slice(result, func(i, j int) bool { return result[i].VbNo < result[j].VbNo })
+	return result
+}
+
+// String implements expvar.Var, summarizing the number of streams in each state for the feed's stats.
+func (m *DCPFeedMonitor) String() string {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	counts := make(map[string]int, 3)
+	for _, vbucket := range m.vbuckets {
+		counts[vbucket.state]++
+	}
+	return fmt.Sprintf(`{"%s":%d,"%s":%d,"%s":%d}`, DCPStreamStateOpening, counts[DCPStreamStateOpening],
+		DCPStreamStateOpen, counts[DCPStreamStateOpen], DCPStreamStateClosed, counts[DCPStreamStateClosed])
+}
@@ -0,0 +1,57 @@
+// Copyright 2022-Present Couchbase, Inc.
+//
+// Use of this software is governed by the Business Source License included
+// in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+// in that file, in accordance with the Business Source License, use of this
+// software will be governed by the Apache License, Version 2.0, included in
+// the file licenses/APL2.txt.
+
+package base
+
+import (
+	"expvar"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDCPFeedMonitor(t *testing.T) {
+	statsMap := new(expvar.Map).Init()
+	monitor := GetDCPFeedMonitor(statsMap)
+	require.NotNil(t, monitor)
+	assert.Same(t, monitor, GetDCPFeedMonitor(statsMap))
+
+	monitor.setStreamState(0, DCPStreamStateOpening)
+	monitor.setStreamState(1, DCPStreamStateOpen)
+	monitor.updateSeq(1, 10)
+	monitor.setStreamState(2, DCPStreamStateOpen)
+	monitor.updateSeq(2, 20)
+	monitor.rollback(2, 5)
+	monitor.setStreamState(2, DCPStreamStateClosed)
+
+	status := monitor.VbucketStatus(map[uint16]uint64{0: 3, 1: 15, 2: 4})
+	require.Len(t, status, 3)
+	assert.Equal(t, DCPStreamStateOpening, status[0].State)
+	assert.Equal(t, uint64(3), status[0].Backlog)
+	assert.Nil(t, status[0].LastEventTime)
+
+	assert.Equal(t, DCPStreamStateOpen, status[1].State)
+	assert.Equal(t, uint64(10), status[1].LastSeq)
+	assert.Equal(t, uint64(15), status[1].HighSeq)
+	assert.Equal(t, uint64(5), status[1].Backlog)
+	assert.NotNil(t, status[1].LastEventTime)
+
+	// A high seq behind the last seq processed has no backlog
+	assert.Equal(t, DCPStreamStateClosed, status[2].State)
+	assert.Equal(t, uint64(5), status[2].LastSeq)
+	assert.Equal(t, uint64(1), status[2].Rollbacks)
+	assert.Equal(t, uint64(0), status[2].Backlog)
+
+	assert.Equal(t, `{"opening":1,"open":1,"closed":1}`, statsMap.Get(dcpFeedMonitorKey).String())
+
+	// A nil monitor ignores updates
+	var nilMonitor *DCPFeedMonitor
+	nilMonitor.updateSeq(0, 1)
+	assert.Empty(t, nilMonitor.VbucketStatus(nil))
+}
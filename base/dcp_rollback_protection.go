@@ -0,0 +1,121 @@
+// Copyright 2022-Present Couchbase, Inc.
+//
+// Use of this software is governed by the Business Source License included
+// in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+// in that file, in accordance with the Business Source License, use of this
+// software will be governed by the Apache License, Version 2.0, included in
+// the file licenses/APL2.txt.
+
+package base
+
+import (
+	"context"
+	"time"
+
+	"github.com/couchbase/gocbcore/v10"
+)
+
+// DCPRollbackHandler is called when a DCP feed detects that a vbucket has been rolled back by the server, with the
+// sequence the vbucket was rolled back to.  Mutations after that sequence that were previously received on the feed
+// may no longer exist.
+type DCPRollbackHandler func(vbNo uint16, rollbackSeq uint64)
+
+// DCPFailoverSnapshotEntry records a vbucket's position on a DCP feed - the UUID of the failover log branch the feed
+// was following, and the last sequence received from it.
+type DCPFailoverSnapshotEntry struct {
+	VbUUID uint64 `json:"vbuuid"`
+	Seq    uint64 `json:"seq"`
+}
+
+// DCPFailoverSnapshot records the position of a DCP feed on each vbucket at a point in time.  It's persisted
+// periodically so that a feed that doesn't resume from checkpoints can detect rollbacks that happened while it wasn't
+// running, by comparing it with the failover logs received when the feed is restarted.
+type DCPFailoverSnapshot struct {
+	Time     time.Time                           `json:"time"`
+	Vbuckets map[uint16]DCPFailoverSnapshotEntry `json:"vbuckets"`
+}
+
+// SetRollbackProtection sets the handler to call when a rollback is detected, and the snapshot of the feed's position
+// from before it was restarted, if any.  Must be called before the feed is started.
+func (m *DCPFeedMonitor) SetRollbackProtection(priorSnapshot *DCPFailoverSnapshot, handler DCPRollbackHandler) {
+	if m == nil {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.rollbackHandler = handler
+	m.priorSnapshot = nil
+	if priorSnapshot != nil {
+		m.priorSnapshot = make(map[uint16]DCPFailoverSnapshotEntry, len(priorSnapshot.Vbuckets))
+		for vbNo, entry := range priorSnapshot.Vbuckets {
+			m.priorSnapshot[vbNo] = entry
+		}
+	}
+}
+
+// FailoverSnapshot returns the feed's current position on each vbucket with a known failover log, that it's received
+// mutations from.
+func (m *DCPFeedMonitor) FailoverSnapshot() *DCPFailoverSnapshot {
+	snapshot := &DCPFailoverSnapshot{
+		Time:     time.Now().UTC(),
+		Vbuckets: make(map[uint16]DCPFailoverSnapshotEntry),
+	}
+	if m == nil {
+		return snapshot
+	}
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	for vbNo, vbucket := range m.vbuckets {
+		if vbucket.vbUUID != 0 && vbucket.lastSeq != 0 {
+			snapshot.Vbuckets[vbNo] = DCPFailoverSnapshotEntry{VbUUID: vbucket.vbUUID, Seq: vbucket.lastSeq}
+		}
+	}
+	return snapshot
+}
+
+// failoverLogReceived records the failover log received when the vbucket's stream is opened.  On the first open after
+// a restart, this is compared with the prior snapshot to detect a rollback while the feed wasn't running.
+func (m *DCPFeedMonitor) failoverLogReceived(vbNo uint16, failoverLog []gocbcore.FailoverEntry) {
+	if m == nil {
+		return
+	}
+	m.lock.Lock()
+	m._getVbucket(vbNo).vbUUID = uint64(getLatestVbUUID(failoverLog))
+	priorEntry, checkRollback := m.priorSnapshot[vbNo]
+	delete(m.priorSnapshot, vbNo)
+	handler := m.rollbackHandler
+	m.lock.Unlock()
+
+	if !checkRollback || handler == nil {
+		return
+	}
+	if rollbackSeq, rolledBack := failoverLogRollbackSeq(failoverLog, priorEntry); rolledBack {
+		InfofCtx(context.TODO(), KeyDCP, "DCP vbucket %d was rolled back to sequence %d while the feed wasn't running - previously received up to sequence %d", vbNo, rollbackSeq, priorEntry.Seq)
+		handler(vbNo, rollbackSeq)
+	}
+}
+
+// failoverLogRollbackSeq returns whether a vbucket with the given failover log, ordered oldest entry first, has been
+// rolled back from the given position, and if so the sequence it was rolled back to.  A position on a branch that's
+// no longer in the failover log is treated as a rollback to zero.
+func failoverLogRollbackSeq(failoverLog []gocbcore.FailoverEntry, position DCPFailoverSnapshotEntry) (rollbackSeq uint64, rolledBack bool) {
+	if len(failoverLog) == 0 || position.Seq == 0 {
+		return 0, false
+	}
+	for i, entry := range failoverLog {
+		if uint64(entry.VbUUID) != position.VbUUID {
+			continue
+		}
+		// Still on the latest branch
+		if i == len(failoverLog)-1 {
+			return 0, false
+		}
+		// The next branch started from this sequence, discarding anything after it on the position's branch
+		branchSeq := uint64(failoverLog[i+1].SeqNo)
+		if branchSeq >= position.Seq {
+			return 0, false
+		}
+		return branchSeq, true
+	}
+	return 0, true
+}
@@ -0,0 +1,73 @@
+// Copyright 2022-Present Couchbase, Inc.
+//
+// Use of this software is governed by the Business Source License included
+// in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+// in that file, in accordance with the Business Source License, use of this
+// software will be governed by the Apache License, Version 2.0, included in
+// the file licenses/APL2.txt.
+
+package base
+
+import (
+	"expvar"
+	"testing"
+
+	"github.com/couchbase/gocbcore/v10"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailoverLogRollbackSeq(t *testing.T) {
+	failoverLog := []gocbcore.FailoverEntry{
+		{VbUUID: 1, SeqNo: 0},
+		{VbUUID: 2, SeqNo: 100},
+		{VbUUID: 3, SeqNo: 150},
+	}
+	testCases := []struct {
+		name        string
+		position    DCPFailoverSnapshotEntry
+		rolledBack  bool
+		rollbackSeq uint64
+	}{
+		{name: "latest branch", position: DCPFailoverSnapshotEntry{VbUUID: 3, Seq: 200}},
+		{name: "no sequences received", position: DCPFailoverSnapshotEntry{VbUUID: 9, Seq: 0}},
+		{name: "failover without data loss", position: DCPFailoverSnapshotEntry{VbUUID: 1, Seq: 100}},
+		{name: "failover with data loss", position: DCPFailoverSnapshotEntry{VbUUID: 2, Seq: 175}, rolledBack: true, rollbackSeq: 150},
+		{name: "unknown branch", position: DCPFailoverSnapshotEntry{VbUUID: 9, Seq: 50}, rolledBack: true, rollbackSeq: 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rollbackSeq, rolledBack := failoverLogRollbackSeq(failoverLog, tc.position)
+			assert.Equal(t, tc.rolledBack, rolledBack)
+			assert.Equal(t, tc.rollbackSeq, rollbackSeq)
+		})
+	}
+}
+
+func TestDCPFeedMonitorRollbackProtection(t *testing.T) {
+	monitor := GetDCPFeedMonitor(new(expvar.Map).Init())
+	rollbacks := map[uint16]uint64{}
+	monitor.SetRollbackProtection(&DCPFailoverSnapshot{Vbuckets: map[uint16]DCPFailoverSnapshotEntry{
+		0: {VbUUID: 1, Seq: 50},
+		1: {VbUUID: 1, Seq: 50},
+	}}, func(vbNo uint16, rollbackSeq uint64) {
+		rollbacks[vbNo] = rollbackSeq
+	})
+
+	// vb 0 failed over after the prior snapshot was taken, discarding sequences after 20
+	monitor.failoverLogReceived(0, []gocbcore.FailoverEntry{{VbUUID: 1, SeqNo: 0}, {VbUUID: 2, SeqNo: 20}})
+	monitor.failoverLogReceived(1, []gocbcore.FailoverEntry{{VbUUID: 1, SeqNo: 0}})
+	assert.Equal(t, map[uint16]uint64{0: 20}, rollbacks)
+
+	// The prior snapshot is only checked on the first stream open
+	monitor.failoverLogReceived(0, []gocbcore.FailoverEntry{{VbUUID: 1, SeqNo: 0}, {VbUUID: 2, SeqNo: 20}})
+	assert.Len(t, rollbacks, 1)
+
+	// Rollbacks while the feed is running are also reported
+	monitor.rollback(1, 0)
+	assert.Equal(t, map[uint16]uint64{0: 20, 1: 0}, rollbacks)
+
+	// Only vbuckets that have received mutations are included in a new snapshot
+	monitor.updateSeq(0, 30)
+	snapshot := monitor.FailoverSnapshot()
+	assert.Equal(t, map[uint16]DCPFailoverSnapshotEntry{0: {VbUUID: 2, Seq: 30}}, snapshot.Vbuckets)
+}
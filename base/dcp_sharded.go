@@ -41,14 +41,19 @@ var firstVersionToSupportCollections = &ComparableVersion{
 type nodeExtras struct {
 	// Version is the node's version.
 	Version *ComparableVersion `json:"v"`
+	// Host is the node's host name, which identifies the node in an ImportPartitionsConfig.  Stored from 3.1.0 onwards.
+	Host string `json:"h,omitempty"`
 }
 
 // CbgtContext holds the two handles we have for CBGT-related functionality.
 type CbgtContext struct {
-	Manager           *cbgt.Manager            // Manager is main entry point for initialization, registering indexes
-	Cfg               cbgt.Cfg                 // Cfg manages storage of the current pindex set and node assignment
-	heartbeater       Heartbeater              // Heartbeater used for failed node detection
-	heartbeatListener *importHeartbeatListener // Listener subscribed to failed node alerts from heartbeater
+	Manager              *cbgt.Manager            // Manager is main entry point for initialization, registering indexes
+	Cfg                  cbgt.Cfg                 // Cfg manages storage of the current pindex set and node assignment
+	heartbeater          Heartbeater              // Heartbeater used for failed node detection
+	heartbeatListener    *importHeartbeatListener // Listener subscribed to failed node alerts from heartbeater
+	dbName               string                   // Name of the database the feed is importing for
+	indexName            string                   // Name of the cbgt index for the feed
+	partitionsTerminator chan struct{}            // Stops reapplying the ImportPartitionsConfig
 }
 
 // StartShardedDCPFeed initializes and starts a CBGT Manager targeting the provided bucket.
@@ -78,6 +83,11 @@ func StartShardedDCPFeed(ctx context.Context, dbName string, configGroup string,
 	cbgtContext.heartbeater = heartbeater
 	cbgtContext.heartbeatListener = listener
 
+	// Reapply manual import partition assignment whenever the planner changes the plan
+	if err := cbgtContext.watchImportPartitions(ctx); err != nil {
+		return nil, err
+	}
+
 	return cbgtContext, nil
 }
 
@@ -149,6 +159,7 @@ func createCBGTIndex(ctx context.Context, c *CbgtContext, dbName string, configG
 
 	// Determine index name and UUID
 	indexName, previousIndexUUID := dcpSafeIndexName(ctx, c, dbName)
+	c.indexName = indexName
 	InfofCtx(ctx, KeyDCP, "Creating cbgt index %q for db %q", indexName, MD(dbName))
 
 	// Register bucketDataSource callback for new index if we need to configure TLS
@@ -276,16 +287,21 @@ func initCBGTManager(ctx context.Context, bucket Bucket, spec BucketSpec, cfgSG
 	//       required for sg-replicate HA anyway
 	tags := []string{"feed", "janitor", "pindex", "planner"}
 
-	// weight: Allows for weighted distribution of vbuckets across participating nodes.  Not
-	//         used by Sync Gateway
-	weight := 1
+	// weight: Allows for weighted distribution of vbuckets across participating nodes.  Set via the
+	//         node_weights of the database's ImportPartitionsConfig, defaults to 1
+	host := localNodeHost()
+	importPartitionsConfig, _, err := getImportPartitionsConfig(cfgSG, dbName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load import partition settings: %w", err)
+	}
+	weight := importPartitionsConfig.nodeWeight(host)
 
 	// container: Used by cbgt to determine node hierarchy.  Not needed by Sync Gateway
 	container := ""
 
 	// extras: Can be used to pass Sync Gateway specific node information to callbacks. Used to store the node version
-	// from Helium (3.1.0) onwards, empty for older versions.
-	extras, err := JSONMarshal(&nodeExtras{Version: ProductVersion})
+	// and host name from Helium (3.1.0) onwards, empty for older versions.
+	extras, err := JSONMarshal(&nodeExtras{Version: ProductVersion, Host: host})
 	if err != nil {
 		return nil, err
 	}
@@ -345,8 +361,10 @@ func initCBGTManager(ctx context.Context, bucket Bucket, spec BucketSpec, cfgSG
 		options)
 
 	cbgtContext := &CbgtContext{
-		Manager: mgr,
-		Cfg:     cfgSG,
+		Manager:              mgr,
+		Cfg:                  cfgSG,
+		dbName:               dbName,
+		partitionsTerminator: make(chan struct{}),
 	}
 
 	if spec.Auth != nil || (spec.Certpath != "" && spec.Keypath != "") {
@@ -408,6 +426,16 @@ func (c *CbgtContext) StartManager(ctx context.Context, dbName string, configGro
 // getNodeVersion returns the version of the node from its Extras field, or nil if none is stored. Returns an error if
 // the extras could not be parsed.
 func getNodeVersion(def *cbgt.NodeDef) (*ComparableVersion, error) {
+	extras, err := getNodeExtras(def)
+	if err != nil || extras == nil {
+		return nil, err
+	}
+	return extras.Version, nil
+}
+
+// getNodeExtras returns the node's Extras field, or nil if none is stored. Returns an error if the extras could not be
+// parsed.
+func getNodeExtras(def *cbgt.NodeDef) (*nodeExtras, error) {
 	if len(def.Extras) == 0 {
 		return nil, nil
 	}
@@ -415,7 +443,7 @@ func getNodeVersion(def *cbgt.NodeDef) (*ComparableVersion, error) {
 	if err := JSONUnmarshal([]byte(def.Extras), &extras); err != nil {
 		return nil, fmt.Errorf("parsing node extras: %w", err)
 	}
-	return extras.Version, nil
+	return &extras, nil
 }
 
 // getMinNodeVersion returns the version of the oldest node currently in the cluster.
@@ -561,7 +589,10 @@ func (l *importHeartbeatListener) StaleHeartbeatDetected(nodeUUID string) {
 	err := cbgt.UnregisterNodes(l.cfg, l.mgr.Version(), []string{nodeUUID})
 	if err != nil {
 		WarnfCtx(context.TODO(), "Attempt to unregister %v from CBGT got error: %v", nodeUUID, err)
+		return
 	}
+	// Reassign the failed node's partitions straight away, rather than waiting for the cfg change to be seen
+	l.mgr.Kick("StaleNodeRemoved")
 }
 
 // subscribeNodeChanges registers with the manager's cfg implementation for notifications on changes to the
@@ -0,0 +1,372 @@
+// Copyright 2022-Present Couchbase, Inc.
+//
+// Use of this software is governed by the Business Source License included
+// in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+// in that file, in accordance with the Business Source License, use of this
+// software will be governed by the Apache License, Version 2.0, included in
+// the file licenses/APL2.txt.
+
+package base
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"sort"
+
+	"github.com/couchbase/cbgt"
+)
+
+// maxImportPartitionsCfgRetries is the number of times an update to the cbgt cfg is retried on a cas mismatch, caused by
+// a concurrent update from another node.
+const maxImportPartitionsCfgRetries = 10
+
+// ImportPartitionsConfig holds manual settings for the assignment of a database's import partitions to nodes.  It's
+// persisted in the cfg so that it's shared by all nodes.  Nodes are identified by host name rather than by UUID, as a
+// node's UUID changes when it restarts.
+type ImportPartitionsConfig struct {
+	NodeWeights map[string]int    `json:"node_weights,omitempty"` // Relative number of partitions assigned to each node, by host name.  Defaults to 1
+	Pins        map[string]string `json:"pins,omitempty"`         // Host name of the node each pinned partition is assigned to, by partition name
+}
+
+// nodeWeight returns the configured weight of the node with the given host name.
+func (c *ImportPartitionsConfig) nodeWeight(host string) int {
+	if weight, ok := c.NodeWeights[host]; ok {
+		return weight
+	}
+	return 1
+}
+
+// merge applies an update to the config.  A weight of zero resets a node's weight to the default, and an empty host
+// name unpins a partition.
+func (c *ImportPartitionsConfig) merge(update ImportPartitionsConfig) {
+	for host, weight := range update.NodeWeights {
+		if weight == 0 {
+			delete(c.NodeWeights, host)
+			continue
+		}
+		if c.NodeWeights == nil {
+			c.NodeWeights = make(map[string]int)
+		}
+		c.NodeWeights[host] = weight
+	}
+	for partition, host := range update.Pins {
+		if host == "" {
+			delete(c.Pins, partition)
+			continue
+		}
+		if c.Pins == nil {
+			c.Pins = make(map[string]string)
+		}
+		c.Pins[partition] = host
+	}
+}
+
+// ImportPartitionsStatus describes the current assignment of a database's import partitions to nodes.
+type ImportPartitionsStatus struct {
+	ImportPartitionsConfig
+	Nodes      []ImportPartitionNode `json:"nodes"`
+	Partitions []ImportPartition     `json:"partitions"`
+}
+
+// ImportPartitionNode describes a node participating in import.
+type ImportPartitionNode struct {
+	UUID       string `json:"uuid"`
+	Host       string `json:"host"`
+	Weight     int    `json:"weight"`
+	Partitions int    `json:"partitions"` // Number of partitions currently assigned to the node
+}
+
+// ImportPartition describes an import partition, which is a set of vbuckets imported by a single node.
+type ImportPartition struct {
+	Name     string `json:"name"`
+	VBuckets string `json:"vbuckets"`
+	Node     string `json:"node,omitempty"` // UUID of the node the partition is assigned to, empty if unassigned
+}
+
+// importPartitionsCfgKey returns the cfg key under which a database's ImportPartitionsConfig is stored.
+func importPartitionsCfgKey(dbName string) string {
+	return "importPartitions-" + GenerateIndexName(dbName)
+}
+
+// getImportPartitionsConfig returns a database's ImportPartitionsConfig, and its cas for updates.
+func getImportPartitionsConfig(cfg cbgt.Cfg, dbName string) (*ImportPartitionsConfig, uint64, error) {
+	val, cas, err := cfg.Get(importPartitionsCfgKey(dbName), 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	config := &ImportPartitionsConfig{}
+	if len(val) > 0 {
+		if err := JSONUnmarshal(val, config); err != nil {
+			return nil, 0, err
+		}
+	}
+	return config, cas, nil
+}
+
+// localNodeHost returns the host name used to identify this node in an ImportPartitionsConfig.
+func localNodeHost() string {
+	host, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return host
+}
+
+// getNodeHost returns the host name used to identify a node in an ImportPartitionsConfig.  Falls back to the node's
+// UUID for nodes that don't store their host name.
+func getNodeHost(def *cbgt.NodeDef) string {
+	extras, err := getNodeExtras(def)
+	if err != nil || extras == nil || extras.Host == "" {
+		return def.UUID
+	}
+	return extras.Host
+}
+
+// isCfgCasError returns whether the error is a cas mismatch on a cfg update.
+func isCfgCasError(err error) bool {
+	var casErr *cbgt.CfgCASError
+	return errors.As(err, &casErr)
+}
+
+// retryOnCfgCasError runs the update until it doesn't fail with a cas mismatch.
+func retryOnCfgCasError(update func() error) (err error) {
+	for i := 0; i < maxImportPartitionsCfgRetries; i++ {
+		err = update()
+		if !isCfgCasError(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// ImportPartitions returns the current assignment of the database's import partitions to nodes.
+func (c *CbgtContext) ImportPartitions() (*ImportPartitionsStatus, error) {
+	config, _, err := getImportPartitionsConfig(c.Cfg, c.dbName)
+	if err != nil {
+		return nil, err
+	}
+	nodeDefs, _, err := cbgt.CfgGetNodeDefs(c.Cfg, cbgt.NODE_DEFS_WANTED)
+	if err != nil {
+		return nil, err
+	}
+	planPIndexes, _, err := cbgt.CfgGetPlanPIndexes(c.Cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &ImportPartitionsStatus{
+		ImportPartitionsConfig: *config,
+		Nodes:                  []ImportPartitionNode{},
+		Partitions:             []ImportPartition{},
+	}
+	partitionCounts := make(map[string]int)
+	if planPIndexes != nil {
+		for _, planPIndex := range planPIndexes.PlanPIndexes {
+			if planPIndex.IndexName != c.indexName {
+				continue
+			}
+			partition := ImportPartition{Name: planPIndex.Name, VBuckets: planPIndex.SourcePartitions}
+			for nodeUUID := range planPIndex.Nodes {
+				partition.Node = nodeUUID
+				partitionCounts[nodeUUID]++
+			}
+			status.Partitions = append(status.Partitions, partition)
+		}
+	}
+	if nodeDefs != nil {
+		for _, nodeDef := range nodeDefs.NodeDefs {
+			status.Nodes = append(status.Nodes, ImportPartitionNode{
+				UUID:       nodeDef.UUID,
+				Host:       getNodeHost(nodeDef),
+				Weight:     nodeDef.Weight,
+				Partitions: partitionCounts[nodeDef.UUID],
+			})
+		}
+	}
+	sort.Slice(status.Nodes, func(i, j int) bool { return status.Nodes[i].UUID < status.Nodes[j].UUID })
+	sort.Slice(status.Partitions, func(i, j int) bool { return status.Partitions[i].Name < status.Partitions[j].Name })
+	return status, nil
+}
+
+// UpdateImportPartitions applies an update to the database's ImportPartitionsConfig, and reassigns partitions to match.
+func (c *CbgtContext) UpdateImportPartitions(ctx context.Context, update ImportPartitionsConfig) error {
+	for host, weight := range update.NodeWeights {
+		if weight < 0 {
+			return HTTPErrorf(http.StatusBadRequest, "Weight of node %q must not be negative", host)
+		}
+	}
+	if len(update.Pins) > 0 {
+		planPIndexes, _, err := cbgt.CfgGetPlanPIndexes(c.Cfg)
+		if err != nil {
+			return err
+		}
+		for partition := range update.Pins {
+			if planPIndexes == nil || planPIndexes.PlanPIndexes[partition] == nil || planPIndexes.PlanPIndexes[partition].IndexName != c.indexName {
+				return HTTPErrorf(http.StatusBadRequest, "Unknown import partition %q", partition)
+			}
+		}
+	}
+
+	var config *ImportPartitionsConfig
+	err := retryOnCfgCasError(func() error {
+		var cas uint64
+		var err error
+		config, cas, err = getImportPartitionsConfig(c.Cfg, c.dbName)
+		if err != nil {
+			return err
+		}
+		config.merge(update)
+		val, err := JSONMarshal(config)
+		if err != nil {
+			return err
+		}
+		_, err = c.Cfg.Set(importPartitionsCfgKey(c.dbName), val, cas)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	InfofCtx(ctx, KeyCluster, "Updated import partition settings - node weights: %v, pins: %v", MD(config.NodeWeights), MD(config.Pins))
+	return c.applyImportPartitionsConfig(ctx, config)
+}
+
+// applyImportPartitionsConfig updates the cfg to match the ImportPartitionsConfig, then kicks the planner and janitor so
+// that partitions are moved straight away.
+func (c *CbgtContext) applyImportPartitionsConfig(ctx context.Context, config *ImportPartitionsConfig) error {
+	for _, kind := range []string{cbgt.NODE_DEFS_WANTED, cbgt.NODE_DEFS_KNOWN} {
+		if err := retryOnCfgCasError(func() error { return c.applyImportNodeWeights(kind, config) }); err != nil {
+			return err
+		}
+	}
+	c.Manager.Kick("ImportNodeWeightsUpdated")
+
+	if err := retryOnCfgCasError(func() error { return c.applyImportPartitionPins(ctx, config) }); err != nil {
+		return err
+	}
+	c.Manager.Kick("ImportPartitionPinsUpdated")
+	return nil
+}
+
+// applyImportNodeWeights sets the weights of the registered nodes, which the planner uses to decide how many partitions
+// each node is assigned.
+func (c *CbgtContext) applyImportNodeWeights(kind string, config *ImportPartitionsConfig) error {
+	nodeDefs, cas, err := cbgt.CfgGetNodeDefs(c.Cfg, kind)
+	if err != nil || nodeDefs == nil {
+		return err
+	}
+	changed := false
+	for _, nodeDef := range nodeDefs.NodeDefs {
+		if weight := config.nodeWeight(getNodeHost(nodeDef)); nodeDef.Weight != weight {
+			nodeDef.Weight = weight
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	nodeDefs.UUID = cbgt.NewUUID()
+	_, err = cbgt.CfgSetNodeDefs(c.Cfg, kind, nodeDefs, cas)
+	return err
+}
+
+// applyImportPartitionPins assigns pinned partitions to the nodes they're pinned to.  The planner doesn't know about
+// pins, so they're reapplied whenever it changes the plan.  A partition whose node isn't running is left wherever the
+// planner assigns it, until the node returns.
+func (c *CbgtContext) applyImportPartitionPins(ctx context.Context, config *ImportPartitionsConfig) error {
+	if len(config.Pins) == 0 {
+		return nil
+	}
+	planPIndexes, cas, err := cbgt.CfgGetPlanPIndexes(c.Cfg)
+	if err != nil || planPIndexes == nil {
+		return err
+	}
+	nodeDefs, _, err := cbgt.CfgGetNodeDefs(c.Cfg, cbgt.NODE_DEFS_KNOWN)
+	if err != nil || nodeDefs == nil {
+		return err
+	}
+	nodesByHost := make(map[string]string, len(nodeDefs.NodeDefs))
+	for _, nodeDef := range nodeDefs.NodeDefs {
+		nodesByHost[getNodeHost(nodeDef)] = nodeDef.UUID
+	}
+
+	changed := false
+	for partition, host := range config.Pins {
+		planPIndex := planPIndexes.PlanPIndexes[partition]
+		if planPIndex == nil || planPIndex.IndexName != c.indexName {
+			continue
+		}
+		nodeUUID, ok := nodesByHost[host]
+		if !ok {
+			DebugfCtx(ctx, KeyCluster, "Node %q that import partition %q is pinned to isn't running - leaving partition unpinned", MD(host), partition)
+			continue
+		}
+		if _, assigned := planPIndex.Nodes[nodeUUID]; assigned && len(planPIndex.Nodes) == 1 {
+			continue
+		}
+		planPIndex.Nodes = map[string]*cbgt.PlanPIndexNode{
+			nodeUUID: {CanRead: true, CanWrite: true},
+		}
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	planPIndexes.UUID = cbgt.NewUUID()
+	_, err = cbgt.CfgSetPlanPIndexes(c.Cfg, planPIndexes, cas)
+	return err
+}
+
+// watchImportPartitions reapplies the database's ImportPartitionsConfig whenever it, the plan or the set of nodes
+// changes, until the context is stopped.
+func (c *CbgtContext) watchImportPartitions(ctx context.Context) error {
+	cfgEvents := make(chan cbgt.CfgEvent)
+	for _, key := range []string{importPartitionsCfgKey(c.dbName), cbgt.PLAN_PINDEXES_KEY, cbgt.CfgNodeDefsKey(cbgt.NODE_DEFS_KNOWN)} {
+		if err := c.Cfg.Subscribe(key, cfgEvents); err != nil {
+			return err
+		}
+	}
+	terminator := c.partitionsTerminator
+	go func() {
+		defer FatalPanicHandler()
+		for {
+			select {
+			case <-cfgEvents:
+				config, _, err := getImportPartitionsConfig(c.Cfg, c.dbName)
+				if err != nil {
+					WarnfCtx(ctx, "Error loading import partition settings: %v", err)
+					continue
+				}
+				if len(config.NodeWeights) == 0 && len(config.Pins) == 0 {
+					continue
+				}
+				// Every node applies the config, so failures due to concurrent updates are expected
+				if err := c.applyImportPartitionsConfig(ctx, config); err != nil {
+					DebugfCtx(ctx, KeyCluster, "Unable to apply import partition settings: %v", err)
+				}
+			case <-terminator:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// StopImportPartitionsWatcher stops reapplying the database's ImportPartitionsConfig.
+func (c *CbgtContext) StopImportPartitionsWatcher() {
+	if c.partitionsTerminator != nil {
+		close(c.partitionsTerminator)
+		c.partitionsTerminator = nil
+	}
+}
+
+// UnregisterLocalNode removes this node from the cfg, so that its partitions are reassigned to other nodes straight
+// away when it stops, rather than once its heartbeat expires.
+func (c *CbgtContext) UnregisterLocalNode(ctx context.Context) {
+	err := cbgt.UnregisterNodes(c.Cfg, c.Manager.Version(), []string{c.Manager.UUID()})
+	if err != nil {
+		WarnfCtx(ctx, "Unable to unregister node %v from import partition assignment - partitions will be reassigned when its heartbeat expires: %v", c.Manager.UUID(), err)
+	}
+}
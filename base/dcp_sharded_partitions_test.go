@@ -0,0 +1,88 @@
+// Copyright 2022-Present Couchbase, Inc.
+//
+// Use of this software is governed by the Business Source License included
+// in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+// in that file, in accordance with the Business Source License, use of this
+// software will be governed by the Apache License, Version 2.0, included in
+// the file licenses/APL2.txt.
+
+package base
+
+import (
+	"testing"
+
+	"github.com/couchbase/cbgt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportPartitionsConfigMerge(t *testing.T) {
+	config := ImportPartitionsConfig{}
+	config.merge(ImportPartitionsConfig{
+		NodeWeights: map[string]int{"host1": 2, "host2": 3},
+		Pins:        map[string]string{"p1": "host1", "p2": "host2"},
+	})
+	assert.Equal(t, 2, config.nodeWeight("host1"))
+	assert.Equal(t, 1, config.nodeWeight("host3"))
+
+	// A zero weight resets to the default, and an empty host unpins
+	config.merge(ImportPartitionsConfig{
+		NodeWeights: map[string]int{"host2": 0},
+		Pins:        map[string]string{"p2": ""},
+	})
+	assert.Equal(t, map[string]int{"host1": 2}, config.NodeWeights)
+	assert.Equal(t, map[string]string{"p1": "host1"}, config.Pins)
+}
+
+func TestApplyImportPartitionsConfig(t *testing.T) {
+	ctx := TestCtx(t)
+	cfg := cbgt.NewCfgMem()
+	c := &CbgtContext{Cfg: cfg, dbName: "db", indexName: GenerateIndexName("db")}
+
+	hostExtras := func(host string) string {
+		extras, err := JSONMarshal(&nodeExtras{Version: ProductVersion, Host: host})
+		require.NoError(t, err)
+		return string(extras)
+	}
+	nodeDefs := cbgt.NewNodeDefs(cbgt.VERSION)
+	nodeDefs.NodeDefs["node1"] = &cbgt.NodeDef{UUID: "node1", Weight: 1, Extras: hostExtras("host1")}
+	nodeDefs.NodeDefs["node2"] = &cbgt.NodeDef{UUID: "node2", Weight: 1, Extras: hostExtras("host2")}
+	nodeDefs.NodeDefs["node3"] = &cbgt.NodeDef{UUID: "node3", Weight: 1} // Legacy node without a host name
+	for _, kind := range []string{cbgt.NODE_DEFS_KNOWN, cbgt.NODE_DEFS_WANTED} {
+		_, err := cbgt.CfgSetNodeDefs(cfg, kind, nodeDefs, 0)
+		require.NoError(t, err)
+	}
+
+	planPIndexes := cbgt.NewPlanPIndexes(cbgt.VERSION)
+	for _, name := range []string{"p1", "p2"} {
+		planPIndexes.PlanPIndexes[name] = &cbgt.PlanPIndex{
+			Name:             name,
+			IndexName:        c.indexName,
+			SourcePartitions: "0,1",
+			Nodes:            map[string]*cbgt.PlanPIndexNode{"node1": {CanRead: true, CanWrite: true}},
+		}
+	}
+	_, err := cbgt.CfgSetPlanPIndexes(cfg, planPIndexes, 0)
+	require.NoError(t, err)
+
+	config := &ImportPartitionsConfig{
+		NodeWeights: map[string]int{"host2": 3, "node3": 2},
+		Pins:        map[string]string{"p1": "host2", "p2": "host4"},
+	}
+	require.NoError(t, c.applyImportNodeWeights(cbgt.NODE_DEFS_WANTED, config))
+	require.NoError(t, c.applyImportPartitionPins(ctx, config))
+
+	status, err := c.ImportPartitions()
+	require.NoError(t, err)
+	assert.Equal(t, []ImportPartitionNode{
+		{UUID: "node1", Host: "host1", Weight: 1, Partitions: 1},
+		{UUID: "node2", Host: "host2", Weight: 3, Partitions: 1},
+		{UUID: "node3", Host: "node3", Weight: 2, Partitions: 0},
+	}, status.Nodes)
+
+	// p2 is pinned to a node that isn't running, so is left where the planner assigned it
+	assert.Equal(t, []ImportPartition{
+		{Name: "p1", VBuckets: "0,1", Node: "node2"},
+		{Name: "p2", VBuckets: "0,1", Node: "node1"},
+	}, status.Partitions)
+}
@@ -47,6 +47,8 @@ var (
 	ErrChannelFeed           = &sgError{"Error while building channel feed"}
 	ErrXattrNotFound         = &sgError{"Xattr Not Found"}
 	ErrTimeout               = &sgError{"Operation timed out"}
+	ErrJSCPUTimeLimit        = &sgError{"JavaScript function exceeded its CPU time limit"}
+	ErrJSMemoryLimit         = &sgError{"JavaScript function exceeded its memory limit"}
 
 	// ErrPartialViewErrors is returned if the view call contains any partial errors.
 	// This is more of a warning, and inspecting ViewResult.Errors is required for detail.
@@ -69,8 +71,9 @@ func (e *sgError) Error() string {
 
 // Simple error implementation wrapping an HTTP response status.
 type HTTPError struct {
-	Status  int
-	Message string
+	Status    int
+	Message   string
+	Rejection *SyncFnRejectionReason // Machine-readable reason given by the sync function for rejecting a document, if any
 }
 
 func (err *HTTPError) Error() string {
@@ -78,7 +81,25 @@ func (err *HTTPError) Error() string {
 }
 
 func HTTPErrorf(status int, format string, args ...interface{}) *HTTPError {
-	return &HTTPError{status, fmt.Sprintf(format, args...)}
+	return &HTTPError{Status: status, Message: fmt.Sprintf(format, args...)}
+}
+
+// SyncFnRejectionReason is a machine-readable reason for the sync function rejecting a document, which lets client
+// apps explain why a write was refused.  It's given by throwing {forbidden: {message: ..., code: ..., details: {...}}},
+// and is also attached to rejections by the requireUser, requireRole, requireAccess and requireAdmin helpers.
+type SyncFnRejectionReason struct {
+	Code    string                 `json:"code"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// SyncFnRejectionReasonFromError returns the sync function rejection reason attached to the error, or nil if there
+// isn't one.
+func SyncFnRejectionReasonFromError(err error) *SyncFnRejectionReason {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Rejection
+	}
+	return nil
 }
 
 // Attempts to map an error to an HTTP status code and message.
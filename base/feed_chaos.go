@@ -0,0 +1,102 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package base
+
+import (
+	"sync"
+)
+
+// FeedChaos holds back or discards the events delivered by a DCP feed, so that tests can verify how Sync Gateway
+// handles a stalled or dropped feed.  For testing use only.
+type FeedChaos struct {
+	lock       sync.Mutex
+	paused     bool
+	discarding bool
+	resumed    chan struct{} // Closed when the feed is resumed or starts discarding, to release held events
+	held       int           // Number of events currently held back by Deliver
+	discarded  uint64        // Number of events discarded
+}
+
+func NewFeedChaos() *FeedChaos {
+	return &FeedChaos{}
+}
+
+// Pause holds back events in Deliver until Resume is called, as for a stalled DCP stream.
+func (c *FeedChaos) Pause() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !c.paused {
+		c.paused = true
+		c.resumed = make(chan struct{})
+	}
+}
+
+// Resume delivers the events held back since Pause was called.
+func (c *FeedChaos) Resume() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.paused {
+		c.paused = false
+		close(c.resumed)
+	}
+}
+
+// Paused returns whether events are being held back.
+func (c *FeedChaos) Paused() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.paused
+}
+
+// SetDiscarding sets whether events are discarded rather than delivered, as for events in flight when a DCP
+// connection is lost.  Events held back by a pause are discarded straight away.  The pause is kept, so that a feed
+// restarted after discarding starts out paused.
+func (c *FeedChaos) SetDiscarding(discard bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if discard && !c.discarding && c.paused {
+		close(c.resumed)
+		c.resumed = make(chan struct{})
+	}
+	c.discarding = discard
+}
+
+// Held returns the number of events currently held back, so that tests can wait for an event to reach a paused feed.
+func (c *FeedChaos) Held() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.held
+}
+
+// Discarded returns the number of events that have been discarded.
+func (c *FeedChaos) Discarded() uint64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.discarded
+}
+
+// Deliver is called by the feed before processing each event.  Blocks while the feed is paused, and returns false
+// when the event is to be discarded.
+func (c *FeedChaos) Deliver() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for c.paused && !c.discarding {
+		resumed := c.resumed
+		c.held++
+		c.lock.Unlock()
+		<-resumed
+		c.lock.Lock()
+		c.held--
+	}
+	if c.discarding {
+		c.discarded++
+		return false
+	}
+	return true
+}
@@ -0,0 +1,58 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package base
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeedChaos(t *testing.T) {
+	chaos := NewFeedChaos()
+	assert.True(t, chaos.Deliver())
+
+	deliver := func() chan bool {
+		delivered := make(chan bool, 1)
+		go func() {
+			delivered <- chaos.Deliver()
+		}()
+		return delivered
+	}
+	waitForHeld := func(expected int) {
+		require.Eventually(t, func() bool { return chaos.Held() == expected }, 5*time.Second, time.Millisecond)
+	}
+
+	// Events are held back while paused, and delivered on resume
+	chaos.Pause()
+	assert.True(t, chaos.Paused())
+	delivered := deliver()
+	waitForHeld(1)
+	chaos.Resume()
+	assert.True(t, <-delivered)
+	assert.Equal(t, 0, chaos.Held())
+
+	// Held events are discarded, and the pause is kept once discarding stops
+	chaos.Pause()
+	delivered = deliver()
+	waitForHeld(1)
+	chaos.SetDiscarding(true)
+	assert.False(t, <-delivered)
+	assert.False(t, chaos.Deliver())
+	assert.Equal(t, uint64(2), chaos.Discarded())
+
+	chaos.SetDiscarding(false)
+	assert.True(t, chaos.Paused())
+	delivered = deliver()
+	waitForHeld(1)
+	chaos.Resume()
+	assert.True(t, <-delivered)
+}
@@ -0,0 +1,238 @@
+// Copyright 2022-Present Couchbase, Inc.
+//
+// Use of this software is governed by the Business Source License included
+// in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+// in that file, in accordance with the Business Source License, use of this
+// software will be governed by the Apache License, Version 2.0, included in
+// the file licenses/APL2.txt.
+
+package base
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	sgbucket "github.com/couchbase/sg-bucket"
+	"github.com/dop251/goja"
+	"github.com/robertkrimen/otto/underscore"
+)
+
+// JavaScript engines that can run a database's sync function and import filter, selected by its javascript_engine
+// config.
+const (
+	JSEngineOtto = "otto" // ES5 only - the default
+	JSEngineGoja = "goja" // ES2020 syntax, e.g. let/const, template strings, arrow functions and optional chaining
+)
+
+// JSLimits are per-invocation resource ceilings for a JavaScript function, which interrupt a runaway function rather
+// than letting it stall its caller.  The CPU time and memory used by a single call can't be told apart from the rest of
+// the process, so limited functions are run in a sandbox process of their own.  Zero values mean no limit.
+type JSLimits struct {
+	MaxCPUTime time.Duration // Max CPU time of a single call, returning ErrJSCPUTimeLimit if exceeded
+	MaxMemory  uint64        // Max growth of the heap during a single call, in bytes, returning ErrJSMemoryLimit if exceeded
+}
+
+// IsZero returns true if no limits are set.
+func (limits JSLimits) IsZero() bool {
+	return limits.MaxCPUTime <= 0 && limits.MaxMemory == 0
+}
+
+var (
+	underscoreProgram     *goja.Program
+	underscoreProgramErr  error
+	underscoreProgramOnce sync.Once
+)
+
+// getUnderscoreProgram returns the compiled underscore.js library.  Compiled programs can be shared by runtimes.
+func getUnderscoreProgram() (*goja.Program, error) {
+	underscoreProgramOnce.Do(func() {
+		underscoreProgram, underscoreProgramErr = goja.Compile("underscore.js", underscore.Source(), false)
+	})
+	return underscoreProgram, underscoreProgramErr
+}
+
+// GojaRunner runs a JavaScript function using the goja engine.  It implements sgbucket.JSServerTask, so it can be
+// pooled by an sgbucket.JSServer in place of an Otto based sgbucket.JSRunner.  Functions written for Otto are
+// supported by also providing underscore.js as _, and by passing sgbucket.JSONString arguments as parsed objects.
+// Not thread-safe!
+type GojaRunner struct {
+	vm        *goja.Runtime
+	fn        goja.Callable
+	fnSource  string
+	timeout   time.Duration
+	jsonParse goja.Callable
+
+	// Optional function that's called before the JS function
+	Before func()
+
+	// Optional function that's called after the JS function, to convert its result
+	After func(result goja.Value, err error) (interface{}, error)
+}
+
+var _ sgbucket.JSServerTask = &GojaRunner{}
+
+// NewGojaRunner creates a GojaRunner for the given function source.
+func NewGojaRunner(funcSource string, timeout time.Duration) (*GojaRunner, error) {
+	runner := &GojaRunner{}
+	if err := runner.Init(funcSource, timeout); err != nil {
+		return nil, err
+	}
+	return runner, nil
+}
+
+// Init initializes the runner, logging calls to console.log and console.error.
+func (runner *GojaRunner) Init(funcSource string, timeout time.Duration) error {
+	ctx := context.Background()
+	return runner.InitWithLogging(funcSource, timeout,
+		func(s string) { ErrorfCtx(ctx, KeyJavascript.String()+": %s", UD(s)) },
+		func(s string) { InfofCtx(ctx, KeyJavascript, "%s", UD(s)) })
+}
+
+// InitWithLogging initializes the runner, passing calls to console.error and console.log to the given functions.
+func (runner *GojaRunner) InitWithLogging(funcSource string, timeout time.Duration, consoleErrorFunc func(string), consoleLogFunc func(string)) error {
+	runner.vm = goja.New()
+	runner.timeout = timeout
+
+	// Compatibility shim for functions written for Otto, which provides underscore.js
+	program, err := getUnderscoreProgram()
+	if err != nil {
+		return fmt.Errorf("unable to compile underscore.js: %w", err)
+	}
+	if _, err := runner.vm.RunProgram(program); err != nil {
+		return fmt.Errorf("unable to load underscore.js: %w", err)
+	}
+
+	console := runner.vm.NewObject()
+	if err := console.Set("error", gojaConsoleFunc(consoleErrorFunc)); err != nil {
+		return err
+	}
+	if err := console.Set("log", gojaConsoleFunc(consoleLogFunc)); err != nil {
+		return err
+	}
+	if err := runner.vm.Set("console", console); err != nil {
+		return err
+	}
+
+	jsonParse, ok := goja.AssertFunction(runner.vm.Get("JSON").ToObject(runner.vm).Get("parse"))
+	if !ok {
+		return errors.New("JSON.parse is not a function")
+	}
+	runner.jsonParse = jsonParse
+
+	_, err = runner.SetFunction(funcSource)
+	return err
+}
+
+func gojaConsoleFunc(logFunc func(string)) func(goja.FunctionCall) goja.Value {
+	return func(call goja.FunctionCall) goja.Value {
+		args := make([]string, 0, len(call.Arguments))
+		for _, arg := range call.Arguments {
+			args = append(args, arg.String())
+		}
+		logFunc(strings.Join(args, " "))
+		return goja.Undefined()
+	}
+}
+
+// DefineNativeFunction defines a global JavaScript function implemented in Go.
+func (runner *GojaRunner) DefineNativeFunction(name string, function func(goja.FunctionCall) goja.Value) {
+	if err := runner.vm.Set(name, function); err != nil {
+		WarnfCtx(context.Background(), "Unable to define JavaScript function %s: %v", name, err)
+	}
+}
+
+// SetFunction compiles the function source, unless it's unchanged.  Returns true if the function was changed.
+func (runner *GojaRunner) SetFunction(funcSource string) (bool, error) {
+	if runner.fn != nil && funcSource == runner.fnSource {
+		return false, nil
+	}
+	// The newline ensures a trailing line comment in the source doesn't swallow the closing parenthesis
+	value, err := runner.vm.RunString("(" + funcSource + "\n)")
+	if err != nil {
+		return false, err
+	}
+	fn, ok := goja.AssertFunction(value)
+	if !ok {
+		return false, errors.New("javascript source does not evaluate to a function")
+	}
+	runner.fn = fn
+	runner.fnSource = funcSource
+	return true, nil
+}
+
+// Interrupt stops the function that's running, if any, so that Call returns the given reason as its error.  Can be
+// called from any goroutine.  The interrupt stays pending until ClearInterrupt is called, so must be cleared once the
+// call has returned.
+func (runner *GojaRunner) Interrupt(reason error) {
+	runner.vm.Interrupt(reason)
+}
+
+// ClearInterrupt clears a pending Interrupt, so that the next call isn't stopped by it.
+func (runner *GojaRunner) ClearInterrupt() {
+	runner.vm.ClearInterrupt()
+}
+
+// Call invokes the function with the given inputs.  Returns sgbucket.ErrJSTimeout if the function runs for longer
+// than the runner's timeout, or the reason given to Interrupt if it's interrupted.
+func (runner *GojaRunner) Call(inputs ...interface{}) (interface{}, error) {
+	args := make([]goja.Value, 0, len(inputs))
+	for _, input := range inputs {
+		arg, err := runner.toValue(input)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+
+	if runner.Before != nil {
+		runner.Before()
+	}
+
+	if runner.timeout > 0 {
+		timer := time.AfterFunc(runner.timeout, func() {
+			runner.vm.Interrupt(sgbucket.ErrJSTimeout)
+		})
+		defer func() {
+			timer.Stop()
+			runner.vm.ClearInterrupt()
+		}()
+	}
+
+	result, err := runner.fn(goja.Undefined(), args...)
+	var interruptedErr *goja.InterruptedError
+	if errors.As(err, &interruptedErr) {
+		if reason, ok := interruptedErr.Value().(error); ok {
+			err = reason
+		} else {
+			err = sgbucket.ErrJSTimeout
+		}
+	}
+	if result == nil {
+		result = goja.Undefined()
+	}
+
+	if runner.After != nil {
+		return runner.After(result, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result.Export(), nil
+}
+
+// toValue converts a Go value to a JavaScript value.  Like Otto, sgbucket.JSONString values are parsed, with an empty
+// string resulting in null.
+func (runner *GojaRunner) toValue(input interface{}) (goja.Value, error) {
+	jsonString, ok := input.(sgbucket.JSONString)
+	if !ok {
+		return runner.vm.ToValue(input), nil
+	}
+	if jsonString == "" {
+		return goja.Null(), nil
+	}
+	return runner.jsonParse(goja.Undefined(), runner.vm.ToValue(string(jsonString)))
+}
@@ -79,6 +79,7 @@ type couchbaseHeartBeater struct {
 	checkCount              int                          // Monitoring stat - number of checks issued
 	sendActive              AtomicBool                   // Monitoring state of send goroutine
 	checkActive             AtomicBool                   // Monitoring state of check goroutine
+	clock                   Clock                        // Schedules heartbeat sends and checks
 }
 
 // Create a new CouchbaseHeartbeater, passing in an authenticated bucket connection,
@@ -96,6 +97,7 @@ func NewCouchbaseHeartbeater(bucket Bucket, keyPrefix, nodeUUID string) (heartbe
 		heartbeatSendInterval:  defaultHeartbeatSendInterval,
 		heartbeatExpirySeconds: defaultHeartbeatExpirySeconds,
 		heartbeatPollInterval:  defaultHeartbeatPollInterval,
+		clock:                  SystemClock,
 	}
 
 	return heartbeater, err
@@ -149,7 +151,7 @@ func (h *couchbaseHeartBeater) StartSendingHeartbeats() error {
 		return err
 	}
 
-	ticker := time.NewTicker(h.heartbeatSendInterval)
+	ticker := h.clock.NewTicker(h.heartbeatSendInterval)
 	go func() {
 		defer FatalPanicHandler()
 		defer func() {
@@ -160,7 +162,7 @@ func (h *couchbaseHeartBeater) StartSendingHeartbeats() error {
 			case <-h.terminator:
 				ticker.Stop()
 				return
-			case <-ticker.C:
+			case <-ticker.C():
 				if err := h.sendHeartbeat(); err != nil {
 					WarnfCtx(context.Background(), "Unexpected error sending heartbeat - will be retried: %v", err)
 				}
@@ -178,7 +180,7 @@ func (h *couchbaseHeartBeater) StartCheckingHeartbeats() error {
 		WarnfCtx(context.Background(), "Error checking for stale heartbeats: %v", err)
 	}
 
-	ticker := time.NewTicker(h.heartbeatPollInterval)
+	ticker := h.clock.NewTicker(h.heartbeatPollInterval)
 	go func() {
 		defer FatalPanicHandler()
 		defer func() { h.checkActive.Set(false) }()
@@ -187,7 +189,7 @@ func (h *couchbaseHeartBeater) StartCheckingHeartbeats() error {
 			case <-h.terminator:
 				ticker.Stop()
 				return
-			case <-ticker.C:
+			case <-ticker.C():
 				if err := h.checkStaleHeartbeats(); err != nil {
 					WarnfCtx(context.Background(), "Error checking for stale heartbeats: %v", err)
 				}
@@ -356,6 +358,16 @@ func (h *couchbaseHeartBeater) SetExpirySeconds(expiry uint32) error {
 	return nil
 }
 
+// SetClock sets the clock that schedules heartbeat sends and checks.  Heartbeat expiry is still enforced by the
+// bucket's document expiry.
+func (h *couchbaseHeartBeater) SetClock(clock Clock) error {
+	if h.sendActive.IsTrue() || h.checkActive.IsTrue() {
+		return errors.New("Cannot modify clock while heartbeater is running - must be set prior to calling Start()")
+	}
+	h.clock = ClockOrDefault(clock)
+	return nil
+}
+
 // documentBackedListener stores set of nodes in a single node list document.  On stale notification,
 // removes node from the list.  Primarily intended for test usage.
 type documentBackedListener struct {
@@ -34,9 +34,10 @@ const (
 
 // This is like a combination of http.ListenAndServe and http.ListenAndServeTLS, which also
 // uses ThrottledListen to limit the number of open HTTP connections.
+// If clientCACertPath is set, TLS clients may present a certificate, which is verified against the CAs at that path.
 func ListenAndServeHTTP(addr string, connLimit uint, certFile, keyFile string, handler http.Handler,
 	readTimeout, writeTimeout, readHeaderTimeout, idleTimeout time.Duration, http2Enabled bool,
-	tlsMinVersion uint16) (serveFn func() error, server *http.Server, err error) {
+	tlsMinVersion uint16, clientCACertPath string) (serveFn func() error, server *http.Server, err error) {
 	var config *tls.Config
 	if certFile != "" {
 		config = &tls.Config{}
@@ -53,6 +54,14 @@ func ListenAndServeHTTP(addr string, connLimit uint, certFile, keyFile string, h
 		if err != nil {
 			return nil, nil, err
 		}
+		if clientCACertPath != "" {
+			config.ClientCAs, err = getRootCAs(clientCACertPath)
+			if err != nil {
+				return nil, nil, err
+			}
+			// Client certs are optional, so that clients can still use other forms of authentication
+			config.ClientAuth = tls.VerifyClientCertIfGiven
+		}
 	}
 	listener, err := ThrottledListen("tcp", addr, connLimit)
 	if err != nil {
@@ -0,0 +1,63 @@
+// Copyright 2022-Present Couchbase, Inc.
+//
+// Use of this software is governed by the Business Source License included
+// in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+// in that file, in accordance with the Business Source License, use of this
+// software will be governed by the Apache License, Version 2.0, included in
+// the file licenses/APL2.txt.
+
+package base
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// jsLibraryRequire implements require() for the modules of a js_library.  A module is run the first time it's
+// required, and is registered before it runs so that modules can require each other.
+const jsLibraryRequire = `
+	var __sgModules = {};
+	function require(name) {
+		if (!__sgModules.hasOwnProperty(name)) {
+			if (!__sgModuleSources.hasOwnProperty(name)) {
+				throw new Error("Cannot find module '" + name + "' in js_library");
+			}
+			var module = {exports: {}};
+			__sgModules[name] = module;
+			__sgModuleSources[name](module, module.exports, require);
+		}
+		return __sgModules[name].exports;
+	}
+`
+
+// WrapJSFunctionWithLibrary returns the source of a JavaScript function that can call require(name) to use the named
+// modules of a js_library.  Modules follow CommonJS conventions: each is run with module, exports and require in
+// scope, and require returns its module.exports.  Modules are compiled along with the function, so are loaded once
+// per JS runner, rather than on every call.  The function source is returned unchanged when the library is empty.
+func WrapJSFunctionWithLibrary(funcSource string, library map[string]string) string {
+	if len(library) == 0 {
+		return funcSource
+	}
+
+	// Sorted, so the same library always results in the same source
+	names := make([]string, 0, len(library))
+	for name := range library {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	moduleSources := make([]string, 0, len(names))
+	for _, name := range names {
+		moduleSources = append(moduleSources, fmt.Sprintf("\t\t%s: %s", ConvertToJSONString(name), JSLibraryModuleFunction(library[name])))
+	}
+
+	// The newline ensures a trailing line comment in the function source doesn't swallow the closing parenthesis
+	return fmt.Sprintf("function() {\n\tvar __sgModuleSources = {\n%s\n\t};\n%s\n\treturn (%s\n\t);\n}()",
+		strings.Join(moduleSources, ",\n"), jsLibraryRequire, funcSource)
+}
+
+// JSLibraryModuleFunction returns the source of the function that runs a js_library module.
+func JSLibraryModuleFunction(moduleSource string) string {
+	return "function(module, exports, require) {\n" + moduleSource + "\n}"
+}
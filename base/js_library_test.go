@@ -0,0 +1,43 @@
+// Copyright 2022-Present Couchbase, Inc.
+//
+// Use of this software is governed by the Business Source License included
+// in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+// in that file, in accordance with the Business Source License, use of this
+// software will be governed by the Apache License, Version 2.0, included in
+// the file licenses/APL2.txt.
+
+package base
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrapJSFunctionWithLibrary(t *testing.T) {
+	const funcSource = `function(x) { return require("math").double(require("math").loads) + x; } // trailing comment`
+	assert.Equal(t, funcSource, WrapJSFunctionWithLibrary(funcSource, nil))
+
+	library := map[string]string{
+		"math": `var counter = require("counter");
+			counter.count++;
+			exports.loads = counter.count;
+			exports.double = function(x) { return 2 * x; };`,
+		"counter": `module.exports = {count: 0}; // trailing comment`,
+	}
+	runner, err := NewGojaRunner(WrapJSFunctionWithLibrary(funcSource, library), 0)
+	require.NoError(t, err)
+
+	// Modules are only run once per runner
+	for i := 0; i < 3; i++ {
+		result, err := runner.Call(1)
+		require.NoError(t, err)
+		assert.EqualValues(t, 3, result)
+	}
+
+	runner, err = NewGojaRunner(WrapJSFunctionWithLibrary(`function() { return require("missing"); }`, library), 0)
+	require.NoError(t, err)
+	_, err = runner.Call()
+	assert.ErrorContains(t, err, "Cannot find module 'missing' in js_library")
+}
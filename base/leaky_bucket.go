@@ -11,10 +11,13 @@ licenses/APL2.txt.
 package base
 
 import (
+	"context"
 	"errors"
 	"expvar"
 	"fmt"
 	"math"
+	"math/rand"
+	"sync"
 	"time"
 
 	sgbucket "github.com/couchbase/sg-bucket"
@@ -25,6 +28,19 @@ type LeakyBucket struct {
 	bucket    Bucket
 	incrCount uint16
 	config    LeakyBucketConfig
+	faultLock sync.Mutex // Guards faultRand and the fault injection settings of config
+	faultRand *rand.Rand // Created on first use, from config.FaultSeed
+}
+
+// ErrLeakyCasMismatch is returned by LeakyBucket for writes failed by LeakyBucketConfig.CasMismatchPercent.  It's
+// identified by IsCasMismatch, as for a CAS mismatch returned by the underlying bucket.
+var ErrLeakyCasMismatch = errors.New("Leaky bucket forced CAS mismatch")
+
+// LeakyLatency adds a delay to a percentage of bucket operations.  The delay is chosen uniformly between Min and Max.
+type LeakyLatency struct {
+	Percent float64 // Percentage of operations delayed, from 0 to 100
+	Min     time.Duration
+	Max     time.Duration
 }
 
 // The config object that controls the LeakyBucket behavior
@@ -76,6 +92,116 @@ type LeakyBucketConfig struct {
 
 	// When IgnoreClose is set to true, bucket.Close() is a no-op.  Used when multiple references to a bucket are active.
 	IgnoreClose bool
+
+	// OpLatency is the latency distribution of KV operations.  Each entry delays its percentage of operations, so
+	// that a mostly fast bucket with a long tail can be modelled as [{90, 0, 1ms}, {9, 10ms, 50ms}, {1, 1s, 2s}].
+	// Percentages should sum to no more than 100; the remaining operations aren't delayed.
+	OpLatency []LeakyLatency
+
+	// CasMismatchPercent is the percentage of CAS writes that fail with ErrLeakyCasMismatch.  Only writes given a
+	// non-zero CAS can fail.  Update and WriteUpdateWithXattr instead run their callback an extra time, as when the
+	// underlying bucket retries after a CAS mismatch.
+	CasMismatchPercent float64
+
+	// FeedDropPercent is the percentage of DCP and TAP feed events that are dropped, as when a stream is dropped and
+	// resumed after the mutation.
+	FeedDropPercent float64
+
+	// FaultSeed seeds the choice of operations that OpLatency, CasMismatchPercent and FeedDropPercent apply to, so
+	// that a failing run can be repeated.  A zero seed uses the current time.
+	FaultSeed int64
+}
+
+// _faultPercent returns true for the given percentage of calls.  Must be called with faultLock held.
+func (b *LeakyBucket) _faultPercent(percent float64) bool {
+	return percent > 0 && b._randFloat()*100 < percent
+}
+
+// _randFloat returns a random number in [0,1).  Must be called with faultLock held.
+func (b *LeakyBucket) _randFloat() float64 {
+	if b.faultRand == nil {
+		seed := b.config.FaultSeed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		b.faultRand = rand.New(rand.NewSource(seed))
+	}
+	return b.faultRand.Float64()
+}
+
+// injectLatency sleeps for a delay chosen from config.OpLatency.
+func (b *LeakyBucket) injectLatency() {
+	b.faultLock.Lock()
+	if len(b.config.OpLatency) == 0 {
+		b.faultLock.Unlock()
+		return
+	}
+	var delay time.Duration
+	r := b._randFloat() * 100
+	for _, latency := range b.config.OpLatency {
+		if r < latency.Percent {
+			delay = latency.Min
+			if latency.Max > latency.Min {
+				delay += time.Duration(b._randFloat() * float64(latency.Max-latency.Min))
+			}
+			break
+		}
+		r -= latency.Percent
+	}
+	b.faultLock.Unlock()
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// injectCasMismatch returns ErrLeakyCasMismatch for config.CasMismatchPercent of writes with a non-zero CAS.
+func (b *LeakyBucket) injectCasMismatch(cas uint64) error {
+	if cas == 0 {
+		return nil
+	}
+	b.faultLock.Lock()
+	defer b.faultLock.Unlock()
+	if b._faultPercent(b.config.CasMismatchPercent) {
+		return ErrLeakyCasMismatch
+	}
+	return nil
+}
+
+// injectCasRetry returns true for config.CasMismatchPercent of updates, which should run their callback an extra
+// time to emulate a retry after a CAS mismatch.
+func (b *LeakyBucket) injectCasRetry() bool {
+	b.faultLock.Lock()
+	defer b.faultLock.Unlock()
+	return b._faultPercent(b.config.CasMismatchPercent)
+}
+
+// dropFeedEvent returns true for config.FeedDropPercent of feed events.
+func (b *LeakyBucket) dropFeedEvent() bool {
+	b.faultLock.Lock()
+	defer b.faultLock.Unlock()
+	return b._faultPercent(b.config.FeedDropPercent)
+}
+
+// SetOpLatency sets the latency distribution of KV operations on a running bucket.
+func (b *LeakyBucket) SetOpLatency(latency []LeakyLatency) {
+	b.faultLock.Lock()
+	defer b.faultLock.Unlock()
+	b.config.OpLatency = latency
+}
+
+// SetCasMismatchPercent sets the percentage of CAS writes that fail on a running bucket.
+func (b *LeakyBucket) SetCasMismatchPercent(percent float64) {
+	b.faultLock.Lock()
+	defer b.faultLock.Unlock()
+	b.config.CasMismatchPercent = percent
+}
+
+// SetFeedDropPercent sets the percentage of feed events dropped on a running bucket.  Applies to feeds started
+// afterwards, and to running DCP feeds.
+func (b *LeakyBucket) SetFeedDropPercent(percent float64) {
+	b.faultLock.Lock()
+	defer b.faultLock.Unlock()
+	b.config.FeedDropPercent = percent
 }
 
 func (b *LeakyBucket) SetDDocDeleteErrorCount(i int) {
@@ -107,6 +233,7 @@ func (b *LeakyBucket) GetName() string {
 	return b.bucket.GetName()
 }
 func (b *LeakyBucket) Get(k string, rv interface{}) (cas uint64, err error) {
+	b.injectLatency()
 	return b.bucket.Get(k, rv)
 }
 
@@ -115,6 +242,7 @@ func (b *LeakyBucket) SetGetRawCallback(callback func(string) error) {
 }
 
 func (b *LeakyBucket) GetRaw(k string) (v []byte, cas uint64, err error) {
+	b.injectLatency()
 	if b.config.GetRawCallback != nil {
 		err = b.config.GetRawCallback(k)
 		if err != nil {
@@ -124,21 +252,27 @@ func (b *LeakyBucket) GetRaw(k string) (v []byte, cas uint64, err error) {
 	return b.bucket.GetRaw(k)
 }
 func (b *LeakyBucket) GetAndTouchRaw(k string, exp uint32) (v []byte, cas uint64, err error) {
+	b.injectLatency()
 	return b.bucket.GetAndTouchRaw(k, exp)
 }
 func (b *LeakyBucket) Touch(k string, exp uint32) (cas uint64, err error) {
+	b.injectLatency()
 	return b.bucket.Touch(k, exp)
 }
 func (b *LeakyBucket) Add(k string, exp uint32, v interface{}) (added bool, err error) {
+	b.injectLatency()
 	return b.bucket.Add(k, exp, v)
 }
 func (b *LeakyBucket) AddRaw(k string, exp uint32, v []byte) (added bool, err error) {
+	b.injectLatency()
 	return b.bucket.AddRaw(k, exp, v)
 }
 func (b *LeakyBucket) Set(k string, exp uint32, opts *sgbucket.UpsertOptions, v interface{}) error {
+	b.injectLatency()
 	return b.bucket.Set(k, exp, opts, v)
 }
 func (b *LeakyBucket) SetRaw(k string, exp uint32, opts *sgbucket.UpsertOptions, v []byte) error {
+	b.injectLatency()
 	for _, errorKey := range b.config.ForceErrorSetRawKeys {
 		if k == errorKey {
 			return fmt.Errorf("Leaky bucket forced SetRaw error for key %s", k)
@@ -147,15 +281,28 @@ func (b *LeakyBucket) SetRaw(k string, exp uint32, opts *sgbucket.UpsertOptions,
 	return b.bucket.SetRaw(k, exp, opts, v)
 }
 func (b *LeakyBucket) Delete(k string) error {
+	b.injectLatency()
 	return b.bucket.Delete(k)
 }
 func (b *LeakyBucket) Remove(k string, cas uint64) (casOut uint64, err error) {
+	b.injectLatency()
+	if err := b.injectCasMismatch(cas); err != nil {
+		return 0, err
+	}
 	return b.bucket.Remove(k, cas)
 }
 func (b *LeakyBucket) WriteCas(k string, flags int, exp uint32, cas uint64, v interface{}, opt sgbucket.WriteOptions) (uint64, error) {
+	b.injectLatency()
+	if err := b.injectCasMismatch(cas); err != nil {
+		return 0, err
+	}
 	return b.bucket.WriteCas(k, flags, exp, cas, v, opt)
 }
 func (b *LeakyBucket) Update(k string, exp uint32, callback sgbucket.UpdateFunc) (casOut uint64, err error) {
+	b.injectLatency()
+	if b.injectCasRetry() {
+		callback = casRetryUpdateFunc(callback)
+	}
 	if b.config.UpdateCallback != nil {
 		wrapperCallback := func(current []byte) (updated []byte, expiry *uint32, isDelete bool, err error) {
 			updated, expiry, isDelete, err = callback(current)
@@ -174,7 +321,23 @@ func (b *LeakyBucket) Update(k string, exp uint32, callback sgbucket.UpdateFunc)
 	return casOut, err
 }
 
+// casRetryUpdateFunc runs an update callback an extra time on its first call, as when the underlying bucket retries
+// an update after a CAS mismatch.
+func casRetryUpdateFunc(callback sgbucket.UpdateFunc) sgbucket.UpdateFunc {
+	retried := false
+	return func(current []byte) (updated []byte, expiry *uint32, isDelete bool, err error) {
+		if !retried {
+			retried = true
+			if _, _, _, err = callback(current); err != nil {
+				return nil, nil, false, err
+			}
+		}
+		return callback(current)
+	}
+}
+
 func (b *LeakyBucket) Incr(k string, amt, def uint64, exp uint32) (uint64, error) {
+	b.injectLatency()
 
 	if b.config.IncrTemporaryFailCount > 0 {
 		if b.incrCount < b.config.IncrTemporaryFailCount {
@@ -235,10 +398,18 @@ func (b *LeakyBucket) GetMaxVbno() (uint16, error) {
 }
 
 func (b *LeakyBucket) WriteCasWithXattr(k string, xattr string, exp uint32, cas uint64, opts *sgbucket.MutateInOptions, v interface{}, xv interface{}) (casOut uint64, err error) {
+	b.injectLatency()
+	if err := b.injectCasMismatch(cas); err != nil {
+		return 0, err
+	}
 	return b.bucket.WriteCasWithXattr(k, xattr, exp, cas, opts, v, xv)
 }
 
 func (b *LeakyBucket) WriteWithXattr(k string, xattrKey string, exp uint32, cas uint64, opts *sgbucket.MutateInOptions, value []byte, xattrValue []byte, isDelete bool, deleteBody bool) (casOut uint64, err error) {
+	b.injectLatency()
+	if err := b.injectCasMismatch(cas); err != nil {
+		return 0, err
+	}
 	if b.config.WriteWithXattrCallback != nil {
 		b.config.WriteWithXattrCallback(k)
 	}
@@ -246,6 +417,10 @@ func (b *LeakyBucket) WriteWithXattr(k string, xattrKey string, exp uint32, cas
 }
 
 func (b *LeakyBucket) WriteUpdateWithXattr(k string, xattr string, userXattrKey string, exp uint32, opts *sgbucket.MutateInOptions, previous *sgbucket.BucketDocument, callback sgbucket.WriteUpdateWithXattrFunc) (casOut uint64, err error) {
+	b.injectLatency()
+	if b.injectCasRetry() {
+		callback = casRetryWriteUpdateWithXattrFunc(callback)
+	}
 	if b.config.UpdateCallback != nil {
 		wrapperCallback := func(current []byte, xattr []byte, userXattr []byte, cas uint64) (updated []byte, updatedXattr []byte, deletedDoc bool, expiry *uint32, err error) {
 			updated, updatedXattr, deletedDoc, expiry, err = callback(current, xattr, userXattr, cas)
@@ -257,7 +432,23 @@ func (b *LeakyBucket) WriteUpdateWithXattr(k string, xattr string, userXattrKey
 	return b.bucket.WriteUpdateWithXattr(k, xattr, userXattrKey, exp, opts, previous, callback)
 }
 
+// casRetryWriteUpdateWithXattrFunc runs an update callback an extra time on its first call, as when the underlying
+// bucket retries an update after a CAS mismatch.
+func casRetryWriteUpdateWithXattrFunc(callback sgbucket.WriteUpdateWithXattrFunc) sgbucket.WriteUpdateWithXattrFunc {
+	retried := false
+	return func(current []byte, xattr []byte, userXattr []byte, cas uint64) (updated []byte, updatedXattr []byte, deletedDoc bool, expiry *uint32, err error) {
+		if !retried {
+			retried = true
+			if _, _, _, _, err = callback(current, xattr, userXattr, cas); err != nil {
+				return nil, nil, false, nil, err
+			}
+		}
+		return callback(current, xattr, userXattr, cas)
+	}
+}
+
 func (b *LeakyBucket) SetXattr(k string, xattrKey string, xv []byte) (casOut uint64, err error) {
+	b.injectLatency()
 	if b.config.SetXattrCallback != nil {
 		if err := b.config.SetXattrCallback(k); err != nil {
 			return 0, err
@@ -267,49 +458,67 @@ func (b *LeakyBucket) SetXattr(k string, xattrKey string, xv []byte) (casOut uin
 }
 
 func (b *LeakyBucket) RemoveXattr(k string, xattrKey string, cas uint64) (err error) {
+	b.injectLatency()
+	if err := b.injectCasMismatch(cas); err != nil {
+		return err
+	}
 	return b.bucket.RemoveXattr(k, xattrKey, cas)
 }
 
 func (b *LeakyBucket) DeleteXattrs(k string, xattrKeys ...string) (err error) {
+	b.injectLatency()
 	return b.bucket.DeleteXattrs(k, xattrKeys...)
 }
 
 func (b *LeakyBucket) SubdocInsert(docID string, fieldPath string, cas uint64, value interface{}) error {
+	b.injectLatency()
 	return b.bucket.SubdocInsert(docID, fieldPath, cas, value)
 }
 
 func (b *LeakyBucket) GetWithXattr(k string, xattr string, userXattrKey string, rv interface{}, xv interface{}, uxv interface{}) (cas uint64, err error) {
+	b.injectLatency()
 	return b.bucket.GetWithXattr(k, xattr, userXattrKey, rv, xv, uxv)
 }
 
 func (b *LeakyBucket) DeleteWithXattr(k string, xattr string) error {
+	b.injectLatency()
 	return b.bucket.DeleteWithXattr(k, xattr)
 }
 
 func (b *LeakyBucket) GetXattr(k string, xattr string, xv interface{}) (cas uint64, err error) {
+	b.injectLatency()
 	return b.bucket.GetXattr(k, xattr, xv)
 }
 
 func (b *LeakyBucket) GetSubDocRaw(k string, subdocKey string) ([]byte, uint64, error) {
+	b.injectLatency()
 	return b.bucket.GetSubDocRaw(k, subdocKey)
 }
 
 func (b *LeakyBucket) WriteSubDoc(k string, subdocKey string, cas uint64, value []byte) (uint64, error) {
+	b.injectLatency()
+	if err := b.injectCasMismatch(cas); err != nil {
+		return 0, err
+	}
 	return b.bucket.WriteSubDoc(k, subdocKey, cas, value)
 }
 
 func (b *LeakyBucket) StartTapFeed(args sgbucket.FeedArguments, dbStats *expvar.Map) (sgbucket.MutationFeed, error) {
 
+	b.faultLock.Lock()
+	feedDropPercent := b.config.FeedDropPercent
+	b.faultLock.Unlock()
+
 	if b.config.TapFeedDeDuplication {
 		return b.wrapFeedForDeduplication(args, dbStats)
-	} else if len(b.config.TapFeedMissingDocs) > 0 {
+	} else if len(b.config.TapFeedMissingDocs) > 0 || feedDropPercent > 0 {
 		callback := func(event *sgbucket.FeedEvent) bool {
 			for _, key := range b.config.TapFeedMissingDocs {
 				if string(event.Key) == key {
 					return false
 				}
 			}
-			return true
+			return !b.dropFeedEvent()
 		}
 		return b.wrapFeed(args, callback, dbStats)
 	} else if b.config.TapFeedVbuckets {
@@ -342,7 +551,17 @@ func (b *LeakyBucket) StartTapFeed(args sgbucket.FeedArguments, dbStats *expvar.
 }
 
 func (b *LeakyBucket) StartDCPFeed(args sgbucket.FeedArguments, callback sgbucket.FeedEventCallbackFunc, dbStats *expvar.Map) error {
-	return b.bucket.StartDCPFeed(args, callback, dbStats)
+	return b.bucket.StartDCPFeed(args, b.wrapDCPCallback(callback), dbStats)
+}
+
+// wrapDCPCallback drops config.FeedDropPercent of the events sent to a DCP feed callback.
+func (b *LeakyBucket) wrapDCPCallback(callback sgbucket.FeedEventCallbackFunc) sgbucket.FeedEventCallbackFunc {
+	return func(event sgbucket.FeedEvent) bool {
+		if b.dropFeedEvent() {
+			return false
+		}
+		return callback(event)
+	}
 }
 
 type EventUpdateFunc func(event *sgbucket.FeedEvent) bool
@@ -539,6 +758,20 @@ func (b *LeakyBucket) Query(statement string, params map[string]interface{}, con
 	return results, err
 }
 
+func (b *LeakyBucket) QueryContext(ctx context.Context, statement string, params map[string]interface{}, consistency ConsistencyMode, adhoc bool) (results sgbucket.QueryResultIterator, err error) {
+	n1qlStore, ok := AsN1QLStore(b.bucket)
+	if !ok {
+		return nil, errors.New("Not N1QL Store")
+	}
+
+	results, err = QueryContext(ctx, n1qlStore, statement, params, consistency, adhoc)
+	if b.config.PostN1QLQueryCallback != nil {
+		b.config.PostN1QLQueryCallback()
+	}
+
+	return results, err
+}
+
 func (b *LeakyBucket) ExplainQuery(statement string, params map[string]interface{}) (plain map[string]interface{}, err error) {
 	n1qlStore, ok := AsN1QLStore(b.bucket)
 	if !ok {
@@ -650,6 +883,7 @@ func (b *LeakyBucket) IsError(err error, errorType sgbucket.DataStoreErrorType)
 }
 
 func (b *LeakyBucket) GetExpiry(k string) (expiry uint32, err error) {
+	b.injectLatency()
 	return b.bucket.GetExpiry(k)
 }
 
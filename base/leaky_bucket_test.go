@@ -12,9 +12,11 @@ package base
 
 import (
 	"testing"
+	"time"
 
 	sgbucket "github.com/couchbase/sg-bucket"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestDedupeTapEventsLaterSeqSameDoc(t *testing.T) {
@@ -68,3 +70,74 @@ func TestDedupeNoDedupeDifferentDocs(t *testing.T) {
 	assert.True(t, len(deduped) == 2)
 
 }
+
+func TestLeakyBucketCasMismatch(t *testing.T) {
+	testBucket := GetTestBucket(t)
+	defer testBucket.Close()
+	bucket := NewLeakyBucket(testBucket, LeakyBucketConfig{CasMismatchPercent: 100})
+
+	// Writes without a CAS aren't failed
+	cas, err := bucket.WriteCas("doc1", 0, 0, 0, []byte(`{"a":1}`), sgbucket.Raw)
+	require.NoError(t, err)
+
+	_, err = bucket.WriteCas("doc1", 0, 0, cas, []byte(`{"a":2}`), sgbucket.Raw)
+	assert.True(t, IsCasMismatch(err))
+
+	// Updates run their callback again, as for a retry
+	callbackCount := 0
+	_, err = bucket.Update("doc1", 0, func(current []byte) (updated []byte, expiry *uint32, isDelete bool, err error) {
+		callbackCount++
+		return []byte(`{"a":3}`), nil, false, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, callbackCount)
+
+	bucket.SetCasMismatchPercent(0)
+	_, err = bucket.WriteCas("doc1", 0, 0, cas, []byte(`{"a":2}`), sgbucket.Raw)
+	assert.True(t, IsCasMismatch(err)) // CAS changed by the update
+	_, cas, err = bucket.GetRaw("doc1")
+	require.NoError(t, err)
+	_, err = bucket.WriteCas("doc1", 0, 0, cas, []byte(`{"a":4}`), sgbucket.Raw)
+	assert.NoError(t, err)
+}
+
+func TestLeakyBucketOpLatency(t *testing.T) {
+	testBucket := GetTestBucket(t)
+	defer testBucket.Close()
+	bucket := NewLeakyBucket(testBucket, LeakyBucketConfig{
+		OpLatency: []LeakyLatency{{Percent: 100, Min: 50 * time.Millisecond, Max: 60 * time.Millisecond}},
+	})
+
+	start := time.Now()
+	require.NoError(t, bucket.SetRaw("doc1", 0, nil, []byte(`{}`)))
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	bucket.SetOpLatency(nil)
+	start = time.Now()
+	_, _, err := bucket.GetRaw("doc1")
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestLeakyBucketFeedDrop(t *testing.T) {
+	bucket := NewLeakyBucket(nil, LeakyBucketConfig{FeedDropPercent: 50, FaultSeed: 1})
+	received := 0
+	callback := bucket.wrapDCPCallback(func(event sgbucket.FeedEvent) bool {
+		received++
+		return true
+	})
+
+	const numEvents = 1000
+	for i := 0; i < numEvents; i++ {
+		callback(sgbucket.FeedEvent{Opcode: sgbucket.FeedOpMutation, Key: []byte("doc1")})
+	}
+	assert.Greater(t, received, numEvents/4)
+	assert.Less(t, received, numEvents*3/4)
+
+	bucket.SetFeedDropPercent(0)
+	received = 0
+	for i := 0; i < numEvents; i++ {
+		callback(sgbucket.FeedEvent{Opcode: sgbucket.FeedOpMutation, Key: []byte("doc1")})
+	}
+	assert.Equal(t, numEvents, received)
+}
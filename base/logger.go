@@ -35,6 +35,9 @@ func FlushLogBuffers() {
 		statsLogger,
 		&consoleLogger.FileLogger,
 	}
+	if auditLogger != nil {
+		loggers = append(loggers, auditLogger.FileLogger)
+	}
 
 	for _, logger := range loggers {
 		if logger != nil && cap(logger.collateBuffer) > 1 {
@@ -0,0 +1,274 @@
+/*
+Copyright 2022-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package base
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/natefinch/lumberjack"
+)
+
+const (
+	auditMinAge = 30
+
+	// auditLoggerName is used to name the audit log file, sg_audit.log
+	auditLoggerName = "audit"
+)
+
+// AuditEvent identifies the kind of action recorded in an audit log record.
+type AuditEvent string
+
+const (
+	AuditEventAdminAPIMutation             AuditEvent = "admin_api_mutation"             // A non-GET request to the admin API completed
+	AuditEventAdminAuthenticationSucceeded AuditEvent = "admin_authentication_succeeded" // A user authenticated as an admin
+	AuditEventAdminAuthenticationFailed    AuditEvent = "admin_authentication_failed"    // A user failed to authenticate as an admin
+	AuditEventAuthenticationSucceeded      AuditEvent = "authentication_succeeded"       // A user authenticated with a database
+	AuditEventAuthenticationFailed         AuditEvent = "authentication_failed"          // A user failed to authenticate with a database
+)
+
+// AllAuditEvents are the events that can be recorded in the audit log.
+var AllAuditEvents = []AuditEvent{
+	AuditEventAdminAPIMutation,
+	AuditEventAdminAuthenticationSucceeded,
+	AuditEventAdminAuthenticationFailed,
+	AuditEventAuthenticationSucceeded,
+	AuditEventAuthenticationFailed,
+}
+
+// AuditLoggerConfig configures the audit log file, sg_audit.log, which is disabled by default.
+type AuditLoggerConfig struct {
+	FileLoggerConfig
+
+	EnabledEvents []string `json:"enabled_events,omitempty"` // Events to record in the audit log. Defaults to all events
+}
+
+// AuditFields describes who did what, when and from where, and the result.
+type AuditFields struct {
+	User          string `json:"user,omitempty"`           // Name of the user, empty for guest or unauthenticated requests
+	SourceIP      string `json:"source_ip,omitempty"`      // Address the request was received from
+	Database      string `json:"db,omitempty"`             // Database the request was for
+	Method        string `json:"method,omitempty"`         // HTTP method of the request
+	Path          string `json:"path,omitempty"`           // Path of the request
+	Status        int    `json:"status,omitempty"`         // HTTP status of the response
+	CorrelationID string `json:"correlation_id,omitempty"` // Correlates the record with the request's other logs
+}
+
+// auditRecord is a line of the audit log.  Records are numbered sequentially and each hash covers the previous
+// record's hash, so that removing, reordering or changing records can be detected by recomputing the chain.
+type auditRecord struct {
+	Seq       uint64     `json:"seq"`
+	Timestamp string     `json:"timestamp"`
+	Event     AuditEvent `json:"event"`
+	AuditFields
+	Hash string `json:"hash,omitempty"` // Hex SHA-256 of the previous record's hash followed by this record's JSON without its hash
+}
+
+// AuditLogger writes audit records to the audit log file.
+type AuditLogger struct {
+	*FileLogger
+
+	events map[AuditEvent]struct{}
+
+	lock     sync.Mutex // Orders records, and protects lastSeq and lastHash
+	lastSeq  uint64
+	lastHash string
+}
+
+var auditLogger *AuditLogger
+
+// NewAuditLogger returns a new AuditLogger from a config.
+func NewAuditLogger(config *AuditLoggerConfig, logFilePath string) (*AuditLogger, error) {
+	if config == nil {
+		config = &AuditLoggerConfig{}
+	}
+
+	// Unlike the other log files, audit logging must be explicitly enabled
+	if config.Enabled == nil {
+		config.Enabled = BoolPtr(false)
+	}
+
+	events := make(map[AuditEvent]struct{}, len(AllAuditEvents))
+	if len(config.EnabledEvents) == 0 {
+		for _, event := range AllAuditEvents {
+			events[event] = struct{}{}
+		}
+	}
+	for _, name := range config.EnabledEvents {
+		event, err := parseAuditEvent(name)
+		if err != nil {
+			return nil, err
+		}
+		events[event] = struct{}{}
+	}
+
+	fileLogger, err := NewFileLogger(&config.FileLoggerConfig, LevelNone, auditLoggerName, logFilePath, auditMinAge, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := &AuditLogger{FileLogger: fileLogger, events: events}
+	if err := logger.continueChain(); err != nil {
+		return nil, err
+	}
+	return logger, nil
+}
+
+// continueChain numbers and chains new records on from the last record in the existing audit log, so that the chain
+// isn't restarted when Sync Gateway restarts.  The most recently rotated log files are checked if the current log file
+// has no records.
+func (l *AuditLogger) continueChain() error {
+	output, ok := l.output.(*lumberjack.Logger)
+	if !ok {
+		return nil
+	}
+
+	// Rotated files are named by the time of their rotation, so sort with the most recent first
+	ext := filepath.Ext(output.Filename)
+	rotated, err := filepath.Glob(strings.TrimSuffix(output.Filename, ext) + "-*" + ext + "*")
+	if err != nil {
+		return err
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(rotated)))
+
+	for _, filename := range append([]string{output.Filename}, rotated...) {
+		record, err := lastAuditRecord(filename)
+		if err != nil {
+			return fmt.Errorf("unable to read the last record of audit log %s: %w", filename, err)
+		}
+		if record != nil {
+			l.lastSeq = record.Seq
+			l.lastHash = record.Hash
+			return nil
+		}
+	}
+	return nil
+}
+
+// lastAuditRecord returns the last complete record in the given audit log file, which may be gzip compressed.  Returns
+// nil if the file doesn't exist or has no records.
+func lastAuditRecord(filename string) (*auditRecord, error) {
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	var reader io.Reader = file
+	if strings.HasSuffix(filename, ".gz") {
+		gzipReader, err := gzip.NewReader(file)
+		if err == io.EOF {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		defer func() { _ = gzipReader.Close() }()
+		reader = gzipReader
+	}
+
+	// A record that was only partly written when Sync Gateway stopped doesn't parse, so is skipped
+	var last *auditRecord
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var record auditRecord
+		if err := JSONUnmarshal(scanner.Bytes(), &record); err == nil && record.Hash != "" {
+			last = &record
+		}
+	}
+	return last, scanner.Err()
+}
+
+// parseAuditEvent returns the audit event with the given name.
+func parseAuditEvent(name string) (AuditEvent, error) {
+	for _, event := range AllAuditEvents {
+		if string(event) == name {
+			return event, nil
+		}
+	}
+	return "", fmt.Errorf("unrecognized audit event: %q", name)
+}
+
+// shouldLog returns true if the given event should be recorded.
+func (l *AuditLogger) shouldLog(event AuditEvent) bool {
+	if l == nil || !l.FileLogger.shouldLog(LevelNone) {
+		return false
+	}
+	_, ok := l.events[event]
+	return ok
+}
+
+// record writes the event to the audit log, numbered and chained to the previous record.
+func (l *AuditLogger) record(event AuditEvent, fields AuditFields) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	record := auditRecord{
+		Seq:         l.lastSeq + 1,
+		Timestamp:   time.Now().Format(ISO8601Format),
+		Event:       event,
+		AuditFields: fields,
+	}
+	unhashed, err := JSONMarshal(record)
+	if err != nil {
+		return
+	}
+	hash := sha256.Sum256(append([]byte(l.lastHash), unhashed...))
+	record.Hash = hex.EncodeToString(hash[:])
+	data, err := JSONMarshal(record)
+	if err != nil {
+		return
+	}
+
+	l.logf("%s", data)
+	l.lastSeq = record.Seq
+	l.lastHash = record.Hash
+}
+
+// Audit records the event in the audit log, if audit logging is enabled for the event.  Audit records aren't
+// redacted, as the audit log is needed to identify who performed an action.
+func Audit(event AuditEvent, fields AuditFields) {
+	if !auditLogger.shouldLog(event) {
+		return
+	}
+	auditLogger.record(event, fields)
+}
+
+// AuditEnabled returns true if the event is recorded in the audit log, so that callers can avoid building its fields.
+func AuditEnabled(event AuditEvent) bool {
+	return auditLogger.shouldLog(event)
+}
+
+func (l *AuditLogger) getAuditLoggerConfig() *AuditLoggerConfig {
+	config := AuditLoggerConfig{}
+	if l == nil {
+		return &config
+	}
+	config.FileLoggerConfig = *l.getFileLoggerConfig()
+	for _, event := range AllAuditEvents {
+		if _, ok := l.events[event]; ok {
+			config.EnabledEvents = append(config.EnabledEvents, string(event))
+		}
+	}
+	return &config
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2022-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package base
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/natefinch/lumberjack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditLogger(t *testing.T) {
+	_, err := NewAuditLogger(&AuditLoggerConfig{EnabledEvents: []string{"unknown"}}, t.TempDir())
+	assert.Error(t, err)
+
+	var buf bytes.Buffer
+	l, err := NewAuditLogger(&AuditLoggerConfig{
+		FileLoggerConfig: FileLoggerConfig{Enabled: BoolPtr(true), Output: &buf},
+		EnabledEvents:    []string{string(AuditEventAdminAPIMutation), string(AuditEventAuthenticationFailed)},
+	}, t.TempDir())
+	require.NoError(t, err)
+
+	assert.True(t, l.shouldLog(AuditEventAdminAPIMutation))
+	assert.False(t, l.shouldLog(AuditEventAuthenticationSucceeded))
+
+	l.record(AuditEventAdminAPIMutation, AuditFields{User: "admin", SourceIP: "10.0.0.1", Database: "db", Method: "PUT", Path: "/db/_config", Status: 201})
+	l.record(AuditEventAuthenticationFailed, AuditFields{User: "alice", SourceIP: "10.0.0.2", Database: "db", Method: "GET", Path: "/db/doc", Status: 401})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+
+	// Recompute the hash chain
+	prevHash := ""
+	for i, line := range lines {
+		var record auditRecord
+		require.NoError(t, JSONUnmarshal([]byte(line), &record))
+		assert.Equal(t, uint64(i+1), record.Seq)
+
+		hashIndex := strings.LastIndex(line, `,"hash":`)
+		require.NotEqual(t, -1, hashIndex)
+		hash := sha256.Sum256([]byte(prevHash + line[:hashIndex] + "}"))
+		assert.Equal(t, hex.EncodeToString(hash[:]), record.Hash)
+		prevHash = record.Hash
+	}
+	assert.Contains(t, lines[0], `"event":"admin_api_mutation"`)
+	assert.Contains(t, lines[0], `"user":"admin"`)
+	assert.Contains(t, lines[1], `"event":"authentication_failed"`)
+	assert.Contains(t, lines[1], `"source_ip":"10.0.0.2"`)
+
+	// Disabled by default
+	l, err = NewAuditLogger(&AuditLoggerConfig{FileLoggerConfig: FileLoggerConfig{Output: &buf}}, t.TempDir())
+	require.NoError(t, err)
+	assert.False(t, l.shouldLog(AuditEventAdminAPIMutation))
+}
+
+func TestAuditLoggerContinuesChain(t *testing.T) {
+	logFilePath := t.TempDir()
+	logFile := filepath.Join(logFilePath, "sg_audit.log")
+	newLogger := func() *AuditLogger {
+		l, err := NewAuditLogger(&AuditLoggerConfig{FileLoggerConfig: FileLoggerConfig{Enabled: BoolPtr(true)}}, logFilePath)
+		require.NoError(t, err)
+		t.Cleanup(func() { assert.NoError(t, l.output.(*lumberjack.Logger).Close()) })
+		return l
+	}
+
+	l := newLogger()
+	l.record(AuditEventAdminAPIMutation, AuditFields{User: "admin"})
+	l.record(AuditEventAdminAPIMutation, AuditFields{User: "admin"})
+	lastHash := l.lastHash
+
+	// A restarted logger continues from the last record in the log
+	l = newLogger()
+	assert.Equal(t, uint64(2), l.lastSeq)
+	assert.Equal(t, lastHash, l.lastHash)
+	l.record(AuditEventAdminAPIMutation, AuditFields{User: "admin"})
+
+	data, err := ioutil.ReadFile(logFile)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 3)
+	var record auditRecord
+	require.NoError(t, JSONUnmarshal([]byte(lines[2]), &record))
+	assert.Equal(t, uint64(3), record.Seq)
+	hashIndex := strings.LastIndex(lines[2], `,"hash":`)
+	require.NotEqual(t, -1, hashIndex)
+	hash := sha256.Sum256([]byte(lastHash + lines[2][:hashIndex] + "}"))
+	assert.Equal(t, hex.EncodeToString(hash[:]), record.Hash)
+
+	// The most recently rotated log is used when the current log has no records, ignoring a partly written record
+	lastHash = l.lastHash
+	require.NoError(t, l.output.(*lumberjack.Logger).Close())
+	file, err := os.OpenFile(logFile, os.O_APPEND|os.O_WRONLY, 0600)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"seq":4,"timestamp":`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	require.NoError(t, os.Rename(logFile, filepath.Join(logFilePath, "sg_audit-2022-01-02T00-00-00.000.log")))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(logFilePath, "sg_audit-2022-01-01T00-00-00.000.log"), []byte(`{"seq":1,"hash":"older"}`+"\n"), 0600))
+	l = newLogger()
+	assert.Equal(t, uint64(3), l.lastSeq)
+	assert.Equal(t, lastHash, l.lastHash)
+}
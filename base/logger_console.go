@@ -11,6 +11,7 @@ licenses/APL2.txt.
 package base
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
@@ -18,6 +19,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"sync"
+	"sync/atomic"
 
 	"github.com/natefinch/lumberjack"
 )
@@ -115,19 +117,35 @@ func (l *ConsoleLogger) shouldLog(logLevel LogLevel, logKey LogKey) bool {
 	if l == nil || l.logger == nil {
 		return false
 	}
+	return shouldLogLevelAndKey(l.LogLevel, l.LogKeyMask, logLevel, logKey)
+}
+
+// shouldLogCtx returns true if the given logLevel and logKey should get logged, using the console log level and log keys
+// of the database in the log context when they've been overridden.
+func (l *ConsoleLogger) shouldLogCtx(ctx context.Context, logLevel LogLevel, logKey LogKey) bool {
+	if l == nil || l.logger == nil {
+		return false
+	}
+	if dbLogger := dbConsoleLoggerFromContext(ctx); dbLogger != nil {
+		return shouldLogLevelAndKey(dbLogger.logLevel(l), dbLogger.logKeyMask(l), logLevel, logKey)
+	}
+	return shouldLogLevelAndKey(l.LogLevel, l.LogKeyMask, logLevel, logKey)
+}
 
+// shouldLogLevelAndKey returns true if the given logLevel and logKey are enabled by the level and log key mask.
+func shouldLogLevelAndKey(level *LogLevel, logKeyMask *LogKeyMask, logLevel LogLevel, logKey LogKey) bool {
 	// Log level disabled
-	if !l.LogLevel.Enabled(logLevel) {
+	if !level.Enabled(logLevel) {
 		return false
 	}
 
 	// Log key All should always log at this point, unless KeyNone is set
-	if logKey == KeyAll && !l.LogKeyMask.Enabled(KeyNone) {
+	if logKey == KeyAll && !logKeyMask.Enabled(KeyNone) {
 		return true
 	}
 
 	// Finally, check the specific log key is enabled
-	return l.LogKeyMask.Enabled(logKey)
+	return logKeyMask.Enabled(logKey)
 }
 
 func (l *ConsoleLogger) getConsoleLoggerConfig() *ConsoleLoggerConfig {
@@ -224,3 +242,121 @@ func mustInitConsoleLogger(config *ConsoleLoggerConfig) *ConsoleLogger {
 	}
 	return logger
 }
+
+// DbConsoleLoggerConfig overrides the console log level and log keys for the logs of a single database.
+type DbConsoleLoggerConfig struct {
+	LogLevel *LogLevel `json:"log_level,omitempty"` // Log level for the database's console output, defaults to the console log level
+	LogKeys  []string  `json:"log_keys,omitempty"`  // Log keys for the database's console output, defaults to the console log keys
+}
+
+// dbConsoleLogger is a database's console log level and log keys, where they've been overridden.
+type dbConsoleLogger struct {
+	config  DbConsoleLoggerConfig
+	level   *LogLevel
+	keyMask *LogKeyMask
+}
+
+// logLevel returns the database's console log level, or the console logger's when not overridden.
+func (l *dbConsoleLogger) logLevel(consoleLogger *ConsoleLogger) *LogLevel {
+	if l.level != nil {
+		return l.level
+	}
+	return consoleLogger.LogLevel
+}
+
+// logKeyMask returns the database's console log keys, or the console logger's when not overridden.
+func (l *dbConsoleLogger) logKeyMask(consoleLogger *ConsoleLogger) *LogKeyMask {
+	if l.keyMask != nil {
+		return l.keyMask
+	}
+	return consoleLogger.LogKeyMask
+}
+
+var (
+	// dbConsoleLoggers holds a map[string]*dbConsoleLogger keyed by database name.  The map is replaced rather than
+	// modified, so that logging can read it without a lock.
+	dbConsoleLoggers     atomic.Value
+	dbConsoleLoggersLock sync.Mutex // Serializes updates of dbConsoleLoggers
+)
+
+// loadDbConsoleLoggers returns the databases with overridden console log levels or log keys.
+func loadDbConsoleLoggers() map[string]*dbConsoleLogger {
+	loggers, _ := dbConsoleLoggers.Load().(map[string]*dbConsoleLogger)
+	return loggers
+}
+
+// dbConsoleLoggerFromContext returns the overridden console log level and log keys for the database in the log context,
+// or nil if there's no database or it uses the console logger's.
+func dbConsoleLoggerFromContext(ctx context.Context) *dbConsoleLogger {
+	loggers := loadDbConsoleLoggers()
+	if len(loggers) == 0 || ctx == nil {
+		return nil
+	}
+	dbLogCtx, ok := ctx.Value(databaseLogContextKey).(*DatabaseLogContext)
+	if !ok || dbLogCtx == nil {
+		return nil
+	}
+	return loggers[dbLogCtx.DatabaseName]
+}
+
+// dbConsoleLoggersShouldLog returns true if any database has overridden its console log level and log keys such that
+// the given logLevel and logKey should get logged.
+func dbConsoleLoggersShouldLog(logLevel LogLevel, logKey LogKey) bool {
+	if consoleLogger == nil || consoleLogger.logger == nil {
+		return false
+	}
+	for _, dbLogger := range loadDbConsoleLoggers() {
+		if shouldLogLevelAndKey(dbLogger.logLevel(consoleLogger), dbLogger.logKeyMask(consoleLogger), logLevel, logKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetDbConsoleLoggerConfig overrides the console log level and log keys for the logs of the given database, or removes
+// the override when config is nil.
+func SetDbConsoleLoggerConfig(dbName string, config *DbConsoleLoggerConfig) error {
+	var dbLogger *dbConsoleLogger
+	if config != nil {
+		dbLogger = &dbConsoleLogger{config: *config}
+		if config.LogLevel != nil {
+			if *config.LogLevel < LevelNone || *config.LogLevel >= levelCount {
+				return fmt.Errorf("invalid log level: %v", *config.LogLevel)
+			}
+			level := *config.LogLevel
+			dbLogger.level = &level
+		}
+		if len(config.LogKeys) > 0 {
+			keyMask := ToLogKey(config.LogKeys)
+			// Always enable the HTTP log key, as for the console logger
+			keyMask.Enable(KeyHTTP)
+			dbLogger.keyMask = &keyMask
+		}
+	}
+
+	dbConsoleLoggersLock.Lock()
+	defer dbConsoleLoggersLock.Unlock()
+	current := loadDbConsoleLoggers()
+	updated := make(map[string]*dbConsoleLogger, len(current)+1)
+	for name, logger := range current {
+		updated[name] = logger
+	}
+	if dbLogger != nil {
+		updated[dbName] = dbLogger
+	} else {
+		delete(updated, dbName)
+	}
+	dbConsoleLoggers.Store(updated)
+	return nil
+}
+
+// GetDbConsoleLoggerConfig returns the overridden console log level and log keys of the given database, or nil if it
+// uses the console logger's.
+func GetDbConsoleLoggerConfig(dbName string) *DbConsoleLoggerConfig {
+	dbLogger, ok := loadDbConsoleLoggers()[dbName]
+	if !ok {
+		return nil
+	}
+	config := dbLogger.config
+	return &config
+}
@@ -16,6 +16,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var consoleShouldLogTests = []struct {
@@ -112,6 +113,45 @@ func TestConsoleShouldLog(t *testing.T) {
 	}
 }
 
+func TestDbConsoleLoggerOverride(t *testing.T) {
+	l := mustInitConsoleLogger(&ConsoleLoggerConfig{
+		LogLevel: logLevelPtr(LevelInfo),
+		LogKeys:  []string{"HTTP"},
+		FileLoggerConfig: FileLoggerConfig{
+			Enabled: BoolPtr(true),
+			Output:  ioutil.Discard,
+		}})
+
+	noisyCtx := LogContextWith(TestCtx(t), &DatabaseLogContext{DatabaseName: "noisy"})
+	otherCtx := LogContextWith(TestCtx(t), &DatabaseLogContext{DatabaseName: "other"})
+
+	assert.False(t, l.shouldLogCtx(noisyCtx, LevelDebug, KeyCRUD))
+
+	assert.Error(t, SetDbConsoleLoggerConfig("noisy", &DbConsoleLoggerConfig{LogLevel: logLevelPtr(levelCount)}))
+	require.NoError(t, SetDbConsoleLoggerConfig("noisy", &DbConsoleLoggerConfig{LogLevel: logLevelPtr(LevelDebug), LogKeys: []string{"CRUD"}}))
+	defer func() { require.NoError(t, SetDbConsoleLoggerConfig("noisy", nil)) }()
+	assert.Equal(t, &DbConsoleLoggerConfig{LogLevel: logLevelPtr(LevelDebug), LogKeys: []string{"CRUD"}}, GetDbConsoleLoggerConfig("noisy"))
+	assert.Nil(t, GetDbConsoleLoggerConfig("other"))
+
+	// Only the overridden database logs at debug level, for its log keys and HTTP
+	assert.True(t, l.shouldLogCtx(noisyCtx, LevelDebug, KeyCRUD))
+	assert.True(t, l.shouldLogCtx(noisyCtx, LevelDebug, KeyHTTP))
+	assert.False(t, l.shouldLogCtx(noisyCtx, LevelDebug, KeyDCP))
+	assert.False(t, l.shouldLogCtx(noisyCtx, LevelTrace, KeyCRUD))
+	assert.False(t, l.shouldLogCtx(otherCtx, LevelDebug, KeyCRUD))
+	assert.False(t, l.shouldLogCtx(TestCtx(t), LevelDebug, KeyCRUD))
+	assert.True(t, l.shouldLogCtx(otherCtx, LevelInfo, KeyHTTP))
+
+	// Unset properties default to the console logger's
+	require.NoError(t, SetDbConsoleLoggerConfig("noisy", &DbConsoleLoggerConfig{LogKeys: []string{"CRUD"}}))
+	assert.True(t, l.shouldLogCtx(noisyCtx, LevelInfo, KeyCRUD))
+	assert.False(t, l.shouldLogCtx(noisyCtx, LevelDebug, KeyCRUD))
+
+	require.NoError(t, SetDbConsoleLoggerConfig("noisy", nil))
+	assert.Nil(t, GetDbConsoleLoggerConfig("noisy"))
+	assert.False(t, l.shouldLogCtx(noisyCtx, LevelInfo, KeyCRUD))
+}
+
 func BenchmarkConsoleShouldLog(b *testing.B) {
 	for _, test := range consoleShouldLogTests {
 		name := fmt.Sprintf("logger{%s,%s}.shouldLog(%s,%s)",
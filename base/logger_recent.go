@@ -0,0 +1,140 @@
+/*
+Copyright 2022-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package base
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultRecentLogEntriesLimit is the number of recent warnings and errors kept in memory for each database by default.
+const DefaultRecentLogEntriesLimit = 100
+
+// RecentLogEntry is a warning or error logged for a database.  The message is redacted according to the redaction
+// level, as for the log files.
+type RecentLogEntry struct {
+	Timestamp     string `json:"timestamp"`
+	Level         string `json:"level"` // error or warn
+	Message       string `json:"msg"`
+	Caller        string `json:"caller,omitempty"`
+	CorrelationID string `json:"correlation_id,omitempty"`
+}
+
+// recentLogBuffer is a ring buffer of a database's most recent warning and error log entries.
+type recentLogBuffer struct {
+	lock    sync.Mutex
+	entries []RecentLogEntry // Grows up to the limit, then wraps around
+	next    int              // Index that the next entry is written to once the buffer is full
+	limit   int
+}
+
+// add adds an entry to the buffer, replacing the oldest entry when the buffer is full.
+func (b *recentLogBuffer) add(entry RecentLogEntry) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if len(b.entries) < b.limit {
+		b.entries = append(b.entries, entry)
+		return
+	}
+	b.entries[b.next] = entry
+	b.next = (b.next + 1) % b.limit
+}
+
+// snapshot returns a copy of the entries in the buffer, oldest first.
+func (b *recentLogBuffer) snapshot() []RecentLogEntry {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	entries := make([]RecentLogEntry, 0, len(b.entries))
+	entries = append(entries, b.entries[b.next:]...)
+	return append(entries, b.entries[:b.next]...)
+}
+
+var (
+	// recentLogBuffers holds a map[string]*recentLogBuffer keyed by database name.  The map is replaced rather than
+	// modified, so that logging can read it without a lock.
+	recentLogBuffers     atomic.Value
+	recentLogBuffersLock sync.Mutex // Serializes updates of recentLogBuffers
+)
+
+// loadRecentLogBuffers returns the databases whose recent warnings and errors are kept.
+func loadRecentLogBuffers() map[string]*recentLogBuffer {
+	buffers, _ := recentLogBuffers.Load().(map[string]*recentLogBuffer)
+	return buffers
+}
+
+// recentLogBufferFromContext returns the recent log buffer of the database in the log context, or nil if there's no
+// database or its recent warnings and errors aren't kept.
+func recentLogBufferFromContext(ctx context.Context) *recentLogBuffer {
+	buffers := loadRecentLogBuffers()
+	if len(buffers) == 0 || ctx == nil {
+		return nil
+	}
+	dbLogCtx, ok := ctx.Value(databaseLogContextKey).(*DatabaseLogContext)
+	if !ok || dbLogCtx == nil {
+		return nil
+	}
+	return buffers[dbLogCtx.DatabaseName]
+}
+
+// addLog adds a formatted and redacted warning or error to the buffer.
+func (b *recentLogBuffer) addLog(ctx context.Context, logLevel LogLevel, caller, msg string) {
+	b.add(RecentLogEntry{
+		Timestamp:     time.Now().Format(ISO8601Format),
+		Level:         logLevel.String(),
+		Message:       msg,
+		Caller:        caller,
+		CorrelationID: CorrelationIDFromContext(ctx),
+	})
+}
+
+// SetRecentLogEntriesLimit sets the number of the given database's most recent warnings and errors that are kept in
+// memory.  Entries already kept are retained up to the new limit.  A limit of zero stops keeping entries and discards
+// them.
+func SetRecentLogEntriesLimit(dbName string, limit int) {
+	recentLogBuffersLock.Lock()
+	defer recentLogBuffersLock.Unlock()
+	current := loadRecentLogBuffers()
+	if existing, ok := current[dbName]; ok && existing.limit == limit {
+		return
+	} else if !ok && limit <= 0 {
+		return
+	}
+
+	updated := make(map[string]*recentLogBuffer, len(current)+1)
+	for name, buffer := range current {
+		updated[name] = buffer
+	}
+	if limit > 0 {
+		buffer := &recentLogBuffer{limit: limit}
+		if existing, ok := current[dbName]; ok {
+			entries := existing.snapshot()
+			if len(entries) > limit {
+				entries = entries[len(entries)-limit:]
+			}
+			buffer.entries = entries
+		}
+		updated[dbName] = buffer
+	} else {
+		delete(updated, dbName)
+	}
+	recentLogBuffers.Store(updated)
+}
+
+// RecentLogEntries returns the most recent warnings and errors logged for the given database, oldest first.
+func RecentLogEntries(dbName string) []RecentLogEntry {
+	buffer, ok := loadRecentLogBuffers()[dbName]
+	if !ok {
+		return []RecentLogEntry{}
+	}
+	return buffer.snapshot()
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2022-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package base
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecentLogEntries(t *testing.T) {
+	dbName := t.Name()
+	dbCtx := LogContextWith(TestCtx(t), &DatabaseLogContext{DatabaseName: dbName})
+	requestCtx := LogContextWith(dbCtx, &LogContext{CorrelationID: "#001"})
+
+	// Not kept until a limit is set
+	WarnfCtx(dbCtx, "not kept")
+	assert.Empty(t, RecentLogEntries(dbName))
+
+	SetRecentLogEntriesLimit(dbName, 3)
+	defer SetRecentLogEntriesLimit(dbName, 0)
+
+	ErrorfCtx(requestCtx, "error %d", 1)
+	InfofCtx(dbCtx, KeyAll, "info isn't kept")
+	WarnfCtx(TestCtx(t), "other databases' warnings aren't kept")
+	for i := 2; i <= 4; i++ {
+		WarnfCtx(dbCtx, "warning %d", i)
+	}
+
+	// Only the most recent entries are kept, oldest first
+	entries := RecentLogEntries(dbName)
+	require.Len(t, entries, 3)
+	for i, entry := range entries {
+		assert.Equal(t, "warning "+strconv.Itoa(i+2), entry.Message)
+		assert.Equal(t, "warn", entry.Level)
+		assert.NotEmpty(t, entry.Timestamp)
+		assert.NotEmpty(t, entry.Caller)
+	}
+
+	// Reducing the limit keeps the most recent entries
+	SetRecentLogEntriesLimit(dbName, 2)
+	ErrorfCtx(requestCtx, "error %d", 5)
+	entries = RecentLogEntries(dbName)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "warning 4", entries[0].Message)
+	assert.Equal(t, "error 5", entries[1].Message)
+	assert.Equal(t, "error", entries[1].Level)
+	assert.Equal(t, "#001", entries[1].CorrelationID)
+
+	SetRecentLogEntriesLimit(dbName, 0)
+	assert.Empty(t, RecentLogEntries(dbName))
+}
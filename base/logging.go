@@ -105,6 +105,9 @@ func RotateLogfiles() map[*FileLogger]error {
 		errorLogger: nil,
 		statsLogger: nil,
 	}
+	if auditLogger != nil {
+		loggers[auditLogger.FileLogger] = nil
+	}
 
 	for logger := range loggers {
 		loggers[logger] = logger.Rotate()
@@ -195,28 +198,46 @@ func logTo(ctx context.Context, logLevel LogLevel, logKey LogKey, format string,
 		SyncGatewayStats.GlobalStats.ResourceUtilizationStats().WarnCount.Add(1)
 	}
 
-	shouldLogConsole := consoleLogger.shouldLog(logLevel, logKey)
+	shouldLogConsole := consoleLogger.shouldLogCtx(ctx, logLevel, logKey)
 	shouldLogError := errorLogger.shouldLog(logLevel)
 	shouldLogWarn := warnLogger.shouldLog(logLevel)
 	shouldLogInfo := infoLogger.shouldLog(logLevel)
 	shouldLogDebug := debugLogger.shouldLog(logLevel)
 	shouldLogTrace := traceLogger.shouldLog(logLevel)
 
+	// Keep the database's recent warnings and errors, whichever loggers they go to.
+	var recentLogs *recentLogBuffer
+	if logLevel == LevelError || logLevel == LevelWarn {
+		recentLogs = recentLogBufferFromContext(ctx)
+	}
+
 	// exit early if we aren't going to log anything anywhere.
-	if !(shouldLogConsole || shouldLogError || shouldLogWarn || shouldLogInfo || shouldLogDebug || shouldLogTrace) {
+	if !(shouldLogConsole || shouldLogError || shouldLogWarn || shouldLogInfo || shouldLogDebug || shouldLogTrace || recentLogs != nil) {
 		return
 	}
 
-	// Prepend timestamp, level, log key.
-	format = addPrefixes(format, ctx, logLevel, logKey)
+	// Perform log redaction, if necessary.
+	args = redact(args)
 
-	// Error, warn and trace logs also append caller name/line numbers.
+	// Error, warn and trace logs also include caller name/line numbers.
+	var caller string
 	if logLevel <= LevelWarn || logLevel == LevelTrace {
-		format += " -- " + GetCallersName(2, true)
+		caller = GetCallersName(2, true)
 	}
 
-	// Perform log redaction, if necessary.
-	args = redact(args)
+	if recentLogs != nil {
+		recentLogs.addLog(ctx, logLevel, caller, fmt.Sprintf(format, args...))
+	}
+
+	if logFormatJSON.IsTrue() {
+		format, args = "%s", []interface{}{formatJSONLogRecord(ctx, logLevel, logKey, caller, fmt.Sprintf(format, args...))}
+	} else {
+		// Prepend timestamp, level, log key.
+		format = addPrefixes(format, ctx, logLevel, logKey)
+		if caller != "" {
+			format += " -- " + caller
+		}
+	}
 
 	if shouldLogConsole {
 		consoleLogger.logf(color(format, logLevel), args...)
@@ -247,6 +268,10 @@ func Consolef(logLevel LogLevel, logKey LogKey, format string, args ...interface
 
 	// If the above logTo didn't already log to stderr, do it directly here
 	if !consoleLogger.isStderr || !consoleLogger.shouldLog(logLevel, logKey) {
+		if logFormatJSON.IsTrue() {
+			_, _ = fmt.Fprintln(consoleFOutput, formatJSONLogRecord(context.Background(), logLevel, logKey, "", fmt.Sprintf(format, args...)))
+			return
+		}
 		format = color(addPrefixes(format, context.Background(), logLevel, logKey), logLevel)
 		_, _ = fmt.Fprintf(consoleFOutput, format+"\n", args...)
 	}
@@ -260,21 +285,25 @@ func LogSyncGatewayVersion() {
 	Consolef(LevelNone, KeyNone, msg)
 
 	// Log the startup indicator to ALL log files too.
-	msg = addPrefixes(msg, context.Background(), LevelNone, KeyNone)
+	if logFormatJSON.IsTrue() {
+		msg = formatJSONLogRecord(context.Background(), LevelNone, KeyNone, "", msg)
+	} else {
+		msg = addPrefixes(msg, context.Background(), LevelNone, KeyNone)
+	}
 	if errorLogger.shouldLog(LevelNone) {
-		errorLogger.logger.Printf(msg)
+		errorLogger.logger.Print(msg)
 	}
 	if warnLogger.shouldLog(LevelNone) {
-		warnLogger.logger.Printf(msg)
+		warnLogger.logger.Print(msg)
 	}
 	if infoLogger.shouldLog(LevelNone) {
-		infoLogger.logger.Printf(msg)
+		infoLogger.logger.Print(msg)
 	}
 	if debugLogger.shouldLog(LevelNone) {
-		debugLogger.logger.Printf(msg)
+		debugLogger.logger.Print(msg)
 	}
 	if traceLogger.shouldLog(LevelNone) {
-		traceLogger.logger.Printf(msg)
+		traceLogger.logger.Print(msg)
 	}
 }
 
@@ -312,6 +341,58 @@ func addPrefixes(format string, ctx context.Context, logLevel LogLevel, logKey L
 	return timestampPrefix + logLevelPrefix + logKeyPrefix + format
 }
 
+// jsonLogRecord is a log line written when the log format is JSON.
+type jsonLogRecord struct {
+	Timestamp     string            `json:"timestamp"`
+	Level         string            `json:"level,omitempty"`
+	LogKey        string            `json:"log_key,omitempty"`
+	Database      string            `json:"db,omitempty"`
+	Keyspace      string            `json:"keyspace,omitempty"`
+	CorrelationID string            `json:"correlation_id,omitempty"`
+	Message       string            `json:"msg"`
+	Caller        string            `json:"caller,omitempty"`
+	Fields        map[string]string `json:"fields,omitempty"` // Any other log context, e.g. the server context or test name
+}
+
+// setField adds the given log context value to the record's fields.
+func (r *jsonLogRecord) setField(name, value string) {
+	if r.Fields == nil {
+		r.Fields = make(map[string]string)
+	}
+	r.Fields[name] = value
+}
+
+// formatJSONLogRecord returns the given message as a single line JSON record, including the same timestamp, log level,
+// log key and log context that addPrefixes adds to text logs.
+func formatJSONLogRecord(ctx context.Context, logLevel LogLevel, logKey LogKey, caller, msg string) string {
+	record := jsonLogRecord{
+		Timestamp: time.Now().Format(ISO8601Format),
+		Message:   msg,
+		Caller:    caller,
+	}
+	if logLevel > LevelNone {
+		record.Level = logLevel.String()
+	}
+	if logKey > KeyNone && logKey != KeyAll {
+		record.LogKey = logKey.String()
+	}
+
+	if ctx != nil {
+		var ctxVal any
+		for _, k := range allLogContextKeys {
+			if ctxVal = ctx.Value(k); ctxVal != nil {
+				if logCtx, ok := ctxVal.(ContextAdder); ok {
+					logCtx.addJSONContext(&record)
+				}
+			}
+		}
+	}
+
+	// Can't fail to marshal a struct of strings
+	data, _ := JSONMarshal(record)
+	return string(data)
+}
+
 // color wraps the given string with color based on logLevel
 // This won't work on Windows. Maybe use fatih's colour package?
 func color(str string, logLevel LogLevel) string {
@@ -340,9 +421,9 @@ func color(str string, logLevel LogLevel) string {
 }
 
 // colorEnabled returns true if the console logger has color enabled,
-// and the environment supports ANSI color escape sequences.
+// the environment supports ANSI color escape sequences, and logs aren't being written as JSON.
 func colorEnabled() bool {
-	return consoleLogger.ColorEnabled && envColorCapable
+	return consoleLogger.ColorEnabled && envColorCapable && !logFormatJSON.IsTrue()
 }
 
 // ConsoleLogLevel returns the console log level.
@@ -355,22 +436,22 @@ func ConsoleLogKey() *LogKeyMask {
 	return consoleLogger.LogKeyMask
 }
 
-// LogInfoEnabled returns true if either the console should log at info level,
+// LogInfoEnabled returns true if either the console should log at info level, for any database,
 // or if the infoLogger is enabled.
 func LogInfoEnabled(logKey LogKey) bool {
-	return consoleLogger.shouldLog(LevelInfo, logKey) || infoLogger.shouldLog(LevelInfo)
+	return consoleLogger.shouldLog(LevelInfo, logKey) || infoLogger.shouldLog(LevelInfo) || dbConsoleLoggersShouldLog(LevelInfo, logKey)
 }
 
-// LogDebugEnabled returns true if either the console should log at debug level,
+// LogDebugEnabled returns true if either the console should log at debug level, for any database,
 // or if the debugLogger is enabled.
 func LogDebugEnabled(logKey LogKey) bool {
-	return consoleLogger.shouldLog(LevelDebug, logKey) || debugLogger.shouldLog(LevelDebug)
+	return consoleLogger.shouldLog(LevelDebug, logKey) || debugLogger.shouldLog(LevelDebug) || dbConsoleLoggersShouldLog(LevelDebug, logKey)
 }
 
-// LogTraceEnabled returns true if either the console should log at trace level,
+// LogTraceEnabled returns true if either the console should log at trace level, for any database,
 // or if the traceLogger is enabled.
 func LogTraceEnabled(logKey LogKey) bool {
-	return consoleLogger.shouldLog(LevelTrace, logKey) || traceLogger.shouldLog(LevelTrace)
+	return consoleLogger.shouldLog(LevelTrace, logKey) || traceLogger.shouldLog(LevelTrace) || dbConsoleLoggersShouldLog(LevelTrace, logKey)
 }
 
 // AssertLogContains asserts that the logs produced by function f contain string s.
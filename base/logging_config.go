@@ -40,6 +40,27 @@ const (
 	loggerCollateFlushDelay = 1 * time.Second
 )
 
+const (
+	LogFormatText = "text" // Printf-style log lines, prefixed with the timestamp, log level and log key
+	LogFormatJSON = "json" // A JSON object per log line
+)
+
+// logFormatJSON is set when logs are written to the console and log files as JSON records.
+var logFormatJSON AtomicBool
+
+// SetLogFormat sets the format of the logs written to the console and log files.  Defaults to text when empty.
+func SetLogFormat(format string) error {
+	switch format {
+	case "", LogFormatText:
+		logFormatJSON.Set(false)
+	case LogFormatJSON:
+		logFormatJSON.Set(true)
+	default:
+		return fmt.Errorf("unrecognized log format: %q, must be one of: %s, %s", format, LogFormatText, LogFormatJSON)
+	}
+	return nil
+}
+
 // ErrUnsetLogFilePath is returned when no log_file_path, or --defaultLogFilePath fallback can be used.
 var ErrUnsetLogFilePath = errors.New("No log_file_path property specified in config, and --defaultLogFilePath command line flag was not set. Log files required for product support are not being generated.")
 
@@ -57,7 +78,7 @@ type LegacyLoggingConfig struct {
 
 func InitLogging(logFilePath string,
 	console *ConsoleLoggerConfig,
-	error, warn, info, debug, trace, stats *FileLoggerConfig) (err error) {
+	error, warn, info, debug, trace, stats *FileLoggerConfig, audit *AuditLoggerConfig) (err error) {
 
 	consoleLogger, err = NewConsoleLogger(true, console)
 	if err != nil {
@@ -77,6 +98,7 @@ func InitLogging(logFilePath string,
 		debugLogger = nil
 		traceLogger = nil
 		statsLogger = nil
+		auditLogger = nil
 
 		return nil
 	}
@@ -119,6 +141,11 @@ func InitLogging(logFilePath string,
 		return err
 	}
 
+	auditLogger, err = NewAuditLogger(audit, logFilePath)
+	if err != nil {
+		return err
+	}
+
 	// Initialize external loggers too
 	initExternalLoggers()
 
@@ -233,6 +260,7 @@ func StatsLoggerIsEnabled() bool {
 type LoggingConfig struct {
 	LogFilePath    string               `json:"log_file_path,omitempty"   help:"Absolute or relative path on the filesystem to the log file directory. A relative path is from the directory that contains the Sync Gateway executable file"`
 	RedactionLevel RedactionLevel       `json:"redaction_level,omitempty" help:"Redaction level to apply to log output"`
+	Format         string               `json:"format,omitempty"          help:"Format of the logs written to the console and log files. Options: text, json"`
 	Console        *ConsoleLoggerConfig `json:"console,omitempty"`
 	Error          *FileLoggerConfig    `json:"error,omitempty"`
 	Warn           *FileLoggerConfig    `json:"warn,omitempty"`
@@ -240,12 +268,18 @@ type LoggingConfig struct {
 	Debug          *FileLoggerConfig    `json:"debug,omitempty"`
 	Trace          *FileLoggerConfig    `json:"trace,omitempty"`
 	Stats          *FileLoggerConfig    `json:"stats,omitempty"`
+	Audit          *AuditLoggerConfig   `json:"audit,omitempty"`
 }
 
 func BuildLoggingConfigFromLoggers(redactionLevel RedactionLevel, LogFilePath string) *LoggingConfig {
 	config := LoggingConfig{
 		RedactionLevel: redactionLevel,
 		LogFilePath:    LogFilePath,
+		Format:         LogFormatText,
+	}
+
+	if logFormatJSON.IsTrue() {
+		config.Format = LogFormatJSON
 	}
 
 	config.Console = consoleLogger.getConsoleLoggerConfig()
@@ -255,6 +289,7 @@ func BuildLoggingConfigFromLoggers(redactionLevel RedactionLevel, LogFilePath st
 	config.Debug = debugLogger.getFileLoggerConfig()
 	config.Trace = traceLogger.getFileLoggerConfig()
 	config.Stats = statsLogger.getFileLoggerConfig()
+	config.Audit = auditLogger.getAuditLoggerConfig()
 
 	return &config
 }
@@ -68,6 +68,30 @@ func (lc *LogContext) addContext(format string) string {
 	return format
 }
 
+// addJSONContext adds the log context to a JSON log record.
+func (lc *LogContext) addJSONContext(record *jsonLogRecord) {
+	if lc == nil {
+		return
+	}
+
+	record.CorrelationID = lc.CorrelationID
+
+	if lc.TestBucketName != "" {
+		keyspace := lc.TestBucketName
+		if lc.TestScopeName != "" {
+			keyspace += "." + lc.TestScopeName
+		}
+		if lc.TestCollectionName != "" {
+			keyspace += "." + lc.TestCollectionName
+		}
+		record.Keyspace = keyspace
+	}
+
+	if lc.TestName != "" {
+		record.setField("test", lc.TestName)
+	}
+}
+
 func (lc *LogContext) getContextKey() LogContextKey {
 	return requestContextKey
 }
@@ -76,6 +100,42 @@ func FormatBlipContextID(contextID string) string {
 	return "[" + contextID + "]"
 }
 
+// CorrelationIDHeader is the HTTP header a caller can set to choose the correlation ID of a request, so that the
+// request can be traced through the caller's and Sync Gateway's logs.  Sync Gateway returns the request's correlation
+// ID in the same header.
+const CorrelationIDHeader = "X-Correlation-ID"
+
+// maxCorrelationIDLength is the longest correlation ID accepted from a caller.
+const maxCorrelationIDLength = 64
+
+// IsValidCorrelationID returns true if a correlation ID supplied by a caller can be used in logs.  Only letters,
+// digits and the characters - _ . : are allowed, so that an ID can't forge or break up log lines.
+func IsValidCorrelationID(id string) bool {
+	if id == "" || len(id) > maxCorrelationIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// CorrelationIDFromContext returns the correlation ID of the context's log context, or an empty string if it has none.
+func CorrelationIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	if logCtx, ok := ctx.Value(requestContextKey).(*LogContext); ok && logCtx != nil {
+		return logCtx.CorrelationID
+	}
+	return ""
+}
+
 func NewTaskID(contextID string, taskName string) string {
 	return contextID + "-" + taskName + "-" + strconv.Itoa(rand.Intn(65536))
 }
@@ -129,6 +189,7 @@ const (
 type ContextAdder interface {
 	getContextKey() LogContextKey
 	addContext(format string) string
+	addJSONContext(record *jsonLogRecord)
 }
 
 // allLogContextKeys contains the keys of all custom contexts,
@@ -157,6 +218,12 @@ func (c *ServerLogContext) addContext(format string) string {
 	return format
 }
 
+func (c *ServerLogContext) addJSONContext(record *jsonLogRecord) {
+	if c != nil && c.LogContextID != "" {
+		record.setField("sc", c.LogContextID)
+	}
+}
+
 // DatabaseLogContext provides database context data for logging
 type DatabaseLogContext struct {
 	DatabaseName string
@@ -172,3 +239,9 @@ func (c *DatabaseLogContext) addContext(format string) string {
 	}
 	return format
 }
+
+func (c *DatabaseLogContext) addJSONContext(record *jsonLogRecord) {
+	if c != nil {
+		record.Database = c.DatabaseName
+	}
+}
@@ -10,11 +10,13 @@ package base
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"math/rand"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/natefinch/lumberjack"
@@ -43,6 +45,38 @@ func TestRedactedLogFuncs(t *testing.T) {
 	AssertLogContains(t, "Username: <ud>alice</ud>", func() { WarnfCtx(ctx, "Username: %s", username) })
 }
 
+func TestJSONLogFormat(t *testing.T) {
+	assert.Error(t, SetLogFormat("xml"))
+	require.NoError(t, SetLogFormat(LogFormatJSON))
+	defer func() { require.NoError(t, SetLogFormat(LogFormatText)) }()
+
+	ctx := LogContextWith(context.Background(), &LogContext{
+		CorrelationID:      "#001",
+		TestName:           t.Name(),
+		TestBucketName:     "bucket",
+		TestScopeName:      "scope",
+		TestCollectionName: "collection",
+	})
+	ctx = LogContextWith(ctx, &DatabaseLogContext{DatabaseName: "db"})
+
+	var record map[string]interface{}
+	require.NoError(t, JSONUnmarshal([]byte(formatJSONLogRecord(ctx, LevelInfo, KeyCRUD, "", "Doc updated")), &record))
+	assert.Equal(t, "info", record["level"])
+	assert.Equal(t, "CRUD", record["log_key"])
+	assert.Equal(t, "db", record["db"])
+	assert.Equal(t, "bucket.scope.collection", record["keyspace"])
+	assert.Equal(t, "#001", record["correlation_id"])
+	assert.Equal(t, "Doc updated", record["msg"])
+	assert.Equal(t, map[string]interface{}{"test": t.Name()}, record["fields"])
+	assert.NotEmpty(t, record["timestamp"])
+	assert.NotContains(t, record, "caller")
+
+	if GlobalTestLoggingSet.IsTrue() {
+		t.Skip("Remainder of test does not work when a global test log level is set")
+	}
+	AssertLogContains(t, `"msg":"Username: alice"`, func() { InfofCtx(ctx, KeyAll, "Username: %s", "alice") })
+}
+
 func Benchmark_LoggingPerformance(b *testing.B) {
 
 	SetUpBenchmarkLogging(b, LevelInfo, KeyHTTP, KeyCRUD)
@@ -269,3 +303,12 @@ func BenchmarkGetCallersName(b *testing.B) {
 		})
 	}
 }
+
+func TestIsValidCorrelationID(t *testing.T) {
+	for _, id := range []string{"abc", "client-req.42", "a_b:c", strings.Repeat("x", maxCorrelationIDLength)} {
+		assert.True(t, IsValidCorrelationID(id), id)
+	}
+	for _, id := range []string{"", "with space", "new\nline", "<ud>x</ud>", strings.Repeat("x", maxCorrelationIDLength+1)} {
+		assert.False(t, IsValidCorrelationID(id), id)
+	}
+}
@@ -36,6 +36,11 @@ const (
 	tbpBucketNameFormat = "%s%d_%d"
 	tbpScopePrefix      = "sg_test_"
 	tbpCollectionPrefix = "sg_test_"
+
+	// Isolated collections are created in this scope of the shared bucket, named with the prefix and a sequential
+	// number.  They don't use tbpScopePrefix, so that any left behind are dropped if the bucket is readied.
+	tbpIsolatedScope            = "sg_isolated"
+	tbpIsolatedCollectionPrefix = "sg_isolated_"
 )
 
 const (
@@ -113,6 +118,14 @@ type TestBucketPool struct {
 	unclosedBucketsLock sync.Mutex
 
 	usingCollections bool
+
+	// sharedBucket is taken from the pool by the first request for an isolated collection, and holds the isolated
+	// collections of every test for the remainder of the run.
+	sharedBucket     tbpBucketName
+	sharedBucketLock sync.Mutex
+
+	// isolatedCollectionCount numbers the isolated collections created in sharedBucket.
+	isolatedCollectionCount uint32
 }
 
 // NewTestBucketPool initializes a new TestBucketPool. To be called from TestMain for packages requiring test buckets.
@@ -359,6 +372,125 @@ func (tbp *TestBucketPool) getTestBucketAndSpec(t testing.TB, collectionType tbp
 	}
 }
 
+// getIsolatedCollectionAndSpec returns a new collection to be used during a test, in a bucket shared with the isolated
+// collections of other tests.  Creating and dropping a collection is much quicker than readying a whole bucket, so
+// tests that don't need a bucket to themselves spend less time waiting.  Falls back to getTestBucketAndSpec when
+// collections can't be used.  The returned teardownFn MUST be called once the test is done, which closes and drops
+// the collection.
+func (tbp *TestBucketPool) getIsolatedCollectionAndSpec(t testing.TB) (b Bucket, s BucketSpec, teardownFn func()) {
+
+	ctx := TestCtx(t)
+
+	if !tbp.integrationMode || !tbp.canUseIsolatedCollections() {
+		tbp.Logf(ctx, "Isolated collections not available - getting a whole test bucket")
+		return tbp.getTestBucketAndSpec(t, getDefaultCollectionType())
+	}
+
+	bucketName := tbp.getSharedBucket(t)
+	scopeName := tbpIsolatedScope
+	collectionName := fmt.Sprintf("%s%d", tbpIsolatedCollectionPrefix, atomic.AddUint32(&tbp.isolatedCollectionCount, 1))
+	spec := getBucketSpec(bucketName)
+	spec.Scope = &scopeName
+	spec.Collection = &collectionName
+
+	ctx = bucketNameCtx(ctx, string(bucketName))
+	tbp.Logf(ctx, "Creating isolated collection %s.%s", scopeName, collectionName)
+	initStart := time.Now()
+	if err := CreateBucketScopesAndCollections(ctx, spec, map[string][]string{scopeName: {collectionName}}); err != nil {
+		t.Fatalf("TEST: Couldn't create isolated collection %s.%s: %v", scopeName, collectionName, err)
+	}
+	collection, err := tbp.cluster.openCollection(spec, 10)
+	if err != nil {
+		t.Fatalf("TEST: Couldn't open isolated collection %s.%s: %v", scopeName, collectionName, err)
+	}
+	ctx = updateContextWithKeyspace(ctx, collection)
+	if err := tbp.bucketInitFunc(ctx, collection, tbp); err != nil {
+		collection.Close()
+		t.Fatalf("TEST: Couldn't run bucket init func on isolated collection: %v", err)
+	}
+	atomic.AddInt32(&tbp.stats.TotalBucketInitCount, 1)
+	atomic.AddInt64(&tbp.stats.TotalBucketInitDurationNano, time.Since(initStart).Nanoseconds())
+
+	tbp.Logf(ctx, "Got isolated collection")
+	tbp.markBucketOpened(t, collection)
+
+	atomic.AddInt32(&tbp.stats.NumBucketsOpened, 1)
+	atomic.AddInt32(&tbp.stats.NumIsolatedCollectionsOpened, 1)
+	openedStart := time.Now()
+	collectionClosed := &AtomicBool{}
+	return collection, spec, func() {
+		if !collectionClosed.CompareAndSwap(false, true) {
+			tbp.Logf(ctx, "Collection teardown was already called. Ignoring.")
+			return
+		}
+
+		tbp.Logf(ctx, "Teardown called - closing isolated collection")
+		atomic.AddInt32(&tbp.stats.NumBucketsClosed, 1)
+		atomic.AddInt64(&tbp.stats.TotalInuseBucketNano, time.Since(openedStart).Nanoseconds())
+		tbp.markBucketClosed(t, collection)
+		collection.Close()
+
+		if tbp.preserveBuckets && t.Failed() {
+			tbp.Logf(ctx, "Test using isolated collection failed. Preserving collection for later inspection")
+			return
+		}
+
+		if err := tbp.cluster.dropCollection(bucketName, scopeName, collectionName); err != nil {
+			tbp.Logf(ctx, "Couldn't drop isolated collection: %v", err)
+			return
+		}
+		atomic.AddInt32(&tbp.stats.NumIsolatedCollectionsDropped, 1)
+	}
+}
+
+// getSharedBucket returns the bucket holding isolated collections, taking it from the pool on first use.
+func (tbp *TestBucketPool) getSharedBucket(t testing.TB) tbpBucketName {
+	tbp.sharedBucketLock.Lock()
+	defer tbp.sharedBucketLock.Unlock()
+
+	if tbp.sharedBucket != "" {
+		return tbp.sharedBucket
+	}
+
+	ctx := TestCtx(t)
+	tbp.Logf(ctx, "Attempting to get shared bucket for isolated collections from pool")
+	waitingBucketStart := time.Now()
+	var collections openCollections
+	select {
+	case collections = <-tbp.readyBucketPool:
+	case <-time.After(waitForReadyBucketTimeout):
+		tbp.Logf(ctx, "Timed out after %s waiting for a bucket to become available.", waitForReadyBucketTimeout)
+		t.Fatalf("TEST: Timed out after %s waiting for a bucket to become available.", waitForReadyBucketTimeout)
+	}
+	atomic.AddInt64(&tbp.stats.TotalWaitingForReadyBucketNano, time.Since(waitingBucketStart).Nanoseconds())
+
+	// Isolated collections are opened with their own connections
+	tbp.sharedBucket = tbpBucketName(collections.defaultCollection.GetName())
+	collections.defaultCollection.Close()
+	if collections.namedCollection != nil {
+		collections.namedCollection.Close()
+	}
+
+	tbp.Logf(bucketNameCtx(ctx, string(tbp.sharedBucket)), "Got shared bucket for isolated collections")
+	return tbp.sharedBucket
+}
+
+// canUseIsolatedCollections returns whether the cluster supports the collections and GSI indexes that isolated
+// collections require.
+func (tbp *TestBucketPool) canUseIsolatedCollections() bool {
+	if TestsDisableGSI() {
+		return false
+	}
+	c, ok := tbp.cluster.(*tbpClusterV2)
+	if !ok {
+		return false
+	}
+	getTestClusterCompatVersionOnce.Do(func() {
+		testClusterCompatVersion = c.getMinClusterCompatVersion()
+	})
+	return testClusterCompatVersion >= minCompatVersionForCollections
+}
+
 func (tbp *TestBucketPool) addBucketToReadierQueue(ctx context.Context, name tbpBucketName, collectionType tbpCollectionType) {
 	tbp.bucketReadierWaitGroup.Add(1)
 	tbp.Logf(ctx, "Putting bucket onto bucketReadierQueue")
@@ -425,6 +557,9 @@ func (tbp *TestBucketPool) printStats() {
 		tbp.Logf(ctx, "Total bucket readier time: %s for %d buckets", totalBucketReadierTime, totalBucketReadierCount)
 	}
 	tbp.Logf(ctx, "Total buckets opened/closed: %d/%d", numBucketsOpened, atomic.LoadInt32(&tbp.stats.NumBucketsClosed))
+	if numIsolatedOpened := atomic.LoadInt32(&tbp.stats.NumIsolatedCollectionsOpened); numIsolatedOpened > 0 {
+		tbp.Logf(ctx, "Of which isolated collections opened/dropped: %d/%d", numIsolatedOpened, atomic.LoadInt32(&tbp.stats.NumIsolatedCollectionsDropped))
+	}
 	if numBucketsOpened > 0 {
 		tbp.Logf(ctx, "Total time waiting for ready bucket: %s over %d buckets (avg: %s)", totalBucketWaitTime, numBucketsOpened, totalBucketWaitTime/numBucketsOpened)
 		tbp.Logf(ctx, "Total time tests using buckets: %s (avg: %s)", totalBucketUseTime, totalBucketUseTime/numBucketsOpened)
@@ -750,6 +885,8 @@ type bucketPoolStats struct {
 	NumBucketsClosed               int32
 	TotalWaitingForReadyBucketNano int64
 	TotalInuseBucketNano           int64
+	NumIsolatedCollectionsOpened   int32
+	NumIsolatedCollectionsDropped  int32
 }
 
 // tbpBucketName use a strongly typed bucket name.
@@ -24,6 +24,8 @@ type tbpCluster interface {
 	insertBucket(name string, quotaMB int) error
 	removeBucket(name string) error
 	openTestBucket(name tbpBucketName, waitUntilReadySeconds int) (Bucket, Bucket, error)
+	openCollection(spec BucketSpec, waitUntilReadySeconds int) (Bucket, error)
+	dropCollection(name tbpBucketName, scopeName, collectionName string) error
 	close() error
 }
 
@@ -183,6 +185,23 @@ func (c *tbpClusterV2) openTestBucket(testBucketName tbpBucketName, waitUntilRea
 	return nil, bucketFromSpec, nil
 }
 
+// openCollection opens the scope and collection of the given spec with a new cluster connection, which is closed when
+// the returned collection is closed.
+func (c *tbpClusterV2) openCollection(spec BucketSpec, waitUntilReadySeconds int) (Bucket, error) {
+	collection, err := GetCollectionFromCluster(initV2Cluster(c.server), spec, waitUntilReadySeconds)
+	if err != nil {
+		return nil, err
+	}
+	return collection, nil
+}
+
+func (c *tbpClusterV2) dropCollection(name tbpBucketName, scopeName, collectionName string) error {
+	return c.cluster.Bucket(string(name)).Collections().DropCollection(gocb.CollectionSpec{
+		Name:      collectionName,
+		ScopeName: scopeName,
+	}, nil)
+}
+
 func (c *tbpClusterV2) close() error {
 	// no close operations needed
 	if c.cluster != nil {
@@ -0,0 +1,636 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package base
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const (
+	DefaultMetricsExportInterval = time.Minute
+	DefaultCloudWatchNamespace   = "SyncGateway"
+
+	metricsExportTimeout = 10 * time.Second
+	statsDMaxPacketSize  = 1432 // Keeps packets within the MTU of most networks
+	cloudWatchMaxMetrics = 100  // Maximum number of metrics in an Embedded Metric Format document
+)
+
+// MetricsExporterOptions configures the sinks that a MetricsExporter pushes stats to.  Sinks with an empty address
+// aren't used.
+type MetricsExporterOptions struct {
+	Interval               time.Duration // How often stats are pushed. Defaults to DefaultMetricsExportInterval
+	StatsDAddress          string        // host:port of a StatsD server, sent DogStatsD tagged metrics over UDP
+	CloudWatchAgentAddress string        // host:port of a CloudWatch agent, sent Embedded Metric Format documents over TCP
+	CloudWatchNamespace    string        // Defaults to DefaultCloudWatchNamespace
+	OTLPEndpoint           string        // URL of an OTLP/HTTP collector, such as http://localhost:4318
+	ServiceName            string        // Service name that OTLP metrics are exported with. Defaults to DefaultTracingServiceName
+}
+
+// MetricsExporter periodically pushes the stats served by the metrics API to remote sinks, for environments where the
+// metrics API can't be scraped.
+type MetricsExporter struct {
+	gatherer   prometheus.Gatherer
+	interval   time.Duration
+	sinks      []metricsSink
+	terminator chan struct{}
+	doneChan   chan struct{}
+}
+
+// metricsSink pushes gathered metrics to a remote system.
+type metricsSink interface {
+	name() string
+	export(metrics []exportedMetric, now time.Time) error
+}
+
+type metricKind int
+
+const (
+	metricKindCounter metricKind = iota
+	metricKindGauge
+	metricKindHistogram
+)
+
+// exportedMetric is a metric family gathered from Prometheus, in a form independent of any sink.
+type exportedMetric struct {
+	name   string
+	help   string
+	kind   metricKind
+	points []metricPoint
+}
+
+// metricPoint is the value of a metric for one set of labels.
+type metricPoint struct {
+	labels       []metricLabel
+	value        float64   // Counters and gauges
+	count        uint64    // Histograms
+	sum          float64   // Histograms
+	upperBounds  []float64 // Histograms
+	bucketCounts []uint64  // Histograms, cumulative for each upper bound
+}
+
+type metricLabel struct {
+	name  string
+	value string
+}
+
+// labelsKey identifies a metric point's set of labels.
+func (p *metricPoint) labelsKey() string {
+	var sb strings.Builder
+	for _, label := range p.labels {
+		sb.WriteString(label.name)
+		sb.WriteByte('=')
+		sb.WriteString(label.value)
+		sb.WriteByte(',')
+	}
+	return sb.String()
+}
+
+// NewMetricsExporter returns a MetricsExporter pushing to the sinks in options, or nil if none are configured.
+func NewMetricsExporter(options MetricsExporterOptions) (*MetricsExporter, error) {
+	exporter := &MetricsExporter{
+		gatherer: prometheus.DefaultGatherer,
+		interval: options.Interval,
+	}
+	if exporter.interval <= 0 {
+		exporter.interval = DefaultMetricsExportInterval
+	}
+	if options.StatsDAddress != "" {
+		sink, err := newStatsDSink(options.StatsDAddress)
+		if err != nil {
+			return nil, err
+		}
+		exporter.sinks = append(exporter.sinks, sink)
+	}
+	if options.CloudWatchAgentAddress != "" {
+		exporter.sinks = append(exporter.sinks, newCloudWatchSink(options.CloudWatchAgentAddress, options.CloudWatchNamespace))
+	}
+	if options.OTLPEndpoint != "" {
+		exporter.sinks = append(exporter.sinks, newOTLPMetricsSink(options.OTLPEndpoint, options.ServiceName))
+	}
+	if len(exporter.sinks) == 0 {
+		return nil, nil
+	}
+	return exporter, nil
+}
+
+// Start starts pushing stats every interval.
+func (e *MetricsExporter) Start(ctx context.Context) {
+	e.terminator = make(chan struct{})
+	e.doneChan = make(chan struct{})
+	go func() {
+		defer close(e.doneChan)
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				e.Export(ctx)
+			case <-e.terminator:
+				// Push the final values, so that activity since the last push isn't lost
+				e.Export(ctx)
+				return
+			}
+		}
+	}()
+	sinkNames := make([]string, 0, len(e.sinks))
+	for _, sink := range e.sinks {
+		sinkNames = append(sinkNames, sink.name())
+	}
+	InfofCtx(ctx, KeyAll, "Pushing stats to %s every %v", strings.Join(sinkNames, ", "), e.interval)
+}
+
+// Stop pushes stats one last time, then stops pushing them.
+func (e *MetricsExporter) Stop(ctx context.Context) {
+	if err := TerminateAndWaitForClose(e.terminator, e.doneChan, 2*metricsExportTimeout); err != nil {
+		InfofCtx(ctx, KeyAll, "Couldn't stop metrics exporter: %v", err)
+	}
+	for _, sink := range e.sinks {
+		if closer, ok := sink.(io.Closer); ok {
+			_ = closer.Close()
+		}
+	}
+}
+
+// Export pushes the current stats to each sink.  Failures are logged, and don't prevent pushing to other sinks.
+func (e *MetricsExporter) Export(ctx context.Context) {
+	metrics, err := e.gather()
+	if err != nil {
+		WarnfCtx(ctx, "Couldn't gather stats to push: %v", err)
+		return
+	}
+	now := time.Now()
+	for _, sink := range e.sinks {
+		if err := sink.export(metrics, now); err != nil {
+			WarnfCtx(ctx, "Couldn't push stats to %s: %v", sink.name(), err)
+		}
+	}
+}
+
+// gather returns Sync Gateway's metrics.  Metrics registered by other packages, such as the Go runtime metrics, aren't
+// exported.
+func (e *MetricsExporter) gather() ([]exportedMetric, error) {
+	families, err := e.gatherer.Gather()
+	if err != nil {
+		return nil, err
+	}
+	metrics := make([]exportedMetric, 0, len(families))
+	for _, family := range families {
+		if !strings.HasPrefix(family.GetName(), NamespaceKey+"_") {
+			continue
+		}
+		metric := exportedMetric{name: family.GetName(), help: family.GetHelp()}
+		switch family.GetType() {
+		case dto.MetricType_COUNTER:
+			metric.kind = metricKindCounter
+		case dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+			metric.kind = metricKindGauge
+		case dto.MetricType_HISTOGRAM:
+			metric.kind = metricKindHistogram
+		default:
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			point := metricPoint{labels: make([]metricLabel, 0, len(m.GetLabel()))}
+			for _, label := range m.GetLabel() {
+				point.labels = append(point.labels, metricLabel{name: label.GetName(), value: label.GetValue()})
+			}
+			switch metric.kind {
+			case metricKindCounter:
+				point.value = m.GetCounter().GetValue()
+			case metricKindGauge:
+				if m.GetGauge() != nil {
+					point.value = m.GetGauge().GetValue()
+				} else {
+					point.value = m.GetUntyped().GetValue()
+				}
+			case metricKindHistogram:
+				h := m.GetHistogram()
+				point.count = h.GetSampleCount()
+				point.sum = h.GetSampleSum()
+				for _, bucket := range h.GetBucket() {
+					if math.IsInf(bucket.GetUpperBound(), 1) {
+						continue
+					}
+					point.upperBounds = append(point.upperBounds, bucket.GetUpperBound())
+					point.bucketCounts = append(point.bucketCounts, bucket.GetCumulativeCount())
+				}
+			}
+			metric.points = append(metric.points, point)
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics, nil
+}
+
+// deltaTracker converts cumulative values into the change since the previous export, for sinks that expect counters
+// to be reported as increments.
+type deltaTracker struct {
+	previous map[string]float64
+}
+
+// delta returns the increase in the value identified by key since the last call.  A decrease means the value was
+// reset, such as when a database is reloaded, so the whole value is the increase.
+func (t *deltaTracker) delta(key string, value float64) float64 {
+	if t.previous == nil {
+		t.previous = make(map[string]float64)
+	}
+	previous, ok := t.previous[key]
+	t.previous[key] = value
+	if !ok || value < previous {
+		return value
+	}
+	return value - previous
+}
+
+// statsDSink sends metrics to a StatsD server over UDP, with labels as DogStatsD tags.  Counters are sent as
+// increments, gauges as values, and histograms as the increments in their count and sum.
+type statsDSink struct {
+	conn   net.Conn
+	deltas deltaTracker
+}
+
+func newStatsDSink(address string) (*statsDSink, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't resolve StatsD address %q: %w", address, err)
+	}
+	return &statsDSink{conn: conn}, nil
+}
+
+func (s *statsDSink) name() string {
+	return "StatsD at " + s.conn.RemoteAddr().String()
+}
+
+func (s *statsDSink) Close() error {
+	return s.conn.Close()
+}
+
+func (s *statsDSink) export(metrics []exportedMetric, _ time.Time) error {
+	var packet bytes.Buffer
+	var firstErr error
+	send := func() {
+		if packet.Len() == 0 {
+			return
+		}
+		if _, err := s.conn.Write(packet.Bytes()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		packet.Reset()
+	}
+	write := func(line string) {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > statsDMaxPacketSize {
+			send()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+
+	for _, metric := range metrics {
+		for i := range metric.points {
+			point := &metric.points[i]
+			key := metric.name + "{" + point.labelsKey() + "}"
+			switch metric.kind {
+			case metricKindCounter:
+				if delta := s.deltas.delta(key, point.value); delta != 0 {
+					write(statsDLine(metric.name, delta, "c", point.labels))
+				}
+			case metricKindGauge:
+				write(statsDLine(metric.name, point.value, "g", point.labels))
+			case metricKindHistogram:
+				if delta := s.deltas.delta(key+"_count", float64(point.count)); delta != 0 {
+					write(statsDLine(metric.name+"_count", delta, "c", point.labels))
+					write(statsDLine(metric.name+"_sum", s.deltas.delta(key+"_sum", point.sum), "c", point.labels))
+				}
+			}
+		}
+	}
+	send()
+	return firstErr
+}
+
+// statsDLine formats a metric in the StatsD line protocol, with labels as DogStatsD tags.
+func statsDLine(name string, value float64, metricType string, labels []metricLabel) string {
+	var sb strings.Builder
+	sb.WriteString(name)
+	sb.WriteByte(':')
+	sb.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+	sb.WriteByte('|')
+	sb.WriteString(metricType)
+	for i, label := range labels {
+		if i == 0 {
+			sb.WriteString("|#")
+		} else {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(label.name)
+		sb.WriteByte(':')
+		sb.WriteString(label.value)
+	}
+	return sb.String()
+}
+
+// cloudWatchSink sends metrics to the CloudWatch agent's TCP listener as Embedded Metric Format documents, one per set
+// of labels, with the labels as dimensions.  Counters are sent as increments, and histograms as the increments in
+// their count and sum.
+type cloudWatchSink struct {
+	address   string
+	namespace string
+	deltas    deltaTracker
+}
+
+func newCloudWatchSink(address, namespace string) *cloudWatchSink {
+	if namespace == "" {
+		namespace = DefaultCloudWatchNamespace
+	}
+	return &cloudWatchSink{address: address, namespace: namespace}
+}
+
+func (s *cloudWatchSink) name() string {
+	return "CloudWatch agent at " + s.address
+}
+
+// cloudWatchDocument accumulates the metrics of one set of labels.
+type cloudWatchDocument struct {
+	labels []metricLabel
+	names  []string
+	values map[string]float64
+}
+
+func (s *cloudWatchSink) export(metrics []exportedMetric, now time.Time) error {
+	documents := make(map[string]*cloudWatchDocument)
+	var keys []string
+	add := func(point *metricPoint, name string, value float64) {
+		labelsKey := point.labelsKey()
+		document, ok := documents[labelsKey]
+		if !ok {
+			document = &cloudWatchDocument{labels: point.labels, values: make(map[string]float64)}
+			documents[labelsKey] = document
+			keys = append(keys, labelsKey)
+		}
+		document.names = append(document.names, name)
+		document.values[name] = value
+	}
+	for _, metric := range metrics {
+		for i := range metric.points {
+			point := &metric.points[i]
+			key := metric.name + "{" + point.labelsKey() + "}"
+			switch metric.kind {
+			case metricKindCounter:
+				add(point, metric.name, s.deltas.delta(key, point.value))
+			case metricKindGauge:
+				add(point, metric.name, point.value)
+			case metricKindHistogram:
+				add(point, metric.name+"_count", s.deltas.delta(key+"_count", float64(point.count)))
+				add(point, metric.name+"_sum", s.deltas.delta(key+"_sum", point.sum))
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	var body bytes.Buffer
+	for _, key := range keys {
+		document := documents[key]
+		for start := 0; start < len(document.names); start += cloudWatchMaxMetrics {
+			end := start + cloudWatchMaxMetrics
+			if end > len(document.names) {
+				end = len(document.names)
+			}
+			data, err := JSONMarshal(s.embeddedMetricFormat(document, document.names[start:end], now))
+			if err != nil {
+				return err
+			}
+			body.Write(data)
+			body.WriteByte('\n')
+		}
+	}
+	if body.Len() == 0 {
+		return nil
+	}
+
+	conn, err := net.DialTimeout("tcp", s.address, metricsExportTimeout)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+	if err := conn.SetWriteDeadline(time.Now().Add(metricsExportTimeout)); err != nil {
+		return err
+	}
+	_, err = conn.Write(body.Bytes())
+	return err
+}
+
+// embeddedMetricFormat returns an Embedded Metric Format document for the named metrics of a document.
+func (s *cloudWatchSink) embeddedMetricFormat(document *cloudWatchDocument, names []string, now time.Time) map[string]interface{} {
+	dimensions := make([]string, 0, len(document.labels))
+	emf := make(map[string]interface{}, len(document.labels)+len(names)+1)
+	for _, label := range document.labels {
+		dimensions = append(dimensions, label.name)
+		emf[label.name] = label.value
+	}
+	definitions := make([]map[string]string, 0, len(names))
+	for _, name := range names {
+		definitions = append(definitions, map[string]string{"Name": name})
+		emf[name] = document.values[name]
+	}
+	emf["_aws"] = map[string]interface{}{
+		"Timestamp": now.UnixNano() / int64(time.Millisecond),
+		"CloudWatchMetrics": []map[string]interface{}{{
+			"Namespace":  s.namespace,
+			"Dimensions": [][]string{dimensions},
+			"Metrics":    definitions,
+		}},
+	}
+	return emf
+}
+
+// otlpMetricsSink exports metrics to an OTLP/HTTP collector, using the OTLP JSON encoding.  Values are exported as
+// cumulative totals, as they are by the metrics API.
+type otlpMetricsSink struct {
+	url         string
+	serviceName string
+	startTime   time.Time // Start of the period that cumulative values are totalled over
+	client      *http.Client
+}
+
+func newOTLPMetricsSink(endpoint, serviceName string) *otlpMetricsSink {
+	if serviceName == "" {
+		serviceName = DefaultTracingServiceName
+	}
+	return &otlpMetricsSink{
+		url:         strings.TrimSuffix(endpoint, "/") + "/v1/metrics",
+		serviceName: serviceName,
+		startTime:   time.Now(),
+		client:      &http.Client{Timeout: metricsExportTimeout},
+	}
+}
+
+func (s *otlpMetricsSink) name() string {
+	return "OTLP collector at " + s.url
+}
+
+func (s *otlpMetricsSink) export(metrics []exportedMetric, now time.Time) error {
+	body, err := JSONMarshal(s.otlpRequest(metrics, now))
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("collector responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// The OTLP JSON encoding of an ExportMetricsServiceRequest.
+type otlpMetricsRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpMetric struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Sum         *otlpSum       `json:"sum,omitempty"`
+	Gauge       *otlpGauge     `json:"gauge,omitempty"`
+	Histogram   *otlpHistogram `json:"histogram,omitempty"`
+}
+
+// otlpAggregationTemporalityCumulative indicates that values are totals since startTimeUnixNano.
+const otlpAggregationTemporalityCumulative = 2
+
+type otlpSum struct {
+	DataPoints             []otlpNumberDataPoint `json:"dataPoints"`
+	AggregationTemporality int                   `json:"aggregationTemporality"`
+	IsMonotonic            bool                  `json:"isMonotonic"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpNumberDataPoint `json:"dataPoints"`
+}
+
+type otlpHistogram struct {
+	DataPoints             []otlpHistogramDataPoint `json:"dataPoints"`
+	AggregationTemporality int                      `json:"aggregationTemporality"`
+}
+
+type otlpNumberDataPoint struct {
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	AsDouble          float64         `json:"asDouble"`
+}
+
+type otlpHistogramDataPoint struct {
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	Count             string          `json:"count"`
+	Sum               float64         `json:"sum"`
+	BucketCounts      []string        `json:"bucketCounts"` // Per bucket rather than cumulative, with a final bucket for values above the last bound
+	ExplicitBounds    []float64       `json:"explicitBounds"`
+}
+
+func (s *otlpMetricsSink) otlpRequest(metrics []exportedMetric, now time.Time) otlpMetricsRequest {
+	startTime := strconv.FormatInt(s.startTime.UnixNano(), 10)
+	timestamp := strconv.FormatInt(now.UnixNano(), 10)
+
+	scopeMetrics := otlpScopeMetrics{
+		Scope:   otlpScope{Name: DefaultTracingServiceName},
+		Metrics: make([]otlpMetric, 0, len(metrics)),
+	}
+	if ProductVersion != nil {
+		scopeMetrics.Scope.Version = ProductVersion.String()
+	}
+	for _, metric := range metrics {
+		m := otlpMetric{Name: metric.name, Description: metric.help}
+		switch metric.kind {
+		case metricKindCounter, metricKindGauge:
+			dataPoints := make([]otlpNumberDataPoint, 0, len(metric.points))
+			for _, point := range metric.points {
+				dataPoints = append(dataPoints, otlpNumberDataPoint{
+					Attributes:   otlpLabelAttributes(point.labels),
+					TimeUnixNano: timestamp,
+					AsDouble:     point.value,
+				})
+			}
+			if metric.kind == metricKindCounter {
+				for i := range dataPoints {
+					dataPoints[i].StartTimeUnixNano = startTime
+				}
+				m.Sum = &otlpSum{DataPoints: dataPoints, AggregationTemporality: otlpAggregationTemporalityCumulative, IsMonotonic: true}
+			} else {
+				m.Gauge = &otlpGauge{DataPoints: dataPoints}
+			}
+		case metricKindHistogram:
+			dataPoints := make([]otlpHistogramDataPoint, 0, len(metric.points))
+			for _, point := range metric.points {
+				bucketCounts := make([]string, 0, len(point.bucketCounts)+1)
+				var previous uint64
+				for _, cumulative := range point.bucketCounts {
+					bucketCounts = append(bucketCounts, strconv.FormatUint(cumulative-previous, 10))
+					previous = cumulative
+				}
+				bucketCounts = append(bucketCounts, strconv.FormatUint(point.count-previous, 10))
+				dataPoints = append(dataPoints, otlpHistogramDataPoint{
+					Attributes:        otlpLabelAttributes(point.labels),
+					StartTimeUnixNano: startTime,
+					TimeUnixNano:      timestamp,
+					Count:             strconv.FormatUint(point.count, 10),
+					Sum:               point.sum,
+					BucketCounts:      bucketCounts,
+					ExplicitBounds:    point.upperBounds,
+				})
+			}
+			m.Histogram = &otlpHistogram{DataPoints: dataPoints, AggregationTemporality: otlpAggregationTemporalityCumulative}
+		}
+		scopeMetrics.Metrics = append(scopeMetrics.Metrics, m)
+	}
+	return otlpMetricsRequest{ResourceMetrics: []otlpResourceMetrics{{
+		Resource:     otlpResource{Attributes: []otlpAttribute{newOTLPAttribute("service.name", s.serviceName)}},
+		ScopeMetrics: []otlpScopeMetrics{scopeMetrics},
+	}}}
+}
+
+func otlpLabelAttributes(labels []metricLabel) []otlpAttribute {
+	if len(labels) == 0 {
+		return nil
+	}
+	attributes := make([]otlpAttribute, 0, len(labels))
+	for _, label := range labels {
+		attributes = append(attributes, newOTLPAttribute(label.name, label.value))
+	}
+	return attributes
+}
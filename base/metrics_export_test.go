@@ -0,0 +1,176 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package base
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestMetricsRegistry returns a registry with a labelled counter, a gauge and a histogram, alongside a metric
+// without the sgw namespace that shouldn't be exported.
+func newTestMetricsRegistry(t *testing.T) (*prometheus.Registry, *prometheus.CounterVec) {
+	registry := prometheus.NewRegistry()
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: NamespaceKey, Subsystem: "database", Name: "num_doc_writes", Help: "Doc writes"}, []string{"database"})
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Namespace: NamespaceKey, Subsystem: "resource_utilization", Name: "goroutines_high_watermark"})
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Namespace: NamespaceKey, Subsystem: "database", Name: "doc_read_duration_seconds", Buckets: []float64{0.1, 1}})
+	other := prometheus.NewGauge(prometheus.GaugeOpts{Name: "go_goroutines"})
+	for _, collector := range []prometheus.Collector{counter, gauge, histogram, other} {
+		require.NoError(t, registry.Register(collector))
+	}
+	counter.WithLabelValues("db1").Add(3)
+	gauge.Set(42)
+	histogram.Observe(0.0625)
+	histogram.Observe(0.5)
+	histogram.Observe(4)
+	return registry, counter
+}
+
+func TestStatsDMetricsExport(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, listener.Close()) }()
+
+	exporter, err := NewMetricsExporter(MetricsExporterOptions{StatsDAddress: listener.LocalAddr().String()})
+	require.NoError(t, err)
+	defer exporter.Stop(TestCtx(t))
+	registry, counter := newTestMetricsRegistry(t)
+	exporter.gatherer = registry
+
+	readLines := func() []string {
+		buf := make([]byte, statsDMaxPacketSize)
+		require.NoError(t, listener.SetReadDeadline(time.Now().Add(5*time.Second)))
+		n, _, err := listener.ReadFrom(buf)
+		require.NoError(t, err)
+		return strings.Split(string(buf[:n]), "\n")
+	}
+
+	exporter.Export(TestCtx(t))
+	assert.ElementsMatch(t, []string{
+		"sgw_database_num_doc_writes:3|c|#database:db1",
+		"sgw_resource_utilization_goroutines_high_watermark:42|g",
+		"sgw_database_doc_read_duration_seconds_count:3|c",
+		"sgw_database_doc_read_duration_seconds_sum:4.5625|c",
+	}, readLines())
+
+	// Counters are sent as the increase since the last push, and aren't sent when they haven't changed
+	counter.WithLabelValues("db1").Add(2)
+	exporter.Export(TestCtx(t))
+	assert.ElementsMatch(t, []string{
+		"sgw_database_num_doc_writes:2|c|#database:db1",
+		"sgw_resource_utilization_goroutines_high_watermark:42|g",
+	}, readLines())
+}
+
+func TestCloudWatchMetricsExport(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, listener.Close()) }()
+	documents := make(chan map[string]interface{}, 10)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			var document map[string]interface{}
+			if JSONUnmarshal(scanner.Bytes(), &document) == nil {
+				documents <- document
+			}
+		}
+		close(documents)
+	}()
+
+	exporter, err := NewMetricsExporter(MetricsExporterOptions{CloudWatchAgentAddress: listener.Addr().String()})
+	require.NoError(t, err)
+	registry, _ := newTestMetricsRegistry(t)
+	exporter.gatherer = registry
+	exporter.Export(TestCtx(t))
+
+	// One document for the metrics without labels, and one for the database's metrics
+	var received []map[string]interface{}
+	for document := range documents {
+		received = append(received, document)
+	}
+	require.Len(t, received, 2)
+	assert.Equal(t, 42.0, received[0]["sgw_resource_utilization_goroutines_high_watermark"])
+	assert.Equal(t, 3.0, received[0]["sgw_database_doc_read_duration_seconds_count"])
+	assert.Equal(t, "db1", received[1]["database"])
+	assert.Equal(t, 3.0, received[1]["sgw_database_num_doc_writes"])
+	aws, ok := received[1]["_aws"].(map[string]interface{})
+	require.True(t, ok)
+	directives := aws["CloudWatchMetrics"].([]interface{})
+	require.Len(t, directives, 1)
+	directive := directives[0].(map[string]interface{})
+	assert.Equal(t, DefaultCloudWatchNamespace, directive["Namespace"])
+	assert.Equal(t, []interface{}{[]interface{}{"database"}}, directive["Dimensions"])
+	assert.NotContains(t, received[0], "go_goroutines")
+}
+
+func TestOTLPMetricsExport(t *testing.T) {
+	requests := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/metrics", r.URL.Path)
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		requests <- body
+	}))
+	defer server.Close()
+
+	exporter, err := NewMetricsExporter(MetricsExporterOptions{OTLPEndpoint: server.URL, ServiceName: "sg-test"})
+	require.NoError(t, err)
+	registry, _ := newTestMetricsRegistry(t)
+	exporter.gatherer = registry
+	exporter.Export(TestCtx(t))
+
+	var request otlpMetricsRequest
+	require.NoError(t, JSONUnmarshal(<-requests, &request))
+	require.Len(t, request.ResourceMetrics, 1)
+	assert.Equal(t, "sg-test", *request.ResourceMetrics[0].Resource.Attributes[0].Value.StringValue)
+	metrics := make(map[string]otlpMetric)
+	for _, metric := range request.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		metrics[metric.Name] = metric
+	}
+	require.Len(t, metrics, 3)
+
+	counter := metrics["sgw_database_num_doc_writes"]
+	require.NotNil(t, counter.Sum)
+	assert.True(t, counter.Sum.IsMonotonic)
+	assert.Equal(t, 3.0, counter.Sum.DataPoints[0].AsDouble)
+	assert.Equal(t, "database", counter.Sum.DataPoints[0].Attributes[0].Key)
+
+	gauge := metrics["sgw_resource_utilization_goroutines_high_watermark"]
+	require.NotNil(t, gauge.Gauge)
+	assert.Equal(t, 42.0, gauge.Gauge.DataPoints[0].AsDouble)
+
+	histogram := metrics["sgw_database_doc_read_duration_seconds"]
+	require.NotNil(t, histogram.Histogram)
+	dataPoint := histogram.Histogram.DataPoints[0]
+	assert.Equal(t, "3", dataPoint.Count)
+	assert.Equal(t, []float64{0.1, 1}, dataPoint.ExplicitBounds)
+	assert.Equal(t, []string{"1", "1", "1"}, dataPoint.BucketCounts)
+}
+
+func TestNewMetricsExporterWithoutSinks(t *testing.T) {
+	exporter, err := NewMetricsExporter(MetricsExporterOptions{})
+	require.NoError(t, err)
+	assert.Nil(t, exporter)
+}
@@ -13,7 +13,9 @@ package base
 import (
 	"context"
 	"expvar"
+	"fmt"
 	"math"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -23,6 +25,22 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// Default upper bounds of the buckets of latency histograms, in seconds.
+var DefaultLatencyHistogramBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// latencyHistogramBuckets are the upper bounds of the buckets of latency histograms created by NewDBStats, in seconds.
+var (
+	latencyHistogramBuckets     = DefaultLatencyHistogramBuckets
+	latencyHistogramBucketsLock sync.RWMutex
+)
+
+// The maximum number of channels whose sync function assignments are counted individually, to bound the size of the
+// stats.  Assignments to further channels are counted under SyncFunctionChannelAssignmentsOtherKey.
+const (
+	MaxSyncFunctionChannelAssignmentStats  = 1000
+	SyncFunctionChannelAssignmentsOtherKey = "_other"
+)
+
 const (
 	StatViewFormat = "%s.%s"
 
@@ -30,6 +48,7 @@ const (
 	ResourceUtilizationSubsystem = "resource_utilization"
 
 	SubsystemCacheKey           = "cache"
+	SubsystemCollectionKey      = "collection"
 	SubsystemDatabaseKey        = "database"
 	SubsystemDeltaSyncKey       = "delta_sync"
 	SubsystemGSIViews           = "gsi_views"
@@ -40,7 +59,9 @@ const (
 	SubsystemSharedBucketImport = "shared_bucket_import"
 
 	DatabaseLabelKey    = "database"
+	CollectionLabelKey  = "collection"
 	ReplicationLabelKey = "replication"
+	RemoteLabelKey      = "remote"
 )
 
 const (
@@ -199,6 +220,7 @@ type DbStats struct {
 	CacheStats              *CacheStats                   `json:"cache,omitempty"`
 	CBLReplicationPullStats *CBLReplicationPullStats      `json:"cbl_replication_pull,omitempty"`
 	CBLReplicationPushStats *CBLReplicationPushStats      `json:"cbl_replication_push,omitempty"`
+	CollectionStats         map[string]*CollectionStats   `json:"per_collection,omitempty"`
 	DatabaseStats           *DatabaseStats                `json:"database,omitempty"`
 	DeltaSyncStats          *DeltaSyncStats               `json:"delta_sync,omitempty"`
 	QueryStats              *QueryStats                   `json:"gsi_views,omitempty"`
@@ -210,6 +232,8 @@ type DbStats struct {
 type CacheStats struct {
 	// The total number of skipped sequences that were not found after 60 minutes and were abandoned.
 	AbandonedSeqs *SgwIntStat `json:"abandoned_seqs"`
+	// The total number of server-side rollbacks of a vbucket detected on the cache feed, whether while running or on restart.
+	CacheFeedRollbackCount *SgwIntStat `json:"cache_feed_rollback_count"`
 	// The total number of active revisions in the channel cache.
 	ChannelCacheRevsActive *SgwIntStat `json:"chan_cache_active_revs"`
 	// The total number of transient bypass channel caches created to serve requests when the channel cache was at capacity.
@@ -226,6 +250,10 @@ type CacheStats struct {
 	ChannelCacheCompactCount *SgwIntStat `json:"chan_cache_compact_count"`
 	// The total amount of time taken by channel cache compaction across all compaction runs.
 	ChannelCacheCompactTime *SgwIntStat `json:"chan_cache_compact_time"`
+	// The total number of channel caches invalidated because they held changes from a vbucket that was rolled back.
+	ChannelCacheChannelsInvalidated *SgwIntStat `json:"chan_cache_channels_invalidated"`
+	// The total number of evicted channel caches restored from channel cache storage.
+	ChannelCacheChannelsRestored *SgwIntStat `json:"chan_cache_channels_restored"`
 	// The total number of channel cache requests fully served by the cache.
 	ChannelCacheHits *SgwIntStat `json:"chan_cache_hits"`
 	// The total size of the largest channel cache.
@@ -236,10 +264,18 @@ type CacheStats struct {
 	ChannelCacheNumChannels *SgwIntStat `json:"chan_cache_num_channels"`
 	// The total number of channel cache pending queries.
 	ChannelCachePendingQueries *SgwIntStat `json:"chan_cache_pending_queries"`
+	// The total size of the evicted channel caches held in channel cache storage.
+	ChannelCacheStorageBytes *SgwIntStat `json:"chan_cache_storage_bytes"`
+	// The total number of evicted channel caches held in channel cache storage.
+	ChannelCacheStoredChannels *SgwIntStat `json:"chan_cache_stored_channels"`
 	// The total number of removal revisions in the channel cache.
 	ChannelCacheRevsRemoval *SgwIntStat `json:"chan_cache_removal_revs"`
 	// The total number of tombstone revisions in the channel cache.
 	ChannelCacheRevsTombstone *SgwIntStat `json:"chan_cache_tombstone_revs"`
+	// The total number of document GETs served from the doc response cache.
+	DocResponseCacheHits *SgwIntStat `json:"doc_response_cache_hits"`
+	// The total number of document GETs that couldn't be served from the doc response cache.
+	DocResponseCacheMisses *SgwIntStat `json:"doc_response_cache_misses"`
 	// The highest sequence number cached.
 	//
 	// There may be skipped sequences lower than high_seq_cached.
@@ -255,12 +291,23 @@ type CacheStats struct {
 	PendingSeqLen *SgwIntStat `json:"pending_seq_len"`
 	// The total number of revision cache bypass operations performed.
 	RevisionCacheBypass *SgwIntStat `json:"rev_cache_bypass"`
+	// The estimated total size, in bytes, of the revisions in the revision cache.
+	RevisionCacheBytes *SgwIntStat `json:"rev_cache_bytes"`
+	// The total size, in bytes, of the revision bodies compressed by the revision cache, once compressed.
+	RevisionCacheCompressedBodyBytes *SgwIntStat `json:"rev_cache_compressed_body_bytes"`
+	// The total size, in bytes, of the revisions evicted from the revision cache.
+	RevisionCacheEvictedBytes *SgwIntStat `json:"rev_cache_evicted_bytes"`
 	// The total number of revision cache hits.
 	RevisionCacheHits *SgwIntStat `json:"rev_cache_hits"`
 	// The total number of revision cache misses.
 	RevisionCacheMisses *SgwIntStat `json:"rev_cache_misses"`
+	// The total size, in bytes, of the revision bodies compressed by the revision cache, before compression.  The
+	// compression ratio achieved is this divided by rev_cache_compressed_body_bytes.
+	RevisionCacheUncompressedBodyBytes *SgwIntStat `json:"rev_cache_uncompressed_body_bytes"`
 	// The current length of the pending skipped sequence queue.
 	SkippedSeqLen *SgwIntStat `json:"skipped_seq_len"`
+	// The current number of ranges of contiguous sequences in the pending skipped sequence queue.
+	SkippedSeqRanges *SgwIntStat `json:"skipped_seq_ranges"`
 	// The total view_queries.
 	ViewQueries *SgwIntStat `json:"view_queries"`
 }
@@ -346,6 +393,10 @@ type DatabaseStats struct {
 	DocWritesXattrBytes *SgwIntStat `json:"doc_writes_xattr_bytes"`
 	// Highest sequence number seen on the caching DCP feed.
 	HighSeqFeed *SgwIntStat `json:"high_seq_feed"`
+	// The total number of requests rejected because the database's estimated memory usage was too high.
+	MemoryAdmissionRejectedCount *SgwIntStat `json:"memory_admission_rejected_count"`
+	// The estimated memory, in bytes, used by the database's caches, in-flight requests and BLIP connections.
+	MemoryUsageBytes *SgwIntStat `json:"memory_usage_bytes"`
 	// The number of attachments compacted
 	NumAttachmentsCompacted *SgwIntStat `json:"num_attachments_compacted"`
 	// The total number of documents read via Couchbase Lite 2.x replication since Sync Gateway node startup.
@@ -354,6 +405,13 @@ type DatabaseStats struct {
 	NumDocReadsRest *SgwIntStat `json:"num_doc_reads_rest"`
 	// The total number of documents written by any means (replication, rest API interaction or imports) since Sync Gateway node startup.
 	NumDocWrites *SgwIntStat `json:"num_doc_writes"`
+	// The distribution of the time taken to read a document revision, by any means, in seconds.
+	DocReadDuration *SgwHistogramStat `json:"doc_read_duration_seconds"`
+	// The distribution of the time taken to write a document, by any means, in seconds.
+	DocWriteDuration *SgwHistogramStat `json:"doc_write_duration_seconds"`
+	// The distribution of the time taken to serve one-shot REST API changes requests, in seconds.  Continuous,
+	// long-poll and websocket feeds aren't included.
+	ChangesRequestDuration *SgwHistogramStat `json:"changes_request_duration_seconds"`
 	// The total number of active replications. This metric only counts continuous pull replications.
 	NumReplicationsActive *SgwIntStat `json:"num_replications_active"`
 	// The total number of replications created since Sync Gateway node startup.
@@ -361,6 +419,8 @@ type DatabaseStats struct {
 	NumTombstonesCompacted *SgwIntStat `json:"num_tombstones_compacted"`
 	// The total number of sequence numbers assigned.
 	SequenceAssignedCount *SgwIntStat `json:"sequence_assigned_count"`
+	// The current number of sequences reserved by each increment of the sequence counter document.
+	SequenceBatchSize *SgwIntStat `json:"sequence_batch_size"`
 	// The total number of high sequence lookups.
 	SequenceGetCount *SgwIntStat `json:"sequence_get_count"`
 	// The total number of times the sequence counter document has been incremented.
@@ -369,6 +429,8 @@ type DatabaseStats struct {
 	SequenceReleasedCount *SgwIntStat `json:"sequence_released_count"`
 	// The total number of sequences reserved by Sync Gateway.
 	SequenceReservedCount *SgwIntStat `json:"sequence_reserved_count"`
+	// The total time (in nanoseconds) spent waiting for sequence numbers to be assigned.
+	SequenceWaitTime *SgwIntStat `json:"sequence_wait_time"`
 	// The total number of warnings relating to the channel name size.
 	WarnChannelNameSizeCount *SgwIntStat `json:"warn_channel_name_size_count"`
 	// The total number of warnings relating to the channel count exceeding the channel count threshold.
@@ -381,6 +443,47 @@ type DatabaseStats struct {
 	SyncFunctionCount *SgwIntStat `json:"sync_function_count"`
 	// The total time spent evaluating the sync_function.
 	SyncFunctionTime *SgwIntStat `json:"sync_function_time"`
+	// The distribution of the time taken to evaluate the sync_function, in seconds.
+	SyncFunctionDuration *SgwHistogramStat `json:"sync_function_duration_seconds"`
+	// The total number of times that the sync_function rejected a document.  Divide by sync_function_count for the
+	// rejection rate.
+	SyncFunctionRejectCount *SgwIntStat `json:"sync_function_reject_count"`
+	// The total number of times that the sync_function threw an exception or timed out.
+	SyncFunctionExceptionCount *SgwIntStat `json:"sync_function_exception_count"`
+	// The total number of times that the sync_function was interrupted for exceeding the database's CPU time or memory
+	// limits.  Also counted by sync_function_exception_count.
+	SyncFunctionLimitExceededCount *SgwIntStat `json:"sync_function_limit_exceeded_count"`
+	// The total number of times that the sync_function took longer than the database's slow sync function threshold.
+	SyncFunctionSlowCount *SgwIntStat `json:"sync_function_slow_count"`
+	// The total number of REST and BLIP requests that took longer than the database's slow request threshold.
+	SlowRequestCount *SgwIntStat `json:"slow_request_count"`
+	// The total number of roles created by the sync_function via role() calls with {create: true}.
+	SyncFunctionRolesCreated *SgwIntStat `json:"sync_function_roles_created"`
+	// The number of documents assigned to each channel by the sync_function.  Only the first
+	// MaxSyncFunctionChannelAssignmentStats channels are tracked individually, with the rest counted together.
+	SyncFunctionChannelAssignments *ExpVarMapWrapper `json:"sync_function_channel_assignments"`
+	// The total number of channel history entries pruned from documents' sync metadata.
+	ChannelHistoryEntriesPruned *SgwIntStat `json:"channel_history_entries_pruned"`
+	// The total reduction in the size of documents' sync metadata from pruning channel history, in bytes.
+	ChannelHistoryBytesSaved *SgwIntStat `json:"channel_history_bytes_saved"`
+	// The number of non-admin requests to the database in progress, when running in serverless mode.
+	ServerlessActiveConnections *SgwIntStat `json:"serverless_active_connections"`
+	// The total number of non-admin requests rejected because the database was at its serverless connection limit.
+	ServerlessRejectedConnections *SgwIntStat `json:"serverless_rejected_connections"`
+	// The total number of read units consumed by doc reads, when running in serverless mode.
+	ServerlessReadUnits *SgwIntStat `json:"serverless_read_units"`
+	// The total number of write units consumed by doc writes, when running in serverless mode.
+	ServerlessWriteUnits *SgwIntStat `json:"serverless_write_units"`
+	// The total size of the doc bodies read, in bytes, when running in serverless mode.
+	ServerlessBytesRead *SgwIntStat `json:"serverless_bytes_read"`
+	// The total size of the docs written, in bytes, when running in serverless mode.
+	ServerlessBytesWritten *SgwIntStat `json:"serverless_bytes_written"`
+	// The time taken to start the database on its first request after being in cold standby or suspended, in
+	// nanoseconds.  Zero if the database was started when its config was loaded.
+	ActivationTime *SgwIntStat `json:"activation_time"`
+	// Guards the addition of channels to SyncFunctionChannelAssignments, and the number of channels added so far.
+	syncFunctionChannelAssignmentsLock  sync.Mutex
+	syncFunctionChannelAssignmentsCount int
 
 	// These can be cleaned up in future versions of SGW, implemented as maps to reduce amount of potential risk
 	// prior to Hydrogen release. These are not exported as part of prometheus and only exposed through expvars
@@ -390,6 +493,25 @@ type DatabaseStats struct {
 
 // This wrapper ensures that an expvar.Map type can be marshalled into JSON. The expvar.Map has no method to go direct to
 // JSON however the map.String() method returns JSON and so we can use this.
+// AddSyncFunctionChannelAssignment counts the assignment of a document to a channel by the sync function.
+func (d *DatabaseStats) AddSyncFunctionChannelAssignment(channel string) {
+	if d.SyncFunctionChannelAssignments.Get(channel) != nil {
+		d.SyncFunctionChannelAssignments.Add(channel, 1)
+		return
+	}
+
+	d.syncFunctionChannelAssignmentsLock.Lock()
+	defer d.syncFunctionChannelAssignmentsLock.Unlock()
+	if d.SyncFunctionChannelAssignments.Get(channel) == nil {
+		if d.syncFunctionChannelAssignmentsCount >= MaxSyncFunctionChannelAssignmentStats {
+			channel = SyncFunctionChannelAssignmentsOtherKey
+		} else {
+			d.syncFunctionChannelAssignmentsCount++
+		}
+	}
+	d.SyncFunctionChannelAssignments.Add(channel, 1)
+}
+
 type ExpVarMapWrapper struct {
 	*expvar.Map
 }
@@ -506,6 +628,10 @@ type DbReplicatorStats struct {
 	DocsCheckedSent          *SgwIntStat `json:"sgr_docs_checked_sent" `
 	NumConnectAttemptsPull   *SgwIntStat `json:"sgr_num_connect_attempts_pull"`
 	NumReconnectsAbortedPull *SgwIntStat `json:"sgr_num_reconnects_aborted_pull"`
+	// The total number of reconnect attempts made by the pull replicator after losing its connection to the remote.
+	NumReconnectsPull *SgwIntStat `json:"sgr_num_reconnects_pull"`
+	// The number of sequences received by the pull replicator that haven't yet been checkpointed.
+	CheckpointLagPull *SgwIntStat `json:"sgr_checkpoint_lag_pull"`
 
 	// The total number of bytes in all the attachments that were pulled since replication started.
 	NumAttachmentBytesPulled *SgwIntStat `json:"sgr_num_attachment_bytes_pulled"`
@@ -525,6 +651,10 @@ type DbReplicatorStats struct {
 	DocsCheckedReceived      *SgwIntStat `json:"sgr_docs_checked_recv"`
 	NumConnectAttemptsPush   *SgwIntStat `json:"sgr_num_connect_attempts_push"`
 	NumReconnectsAbortedPush *SgwIntStat `json:"sgr_num_reconnects_aborted_push"`
+	// The total number of reconnect attempts made by the push replicator after losing its connection to the remote.
+	NumReconnectsPush *SgwIntStat `json:"sgr_num_reconnects_push"`
+	// The number of sequences sent by the push replicator that haven't yet been checkpointed.
+	CheckpointLagPush *SgwIntStat `json:"sgr_checkpoint_lag_push"`
 
 	// The total number of conflicting documents that were resolved successfully locally (by the active replicator).
 	ConflictResolvedLocalCount *SgwIntStat `json:"sgr_conflict_resolved_local_count"`
@@ -535,6 +665,34 @@ type DbReplicatorStats struct {
 
 	// The number of times a handler panicked and didn't know how to recover from it.
 	NumHandlersPanicked *SgwIntStat `json:"-"`
+
+	// The remote the stats are labelled with
+	remote string
+}
+
+// CollectionStats are the stats for a single keyspace of a database, so that activity can be attributed to a
+// collection rather than only to the database as a whole.
+type CollectionStats struct {
+	// The total number of documents imported into the collection.
+	ImportCount *SgwIntStat `json:"import_count"`
+	// The total number of documents in the collection read via the REST API.
+	NumDocReadsRest *SgwIntStat `json:"num_doc_reads_rest"`
+	// The total number of documents written to the collection by any means.
+	NumDocWrites *SgwIntStat `json:"num_doc_writes"`
+	// The total number of bytes written to documents in the collection.
+	DocWritesBytes *SgwIntStat `json:"doc_writes_bytes"`
+	// The total number of times the sync function was evaluated for documents in the collection.
+	SyncFunctionCount *SgwIntStat `json:"sync_function_count"`
+	// The total time spent evaluating the sync function for documents in the collection.
+	SyncFunctionTime *SgwIntStat `json:"sync_function_time"`
+	// The number of live documents in the collection counted towards its quota.
+	QuotaDocCount *SgwIntStat `json:"quota_doc_count"`
+	// The total size of the bodies of live documents in the collection counted towards its quota.
+	QuotaBodyBytes *SgwIntStat `json:"quota_body_bytes"`
+	// The total number of writes to the collection rejected for exceeding its quota.
+	QuotaRejectedCount *SgwIntStat `json:"quota_rejected_count"`
+	// The total number of times the collection's usage has risen above its quota's warning threshold.
+	QuotaWarningCount *SgwIntStat `json:"quota_warning_count"`
 }
 
 type SecurityStats struct {
@@ -542,10 +700,18 @@ type SecurityStats struct {
 	AuthFailedCount *SgwIntStat `json:"auth_failed_count"`
 	// The total number of successful authentications.
 	AuthSuccessCount *SgwIntStat `json:"auth_success_count"`
+	// The total number of password logins rejected without being checked, because the user or source IP was backing off
+	// after failed logins or locked out.
+	AuthThrottledCount *SgwIntStat `json:"auth_throttled_count"`
+	// The total number of times a user or source IP was locked out after too many failed password logins.
+	AuthLockoutCount *SgwIntStat `json:"auth_lockout_count"`
 	// The total number of documents rejected by write access functions (requireAccess, requireRole, requireUser).
 	NumAccessErrors *SgwIntStat `json:"num_access_errors"`
 	// The total number of documents rejected by the sync_function.
 	NumDocsRejected *SgwIntStat `json:"num_docs_rejected"`
+	// The total number of documents rejected by the sync_function with a machine-readable reason, including those
+	// rejected by the write access functions.
+	NumDocsRejectedWithReason *SgwIntStat `json:"num_docs_rejected_with_reason"`
 	// The total time spent in authenticating all requests.
 	TotalAuthTime *SgwIntStat `json:"total_auth_time"`
 }
@@ -563,6 +729,22 @@ type SharedBucketImportStats struct {
 	ImportHighSeq *SgwIntStat `json:"import_high_seq"`
 	// The total number of import partitions.
 	ImportPartitions *SgwIntStat `json:"import_partitions"`
+	// The total number of import partitions assigned to this node.
+	ImportPartitionsAssignedCount *SgwIntStat `json:"import_partitions_assigned_count"`
+	// The total number of import partitions released by this node, when reassigned to another node or on shutdown.
+	ImportPartitionsReleasedCount *SgwIntStat `json:"import_partitions_released_count"`
+	// The number of imports currently waiting on the import throttle.
+	ImportQueueDepth *SgwIntStat `json:"import_queue_depth"`
+	// The total number of imports delayed by the import throttle.
+	ImportThrottledCount *SgwIntStat `json:"import_throttled_count"`
+	// The total number of SDK writes imported on colliding with a Sync Gateway write.
+	ImportConflictPreferSDKCount *SgwIntStat `json:"import_conflict_prefer_sdk_count"`
+	// The total number of SDK writes discarded on colliding with a Sync Gateway write.
+	ImportConflictPreferSGCount *SgwIntStat `json:"import_conflict_prefer_sg_count"`
+	// The total number of import conflicts passed to a custom import conflict resolver.
+	ImportConflictCustomCount *SgwIntStat `json:"import_conflict_custom_count"`
+	// The total number of docs imported that had an expiry when they were imported.
+	ImportWithExpiryCount *SgwIntStat `json:"import_with_expiry_count"`
 }
 
 type SgwStat struct {
@@ -742,10 +924,133 @@ func (s *SgwDurStat) String() string {
 	return strconv.Itoa(int(time.Since(s.StartTime).Nanoseconds()))
 }
 
+// SgwHistogramStat is a wrapper around SgwStat for reporting the distribution of observed values, such as durations
+// in seconds.  It's reported to Prometheus as a histogram, and to expvars as the count and sum of the observed values
+// along with the cumulative count of values in each bucket.
+type SgwHistogramStat struct {
+	SgwStat
+	upperBounds []float64 // Upper bounds of the buckets, in increasing order
+
+	lock         sync.Mutex
+	bucketCounts []uint64 // Number of observed values in each bucket, with a final bucket for values above all bounds
+	count        uint64
+	sum          float64
+}
+
+// NewHistogramStat creates a new histogram with the given bucket upper bounds, registers it with the Prometheus's
+// DefaultRegisterer and returns it.
+func NewHistogramStat(subsystem string, key string, labelKeys []string, labelVals []string, upperBounds []float64) *SgwHistogramStat {
+	stat := &SgwHistogramStat{
+		SgwStat:      *newSGWStat(subsystem, key, labelKeys, labelVals, prometheus.UntypedValue),
+		upperBounds:  upperBounds,
+		bucketCounts: make([]uint64, len(upperBounds)+1),
+	}
+
+	if !SkipPrometheusStatsRegistration {
+		prometheus.MustRegister(stat)
+	}
+
+	return stat
+}
+
+// Observe adds a value to the histogram.
+func (s *SgwHistogramStat) Observe(value float64) {
+	i := sort.SearchFloat64s(s.upperBounds, value)
+	s.lock.Lock()
+	s.bucketCounts[i]++
+	s.count++
+	s.sum += value
+	s.lock.Unlock()
+}
+
+// snapshot returns the count and sum of the observed values, and the cumulative count for each bucket upper bound.
+func (s *SgwHistogramStat) snapshot() (count uint64, sum float64, buckets map[float64]uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	buckets = make(map[float64]uint64, len(s.upperBounds))
+	var cumulativeCount uint64
+	for i, upperBound := range s.upperBounds {
+		cumulativeCount += s.bucketCounts[i]
+		buckets[upperBound] = cumulativeCount
+	}
+	return s.count, s.sum, buckets
+}
+
+// Count returns the number of observed values.
+func (s *SgwHistogramStat) Count() uint64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.count
+}
+
+func (s *SgwHistogramStat) Describe(ch chan<- *prometheus.Desc) {
+	ch <- s.statDesc
+}
+
+func (s *SgwHistogramStat) Collect(ch chan<- prometheus.Metric) {
+	count, sum, buckets := s.snapshot()
+	ch <- prometheus.MustNewConstHistogram(s.statDesc, count, sum, buckets)
+}
+
+func (s *SgwHistogramStat) MarshalJSON() ([]byte, error) {
+	count, sum, buckets := s.snapshot()
+	jsonBuckets := make(map[string]uint64, len(buckets))
+	for upperBound, cumulativeCount := range buckets {
+		jsonBuckets[strconv.FormatFloat(upperBound, 'g', -1, 64)] = cumulativeCount
+	}
+	return JSONMarshal(struct {
+		Count   uint64            `json:"count"`
+		Sum     float64           `json:"sum"`
+		Buckets map[string]uint64 `json:"buckets"`
+	}{Count: count, Sum: sum, Buckets: jsonBuckets})
+}
+
+func (s *SgwHistogramStat) String() string {
+	bytes, _ := s.MarshalJSON()
+	return string(bytes)
+}
+
+// ValidateHistogramBuckets returns an error if the given upper bounds aren't positive, finite and strictly increasing.
+func ValidateHistogramBuckets(upperBounds []float64) error {
+	for i, upperBound := range upperBounds {
+		if upperBound <= 0 || math.IsInf(upperBound, 0) || math.IsNaN(upperBound) {
+			return fmt.Errorf("histogram bucket upper bound %v must be a positive number", upperBound)
+		}
+		if i > 0 && upperBound <= upperBounds[i-1] {
+			return fmt.Errorf("histogram bucket upper bounds must be in increasing order, found %v after %v", upperBound, upperBounds[i-1])
+		}
+	}
+	return nil
+}
+
+// SetLatencyHistogramBuckets sets the upper bounds of the buckets, in seconds, of the latency histograms of databases
+// created afterwards.  Setting no upper bounds restores DefaultLatencyHistogramBuckets.
+func SetLatencyHistogramBuckets(upperBounds []float64) error {
+	if err := ValidateHistogramBuckets(upperBounds); err != nil {
+		return err
+	}
+	if len(upperBounds) == 0 {
+		upperBounds = DefaultLatencyHistogramBuckets
+	}
+	latencyHistogramBucketsLock.Lock()
+	latencyHistogramBuckets = append([]float64(nil), upperBounds...)
+	latencyHistogramBucketsLock.Unlock()
+	return nil
+}
+
+// LatencyHistogramBuckets returns the upper bounds of the buckets of latency histograms, in seconds.
+func LatencyHistogramBuckets() []float64 {
+	latencyHistogramBucketsLock.RLock()
+	defer latencyHistogramBucketsLock.RUnlock()
+	return latencyHistogramBuckets
+}
+
 type QueryStat struct {
 	QueryCount      *SgwIntStat
 	QueryErrorCount *SgwIntStat
+	QuerySlowCount  *SgwIntStat // Queries that took longer than the database's slow query warning threshold
 	QueryTime       *SgwIntStat
+	QueryDuration   *SgwHistogramStat // Distribution of the time taken by the query, in seconds
 }
 
 func (s *SgwStats) NewDBStats(name string, deltaSyncEnabled bool, importEnabled bool, viewsEnabled bool, queryNames ...string) *DbStats {
@@ -799,6 +1104,7 @@ func (s *SgwStats) ClearDBStats(name string) {
 	for replName := range s.DbStats[name].DbReplicatorStats {
 		s.DbStats[name].unregisterReplicationStats(replName)
 	}
+	s.DbStats[name].unregisterCollectionStats()
 	s.DbStats[name].unregisterDatabaseStats()
 	s.DbStats[name].unregisterSecurityStats()
 
@@ -829,6 +1135,7 @@ func (d *DbStats) initCacheStats() {
 	labelVals := []string{d.dbName}
 	d.CacheStats = &CacheStats{
 		AbandonedSeqs:                       NewIntStat(SubsystemCacheKey, "abandoned_seqs", labelKeys, labelVals, prometheus.CounterValue, 0),
+		CacheFeedRollbackCount:              NewIntStat(SubsystemCacheKey, "cache_feed_rollback_count", labelKeys, labelVals, prometheus.CounterValue, 0),
 		ChannelCacheRevsActive:              NewIntStat(SubsystemCacheKey, "chan_cache_active_revs", labelKeys, labelVals, prometheus.GaugeValue, 0),
 		ChannelCacheBypassCount:             NewIntStat(SubsystemCacheKey, "chan_cache_bypass_count", labelKeys, labelVals, prometheus.CounterValue, 0),
 		ChannelCacheChannelsAdded:           NewIntStat(SubsystemCacheKey, "chan_cache_channels_added", labelKeys, labelVals, prometheus.CounterValue, 0),
@@ -836,13 +1143,19 @@ func (d *DbStats) initCacheStats() {
 		ChannelCacheChannelsEvictedNRU:      NewIntStat(SubsystemCacheKey, "chan_cache_channels_evicted_nru", labelKeys, labelVals, prometheus.CounterValue, 0),
 		ChannelCacheCompactCount:            NewIntStat(SubsystemCacheKey, "chan_cache_compact_count", labelKeys, labelVals, prometheus.CounterValue, 0),
 		ChannelCacheCompactTime:             NewIntStat(SubsystemCacheKey, "chan_cache_compact_time", labelKeys, labelVals, prometheus.CounterValue, 0),
+		ChannelCacheChannelsInvalidated:     NewIntStat(SubsystemCacheKey, "chan_cache_channels_invalidated", labelKeys, labelVals, prometheus.CounterValue, 0),
+		ChannelCacheChannelsRestored:        NewIntStat(SubsystemCacheKey, "chan_cache_channels_restored", labelKeys, labelVals, prometheus.CounterValue, 0),
 		ChannelCacheHits:                    NewIntStat(SubsystemCacheKey, "chan_cache_hits", labelKeys, labelVals, prometheus.CounterValue, 0),
 		ChannelCacheMaxEntries:              NewIntStat(SubsystemCacheKey, "chan_cache_max_entries", labelKeys, labelVals, prometheus.GaugeValue, 0),
 		ChannelCacheMisses:                  NewIntStat(SubsystemCacheKey, "chan_cache_misses", labelKeys, labelVals, prometheus.CounterValue, 0),
 		ChannelCacheNumChannels:             NewIntStat(SubsystemCacheKey, "chan_cache_num_channels", labelKeys, labelVals, prometheus.GaugeValue, 0),
 		ChannelCachePendingQueries:          NewIntStat(SubsystemCacheKey, "chan_cache_pending_queries", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		ChannelCacheStorageBytes:            NewIntStat(SubsystemCacheKey, "chan_cache_storage_bytes", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		ChannelCacheStoredChannels:          NewIntStat(SubsystemCacheKey, "chan_cache_stored_channels", labelKeys, labelVals, prometheus.GaugeValue, 0),
 		ChannelCacheRevsRemoval:             NewIntStat(SubsystemCacheKey, "chan_cache_removal_revs", labelKeys, labelVals, prometheus.GaugeValue, 0),
 		ChannelCacheRevsTombstone:           NewIntStat(SubsystemCacheKey, "chan_cache_tombstone_revs", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		DocResponseCacheHits:                NewIntStat(SubsystemCacheKey, "doc_response_cache_hits", labelKeys, labelVals, prometheus.CounterValue, 0),
+		DocResponseCacheMisses:              NewIntStat(SubsystemCacheKey, "doc_response_cache_misses", labelKeys, labelVals, prometheus.CounterValue, 0),
 		HighSeqCached:                       NewIntStat(SubsystemCacheKey, "high_seq_cached", labelKeys, labelVals, prometheus.CounterValue, 0),
 		HighSeqStable:                       NewIntStat(SubsystemCacheKey, "high_seq_stable", labelKeys, labelVals, prometheus.CounterValue, 0),
 		NonMobileIgnoredCount:               NewIntStat(SubsystemCacheKey, "non_mobile_ignored_count", labelKeys, labelVals, prometheus.CounterValue, 0),
@@ -850,15 +1163,21 @@ func (d *DbStats) initCacheStats() {
 		NumSkippedSeqs:                      NewIntStat(SubsystemCacheKey, "num_skipped_seqs", labelKeys, labelVals, prometheus.CounterValue, 0),
 		PendingSeqLen:                       NewIntStat(SubsystemCacheKey, "pending_seq_len", labelKeys, labelVals, prometheus.GaugeValue, 0),
 		RevisionCacheBypass:                 NewIntStat(SubsystemCacheKey, "rev_cache_bypass", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		RevisionCacheBytes:                  NewIntStat(SubsystemCacheKey, "rev_cache_bytes", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		RevisionCacheCompressedBodyBytes:    NewIntStat(SubsystemCacheKey, "rev_cache_compressed_body_bytes", labelKeys, labelVals, prometheus.CounterValue, 0),
+		RevisionCacheEvictedBytes:           NewIntStat(SubsystemCacheKey, "rev_cache_evicted_bytes", labelKeys, labelVals, prometheus.CounterValue, 0),
 		RevisionCacheHits:                   NewIntStat(SubsystemCacheKey, "rev_cache_hits", labelKeys, labelVals, prometheus.CounterValue, 0),
 		RevisionCacheMisses:                 NewIntStat(SubsystemCacheKey, "rev_cache_misses", labelKeys, labelVals, prometheus.CounterValue, 0),
+		RevisionCacheUncompressedBodyBytes:  NewIntStat(SubsystemCacheKey, "rev_cache_uncompressed_body_bytes", labelKeys, labelVals, prometheus.CounterValue, 0),
 		SkippedSeqLen:                       NewIntStat(SubsystemCacheKey, "skipped_seq_len", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		SkippedSeqRanges:                    NewIntStat(SubsystemCacheKey, "skipped_seq_ranges", labelKeys, labelVals, prometheus.GaugeValue, 0),
 		ViewQueries:                         NewIntStat(SubsystemCacheKey, "view_queries", labelKeys, labelVals, prometheus.CounterValue, 0),
 	}
 }
 
 func (d *DbStats) unregisterCacheStats() {
 	prometheus.Unregister(d.CacheStats.AbandonedSeqs)
+	prometheus.Unregister(d.CacheStats.CacheFeedRollbackCount)
 	prometheus.Unregister(d.CacheStats.ChannelCacheRevsActive)
 	prometheus.Unregister(d.CacheStats.ChannelCacheBypassCount)
 	prometheus.Unregister(d.CacheStats.ChannelCacheChannelsAdded)
@@ -866,13 +1185,19 @@ func (d *DbStats) unregisterCacheStats() {
 	prometheus.Unregister(d.CacheStats.ChannelCacheChannelsEvictedNRU)
 	prometheus.Unregister(d.CacheStats.ChannelCacheCompactCount)
 	prometheus.Unregister(d.CacheStats.ChannelCacheCompactTime)
+	prometheus.Unregister(d.CacheStats.ChannelCacheChannelsInvalidated)
+	prometheus.Unregister(d.CacheStats.ChannelCacheChannelsRestored)
 	prometheus.Unregister(d.CacheStats.ChannelCacheHits)
 	prometheus.Unregister(d.CacheStats.ChannelCacheMaxEntries)
 	prometheus.Unregister(d.CacheStats.ChannelCacheMisses)
 	prometheus.Unregister(d.CacheStats.ChannelCacheNumChannels)
 	prometheus.Unregister(d.CacheStats.ChannelCachePendingQueries)
+	prometheus.Unregister(d.CacheStats.ChannelCacheStorageBytes)
+	prometheus.Unregister(d.CacheStats.ChannelCacheStoredChannels)
 	prometheus.Unregister(d.CacheStats.ChannelCacheRevsRemoval)
 	prometheus.Unregister(d.CacheStats.ChannelCacheRevsTombstone)
+	prometheus.Unregister(d.CacheStats.DocResponseCacheHits)
+	prometheus.Unregister(d.CacheStats.DocResponseCacheMisses)
 	prometheus.Unregister(d.CacheStats.HighSeqCached)
 	prometheus.Unregister(d.CacheStats.HighSeqStable)
 	prometheus.Unregister(d.CacheStats.NonMobileIgnoredCount)
@@ -880,9 +1205,14 @@ func (d *DbStats) unregisterCacheStats() {
 	prometheus.Unregister(d.CacheStats.NumSkippedSeqs)
 	prometheus.Unregister(d.CacheStats.PendingSeqLen)
 	prometheus.Unregister(d.CacheStats.RevisionCacheBypass)
+	prometheus.Unregister(d.CacheStats.RevisionCacheBytes)
+	prometheus.Unregister(d.CacheStats.RevisionCacheCompressedBodyBytes)
+	prometheus.Unregister(d.CacheStats.RevisionCacheEvictedBytes)
 	prometheus.Unregister(d.CacheStats.RevisionCacheHits)
 	prometheus.Unregister(d.CacheStats.RevisionCacheMisses)
+	prometheus.Unregister(d.CacheStats.RevisionCacheUncompressedBodyBytes)
 	prometheus.Unregister(d.CacheStats.SkippedSeqLen)
+	prometheus.Unregister(d.CacheStats.SkippedSeqRanges)
 	prometheus.Unregister(d.CacheStats.ViewQueries)
 }
 
@@ -966,39 +1296,63 @@ func (d *DbStats) initDatabaseStats() {
 	labelKeys := []string{DatabaseLabelKey}
 	labelVals := []string{d.dbName}
 	d.DatabaseStats = &DatabaseStats{
-		CompactionAttachmentStartTime: NewIntStat(SubsystemDatabaseKey, "compaction_attachment_start_time", labelKeys, labelVals, prometheus.GaugeValue, 0),
-		CompactionTombstoneStartTime:  NewIntStat(SubsystemDatabaseKey, "compaction_tombstone_start_time", labelKeys, labelVals, prometheus.GaugeValue, 0),
-		ConflictWriteCount:            NewIntStat(SubsystemDatabaseKey, "conflict_write_count", labelKeys, labelVals, prometheus.CounterValue, 0),
-		Crc32MatchCount:               NewIntStat(SubsystemDatabaseKey, "crc32c_match_count", labelKeys, labelVals, prometheus.GaugeValue, 0),
-		DCPCachingCount:               NewIntStat(SubsystemDatabaseKey, "dcp_caching_count", labelKeys, labelVals, prometheus.GaugeValue, 0),
-		DCPCachingTime:                NewIntStat(SubsystemDatabaseKey, "dcp_caching_time", labelKeys, labelVals, prometheus.GaugeValue, 0),
-		DCPReceivedCount:              NewIntStat(SubsystemDatabaseKey, "dcp_received_count", labelKeys, labelVals, prometheus.GaugeValue, 0),
-		DCPReceivedTime:               NewIntStat(SubsystemDatabaseKey, "dcp_received_time", labelKeys, labelVals, prometheus.GaugeValue, 0),
-		DocReadsBytesBlip:             NewIntStat(SubsystemDatabaseKey, "doc_reads_bytes_blip", labelKeys, labelVals, prometheus.CounterValue, 0),
-		DocWritesBytes:                NewIntStat(SubsystemDatabaseKey, "doc_writes_bytes", labelKeys, labelVals, prometheus.CounterValue, 0),
-		DocWritesXattrBytes:           NewIntStat(SubsystemDatabaseKey, "doc_writes_xattr_bytes", labelKeys, labelVals, prometheus.CounterValue, 0),
-		HighSeqFeed:                   NewIntStat(SubsystemDatabaseKey, "high_seq_feed", labelKeys, labelVals, prometheus.CounterValue, 0),
-		NumAttachmentsCompacted:       NewIntStat(SubsystemDatabaseKey, "num_attachments_compacted", labelKeys, labelVals, prometheus.CounterValue, 0),
-		DocWritesBytesBlip:            NewIntStat(SubsystemDatabaseKey, "doc_writes_bytes_blip", labelKeys, labelVals, prometheus.CounterValue, 0),
-		NumDocReadsBlip:               NewIntStat(SubsystemDatabaseKey, "num_doc_reads_blip", labelKeys, labelVals, prometheus.CounterValue, 0),
-		NumDocReadsRest:               NewIntStat(SubsystemDatabaseKey, "num_doc_reads_rest", labelKeys, labelVals, prometheus.CounterValue, 0),
-		NumDocWrites:                  NewIntStat(SubsystemDatabaseKey, "num_doc_writes", labelKeys, labelVals, prometheus.CounterValue, 0),
-		NumReplicationsActive:         NewIntStat(SubsystemDatabaseKey, "num_replications_active", labelKeys, labelVals, prometheus.GaugeValue, 0),
-		NumReplicationsTotal:          NewIntStat(SubsystemDatabaseKey, "num_replications_total", labelKeys, labelVals, prometheus.CounterValue, 0),
-		NumTombstonesCompacted:        NewIntStat(SubsystemDatabaseKey, "num_tombstones_compacted", labelKeys, labelVals, prometheus.CounterValue, 0),
-		SequenceAssignedCount:         NewIntStat(SubsystemDatabaseKey, "sequence_assigned_count", labelKeys, labelVals, prometheus.CounterValue, 0),
-		SequenceGetCount:              NewIntStat(SubsystemDatabaseKey, "sequence_get_count", labelKeys, labelVals, prometheus.CounterValue, 0),
-		SequenceIncrCount:             NewIntStat(SubsystemDatabaseKey, "sequence_incr_count", labelKeys, labelVals, prometheus.CounterValue, 0),
-		SequenceReleasedCount:         NewIntStat(SubsystemDatabaseKey, "sequence_released_count", labelKeys, labelVals, prometheus.CounterValue, 0),
-		SequenceReservedCount:         NewIntStat(SubsystemDatabaseKey, "sequence_reserved_count", labelKeys, labelVals, prometheus.CounterValue, 0),
-		WarnChannelNameSizeCount:      NewIntStat(SubsystemDatabaseKey, "warn_channel_name_size_count", labelKeys, labelVals, prometheus.CounterValue, 0),
-		WarnChannelsPerDocCount:       NewIntStat(SubsystemDatabaseKey, "warn_channels_per_doc_count", labelKeys, labelVals, prometheus.CounterValue, 0),
-		WarnGrantsPerDocCount:         NewIntStat(SubsystemDatabaseKey, "warn_grants_per_doc_count", labelKeys, labelVals, prometheus.CounterValue, 0),
-		WarnXattrSizeCount:            NewIntStat(SubsystemDatabaseKey, "warn_xattr_size_count", labelKeys, labelVals, prometheus.CounterValue, 0),
-		SyncFunctionCount:             NewIntStat(SubsystemDatabaseKey, "sync_function_count", labelKeys, labelVals, prometheus.CounterValue, 0),
-		SyncFunctionTime:              NewIntStat(SubsystemDatabaseKey, "sync_function_time", labelKeys, labelVals, prometheus.CounterValue, 0),
-		ImportFeedMapStats:            &ExpVarMapWrapper{new(expvar.Map).Init()},
-		CacheFeedMapStats:             &ExpVarMapWrapper{new(expvar.Map).Init()},
+		CompactionAttachmentStartTime:  NewIntStat(SubsystemDatabaseKey, "compaction_attachment_start_time", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		CompactionTombstoneStartTime:   NewIntStat(SubsystemDatabaseKey, "compaction_tombstone_start_time", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		ConflictWriteCount:             NewIntStat(SubsystemDatabaseKey, "conflict_write_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		Crc32MatchCount:                NewIntStat(SubsystemDatabaseKey, "crc32c_match_count", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		DCPCachingCount:                NewIntStat(SubsystemDatabaseKey, "dcp_caching_count", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		DCPCachingTime:                 NewIntStat(SubsystemDatabaseKey, "dcp_caching_time", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		DCPReceivedCount:               NewIntStat(SubsystemDatabaseKey, "dcp_received_count", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		DCPReceivedTime:                NewIntStat(SubsystemDatabaseKey, "dcp_received_time", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		DocReadsBytesBlip:              NewIntStat(SubsystemDatabaseKey, "doc_reads_bytes_blip", labelKeys, labelVals, prometheus.CounterValue, 0),
+		DocWritesBytes:                 NewIntStat(SubsystemDatabaseKey, "doc_writes_bytes", labelKeys, labelVals, prometheus.CounterValue, 0),
+		DocWritesXattrBytes:            NewIntStat(SubsystemDatabaseKey, "doc_writes_xattr_bytes", labelKeys, labelVals, prometheus.CounterValue, 0),
+		HighSeqFeed:                    NewIntStat(SubsystemDatabaseKey, "high_seq_feed", labelKeys, labelVals, prometheus.CounterValue, 0),
+		MemoryAdmissionRejectedCount:   NewIntStat(SubsystemDatabaseKey, "memory_admission_rejected_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		MemoryUsageBytes:               NewIntStat(SubsystemDatabaseKey, "memory_usage_bytes", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		NumAttachmentsCompacted:        NewIntStat(SubsystemDatabaseKey, "num_attachments_compacted", labelKeys, labelVals, prometheus.CounterValue, 0),
+		DocWritesBytesBlip:             NewIntStat(SubsystemDatabaseKey, "doc_writes_bytes_blip", labelKeys, labelVals, prometheus.CounterValue, 0),
+		NumDocReadsBlip:                NewIntStat(SubsystemDatabaseKey, "num_doc_reads_blip", labelKeys, labelVals, prometheus.CounterValue, 0),
+		NumDocReadsRest:                NewIntStat(SubsystemDatabaseKey, "num_doc_reads_rest", labelKeys, labelVals, prometheus.CounterValue, 0),
+		NumDocWrites:                   NewIntStat(SubsystemDatabaseKey, "num_doc_writes", labelKeys, labelVals, prometheus.CounterValue, 0),
+		DocReadDuration:                NewHistogramStat(SubsystemDatabaseKey, "doc_read_duration_seconds", labelKeys, labelVals, LatencyHistogramBuckets()),
+		DocWriteDuration:               NewHistogramStat(SubsystemDatabaseKey, "doc_write_duration_seconds", labelKeys, labelVals, LatencyHistogramBuckets()),
+		ChangesRequestDuration:         NewHistogramStat(SubsystemDatabaseKey, "changes_request_duration_seconds", labelKeys, labelVals, LatencyHistogramBuckets()),
+		NumReplicationsActive:          NewIntStat(SubsystemDatabaseKey, "num_replications_active", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		NumReplicationsTotal:           NewIntStat(SubsystemDatabaseKey, "num_replications_total", labelKeys, labelVals, prometheus.CounterValue, 0),
+		NumTombstonesCompacted:         NewIntStat(SubsystemDatabaseKey, "num_tombstones_compacted", labelKeys, labelVals, prometheus.CounterValue, 0),
+		SequenceAssignedCount:          NewIntStat(SubsystemDatabaseKey, "sequence_assigned_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		SequenceBatchSize:              NewIntStat(SubsystemDatabaseKey, "sequence_batch_size", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		SequenceGetCount:               NewIntStat(SubsystemDatabaseKey, "sequence_get_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		SequenceIncrCount:              NewIntStat(SubsystemDatabaseKey, "sequence_incr_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		SequenceReleasedCount:          NewIntStat(SubsystemDatabaseKey, "sequence_released_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		SequenceReservedCount:          NewIntStat(SubsystemDatabaseKey, "sequence_reserved_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		SequenceWaitTime:               NewIntStat(SubsystemDatabaseKey, "sequence_wait_time", labelKeys, labelVals, prometheus.CounterValue, 0),
+		WarnChannelNameSizeCount:       NewIntStat(SubsystemDatabaseKey, "warn_channel_name_size_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		WarnChannelsPerDocCount:        NewIntStat(SubsystemDatabaseKey, "warn_channels_per_doc_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		WarnGrantsPerDocCount:          NewIntStat(SubsystemDatabaseKey, "warn_grants_per_doc_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		WarnXattrSizeCount:             NewIntStat(SubsystemDatabaseKey, "warn_xattr_size_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		SyncFunctionCount:              NewIntStat(SubsystemDatabaseKey, "sync_function_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		SyncFunctionTime:               NewIntStat(SubsystemDatabaseKey, "sync_function_time", labelKeys, labelVals, prometheus.CounterValue, 0),
+		SyncFunctionDuration:           NewHistogramStat(SubsystemDatabaseKey, "sync_function_duration_seconds", labelKeys, labelVals, LatencyHistogramBuckets()),
+		SyncFunctionRejectCount:        NewIntStat(SubsystemDatabaseKey, "sync_function_reject_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		SyncFunctionExceptionCount:     NewIntStat(SubsystemDatabaseKey, "sync_function_exception_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		SyncFunctionLimitExceededCount: NewIntStat(SubsystemDatabaseKey, "sync_function_limit_exceeded_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		SyncFunctionSlowCount:          NewIntStat(SubsystemDatabaseKey, "sync_function_slow_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		SlowRequestCount:               NewIntStat(SubsystemDatabaseKey, "slow_request_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		SyncFunctionRolesCreated:       NewIntStat(SubsystemDatabaseKey, "sync_function_roles_created", labelKeys, labelVals, prometheus.CounterValue, 0),
+		SyncFunctionChannelAssignments: &ExpVarMapWrapper{new(expvar.Map).Init()},
+		ChannelHistoryEntriesPruned:    NewIntStat(SubsystemDatabaseKey, "channel_history_entries_pruned", labelKeys, labelVals, prometheus.CounterValue, 0),
+		ChannelHistoryBytesSaved:       NewIntStat(SubsystemDatabaseKey, "channel_history_bytes_saved", labelKeys, labelVals, prometheus.CounterValue, 0),
+		ServerlessActiveConnections:    NewIntStat(SubsystemDatabaseKey, "serverless_active_connections", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		ServerlessRejectedConnections:  NewIntStat(SubsystemDatabaseKey, "serverless_rejected_connections", labelKeys, labelVals, prometheus.CounterValue, 0),
+		ServerlessReadUnits:            NewIntStat(SubsystemDatabaseKey, "serverless_read_units", labelKeys, labelVals, prometheus.CounterValue, 0),
+		ServerlessWriteUnits:           NewIntStat(SubsystemDatabaseKey, "serverless_write_units", labelKeys, labelVals, prometheus.CounterValue, 0),
+		ServerlessBytesRead:            NewIntStat(SubsystemDatabaseKey, "serverless_bytes_read", labelKeys, labelVals, prometheus.CounterValue, 0),
+		ServerlessBytesWritten:         NewIntStat(SubsystemDatabaseKey, "serverless_bytes_written", labelKeys, labelVals, prometheus.CounterValue, 0),
+		ActivationTime:                 NewIntStat(SubsystemDatabaseKey, "activation_time", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		ImportFeedMapStats:             &ExpVarMapWrapper{new(expvar.Map).Init()},
+		CacheFeedMapStats:              &ExpVarMapWrapper{new(expvar.Map).Init()},
 	}
 }
 
@@ -1015,11 +1369,16 @@ func (d *DbStats) unregisterDatabaseStats() {
 	prometheus.Unregister(d.DatabaseStats.DocWritesBytes)
 	prometheus.Unregister(d.DatabaseStats.DocWritesXattrBytes)
 	prometheus.Unregister(d.DatabaseStats.HighSeqFeed)
+	prometheus.Unregister(d.DatabaseStats.MemoryAdmissionRejectedCount)
+	prometheus.Unregister(d.DatabaseStats.MemoryUsageBytes)
 	prometheus.Unregister(d.DatabaseStats.DocWritesBytesBlip)
 	prometheus.Unregister(d.DatabaseStats.NumAttachmentsCompacted)
 	prometheus.Unregister(d.DatabaseStats.NumDocReadsBlip)
 	prometheus.Unregister(d.DatabaseStats.NumDocReadsRest)
 	prometheus.Unregister(d.DatabaseStats.NumDocWrites)
+	prometheus.Unregister(d.DatabaseStats.DocReadDuration)
+	prometheus.Unregister(d.DatabaseStats.DocWriteDuration)
+	prometheus.Unregister(d.DatabaseStats.ChangesRequestDuration)
 	prometheus.Unregister(d.DatabaseStats.NumReplicationsActive)
 	prometheus.Unregister(d.DatabaseStats.NumReplicationsTotal)
 	prometheus.Unregister(d.DatabaseStats.NumTombstonesCompacted)
@@ -1028,12 +1387,72 @@ func (d *DbStats) unregisterDatabaseStats() {
 	prometheus.Unregister(d.DatabaseStats.SequenceIncrCount)
 	prometheus.Unregister(d.DatabaseStats.SequenceReleasedCount)
 	prometheus.Unregister(d.DatabaseStats.SequenceReservedCount)
+	prometheus.Unregister(d.DatabaseStats.SequenceBatchSize)
+	prometheus.Unregister(d.DatabaseStats.SequenceWaitTime)
 	prometheus.Unregister(d.DatabaseStats.WarnChannelNameSizeCount)
 	prometheus.Unregister(d.DatabaseStats.WarnChannelsPerDocCount)
 	prometheus.Unregister(d.DatabaseStats.WarnGrantsPerDocCount)
 	prometheus.Unregister(d.DatabaseStats.WarnXattrSizeCount)
 	prometheus.Unregister(d.DatabaseStats.SyncFunctionCount)
 	prometheus.Unregister(d.DatabaseStats.SyncFunctionTime)
+	prometheus.Unregister(d.DatabaseStats.SyncFunctionDuration)
+	prometheus.Unregister(d.DatabaseStats.SyncFunctionRejectCount)
+	prometheus.Unregister(d.DatabaseStats.SyncFunctionExceptionCount)
+	prometheus.Unregister(d.DatabaseStats.SyncFunctionLimitExceededCount)
+	prometheus.Unregister(d.DatabaseStats.SyncFunctionSlowCount)
+	prometheus.Unregister(d.DatabaseStats.SlowRequestCount)
+	prometheus.Unregister(d.DatabaseStats.SyncFunctionRolesCreated)
+	prometheus.Unregister(d.DatabaseStats.ChannelHistoryEntriesPruned)
+	prometheus.Unregister(d.DatabaseStats.ChannelHistoryBytesSaved)
+	prometheus.Unregister(d.DatabaseStats.ServerlessActiveConnections)
+	prometheus.Unregister(d.DatabaseStats.ServerlessRejectedConnections)
+	prometheus.Unregister(d.DatabaseStats.ServerlessReadUnits)
+	prometheus.Unregister(d.DatabaseStats.ServerlessWriteUnits)
+	prometheus.Unregister(d.DatabaseStats.ServerlessBytesRead)
+	prometheus.Unregister(d.DatabaseStats.ServerlessBytesWritten)
+	prometheus.Unregister(d.DatabaseStats.ActivationTime)
+}
+
+// InitCollectionStats creates the stats for the given keyspace, labelled with its scope and collection, if they don't
+// already exist.  Expected to be called while the database is being initialized, before the stats are used.
+func (d *DbStats) InitCollectionStats(scopeName, collectionName string) *CollectionStats {
+	if d.CollectionStats == nil {
+		d.CollectionStats = map[string]*CollectionStats{}
+	}
+	keyspace := scopeName + ScopeCollectionSeparator + collectionName
+	if collectionStats, ok := d.CollectionStats[keyspace]; ok {
+		return collectionStats
+	}
+	labelKeys := []string{DatabaseLabelKey, CollectionLabelKey}
+	labelVals := []string{d.dbName, keyspace}
+	d.CollectionStats[keyspace] = &CollectionStats{
+		ImportCount:        NewIntStat(SubsystemCollectionKey, "import_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		NumDocReadsRest:    NewIntStat(SubsystemCollectionKey, "num_doc_reads_rest", labelKeys, labelVals, prometheus.CounterValue, 0),
+		NumDocWrites:       NewIntStat(SubsystemCollectionKey, "num_doc_writes", labelKeys, labelVals, prometheus.CounterValue, 0),
+		DocWritesBytes:     NewIntStat(SubsystemCollectionKey, "doc_writes_bytes", labelKeys, labelVals, prometheus.CounterValue, 0),
+		SyncFunctionCount:  NewIntStat(SubsystemCollectionKey, "sync_function_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		SyncFunctionTime:   NewIntStat(SubsystemCollectionKey, "sync_function_time", labelKeys, labelVals, prometheus.CounterValue, 0),
+		QuotaDocCount:      NewIntStat(SubsystemCollectionKey, "quota_doc_count", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		QuotaBodyBytes:     NewIntStat(SubsystemCollectionKey, "quota_body_bytes", labelKeys, labelVals, prometheus.GaugeValue, 0),
+		QuotaRejectedCount: NewIntStat(SubsystemCollectionKey, "quota_rejected_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+		QuotaWarningCount:  NewIntStat(SubsystemCollectionKey, "quota_warning_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+	}
+	return d.CollectionStats[keyspace]
+}
+
+func (d *DbStats) unregisterCollectionStats() {
+	for _, stats := range d.CollectionStats {
+		prometheus.Unregister(stats.ImportCount)
+		prometheus.Unregister(stats.NumDocReadsRest)
+		prometheus.Unregister(stats.NumDocWrites)
+		prometheus.Unregister(stats.DocWritesBytes)
+		prometheus.Unregister(stats.SyncFunctionCount)
+		prometheus.Unregister(stats.SyncFunctionTime)
+		prometheus.Unregister(stats.QuotaDocCount)
+		prometheus.Unregister(stats.QuotaBodyBytes)
+		prometheus.Unregister(stats.QuotaRejectedCount)
+		prometheus.Unregister(stats.QuotaWarningCount)
+	}
 }
 
 func (d *DbStats) Database() *DatabaseStats {
@@ -1071,11 +1490,14 @@ func (d *DbStats) initSecurityStats() {
 		labelKeys := []string{DatabaseLabelKey}
 		labelVals := []string{d.dbName}
 		d.SecurityStats = &SecurityStats{
-			AuthFailedCount:  NewIntStat(SubsystemSecurity, "auth_failed_count", labelKeys, labelVals, prometheus.CounterValue, 0),
-			AuthSuccessCount: NewIntStat(SubsystemSecurity, "auth_success_count", labelKeys, labelVals, prometheus.CounterValue, 0),
-			NumAccessErrors:  NewIntStat(SubsystemSecurity, "num_access_errors", labelKeys, labelVals, prometheus.CounterValue, 0),
-			NumDocsRejected:  NewIntStat(SubsystemSecurity, "num_docs_rejected", labelKeys, labelVals, prometheus.CounterValue, 0),
-			TotalAuthTime:    NewIntStat(SubsystemSecurity, "total_auth_time", labelKeys, labelVals, prometheus.GaugeValue, 0),
+			AuthFailedCount:           NewIntStat(SubsystemSecurity, "auth_failed_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+			AuthSuccessCount:          NewIntStat(SubsystemSecurity, "auth_success_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+			AuthThrottledCount:        NewIntStat(SubsystemSecurity, "auth_throttled_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+			AuthLockoutCount:          NewIntStat(SubsystemSecurity, "auth_lockout_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+			NumAccessErrors:           NewIntStat(SubsystemSecurity, "num_access_errors", labelKeys, labelVals, prometheus.CounterValue, 0),
+			NumDocsRejected:           NewIntStat(SubsystemSecurity, "num_docs_rejected", labelKeys, labelVals, prometheus.CounterValue, 0),
+			NumDocsRejectedWithReason: NewIntStat(SubsystemSecurity, "num_docs_rejected_with_reason", labelKeys, labelVals, prometheus.CounterValue, 0),
+			TotalAuthTime:             NewIntStat(SubsystemSecurity, "total_auth_time", labelKeys, labelVals, prometheus.GaugeValue, 0),
 		}
 	}
 }
@@ -1108,26 +1530,54 @@ func (d *DbStats) unregisterReplicationStats(replicationID string) {
 	prometheus.Unregister(d.DbReplicatorStats[replicationID].ConflictResolvedMergedCount)
 	prometheus.Unregister(d.DbReplicatorStats[replicationID].NumConnectAttemptsPull)
 	prometheus.Unregister(d.DbReplicatorStats[replicationID].NumReconnectsAbortedPull)
+	prometheus.Unregister(d.DbReplicatorStats[replicationID].NumReconnectsPush)
+	prometheus.Unregister(d.DbReplicatorStats[replicationID].NumReconnectsPull)
+	prometheus.Unregister(d.DbReplicatorStats[replicationID].CheckpointLagPush)
+	prometheus.Unregister(d.DbReplicatorStats[replicationID].CheckpointLagPull)
 	prometheus.Unregister(d.DbReplicatorStats[replicationID].NumHandlersPanicked)
 }
 
 func (d *DbStats) unregisterSecurityStats() {
 	prometheus.Unregister(d.SecurityStats.AuthFailedCount)
 	prometheus.Unregister(d.SecurityStats.AuthSuccessCount)
+	prometheus.Unregister(d.SecurityStats.AuthThrottledCount)
+	prometheus.Unregister(d.SecurityStats.AuthLockoutCount)
 	prometheus.Unregister(d.SecurityStats.NumAccessErrors)
 	prometheus.Unregister(d.SecurityStats.NumDocsRejected)
+	prometheus.Unregister(d.SecurityStats.NumDocsRejectedWithReason)
 	prometheus.Unregister(d.SecurityStats.TotalAuthTime)
 }
 
+// DBReplicatorStats returns the stats for the given replication, creating them without a remote label if they don't
+// already exist.
 func (d *DbStats) DBReplicatorStats(replicationID string) *DbReplicatorStats {
+	if replicationStats, ok := d.DbReplicatorStats[replicationID]; ok {
+		return replicationStats
+	}
+	return d.DBReplicatorStatsForRemote(replicationID, replicationID, "")
+}
+
+// DBReplicatorStatsForRemote returns the replication stats stored under key, labelled with the given replication ID
+// and remote.  Stats previously created with a different remote are re-created, so that metrics aren't attributed
+// to a remote the replication no longer replicates with.
+//
+// The remote label is part of the identity of each sgr_* series, so adding it changed the series previously exposed
+// for a replication, and changing a replication's remote ends its existing series (counters restart from zero under
+// the new remote) rather than continuing them.  Consumers that don't care about the remote should aggregate over it.
+func (d *DbStats) DBReplicatorStatsForRemote(key, replicationID, remote string) *DbReplicatorStats {
 	if d.DbReplicatorStats == nil {
 		d.DbReplicatorStats = map[string]*DbReplicatorStats{}
 	}
 
-	if _, ok := d.DbReplicatorStats[replicationID]; !ok {
-		labelKeys := []string{DatabaseLabelKey, ReplicationLabelKey}
-		labelVals := []string{d.dbName, replicationID}
-		d.DbReplicatorStats[replicationID] = &DbReplicatorStats{
+	if existing, ok := d.DbReplicatorStats[key]; ok && existing.remote != remote {
+		d.unregisterReplicationStats(key)
+		delete(d.DbReplicatorStats, key)
+	}
+
+	if _, ok := d.DbReplicatorStats[key]; !ok {
+		labelKeys := []string{DatabaseLabelKey, ReplicationLabelKey, RemoteLabelKey}
+		labelVals := []string{d.dbName, replicationID, remote}
+		d.DbReplicatorStats[key] = &DbReplicatorStats{
 			NumAttachmentBytesPushed:    NewIntStat(SubsystemReplication, "sgr_num_attachment_bytes_pushed", labelKeys, labelVals, prometheus.CounterValue, 0),
 			NumAttachmentPushed:         NewIntStat(SubsystemReplication, "sgr_num_attachments_pushed", labelKeys, labelVals, prometheus.CounterValue, 0),
 			NumDocPushed:                NewIntStat(SubsystemReplication, "sgr_num_docs_pushed", labelKeys, labelVals, prometheus.CounterValue, 0),
@@ -1151,11 +1601,16 @@ func (d *DbStats) DBReplicatorStats(replicationID string) *DbReplicatorStats {
 			ConflictResolvedMergedCount: NewIntStat(SubsystemReplication, "sgr_conflict_resolved_merge_count", labelKeys, labelVals, prometheus.CounterValue, 0),
 			NumConnectAttemptsPull:      NewIntStat(SubsystemReplication, "sgr_num_connect_attempts_pull", labelKeys, labelVals, prometheus.CounterValue, 0),
 			NumReconnectsAbortedPull:    NewIntStat(SubsystemReplication, "sgr_num_reconnects_aborted_pull", labelKeys, labelVals, prometheus.CounterValue, 0),
+			NumReconnectsPush:           NewIntStat(SubsystemReplication, "sgr_num_reconnects_push", labelKeys, labelVals, prometheus.CounterValue, 0),
+			NumReconnectsPull:           NewIntStat(SubsystemReplication, "sgr_num_reconnects_pull", labelKeys, labelVals, prometheus.CounterValue, 0),
+			CheckpointLagPush:           NewIntStat(SubsystemReplication, "sgr_checkpoint_lag_push", labelKeys, labelVals, prometheus.GaugeValue, 0),
+			CheckpointLagPull:           NewIntStat(SubsystemReplication, "sgr_checkpoint_lag_pull", labelKeys, labelVals, prometheus.GaugeValue, 0),
 			NumHandlersPanicked:         NewIntStat(SubsystemReplication, "sgr_num_handlers_panicked", labelKeys, labelVals, prometheus.CounterValue, 0),
+			remote:                      remote,
 		}
 	}
 
-	return d.DbReplicatorStats[replicationID]
+	return d.DbReplicatorStats[key]
 }
 
 // Reset replication stats to zero
@@ -1179,6 +1634,10 @@ func (dbr *DbReplicatorStats) Reset() {
 	dbr.ConflictResolvedLocalCount.Set(0)
 	dbr.ConflictResolvedRemoteCount.Set(0)
 	dbr.ConflictResolvedMergedCount.Set(0)
+	dbr.NumReconnectsPush.Set(0)
+	dbr.NumReconnectsPull.Set(0)
+	dbr.CheckpointLagPush.Set(0)
+	dbr.CheckpointLagPull.Set(0)
 }
 
 func (d *DbStats) Security() *SecurityStats {
@@ -1190,12 +1649,20 @@ func (d *DbStats) InitSharedBucketImportStats() {
 		labelKeys := []string{DatabaseLabelKey}
 		labelVals := []string{d.dbName}
 		d.SharedBucketImportStats = &SharedBucketImportStats{
-			ImportCount:          NewIntStat(SubsystemSharedBucketImport, "import_count", labelKeys, labelVals, prometheus.CounterValue, 0),
-			ImportCancelCAS:      NewIntStat(SubsystemSharedBucketImport, "import_cancel_cas", labelKeys, labelVals, prometheus.CounterValue, 0),
-			ImportErrorCount:     NewIntStat(SubsystemSharedBucketImport, "import_error_count", labelKeys, labelVals, prometheus.CounterValue, 0),
-			ImportProcessingTime: NewIntStat(SubsystemSharedBucketImport, "import_processing_time", labelKeys, labelVals, prometheus.GaugeValue, 0),
-			ImportHighSeq:        NewIntStat(SubsystemSharedBucketImport, "import_high_seq", labelKeys, labelVals, prometheus.CounterValue, 0),
-			ImportPartitions:     NewIntStat(SubsystemSharedBucketImport, "import_partitions", labelKeys, labelVals, prometheus.GaugeValue, 0),
+			ImportCount:                   NewIntStat(SubsystemSharedBucketImport, "import_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+			ImportCancelCAS:               NewIntStat(SubsystemSharedBucketImport, "import_cancel_cas", labelKeys, labelVals, prometheus.CounterValue, 0),
+			ImportErrorCount:              NewIntStat(SubsystemSharedBucketImport, "import_error_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+			ImportProcessingTime:          NewIntStat(SubsystemSharedBucketImport, "import_processing_time", labelKeys, labelVals, prometheus.GaugeValue, 0),
+			ImportHighSeq:                 NewIntStat(SubsystemSharedBucketImport, "import_high_seq", labelKeys, labelVals, prometheus.CounterValue, 0),
+			ImportPartitions:              NewIntStat(SubsystemSharedBucketImport, "import_partitions", labelKeys, labelVals, prometheus.GaugeValue, 0),
+			ImportPartitionsAssignedCount: NewIntStat(SubsystemSharedBucketImport, "import_partitions_assigned_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+			ImportPartitionsReleasedCount: NewIntStat(SubsystemSharedBucketImport, "import_partitions_released_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+			ImportQueueDepth:              NewIntStat(SubsystemSharedBucketImport, "import_queue_depth", labelKeys, labelVals, prometheus.GaugeValue, 0),
+			ImportThrottledCount:          NewIntStat(SubsystemSharedBucketImport, "import_throttled_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+			ImportConflictPreferSDKCount:  NewIntStat(SubsystemSharedBucketImport, "import_conflict_prefer_sdk_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+			ImportConflictPreferSGCount:   NewIntStat(SubsystemSharedBucketImport, "import_conflict_prefer_sg_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+			ImportConflictCustomCount:     NewIntStat(SubsystemSharedBucketImport, "import_conflict_custom_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+			ImportWithExpiryCount:         NewIntStat(SubsystemSharedBucketImport, "import_with_expiry_count", labelKeys, labelVals, prometheus.CounterValue, 0),
 		}
 	}
 }
@@ -1207,6 +1674,14 @@ func (d *DbStats) unregisterSharedBucketImportStats() {
 	prometheus.Unregister(d.SharedBucketImportStats.ImportProcessingTime)
 	prometheus.Unregister(d.SharedBucketImportStats.ImportHighSeq)
 	prometheus.Unregister(d.SharedBucketImportStats.ImportPartitions)
+	prometheus.Unregister(d.SharedBucketImportStats.ImportPartitionsAssignedCount)
+	prometheus.Unregister(d.SharedBucketImportStats.ImportPartitionsReleasedCount)
+	prometheus.Unregister(d.SharedBucketImportStats.ImportQueueDepth)
+	prometheus.Unregister(d.SharedBucketImportStats.ImportThrottledCount)
+	prometheus.Unregister(d.SharedBucketImportStats.ImportConflictPreferSDKCount)
+	prometheus.Unregister(d.SharedBucketImportStats.ImportConflictPreferSGCount)
+	prometheus.Unregister(d.SharedBucketImportStats.ImportConflictCustomCount)
+	prometheus.Unregister(d.SharedBucketImportStats.ImportWithExpiryCount)
 }
 
 func (d *DbStats) SharedBucketImport() *SharedBucketImportStats {
@@ -1240,7 +1715,9 @@ func (d *DbStats) _initQueryStat(useViews bool, queryName string) {
 		d.QueryStats.Stats[queryName] = &QueryStat{
 			QueryCount:      NewIntStat(SubsystemGSIViews, prometheusKey+"_count", labelKeys, labelVals, prometheus.CounterValue, 0),
 			QueryErrorCount: NewIntStat(SubsystemGSIViews, prometheusKey+"_error_count", labelKeys, labelVals, prometheus.CounterValue, 0),
+			QuerySlowCount:  NewIntStat(SubsystemGSIViews, prometheusKey+"_slow_count", labelKeys, labelVals, prometheus.CounterValue, 0),
 			QueryTime:       NewIntStat(SubsystemGSIViews, prometheusKey+"_time", labelKeys, labelVals, prometheus.CounterValue, 0),
+			QueryDuration:   NewHistogramStat(SubsystemGSIViews, prometheusKey+"_duration_seconds", labelKeys, labelVals, LatencyHistogramBuckets()),
 		}
 	}
 }
@@ -1249,7 +1726,9 @@ func (d *DbStats) unregisterQueryStats() {
 	for _, stat := range d.QueryStats.Stats {
 		prometheus.Unregister(stat.QueryCount)
 		prometheus.Unregister(stat.QueryErrorCount)
+		prometheus.Unregister(stat.QuerySlowCount)
 		prometheus.Unregister(stat.QueryTime)
+		prometheus.Unregister(stat.QueryDuration)
 	}
 }
 
@@ -1264,7 +1743,9 @@ func (g *QueryStats) MarshalJSON() ([]byte, error) {
 	for queryName, queryMap := range g.Stats {
 		ret[queryName+"_query_count"] = queryMap.QueryCount
 		ret[queryName+"_query_error_count"] = queryMap.QueryErrorCount
+		ret[queryName+"_query_slow_count"] = queryMap.QuerySlowCount
 		ret[queryName+"_query_time"] = queryMap.QueryTime
+		ret[queryName+"_query_duration_seconds"] = queryMap.QueryDuration
 	}
 
 	return JSONMarshalCanonical(ret)
@@ -12,9 +12,12 @@ package base
 
 import (
 	"expvar"
+	"strconv"
 	"testing"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func BenchmarkExpvarString(b *testing.B) {
@@ -162,3 +165,74 @@ func initExpvarBaseEquivalent() *expvar.Map {
 
 	return expvarMap
 }
+
+func TestDBReplicatorStatsForRemote(t *testing.T) {
+	sgwStats := NewSyncGatewayStats()
+	dbStats := sgwStats.NewDBStats(t.Name(), false, false, false)
+
+	replicationStats := dbStats.DBReplicatorStatsForRemote("repl1", "repl1", "https://remote1:4984/db")
+	assert.Equal(t, []string{t.Name(), "repl1", "https://remote1:4984/db"}, replicationStats.NumDocPushed.labelValues)
+	replicationStats.NumDocPushed.Add(5)
+
+	// Same remote returns the existing stats
+	assert.Equal(t, replicationStats, dbStats.DBReplicatorStatsForRemote("repl1", "repl1", "https://remote1:4984/db"))
+	assert.Equal(t, int64(5), dbStats.DBReplicatorStats("repl1").NumDocPushed.Value())
+
+	// Changed remote re-creates the stats with the new label
+	replicationStats = dbStats.DBReplicatorStatsForRemote("repl1", "repl1", "https://remote2:4984/db")
+	assert.Equal(t, []string{t.Name(), "repl1", "https://remote2:4984/db"}, replicationStats.CheckpointLagPush.labelValues)
+	assert.Equal(t, int64(0), replicationStats.NumDocPushed.Value())
+}
+
+func TestHistogramStat(t *testing.T) {
+	stat := NewHistogramStat("test", "test_histogram", nil, nil, []float64{0.1, 1, 10})
+	defer prometheus.Unregister(stat)
+
+	for _, value := range []float64{0.05, 0.1, 0.5, 5, 50} {
+		stat.Observe(value)
+	}
+	assert.Equal(t, uint64(5), stat.Count())
+
+	count, sum, buckets := stat.snapshot()
+	assert.Equal(t, uint64(5), count)
+	assert.InDelta(t, 55.65, sum, 0.0001)
+	assert.Equal(t, map[float64]uint64{0.1: 2, 1: 3, 10: 4}, buckets)
+
+	assert.JSONEq(t, `{"count":5,"sum":55.65,"buckets":{"0.1":2,"1":3,"10":4}}`, stat.String())
+}
+
+func TestLatencyHistogramBuckets(t *testing.T) {
+	defer func() { require.NoError(t, SetLatencyHistogramBuckets(nil)) }()
+
+	assert.Error(t, SetLatencyHistogramBuckets([]float64{0, 1}))
+	assert.Error(t, SetLatencyHistogramBuckets([]float64{1, 0.5}))
+	assert.Error(t, SetLatencyHistogramBuckets([]float64{1, 1}))
+	assert.Equal(t, DefaultLatencyHistogramBuckets, LatencyHistogramBuckets())
+
+	require.NoError(t, SetLatencyHistogramBuckets([]float64{0.1, 1}))
+	assert.Equal(t, []float64{0.1, 1}, LatencyHistogramBuckets())
+
+	sgwStats := NewSyncGatewayStats()
+	dbStats := sgwStats.NewDBStats(t.Name(), false, false, false, "query")
+	defer sgwStats.ClearDBStats(t.Name())
+	dbStats.Database().DocReadDuration.Observe(0.5)
+	dbStats.Query("query").QueryDuration.Observe(5)
+	assert.JSONEq(t, `{"count":1,"sum":0.5,"buckets":{"0.1":0,"1":1}}`, dbStats.Database().DocReadDuration.String())
+	assert.JSONEq(t, `{"count":1,"sum":5,"buckets":{"0.1":0,"1":0}}`, dbStats.Query("query").QueryDuration.String())
+
+	require.NoError(t, SetLatencyHistogramBuckets(nil))
+	assert.Equal(t, DefaultLatencyHistogramBuckets, LatencyHistogramBuckets())
+}
+
+func TestAddSyncFunctionChannelAssignment(t *testing.T) {
+	stats := &DatabaseStats{SyncFunctionChannelAssignments: &ExpVarMapWrapper{new(expvar.Map).Init()}}
+	for i := 0; i < MaxSyncFunctionChannelAssignmentStats+2; i++ {
+		stats.AddSyncFunctionChannelAssignment(strconv.Itoa(i))
+	}
+	stats.AddSyncFunctionChannelAssignment("0")
+
+	assert.Equal(t, "2", stats.SyncFunctionChannelAssignments.Get("0").String())
+	assert.Equal(t, "1", stats.SyncFunctionChannelAssignments.Get(strconv.Itoa(MaxSyncFunctionChannelAssignmentStats-1)).String())
+	assert.Nil(t, stats.SyncFunctionChannelAssignments.Get(strconv.Itoa(MaxSyncFunctionChannelAssignmentStats)))
+	assert.Equal(t, "2", stats.SyncFunctionChannelAssignments.Get(SyncFunctionChannelAssignmentsOtherKey).String())
+}
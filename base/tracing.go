@@ -0,0 +1,446 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package base
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// TraceparentHeader is the W3C Trace Context header carrying the caller's trace and span IDs.
+	TraceparentHeader = "traceparent"
+
+	// DefaultTracingServiceName is the service name spans are exported with when tracing.service_name isn't set.
+	DefaultTracingServiceName = "sync_gateway"
+
+	tracingBatchSize     = 512             // Maximum number of spans exported per request
+	tracingQueueSize     = 4096            // Spans ended while the queue is full are dropped
+	tracingFlushInterval = 5 * time.Second // Maximum time an ended span waits to be exported
+	tracingExportTimeout = 10 * time.Second
+)
+
+// SpanKind describes the relationship of a span to its parent and children, as defined by OpenTelemetry.
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = 1 // An operation within Sync Gateway
+	SpanKindServer   SpanKind = 2 // A request handled by Sync Gateway
+	SpanKindClient   SpanKind = 3 // A request made by Sync Gateway to Couchbase Server
+)
+
+// SpanContext identifies a span within a trace, and is propagated between services in the traceparent header.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// ParseTraceparent parses a W3C Trace Context traceparent header.  Returns false if the header isn't valid.
+func ParseTraceparent(header string) (sc SpanContext, ok bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return SpanContext{}, false
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil || sc.TraceID == [16]byte{} {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil || sc.SpanID == [8]byte{} {
+		return SpanContext{}, false
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil {
+		return SpanContext{}, false
+	}
+	sc.Sampled = flags&0x01 == 0x01
+	return sc, true
+}
+
+// Traceparent returns the W3C Trace Context traceparent header identifying the span.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-" + flags
+}
+
+// Span is a timed operation within a trace, exported via OTLP when it ends.  Spans are only created while tracing is
+// enabled and the trace is sampled - methods are safe to call on a nil span, which records nothing.
+type Span struct {
+	SpanContext
+	parentSpanID [8]byte
+	name         string
+	kind         SpanKind
+	startTime    time.Time
+	endTime      time.Time
+	attributes   map[string]interface{}
+	err          error
+	lock         sync.Mutex
+	ended        bool
+	exporter     *spanExporter
+}
+
+type spanContextKey struct{}
+
+// SpanFromContext returns the span in the context, or nil if the context isn't being traced.
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanContextKey{}).(*Span)
+	return span
+}
+
+// StartSpan starts a span for an operation within Sync Gateway, as a child of the span in the context.  Returns a
+// context containing the new span, which must be ended by calling End.
+func StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	return startSpan(ctx, name, SpanKindInternal, nil)
+}
+
+// StartServerSpan starts a span for a request handled by Sync Gateway.  The span continues the caller's trace when
+// the traceparent header is valid, otherwise it starts a new trace.
+func StartServerSpan(ctx context.Context, name string, traceparent string) (context.Context, *Span) {
+	var remoteParent *SpanContext
+	if parent, ok := ParseTraceparent(traceparent); ok {
+		remoteParent = &parent
+	}
+	return startSpan(ctx, name, SpanKindServer, remoteParent)
+}
+
+func startSpan(ctx context.Context, name string, kind SpanKind, remoteParent *SpanContext) (context.Context, *Span) {
+	exporter := getSpanExporter()
+	if exporter == nil {
+		return ctx, nil
+	}
+
+	span := &Span{name: name, kind: kind, startTime: time.Now(), exporter: exporter}
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.TraceID = parent.TraceID
+		span.parentSpanID = parent.SpanID
+		span.Sampled = true
+	} else if remoteParent != nil {
+		span.TraceID = remoteParent.TraceID
+		span.parentSpanID = remoteParent.SpanID
+		span.Sampled = remoteParent.Sampled
+	} else {
+		_, _ = rand.Read(span.TraceID[:])
+		span.Sampled = exporter.sample()
+	}
+	if !span.Sampled {
+		return ctx, nil
+	}
+	_, _ = rand.Read(span.SpanID[:])
+	return context.WithValue(ctx, spanContextKey{}, span), span
+}
+
+// SetAttribute records an attribute of the span.  Values are exported as strings, integers, floats or booleans.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.attributes == nil {
+		s.attributes = make(map[string]interface{})
+	}
+	s.attributes[key] = value
+}
+
+// End ends the span, marking it as failed if err is non-nil, and queues it for export.  Only the first call has any
+// effect.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	if s.ended {
+		s.lock.Unlock()
+		return
+	}
+	s.ended = true
+	s.endTime = time.Now()
+	s.err = err
+	s.lock.Unlock()
+	s.exporter.enqueue(s)
+}
+
+// spanExporter exports ended spans in batches to an OTLP/HTTP endpoint, using the OTLP JSON encoding.
+type spanExporter struct {
+	url         string
+	serviceName string
+	sampleRate  float64
+	client      *http.Client
+	queue       chan *Span
+	terminator  chan struct{}
+	doneChan    chan struct{}
+}
+
+var (
+	spanExporterLock   sync.RWMutex
+	activeSpanExporter *spanExporter
+)
+
+func getSpanExporter() *spanExporter {
+	spanExporterLock.RLock()
+	defer spanExporterLock.RUnlock()
+	return activeSpanExporter
+}
+
+// StartTracing starts exporting spans to the OTLP/HTTP collector at endpoint, such as http://localhost:4318.  New
+// traces are sampled at sampleRate, between 0 and 1, while traces continued from a caller's traceparent header follow
+// the caller's sampling decision.  Replaces any previous exporter, flushing its spans.
+func StartTracing(ctx context.Context, endpoint string, serviceName string, sampleRate float64) {
+	if serviceName == "" {
+		serviceName = DefaultTracingServiceName
+	}
+	exporter := &spanExporter{
+		url:         strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		serviceName: serviceName,
+		sampleRate:  sampleRate,
+		client:      &http.Client{Timeout: tracingExportTimeout},
+		queue:       make(chan *Span, tracingQueueSize),
+		terminator:  make(chan struct{}),
+		doneChan:    make(chan struct{}),
+	}
+	go exporter.run(ctx)
+
+	spanExporterLock.Lock()
+	previous := activeSpanExporter
+	activeSpanExporter = exporter
+	spanExporterLock.Unlock()
+	if previous != nil {
+		previous.stop(ctx)
+	}
+	InfofCtx(ctx, KeyAll, "Exporting traces to %s with sample rate %v", MD(exporter.url), sampleRate)
+}
+
+// StopTracing stops creating spans, and exports the spans that have already ended.
+func StopTracing(ctx context.Context) {
+	spanExporterLock.Lock()
+	exporter := activeSpanExporter
+	activeSpanExporter = nil
+	spanExporterLock.Unlock()
+	if exporter != nil {
+		exporter.stop(ctx)
+	}
+}
+
+func (e *spanExporter) sample() bool {
+	if e.sampleRate >= 1 {
+		return true
+	} else if e.sampleRate <= 0 {
+		return false
+	}
+	const precision = 1 << 30
+	n, err := rand.Int(rand.Reader, big.NewInt(precision))
+	return err == nil && float64(n.Int64()) < e.sampleRate*precision
+}
+
+func (e *spanExporter) enqueue(span *Span) {
+	select {
+	case e.queue <- span:
+	default:
+		// Drop spans rather than block requests when the collector can't keep up
+	}
+}
+
+func (e *spanExporter) stop(ctx context.Context) {
+	if err := TerminateAndWaitForClose(e.terminator, e.doneChan, tracingExportTimeout); err != nil {
+		InfofCtx(ctx, KeyAll, "Couldn't stop trace exporter: %v", err)
+	}
+}
+
+func (e *spanExporter) run(ctx context.Context) {
+	defer close(e.doneChan)
+	ticker := time.NewTicker(tracingFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, tracingBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.export(batch); err != nil {
+			DebugfCtx(ctx, KeyAll, "Couldn't export %d spans: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case span := <-e.queue:
+			batch = append(batch, span)
+			if len(batch) >= tracingBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-e.terminator:
+			for {
+				select {
+				case span := <-e.queue:
+					batch = append(batch, span)
+					if len(batch) >= tracingBatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (e *spanExporter) export(spans []*Span) error {
+	body, err := JSONMarshal(e.otlpRequest(spans))
+	if err != nil {
+		return err
+	}
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("collector responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// The OTLP JSON encoding of an ExportTraceServiceRequest.
+type otlpTraceRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              SpanKind        `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"` // 1 is OK, 2 is an error
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string             `json:"key"`
+	Value otlpAttributeValue `json:"value"`
+}
+
+type otlpAttributeValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"` // 64 bit integers are encoded as strings
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+func newOTLPAttribute(key string, value interface{}) otlpAttribute {
+	attribute := otlpAttribute{Key: key}
+	switch v := value.(type) {
+	case string:
+		attribute.Value.StringValue = &v
+	case bool:
+		attribute.Value.BoolValue = &v
+	case int:
+		s := strconv.FormatInt(int64(v), 10)
+		attribute.Value.IntValue = &s
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		attribute.Value.IntValue = &s
+	case uint64:
+		s := strconv.FormatUint(v, 10)
+		attribute.Value.IntValue = &s
+	case float64:
+		attribute.Value.DoubleValue = &v
+	default:
+		s := fmt.Sprintf("%v", v)
+		attribute.Value.StringValue = &s
+	}
+	return attribute
+}
+
+func (e *spanExporter) otlpRequest(spans []*Span) otlpTraceRequest {
+	scopeSpans := otlpScopeSpans{
+		Scope: otlpScope{Name: DefaultTracingServiceName},
+		Spans: make([]otlpSpan, 0, len(spans)),
+	}
+	if ProductVersion != nil {
+		scopeSpans.Scope.Version = ProductVersion.String()
+	}
+	for _, span := range spans {
+		scopeSpans.Spans = append(scopeSpans.Spans, span.otlpSpan())
+	}
+	return otlpTraceRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: []otlpAttribute{newOTLPAttribute("service.name", e.serviceName)}},
+		ScopeSpans: []otlpScopeSpans{scopeSpans},
+	}}}
+}
+
+func (s *Span) otlpSpan() otlpSpan {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	span := otlpSpan{
+		TraceID:           hex.EncodeToString(s.TraceID[:]),
+		SpanID:            hex.EncodeToString(s.SpanID[:]),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.startTime.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.endTime.UnixNano(), 10),
+		Status:            otlpStatus{Code: 1},
+	}
+	if s.parentSpanID != [8]byte{} {
+		span.ParentSpanID = hex.EncodeToString(s.parentSpanID[:])
+	}
+	for key, value := range s.attributes {
+		span.Attributes = append(span.Attributes, newOTLPAttribute(key, value))
+	}
+	if s.err != nil {
+		span.Status = otlpStatus{Code: 2, Message: s.err.Error()}
+	}
+	return span
+}
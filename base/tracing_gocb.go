@@ -0,0 +1,59 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package base
+
+import (
+	"context"
+	"time"
+
+	"github.com/couchbase/gocb/v2"
+)
+
+// goCBv2RequestTracer exports the spans gocb creates for operations against Couchbase Server.  The bucket APIs don't
+// carry the request's context, so each operation starts its own trace, sampled at tracing.sample_rate, with gocb's
+// encoding and dispatch spans as its children.
+type goCBv2RequestTracer struct{}
+
+var _ gocb.RequestTracer = goCBv2RequestTracer{}
+
+// GoCBv2RequestTracer returns the tracer to set in gocb.ClusterOptions, or nil when tracing isn't enabled.
+func GoCBv2RequestTracer() gocb.RequestTracer {
+	if getSpanExporter() == nil {
+		return nil
+	}
+	return goCBv2RequestTracer{}
+}
+
+func (goCBv2RequestTracer) RequestSpan(parentContext gocb.RequestSpanContext, operationName string) gocb.RequestSpan {
+	ctx := context.Background()
+	if parent, ok := parentContext.(*Span); ok && parent != nil {
+		ctx = context.WithValue(ctx, spanContextKey{}, parent)
+	}
+	_, span := startSpan(ctx, operationName, SpanKindClient, nil)
+	span.SetAttribute("db.system", "couchbase")
+	return goCBv2RequestSpan{span: span}
+}
+
+type goCBv2RequestSpan struct {
+	span *Span
+}
+
+func (s goCBv2RequestSpan) End() {
+	s.span.End(nil)
+}
+
+func (s goCBv2RequestSpan) Context() gocb.RequestSpanContext {
+	return s.span
+}
+
+func (s goCBv2RequestSpan) AddEvent(name string, timestamp time.Time) {}
+
+func (s goCBv2RequestSpan) SetAttribute(key string, value interface{}) {
+	s.span.SetAttribute(key, value)
+}
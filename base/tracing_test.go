@@ -0,0 +1,117 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package base
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	testCases := []struct {
+		header  string
+		valid   bool
+		sampled bool
+	}{
+		{header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", valid: true, sampled: true},
+		{header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", valid: true, sampled: false},
+		{header: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future", valid: true, sampled: true},
+		{header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", valid: false},
+		{header: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", valid: false},
+		{header: "00-00000000000000000000000000000000-00f067aa0ba902b7-01", valid: false},
+		{header: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", valid: false},
+		{header: "00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01", valid: false},
+		{header: "00-xyz92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", valid: false},
+		{header: "", valid: false},
+	}
+	for _, test := range testCases {
+		t.Run(test.header, func(t *testing.T) {
+			sc, ok := ParseTraceparent(test.header)
+			require.Equal(t, test.valid, ok)
+			if !test.valid {
+				return
+			}
+			assert.Equal(t, test.sampled, sc.Sampled)
+			if test.header[:2] == "00" {
+				assert.Equal(t, test.header, sc.Traceparent())
+			}
+		})
+	}
+}
+
+func TestTracingExport(t *testing.T) {
+	var lock sync.Mutex
+	var requests []otlpTraceRequest
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		var request otlpTraceRequest
+		require.NoError(t, JSONUnmarshal(body, &request))
+		lock.Lock()
+		requests = append(requests, request)
+		lock.Unlock()
+	}))
+	defer collector.Close()
+
+	ctx := TestCtx(t)
+
+	// No spans are created while tracing is disabled
+	_, span := StartServerSpan(ctx, "GET /", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	assert.Nil(t, span)
+
+	StartTracing(ctx, collector.URL, "", 1)
+	defer StopTracing(ctx)
+
+	// The server span continues the caller's trace, and internal spans are its children
+	rqCtx, serverSpan := StartServerSpan(ctx, "GET /{db}/", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.NotNil(t, serverSpan)
+	serverSpan.SetAttribute("http.status_code", 500)
+	_, childSpan := StartSpan(rqCtx, "db.get_rev")
+	require.NotNil(t, childSpan)
+	assert.Equal(t, serverSpan.TraceID, childSpan.TraceID)
+	childSpan.End(nil)
+	serverSpan.End(errors.New("500 Internal Server Error"))
+
+	// Traces the caller didn't sample aren't recorded
+	_, unsampledSpan := StartServerSpan(ctx, "GET /", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	assert.Nil(t, unsampledSpan)
+
+	StopTracing(ctx)
+
+	lock.Lock()
+	defer lock.Unlock()
+	require.Len(t, requests, 1)
+	require.Len(t, requests[0].ResourceSpans, 1)
+	assert.Equal(t, DefaultTracingServiceName, *requests[0].ResourceSpans[0].Resource.Attributes[0].Value.StringValue)
+	spans := requests[0].ResourceSpans[0].ScopeSpans[0].Spans
+	require.Len(t, spans, 2)
+
+	child, server := spans[0], spans[1]
+	assert.Equal(t, "db.get_rev", child.Name)
+	assert.Equal(t, SpanKindInternal, child.Kind)
+	assert.Equal(t, server.SpanID, child.ParentSpanID)
+	assert.Equal(t, 1, child.Status.Code)
+
+	assert.Equal(t, "GET /{db}/", server.Name)
+	assert.Equal(t, SpanKindServer, server.Kind)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", server.ParentSpanID)
+	assert.Equal(t, 2, server.Status.Code)
+	require.Len(t, server.Attributes, 1)
+	assert.Equal(t, "http.status_code", server.Attributes[0].Key)
+	assert.Equal(t, "500", *server.Attributes[0].Value.IntValue)
+}
@@ -0,0 +1,142 @@
+// Copyright 2022-Present Couchbase, Inc.
+//
+// Use of this software is governed by the Business Source License included
+// in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+// in that file, in accordance with the Business Source License, use of this
+// software will be governed by the Apache License, Version 2.0, included in
+// the file licenses/APL2.txt.
+
+package base
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// UserXattrKeySeparator separates the keys of a user xattr key specification that refers to more than one key.
+	UserXattrKeySeparator = ","
+
+	// UserXattrPathSeparator separates the name of a user xattr from the path to a property nested within it.
+	UserXattrPathSeparator = "."
+)
+
+// A user xattr key specification, as passed to bucket operations, is either the name of a single user xattr, or a
+// composite specification made up of one or more keys separated by UserXattrKeySeparator, where each key is the name of
+// an xattr optionally followed by a dot-separated path to a property nested within it (e.g. "appMeta.access").
+//
+// For a single user xattr, the raw user xattr is the value of that xattr.  For a composite specification, the raw user
+// xattr is a JSON object with a property per xattr, holding only the (nested) properties selected by the keys - e.g.
+// {"appMeta":{"access":...}}.  As the raw user xattr is hashed to detect changes to it, only changes to the selected
+// properties are detected.
+
+// UserXattrKeySpec returns the user xattr key specification for the given keys.
+func UserXattrKeySpec(keys []string) string {
+	return strings.Join(keys, UserXattrKeySeparator)
+}
+
+// UserXattrKeys returns the keys in a user xattr key specification.
+func UserXattrKeys(userXattrKey string) []string {
+	if userXattrKey == "" {
+		return nil
+	}
+	return strings.Split(userXattrKey, UserXattrKeySeparator)
+}
+
+// IsCompositeUserXattrKey returns true if the user xattr key specification refers to more than one key, or to a nested
+// property, and so has a composite raw user xattr.
+func IsCompositeUserXattrKey(userXattrKey string) bool {
+	return strings.Contains(userXattrKey, UserXattrKeySeparator) || strings.Contains(userXattrKey, UserXattrPathSeparator)
+}
+
+// UserXattrName returns the name of the xattr that a user xattr key refers to.
+func UserXattrName(key string) string {
+	name, _, _ := strings.Cut(key, UserXattrPathSeparator)
+	return name
+}
+
+// ValidateUserXattrKey returns an error if the given key isn't valid for use as a user xattr key.
+func ValidateUserXattrKey(key string) error {
+	if key == "" {
+		return errors.New("key must not be empty")
+	}
+	if strings.Contains(key, UserXattrKeySeparator) {
+		return fmt.Errorf("key %q must not contain %q", key, UserXattrKeySeparator)
+	}
+	for _, component := range strings.Split(key, UserXattrPathSeparator) {
+		if component == "" {
+			return fmt.Errorf("key %q must not contain empty path components", key)
+		}
+	}
+	if UserXattrName(key) == SyncXattrName {
+		return fmt.Errorf("key %q must not refer to the %s xattr", key, SyncXattrName)
+	}
+	return nil
+}
+
+// UserXattrPathValue returns the value of the property at the given key's path within the raw value of the xattr it
+// refers to, or nil if there isn't one.
+func UserXattrPathValue(key string, rawXattr []byte) []byte {
+	path := strings.Split(key, UserXattrPathSeparator)[1:]
+	value := json.RawMessage(rawXattr)
+	for _, property := range path {
+		var object map[string]json.RawMessage
+		if err := JSONUnmarshal(value, &object); err != nil {
+			// Not an object, so there's no nested property
+			return nil
+		}
+		var ok bool
+		if value, ok = object[property]; !ok {
+			return nil
+		}
+	}
+	return value
+}
+
+// CompositeUserXattr builds the composite raw user xattr from the values of the keys of a composite user xattr key
+// specification.  Keys without a value are omitted.  Returns nil if none of the keys have a value.
+func CompositeUserXattr(values map[string][]byte) ([]byte, error) {
+	// Sorting ensures a key's value takes precedence over the values of keys nested within it
+	keys := make([]string, 0, len(values))
+	for key, value := range values {
+		if len(value) > 0 {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	sort.Strings(keys)
+
+	composite := map[string]interface{}{}
+	for _, key := range keys {
+		parent := composite
+		path := strings.Split(key, UserXattrPathSeparator)
+		for i, property := range path {
+			if i == len(path)-1 {
+				// Compact values so that the composite doesn't depend on how they were retrieved
+				var value bytes.Buffer
+				if err := json.Compact(&value, values[key]); err != nil {
+					return nil, err
+				}
+				parent[property] = json.RawMessage(value.Bytes())
+				break
+			}
+			child, ok := parent[property].(map[string]interface{})
+			if !ok {
+				if _, isValue := parent[property]; isValue {
+					// Already holds the value of an enclosing key
+					break
+				}
+				child = map[string]interface{}{}
+				parent[property] = child
+			}
+			parent = child
+		}
+	}
+	return JSONMarshalCanonical(composite)
+}
@@ -0,0 +1,61 @@
+// Copyright 2022-Present Couchbase, Inc.
+//
+// Use of this software is governed by the Business Source License included
+// in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+// in that file, in accordance with the Business Source License, use of this
+// software will be governed by the Apache License, Version 2.0, included in
+// the file licenses/APL2.txt.
+
+package base
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsCompositeUserXattrKey(t *testing.T) {
+	assert.False(t, IsCompositeUserXattrKey(""))
+	assert.False(t, IsCompositeUserXattrKey("channelMeta"))
+	assert.True(t, IsCompositeUserXattrKey("appMeta.access"))
+	assert.True(t, IsCompositeUserXattrKey("channelMeta,appMeta"))
+	assert.Equal(t, []string{"channelMeta", "appMeta.access"}, UserXattrKeys(UserXattrKeySpec([]string{"channelMeta", "appMeta.access"})))
+	assert.Equal(t, "appMeta", UserXattrName("appMeta.access.alice"))
+}
+
+func TestValidateUserXattrKey(t *testing.T) {
+	assert.NoError(t, ValidateUserXattrKey("channelMeta"))
+	assert.NoError(t, ValidateUserXattrKey("appMeta.access.alice"))
+	assert.Error(t, ValidateUserXattrKey(""))
+	assert.Error(t, ValidateUserXattrKey("channelMeta,appMeta"))
+	assert.Error(t, ValidateUserXattrKey("appMeta..access"))
+	assert.Error(t, ValidateUserXattrKey("appMeta."))
+	assert.Error(t, ValidateUserXattrKey(SyncXattrName))
+	assert.Error(t, ValidateUserXattrKey(SyncXattrName+".sequence"))
+}
+
+func TestUserXattrPathValue(t *testing.T) {
+	rawXattr := []byte(`{"access": {"alice": ["ABC"]}, "audit": "ignored"}`)
+	assert.Equal(t, string(rawXattr), string(UserXattrPathValue("appMeta", rawXattr)))
+	assert.Equal(t, `{"alice": ["ABC"]}`, string(UserXattrPathValue("appMeta.access", rawXattr)))
+	assert.Equal(t, `["ABC"]`, string(UserXattrPathValue("appMeta.access.alice", rawXattr)))
+	assert.Nil(t, UserXattrPathValue("appMeta.missing", rawXattr))
+	assert.Nil(t, UserXattrPathValue("appMeta.audit.nested", rawXattr))
+}
+
+func TestCompositeUserXattr(t *testing.T) {
+	composite, err := CompositeUserXattr(map[string][]byte{})
+	require.NoError(t, err)
+	assert.Nil(t, composite)
+
+	composite, err = CompositeUserXattr(map[string][]byte{
+		"channelMeta":         []byte(`[ "ABC",  "DEF" ]`),
+		"appMeta.access":      []byte(`{"alice": ["ABC"]}`),
+		"appMeta.roles":       []byte(`"admin"`),
+		"appMeta.access.bob":  []byte(`["DEF"]`), // Already included in appMeta.access
+		"missingMeta.nothing": nil,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `{"appMeta":{"access":{"alice":["ABC"]},"roles":"admin"},"channelMeta":["ABC","DEF"]}`, string(composite))
+}
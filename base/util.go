@@ -841,6 +841,11 @@ func IntPtr(i int) *int {
 	return &i
 }
 
+// Int64Ptr returns a pointer to the given int64 literal.
+func Int64Ptr(i int64) *int64 {
+	return &i
+}
+
 // BoolPtr returns a pointer to the given bool literal.
 func BoolPtr(b bool) *bool {
 	return &b
@@ -1451,6 +1456,47 @@ func injectJSONPropertyFromBytes(b []byte, bIsEmpty bool, kvPairs []KVPairBytes)
 	return newJSON
 }
 
+// RemoveJSONProperty returns a copy of the given JSON object with the given top-level property removed, without
+// unmarshalling the object's other properties.  Returns the given byte slice unmodified if the property isn't present.
+func RemoveJSONProperty(b []byte, key string) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return nil, errors.New("JSON value is not an object")
+	}
+
+	// Each property after the first is preceded by a comma, which is removed with the property
+	propertyStart := decoder.InputOffset()
+	for first := true; decoder.More(); first = false {
+		token, err = decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return nil, err
+		}
+		propertyEnd := decoder.InputOffset()
+		if token != key {
+			propertyStart = propertyEnd
+			continue
+		}
+		if first {
+			// The first property's followed by a comma instead, if there are others
+			if commaIndex := bytes.IndexByte(b[propertyEnd:], ','); commaIndex >= 0 && decoder.More() {
+				propertyEnd += int64(commaIndex) + 1
+			}
+		}
+		newJSON := make([]byte, 0, len(b)-int(propertyEnd-propertyStart))
+		newJSON = append(newJSON, b[:propertyStart]...)
+		return append(newJSON, b[propertyEnd:]...), nil
+	}
+	return b, nil
+}
+
 // WrapJSONUnknownFieldErr wraps JSON unknown field errors with ErrUnknownField for later checking via errors.Cause
 func WrapJSONUnknownFieldErr(err error) error {
 	if err != nil && strings.Contains(err.Error(), "unknown field") {
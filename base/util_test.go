@@ -778,6 +778,30 @@ func TestIsDeltaError(t *testing.T) {
 }
 
 // Test to ensure that InjectJSONProperties does not mutate the given byte slice, and instead only returns a modified copy.
+func TestRemoveJSONProperty(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: `{"_sync":{"rev":"1-a"},"a":1}`, expected: `{"a":1}`},
+		{input: `{"a":1,"_sync":{"rev":"1-a"}}`, expected: `{"a":1}`},
+		{input: `{"a":1, "_sync" : [1,2] , "b":{"_sync":true}}`, expected: `{"a":1 , "b":{"_sync":true}}`},
+		{input: `{"_sync":1}`, expected: `{}`},
+		{input: `{"a":"_sync"}`, expected: `{"a":"_sync"}`},
+		{input: `{}`, expected: `{}`},
+	}
+	for _, test := range tests {
+		output, err := RemoveJSONProperty([]byte(test.input), "_sync")
+		require.NoError(t, err)
+		assert.Equal(t, test.expected, string(output))
+	}
+
+	_, err := RemoveJSONProperty([]byte(`[1]`), "_sync")
+	assert.Error(t, err)
+	_, err = RemoveJSONProperty([]byte(`{"a":`), "_sync")
+	assert.Error(t, err)
+}
+
 func TestInjectJSONPropertiesMutable(t *testing.T) {
 	origBytes := []byte(`{"orig":true}`)
 
@@ -111,6 +111,18 @@ func GetTestBucketDefaultCollection(t testing.TB) *TestBucket {
 	return getTestBucket(t, tbpCollectionDefault)
 }
 
+// GetTestBucketIsolatedCollection returns a TestBucket for a new collection in a bucket shared with other tests, which
+// is dropped when the TestBucket is closed.  Returns a whole TestBucket from the pool when using Walrus, or when the
+// server doesn't support collections.
+func GetTestBucketIsolatedCollection(t testing.TB) *TestBucket {
+	bucket, spec, closeFn := GTestBucketPool.getIsolatedCollectionAndSpec(t)
+	return &TestBucket{
+		Bucket:     bucket,
+		BucketSpec: spec,
+		closeFn:    closeFn,
+	}
+}
+
 // getTestBucket returns a bucket from the bucket pool
 func getTestBucket(t testing.TB, collectionType tbpCollectionType) *TestBucket {
 	bucket, spec, closeFn := GTestBucketPool.getTestBucketAndSpec(t, collectionType)
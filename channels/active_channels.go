@@ -12,6 +12,7 @@ package channels
 
 import (
 	"context"
+	"sort"
 	"sync"
 
 	"github.com/couchbase/sync_gateway/base"
@@ -76,6 +77,29 @@ func (ac *ActiveChannels) IsActive(channelName string) bool {
 	return ok
 }
 
+// TopChannels returns up to n active channels, ordered by descending number of active pull replications.
+func (ac *ActiveChannels) TopChannels(n int) []string {
+	ac.lock.RLock()
+	channelNames := make([]string, 0, len(ac.channelCounts))
+	counts := make(map[string]uint64, len(ac.channelCounts))
+	for channelName, count := range ac.channelCounts {
+		channelNames = append(channelNames, channelName)
+		counts[channelName] = count
+	}
+	ac.lock.RUnlock()
+
+	sort.Slice(channelNames, func(i, j int) bool {
+		if counts[channelNames[i]] != counts[channelNames[j]] {
+			return counts[channelNames[i]] > counts[channelNames[j]]
+		}
+		return channelNames[i] < channelNames[j]
+	})
+	if len(channelNames) > n {
+		channelNames = channelNames[:n]
+	}
+	return channelNames
+}
+
 func (ac *ActiveChannels) IncrChannel(channelName string) {
 	ac.lock.Lock()
 	ac._incr(channelName)
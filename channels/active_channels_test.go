@@ -60,3 +60,22 @@ func TestActiveChannelsConcurrency(t *testing.T) {
 	assert.Equal(t, int64(3), activeChannelStat.Value())
 
 }
+
+func TestActiveChannelsTopChannels(t *testing.T) {
+
+	activeChannelStat := &base.SgwIntStat{}
+	ac := NewActiveChannels(activeChannelStat)
+	assert.Len(t, ac.TopChannels(2), 0)
+
+	ac.IncrChannel("ABC")
+	ac.IncrChannel("DEF")
+	ac.IncrChannel("DEF")
+	ac.IncrChannel("GHI")
+	ac.IncrChannel("JKL")
+	ac.IncrChannel("JKL")
+	ac.IncrChannel("JKL")
+
+	assert.Equal(t, []string{"JKL", "DEF"}, ac.TopChannels(2))
+	// Ties are ordered by name
+	assert.Equal(t, []string{"JKL", "DEF", "ABC", "GHI"}, ac.TopChannels(10))
+}
@@ -20,11 +20,13 @@ import (
 
 /** Result of running a channel-mapper function. */
 type ChannelMapperOutput struct {
-	Channels  base.Set  // channels assigned to the document via channel() callback
-	Roles     AccessMap // roles granted to users via role() callback
-	Access    AccessMap // channels granted to users via access() callback
-	Rejection error     // Error associated with failed validate (require callbacks, etc)
-	Expiry    *uint32   // Expiry value specified by expiry() callback.  Standard CBS expiry format: seconds if less than 30 days, epoch time otherwise
+	Channels     base.Set        // channels assigned to the document via channel() callback
+	Roles        AccessMap       // roles granted to users via role() callback
+	RoleCreates  AccessMap       // roles to be created if they don't exist, with their admin channels, via role() callback with {create: true}
+	Access       AccessMap       // channels granted to users via access() callback
+	AccessExpiry AccessExpiryMap // expiry of time-limited channel grants made via access() callback
+	Rejection    error           // Error associated with failed validate (require callbacks, etc)
+	Expiry       *uint32         // Expiry value specified by expiry() callback.  Standard CBS expiry format: seconds if less than 30 days, epoch time otherwise
 }
 
 type ChannelMapper struct {
@@ -34,6 +36,10 @@ type ChannelMapper struct {
 // Maps user names (or role names prefixed with "role:") to arrays of channel or role names
 type AccessMap map[string]base.Set
 
+// Maps user names (or role names prefixed with "role:") to the expiry (unix time in seconds) of each time-limited
+// channel grant, keyed by channel name
+type AccessExpiryMap map[string]map[string]uint32
+
 // Number of SyncRunner tasks (and Otto contexts) to cache
 // Should be larger than sequence_allocator.maxBatchSize, to avoid pool overflow under some load scenarios (CBG-436)
 const kTaskCacheSize = 16
@@ -41,12 +47,50 @@ const kTaskCacheSize = 16
 const DefaultSyncFunction = `function(doc){channel(doc.channels);}`
 
 func NewChannelMapper(fnSource string, timeout time.Duration) *ChannelMapper {
+	return NewChannelMapperWithEngine(base.JSEngineOtto, fnSource, timeout)
+}
+
+// NewChannelMapperWithEngine returns a ChannelMapper that runs the sync function using the given JavaScript engine,
+// either base.JSEngineOtto or base.JSEngineGoja.
+func NewChannelMapperWithEngine(engine string, fnSource string, timeout time.Duration) *ChannelMapper {
+	return NewChannelMapperWithLimits(engine, fnSource, timeout, base.JSLimits{})
+}
+
+// NewChannelMapperWithLimits returns a ChannelMapper like NewChannelMapperWithEngine, that also enforces the given
+// per-invocation resource limits on the sync function by running it in a SandboxSyncRunner.  Limits are only
+// supported by base.JSEngineGoja.
+func NewChannelMapperWithLimits(engine string, fnSource string, timeout time.Duration, limits base.JSLimits) *ChannelMapper {
+	newTask := func(fnSource string, timeout time.Duration) (sgbucket.JSServerTask, error) {
+		return NewSyncRunner(fnSource, timeout)
+	}
+	if engine == base.JSEngineGoja {
+		newTask = func(fnSource string, timeout time.Duration) (sgbucket.JSServerTask, error) {
+			return NewGojaSyncRunner(fnSource, timeout)
+		}
+		if !limits.IsZero() {
+			newTask = func(fnSource string, timeout time.Duration) (sgbucket.JSServerTask, error) {
+				return NewSandboxSyncRunner(fnSource, timeout, limits)
+			}
+		}
+	}
 	return &ChannelMapper{
-		JSServer: sgbucket.NewJSServer(fnSource, timeout, kTaskCacheSize,
-			func(fnSource string, timeout time.Duration) (sgbucket.JSServerTask, error) {
-				return NewSyncRunner(fnSource, timeout)
-			}),
+		JSServer: sgbucket.NewJSServer(fnSource, timeout, kTaskCacheSize, newTask),
+	}
+}
+
+// NewWasmChannelMapper returns a ChannelMapper that runs a sync policy compiled to WebAssembly in place of a
+// JavaScript sync function.  The module must implement the sync policy ABI described alongside WasmSyncRunner.
+func NewWasmChannelMapper(module []byte, timeout time.Duration) (*ChannelMapper, error) {
+	// Fail fast on an invalid module, rather than on the first document write
+	if _, err := NewWasmSyncRunner(module, timeout); err != nil {
+		return nil, err
 	}
+	newTask := func(fnSource string, timeout time.Duration) (sgbucket.JSServerTask, error) {
+		return NewWasmSyncRunner([]byte(fnSource), timeout)
+	}
+	return &ChannelMapper{
+		JSServer: sgbucket.NewJSServer(string(module), timeout, kTaskCacheSize, newTask),
+	}, nil
 }
 
 func NewDefaultChannelMapper() *ChannelMapper {
@@ -10,6 +10,7 @@ package channels
 
 import (
 	"testing"
+	"time"
 
 	"github.com/couchbase/sync_gateway/base"
 	"github.com/robertkrimen/otto"
@@ -72,6 +73,24 @@ func TestAccessFunction(t *testing.T) {
 	assert.Equal(t, AccessMap{"foo": SetOf(t, "bar", "baz")}, res.Access)
 }
 
+// Verify that an expiry passed to access() is recorded as an absolute time, and that an unlimited grant of the same
+// channel takes precedence.
+func TestAccessFunctionWithExpiry(t *testing.T) {
+	mapper := NewChannelMapper(`function(doc) {
+		access("alice", "bar", {expiry: "2030-01-01T00:00:00Z"});
+		access("bob", ["bar", "baz"], {expiry: 3600});
+		access("bob", "baz");
+	}`, 0)
+	res, err := mapper.MapToChannelsAndAccess(parse(`{}`), `{}`, emptyMetaMap(), noUser)
+	require.NoError(t, err, "MapToChannelsAndAccess failed")
+	assert.Equal(t, AccessMap{"alice": SetOf(t, "bar"), "bob": SetOf(t, "bar", "baz")}, res.Access)
+
+	assert.Equal(t, uint32(1893456000), res.AccessExpiry["alice"]["bar"])
+	assert.InDelta(t, time.Now().Add(time.Hour).Unix(), int64(res.AccessExpiry["bob"]["bar"]), 5)
+	_, ok := res.AccessExpiry["bob"]["baz"]
+	assert.False(t, ok, "Unlimited grant should not have an expiry")
+}
+
 // Just verify that the calls to the channel() fn show up in the output channel list.
 func TestSyncFunctionTakesArray(t *testing.T) {
 	mapper := NewChannelMapper(`function(doc) {channel(["foo", "bar ok","baz"])}`, 0)
@@ -169,6 +188,28 @@ func TestRoleFunction(t *testing.T) {
 	assert.Equal(t, AccessMap{"bar": SetOf(t, "froods"), "baz": SetOf(t, "froods"), "foo": SetOf(t, "froods")}, res.Roles)
 }
 
+// Verify that role() creates roles, rather than granting them, when given {create: true} options.
+func TestRoleFunctionCreate(t *testing.T) {
+	for _, engine := range []string{base.JSEngineOtto, base.JSEngineGoja} {
+		t.Run(engine, func(t *testing.T) {
+			mapper := NewChannelMapperWithEngine(engine, `function(doc) {
+				role(["froods", "role:hoopys"], {create: true, admin_channels: ["towels", "guides"]});
+				role("vogons", {create: true});
+				role("ignored", {create: false, admin_channels: "poetry"});
+				role("arthur", "role:froods");
+			}`, 0)
+			res, err := mapper.MapToChannelsAndAccess(parse(`{}`), `{}`, emptyMetaMap(), noUser)
+			require.NoError(t, err, "MapToChannelsAndAccess failed")
+			assert.Equal(t, AccessMap{
+				"froods": SetOf(t, "towels", "guides"),
+				"hoopys": SetOf(t, "towels", "guides"),
+				"vogons": SetOf(t),
+			}, res.RoleCreates)
+			assert.Equal(t, AccessMap{"arthur": SetOf(t, "froods")}, res.Roles)
+		})
+	}
+}
+
 // Now just make sure the input comes through intact
 func TestInputParse(t *testing.T) {
 	mapper := NewChannelMapper(`function(doc) {channel(doc.channel);}`, 0)
@@ -251,7 +292,7 @@ func TestCheckUser(t *testing.T) {
 	var linus = map[string]interface{}{"name": "linus", "channels": []string{}}
 	res, err = mapper.MapToChannelsAndAccess(parse(`{"owner": "sally"}`), `{}`, emptyMetaMap(), linus)
 	assert.NoError(t, err, "MapToChannelsAndAccess failed")
-	assert.Equal(t, base.HTTPErrorf(403, base.SyncFnErrorWrongUser), res.Rejection)
+	assert.Equal(t, forbiddenWithReason(base.SyncFnErrorWrongUser, base.SyncFnRejectionCodeWrongUser, "users", "sally"), res.Rejection)
 
 	res, err = mapper.MapToChannelsAndAccess(parse(`{"owner": "sally"}`), `{}`, emptyMetaMap(), nil)
 	assert.NoError(t, err, "MapToChannelsAndAccess failed")
@@ -271,7 +312,7 @@ func TestCheckUserArray(t *testing.T) {
 	var linus = map[string]interface{}{"name": "linus", "channels": []string{}}
 	res, err = mapper.MapToChannelsAndAccess(parse(`{"owners": ["sally", "joe"]}`), `{}`, emptyMetaMap(), linus)
 	assert.NoError(t, err, "MapToChannelsAndAccess failed")
-	assert.Equal(t, base.HTTPErrorf(403, base.SyncFnErrorWrongUser), res.Rejection)
+	assert.Equal(t, forbiddenWithReason(base.SyncFnErrorWrongUser, base.SyncFnRejectionCodeWrongUser, "users", "sally", "joe"), res.Rejection)
 
 	res, err = mapper.MapToChannelsAndAccess(parse(`{"owners": ["sally"]}`), `{}`, emptyMetaMap(), nil)
 	assert.NoError(t, err, "MapToChannelsAndAccess failed")
@@ -291,7 +332,7 @@ func TestCheckRole(t *testing.T) {
 	var linus = map[string]interface{}{"name": "linus", "roles": []string{"boy", "musician"}}
 	res, err = mapper.MapToChannelsAndAccess(parse(`{"role": "girl"}`), `{}`, emptyMetaMap(), linus)
 	assert.NoError(t, err, "MapToChannelsAndAccess failed")
-	assert.Equal(t, base.HTTPErrorf(403, base.SyncFnErrorMissingRole), res.Rejection)
+	assert.Equal(t, forbiddenWithReason(base.SyncFnErrorMissingRole, base.SyncFnRejectionCodeMissingRole, "roles", "girl"), res.Rejection)
 
 	res, err = mapper.MapToChannelsAndAccess(parse(`{"role": "girl"}`), `{}`, emptyMetaMap(), nil)
 	assert.NoError(t, err, "MapToChannelsAndAccess failed")
@@ -311,7 +352,7 @@ func TestCheckRoleArray(t *testing.T) {
 	var linus = map[string]interface{}{"name": "linus", "roles": map[string]int{"boy": 1, "musician": 1}}
 	res, err = mapper.MapToChannelsAndAccess(parse(`{"roles": ["girl"]}`), `{}`, emptyMetaMap(), linus)
 	assert.NoError(t, err, "MapToChannelsAndAccess failed")
-	assert.Equal(t, base.HTTPErrorf(403, base.SyncFnErrorMissingRole), res.Rejection)
+	assert.Equal(t, forbiddenWithReason(base.SyncFnErrorMissingRole, base.SyncFnRejectionCodeMissingRole, "roles", "girl"), res.Rejection)
 
 	res, err = mapper.MapToChannelsAndAccess(parse(`{"roles": ["girl"]}`), `{}`, emptyMetaMap(), nil)
 	assert.NoError(t, err, "MapToChannelsAndAccess failed")
@@ -331,7 +372,7 @@ func TestCheckAccess(t *testing.T) {
 	var linus = map[string]interface{}{"name": "linus", "roles": []string{"boy", "musician"}, "channels": []string{"party", "school"}}
 	res, err = mapper.MapToChannelsAndAccess(parse(`{"channel": "work"}`), `{}`, emptyMetaMap(), linus)
 	assert.NoError(t, err, "MapToChannelsAndAccess failed")
-	assert.Equal(t, base.HTTPErrorf(403, base.SyncFnErrorMissingChannelAccess), res.Rejection)
+	assert.Equal(t, forbiddenWithReason(base.SyncFnErrorMissingChannelAccess, base.SyncFnRejectionCodeMissingChannelAccess, "channels", "work"), res.Rejection)
 
 	res, err = mapper.MapToChannelsAndAccess(parse(`{"channel": "magic"}`), `{}`, emptyMetaMap(), nil)
 	assert.NoError(t, err, "MapToChannelsAndAccess failed")
@@ -351,7 +392,7 @@ func TestCheckAccessArray(t *testing.T) {
 	var linus = map[string]interface{}{"name": "linus", "roles": []string{"boy", "musician"}, "channels": []string{"party", "school"}}
 	res, err = mapper.MapToChannelsAndAccess(parse(`{"channels": ["work"]}`), `{}`, emptyMetaMap(), linus)
 	assert.NoError(t, err, "MapToChannelsAndAccess failed")
-	assert.Equal(t, base.HTTPErrorf(403, base.SyncFnErrorMissingChannelAccess), res.Rejection)
+	assert.Equal(t, forbiddenWithReason(base.SyncFnErrorMissingChannelAccess, base.SyncFnRejectionCodeMissingChannelAccess, "channels", "work"), res.Rejection)
 
 	res, err = mapper.MapToChannelsAndAccess(parse(`{"channels": ["magic"]}`), `{}`, emptyMetaMap(), nil)
 	assert.NoError(t, err, "MapToChannelsAndAccess failed")
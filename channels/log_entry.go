@@ -41,19 +41,20 @@ const (
 )
 
 type LogEntry struct {
-	Sequence     uint64       // Sequence number
-	DocID        string       // Document ID
-	RevID        string       // Revision ID
-	Flags        uint8        // Deleted/Removed/Hidden flags
-	VbNo         uint16       // vbucket number
-	TimeSaved    time.Time    // Time doc revision was saved (just used for perf metrics)
-	TimeReceived time.Time    // Time received from tap feed
-	Channels     ChannelMap   // Channels this entry is in or was removed from
-	Skipped      bool         // Late arriving entry
-	Type         LogEntryType // Log entry type
-	Value        []byte       // Snapshot metadata (when Type=LogEntryCheckpoint)
-	PrevSequence uint64       // Sequence of previous active revision
-	IsPrincipal  bool         // Whether the log-entry is a tracking entry for a principal doc
+	Sequence      uint64       // Sequence number
+	DocID         string       // Document ID
+	RevID         string       // Revision ID
+	Flags         uint8        // Deleted/Removed/Hidden flags
+	VbNo          uint16       // vbucket number
+	TimeSaved     time.Time    // Time doc revision was saved (just used for perf metrics)
+	TimeReceived  time.Time    // Time received from tap feed
+	Channels      ChannelMap   // Channels this entry is in or was removed from
+	Skipped       bool         // Late arriving entry
+	Type          LogEntryType // Log entry type
+	Value         []byte       // Snapshot metadata (when Type=LogEntryCheckpoint)
+	PrevSequence  uint64       // Sequence of previous active revision
+	IsPrincipal   bool         // Whether the log-entry is a tracking entry for a principal doc
+	ChannelsAdded base.Set     // Channels the doc was added to at this sequence (used for channel stats)
 }
 
 func (l LogEntry) String() string {
@@ -18,6 +18,9 @@ import (
 )
 
 func TestMain(m *testing.M) {
+	// The test binary is run as the sandbox of SandboxSyncRunners
+	RunSyncSandboxIfRequested()
+
 	// can't use defer because of os.Exit
 	teardownFuncs := make([]func(), 0)
 	teardownFuncs = append(teardownFuncs, base.SetUpGlobalTestLogging(m))
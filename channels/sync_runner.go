@@ -59,28 +59,28 @@ const funcWrapper = `
 
 		function requireAdmin() {
 			if (shouldValidate)
-				throw({forbidden: "%s"});
+				throw({forbidden: {message: "%s", code: "%s"}});
 		}
 
 		function requireUser(names) {
 				if (!shouldValidate) return;
 				names = makeArray(names);
 				if (!inArray(realUserCtx.name, names))
-					throw({forbidden: "%s"});
+					throw({forbidden: {message: "%s", code: "%s", details: {users: names}}});
 		}
 
 		function requireRole(roles) {
 				if (!shouldValidate) return;
 				roles = makeArray(roles);
 				if (!anyKeysInArray(realUserCtx.roles, roles))
-					throw({forbidden: "%s"});
+					throw({forbidden: {message: "%s", code: "%s", details: {roles: roles}}});
 		}
 
 		function requireAccess(channels) {
 				if (!shouldValidate) return;
 				channels = makeArray(channels);
 				if (!anyInArray(realUserCtx.channels, channels))
-					throw({forbidden: "%s"});
+					throw({forbidden: {message: "%s", code: "%s", details: {channels: channels}}});
 		}
 
 		return function (newDoc, oldDoc, meta, _realUserCtx) {
@@ -108,12 +108,20 @@ const funcWrapper = `
 
 // An object that runs a specific JS sync() function. Not thread-safe!
 type SyncRunner struct {
-	sgbucket.JSRunner                      // "Superclass"
-	output            *ChannelMapperOutput // Results being accumulated while the JS fn runs
-	channels          []string
-	access            map[string][]string // channels granted to users via access() callback
-	roles             map[string][]string // roles granted to users via role() callback
-	expiry            *uint32             // document expiry (in seconds) specified via expiry() callback
+	sgbucket.JSRunner // "Superclass"
+	syncRunnerState
+}
+
+// The results of the sync function's callbacks, accumulated while the JS fn runs.  Shared by the Otto and goja
+// sync runners.
+type syncRunnerState struct {
+	output       *ChannelMapperOutput // Results being accumulated while the JS fn runs
+	channels     []string
+	access       map[string][]string // channels granted to users via access() callback
+	accessExpiry AccessExpiryMap     // expiry of time-limited channel grants made via access() callback
+	roles        map[string][]string // roles granted to users via role() callback
+	roleCreates  map[string][]string // roles to be created, with their admin channels, via role() callback with {create: true}
+	expiry       *uint32             // document expiry (in seconds) specified via expiry() callback
 }
 
 func NewSyncRunner(funcSource string, timeout time.Duration) (*SyncRunner, error) {
@@ -137,26 +145,45 @@ func NewSyncRunner(funcSource string, timeout time.Duration) (*SyncRunner, error
 		return otto.UndefinedValue()
 	})
 
-	// Implementation of the 'access()' callback:
+	// Implementation of the 'access()' callback.  An optional third argument of the form {expiry: ...} makes the
+	// grant time-limited:
 	runner.DefineNativeFunction("access", func(call otto.FunctionCall) otto.Value {
-		return runner.addValueForUser(call.Argument(0), call.Argument(1), runner.access)
+		grantExpiry, err := ottoValueToGrantExpiry(call.Argument(2))
+		if err != nil {
+			base.WarnfCtx(ctx, "SyncRunner: Ignoring access() call with invalid expiry %v: %v", call.Argument(2), err)
+			return otto.UndefinedValue()
+		}
+		users, values := ottoValueToStringArray(call.Argument(0)), ottoValueToStringArray(call.Argument(1))
+		runner.addAccessExpiry(users, values, grantExpiry)
+		runner.addValueForUser(users, values, runner.access)
+		return otto.UndefinedValue()
 	})
 
-	// Implementation of the 'role()' callback:
+	// Implementation of the 'role()' callback.  If the second argument is an object of the form
+	// {create: true, admin_channels: [...]}, the named roles are created instead of being granted:
 	runner.DefineNativeFunction("role", func(call otto.FunctionCall) otto.Value {
-		return runner.addValueForUser(call.Argument(0), call.Argument(1), runner.roles)
+		if options := call.Argument(1); options.IsObject() && options.Class() != "Array" {
+			exportedOptions, _ := options.Export()
+			runner.addRoleCreate(ctx, ottoValueToStringArray(call.Argument(0)), exportedOptions)
+			return otto.UndefinedValue()
+		}
+		runner.addValueForUser(ottoValueToStringArray(call.Argument(0)), ottoValueToStringArray(call.Argument(1)), runner.roles)
+		return otto.UndefinedValue()
 	})
 
-	// Implementation of the 'reject()' callback:
+	// Implementation of the 'reject()' callback.  The second argument is either a message, or an object of the form
+	// {message: ..., code: ..., details: {...}} giving a machine-readable reason:
 	runner.DefineNativeFunction("reject", func(call otto.FunctionCall) otto.Value {
-		if runner.output.Rejection == nil {
-			if status, err := call.Argument(0).ToInteger(); err == nil && status >= 400 {
-				var message string
-				if len(call.ArgumentList) > 1 {
-					message = call.Argument(1).String()
+		if status, err := call.Argument(0).ToInteger(); err == nil {
+			var reason interface{}
+			if len(call.ArgumentList) > 1 {
+				if reasonArg := call.Argument(1); reasonArg.IsObject() {
+					reason, _ = reasonArg.Export()
+				} else {
+					reason = reasonArg.String()
 				}
-				runner.output.Rejection = base.HTTPErrorf(int(status), message)
 			}
+			runner.reject(status, reason)
 		}
 		return otto.UndefinedValue()
 	})
@@ -171,44 +198,17 @@ func NewSyncRunner(funcSource string, timeout time.Duration) (*SyncRunner, error
 			}
 
 			// Called expiry with null/undefined value - ignore
-			if rawExpiry == nil || call.Argument(0).IsUndefined() {
-				return otto.UndefinedValue()
-			}
-
-			expiry, reflectErr := base.ReflectExpiry(rawExpiry)
-			if reflectErr != nil {
-				base.WarnfCtx(ctx, "SyncRunner: Invalid value passed to expiry().  Value:%+v ", call.Argument(0))
+			if call.Argument(0).IsUndefined() {
 				return otto.UndefinedValue()
 			}
-
-			runner.expiry = expiry
+			runner.setExpiry(ctx, rawExpiry)
 		}
 		return otto.UndefinedValue()
 	})
 
-	runner.Before = func() {
-		runner.output = &ChannelMapperOutput{}
-		runner.channels = []string{}
-		runner.access = map[string][]string{}
-		runner.roles = map[string][]string{}
-		runner.expiry = nil
-	}
+	runner.Before = runner.reset
 	runner.After = func(result otto.Value, err error) (interface{}, error) {
-		output := runner.output
-		runner.output = nil
-		if err == nil {
-			output.Channels, err = SetFromArray(runner.channels, ExpandStar)
-			if err == nil {
-				output.Access, err = compileAccessMap(runner.access, "")
-				if err == nil {
-					output.Roles, err = compileAccessMap(runner.roles, RoleAccessPrefix)
-				}
-			}
-			if runner.expiry != nil {
-				output.Expiry = runner.expiry
-			}
-		}
-		return output, err
+		return runner.compileOutput(err)
 	}
 	return runner, nil
 }
@@ -218,15 +218,187 @@ func (runner *SyncRunner) SetFunction(funcSource string) (bool, error) {
 	return runner.JSRunner.SetFunction(funcSource)
 }
 
+// Resets the state before each run of the sync function
+func (state *syncRunnerState) reset() {
+	state.output = &ChannelMapperOutput{}
+	state.channels = []string{}
+	state.access = map[string][]string{}
+	state.accessExpiry = AccessExpiryMap{}
+	state.roles = map[string][]string{}
+	state.roleCreates = map[string][]string{}
+	state.expiry = nil
+}
+
+// Compiles the accumulated state into the output of the sync function
+func (state *syncRunnerState) compileOutput(err error) (*ChannelMapperOutput, error) {
+	output := state.output
+	state.output = nil
+	if err == nil {
+		output.Channels, err = SetFromArray(state.channels, ExpandStar)
+		if err == nil {
+			output.Access, err = compileAccessMap(state.access, "")
+			output.AccessExpiry = state.accessExpiry.compile()
+			if err == nil {
+				output.Roles, err = compileAccessMap(state.roles, RoleAccessPrefix)
+			}
+			if err == nil && len(state.roleCreates) > 0 {
+				output.RoleCreates, err = compileAccessMap(state.roleCreates, "")
+			}
+		}
+		if state.expiry != nil {
+			output.Expiry = state.expiry
+		}
+	}
+	return output, err
+}
+
 // Common implementation of 'access()' and 'role()' callbacks
-func (runner *SyncRunner) addValueForUser(user otto.Value, value otto.Value, mapping map[string][]string) otto.Value {
-	valueStrings := ottoValueToStringArray(value)
-	if len(valueStrings) > 0 {
-		for _, name := range ottoValueToStringArray(user) {
-			mapping[name] = append(mapping[name], valueStrings...)
+func (state *syncRunnerState) addValueForUser(users []string, values []string, mapping map[string][]string) {
+	if len(values) > 0 {
+		for _, name := range users {
+			mapping[name] = append(mapping[name], values...)
 		}
 	}
-	return otto.UndefinedValue()
+}
+
+// Implementation of the 'role()' callback when given options rather than roles to grant, given the exported options.
+// Role names may optionally have the "role:" prefix.  Options other than {create: true, admin_channels: [...]} are
+// ignored.
+func (state *syncRunnerState) addRoleCreate(ctx context.Context, names []string, options interface{}) {
+	optionsMap, _ := options.(map[string]interface{})
+	if create, _ := optionsMap["create"].(bool); !create {
+		base.WarnfCtx(ctx, "SyncRunner: Ignoring role() call with options that don't specify {create: true}")
+		return
+	}
+	var adminChannels []string
+	if rawChannels, ok := optionsMap["admin_channels"]; ok && rawChannels != nil {
+		var nonStrings []interface{}
+		adminChannels, nonStrings = base.ValueToStringArray(rawChannels)
+		if nonStrings != nil {
+			base.WarnfCtx(ctx, "Channel names must be string values only. Ignoring non-string channels: %s", base.UD(nonStrings))
+		}
+	}
+	for _, name := range names {
+		name = strings.TrimPrefix(name, RoleAccessPrefix)
+		state.roleCreates[name] = append(state.roleCreates[name], adminChannels...)
+	}
+}
+
+// Implementation of the 'reject()' callback, given the exported reason.  Only the first rejection with an error status
+// is recorded.
+func (state *syncRunnerState) reject(status int64, reason interface{}) {
+	if state.output.Rejection == nil && status >= 400 {
+		message, rejection := exportedValueToRejectionReason(reason)
+		state.output.Rejection = &base.HTTPError{Status: int(status), Message: message, Rejection: rejection}
+	}
+}
+
+// Converts the exported reason for a rejection to its message, along with the machine-readable reason if the reason
+// is an object with a code.  Details are normalized to their JSON form, as returned to clients, and are dropped if
+// they can't be represented as JSON.
+func exportedValueToRejectionReason(reason interface{}) (message string, rejection *base.SyncFnRejectionReason) {
+	switch reason := reason.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return reason, nil
+	case map[string]interface{}:
+		message, _ = reason["message"].(string)
+		code, _ := reason["code"].(string)
+		if code == "" {
+			return message, nil
+		}
+		if message == "" {
+			message = code
+		}
+		rejection = &base.SyncFnRejectionReason{Code: code}
+		if details, ok := reason["details"]; ok && details != nil {
+			if detailsJSON, err := base.JSONMarshal(details); err == nil {
+				_ = base.JSONUnmarshal(detailsJSON, &rejection.Details)
+			}
+		}
+		return message, rejection
+	default:
+		return fmt.Sprintf("%v", reason), nil
+	}
+}
+
+// Implementation of the 'expiry()' callback, given the exported expiry value.  Null values are ignored.
+func (state *syncRunnerState) setExpiry(ctx context.Context, rawExpiry interface{}) {
+	if rawExpiry == nil {
+		return
+	}
+	expiry, err := base.ReflectExpiry(rawExpiry)
+	if err != nil {
+		base.WarnfCtx(ctx, "SyncRunner: Invalid value passed to expiry().  Value:%+v ", rawExpiry)
+		return
+	}
+	state.expiry = expiry
+}
+
+// Records the expiry of an 'access()' grant.  A zero expiry marks a grant that never expires, which takes
+// precedence over any time-limited grant of the same channel to the same user.
+func (state *syncRunnerState) addAccessExpiry(users []string, channels []string, expiry uint32) {
+	for _, name := range users {
+		for _, channel := range channels {
+			userExpiry, ok := state.accessExpiry[name]
+			if !ok {
+				userExpiry = map[string]uint32{}
+				state.accessExpiry[name] = userExpiry
+			}
+			channelExpiry := expiry
+			if existing, ok := userExpiry[channel]; ok {
+				channelExpiry = mergeExpiry(existing, expiry)
+			}
+			userExpiry[channel] = channelExpiry
+		}
+	}
+}
+
+// Returns only the time-limited grants, or nil if there are none.
+func (expiryMap AccessExpiryMap) compile() AccessExpiryMap {
+	var result AccessExpiryMap
+	for name, userExpiry := range expiryMap {
+		for channel, expiry := range userExpiry {
+			if expiry == 0 {
+				continue
+			}
+			if result == nil {
+				result = AccessExpiryMap{}
+			}
+			if result[name] == nil {
+				result[name] = map[string]uint32{}
+			}
+			result[name][channel] = expiry
+		}
+	}
+	return result
+}
+
+// Converts the options argument of an 'access()' call to an absolute grant expiry (unix time in seconds).  Expiry values
+// use the same formats as the 'expiry()' callback.  Returns zero if no expiry was specified.
+func ottoValueToGrantExpiry(options otto.Value) (uint32, error) {
+	if !options.IsObject() {
+		return 0, nil
+	}
+	rawExpiry, err := options.Object().Get("expiry")
+	if err != nil || rawExpiry.IsUndefined() || rawExpiry.IsNull() {
+		return 0, err
+	}
+	exportedExpiry, err := rawExpiry.Export()
+	if err != nil {
+		return 0, err
+	}
+	return exportedValueToGrantExpiry(exportedExpiry)
+}
+
+// Converts the exported expiry of an 'access()' grant to an absolute grant expiry (unix time in seconds).
+func exportedValueToGrantExpiry(exportedExpiry interface{}) (uint32, error) {
+	expiry, err := base.ReflectExpiry(exportedExpiry)
+	if err != nil || expiry == nil || *expiry == 0 {
+		return 0, err
+	}
+	return uint32(base.CbsExpiryToTime(*expiry).Unix()), nil
 }
 
 func compileAccessMap(input map[string][]string, prefix string) (AccessMap, error) {
@@ -274,9 +446,9 @@ func wrappedFuncSource(funcSource string) string {
 	return fmt.Sprintf(
 		funcWrapper,
 		funcSource,
-		base.SyncFnErrorAdminRequired,
-		base.SyncFnErrorWrongUser,
-		base.SyncFnErrorMissingRole,
-		base.SyncFnErrorMissingChannelAccess,
+		base.SyncFnErrorAdminRequired, base.SyncFnRejectionCodeAdminRequired,
+		base.SyncFnErrorWrongUser, base.SyncFnRejectionCodeWrongUser,
+		base.SyncFnErrorMissingRole, base.SyncFnRejectionCodeMissingRole,
+		base.SyncFnErrorMissingChannelAccess, base.SyncFnRejectionCodeMissingChannelAccess,
 	)
 }
@@ -0,0 +1,132 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package channels
+
+import (
+	"context"
+	"time"
+
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/dop251/goja"
+)
+
+// An object that runs a specific JS sync() function using the goja engine, which supports ES2020 syntax.  The
+// callbacks behave the same as those of SyncRunner.  Not thread-safe!
+type GojaSyncRunner struct {
+	base.GojaRunner // "Superclass"
+	syncRunnerState
+}
+
+func NewGojaSyncRunner(funcSource string, timeout time.Duration) (*GojaSyncRunner, error) {
+	ctx := context.Background()
+	return newGojaSyncRunnerWithLogging(funcSource, timeout,
+		func(s string) { base.ErrorfCtx(ctx, base.KeyJavascript.String()+": Sync %s", base.UD(s)) },
+		func(s string) { base.InfofCtx(ctx, base.KeyJavascript, "Sync %s", base.UD(s)) })
+}
+
+// newGojaSyncRunnerWithLogging creates a GojaSyncRunner that passes calls to console.error and console.log to the
+// given functions.
+func newGojaSyncRunnerWithLogging(funcSource string, timeout time.Duration, consoleErrorFunc func(string), consoleLogFunc func(string)) (*GojaSyncRunner, error) {
+	ctx := context.Background()
+	runner := &GojaSyncRunner{}
+	err := runner.InitWithLogging(wrappedFuncSource(funcSource), timeout, consoleErrorFunc, consoleLogFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	// Implementation of the 'channel()' callback:
+	runner.DefineNativeFunction("channel", func(call goja.FunctionCall) goja.Value {
+		for _, arg := range call.Arguments {
+			if strings := gojaValueToStringArray(arg); strings != nil {
+				runner.channels = append(runner.channels, strings...)
+			}
+		}
+		return goja.Undefined()
+	})
+
+	// Implementation of the 'access()' callback.  An optional third argument of the form {expiry: ...} makes the
+	// grant time-limited:
+	runner.DefineNativeFunction("access", func(call goja.FunctionCall) goja.Value {
+		grantExpiry, err := gojaValueToGrantExpiry(call.Argument(2))
+		if err != nil {
+			base.WarnfCtx(ctx, "SyncRunner: Ignoring access() call with invalid expiry %v: %v", call.Argument(2), err)
+			return goja.Undefined()
+		}
+		users, values := gojaValueToStringArray(call.Argument(0)), gojaValueToStringArray(call.Argument(1))
+		runner.addAccessExpiry(users, values, grantExpiry)
+		runner.addValueForUser(users, values, runner.access)
+		return goja.Undefined()
+	})
+
+	// Implementation of the 'role()' callback.  If the second argument is an object of the form
+	// {create: true, admin_channels: [...]}, the named roles are created instead of being granted:
+	runner.DefineNativeFunction("role", func(call goja.FunctionCall) goja.Value {
+		if options, ok := call.Argument(1).(*goja.Object); ok && options.ClassName() != "Array" {
+			runner.addRoleCreate(ctx, gojaValueToStringArray(call.Argument(0)), options.Export())
+			return goja.Undefined()
+		}
+		runner.addValueForUser(gojaValueToStringArray(call.Argument(0)), gojaValueToStringArray(call.Argument(1)), runner.roles)
+		return goja.Undefined()
+	})
+
+	// Implementation of the 'reject()' callback.  The second argument is either a message, or an object of the form
+	// {message: ..., code: ..., details: {...}} giving a machine-readable reason:
+	runner.DefineNativeFunction("reject", func(call goja.FunctionCall) goja.Value {
+		var reason interface{}
+		if len(call.Arguments) > 1 {
+			if reasonArg, ok := call.Argument(1).(*goja.Object); ok {
+				reason = reasonArg.Export()
+			} else {
+				reason = call.Argument(1).String()
+			}
+		}
+		runner.reject(call.Argument(0).ToInteger(), reason)
+		return goja.Undefined()
+	})
+
+	// Implementation of the 'expiry()' callback:
+	runner.DefineNativeFunction("expiry", func(call goja.FunctionCall) goja.Value {
+		runner.setExpiry(ctx, call.Argument(0).Export())
+		return goja.Undefined()
+	})
+
+	runner.Before = runner.reset
+	runner.After = func(result goja.Value, err error) (interface{}, error) {
+		return runner.compileOutput(err)
+	}
+	return runner, nil
+}
+
+func (runner *GojaSyncRunner) SetFunction(funcSource string) (bool, error) {
+	return runner.GojaRunner.SetFunction(wrappedFuncSource(funcSource))
+}
+
+// Converts the options argument of an 'access()' call to an absolute grant expiry (unix time in seconds).  Returns
+// zero if no expiry was specified.
+func gojaValueToGrantExpiry(options goja.Value) (uint32, error) {
+	optionsObject, ok := options.(*goja.Object)
+	if !ok {
+		return 0, nil
+	}
+	rawExpiry := optionsObject.Get("expiry")
+	if rawExpiry == nil || goja.IsUndefined(rawExpiry) || goja.IsNull(rawExpiry) {
+		return 0, nil
+	}
+	return exportedValueToGrantExpiry(rawExpiry.Export())
+}
+
+// Converts a JS string or array into a Go string array.
+func gojaValueToStringArray(value goja.Value) []string {
+	result, nonStrings := base.ValueToStringArray(value.Export())
+
+	if !goja.IsNull(value) && !goja.IsUndefined(value) && nonStrings != nil {
+		base.WarnfCtx(context.Background(), "Channel names must be string values only. Ignoring non-string channels: %s", base.UD(nonStrings))
+	}
+	return result
+}
@@ -0,0 +1,123 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package channels
+
+import (
+	"testing"
+	"time"
+
+	sgbucket "github.com/couchbase/sg-bucket"
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Verify that the goja engine supports ES2020 syntax in the sync function.
+func TestGojaSyncFunctionES2020(t *testing.T) {
+	mapper := NewChannelMapperWithEngine(base.JSEngineGoja, `(doc, oldDoc) => {
+		const owner = doc.owner?.name ?? "nobody";
+		let channels = [...(doc.channels ?? []), `+"`user-${owner}`"+`];
+		channel(channels.map((name) => name.toLowerCase()));
+		access(owner, `+"`user-${owner}`"+`, {expiry: 3600});
+		role(owner, "role:editor");
+		expiry(oldDoc?.ttl ?? 60);
+	}`, 0)
+	res, err := mapper.MapToChannelsAndAccess(parse(`{"owner": {"name": "alice"}, "channels": ["A", "B"]}`), `{"ttl": 120}`, emptyMetaMap(), noUser)
+	require.NoError(t, err, "MapToChannelsAndAccess failed")
+	assert.Equal(t, SetOf(t, "a", "b", "user-alice"), res.Channels)
+	assert.Equal(t, AccessMap{"alice": SetOf(t, "user-alice")}, res.Access)
+	assert.InDelta(t, time.Now().Add(time.Hour).Unix(), int64(res.AccessExpiry["alice"]["user-alice"]), 5)
+	assert.Equal(t, AccessMap{"alice": SetOf(t, "editor")}, res.Roles)
+	require.NotNil(t, res.Expiry)
+	assert.Equal(t, uint32(120), *res.Expiry)
+
+	res, err = mapper.MapToChannelsAndAccess(parse(`{}`), ``, emptyMetaMap(), noUser)
+	require.NoError(t, err, "MapToChannelsAndAccess failed")
+	assert.Equal(t, SetOf(t, "user-nobody"), res.Channels)
+	require.NotNil(t, res.Expiry)
+	assert.Equal(t, uint32(60), *res.Expiry)
+}
+
+// Verify that functions written for Otto behave the same with the goja engine, including use of underscore.js.
+func TestGojaSyncFunctionCompatibility(t *testing.T) {
+	mapper := NewChannelMapperWithEngine(base.JSEngineGoja, `function(doc, oldDoc) {
+		if (doc.type == "secret") {
+			throw({forbidden: doc.reason || "no secrets"});
+		}
+		requireUser(doc.owner);
+		channel(_.uniq(doc.channels));
+	}`, 0)
+
+	var sally = map[string]interface{}{"name": "sally", "channels": []string{}}
+	res, err := mapper.MapToChannelsAndAccess(parse(`{"owner": "sally", "channels": ["foo", "bar", "foo"]}`), `{}`, emptyMetaMap(), sally)
+	require.NoError(t, err, "MapToChannelsAndAccess failed")
+	assert.Nil(t, res.Rejection)
+	assert.Equal(t, SetOf(t, "foo", "bar"), res.Channels)
+
+	var linus = map[string]interface{}{"name": "linus", "channels": []string{}}
+	res, err = mapper.MapToChannelsAndAccess(parse(`{"owner": "sally", "channels": []}`), `{}`, emptyMetaMap(), linus)
+	require.NoError(t, err, "MapToChannelsAndAccess failed")
+	assert.Equal(t, forbiddenWithReason(base.SyncFnErrorWrongUser, base.SyncFnRejectionCodeWrongUser, "users", "sally"), res.Rejection)
+
+	res, err = mapper.MapToChannelsAndAccess(parse(`{"type": "secret"}`), `{}`, emptyMetaMap(), nil)
+	require.NoError(t, err, "MapToChannelsAndAccess failed")
+	assert.Equal(t, base.HTTPErrorf(403, "no secrets"), res.Rejection)
+
+	res, err = mapper.MapToChannelsAndAccess(parse(`{"type": "secret", "reason": {"code": "secret_doc", "details": {"level": 3}}}`), `{}`, emptyMetaMap(), nil)
+	require.NoError(t, err, "MapToChannelsAndAccess failed")
+	assert.Equal(t, &base.HTTPError{Status: 403, Message: "secret_doc", Rejection: &base.SyncFnRejectionReason{
+		Code:    "secret_doc",
+		Details: map[string]interface{}{"level": float64(3)},
+	}}, res.Rejection)
+
+	// The function can be replaced, as it is when the sync function is updated via the admin API
+	changed, err := mapper.SetFunction(`(doc) => channel("all")`)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	res, err = mapper.MapToChannelsAndAccess(parse(`{}`), `{}`, emptyMetaMap(), noUser)
+	require.NoError(t, err, "MapToChannelsAndAccess failed")
+	assert.Equal(t, SetOf(t, "all"), res.Channels)
+}
+
+// Verify that a sync function running on the goja engine is interrupted once it exceeds its timeout.
+func TestGojaSyncFunctionTimeout(t *testing.T) {
+	mapper := NewChannelMapperWithEngine(base.JSEngineGoja, `function(doc) { while (true) {} }`, 100*time.Millisecond)
+	_, err := mapper.MapToChannelsAndAccess(parse(`{}`), `{}`, emptyMetaMap(), noUser)
+	assert.ErrorIs(t, err, sgbucket.ErrJSTimeout)
+
+	// The runner is still usable after being interrupted
+	_, err = mapper.SetFunction(`function(doc) { channel("foo"); }`)
+	require.NoError(t, err)
+	res, err := mapper.MapToChannelsAndAccess(parse(`{}`), `{}`, emptyMetaMap(), noUser)
+	require.NoError(t, err, "MapToChannelsAndAccess failed")
+	assert.Equal(t, SetOf(t, "foo"), res.Channels)
+}
+
+// Verify that a sync function running on the goja engine is interrupted once it exceeds its CPU time or memory limits,
+// with a distinct error for each.
+func TestGojaSyncFunctionLimits(t *testing.T) {
+	mapper := NewChannelMapperWithLimits(base.JSEngineGoja, `function(doc) { while (true) {} }`, 10*time.Second,
+		base.JSLimits{MaxCPUTime: 100 * time.Millisecond})
+	_, err := mapper.MapToChannelsAndAccess(parse(`{}`), `{}`, emptyMetaMap(), noUser)
+	assert.ErrorIs(t, err, base.ErrJSCPUTimeLimit)
+
+	mapper = NewChannelMapperWithLimits(base.JSEngineGoja, `function(doc) {
+		var chunks = [];
+		while (true) { chunks.push(new Array(1024).fill(chunks.length)); }
+	}`, 10*time.Second, base.JSLimits{MaxMemory: 16 * 1024 * 1024})
+	_, err = mapper.MapToChannelsAndAccess(parse(`{}`), `{}`, emptyMetaMap(), noUser)
+	assert.ErrorIs(t, err, base.ErrJSMemoryLimit)
+
+	// Functions within the limits are unaffected, and the runner is still usable after being interrupted
+	_, err = mapper.SetFunction(`function(doc) { channel(new Array(100).fill("foo")); }`)
+	require.NoError(t, err)
+	res, err := mapper.MapToChannelsAndAccess(parse(`{}`), `{}`, emptyMetaMap(), noUser)
+	require.NoError(t, err, "MapToChannelsAndAccess failed")
+	assert.Equal(t, SetOf(t, "foo"), res.Channels)
+}
@@ -0,0 +1,493 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"runtime/metrics"
+	"strconv"
+	"time"
+
+	sgbucket "github.com/couchbase/sg-bucket"
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/dop251/goja"
+)
+
+// Environment variable set on a sandbox process started by a SandboxSyncRunner, which makes the executable run sync
+// functions for its parent rather than doing what it normally does
+const syncSandboxEnvVar = "SG_SYNC_FUNCTION_SANDBOX"
+
+// Interval at which a sandbox checks the CPU time and memory used by the sync function that's running
+const syncSandboxLimitCheckInterval = time.Millisecond
+
+// Time that a sandbox waits for an interrupted sync function to return before exiting instead, as a function can't be
+// interrupted while it's running native code such as a regular expression match
+const syncSandboxInterruptGracePeriod = 100 * time.Millisecond
+
+// Exit codes of a sandbox that exited because it couldn't interrupt a sync function that exceeded a limit
+const (
+	syncSandboxExitCPUTimeLimit = 3
+	syncSandboxExitMemoryLimit  = 4
+)
+
+// Runtime metric used to measure the memory used by a sync function.  It's process-wide, but the sandbox process
+// doesn't do anything other than run one call of the sync function at a time.
+const syncSandboxHeapMetric = "/memory/classes/heap/objects:bytes"
+
+// Errors returned by a call in a sandbox, that are sent to the SandboxSyncRunner by code so it can return the same
+// error values
+var syncSandboxErrors = map[string]error{
+	"timeout":        sgbucket.ErrJSTimeout,
+	"cpu_time_limit": base.ErrJSCPUTimeLimit,
+	"memory_limit":   base.ErrJSMemoryLimit,
+}
+
+// A call of the sync function, sent by a SandboxSyncRunner to its sandbox as a line of JSON.
+type syncSandboxRequest struct {
+	Function string                 `json:"function,omitempty"` // Replaces the sandbox's sync function if set, along with its timeout and limits
+	Timeout  time.Duration          `json:"timeout,omitempty"`
+	Limits   base.JSLimits          `json:"limits"`
+	Doc      interface{}            `json:"doc"`
+	OldDoc   string                 `json:"old_doc"`
+	Meta     interface{}            `json:"meta"`
+	UserCtx  map[string]interface{} `json:"user_ctx"`
+}
+
+// The result of a call of the sync function, sent back by a sandbox as a line of JSON.
+type syncSandboxResponse struct {
+	Output    *syncSandboxOutput `json:"output,omitempty"`
+	Error     string             `json:"error,omitempty"`
+	ErrorCode string             `json:"error_code,omitempty"` // Key of syncSandboxErrors, if the error is one of them
+	Logs      []syncSandboxLog   `json:"logs,omitempty"`       // Logged by the sync function during the call
+}
+
+// The JSON form of a ChannelMapperOutput.  Fields aren't omitted when empty, so that nil and empty values survive
+// the round trip.
+type syncSandboxOutput struct {
+	Channels     base.Set        `json:"channels"`
+	Roles        AccessMap       `json:"roles"`
+	RoleCreates  AccessMap       `json:"role_creates"`
+	Access       AccessMap       `json:"access"`
+	AccessExpiry AccessExpiryMap `json:"access_expiry"`
+	Rejection    *base.HTTPError `json:"rejection"`
+	Expiry       *uint32         `json:"expiry"`
+}
+
+// A call to console.log or console.error made by the sync function in a sandbox.
+type syncSandboxLog struct {
+	Error   bool   `json:"error,omitempty"`
+	Message string `json:"message"`
+}
+
+// SandboxSyncRunner runs a JavaScript sync function using the goja engine in a sandbox process, so that resource
+// limits can be enforced on each call.  The CPU time and memory used by a call of a function running in-process can't
+// be told apart from the rest of Sync Gateway's, but a sandbox does nothing other than run one call at a time.
+//
+// The sandbox is a copy of the running executable, which must call RunSyncSandboxIfRequested on startup.  It's
+// started by the first call, and replaced if it exits, e.g. after a function that exceeded a limit couldn't be
+// interrupted.  It implements sgbucket.JSServerTask, so it can be pooled by a ChannelMapper's sgbucket.JSServer in
+// place of a GojaSyncRunner.  Not thread-safe!
+type SandboxSyncRunner struct {
+	fnSource string
+	timeout  time.Duration
+	limits   base.JSLimits
+	sandbox  *syncSandboxProcess // nil until the first call, and once the sandbox has exited
+}
+
+// A sandbox process started by a SandboxSyncRunner.
+type syncSandboxProcess struct {
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	encoder  *json.Encoder
+	decoder  *json.Decoder
+	fnSource string // Function last sent to the sandbox
+}
+
+var _ sgbucket.JSServerTask = &SandboxSyncRunner{}
+
+// NewSandboxSyncRunner creates a SandboxSyncRunner for the given function source, that enforces the given limits.
+func NewSandboxSyncRunner(funcSource string, timeout time.Duration, limits base.JSLimits) (*SandboxSyncRunner, error) {
+	runner := &SandboxSyncRunner{timeout: timeout, limits: limits}
+	// Runners are discarded by the JSServer's pool without notice, so stop the sandbox once the runner's unreachable
+	runtime.SetFinalizer(runner, func(runner *SandboxSyncRunner) {
+		_ = runner.stopSandbox()
+	})
+	if _, err := runner.SetFunction(funcSource); err != nil {
+		return nil, err
+	}
+	return runner, nil
+}
+
+// SetFunction sets the function source, unless it's unchanged.  Returns true if the function was changed.  The
+// function is compiled to check that it's valid, but is only sent to the sandbox with the next call.
+func (runner *SandboxSyncRunner) SetFunction(funcSource string) (bool, error) {
+	if runner.fnSource != "" && funcSource == runner.fnSource {
+		return false, nil
+	}
+	// The newline ensures a trailing line comment in the source doesn't swallow the closing parenthesis
+	if _, err := goja.Compile("", "("+wrappedFuncSource(funcSource)+"\n)", false); err != nil {
+		return false, err
+	}
+	runner.fnSource = funcSource
+	return true, nil
+}
+
+// Call calls the function in the sandbox, starting the sandbox if it isn't running.  Takes the same inputs as a
+// SyncRunner.  Returns base.ErrJSCPUTimeLimit or base.ErrJSMemoryLimit if the call exceeds the runner's limits.
+func (runner *SandboxSyncRunner) Call(inputs ...interface{}) (interface{}, error) {
+	if len(inputs) != 4 {
+		return nil, fmt.Errorf("sync function called with %d inputs, expected 4", len(inputs))
+	}
+	oldDoc, _ := inputs[1].(sgbucket.JSONString)
+	userCtx, _ := inputs[3].(map[string]interface{})
+	request := syncSandboxRequest{
+		Doc:     syncSandboxValue(inputs[0]),
+		OldDoc:  string(oldDoc),
+		Meta:    syncSandboxValue(inputs[2]),
+		UserCtx: userCtx,
+	}
+
+	if runner.sandbox == nil {
+		sandbox, err := startSyncSandbox()
+		if err != nil {
+			return nil, err
+		}
+		runner.sandbox = sandbox
+	}
+	if runner.sandbox.fnSource != runner.fnSource {
+		request.Function = runner.fnSource
+		request.Timeout = runner.timeout
+		request.Limits = runner.limits
+	}
+
+	var response syncSandboxResponse
+	err := runner.sandbox.encoder.Encode(&request)
+	if err == nil {
+		err = runner.sandbox.decoder.Decode(&response)
+	}
+	if err != nil {
+		// The sandbox can't be used once a call has failed, so is replaced by the next call
+		return nil, syncSandboxExitError(runner.stopSandbox(), err)
+	}
+
+	ctx := context.Background()
+	for _, log := range response.Logs {
+		if log.Error {
+			base.ErrorfCtx(ctx, base.KeyJavascript.String()+": Sync %s", base.UD(log.Message))
+		} else {
+			base.InfofCtx(ctx, base.KeyJavascript, "Sync %s", base.UD(log.Message))
+		}
+	}
+
+	if response.Error != "" {
+		if err, ok := syncSandboxErrors[response.ErrorCode]; ok {
+			return nil, err
+		}
+		return nil, errors.New(response.Error)
+	}
+	runner.sandbox.fnSource = runner.fnSource
+	if response.Output == nil {
+		return nil, errors.New("sync function sandbox returned no output")
+	}
+	return response.Output.channelMapperOutput(), nil
+}
+
+// A float64 that's marshalled with an exponent, so that ConvertJSONNumbers converts it back to a float64 rather than
+// an integer or json.Number.
+type syncSandboxFloat float64
+
+func (f syncSandboxFloat) MarshalJSON() ([]byte, error) {
+	return strconv.AppendFloat(nil, float64(f), 'e', -1, 64), nil
+}
+
+// syncSandboxValue returns a copy of an input to the sync function, that has the same value once it's been marshalled,
+// unmarshalled and passed to ConvertJSONNumbers by the sandbox.
+func syncSandboxValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case float64:
+		return syncSandboxFloat(value)
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(value))
+		for k, v := range value {
+			copied[k] = syncSandboxValue(v)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(value))
+		for i, v := range value {
+			copied[i] = syncSandboxValue(v)
+		}
+		return copied
+	default:
+		return value
+	}
+}
+
+// startSyncSandbox starts a sandbox process, running a copy of the running executable.
+func startSyncSandbox() (*syncSandboxProcess, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("unable to find executable for sync function sandbox: %w", err)
+	}
+	cmd := exec.Command(executable)
+	cmd.Env = append(os.Environ(), syncSandboxEnvVar+"=true")
+	// Anything the sandbox logs, other than the sync function's console output, goes to Sync Gateway's stderr
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("unable to start sync function sandbox: %w", err)
+	}
+	return &syncSandboxProcess{
+		cmd:     cmd,
+		stdin:   stdin,
+		encoder: json.NewEncoder(stdin),
+		decoder: json.NewDecoder(stdout),
+	}, nil
+}
+
+// stopSandbox kills the sandbox process, if it's running, and returns the error it exited with.  A sandbox that has
+// already exited keeps its exit status.
+func (runner *SandboxSyncRunner) stopSandbox() error {
+	sandbox := runner.sandbox
+	if sandbox == nil {
+		return nil
+	}
+	runner.sandbox = nil
+	_ = sandbox.stdin.Close()
+	_ = sandbox.cmd.Process.Kill()
+	return sandbox.cmd.Wait()
+}
+
+// syncSandboxExitError returns the error for a call that failed because the sandbox exited, given the error it exited
+// with and the error communicating with it.
+func syncSandboxExitError(exitErr error, callErr error) error {
+	var exitError *exec.ExitError
+	if errors.As(exitErr, &exitError) {
+		switch exitError.ExitCode() {
+		case syncSandboxExitCPUTimeLimit:
+			return base.ErrJSCPUTimeLimit
+		case syncSandboxExitMemoryLimit:
+			return base.ErrJSMemoryLimit
+		}
+	}
+	if exitErr != nil {
+		return fmt.Errorf("sync function sandbox exited: %v", exitErr)
+	}
+	return fmt.Errorf("sync function sandbox failed: %w", callErr)
+}
+
+func newSyncSandboxOutput(output *ChannelMapperOutput) *syncSandboxOutput {
+	sandboxOutput := &syncSandboxOutput{
+		Channels:     output.Channels,
+		Roles:        output.Roles,
+		RoleCreates:  output.RoleCreates,
+		Access:       output.Access,
+		AccessExpiry: output.AccessExpiry,
+		Expiry:       output.Expiry,
+	}
+	if output.Rejection != nil {
+		var ok bool
+		if sandboxOutput.Rejection, ok = output.Rejection.(*base.HTTPError); !ok {
+			status, message := base.ErrorAsHTTPStatus(output.Rejection)
+			sandboxOutput.Rejection = &base.HTTPError{Status: status, Message: message}
+		}
+	}
+	return sandboxOutput
+}
+
+func (sandboxOutput *syncSandboxOutput) channelMapperOutput() *ChannelMapperOutput {
+	output := &ChannelMapperOutput{
+		Channels:     sandboxOutput.Channels,
+		Roles:        sandboxOutput.Roles,
+		RoleCreates:  sandboxOutput.RoleCreates,
+		Access:       sandboxOutput.Access,
+		AccessExpiry: sandboxOutput.AccessExpiry,
+		Expiry:       sandboxOutput.Expiry,
+	}
+	// Only set when non-nil, as a nil *base.HTTPError isn't a nil error
+	if sandboxOutput.Rejection != nil {
+		output.Rejection = sandboxOutput.Rejection
+	}
+	return output
+}
+
+// RunSyncSandboxIfRequested runs the process as a sync function sandbox, then exits, if it was started as one by a
+// SandboxSyncRunner.  Otherwise it returns immediately.  Must be called on startup of any executable that can run a
+// SandboxSyncRunner, including test binaries, as the sandbox is a copy of the executable.
+func RunSyncSandboxIfRequested() {
+	if os.Getenv(syncSandboxEnvVar) == "" {
+		return
+	}
+	if err := runSyncSandbox(os.Stdin, os.Stdout); err != nil {
+		base.ErrorfCtx(context.Background(), "Sync function sandbox failed: %v", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// The state of a sandbox process.
+type syncSandbox struct {
+	runner *GojaSyncRunner
+	limits base.JSLimits
+	logs   []syncSandboxLog // Logged by the call that's running
+}
+
+// runSyncSandbox calls the sync function for each request read from input, writing the responses to output, until
+// input is closed.
+func runSyncSandbox(input io.Reader, output io.Writer) error {
+	sandbox := &syncSandbox{}
+	decoder := json.NewDecoder(input)
+	decoder.UseNumber()
+	encoder := json.NewEncoder(output)
+	for {
+		var request syncSandboxRequest
+		if err := decoder.Decode(&request); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if err := encoder.Encode(sandbox.call(&request)); err != nil {
+			return err
+		}
+	}
+}
+
+func (sandbox *syncSandbox) call(request *syncSandboxRequest) *syncSandboxResponse {
+	sandbox.logs = nil
+	output, err := sandbox.callFunction(request)
+	response := &syncSandboxResponse{Logs: sandbox.logs}
+	if err != nil {
+		response.Error = err.Error()
+		for code, codeErr := range syncSandboxErrors {
+			if errors.Is(err, codeErr) {
+				response.ErrorCode = code
+			}
+		}
+		return response
+	}
+	response.Output = newSyncSandboxOutput(output)
+	return response
+}
+
+func (sandbox *syncSandbox) callFunction(request *syncSandboxRequest) (*ChannelMapperOutput, error) {
+	if request.Function != "" {
+		if sandbox.runner == nil {
+			runner, err := newGojaSyncRunnerWithLogging(request.Function, request.Timeout,
+				func(s string) { sandbox.logs = append(sandbox.logs, syncSandboxLog{Error: true, Message: s}) },
+				func(s string) { sandbox.logs = append(sandbox.logs, syncSandboxLog{Message: s}) })
+			if err != nil {
+				return nil, err
+			}
+			sandbox.runner = runner
+		} else if _, err := sandbox.runner.SetFunction(request.Function); err != nil {
+			return nil, err
+		}
+		sandbox.limits = request.Limits
+	}
+	if sandbox.runner == nil {
+		return nil, errors.New("sync function sandbox was called before being given a function")
+	}
+
+	stopWatchdog, err := sandbox.startLimitWatchdog()
+	if err != nil {
+		return nil, err
+	}
+	// Numbers are unmarshalled as json.Number, so are converted the same way as by ChannelMapper
+	result, err := sandbox.runner.Call(ConvertJSONNumbers(request.Doc), sgbucket.JSONString(request.OldDoc),
+		ConvertJSONNumbers(request.Meta), request.UserCtx)
+	stopWatchdog()
+	sandbox.runner.ClearInterrupt()
+	if err != nil {
+		return nil, err
+	}
+	return result.(*ChannelMapperOutput), nil
+}
+
+// startLimitWatchdog starts a goroutine that interrupts the sync function if it exceeds the sandbox's limits, or exits
+// the process if the function doesn't return once interrupted.  Returns a function that stops the goroutine and waits
+// for it to exit.
+func (sandbox *syncSandbox) startLimitWatchdog() (stop func(), err error) {
+	limits := sandbox.limits
+	if limits.IsZero() {
+		return func() {}, nil
+	}
+	cpuTimeStart, err := base.ProcessCPUTime()
+	if err != nil {
+		return nil, fmt.Errorf("unable to measure CPU time of sync function: %w", err)
+	}
+	heapSample := []metrics.Sample{{Name: syncSandboxHeapMetric}}
+	heapStart := readSyncSandboxHeapBytes(heapSample)
+
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		ticker := time.NewTicker(syncSandboxLimitCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			var exceeded error
+			exitCode := 0
+			if limits.MaxCPUTime > 0 {
+				if cpuTime, err := base.ProcessCPUTime(); err == nil && cpuTime-cpuTimeStart > limits.MaxCPUTime {
+					exceeded, exitCode = base.ErrJSCPUTimeLimit, syncSandboxExitCPUTimeLimit
+				}
+			}
+			if limits.MaxMemory > 0 && exceeded == nil {
+				if heap := readSyncSandboxHeapBytes(heapSample); heap > heapStart && heap-heapStart > limits.MaxMemory {
+					exceeded, exitCode = base.ErrJSMemoryLimit, syncSandboxExitMemoryLimit
+				}
+			}
+			if exceeded == nil {
+				continue
+			}
+
+			sandbox.runner.Interrupt(exceeded)
+			select {
+			case <-done:
+			case <-time.After(syncSandboxInterruptGracePeriod):
+				os.Exit(exitCode)
+			}
+			return
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-exited
+	}, nil
+}
+
+func readSyncSandboxHeapBytes(sample []metrics.Sample) uint64 {
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return sample[0].Value.Uint64()
+}
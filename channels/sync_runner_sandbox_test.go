@@ -0,0 +1,124 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package channels
+
+import (
+	"testing"
+	"time"
+
+	sgbucket "github.com/couchbase/sg-bucket"
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Verify that a sync function run in a sandbox has the same output as when it's run in-process.
+func TestSandboxSyncRunnerOutput(t *testing.T) {
+	const syncFn = `function(doc, oldDoc, meta) {
+		if (doc.forbidden) {
+			throw({forbidden: doc.forbidden});
+		}
+		if (doc.owner) {
+			requireUser(doc.owner);
+		}
+		channel(doc.channels);
+		access(doc.grantee, doc.channels);
+		role(doc.grantee, doc.roles);
+		if (doc.newRole) {
+			role(doc.newRole, {create: true, admin_channels: ["admin"]});
+		}
+		if (doc.large) {
+			channel("large-" + (doc.large + 1));
+		}
+		expiry(doc.ttl);
+	}`
+
+	inProcess := NewChannelMapperWithEngine(base.JSEngineGoja, syncFn, time.Minute)
+	sandboxed := NewChannelMapperWithLimits(base.JSEngineGoja, syncFn, time.Minute, base.JSLimits{MaxCPUTime: time.Minute})
+
+	testCases := []struct {
+		name    string
+		doc     string
+		userCtx map[string]interface{}
+	}{
+		{
+			name: "no output",
+			doc:  `{}`,
+		},
+		{
+			name: "channels, grants and expiry",
+			doc:  `{"channels": ["a", "b"], "grantee": "alice", "roles": ["role:editor"], "newRole": "reviewer", "ttl": 120}`,
+		},
+		{
+			name: "large integer",
+			doc:  `{"large": 9007199254740993}`,
+		},
+		{
+			name: "large float",
+			doc:  `{"large": 9007199254740992.0}`,
+		},
+		{
+			name: "rejected",
+			doc:  `{"forbidden": "not allowed"}`,
+		},
+		{
+			name:    "wrong user",
+			doc:     `{"owner": "bob"}`,
+			userCtx: map[string]interface{}{"name": "alice", "channels": []string{}, "roles": []string{}},
+		},
+		{
+			name: "admin",
+			doc:  `{"owner": "bob"}`,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			expected, err := inProcess.MapToChannelsAndAccess(parse(test.doc), `{}`, emptyMetaMap(), test.userCtx)
+			require.NoError(t, err)
+			actual, err := sandboxed.MapToChannelsAndAccess(parse(test.doc), `{}`, emptyMetaMap(), test.userCtx)
+			require.NoError(t, err)
+			assert.Equal(t, expected, actual)
+		})
+	}
+
+	// Errors thrown by the function are returned as errors
+	_, err := sandboxed.SetFunction(`function(doc) { throw new Error("failed"); }`)
+	require.NoError(t, err)
+	_, err = sandboxed.MapToChannelsAndAccess(parse(`{}`), `{}`, emptyMetaMap(), noUser)
+	assert.ErrorContains(t, err, "failed")
+
+	// Functions that don't compile are rejected without reaching the sandbox
+	_, err = sandboxed.SetFunction(`function(doc) { var }`)
+	require.NoError(t, err)
+	_, err = sandboxed.MapToChannelsAndAccess(parse(`{}`), `{}`, emptyMetaMap(), noUser)
+	assert.ErrorContains(t, err, "Unexpected token")
+}
+
+// Verify that a sandbox that times out, or can't interrupt a function that exceeds its limits, returns the same error
+// as an interrupted function, and is replaced by the next call.
+func TestSandboxSyncRunnerUninterruptible(t *testing.T) {
+	runner, err := NewSandboxSyncRunner(`function(doc) { while (true) {} }`, 100*time.Millisecond, base.JSLimits{MaxMemory: 1024 * 1024 * 1024})
+	require.NoError(t, err)
+	_, err = runner.Call(parse(`{}`), sgbucket.JSONString(`{}`), emptyMetaMap(), noUser)
+	assert.ErrorIs(t, err, sgbucket.ErrJSTimeout)
+
+	// Regular expressions that need backtracking are matched in Go, so can't be interrupted
+	runner, err = NewSandboxSyncRunner(`function(doc) { channel(/^(a|a?)+(?=b)/.test("a".repeat(50)) ? "matched" : "unmatched"); }`,
+		0, base.JSLimits{MaxCPUTime: 100 * time.Millisecond})
+	require.NoError(t, err)
+	_, err = runner.Call(parse(`{}`), sgbucket.JSONString(`{}`), emptyMetaMap(), noUser)
+	assert.ErrorIs(t, err, base.ErrJSCPUTimeLimit)
+	assert.Nil(t, runner.sandbox)
+
+	_, err = runner.SetFunction(`function(doc) { channel("foo"); }`)
+	require.NoError(t, err)
+	result, err := runner.Call(parse(`{}`), sgbucket.JSONString(`{}`), emptyMetaMap(), noUser)
+	require.NoError(t, err)
+	assert.Equal(t, SetOf(t, "foo"), result.(*ChannelMapperOutput).Channels)
+}
@@ -29,7 +29,7 @@ func TestRequireUser(t *testing.T) {
 	result, _ = runner.Call(parse(`{}`), parse(`{"_names": ["beta", "gamma"]}`), emptyMetaMap(), parse(`{"name": "beta"}`))
 	assertNotRejected(t, result)
 	result, _ = runner.Call(parse(`{}`), parse(`{"_names": ["delta"]}`), emptyMetaMap(), parse(`{"name": "beta"}`))
-	assertRejected(t, result, base.HTTPErrorf(http.StatusForbidden, base.SyncFnErrorWrongUser))
+	assertRejected(t, result, forbiddenWithReason(base.SyncFnErrorWrongUser, base.SyncFnRejectionCodeWrongUser, "users", "delta"))
 }
 
 func TestRequireRole(t *testing.T) {
@@ -42,7 +42,7 @@ func TestRequireRole(t *testing.T) {
 	result, _ = runner.Call(parse(`{}`), parse(`{"_roles": ["beta", "gamma"]}`), emptyMetaMap(), parse(`{"name": "", "roles": {"beta": ""}}`))
 	assertNotRejected(t, result)
 	result, _ = runner.Call(parse(`{}`), parse(`{"_roles": ["delta"]}`), emptyMetaMap(), parse(`{"name": "", "roles": {"beta":""}}`))
-	assertRejected(t, result, base.HTTPErrorf(http.StatusForbidden, base.SyncFnErrorMissingRole))
+	assertRejected(t, result, forbiddenWithReason(base.SyncFnErrorMissingRole, base.SyncFnRejectionCodeMissingRole, "roles", "delta"))
 }
 
 func TestRequireAccess(t *testing.T) {
@@ -55,7 +55,7 @@ func TestRequireAccess(t *testing.T) {
 	result, _ = runner.Call(parse(`{}`), parse(`{"_access": ["beta", "gamma"]}`), emptyMetaMap(), parse(`{"name": "", "channels": ["beta"]}`))
 	assertNotRejected(t, result)
 	result, _ = runner.Call(parse(`{}`), parse(`{"_access": ["delta"]}`), emptyMetaMap(), parse(`{"name": "", "channels": ["beta"]}`))
-	assertRejected(t, result, base.HTTPErrorf(http.StatusForbidden, base.SyncFnErrorMissingChannelAccess))
+	assertRejected(t, result, forbiddenWithReason(base.SyncFnErrorMissingChannelAccess, base.SyncFnRejectionCodeMissingChannelAccess, "channels", "delta"))
 }
 
 func TestRequireAdmin(t *testing.T) {
@@ -66,14 +66,56 @@ func TestRequireAdmin(t *testing.T) {
 	result, _ = runner.Call(parse(`{}`), parse(`{}`), emptyMetaMap(), parse(`{}`))
 	assertNotRejected(t, result)
 	result, _ = runner.Call(parse(`{}`), parse(`{}`), emptyMetaMap(), parse(`{"name": ""}`))
-	assertRejected(t, result, base.HTTPErrorf(http.StatusForbidden, base.SyncFnErrorAdminRequired))
+	assertRejected(t, result, forbiddenWithReason(base.SyncFnErrorAdminRequired, base.SyncFnRejectionCodeAdminRequired, ""))
 	result, _ = runner.Call(parse(`{}`), parse(`{}`), emptyMetaMap(), parse(`{"name": "GUEST"}`))
-	assertRejected(t, result, base.HTTPErrorf(http.StatusForbidden, base.SyncFnErrorAdminRequired))
+	assertRejected(t, result, forbiddenWithReason(base.SyncFnErrorAdminRequired, base.SyncFnRejectionCodeAdminRequired, ""))
 	result, _ = runner.Call(parse(`{}`), parse(`{}`), emptyMetaMap(), parse(`{"name": "beta"}`))
-	assertRejected(t, result, base.HTTPErrorf(http.StatusForbidden, base.SyncFnErrorAdminRequired))
+	assertRejected(t, result, forbiddenWithReason(base.SyncFnErrorAdminRequired, base.SyncFnRejectionCodeAdminRequired, ""))
+}
+
+// Verify that a sync function can reject a document with its own machine-readable reason.
+func TestRejectWithReason(t *testing.T) {
+	const funcSource = `function(doc, oldDoc) {
+		if (doc.reason == "structured") {
+			throw({forbidden: {message: "not yours", code: "not_owner", details: {owner: doc.owner, count: 2}}});
+		} else if (doc.reason == "code") {
+			throw({unauthorized: {code: "login_required"}});
+		} else if (doc.reason == "no_code") {
+			throw({forbidden: {message: "no code"}});
+		}
+		throw({forbidden: "plain"});
+	}`
+	runner, err := NewSyncRunner(funcSource, 0)
+	require.NoError(t, err)
+	var result interface{}
+	result, _ = runner.Call(parse(`{"reason": "structured", "owner": "alpha"}`), parse(`{}`), emptyMetaMap(), parse(`{"name": "beta"}`))
+	assertRejected(t, result, &base.HTTPError{Status: http.StatusForbidden, Message: "not yours", Rejection: &base.SyncFnRejectionReason{
+		Code:    "not_owner",
+		Details: map[string]interface{}{"owner": "alpha", "count": float64(2)},
+	}})
+	r, ok := result.(*ChannelMapperOutput)
+	require.True(t, ok)
+	assert.Equal(t, "not_owner", base.SyncFnRejectionReasonFromError(r.Rejection).Code)
+
+	result, _ = runner.Call(parse(`{"reason": "code"}`), parse(`{}`), emptyMetaMap(), parse(`{"name": "beta"}`))
+	assertRejected(t, result, &base.HTTPError{Status: http.StatusUnauthorized, Message: "login_required", Rejection: &base.SyncFnRejectionReason{Code: "login_required"}})
+	result, _ = runner.Call(parse(`{"reason": "no_code"}`), parse(`{}`), emptyMetaMap(), parse(`{"name": "beta"}`))
+	assertRejected(t, result, base.HTTPErrorf(http.StatusForbidden, "no code"))
+	result, _ = runner.Call(parse(`{}`), parse(`{}`), emptyMetaMap(), parse(`{"name": "beta"}`))
+	assertRejected(t, result, base.HTTPErrorf(http.StatusForbidden, "plain"))
 }
 
 // Helpers
+
+// forbiddenWithReason returns the rejection made by the require* functions, with the given detail values (if any).
+func forbiddenWithReason(message, code, detailsKey string, detailValues ...interface{}) *base.HTTPError {
+	rejection := &base.SyncFnRejectionReason{Code: code}
+	if detailsKey != "" {
+		rejection.Details = map[string]interface{}{detailsKey: detailValues}
+	}
+	return &base.HTTPError{Status: http.StatusForbidden, Message: message, Rejection: rejection}
+}
+
 func assertRejected(t *testing.T, result interface{}, err *base.HTTPError) {
 	r, ok := result.(*ChannelMapperOutput)
 	assert.True(t, ok)
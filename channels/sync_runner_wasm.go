@@ -0,0 +1,317 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime"
+	"time"
+
+	sgbucket "github.com/couchbase/sg-bucket"
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// The sync policy ABI that WebAssembly modules run by a WasmSyncRunner must implement.  Modules export:
+//
+//   - "memory": the module's linear memory.
+//   - "sg_alloc(size i32) i32": returns the address of size bytes of memory, which the input is written to.
+//   - "sg_free(ptr i32, size i32)": optional, frees memory returned by sg_alloc once the sync policy has returned.
+//   - "sync(ptr i32, len i32)": the sync policy, given the address and length of a JSON object of the form
+//     {"doc": ..., "oldDoc": ..., "meta": ..., "userCtx": ...}.  userCtx is null for writes made via the admin API,
+//     which the policy shouldn't reject for want of access.
+//
+// Modules can import the callbacks of the "sync_gateway" host module, which take the address and length of a JSON
+// argument and behave the same as the JavaScript sync function's callbacks:
+//
+//   - "channel(ptr i32, len i32)": a channel name or array of names.
+//   - "access(ptr i32, len i32)": an object of the form {"users": ..., "channels": ...}.
+//   - "role(ptr i32, len i32)": an object of the form {"users": ..., "roles": ...}, with role names prefixed "role:".
+//   - "expiry(ptr i32, len i32)": the document's expiry, in any format accepted by the JavaScript expiry() callback.
+//   - "reject(status i32, ptr i32, len i32)": rejects the document with the given HTTP status and message.
+//
+// WASI is also provided, for modules built by toolchains that require it, without access to the filesystem.
+const (
+	wasmHostModuleName = "sync_gateway"
+	wasmAllocFuncName  = "sg_alloc"
+	wasmFreeFuncName   = "sg_free"
+	wasmSyncFuncName   = "sync"
+)
+
+// Compiled modules are cached across the runtimes of all WasmSyncRunners, so that each module is only compiled once.
+var wasmCompilationCache = wazero.NewCompilationCache()
+
+// WasmSyncRunner runs a sync policy compiled to WebAssembly, as an alternative to a JavaScript sync function.  It
+// implements sgbucket.JSServerTask, so it can be pooled by a ChannelMapper's sgbucket.JSServer, with the module's
+// binary as the function source.  Not thread-safe!
+type WasmSyncRunner struct {
+	syncRunnerState
+	wasmRuntime wazero.Runtime
+	compiled    wazero.CompiledModule
+	module      api.Module // Instance of compiled - nil if it needs to be instantiated, e.g. after a timeout
+	moduleCount int        // Number of instances created, used to give each a unique name
+	source      string
+	timeout     time.Duration
+}
+
+var _ sgbucket.JSServerTask = &WasmSyncRunner{}
+
+// NewWasmSyncRunner creates a WasmSyncRunner for the given WebAssembly module binary.
+func NewWasmSyncRunner(module []byte, timeout time.Duration) (*WasmSyncRunner, error) {
+	ctx := context.Background()
+	runner := &WasmSyncRunner{timeout: timeout}
+	runner.reset()
+
+	// Closing modules on context cancellation is what allows a runaway module to be interrupted on timeout
+	runner.wasmRuntime = wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithCompilationCache(wasmCompilationCache).
+		WithCloseOnContextDone(true))
+	// Runners are discarded by the JSServer's pool without notice, so release the runtime once it's unreachable
+	runtime.SetFinalizer(runner, func(runner *WasmSyncRunner) {
+		_ = runner.wasmRuntime.Close(context.Background())
+	})
+
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, runner.wasmRuntime); err != nil {
+		return nil, fmt.Errorf("unable to instantiate WASI: %w", err)
+	}
+	if err := runner.instantiateHostModule(ctx); err != nil {
+		return nil, err
+	}
+	if _, err := runner.SetFunction(string(module)); err != nil {
+		return nil, err
+	}
+	return runner, nil
+}
+
+// instantiateHostModule defines the sync_gateway host module, whose callbacks update the state of the runner given by
+// the calling context.
+func (runner *WasmSyncRunner) instantiateHostModule(ctx context.Context) error {
+	_, err := runner.wasmRuntime.NewHostModuleBuilder(wasmHostModuleName).
+		NewFunctionBuilder().WithFunc(wasmChannelCallback).Export("channel").
+		NewFunctionBuilder().WithFunc(wasmAccessCallback).Export("access").
+		NewFunctionBuilder().WithFunc(wasmRoleCallback).Export("role").
+		NewFunctionBuilder().WithFunc(wasmExpiryCallback).Export("expiry").
+		NewFunctionBuilder().WithFunc(wasmRejectCallback).Export("reject").
+		Instantiate(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to instantiate %s host module: %w", wasmHostModuleName, err)
+	}
+	return nil
+}
+
+// Implementation of the 'channel()' callback:
+func wasmChannelCallback(ctx context.Context, m api.Module, ptr, size uint32) {
+	var value interface{}
+	if readWasmJSON(ctx, m, "channel", ptr, size, &value) {
+		state := wasmRunnerStateFromContext(ctx)
+		state.channels = append(state.channels, exportedValueToStringArray(ctx, value)...)
+	}
+}
+
+// Implementation of the 'access()' callback:
+func wasmAccessCallback(ctx context.Context, m api.Module, ptr, size uint32) {
+	var grant struct {
+		Users    interface{} `json:"users"`
+		Channels interface{} `json:"channels"`
+	}
+	if readWasmJSON(ctx, m, "access", ptr, size, &grant) {
+		state := wasmRunnerStateFromContext(ctx)
+		users, values := exportedValueToStringArray(ctx, grant.Users), exportedValueToStringArray(ctx, grant.Channels)
+		state.addAccessExpiry(users, values, 0)
+		state.addValueForUser(users, values, state.access)
+	}
+}
+
+// Implementation of the 'role()' callback:
+func wasmRoleCallback(ctx context.Context, m api.Module, ptr, size uint32) {
+	var grant struct {
+		Users interface{} `json:"users"`
+		Roles interface{} `json:"roles"`
+	}
+	if readWasmJSON(ctx, m, "role", ptr, size, &grant) {
+		state := wasmRunnerStateFromContext(ctx)
+		state.addValueForUser(exportedValueToStringArray(ctx, grant.Users), exportedValueToStringArray(ctx, grant.Roles), state.roles)
+	}
+}
+
+// Implementation of the 'expiry()' callback:
+func wasmExpiryCallback(ctx context.Context, m api.Module, ptr, size uint32) {
+	var expiry interface{}
+	if readWasmJSON(ctx, m, "expiry", ptr, size, &expiry) {
+		wasmRunnerStateFromContext(ctx).setExpiry(ctx, expiry)
+	}
+}
+
+// Implementation of the 'reject()' callback.  The status is signed, so that a negative status is ignored like one
+// that's below 400:
+func wasmRejectCallback(ctx context.Context, m api.Module, status, ptr, size uint32) {
+	message, ok := m.Memory().Read(ptr, size)
+	if !ok {
+		base.WarnfCtx(ctx, "SyncRunner: Ignoring reject() call with out of range message")
+		return
+	}
+	wasmRunnerStateFromContext(ctx).reject(int64(int32(status)), string(message))
+}
+
+type wasmRunnerStateKey struct{}
+
+func wasmRunnerStateFromContext(ctx context.Context) *syncRunnerState {
+	return ctx.Value(wasmRunnerStateKey{}).(*syncRunnerState)
+}
+
+// readWasmJSON unmarshals the JSON argument of a callback from the module's memory.  Returns false, after logging a
+// warning, if it can't be read.
+func readWasmJSON(ctx context.Context, m api.Module, callback string, ptr, size uint32, value interface{}) bool {
+	data, ok := m.Memory().Read(ptr, size)
+	if !ok {
+		base.WarnfCtx(ctx, "SyncRunner: Ignoring %s() call with out of range argument", callback)
+		return false
+	}
+	if err := base.JSONUnmarshal(data, value); err != nil {
+		base.WarnfCtx(ctx, "SyncRunner: Ignoring %s() call with invalid JSON argument: %v", callback, err)
+		return false
+	}
+	return true
+}
+
+// exportedValueToStringArray converts an unmarshalled channel, user or role name, or array of names, to a string array.
+func exportedValueToStringArray(ctx context.Context, value interface{}) []string {
+	result, nonStrings := base.ValueToStringArray(value)
+	if value != nil && nonStrings != nil {
+		base.WarnfCtx(ctx, "Channel names must be string values only. Ignoring non-string channels: %s", base.UD(nonStrings))
+	}
+	return result
+}
+
+// SetFunction compiles the module binary, unless it's unchanged.  Returns true if the module was changed.
+func (runner *WasmSyncRunner) SetFunction(source string) (bool, error) {
+	if runner.compiled != nil && source == runner.source {
+		return false, nil
+	}
+	ctx := context.Background()
+	compiled, err := runner.wasmRuntime.CompileModule(ctx, []byte(source))
+	if err != nil {
+		return false, fmt.Errorf("invalid WebAssembly sync module: %w", err)
+	}
+	exports := compiled.ExportedFunctions()
+	for _, name := range []string{wasmAllocFuncName, wasmSyncFuncName} {
+		if _, ok := exports[name]; !ok {
+			return false, fmt.Errorf("WebAssembly sync module does not export the %q function", name)
+		}
+	}
+
+	runner.closeModule(ctx)
+	if runner.compiled != nil {
+		_ = runner.compiled.Close(ctx)
+	}
+	runner.compiled = compiled
+	runner.source = source
+	if err := runner.instantiateModule(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// instantiateModule creates a new instance of the compiled module.  Any callbacks made while the module initializes
+// are discarded by the next call.
+func (runner *WasmSyncRunner) instantiateModule(ctx context.Context) error {
+	ctx = context.WithValue(ctx, wasmRunnerStateKey{}, &runner.syncRunnerState)
+	runner.moduleCount++
+	module, err := runner.wasmRuntime.InstantiateModule(ctx, runner.compiled,
+		wazero.NewModuleConfig().WithName(fmt.Sprintf("sync-%d", runner.moduleCount)))
+	if err != nil {
+		return fmt.Errorf("unable to instantiate WebAssembly sync module: %w", err)
+	}
+	runner.module = module
+	return nil
+}
+
+func (runner *WasmSyncRunner) closeModule(ctx context.Context) {
+	if runner.module != nil {
+		_ = runner.module.Close(ctx)
+		runner.module = nil
+	}
+}
+
+// Call runs the sync policy with the same inputs as a JavaScript sync function: the doc, the old doc as an
+// sgbucket.JSONString, the meta map and the user context.  Returns sgbucket.ErrJSTimeout if the policy runs for longer
+// than the runner's timeout.
+func (runner *WasmSyncRunner) Call(inputs ...interface{}) (interface{}, error) {
+	ctx := context.Background()
+	if runner.module == nil {
+		if err := runner.instantiateModule(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	input, err := wasmSyncInput(inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	runner.reset()
+	callCtx := context.WithValue(ctx, wasmRunnerStateKey{}, &runner.syncRunnerState)
+	if runner.timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(callCtx, runner.timeout)
+		defer cancel()
+	}
+
+	err = runner.callSync(callCtx, input)
+	if err != nil && callCtx.Err() != nil {
+		// The module has been closed, so will be instantiated again by the next call
+		runner.module = nil
+		err = sgbucket.ErrJSTimeout
+	}
+	return runner.compileOutput(err)
+}
+
+// callSync writes the input to the module's memory and calls its sync function.
+func (runner *WasmSyncRunner) callSync(ctx context.Context, input []byte) error {
+	results, err := runner.module.ExportedFunction(wasmAllocFuncName).Call(ctx, uint64(len(input)))
+	if err != nil {
+		return err
+	}
+	if len(results) != 1 {
+		return errors.New("WebAssembly sync module's sg_alloc function must return an address")
+	}
+	ptr := uint32(results[0])
+	if !runner.module.Memory().Write(ptr, input) {
+		return errors.New("WebAssembly sync module's sg_alloc function returned an out of range address")
+	}
+	if free := runner.module.ExportedFunction(wasmFreeFuncName); free != nil {
+		defer func() {
+			_, _ = free.Call(ctx, uint64(ptr), uint64(len(input)))
+		}()
+	}
+	_, err = runner.module.ExportedFunction(wasmSyncFuncName).Call(ctx, uint64(ptr), uint64(len(input)))
+	return err
+}
+
+// wasmSyncInput marshals the inputs of the sync function to the JSON object passed to the module.
+func wasmSyncInput(inputs []interface{}) ([]byte, error) {
+	if len(inputs) != 4 {
+		return nil, fmt.Errorf("WebAssembly sync module expects 4 inputs, got %d", len(inputs))
+	}
+	oldDoc := json.RawMessage("null")
+	if oldDocJSON, ok := inputs[1].(sgbucket.JSONString); ok && oldDocJSON != "" {
+		oldDoc = json.RawMessage(oldDocJSON)
+	}
+	return base.JSONMarshal(map[string]interface{}{
+		"doc":     inputs[0],
+		"oldDoc":  oldDoc,
+		"meta":    inputs[2],
+		"userCtx": inputs[3],
+	})
+}
@@ -0,0 +1,76 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package channels
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	sgbucket "github.com/couchbase/sg-bucket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// A sync module whose sync function assigns every doc to the "public" channel:
+//
+//	(module
+//	  (import "sync_gateway" "channel" (func $channel (param i32 i32)))
+//	  (memory (export "memory") 1)
+//	  (data (i32.const 0) "[\"public\"]")
+//	  (func (export "sg_alloc") (param i32) (result i32) (i32.const 1024))
+//	  (func (export "sync") (param i32 i32) (call $channel (i32.const 0) (i32.const 10))))
+const wasmPublicChannelModuleHex = "0061736d01000000010b0260027f7f0060017f017f0218010c73796e635f67617465776179076368616e6e656c0000030302" +
+	"01000503010001071c03066d656d6f727902000873675f616c6c6f6300010473796e6300020a100205004180080b08004100" +
+	"410a10000b0b10010041000b0a5b227075626c6963225d"
+
+// The same module, whose sync function loops forever.
+const wasmLoopModuleHex = "0061736d01000000010b0260027f7f0060017f017f0218010c73796e635f67617465776179076368616e6e656c0000030302" +
+	"01000503010001071c03066d656d6f727902000873675f616c6c6f6300010473796e6300020a0f0205004180080b07000340" +
+	"0c000b0b0b10010041000b0a5b227075626c6963225d"
+
+// The same module, without the sync function.
+const wasmMissingSyncModuleHex = "0061736d01000000010b0260027f7f0060017f017f0218010c73796e635f67617465776179076368616e6e656c0000030302" +
+	"01000503010001071502066d656d6f727902000873675f616c6c6f6300010a100205004180080b08004100410a10000b0b10" +
+	"010041000b0a5b227075626c6963225d"
+
+func decodeWasmModule(t *testing.T, moduleHex string) []byte {
+	module, err := hex.DecodeString(moduleHex)
+	require.NoError(t, err)
+	return module
+}
+
+func TestWasmSyncModule(t *testing.T) {
+	mapper, err := NewWasmChannelMapper(decodeWasmModule(t, wasmPublicChannelModuleHex), 0)
+	require.NoError(t, err)
+	res, err := mapper.MapToChannelsAndAccess(parse(`{"channels": "ignored"}`), `{}`, emptyMetaMap(), noUser)
+	require.NoError(t, err, "MapToChannelsAndAccess failed")
+	assert.Equal(t, SetOf(t, "public"), res.Channels)
+	assert.Empty(t, res.Access)
+	assert.Empty(t, res.Roles)
+	assert.Nil(t, res.Rejection)
+}
+
+// Verify that a sync module is interrupted once it exceeds its timeout, and that the mapper is still usable.
+func TestWasmSyncModuleTimeout(t *testing.T) {
+	mapper, err := NewWasmChannelMapper(decodeWasmModule(t, wasmLoopModuleHex), 100*time.Millisecond)
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		_, err = mapper.MapToChannelsAndAccess(parse(`{}`), `{}`, emptyMetaMap(), noUser)
+		assert.ErrorIs(t, err, sgbucket.ErrJSTimeout)
+	}
+}
+
+func TestWasmSyncModuleInvalid(t *testing.T) {
+	_, err := NewWasmChannelMapper([]byte("not a wasm module"), 0)
+	assert.ErrorContains(t, err, "invalid WebAssembly sync module")
+
+	_, err = NewWasmChannelMapper(decodeWasmModule(t, wasmMissingSyncModuleHex), 0)
+	assert.ErrorContains(t, err, `does not export the "sync" function`)
+}
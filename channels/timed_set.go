@@ -13,6 +13,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/couchbase/sync_gateway/base"
 )
@@ -21,6 +22,7 @@ import (
 type VbSequence struct {
 	VbNo     *uint16 `json:"vb,omitempty"`
 	Sequence uint64  `json:"seq"`
+	Expiry   uint32  `json:"exp,omitempty"` // Unix time (seconds) at which a time-limited grant lapses, zero if it never expires
 }
 
 func NewVbSequence(vbNo uint16, sequence uint64) VbSequence {
@@ -40,12 +42,32 @@ func (vbs VbSequence) String() string {
 }
 
 func (vbs VbSequence) Copy() VbSequence {
+	var result VbSequence
 	if vbs.VbNo == nil {
-		return NewVbSimpleSequence(vbs.Sequence)
+		result = NewVbSimpleSequence(vbs.Sequence)
 	} else {
 		vbInt := *vbs.VbNo
-		return NewVbSequence(vbInt, vbs.Sequence)
+		result = NewVbSequence(vbInt, vbs.Sequence)
 	}
+	result.Expiry = vbs.Expiry
+	return result
+}
+
+// IsExpired returns true if the entry carries an expiry that is at or before the given time.
+func (vbs VbSequence) IsExpired(now time.Time) bool {
+	return vbs.Expiry != 0 && int64(vbs.Expiry) <= now.Unix()
+}
+
+// mergeExpiry combines the expiries of two grants of the same channel.  A grant without an expiry
+// outlives any time-limited grant, otherwise the later expiry wins.
+func mergeExpiry(a, b uint32) uint32 {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	if a > b {
+		return a
+	}
+	return b
 }
 
 func (vbs VbSequence) Equals(other VbSequence) bool {
@@ -175,6 +197,7 @@ func (set TimedSet) Add(other TimedSet) bool {
 func (set TimedSet) AddAtSequence(other TimedSet, atSequence uint64) bool {
 	changed := false
 	for ch, vbSeq := range other {
+		existing, existed := set[ch]
 		// If vbucket is present, do a straight replace
 		if vbSeq.VbNo != nil {
 			set[ch] = vbSeq
@@ -187,6 +210,18 @@ func (set TimedSet) AddAtSequence(other TimedSet, atSequence uint64) bool {
 				changed = true
 			}
 		}
+		// Carry over the expiry of time-limited grants, merging with any existing grant of the channel
+		if entry, ok := set[ch]; ok {
+			expiry := vbSeq.Expiry
+			if existed {
+				expiry = mergeExpiry(existing.Expiry, vbSeq.Expiry)
+			}
+			if entry.Expiry != expiry {
+				entry.Expiry = expiry
+				set[ch] = entry
+				changed = true
+			}
+		}
 	}
 	return changed
 }
@@ -211,6 +246,56 @@ func (set TimedSet) UpdateIfPresent(other TimedSet) {
 	}
 }
 
+// UpdateExpiry sets the expiry of each entry to the value found in expiries, clearing the expiry of entries
+// not present in expiries.  Expiries are unix times in seconds.  Returns true if any entry was modified.
+func (set TimedSet) UpdateExpiry(expiries map[string]uint32) bool {
+	changed := false
+	for ch, vbSeq := range set {
+		if expiry := expiries[ch]; vbSeq.Expiry != expiry {
+			vbSeq.Expiry = expiry
+			set[ch] = vbSeq
+			changed = true
+		}
+	}
+	return changed
+}
+
+// HasExpired returns true if any entry in the set has an expiry at or before the given time.
+func (set TimedSet) HasExpired(now time.Time) bool {
+	for _, vbSeq := range set {
+		if vbSeq.IsExpired(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveExpired removes all entries whose expiry is at or before the given time, and returns the
+// names of the removed entries.
+func (set TimedSet) RemoveExpired(now time.Time) (removed []string) {
+	for ch, vbSeq := range set {
+		if vbSeq.IsExpired(now) {
+			delete(set, ch)
+			removed = append(removed, ch)
+		}
+	}
+	return removed
+}
+
+// Expiries returns the expiry of each time-limited entry in the set, keyed by entry name.
+func (set TimedSet) Expiries() map[string]uint32 {
+	var expiries map[string]uint32
+	for ch, vbSeq := range set {
+		if vbSeq.Expiry != 0 {
+			if expiries == nil {
+				expiries = make(map[string]uint32)
+			}
+			expiries[ch] = vbSeq.Expiry
+		}
+	}
+	return expiries
+}
+
 // TimedSetDiff stores the result of TimedSet.CompareKeys
 // Elements present in the set but not in the other are returned with value true
 // Elements present in the other set but not in set are returned with value false
@@ -279,18 +364,20 @@ func (setPtr *TimedSet) UnmarshalJSON(data []byte) error {
 
 func (set TimedSet) MarshalJSON() ([]byte, error) {
 
-	// If no vbuckets are defined, marshal as SequenceOnlySet for backwards compatibility.  Otherwise marshal with vbuckets
-	hasVbucket := false
+	// If no vbuckets or expiries are defined, marshal as SequenceOnlySet for backwards compatibility.  Otherwise marshal
+	// in normal form
+	hasVbucketOrExpiry := false
 	for _, vbSeq := range set {
-		if vbSeq.VbNo != nil {
-			hasVbucket = true
+		if vbSeq.VbNo != nil || vbSeq.Expiry != 0 {
+			hasVbucketOrExpiry = true
 			break
 		}
 	}
-	if hasVbucket {
+	if hasVbucketOrExpiry {
 		// Normal form - unmarshal as map[string]VbSequence.  Need to convert back to simple map[string]VbSequence to avoid
 		// having json.Marshal just call back into this function.
-		// Marshals entries as "ABC":{"vb":5,"seq":1} or "CBS":{"seq":1}, depending on whether VbSequence.VbNo is nil
+		// Marshals entries as "ABC":{"vb":5,"seq":1}, "CBS":{"seq":1} or "XYZ":{"seq":1,"exp":1700000000}, depending on
+		// whether VbSequence.VbNo and VbSequence.Expiry are set
 		var plainMap map[string]VbSequence
 		plainMap = set
 		return base.JSONMarshal(plainMap)
@@ -12,9 +12,11 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/couchbase/sync_gateway/base"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestTimedSetMarshal(t *testing.T) {
@@ -168,3 +170,35 @@ func TestTimedSetCompareKeys(t *testing.T) {
 		})
 	}
 }
+
+func TestTimedSetExpiry(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	set := TimedSetFromString("ABC:1,BBC:2,CBS:3")
+	assert.False(t, set.UpdateExpiry(nil))
+	assert.True(t, set.UpdateExpiry(map[string]uint32{"ABC": 1600000000, "BBC": 1800000000}))
+	assert.Equal(t, map[string]uint32{"ABC": 1600000000, "BBC": 1800000000}, set.Expiries())
+
+	// Expiry forces the normal form when marshalling
+	bytes, err := base.JSONMarshal(TimedSet{"BBC": set["BBC"]})
+	require.NoError(t, err)
+	assert.Equal(t, `{"BBC":{"seq":2,"exp":1800000000}}`, string(bytes))
+	var unmarshalled TimedSet
+	require.NoError(t, base.JSONUnmarshal(bytes, &unmarshalled))
+	assert.Equal(t, uint32(1800000000), unmarshalled["BBC"].Expiry)
+
+	assert.True(t, set.HasExpired(now))
+	assert.Equal(t, []string{"ABC"}, set.RemoveExpired(now))
+	assert.False(t, set.HasExpired(now))
+	assert.True(t, set.Equals(base.SetOf("BBC", "CBS")))
+}
+
+func TestTimedSetAddMergesExpiry(t *testing.T) {
+	set := TimedSet{"ABC": {Sequence: 5, Expiry: 1600000000}, "BBC": {Sequence: 5, Expiry: 1600000000}}
+	other := TimedSet{"ABC": {Sequence: 3, Expiry: 1700000000}, "BBC": {Sequence: 7}, "CBS": {Sequence: 7, Expiry: 1500000000}}
+	assert.True(t, set.Add(other))
+
+	// Earliest sequence wins, latest expiry wins, and an unlimited grant clears the expiry
+	assert.Equal(t, VbSequence{Sequence: 3, Expiry: 1700000000}, set["ABC"])
+	assert.Equal(t, VbSequence{Sequence: 5}, set["BBC"])
+	assert.Equal(t, VbSequence{Sequence: 7, Expiry: 1500000000}, set["CBS"])
+}
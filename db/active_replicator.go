@@ -12,11 +12,13 @@ package db
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"sync"
 
 	"github.com/couchbase/go-blip"
 	"github.com/couchbase/sync_gateway/base"
@@ -27,8 +29,14 @@ type ActiveReplicator struct {
 	ID        string
 	Push      *ActivePushReplicator
 	Pull      *ActivePullReplicator
+	Targets   []*ActiveReplicator // Target replicators for a fan-out replication, used instead of Push/Pull
 	config    *ActiveReplicatorConfig
-	statusKey string // key used when persisting replication status
+	statusKey string          // key used when persisting replication status
+	remote    string          // Redacted remote URL, set for fan-out targets
+	ctx       context.Context // Logging context
+
+	fanOutLock     sync.Mutex // Synchronises completion of a fan-out replication's targets
+	fanOutComplete bool       // Whether onComplete has been invoked since the fan-out targets were last started
 }
 
 // NewActiveReplicator returns a bidirectional active replicator for the given config.
@@ -37,6 +45,15 @@ func NewActiveReplicator(ctx context.Context, config *ActiveReplicatorConfig) *A
 		ID:        config.ID,
 		config:    config,
 		statusKey: replicationStatusKey(config.ID),
+		ctx:       ctx,
+	}
+
+	if len(config.FanOutRemoteDBURLs) > 0 {
+		for _, remoteDBURL := range config.FanOutRemoteDBURLs {
+			ar.Targets = append(ar.Targets, ar.newFanOutTarget(ctx, remoteDBURL))
+		}
+		base.InfofCtx(ctx, base.KeyReplicate, "Created fan-out active replicator ID:%s with %d targets", config.ID, len(ar.Targets))
+		return ar
 	}
 
 	if pushReplication := config.Direction == ActiveReplicatorTypePush || config.Direction == ActiveReplicatorTypePushAndPull; pushReplication {
@@ -59,6 +76,15 @@ func NewActiveReplicator(ctx context.Context, config *ActiveReplicatorConfig) *A
 
 func (ar *ActiveReplicator) Start(ctx context.Context) error {
 
+	if len(ar.Targets) > 0 {
+		ar.fanOutLock.Lock()
+		ar.fanOutComplete = false
+		ar.fanOutLock.Unlock()
+		return ar.forEachTarget(func(target *ActiveReplicator) error {
+			return target.Start(ctx)
+		})
+	}
+
 	if ar.Push == nil && ar.Pull == nil {
 		return fmt.Errorf("Attempted to start activeReplicator for %s with neither Push nor Pull defined", base.UD(ar.ID))
 	}
@@ -86,6 +112,10 @@ func (ar *ActiveReplicator) Start(ctx context.Context) error {
 
 func (ar *ActiveReplicator) Stop() error {
 
+	if len(ar.Targets) > 0 {
+		return ar.forEachTarget((*ActiveReplicator).Stop)
+	}
+
 	if ar.Push == nil && ar.Pull == nil {
 		return fmt.Errorf("Attempted to stop activeReplicator for %s with neither Push nor Pull defined", base.UD(ar.ID))
 	}
@@ -120,6 +150,10 @@ func (ar *ActiveReplicator) Stop() error {
 }
 
 func (ar *ActiveReplicator) Reset() error {
+	if len(ar.Targets) > 0 {
+		return ar.forEachTarget((*ActiveReplicator).Reset)
+	}
+
 	var pushErr error
 	if ar.Push != nil {
 		pushErr = ar.Push.reset()
@@ -164,6 +198,17 @@ func (ar *ActiveReplicator) _onReplicationComplete() {
 
 func (ar *ActiveReplicator) State() (state string, errorMessage string) {
 
+	if len(ar.Targets) > 0 {
+		for _, target := range ar.Targets {
+			targetState, targetErrorMessage := target.State()
+			state = combinedState(state, targetState)
+			if targetErrorMessage != "" {
+				errorMessage = targetErrorMessage
+			}
+		}
+		return state, errorMessage
+	}
+
 	state = ReplicationStateStopped
 	if ar.Push != nil {
 		state, errorMessage = ar.Push.getStateWithErrorMessage()
@@ -182,8 +227,13 @@ func (ar *ActiveReplicator) State() (state string, errorMessage string) {
 
 func (ar *ActiveReplicator) GetStatus() *ReplicationStatus {
 
+	if len(ar.Targets) > 0 {
+		return ar.fanOutStatus()
+	}
+
 	status := &ReplicationStatus{
-		ID: ar.ID,
+		ID:     ar.ID,
+		Remote: ar.remote,
 	}
 	status.Status, status.ErrorMessage = ar.State()
 
@@ -222,22 +272,49 @@ func connect(arc *activeReplicatorCommon, idSuffix string) (blipSender *blip.Sen
 		bsc.sgCanUseDeltas = false
 	}
 
-	blipSender, err = blipSync(*arc.config.RemoteDBURL, blipContext, arc.config.InsecureSkipVerify)
+	// Client certs are loaded on each connect, so that rotated certs are picked up on reconnect.
+	var clientCert *tls.Certificate
+	if arc.config.ClientCertPath != "" {
+		cert, err := tls.LoadX509KeyPair(arc.config.ClientCertPath, arc.config.ClientKeyPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to load replication client certificate: %w", err)
+		}
+		clientCert = &cert
+	}
+
+	blipSender, err = blipSync(*arc.config.RemoteDBURL, blipContext, arc.config.InsecureSkipVerify, clientCert)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	if arc.config.RemoteKeyspace != "" {
+		if err := bsc.initRemoteCollection(blipSender, arc.config.RemoteKeyspace, arc.CheckpointID, arc.config.ActiveDB); err != nil {
+			blipSender.Close()
+			bsc.Close()
+			return nil, nil, err
+		}
+	}
+
 	return blipSender, bsc, nil
 }
 
-// blipSync opens a connection to the target, and returns a blip.Sender to send messages over.
-func blipSync(target url.URL, blipContext *blip.Context, insecureSkipVerify bool) (*blip.Sender, error) {
+// blipSync opens a connection to the target, and returns a blip.Sender to send messages over.  When clientCert is
+// non-nil, it's presented to the remote during the TLS handshake.
+func blipSync(target url.URL, blipContext *blip.Context, insecureSkipVerify bool, clientCert *tls.Certificate) (*blip.Sender, error) {
 	// GET target database endpoint to see if reachable for exit-early/clearer error message
 	req, err := http.NewRequest(http.MethodGet, target.String(), nil)
 	if err != nil {
 		return nil, err
 	}
 	client := base.GetHttpClient(insecureSkipVerify)
+	if clientCert != nil {
+		transport := base.DefaultHTTPTransport()
+		transport.TLSClientConfig = &tls.Config{
+			InsecureSkipVerify: insecureSkipVerify,
+			Certificates:       []tls.Certificate{*clientCert},
+		}
+		client = &http.Client{Transport: transport}
+	}
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
@@ -272,10 +349,16 @@ func blipSync(target url.URL, blipContext *blip.Context, insecureSkipVerify bool
 		HTTPClient: client,
 	}
 
+	// Send the replication's ID as the correlation ID, so that the remote's logs of the replication can be found
+	config.HTTPHeader = http.Header{}
+	if base.ProductVersion != nil {
+		config.HTTPHeader.Set("User-Agent", ClientSyncGateway+"/"+base.ProductVersion.String())
+	}
+	if base.IsValidCorrelationID(blipContext.ID) {
+		config.HTTPHeader.Set(base.CorrelationIDHeader, blipContext.ID)
+	}
 	if basicAuthCreds != nil {
-		config.HTTPHeader = http.Header{
-			"Authorization": []string{"Basic " + base64UserInfo(basicAuthCreds)},
-		}
+		config.HTTPHeader.Set("Authorization", "Basic "+base64UserInfo(basicAuthCreds))
 	}
 
 	return blipContext.DialConfig(&config)
@@ -322,6 +405,10 @@ func combinedState(state1, state2 string) (combinedState string) {
 }
 
 func (ar *ActiveReplicator) purgeCheckpoints() {
+	for _, target := range ar.Targets {
+		target.purgeCheckpoints()
+	}
+
 	if ar.Pull != nil {
 		_ = ar.Pull.reset()
 	}
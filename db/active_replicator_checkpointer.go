@@ -13,6 +13,7 @@ package db
 import (
 	"context"
 	"errors"
+	"net/http"
 	"sort"
 	"strings"
 	"sync"
@@ -51,6 +52,20 @@ type Checkpointer struct {
 
 	stats CheckpointerStats
 
+	// lagStat, when set, is updated with the number of expected sequences pending checkpoint
+	lagStat *base.SgwIntStat
+
+	// beforeCheckpointCallback, when set, is called with the lock held before calculating the sequence to checkpoint, to
+	// collect state for processed sequences (e.g. rejected revisions).  The returned function is called once the lock
+	// has been released, to persist that state before those sequences are checkpointed.
+	beforeCheckpointCallback func() (persist func())
+
+	// checkpointLock serialises checkpoints, as the lock is released while persisting state for a checkpoint
+	checkpointLock sync.Mutex
+
+	// collectionIdx is the collection index used for remote checkpoints, when replicating with a remote keyspace
+	collectionIdx *int
+
 	// closeWg waits for the time-based checkpointer goroutine to finish.
 	closeWg sync.WaitGroup
 }
@@ -79,6 +94,7 @@ func NewCheckpointer(ctx context.Context, clientID string, configHash string, bl
 		ctx:                ctx,
 		stats:              CheckpointerStats{},
 		statusCallback:     statusCallback,
+		collectionIdx:      replicatorConfig.remoteCollectionIdx(),
 	}
 }
 
@@ -203,8 +219,14 @@ func (c *Checkpointer) CheckpointNow() {
 		return
 	}
 
+	c.checkpointLock.Lock()
+	defer c.checkpointLock.Unlock()
+
 	c.lock.Lock()
-	defer c.lock.Unlock()
+	var persist func()
+	if c.beforeCheckpointCallback != nil {
+		persist = c.beforeCheckpointCallback()
+	}
 
 	// Retrieve status after obtaining the lock to ensure
 	status := c.statusCallback(c._calculateSafeProcessedSeq())
@@ -212,17 +234,37 @@ func (c *Checkpointer) CheckpointNow() {
 	base.TracefCtx(c.ctx, base.KeyReplicate, "checkpointer: running")
 
 	seq := c._updateCheckpointLists()
+	if c.lagStat != nil {
+		c.lagStat.Set(int64(len(c.expectedSeqs)))
+	}
+	c.lock.Unlock()
+
+	if persist != nil {
+		persist()
+	}
 	if seq == "" {
 		return
 	}
 
 	base.InfofCtx(c.ctx, base.KeyReplicate, "checkpointer: calculated seq: %v", seq)
+	c.lock.Lock()
 	err := c._setCheckpoints(seq, status)
+	c.lock.Unlock()
 	if err != nil {
 		base.WarnfCtx(c.ctx, "couldn't set checkpoints: %v", err)
 	}
 }
 
+// setCheckpoint persists seq as the checkpointed sequence, for sequences that have been replicated outside of this
+// checkpointer's expected and processed sequence tracking (e.g. by partitioned backfill workers).
+func (c *Checkpointer) setCheckpoint(seq string) error {
+	c.checkpointLock.Lock()
+	defer c.checkpointLock.Unlock()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c._setCheckpoints(seq, c.statusCallback(seq))
+}
+
 // Stats returns a copy of the checkpointer stats. Intended for test use - non-test usage may have
 // performance implications associated with locking
 func (c *Checkpointer) Stats() CheckpointerStats {
@@ -502,13 +544,55 @@ func resetLocalCheckpoint(activeDB *Database, checkpointID string) error {
 	return nil
 }
 
+// rollbackLocalCheckpoint rewrites the local checkpoint to the given sequence, retaining the config hash so that the
+// checkpoint is still valid for the replication.  An empty seq removes the checkpoint.  Sequences later than the
+// existing checkpoint are rejected, as resuming from those would skip changes.
+func rollbackLocalCheckpoint(activeDB *Database, checkpointID string, direction ActiveReplicatorDirection, seq string) error {
+	if seq == "" {
+		return resetLocalCheckpoint(activeDB, checkpointID)
+	}
+
+	targetSeq, err := parseIntegerSequenceID(seq)
+	if err != nil {
+		return base.HTTPErrorf(http.StatusBadRequest, "Invalid sequence %q: %v", seq, err)
+	}
+
+	checkpoint, err := getLocalCheckpoint(activeDB.DatabaseContext, checkpointID)
+	if err != nil {
+		return err
+	}
+	if checkpoint == nil || checkpoint.LastSeq == "" {
+		return base.HTTPErrorf(http.StatusBadRequest, "No checkpointed sequence to roll back for %s", checkpointID)
+	}
+
+	currentSeq, err := parseIntegerSequenceID(checkpoint.LastSeq)
+	if err != nil {
+		return err
+	}
+	if currentSeq.Before(targetSeq) {
+		return base.HTTPErrorf(http.StatusBadRequest, "Sequence %s is later than the checkpointed sequence %s", seq, checkpoint.LastSeq)
+	}
+
+	checkpoint.LastSeq = seq
+	if checkpoint.Status != nil {
+		if direction == ActiveReplicatorTypePush {
+			checkpoint.Status.LastSeqPush = seq
+		} else {
+			checkpoint.Status.LastSeqPull = seq
+		}
+	}
+	_, err = activeDB.putSpecial(DocTypeLocal, CheckpointDocIDPrefix+checkpointID, checkpoint.Rev, checkpoint.AsBody())
+	return err
+}
+
 // getRemoteCheckpoint returns the sequence and rev for the remote checkpoint.
 // if the checkpoint does not exist, returns empty sequence and rev.
 func (c *Checkpointer) getRemoteCheckpoint() (checkpoint *replicationCheckpoint, err error) {
 	base.TracefCtx(c.ctx, base.KeyReplicate, "getRemoteCheckpoint")
 
 	rq := GetSGR2CheckpointRequest{
-		Client: c.clientID,
+		Client:        c.clientID,
+		CollectionIdx: c.collectionIdx,
 	}
 
 	if err := rq.Send(c.blipSender); err != nil {
@@ -533,8 +617,9 @@ func (c *Checkpointer) setRemoteCheckpoint(checkpoint *replicationCheckpoint) (n
 
 	checkpointBody := checkpoint.AsBody()
 	rq := SetSGR2CheckpointRequest{
-		Client:     c.clientID,
-		Checkpoint: checkpoint.AsBody(),
+		Client:        c.clientID,
+		Checkpoint:    checkpoint.AsBody(),
+		CollectionIdx: c.collectionIdx,
 	}
 
 	parentRev, ok := checkpointBody[BodyRev].(string)
@@ -120,6 +120,7 @@ func (a *activeReplicatorCommon) reconnectLoop() {
 		}
 
 		// set lastError, but don't set an error state inside the reconnect loop
+		a.replicationStats.NumReconnects.Add(1)
 		err = a.replicatorConnectFn()
 		a.setLastError(err)
 		a._publishStatus()
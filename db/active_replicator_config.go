@@ -62,8 +62,19 @@ type ActiveReplicatorConfig struct {
 	Continuous bool
 	// RemoteDBURL represents the full Sync Gateway URL, including database path, and basic auth credentials of the target.
 	RemoteDBURL *url.URL
+	// FanOutRemoteDBURLs is set instead of RemoteDBURL for fan-out push replications, and defines the set of targets
+	// replicated to.  Each target is run as an independent replication with its own checkpoints and status.
+	FanOutRemoteDBURLs []*url.URL
 	// RunAs is the user to run the replication under
 	RunAs string
+	// Schedule is the cron expression for a scheduled one-shot replication, run by sgReplicateManager.
+	Schedule string
+	// RemoteKeyspace is the scope.collection on the remote that the active database's collection is replicated with,
+	// when it differs from the remote database's default keyspace.
+	RemoteKeyspace string
+	// BackfillWorkers is the number of parallel workers used to push the changes backlog when a push replication
+	// starts from zero.  Values less than two disable partitioned backfill.
+	BackfillWorkers int
 	// PurgeOnRemoval will purge the document on the active side if we pull a removal from the remote.
 	PurgeOnRemoval bool
 	// ActiveDB is a reference to the active database context.
@@ -90,6 +101,10 @@ type ActiveReplicatorConfig struct {
 	// disabled during replication. TLS certificate verification is enabled by default.
 	InsecureSkipVerify bool
 
+	// ClientCertPath and ClientKeyPath define the TLS client certificate presented to the remote, when set.
+	ClientCertPath string
+	ClientKeyPath  string
+
 	// Callback to be invoked on replication completion
 	onComplete OnCompleteFunc
 
@@ -112,6 +127,13 @@ func (arc *ActiveReplicatorConfig) SetCheckpointPrefix(_ testing.TB, s string) {
 
 type OnCompleteFunc func(replicationID string)
 
+// replicationStatsRemote returns the value of the remote label for replication stats, which excludes any credentials.
+func replicationStatsRemote(remoteDBURL *url.URL) string {
+	remote := *remoteDBURL
+	remote.User = nil
+	return remote.String()
+}
+
 // CheckpointHash returns a deterministic hash of the given config to be used as a checkpoint ID.
 // TODO: Might be a way of caching this value? But need to be sure no config values wil change without clearing the cached hash.
 func (arc ActiveReplicatorConfig) CheckpointHash() (string, error) {
@@ -147,6 +169,12 @@ func (arc ActiveReplicatorConfig) CheckpointHash() (string, error) {
 	if _, err := hash.Write([]byte(arc.RunAs)); err != nil {
 		return "", err
 	}
+	// Only included when set, to retain existing checkpoints for replications without a remote keyspace
+	if arc.RemoteKeyspace != "" {
+		if _, err := hash.Write([]byte(arc.RemoteKeyspace)); err != nil {
+			return "", err
+		}
+	}
 	bucketUUID, err := arc.ActiveDB.Bucket.UUID()
 	if err != nil {
 		return "", err
@@ -200,6 +228,10 @@ func (arc *ActiveReplicatorConfig) Equals(other *ActiveReplicatorConfig) bool {
 		return false
 	}
 
+	if !reflect.DeepEqual(arc.FanOutRemoteDBURLs, other.FanOutRemoteDBURLs) {
+		return false
+	}
+
 	if arc.PurgeOnRemoval != other.PurgeOnRemoval {
 		return false
 	}
@@ -232,5 +264,31 @@ func (arc *ActiveReplicatorConfig) Equals(other *ActiveReplicatorConfig) bool {
 		return false
 	}
 
+	if arc.ClientCertPath != other.ClientCertPath || arc.ClientKeyPath != other.ClientKeyPath {
+		return false
+	}
+
+	if arc.Schedule != other.Schedule {
+		return false
+	}
+
+	if arc.BackfillWorkers != other.BackfillWorkers {
+		return false
+	}
+
+	if arc.RemoteKeyspace != other.RemoteKeyspace {
+		return false
+	}
+
 	return true
 }
+
+// remoteCollectionIdx returns the collection index set on messages sent to the remote.  When replicating with a remote
+// keyspace, the connection's getCollections request contains only that keyspace, at index 0.
+func (arc *ActiveReplicatorConfig) remoteCollectionIdx() *int {
+	if arc.RemoteKeyspace == "" {
+		return nil
+	}
+	collectionIdx := 0
+	return &collectionIdx
+}
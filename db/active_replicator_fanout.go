@@ -0,0 +1,159 @@
+/*
+Copyright 2022-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package db
+
+import (
+	"context"
+	"errors"
+	"net/url"
+
+	"github.com/couchbase/sync_gateway/base"
+)
+
+// A fan-out replication is a push replication defined with multiple remotes.  The ActiveReplicator for a fan-out
+// replication doesn't replicate directly, but manages one target ActiveReplicator per remote.  Targets share the
+// replication ID, but checkpoint and track stats independently, so that a slow or unavailable remote doesn't block
+// replication to the others.
+
+// fanOutTargetKey returns a stable identifier for a fan-out target.  Credentials are excluded from the key, so that
+// existing checkpoints continue to be used when credentials are rotated or the remotes are reordered.
+func fanOutTargetKey(remoteURL *url.URL) string {
+	return base.Sha1HashString(replicationStatsRemote(remoteURL), "")[:16]
+}
+
+// fanOutCheckpointPrefix returns the checkpoint prefix for the target identified by targetKey.
+func fanOutCheckpointPrefix(replicationCheckpointPrefix string, targetKey string) string {
+	return replicationCheckpointPrefix + "target:" + targetKey + ":"
+}
+
+// fanOutStatsKey returns the key used for the target's entry in db.replications stats.
+func fanOutStatsKey(replicationID string, targetKey string) string {
+	return replicationID + ":" + targetKey
+}
+
+// newFanOutTarget returns the active replicator for a single target of the fan-out replication.
+func (ar *ActiveReplicator) newFanOutTarget(ctx context.Context, remoteDBURL *url.URL) *ActiveReplicator {
+	targetKey := fanOutTargetKey(remoteDBURL)
+
+	targetConfig := *ar.config
+	targetConfig.RemoteDBURL = remoteDBURL
+	targetConfig.FanOutRemoteDBURLs = nil
+	targetConfig.checkpointPrefix = fanOutCheckpointPrefix(ar.config.checkpointPrefix, targetKey)
+	if ar.config.ReplicationStatsMap != nil {
+		targetConfig.ReplicationStatsMap = ar.config.ActiveDB.DbStats.DBReplicatorStatsForRemote(fanOutStatsKey(ar.ID, targetKey), ar.ID, replicationStatsRemote(remoteDBURL))
+	}
+	if ar.config.onComplete != nil {
+		targetConfig.onComplete = func(string) {
+			ar._onFanOutTargetComplete()
+		}
+	}
+
+	target := NewActiveReplicator(ctx, &targetConfig)
+	target.remote = base.RedactBasicAuthURLPassword(remoteDBURL.String())
+	return target
+}
+
+// _onFanOutTargetComplete is invoked when a one-shot target completes.  The fan-out replication is complete
+// once all of its targets have either stopped or failed, so that a remote in error doesn't prevent completion.
+// Targets that complete at the same time may each see all targets finished, so onComplete is only invoked by the
+// first.
+func (ar *ActiveReplicator) _onFanOutTargetComplete() {
+	for _, target := range ar.Targets {
+		if state, _ := target.State(); state != ReplicationStateStopped && state != ReplicationStateError {
+			return
+		}
+	}
+	ar.fanOutLock.Lock()
+	alreadyComplete := ar.fanOutComplete
+	ar.fanOutComplete = true
+	ar.fanOutLock.Unlock()
+	if !alreadyComplete {
+		ar.config.onComplete(ar.ID)
+	}
+}
+
+// forEachTarget invokes fn for every fan-out target, returning the first error encountered.  fn is invoked for all
+// targets regardless of errors, so that a single failing remote doesn't prevent start/stop of the others.
+func (ar *ActiveReplicator) forEachTarget(fn func(target *ActiveReplicator) error) error {
+	var firstErr error
+	for _, target := range ar.Targets {
+		if err := fn(target); err != nil {
+			base.WarnfCtx(ar.ctx, "Error for replication %s target %s: %v", base.UD(ar.ID), base.UD(target.remote), err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// fanOutStatus returns the combined status of the fan-out targets.  Counters are aggregated across targets, and the
+// status of each target is included in Targets.
+func (ar *ActiveReplicator) fanOutStatus() *ReplicationStatus {
+	status := &ReplicationStatus{
+		ID: ar.ID,
+	}
+	status.Status, status.ErrorMessage = ar.State()
+	for _, target := range ar.Targets {
+		targetStatus := target.GetStatus()
+		status.PushReplicationStatus.Add(targetStatus.PushReplicationStatus)
+		status.Targets = append(status.Targets, targetStatus)
+	}
+	return status
+}
+
+// LoadFanOutReplicationStatus attempts to load the push checkpoint of each target of a fan-out replication, and
+// constructs the combined status.  Used when the replication isn't running locally.
+func LoadFanOutReplicationStatus(dbContext *DatabaseContext, replicationID string, checkpointPrefix string, remotes []string) (status *ReplicationStatus, err error) {
+
+	status = &ReplicationStatus{
+		ID: replicationID,
+	}
+
+	foundStatus := false
+	for _, remote := range remotes {
+		remoteURL, err := url.Parse(remote)
+		if err != nil {
+			return nil, err
+		}
+		targetStatus := &ReplicationStatus{
+			ID:     replicationID,
+			Remote: base.RedactBasicAuthURLPassword(remote),
+		}
+
+		targetCheckpointID := fanOutCheckpointPrefix(checkpointPrefix, fanOutTargetKey(remoteURL)) + PushCheckpointID(replicationID)
+		pushCheckpoint, _ := getLocalCheckpoint(dbContext, targetCheckpointID)
+		if pushCheckpoint != nil {
+			if pushCheckpoint.Status != nil {
+				foundStatus = true
+				targetStatus.PushReplicationStatus = pushCheckpoint.Status.PushReplicationStatus
+				targetStatus.Status = pushCheckpoint.Status.Status
+				targetStatus.ErrorMessage = pushCheckpoint.Status.ErrorMessage
+				targetStatus.LastSeqPush = pushCheckpoint.Status.LastSeqPush
+			} else {
+				targetStatus.LastSeqPush = pushCheckpoint.LastSeq
+			}
+		}
+
+		status.Status = combinedState(status.Status, targetStatus.Status)
+		if targetStatus.ErrorMessage != "" {
+			status.ErrorMessage = targetStatus.ErrorMessage
+		}
+		status.PushReplicationStatus.Add(targetStatus.PushReplicationStatus)
+		status.Targets = append(status.Targets, targetStatus)
+	}
+
+	if !foundStatus {
+		return nil, errors.New("Replication status not found")
+	}
+
+	return status, nil
+}
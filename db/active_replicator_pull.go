@@ -90,6 +90,7 @@ func (apr *ActivePullReplicator) _connect() error {
 		ActiveOnly:     apr.config.ActiveOnly,
 		clientType:     clientTypeSGR2,
 		Revocations:    apr.config.PurgeOnRemoval,
+		CollectionIdx:  apr.config.remoteCollectionIdx(),
 	}
 
 	if err := subChangesRequest.Send(apr.blipSender); err != nil {
@@ -152,6 +153,7 @@ func (apr *ActivePullReplicator) _initCheckpointer() error {
 	}
 
 	apr.Checkpointer = NewCheckpointer(apr.checkpointerCtx, apr.CheckpointID, checkpointHash, apr.blipSender, apr.config, apr.getPullStatus)
+	apr.Checkpointer.lagStat = apr.replicationStats.CheckpointLag
 
 	var err error
 	apr.initialStatus, err = apr.Checkpointer.fetchCheckpoints()
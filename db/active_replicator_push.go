@@ -15,6 +15,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -25,6 +26,9 @@ import (
 // ActivePushReplicator is a unidirectional push active replicator.
 type ActivePushReplicator struct {
 	*activeReplicatorCommon
+	rejectedRevsLock        sync.Mutex    // Serializes updates to the replication's rejected revisions
+	pendingRejectedRevsLock sync.Mutex    // Guards pendingRejectedRevs
+	pendingRejectedRevs     []RejectedRev // Rejected revisions not yet persisted, flushed on checkpoint
 }
 
 func NewPushReplicator(config *ActiveReplicatorConfig) *ActivePushReplicator {
@@ -90,6 +94,8 @@ func (apr *ActivePushReplicator) _connect() error {
 		db:              apr.config.ActiveDB,
 		collection:      apr.config.ActiveDB,
 		serialNumber:    apr.blipSyncContext.incrementSerialNumber(),
+		collectionIdx:   apr.config.remoteCollectionIdx(),
+		loggingCtx:      apr.blipSyncContext.loggingCtx,
 	}
 
 	seq, err := apr.config.ActiveDB.ParseSequenceID(apr.Checkpointer.lastCheckpointSeq)
@@ -119,25 +125,48 @@ func (apr *ActivePushReplicator) _connect() error {
 		// No special handling for error
 	}
 
+	changesOptions := sendChangesOptions{
+		docIDs:            apr.config.DocIDs,
+		since:             seq,
+		continuous:        apr.config.Continuous,
+		activeOnly:        apr.config.ActiveOnly,
+		batchSize:         int(apr.config.ChangesBatchSize),
+		revocations:       apr.config.PurgeOnRemoval,
+		channels:          channels,
+		clientType:        clientTypeSGR2,
+		ignoreNoConflicts: true, // force the passive side to accept a "changes" message, even in no conflicts mode.
+	}
+
+	// A failure to initialize the backfill falls back to an unpartitioned push, which is safe as the replication's
+	// checkpoint isn't advanced until a backfill completes.
+	backfillPlan, err := apr._initBackfillPlan(seq)
+	if err != nil {
+		base.WarnfCtx(apr.ctx, "Unable to initialize push backfill, continuing without partitioning: %v", err)
+		backfillPlan = nil
+	}
+
 	apr.activeSendChanges.Set(true)
-	go func(s *blip.Sender) {
+	go func(s *blip.Sender, checkpointer *Checkpointer, ctx context.Context) {
 		defer apr.activeSendChanges.Set(false)
-		isComplete := bh.sendChanges(s, &sendChangesOptions{
-			docIDs:            apr.config.DocIDs,
-			since:             seq,
-			continuous:        apr.config.Continuous,
-			activeOnly:        apr.config.ActiveOnly,
-			batchSize:         int(apr.config.ChangesBatchSize),
-			revocations:       apr.config.PurgeOnRemoval,
-			channels:          channels,
-			clientType:        clientTypeSGR2,
-			ignoreNoConflicts: true, // force the passive side to accept a "changes" message, even in no conflicts mode.
-		})
+		if backfillPlan != nil {
+			if err := apr.runBackfill(ctx, s, checkpointer, backfillPlan, changesOptions); err != nil {
+				if ctx.Err() == nil {
+					base.WarnfCtx(apr.ctx, "Push backfill for replication %s failed, will resume on reconnect: %v", apr.config.ID, err)
+					apr.setLastError(err)
+					if err := apr.reconnect(); err != nil {
+						base.ErrorfCtx(apr.ctx, "Failed to reconnect replication: %v", err)
+					}
+				}
+				return
+			}
+			changesOptions.since = SequenceID{Seq: backfillPlan.EndSeq}
+		}
+		isComplete := bh.sendChanges(s, &changesOptions)
 		// On a normal completion, call complete for the replication
 		if isComplete {
 			apr.Complete()
 		}
-	}(apr.blipSender)
+	}(apr.blipSender, apr.Checkpointer, apr.checkpointerCtx)
 
 	apr.setState(ReplicationStateRunning)
 	return nil
@@ -188,6 +217,8 @@ func (apr *ActivePushReplicator) _initCheckpointer() error {
 		return hashErr
 	}
 	apr.Checkpointer = NewCheckpointer(apr.checkpointerCtx, apr.CheckpointID, checkpointHash, apr.blipSender, apr.config, apr.getPushStatus)
+	apr.Checkpointer.lagStat = apr.replicationStats.CheckpointLag
+	apr.Checkpointer.beforeCheckpointCallback = apr.collectRejectedRevs
 
 	var err error
 	apr.initialStatus, err = apr.Checkpointer.fetchCheckpoints()
@@ -243,6 +274,20 @@ func (apr *ActivePushReplicator) reset() error {
 		return err
 	}
 
+	if err := resetRejectedRevs(apr.config.ActiveDB, apr.CheckpointID); err != nil {
+		return err
+	}
+
+	backfillPlan, err := apr.getBackfillPlan()
+	if err != nil {
+		return err
+	}
+	if backfillPlan != nil {
+		if err := apr.resetBackfill(backfillPlan); err != nil {
+			return err
+		}
+	}
+
 	apr.lock.Lock()
 	apr.Checkpointer = nil
 	apr.lock.Unlock()
@@ -257,6 +302,8 @@ func (apr *ActivePushReplicator) registerCheckpointerCallbacks() {
 	apr.blipSyncContext.sgr2PushAddExpectedSeqsCallback = apr.Checkpointer.AddExpectedSeqs
 
 	apr.blipSyncContext.sgr2PushProcessedSeqCallback = apr.Checkpointer.AddProcessedSeq
+
+	apr.blipSyncContext.sgr2PushRejectedRevCallback = apr.recordRejectedRev
 }
 
 // waitForExpectedSequences waits for the pending changes response count
@@ -264,12 +311,18 @@ func (apr *ActivePushReplicator) registerCheckpointerCallbacks() {
 // in-flight changes responses to arrive.
 // Waits up to 10s, polling every 100ms.
 func (apr *ActivePushReplicator) _waitForPendingChangesResponse() error {
+	return waitForPendingChangesResponse(apr.blipSyncContext)
+}
+
+// waitForPendingChangesResponse waits for the pending changes response count on bsc to drain to zero.
+// Waits up to 10s, polling every 100ms.
+func waitForPendingChangesResponse(bsc *BlipSyncContext) error {
 	waitCount := 0
 	for waitCount < 100 {
-		if apr.blipSyncContext == nil {
+		if bsc == nil {
 			return nil
 		}
-		pendingCount := atomic.LoadInt64(&apr.blipSyncContext.changesPendingResponseCount)
+		pendingCount := atomic.LoadInt64(&bsc.changesPendingResponseCount)
 		if pendingCount <= 0 {
 			return nil
 		}
@@ -0,0 +1,324 @@
+/*
+Copyright 2022-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/couchbase/go-blip"
+	"github.com/couchbase/sync_gateway/base"
+)
+
+// A push replication starting from zero can partition the changes backlog into sequence ranges, and push each range
+// over its own connection in parallel.  The plan for the backfill (the end sequence and number of ranges) is
+// persisted as a local doc, and each range is checkpointed independently, so that an interrupted backfill resumes
+// with the same ranges from where each range left off.  Once all ranges are complete, the replication's checkpoint is
+// advanced to the end sequence and the replication continues as a regular push from that point.
+
+// pushBackfillSuffix is appended to the replication's checkpoint ID to identify the backfill plan and range checkpoints.
+const pushBackfillSuffix = ":backfill"
+
+// pushBackfillPlan defines the sequence ranges pushed by a partitioned backfill.
+type pushBackfillPlan struct {
+	ConfigHash string `json:"config_hash"` // Checkpoint hash of the replication config the plan was created for
+	EndSeq     uint64 `json:"end_seq"`     // Last sequence pushed by the backfill
+	Workers    int    `json:"workers"`     // Number of ranges the backfill is partitioned into
+}
+
+// pushBackfillRange is a range of sequences pushed by a single backfill worker.
+type pushBackfillRange struct {
+	start uint64 // exclusive
+	end   uint64 // inclusive
+}
+
+// ranges partitions the sequences (0, EndSeq] into contiguous ranges of equal size, one per worker.
+func (p *pushBackfillPlan) ranges() []pushBackfillRange {
+	workers := uint64(p.Workers)
+	if workers > p.EndSeq {
+		workers = p.EndSeq
+	}
+	if workers == 0 {
+		return nil
+	}
+
+	size := p.EndSeq / workers
+	remainder := p.EndSeq % workers
+	ranges := make([]pushBackfillRange, 0, workers)
+	var start uint64
+	for i := uint64(0); i < workers; i++ {
+		end := start + size
+		if i < remainder {
+			end++
+		}
+		ranges = append(ranges, pushBackfillRange{start: start, end: end})
+		start = end
+	}
+	return ranges
+}
+
+func (apr *ActivePushReplicator) backfillPlanID() string {
+	return apr.CheckpointID + pushBackfillSuffix
+}
+
+func (apr *ActivePushReplicator) backfillRangeCheckpointID(index int) string {
+	return fmt.Sprintf("%s%s:%d", apr.CheckpointID, pushBackfillSuffix, index)
+}
+
+// getBackfillPlan returns the persisted backfill plan for the replication, or nil if none exists.
+func (apr *ActivePushReplicator) getBackfillPlan() (*pushBackfillPlan, error) {
+	activeDB := apr.config.ActiveDB
+	planBytes, err := activeDB.GetSpecialBytes(DocTypeLocal, CheckpointDocIDPrefix+apr.backfillPlanID())
+	if err != nil {
+		if base.IsKeyNotFoundError(activeDB.Bucket, err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var plan pushBackfillPlan
+	if err := base.JSONUnmarshal(planBytes, &plan); err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// _initBackfillPlan returns the plan for a partitioned backfill when one should be run on connect, either by resuming
+// an existing plan or creating a new one when replicating from zero.  Returns nil when the replication should push
+// without partitioning.
+func (apr *ActivePushReplicator) _initBackfillPlan(since SequenceID) (*pushBackfillPlan, error) {
+	if apr.config.BackfillWorkers < 2 || len(apr.config.DocIDs) > 0 {
+		return nil, nil
+	}
+
+	configHash, err := apr.config.CheckpointHash()
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := apr.getBackfillPlan()
+	if err != nil {
+		return nil, err
+	}
+	if plan != nil {
+		// A checkpoint at or beyond the end of the backfill means the plan outlived a completed backfill.
+		if plan.ConfigHash == configHash && since.Seq < plan.EndSeq {
+			base.InfofCtx(apr.ctx, base.KeyReplicate, "Resuming push backfill of sequences up to %d", plan.EndSeq)
+			return plan, nil
+		}
+		if err := apr.removeBackfill(plan, apr.blipSender); err != nil {
+			return nil, err
+		}
+	}
+
+	if since.Seq > 0 {
+		return nil, nil
+	}
+
+	endSeq, err := apr.config.ActiveDB.LastSequence()
+	if err != nil {
+		return nil, err
+	}
+	plan = &pushBackfillPlan{
+		ConfigHash: configHash,
+		EndSeq:     endSeq,
+		Workers:    apr.config.BackfillWorkers,
+	}
+	if len(plan.ranges()) < 2 {
+		return nil, nil
+	}
+
+	_, err = apr.config.ActiveDB.putSpecial(DocTypeLocal, CheckpointDocIDPrefix+apr.backfillPlanID(), "", Body{
+		"config_hash": plan.ConfigHash,
+		"end_seq":     plan.EndSeq,
+		"workers":     plan.Workers,
+	})
+	if err != nil {
+		return nil, err
+	}
+	base.InfofCtx(apr.ctx, base.KeyReplicate, "Starting push backfill of sequences up to %d with %d workers", plan.EndSeq, plan.Workers)
+	return plan, nil
+}
+
+// removeBackfill removes the plan and the local and remote range checkpoints for a backfill.  Remote range checkpoints
+// are removed over sender on a best-effort basis, as they're rolled back to the local checkpoint if reused.
+func (apr *ActivePushReplicator) removeBackfill(plan *pushBackfillPlan, sender *blip.Sender) error {
+	for i := range plan.ranges() {
+		if err := resetLocalCheckpoint(apr.config.ActiveDB, apr.backfillRangeCheckpointID(i)); err != nil {
+			return err
+		}
+		if err := apr.removeRemoteBackfillCheckpoint(sender, i); err != nil {
+			base.InfofCtx(apr.ctx, base.KeyReplicate, "Unable to remove remote checkpoint for push backfill range %d: %v", i, err)
+		}
+	}
+	return resetLocalCheckpoint(apr.config.ActiveDB, apr.backfillPlanID())
+}
+
+// resetBackfill removes the local range checkpoints for a backfill, so that each range is pushed again from its
+// start.  The plan is retained so that the remote range checkpoints are removed once a connection is available, when
+// the backfill completes or is discarded.
+func (apr *ActivePushReplicator) resetBackfill(plan *pushBackfillPlan) error {
+	for i := range plan.ranges() {
+		if err := resetLocalCheckpoint(apr.config.ActiveDB, apr.backfillRangeCheckpointID(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeRemoteBackfillCheckpoint removes the remote checkpoint for the backfill range with the given index.
+func (apr *ActivePushReplicator) removeRemoteBackfillCheckpoint(sender *blip.Sender, index int) error {
+	if sender == nil {
+		return nil
+	}
+
+	getRq := GetSGR2CheckpointRequest{
+		Client:        apr.backfillRangeCheckpointID(index),
+		CollectionIdx: apr.config.remoteCollectionIdx(),
+	}
+	if err := getRq.Send(sender); err != nil {
+		return err
+	}
+	resp, err := getRq.Response()
+	if err != nil || resp == nil {
+		return err
+	}
+
+	setRq := SetSGR2CheckpointRequest{
+		Client:        apr.backfillRangeCheckpointID(index),
+		RevID:         &resp.RevID,
+		Checkpoint:    Body{},
+		CollectionIdx: apr.config.remoteCollectionIdx(),
+		Deleted:       true,
+	}
+	if err := setRq.Send(sender); err != nil {
+		return err
+	}
+	_, err = setRq.Response()
+	return err
+}
+
+// runBackfill pushes each of the plan's ranges in parallel.  Once all ranges are complete, the replication's checkpoint
+// is advanced to the end of the backfill and the plan is removed.
+func (apr *ActivePushReplicator) runBackfill(ctx context.Context, sender *blip.Sender, checkpointer *Checkpointer, plan *pushBackfillPlan, opts sendChangesOptions) error {
+	ranges := plan.ranges()
+	errs := make([]error, len(ranges))
+	var wg sync.WaitGroup
+	for i, r := range ranges {
+		wg.Add(1)
+		go func(i int, r pushBackfillRange) {
+			defer wg.Done()
+			errs[i] = apr.runBackfillWorker(ctx, i, r, opts)
+		}(i, r)
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := checkpointer.setCheckpoint(SequenceID{Seq: plan.EndSeq}.String()); err != nil {
+		return err
+	}
+	base.InfofCtx(ctx, base.KeyReplicate, "Completed push backfill of sequences up to %d", plan.EndSeq)
+	return apr.removeBackfill(plan, sender)
+}
+
+// runBackfillWorker pushes the changes in a single range over a dedicated connection, checkpointing progress against
+// the range.  The changes feed for the range starts at the range's checkpoint and ends at the first change later than
+// the end of the range.
+func (apr *ActivePushReplicator) runBackfillWorker(ctx context.Context, index int, r pushBackfillRange, opts sendChangesOptions) error {
+	sender, bsc, err := connect(apr.activeReplicatorCommon, fmt.Sprintf("-push-backfill-%d", index))
+	if err != nil {
+		return err
+	}
+	// Worker connections are closed once the range is complete - an unexpected close is surfaced as an incomplete
+	// range, and reconnect is handled by the replicator.
+	bsc.blipContext.OnExitCallback = nil
+	bsc.sendRevNoConflicts = true
+
+	workerCtx, workerCtxCancel := context.WithCancel(ctx)
+	closed := make(chan struct{})
+	go func() {
+		<-workerCtx.Done()
+		sender.Close()
+		bsc.Close()
+		close(closed)
+	}()
+	defer func() {
+		workerCtxCancel()
+		<-closed
+	}()
+
+	checkpointHash, err := apr.config.CheckpointHash()
+	if err != nil {
+		return err
+	}
+	checkpointer := NewCheckpointer(workerCtx, apr.backfillRangeCheckpointID(index), checkpointHash, sender, apr.config, apr.getPushStatus)
+	if _, err := checkpointer.fetchCheckpoints(); err != nil {
+		return err
+	}
+	bsc.sgr2PushAlreadyKnownSeqsCallback = checkpointer.AddAlreadyKnownSeq
+	bsc.sgr2PushAddExpectedSeqsCallback = checkpointer.AddExpectedSeqs
+	bsc.sgr2PushProcessedSeqCallback = checkpointer.AddProcessedSeq
+	bsc.sgr2PushRejectedRevCallback = apr.recordRejectedRev
+	checkpointer.beforeCheckpointCallback = apr.collectRejectedRevs
+	checkpointer.Start()
+
+	since := r.start
+	checkpointSeq, err := parseIntegerSequenceID(checkpointer.lastCheckpointSeq)
+	if err != nil {
+		base.WarnfCtx(ctx, "couldn't parse checkpointed sequence ID for backfill range %d, starting from seq:%d", index, r.start)
+	} else if checkpointSeq.Seq > since {
+		since = checkpointSeq.Seq
+	}
+	if since >= r.end {
+		base.DebugfCtx(ctx, base.KeyReplicate, "Push backfill range %d already complete", index)
+		return nil
+	}
+
+	bh := blipHandler{
+		BlipSyncContext: bsc,
+		db:              apr.config.ActiveDB,
+		collection:      apr.config.ActiveDB,
+		serialNumber:    bsc.incrementSerialNumber(),
+		collectionIdx:   apr.config.remoteCollectionIdx(),
+		loggingCtx:      bsc.loggingCtx,
+	}
+	opts.since = SequenceID{Seq: since}
+	opts.until = r.end
+	opts.continuous = false
+	if !bh.sendChanges(sender, &opts) {
+		return fmt.Errorf("push backfill of sequences %d-%d closed before completion", since+1, r.end)
+	}
+
+	if err := waitForPendingChangesResponse(bsc); err != nil {
+		return err
+	}
+	if err := checkpointer.waitForExpectedSequences(); err != nil {
+		return err
+	}
+
+	// Persist the range's progress, and mark the range complete at its end, as the last sequences in the range may
+	// not have been sent (e.g. for docs updated since the backfill started) and so won't have been checkpointed.
+	checkpointer.CheckpointNow()
+	if err := checkpointer.setCheckpoint(SequenceID{Seq: r.end}.String()); err != nil {
+		return err
+	}
+	base.DebugfCtx(ctx, base.KeyReplicate, "Push backfill range %d complete", index)
+	return nil
+}
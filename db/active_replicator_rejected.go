@@ -0,0 +1,346 @@
+/*
+Copyright 2022-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package db
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/couchbase/sync_gateway/base"
+)
+
+// Revisions pushed by a replication that are rejected by the remote (e.g. by the remote's sync function) are recorded
+// in a per-replication local doc, so that they can be inspected and retried once the cause of the rejection has been
+// resolved.  Only the most recent rejection for each document is retained.  Rejections are buffered in memory as rev
+// responses are received, and persisted before the replication checkpoints the rejected sequences.
+
+// RejectedRevsDocIDPrefix is the prefix of the local doc listing the rejected revisions for a push checkpoint ID.
+const RejectedRevsDocIDPrefix = "sgr2rejected:"
+
+// rejectedRevsMaxEntries is the maximum number of rejected revisions retained per replication.  Once exceeded, the
+// oldest rejections are discarded.
+const rejectedRevsMaxEntries = 1000
+
+// RejectedRev is a revision pushed by a replication that was rejected by the remote.
+type RejectedRev struct {
+	DocID  string    `json:"doc_id"`
+	RevID  string    `json:"rev"`
+	Seq    string    `json:"seq"`
+	Status int       `json:"status"`
+	Reason string    `json:"reason,omitempty"`
+	Time   time.Time `json:"time"`
+	Remote string    `json:"remote,omitempty"` // Redacted remote URL, set for fan-out replications
+}
+
+// ReplicationRejectedRevs is the response for GET _replicationStatus/{replicationID}/_rejected
+type ReplicationRejectedRevs struct {
+	ID       string        `json:"replication_id"`
+	Rejected []RejectedRev `json:"rejected"`
+}
+
+type rejectedRevsDoc struct {
+	Rev      string        `json:"_rev"`
+	Rejected []RejectedRev `json:"rejected"`
+}
+
+func getRejectedRevs(activeDB *Database, checkpointID string) (*rejectedRevsDoc, error) {
+	docBytes, err := activeDB.GetSpecialBytes(DocTypeLocal, RejectedRevsDocIDPrefix+checkpointID)
+	if err != nil {
+		if base.IsKeyNotFoundError(activeDB.Bucket, err) {
+			return &rejectedRevsDoc{}, nil
+		}
+		return nil, err
+	}
+	var doc rejectedRevsDoc
+	if err := base.JSONUnmarshal(docBytes, &doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// updateRejectedRevs applies updateFn to the rejected revisions for checkpointID, retrying on conflict.  The doc is
+// removed when no rejected revisions remain.
+func updateRejectedRevs(activeDB *Database, checkpointID string, updateFn func(rejected []RejectedRev) []RejectedRev) error {
+	for numAttempts := 0; numAttempts < 10; numAttempts++ {
+		doc, err := getRejectedRevs(activeDB, checkpointID)
+		if err != nil {
+			return err
+		}
+
+		rejected := updateFn(doc.Rejected)
+		var body Body
+		if len(rejected) > 0 {
+			body = Body{"rejected": rejected}
+		} else if doc.Rev == "" {
+			return nil
+		}
+
+		_, err = activeDB.putSpecial(DocTypeLocal, RejectedRevsDocIDPrefix+checkpointID, doc.Rev, body)
+		if err == nil {
+			return nil
+		}
+		if status, _ := base.ErrorAsHTTPStatus(err); status != http.StatusConflict && status != http.StatusNotFound {
+			return err
+		}
+	}
+	return errors.New("failed to update rejected revisions after 10 attempts")
+}
+
+// addRejectedRevs records revs as rejected, replacing any existing rejection for the same document.
+func addRejectedRevs(activeDB *Database, checkpointID string, revs ...RejectedRev) error {
+	added := make(map[string]struct{}, len(revs))
+	for _, rev := range revs {
+		added[rev.DocID] = struct{}{}
+	}
+	return updateRejectedRevs(activeDB, checkpointID, func(rejected []RejectedRev) []RejectedRev {
+		updated := make([]RejectedRev, 0, len(rejected)+len(revs))
+		for _, existing := range rejected {
+			if _, ok := added[existing.DocID]; !ok {
+				updated = append(updated, existing)
+			}
+		}
+		// Only the latest of multiple rejections for the same document is retained
+		for i, rev := range revs {
+			if latestRejectedRevIndex(revs, rev.DocID) == i {
+				updated = append(updated, rev)
+			}
+		}
+		if len(updated) > rejectedRevsMaxEntries {
+			updated = updated[len(updated)-rejectedRevsMaxEntries:]
+		}
+		return updated
+	})
+}
+
+// latestRejectedRevIndex returns the index of the last rejection for docID in revs.
+func latestRejectedRevIndex(revs []RejectedRev, docID string) int {
+	for i := len(revs) - 1; i >= 0; i-- {
+		if revs[i].DocID == docID {
+			return i
+		}
+	}
+	return -1
+}
+
+// removeRejectedRevs removes the rejections for the given documents.
+func removeRejectedRevs(activeDB *Database, checkpointID string, docIDs []string) error {
+	remove := base.SetFromArray(docIDs)
+	return updateRejectedRevs(activeDB, checkpointID, func(rejected []RejectedRev) []RejectedRev {
+		updated := make([]RejectedRev, 0, len(rejected))
+		for _, existing := range rejected {
+			if !remove.Contains(existing.DocID) {
+				updated = append(updated, existing)
+			}
+		}
+		return updated
+	})
+}
+
+// resetRejectedRevs removes all rejected revisions for checkpointID.
+func resetRejectedRevs(activeDB *Database, checkpointID string) error {
+	key := RealSpecialDocID(DocTypeLocal, RejectedRevsDocIDPrefix+checkpointID)
+	if err := activeDB.Bucket.Delete(key); err != nil && !base.IsDocNotFoundError(err) {
+		return err
+	}
+	return nil
+}
+
+// recordRejectedRev is registered as the sgr2PushRejectedRevCallback for the replication's connections.  The rejection
+// is buffered until the next flushRejectedRevs.
+func (apr *ActivePushReplicator) recordRejectedRev(docID, revID string, seq SequenceID, status int, reason string) {
+	apr.pendingRejectedRevsLock.Lock()
+	apr.pendingRejectedRevs = append(apr.pendingRejectedRevs, RejectedRev{
+		DocID:  docID,
+		RevID:  revID,
+		Seq:    seq.String(),
+		Status: status,
+		Reason: reason,
+		Time:   time.Now().UTC(),
+	})
+	apr.pendingRejectedRevsLock.Unlock()
+}
+
+// flushRejectedRevs persists the buffered rejected revisions.  Rejections that can't be persisted are retained in the
+// buffer for the next flush.
+func (apr *ActivePushReplicator) flushRejectedRevs() {
+	apr.persistRejectedRevs(apr.takePendingRejectedRevs())
+}
+
+// collectRejectedRevs is registered as the beforeCheckpointCallback of the replication's checkpointers.  The buffered
+// rejected revisions are collected while the checkpointer holds its lock, so that they include the rejections of the
+// sequences about to be checkpointed, and are persisted by the returned function once the lock has been released.
+func (apr *ActivePushReplicator) collectRejectedRevs() (persist func()) {
+	pending := apr.takePendingRejectedRevs()
+	return func() {
+		apr.persistRejectedRevs(pending)
+	}
+}
+
+// takePendingRejectedRevs removes and returns the buffered rejected revisions.
+func (apr *ActivePushReplicator) takePendingRejectedRevs() []RejectedRev {
+	apr.pendingRejectedRevsLock.Lock()
+	defer apr.pendingRejectedRevsLock.Unlock()
+	pending := apr.pendingRejectedRevs
+	apr.pendingRejectedRevs = nil
+	return pending
+}
+
+// persistRejectedRevs records the given rejected revisions, returning them to the buffer if they can't be persisted.
+func (apr *ActivePushReplicator) persistRejectedRevs(pending []RejectedRev) {
+	if len(pending) == 0 {
+		return
+	}
+
+	apr.rejectedRevsLock.Lock()
+	err := addRejectedRevs(apr.config.ActiveDB, apr.CheckpointID, pending...)
+	apr.rejectedRevsLock.Unlock()
+	if err != nil {
+		base.WarnfCtx(apr.ctx, "Unable to record %d rejected revisions, will retry: %v", len(pending), err)
+		apr.pendingRejectedRevsLock.Lock()
+		apr.pendingRejectedRevs = append(pending, apr.pendingRejectedRevs...)
+		apr.pendingRejectedRevsLock.Unlock()
+	}
+}
+
+// retryRejectedRevs pushes the current revision of each rejected document over a dedicated connection, and waits for
+// the remote to respond.  Each document is removed from the rejected revisions once the remote accepts it - those
+// rejected again are re-recorded with the new rejection, and those that aren't sent (e.g. already known to the remote)
+// or don't receive a response are retained.
+func (apr *ActivePushReplicator) retryRejectedRevs() (err error) {
+	apr.lock.RLock()
+	running := apr.ctx != nil && apr.ctx.Err() == nil
+	apr.lock.RUnlock()
+	if !running {
+		return base.HTTPErrorf(http.StatusBadRequest, "Replication must be running to retry rejected revisions")
+	}
+
+	apr.flushRejectedRevs()
+	activeDB := apr.config.ActiveDB
+	doc, err := getRejectedRevs(activeDB, apr.CheckpointID)
+	if err != nil {
+		return err
+	}
+	if len(doc.Rejected) == 0 {
+		return nil
+	}
+	docIDs := make([]string, 0, len(doc.Rejected))
+	for _, rejected := range doc.Rejected {
+		docIDs = append(docIDs, rejected.DocID)
+	}
+
+	sender, bsc, err := connect(apr.activeReplicatorCommon, "-push-retry")
+	if err != nil {
+		return err
+	}
+	bsc.blipContext.OnExitCallback = nil
+	bsc.sendRevNoConflicts = true
+	defer func() {
+		sender.Close()
+		bsc.Close()
+	}()
+
+	// Remove the documents accepted by the remote on every return, so that a failed retry only retains the documents
+	// that weren't accepted.
+	var acceptedLock sync.Mutex
+	accepted := make([]string, 0, len(docIDs))
+	bsc.sgr2PushAcceptedRevCallback = func(docID, _ string) {
+		acceptedLock.Lock()
+		accepted = append(accepted, docID)
+		acceptedLock.Unlock()
+	}
+	defer func() {
+		apr.flushRejectedRevs()
+		acceptedLock.Lock()
+		acceptedDocIDs := accepted
+		acceptedLock.Unlock()
+		if len(acceptedDocIDs) == 0 {
+			return
+		}
+		apr.rejectedRevsLock.Lock()
+		removeErr := removeRejectedRevs(activeDB, apr.CheckpointID, acceptedDocIDs)
+		apr.rejectedRevsLock.Unlock()
+		if removeErr != nil && err == nil {
+			err = removeErr
+		}
+	}()
+
+	// Track the revs sent on the connection, to wait for the remote's response to each.  The processed callback also
+	// ensures rev responses are awaited, so that rejections are reported via the rejected callback.
+	var pendingRevs int64
+	bsc.sgr2PushAddExpectedSeqsCallback = func(expectedSeqs ...string) {
+		atomic.AddInt64(&pendingRevs, int64(len(expectedSeqs)))
+	}
+	bsc.sgr2PushProcessedSeqCallback = func(string) {
+		atomic.AddInt64(&pendingRevs, -1)
+	}
+	bsc.sgr2PushRejectedRevCallback = apr.recordRejectedRev
+
+	var channels base.Set
+	if apr.config.FilterChannels != nil {
+		channels = base.SetFromArray(apr.config.FilterChannels)
+	}
+	bh := blipHandler{
+		BlipSyncContext: bsc,
+		db:              activeDB,
+		collection:      activeDB,
+		serialNumber:    bsc.incrementSerialNumber(),
+		collectionIdx:   apr.config.remoteCollectionIdx(),
+		loggingCtx:      bsc.loggingCtx,
+	}
+	base.InfofCtx(apr.ctx, base.KeyReplicate, "Retrying %d rejected revisions for replication %s", len(docIDs), apr.config.ID)
+	if !bh.sendChanges(sender, &sendChangesOptions{
+		docIDs:            docIDs,
+		activeOnly:        apr.config.ActiveOnly,
+		batchSize:         int(apr.config.ChangesBatchSize),
+		revocations:       apr.config.PurgeOnRemoval,
+		channels:          channels,
+		clientType:        clientTypeSGR2,
+		ignoreNoConflicts: true,
+	}) {
+		return errors.New("connection closed while retrying rejected revisions")
+	}
+
+	if err := waitForPendingChangesResponse(bsc); err != nil {
+		return err
+	}
+	for waitCount := 0; atomic.LoadInt64(&pendingRevs) > 0; waitCount++ {
+		if waitCount >= 100 {
+			return errors.New("timed out waiting for responses to retried revisions")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return nil
+}
+
+// retryRejectedRevs retries the rejected revisions of a push replication, or of each target of a fan-out replication.
+func (ar *ActiveReplicator) retryRejectedRevs() error {
+	if len(ar.Targets) > 0 {
+		return ar.forEachTarget((*ActiveReplicator).retryRejectedRevs)
+	}
+	if ar.Push == nil {
+		return base.HTTPErrorf(http.StatusBadRequest, "Replication %s is not a push replication", base.UD(ar.ID))
+	}
+	return ar.Push.retryRejectedRevs()
+}
+
+// flushRejectedRevs persists the buffered rejected revisions of a push replication, or of each target of a fan-out
+// replication.
+func (ar *ActiveReplicator) flushRejectedRevs() {
+	for _, target := range ar.Targets {
+		target.flushRejectedRevs()
+	}
+	if ar.Push != nil {
+		ar.Push.flushRejectedRevs()
+	}
+}
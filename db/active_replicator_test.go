@@ -14,6 +14,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"sync"
+	"sync/atomic"
 	"testing"
 
 	"github.com/couchbase/sync_gateway/base"
@@ -68,7 +70,7 @@ func TestBlipSyncErrorUserinfo(t *testing.T) {
 			blipContext, err := NewSGBlipContext(base.TestCtx(t), t.Name())
 			require.NoError(t, err)
 
-			_, err = blipSync(*srvURL, blipContext, false)
+			_, err = blipSync(*srvURL, blipContext, false, nil)
 			require.Error(t, err)
 			t.Logf("error: %v", err)
 			if targetPassword, hasPassword := srvURL.User.Password(); hasPassword {
@@ -77,3 +79,132 @@ func TestBlipSyncErrorUserinfo(t *testing.T) {
 		})
 	}
 }
+
+func TestPushBackfillPlanRanges(t *testing.T) {
+	testCases := []struct {
+		name     string
+		endSeq   uint64
+		workers  int
+		expected []pushBackfillRange
+	}{
+		{
+			name:     "even",
+			endSeq:   100,
+			workers:  4,
+			expected: []pushBackfillRange{{0, 25}, {25, 50}, {50, 75}, {75, 100}},
+		},
+		{
+			name:     "remainder",
+			endSeq:   10,
+			workers:  3,
+			expected: []pushBackfillRange{{0, 4}, {4, 7}, {7, 10}},
+		},
+		{
+			name:     "more workers than sequences",
+			endSeq:   2,
+			workers:  4,
+			expected: []pushBackfillRange{{0, 1}, {1, 2}},
+		},
+		{
+			name:    "no sequences",
+			endSeq:  0,
+			workers: 4,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			plan := &pushBackfillPlan{EndSeq: tc.endSeq, Workers: tc.workers}
+			assert.Equal(t, tc.expected, plan.ranges())
+		})
+	}
+}
+
+func TestRejectedRevs(t *testing.T) {
+	db, ctx := setupTestDB(t)
+	defer db.Close(ctx)
+
+	checkpointID := PushCheckpointID(t.Name())
+	rejected, err := getRejectedRevs(db, checkpointID)
+	require.NoError(t, err)
+	assert.Empty(t, rejected.Rejected)
+
+	require.NoError(t, addRejectedRevs(db, checkpointID, RejectedRev{DocID: "doc1", RevID: "1-a", Status: http.StatusForbidden}))
+	require.NoError(t, addRejectedRevs(db, checkpointID, RejectedRev{DocID: "doc2", RevID: "1-b", Status: http.StatusForbidden}))
+	// A later rejection for the same doc replaces the earlier one
+	require.NoError(t, addRejectedRevs(db, checkpointID, RejectedRev{DocID: "doc1", RevID: "2-a", Status: http.StatusInternalServerError}))
+
+	rejected, err = getRejectedRevs(db, checkpointID)
+	require.NoError(t, err)
+	require.Len(t, rejected.Rejected, 2)
+	assert.Equal(t, "doc2", rejected.Rejected[0].DocID)
+	assert.Equal(t, "doc1", rejected.Rejected[1].DocID)
+	assert.Equal(t, "2-a", rejected.Rejected[1].RevID)
+	assert.Equal(t, http.StatusInternalServerError, rejected.Rejected[1].Status)
+
+	require.NoError(t, removeRejectedRevs(db, checkpointID, []string{"doc2"}))
+	rejected, err = getRejectedRevs(db, checkpointID)
+	require.NoError(t, err)
+	require.Len(t, rejected.Rejected, 1)
+	assert.Equal(t, "doc1", rejected.Rejected[0].DocID)
+
+	// Removing the last rejection removes the doc
+	require.NoError(t, removeRejectedRevs(db, checkpointID, []string{"doc1"}))
+	rejected, err = getRejectedRevs(db, checkpointID)
+	require.NoError(t, err)
+	assert.Empty(t, rejected.Rejected)
+	assert.Empty(t, rejected.Rev)
+
+	// Only the latest of multiple rejections for the same doc in a batch is retained
+	require.NoError(t, addRejectedRevs(db, checkpointID,
+		RejectedRev{DocID: "doc3", RevID: "1-c"},
+		RejectedRev{DocID: "doc1", RevID: "3-a"},
+		RejectedRev{DocID: "doc3", RevID: "2-c"},
+	))
+	rejected, err = getRejectedRevs(db, checkpointID)
+	require.NoError(t, err)
+	require.Len(t, rejected.Rejected, 2)
+	assert.Equal(t, "doc1", rejected.Rejected[0].DocID)
+	assert.Equal(t, "3-a", rejected.Rejected[0].RevID)
+	assert.Equal(t, "doc3", rejected.Rejected[1].DocID)
+	assert.Equal(t, "2-c", rejected.Rejected[1].RevID)
+
+	require.NoError(t, resetRejectedRevs(db, checkpointID))
+	rejected, err = getRejectedRevs(db, checkpointID)
+	require.NoError(t, err)
+	assert.Empty(t, rejected.Rejected)
+}
+
+// TestFanOutTargetComplete ensures a fan-out replication completes once every target has stopped or failed, and that
+// onComplete is only invoked once when targets complete concurrently.
+func TestFanOutTargetComplete(t *testing.T) {
+	var completions int32
+	ar := &ActiveReplicator{
+		ID: t.Name(),
+		config: &ActiveReplicatorConfig{onComplete: func(string) {
+			atomic.AddInt32(&completions, 1)
+		}},
+	}
+	for _, state := range []string{ReplicationStateStopped, ReplicationStateError, ReplicationStateRunning} {
+		ar.Targets = append(ar.Targets, &ActiveReplicator{
+			Push: &ActivePushReplicator{activeReplicatorCommon: &activeReplicatorCommon{state: state}},
+		})
+	}
+
+	// A running target prevents completion
+	ar._onFanOutTargetComplete()
+	assert.Equal(t, int32(0), atomic.LoadInt32(&completions))
+
+	// Stopped and errored targets are finished
+	ar.Targets[2].Push.setState(ReplicationStateStopped)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ar._onFanOutTargetComplete()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&completions))
+}
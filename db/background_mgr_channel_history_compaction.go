@@ -0,0 +1,72 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package db
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/couchbase/sync_gateway/base"
+)
+
+// ==============================================================
+// Channel History Compaction Implementation of Background Manager
+// ==============================================================
+
+type ChannelHistoryCompactionManager struct {
+	DocsProcessed int64
+	DocsChanged   int64
+}
+
+var _ BackgroundManagerProcessI = &ChannelHistoryCompactionManager{}
+
+func NewChannelHistoryCompactionManager() *BackgroundManager {
+	return &BackgroundManager{
+		Process:    &ChannelHistoryCompactionManager{},
+		terminator: base.NewSafeTerminator(),
+	}
+}
+
+func (c *ChannelHistoryCompactionManager) Init(ctx context.Context, options map[string]interface{}, clusterStatus []byte) error {
+	return nil
+}
+
+func (c *ChannelHistoryCompactionManager) Run(ctx context.Context, options map[string]interface{}, persistClusterStatusCallback updateStatusCallbackFunc, terminator *base.SafeTerminator) error {
+	database := options["database"].(*Database)
+
+	callback := func(docsProcessed, docsChanged *int) {
+		atomic.StoreInt64(&c.DocsProcessed, int64(*docsProcessed))
+		atomic.StoreInt64(&c.DocsChanged, int64(*docsChanged))
+	}
+
+	_, err := database.CompactChannelHistory(ctx, callback, terminator)
+	return err
+}
+
+type ChannelHistoryCompactionManagerResponse struct {
+	BackgroundManagerStatus
+	DocsProcessed int64 `json:"docs_processed"`
+	DocsChanged   int64 `json:"docs_changed"`
+}
+
+func (c *ChannelHistoryCompactionManager) GetProcessStatus(backgroundManagerStatus BackgroundManagerStatus) ([]byte, []byte, error) {
+	retStatus := ChannelHistoryCompactionManagerResponse{
+		BackgroundManagerStatus: backgroundManagerStatus,
+		DocsProcessed:           atomic.LoadInt64(&c.DocsProcessed),
+		DocsChanged:             atomic.LoadInt64(&c.DocsChanged),
+	}
+
+	statusJSON, err := base.JSONMarshal(retStatus)
+	return statusJSON, nil, err
+}
+
+func (c *ChannelHistoryCompactionManager) ResetStatus() {
+	atomic.StoreInt64(&c.DocsProcessed, 0)
+	atomic.StoreInt64(&c.DocsChanged, 0)
+}
@@ -0,0 +1,139 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package db
+
+import (
+	"context"
+	"sync"
+
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/google/uuid"
+)
+
+// ======================================================================
+// Metadata Migration Implementation of Background Manager Process
+// ======================================================================
+
+// MetadataMigrationManager moves inline _sync metadata written by Sync Gateway without shared bucket access into the
+// sync xattr, so that a legacy bucket's docs don't each need migrating on import.
+type MetadataMigrationManager struct {
+	DocsProcessed base.AtomicInt
+	DocsMigrated  base.AtomicInt
+	MigrationID   string
+	maxPerSecond  uint64
+	lock          sync.Mutex
+}
+
+var _ BackgroundManagerProcessI = &MetadataMigrationManager{}
+
+func NewMetadataMigrationManager(bucket base.Bucket) *BackgroundManager {
+	return &BackgroundManager{
+		Process: &MetadataMigrationManager{},
+		clusterAwareOptions: &ClusterAwareBackgroundManagerOptions{
+			bucket:        bucket,
+			processSuffix: "migrate_metadata",
+		},
+		terminator: base.NewSafeTerminator(),
+	}
+}
+
+func (m *MetadataMigrationManager) Init(ctx context.Context, options map[string]interface{}, clusterStatus []byte) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.maxPerSecond, _ = options["maxPerSecond"].(uint64)
+
+	newRunInit := func() error {
+		uniqueUUID, err := uuid.NewRandom()
+		if err != nil {
+			return err
+		}
+		m.MigrationID = uniqueUUID.String()
+		base.InfofCtx(ctx, base.KeyAll, "Metadata Migration: Starting new migration with migration ID: %q", m.MigrationID)
+		return nil
+	}
+
+	if clusterStatus != nil {
+		var statusDoc MetadataMigrationManagerStatusDoc
+		err := base.JSONUnmarshal(clusterStatus, &statusDoc)
+
+		reset, _ := options["reset"].(bool)
+		if reset {
+			base.InfofCtx(ctx, base.KeyAll, "Metadata Migration: Resetting migration. Will not resume any partially completed migration")
+		}
+
+		// Start from scratch if the previous run completed or can't be resumed, otherwise resume with the previous
+		// run's ID, which picks up the DCP checkpoints persisted during that run.
+		if statusDoc.State == BackgroundProcessStateCompleted || err != nil || reset || statusDoc.MigrationID == "" {
+			return newRunInit()
+		}
+
+		m.MigrationID = statusDoc.MigrationID
+		m.DocsProcessed.Set(statusDoc.DocsProcessed)
+		m.DocsMigrated.Set(statusDoc.DocsMigrated)
+		base.InfofCtx(ctx, base.KeyAll, "Metadata Migration: Attempting to resume migration with migration ID: %q", m.MigrationID)
+		return nil
+	}
+
+	return newRunInit()
+}
+
+func (m *MetadataMigrationManager) Run(ctx context.Context, options map[string]interface{}, persistClusterStatusCallback updateStatusCallbackFunc, terminator *base.SafeTerminator) error {
+	database := options["database"].(*Database)
+
+	defer func() {
+		err := persistClusterStatusCallback()
+		if err != nil {
+			base.WarnfCtx(ctx, "Failed to persist cluster status on-demand following metadata migration: %v", err)
+		}
+	}()
+
+	m.lock.Lock()
+	migrationID, maxPerSecond := m.MigrationID, m.maxPerSecond
+	m.lock.Unlock()
+
+	return migrateAllMetadata(ctx, database, migrationID, maxPerSecond, terminator, &m.DocsProcessed, &m.DocsMigrated)
+}
+
+type MetadataMigrationManagerResponse struct {
+	BackgroundManagerStatus
+	DocsProcessed int64  `json:"docs_processed"`
+	DocsMigrated  int64  `json:"docs_migrated"`
+	MigrationID   string `json:"migration_id"`
+	MaxPerSecond  uint64 `json:"max_per_second,omitempty"`
+}
+
+type MetadataMigrationManagerStatusDoc struct {
+	MetadataMigrationManagerResponse `json:"status"`
+}
+
+func (m *MetadataMigrationManager) GetProcessStatus(status BackgroundManagerStatus) ([]byte, []byte, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	response := MetadataMigrationManagerResponse{
+		BackgroundManagerStatus: status,
+		DocsProcessed:           m.DocsProcessed.Value(),
+		DocsMigrated:            m.DocsMigrated.Value(),
+		MigrationID:             m.MigrationID,
+		MaxPerSecond:            m.maxPerSecond,
+	}
+
+	statusJSON, err := base.JSONMarshal(response)
+	return statusJSON, nil, err
+}
+
+func (m *MetadataMigrationManager) ResetStatus() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.DocsProcessed.Set(0)
+	m.DocsMigrated.Set(0)
+	m.maxPerSecond = 0
+}
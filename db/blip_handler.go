@@ -61,7 +61,8 @@ type blipHandler struct {
 	collection    *Database // Handler-specific copy of the BlipSyncContext's collection specific DB
 	collectionIdx *int      // index into BlipSyncContext.collectionMapping for the collection
 
-	serialNumber uint64 // This blip handler's serial number to differentiate logs w/ other handlers
+	serialNumber uint64          // This blip handler's serial number to differentiate logs w/ other handlers
+	loggingCtx   context.Context // The BlipSyncContext's loggingCtx, with the span tracing the handled message
 }
 
 // BlipSyncContextClientType represents whether to replicate to another Sync Gateway or Couchbase Lite
@@ -197,6 +198,14 @@ func (bh *blipHandler) handleSetCheckpoint(rq *blip.Message) error {
 	checkpointMessage := SetCheckpointMessage{rq}
 	bh.logEndpointEntry(rq.Profile(), checkpointMessage.String())
 
+	if checkpointMessage.deleted() {
+		err := bh.collection.DeleteSpecial(DocTypeLocal, CheckpointDocIDPrefix+checkpointMessage.client(), checkpointMessage.rev())
+		if err != nil && !base.IsDocNotFoundError(err) {
+			return err
+		}
+		return nil
+	}
+
 	var checkpoint Body
 	if err := checkpointMessage.ReadJSONBody(&checkpoint); err != nil {
 		return err
@@ -331,6 +340,7 @@ type sendChangesOptions struct {
 	clientType        clientType
 	revocations       bool
 	ignoreNoConflicts bool
+	until             uint64 // When non-zero, the changes feed ends at the first change with a later sequence
 }
 
 type changesDeletedFlag uint
@@ -374,6 +384,7 @@ func (bh *blipHandler) sendChanges(sender *blip.Sender, opts *sendChangesOptions
 	}
 
 	caughtUp := false
+	untilReached := false
 	pendingChanges := make([][]interface{}, 0, opts.batchSize)
 	sendPendingChangesAt := func(minChanges int) error {
 		if len(pendingChanges) >= minChanges {
@@ -391,6 +402,18 @@ func (bh *blipHandler) sendChanges(sender *blip.Sender, opts *sendChangesOptions
 	_, forceClose := generateBlipSyncChanges(bh.loggingCtx, changesDb, channelSet, options, opts.docIDs, func(changes []*ChangeEntry) error {
 		base.DebugfCtx(bh.loggingCtx, base.KeySync, "    Sending %d changes", len(changes))
 		for _, change := range changes {
+			if opts.until > 0 && change.Seq.Seq > opts.until {
+				// Changes are sent in sequence order, so there are no further changes to send.  Flush pending changes
+				// and signal caught up before ending the feed.
+				if err := sendPendingChangesAt(1); err != nil {
+					return err
+				}
+				if err := bh.sendBatchOfChanges(sender, nil, opts.ignoreNoConflicts); err != nil {
+					return err
+				}
+				untilReached = true
+				return errChangesUntilReached
+			}
 			if !strings.HasPrefix(change.ID, "_") {
 				for _, item := range change.Changes {
 					changeRow := bh.buildChangesRow(change, item["rev"])
@@ -445,6 +468,11 @@ func (bh *blipHandler) sendChanges(sender *blip.Sender, opts *sendChangesOptions
 		return nil
 	})
 
+	// Ending the feed at until is a normal completion
+	if untilReached {
+		return true
+	}
+
 	// On forceClose, send notify to trigger immediate exit from change waiter
 	if forceClose {
 		user := ""
@@ -1205,6 +1233,9 @@ func (bh *blipHandler) handleGetAttachment(rq *blip.Message) error {
 
 var errNoBlipHandler = fmt.Errorf("404 - No handler for BLIP request")
 
+// errChangesUntilReached is returned by the changes feed callback to end the feed once sendChangesOptions.until is reached
+var errChangesUntilReached = fmt.Errorf("changes feed reached until sequence")
+
 // sendGetAttachment requests the full attachment from the peer.
 func (bh *blipHandler) sendGetAttachment(sender *blip.Sender, docID string, name string, digest string, meta map[string]interface{}) ([]byte, error) {
 	base.DebugfCtx(bh.loggingCtx, base.KeySync, "    Asking for attachment %q for doc %s (digest %s)", base.UD(name), base.UD(docID), digest)
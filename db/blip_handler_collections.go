@@ -110,3 +110,38 @@ func (bsc *BlipSyncContext) getCollectionIndexForDB(db *Database) (int, bool) {
 	}
 	return 0, false
 }
+
+// initRemoteCollection sends a getCollections request for remoteKeyspace to the remote, and maps collection index 0 of
+// the connection to localDB.  Used by active replicators replicating with a remote keyspace.
+func (bsc *BlipSyncContext) initRemoteCollection(sender *blip.Sender, remoteKeyspace string, checkpointID string, localDB *Database) error {
+	msg, err := NewGetCollectionsMessage(GetCollectionsRequestBody{
+		Collections:   []string{remoteKeyspace},
+		CheckpointIDs: []string{checkpointID},
+	})
+	if err != nil {
+		return err
+	}
+	if !bsc.sendBLIPMessage(sender, msg) {
+		return ErrClosedBLIPSender
+	}
+
+	resp := msg.Response()
+	respBody, err := resp.Body()
+	if err != nil {
+		return err
+	}
+	if resp.Type() == blip.ErrorType {
+		return fmt.Errorf("error response to %s for remote keyspace %s: %s", MessageGetCollections, base.MD(remoteKeyspace).Redact(), respBody)
+	}
+
+	var checkpoints []Body
+	if err := base.JSONUnmarshal(respBody, &checkpoints); err != nil {
+		return fmt.Errorf("invalid response to %s: %w", MessageGetCollections, err)
+	}
+	if len(checkpoints) != 1 || checkpoints[0] == nil {
+		return fmt.Errorf("remote keyspace %s not found on remote database", base.MD(remoteKeyspace).Redact())
+	}
+
+	bsc.collectionMapping = []*Database{localDB}
+	return nil
+}
@@ -124,6 +124,7 @@ func TestCollectionBlipHandler(t *testing.T) {
 			bh := blipHandler{
 				db:              allDBContext,
 				BlipSyncContext: &BlipSyncContext{collectionMapping: testCase.collectionMapping},
+				loggingCtx:      base.TestCtx(t),
 			}
 
 			passedMiddleware := false
@@ -35,6 +35,7 @@ type SubChangesRequest struct {
 	DocIDs         []string // DocIDs specifies which doc IDs the recipient should send changes for (optional)
 	ActiveOnly     bool     // ActiveOnly is set to `true` if the requester doesn't want to be sent tombstones. (optional)
 	Revocations    bool     // Revocations is set to `true` if the requester wants to be send revocation messages (optional)
+	CollectionIdx  *int     // CollectionIdx is the index of the collection returned by getCollections (optional)
 	clientType     clientType
 }
 
@@ -63,6 +64,7 @@ func (rq *SubChangesRequest) marshalBLIPRequest() (*blip.Message, error) {
 	setOptionalProperty(msg.Properties, SubChangesFilter, rq.Filter)
 	setOptionalProperty(msg.Properties, SubChangesChannels, strings.Join(rq.FilterChannels, ","))
 	setOptionalProperty(msg.Properties, SubChangesRevocations, rq.Revocations)
+	setOptionalProperty(msg.Properties, BlipCollection, rq.CollectionIdx)
 
 	if len(rq.DocIDs) > 0 {
 		if err := msg.SetJSONBody(map[string]interface{}{
@@ -81,6 +83,10 @@ type SetSGR2CheckpointRequest struct {
 	Client     string  // Client is the unique ID of client checkpoint to retrieve
 	RevID      *string // RevID of the previous checkpoint, if known.
 	Checkpoint Body    // Checkpoint is the actual checkpoint body we're sending.
+	// CollectionIdx is the index of the collection returned by getCollections (optional)
+	CollectionIdx *int
+	// Deleted removes the checkpoint instead of setting it.  Remotes that don't support removal set an empty checkpoint.
+	Deleted bool
 
 	msg *blip.Message
 }
@@ -108,6 +114,8 @@ func (rq *SetSGR2CheckpointRequest) marshalBLIPRequest() (*blip.Message, error)
 
 	setProperty(msg.Properties, SetCheckpointClient, rq.Client)
 	setOptionalProperty(msg.Properties, SetCheckpointRev, rq.RevID)
+	setOptionalProperty(msg.Properties, BlipCollection, rq.CollectionIdx)
+	setOptionalProperty(msg.Properties, SetCheckpointDeleted, rq.Deleted)
 
 	if err := msg.SetJSONBody(rq.Checkpoint); err != nil {
 		return nil, err
@@ -148,7 +156,8 @@ func (rq *SetSGR2CheckpointRequest) Response() (*SetSGR2CheckpointResponse, erro
 
 // GetSGR2CheckpointRequest is a strongly typed 'getCheckpoint' request for SG-Replicate 2.
 type GetSGR2CheckpointRequest struct {
-	Client string // Client is the unique ID of client checkpoint to retrieve
+	Client        string // Client is the unique ID of client checkpoint to retrieve
+	CollectionIdx *int   // CollectionIdx is the index of the collection returned by getCollections (optional)
 
 	msg *blip.Message
 }
@@ -172,6 +181,7 @@ func (rq *GetSGR2CheckpointRequest) marshalBLIPRequest() *blip.Message {
 	msg.SetProfile(MessageGetCheckpoint)
 
 	setProperty(msg.Properties, GetCheckpointClient, rq.Client)
+	setOptionalProperty(msg.Properties, BlipCollection, rq.CollectionIdx)
 
 	return msg
 }
@@ -59,6 +59,10 @@ func setOptionalProperty(p blip.Properties, k string, v interface{}) {
 		if val != 0 {
 			p[k] = strconv.FormatUint(uint64(val), 10)
 		}
+	case *int:
+		if val != nil {
+			p[k] = strconv.Itoa(*val)
+		}
 	case fmt.Stringer:
 		p[k] = val.String()
 	default:
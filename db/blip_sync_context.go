@@ -15,6 +15,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"runtime/debug"
 	"strconv"
 	"sync"
@@ -77,6 +78,9 @@ func NewBlipSyncContext(ctx context.Context, bc *blip.Context, db *Database, con
 	return bsc
 }
 
+// rejectedRevFunc is called with the HTTP status and error message when a pushed revision is rejected by the remote.
+type rejectedRevFunc func(docID, revID string, seq SequenceID, status int, reason string)
+
 // BlipSyncContext represents one BLIP connection (socket) opened by a client.
 // This connection remains open until the client closes it, and can receive any number of requests.
 type BlipSyncContext struct {
@@ -100,6 +104,8 @@ type BlipSyncContext struct {
 	sgr2PushAddExpectedSeqsCallback  func(expectedSeqs ...string)              // sgr2PushAddExpectedSeqsCallback is called after sync gateway has sent a revision, but is still awaiting an acknowledgement
 	sgr2PushProcessedSeqCallback     func(remoteSeq string)                    // sgr2PushProcessedSeqCallback is called after receiving acknowledgement of a sent revision
 	sgr2PushAlreadyKnownSeqsCallback func(alreadyKnownSeqs ...string)          // sgr2PushAlreadyKnownSeqsCallback is called to mark the sequence as being immediately processed
+	sgr2PushRejectedRevCallback      rejectedRevFunc                           // sgr2PushRejectedRevCallback is called when a sent revision is rejected by the remote
+	sgr2PushAcceptedRevCallback      func(docID, revID string)                 // sgr2PushAcceptedRevCallback is called when a sent revision is accepted by the remote
 	emptyChangesMessageCallback      func()                                    // emptyChangesMessageCallback is called when an empty changes message is received
 	replicationStats                 *BlipSyncStats                            // Replication stats
 	purgeOnRemoval                   bool                                      // Purges the document when we pull a _removed:true revision.
@@ -168,10 +174,12 @@ func (bsc *BlipSyncContext) register(profile string, handlerFn func(*blipHandler
 		}()
 
 		startTime := time.Now()
+		handlerCtx, span := base.StartSpan(bsc.loggingCtx, "blip."+profile)
 		handler := blipHandler{
 			BlipSyncContext: bsc,
 			db:              bsc.copyContextDatabase(),
 			serialNumber:    bsc.incrementSerialNumber(),
+			loggingCtx:      handlerCtx,
 		}
 
 		// Trace log the full message body and properties
@@ -180,10 +188,20 @@ func (bsc *BlipSyncContext) register(profile string, handlerFn func(*blipHandler
 			base.TracefCtx(bsc.loggingCtx, base.KeySyncMsg, "Recv Req %s: Body: '%s' Properties: %v", rq, base.UD(rqBody), base.UD(rq.Properties))
 		}
 
-		if err := handlerFn(&handler, rq); err != nil {
+		err := handlerFn(&handler, rq)
+		span.End(err)
+		bsc.blipContextDb.CheckSlowRequest(bsc.loggingCtx, time.Since(startTime), func() string {
+			return fmt.Sprintf("BLIP #%d %s", handler.serialNumber, profile)
+		})
+		if err != nil {
 			status, msg := base.ErrorAsHTTPStatus(err)
 			if response := rq.Response(); response != nil {
 				response.SetError("HTTP", status, msg)
+				if rejection := base.SyncFnRejectionReasonFromError(err); rejection != nil {
+					if rejectionJSON, marshalErr := base.JSONMarshal(rejection); marshalErr == nil {
+						response.Properties[BlipErrorRejection] = string(rejectionJSON)
+					}
+				}
 			}
 			base.InfofCtx(bsc.loggingCtx, base.KeySyncMsg, "#%d: Type:%s   --> %d %s Time:%v", handler.serialNumber, profile, status, msg, time.Since(startTime))
 		} else if profile != "subChanges" {
@@ -432,6 +450,9 @@ func (bsc *BlipSyncContext) sendRevisionWithProperties(sender *blip.Sender, docI
 						bsc.replicationStats.SendRevErrorConflictCount.Add(1)
 					case "403":
 						bsc.replicationStats.SendRevErrorRejectedCount.Add(1)
+						if bsc.sgr2PushRejectedRevCallback != nil {
+							bsc.sgr2PushRejectedRevCallback(docID, revID, seq, http.StatusForbidden, string(respBody))
+						}
 					case "422", "404":
 						// unprocessable entity, CBL has not been able to use the delta we sent, so we should re-send the revision in full
 						if resendFullRevisionFunc != nil {
@@ -444,6 +465,9 @@ func (bsc *BlipSyncContext) sendRevisionWithProperties(sender *blip.Sender, docI
 						// runtime exceptions return 500 status codes, but we have no other way to determine if this 500 error was caused by the sync-function than matching on the error message.
 						if bytes.Contains(respBody, []byte("JS sync function")) {
 							bsc.replicationStats.SendRevErrorRejectedCount.Add(1)
+							if bsc.sgr2PushRejectedRevCallback != nil {
+								bsc.sgr2PushRejectedRevCallback(docID, revID, seq, http.StatusInternalServerError, string(respBody))
+							}
 						} else {
 							bsc.replicationStats.SendRevErrorOtherCount.Add(1)
 						}
@@ -451,6 +475,9 @@ func (bsc *BlipSyncContext) sendRevisionWithProperties(sender *blip.Sender, docI
 				}
 			} else {
 				bsc.replicationStats.SendRevCount.Add(1)
+				if bsc.sgr2PushAcceptedRevCallback != nil {
+					bsc.sgr2PushAcceptedRevCallback(docID, revID)
+				}
 			}
 
 			bsc.removeAllowedAttachments(docID, attMeta, activeSubprotocol)
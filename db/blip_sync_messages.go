@@ -56,6 +56,7 @@ const (
 	SetCheckpointRev         = "rev"
 	SetCheckpointClient      = "client"
 	SetCheckpointResponseRev = "rev"
+	SetCheckpointDeleted     = "deleted" // When true, removes the checkpoint instead of setting it
 
 	// getCheckpoint message properties
 	GetCheckpointResponseRev = "rev"
@@ -128,8 +129,9 @@ const (
 	BlipCollection = "collection"
 
 	// blip error properties
-	BlipErrorDomain = "Error-Domain"
-	BlipErrorCode   = "Error-Code"
+	BlipErrorDomain    = "Error-Domain"
+	BlipErrorCode      = "Error-Code"
+	BlipErrorRejection = "Error-Rejection" // JSON reason for a sync function rejection, when given
 )
 
 const CheckpointDocIDPrefix = "checkpoint/"
@@ -317,6 +319,10 @@ func (scm *SetCheckpointMessage) SetRev(rev string) {
 	scm.Properties[SetCheckpointRev] = rev
 }
 
+func (scm *SetCheckpointMessage) deleted() bool {
+	return scm.Properties[SetCheckpointDeleted] == trueProperty
+}
+
 func (scm *SetCheckpointMessage) String() string {
 
 	buffer := bytes.NewBufferString("")
@@ -60,6 +60,8 @@ type BlipSyncStats struct {
 	SendChangesCount                 *base.SgwIntStat // sendChanges
 	NumConnectAttempts               *base.SgwIntStat
 	NumReconnectsAborted             *base.SgwIntStat
+	NumReconnects                    *base.SgwIntStat
+	CheckpointLag                    *base.SgwIntStat
 	NumHandlersPanicked              *base.SgwIntStat
 }
 
@@ -108,6 +110,8 @@ func NewBlipSyncStats() *BlipSyncStats {
 		SendChangesCount:                 &base.SgwIntStat{},
 		NumConnectAttempts:               &base.SgwIntStat{},
 		NumReconnectsAborted:             &base.SgwIntStat{},
+		NumReconnects:                    &base.SgwIntStat{},
+		CheckpointLag:                    &base.SgwIntStat{},
 		NumHandlersPanicked:              &base.SgwIntStat{},
 	}
 }
@@ -167,6 +171,8 @@ func BlipSyncStatsForSGRPush(replicationStats *base.DbReplicatorStats) *BlipSync
 	blipStats.SendChangesCount = replicationStats.DocsCheckedSent
 	blipStats.NumConnectAttempts = replicationStats.NumConnectAttemptsPush
 	blipStats.NumReconnectsAborted = replicationStats.NumReconnectsAbortedPush
+	blipStats.NumReconnects = replicationStats.NumReconnectsPush
+	blipStats.CheckpointLag = replicationStats.CheckpointLagPush
 
 	blipStats.NumHandlersPanicked = replicationStats.NumHandlersPanicked
 
@@ -186,6 +192,8 @@ func BlipSyncStatsForSGRPull(replicationStats *base.DbReplicatorStats) *BlipSync
 	blipStats.HandleChangesCount = replicationStats.DocsCheckedReceived
 	blipStats.NumConnectAttempts = replicationStats.NumConnectAttemptsPull
 	blipStats.NumReconnectsAborted = replicationStats.NumReconnectsAbortedPull
+	blipStats.NumReconnects = replicationStats.NumReconnectsPull
+	blipStats.CheckpointLag = replicationStats.CheckpointLagPull
 
 	blipStats.NumHandlersPanicked = replicationStats.NumHandlersPanicked
 
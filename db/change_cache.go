@@ -12,11 +12,11 @@ package db
 
 import (
 	"container/heap"
-	"container/list"
 	"context"
 	"errors"
 	"fmt"
 	"math"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -69,6 +69,8 @@ type changeCache struct {
 	internalStats      changeCacheStats        // Running stats for the change cache.  Only applied to expvars on a call to changeCache.updateStats
 	cfgEventCallback   base.CfgEventNotifyFunc // Callback for Cfg updates recieved over the caching feed
 	sgCfgPrefix        string                  // Prefix for SG Cfg doc keys
+	channelStats       *channelStatsTracker    // Per-channel stats, tracked from the changes added to the cache
+	clock              base.Clock              // Times the expiry of skipped sequences
 }
 
 type changeCacheStats struct {
@@ -121,16 +123,24 @@ type LogEntries []*LogEntry
 // A priority-queue of LogEntries, kept ordered by increasing sequence #.
 type LogPriorityQueue []*LogEntry
 
+// SkippedSequence is a range of contiguous sequences, from start to end inclusive, that were skipped at the same time.
 type SkippedSequence struct {
-	seq       uint64
+	start     uint64
+	end       uint64
 	timeAdded time.Time
 }
 
+// count returns the number of sequences in the range.
+func (s *SkippedSequence) count() int64 {
+	return int64(s.end - s.start + 1)
+}
+
 type CacheOptions struct {
 	ChannelCacheOptions
-	CachePendingSeqMaxWait time.Duration // Max wait for pending sequence before skipping
-	CachePendingSeqMaxNum  int           // Max number of pending sequences before skipping
-	CacheSkippedSeqMaxWait time.Duration // Max wait for skipped sequence before abandoning
+	CachePendingSeqMaxWait time.Duration              // Max wait for pending sequence before skipping
+	CachePendingSeqMaxNum  int                        // Max number of pending sequences before skipping
+	CacheSkippedSeqMaxWait time.Duration              // Max wait for skipped sequence before abandoning
+	Preload                *ChannelCachePreloadConfig // Channels to preload into the channel cache on startup
 }
 
 func DefaultCacheOptions() CacheOptions {
@@ -163,7 +173,9 @@ func (c *changeCache) Init(logCtx context.Context, dbcontext *DatabaseContext, n
 
 	c.notifyChange = notifyChange
 	c.receivedSeqs = make(map[uint64]struct{})
+	c.channelStats = newChannelStatsTracker()
 	c.terminator = make(chan bool)
+	c.clock = base.ClockOrDefault(dbcontext.Options.Clock)
 	c.initTime = time.Now()
 	c.skippedSeqs = NewSkippedSequenceList()
 	c.lastAddPendingTime = time.Now().UnixNano()
@@ -312,57 +324,72 @@ func (c *changeCache) InsertPendingEntries(ctx context.Context) error {
 // and subsequent removal (RemoveSkipped).
 func (c *changeCache) CleanSkippedSequenceQueue(ctx context.Context) error {
 
-	oldSkippedSequences := c.GetSkippedSequencesOlderThanMaxWait()
-	if len(oldSkippedSequences) == 0 {
+	oldSkippedRanges := c.GetSkippedSequencesOlderThanMaxWait()
+	if len(oldSkippedRanges) == 0 {
 		return nil
 	}
 
-	base.InfofCtx(ctx, base.KeyCache, "Starting CleanSkippedSequenceQueue, found %d skipped sequences older than max wait for database %s", len(oldSkippedSequences), base.MD(c.context.Name))
+	base.InfofCtx(ctx, base.KeyCache, "Starting CleanSkippedSequenceQueue, found %d skipped sequence ranges older than max wait for database %s", len(oldSkippedRanges), base.MD(c.context.Name))
 
 	var foundEntries []*LogEntry
-	var pendingRemovals []uint64
+	var pendingRemovals []SkippedSequence
 
 	if c.context.Options.UnsupportedOptions != nil && c.context.Options.UnsupportedOptions.DisableCleanSkippedQuery {
-		pendingRemovals = append(pendingRemovals, oldSkippedSequences...)
-		oldSkippedSequences = nil
+		pendingRemovals = append(pendingRemovals, oldSkippedRanges...)
+		oldSkippedRanges = nil
+	}
+
+	// Runs a query for the given skipped ranges.  Found entries are processed below, which removes them from the
+	// skipped sequence queue - whatever remains of the ranges afterwards is removed as not found.  On query error the
+	// ranges are left in the queue, to be retried by the next clean.
+	// Note: The view query is only going to hit for active revisions - sequences associated with inactive revisions
+	//       aren't indexed by the channel view.  This means we can potentially miss channel removals:
+	//       when an older revision is missed by the TAP feed, and a channel is removed in that revision,
+	//       the doc won't be flagged as removed from that channel in the in-memory channel cache.
+	queryRanges := func(ranges []SkippedSequence, query func() (LogEntries, error)) {
+		entries, err := query()
+		if err != nil {
+			base.WarnfCtx(ctx, "Error retrieving sequences via query during skipped sequence clean - %d sequence ranges will be retried: %v", len(ranges), err)
+			return
+		}
+		foundEntries = append(foundEntries, entries...)
+		pendingRemovals = append(pendingRemovals, ranges...)
 	}
 
-	for len(oldSkippedSequences) > 0 {
-		var skippedSeqBatch []uint64
-		if len(oldSkippedSequences) >= SkippedSeqCleanViewBatch {
-			skippedSeqBatch = oldSkippedSequences[0:SkippedSeqCleanViewBatch]
-			oldSkippedSequences = oldSkippedSequences[SkippedSeqCleanViewBatch:]
-		} else {
-			skippedSeqBatch = oldSkippedSequences[0:]
-			oldSkippedSequences = nil
+	// Small ranges are batched into queries for up to SkippedSeqCleanViewBatch individual sequences.  Larger ranges
+	// are queried by sequence range instead, to avoid listing every sequence in them.
+	var batchSequences []uint64
+	var batchRanges []SkippedSequence
+	queryBatch := func() {
+		if len(batchSequences) == 0 {
+			return
 		}
-
-		base.InfofCtx(ctx, base.KeyCache, "Issuing skipped sequence clean query for %d sequences, %d remain pending (db:%s).", len(skippedSeqBatch), len(oldSkippedSequences), base.MD(c.context.Name))
-		// Note: The view query is only going to hit for active revisions - sequences associated with inactive revisions
-		//       aren't indexed by the channel view.  This means we can potentially miss channel removals:
-		//       when an older revision is missed by the TAP feed, and a channel is removed in that revision,
-		//       the doc won't be flagged as removed from that channel in the in-memory channel cache.
-		entries, err := c.context.getChangesForSequences(ctx, skippedSeqBatch)
-		if err != nil {
-			base.WarnfCtx(ctx, "Error retrieving sequences via query during skipped sequence clean - #%d sequences treated as not found: %v", len(skippedSeqBatch), err)
+		base.InfofCtx(ctx, base.KeyCache, "Issuing skipped sequence clean query for %d sequences (db:%s).", len(batchSequences), base.MD(c.context.Name))
+		sequences := batchSequences
+		queryRanges(batchRanges, func() (LogEntries, error) {
+			return c.context.getChangesForSequences(ctx, sequences)
+		})
+		batchSequences, batchRanges = nil, nil
+	}
+
+	for _, skippedRange := range oldSkippedRanges {
+		if skippedRange.count() > int64(SkippedSeqCleanViewBatch) {
+			base.InfofCtx(ctx, base.KeyCache, "Issuing skipped sequence clean query for sequences #%d-#%d (db:%s).", skippedRange.start, skippedRange.end, base.MD(c.context.Name))
+			start, end := skippedRange.start, skippedRange.end
+			queryRanges([]SkippedSequence{skippedRange}, func() (LogEntries, error) {
+				return c.context.getChangesInChannelFromQuery(ctx, channels.UserStarChannel, start, end, 0, false)
+			})
 			continue
 		}
-
-		// Process found entries.  Add to foundEntries for subsequent cache processing, foundMap for pendingRemoval calculation below.
-		foundMap := make(map[uint64]struct{}, len(entries))
-		for _, foundEntry := range entries {
-			foundMap[foundEntry.Sequence] = struct{}{}
-			foundEntries = append(foundEntries, foundEntry)
+		for seq := skippedRange.start; seq <= skippedRange.end; seq++ {
+			batchSequences = append(batchSequences, seq)
 		}
-
-		// Add queried sequences not in the resultset to pendingRemovals
-		for _, skippedSeq := range skippedSeqBatch {
-			if _, ok := foundMap[skippedSeq]; !ok {
-				base.WarnfCtx(ctx, "Skipped Sequence %d didn't show up in MaxChannelLogMissingWaitTime, and isn't available from a * channel query.  If it's a valid sequence, it won't be replicated until Sync Gateway is restarted.", skippedSeq)
-				pendingRemovals = append(pendingRemovals, skippedSeq)
-			}
+		batchRanges = append(batchRanges, skippedRange)
+		if len(batchSequences) >= SkippedSeqCleanViewBatch {
+			queryBatch()
 		}
 	}
+	queryBatch()
 
 	// Issue processEntry for found entries.  Standard processEntry handling will remove these sequences from the skipped seq queue.
 	changedChannelsCombined := base.Set{}
@@ -388,10 +415,10 @@ func (c *changeCache) CleanSkippedSequenceQueue(ctx context.Context) error {
 	}
 
 	// Purge sequences not found from the skipped sequence queue
-	numRemoved := c.RemoveSkippedSequences(ctx, pendingRemovals)
+	numRemoved := c.RemoveSkippedRanges(ctx, pendingRemovals)
 	c.context.DbStats.Cache().AbandonedSeqs.Add(numRemoved)
 
-	base.InfofCtx(ctx, base.KeyCache, "CleanSkippedSequenceQueue complete.  Found:%d, Not Found:%d for database %s.", len(foundEntries), len(pendingRemovals), base.MD(c.context.Name))
+	base.InfofCtx(ctx, base.KeyCache, "CleanSkippedSequenceQueue complete.  Found:%d, Not Found:%d for database %s.", len(foundEntries), numRemoved, base.MD(c.context.Name))
 	return nil
 }
 
@@ -433,6 +460,9 @@ func (c *changeCache) DocChanged(event sgbucket.FeedEvent) {
 		return
 	}
 
+	// Cached responses for the doc may be stale, including when it was changed on another node or purged
+	c.context.docResponseCache.invalidate(docID)
+
 	// If this is a delete and there are no xattrs (no existing SG revision), we can ignore
 	if event.Opcode == sgbucket.FeedOpDeletion && len(docJSON) == 0 {
 		base.DebugfCtx(c.logCtx, base.KeyImport, "Ignoring delete mutation for %s - no existing Sync Gateway metadata.", base.UD(docID))
@@ -558,6 +588,14 @@ func (c *changeCache) DocChanged(event sgbucket.FeedEvent) {
 		TimeSaved:    syncData.TimeSaved,
 		Channels:     syncData.Channels,
 	}
+	for _, channelSetEntry := range syncData.ChannelSet {
+		if channelSetEntry.Start == syncData.Sequence && channelSetEntry.End == 0 {
+			if change.ChannelsAdded == nil {
+				change.ChannelsAdded = base.Set{}
+			}
+			change.ChannelsAdded.Add(channelSetEntry.Name)
+		}
+	}
 
 	millisecondLatency := int(feedLatency / time.Millisecond)
 
@@ -580,8 +618,11 @@ func (c *changeCache) DocChanged(event sgbucket.FeedEvent) {
 
 // Simplified principal limited to properties needed by caching
 type cachePrincipal struct {
-	Name     string `json:"name"`
-	Sequence uint64 `json:"sequence"`
+	Name            string            `json:"name"`
+	Sequence        uint64            `json:"sequence"`
+	Channels        channels.TimedSet `json:"all_channels"`                // Used for channel stats
+	ChannelInvalSeq uint64            `json:"channel_inval_seq,omitempty"` // Non-zero if Channels is pending recomputation
+	Deleted         bool              `json:"deleted,omitempty"`
 }
 
 func (c *changeCache) Remove(docIDs []string, startTime time.Time) (count int) {
@@ -641,6 +682,29 @@ func (c *changeCache) processUnusedSequenceRange(docID string) {
 		return
 	}
 
+	c.releaseUnusedSequenceRange(fromSequence, toSequence)
+}
+
+// releaseUnusedSequenceRange sends the unused sequences from fromSequence to toSequence (inclusive) to the cache for
+// buffering.  Also used by the sequence allocator to release sequences on this node without waiting for the unused
+// sequences document to arrive over the cache feed - sequences that have already been released are ignored.
+func (c *changeCache) releaseUnusedSequenceRange(fromSequence, toSequence uint64) {
+	// Sequences in the range that have already been skipped are removed from the skipped sequence queue as a range,
+	// rather than processed one at a time
+	c.lock.Lock()
+	if !c.logsDisabled && fromSequence < c.nextSequence {
+		skippedTo := toSequence
+		if skippedTo >= c.nextSequence {
+			skippedTo = c.nextSequence - 1
+		}
+		if numRemoved := c.skippedSeqs.RemoveRange(fromSequence, skippedTo); numRemoved > 0 {
+			base.InfofCtx(c.logCtx, base.KeyCache, "Received %d previously skipped unused sequences (#%d-#%d)", numRemoved, fromSequence, skippedTo)
+			c.updateSkippedSeqStats()
+		}
+		fromSequence = skippedTo + 1
+	}
+	c.lock.Unlock()
+
 	// TODO: There should be a more efficient way to do this
 	for seq := fromSequence; seq <= toSequence; seq++ {
 		c.releaseUnusedSequence(seq, time.Now())
@@ -663,6 +727,16 @@ func (c *changeCache) processPrincipalDoc(docID string, docJSON []byte, isUser b
 		return // Tap is sending us an old value from before I started up; ignore it
 	}
 
+	// A user's channels are invalidated when their access changes, until recomputed, so only update channel stats
+	// when they're known
+	if isUser {
+		if princ.Deleted {
+			c.channelStats.updateUserChannels(princ.Name, nil)
+		} else if princ.Channels != nil && princ.ChannelInvalSeq == 0 {
+			c.channelStats.updateUserChannels(princ.Name, princ.Channels.AsSet())
+		}
+	}
+
 	// Now add the (somewhat fictitious) entry:
 	change := &LogEntry{
 		Sequence:     sequence,
@@ -778,6 +852,9 @@ func (c *changeCache) _addToCache(change *LogEntry) []string {
 		return nil
 	}
 
+	// Update channel stats before adding to the channel cache, as it discards the change's channels
+	c.channelStats.addChange(change)
+
 	// updatedChannels tracks the set of channels that should be notified of the change.  This includes
 	// the change's active channels, as well as any channel removals for the active revision.
 	updatedChannels := c.channelCache.AddToCache(change)
@@ -806,9 +883,10 @@ func (c *changeCache) _addPendingLogs() base.Set {
 			heap.Pop(&c.pendingLogs)
 			changedChannels = changedChannels.UpdateWithSlice(c._addToCache(change))
 		} else if len(c.pendingLogs) > c.options.CachePendingSeqMaxNum || time.Since(c.pendingLogs[0].TimeReceived) >= c.options.CachePendingSeqMaxWait {
-			c.context.DbStats.Cache().NumSkippedSeqs.Add(1)
-			c.PushSkipped(c.nextSequence)
-			c.nextSequence++
+			// Skip the whole gap up to the oldest pending sequence as a single range
+			c.context.DbStats.Cache().NumSkippedSeqs.Add(int64(change.Sequence - c.nextSequence))
+			c.PushSkipped(c.nextSequence, change.Sequence-1)
+			c.nextSequence = change.Sequence
 		} else {
 			break
 		}
@@ -898,32 +976,46 @@ func (h *LogPriorityQueue) Pop() interface{} {
 
 func (c *changeCache) RemoveSkipped(x uint64) error {
 	err := c.skippedSeqs.Remove(x)
-	c.context.DbStats.Cache().SkippedSeqLen.Set(int64(c.skippedSeqs.skippedList.Len()))
+	c.updateSkippedSeqStats()
 	return err
 }
 
-// Removes a set of sequences.  Logs warning on removal error, returns count of successfully removed.
-func (c *changeCache) RemoveSkippedSequences(ctx context.Context, sequences []uint64) (removedCount int64) {
-	numRemoved := c.skippedSeqs.RemoveSequences(ctx, sequences)
-	c.context.DbStats.Cache().SkippedSeqLen.Set(int64(c.skippedSeqs.skippedList.Len()))
-	return numRemoved
+// Removes the sequences in a set of skipped sequence ranges that are still in the skipped sequence queue.  Logs warning
+// for the sequences removed, returns count of removed.
+func (c *changeCache) RemoveSkippedRanges(ctx context.Context, ranges []SkippedSequence) (removedCount int64) {
+	for _, skippedRange := range ranges {
+		numRemoved := c.skippedSeqs.RemoveRange(skippedRange.start, skippedRange.end)
+		if numRemoved > 0 {
+			base.WarnfCtx(ctx, "%d skipped sequences between #%d and #%d didn't show up in MaxChannelLogMissingWaitTime, and aren't available from a * channel query.  If they're valid sequences, they won't be replicated until Sync Gateway is restarted.", numRemoved, skippedRange.start, skippedRange.end)
+		}
+		removedCount += numRemoved
+	}
+	c.updateSkippedSeqStats()
+	return removedCount
 }
 
 func (c *changeCache) WasSkipped(x uint64) bool {
 	return c.skippedSeqs.Contains(x)
 }
 
-func (c *changeCache) PushSkipped(sequence uint64) {
-	err := c.skippedSeqs.Push(&SkippedSequence{seq: sequence, timeAdded: time.Now()})
+// PushSkipped adds the sequences from start to end (inclusive) to the skipped sequence queue as a single range.
+func (c *changeCache) PushSkipped(start, end uint64) {
+	err := c.skippedSeqs.Push(&SkippedSequence{start: start, end: end, timeAdded: c.clock.Now()})
 	if err != nil {
-		base.InfofCtx(c.logCtx, base.KeyCache, "Error pushing skipped sequence: %d, %v", sequence, err)
+		base.InfofCtx(c.logCtx, base.KeyCache, "Error pushing skipped sequences: #%d-#%d, %v", start, end, err)
 		return
 	}
-	c.context.DbStats.Cache().SkippedSeqLen.Set(int64(c.skippedSeqs.skippedList.Len()))
+	c.updateSkippedSeqStats()
 }
 
-func (c *changeCache) GetSkippedSequencesOlderThanMaxWait() (oldSequences []uint64) {
-	return c.skippedSeqs.getOlderThan(c.options.CacheSkippedSeqMaxWait)
+func (c *changeCache) updateSkippedSeqStats() {
+	numSequences, numRanges := c.skippedSeqs.getStats()
+	c.context.DbStats.Cache().SkippedSeqLen.Set(numSequences)
+	c.context.DbStats.Cache().SkippedSeqRanges.Set(numRanges)
+}
+
+func (c *changeCache) GetSkippedSequencesOlderThanMaxWait() (oldRanges []SkippedSequence) {
+	return c.skippedSeqs.getOlderThan(c.clock.Now(), c.options.CacheSkippedSeqMaxWait)
 }
 
 // waitForSequence blocks up to maxWaitTime until the given sequence has been received.
@@ -983,109 +1075,140 @@ func (c *changeCache) _getMaxStableCached() uint64 {
 	return c.nextSequence - 1
 }
 
-// SkippedSequenceList stores the set of skipped sequences as an ordered list of *SkippedSequence with an associated map
-// for sequence-based lookup.
+// SkippedSequenceList stores the set of skipped sequences as an ordered list of ranges of contiguous sequences, so that
+// large gaps in the sequences received (e.g. unused sequence batches) don't need an entry per sequence.  Ranges are
+// ordered by sequence, which is also the order they were added in, and lookups are by binary search.
 type SkippedSequenceList struct {
-	skippedList *list.List               // Ordered list of skipped sequences
-	skippedMap  map[uint64]*list.Element // Map from sequence to list elements
-	lock        sync.RWMutex             // Coordinates access to skippedSequenceList
+	skippedList  []*SkippedSequence // Ordered list of skipped sequence ranges
+	numSequences int64              // Total number of sequences in skippedList
+	lock         sync.RWMutex       // Coordinates access to skippedSequenceList
 }
 
 func NewSkippedSequenceList() *SkippedSequenceList {
-	return &SkippedSequenceList{
-		skippedMap:  map[uint64]*list.Element{},
-		skippedList: list.New(),
-	}
+	return &SkippedSequenceList{}
 }
 
-// getOldest returns the sequence of the first element in the skippedSequenceList
+// getOldest returns the lowest sequence in the skippedSequenceList
 func (l *SkippedSequenceList) getOldest() (oldestSkippedSeq uint64) {
 	l.lock.RLock()
-	if firstElement := l.skippedList.Front(); firstElement != nil {
-		value := firstElement.Value.(*SkippedSequence)
-		oldestSkippedSeq = value.seq
+	if len(l.skippedList) > 0 {
+		oldestSkippedSeq = l.skippedList[0].start
 	}
 	l.lock.RUnlock()
 	return oldestSkippedSeq
 }
 
+// getStats returns the number of sequences and the number of ranges in the list.
+func (l *SkippedSequenceList) getStats() (numSequences int64, numRanges int64) {
+	l.lock.RLock()
+	numSequences = l.numSequences
+	numRanges = int64(len(l.skippedList))
+	l.lock.RUnlock()
+	return numSequences, numRanges
+}
+
 // Removes a single entry from the list.
 func (l *SkippedSequenceList) Remove(x uint64) error {
 	l.lock.Lock()
-	err := l._remove(x)
+	removedCount := l._removeRange(x, x)
 	l.lock.Unlock()
-	return err
+	if removedCount == 0 {
+		return errors.New("Value not found")
+	}
+	return nil
 }
 
-func (l *SkippedSequenceList) RemoveSequences(ctx context.Context, sequences []uint64) (removedCount int64) {
+// RemoveRange removes any of the sequences from start to end (inclusive) that are in the list, returning the number
+// removed.
+func (l *SkippedSequenceList) RemoveRange(start, end uint64) (removedCount int64) {
 	l.lock.Lock()
-	for _, seq := range sequences {
-		err := l._remove(seq)
-		if err != nil {
-			base.WarnfCtx(ctx, "Error purging skipped sequence %d from skipped sequence queue: %v", seq, err)
-		} else {
-			removedCount++
-		}
-	}
+	removedCount = l._removeRange(start, end)
 	l.lock.Unlock()
 	return removedCount
 }
 
-// Removes an entry from the list.  Expects callers to hold l.lock.Lock
-func (l *SkippedSequenceList) _remove(x uint64) error {
-	if listElement, ok := l.skippedMap[x]; ok {
-		l.skippedList.Remove(listElement)
-		delete(l.skippedMap, x)
-		return nil
-	} else {
-		return errors.New("Value not found")
+// Removes the sequences from start to end from the list, splitting any range that's only partially removed.  Expects
+// callers to hold l.lock.Lock
+func (l *SkippedSequenceList) _removeRange(start, end uint64) (removedCount int64) {
+	i := l._search(start)
+	for i < len(l.skippedList) && l.skippedList[i].start <= end {
+		skipped := l.skippedList[i]
+		removeStart, removeEnd := skipped.start, skipped.end
+		if start > removeStart {
+			removeStart = start
+		}
+		if end < removeEnd {
+			removeEnd = end
+		}
+		removedCount += int64(removeEnd - removeStart + 1)
+
+		switch {
+		case removeStart == skipped.start && removeEnd == skipped.end:
+			copy(l.skippedList[i:], l.skippedList[i+1:])
+			l.skippedList[len(l.skippedList)-1] = nil
+			l.skippedList = l.skippedList[:len(l.skippedList)-1]
+			continue
+		case removeStart == skipped.start:
+			skipped.start = removeEnd + 1
+		case removeEnd == skipped.end:
+			skipped.end = removeStart - 1
+		default:
+			// Removal from the middle of the range splits it in two
+			remainder := &SkippedSequence{start: removeEnd + 1, end: skipped.end, timeAdded: skipped.timeAdded}
+			skipped.end = removeStart - 1
+			l.skippedList = append(l.skippedList, nil)
+			copy(l.skippedList[i+2:], l.skippedList[i+1:])
+			l.skippedList[i+1] = remainder
+		}
+		i++
 	}
+	l.numSequences -= removedCount
+	return removedCount
 }
 
-// Contains does a simple search to detect presence
+// Returns the index of the first range in the list that ends at or after x.  Expects callers to hold l.lock
+func (l *SkippedSequenceList) _search(x uint64) int {
+	return sort.Search(len(l.skippedList), func(i int) bool {
+		return l.skippedList[i].end >= x
+	})
+}
+
+// Contains does a binary search to detect presence
 func (l *SkippedSequenceList) Contains(x uint64) bool {
 	l.lock.RLock()
-	_, ok := l.skippedMap[x]
+	i := l._search(x)
+	found := i < len(l.skippedList) && l.skippedList[i].start <= x
 	l.lock.RUnlock()
-	return ok
+	return found
 }
 
-// Push sequence to the end of SkippedSequenceList.  Validates sequence ordering in list.
+// Push sequence range to the end of SkippedSequenceList.  Validates sequence ordering in list.
 func (l *SkippedSequenceList) Push(x *SkippedSequence) (err error) {
 
-	l.lock.Lock()
-	validPush := false
-	lastElement := l.skippedList.Back()
-	if lastElement == nil {
-		validPush = true
-	} else {
-		lastSkipped, _ := lastElement.Value.(*SkippedSequence)
-		if lastSkipped.seq < x.seq {
-			validPush = true
-		}
+	if x.end < x.start {
+		return errors.New("Can't push sequence range with end lower than start")
 	}
 
-	if validPush {
-		newListElement := l.skippedList.PushBack(x)
-		l.skippedMap[x.seq] = newListElement
+	l.lock.Lock()
+	if len(l.skippedList) == 0 || l.skippedList[len(l.skippedList)-1].end < x.start {
+		l.skippedList = append(l.skippedList, x)
+		l.numSequences += x.count()
 	} else {
 		err = errors.New("Can't push sequence lower than existing maximum")
 	}
-
 	l.lock.Unlock()
 	return err
 
 }
 
-// getOldest returns a slice of sequences older than the specified duration of the first element in the skippedSequenceList
-func (l *SkippedSequenceList) getOlderThan(skippedExpiry time.Duration) []uint64 {
+// getOlderThan returns copies of the sequence ranges that were added longer than the specified duration before now
+func (l *SkippedSequenceList) getOlderThan(now time.Time, skippedExpiry time.Duration) []SkippedSequence {
 
 	l.lock.RLock()
-	oldSequences := make([]uint64, 0)
-	for e := l.skippedList.Front(); e != nil; e = e.Next() {
-		skippedSeq := e.Value.(*SkippedSequence)
-		if time.Since(skippedSeq.timeAdded) > skippedExpiry {
-			oldSequences = append(oldSequences, skippedSeq.seq)
+	oldRanges := make([]SkippedSequence, 0)
+	for _, skipped := range l.skippedList {
+		if now.Sub(skipped.timeAdded) > skippedExpiry {
+			oldRanges = append(oldRanges, *skipped)
 		} else {
 			// skippedSeqs are ordered by arrival time, so can stop iterating once we find one
 			// still inside the time window
@@ -1093,5 +1216,5 @@ func (l *SkippedSequenceList) getOlderThan(skippedExpiry time.Duration) []uint64
 		}
 	}
 	l.lock.RUnlock()
-	return oldSequences
+	return oldRanges
 }
@@ -0,0 +1,73 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package db
+
+import (
+	"context"
+	"expvar"
+	"time"
+
+	"github.com/couchbase/sync_gateway/base"
+)
+
+// How often the cache feed's position is persisted, for detection of rollbacks while Sync Gateway isn't running
+const cacheFeedFailoverSnapshotInterval = time.Minute
+
+// initCacheFeedRollbackProtection protects the channel cache against server-side rollbacks of the cache feed's
+// vbuckets, which can discard mutations that have already been cached.  When a vbucket is rolled back, either while
+// the feed is running or while Sync Gateway was stopped, the caches of the channels holding changes to docs in that
+// vbucket are invalidated, rather than requiring Sync Gateway to be restarted.  Must be called before the cache feed is
+// started.
+func (dbCtx *DatabaseContext) initCacheFeedRollbackProtection(ctx context.Context, cacheFeedStats *expvar.Map) {
+	cbStore, ok := base.AsCouchbaseStore(dbCtx.Bucket)
+	if !ok {
+		return
+	}
+	maxVbNo, err := cbStore.GetMaxVbno()
+	if err != nil {
+		base.WarnfCtx(ctx, "Unable to determine number of vbuckets - cache feed rollback protection disabled: %v", err)
+		return
+	}
+
+	var priorSnapshot *base.DCPFailoverSnapshot
+	if _, err := dbCtx.Bucket.Get(base.DCPFailoverSnapshotKeyWithGroupID(dbCtx.Options.GroupID), &priorSnapshot); err != nil && !base.IsDocNotFoundError(err) {
+		base.WarnfCtx(ctx, "Unable to load cache feed failover snapshot - rollbacks while Sync Gateway wasn't running won't be detected: %v", err)
+	}
+
+	base.GetDCPFeedMonitor(cacheFeedStats).SetRollbackProtection(priorSnapshot, func(vbNo uint16, rollbackSeq uint64) {
+		dbCtx.onCacheFeedRollback(ctx, vbNo, rollbackSeq, maxVbNo)
+	})
+}
+
+// onCacheFeedRollback invalidates the caches of channels holding changes to docs in a vbucket that's been rolled back.
+// Changes aren't tracked by vbucket sequence, so every change in the vbucket is treated as potentially rolled back.
+func (dbCtx *DatabaseContext) onCacheFeedRollback(ctx context.Context, vbNo uint16, rollbackSeq uint64, maxVbNo uint16) {
+	dbCtx.DbStats.Cache().CacheFeedRollbackCount.Add(1)
+	if dbCtx.changeCache == nil || dbCtx.changeCache.getChannelCache() == nil {
+		return
+	}
+
+	invalidated := dbCtx.changeCache.getChannelCache().InvalidateChannels(func(change *LogEntry) bool {
+		return base.VBHash(change.DocID, int(maxVbNo)) == uint32(vbNo)
+	})
+	base.WarnfCtx(ctx, "Cache feed vbucket %d was rolled back by the server to sequence %d - invalidated %d channel caches holding changes from that vbucket", vbNo, rollbackSeq, invalidated)
+}
+
+// persistCacheFeedFailoverSnapshot persists the cache feed's current position, so a rollback that happens while Sync
+// Gateway isn't running can be detected when it restarts.
+func (dbCtx *DatabaseContext) persistCacheFeedFailoverSnapshot(ctx context.Context) error {
+	snapshot := base.GetDCPFeedMonitor(dbCtx.DbStats.Database().CacheFeedMapStats.Map).FailoverSnapshot()
+	if len(snapshot.Vbuckets) == 0 {
+		return nil
+	}
+	if err := dbCtx.Bucket.Set(base.DCPFailoverSnapshotKeyWithGroupID(dbCtx.Options.GroupID), 0, nil, snapshot); err != nil {
+		base.WarnfCtx(ctx, "Unable to persist cache feed failover snapshot: %v", err)
+	}
+	return nil
+}
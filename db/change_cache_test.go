@@ -77,11 +77,11 @@ func TestSkippedSequenceList(t *testing.T) {
 
 	skipList := NewSkippedSequenceList()
 	// Push values
-	assert.NoError(t, skipList.Push(&SkippedSequence{4, time.Now()}))
-	assert.NoError(t, skipList.Push(&SkippedSequence{7, time.Now()}))
-	assert.NoError(t, skipList.Push(&SkippedSequence{8, time.Now()}))
-	assert.NoError(t, skipList.Push(&SkippedSequence{12, time.Now()}))
-	assert.NoError(t, skipList.Push(&SkippedSequence{18, time.Now()}))
+	assert.NoError(t, skipList.Push(&SkippedSequence{4, 4, time.Now()}))
+	assert.NoError(t, skipList.Push(&SkippedSequence{7, 7, time.Now()}))
+	assert.NoError(t, skipList.Push(&SkippedSequence{8, 8, time.Now()}))
+	assert.NoError(t, skipList.Push(&SkippedSequence{12, 12, time.Now()}))
+	assert.NoError(t, skipList.Push(&SkippedSequence{18, 18, time.Now()}))
 	assert.True(t, verifySkippedSequences(skipList, []uint64{4, 7, 8, 12, 18}))
 
 	// Retrieval of low value
@@ -107,11 +107,68 @@ func TestSkippedSequenceList(t *testing.T) {
 	assert.True(t, verifySkippedSequences(skipList, []uint64{7}))
 
 	// Add an out-of-sequence entry (make sure bad sequencing doesn't throw us into an infinite loop)
-	assert.Error(t, skipList.Push(&SkippedSequence{6, time.Now()}))
-	assert.NoError(t, skipList.Push(&SkippedSequence{9, time.Now()}))
+	assert.Error(t, skipList.Push(&SkippedSequence{6, 6, time.Now()}))
+	assert.NoError(t, skipList.Push(&SkippedSequence{9, 9, time.Now()}))
 	assert.True(t, verifySkippedSequences(skipList, []uint64{7, 9}))
 }
 
+func TestSkippedSequenceListRanges(t *testing.T) {
+
+	skipList := NewSkippedSequenceList()
+	assert.NoError(t, skipList.Push(&SkippedSequence{5, 10, time.Now()}))
+	assert.NoError(t, skipList.Push(&SkippedSequence{20, 20, time.Now()}))
+	assert.NoError(t, skipList.Push(&SkippedSequence{30, 1000029, time.Now()}))
+	assert.Len(t, skipList.skippedList, 3)
+	numSequences, numRanges := skipList.getStats()
+	assert.Equal(t, int64(1000007), numSequences)
+	assert.Equal(t, int64(3), numRanges)
+
+	// Invalid and overlapping ranges can't be pushed
+	assert.Error(t, skipList.Push(&SkippedSequence{2000000, 1999999, time.Now()}))
+	assert.Error(t, skipList.Push(&SkippedSequence{1000029, 1000030, time.Now()}))
+
+	assert.Equal(t, uint64(5), skipList.getOldest())
+	assert.True(t, skipList.Contains(5))
+	assert.True(t, skipList.Contains(10))
+	assert.False(t, skipList.Contains(11))
+	assert.True(t, skipList.Contains(500000))
+	assert.False(t, skipList.Contains(1000030))
+
+	// Removal from the middle of a range splits it
+	assert.NoError(t, skipList.Remove(7))
+	assert.True(t, verifySkippedSequences(skipList, append([]uint64{5, 6, 8, 9, 10, 20}, sequenceRange(30, 1000029)...)))
+	assert.Len(t, skipList.skippedList, 4)
+
+	// Removal from either end of a range shrinks it
+	assert.NoError(t, skipList.Remove(5))
+	assert.NoError(t, skipList.Remove(10))
+	assert.Error(t, skipList.Remove(10))
+	assert.Equal(t, uint64(6), skipList.getOldest())
+
+	// Range removal spans multiple ranges, and only counts the sequences present
+	assert.Equal(t, int64(6), skipList.RemoveRange(6, 31))
+	assert.True(t, verifySkippedSequences(skipList, sequenceRange(32, 1000029)))
+	assert.Equal(t, int64(999998), skipList.RemoveRange(0, 2000000))
+	assert.Len(t, skipList.skippedList, 0)
+	assert.Equal(t, uint64(0), skipList.getOldest())
+
+	// Only ranges older than the expiry are returned
+	assert.NoError(t, skipList.Push(&SkippedSequence{40, 49, time.Now().Add(-time.Hour)}))
+	assert.NoError(t, skipList.Push(&SkippedSequence{60, 69, time.Now()}))
+	oldRanges := skipList.getOlderThan(time.Now(), time.Minute)
+	require.Len(t, oldRanges, 1)
+	assert.Equal(t, uint64(40), oldRanges[0].start)
+	assert.Equal(t, uint64(49), oldRanges[0].end)
+}
+
+func sequenceRange(start, end uint64) []uint64 {
+	sequences := make([]uint64, 0, end-start+1)
+	for seq := start; seq <= end; seq++ {
+		sequences = append(sequences, seq)
+	}
+	return sequences
+}
+
 func TestLateSequenceHandling(t *testing.T) {
 
 	context, ctx := setupTestDBWithCacheOptions(t, DefaultCacheOptions())
@@ -1296,15 +1353,82 @@ func TestSkippedViewRetrieval(t *testing.T) {
 
 	// Artificially add skipped sequences to queue, and back date skipped entry by 2 hours to trigger attempted view retrieval during Clean call
 	// Sequences '3', '7', '10', '13' and '14' exist, should be found.
-	require.NoError(t, changeCache.skippedSeqs.Push(&SkippedSequence{3, time.Now().Add(time.Duration(time.Hour * -2))}))
-	require.NoError(t, changeCache.skippedSeqs.Push(&SkippedSequence{5, time.Now().Add(time.Duration(time.Hour * -2))}))
-	require.NoError(t, changeCache.skippedSeqs.Push(&SkippedSequence{6, time.Now().Add(time.Duration(time.Hour * -2))}))
-	require.NoError(t, changeCache.skippedSeqs.Push(&SkippedSequence{7, time.Now().Add(time.Duration(time.Hour * -2))}))
-	require.NoError(t, changeCache.skippedSeqs.Push(&SkippedSequence{10, time.Now().Add(time.Duration(time.Hour * -2))}))
-	require.NoError(t, changeCache.skippedSeqs.Push(&SkippedSequence{11, time.Now().Add(time.Duration(time.Hour * -2))}))
-	require.NoError(t, changeCache.skippedSeqs.Push(&SkippedSequence{12, time.Now().Add(time.Duration(time.Hour * -2))}))
-	require.NoError(t, changeCache.skippedSeqs.Push(&SkippedSequence{13, time.Now().Add(time.Duration(time.Hour * -2))}))
-	require.NoError(t, changeCache.skippedSeqs.Push(&SkippedSequence{14, time.Now().Add(time.Duration(time.Hour * -2))}))
+	require.NoError(t, changeCache.skippedSeqs.Push(&SkippedSequence{3, 3, time.Now().Add(time.Duration(time.Hour * -2))}))
+	require.NoError(t, changeCache.skippedSeqs.Push(&SkippedSequence{5, 5, time.Now().Add(time.Duration(time.Hour * -2))}))
+	require.NoError(t, changeCache.skippedSeqs.Push(&SkippedSequence{6, 6, time.Now().Add(time.Duration(time.Hour * -2))}))
+	require.NoError(t, changeCache.skippedSeqs.Push(&SkippedSequence{7, 7, time.Now().Add(time.Duration(time.Hour * -2))}))
+	require.NoError(t, changeCache.skippedSeqs.Push(&SkippedSequence{10, 10, time.Now().Add(time.Duration(time.Hour * -2))}))
+	require.NoError(t, changeCache.skippedSeqs.Push(&SkippedSequence{11, 11, time.Now().Add(time.Duration(time.Hour * -2))}))
+	require.NoError(t, changeCache.skippedSeqs.Push(&SkippedSequence{12, 12, time.Now().Add(time.Duration(time.Hour * -2))}))
+	require.NoError(t, changeCache.skippedSeqs.Push(&SkippedSequence{13, 13, time.Now().Add(time.Duration(time.Hour * -2))}))
+	require.NoError(t, changeCache.skippedSeqs.Push(&SkippedSequence{14, 14, time.Now().Add(time.Duration(time.Hour * -2))}))
+	cleanErr := changeCache.CleanSkippedSequenceQueue(ctx)
+	assert.NoError(t, cleanErr, "CleanSkippedSequenceQueue returned error")
+
+	// Validate expected entries
+	require.NoError(t, db.changeCache.waitForSequence(ctx, 15, base.DefaultWaitForSequence))
+	entries, err := db.changeCache.GetChanges("ABC", getChangesOptionsWithSeq(SequenceID{Seq: 2}))
+	assert.NoError(t, err, "Get Changes returned error")
+	assert.Equal(t, 6, len(entries))
+	log.Printf("entries: %v", entries)
+	if len(entries) == 6 {
+		assert.Equal(t, "doc-3", entries[0].DocID)
+		assert.Equal(t, "doc-7", entries[1].DocID)
+		assert.Equal(t, "doc-10", entries[2].DocID)
+		assert.Equal(t, "doc-13", entries[3].DocID)
+		assert.Equal(t, "doc-14", entries[4].DocID)
+		assert.Equal(t, "doc-15", entries[5].DocID)
+	}
+
+}
+
+// Test retrieval of skipped sequence ranges using view.  Ranges no larger than SkippedSeqCleanViewBatch are retrieved by
+// sequence, and larger ranges by sequence range query.
+func TestSkippedViewRetrievalRanges(t *testing.T) {
+
+	base.LongRunningTest(t)
+
+	if base.TestUseXattrs() {
+		t.Skip("This test does not work with XATTRs due to calling WriteDirect().  Skipping.")
+	}
+
+	base.SetUpTestLogging(t, base.LevelDebug, base.KeyCache)
+
+	originalBatchSize := SkippedSeqCleanViewBatch
+	SkippedSeqCleanViewBatch = 4
+	defer func() {
+		SkippedSeqCleanViewBatch = originalBatchSize
+	}()
+
+	// Use leaky bucket to have the tap feed 'lose' document 3
+	leakyConfig := base.LeakyBucketConfig{
+		TapFeedMissingDocs: []string{"doc-3", "doc-7", "doc-10", "doc-13", "doc-14"},
+	}
+	db, ctx := setupTestLeakyDBWithCacheOptions(t, DefaultCacheOptions(), leakyConfig)
+	defer db.Close(ctx)
+	db.ChannelMapper = channels.NewDefaultChannelMapper()
+
+	// Allow db to initialize and run initial CleanSkippedSequenceQueue
+	time.Sleep(10 * time.Millisecond)
+
+	// Write sequences direct
+	WriteDirect(db, []string{"ABC"}, 1)
+	WriteDirect(db, []string{"ABC"}, 2)
+	WriteDirect(db, []string{"ABC"}, 3)
+	WriteDirect(db, []string{"ABC"}, 7)
+	WriteDirect(db, []string{"ABC"}, 10)
+	WriteDirect(db, []string{"ABC"}, 13)
+	WriteDirect(db, []string{"ABC"}, 14)
+	WriteDirect(db, []string{"ABC"}, 15)
+
+	changeCache := db.changeCache
+
+	// Artificially add skipped sequence ranges to queue, and back date skipped entries by 2 hours to trigger attempted view retrieval during
+	// Clean call.  Sequences '3', '7', '10', '13' and '14' exist, should be found.
+	require.NoError(t, changeCache.skippedSeqs.Push(&SkippedSequence{3, 3, time.Now().Add(time.Duration(time.Hour * -2))}))
+	require.NoError(t, changeCache.skippedSeqs.Push(&SkippedSequence{5, 7, time.Now().Add(time.Duration(time.Hour * -2))}))
+	// Range larger than SkippedSeqCleanViewBatch is queried by sequence range
+	require.NoError(t, changeCache.skippedSeqs.Push(&SkippedSequence{10, 14, time.Now().Add(time.Duration(time.Hour * -2))}))
 	cleanErr := changeCache.CleanSkippedSequenceQueue(ctx)
 	assert.NoError(t, cleanErr, "CleanSkippedSequenceQueue returned error")
 
@@ -1352,7 +1476,7 @@ func TestStopChangeCache(t *testing.T) {
 	WriteDirect(db, []string{"ABC"}, 3)
 
 	// Artificially add 3 skipped, and back date skipped entry by 2 hours to trigger attempted view retrieval during Clean call
-	err := db.changeCache.skippedSeqs.Push(&SkippedSequence{3, time.Now().Add(time.Duration(time.Hour * -2))})
+	err := db.changeCache.skippedSeqs.Push(&SkippedSequence{3, 3, time.Now().Add(time.Duration(time.Hour * -2))})
 	require.NoError(t, err)
 
 	// tear down the DB.  Should stop the cache before view retrieval of the skipped sequence is attempted.
@@ -1415,20 +1539,21 @@ func shortWaitCache() CacheOptions {
 }
 
 func verifySkippedSequences(list *SkippedSequenceList, sequences []uint64) bool {
-	if len(list.skippedMap) != len(sequences) {
-		log.Printf("verifySkippedSequences: skippedMap size (%v) not equals to sequences size (%v)",
-			len(list.skippedMap), len(sequences))
+	if list.numSequences != int64(len(sequences)) {
+		log.Printf("verifySkippedSequences: numSequences (%v) not equals to sequences size (%v)",
+			list.numSequences, len(sequences))
 		return false
 	}
 
 	i := -1
-	for e := list.skippedList.Front(); e != nil; e = e.Next() {
-		i++
-		skippedSeq := e.Value.(*SkippedSequence)
-		if skippedSeq.seq != sequences[i] {
-			log.Printf("verifySkippedSequences: sequence mismatch at index %v, queue=%v, sequences=%v",
-				i, skippedSeq.seq, sequences[i])
-			return false
+	for _, skippedRange := range list.skippedList {
+		for seq := skippedRange.start; seq <= skippedRange.end; seq++ {
+			i++
+			if i >= len(sequences) || seq != sequences[i] {
+				log.Printf("verifySkippedSequences: sequence mismatch at index %v, queue=%v, sequences=%v",
+					i, seq, sequences)
+				return false
+			}
 		}
 	}
 	if i != len(sequences)-1 {
@@ -28,26 +28,48 @@ import (
 // changes.
 type changeListener struct {
 	bucket                base.Bucket
-	bucketName            string                 // Used for logging
-	tapFeed               base.TapFeed           // Observes changes to bucket
-	tapNotifier           *sync.Cond             // Posts notifications when documents are updated
-	FeedArgs              sgbucket.FeedArguments // The Tap Args (backfill, etc)
-	counter               uint64                 // Event counter; increments on every doc update
-	terminateCheckCounter uint64                 // Termination Event counter; increments on every notifyCheckForTermination
-	keyCounts             map[string]uint64      // Latest count at which each doc key was updated
-	OnDocChanged          DocChangedFunc         // Called when change arrives on feed
-	terminator            chan bool              // Signal to cause cbdatasource bucketdatasource.Close() to be called, which removes dcp receiver
-	sgCfgPrefix           string                 // SG config key prefix
+	bucketName            string                   // Used for logging
+	tapFeed               base.TapFeed             // Observes changes to bucket
+	notifyLock            sync.Mutex               // Guards the counters, keyCounts and subscriptions
+	subscriptions         map[string]subscriberSet // Subscriptions of waiting ChangeWaiters for each key, shared by all waiters on that key
+	allSubscriptions      subscriberSet            // Subscriptions of all waiting ChangeWaiters, woken by termination checks and stopping
+	FeedArgs              sgbucket.FeedArguments   // The Tap Args (backfill, etc)
+	counter               uint64                   // Event counter; increments on every doc update
+	terminateCheckCounter uint64                   // Termination Event counter; increments on every notifyCheckForTermination
+	keyCounts             map[string]uint64        // Latest count at which each doc key was updated
+	OnDocChanged          DocChangedFunc           // Called when change arrives on feed
+	terminator            chan bool                // Signal to cause cbdatasource bucketdatasource.Close() to be called, which removes dcp receiver
+	sgCfgPrefix           string                   // SG config key prefix
+	chaos                 *base.FeedChaos          // Test only - holds back or discards feed events, nil unless set in DatabaseContextOptions
 }
 
 type DocChangedFunc func(event sgbucket.FeedEvent)
 
+// listenerSubscription registers a waiting ChangeWaiter with the changeListener for the duration of a Wait.  Notifying a
+// key only wakes the subscriptions to that key, through a non-blocking send on wakeup, so that thousands of continuous
+// feeds waiting on other channels aren't all woken to recheck their counters on every notification.
+type listenerSubscription struct {
+	keys   []string
+	wakeup chan struct{}
+}
+
+type subscriberSet map[*listenerSubscription]struct{}
+
+// wake signals the subscription's waiter, without blocking if it has already been signalled.
+func (sub *listenerSubscription) wake() {
+	select {
+	case sub.wakeup <- struct{}{}:
+	default:
+	}
+}
+
 func (listener *changeListener) Init(name string, groupID string) {
 	listener.bucketName = name
 	listener.counter = 1
 	listener.terminateCheckCounter = 0
 	listener.keyCounts = map[string]uint64{}
-	listener.tapNotifier = sync.NewCond(&sync.Mutex{})
+	listener.subscriptions = map[string]subscriberSet{}
+	listener.allSubscriptions = subscriberSet{}
 	listener.sgCfgPrefix = base.SGCfgPrefixWithGroupID(groupID)
 }
 
@@ -106,6 +128,9 @@ func (listener *changeListener) StartMutationFeed(bucket base.Bucket, dbStats *e
 // ProcessFeedEvent is invoked for each mutate or delete event seen on the server's mutation feed (TAP or DCP).  Uses document
 // key to determine handling, based on whether the incoming mutation is an internal Sync Gateway document.
 func (listener *changeListener) ProcessFeedEvent(event sgbucket.FeedEvent) bool {
+	if listener.chaos != nil && !listener.chaos.Deliver() {
+		return false
+	}
 	requiresCheckpointPersistence := true
 	if event.Opcode == sgbucket.FeedOpMutation || event.Opcode == sgbucket.FeedOpDeletion {
 		key := string(event.Key)
@@ -152,10 +177,10 @@ func (listener *changeListener) Stop() {
 		close(listener.terminator)
 	}
 
-	if listener.tapNotifier != nil {
-		// Unblock any change listeners blocked on tapNotifier.Wait()
-		listener.tapNotifier.Broadcast()
-	}
+	// Unblock any change listeners blocked in Wait()
+	listener.notifyLock.Lock()
+	listener._wakeAll()
+	listener.notifyLock.Unlock()
 
 	if listener.tapFeed != nil {
 		err := listener.tapFeed.Close()
@@ -186,15 +211,17 @@ func (listener *changeListener) Notify(keys base.Set) {
 	if len(keys) == 0 {
 		return
 	}
-	listener.tapNotifier.L.Lock()
+	listener.notifyLock.Lock()
 	listener.counter++
 	for key := range keys {
 		listener.keyCounts[key] = listener.counter
+		for sub := range listener.subscriptions[key] {
+			sub.wake()
+		}
 	}
 	base.DebugfCtx(context.TODO(), base.KeyChanges, "Notifying that %q changed (keys=%q) count=%d",
 		base.MD(listener.bucketName), base.UD(keys), listener.counter)
-	listener.tapNotifier.Broadcast()
-	listener.tapNotifier.L.Unlock()
+	listener.notifyLock.Unlock()
 }
 
 // Changes the counter, notifying waiting clients.
@@ -202,7 +229,7 @@ func (listener *changeListener) NotifyCheckForTermination(keys base.Set) {
 	if len(keys) == 0 {
 		return
 	}
-	listener.tapNotifier.L.Lock()
+	listener.notifyLock.Lock()
 
 	// Increment terminateCheckCounter, but loop back to zero
 	//if we have reached maximum value for uint64 type
@@ -213,23 +240,71 @@ func (listener *changeListener) NotifyCheckForTermination(keys base.Set) {
 	}
 
 	base.DebugfCtx(context.TODO(), base.KeyChanges, "Notifying to check for _changes feed termination")
-	listener.tapNotifier.Broadcast()
-	listener.tapNotifier.L.Unlock()
+	listener._wakeAll()
+	listener.notifyLock.Unlock()
 }
 
 func (listener *changeListener) notifyStopping() {
-	listener.tapNotifier.L.Lock()
+	listener.notifyLock.Lock()
 	listener.counter = 0
 	listener.keyCounts = map[string]uint64{}
 	base.DebugfCtx(context.TODO(), base.KeyChanges, "Notifying that changeListener is stopping")
-	listener.tapNotifier.Broadcast()
-	listener.tapNotifier.L.Unlock()
+	listener._wakeAll()
+	listener.notifyLock.Unlock()
+}
+
+// Wakes all waiting subscriptions.  Expects callers to hold notifyLock
+func (listener *changeListener) _wakeAll() {
+	for sub := range listener.allSubscriptions {
+		sub.wake()
+	}
+}
+
+// Registers a subscription to the given keys.  Expects callers to hold notifyLock
+func (listener *changeListener) _subscribe(keys []string) *listenerSubscription {
+	sub := &listenerSubscription{
+		keys:   keys,
+		wakeup: make(chan struct{}, 1),
+	}
+	if listener.subscriptions == nil {
+		listener.subscriptions = map[string]subscriberSet{}
+		listener.allSubscriptions = subscriberSet{}
+	}
+	for _, key := range keys {
+		keySubscriptions, ok := listener.subscriptions[key]
+		if !ok {
+			keySubscriptions = subscriberSet{}
+			listener.subscriptions[key] = keySubscriptions
+		}
+		keySubscriptions[sub] = struct{}{}
+	}
+	listener.allSubscriptions[sub] = struct{}{}
+	return sub
+}
+
+// Removes a subscription, and the subscription sets of keys that no longer have any.  Expects callers to hold notifyLock
+func (listener *changeListener) _unsubscribe(sub *listenerSubscription) {
+	for _, key := range sub.keys {
+		if keySubscriptions, ok := listener.subscriptions[key]; ok {
+			delete(keySubscriptions, sub)
+			if len(keySubscriptions) == 0 {
+				delete(listener.subscriptions, key)
+			}
+		}
+	}
+	delete(listener.allSubscriptions, sub)
 }
 
 // Waits until either the counter, or terminateCheckCounter exceeds the given value. Returns the new counters.
 func (listener *changeListener) Wait(keys []string, counter uint64, terminateCheckCounter uint64) (uint64, uint64) {
-	listener.tapNotifier.L.Lock()
-	defer listener.tapNotifier.L.Unlock()
+	listener.notifyLock.Lock()
+	var sub *listenerSubscription
+	defer func() {
+		if sub != nil {
+			listener._unsubscribe(sub)
+		}
+		listener.notifyLock.Unlock()
+	}()
 	base.DebugfCtx(context.TODO(), base.KeyChanges, "No new changes to send to change listener.  Waiting for %q's count to pass %d",
 		base.MD(listener.bucketName), counter)
 
@@ -240,23 +315,27 @@ func (listener *changeListener) Wait(keys []string, counter uint64, terminateChe
 			return curCounter, listener.terminateCheckCounter
 		}
 
-		listener.tapNotifier.Wait()
+		// Subscribe before releasing the lock, so that notifications made while waiting aren't missed
+		if sub == nil {
+			sub = listener._subscribe(keys)
+		}
+		listener.notifyLock.Unlock()
 
-		// Don't go back through the for loop if this changeListener was terminated
 		select {
+		case <-sub.wakeup:
+			listener.notifyLock.Lock()
 		case <-listener.terminator:
+			// Don't go back through the for loop if this changeListener was terminated
+			listener.notifyLock.Lock()
 			return 0, 0
-		default:
-			// do nothing
 		}
-
 	}
 }
 
 // Returns the max value of the counter for all the given keys
 func (listener *changeListener) CurrentCount(keys []string) uint64 {
-	listener.tapNotifier.L.Lock()
-	defer listener.tapNotifier.L.Unlock()
+	listener.notifyLock.Lock()
+	defer listener.notifyLock.Unlock()
 	return listener._currentCount(keys)
 }
 
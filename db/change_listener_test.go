@@ -13,6 +13,7 @@ package db
 import (
 	"log"
 	"testing"
+	"time"
 
 	"github.com/couchbase/sync_gateway/auth"
 	"github.com/couchbase/sync_gateway/base"
@@ -133,3 +134,57 @@ func TestUserWaiterForRoleChange(t *testing.T) {
 	// Wait for user notification of updated role
 	require.True(t, WaitForUserWaiterChange(userWaiter))
 }
+
+// TestChangeListenerSubscriptions ensures notifying a key only wakes the waiters on that key, and that the subscriptions
+// of waiters are removed once they stop waiting.
+func TestChangeListenerSubscriptions(t *testing.T) {
+	var listener changeListener
+	listener.Init("testBucket", "")
+
+	waitResult := func(waiter *ChangeWaiter) chan uint32 {
+		result := make(chan uint32, 1)
+		go func() {
+			result <- waiter.Wait()
+		}()
+		return result
+	}
+	waitForSubscriptions := func(expected int) {
+		_, ok := base.WaitForStat(func() int64 {
+			listener.notifyLock.Lock()
+			defer listener.notifyLock.Unlock()
+			return int64(len(listener.allSubscriptions))
+		}, int64(expected))
+		require.True(t, ok)
+	}
+
+	waiterABC := listener.NewWaiter([]string{"ABC"})
+	waiterDEF := listener.NewWaiter([]string{"DEF"})
+	resultABC := waitResult(waiterABC)
+	resultDEF := waitResult(waiterDEF)
+	waitForSubscriptions(2)
+
+	listener.Notify(base.SetOf("ABC"))
+	select {
+	case result := <-resultABC:
+		assert.Equal(t, WaiterHasChanges, result)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Waiter on notified key wasn't woken")
+	}
+	waitForSubscriptions(1)
+	select {
+	case <-resultDEF:
+		t.Fatal("Waiter on other key shouldn't be woken")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Termination checks wake all waiters
+	listener.NotifyCheckForTermination(base.SetOf("DEF"))
+	select {
+	case result := <-resultDEF:
+		assert.Equal(t, WaiterCheckTerminated, result)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Waiter wasn't woken by termination check")
+	}
+	waitForSubscriptions(0)
+	assert.Len(t, listener.subscriptions, 0)
+}
@@ -74,6 +74,40 @@ const (
 
 type ChangeRev map[string]string // Key is always "rev", value is rev ID
 
+const (
+	DefaultChangesQueryConcurrency = 10  // Default number of channels queried concurrently by a changes request
+	MaxChangesQueryConcurrency     = 100 // Maximum configurable number of channels queried concurrently by a changes request
+)
+
+// MaxChangesCoalesceWindowMs limits how long a waiting changes feed can be delayed after being woken, as it adds to the
+// latency of every change sent to caught up clients.
+const MaxChangesCoalesceWindowMs = 1000
+
+// changesQuerySlots bound the number of channels that a changes request retrieves changes for concurrently.  Each
+// channel's feed retrieves its changes in its own goroutine, and the results are merged by sequence, so without a bound
+// a backfill for a user with many channels would issue a query for every channel at once.
+type changesQuerySlots chan struct{}
+
+func newChangesQuerySlots(concurrency int) changesQuerySlots {
+	if concurrency <= 0 {
+		concurrency = DefaultChangesQueryConcurrency
+	}
+	return make(changesQuerySlots, concurrency)
+}
+
+// getChanges retrieves changes from the channel cache while holding a slot.  Returns ok=false without retrieving
+// changes if the changes request is terminated while waiting for a slot.
+func (s changesQuerySlots) getChanges(singleChannelCache SingleChannelCache, options ChangesOptions) (changes []*LogEntry, ok bool, err error) {
+	select {
+	case s <- struct{}{}:
+	case <-options.ChangesCtx.Done():
+		return nil, false, nil
+	}
+	defer func() { <-s }()
+	changes, err = singleChannelCache.GetChanges(options)
+	return changes, true, err
+}
+
 type ViewDoc struct {
 	Json json.RawMessage // should be type 'document', but that fails to unmarshal correctly
 }
@@ -135,6 +169,28 @@ func (db *Database) addDocToChangeEntry(ctx context.Context, entry *ChangeEntry,
 
 }
 
+// waitForChangesCoalesceWindow delays a feed woken by a change for the database's coalescing window, if any, so that the
+// rest of a burst of writes is sent in the same batch rather than waking the feed for each.  Returns false if the
+// changes request was cancelled.
+func (db *Database) waitForChangesCoalesceWindow(changesCtx context.Context) bool {
+	if db.Options.ChangesCoalesceWindow <= 0 {
+		select {
+		case <-changesCtx.Done():
+			return false
+		default:
+			return true
+		}
+	}
+	timer := time.NewTimer(db.Options.ChangesCoalesceWindow)
+	defer timer.Stop()
+	select {
+	case <-changesCtx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
 func (db *Database) AddDocToChangeEntryUsingRevCache(ctx context.Context, entry *ChangeEntry, revID string) (err error) {
 	rev, err := db.getRev(ctx, entry.ID, revID, 0, nil, RevCacheIncludeBody)
 	if err != nil {
@@ -166,6 +222,7 @@ func (db *Database) AddDocInstanceToChangeEntry(ctx context.Context, entry *Chan
 		var err error
 		entry.Doc, _, err = db.get1xRevFromDoc(ctx, doc, revID, false)
 		db.DbStats.Database().NumDocReadsRest.Add(1)
+		db.CollectionStats.NumDocReadsRest.Add(1)
 		if err != nil {
 			base.WarnfCtx(ctx, "Changes feed: error getting doc %q/%q: %v", base.UD(doc.ID), revID, err)
 		}
@@ -179,7 +236,7 @@ func (db *Database) AddDocInstanceToChangeEntry(ctx context.Context, entry *Chan
 // This is used in this function in 'wasDocInChannelAtSeq'.
 // revokeFrom: This is the point at which we should run the changes feed from to find the documents we should revoke. It
 // is calculated higher up based on whether we are resuming an interrupted feed or not.
-func (db *Database) buildRevokedFeed(ctx context.Context, channelName string, options ChangesOptions, revokedAt, revocationSinceSeq, revokeFrom uint64, to string) <-chan *ChangeEntry {
+func (db *Database) buildRevokedFeed(ctx context.Context, querySlots changesQuerySlots, channelName string, options ChangesOptions, revokedAt, revocationSinceSeq, revokeFrom uint64, to string) <-chan *ChangeEntry {
 	feed := make(chan *ChangeEntry, 1)
 	sinceVal := options.Since.Seq
 
@@ -218,7 +275,11 @@ func (db *Database) buildRevokedFeed(ctx context.Context, channelName string, op
 
 			// Get changes from 0 to latest seq
 			base.TracefCtx(ctx, base.KeyChanges, "Querying channel %q for revocation with options: %+v", base.UD(singleChannelCache.ChannelName()), paginationOptions)
-			changes, err := singleChannelCache.GetChanges(paginationOptions)
+			changes, ok, err := querySlots.getChanges(singleChannelCache, paginationOptions)
+			if !ok {
+				base.DebugfCtx(ctx, base.KeyChanges, "Terminating revocation channel feed %s", base.UD(to))
+				return
+			}
 			if err != nil {
 				base.WarnfCtx(ctx, "Error retrieving changes for channel %q: %v", base.UD(singleChannelCache.ChannelName()), err)
 				change := ChangeEntry{
@@ -368,7 +429,7 @@ func (db *Database) wasDocInChannelPriorToRevocation(ctx context.Context, docID,
 
 // Creates a Go-channel of all the changes made on a channel.
 // Does NOT handle the Wait option. Does NOT check authorization.
-func (db *Database) changesFeed(ctx context.Context, singleChannelCache SingleChannelCache, options ChangesOptions, to string) <-chan *ChangeEntry {
+func (db *Database) changesFeed(ctx context.Context, querySlots changesQuerySlots, singleChannelCache SingleChannelCache, options ChangesOptions, to string) <-chan *ChangeEntry {
 
 	feed := make(chan *ChangeEntry, 1)
 
@@ -402,7 +463,11 @@ func (db *Database) changesFeed(ctx context.Context, singleChannelCache SingleCh
 
 			// TODO: pass db.Ctx down to changeCache?
 			base.TracefCtx(ctx, base.KeyChanges, "Querying channel %q with options: %+v", base.UD(singleChannelCache.ChannelName()), paginationOptions)
-			changes, err := singleChannelCache.GetChanges(paginationOptions)
+			changes, ok, err := querySlots.getChanges(singleChannelCache, paginationOptions)
+			if !ok {
+				base.DebugfCtx(ctx, base.KeyChanges, "Terminating channel feed %s", base.UD(to))
+				return
+			}
 			if err != nil {
 				base.WarnfCtx(ctx, "Error retrieving changes for channel %q: %v", base.UD(singleChannelCache.ChannelName()), err)
 				change := ChangeEntry{
@@ -626,6 +691,9 @@ func (db *Database) SimpleMultiChangesFeed(ctx context.Context, chans base.Set,
 		var userChanged bool                // Whether the user document has changed in a given iteration loop
 		var deferredBackfill bool           // Whether there's a backfill identified in the user doc that's deferred while the SG cache catches up
 
+		// Slots shared by the channel feeds of every iteration, to bound the channels queried concurrently
+		querySlots := newChangesQuerySlots(db.Options.ChangesQueryConcurrency)
+
 		// Retrieve the current max cached sequence - ensures there isn't a race between the subsequent channel cache queries
 		currentCachedSequence = db.changeCache.getChannelCache().GetHighCacheSequence()
 		if options.Wait {
@@ -787,7 +855,7 @@ func (db *Database) SimpleMultiChangesFeed(ctx context.Context, chans base.Set,
 					chanOpts.Since = SequenceID{Seq: options.Since.TriggeredBy - 1}
 				}
 
-				feed := db.changesFeed(ctx, singleChannelCache, chanOpts, to)
+				feed := db.changesFeed(ctx, querySlots, singleChannelCache, chanOpts, to)
 				feeds = append(feeds, feed)
 
 			}
@@ -820,7 +888,7 @@ func (db *Database) SimpleMultiChangesFeed(ctx context.Context, chans base.Set,
 						}
 					}
 
-					feed := db.buildRevokedFeed(ctx, channel, options, revokedSeq, revocationSinceSeq, revokeFrom, to)
+					feed := db.buildRevokedFeed(ctx, querySlots, channel, options, revokedSeq, revocationSinceSeq, revokeFrom, to)
 					feeds = append(feeds, feed)
 				}
 			}
@@ -983,12 +1051,10 @@ func (db *Database) SimpleMultiChangesFeed(ctx context.Context, chans base.Set,
 				if waitResponse == WaiterClosed {
 					break outer
 				} else if waitResponse == WaiterHasChanges {
-					select {
-					case <-options.ChangesCtx.Done():
+					if !db.waitForChangesCoalesceWindow(options.ChangesCtx) {
 						return
-					default:
-						break waitForChanges
 					}
+					break waitForChanges
 				} else if waitResponse == WaiterCheckTerminated {
 					// Check whether I was terminated while waiting for a change.  If not, resume wait.
 					select {
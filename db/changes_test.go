@@ -499,3 +499,27 @@ func BenchmarkChangesFeedDocUnmarshalling(b *testing.B) {
 	}
 
 }
+
+func TestChangesQuerySlots(t *testing.T) {
+	assert.Equal(t, DefaultChangesQueryConcurrency, cap(newChangesQuerySlots(0)))
+
+	querySlots := newChangesQuerySlots(1)
+	testStats := (base.NewSyncGatewayStats()).NewDBStats("", false, false, false).Cache()
+	singleCache := newSingleChannelCache(&testQueryHandler{}, "ABC", 0, testStats)
+	singleCache.addToCache(testLogEntry(1, "doc1", "1-a"), false)
+
+	ctx, cancel := context.WithCancel(base.TestCtx(t))
+	options := ChangesOptions{ChangesCtx: ctx, LoggingCtx: ctx}
+	changes, ok, err := querySlots.getChanges(singleCache, options)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Len(t, changes, 1)
+	assert.Len(t, querySlots, 0, "Slot should be released after retrieving changes")
+
+	// While all slots are held, retrieval waits until the changes request is terminated
+	querySlots <- struct{}{}
+	cancel()
+	_, ok, err = querySlots.getChanges(singleCache, options)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
@@ -47,6 +47,10 @@ type ChannelCache interface {
 	// Remove purges the given doc IDs from all channel caches and returns the number of items removed.
 	Remove(docIDs []string, startTime time.Time) (count int)
 
+	// InvalidateChannels removes the caches of all channels holding a matching change, so they're reloaded from the
+	// bucket when next requested.  Returns the number of channel caches removed.
+	InvalidateChannels(matches func(change *LogEntry) bool) (count int)
+
 	// Returns set of changes for a given channel, within the bounds specified in options
 	GetChanges(channelName string, options ChangesOptions) ([]*LogEntry, error)
 
@@ -56,6 +60,9 @@ type ChannelCache interface {
 	// Clear reinitializes the cache to an empty state
 	Clear()
 
+	// Returns the number of cached entries of each channel with an active cache (intended for diagnostic usage)
+	CachedChannelSizes() map[string]int
+
 	// Size of the the largest individual channel cache, invoked for stats reporting
 	// // TODO: let the cache manage its own stats internally (maybe take an updateStats call)
 	MaxCacheSize() int
@@ -97,6 +104,7 @@ type channelCacheImpl struct {
 	activeChannels       *channels.ActiveChannels  // Active channel handler
 	cacheStats           *base.CacheStats          // Map used for cache stats
 	validFromLock        sync.RWMutex              // Mutex used to avoid race between AddToCache and addChannelCache.  See CBG-520 for more details
+	storage              ChannelCacheStorage       // Storage for channel caches evicted by compaction, nil when they're discarded
 }
 
 func NewChannelCacheForContext(options ChannelCacheOptions, context *DatabaseContext) (*channelCacheImpl, error) {
@@ -118,6 +126,18 @@ func newChannelCache(dbName string, options ChannelCacheOptions, queryHandler Ch
 		activeChannels:       activeChannels,
 		cacheStats:           cacheStats,
 	}
+	if options.Storage != nil {
+		// Stored caches of busy channels are dropped once they've received as many changes again as a cache can hold
+		maxLength := options.ChannelCacheMaxLength
+		if maxLength <= 0 {
+			maxLength = DefaultChannelCacheMaxLength
+		}
+		storage, err := NewChannelCacheStorage(dbName, *options.Storage, 2*maxLength, cacheStats)
+		if err != nil {
+			return nil, err
+		}
+		channelCache.storage = storage
+	}
 	bgt, err := NewBackgroundTask("CleanAgedItems", dbName, channelCache.cleanAgedItems, options.ChannelCacheAge, channelCache.terminator)
 	if err != nil {
 		return nil, err
@@ -131,6 +151,9 @@ func newChannelCache(dbName string, options ChannelCacheOptions, queryHandler Ch
 func (c *channelCacheImpl) Clear() {
 	c.seqLock.Lock()
 	c.channelCaches.Init()
+	if c.storage != nil {
+		c.storage.Clear()
+	}
 	c.seqLock.Unlock()
 }
 
@@ -141,6 +164,10 @@ func (c *channelCacheImpl) Stop() {
 
 	// Wait for channel cache background tasks to finish.
 	waitForBGTCompletion(context.TODO(), BGTCompletionMaxWait, c.backgroundTasks, c.dbName)
+
+	if c.storage != nil {
+		c.storage.Close()
+	}
 }
 
 func (c *channelCacheImpl) Init(initialSequence uint64) {
@@ -220,6 +247,8 @@ func (c *channelCacheImpl) AddToCache(change *LogEntry) (updatedChannels []strin
 				if change.Skipped {
 					channelCache.AddLateSequence(change)
 				}
+			} else if c.storage != nil {
+				c.storage.Append(channelName, change, removal != nil)
 			}
 			// Need to notify even if channel isn't active, for case where number of connected changes channels exceeds cache capacity
 			updatedChannels = append(updatedChannels, channelName)
@@ -233,6 +262,8 @@ func (c *channelCacheImpl) AddToCache(change *LogEntry) (updatedChannels []strin
 			if change.Skipped {
 				channelCache.AddLateSequence(change)
 			}
+		} else if c.storage != nil {
+			c.storage.Append(channels.UserStarChannel, change, false)
 		}
 		updatedChannels = append(updatedChannels, channels.UserStarChannel)
 	}
@@ -262,9 +293,48 @@ func (c *channelCacheImpl) Remove(docIDs []string, startTime time.Time) (count i
 
 	c.channelCaches.Range(removeCallback)
 
+	// Stored channel caches aren't searched for the docs, as that would mean loading all of them - they're dropped
+	// instead, and reloaded by query when next requested.
+	if c.storage != nil {
+		c.storage.Clear()
+	}
+
 	return count
 }
 
+// InvalidateChannels removes the caches of all channels holding a matching change, so they're reloaded from the bucket
+// when next requested.  Unlike removing individual changes, removing whole channel caches doesn't break the guarantee
+// that a channel cache holds every change since its validFrom sequence.
+func (c *channelCacheImpl) InvalidateChannels(matches func(change *LogEntry) bool) (count int) {
+	var invalidChannels []string
+	findCallback := func(v interface{}) bool {
+		channelCache := AsSingleChannelCache(v)
+		if channelCache == nil {
+			return true
+		}
+		_, changes := channelCache.GetCachedChanges(ChangesOptions{Since: SequenceID{Seq: 0}})
+		for _, change := range changes {
+			if matches(change) {
+				invalidChannels = append(invalidChannels, channelCache.channelName)
+				break
+			}
+		}
+		return true
+	}
+	c.channelCaches.Range(findCallback)
+
+	for _, channelName := range invalidChannels {
+		c.channelCaches.Remove(channelName)
+	}
+	// As for Remove, stored channel caches are dropped rather than searched
+	if c.storage != nil {
+		c.storage.Clear()
+	}
+	c.cacheStats.ChannelCacheNumChannels.Add(-1 * int64(len(invalidChannels)))
+	c.cacheStats.ChannelCacheChannelsInvalidated.Add(int64(len(invalidChannels)))
+	return len(invalidChannels)
+}
+
 func (c *channelCacheImpl) GetChanges(channelName string, options ChangesOptions) ([]*LogEntry, error) {
 
 	return c.getChannelCache(channelName).GetChanges(options)
@@ -353,7 +423,20 @@ func (c *channelCacheImpl) addChannelCache(channelName string) (*singleChannelCa
 	// Everything after the current high sequence will be added to the cache via the feed
 	validFrom := c.GetHighCacheSequence() + 1
 
+	// If the channel's cache was evicted and stored, it's restored along with the changes it received while stored
+	var storedChanges LogEntries
+	var restored bool
+	if c.storage != nil {
+		var storedValidFrom uint64
+		if storedValidFrom, storedChanges, restored = c.storage.Load(channelName); restored {
+			validFrom = storedValidFrom
+		}
+	}
+
 	singleChannelCache := newChannelCacheWithOptions(c.queryHandler, channelName, validFrom, c.options, c.cacheStats)
+	if restored {
+		singleChannelCache.restoreChanges(storedChanges)
+	}
 	cacheValue, created, cacheSize := c.channelCaches.GetOrInsert(channelName, singleChannelCache)
 	c.validFromLock.Unlock()
 
@@ -366,6 +449,9 @@ func (c *channelCacheImpl) addChannelCache(channelName string) (*singleChannelCa
 	if created {
 		c.cacheStats.ChannelCacheNumChannels.Add(1)
 		c.cacheStats.ChannelCacheChannelsAdded.Add(1)
+		if restored {
+			c.cacheStats.ChannelCacheChannelsRestored.Add(1)
+		}
 	}
 
 	return singleChannelCache, true
@@ -400,6 +486,22 @@ func (c *channelCacheImpl) MaxCacheSize() int {
 	return maxCacheSize
 }
 
+func (c *channelCacheImpl) CachedChannelSizes() map[string]int {
+
+	sizes := make(map[string]int)
+	callback := func(v interface{}) bool {
+		channelCache := AsSingleChannelCache(v)
+		if channelCache == nil {
+			return false
+		}
+		sizes[channelCache.ChannelName()] = channelCache.GetSize()
+		return true
+	}
+	c.channelCaches.Range(callback)
+
+	return sizes
+}
+
 func (c *channelCacheImpl) isCompactActive() bool {
 	return c.compactRunning.IsTrue()
 }
@@ -509,7 +611,11 @@ func (c *channelCacheImpl) compactChannelCache() {
 			}
 		}
 
-		cacheSize = c.channelCaches.RemoveElements(evictionElements)
+		if c.storage != nil {
+			cacheSize = c.storeAndRemoveElements(evictionElements)
+		} else {
+			cacheSize = c.channelCaches.RemoveElements(evictionElements)
+		}
 
 		// Update eviction stats
 		c.updateEvictionStats(inactiveEvictCount, len(evictionElements), compactIterationStart)
@@ -518,6 +624,27 @@ func (c *channelCacheImpl) compactChannelCache() {
 	}
 }
 
+// storeAndRemoveElements removes evicted channel caches from the cache, and stores them.  Holds validFromLock while
+// doing so, so that every change to an evicted channel is either in its cache when it's stored, or appended to the
+// stored cache.
+func (c *channelCacheImpl) storeAndRemoveElements(elements []*base.AppendOnlyListElement) (cacheSize int) {
+	c.validFromLock.Lock()
+	defer c.validFromLock.Unlock()
+
+	cacheSize = c.channelCaches.RemoveElements(elements)
+	for _, elem := range elements {
+		singleChannelCache := AsSingleChannelCache(elem.Value)
+		if singleChannelCache == nil {
+			continue
+		}
+		singleChannelCache.lock.RLock()
+		validFrom, changes := singleChannelCache._getCachedChanges(0, 0)
+		singleChannelCache.lock.RUnlock()
+		c.storage.Store(singleChannelCache.channelName, validFrom, changes)
+	}
+	return cacheSize
+}
+
 // Updates cache stats
 func (c *channelCacheImpl) updateEvictionStats(inactiveEvicted int, totalEvicted int, startTime time.Time) {
 	// Eviction stats
@@ -0,0 +1,115 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/couchbase/sync_gateway/base"
+)
+
+// How often the most active channels are persisted, for preloading when the database next starts
+const channelCachePreloadPersistInterval = 5 * time.Minute
+
+// MaxChannelCachePreloadTopN limits the number of automatically detected channels preloaded on startup, to bound the
+// time taken to bring the database online.
+const MaxChannelCachePreloadTopN = 1000
+
+// ChannelCachePreloadConfig configures the channels whose caches are backfilled when the database starts, before it's
+// brought online, so that the first changes requests after a restart don't have to query for them.
+type ChannelCachePreloadConfig struct {
+	Channels []string `json:"channels,omitempty"` // Channels to always preload
+	TopN     *int     `json:"top_n,omitempty"`    // Number of channels with the most active changes feeds to preload, as persisted while the database was last running
+}
+
+// Validate ensures the config's settings are valid.
+func (c *ChannelCachePreloadConfig) Validate() error {
+	for _, channelName := range c.Channels {
+		if channelName == "" {
+			return errors.New("channels must not contain an empty channel name")
+		}
+	}
+	if c.TopN != nil && (*c.TopN < 0 || *c.TopN > MaxChannelCachePreloadTopN) {
+		return fmt.Errorf("top_n must be between 0 and %d", MaxChannelCachePreloadTopN)
+	}
+	return nil
+}
+
+func (c *ChannelCachePreloadConfig) topN() int {
+	if c == nil || c.TopN == nil {
+		return 0
+	}
+	return *c.TopN
+}
+
+// channelCachePreloadDoc is the metadata document holding the channels with the most active changes feeds
+type channelCachePreloadDoc struct {
+	Channels []string `json:"channels"`
+}
+
+// preloadChannelCaches backfills the caches of the configured channels, and of the channels that had the most active
+// changes feeds when the database was last running.  Failures are logged rather than returned, as the channels will
+// still be cached by query when they're requested.
+func (dbCtx *DatabaseContext) preloadChannelCaches(ctx context.Context, preload *ChannelCachePreloadConfig) {
+	channelNames := make([]string, 0, len(preload.Channels)+preload.topN())
+	preloadSet := make(map[string]struct{}, cap(channelNames))
+	addChannel := func(channelName string) {
+		if _, ok := preloadSet[channelName]; !ok {
+			preloadSet[channelName] = struct{}{}
+			channelNames = append(channelNames, channelName)
+		}
+	}
+	for _, channelName := range preload.Channels {
+		addChannel(channelName)
+	}
+	if topN := preload.topN(); topN > 0 {
+		var preloadDoc channelCachePreloadDoc
+		if _, err := dbCtx.Bucket.Get(base.ChannelCachePreloadKeyWithGroupID(dbCtx.Options.GroupID), &preloadDoc); err != nil && !base.IsDocNotFoundError(err) {
+			base.WarnfCtx(ctx, "Unable to load the most active channels for channel cache preloading: %v", err)
+		}
+		for i, channelName := range preloadDoc.Channels {
+			if i == topN {
+				break
+			}
+			addChannel(channelName)
+		}
+	}
+	if len(channelNames) == 0 {
+		return
+	}
+
+	startTime := time.Now()
+	channelCache := dbCtx.changeCache.getChannelCache()
+	preloaded := 0
+	for _, channelName := range channelNames {
+		if _, err := channelCache.GetChanges(channelName, ChangesOptions{LoggingCtx: ctx, ChangesCtx: ctx}); err != nil {
+			base.WarnfCtx(ctx, "Unable to preload cache of channel %q: %v", base.UD(channelName), err)
+			continue
+		}
+		preloaded++
+	}
+	base.InfofCtx(ctx, base.KeyCache, "Preloaded caches of %d channels in %v", preloaded, time.Since(startTime))
+}
+
+// persistChannelCachePreloadChannels persists the channels with the most active changes feeds, to be preloaded into the
+// channel cache when the database next starts.  Nothing is persisted while there are no active changes feeds, to
+// avoid losing the channels of a busy period to a brief lull.
+func (dbCtx *DatabaseContext) persistChannelCachePreloadChannels(ctx context.Context, topN int) error {
+	channelNames := dbCtx.activeChannels.TopChannels(topN)
+	if len(channelNames) == 0 {
+		return nil
+	}
+	if err := dbCtx.Bucket.Set(base.ChannelCachePreloadKeyWithGroupID(dbCtx.Options.GroupID), 0, nil, channelCachePreloadDoc{Channels: channelNames}); err != nil {
+		base.WarnfCtx(ctx, "Unable to persist the most active channels for channel cache preloading: %v", err)
+	}
+	return nil
+}
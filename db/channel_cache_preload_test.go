@@ -0,0 +1,64 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package db
+
+import (
+	"testing"
+
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannelCachePreloadConfigValidate(t *testing.T) {
+	assert.NoError(t, (&ChannelCachePreloadConfig{}).Validate())
+	assert.NoError(t, (&ChannelCachePreloadConfig{Channels: []string{"ABC"}, TopN: base.IntPtr(100)}).Validate())
+	assert.Error(t, (&ChannelCachePreloadConfig{Channels: []string{"ABC", ""}}).Validate())
+	assert.Error(t, (&ChannelCachePreloadConfig{TopN: base.IntPtr(-1)}).Validate())
+	assert.Error(t, (&ChannelCachePreloadConfig{TopN: base.IntPtr(MaxChannelCachePreloadTopN + 1)}).Validate())
+}
+
+// TestChannelCachePreload ensures the configured channels, and the most active channels persisted by a previous run,
+// are cached when the database context is created.
+func TestChannelCachePreload(t *testing.T) {
+
+	base.SetUpTestLogging(t, base.LevelInfo, base.KeyCache)
+
+	bucket := base.GetTestBucket(t)
+	ctx := base.TestCtx(t)
+
+	// Persist the most active channels, as a previous run would have done
+	_, err := bucket.Add(base.ChannelCachePreloadKeyWithGroupID(""), 0, channelCachePreloadDoc{Channels: []string{"DEF", "GHI"}})
+	require.NoError(t, err)
+
+	cacheOptions := DefaultCacheOptions()
+	cacheOptions.Preload = &ChannelCachePreloadConfig{Channels: []string{"ABC"}, TopN: base.IntPtr(1)}
+	dbCtx, err := NewDatabaseContext(ctx, "db", bucket, false, DatabaseContextOptions{CacheOptions: &cacheOptions})
+	require.NoError(t, err)
+	defer dbCtx.Close(ctx)
+
+	channelCache, ok := dbCtx.changeCache.getChannelCache().(*channelCacheImpl)
+	require.True(t, ok)
+	_, isCached := channelCache.channelCaches.Get("ABC")
+	assert.True(t, isCached)
+	_, isCached = channelCache.channelCaches.Get("DEF")
+	assert.True(t, isCached)
+	_, isCached = channelCache.channelCaches.Get("GHI")
+	assert.False(t, isCached, "Only top_n persisted channels should be preloaded")
+
+	// The channels with the most active changes feeds are persisted for the next run
+	dbCtx.activeChannels.IncrChannel("JKL")
+	dbCtx.activeChannels.IncrChannel("JKL")
+	dbCtx.activeChannels.IncrChannel("MNO")
+	require.NoError(t, dbCtx.persistChannelCachePreloadChannels(ctx, 1))
+	var preloadDoc channelCachePreloadDoc
+	_, err = bucket.Get(base.ChannelCachePreloadKeyWithGroupID(""), &preloadDoc)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"JKL"}, preloadDoc.Channels)
+}
@@ -161,13 +161,14 @@ func newChannelCacheWithOptions(queryHandler ChannelQueryHandler, channelName st
 }
 
 type ChannelCacheOptions struct {
-	ChannelCacheMinLength       int           // Keep at least this many entries in each per-channel cache
-	ChannelCacheMaxLength       int           // Don't put more than this many entries in each per-channel cache
-	ChannelCacheAge             time.Duration // Keep entries at least this long
-	MaxNumChannels              int           // Maximum number of per-channel caches which will exist at any one point
-	CompactHighWatermarkPercent int           // Compact HWM (as percent of MaxNumChannels)
-	CompactLowWatermarkPercent  int           // Compact LWM (as percent of MaxNumChannels)
-	ChannelQueryLimit           int           // Query limit
+	ChannelCacheMinLength       int                        // Keep at least this many entries in each per-channel cache
+	ChannelCacheMaxLength       int                        // Don't put more than this many entries in each per-channel cache
+	ChannelCacheAge             time.Duration              // Keep entries at least this long
+	MaxNumChannels              int                        // Maximum number of per-channel caches which will exist at any one point
+	CompactHighWatermarkPercent int                        // Compact HWM (as percent of MaxNumChannels)
+	CompactLowWatermarkPercent  int                        // Compact LWM (as percent of MaxNumChannels)
+	ChannelQueryLimit           int                        // Query limit
+	Storage                     *ChannelCacheStorageConfig // Storage for channel caches evicted by compaction, nil to discard them
 }
 
 func (c *singleChannelCacheImpl) ChannelName() string {
@@ -0,0 +1,489 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package db
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/couchbase/sync_gateway/channels"
+)
+
+// Channel cache storage types, which decide what happens to the caches of channels evicted by channel cache compaction.
+const (
+	ChannelCacheStorageHeap    = "heap"    // Evicted channel caches are discarded, and reloaded by query when next requested
+	ChannelCacheStorageCompact = "compact" // Evicted channel caches are kept in memory, in a compact encoding the garbage collector doesn't scan
+	ChannelCacheStorageDisk    = "disk"    // Evicted channel caches are kept in files on disk
+)
+
+// DefaultChannelCacheStorageBudgetMB is the default limit on the size of the stored channel caches.
+const DefaultChannelCacheStorageBudgetMB = 256
+
+// ChannelCacheStorageConfig configures the storage of channel caches evicted from the heap by channel cache compaction.
+// For databases with very large numbers of channels, keeping evicted caches in storage lets max_number be lowered to
+// relieve GC pressure, without channels that are evicted and requested again having to be reloaded by query.
+type ChannelCacheStorageConfig struct {
+	Type     string `json:"type,omitempty"`      // One of ChannelCacheStorageHeap, ChannelCacheStorageCompact or ChannelCacheStorageDisk
+	BudgetMB *int   `json:"budget_mb,omitempty"` // Limit on the size of the stored channel caches, in memory or on disk depending on type
+	Path     string `json:"path,omitempty"`      // For ChannelCacheStorageDisk, the directory to store channel caches in
+}
+
+// Validate ensures the config's settings are valid.
+func (c *ChannelCacheStorageConfig) Validate() error {
+	switch c.Type {
+	case "", ChannelCacheStorageHeap, ChannelCacheStorageCompact:
+		if c.Path != "" {
+			return fmt.Errorf("path is only supported by type %q", ChannelCacheStorageDisk)
+		}
+	case ChannelCacheStorageDisk:
+		if c.Path == "" {
+			return fmt.Errorf("type %q requires a path", ChannelCacheStorageDisk)
+		}
+	default:
+		return fmt.Errorf("unknown type %q - must be one of %q, %q or %q", c.Type, ChannelCacheStorageHeap, ChannelCacheStorageCompact, ChannelCacheStorageDisk)
+	}
+	if c.BudgetMB != nil && *c.BudgetMB < 1 {
+		return errors.New("budget_mb must be at least 1")
+	}
+	return nil
+}
+
+// ChannelCacheStorage stores the caches of channels evicted from the heap, until they're next requested.  A stored
+// channel cache continues to receive the channel's changes, so it's still complete from its validFrom sequence when
+// it's restored.  Stored channel caches may be dropped at any time (e.g. to stay within budget), in which case they're
+// reloaded by query when next requested.
+type ChannelCacheStorage interface {
+	// Store stores the changes of an evicted channel cache, which is valid from validFrom.
+	Store(channelName string, validFrom uint64, changes LogEntries)
+
+	// Append adds a change to the stored cache of the channel, if it's stored.
+	Append(channelName string, change *LogEntry, isRemoval bool)
+
+	// Load removes the stored cache of the channel, returning its changes and the sequence it's valid from.  Changes
+	// are returned in the order they were added - they may be out of sequence order, and may include more than one
+	// change to a doc.
+	Load(channelName string) (validFrom uint64, changes LogEntries, found bool)
+
+	// Clear removes all stored channel caches.
+	Clear()
+
+	// Close removes all stored channel caches and releases the storage's resources.
+	Close()
+}
+
+// NewChannelCacheStorage returns the storage for channel caches with the given config, or nil if evicted channel caches
+// are discarded.  maxEntries limits the number of changes kept for each stored channel cache.
+func NewChannelCacheStorage(dbName string, config ChannelCacheStorageConfig, maxEntries int, cacheStats *base.CacheStats) (ChannelCacheStorage, error) {
+	budgetMB := DefaultChannelCacheStorageBudgetMB
+	if config.BudgetMB != nil {
+		budgetMB = *config.BudgetMB
+	}
+
+	var backend channelCacheStoreBackend
+	switch config.Type {
+	case "", ChannelCacheStorageHeap:
+		return nil, nil
+	case ChannelCacheStorageCompact:
+		backend = newCompactChannelCacheStoreBackend()
+	case ChannelCacheStorageDisk:
+		var err error
+		if backend, err = newDiskChannelCacheStoreBackend(config.Path, dbName); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown channel cache storage type %q", config.Type)
+	}
+	return newChannelCacheStore(backend, int64(budgetMB)*1024*1024, maxEntries, cacheStats), nil
+}
+
+// channelCacheStoreBackend holds the encoded changes of stored channel caches.
+type channelCacheStoreBackend interface {
+	write(channelName string, data []byte) error
+	append(channelName string, data []byte) error
+	read(channelName string) ([]byte, error)
+	remove(channelName string)
+	removeAll()
+}
+
+// channelCacheStore implements ChannelCacheStorage, keeping an index of the stored channel caches and evicting the
+// least recently updated when the storage is over budget.
+type channelCacheStore struct {
+	backend    channelCacheStoreBackend
+	budget     int64                    // Maximum total size of the encoded changes of stored channel caches
+	maxEntries int                      // Maximum number of changes kept for a stored channel cache
+	index      map[string]*list.Element // Stored channel caches by name
+	lru        *list.List               // Stored channel caches, most recently updated first
+	size       int64                    // Total size of the encoded changes of stored channel caches
+	lock       sync.Mutex               // Controls access to index, lru and size, and serializes backend access
+	cacheStats *base.CacheStats
+}
+
+// storedChannelCache is the index entry of a stored channel cache.
+type storedChannelCache struct {
+	channelName string
+	validFrom   uint64
+	numEntries  int
+	size        int64
+}
+
+var _ ChannelCacheStorage = &channelCacheStore{}
+
+func newChannelCacheStore(backend channelCacheStoreBackend, budget int64, maxEntries int, cacheStats *base.CacheStats) *channelCacheStore {
+	return &channelCacheStore{
+		backend:    backend,
+		budget:     budget,
+		maxEntries: maxEntries,
+		index:      make(map[string]*list.Element),
+		lru:        list.New(),
+		cacheStats: cacheStats,
+	}
+}
+
+func (s *channelCacheStore) Store(channelName string, validFrom uint64, changes LogEntries) {
+	var data []byte
+	for _, change := range changes {
+		data = appendEncodedLogEntry(data, change, false)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s._remove(channelName)
+	if err := s.backend.write(channelName, data); err != nil {
+		base.WarnfCtx(context.TODO(), "Unable to store cache of channel %q - it will be reloaded by query when next requested: %v", base.UD(channelName), err)
+		s.backend.remove(channelName)
+		return
+	}
+	entry := &storedChannelCache{channelName: channelName, validFrom: validFrom, numEntries: len(changes)}
+	s.index[channelName] = s.lru.PushFront(entry)
+	s.cacheStats.ChannelCacheStoredChannels.Add(1)
+	s._addSize(entry, int64(len(data)))
+	s._enforceBudget()
+}
+
+func (s *channelCacheStore) Append(channelName string, change *LogEntry, isRemoval bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	elem, ok := s.index[channelName]
+	if !ok {
+		return
+	}
+	entry := elem.Value.(*storedChannelCache)
+
+	// Rather than compacting the stored changes of busy channels, they're dropped, as they're likely to be requested
+	// again soon and will then be cached by query.
+	if entry.numEntries >= s.maxEntries {
+		s._remove(channelName)
+		return
+	}
+
+	data := appendEncodedLogEntry(nil, change, isRemoval)
+	if err := s.backend.append(channelName, data); err != nil {
+		base.WarnfCtx(context.TODO(), "Unable to add change to stored cache of channel %q - it will be reloaded by query when next requested: %v", base.UD(channelName), err)
+		s._remove(channelName)
+		return
+	}
+	entry.numEntries++
+	s.lru.MoveToFront(elem)
+	s._addSize(entry, int64(len(data)))
+	s._enforceBudget()
+}
+
+func (s *channelCacheStore) Load(channelName string) (validFrom uint64, changes LogEntries, found bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	elem, ok := s.index[channelName]
+	if !ok {
+		return 0, nil, false
+	}
+	entry := elem.Value.(*storedChannelCache)
+	data, err := s.backend.read(channelName)
+	s._remove(channelName)
+	if err == nil {
+		changes, err = decodeLogEntries(data)
+	}
+	if err != nil {
+		base.WarnfCtx(context.TODO(), "Unable to load stored cache of channel %q - it will be reloaded by query: %v", base.UD(channelName), err)
+		return 0, nil, false
+	}
+	return entry.validFrom, changes, true
+}
+
+func (s *channelCacheStore) Clear() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.backend.removeAll()
+	s.cacheStats.ChannelCacheStoredChannels.Add(-int64(len(s.index)))
+	s.cacheStats.ChannelCacheStorageBytes.Add(-s.size)
+	s.index = make(map[string]*list.Element)
+	s.lru.Init()
+	s.size = 0
+}
+
+func (s *channelCacheStore) Close() {
+	s.Clear()
+	if closer, ok := s.backend.(interface{ close() }); ok {
+		closer.close()
+	}
+}
+
+// _remove removes the stored cache of the channel, if it's stored.  Caller must hold the lock.
+func (s *channelCacheStore) _remove(channelName string) {
+	elem, ok := s.index[channelName]
+	if !ok {
+		return
+	}
+	entry := s.lru.Remove(elem).(*storedChannelCache)
+	delete(s.index, channelName)
+	s.backend.remove(channelName)
+	s._addSize(entry, -entry.size)
+	s.cacheStats.ChannelCacheStoredChannels.Add(-1)
+}
+
+// _addSize updates the size of a stored channel cache.  Caller must hold the lock.
+func (s *channelCacheStore) _addSize(entry *storedChannelCache, delta int64) {
+	entry.size += delta
+	s.size += delta
+	s.cacheStats.ChannelCacheStorageBytes.Add(delta)
+}
+
+// _enforceBudget drops the least recently updated channel caches until the storage is within budget.  Caller must hold
+// the lock.
+func (s *channelCacheStore) _enforceBudget() {
+	for s.size > s.budget && s.lru.Len() > 0 {
+		s._remove(s.lru.Back().Value.(*storedChannelCache).channelName)
+	}
+}
+
+// compactChannelCacheStoreBackend keeps the encoded changes of stored channel caches in byte slices, which don't
+// contain pointers and so aren't scanned by the garbage collector.
+type compactChannelCacheStoreBackend struct {
+	data map[string][]byte
+}
+
+func newCompactChannelCacheStoreBackend() *compactChannelCacheStoreBackend {
+	return &compactChannelCacheStoreBackend{data: make(map[string][]byte)}
+}
+
+func (b *compactChannelCacheStoreBackend) write(channelName string, data []byte) error {
+	b.data[channelName] = data
+	return nil
+}
+
+func (b *compactChannelCacheStoreBackend) append(channelName string, data []byte) error {
+	b.data[channelName] = append(b.data[channelName], data...)
+	return nil
+}
+
+func (b *compactChannelCacheStoreBackend) read(channelName string) ([]byte, error) {
+	return b.data[channelName], nil
+}
+
+func (b *compactChannelCacheStoreBackend) remove(channelName string) {
+	delete(b.data, channelName)
+}
+
+func (b *compactChannelCacheStoreBackend) removeAll() {
+	b.data = make(map[string][]byte)
+}
+
+// diskChannelCacheStoreBackend keeps the encoded changes of each stored channel cache in a file, in a directory
+// created for the channel cache.
+type diskChannelCacheStoreBackend struct {
+	dir string
+}
+
+func newDiskChannelCacheStoreBackend(path string, dbName string) (*diskChannelCacheStoreBackend, error) {
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return nil, fmt.Errorf("unable to create channel cache storage path: %w", err)
+	}
+	dir, err := os.MkdirTemp(path, "chan_cache_"+hex.EncodeToString([]byte(dbName))+"_")
+	if err != nil {
+		return nil, fmt.Errorf("unable to create channel cache storage directory: %w", err)
+	}
+	return &diskChannelCacheStoreBackend{dir: dir}, nil
+}
+
+// filePath returns the path of the channel's file.  Channel names are hashed, as they can contain characters that
+// aren't valid in file names.
+func (b *diskChannelCacheStoreBackend) filePath(channelName string) string {
+	hash := sha1.Sum([]byte(channelName))
+	return filepath.Join(b.dir, hex.EncodeToString(hash[:]))
+}
+
+func (b *diskChannelCacheStoreBackend) write(channelName string, data []byte) error {
+	return os.WriteFile(b.filePath(channelName), data, 0600)
+}
+
+func (b *diskChannelCacheStoreBackend) append(channelName string, data []byte) error {
+	file, err := os.OpenFile(b.filePath(channelName), os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (b *diskChannelCacheStoreBackend) read(channelName string) ([]byte, error) {
+	return os.ReadFile(b.filePath(channelName))
+}
+
+func (b *diskChannelCacheStoreBackend) remove(channelName string) {
+	if err := os.Remove(b.filePath(channelName)); err != nil && !os.IsNotExist(err) {
+		base.WarnfCtx(context.TODO(), "Unable to remove stored cache of channel %q: %v", base.UD(channelName), err)
+	}
+}
+
+func (b *diskChannelCacheStoreBackend) removeAll() {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		base.WarnfCtx(context.TODO(), "Unable to list stored channel caches for removal: %v", err)
+		return
+	}
+	for _, entry := range entries {
+		if err := os.Remove(filepath.Join(b.dir, entry.Name())); err != nil {
+			base.WarnfCtx(context.TODO(), "Unable to remove stored channel cache: %v", err)
+		}
+	}
+}
+
+func (b *diskChannelCacheStoreBackend) close() {
+	if err := os.RemoveAll(b.dir); err != nil {
+		base.WarnfCtx(context.TODO(), "Unable to remove channel cache storage directory: %v", err)
+	}
+}
+
+// appendEncodedLogEntry appends the encoding of the fields of a change that are used by the channel cache to data.
+func appendEncodedLogEntry(data []byte, change *LogEntry, isRemoval bool) []byte {
+	flags := change.Flags
+	if isRemoval {
+		flags |= channels.Removed
+	}
+	data = appendUvarint(data, change.Sequence)
+	data = append(data, flags)
+	data = appendUvarint(data, uint64(change.VbNo))
+	data = appendVarint(data, encodeLogEntryTime(change.TimeReceived))
+	data = appendVarint(data, encodeLogEntryTime(change.TimeSaved))
+	data = appendUvarint(data, change.PrevSequence)
+	data = appendUvarint(data, uint64(len(change.DocID)))
+	data = append(data, change.DocID...)
+	data = appendUvarint(data, uint64(len(change.RevID)))
+	return append(data, change.RevID...)
+}
+
+func appendUvarint(data []byte, value uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(data, buf[:binary.PutUvarint(buf[:], value)]...)
+}
+
+func appendVarint(data []byte, value int64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(data, buf[:binary.PutVarint(buf[:], value)]...)
+}
+
+// encodeLogEntryTime encodes a time as nanoseconds since the Unix epoch, with zero for the zero time, which isn't
+// representable in nanoseconds.
+func encodeLogEntryTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func decodeLogEntryTime(nanos int64) time.Time {
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+var errInvalidStoredLogEntry = errors.New("invalid stored channel cache entry")
+
+// decodeLogEntries decodes changes encoded by appendEncodedLogEntry.
+func decodeLogEntries(data []byte) (LogEntries, error) {
+	var changes LogEntries
+	for len(data) > 0 {
+		var change LogEntry
+		var ok bool
+		var vbNo, docIDLen, revIDLen uint64
+		var timeReceived, timeSaved int64
+		if change.Sequence, data, ok = decodeUvarint(data); !ok || len(data) == 0 {
+			return nil, errInvalidStoredLogEntry
+		}
+		change.Flags, data = data[0], data[1:]
+		if vbNo, data, ok = decodeUvarint(data); !ok {
+			return nil, errInvalidStoredLogEntry
+		}
+		change.VbNo = uint16(vbNo)
+		if timeReceived, data, ok = decodeVarint(data); !ok {
+			return nil, errInvalidStoredLogEntry
+		}
+		change.TimeReceived = decodeLogEntryTime(timeReceived)
+		if timeSaved, data, ok = decodeVarint(data); !ok {
+			return nil, errInvalidStoredLogEntry
+		}
+		change.TimeSaved = decodeLogEntryTime(timeSaved)
+		if change.PrevSequence, data, ok = decodeUvarint(data); !ok {
+			return nil, errInvalidStoredLogEntry
+		}
+		if docIDLen, data, ok = decodeUvarint(data); !ok || uint64(len(data)) < docIDLen {
+			return nil, errInvalidStoredLogEntry
+		}
+		change.DocID, data = string(data[:docIDLen]), data[docIDLen:]
+		if revIDLen, data, ok = decodeUvarint(data); !ok || uint64(len(data)) < revIDLen {
+			return nil, errInvalidStoredLogEntry
+		}
+		change.RevID, data = string(data[:revIDLen]), data[revIDLen:]
+		changes = append(changes, &change)
+	}
+	return changes, nil
+}
+
+func decodeUvarint(data []byte) (value uint64, remaining []byte, ok bool) {
+	value, n := binary.Uvarint(data)
+	if n <= 0 {
+		return 0, data, false
+	}
+	return value, data[n:], true
+}
+
+func decodeVarint(data []byte) (value int64, remaining []byte, ok bool) {
+	value, n := binary.Varint(data)
+	if n <= 0 {
+		return 0, data, false
+	}
+	return value, data[n:], true
+}
+
+// restoreChanges adds the changes of a stored channel cache to a new, empty channel cache.  Changes are added in the
+// order they were stored, so later changes to a doc replace earlier ones, as they would have if the channel had stayed
+// in the cache.
+func (c *singleChannelCacheImpl) restoreChanges(changes LogEntries) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, change := range changes {
+		if c.wouldBeImmediatelyPruned(change) {
+			continue
+		}
+		c._appendChange(change)
+	}
+	c._pruneCacheLength()
+}
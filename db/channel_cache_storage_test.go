@@ -0,0 +1,224 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package db
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/couchbase/sync_gateway/channels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannelCacheStorageConfigValidate(t *testing.T) {
+	testCases := []struct {
+		config        ChannelCacheStorageConfig
+		expectedError string
+	}{
+		{config: ChannelCacheStorageConfig{}},
+		{config: ChannelCacheStorageConfig{Type: ChannelCacheStorageHeap}},
+		{config: ChannelCacheStorageConfig{Type: ChannelCacheStorageCompact, BudgetMB: base.IntPtr(64)}},
+		{config: ChannelCacheStorageConfig{Type: ChannelCacheStorageDisk, Path: "/tmp"}},
+		{config: ChannelCacheStorageConfig{Type: ChannelCacheStorageDisk}, expectedError: `type "disk" requires a path`},
+		{config: ChannelCacheStorageConfig{Type: ChannelCacheStorageCompact, Path: "/tmp"}, expectedError: `path is only supported by type "disk"`},
+		{config: ChannelCacheStorageConfig{Type: ChannelCacheStorageCompact, BudgetMB: base.IntPtr(0)}, expectedError: "budget_mb must be at least 1"},
+		{config: ChannelCacheStorageConfig{Type: "ssd"}, expectedError: `unknown type "ssd"`},
+	}
+	for _, testCase := range testCases {
+		err := testCase.config.Validate()
+		if testCase.expectedError == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.ErrorContains(t, err, testCase.expectedError)
+		}
+	}
+}
+
+func TestEncodeDecodeLogEntries(t *testing.T) {
+	changes := LogEntries{
+		{Sequence: 1, DocID: "doc1", RevID: "1-a", VbNo: 12, TimeReceived: time.Unix(1600000000, 123), TimeSaved: time.Unix(1600000000, 0)},
+		{Sequence: 300, DocID: "doc2", RevID: "2-b", Flags: channels.Deleted, PrevSequence: 299},
+		{Sequence: 1 << 40, DocID: "", RevID: "3-c"},
+	}
+	var data []byte
+	for _, change := range changes {
+		data = appendEncodedLogEntry(data, change, false)
+	}
+	data = appendEncodedLogEntry(data, &LogEntry{Sequence: 301, DocID: "doc3", RevID: "1-d"}, true)
+
+	decoded, err := decodeLogEntries(data)
+	require.NoError(t, err)
+	require.Len(t, decoded, 4)
+	for i, change := range changes {
+		assert.Equal(t, change.Sequence, decoded[i].Sequence)
+		assert.Equal(t, change.DocID, decoded[i].DocID)
+		assert.Equal(t, change.RevID, decoded[i].RevID)
+		assert.Equal(t, change.Flags, decoded[i].Flags)
+		assert.Equal(t, change.VbNo, decoded[i].VbNo)
+		assert.Equal(t, change.PrevSequence, decoded[i].PrevSequence)
+		assert.True(t, change.TimeReceived.Equal(decoded[i].TimeReceived))
+		assert.True(t, change.TimeSaved.Equal(decoded[i].TimeSaved))
+	}
+	assert.True(t, decoded[3].IsRemoved())
+
+	// Truncated data can't be decoded
+	_, err = decodeLogEntries(data[:len(data)-1])
+	assert.Error(t, err)
+}
+
+func TestChannelCacheStorage(t *testing.T) {
+	testCases := []struct {
+		name   string
+		config ChannelCacheStorageConfig
+	}{
+		{name: "compact", config: ChannelCacheStorageConfig{Type: ChannelCacheStorageCompact}},
+		{name: "disk", config: ChannelCacheStorageConfig{Type: ChannelCacheStorageDisk, Path: t.TempDir()}},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			testStats := (base.NewSyncGatewayStats()).NewDBStats("", false, false, false).Cache()
+			storage, err := NewChannelCacheStorage("testDb", testCase.config, 3, testStats)
+			require.NoError(t, err)
+			require.NotNil(t, storage)
+
+			storage.Store("ABC", 5, LogEntries{testLogEntry(5, "doc1", "1-a"), testLogEntry(6, "doc2", "1-a")})
+			storage.Append("ABC", testLogEntry(7, "doc1", "2-a"), true)
+			// Changes to channels that aren't stored are ignored
+			storage.Append("DEF", testLogEntry(8, "doc3", "1-a"), false)
+			assert.Equal(t, int64(1), testStats.ChannelCacheStoredChannels.Value())
+			assert.NotZero(t, testStats.ChannelCacheStorageBytes.Value())
+
+			validFrom, changes, found := storage.Load("ABC")
+			require.True(t, found)
+			assert.Equal(t, uint64(5), validFrom)
+			require.Len(t, changes, 3)
+			assert.Equal(t, uint64(7), changes[2].Sequence)
+			assert.True(t, changes[2].IsRemoved())
+
+			// Loading removes the channel from storage
+			_, _, found = storage.Load("ABC")
+			assert.False(t, found)
+			_, _, found = storage.Load("DEF")
+			assert.False(t, found)
+			assert.Equal(t, int64(0), testStats.ChannelCacheStoredChannels.Value())
+			assert.Equal(t, int64(0), testStats.ChannelCacheStorageBytes.Value())
+
+			// Stored channels are dropped once they'd hold more than maxEntries changes
+			storage.Store("ABC", 5, LogEntries{testLogEntry(5, "doc1", "1-a"), testLogEntry(6, "doc2", "1-a")})
+			storage.Append("ABC", testLogEntry(7, "doc3", "1-a"), false)
+			storage.Append("ABC", testLogEntry(8, "doc4", "1-a"), false)
+			_, _, found = storage.Load("ABC")
+			assert.False(t, found)
+
+			storage.Store("ABC", 5, LogEntries{testLogEntry(5, "doc1", "1-a")})
+			storage.Store("DEF", 5, LogEntries{testLogEntry(5, "doc1", "1-a")})
+			storage.Clear()
+			_, _, found = storage.Load("ABC")
+			assert.False(t, found)
+			assert.Equal(t, int64(0), testStats.ChannelCacheStoredChannels.Value())
+
+			storage.Close()
+		})
+	}
+}
+
+func TestChannelCacheStorageBudget(t *testing.T) {
+	testStats := (base.NewSyncGatewayStats()).NewDBStats("", false, false, false).Cache()
+	change := testLogEntry(1, "doc1", "1-a")
+	changeSize := len(appendEncodedLogEntry(nil, change, false))
+
+	// Budget for three channels of a single change
+	store := newChannelCacheStore(newCompactChannelCacheStoreBackend(), int64(3*changeSize), 10, testStats)
+	for i := 1; i <= 4; i++ {
+		store.Store(fmt.Sprintf("chan_%d", i), 1, LogEntries{change})
+	}
+
+	// The least recently stored channel is dropped
+	assert.Equal(t, int64(3), testStats.ChannelCacheStoredChannels.Value())
+	assert.Equal(t, int64(3*changeSize), testStats.ChannelCacheStorageBytes.Value())
+	_, _, found := store.Load("chan_1")
+	assert.False(t, found)
+	_, _, found = store.Load("chan_4")
+	assert.True(t, found)
+}
+
+func TestDiskChannelCacheStorageClose(t *testing.T) {
+	path := t.TempDir()
+	testStats := (base.NewSyncGatewayStats()).NewDBStats("", false, false, false).Cache()
+	storage, err := NewChannelCacheStorage("testDb", ChannelCacheStorageConfig{Type: ChannelCacheStorageDisk, Path: path}, 10, testStats)
+	require.NoError(t, err)
+
+	storage.Store("ABC", 1, LogEntries{testLogEntry(1, "doc1", "1-a")})
+	entries, err := os.ReadDir(path)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// Closing removes the storage's directory
+	storage.Close()
+	entries, err = os.ReadDir(path)
+	require.NoError(t, err)
+	assert.Len(t, entries, 0)
+}
+
+// TestChannelCacheRestoreEvictedChannel ensures that a channel evicted by compaction is restored from storage, including
+// changes made while it was evicted, without being queried.
+func TestChannelCacheRestoreEvictedChannel(t *testing.T) {
+
+	base.SetUpTestLogging(t, base.LevelInfo, base.KeyCache)
+
+	// Define cache with max channels 20, watermarks 50/90
+	options := DefaultCacheOptions().ChannelCacheOptions
+	options.MaxNumChannels = 20
+	options.CompactHighWatermarkPercent = 90
+	options.CompactLowWatermarkPercent = 50
+	options.Storage = &ChannelCacheStorageConfig{Type: ChannelCacheStorageCompact}
+
+	testStats := (base.NewSyncGatewayStats()).NewDBStats("", false, false, false).Cache()
+	queryHandler := &testQueryHandler{}
+	activeChannelStat := &base.SgwIntStat{}
+	activeChannels := channels.NewActiveChannels(activeChannelStat)
+	cache, err := newChannelCache("testDb", options, queryHandler, activeChannels, testStats)
+	require.NoError(t, err, "Background task error whilst creating channel cache")
+	defer cache.Stop()
+
+	// Add 18 channels to the cache, marking all but chan_2 as active
+	for i := 1; i <= 18; i++ {
+		channelName := fmt.Sprintf("chan_%d", i)
+		cache.addChannelCache(channelName)
+		if i != 2 {
+			activeChannels.IncrChannel(channelName)
+		}
+	}
+	cache.AddToCache(logEntry(1, "doc1", "1-a", []string{"chan_2"}))
+	cache.AddToCache(logEntry(2, "doc2", "1-a", []string{"chan_2"}))
+
+	// Add another channel to cache, should trigger compaction and evict chan_2
+	cache.addChannelCache("chan_19")
+	assert.True(t, waitForCompaction(cache), "Compaction didn't complete in expected time")
+	_, isCached := cache.channelCaches.Get("chan_2")
+	require.False(t, isCached)
+	assert.Equal(t, int64(1), testStats.ChannelCacheStoredChannels.Value())
+
+	// Changes to the evicted channel are added to the stored cache
+	cache.AddToCache(logEntry(3, "doc1", "2-a", []string{"chan_2"}))
+
+	changes, err := cache.GetChanges("chan_2", getChangesOptionsWithCtxOnly())
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, "doc2", changes[0].DocID)
+	assert.Equal(t, "doc1", changes[1].DocID)
+	assert.Equal(t, "2-a", changes[1].RevID)
+	assert.Equal(t, 0, queryHandler.queryCount)
+	assert.Equal(t, int64(1), testStats.ChannelCacheChannelsRestored.Value())
+	assert.Equal(t, int64(0), testStats.ChannelCacheStoredChannels.Value())
+}
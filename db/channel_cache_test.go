@@ -509,3 +509,32 @@ func TestChannelCacheBackgroundTaskWithIllegalTimeInterval(t *testing.T) {
 	assert.Equal(t, "CleanAgedItems", backgroundTaskError.TaskName)
 	assert.Equal(t, options.ChannelCacheAge, backgroundTaskError.Interval)
 }
+
+func TestChannelCacheInvalidateChannels(t *testing.T) {
+
+	base.SetUpTestLogging(t, base.LevelInfo, base.KeyCache)
+
+	bucket := base.GetTestBucket(t)
+
+	ctx := base.TestCtx(t)
+	dbCtx, err := NewDatabaseContext(ctx, "db", bucket, false, DatabaseContextOptions{})
+	require.NoError(t, err)
+	defer dbCtx.Close(ctx)
+	cache := dbCtx.changeCache.getChannelCache()
+
+	// Make channels active
+	for _, channelName := range []string{"TestA", "TestB", "TestC"} {
+		_, err = cache.GetChanges(channelName, getChangesOptionsWithCtxOnly())
+		require.NoError(t, err)
+	}
+	cache.AddToCache(logEntry(1, "doc1", "1-a", []string{"TestA", "TestB"}))
+	cache.AddToCache(logEntry(2, "doc2", "1-a", []string{"TestC"}))
+	numChannels := dbCtx.DbStats.Cache().ChannelCacheNumChannels.Value()
+
+	// Only the caches of channels holding a matching change are removed
+	invalidated := cache.InvalidateChannels(func(change *LogEntry) bool { return change.DocID == "doc1" })
+	assert.Equal(t, 2, invalidated)
+	assert.Equal(t, map[string]int{"TestC": 1}, cache.CachedChannelSizes())
+	assert.Equal(t, int64(2), dbCtx.DbStats.Cache().ChannelCacheChannelsInvalidated.Value())
+	assert.Equal(t, numChannels-2, dbCtx.DbStats.Cache().ChannelCacheNumChannels.Value())
+}
@@ -0,0 +1,243 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/couchbase/sync_gateway/base"
+)
+
+// ChannelHistoryConfig limits the channel history kept in a document's sync metadata, which otherwise grows for as long
+// as the document keeps moving between channels.  Pruned history is applied when a document is written, and by the
+// channel_history compaction job.
+//
+// Channel history is used to decide whether a document must be revoked from a client whose access to a channel was
+// removed, so clients that haven't synced for longer than the max_sequence_age window may keep documents that they'd
+// otherwise have had revoked.
+type ChannelHistoryConfig struct {
+	MaxEntriesPerChannel int    `json:"max_entries_per_channel,omitempty"` // Max past membership periods kept per channel, older periods being merged - defaults to DocumentHistoryMaxEntriesPerChannel
+	MaxSequenceAge       uint64 `json:"max_sequence_age,omitempty"`        // Drop periods that ended more than this many sequences before the doc's current sequence - 0 to keep them
+}
+
+// Validate ensures the config's settings are valid.
+func (c *ChannelHistoryConfig) Validate() error {
+	if c.MaxEntriesPerChannel < 0 || c.MaxEntriesPerChannel > DocumentHistoryMaxEntriesPerChannel {
+		return fmt.Errorf("max_entries_per_channel must be between 1 and %d", DocumentHistoryMaxEntriesPerChannel)
+	}
+	return nil
+}
+
+func (c *ChannelHistoryConfig) maxEntriesPerChannel() int {
+	if c.MaxEntriesPerChannel == 0 {
+		return DocumentHistoryMaxEntriesPerChannel
+	}
+	return c.MaxEntriesPerChannel
+}
+
+// pruneChannelSetHistory removes channel history entries that are outside the config's window.  Entries that ended
+// more than MaxSequenceAge sequences ago are dropped, then the oldest entries of each channel are merged until there
+// are at most MaxEntriesPerChannel, in the same way as addToChannelSetHistory.  Returns the number of entries removed
+// and the resulting reduction in the size of the sync metadata, in bytes.
+func (doc *Document) pruneChannelSetHistory(config ChannelHistoryConfig) (entriesPruned int, bytesSaved int) {
+	sizeBefore := doc.channelSetHistorySize()
+	entryCountBefore := len(doc.ChannelSet) + len(doc.ChannelSetHistory)
+
+	if config.MaxSequenceAge > 0 && doc.Sequence > config.MaxSequenceAge {
+		minEnd := doc.Sequence - config.MaxSequenceAge
+		isStale := func(entry ChannelSetEntry) bool {
+			return entry.End != 0 && entry.End < minEnd
+		}
+		doc.ChannelSet = filterChannelSetEntries(doc.ChannelSet, isStale)
+		doc.ChannelSetHistory = filterChannelSetEntries(doc.ChannelSetHistory, isStale)
+	}
+
+	maxEntries := config.maxEntriesPerChannel()
+	entriesByChannel := make(map[string][]ChannelSetEntry)
+	for _, entry := range doc.ChannelSetHistory {
+		entriesByChannel[entry.Name] = append(entriesByChannel[entry.Name], entry)
+	}
+	var prunedHistory []ChannelSetEntry
+	for _, entry := range doc.ChannelSetHistory {
+		channelEntries := entriesByChannel[entry.Name]
+		if channelEntries == nil {
+			continue // Already handled
+		}
+		if len(channelEntries) > maxEntries {
+			// Merge the oldest entries into one, so the history covers the same periods
+			sort.Slice(channelEntries, func(i, j int) bool { return channelEntries[i].Start < channelEntries[j].Start })
+			mergeCount := len(channelEntries) - maxEntries + 1
+			merged := channelEntries[mergeCount-1]
+			merged.Start = channelEntries[0].Start
+			channelEntries = append([]ChannelSetEntry{merged}, channelEntries[mergeCount:]...)
+		}
+		prunedHistory = append(prunedHistory, channelEntries...)
+		entriesByChannel[entry.Name] = nil
+	}
+	doc.ChannelSetHistory = prunedHistory
+
+	entriesPruned = entryCountBefore - len(doc.ChannelSet) - len(doc.ChannelSetHistory)
+	if entriesPruned == 0 {
+		return 0, 0
+	}
+	return entriesPruned, sizeBefore - doc.channelSetHistorySize()
+}
+
+// channelSetHistorySize returns the size of the document's channel set and channel set history, as JSON.
+func (doc *Document) channelSetHistorySize() int {
+	data, err := base.JSONMarshal([]interface{}{doc.ChannelSet, doc.ChannelSetHistory})
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
+
+func filterChannelSetEntries(entries []ChannelSetEntry, remove func(ChannelSetEntry) bool) []ChannelSetEntry {
+	var result []ChannelSetEntry
+	for _, entry := range entries {
+		if !remove(entry) {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// pruneChannelHistory prunes the document's channel history according to the given config, and updates the database's
+// stats.  Returns true if anything was pruned.
+func (context *DatabaseContext) pruneChannelHistory(ctx context.Context, doc *Document, config ChannelHistoryConfig) bool {
+	entriesPruned, bytesSaved := doc.pruneChannelSetHistory(config)
+	if entriesPruned == 0 {
+		return false
+	}
+	base.DebugfCtx(ctx, base.KeyCRUD, "Pruned %d channel history entries from doc %q, saving %d bytes", entriesPruned, base.UD(doc.ID), bytesSaved)
+	context.DbStats.Database().ChannelHistoryEntriesPruned.Add(int64(entriesPruned))
+	context.DbStats.Database().ChannelHistoryBytesSaved.Add(int64(bytesSaved))
+	return true
+}
+
+type compactChannelHistoryCallbackFunc func(docsProcessed, docsChanged *int)
+
+// CompactChannelHistory rewrites the sync metadata of every document whose channel history is outside the window of
+// the database's channel history config, or the default window if it has none.  Documents' revisions and sequences are
+// unchanged.  Returns the number of documents changed.
+func (db *Database) CompactChannelHistory(ctx context.Context, callback compactChannelHistoryCallbackFunc, terminator *base.SafeTerminator) (int, error) {
+	base.InfofCtx(ctx, base.KeyAll, "Compacting document channel history...")
+
+	var config ChannelHistoryConfig
+	if db.Options.ChannelHistory != nil {
+		config = *db.Options.ChannelHistory
+	}
+
+	queryLimit := db.Options.QueryPaginationLimit
+	startSeq := uint64(0)
+	endSeq, err := db.sequences.getSequence()
+	if err != nil {
+		return 0, err
+	}
+
+	docsChanged := 0
+	docsProcessed := 0
+	defer callback(&docsProcessed, &docsChanged)
+
+	for {
+		results, err := db.QueryResync(ctx, queryLimit, startSeq, endSeq)
+		if err != nil {
+			return 0, err
+		}
+
+		queryRowCount := 0
+		highSeq := uint64(0)
+
+		var row QueryIdRow
+		for results.Next(&row) {
+			select {
+			case <-terminator.Done():
+				base.InfofCtx(ctx, base.KeyAll, "Channel history compaction was stopped before the operation could be completed. "+
+					"Docs changed: %d Docs Processed: %d", docsChanged, docsProcessed)
+				closeErr := results.Close()
+				if closeErr != nil {
+					return 0, closeErr
+				}
+				return docsChanged, nil
+			default:
+			}
+
+			docid := row.Id
+			key := realDocID(docid)
+			queryRowCount++
+			docsProcessed++
+
+			// Returns the document with its channel history pruned, or ErrUpdateCancel if there's nothing to prune
+			pruneDoc := func(doc *Document) (*Document, error) {
+				highSeq = doc.Sequence
+				if !doc.HasValidSyncData() || !db.pruneChannelHistory(ctx, doc, config) {
+					return nil, base.ErrUpdateCancel
+				}
+				base.DebugfCtx(ctx, base.KeyCRUD, "Saving compacted channel history of %q", base.UD(docid))
+				return doc, nil
+			}
+
+			if db.UseXattrs() {
+				_, err = db.Bucket.WriteUpdateWithXattr(key, base.SyncXattrName, db.Options.UserXattrKey, 0, nil, nil, func(currentValue []byte, currentXattr []byte, currentUserXattr []byte, cas uint64) (
+					raw []byte, rawXattr []byte, deleteDoc bool, expiry *uint32, err error) {
+					if len(currentValue) == 0 {
+						return nil, nil, false, nil, base.ErrUpdateCancel
+					}
+					doc, err := unmarshalDocumentWithXattr(docid, currentValue, currentXattr, currentUserXattr, cas, DocUnmarshalAll)
+					if err != nil {
+						return nil, nil, false, nil, err
+					}
+					if doc, err = pruneDoc(doc); err != nil {
+						return nil, nil, false, nil, err
+					}
+					doc.SetCrc32cUserXattrHash()
+					raw, rawXattr, err = doc.MarshalWithXattr()
+					return raw, rawXattr, false, nil, err
+				})
+			} else {
+				_, err = db.Bucket.Update(key, 0, func(currentValue []byte) ([]byte, *uint32, bool, error) {
+					if currentValue == nil {
+						return nil, nil, false, base.ErrUpdateCancel
+					}
+					doc, err := unmarshalDocument(docid, currentValue)
+					if err != nil {
+						return nil, nil, false, err
+					}
+					if doc, err = pruneDoc(doc); err != nil {
+						return nil, nil, false, err
+					}
+					updatedBytes, marshalErr := base.JSONMarshal(doc)
+					return updatedBytes, nil, false, marshalErr
+				})
+			}
+			if err == nil {
+				docsChanged++
+			} else if err != base.ErrUpdateCancel {
+				base.WarnfCtx(ctx, "Error compacting channel history of doc %q: %v", base.UD(docid), err)
+			}
+		}
+
+		callback(&docsProcessed, &docsChanged)
+
+		closeErr := results.Close()
+		if closeErr != nil {
+			return 0, closeErr
+		}
+
+		if queryRowCount < queryLimit || highSeq >= endSeq {
+			break
+		}
+		startSeq = highSeq + 1
+	}
+
+	base.InfofCtx(ctx, base.KeyAll, "Finished compacting document channel history - %d documents changed", docsChanged)
+	return docsChanged, nil
+}
@@ -0,0 +1,106 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package db
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/couchbase/sync_gateway/channels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPruneChannelSetHistory(t *testing.T) {
+	newDoc := func() *Document {
+		doc := NewDocument("doc1")
+		doc.Sequence = 100
+		doc.ChannelSet = []ChannelSetEntry{
+			{Name: "a", Start: 90},
+			{Name: "b", Start: 5, End: 10},
+		}
+		doc.ChannelSetHistory = []ChannelSetEntry{
+			{Name: "a", Start: 20, End: 30},
+			{Name: "c", Start: 1, End: 2},
+			{Name: "a", Start: 1, End: 10},
+			{Name: "a", Start: 50, End: 60},
+		}
+		return doc
+	}
+
+	// The default window keeps everything
+	doc := newDoc()
+	entriesPruned, bytesSaved := doc.pruneChannelSetHistory(ChannelHistoryConfig{})
+	assert.Equal(t, 0, entriesPruned)
+	assert.Equal(t, 0, bytesSaved)
+	assert.Equal(t, newDoc().ChannelSetHistory, doc.ChannelSetHistory)
+
+	// The oldest entries of a channel are merged
+	doc = newDoc()
+	entriesPruned, bytesSaved = doc.pruneChannelSetHistory(ChannelHistoryConfig{MaxEntriesPerChannel: 2})
+	assert.Equal(t, 1, entriesPruned)
+	assert.Greater(t, bytesSaved, 0)
+	assert.Equal(t, newDoc().ChannelSet, doc.ChannelSet)
+	assert.Equal(t, []ChannelSetEntry{
+		{Name: "a", Start: 1, End: 30},
+		{Name: "a", Start: 50, End: 60},
+		{Name: "c", Start: 1, End: 2},
+	}, doc.ChannelSetHistory)
+
+	// Entries that ended before the sequence window are dropped, but not those that haven't ended
+	doc = newDoc()
+	entriesPruned, _ = doc.pruneChannelSetHistory(ChannelHistoryConfig{MaxSequenceAge: 60})
+	assert.Equal(t, 4, entriesPruned)
+	assert.Equal(t, []ChannelSetEntry{{Name: "a", Start: 90}}, doc.ChannelSet)
+	assert.Equal(t, []ChannelSetEntry{{Name: "a", Start: 50, End: 60}}, doc.ChannelSetHistory)
+}
+
+func TestCompactChannelHistory(t *testing.T) {
+	db, ctx := setupTestDBWithOptions(t, DatabaseContextOptions{QueryPaginationLimit: 5000})
+	defer db.Close(ctx)
+
+	db.ChannelMapper = channels.NewChannelMapper(`function(doc) { channel(doc.channel); }`, 0)
+
+	// Move doc1 in and out of channel "a", building up history
+	revID, _, err := db.Put(ctx, "doc1", Body{"channel": "a"})
+	require.NoError(t, err)
+	for i := 0; i < 4; i++ {
+		revID, _, err = db.Put(ctx, "doc1", Body{BodyRev: revID, "channel": "b"})
+		require.NoError(t, err)
+		revID, _, err = db.Put(ctx, "doc1", Body{BodyRev: revID, "channel": "a"})
+		require.NoError(t, err)
+	}
+	_, _, err = db.Put(ctx, "doc2", Body{"channel": "a"})
+	require.NoError(t, err)
+
+	doc, err := db.GetDocument(ctx, "doc1", DocUnmarshalAll)
+	require.NoError(t, err)
+	require.Len(t, doc.ChannelSetHistory, 7)
+	assert.Equal(t, int64(0), db.DbStats.Database().ChannelHistoryEntriesPruned.Value())
+
+	db.Options.ChannelHistory = &ChannelHistoryConfig{MaxEntriesPerChannel: 1}
+	docsChanged, err := db.CompactChannelHistory(ctx, func(docsProcessed, docsChanged *int) {}, base.NewSafeTerminator())
+	require.NoError(t, err)
+	assert.Equal(t, 1, docsChanged)
+
+	doc, err = db.GetDocument(ctx, "doc1", DocUnmarshalAll)
+	require.NoError(t, err)
+	assert.Equal(t, revID, doc.CurrentRev)
+	assert.Len(t, doc.ChannelSetHistory, 2, fmt.Sprintf("%+v", doc.ChannelSetHistory))
+	assert.Equal(t, int64(5), db.DbStats.Database().ChannelHistoryEntriesPruned.Value())
+	assert.Greater(t, db.DbStats.Database().ChannelHistoryBytesSaved.Value(), int64(0))
+
+	// Subsequent writes keep the history within the window
+	_, _, err = db.Put(ctx, "doc1", Body{BodyRev: revID, "channel": "b"})
+	require.NoError(t, err)
+	doc, err = db.GetDocument(ctx, "doc1", DocUnmarshalAll)
+	require.NoError(t, err)
+	assert.Len(t, doc.ChannelSetHistory, 2)
+}
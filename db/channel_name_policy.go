@@ -0,0 +1,125 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package db
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/couchbase/sync_gateway/channels"
+)
+
+// ChannelNamePolicyConfig restricts the names of the channels that the sync function can assign documents to, or
+// grant access to, so that a typo'd channel name results in an error rather than a new channel.  The star channels
+// ("*" and "!") are always allowed.
+type ChannelNamePolicyConfig struct {
+	AllowedPatterns  []string `json:"allowed_patterns,omitempty"`  // Regexes of allowed names - a name must fully match at least one.  Empty allows all names.
+	MaxLength        int      `json:"max_length,omitempty"`        // Max length of a name in bytes - 0 for no limit
+	ReservedPrefixes []string `json:"reserved_prefixes,omitempty"` // Prefixes that names must not start with
+}
+
+// Validate ensures the config's settings are valid.
+func (c *ChannelNamePolicyConfig) Validate() error {
+	if _, err := compileChannelNamePatterns(c.AllowedPatterns); err != nil {
+		return err
+	}
+	if c.MaxLength < 0 {
+		return fmt.Errorf("max_length must not be negative")
+	}
+	for _, prefix := range c.ReservedPrefixes {
+		if prefix == "" {
+			return fmt.Errorf("reserved_prefixes must not contain an empty prefix")
+		}
+	}
+	return nil
+}
+
+func compileChannelNamePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		// Anchored, so that the pattern must match the whole name
+		regex, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed_patterns regex %q: %w", pattern, err)
+		}
+		compiled = append(compiled, regex)
+	}
+	return compiled, nil
+}
+
+// ChannelNamePolicy checks channel names against a database's ChannelNamePolicyConfig.
+type ChannelNamePolicy struct {
+	allowedPatterns  []*regexp.Regexp
+	maxLength        int
+	reservedPrefixes []string
+}
+
+// NewChannelNamePolicy creates a ChannelNamePolicy enforcing the given config.
+func NewChannelNamePolicy(config ChannelNamePolicyConfig) (*ChannelNamePolicy, error) {
+	allowedPatterns, err := compileChannelNamePatterns(config.AllowedPatterns)
+	if err != nil {
+		return nil, err
+	}
+	return &ChannelNamePolicy{
+		allowedPatterns:  allowedPatterns,
+		maxLength:        config.MaxLength,
+		reservedPrefixes: config.ReservedPrefixes,
+	}, nil
+}
+
+// CheckName returns an error describing why the channel name isn't allowed by the policy, or nil if it is.
+func (p *ChannelNamePolicy) CheckName(name string) error {
+	if name == channels.UserStarChannel || name == channels.DocumentStarChannel {
+		return nil
+	}
+	if p.maxLength > 0 && len(name) > p.maxLength {
+		return fmt.Errorf("channel name %q is longer than the max length of %d", name, p.maxLength)
+	}
+	for _, prefix := range p.reservedPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return fmt.Errorf("channel name %q starts with reserved prefix %q", name, prefix)
+		}
+	}
+	if len(p.allowedPatterns) == 0 {
+		return nil
+	}
+	for _, pattern := range p.allowedPatterns {
+		if pattern.MatchString(name) {
+			return nil
+		}
+	}
+	return fmt.Errorf("channel name %q doesn't match any of the allowed patterns", name)
+}
+
+// CheckSyncFnOutput checks the names of the channels that the sync function assigned a document to, and those it
+// granted access to.  Names are checked in sorted order, so the same output always results in the same error.
+func (p *ChannelNamePolicy) CheckSyncFnOutput(docChannels base.Set, access channels.AccessMap) error {
+	names := docChannels.ToArray()
+	for _, grantedChannels := range access {
+		names = append(names, grantedChannels.ToArray()...)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := p.CheckName(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkChannelNamePolicy checks the sync function's output against the database's channel name policy, if any.
+func (context *DatabaseContext) checkChannelNamePolicy(docChannels base.Set, access channels.AccessMap) error {
+	if context.ChannelNamePolicy == nil {
+		return nil
+	}
+	return context.ChannelNamePolicy.CheckSyncFnOutput(docChannels, access)
+}
@@ -0,0 +1,63 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package db
+
+import (
+	"testing"
+
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/couchbase/sync_gateway/channels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannelNamePolicy(t *testing.T) {
+	policy, err := NewChannelNamePolicy(ChannelNamePolicyConfig{
+		AllowedPatterns:  []string{"user-[a-z]+", "team-(sales|support)"},
+		MaxLength:        12,
+		ReservedPrefixes: []string{"user-admin"},
+	})
+	require.NoError(t, err)
+
+	for _, name := range []string{"user-alice", "team-sales", channels.UserStarChannel, channels.DocumentStarChannel} {
+		assert.NoError(t, policy.CheckName(name), name)
+	}
+	assert.ErrorContains(t, policy.CheckName("user-bartholomew"), "longer than the max length of 12")
+	assert.ErrorContains(t, policy.CheckName("user-adminx"), `starts with reserved prefix "user-admin"`)
+	assert.ErrorContains(t, policy.CheckName("usr-alice"), "doesn't match any of the allowed patterns")
+	// Patterns must match the whole name
+	assert.ErrorContains(t, policy.CheckName("team-salesx"), "doesn't match any of the allowed patterns")
+
+	// Names are checked in sorted order, so the first invalid name is always reported
+	err = policy.CheckSyncFnOutput(base.SetOf("user-bob", "usr-z"), channels.AccessMap{"bob": base.SetOf("usr-b", "user-bob")})
+	assert.EqualError(t, err, `channel name "usr-b" doesn't match any of the allowed patterns`)
+	assert.NoError(t, policy.CheckSyncFnOutput(base.SetOf("user-bob"), channels.AccessMap{"bob": base.SetOf("team-sales")}))
+}
+
+func TestChannelNamePolicySyncFn(t *testing.T) {
+
+	db, ctx := setupTestDB(t)
+	defer db.Close(ctx)
+
+	db.ChannelMapper = channels.NewChannelMapper(`function(doc) {
+		channel(doc.channels);
+		if (doc.grant) access("bob", doc.grant);
+	}`, 0)
+	var err error
+	db.ChannelNamePolicy, err = NewChannelNamePolicy(ChannelNamePolicyConfig{AllowedPatterns: []string{"[a-z]+"}})
+	require.NoError(t, err)
+
+	_, _, err = db.Put(ctx, "doc1", Body{"channels": []string{"valid", "!"}})
+	require.NoError(t, err)
+	_, _, err = db.Put(ctx, "doc2", Body{"channels": []string{"valid", "Typo"}})
+	assertHTTPError(t, err, 500)
+	assert.ErrorContains(t, err, `channel name "Typo" doesn't match any of the allowed patterns`)
+	_, _, err = db.Put(ctx, "doc3", Body{"channels": []string{"valid"}, "grant": "Typo"})
+	assertHTTPError(t, err, 500)
+}
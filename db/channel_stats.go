@@ -0,0 +1,135 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package db
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/couchbase/sync_gateway/base"
+)
+
+// ChannelStats describes a channel known to the database, as returned by the admin API's /{db}/_channels endpoint.
+// Doc and user counts are tracked incrementally from the changes processed by this node's change cache since the
+// database was started, so only reflect documents and users that have changed since then.
+type ChannelStats struct {
+	Name          string `json:"name"`
+	DocCount      int64  `json:"doc_count"`                // Net number of docs that have joined the channel
+	LastSequence  uint64 `json:"last_sequence,omitempty"`  // Sequence of the most recent change to a doc in the channel
+	Cached        bool   `json:"cached"`                   // Whether the channel has an active channel cache
+	CachedEntries int    `json:"cached_entries,omitempty"` // Number of changes held in the channel cache
+	GrantedUsers  int64  `json:"granted_users"`            // Number of users granted access to the channel, excluding via roles
+}
+
+// channelStatsTracker incrementally tracks per-channel stats from the docs and users processed by the change cache.
+type channelStatsTracker struct {
+	lock         sync.RWMutex
+	channels     map[string]*channelStatsEntry
+	userChannels map[string]base.Set // Channels granted to each user, as of their most recent principal doc
+}
+
+type channelStatsEntry struct {
+	docCount     int64
+	lastSequence uint64
+	grantedUsers int64
+}
+
+func newChannelStatsTracker() *channelStatsTracker {
+	return &channelStatsTracker{
+		channels:     make(map[string]*channelStatsEntry),
+		userChannels: make(map[string]base.Set),
+	}
+}
+
+// _getEntry returns the stats entry for the channel, creating it if necessary.  Requires the write lock.
+func (t *channelStatsTracker) _getEntry(channelName string) *channelStatsEntry {
+	entry, ok := t.channels[channelName]
+	if !ok {
+		entry = &channelStatsEntry{}
+		t.channels[channelName] = entry
+	}
+	return entry
+}
+
+// addChange updates the stats of the channels that a doc change is in, or was removed from.
+func (t *channelStatsTracker) addChange(change *LogEntry) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for channelName, removal := range change.Channels {
+		if removal == nil {
+			entry := t._getEntry(channelName)
+			entry.lastSequence = change.Sequence
+			if change.ChannelsAdded.Contains(channelName) {
+				entry.docCount++
+			}
+		} else if removal.Seq == change.Sequence {
+			entry := t._getEntry(channelName)
+			entry.lastSequence = change.Sequence
+			entry.docCount--
+		}
+	}
+}
+
+// updateUserChannels updates the granted user counts for the channels that a user has been granted access to.
+func (t *channelStatsTracker) updateUserChannels(username string, grantedChannels base.Set) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	previousChannels := t.userChannels[username]
+	for channelName := range previousChannels {
+		if !grantedChannels.Contains(channelName) {
+			t._getEntry(channelName).grantedUsers--
+		}
+	}
+	for channelName := range grantedChannels {
+		if !previousChannels.Contains(channelName) {
+			t._getEntry(channelName).grantedUsers++
+		}
+	}
+	if len(grantedChannels) == 0 {
+		delete(t.userChannels, username)
+	} else {
+		t.userChannels[username] = grantedChannels
+	}
+}
+
+// GetChannelStats returns the stats of all the channels known to the database, sorted by name.
+func (context *DatabaseContext) GetChannelStats() []ChannelStats {
+	statsByName := make(map[string]*ChannelStats)
+	getStats := func(channelName string) *ChannelStats {
+		stats, ok := statsByName[channelName]
+		if !ok {
+			stats = &ChannelStats{Name: channelName}
+			statsByName[channelName] = stats
+		}
+		return stats
+	}
+
+	tracker := context.changeCache.channelStats
+	tracker.lock.RLock()
+	for channelName, entry := range tracker.channels {
+		stats := getStats(channelName)
+		stats.DocCount = entry.docCount
+		stats.LastSequence = entry.lastSequence
+		stats.GrantedUsers = entry.grantedUsers
+	}
+	tracker.lock.RUnlock()
+
+	for channelName, size := range context.changeCache.getChannelCache().CachedChannelSizes() {
+		stats := getStats(channelName)
+		stats.Cached = true
+		stats.CachedEntries = size
+	}
+
+	result := make([]ChannelStats, 0, len(statsByName))
+	for _, stats := range statsByName {
+		result = append(result, *stats)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
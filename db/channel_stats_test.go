@@ -0,0 +1,69 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package db
+
+import (
+	"testing"
+
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/couchbase/sync_gateway/channels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannelStatsTracker(t *testing.T) {
+	tracker := newChannelStatsTracker()
+
+	// doc1 joins a and b, then is updated while in a, then leaves b
+	tracker.addChange(&LogEntry{Sequence: 1, Channels: channels.ChannelMap{"a": nil, "b": nil}, ChannelsAdded: base.SetOf("a", "b")})
+	tracker.addChange(&LogEntry{Sequence: 2, Channels: channels.ChannelMap{"a": nil, "b": nil}})
+	tracker.addChange(&LogEntry{Sequence: 3, Channels: channels.ChannelMap{"a": nil, "b": &channels.ChannelRemoval{Seq: 3}}})
+	// doc2 was removed from c before the tracker started
+	tracker.addChange(&LogEntry{Sequence: 4, Channels: channels.ChannelMap{"a": nil, "c": &channels.ChannelRemoval{Seq: 1}}, ChannelsAdded: base.SetOf("a")})
+
+	assert.Equal(t, &channelStatsEntry{docCount: 2, lastSequence: 4}, tracker.channels["a"])
+	assert.Equal(t, &channelStatsEntry{docCount: 0, lastSequence: 3}, tracker.channels["b"])
+	assert.NotContains(t, tracker.channels, "c")
+
+	tracker.updateUserChannels("alice", base.SetOf("a", "b"))
+	tracker.updateUserChannels("bob", base.SetOf("a"))
+	tracker.updateUserChannels("alice", base.SetOf("a", "d"))
+	assert.Equal(t, int64(2), tracker.channels["a"].grantedUsers)
+	assert.Equal(t, int64(0), tracker.channels["b"].grantedUsers)
+	assert.Equal(t, int64(1), tracker.channels["d"].grantedUsers)
+
+	// Deleted users no longer count
+	tracker.updateUserChannels("alice", nil)
+	assert.Equal(t, int64(1), tracker.channels["a"].grantedUsers)
+	assert.Equal(t, int64(0), tracker.channels["d"].grantedUsers)
+}
+
+func TestGetChannelStats(t *testing.T) {
+	db, ctx := setupTestDB(t)
+	defer db.Close(ctx)
+
+	db.ChannelMapper = channels.NewChannelMapper(`function(doc) { channel(doc.channels); }`, 0)
+
+	rev1ID, _, err := db.Put(ctx, "doc1", Body{"channels": []string{"a", "b"}})
+	require.NoError(t, err)
+	_, _, err = db.Put(ctx, "doc2", Body{"channels": []string{"a"}})
+	require.NoError(t, err)
+	_, _, err = db.Put(ctx, "doc1", Body{BodyRev: rev1ID, "channels": []string{"a"}})
+	require.NoError(t, err)
+	require.NoError(t, db.WaitForPendingChanges(ctx))
+
+	// Populate the cache for channel a
+	_, err = db.changeCache.GetChanges("a", getChangesOptionsWithZeroSeq())
+	require.NoError(t, err)
+
+	stats := db.GetChannelStats()
+	require.Len(t, stats, 2)
+	assert.Equal(t, ChannelStats{Name: "a", DocCount: 2, LastSequence: 3, Cached: true, CachedEntries: 2}, stats[0])
+	assert.Equal(t, ChannelStats{Name: "b", DocCount: 0, LastSequence: 3}, stats[1])
+}
@@ -0,0 +1,200 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package db
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxClientTelemetryEntries limits the number of distinct clients tracked for a database, so that arbitrary
+	// User-Agent headers can't use unbounded memory.  Further clients are counted as ClientOther.
+	maxClientTelemetryEntries = 1000
+
+	// maxClientFieldLength is the longest client name, version or platform kept from a User-Agent header.
+	maxClientFieldLength = 64
+
+	// maxClientProtocols is the number of distinct BLIP subprotocols counted for a client.
+	maxClientProtocols = 16
+
+	// ClientCouchbaseLite is the client name in Couchbase Lite's User-Agent header.
+	ClientCouchbaseLite = "CouchbaseLite"
+	// ClientSyncGateway is the client name in the User-Agent header of inter-Sync Gateway replications.
+	ClientSyncGateway = "SyncGateway"
+	// ClientUnknown is used for requests without a User-Agent header.
+	ClientUnknown = "unknown"
+	// ClientOther is used for clients beyond maxClientTelemetryEntries.
+	ClientOther = "other"
+)
+
+// ClientInfo identifies the build of a client, as parsed from its User-Agent header.
+type ClientInfo struct {
+	Client   string `json:"client"`             // Product name, such as CouchbaseLite
+	Version  string `json:"version,omitempty"`  // Product version, without Couchbase Lite's build number
+	Platform string `json:"platform,omitempty"` // Operating system reported by Couchbase Lite, such as Android or iOS
+}
+
+// ClientSummary is the usage of a database by a client build.
+type ClientSummary struct {
+	ClientInfo
+	RESTRequests      uint64            `json:"rest_requests"`       // Public REST API requests, other than those upgraded to websockets
+	BLIPConnections   uint64            `json:"blip_connections"`    // BLIP replication connections made
+	ActiveConnections int64             `json:"active_connections"`  // BLIP replication connections currently open
+	Protocols         map[string]uint64 `json:"protocols,omitempty"` // BLIP connections by each subprotocol the client offered
+	LastSeen          time.Time         `json:"last_seen"`
+}
+
+// ClientTelemetry counts the requests and replications made to a database by each client build, so that it's known
+// which client versions are still connecting before support for them is dropped.  Counts are kept in memory, and
+// reset when the database is reloaded.
+type ClientTelemetry struct {
+	lock    sync.Mutex
+	clients map[ClientInfo]*ClientSummary
+}
+
+func NewClientTelemetry() *ClientTelemetry {
+	return &ClientTelemetry{clients: make(map[ClientInfo]*ClientSummary)}
+}
+
+// ParseClientUserAgent returns the client, version and platform from a User-Agent header such as
+// "CouchbaseLite/3.0.2-13 (Java; Android 12; Pixel 6) Build/13 Commit/abc LiteCore/3.0.2".  Headers not from
+// Couchbase Lite are identified by their first product token.
+func ParseClientUserAgent(userAgent string) ClientInfo {
+	userAgent = strings.TrimSpace(userAgent)
+	if userAgent == "" {
+		return ClientInfo{Client: ClientUnknown}
+	}
+	product := userAgent
+	if i := strings.IndexAny(product, " ("); i >= 0 {
+		product = product[:i]
+	}
+	name, version, _ := strings.Cut(product, "/")
+	info := ClientInfo{Client: truncateClientField(name), Version: truncateClientField(version)}
+	if info.Client == "" {
+		info.Client = ClientUnknown
+	}
+	if info.Client != ClientCouchbaseLite {
+		return info
+	}
+
+	// Couchbase Lite versions include a build number, which isn't needed to identify the release
+	info.Version, _, _ = strings.Cut(info.Version, "-")
+
+	// The second comment field is the operating system and its version, such as "Android 12" or "iOS 15.2"
+	_, comment, found := strings.Cut(userAgent, "(")
+	if !found {
+		return info
+	}
+	comment, _, _ = strings.Cut(comment, ")")
+	fields := strings.Split(comment, ";")
+	if len(fields) < 2 {
+		return info
+	}
+	var platform []string
+	for _, word := range strings.Fields(fields[1]) {
+		if word[0] >= '0' && word[0] <= '9' {
+			break
+		}
+		platform = append(platform, word)
+	}
+	info.Platform = truncateClientField(strings.Join(platform, " "))
+	return info
+}
+
+func truncateClientField(field string) string {
+	if len(field) > maxClientFieldLength {
+		return field[:maxClientFieldLength]
+	}
+	return field
+}
+
+// summary returns the usage of the given client, adding it if necessary.  Must be called with the lock held.
+func (t *ClientTelemetry) summary(info ClientInfo) *ClientSummary {
+	summary, ok := t.clients[info]
+	if ok {
+		return summary
+	}
+	if len(t.clients) >= maxClientTelemetryEntries {
+		info = ClientInfo{Client: ClientOther}
+		if summary, ok = t.clients[info]; ok {
+			return summary
+		}
+	}
+	summary = &ClientSummary{ClientInfo: info}
+	t.clients[info] = summary
+	return summary
+}
+
+// RecordRequest counts a public REST API request from the client with the given User-Agent header.
+func (t *ClientTelemetry) RecordRequest(userAgent string) {
+	info := ParseClientUserAgent(userAgent)
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	summary := t.summary(info)
+	summary.RESTRequests++
+	summary.LastSeen = time.Now()
+}
+
+// AddBLIPConnection counts a BLIP replication connection from the client with the given User-Agent header, which
+// offered the given BLIP subprotocols.  The returned function must be called when the connection closes.
+func (t *ClientTelemetry) AddBLIPConnection(userAgent string, protocols []string) (release func()) {
+	info := ParseClientUserAgent(userAgent)
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	summary := t.summary(info)
+	summary.BLIPConnections++
+	summary.ActiveConnections++
+	summary.LastSeen = time.Now()
+	for _, protocol := range protocols {
+		if summary.Protocols == nil {
+			summary.Protocols = make(map[string]uint64)
+		}
+		protocol = truncateClientField(protocol)
+		if _, ok := summary.Protocols[protocol]; ok || len(summary.Protocols) < maxClientProtocols {
+			summary.Protocols[protocol]++
+		}
+	}
+	return func() {
+		t.lock.Lock()
+		defer t.lock.Unlock()
+		summary.ActiveConnections--
+		summary.LastSeen = time.Now()
+	}
+}
+
+// Clients returns the usage of the database by each client build, ordered by client and version.
+func (t *ClientTelemetry) Clients() []ClientSummary {
+	t.lock.Lock()
+	clients := make([]ClientSummary, 0, len(t.clients))
+	for _, summary := range t.clients {
+		client := *summary
+		if summary.Protocols != nil {
+			client.Protocols = make(map[string]uint64, len(summary.Protocols))
+			for protocol, count := range summary.Protocols {
+				client.Protocols[protocol] = count
+			}
+		}
+		clients = append(clients, client)
+	}
+	t.lock.Unlock()
+
+	sort.Slice(clients, func(i, j int) bool {
+		if clients[i].Client != clients[j].Client {
+			return clients[i].Client < clients[j].Client
+		}
+		if clients[i].Version != clients[j].Version {
+			return clients[i].Version < clients[j].Version
+		}
+		return clients[i].Platform < clients[j].Platform
+	})
+	return clients
+}
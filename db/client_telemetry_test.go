@@ -0,0 +1,80 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package db
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseClientUserAgent(t *testing.T) {
+	testCases := []struct {
+		userAgent string
+		expected  ClientInfo
+	}{
+		{"CouchbaseLite/3.0.2-13 (Java; Android 12; Pixel 6) EE/release, Commit/abc Core/3.0.2", ClientInfo{Client: ClientCouchbaseLite, Version: "3.0.2", Platform: "Android"}},
+		{"CouchbaseLite/2.8.4 (Swift; iOS 14.4; iPhone) Build/9 Commit/abc LiteCore/2.8.4", ClientInfo{Client: ClientCouchbaseLite, Version: "2.8.4", Platform: "iOS"}},
+		{"CouchbaseLite/3.1.0-5 (.NET; Microsoft Windows 10.0.19041) Build/5", ClientInfo{Client: ClientCouchbaseLite, Version: "3.1.0", Platform: "Microsoft Windows"}},
+		{"CouchbaseLite/1.4", ClientInfo{Client: ClientCouchbaseLite, Version: "1.4"}},
+		{"SyncGateway/3.1.0", ClientInfo{Client: ClientSyncGateway, Version: "3.1.0"}},
+		{"curl/7.79.1", ClientInfo{Client: "curl", Version: "7.79.1"}},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7)", ClientInfo{Client: "Mozilla", Version: "5.0"}},
+		{"", ClientInfo{Client: ClientUnknown}},
+		{"(no product)", ClientInfo{Client: ClientUnknown}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.userAgent, func(t *testing.T) {
+			assert.Equal(t, tc.expected, ParseClientUserAgent(tc.userAgent))
+		})
+	}
+}
+
+func TestClientTelemetry(t *testing.T) {
+	telemetry := NewClientTelemetry()
+	const android = "CouchbaseLite/3.0.2-13 (Java; Android 12; Pixel 6)"
+	const ios = "CouchbaseLite/2.8.4 (Swift; iOS 14.4; iPhone)"
+
+	telemetry.RecordRequest(android)
+	release := telemetry.AddBLIPConnection(android, []string{BlipCBMobileReplicationV3, BlipCBMobileReplicationV2})
+	telemetry.AddBLIPConnection(ios, []string{BlipCBMobileReplicationV2})()
+
+	clients := telemetry.Clients()
+	require.Len(t, clients, 2)
+	assert.Equal(t, "2.8.4", clients[0].Version)
+	assert.Equal(t, uint64(1), clients[0].BLIPConnections)
+	assert.Equal(t, int64(0), clients[0].ActiveConnections)
+	assert.Equal(t, map[string]uint64{BlipCBMobileReplicationV2: 1}, clients[0].Protocols)
+
+	assert.Equal(t, "3.0.2", clients[1].Version)
+	assert.Equal(t, uint64(1), clients[1].RESTRequests)
+	assert.Equal(t, uint64(1), clients[1].BLIPConnections)
+	assert.Equal(t, int64(1), clients[1].ActiveConnections)
+	assert.Equal(t, map[string]uint64{BlipCBMobileReplicationV3: 1, BlipCBMobileReplicationV2: 1}, clients[1].Protocols)
+
+	release()
+	assert.Equal(t, int64(0), telemetry.Clients()[1].ActiveConnections)
+
+	// Clients beyond the limit are counted together
+	for i := 0; i < maxClientTelemetryEntries; i++ {
+		telemetry.RecordRequest("client/" + strconv.Itoa(i))
+	}
+	clients = telemetry.Clients()
+	require.Len(t, clients, maxClientTelemetryEntries+1)
+	var other *ClientSummary
+	for i := range clients {
+		if clients[i].Client == ClientOther {
+			other = &clients[i]
+		}
+	}
+	require.NotNil(t, other)
+	assert.Equal(t, uint64(2), other.RESTRequests)
+}
@@ -0,0 +1,178 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/couchbase/sync_gateway/base"
+)
+
+const (
+	DefaultCollectionQuotaWarningThresholdPercent = 80
+	collectionQuotaRefreshInterval                = 5 * time.Minute
+)
+
+var ErrCollectionQuotaExceeded = base.HTTPErrorf(http.StatusForbidden, "Collection quota exceeded")
+
+// CollectionQuotaConfig limits the number and total size of the documents in a collection, for deployments that map
+// tenants onto collections.
+type CollectionQuotaConfig struct {
+	MaxDocs                 *int64  `json:"max_docs,omitempty"`                  // Maximum number of live documents in the collection
+	MaxBytes                *int64  `json:"max_bytes,omitempty"`                 // Maximum total size of the bodies of the live documents in the collection
+	WarningThresholdPercent *uint32 `json:"warning_threshold_percent,omitempty"` // Percentage of a quota above which a warning is logged
+}
+
+// Validate ensures the config's settings are valid.
+func (c *CollectionQuotaConfig) Validate() error {
+	if c.MaxDocs != nil && *c.MaxDocs < 1 {
+		return fmt.Errorf("max_docs must be at least 1")
+	}
+	if c.MaxBytes != nil && *c.MaxBytes < 1 {
+		return fmt.Errorf("max_bytes must be at least 1")
+	}
+	if c.WarningThresholdPercent != nil && (*c.WarningThresholdPercent < 1 || *c.WarningThresholdPercent > 100) {
+		return fmt.Errorf("warning_threshold_percent must be between 1 and 100")
+	}
+	return nil
+}
+
+// collectionQuota enforces a collection's quotas on the writes made through this node.  Usage is established by
+// querying the collection when the database starts, and periodically after that to pick up writes made by other nodes
+// and SDKs, and is adjusted for each write made through this node in between.
+type collectionQuota struct {
+	maxDocs      int64 // Zero when the number of docs isn't limited
+	maxBytes     int64 // Zero when the size of docs isn't limited
+	warnDocs     int64
+	warnBytes    int64
+	docCount     int64 // Accessed atomically
+	bodyBytes    int64 // Accessed atomically
+	warning      int32 // Non-zero while usage is above a warning threshold, accessed atomically
+	stats        *base.CollectionStats
+	collectionID string // Scope and collection, for logging
+}
+
+// newCollectionQuota returns the quota for the given config, or nil when no quotas are configured.
+func newCollectionQuota(config *CollectionQuotaConfig, collectionStats *base.CollectionStats, collectionID string) *collectionQuota {
+	if config == nil || (config.MaxDocs == nil && config.MaxBytes == nil) {
+		return nil
+	}
+	q := &collectionQuota{
+		stats:        collectionStats,
+		collectionID: collectionID,
+	}
+	warningThresholdPercent := int64(DefaultCollectionQuotaWarningThresholdPercent)
+	if config.WarningThresholdPercent != nil {
+		warningThresholdPercent = int64(*config.WarningThresholdPercent)
+	}
+	if config.MaxDocs != nil {
+		q.maxDocs = *config.MaxDocs
+		q.warnDocs = q.maxDocs * warningThresholdPercent / 100
+	}
+	if config.MaxBytes != nil {
+		q.maxBytes = *config.MaxBytes
+		q.warnBytes = q.maxBytes * warningThresholdPercent / 100
+	}
+	return q
+}
+
+// checkWrite returns ErrCollectionQuotaExceeded if a write changing the number and size of live docs by the given
+// amounts would exceed a quota.  Writes that don't add docs or bytes are always allowed, so that docs can be deleted
+// or shrunk when over quota.  Safe to call on a nil quota.
+func (q *collectionQuota) checkWrite(docDelta, bytesDelta int64) error {
+	if q == nil {
+		return nil
+	}
+	if (q.maxDocs > 0 && docDelta > 0 && atomic.LoadInt64(&q.docCount)+docDelta > q.maxDocs) ||
+		(q.maxBytes > 0 && bytesDelta > 0 && atomic.LoadInt64(&q.bodyBytes)+bytesDelta > q.maxBytes) {
+		q.stats.QuotaRejectedCount.Add(1)
+		return ErrCollectionQuotaExceeded
+	}
+	return nil
+}
+
+// recordWrite adjusts usage for a completed write.  Safe to call on a nil quota.
+func (q *collectionQuota) recordWrite(ctx context.Context, docDelta, bytesDelta int64) {
+	if q == nil || (docDelta == 0 && bytesDelta == 0) {
+		return
+	}
+	q.updateUsage(ctx, atomic.AddInt64(&q.docCount, docDelta), atomic.AddInt64(&q.bodyBytes, bytesDelta))
+}
+
+// setUsage replaces the usage with that found by querying the collection.
+func (q *collectionQuota) setUsage(ctx context.Context, docCount, bodyBytes int64) {
+	atomic.StoreInt64(&q.docCount, docCount)
+	atomic.StoreInt64(&q.bodyBytes, bodyBytes)
+	q.updateUsage(ctx, docCount, bodyBytes)
+}
+
+// updateUsage updates the usage stats, and logs a warning when usage rises above a warning threshold.
+func (q *collectionQuota) updateUsage(ctx context.Context, docCount, bodyBytes int64) {
+	q.stats.QuotaDocCount.Set(docCount)
+	q.stats.QuotaBodyBytes.Set(bodyBytes)
+
+	aboveThreshold := (q.maxDocs > 0 && docCount >= q.warnDocs) || (q.maxBytes > 0 && bodyBytes >= q.warnBytes)
+	if !aboveThreshold {
+		atomic.StoreInt32(&q.warning, 0)
+	} else if atomic.CompareAndSwapInt32(&q.warning, 0, 1) {
+		q.stats.QuotaWarningCount.Add(1)
+		base.WarnfCtx(ctx, "Collection %s is approaching its quota - %d docs of max_docs %d, %d bytes of max_bytes %d",
+			base.MD(q.collectionID), docCount, q.maxDocs, bodyBytes, q.maxBytes)
+	}
+}
+
+// initCollectionQuota returns the quota for the database's collection, or nil when none is configured.
+// WIP: Collections Phase 1 - a database runs with a single collection, whose quota is returned.
+func initCollectionQuota(collectionStats *base.CollectionStats, scopes ScopesOptions) *collectionQuota {
+	for scopeName, scope := range scopes {
+		for collectionName, collection := range scope.Collections {
+			return newCollectionQuota(collection.Quota, collectionStats, scopeName+base.ScopeCollectionSeparator+collectionName)
+		}
+	}
+	return nil
+}
+
+// refreshCollectionQuotaUsage queries the collection for the number and size of its live docs, and replaces the
+// quota's usage with the result.
+func (context *DatabaseContext) refreshCollectionQuotaUsage(ctx context.Context) error {
+	results, err := context.QueryCollectionUsage(ctx)
+	if err != nil {
+		return err
+	}
+	var usage struct {
+		Docs  int64 `json:"docs"`
+		Bytes int64 `json:"bytes"`
+	}
+	found := results.Next(&usage)
+	if err := results.Close(); err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("no results from collection usage query")
+	}
+	context.collectionQuota.setUsage(ctx, usage.Docs, usage.Bytes)
+	return nil
+}
+
+// quotaDeltas returns the change in the number and size of live docs made by replacing a doc's body.
+func quotaDeltas(prevLive bool, prevBytes int, newLive bool, newBytes int) (docDelta, bytesDelta int64) {
+	if prevLive {
+		docDelta--
+		bytesDelta -= int64(prevBytes)
+	}
+	if newLive {
+		docDelta++
+		bytesDelta += int64(newBytes)
+	}
+	return docDelta, bytesDelta
+}
@@ -0,0 +1,81 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package db
+
+import (
+	"testing"
+
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectionQuotaConfigValidate(t *testing.T) {
+	assert.NoError(t, (&CollectionQuotaConfig{}).Validate())
+	assert.NoError(t, (&CollectionQuotaConfig{MaxDocs: base.Int64Ptr(10), MaxBytes: base.Int64Ptr(1024), WarningThresholdPercent: base.Uint32Ptr(90)}).Validate())
+	assert.Error(t, (&CollectionQuotaConfig{MaxDocs: base.Int64Ptr(0)}).Validate())
+	assert.Error(t, (&CollectionQuotaConfig{MaxBytes: base.Int64Ptr(-1)}).Validate())
+	assert.Error(t, (&CollectionQuotaConfig{WarningThresholdPercent: base.Uint32Ptr(0)}).Validate())
+	assert.Error(t, (&CollectionQuotaConfig{WarningThresholdPercent: base.Uint32Ptr(101)}).Validate())
+}
+
+func TestCollectionQuota(t *testing.T) {
+	ctx := base.TestCtx(t)
+	collectionStats := base.NewSyncGatewayStats().NewDBStats("", false, false, false).InitCollectionStats("scope1", "collection1")
+	assert.Nil(t, newCollectionQuota(nil, collectionStats, "scope1.collection1"))
+	assert.Nil(t, newCollectionQuota(&CollectionQuotaConfig{WarningThresholdPercent: base.Uint32Ptr(50)}, collectionStats, "scope1.collection1"))
+
+	// A nil quota allows all writes
+	var nilQuota *collectionQuota
+	assert.NoError(t, nilQuota.checkWrite(1, 100))
+	nilQuota.recordWrite(ctx, 1, 100)
+
+	quota := newCollectionQuota(&CollectionQuotaConfig{MaxDocs: base.Int64Ptr(10), MaxBytes: base.Int64Ptr(1000)}, collectionStats, "scope1.collection1")
+	require.NotNil(t, quota)
+	quota.setUsage(ctx, 7, 500)
+	assert.Equal(t, int64(7), collectionStats.QuotaDocCount.Value())
+	assert.Equal(t, int64(0), collectionStats.QuotaWarningCount.Value())
+
+	// Crossing the default 80% threshold warns once
+	assert.NoError(t, quota.checkWrite(1, 100))
+	quota.recordWrite(ctx, 1, 100)
+	quota.recordWrite(ctx, 1, 100)
+	assert.Equal(t, int64(9), collectionStats.QuotaDocCount.Value())
+	assert.Equal(t, int64(700), collectionStats.QuotaBodyBytes.Value())
+	assert.Equal(t, int64(1), collectionStats.QuotaWarningCount.Value())
+
+	// Writes taking usage over either limit are rejected
+	assert.Equal(t, ErrCollectionQuotaExceeded, quota.checkWrite(2, 100))
+	assert.Equal(t, ErrCollectionQuotaExceeded, quota.checkWrite(0, 301))
+	assert.Equal(t, int64(2), collectionStats.QuotaRejectedCount.Value())
+
+	// Deletions and shrinking updates are allowed when over quota
+	quota.setUsage(ctx, 12, 2000)
+	assert.NoError(t, quota.checkWrite(-1, -100))
+	assert.NoError(t, quota.checkWrite(0, -10))
+
+	// Falling below the threshold re-arms the warning
+	quota.setUsage(ctx, 1, 100)
+	quota.setUsage(ctx, 9, 100)
+	assert.Equal(t, int64(2), collectionStats.QuotaWarningCount.Value())
+}
+
+func TestQuotaDeltas(t *testing.T) {
+	docDelta, bytesDelta := quotaDeltas(false, 0, true, 100)
+	assert.Equal(t, int64(1), docDelta)
+	assert.Equal(t, int64(100), bytesDelta)
+
+	docDelta, bytesDelta = quotaDeltas(true, 100, true, 150)
+	assert.Equal(t, int64(0), docDelta)
+	assert.Equal(t, int64(50), bytesDelta)
+
+	docDelta, bytesDelta = quotaDeltas(true, 100, false, 20)
+	assert.Equal(t, int64(-1), docDelta)
+	assert.Equal(t, int64(-100), bytesDelta)
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2022-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/couchbase/sync_gateway/base"
+)
+
+// CRDTOptions identifies the top-level document properties in a collection that are merged as conflict-free
+// replicated data types during sg-replicate conflict resolution, instead of being taken from the winning revision.
+type CRDTOptions struct {
+	Counters []string // Numeric properties merged as counters - concurrent increments and decrements are summed
+	Sets     []string // Array properties merged as observed-remove sets - concurrent additions and removals are kept
+}
+
+// Validate ensures that properties are valid top-level property names and aren't defined more than once.
+func (o *CRDTOptions) Validate() error {
+	seen := make(base.Set, len(o.Counters)+len(o.Sets))
+	for _, properties := range [][]string{o.Counters, o.Sets} {
+		for _, property := range properties {
+			if property == "" {
+				return fmt.Errorf("CRDT property names must not be empty")
+			}
+			if strings.HasPrefix(property, "_") {
+				return fmt.Errorf("CRDT property %q must not start with an underscore", property)
+			}
+			if seen.Contains(property) {
+				return fmt.Errorf("CRDT property %q must only be defined once", property)
+			}
+			seen.Add(property)
+		}
+	}
+	return nil
+}
+
+// crdtOptions returns the CRDT options for the database's collection, or nil if none are defined.
+func (context *DatabaseContext) crdtOptions() *CRDTOptions {
+	// WIP: Collections Phase 1 - the database runs against a single collection
+	for _, scope := range context.Options.Scopes {
+		for _, collection := range scope.Collections {
+			if collection.CRDT != nil {
+				return collection.CRDT
+			}
+		}
+	}
+	return nil
+}
+
+// mergeCRDTProperties performs a three-way merge of the CRDT properties of the local and remote documents, using the
+// body of their common ancestor as the base, and applies the merged values to winner.  When ancestor is nil
+// (e.g. the common ancestor's body is no longer available) sets are merged as a union, and counters are left as the
+// winner's value.  Returns true if any property on winner was modified.
+func (o *CRDTOptions) mergeCRDTProperties(conflict Conflict, ancestor Body, winner Body) (modified bool) {
+	for _, property := range o.Counters {
+		if ancestor == nil {
+			continue
+		}
+		local, localOK := crdtCounterValue(conflict.LocalDocument, property)
+		remote, remoteOK := crdtCounterValue(conflict.RemoteDocument, property)
+		if !localOK || !remoteOK {
+			continue
+		}
+		// A missing or non-numeric ancestor value is treated as zero
+		baseValue, _ := crdtCounterValue(ancestor, property)
+		merged := local + remote - baseValue
+		if current, ok := crdtCounterValue(winner, property); !ok || current != merged {
+			winner[property] = merged
+			modified = true
+		}
+	}
+
+	for _, property := range o.Sets {
+		local, localOK := conflict.LocalDocument[property].([]interface{})
+		remote, remoteOK := conflict.RemoteDocument[property].([]interface{})
+		if !localOK || !remoteOK {
+			continue
+		}
+		baseItems, _ := ancestor[property].([]interface{})
+		merged := mergeCRDTSet(baseItems, local, remote)
+		if current, ok := winner[property].([]interface{}); !ok || !crdtSetEquals(current, merged) {
+			winner[property] = merged
+			modified = true
+		}
+	}
+	return modified
+}
+
+// crdtCounterValue returns the numeric value of the given property, if present.
+func crdtCounterValue(body Body, property string) (float64, bool) {
+	switch value := body[property].(type) {
+	case float64:
+		return value, true
+	case int:
+		return float64(value), true
+	case int64:
+		return float64(value), true
+	case json.Number:
+		if f, err := value.Float64(); err == nil {
+			return f, true
+		}
+	}
+	return 0, false
+}
+
+// mergeCRDTSet merges local and remote as observed-remove sets relative to baseItems.  An item is retained when it
+// is present on both sides, or was added on either side since the base.  Items removed on either side are dropped.
+// Local ordering is preserved, followed by items added remotely.
+func mergeCRDTSet(baseItems, local, remote []interface{}) []interface{} {
+	baseKeys := crdtSetKeys(baseItems)
+	localKeys := crdtSetKeys(local)
+	remoteKeys := crdtSetKeys(remote)
+
+	merged := make([]interface{}, 0, len(local)+len(remote))
+	mergedKeys := make(base.Set, len(local)+len(remote))
+	for _, item := range local {
+		key := crdtSetKey(item)
+		if mergedKeys.Contains(key) {
+			continue
+		}
+		if remoteKeys.Contains(key) || !baseKeys.Contains(key) {
+			merged = append(merged, item)
+			mergedKeys.Add(key)
+		}
+	}
+	for _, item := range remote {
+		key := crdtSetKey(item)
+		if mergedKeys.Contains(key) || localKeys.Contains(key) {
+			continue
+		}
+		if !baseKeys.Contains(key) {
+			merged = append(merged, item)
+			mergedKeys.Add(key)
+		}
+	}
+	return merged
+}
+
+// crdtSetEquals returns true if a and b contain the same items in the same order.
+func crdtSetEquals(a, b []interface{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if crdtSetKey(a[i]) != crdtSetKey(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func crdtSetKeys(items []interface{}) base.Set {
+	keys := make(base.Set, len(items))
+	for _, item := range items {
+		keys.Add(crdtSetKey(item))
+	}
+	return keys
+}
+
+// crdtSetKey returns the JSON representation of a set item, used to compare items of any type.
+func crdtSetKey(item interface{}) string {
+	if s, ok := item.(string); ok {
+		return `"` + s + `"`
+	}
+	keyBytes, err := base.JSONMarshal(item)
+	if err != nil {
+		return fmt.Sprintf("%v", item)
+	}
+	return string(keyBytes)
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2022-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package db
+
+import (
+	"testing"
+
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCRDTOptionsValidate(t *testing.T) {
+	testCases := []struct {
+		name          string
+		options       CRDTOptions
+		expectedError string
+	}{
+		{
+			name:    "valid",
+			options: CRDTOptions{Counters: []string{"stock", "reserved"}, Sets: []string{"tags"}},
+		},
+		{
+			name:          "empty property",
+			options:       CRDTOptions{Sets: []string{""}},
+			expectedError: "must not be empty",
+		},
+		{
+			name:          "underscore prefix",
+			options:       CRDTOptions{Counters: []string{"_rev"}},
+			expectedError: "must not start with an underscore",
+		},
+		{
+			name:          "counter and set",
+			options:       CRDTOptions{Counters: []string{"stock"}, Sets: []string{"stock"}},
+			expectedError: "must only be defined once",
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.options.Validate()
+			if test.expectedError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, test.expectedError)
+			}
+		})
+	}
+}
+
+func TestMergeCRDTSet(t *testing.T) {
+	testCases := []struct {
+		name     string
+		base     []interface{}
+		local    []interface{}
+		remote   []interface{}
+		expected []interface{}
+	}{
+		{
+			name:     "concurrent additions",
+			base:     []interface{}{"a"},
+			local:    []interface{}{"a", "b"},
+			remote:   []interface{}{"a", "c"},
+			expected: []interface{}{"a", "b", "c"},
+		},
+		{
+			name:     "removal and addition",
+			base:     []interface{}{"a", "b"},
+			local:    []interface{}{"a"},
+			remote:   []interface{}{"a", "b", "c"},
+			expected: []interface{}{"a", "c"},
+		},
+		{
+			name:     "removed on both sides",
+			base:     []interface{}{"a", "b"},
+			local:    []interface{}{"b"},
+			remote:   []interface{}{"b"},
+			expected: []interface{}{"b"},
+		},
+		{
+			name:     "no base",
+			local:    []interface{}{"a", "b"},
+			remote:   []interface{}{"b", "c"},
+			expected: []interface{}{"a", "b", "c"},
+		},
+		{
+			name:     "non-string items",
+			base:     []interface{}{1.0, map[string]interface{}{"sku": "x"}},
+			local:    []interface{}{1.0, map[string]interface{}{"sku": "x"}, map[string]interface{}{"sku": "y"}},
+			remote:   []interface{}{map[string]interface{}{"sku": "x"}},
+			expected: []interface{}{map[string]interface{}{"sku": "x"}, map[string]interface{}{"sku": "y"}},
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, mergeCRDTSet(test.base, test.local, test.remote))
+		})
+	}
+}
+
+func TestConflictResolverCRDT(t *testing.T) {
+	crdt := &CRDTOptions{Counters: []string{"stock"}, Sets: []string{"tags"}}
+	ancestor := Body{"stock": 10, "tags": []interface{}{"a"}, "name": "widget"}
+
+	testCases := []struct {
+		name                   string
+		localDocument          Body
+		remoteDocument         Body
+		ancestor               Body
+		expectedResolutionType ConflictResolutionType
+		expectedBody           string
+	}{
+		{
+			name:                   "merged counters and sets",
+			localDocument:          Body{BodyRev: "3-abc", "stock": 7, "tags": []interface{}{"a", "b"}, "name": "local"},
+			remoteDocument:         Body{BodyRev: "3-def", "stock": 12, "tags": []interface{}{"c"}, "name": "remote"},
+			ancestor:               ancestor,
+			expectedResolutionType: ConflictResolutionMerge,
+			expectedBody:           `{"stock":9,"tags":["b","c"],"name":"remote"}`,
+		},
+		{
+			name:                   "no ancestor",
+			localDocument:          Body{BodyRev: "3-abc", "stock": 7, "tags": []interface{}{"a", "b"}},
+			remoteDocument:         Body{BodyRev: "3-def", "stock": 12, "tags": []interface{}{"c"}},
+			expectedResolutionType: ConflictResolutionMerge,
+			expectedBody:           `{"stock":12,"tags":["a","b","c"]}`,
+		},
+		{
+			name:                   "merge matches winner",
+			localDocument:          Body{BodyRev: "3-abc", "stock": 10, "tags": []interface{}{"a"}},
+			remoteDocument:         Body{BodyRev: "3-def", "stock": 8, "tags": []interface{}{"a"}},
+			ancestor:               ancestor,
+			expectedResolutionType: ConflictResolutionRemote,
+			expectedBody:           `{"_rev":"3-def","stock":8,"tags":["a"]}`,
+		},
+		{
+			name:                   "local deleted",
+			localDocument:          Body{BodyRev: "3-abc", BodyDeleted: true},
+			remoteDocument:         Body{BodyRev: "3-def", "stock": 8, "tags": []interface{}{"a"}},
+			ancestor:               ancestor,
+			expectedResolutionType: ConflictResolutionLocal,
+			expectedBody:           `{"_rev":"3-abc","_deleted":true}`,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			resolver := NewConflictResolver(DefaultConflictResolver, nil)
+			conflict := Conflict{LocalDocument: test.localDocument, RemoteDocument: test.remoteDocument}
+			winner, resolutionType, err := resolver.ResolveWithCRDT(conflict, test.ancestor, crdt)
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedResolutionType, resolutionType)
+			winnerBytes, err := base.JSONMarshal(winner)
+			require.NoError(t, err)
+			assert.JSONEq(t, test.expectedBody, string(winnerBytes))
+		})
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"fmt"
 	"math"
 	"net/http"
+	"sort"
 	"strings"
 	"time"
 
@@ -55,6 +56,9 @@ func (db *DatabaseContext) GetDocument(ctx context.Context, docid string, unmars
 
 // Lowest-level method that reads a document from the bucket
 func (db *DatabaseContext) GetDocumentWithRaw(ctx context.Context, docid string, unmarshalLevel DocumentUnmarshalLevel) (doc *Document, rawBucketDoc *sgbucket.BucketDocument, err error) {
+	ctx, span := base.StartSpan(ctx, "db.get_document")
+	defer func() { span.End(err) }()
+
 	key := realDocID(docid)
 	if key == "" {
 		return nil, nil, base.HTTPErrorf(400, "Invalid doc ID")
@@ -87,7 +91,7 @@ func (db *DatabaseContext) GetDocumentWithRaw(ctx context.Context, docid string,
 			return nil, nil, getErr
 		}
 
-		doc, err = unmarshalDocument(key, rawDoc)
+		doc, err = unmarshalDocumentWithLevel(key, rawDoc, unmarshalLevel)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -258,6 +262,13 @@ func (db *Database) Get1xRevBodyWithHistory(ctx context.Context, docid, revid st
 //     revisions for which the client already has attachments and doesn't need bodies. Any attachment
 //     that hasn't changed since one of those revisions will be returned as a stub.
 func (db *Database) getRev(ctx context.Context, docid, revid string, maxHistory int, historyFrom []string, includeBody bool) (revision DocumentRevision, err error) {
+	startTime := time.Now()
+	ctx, span := base.StartSpan(ctx, "db.get_rev")
+	defer func() {
+		span.End(err)
+		db.DbStats.Database().DocReadDuration.Observe(time.Since(startTime).Seconds())
+	}()
+
 	if revid != "" {
 		// Get a specific revision body and history from the revision cache
 		// (which will load them if necessary, by calling revCacheLoader, above)
@@ -311,6 +322,7 @@ func (db *Database) getRev(ctx context.Context, docid, revid string, maxHistory
 		return DocumentRevision{}, ErrDeleted
 	}
 
+	db.TenantUsage.RecordRead(len(revision.BodyBytes))
 	return revision, nil
 }
 
@@ -773,7 +785,14 @@ func (db *Database) backupAncestorRevs(ctx context.Context, doc *Document, newDo
 
 // ////// UPDATING DOCUMENTS:
 
-func (db *Database) OnDemandImportForWrite(ctx context.Context, docid string, doc *Document, deleted bool) error {
+// OnDemandImportForWrite imports an SDK write to a doc before Sync Gateway writes sgBody to it.  If the doc already has a
+// Sync Gateway revision, the SDK write collided with the Sync Gateway write, and the database's import conflict
+// strategy decides whether it's imported or discarded.
+func (db *Database) OnDemandImportForWrite(ctx context.Context, docid string, doc *Document, deleted bool, sgBody Body) error {
+
+	if doc.CurrentRev != "" && !db.importSDKWriteOnConflict(ctx, docid, doc, sgBody) {
+		return nil
+	}
 
 	// Check whether the doc requiring import is an SDK delete
 	isDelete := false
@@ -802,6 +821,8 @@ func (db *Database) OnDemandImportForWrite(ctx context.Context, docid string, do
 // The new body's BodyRev property must match the current revision's, if any.
 func (db *Database) Put(ctx context.Context, docid string, body Body) (newRevID string, doc *Document, err error) {
 
+	defer db.beginAPIWrite()()
+
 	delete(body, BodyId)
 
 	// Get the revision ID to match, and the new generation number:
@@ -853,7 +874,7 @@ func (db *Database) Put(ctx context.Context, docid string, body Body) (newRevID
 		// (Be careful: this block can be invoked multiple times if there are races!)
 		// If the existing doc isn't an SG write, import prior to updating
 		if doc != nil && !isSgWrite && db.UseXattrs() {
-			err := db.OnDemandImportForWrite(ctx, newDoc.ID, doc, deleted)
+			err := db.OnDemandImportForWrite(ctx, newDoc.ID, doc, deleted, body)
 			if err != nil {
 				if db.ForceAPIForbiddenErrors() {
 					base.InfofCtx(ctx, base.KeyCRUD, "Importing doc %q prior to write caused error", base.UD(newDoc.ID))
@@ -956,6 +977,8 @@ func (db *Database) PutExistingRev(ctx context.Context, newDoc *Document, docHis
 //  2. If noConflicts == true and a conflictResolverFunc is not provided, a 409 conflict error will be returned
 //  3. If noConflicts == true and a conflictResolverFunc is provided, conflicts will be resolved and the result added to the document.
 func (db *Database) PutExistingRevWithConflictResolution(ctx context.Context, newDoc *Document, docHistory []string, noConflicts bool, conflictResolver *ConflictResolver, forceAllowConflictingTombstone bool, existingDoc *sgbucket.BucketDocument) (doc *Document, newRevID string, err error) {
+	defer db.beginAPIWrite()()
+
 	newRev := docHistory[0]
 	generation, _ := ParseRevID(newRev)
 	if generation < 0 {
@@ -979,7 +1002,7 @@ func (db *Database) PutExistingRevWithConflictResolution(ctx context.Context, ne
 
 		// If the existing doc isn't an SG write, import prior to updating
 		if doc != nil && !isSgWrite && db.UseXattrs() {
-			err := db.OnDemandImportForWrite(ctx, newDoc.ID, doc, newDoc.Deleted)
+			err := db.OnDemandImportForWrite(ctx, newDoc.ID, doc, newDoc.Deleted, newDoc.Body())
 			if err != nil {
 				return nil, nil, false, nil, err
 			}
@@ -1143,7 +1166,14 @@ func (db *Database) resolveConflict(ctx context.Context, localDoc *Document, rem
 		RemoteDocument: remoteDocBody,
 	}
 
-	resolvedBody, resolutionType, resolveFuncError := resolver.Resolve(conflict)
+	// When CRDT properties are defined, the body of the common ancestor is used as the base for merging them
+	var ancestorBody Body
+	crdt := db.crdtOptions()
+	if crdt != nil {
+		ancestorBody = db.getCommonAncestorBody(ctx, localDoc, docHistory)
+	}
+
+	resolvedBody, resolutionType, resolveFuncError := resolver.ResolveWithCRDT(conflict, ancestorBody, crdt)
 	if resolveFuncError != nil {
 		base.InfofCtx(ctx, base.KeyReplicate, "Error when running conflict resolution for doc %s: %v", base.UD(localDoc.ID), resolveFuncError)
 		return "", nil, resolveFuncError
@@ -1164,6 +1194,26 @@ func (db *Database) resolveConflict(ctx context.Context, localDoc *Document, rem
 	}
 }
 
+// getCommonAncestorBody returns the body of the most recent revision in docHistory that is also in the local
+// document's revision tree.  Returns nil if there's no common ancestor, or its body is no longer available.
+func (db *Database) getCommonAncestorBody(ctx context.Context, localDoc *Document, docHistory []string) Body {
+	ancestorRevID := localDoc.History.findAncestorFromSet(localDoc.CurrentRev, docHistory)
+	if ancestorRevID == "" {
+		return nil
+	}
+	bodyBytes, _, _, err := db.getRevision(ctx, localDoc, ancestorRevID)
+	if err != nil || bodyBytes == nil {
+		base.InfofCtx(ctx, base.KeyReplicate, "Common ancestor %s for doc %s not available for CRDT merge: %v", ancestorRevID, base.UD(localDoc.ID), err)
+		return nil
+	}
+	var ancestorBody Body
+	if err := ancestorBody.Unmarshal(bodyBytes); err != nil {
+		base.InfofCtx(ctx, base.KeyReplicate, "Unable to unmarshal common ancestor %s for doc %s for CRDT merge: %v", ancestorRevID, base.UD(localDoc.ID), err)
+		return nil
+	}
+	return ancestorBody
+}
+
 // resolveDocRemoteWins makes the following changes to the document:
 //   - Tombstones the local revision
 //
@@ -1462,7 +1512,9 @@ func (db *Database) prepareSyncFn(doc *Document, newDoc *Document) (mutableBody
 // Run the sync function on the given document and body. Need to inject the document ID and rev ID temporarily to run
 // the sync function.
 func (db *Database) runSyncFn(ctx context.Context, doc *Document, body Body, metaMap map[string]interface{}, newRevId string) (*uint32, string, base.Set, channels.AccessMap, channels.AccessMap, error) {
+	ctx, span := base.StartSpan(ctx, "db.sync_function")
 	channelSet, access, roles, syncExpiry, oldBody, err := db.getChannelsAndAccess(ctx, doc, body, metaMap, newRevId)
+	span.End(err)
 	if err != nil {
 		return nil, ``, nil, nil, nil, err
 	}
@@ -1726,6 +1778,9 @@ func (db *Database) documentUpdateFunc(ctx context.Context, docExists bool, doc
 		if err != nil {
 			return
 		}
+		if db.Options.ChannelHistory != nil {
+			db.pruneChannelHistory(ctx, doc, *db.Options.ChannelHistory)
+		}
 		changedAccessPrincipals = doc.Access.updateAccess(doc, access)
 		changedRoleAccessUsers = doc.RoleAccess.updateAccess(doc, roles)
 	} else {
@@ -1757,6 +1812,9 @@ type updateAndReturnDocCallback func(*Document) (resultDoc *Document, resultAtta
 //  2. Specify the existing document body/xattr/cas, to avoid initial retrieval of the doc in cases that the current contents are already known (e.g. import).
 //     On cas failure, the document will still be reloaded from the bucket as usual.
 func (db *Database) updateAndReturnDoc(ctx context.Context, docid string, allowImport bool, expiry uint32, opts *sgbucket.MutateInOptions, existingDoc *sgbucket.BucketDocument, callback updateAndReturnDocCallback) (doc *Document, newRevID string, err error) {
+	startTime := time.Now()
+	ctx, span := base.StartSpan(ctx, "db.update_doc")
+	defer func() { span.End(err) }()
 
 	key := realDocID(docid)
 	if key == "" {
@@ -1771,6 +1829,7 @@ func (db *Database) updateAndReturnDoc(ctx context.Context, docid string, allowI
 	var oldBodyJSON string                                       // Stores previous revision body for use by DocumentChangeEvent
 	var createNewRevIDSkipped bool
 	var previousAttachments map[string]struct{}
+	var quotaDocDelta, quotaBytesDelta int64 // Change in the collection's quota usage made by the write
 
 	// Update the document
 	inConflict := false
@@ -1792,6 +1851,7 @@ func (db *Database) updateAndReturnDoc(ctx context.Context, docid string, allowI
 				base.ErrorfCtx(ctx, "Error retrieving previous leaf attachments of doc: %s, Error: %v", base.UD(docid), err)
 			}
 			prevCurrentRev = doc.CurrentRev
+			prevLive := doc.CurrentRev != "" && !doc.hasFlag(channels.Deleted)
 			docExists := currentValue != nil
 			syncFuncExpiry, newRevID, storedDoc, oldBodyJSON, unusedSequences, changedAccessPrincipals, changedRoleAccessUsers, createNewRevIDSkipped, err = db.documentUpdateFunc(ctx, docExists, doc, allowImport, docSequence, unusedSequences, callback, expiry)
 			if err != nil {
@@ -1802,6 +1862,13 @@ func (db *Database) updateAndReturnDoc(ctx context.Context, docid string, allowI
 			inConflict = doc.hasFlag(channels.Conflict)
 			// Return the new raw document value for the bucket to store.
 			raw, err = doc.MarshalBodyAndSync()
+			if err != nil {
+				return
+			}
+			quotaDocDelta, quotaBytesDelta = quotaDeltas(prevLive, len(currentValue), !doc.hasFlag(channels.Deleted), len(raw))
+			if err = db.collectionQuota.checkWrite(quotaDocDelta, quotaBytesDelta); err != nil {
+				return
+			}
 			base.DebugfCtx(ctx, base.KeyCRUD, "Saving doc (seq: #%d, id: %v rev: %v)", doc.Sequence, base.UD(doc.ID), doc.CurrentRev)
 			docBytes = len(raw)
 			return raw, syncFuncExpiry, false, err
@@ -1826,6 +1893,7 @@ func (db *Database) updateAndReturnDoc(ctx context.Context, docid string, allowI
 				return
 			}
 			prevCurrentRev = doc.CurrentRev
+			prevLive := doc.CurrentRev != "" && !doc.hasFlag(channels.Deleted)
 
 			// Check whether Sync Data originated in body
 			if currentXattr == nil && doc.Sequence > 0 {
@@ -1857,6 +1925,13 @@ func (db *Database) updateAndReturnDoc(ctx context.Context, docid string, allowI
 			// Return the new raw document value for the bucket to store.
 			doc.SetCrc32cUserXattrHash()
 			raw, rawXattr, err = doc.MarshalWithXattr()
+			if err != nil {
+				return
+			}
+			quotaDocDelta, quotaBytesDelta = quotaDeltas(prevLive, len(currentValue), !deleteDoc, len(raw))
+			if err = db.collectionQuota.checkWrite(quotaDocDelta, quotaBytesDelta); err != nil {
+				return
+			}
 			docBytes = len(raw)
 
 			// Warn when sync data is larger than a configured threshold
@@ -1915,7 +1990,12 @@ func (db *Database) updateAndReturnDoc(ctx context.Context, docid string, allowI
 	}
 
 	db.DbStats.Database().NumDocWrites.Add(1)
+	db.DbStats.Database().DocWriteDuration.Observe(time.Since(startTime).Seconds())
 	db.DbStats.Database().DocWritesBytes.Add(int64(docBytes))
+	db.CollectionStats.NumDocWrites.Add(1)
+	db.CollectionStats.DocWritesBytes.Add(int64(docBytes))
+	db.collectionQuota.recordWrite(ctx, quotaDocDelta, quotaBytesDelta)
+	db.TenantUsage.RecordWrite(docBytes)
 	db.DbStats.Database().DocWritesXattrBytes.Add(int64(xattrBytes))
 	if inConflict {
 		db.DbStats.Database().ConflictWriteCount.Add(1)
@@ -1952,6 +2032,7 @@ func (db *Database) updateAndReturnDoc(ctx context.Context, docid string, allowI
 		} else {
 			db.revisionCache.Put(ctx, documentRevision)
 		}
+		db.docResponseCache.invalidate(docid)
 
 		if db.EventMgr.HasHandlerForEvent(DocumentChange) {
 			webhookJSON, err := doc.BodyWithSpecialProperties()
@@ -2002,6 +2083,9 @@ func (db *Database) updateAndReturnDoc(ctx context.Context, docid string, allowI
 	// Remove any obsolete non-winning revision bodies
 	doc.deleteRemovedRevisionBodies(db.Bucket)
 
+	// Create any roles defined by the sync function before users are granted them:
+	db.createSyncFnRoles(ctx, doc.roleCreates)
+
 	// Mark affected users/roles as needing to recompute their channel access:
 	db.MarkPrincipalsChanged(ctx, docid, newRevID, changedAccessPrincipals, changedRoleAccessUsers, doc.Sequence)
 	return doc, newRevID, nil
@@ -2138,6 +2222,26 @@ func (db *Database) MarkPrincipalsChanged(ctx context.Context, docid string, new
 
 }
 
+// createSyncFnRoles creates the roles defined by the sync function via role() calls with {create: true}, with their
+// admin channels, unless they already exist.  Existing roles are left unchanged.
+func (db *Database) createSyncFnRoles(ctx context.Context, roleCreates channels.AccessMap) {
+	roleNames := make([]string, 0, len(roleCreates))
+	for name := range roleCreates {
+		roleNames = append(roleNames, name)
+	}
+	sort.Strings(roleNames)
+	for _, name := range roleNames {
+		roleName := name
+		_, err := db.UpdatePrincipal(ctx, &auth.PrincipalConfig{Name: &roleName, ExplicitChannels: roleCreates[name]}, false, false)
+		if err == nil {
+			base.InfofCtx(ctx, base.KeyAccess, "Sync fn created role %q with admin channels %v", base.UD(roleName), base.UD(roleCreates[name]))
+			db.DbStats.Database().SyncFunctionRolesCreated.Add(1)
+		} else if status, _ := base.ErrorAsHTTPStatus(err); status != http.StatusConflict {
+			base.WarnfCtx(ctx, "Unable to create role %q defined by sync fn: %v", base.UD(roleName), err)
+		}
+	}
+}
+
 // Creates a new document, assigning it a random doc ID.
 func (db *Database) Post(ctx context.Context, body Body) (docid string, rev string, doc *Document, err error) {
 	if body[BodyRev] != nil {
@@ -2211,6 +2315,9 @@ func (db *Database) getChannelsAndAccess(ctx context.Context, doc *Document, bod
 		return result, access, roles, expiry, oldJson, base.HTTPErrorf(403, auth.GuestUserReadOnly)
 	}
 
+	doc.accessExpiry = nil
+	doc.roleCreates = nil
+
 	// Get the parent revision, to pass to the sync function:
 	var oldJsonBytes []byte
 	if oldJsonBytes, err = db.getAncestorJSON(ctx, doc, revID); err != nil {
@@ -2219,19 +2326,31 @@ func (db *Database) getChannelsAndAccess(ctx context.Context, doc *Document, bod
 	oldJson = string(oldJsonBytes)
 
 	if db.ChannelMapper != nil {
+		// Describe the parent revision's metadata, in addition to its body:
+		metaMap = doc.withOldRevisionMeta(metaMap, doc.History.getParent(revID))
+
 		// Call the ChannelMapper:
 		startTime := time.Now()
 		db.DbStats.Database().SyncFunctionCount.Add(1)
+		db.CollectionStats.SyncFunctionCount.Add(1)
 
 		var output *channels.ChannelMapperOutput
 		output, err = db.ChannelMapper.MapToChannelsAndAccess(body, oldJson, metaMap,
 			makeUserCtx(db.user))
 
-		db.DbStats.Database().SyncFunctionTime.Add(time.Since(startTime).Nanoseconds())
+		elapsed := time.Since(startTime)
+		db.DbStats.Database().SyncFunctionTime.Add(elapsed.Nanoseconds())
+		db.CollectionStats.SyncFunctionTime.Add(elapsed.Nanoseconds())
+		db.DbStats.Database().SyncFunctionDuration.Observe(elapsed.Seconds())
+		if threshold := db.Options.SyncFunctionSlowThreshold; threshold > 0 && elapsed > threshold {
+			base.WarnfCtx(ctx, "Sync fn took %v for doc %q / %q, exceeding the threshold of %v", elapsed, base.UD(doc.ID), base.UD(doc.NewestRev), threshold)
+			db.DbStats.Database().SyncFunctionSlowCount.Add(1)
+		}
 
 		if err == nil {
 			result = output.Channels
 			access = output.Access
+			doc.accessExpiry = output.AccessExpiry
 			roles = output.Roles
 			expiry = output.Expiry
 			err = output.Rejection
@@ -2239,17 +2358,37 @@ func (db *Database) getChannelsAndAccess(ctx context.Context, doc *Document, bod
 				base.InfofCtx(ctx, base.KeyAll, "Sync fn rejected doc %q / %q --> %s", base.UD(doc.ID), base.UD(doc.NewestRev), err)
 				base.DebugfCtx(ctx, base.KeyAll, "    rejected doc %q / %q : new=%+v  old=%s", base.UD(doc.ID), base.UD(doc.NewestRev), base.UD(body), base.UD(oldJson))
 				db.DbStats.Security().NumDocsRejected.Add(1)
+				db.DbStats.Database().SyncFunctionRejectCount.Add(1)
+				if rejection := base.SyncFnRejectionReasonFromError(err); rejection != nil {
+					base.DebugfCtx(ctx, base.KeyAll, "    rejected doc %q / %q with reason code %q", base.UD(doc.ID), base.UD(doc.NewestRev), rejection.Code)
+					db.DbStats.Security().NumDocsRejectedWithReason.Add(1)
+				}
 				if isAccessError(err) {
 					db.DbStats.Security().NumAccessErrors.Add(1)
 				}
 			} else if !validateAccessMap(access) || !validateRoleAccessMap(roles) {
 				err = base.HTTPErrorf(500, "Error in JS sync function")
+			} else if policyErr := db.checkChannelNamePolicy(result, access); policyErr != nil {
+				base.WarnfCtx(ctx, "Sync fn output for doc %q / %q violates the channel name policy: %v", base.UD(doc.ID), base.UD(doc.NewestRev), base.UD(policyErr))
+				err = base.HTTPErrorf(500, "Error in JS sync function: %v", policyErr)
+			} else if policyErr := db.checkChannelNamePolicy(nil, output.RoleCreates); policyErr != nil {
+				base.WarnfCtx(ctx, "Sync fn role definitions for doc %q / %q violate the channel name policy: %v", base.UD(doc.ID), base.UD(doc.NewestRev), base.UD(policyErr))
+				err = base.HTTPErrorf(500, "Error in JS sync function: %v", policyErr)
+			} else {
+				doc.roleCreates = output.RoleCreates
+				for channel := range result {
+					db.DbStats.Database().AddSyncFunctionChannelAssignment(channel)
+				}
 			}
 
 		} else {
 			base.WarnfCtx(ctx, "Sync fn exception: %+v; doc = %s", err, base.UD(body))
+			db.DbStats.Database().SyncFunctionExceptionCount.Add(1)
 			if errors.Is(err, sgbucket.ErrJSTimeout) {
 				err = base.HTTPErrorf(500, "JS sync function timed out")
+			} else if errors.Is(err, base.ErrJSCPUTimeLimit) || errors.Is(err, base.ErrJSMemoryLimit) {
+				db.DbStats.Database().SyncFunctionLimitExceededCount.Add(1)
+				err = base.HTTPErrorf(500, "JS sync function interrupted: %v", err)
 			} else {
 				err = base.HTTPErrorf(500, "Exception in JS sync function")
 			}
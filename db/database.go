@@ -70,6 +70,11 @@ var (
 	DefaultQueryPaginationLimit = 5000
 )
 
+const (
+	DefaultBulkDocsConcurrency = 1   // Default number of docs written concurrently by a _bulk_docs request - concurrent writes are opt-in
+	MaxBulkDocsConcurrency     = 100 // Maximum configurable number of docs written concurrently by a _bulk_docs request
+)
+
 const (
 	CompactIntervalMinDays = float32(0.04) // ~1 Hour in days
 	CompactIntervalMaxDays = float32(60)   // 60 Days in days
@@ -82,47 +87,62 @@ const BGTCompletionMaxWait = 30 * time.Second
 // Basic description of a database. Shared between all Database objects on the same database.
 // This object is thread-safe so it can be shared between HTTP handlers.
 type DatabaseContext struct {
-	Name                         string                  // Database name
-	UUID                         string                  // UUID for this database instance. Used by cbgt and sgr
-	Bucket                       base.Bucket             // Storage
-	BucketSpec                   base.BucketSpec         // The BucketSpec
-	BucketLock                   sync.RWMutex            // Control Access to the underlying bucket object
-	mutationListener             changeListener          // Caching feed listener
-	ImportListener               *importListener         // Import feed listener
-	sequences                    *sequenceAllocator      // Source of new sequence numbers
-	ChannelMapper                *channels.ChannelMapper // Runs JS 'sync' function
-	StartTime                    time.Time               // Timestamp when context was instantiated
-	RevsLimit                    uint32                  // Max depth a document's revision tree can grow to
-	autoImport                   bool                    // Add sync data to new untracked couchbase server docs?  (Xattr mode specific)
-	revisionCache                RevisionCache           // Cache of recently-accessed doc revisions
-	changeCache                  *changeCache            // Cache of recently-access channels
-	EventMgr                     *EventManager           // Manages notification events
-	AllowEmptyPassword           bool                    // Allow empty passwords?  Defaults to false
-	Options                      DatabaseContextOptions  // Database Context Options
-	AccessLock                   sync.RWMutex            // Allows DB offline to block until synchronous calls have completed
-	State                        uint32                  // The runtime state of the DB from a service perspective
-	ResyncManager                *BackgroundManager
-	TombstoneCompactionManager   *BackgroundManager
-	AttachmentCompactionManager  *BackgroundManager
-	ExitChanges                  chan struct{}        // Active _changes feeds on the DB will close when this channel is closed
-	OIDCProviders                auth.OIDCProviderMap // OIDC clients
-	LocalJWTProviders            auth.LocalJWTProviderMap
-	PurgeInterval                time.Duration            // Metadata purge interval
-	serverUUID                   string                   // UUID of the server, if available
-	DbStats                      *base.DbStats            // stats that correspond to this database context
-	CompactState                 uint32                   // Status of database compaction
-	terminator                   chan bool                // Signal termination of background goroutines
-	backgroundTasks              []BackgroundTask         // List of background tasks that are initiated.
-	activeChannels               *channels.ActiveChannels // Tracks active replications by channel
-	CfgSG                        cbgt.Cfg                 // Sync Gateway cluster shared config
-	SGReplicateMgr               *sgReplicateManager      // Manages interactions with sg-replicate replications
-	Heartbeater                  base.Heartbeater         // Node heartbeater for SG cluster awareness
-	ServeInsecureAttachmentTypes bool                     // Attachment content type will bypass the content-disposition handling, default false
-	NoX509HTTPClient             *http.Client             // A HTTP Client from gocb to use the management endpoints
-	ServerContextHasStarted      chan struct{}            // Closed via PostStartup once the server has fully started
-	userFunctions                UserFunctions            // client-callable JavaScript functions
-	graphQL                      *GraphQL                 // GraphQL query evaluator
-	Scopes                       map[string]Scope         // A map keyed by scope name containing a set of scopes/collections. Nil if running with only _default._default
+	Name                            string                  // Database name
+	UUID                            string                  // UUID for this database instance. Used by cbgt and sgr
+	Bucket                          base.Bucket             // Storage
+	BucketSpec                      base.BucketSpec         // The BucketSpec
+	BucketLock                      sync.RWMutex            // Control Access to the underlying bucket object
+	mutationListener                changeListener          // Caching feed listener
+	ImportListener                  *importListener         // Import feed listener
+	sequences                       *sequenceAllocator      // Source of new sequence numbers
+	ChannelMapper                   *channels.ChannelMapper // Runs JS 'sync' function
+	StartTime                       time.Time               // Timestamp when context was instantiated
+	RevsLimit                       uint32                  // Max depth a document's revision tree can grow to
+	autoImport                      bool                    // Add sync data to new untracked couchbase server docs?  (Xattr mode specific)
+	revisionCache                   RevisionCache           // Cache of recently-accessed doc revisions
+	docResponseCache                *docResponseCache       // Cache of recent document GET responses, nil when not enabled
+	MemoryAccountant                *MemoryAccountant       // Tracks estimated memory usage, and rejects requests when it's too high
+	ClientTelemetry                 *ClientTelemetry        // Counts requests and replications by client build
+	CollectionStats                 *base.CollectionStats   // Stats for the database's collection, labelled with its keyspace
+	collectionQuota                 *collectionQuota        // Limits the number and size of docs in the collection, nil when not configured
+	TenantUsage                     *TenantUsageTracker     // Tracks usage and limits connections in serverless mode, nil when not serverless
+	changeCache                     *changeCache            // Cache of recently-access channels
+	EventMgr                        *EventManager           // Manages notification events
+	AllowEmptyPassword              bool                    // Allow empty passwords?  Defaults to false
+	Options                         DatabaseContextOptions  // Database Context Options
+	AccessLock                      sync.RWMutex            // Allows DB offline to block until synchronous calls have completed
+	State                           uint32                  // The runtime state of the DB from a service perspective
+	ResyncManager                   *BackgroundManager
+	TombstoneCompactionManager      *BackgroundManager
+	ChannelHistoryCompactionManager *BackgroundManager
+	AttachmentCompactionManager     *BackgroundManager
+	MetadataMigrationManager        *BackgroundManager
+	ExitChanges                     chan struct{}        // Active _changes feeds on the DB will close when this channel is closed
+	OIDCProviders                   auth.OIDCProviderMap // OIDC clients
+	LocalJWTProviders               auth.LocalJWTProviderMap
+	LDAPProvider                    *auth.LDAPProvider       // LDAP directory used to authenticate users, nil if not configured
+	LoginThrottle                   *auth.LoginThrottle      // Tracks failed password logins, nil if not configured
+	GuestUserLimiter                *auth.GuestUserLimiter   // Limits guest device user creation per source IP, nil if guest sessions aren't enabled
+	ClientCertMapper                *auth.ClientCertMapper   // Maps TLS client certs to users, nil if client cert auth isn't configured
+	UserConnectionLimiter           *UserConnectionLimiter   // Limits concurrent replications and changes feeds per user, nil if not configured
+	ChannelNamePolicy               *ChannelNamePolicy       // Restricts the channel names assigned by the sync fn, nil if not configured
+	PurgeInterval                   time.Duration            // Metadata purge interval
+	serverUUID                      string                   // UUID of the server, if available
+	DbStats                         *base.DbStats            // stats that correspond to this database context
+	CompactState                    uint32                   // Status of database compaction
+	terminator                      chan bool                // Signal termination of background goroutines
+	backgroundTasks                 []BackgroundTask         // List of background tasks that are initiated.
+	activeChannels                  *channels.ActiveChannels // Tracks active replications by channel
+	CfgSG                           cbgt.Cfg                 // Sync Gateway cluster shared config
+	SGReplicateMgr                  *sgReplicateManager      // Manages interactions with sg-replicate replications
+	Heartbeater                     base.Heartbeater         // Node heartbeater for SG cluster awareness
+	ServeInsecureAttachmentTypes    bool                     // Attachment content type will bypass the content-disposition handling, default false
+	NoX509HTTPClient                *http.Client             // A HTTP Client from gocb to use the management endpoints
+	ServerContextHasStarted         chan struct{}            // Closed via PostStartup once the server has fully started
+	userFunctions                   UserFunctions            // client-callable JavaScript functions
+	graphQL                         *GraphQL                 // GraphQL query evaluator
+	Scopes                          map[string]Scope         // A map keyed by scope name containing a set of scopes/collections. Nil if running with only _default._default
+	activeAPIWrites                 int64                    // Number of writes in progress via the REST and BLIP APIs, which low priority imports yield to
 }
 
 type Scope struct {
@@ -136,11 +156,19 @@ type Collection struct {
 type DatabaseContextOptions struct {
 	CacheOptions                  *CacheOptions
 	RevisionCacheOptions          *RevisionCacheOptions
+	DocResponseCacheConfig        *DocResponseCacheConfig // Short-lived caching of document GET responses, nil for no caching
+	MemoryAdmissionConfig         *MemoryAdmissionConfig  // Rejection of requests while estimated memory usage is high, nil to never reject
+	MaxSequenceBatchSize          uint64                  // Maximum number of sequences reserved per increment of the sequence counter, zero for the default
+	ChangesQueryConcurrency       int                     // Maximum number of channels queried concurrently by a changes request, zero for the default
+	BulkDocsConcurrency           int                     // Maximum number of docs written concurrently by a _bulk_docs request, zero for the default
+	ChangesCoalesceWindow         time.Duration           // How long a waiting changes feed delays after being woken by a change, to batch bursts of writes, zero for no delay
 	OldRevExpirySeconds           uint32
 	AdminInterface                *string
 	UnsupportedOptions            *UnsupportedOptions
 	OIDCOptions                   *auth.OIDCOptions
 	LocalJWTConfig                auth.LocalJWTConfig
+	LDAPConfig                    *auth.LDAPConfig
+	ClientCertAuth                *auth.ClientCertAuthConfig
 	DBOnlineCallback              DBOnlineCallback // Callback function to take the DB back online
 	ImportOptions                 ImportOptions
 	EnableXattr                   bool                  // Use xattr for _sync
@@ -148,6 +176,7 @@ type DatabaseContextOptions struct {
 	SecureCookieOverride          bool                  // Pass-through DBConfig.SecureCookieOverride
 	SessionCookieName             string                // Pass-through DbConfig.SessionCookieName
 	SessionCookieHttpOnly         bool                  // Pass-through DbConfig.SessionCookieHTTPOnly
+	RefreshTokenTTL               time.Duration         // Time-to-live of refresh tokens issued with sessions - 0 means refresh tokens aren't issued
 	UserQueries                   UserQueryMap          // Pass-through DbConfig.UserQueries
 	UserFunctions                 UserFunctionConfigMap // Pass-through DbConfig.UserFunctions
 	GraphQL                       *GraphQLConfig        // Pass-through DbConfig.GraphQL
@@ -160,14 +189,32 @@ type DatabaseContextOptions struct {
 	SGReplicateOptions            SGReplicateOptions
 	SlowQueryWarningThreshold     time.Duration
 	QueryPaginationLimit          int    // Limit used for pagination of queries. If not set defaults to DefaultQueryPaginationLimit
-	UserXattrKey                  string // Key of user xattr that will be accessible from the Sync Function. If empty the feature will be disabled.
+	UserXattrKey                  string // User xattr key specification (see base.UserXattrKeys) for the user xattrs accessible from the Sync Function. If empty the feature will be disabled.
 	ClientPartitionWindow         time.Duration
 	BcryptCost                    int
+	PasswordPolicy                *auth.PasswordPolicy        // Pass-through DbConfig.PasswordPolicy
+	GuestSessions                 *auth.GuestSessionConfig    // Pass-through DbConfig.GuestSessions
+	LoginThrottle                 *auth.LoginThrottleConfig   // Pass-through DbConfig.LoginThrottle
+	AdminRoleActions              map[string][]string         // Pass-through DbConfig.AdminRoleActions
+	UserConnectionLimits          *UserConnectionLimitsConfig // Pass-through DbConfig.UserConnectionLimits
+	ChannelNamePolicy             *ChannelNamePolicyConfig    // Pass-through DbConfig.ChannelNamePolicy
+	ChannelHistory                *ChannelHistoryConfig       // Pass-through DbConfig.ChannelHistory
+	SyncFunctionLimits            *SyncFunctionLimitsConfig   // Pass-through DbConfig.SyncFunctionLimits
+	SyncWasmModule                []byte                      // WebAssembly module run in place of the sync function, read from DbConfig.SyncWasmModule
 	GroupID                       string
-	JavascriptTimeout             time.Duration // Max time the JS functions run for (ie. sync fn, import filter)
-	Serverless                    bool          // If running in serverless mode
+	JavascriptTimeout             time.Duration     // Max time the JS functions run for (ie. sync fn, import filter)
+	JavascriptEngine              string            // JS engine that runs the sync fn and import filter (base.JSEngineOtto or base.JSEngineGoja)
+	JSLibrary                     map[string]string // Named JS modules that the sync fn and import filter can require()
+	SyncFunctionSlowThreshold     time.Duration     // Log a warning if the sync fn takes longer than this for a doc.  Zero disables.
+	SlowRequestThreshold          time.Duration     // Log a warning if a REST or BLIP request takes longer than this.  Zero disables.
+	RecentErrorsLimit             int               // Number of the most recent warnings and errors to keep in memory.  Zero disables.
+	Serverless                    bool              // If running in serverless mode
+	ServerlessMaxConnections      uint              // Max concurrent non-admin requests to the database in serverless mode - 0 for no limit
 	Scopes                        ScopesOptions
-	skipRegisterImportPIndex      bool // if set, skips the global gocb PIndex registration
+	Clock                         base.Clock      // Source of time for sequence allocation, cache expiry, sessions and heartbeats.  Nil for the system clock.
+	CacheFeedChaos                *base.FeedChaos // Test only - holds back or discards caching feed events
+	ImportFeedChaos               *base.FeedChaos // Test only - holds back or discards import feed events
+	skipRegisterImportPIndex      bool            // if set, skips the global gocb PIndex registration
 }
 
 type ScopesOptions map[string]ScopeOptions
@@ -176,11 +223,22 @@ type ScopeOptions struct {
 	Collections map[string]CollectionOptions
 }
 
-type CollectionOptions struct{}
+type CollectionOptions struct {
+	CRDT          *CRDTOptions           // Properties merged as CRDTs during sg-replicate conflict resolution, if any
+	ImportEnabled bool                   // Whether the import feed imports docs in this collection
+	Quota         *CollectionQuotaConfig // Limits on the number and size of docs in this collection, if any
+}
 
 type SGReplicateOptions struct {
-	Enabled               bool          // Whether this node can be assigned sg-replicate replications
-	WebsocketPingInterval time.Duration // BLIP Websocket Ping interval (for active replicators)
+	Enabled               bool                                   // Whether this node can be assigned sg-replicate replications
+	WebsocketPingInterval time.Duration                          // BLIP Websocket Ping interval (for active replicators)
+	ClientCerts           map[string]ReplicationClientCertConfig // Named TLS client certs that can be referenced by replications
+}
+
+// ReplicationClientCertConfig defines a TLS client certificate presented by active replicators when connecting to a remote.
+type ReplicationClientCertConfig struct {
+	CertPath string `json:"cert_path"`
+	KeyPath  string `json:"key_path"`
 }
 
 type OidcTestProviderOptions struct {
@@ -228,9 +286,14 @@ type WarningThresholds struct {
 
 // Options associated with the import of documents not written by Sync Gateway
 type ImportOptions struct {
-	ImportFilter     *ImportFilterFunction // Opt-in filter for document import
-	BackupOldRev     bool                  // Create temporary backup of old revision body when available
-	ImportPartitions uint16                // Number of partitions for import
+	ImportFilter             *ImportFilterFunction           // Opt-in filter for document import
+	ImportFilterMetadataOnly bool                            // Pass the import filter a null body, so raw docs are filtered before being unmarshalled
+	BackupOldRev             bool                            // Create temporary backup of old revision body when available
+	ImportPartitions         uint16                          // Number of partitions for import
+	Throttle                 *ImportThrottleConfig           // Limits on the rate of imports by the import feed, nil for no limits
+	Conflict                 *ImportConflictConfig           // How SDK writes that collide with SG writes are handled, nil to import them
+	ConflictResolver         *ImportConflictResolverFunction // Custom import conflict resolver, for ImportConflictCustom
+	Expiry                   *ImportExpiryConfig             // How the expiry of SDK-written docs is handled on import, nil to preserve it
 }
 
 // Represents a simulated CouchDB database. A new instance is created for each HTTP request,
@@ -345,6 +408,10 @@ func NewDatabaseContext(ctx context.Context, dbName string, bucket base.Bucket,
 	// Register the cbgt pindex type for the configGroup
 	RegisterImportPindexImpl(ctx, options.GroupID)
 
+	// Keep recent warnings and errors from the start, so that those preventing the database from starting are included.
+	// They're kept when the database is reloaded or taken offline, and discarded when it's removed.
+	base.SetRecentLogEntriesLimit(dbName, options.RecentErrorsLimit)
+
 	dbContext := &DatabaseContext{
 		Name:       dbName,
 		UUID:       cbgt.NewUUID(),
@@ -386,11 +453,17 @@ func NewDatabaseContext(ctx context.Context, dbName string, bucket base.Bucket,
 		dbContext,
 		dbContext.DbStats.Cache(),
 	)
+	dbContext.docResponseCache = newDocResponseCache(options.DocResponseCacheConfig, dbContext.DbStats.Cache())
+	dbContext.MemoryAccountant = NewMemoryAccountant(options.MemoryAdmissionConfig, dbContext.DbStats)
+	dbContext.ClientTelemetry = NewClientTelemetry()
+	dbContext.CollectionStats = initCollectionStats(dbContext.DbStats, options.Scopes)
+	dbContext.collectionQuota = initCollectionQuota(dbContext.CollectionStats, options.Scopes)
+	dbContext.TenantUsage = newTenantUsageTracker(options, dbContext.DbStats.Database())
 
 	dbContext.EventMgr = NewEventManager(dbContext.terminator)
 
 	var err error
-	dbContext.sequences, err = newSequenceAllocator(bucket, dbContext.DbStats.Database())
+	dbContext.sequences, err = newSequenceAllocator(bucket, dbContext.DbStats.Database(), options.MaxSequenceBatchSize, options.Clock)
 	if err != nil {
 		return nil, err
 	}
@@ -404,7 +477,7 @@ func NewDatabaseContext(ctx context.Context, dbName string, bucket base.Bucket,
 	if seqErr != nil {
 		return nil, seqErr
 	}
-	initialSequenceTime := time.Now()
+	initialSequenceTime := dbContext.sequences.clock.Now()
 
 	// In-memory channel cache
 	dbContext.changeCache = &changeCache{}
@@ -433,6 +506,7 @@ func NewDatabaseContext(ctx context.Context, dbName string, bucket base.Bucket,
 
 	// Initialize the tap Listener for notify handling
 	dbContext.mutationListener.Init(bucket.GetName(), options.GroupID)
+	dbContext.mutationListener.chaos = options.CacheFeedChaos
 
 	// Initialize sg cluster config.  Required even if import and sgreplicate are disabled
 	// on this node, to support replication REST API calls
@@ -465,6 +539,9 @@ func NewDatabaseContext(ctx context.Context, dbName string, bucket base.Bucket,
 		if err != nil {
 			return nil, pkgerrors.Wrapf(err, "Error starting heartbeater for bucket %s", base.MD(bucket.GetName()).Redact())
 		}
+		if err := heartbeater.SetClock(options.Clock); err != nil {
+			return nil, err
+		}
 		err = heartbeater.StartSendingHeartbeats()
 		if err != nil {
 			return nil, err
@@ -491,6 +568,7 @@ func NewDatabaseContext(ctx context.Context, dbName string, bucket base.Bucket,
 	// Start DCP feed
 	base.InfofCtx(ctx, base.KeyDCP, "Starting mutation feed on bucket %v due to either channel cache mode or doc tracking (auto-import)", base.MD(bucket.GetName()))
 	cacheFeedStatsMap := dbContext.DbStats.Database().CacheFeedMapStats
+	dbContext.initCacheFeedRollbackProtection(ctx, cacheFeedStatsMap.Map)
 	err = dbContext.mutationListener.Start(bucket, cacheFeedStatsMap.Map)
 
 	// Check if there is an error starting the DCP feed
@@ -503,6 +581,12 @@ func NewDatabaseContext(ctx context.Context, dbName string, bucket base.Bucket,
 		dbContext.mutationListener.Stop()
 	})
 
+	failoverSnapshotTask, err := NewBackgroundTask("CacheFeedFailoverSnapshot", dbContext.Name, dbContext.persistCacheFeedFailoverSnapshot, cacheFeedFailoverSnapshotInterval, dbContext.terminator)
+	if err != nil {
+		return nil, err
+	}
+	dbContext.backgroundTasks = append(dbContext.backgroundTasks, failoverSnapshotTask)
+
 	// Unlock change cache.  Validate that any allocated sequences on other nodes have either been assigned or released
 	// before starting
 	if initialSequence > 0 {
@@ -513,6 +597,7 @@ func NewDatabaseContext(ctx context.Context, dbName string, bucket base.Bucket,
 	if err != nil {
 		return nil, err
 	}
+	dbContext.sequences.setReleasedSequenceCallback(dbContext.changeCache.releaseUnusedSequenceRange)
 
 	cleanupFunctions = append(cleanupFunctions, func() {
 		dbContext.changeCache.Stop()
@@ -572,6 +657,33 @@ func NewDatabaseContext(ctx context.Context, dbName string, bucket base.Bucket,
 		dbContext.LocalJWTProviders[name] = cfg.BuildProvider(name)
 	}
 
+	if options.LDAPConfig != nil {
+		dbContext.LDAPProvider = options.LDAPConfig.BuildProvider()
+	}
+
+	if options.ClientCertAuth != nil {
+		dbContext.ClientCertMapper = options.ClientCertAuth.BuildMapper()
+	}
+
+	if options.LoginThrottle != nil {
+		dbContext.LoginThrottle = auth.NewLoginThrottle(*options.LoginThrottle)
+	}
+
+	if options.GuestSessions != nil {
+		dbContext.GuestUserLimiter = auth.NewGuestUserLimiter(*options.GuestSessions)
+	}
+
+	if options.UserConnectionLimits != nil {
+		dbContext.UserConnectionLimiter = NewUserConnectionLimiter(*options.UserConnectionLimits)
+	}
+
+	if options.ChannelNamePolicy != nil {
+		dbContext.ChannelNamePolicy, err = NewChannelNamePolicy(*options.ChannelNamePolicy)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if dbContext.UseXattrs() {
 		// Set the purge interval for tombstone compaction
 		dbContext.PurgeInterval = DefaultPurgeInterval
@@ -639,7 +751,9 @@ func NewDatabaseContext(ctx context.Context, dbName string, bucket base.Bucket,
 
 	dbContext.ResyncManager = NewResyncManager(bucket)
 	dbContext.TombstoneCompactionManager = NewTombstoneCompactionManager()
+	dbContext.ChannelHistoryCompactionManager = NewChannelHistoryCompactionManager()
 	dbContext.AttachmentCompactionManager = NewAttachmentCompactionManager(bucket)
+	dbContext.MetadataMigrationManager = NewMetadataMigrationManager(bucket)
 
 	if options.UserFunctions != nil {
 		dbContext.userFunctions, err = compileUserFunctions(ctx, options.UserFunctions)
@@ -654,6 +768,53 @@ func NewDatabaseContext(ctx context.Context, dbName string, bucket base.Bucket,
 		}
 	}
 
+	// Preload channel caches before the database is brought online
+	if options.CacheOptions != nil && options.CacheOptions.Preload != nil {
+		preload := options.CacheOptions.Preload
+		dbContext.preloadChannelCaches(ctx, preload)
+		if topN := preload.topN(); topN > 0 {
+			preloadTask, err := NewBackgroundTask("ChannelCachePreloadPersist", dbContext.Name, func(ctx context.Context) error {
+				return dbContext.persistChannelCachePreloadChannels(ctx, topN)
+			}, channelCachePreloadPersistInterval, dbContext.terminator)
+			if err != nil {
+				return nil, err
+			}
+			dbContext.backgroundTasks = append(dbContext.backgroundTasks, preloadTask)
+		}
+	}
+
+	if dbContext.collectionQuota != nil {
+		if err := dbContext.refreshCollectionQuotaUsage(ctx); err != nil {
+			base.WarnfCtx(ctx, "Unable to establish collection quota usage, writes will be counted from zero until the next refresh: %v", err)
+		}
+		quotaTask, err := NewBackgroundTask("CollectionQuotaRefresh", dbContext.Name, func(ctx context.Context) error {
+			if err := dbContext.refreshCollectionQuotaUsage(ctx); err != nil {
+				base.WarnfCtx(ctx, "Unable to refresh collection quota usage: %v", err)
+			}
+			return nil
+		}, collectionQuotaRefreshInterval, dbContext.terminator)
+		if err != nil {
+			return nil, err
+		}
+		dbContext.backgroundTasks = append(dbContext.backgroundTasks, quotaTask)
+	}
+
+	if options.GuestSessions != nil {
+		guestCleanupTask, err := NewBackgroundTask("GuestDeviceUserCleanup", dbContext.Name, func(ctx context.Context) error {
+			removed, err := dbContext.DeleteExpiredGuestDeviceUsers(ctx)
+			if err != nil {
+				base.WarnfCtx(ctx, "Unable to remove expired guest device users: %v", err)
+			} else if removed > 0 {
+				base.InfofCtx(ctx, base.KeyAuth, "Removed %d expired guest device users", removed)
+			}
+			return nil
+		}, guestDeviceUserCleanupInterval, dbContext.terminator)
+		if err != nil {
+			return nil, err
+		}
+		dbContext.backgroundTasks = append(dbContext.backgroundTasks, guestCleanupTask)
+	}
+
 	return dbContext, nil
 }
 
@@ -677,6 +838,17 @@ func (context *DatabaseContext) GetOIDCProvider(providerName string) (*auth.OIDC
 
 // Create a zero'd out since value (eg, initial since value) based on the sequence type
 // of the database (int or vector clock)
+// CheckSlowRequest logs a warning and counts the request if it took longer than the database's slow request threshold.
+// describe is only called for slow requests, and should return the request's method and sanitized path, or BLIP profile.
+func (context *DatabaseContext) CheckSlowRequest(ctx context.Context, elapsed time.Duration, describe func() string) {
+	threshold := context.Options.SlowRequestThreshold
+	if threshold <= 0 || elapsed <= threshold {
+		return
+	}
+	base.WarnfCtx(ctx, "Slow request: %s took %v, exceeding the threshold of %v", describe(), elapsed, threshold)
+	context.DbStats.Database().SlowRequestCount.Add(1)
+}
+
 func (context *DatabaseContext) CreateZeroSinceValue() SequenceID {
 	return SequenceID{}
 }
@@ -765,18 +937,56 @@ func (context *DatabaseContext) IsClosed() bool {
 }
 
 // For testing only!
-func (context *DatabaseContext) RestartListener() error {
-	context.mutationListener.Stop()
+func (dbCtx *DatabaseContext) RestartListener() error {
+	dbCtx.mutationListener.Stop()
 	// Delay needed to properly stop
 	time.Sleep(2 * time.Second)
-	context.mutationListener.Init(context.Bucket.GetName(), context.Options.GroupID)
-	cacheFeedStatsMap := context.DbStats.Database().CacheFeedMapStats
-	if err := context.mutationListener.Start(context.Bucket, cacheFeedStatsMap.Map); err != nil {
+	return dbCtx.startStoppedListener()
+}
+
+// startStoppedListener starts the caching feed again after the mutationListener has been stopped.
+func (dbCtx *DatabaseContext) startStoppedListener() error {
+	dbCtx.mutationListener.Init(dbCtx.Bucket.GetName(), dbCtx.Options.GroupID)
+	cacheFeedStatsMap := dbCtx.DbStats.Database().CacheFeedMapStats
+	dbCtx.initCacheFeedRollbackProtection(dbCtx.AddDatabaseLogContext(context.Background()), cacheFeedStatsMap.Map)
+	if err := dbCtx.mutationListener.Start(dbCtx.Bucket, cacheFeedStatsMap.Map); err != nil {
 		return err
 	}
 	return nil
 }
 
+// KillCacheFeed drops the caching feed's connection, discarding the events in flight or held back by
+// Options.CacheFeedChaos, then restarts the feed.  For testing only!
+func (dbCtx *DatabaseContext) KillCacheFeed() error {
+	chaos := dbCtx.Options.CacheFeedChaos
+	if chaos == nil {
+		return errors.New("caching feed chaos not enabled")
+	}
+	chaos.SetDiscarding(true)
+	dbCtx.mutationListener.Stop()
+	// Delay needed to properly stop
+	time.Sleep(2 * time.Second)
+	chaos.SetDiscarding(false)
+	return dbCtx.startStoppedListener()
+}
+
+// KillImportFeed drops the import feed's connection, discarding the events in flight or held back by
+// Options.ImportFeedChaos, then restarts the feed from its checkpoints.  For testing only!
+func (dbCtx *DatabaseContext) KillImportFeed(ctx context.Context) error {
+	chaos := dbCtx.Options.ImportFeedChaos
+	if chaos == nil {
+		return errors.New("import feed chaos not enabled")
+	}
+	if dbCtx.ImportListener == nil {
+		return errors.New("import feed not running")
+	}
+	chaos.SetDiscarding(true)
+	dbCtx.ImportListener.Stop()
+	chaos.SetDiscarding(false)
+	dbCtx.ImportListener = NewImportListener(dbCtx.Options.GroupID)
+	return dbCtx.ImportListener.StartImportFeed(ctx, dbCtx.Bucket, dbCtx.DbStats, dbCtx)
+}
+
 // Cache flush support.  Currently test-only - added for unit test access from rest package
 func (dbCtx *DatabaseContext) FlushChannelCache(ctx context.Context) error {
 	base.InfofCtx(ctx, base.KeyCache, "Flushing channel cache")
@@ -873,6 +1083,9 @@ func (context *DatabaseContext) Authenticator(ctx context.Context) *auth.Authent
 		ChannelsWarningThreshold: channelsWarningThreshold,
 		SessionCookieName:        sessionCookieName,
 		BcryptCost:               context.Options.BcryptCost,
+		PasswordPolicy:           context.Options.PasswordPolicy,
+		LastSequence:             context.LastSequence,
+		Clock:                    context.Options.Clock,
 		LogCtx:                   ctx,
 	})
 
@@ -1233,6 +1446,33 @@ outerLoop:
 
 // ////// HOUSEKEEPING:
 
+// GetUserSessions returns the active sessions for the given user.
+func (db *DatabaseContext) GetUserSessions(ctx context.Context, userName string) ([]*auth.LoginSession, error) {
+
+	results, err := db.QuerySessions(ctx, userName)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]*auth.LoginSession, 0)
+	var sessionsRow QueryIdRow
+	for results.Next(&sessionsRow) {
+		var session auth.LoginSession
+		if _, err := db.Bucket.Get(sessionsRow.Id, &session); err != nil {
+			// The session may have expired or been deleted since the query was run
+			if !base.IsDocNotFoundError(err) {
+				base.WarnfCtx(ctx, "Error getting session %q: %v", base.UD(sessionsRow.Id), err)
+			}
+			continue
+		}
+		sessions = append(sessions, &session)
+	}
+	if err := results.Close(); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
 // Deletes all session documents for a user
 func (db *DatabaseContext) DeleteUserSessions(ctx context.Context, userName string) error {
 
@@ -1248,7 +1488,10 @@ func (db *DatabaseContext) DeleteUserSessions(ctx context.Context, userName stri
 			base.WarnfCtx(ctx, "Error deleting %q: %v", sessionsRow.Id, err)
 		}
 	}
-	return results.Close()
+	if err := results.Close(); err != nil {
+		return err
+	}
+	return db.Authenticator(ctx).RevokeRefreshTokens(userName)
 }
 
 // Trigger tombstone compaction from view and/or GSI indexes.  Several Sync Gateway indexes server tombstones (deleted documents with an xattr).
@@ -1371,17 +1614,31 @@ func (db *Database) Compact(ctx context.Context, skipRunningStateCheck bool, cal
 
 // ////// SYNC FUNCTION:
 
+// Prefix of the saved sync function of a database that runs a WebAssembly module in place of a sync function
+const syncWasmModulePrefix = "wasm:"
+
 // Sets the database context's sync function based on the JS code from config.
 // Returns a boolean indicating whether the function is different from the saved one.
 // If multiple gateway instances try to update the function at the same time (to the same new
 // value) only one of them will get a changed=true result.
 func (dbCtx *DatabaseContext) UpdateSyncFun(ctx context.Context, syncFun string) (changed bool, err error) {
-	if syncFun == "" {
+	if len(dbCtx.Options.SyncWasmModule) > 0 {
+		// Save a digest of the module as the sync function, so that changes to the module are detected
+		syncFun = syncWasmModulePrefix + base.Sha1HashString(string(dbCtx.Options.SyncWasmModule), "")
+		if dbCtx.ChannelMapper == nil {
+			dbCtx.ChannelMapper, err = channels.NewWasmChannelMapper(dbCtx.Options.SyncWasmModule, dbCtx.Options.JavascriptTimeout)
+		}
+	} else if syncFun == "" {
 		dbCtx.ChannelMapper = nil
 	} else if dbCtx.ChannelMapper != nil {
-		_, err = dbCtx.ChannelMapper.SetFunction(syncFun)
+		_, err = dbCtx.ChannelMapper.SetFunction(base.WrapJSFunctionWithLibrary(syncFun, dbCtx.Options.JSLibrary))
 	} else {
-		dbCtx.ChannelMapper = channels.NewChannelMapper(syncFun, dbCtx.Options.JavascriptTimeout)
+		var limits base.JSLimits
+		if dbCtx.Options.SyncFunctionLimits != nil {
+			limits = dbCtx.Options.SyncFunctionLimits.JSLimits()
+		}
+		dbCtx.ChannelMapper = channels.NewChannelMapperWithLimits(dbCtx.Options.JavascriptEngine,
+			base.WrapJSFunctionWithLibrary(syncFun, dbCtx.Options.JSLibrary), dbCtx.Options.JavascriptTimeout, limits)
 	}
 	if err != nil {
 		base.WarnfCtx(ctx, "Error setting sync function: %s", err)
@@ -1792,6 +2049,19 @@ func (context *DatabaseContext) FlushRevisionCacheForTest() {
 
 }
 
+// initCollectionStats returns the stats for the database's collection, which is the default collection when no scopes
+// are configured.
+// WIP: Collections Phase 1 - a database runs with a single collection, whose stats are returned.
+func initCollectionStats(dbStats *base.DbStats, scopes ScopesOptions) *base.CollectionStats {
+	scopeName, collectionName := base.DefaultScope, base.DefaultCollection
+	for sn, scope := range scopes {
+		for cn := range scope.Collections {
+			scopeName, collectionName = sn, cn
+		}
+	}
+	return dbStats.InitCollectionStats(scopeName, collectionName)
+}
+
 func initDatabaseStats(dbName string, autoImport bool, options DatabaseContextOptions) *base.DbStats {
 
 	enabledDeltaSync := options.DeltaSyncOptions.Enabled
@@ -1826,6 +2096,7 @@ func initDatabaseStats(dbName string, autoImport bool, options DatabaseContextOp
 			QueryTypeTombstones,
 			QueryTypeResync,
 			QueryTypeAllDocs,
+			QueryTypeCollectionUsage,
 			QueryTypeUsers,
 		}
 	}
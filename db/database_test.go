@@ -367,7 +367,7 @@ func TestGetRemovedAsUser(t *testing.T) {
 	// Manually flush the rev cache
 	// After expiry from the rev cache and removal of doc backup, try again
 	cacheHitCounter, cacheMissCounter := db.DatabaseContext.DbStats.Cache().RevisionCacheHits, db.DatabaseContext.DbStats.Cache().RevisionCacheMisses
-	db.DatabaseContext.revisionCache = NewShardedLRURevisionCache(DefaultRevisionCacheShardCount, DefaultRevisionCacheSize, db.DatabaseContext, cacheHitCounter, cacheMissCounter)
+	db.DatabaseContext.revisionCache = NewShardedLRURevisionCache(DefaultRevisionCacheShardCount, DefaultRevisionCacheSize, 0, db.DatabaseContext, cacheHitCounter, cacheMissCounter, &base.SgwIntStat{}, &base.SgwIntStat{})
 	err = db.PurgeOldRevisionJSON(ctx, "doc1", rev2id)
 	assert.NoError(t, err, "Purge old revision JSON")
 
@@ -684,7 +684,7 @@ func TestGetRemoved(t *testing.T) {
 	// Manually flush the rev cache
 	// After expiry from the rev cache and removal of doc backup, try again
 	cacheHitCounter, cacheMissCounter := db.DatabaseContext.DbStats.Cache().RevisionCacheHits, db.DatabaseContext.DbStats.Cache().RevisionCacheMisses
-	db.DatabaseContext.revisionCache = NewShardedLRURevisionCache(DefaultRevisionCacheShardCount, DefaultRevisionCacheSize, db.DatabaseContext, cacheHitCounter, cacheMissCounter)
+	db.DatabaseContext.revisionCache = NewShardedLRURevisionCache(DefaultRevisionCacheShardCount, DefaultRevisionCacheSize, 0, db.DatabaseContext, cacheHitCounter, cacheMissCounter, &base.SgwIntStat{}, &base.SgwIntStat{})
 	err = db.PurgeOldRevisionJSON(ctx, "doc1", rev2id)
 	assert.NoError(t, err, "Purge old revision JSON")
 
@@ -750,7 +750,7 @@ func TestGetRemovedAndDeleted(t *testing.T) {
 	// Manually flush the rev cache
 	// After expiry from the rev cache and removal of doc backup, try again
 	cacheHitCounter, cacheMissCounter := db.DatabaseContext.DbStats.Cache().RevisionCacheHits, db.DatabaseContext.DbStats.Cache().RevisionCacheMisses
-	db.DatabaseContext.revisionCache = NewShardedLRURevisionCache(DefaultRevisionCacheShardCount, DefaultRevisionCacheSize, db.DatabaseContext, cacheHitCounter, cacheMissCounter)
+	db.DatabaseContext.revisionCache = NewShardedLRURevisionCache(DefaultRevisionCacheShardCount, DefaultRevisionCacheSize, 0, db.DatabaseContext, cacheHitCounter, cacheMissCounter, &base.SgwIntStat{}, &base.SgwIntStat{})
 	err = db.PurgeOldRevisionJSON(ctx, "doc1", rev2id)
 	assert.NoError(t, err, "Purge old revision JSON")
 
@@ -1363,6 +1363,48 @@ func TestSyncFnOnPush(t *testing.T) {
 	assert.Equal(t, base.SetOf("clibup"), doc.History["4-four"].Channels)
 }
 
+// Verify that the sync function can validate a new revision against the previous revision's channels and expiry.
+func TestSyncFnOldRevisionMeta(t *testing.T) {
+
+	db, ctx := setupTestDB(t)
+	defer db.Close(ctx)
+
+	db.ChannelMapper = channels.NewChannelMapper(`function(doc, oldDoc, meta) {
+		function contains(array, value) {
+			for (var i = 0; i < array.length; i++) {
+				if (array[i] == value) return true;
+			}
+			return false;
+		}
+		if (meta.oldRev != null) {
+			for (var i = 0; i < doc.channels.length; i++) {
+				if (!contains(meta.oldChannels, doc.channels[i])) throw({forbidden: "channels may only be narrowed"});
+			}
+		}
+		var newExpiry = Math.floor(Date.now() / 1000) + doc.ttl;
+		if (meta.oldExpiry != null && newExpiry > meta.oldExpiry) throw({forbidden: "expiry can't be extended"});
+		expiry(newExpiry);
+		channel(doc.channels);
+		channel("from-" + meta.oldRev);
+	}`, 0)
+
+	rev1ID, _, err := db.Put(ctx, "doc1", Body{"channels": []string{"a", "b"}, "ttl": 3600})
+	require.NoError(t, err)
+
+	_, _, err = db.Put(ctx, "doc1", Body{BodyRev: rev1ID, "channels": []string{"a", "c"}, "ttl": 60})
+	assertHTTPError(t, err, 403)
+	_, _, err = db.Put(ctx, "doc1", Body{BodyRev: rev1ID, "channels": []string{"a"}, "ttl": 7200})
+	assertHTTPError(t, err, 403)
+
+	rev2ID, _, err := db.Put(ctx, "doc1", Body{BodyRev: rev1ID, "channels": []string{"a"}, "ttl": 60})
+	require.NoError(t, err)
+
+	doc, err := db.GetDocument(ctx, "doc1", DocUnmarshalAll)
+	require.NoError(t, err)
+	assert.Equal(t, base.SetOf("a", "b", "from-null"), doc.History[rev1ID].Channels)
+	assert.Equal(t, base.SetOf("a", "from-"+rev1ID), doc.History[rev2ID].Channels)
+}
+
 func TestInvalidChannel(t *testing.T) {
 
 	db, ctx := setupTestDB(t)
@@ -2590,3 +2632,107 @@ func waitAndAssertConditionWithOptions(t *testing.T, fn func() bool, retryCount,
 func waitAndAssertCondition(t *testing.T, fn func() bool, failureMsgAndArgs ...interface{}) {
 	waitAndAssertConditionWithOptions(t, fn, 20, 100, failureMsgAndArgs...)
 }
+
+func TestSyncFnStats(t *testing.T) {
+
+	db, ctx := setupTestDB(t)
+	defer db.Close(ctx)
+
+	db.ChannelMapper = channels.NewChannelMapper(`function(doc) {
+		if (doc.reject) throw({forbidden: "rejected"});
+		if (doc.fail) throw new Error("failed");
+		if (doc.slow) { var end = Date.now() + 50; while (Date.now() < end) {} }
+		channel(doc.channels);
+	}`, 0)
+	db.Options.SyncFunctionSlowThreshold = 20 * time.Millisecond
+
+	dbStats := db.DbStats.Database()
+	_, _, err := db.Put(ctx, "doc1", Body{"channels": []string{"a", "b"}})
+	require.NoError(t, err)
+	_, _, err = db.Put(ctx, "doc2", Body{"channels": []string{"a"}, "slow": true})
+	require.NoError(t, err)
+	_, _, err = db.Put(ctx, "doc3", Body{"reject": true})
+	assertHTTPError(t, err, 403)
+	_, _, err = db.Put(ctx, "doc4", Body{"fail": true})
+	assertHTTPError(t, err, 500)
+
+	assert.Equal(t, int64(4), dbStats.SyncFunctionCount.Value())
+	assert.Equal(t, uint64(4), dbStats.SyncFunctionDuration.Count())
+	assert.Equal(t, int64(1), dbStats.SyncFunctionRejectCount.Value())
+	assert.Equal(t, int64(1), dbStats.SyncFunctionExceptionCount.Value())
+	assert.Equal(t, int64(1), dbStats.SyncFunctionSlowCount.Value())
+	assert.Equal(t, "2", dbStats.SyncFunctionChannelAssignments.Get("a").String())
+	assert.Equal(t, "1", dbStats.SyncFunctionChannelAssignments.Get("b").String())
+}
+
+func TestCheckSlowRequest(t *testing.T) {
+
+	db, ctx := setupTestDB(t)
+	defer db.Close(ctx)
+
+	described := 0
+	describe := func() string {
+		described++
+		return "GET /db/doc"
+	}
+
+	// Disabled by default
+	db.CheckSlowRequest(ctx, time.Hour, describe)
+	assert.Equal(t, int64(0), db.DbStats.Database().SlowRequestCount.Value())
+
+	db.Options.SlowRequestThreshold = 100 * time.Millisecond
+	db.CheckSlowRequest(ctx, 50*time.Millisecond, describe)
+	assert.Equal(t, 0, described)
+	db.CheckSlowRequest(ctx, 150*time.Millisecond, describe)
+	assert.Equal(t, 1, described)
+	assert.Equal(t, int64(1), db.DbStats.Database().SlowRequestCount.Value())
+}
+
+func TestSyncFnCreateRoles(t *testing.T) {
+
+	db, ctx := setupTestDB(t)
+	defer db.Close(ctx)
+
+	db.ChannelMapper = channels.NewChannelMapper(`function(doc) {
+		role(doc.team, {create: true, admin_channels: doc.channels});
+		role(doc.owner, "role:" + doc.team);
+	}`, 0)
+
+	_, _, err := db.Put(ctx, "doc1", Body{"team": "editors", "owner": "alice", "channels": []string{"drafts", "published"}})
+	require.NoError(t, err)
+
+	role, err := db.Authenticator(ctx).GetRole("editors")
+	require.NoError(t, err)
+	require.NotNil(t, role)
+	assert.True(t, role.ExplicitChannels().Equals(base.SetOf("drafts", "published")))
+	assert.Equal(t, int64(1), db.DbStats.Database().SyncFunctionRolesCreated.Value())
+
+	// Roles that already exist are left unchanged
+	_, _, err = db.Put(ctx, "doc2", Body{"team": "editors", "owner": "bob", "channels": []string{"archive"}})
+	require.NoError(t, err)
+
+	role, err = db.Authenticator(ctx).GetRole("editors")
+	require.NoError(t, err)
+	require.NotNil(t, role)
+	assert.True(t, role.ExplicitChannels().Equals(base.SetOf("drafts", "published")))
+	assert.Equal(t, int64(1), db.DbStats.Database().SyncFunctionRolesCreated.Value())
+}
+
+// TestCollectionStats ensures that writes and sync function runs are attributed to the database's collection.
+func TestCollectionStats(t *testing.T) {
+
+	db, ctx := setupTestDB(t)
+	defer db.Close(ctx)
+
+	require.Len(t, db.DbStats.CollectionStats, 1)
+	assert.Contains(t, db.DbStats.CollectionStats, base.DefaultScope+base.ScopeCollectionSeparator+base.DefaultCollection)
+
+	_, _, err := db.Put(ctx, "doc1", Body{"channels": []string{"ABC"}})
+	require.NoError(t, err)
+	_, _, err = db.Put(ctx, "doc2", Body{"channels": []string{"ABC"}})
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(2), db.CollectionStats.NumDocWrites.Value())
+	assert.Equal(t, db.DbStats.Database().DocWritesBytes.Value(), db.CollectionStats.DocWritesBytes.Value())
+	assert.Equal(t, int64(2), db.CollectionStats.SyncFunctionCount.Value())
+}
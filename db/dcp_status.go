@@ -0,0 +1,78 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package db
+
+import (
+	"context"
+
+	"github.com/couchbase/sync_gateway/base"
+)
+
+// DCPStatus describes the state of the database's DCP feeds on this node, as returned by the admin API's /{db}/_dcp
+// endpoint.
+type DCPStatus struct {
+	CacheFeed  *DCPFeedStatus `json:"cache_feed"`
+	ImportFeed *DCPFeedStatus `json:"import_feed,omitempty"` // Omitted when this node isn't running an import feed
+}
+
+// DCPFeedStatus describes the state of each vbucket's stream for a DCP feed.  For a sharded import feed, only the
+// vbuckets assigned to this node are included.
+type DCPFeedStatus struct {
+	OpenStreams int                     `json:"open_streams"`
+	Backlog     uint64                  `json:"backlog"`   // Estimated number of sequences still to be processed, across all vbuckets
+	Rollbacks   uint64                  `json:"rollbacks"` // Number of rollbacks since the feed was started, across all vbuckets
+	Vbuckets    []base.DCPVbucketStatus `json:"vbuckets"`
+}
+
+// GetDCPStatus returns the state of the database's DCP feeds.  Backlogs are estimated from the current high sequence
+// of each vbucket, and are omitted if those can't be retrieved.
+func (context *DatabaseContext) GetDCPStatus(ctx context.Context) *DCPStatus {
+	highSeqs := context.vbucketHighSeqs(ctx)
+	status := &DCPStatus{
+		CacheFeed: newDCPFeedStatus(context.DbStats.Database().CacheFeedMapStats, highSeqs),
+	}
+	if context.ImportListener != nil {
+		status.ImportFeed = newDCPFeedStatus(context.DbStats.Database().ImportFeedMapStats, highSeqs)
+	}
+	return status
+}
+
+func newDCPFeedStatus(feedStats *base.ExpVarMapWrapper, highSeqs map[uint16]uint64) *DCPFeedStatus {
+	status := &DCPFeedStatus{
+		Vbuckets: base.GetDCPFeedMonitor(feedStats.Map).VbucketStatus(highSeqs),
+	}
+	for _, vbucket := range status.Vbuckets {
+		if vbucket.State == base.DCPStreamStateOpen {
+			status.OpenStreams++
+		}
+		status.Backlog += vbucket.Backlog
+		status.Rollbacks += vbucket.Rollbacks
+	}
+	return status
+}
+
+// vbucketHighSeqs returns the current high sequence of each vbucket in the database's bucket, or nil if they can't be
+// retrieved.
+func (context *DatabaseContext) vbucketHighSeqs(ctx context.Context) map[uint16]uint64 {
+	store, ok := base.AsCouchbaseStore(context.Bucket)
+	if !ok {
+		return nil
+	}
+	maxVbNo, err := store.GetMaxVbno()
+	if err != nil {
+		base.WarnfCtx(ctx, "Unable to retrieve vbucket count to estimate DCP backlog: %v", err)
+		return nil
+	}
+	_, highSeqs, err := store.GetStatsVbSeqno(maxVbNo, false)
+	if err != nil {
+		base.WarnfCtx(ctx, "Unable to retrieve vbucket high sequences to estimate DCP backlog: %v", err)
+		return nil
+	}
+	return highSeqs
+}
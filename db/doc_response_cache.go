@@ -0,0 +1,175 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package db
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/couchbase/sync_gateway/base"
+)
+
+const (
+	DefaultDocResponseCacheTTL        = time.Second
+	DefaultDocResponseCacheMaxEntries = 10000
+	MaxDocResponseCacheTTLMs          = 60000
+)
+
+// DocResponseCacheConfig configures a short-lived cache of the response bodies of GETs for the current revision of
+// documents, to absorb read storms on popular documents without fetching them from the bucket for every request.
+type DocResponseCacheConfig struct {
+	Enabled    *bool   `json:"enabled,omitempty"`     // Whether responses are cached
+	TTLMs      *uint32 `json:"ttl_ms,omitempty"`      // How long a response can be served from the cache, in milliseconds
+	MaxEntries *int    `json:"max_entries,omitempty"` // Maximum number of documents' responses cached
+}
+
+// Validate ensures the config's settings are valid.
+func (c *DocResponseCacheConfig) Validate() error {
+	if c.TTLMs != nil && (*c.TTLMs < 1 || *c.TTLMs > MaxDocResponseCacheTTLMs) {
+		return fmt.Errorf("ttl_ms must be between 1 and %d", MaxDocResponseCacheTTLMs)
+	}
+	if c.MaxEntries != nil && *c.MaxEntries < 1 {
+		return fmt.Errorf("max_entries must be at least 1")
+	}
+	return nil
+}
+
+// docResponseCache is an LRU cache of the marshalled bodies of documents' current revisions, keyed by doc ID.  Entries
+// are invalidated when the document changes on this node or arrives over the caching feed, and otherwise expire after
+// the TTL, which bounds how stale a response can be when a change on another node hasn't arrived yet.
+type docResponseCache struct {
+	lock       sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]*list.Element
+	lruList    *list.List
+	hitStat    *base.SgwIntStat
+	missStat   *base.SgwIntStat
+}
+
+type docResponseCacheEntry struct {
+	docID     string
+	revID     string
+	channels  base.Set // Channels of the revision, to authorize users served from the cache
+	body      []byte
+	expiresAt time.Time
+}
+
+// newDocResponseCache returns a doc response cache for the given config, or nil if it isn't enabled.
+func newDocResponseCache(config *DocResponseCacheConfig, cacheStats *base.CacheStats) *docResponseCache {
+	if config == nil || !base.BoolDefault(config.Enabled, false) {
+		return nil
+	}
+	cache := &docResponseCache{
+		ttl:        DefaultDocResponseCacheTTL,
+		maxEntries: DefaultDocResponseCacheMaxEntries,
+		entries:    make(map[string]*list.Element),
+		lruList:    list.New(),
+		hitStat:    cacheStats.DocResponseCacheHits,
+		missStat:   cacheStats.DocResponseCacheMisses,
+	}
+	if config.TTLMs != nil {
+		cache.ttl = time.Duration(*config.TTLMs) * time.Millisecond
+	}
+	if config.MaxEntries != nil {
+		cache.maxEntries = *config.MaxEntries
+	}
+	return cache
+}
+
+// get returns the unexpired entry for the given doc, if present.
+func (c *docResponseCache) get(docID string) (*docResponseCacheEntry, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	elem, ok := c.entries[docID]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*docResponseCacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		c._remove(elem)
+		return nil, false
+	}
+	c.lruList.MoveToFront(elem)
+	return entry, true
+}
+
+// put adds or replaces the entry for a doc, evicting the least recently used entries when over capacity.
+func (c *docResponseCache) put(entry *docResponseCacheEntry) {
+	entry.expiresAt = time.Now().Add(c.ttl)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if elem, ok := c.entries[entry.docID]; ok {
+		elem.Value = entry
+		c.lruList.MoveToFront(elem)
+		return
+	}
+	c.entries[entry.docID] = c.lruList.PushFront(entry)
+	for len(c.entries) > c.maxEntries {
+		c._remove(c.lruList.Back())
+	}
+}
+
+// invalidate removes the entry for a doc.  Safe to call on a nil cache, when response caching isn't enabled.
+func (c *docResponseCache) invalidate(docID string) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	if elem, ok := c.entries[docID]; ok {
+		c._remove(elem)
+	}
+	c.lock.Unlock()
+}
+
+// Expects callers to hold c.lock
+func (c *docResponseCache) _remove(elem *list.Element) {
+	c.lruList.Remove(elem)
+	delete(c.entries, elem.Value.(*docResponseCacheEntry).docID)
+}
+
+// GetCurrentRev1xBodyBytes returns the ID and marshalled 1.x body of the current revision of a document, as returned by
+// a GET without any options.  When the doc response cache is enabled, responses are served from it while they're
+// unexpired and their revision is still in the revision cache, once the user's been authorized for the revision's
+// channels.
+func (db *Database) GetCurrentRev1xBodyBytes(ctx context.Context, docID string) (revID string, bodyBytes []byte, err error) {
+	cache := db.docResponseCache
+	if cache != nil {
+		if entry, ok := cache.get(docID); ok {
+			if _, found := db.revisionCache.Peek(ctx, docID, entry.revID); !found {
+				cache.invalidate(docID)
+			} else if isAuthorized, _ := db.authorizeUserForChannels(docID, entry.revID, entry.channels, false, nil); isAuthorized {
+				cache.hitStat.Add(1)
+				return entry.revID, entry.body, nil
+			}
+			// Unauthorized users are handled by the uncached retrieval below, for consistent errors
+		}
+		cache.missStat.Add(1)
+	}
+
+	rev, err := db.getRev(ctx, docID, "", 0, nil, RevCacheIncludeBody)
+	if err != nil {
+		return "", nil, err
+	}
+	body, err := rev.Mutable1xBody(db, nil, nil, false)
+	if err != nil {
+		return "", nil, err
+	}
+	bodyBytes, err = base.JSONMarshalCanonical(body)
+	if err != nil {
+		return "", nil, err
+	}
+	if cache != nil {
+		cache.put(&docResponseCacheEntry{docID: docID, revID: rev.RevID, channels: rev.Channels, body: bodyBytes})
+	}
+	return rev.RevID, bodyBytes, nil
+}
@@ -0,0 +1,111 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/couchbase/sync_gateway/channels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocResponseCacheConfigValidate(t *testing.T) {
+	assert.NoError(t, (&DocResponseCacheConfig{}).Validate())
+	assert.NoError(t, (&DocResponseCacheConfig{Enabled: base.BoolPtr(true), TTLMs: base.Uint32Ptr(500), MaxEntries: base.IntPtr(100)}).Validate())
+	assert.Error(t, (&DocResponseCacheConfig{TTLMs: base.Uint32Ptr(0)}).Validate())
+	assert.Error(t, (&DocResponseCacheConfig{TTLMs: base.Uint32Ptr(MaxDocResponseCacheTTLMs + 1)}).Validate())
+	assert.Error(t, (&DocResponseCacheConfig{MaxEntries: base.IntPtr(0)}).Validate())
+}
+
+func TestDocResponseCache(t *testing.T) {
+	testStats := (base.NewSyncGatewayStats()).NewDBStats("", false, false, false).Cache()
+	assert.Nil(t, newDocResponseCache(nil, testStats))
+	assert.Nil(t, newDocResponseCache(&DocResponseCacheConfig{}, testStats))
+
+	cache := newDocResponseCache(&DocResponseCacheConfig{Enabled: base.BoolPtr(true), MaxEntries: base.IntPtr(2)}, testStats)
+	require.NotNil(t, cache)
+	cache.put(&docResponseCacheEntry{docID: "doc1", revID: "1-a"})
+	cache.put(&docResponseCacheEntry{docID: "doc2", revID: "1-a"})
+
+	// Getting doc1 makes doc2 the least recently used, to be evicted when doc3 is added
+	_, ok := cache.get("doc1")
+	assert.True(t, ok)
+	cache.put(&docResponseCacheEntry{docID: "doc3", revID: "1-a"})
+	_, ok = cache.get("doc2")
+	assert.False(t, ok)
+
+	// Replacing an entry updates it in place
+	cache.put(&docResponseCacheEntry{docID: "doc1", revID: "2-a"})
+	entry, ok := cache.get("doc1")
+	require.True(t, ok)
+	assert.Equal(t, "2-a", entry.revID)
+	assert.Len(t, cache.entries, 2)
+
+	cache.invalidate("doc1")
+	_, ok = cache.get("doc1")
+	assert.False(t, ok)
+
+	// Expired entries aren't returned
+	cache.ttl = time.Millisecond
+	cache.put(&docResponseCacheEntry{docID: "doc4", revID: "1-a"})
+	time.Sleep(5 * time.Millisecond)
+	_, ok = cache.get("doc4")
+	assert.False(t, ok)
+
+	// Invalidating a nil cache is a no-op
+	var nilCache *docResponseCache
+	nilCache.invalidate("doc1")
+}
+
+func TestGetCurrentRev1xBodyBytes(t *testing.T) {
+	db, ctx := setupTestDBWithOptions(t, DatabaseContextOptions{
+		DocResponseCacheConfig: &DocResponseCacheConfig{Enabled: base.BoolPtr(true), TTLMs: base.Uint32Ptr(60000)},
+	})
+	defer db.Close(ctx)
+	db.ChannelMapper = channels.NewDefaultChannelMapper()
+	cacheStats := db.DbStats.Cache()
+
+	rev1ID, doc, err := db.Put(ctx, "doc1", Body{"channels": []string{"ABC"}, "value": 1})
+	require.NoError(t, err)
+	// Wait for the write to arrive over the caching feed, which invalidates any cached response
+	require.NoError(t, db.changeCache.waitForSequence(ctx, doc.Sequence, base.DefaultWaitForSequence))
+
+	revID, bodyBytes, err := db.GetCurrentRev1xBodyBytes(ctx, "doc1")
+	require.NoError(t, err)
+	assert.Equal(t, rev1ID, revID)
+	assert.Contains(t, string(bodyBytes), `"value":1`)
+	assert.Equal(t, int64(1), cacheStats.DocResponseCacheMisses.Value())
+
+	_, cachedBodyBytes, err := db.GetCurrentRev1xBodyBytes(ctx, "doc1")
+	require.NoError(t, err)
+	assert.Equal(t, bodyBytes, cachedBodyBytes)
+	assert.Equal(t, int64(1), cacheStats.DocResponseCacheHits.Value())
+
+	// Users without access to the revision's channels aren't served from the cache
+	authenticator := db.Authenticator(ctx)
+	user, err := authenticator.NewUser("naomi", "letmein", channels.SetOf(t, "DEF"))
+	require.NoError(t, err)
+	db.user = user
+	_, _, err = db.GetCurrentRev1xBodyBytes(ctx, "doc1")
+	assert.Equal(t, ErrForbidden, err)
+	assert.Equal(t, int64(1), cacheStats.DocResponseCacheHits.Value())
+	db.user = nil
+
+	// Updating the doc invalidates the cached response
+	rev2ID, _, err := db.Put(ctx, "doc1", Body{"channels": []string{"ABC"}, "value": 2, BodyRev: rev1ID})
+	require.NoError(t, err)
+	revID, bodyBytes, err = db.GetCurrentRev1xBodyBytes(ctx, "doc1")
+	require.NoError(t, err)
+	assert.Equal(t, rev2ID, revID)
+	assert.Contains(t, string(bodyBytes), `"value":2`)
+	assert.Equal(t, int64(1), cacheStats.DocResponseCacheHits.Value())
+}
@@ -17,6 +17,7 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"sort"
 	"time"
 
 	"github.com/couchbase/sync_gateway/base"
@@ -175,6 +176,9 @@ type Document struct {
 	RevID          string
 	DocAttachments AttachmentsMeta
 	inlineSyncData bool
+
+	accessExpiry channels.AccessExpiryMap // Expiry of time-limited access() grants from the latest sync function run, applied to Access by updateAccess
+	roleCreates  channels.AccessMap       // Roles to be created by the latest sync function run, created once the doc has been written
 }
 
 type revOnlySyncData struct {
@@ -340,7 +344,7 @@ func (doc *Document) GetMetaMap(userXattrKey string) (map[string]interface{}, er
 				return nil, err
 			}
 		}
-		xattrsMap[userXattrKey] = userXattr
+		addUserXattrToMeta(xattrsMap, userXattrKey, userXattr)
 	}
 
 	return map[string]interface{}{
@@ -348,6 +352,46 @@ func (doc *Document) GetMetaMap(userXattrKey string) (map[string]interface{}, er
 	}, nil
 }
 
+// withOldRevisionMeta returns a copy of metaMap that also describes the given parent revision, so the sync function
+// can compare the new revision with the previous revision's metadata as well as its body.
+func (doc *Document) withOldRevisionMeta(metaMap map[string]interface{}, oldRevID string) map[string]interface{} {
+	result := make(map[string]interface{}, len(metaMap)+3)
+	for key, value := range metaMap {
+		result[key] = value
+	}
+
+	var oldRev, oldChannels, oldExpiry interface{}
+	if oldRevID != "" {
+		oldRev = oldRevID
+		if info, err := doc.History.getInfo(oldRevID); err == nil {
+			channelNames := info.Channels.ToArray()
+			sort.Strings(channelNames)
+			oldChannels = channelNames
+		}
+	}
+	if doc.Expiry != nil && !doc.Expiry.IsZero() {
+		oldExpiry = doc.Expiry.Unix()
+	}
+	result[base.MetaMapOldRevKey] = oldRev
+	result[base.MetaMapOldChannelsKey] = oldChannels
+	result[base.MetaMapOldExpiryKey] = oldExpiry
+	return result
+}
+
+// addUserXattrToMeta adds the user xattr to the given map of xattrs.  A composite user xattr already holds its xattrs
+// keyed by name, so they're added individually - each configured xattr is present, even if it isn't set on the doc.
+func addUserXattrToMeta(xattrsMap map[string]interface{}, userXattrKey string, userXattr interface{}) {
+	if !base.IsCompositeUserXattrKey(userXattrKey) {
+		xattrsMap[userXattrKey] = userXattr
+		return
+	}
+	composite, _ := userXattr.(map[string]interface{})
+	for _, key := range base.UserXattrKeys(userXattrKey) {
+		name := base.UserXattrName(key)
+		xattrsMap[name] = composite[name]
+	}
+}
+
 func (doc *Document) SetCrc32cUserXattrHash() {
 	doc.SyncData.Crc32cUserXattr = userXattrCrc32cHash(doc.rawUserXattr)
 }
@@ -379,11 +423,35 @@ func unmarshalDocument(docid string, data []byte) (*Document, error) {
 	return doc, nil
 }
 
+// unmarshalDocumentWithLevel unmarshals a document with inline sync metadata to the given DocumentUnmarshalLevel.  Below
+// DocUnmarshalAll, only the sync metadata is unmarshalled, and the rest of the raw document is retained as the body for
+// lazy unmarshalling, as is done for documents with xattr metadata.  This avoids the cost of unmarshalling the body on
+// paths that only need the metadata, such as changes feeds that don't include docs.
+func unmarshalDocumentWithLevel(docid string, data []byte, unmarshalLevel DocumentUnmarshalLevel) (*Document, error) {
+	if unmarshalLevel == DocUnmarshalAll || len(data) == 0 {
+		return unmarshalDocument(docid, data)
+	}
+
+	syncData, err := UnmarshalDocumentSyncData(data, unmarshalLevel == DocUnmarshalSync)
+	if err != nil {
+		return nil, pkgerrors.Wrapf(err, "Error unmarshalling doc sync data.")
+	}
+	doc := NewDocument(docid)
+	if syncData != nil {
+		doc.SyncData = *syncData
+	}
+	doc._rawBody, err = base.RemoveJSONProperty(data, base.SyncPropertyName)
+	if err != nil {
+		return nil, pkgerrors.Wrapf(err, "Error removing sync data from doc body.")
+	}
+	return doc, nil
+}
+
 func unmarshalDocumentWithXattr(docid string, data []byte, xattrData []byte, userXattrData []byte, cas uint64, unmarshalLevel DocumentUnmarshalLevel) (doc *Document, err error) {
 
 	if xattrData == nil || len(xattrData) == 0 {
 		// If no xattr data, unmarshal as standard doc
-		doc, err = unmarshalDocument(docid, data)
+		doc, err = unmarshalDocumentWithLevel(docid, data, unmarshalLevel)
 	} else {
 		doc = NewDocument(docid)
 		err = doc.UnmarshalWithXattr(data, xattrData, unmarshalLevel)
@@ -425,12 +493,12 @@ func UnmarshalDocumentSyncData(data []byte, needHistory bool) (*SyncData, error)
 func UnmarshalDocumentSyncDataFromFeed(data []byte, dataType uint8, userXattrKey string, needHistory bool) (result *SyncData, rawBody []byte, rawXattr []byte, rawUserXattr []byte, err error) {
 
 	var body []byte
+	var userXattr []byte
 
 	// If attr datatype flag is set, data includes both xattrs and document body.  Check for presence of sync xattr.
 	// Note that there could be a non-sync xattr present
 	if dataType&base.MemcachedDataTypeXattr != 0 {
 		var syncXattr []byte
-		var userXattr []byte
 		body, syncXattr, userXattr, err = parseXattrStreamData(base.SyncXattrName, userXattrKey, data)
 		if err != nil {
 			return nil, nil, nil, nil, err
@@ -453,9 +521,10 @@ func UnmarshalDocumentSyncDataFromFeed(data []byte, dataType uint8, userXattrKey
 		body = data
 	}
 
-	// Non-xattr data, or sync xattr not present.  Attempt to retrieve sync metadata from document body
+	// Non-xattr data, or sync xattr not present.  Attempt to retrieve sync metadata from document body.  The user xattr
+	// is still returned, so that it's available to the sync function when a doc that's never been imported is imported.
 	result, err = UnmarshalDocumentSyncData(body, needHistory)
-	return result, body, rawUserXattr, nil, err
+	return result, body, nil, userXattr, err
 }
 
 func UnmarshalDocumentFromFeed(docid string, cas uint64, data []byte, dataType uint8, userXattrKey string) (doc *Document, err error) {
@@ -463,7 +532,6 @@ func UnmarshalDocumentFromFeed(docid string, cas uint64, data []byte, dataType u
 
 	if dataType&base.MemcachedDataTypeXattr != 0 {
 		var syncXattr []byte
-		var userXattr []byte
 		body, syncXattr, userXattr, err = parseXattrStreamData(base.SyncXattrName, userXattrKey, data)
 		if err != nil {
 			return nil, err
@@ -510,6 +578,16 @@ func parseXattrStreamData(xattrName string, userXattrName string, data []byte) (
 		return body, nil, nil, nil
 	}
 
+	// A composite user xattr key can refer to more than one xattr, so all of the xattrs it refers to are collected
+	// before building the composite user xattr
+	var userXattrs map[string][]byte
+	if base.IsCompositeUserXattrKey(userXattrName) {
+		userXattrs = make(map[string][]byte)
+		for _, key := range base.UserXattrKeys(userXattrName) {
+			userXattrs[base.UserXattrName(key)] = nil
+		}
+	}
+
 	// In the xattr key/value pairs, key and value are both terminated by 0x00 (byte(0)).  Use this as a separator to split the byte slice
 	separator := []byte("\x00")
 
@@ -530,21 +608,42 @@ func parseXattrStreamData(xattrName string, userXattrName string, data []byte) (
 		xattrKey := string(components[0])
 		if xattrName == xattrKey {
 			xattr = components[1]
-		} else if userXattrName != "" && userXattrName == xattrKey {
+		} else if _, ok := userXattrs[xattrKey]; ok {
+			userXattrs[xattrKey] = components[1]
+		} else if userXattrs == nil && userXattrName != "" && userXattrName == xattrKey {
 			userXattr = components[1]
 		}
 
 		// Exit if we have xattrs we want (either both or one if the latter is disabled)
-		if len(xattr) > 0 && (len(userXattr) > 0 || userXattrName == "") {
+		if userXattrs == nil && len(xattr) > 0 && (len(userXattr) > 0 || userXattrName == "") {
 			return body, xattr, userXattr, nil
 		}
 
 		pos += pairLen
 	}
 
+	if userXattrs != nil {
+		userXattr, err = compositeUserXattrFromXattrs(userXattrName, userXattrs)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
 	return body, xattr, userXattr, nil
 }
 
+// compositeUserXattrFromXattrs builds the composite raw user xattr for a composite user xattr key, given the raw values
+// of the xattrs it refers to, keyed by xattr name.
+func compositeUserXattrFromXattrs(userXattrKey string, xattrs map[string][]byte) ([]byte, error) {
+	values := make(map[string][]byte)
+	for _, key := range base.UserXattrKeys(userXattrKey) {
+		if rawXattr := xattrs[base.UserXattrName(key)]; len(rawXattr) > 0 {
+			values[key] = base.UserXattrPathValue(key, rawXattr)
+		}
+	}
+	return base.CompositeUserXattr(values)
+}
+
 func (doc *SyncData) HasValidSyncData() bool {
 
 	valid := doc != nil && doc.CurrentRev != "" && (doc.Sequence > 0)
@@ -1030,9 +1129,19 @@ func (doc *Document) IsChannelRemoval(revID string) (bodyBytes []byte, history R
 // Updates a document's channel/role UserAccessMap with new access settings from an AccessMap.
 // Returns an array of the user/role names whose access has changed as a result.
 func (accessMap *UserAccessMap) updateAccess(doc *Document, newAccess channels.AccessMap) (changedUsers []string) {
+	// Only channel grants can be time-limited
+	var accessExpiry channels.AccessExpiryMap
+	if accessMap == &doc.Access {
+		accessExpiry = doc.accessExpiry
+	}
+
 	// Update users already appearing in doc.Access:
 	for name, access := range *accessMap {
-		if access.UpdateAtSequence(newAccess[name], doc.Sequence) {
+		updated := access.UpdateAtSequence(newAccess[name], doc.Sequence)
+		if access.UpdateExpiry(accessExpiry[name]) {
+			updated = true
+		}
+		if updated {
 			if len(access) == 0 {
 				delete(*accessMap, name)
 			}
@@ -1045,7 +1154,9 @@ func (accessMap *UserAccessMap) updateAccess(doc *Document, newAccess channels.A
 			if *accessMap == nil {
 				*accessMap = UserAccessMap{}
 			}
-			(*accessMap)[name] = channels.AtSequence(access, doc.Sequence)
+			userAccess := channels.AtSequence(access, doc.Sequence)
+			userAccess.UpdateExpiry(accessExpiry[name])
+			(*accessMap)[name] = userAccess
 			changedUsers = append(changedUsers, name)
 		}
 	}
@@ -13,11 +13,13 @@ package db
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/json"
 	"log"
 	"testing"
 
 	"github.com/couchbase/sync_gateway/base"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TODO: Could consider checking this in as a file and include it into the compiled test binary using something like https://github.com/jteeuwen/go-bindata
@@ -187,6 +189,27 @@ func BenchmarkUnmarshalBody(b *testing.B) {
 	}
 }
 
+// TestUnmarshalDocumentWithLevel ensures that the body of a document with inline sync metadata is only unmarshalled
+// when requested, and is otherwise retained raw for lazy unmarshalling.
+func TestUnmarshalDocumentWithLevel(t *testing.T) {
+	data := []byte(`{"_sync":{"rev":"2-b","sequence":5,"history":{"revs":["1-a","2-b"],"parents":[-1,0],"channels":[null,null]}},"value":1}`)
+
+	doc, err := unmarshalDocumentWithLevel("doc1", data, DocUnmarshalSync)
+	require.NoError(t, err)
+	assert.Equal(t, "2-b", doc.CurrentRev)
+	assert.Equal(t, uint64(5), doc.Sequence)
+	assert.Len(t, doc.History, 2)
+	assert.Nil(t, doc._body)
+	assert.Equal(t, `{"value":1}`, string(doc._rawBody))
+	assert.Equal(t, Body{"value": json.Number("1")}, doc.Body())
+
+	doc, err = unmarshalDocumentWithLevel("doc1", data, DocUnmarshalAll)
+	require.NoError(t, err)
+	assert.Equal(t, "2-b", doc.CurrentRev)
+	assert.NotNil(t, doc._body)
+	assert.Equal(t, json.Number("1"), doc._body["value"])
+}
+
 func TestParseXattr(t *testing.T) {
 	zeroByte := byte(0)
 	// Build payload for single xattr pair and body
@@ -223,6 +246,92 @@ func TestParseXattr(t *testing.T) {
 	assert.True(t, emptyXattr == nil, "Nil xattr expected")
 }
 
+// makeXattrStreamData builds DCP mutation data holding the given body and xattr key/value pairs, in order.
+func makeXattrStreamData(body string, xattrs ...string) []byte {
+	var xattrBytes []byte
+	for i := 0; i+1 < len(xattrs); i += 2 {
+		pair := []byte(xattrs[i] + "\x00" + xattrs[i+1] + "\x00")
+		pairLength := make([]byte, 4)
+		binary.BigEndian.PutUint32(pairLength, uint32(len(pair)))
+		xattrBytes = append(xattrBytes, pairLength...)
+		xattrBytes = append(xattrBytes, pair...)
+	}
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint32(data, uint32(len(xattrBytes)))
+	data = append(data, xattrBytes...)
+	return append(data, body...)
+}
+
+func TestParseXattrCompositeUserXattr(t *testing.T) {
+	body := `{"value":"ABC"}`
+	data := makeXattrStreamData(body,
+		base.SyncXattrName, `{"seq":1}`,
+		"appMeta", `{"access": {"alice": ["ABC"]}, "audit": "ignored"}`,
+		"channelMeta", `["ABC", "DEF"]`,
+		"otherMeta", `{"ignored": true}`,
+	)
+
+	testCases := []struct {
+		name              string
+		userXattrKey      string
+		expectedUserXattr string
+	}{
+		{
+			name:              "single user xattr",
+			userXattrKey:      "channelMeta",
+			expectedUserXattr: `["ABC", "DEF"]`,
+		},
+		{
+			name:              "multiple user xattrs",
+			userXattrKey:      "channelMeta,otherMeta",
+			expectedUserXattr: `{"channelMeta":["ABC","DEF"],"otherMeta":{"ignored":true}}`,
+		},
+		{
+			name:              "nested path",
+			userXattrKey:      "appMeta.access",
+			expectedUserXattr: `{"appMeta":{"access":{"alice":["ABC"]}}}`,
+		},
+		{
+			name:              "nested path and user xattr",
+			userXattrKey:      "appMeta.access,channelMeta",
+			expectedUserXattr: `{"appMeta":{"access":{"alice":["ABC"]}},"channelMeta":["ABC","DEF"]}`,
+		},
+		{
+			name:              "missing keys omitted",
+			userXattrKey:      "appMeta.missing,channelMeta,missingMeta",
+			expectedUserXattr: `{"channelMeta":["ABC","DEF"]}`,
+		},
+		{
+			name:              "no keys present",
+			userXattrKey:      "appMeta.missing,missingMeta",
+			expectedUserXattr: ``,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resultBody, resultXattr, resultUserXattr, err := parseXattrStreamData(base.SyncXattrName, tc.userXattrKey, data)
+			require.NoError(t, err)
+			assert.Equal(t, body, string(resultBody))
+			assert.Equal(t, `{"seq":1}`, string(resultXattr))
+			assert.Equal(t, tc.expectedUserXattr, string(resultUserXattr))
+		})
+	}
+}
+
+func TestGetMetaMapCompositeUserXattr(t *testing.T) {
+	doc := &Document{rawUserXattr: []byte(`{"appMeta":{"access":{"alice":["ABC"]}}}`)}
+
+	metaMap, err := doc.GetMetaMap("appMeta.access,channelMeta")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		base.MetaMapXattrsKey: map[string]interface{}{
+			"appMeta":     map[string]interface{}{"access": map[string]interface{}{"alice": []interface{}{"ABC"}}},
+			"channelMeta": nil,
+		},
+	}, metaMap)
+}
+
 func TestParseDocumentCas(t *testing.T) {
 	syncData := &SyncData{}
 	syncData.Cas = "0x00002ade734fb714"
@@ -0,0 +1,46 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/couchbase/sync_gateway/auth"
+	"github.com/couchbase/sync_gateway/base"
+)
+
+// How often expired guest device users are removed, when guest sessions are enabled.
+const guestDeviceUserCleanupInterval = time.Hour
+
+// DeleteExpiredGuestDeviceUsers removes the guest device users that have expired since their device's most recent guest
+// session.  Returns the number of users removed.
+func (db *DatabaseContext) DeleteExpiredGuestDeviceUsers(ctx context.Context) (int, error) {
+	users, _, err := db.AllPrincipalIDs(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	authenticator := db.Authenticator(ctx)
+	removed := 0
+	for _, username := range users {
+		if !auth.IsGuestDeviceUserName(username) {
+			continue
+		}
+		deleted, err := authenticator.DeleteExpiredGuestDeviceUser(username)
+		if err != nil {
+			base.WarnfCtx(ctx, "Error removing expired guest device user %q: %v", base.UD(username), err)
+			continue
+		}
+		if deleted {
+			removed++
+		}
+	}
+	return removed, nil
+}
@@ -20,6 +20,7 @@ import (
 	sgbucket "github.com/couchbase/sg-bucket"
 	"github.com/couchbase/sync_gateway/base"
 	"github.com/couchbase/sync_gateway/channels"
+	"github.com/dop251/goja"
 	"github.com/robertkrimen/otto"
 )
 
@@ -33,6 +34,15 @@ const (
 // Imports a document that was written by someone other than sync gateway, given the existing state of the doc in raw bytes
 func (db *Database) ImportDocRaw(ctx context.Context, docid string, value []byte, xattrValue []byte, userXattrValue []byte, isDelete bool, cas uint64, expiry *uint32, mode ImportMode) (docOut *Document, err error) {
 
+	// A metadata-only import filter can exclude the doc before its body is unmarshalled
+	filterEvaluated := false
+	if db.Options.ImportOptions.ImportFilter != nil && db.Options.ImportOptions.ImportFilterMetadataOnly {
+		if err := db.evaluateImportFilter(ctx, docid, nil, isDelete, db.importFilterMeta(ctx, docid, userXattrValue, expiry, isDelete)); err != nil {
+			return nil, err
+		}
+		filterEvaluated = true
+	}
+
 	var body Body
 	if isDelete {
 		body = Body{}
@@ -57,7 +67,7 @@ func (db *Database) ImportDocRaw(ctx context.Context, docid string, value []byte
 		Cas:       cas,
 	}
 
-	return db.importDoc(ctx, docid, body, expiry, isDelete, existingBucketDoc, mode)
+	return db.importDoc(ctx, docid, body, expiry, isDelete, existingBucketDoc, mode, filterEvaluated)
 }
 
 // Import a document, given the existing state of the doc in *document format.
@@ -91,7 +101,76 @@ func (db *Database) ImportDoc(ctx context.Context, docid string, existingDoc *Do
 		return nil, err
 	}
 
-	return db.importDoc(ctx, docid, existingDoc.Body(), expiry, isDelete, existingBucketDoc, mode)
+	return db.importDoc(ctx, docid, existingDoc.Body(), expiry, isDelete, existingBucketDoc, mode, false)
+}
+
+// Outcomes of importing a doc via ImportDocs
+const (
+	ImportStatusImported        = "imported"         // The doc was imported
+	ImportStatusAlreadyImported = "already_imported" // The doc's current version was already imported, or written via Sync Gateway
+	ImportStatusFiltered        = "filtered"         // The doc was excluded by the import filter
+	ImportStatusNotFound        = "not_found"        // The doc doesn't exist
+	ImportStatusError           = "error"            // The import failed
+)
+
+// ImportDocResult is the outcome of importing a single doc via ImportDocs.
+type ImportDocResult struct {
+	DocID  string `json:"id"`
+	Status string `json:"status"`
+	RevID  string `json:"rev,omitempty"`   // The doc's current revision, if it's been imported
+	Error  string `json:"error,omitempty"` // Why the import failed, for ImportStatusError
+}
+
+// ImportDocs imports the given docs immediately, rather than waiting for the import feed to reach them, so that docs
+// written via Couchbase Server SDKs can be made available to mobile clients straight away.  Docs whose current
+// version has already been imported are left unchanged.  Requires shared bucket access.
+func (db *Database) ImportDocs(ctx context.Context, docIDs []string) []ImportDocResult {
+	results := make([]ImportDocResult, 0, len(docIDs))
+	for _, docID := range docIDs {
+		results = append(results, db.importDocByID(ctx, docID))
+	}
+	return results
+}
+
+// importDocByID imports the current version of the doc with the given ID, if it hasn't already been imported.
+func (db *Database) importDocByID(ctx context.Context, docID string) ImportDocResult {
+	result := ImportDocResult{DocID: docID}
+	key := realDocID(docID)
+	if key == "" {
+		result.Status = ImportStatusError
+		result.Error = "Invalid doc ID"
+		return result
+	}
+
+	doc, rawBucketDoc, err := db.GetDocWithXattr(key, DocUnmarshalSync)
+	if base.IsDocNotFoundError(err) {
+		result.Status = ImportStatusNotFound
+		return result
+	} else if err != nil {
+		result.Status = ImportStatusError
+		result.Error = err.Error()
+		return result
+	}
+
+	if isSGWrite, _, _ := doc.IsSGWrite(ctx, rawBucketDoc.Body); isSGWrite {
+		result.Status = ImportStatusAlreadyImported
+		result.RevID = doc.CurrentRev
+		return result
+	}
+
+	isDelete := rawBucketDoc.Body == nil
+	importedDoc, err := db.ImportDocRaw(ctx, docID, rawBucketDoc.Body, rawBucketDoc.Xattr, rawBucketDoc.UserXattr, isDelete, rawBucketDoc.Cas, nil, ImportOnDemand)
+	if err == base.ErrImportCancelledFilter {
+		result.Status = ImportStatusFiltered
+	} else if err != nil {
+		base.DebugfCtx(ctx, base.KeyImport, "Did not import doc %q on demand: %v", base.UD(docID), err)
+		result.Status = ImportStatusError
+		result.Error = err.Error()
+	} else {
+		result.Status = ImportStatusImported
+		result.RevID = importedDoc.CurrentRev
+	}
+	return result
 }
 
 // Import document
@@ -101,7 +180,8 @@ func (db *Database) ImportDoc(ctx context.Context, docid string, existingDoc *Do
 //	isDelete - whether the document to be imported is a delete
 //	existingDoc - bytes/cas/expiry of the  document to be imported (including xattr when available)
 //	mode - ImportMode - ImportFromFeed or ImportOnDemand
-func (db *Database) importDoc(ctx context.Context, docid string, body Body, expiry *uint32, isDelete bool, existingDoc *sgbucket.BucketDocument, mode ImportMode) (docOut *Document, err error) {
+//	filterEvaluated - whether the import filter has already included existingDoc
+func (db *Database) importDoc(ctx context.Context, docid string, body Body, expiry *uint32, isDelete bool, existingDoc *sgbucket.BucketDocument, mode ImportMode, filterEvaluated bool) (docOut *Document, err error) {
 
 	base.DebugfCtx(ctx, base.KeyImport, "Attempting to import doc %q...", base.UD(docid))
 	importStartTime := time.Now()
@@ -124,11 +204,12 @@ func (db *Database) importDoc(ctx context.Context, docid string, body Body, expi
 	var newRev string
 	var alreadyImportedDoc *Document
 
+	expiryConfig := db.Options.ImportOptions.Expiry
 	mutationOptions := sgbucket.MutateInOptions{}
-	if db.Bucket.IsSupported(sgbucket.DataStoreFeaturePreserveExpiry) {
+	if db.Bucket.IsSupported(sgbucket.DataStoreFeaturePreserveExpiry) && !expiryConfig.overridesExpiry() {
 		mutationOptions.PreserveExpiry = true
 	} else {
-		// Get the doc expiry if it wasn't passed in and preserve expiry is not supported
+		// Get the doc expiry if it wasn't passed in, as preserve expiry is not supported or the expiry is being replaced
 		if expiry == nil {
 			cbStore, _ := base.AsCouchbaseStore(db.Bucket)
 			getExpiry, getExpiryErr := cbStore.GetExpiry(docid)
@@ -137,7 +218,7 @@ func (db *Database) importDoc(ctx context.Context, docid string, body Body, expi
 			}
 			expiry = &getExpiry
 		}
-		existingDoc.Expiry = *expiry
+		existingDoc.Expiry = expiryConfig.importExpiry(*expiry, time.Now())
 	}
 
 	docOut, _, err = db.updateAndReturnDoc(ctx, newDoc.ID, true, existingDoc.Expiry, &mutationOptions, existingDoc, func(doc *Document) (resultDocument *Document, resultAttachmentData AttachmentData, createNewRevIDSkipped bool, updatedExpiry *uint32, resultErr error) {
@@ -159,16 +240,19 @@ func (db *Database) importDoc(ctx context.Context, docid string, body Body, expi
 				existingDoc = &sgbucket.BucketDocument{
 					Cas: doc.Cas,
 				}
+				filterEvaluated = false
 
 				if !mutationOptions.PreserveExpiry {
-					// Reload the doc expiry if GoCB is not preserving expiry
+					// Reload the doc expiry if GoCB is not preserving expiry, or the expiry is being replaced
 					cbStore, _ := base.AsCouchbaseStore(db.Bucket)
-					expiry, getExpiryErr := cbStore.GetExpiry(newDoc.ID)
+					reloadedExpiry, getExpiryErr := cbStore.GetExpiry(newDoc.ID)
 					if getExpiryErr != nil {
 						return nil, nil, false, nil, getExpiryErr
 					}
-					existingDoc.Expiry = expiry
-					updatedExpiry = &expiry
+					expiry = &reloadedExpiry
+					importExpiry := expiryConfig.importExpiry(reloadedExpiry, time.Now())
+					existingDoc.Expiry = importExpiry
+					updatedExpiry = &importExpiry
 				}
 
 				if doc.inlineSyncData {
@@ -230,30 +314,10 @@ func (db *Database) importDoc(ctx context.Context, docid string, body Body, expi
 		}
 
 		// If there's a filter function defined, evaluate to determine whether we should import this doc
-		if db.DatabaseContext.Options.ImportOptions.ImportFilter != nil {
-			var shouldImport bool
-			var importErr error
-
-			if isDelete && body == nil {
-				deleteBody := Body{BodyDeleted: true}
-				shouldImport, importErr = db.DatabaseContext.Options.ImportOptions.ImportFilter.EvaluateFunction(ctx, deleteBody)
-			} else if isDelete && body != nil {
-				deleteBody := body.ShallowCopy()
-				deleteBody[BodyDeleted] = true
-				shouldImport, importErr = db.DatabaseContext.Options.ImportOptions.ImportFilter.EvaluateFunction(ctx, deleteBody)
-			} else {
-				shouldImport, importErr = db.DatabaseContext.Options.ImportOptions.ImportFilter.EvaluateFunction(ctx, body)
-			}
-
-			if importErr != nil {
-				base.DebugfCtx(ctx, base.KeyImport, "Error returned for doc %s while evaluating import function - will not be imported.", base.UD(docid))
-				return nil, nil, false, updatedExpiry, base.ErrImportCancelledFilter
-			}
-			if !shouldImport {
-				base.DebugfCtx(ctx, base.KeyImport, "Doc %s excluded by document import function - will not be imported.", base.UD(docid))
-				// TODO: If this document has a current revision (this is a document that was previously mobile-enabled), do additional opt-out processing
-				// pending https://github.com/couchbase/sync_gateway/issues/2750
-				return nil, nil, false, updatedExpiry, base.ErrImportCancelledFilter
+		if db.DatabaseContext.Options.ImportOptions.ImportFilter != nil && !filterEvaluated {
+			meta := db.importFilterMeta(ctx, docid, existingDoc.UserXattr, expiry, isDelete)
+			if err := db.evaluateImportFilter(ctx, docid, body, isDelete, meta); err != nil {
+				return nil, nil, false, updatedExpiry, err
 			}
 		}
 
@@ -329,8 +393,12 @@ func (db *Database) importDoc(ctx context.Context, docid string, body Body, expi
 		docOut = alreadyImportedDoc
 	case nil:
 		db.DbStats.SharedBucketImport().ImportCount.Add(1)
+		db.CollectionStats.ImportCount.Add(1)
 		db.DbStats.SharedBucketImport().ImportHighSeq.Set(int64(docOut.SyncData.Sequence))
 		db.DbStats.SharedBucketImport().ImportProcessingTime.Add(time.Since(importStartTime).Nanoseconds())
+		if expiry != nil && *expiry != 0 {
+			db.DbStats.SharedBucketImport().ImportWithExpiryCount.Add(1)
+		}
 		base.DebugfCtx(ctx, base.KeyImport, "Imported %s (delete=%v) as rev %s", base.UD(newDoc.ID), isDelete, newRev)
 	case base.ErrImportCancelled:
 		// Import was cancelled (SG purge) - don't return error.
@@ -443,6 +511,61 @@ func (db *Database) backupPreImportRevision(ctx context.Context, docid, revid st
 	return nil
 }
 
+// evaluateImportFilter runs the import filter on a doc being imported, given its body and the metadata returned by
+// importFilterMeta.  Deletions are passed to the filter with _deleted set, unless the filter is metadata-only, in which
+// case it's passed a null body.  Returns base.ErrImportCancelledFilter if the doc shouldn't be imported.
+func (db *Database) evaluateImportFilter(ctx context.Context, docid string, body Body, isDelete bool, meta map[string]interface{}) error {
+	var filterDoc interface{}
+	if !db.Options.ImportOptions.ImportFilterMetadataOnly {
+		if isDelete && body == nil {
+			filterDoc = Body{BodyDeleted: true}
+		} else if isDelete && body != nil {
+			deleteBody := body.ShallowCopy()
+			deleteBody[BodyDeleted] = true
+			filterDoc = deleteBody
+		} else {
+			filterDoc = body
+		}
+	}
+
+	shouldImport, importErr := db.Options.ImportOptions.ImportFilter.EvaluateFunctionWithMeta(ctx, filterDoc, meta)
+	if importErr != nil {
+		base.DebugfCtx(ctx, base.KeyImport, "Error returned for doc %s while evaluating import function - will not be imported.", base.UD(docid))
+		return base.ErrImportCancelledFilter
+	}
+	if !shouldImport {
+		base.DebugfCtx(ctx, base.KeyImport, "Doc %s excluded by document import function - will not be imported.", base.UD(docid))
+		// TODO: If this document has a current revision (this is a document that was previously mobile-enabled), do additional opt-out processing
+		// pending https://github.com/couchbase/sync_gateway/issues/2750
+		return base.ErrImportCancelledFilter
+	}
+	return nil
+}
+
+// importFilterMeta returns the metadata of a doc being imported, which is passed to the import filter as its second
+// argument: an object of the form {xattrs: {...}, expiry: ..., deleted: ...}.  xattrs holds the doc's user xattrs,
+// keyed by xattr name, if the database has a user xattr key.  expiry is omitted if it isn't known.
+func (db *Database) importFilterMeta(ctx context.Context, docid string, rawUserXattr []byte, expiry *uint32, isDelete bool) map[string]interface{} {
+	xattrs := map[string]interface{}{}
+	if db.Options.UserXattrKey != "" && len(rawUserXattr) > 0 {
+		var userXattr interface{}
+		if err := base.JSONUnmarshal(rawUserXattr, &userXattr); err != nil {
+			base.WarnfCtx(ctx, "Unable to unmarshal user xattr of doc %q for import filter: %v", base.UD(docid), err)
+		} else {
+			addUserXattrToMeta(xattrs, db.Options.UserXattrKey, userXattr)
+		}
+	}
+
+	meta := map[string]interface{}{
+		"xattrs":  xattrs,
+		"deleted": isDelete,
+	}
+	if expiry != nil {
+		meta["expiry"] = *expiry
+	}
+	return meta
+}
+
 // ////// Import Filter Function
 
 // A compiled JavaScript event function.
@@ -471,18 +594,44 @@ func newImportFilterRunner(funcSource string, timeout time.Duration) (sgbucket.J
 	return importFilterRunner, nil
 }
 
+// Compiles a JavaScript import filter function to a base.GojaRunner, which supports ES2020 syntax.
+func newGojaImportFilterRunner(funcSource string, timeout time.Duration) (sgbucket.JSServerTask, error) {
+	importFilterRunner := &base.GojaRunner{}
+	err := importFilterRunner.InitWithLogging(funcSource, timeout,
+		func(s string) {
+			base.ErrorfCtx(context.Background(), base.KeyJavascript.String()+": Import %s", base.UD(s))
+		},
+		func(s string) { base.InfofCtx(context.Background(), base.KeyJavascript, "Import %s", base.UD(s)) })
+	if err != nil {
+		return nil, err
+	}
+
+	importFilterRunner.After = func(result goja.Value, err error) (interface{}, error) {
+		return result.Export(), err
+	}
+
+	return importFilterRunner, nil
+}
+
 type ImportFilterFunction struct {
 	*sgbucket.JSServer
 }
 
 func NewImportFilterFunction(fnSource string, timeout time.Duration) *ImportFilterFunction {
+	return NewImportFilterFunctionWithEngine(base.JSEngineOtto, fnSource, timeout)
+}
+
+// NewImportFilterFunctionWithEngine returns an ImportFilterFunction that runs the import filter using the given
+// JavaScript engine, either base.JSEngineOtto or base.JSEngineGoja.
+func NewImportFilterFunctionWithEngine(engine string, fnSource string, timeout time.Duration) *ImportFilterFunction {
 
 	base.DebugfCtx(context.Background(), base.KeyImport, "Creating new ImportFilterFunction")
+	newTask := newImportFilterRunner
+	if engine == base.JSEngineGoja {
+		newTask = newGojaImportFilterRunner
+	}
 	return &ImportFilterFunction{
-		JSServer: sgbucket.NewJSServer(fnSource, timeout, kTaskCacheSize,
-			func(fnSource string, timeout time.Duration) (sgbucket.JSServerTask, error) {
-				return newImportFilterRunner(fnSource, timeout)
-			}),
+		JSServer: sgbucket.NewJSServer(fnSource, timeout, kTaskCacheSize, newTask),
 	}
 }
 
@@ -490,6 +639,18 @@ func NewImportFilterFunction(fnSource string, timeout time.Duration) *ImportFilt
 func (i *ImportFilterFunction) EvaluateFunction(ctx context.Context, doc Body) (bool, error) {
 
 	result, err := i.Call(doc)
+	return importFilterResultToBool(ctx, doc, result, err)
+}
+
+// EvaluateFunctionWithMeta calls the import filter with the doc, or nil for a metadata-only filter, and the doc's
+// metadata as returned by importFilterMeta.
+func (i *ImportFilterFunction) EvaluateFunctionWithMeta(ctx context.Context, doc interface{}, meta map[string]interface{}) (bool, error) {
+	result, err := i.Call(doc, meta)
+	return importFilterResultToBool(ctx, doc, result, err)
+}
+
+// importFilterResultToBool converts the result of calling the import filter to whether the doc should be imported.
+func importFilterResultToBool(ctx context.Context, doc interface{}, result interface{}, err error) (bool, error) {
 	if err != nil {
 		base.WarnfCtx(ctx, "Unexpected error invoking import filter for document %s - processing aborted, document will not be imported.  Error: %v", base.UD(doc), err)
 		return false, err
@@ -0,0 +1,124 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	sgbucket "github.com/couchbase/sg-bucket"
+	"github.com/couchbase/sync_gateway/base"
+)
+
+// Import conflict strategies, which decide whether an SDK write that collides with a Sync Gateway write is imported.
+const (
+	ImportConflictPreferSDK = "prefer_sdk" // Import the SDK write, so the Sync Gateway write fails if it doesn't descend from it
+	ImportConflictPreferSG  = "prefer_sg"  // Discard the SDK write, so the Sync Gateway write replaces it
+	ImportConflictCustom    = "custom"     // A JavaScript resolver decides whether to import the SDK write
+)
+
+// Results returned by a custom import conflict resolver
+const (
+	importConflictResolverSDK = "sdk"
+	importConflictResolverSG  = "sg"
+)
+
+// ImportConflictConfig configures how an SDK write that collides with a Sync Gateway write is handled.  An SDK write
+// collides with a Sync Gateway write when it updates a doc that has a Sync Gateway revision, and hasn't been imported
+// by the time Sync Gateway next writes the doc.  By default the SDK write is imported first, so the Sync Gateway write
+// is rejected as a conflict unless it descends from the imported revision.
+type ImportConflictConfig struct {
+	Strategy string `json:"strategy,omitempty"` // One of ImportConflictPreferSDK, ImportConflictPreferSG or ImportConflictCustom
+	Resolver string `json:"resolver,omitempty"` // For ImportConflictCustom, function(sdkDoc, sgDoc) returning "sdk" or "sg"
+}
+
+// Validate ensures the config's settings are valid.
+func (c *ImportConflictConfig) Validate() error {
+	switch c.Strategy {
+	case "", ImportConflictPreferSDK, ImportConflictPreferSG:
+		if c.Resolver != "" {
+			return fmt.Errorf("resolver is only supported by strategy %q", ImportConflictCustom)
+		}
+	case ImportConflictCustom:
+		if c.Resolver == "" {
+			return fmt.Errorf("strategy %q requires a resolver", ImportConflictCustom)
+		}
+	default:
+		return fmt.Errorf("unknown strategy %q - must be one of %q, %q or %q", c.Strategy, ImportConflictPreferSDK, ImportConflictPreferSG, ImportConflictCustom)
+	}
+	return nil
+}
+
+// ImportConflictResolverFunction is a custom import conflict resolver, which is passed the bodies of the SDK write and
+// the Sync Gateway write, and returns "sdk" to import the SDK write or "sg" to discard it.
+type ImportConflictResolverFunction struct {
+	*sgbucket.JSServer
+}
+
+// NewImportConflictResolverFunction returns an ImportConflictResolverFunction that runs the resolver using the given
+// JavaScript engine, either base.JSEngineOtto or base.JSEngineGoja.
+func NewImportConflictResolverFunction(engine string, fnSource string, timeout time.Duration) *ImportConflictResolverFunction {
+	newTask := newImportFilterRunner
+	if engine == base.JSEngineGoja {
+		newTask = newGojaImportFilterRunner
+	}
+	return &ImportConflictResolverFunction{
+		JSServer: sgbucket.NewJSServer(fnSource, timeout, kTaskCacheSize, newTask),
+	}
+}
+
+// Resolve calls the resolver, returning whether the SDK write should be imported.
+func (f *ImportConflictResolverFunction) Resolve(sdkDoc, sgDoc Body) (importSDKWrite bool, err error) {
+	result, err := f.Call(sdkDoc, sgDoc)
+	if err != nil {
+		return false, err
+	}
+	switch result {
+	case importConflictResolverSDK:
+		return true, nil
+	case importConflictResolverSG:
+		return false, nil
+	default:
+		return false, fmt.Errorf("import conflict resolver returned %v - must return %q or %q", result, importConflictResolverSDK, importConflictResolverSG)
+	}
+}
+
+// importSDKWriteOnConflict returns whether an SDK write to a doc that has a Sync Gateway revision should be imported
+// before the given Sync Gateway write is made, according to the database's import conflict strategy.  A custom resolver
+// that fails falls back to importing the SDK write.
+func (db *Database) importSDKWriteOnConflict(ctx context.Context, docid string, sdkDoc *Document, sgBody Body) bool {
+	stats := db.DbStats.SharedBucketImport()
+	strategy := ImportConflictPreferSDK
+	if db.Options.ImportOptions.Conflict != nil && db.Options.ImportOptions.Conflict.Strategy != "" {
+		strategy = db.Options.ImportOptions.Conflict.Strategy
+	}
+
+	importSDKWrite := true
+	switch strategy {
+	case ImportConflictPreferSG:
+		importSDKWrite = false
+	case ImportConflictCustom:
+		stats.ImportConflictCustomCount.Add(1)
+		var err error
+		importSDKWrite, err = db.Options.ImportOptions.ConflictResolver.Resolve(sdkDoc.Body(), sgBody)
+		if err != nil {
+			base.WarnfCtx(ctx, "Error running import conflict resolver for doc %q - importing SDK write: %v", base.UD(docid), err)
+			importSDKWrite = true
+		}
+	}
+
+	if importSDKWrite {
+		stats.ImportConflictPreferSDKCount.Add(1)
+	} else {
+		base.DebugfCtx(ctx, base.KeyImport, "Discarding SDK write to doc %q in favour of Sync Gateway write, due to import conflict strategy %q", base.UD(docid), strategy)
+		stats.ImportConflictPreferSGCount.Add(1)
+	}
+	return importSDKWrite
+}
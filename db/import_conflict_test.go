@@ -0,0 +1,65 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package db
+
+import (
+	"testing"
+
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportConflictResolverFunction(t *testing.T) {
+	for _, engine := range []string{base.JSEngineOtto, base.JSEngineGoja} {
+		t.Run(engine, func(t *testing.T) {
+			resolver := NewImportConflictResolverFunction(engine, `function(sdkDoc, sgDoc) {
+				if (sgDoc.priority > sdkDoc.priority) {
+					return "sg";
+				} else if (sgDoc.priority == sdkDoc.priority) {
+					return "neither";
+				}
+				return "sdk";
+			}`, 0)
+
+			importSDKWrite, err := resolver.Resolve(Body{"priority": 1}, Body{"priority": 2})
+			require.NoError(t, err)
+			assert.False(t, importSDKWrite)
+
+			importSDKWrite, err = resolver.Resolve(Body{"priority": 2}, Body{"priority": 1})
+			require.NoError(t, err)
+			assert.True(t, importSDKWrite)
+
+			_, err = resolver.Resolve(Body{"priority": 1}, Body{"priority": 1})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestImportConflictConfigValidate(t *testing.T) {
+	testCases := []struct {
+		config        ImportConflictConfig
+		expectedError string
+	}{
+		{config: ImportConflictConfig{}},
+		{config: ImportConflictConfig{Strategy: ImportConflictPreferSG}},
+		{config: ImportConflictConfig{Strategy: ImportConflictCustom, Resolver: `function(sdkDoc, sgDoc) { return "sg"; }`}},
+		{config: ImportConflictConfig{Strategy: ImportConflictCustom}, expectedError: `strategy "custom" requires a resolver`},
+		{config: ImportConflictConfig{Strategy: ImportConflictPreferSDK, Resolver: "function() {}"}, expectedError: `resolver is only supported by strategy "custom"`},
+		{config: ImportConflictConfig{Strategy: "prefer_newest"}, expectedError: `unknown strategy "prefer_newest"`},
+	}
+	for _, testCase := range testCases {
+		err := testCase.config.Validate()
+		if testCase.expectedError == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.ErrorContains(t, err, testCase.expectedError)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+// Import expiry modes, which decide the expiry of an imported document that was written with an expiry via the SDK.
+const (
+	ImportExpiryPreserve = "preserve" // Keep the doc's expiry
+	ImportExpiryClear    = "clear"    // Remove the doc's expiry, so the imported doc doesn't expire
+	ImportExpiryExtend   = "extend"   // Push the doc's expiry out to at least extend_secs after the import
+)
+
+// ImportExpiryConfig configures how the expiry of a document written via the SDK is handled when it's imported.  Only
+// docs with an expiry are affected - by default, their expiry is preserved.
+type ImportExpiryConfig struct {
+	Mode       string  `json:"mode,omitempty"`        // One of ImportExpiryPreserve, ImportExpiryClear or ImportExpiryExtend
+	ExtendSecs *uint32 `json:"extend_secs,omitempty"` // For ImportExpiryExtend, the minimum time until an imported doc expires
+}
+
+// Validate ensures the config's settings are valid.
+func (c *ImportExpiryConfig) Validate() error {
+	switch c.Mode {
+	case "", ImportExpiryPreserve, ImportExpiryClear:
+		if c.ExtendSecs != nil {
+			return fmt.Errorf("extend_secs is only supported by mode %q", ImportExpiryExtend)
+		}
+	case ImportExpiryExtend:
+		if c.ExtendSecs == nil || *c.ExtendSecs == 0 {
+			return fmt.Errorf("mode %q requires a non-zero extend_secs", ImportExpiryExtend)
+		}
+	default:
+		return fmt.Errorf("unknown mode %q - must be one of %q, %q or %q", c.Mode, ImportExpiryPreserve, ImportExpiryClear, ImportExpiryExtend)
+	}
+	return nil
+}
+
+// overridesExpiry returns true if docs are imported with a different expiry to the one they had.
+func (c *ImportExpiryConfig) overridesExpiry() bool {
+	return c != nil && (c.Mode == ImportExpiryClear || c.Mode == ImportExpiryExtend)
+}
+
+// importExpiry returns the expiry to import a doc with, given the doc's absolute expiry (zero for no expiry).
+func (c *ImportExpiryConfig) importExpiry(expiry uint32, now time.Time) uint32 {
+	if expiry == 0 || !c.overridesExpiry() {
+		return expiry
+	}
+	if c.Mode == ImportExpiryClear {
+		return 0
+	}
+	if extended := uint32(now.Unix()) + *c.ExtendSecs; extended > expiry {
+		return extended
+	}
+	return expiry
+}
@@ -0,0 +1,66 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportExpiryConfigValidate(t *testing.T) {
+	testCases := []struct {
+		config        ImportExpiryConfig
+		expectedError string
+	}{
+		{config: ImportExpiryConfig{}},
+		{config: ImportExpiryConfig{Mode: ImportExpiryPreserve}},
+		{config: ImportExpiryConfig{Mode: ImportExpiryClear}},
+		{config: ImportExpiryConfig{Mode: ImportExpiryExtend, ExtendSecs: base.Uint32Ptr(3600)}},
+		{config: ImportExpiryConfig{Mode: ImportExpiryExtend}, expectedError: `mode "extend" requires a non-zero extend_secs`},
+		{config: ImportExpiryConfig{Mode: ImportExpiryExtend, ExtendSecs: base.Uint32Ptr(0)}, expectedError: `mode "extend" requires a non-zero extend_secs`},
+		{config: ImportExpiryConfig{Mode: ImportExpiryClear, ExtendSecs: base.Uint32Ptr(3600)}, expectedError: `extend_secs is only supported by mode "extend"`},
+		{config: ImportExpiryConfig{Mode: "reset"}, expectedError: `unknown mode "reset"`},
+	}
+	for _, testCase := range testCases {
+		err := testCase.config.Validate()
+		if testCase.expectedError == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.ErrorContains(t, err, testCase.expectedError)
+		}
+	}
+}
+
+func TestImportExpiryConfigImportExpiry(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	nowExpiry := uint32(now.Unix())
+
+	var nilConfig *ImportExpiryConfig
+	assert.Equal(t, nowExpiry+10, nilConfig.importExpiry(nowExpiry+10, now))
+	assert.Equal(t, uint32(0), nilConfig.importExpiry(0, now))
+
+	preserve := &ImportExpiryConfig{Mode: ImportExpiryPreserve}
+	assert.False(t, preserve.overridesExpiry())
+	assert.Equal(t, nowExpiry+10, preserve.importExpiry(nowExpiry+10, now))
+
+	clearConfig := &ImportExpiryConfig{Mode: ImportExpiryClear}
+	assert.True(t, clearConfig.overridesExpiry())
+	assert.Equal(t, uint32(0), clearConfig.importExpiry(nowExpiry+10, now))
+	assert.Equal(t, uint32(0), clearConfig.importExpiry(0, now))
+
+	extend := &ImportExpiryConfig{Mode: ImportExpiryExtend, ExtendSecs: base.Uint32Ptr(3600)}
+	assert.True(t, extend.overridesExpiry())
+	// Expiries sooner than extend_secs are pushed out, later expiries are kept, and docs without an expiry don't get one
+	assert.Equal(t, nowExpiry+3600, extend.importExpiry(nowExpiry+10, now))
+	assert.Equal(t, nowExpiry+7200, extend.importExpiry(nowExpiry+7200, now))
+	assert.Equal(t, uint32(0), extend.importExpiry(0, now))
+}
@@ -32,6 +32,8 @@ type importListener struct {
 	cbgtContext      *base.CbgtContext             // Handle to cbgt manager,cfg
 	checkpointPrefix string                        // DCP checkpoint key prefix
 	loggingCtx       context.Context               // ctx for logging on event callbacks
+	throttle         *importThrottle               // Limits the rate of imports, nil if not configured
+	chaos            *base.FeedChaos               // Test only - holds back or discards feed events, nil unless set in DatabaseContextOptions
 }
 
 func NewImportListener(groupID string) *importListener {
@@ -52,6 +54,10 @@ func (il *importListener) StartImportFeed(ctx context.Context, bucket base.Bucke
 	il.collections = make(map[uint32]Database)
 	il.dbStats = dbStats.Database()
 	il.importStats = dbStats.SharedBucketImport()
+	il.chaos = dbContext.Options.ImportFeedChaos
+	if throttleConfig := dbContext.Options.ImportOptions.Throttle; throttleConfig != nil {
+		il.throttle = newImportThrottle(*throttleConfig, dbContext.importUnderPressure, il.importStats)
+	}
 
 	collectionNamesByScope := make(map[string][]string)
 	var scopeName string
@@ -75,6 +81,11 @@ func (il *importListener) StartImportFeed(ctx context.Context, bucket base.Bucke
 
 		collectionNamesByScope[scopeName] = make([]string, 0, len(dbContext.Scopes[scopeName].Collections))
 		for collName, collCtx := range dbContext.Scopes[scopeName].Collections {
+			// Collections with import disabled are left out of the feed
+			if !dbContext.Options.Scopes[scopeName].Collections[collName].ImportEnabled {
+				base.InfofCtx(ctx, base.KeyImport, "Import disabled for collection %s.%s", base.MD(scopeName), base.MD(collName))
+				continue
+			}
 			collectionNamesByScope[scopeName] = append(collectionNamesByScope[scopeName], collName)
 
 			collID, ok := base.GetIDForCollection(collectionManifest, scopeName, collName)
@@ -130,6 +141,11 @@ func (il *importListener) StartImportFeed(ctx context.Context, bucket base.Bucke
 // internal documents based on key, then checks sync metadata to determine whether document needs to be imported
 func (il *importListener) ProcessFeedEvent(event sgbucket.FeedEvent) (shouldPersistCheckpoint bool) {
 
+	// Discarded events don't advance the checkpoint, so that they're seen again when the feed restarts
+	if il.chaos != nil && !il.chaos.Deliver() {
+		return false
+	}
+
 	// Ignore non-mutation/deletion events
 	if event.Opcode != sgbucket.FeedOpMutation && event.Opcode != sgbucket.FeedOpDeletion {
 		return true
@@ -202,6 +218,14 @@ func (il *importListener) ImportFeedEvent(event sgbucket.FeedEvent) {
 		default:
 		}
 
+		if il.throttle != nil {
+			if !il.throttle.acquire(il.terminator) {
+				base.InfofCtx(il.loggingCtx, base.KeyImport, "Aborting import for doc %q - importListener.terminator was closed", base.UD(docID))
+				return
+			}
+			defer il.throttle.release()
+		}
+
 		_, err := collectionCtx.ImportDocRaw(il.loggingCtx, docID, rawBody, rawXattr, rawUserXattr, isDelete, event.Cas, &event.Expiry, ImportFromFeed)
 		if err != nil {
 			if err == base.ErrImportCasFailure {
@@ -219,6 +243,10 @@ func (il *importListener) Stop() {
 	if il != nil {
 		if il.cbgtContext != nil {
 			il.cbgtContext.StopHeartbeatListener()
+			il.cbgtContext.StopImportPartitionsWatcher()
+
+			// Leave the cfg before closing PIndexes, so that other nodes take over this node's partitions straight away
+			il.cbgtContext.UnregisterLocalNode(il.loggingCtx)
 
 			// Close open PIndexes before stopping the manager.
 			_, pindexes := il.cbgtContext.Manager.CurrentMaps()
@@ -240,3 +268,21 @@ func (il *importListener) Stop() {
 		close(il.terminator)
 	}
 }
+
+// ImportPartitions returns the assignment of the database's import partitions to nodes.  Returns base.ErrNotFound if
+// this node isn't running a sharded import feed for the database.
+func (context *DatabaseContext) ImportPartitions() (*base.ImportPartitionsStatus, error) {
+	if context.ImportListener == nil || context.ImportListener.cbgtContext == nil {
+		return nil, base.ErrNotFound
+	}
+	return context.ImportListener.cbgtContext.ImportPartitions()
+}
+
+// UpdateImportPartitions updates the node weights and partition pins used to assign the database's import partitions to
+// nodes.  Returns base.ErrNotFound if this node isn't running a sharded import feed for the database.
+func (context *DatabaseContext) UpdateImportPartitions(ctx context.Context, update base.ImportPartitionsConfig) error {
+	if context.ImportListener == nil || context.ImportListener.cbgtContext == nil {
+		return base.ErrNotFound
+	}
+	return context.ImportListener.cbgtContext.UpdateImportPartitions(ctx, update)
+}
@@ -95,8 +95,6 @@ func (il *importListener) NewImportDest() (cbgt.Dest, error) {
 	}
 
 	importFeedStatsMap := il.dbStats.ImportFeedMapStats
-	importPartitionStat := il.importStats.ImportPartitions
-
-	importDest, _ := base.NewDCPDest(il.loggingCtx, callback, il.metaStore, maxVbNo, true, importFeedStatsMap.Map, base.DCPImportFeedID, importPartitionStat, il.checkpointPrefix)
+	importDest, _ := base.NewDCPDest(il.loggingCtx, callback, il.metaStore, maxVbNo, true, importFeedStatsMap.Map, base.DCPImportFeedID, il.importStats, il.checkpointPrefix)
 	return importDest, nil
 }
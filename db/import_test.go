@@ -177,7 +177,7 @@ func TestImportWithStaleBucketDocCorrectExpiry(t *testing.T) {
 			require.NoError(t, err)
 
 			// Import the doc (will migrate as part of the import since the doc contains sync meta)
-			_, errImportDoc := db.importDoc(ctx, key, body, &expiry, false, existingBucketDoc, ImportOnDemand)
+			_, errImportDoc := db.importDoc(ctx, key, body, &expiry, false, existingBucketDoc, ImportOnDemand, false)
 			assert.NoError(t, errImportDoc, "Unexpected error")
 
 			// Make sure the doc in the bucket has expected XATTR
@@ -326,7 +326,7 @@ func TestImportWithCasFailureUpdate(t *testing.T) {
 			runOnce = true
 
 			// Trigger import
-			_, err = db.importDoc(ctx, testcase.docname, bodyD, nil, false, existingBucketDoc, ImportOnDemand)
+			_, err = db.importDoc(ctx, testcase.docname, bodyD, nil, false, existingBucketDoc, ImportOnDemand, false)
 			assert.NoError(t, err)
 
 			// Check document has the rev and new body
@@ -394,7 +394,7 @@ func TestImportNullDoc(t *testing.T) {
 	existingDoc := &sgbucket.BucketDocument{Body: rawNull, Cas: 1}
 
 	// Import a null document
-	importedDoc, err := db.importDoc(ctx, key+"1", body, nil, false, existingDoc, ImportOnDemand)
+	importedDoc, err := db.importDoc(ctx, key+"1", body, nil, false, existingDoc, ImportOnDemand, false)
 	assert.Equal(t, base.ErrEmptyDocument, err)
 	assert.True(t, importedDoc == nil, "Expected no imported doc")
 }
@@ -477,3 +477,54 @@ func TestEvaluateFunction(t *testing.T) {
 	assert.Error(t, err, `strconv.ParseBool: parsing "TruE": invalid syntax`)
 	assert.False(t, result, "Import filter function should return true")
 }
+
+func TestEvaluateFunctionWithMeta(t *testing.T) {
+	base.SetUpTestLogging(t, base.LevelInfo, base.KeyImport)
+	db, ctx := setupTestDB(t)
+	defer db.Close(ctx)
+	db.Options.UserXattrKey = "channels"
+
+	source := `function(doc, meta) { return doc.type == "mobile" && meta.xattrs.channels == "ABC" && meta.expiry == 10 && !meta.deleted; }`
+	importFilterFunc := NewImportFilterFunction(source, 0)
+	expiry := uint32(10)
+
+	meta := db.importFilterMeta(ctx, "doc1", []byte(`"ABC"`), &expiry, false)
+	result, err := importFilterFunc.EvaluateFunctionWithMeta(ctx, Body{"type": "mobile"}, meta)
+	require.NoError(t, err)
+	assert.True(t, result)
+
+	meta = db.importFilterMeta(ctx, "doc1", []byte(`"DEF"`), &expiry, false)
+	result, err = importFilterFunc.EvaluateFunctionWithMeta(ctx, Body{"type": "mobile"}, meta)
+	require.NoError(t, err)
+	assert.False(t, result)
+
+	meta = db.importFilterMeta(ctx, "doc1", []byte(`"ABC"`), &expiry, true)
+	result, err = importFilterFunc.EvaluateFunctionWithMeta(ctx, Body{"type": "mobile"}, meta)
+	require.NoError(t, err)
+	assert.False(t, result)
+
+	// Expiry is omitted when not known
+	meta = db.importFilterMeta(ctx, "doc1", []byte(`"ABC"`), nil, false)
+	assert.NotContains(t, meta, "expiry")
+}
+
+func TestImportFilterMetadataOnly(t *testing.T) {
+	base.SetUpTestLogging(t, base.LevelInfo, base.KeyImport)
+	db, ctx := setupTestDB(t)
+	defer db.Close(ctx)
+	db.Options.UserXattrKey = "import"
+	db.Options.ImportOptions.ImportFilterMetadataOnly = true
+	db.Options.ImportOptions.ImportFilter = NewImportFilterFunction(`function(doc, meta) { return doc === null && meta.xattrs.import === true; }`, 0)
+
+	// The body isn't valid JSON, but is excluded by the filter before being unmarshalled
+	exp := uint32(0)
+	importedDoc, err := db.ImportDocRaw(ctx, "TestImportFilterMetadataOnly", []byte("{invalid"), []byte("{}"), []byte("false"), false, 1, &exp, ImportFromFeed)
+	assert.Equal(t, base.ErrImportCancelledFilter, err)
+	assert.Nil(t, importedDoc)
+
+	// Docs included by the filter are still unmarshalled as usual
+	importedDoc, err = db.ImportDocRaw(ctx, "TestImportFilterMetadataOnly", []byte("{invalid"), []byte("{}"), []byte("true"), false, 1, &exp, ImportFromFeed)
+	assert.Error(t, err)
+	assert.NotEqual(t, base.ErrImportCancelledFilter, err)
+	assert.Nil(t, importedDoc)
+}
@@ -0,0 +1,178 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package db
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/couchbase/sync_gateway/base"
+)
+
+const (
+	importLowPriorityPollInterval = 10 * time.Millisecond // How often a low priority import checks whether it can proceed
+	importLowPriorityMaxWait      = time.Second           // Max time a low priority import yields, so the import feed can't stall
+)
+
+// ImportThrottleConfig limits the rate at which the import feed imports documents, so that a burst of writes made via
+// Couchbase Server SDKs doesn't degrade the latency of the REST and BLIP APIs.  Throttled imports hold up the import
+// feed, which resumes from the DCP stream once they've been processed.
+type ImportThrottleConfig struct {
+	MaxConcurrent int     `json:"max_concurrent,omitempty"` // Max imports in progress at once - 0 for no limit
+	MaxPerSecond  float64 `json:"max_per_second,omitempty"` // Max imports started per second, on average - 0 for no limit
+	Burst         int     `json:"burst,omitempty"`          // Max imports started at once when under max_per_second - defaults to 1
+	LowPriority   bool    `json:"low_priority,omitempty"`   // Delay imports while API writes are in progress, or the change cache is backed up
+}
+
+// Validate ensures the config's settings are valid.
+func (c *ImportThrottleConfig) Validate() error {
+	if c.MaxConcurrent < 0 {
+		return fmt.Errorf("max_concurrent must not be negative")
+	}
+	if c.MaxPerSecond < 0 {
+		return fmt.Errorf("max_per_second must not be negative")
+	}
+	if c.Burst < 0 {
+		return fmt.Errorf("burst must not be negative")
+	}
+	if c.Burst > 0 && c.MaxPerSecond == 0 {
+		return fmt.Errorf("burst requires max_per_second")
+	}
+	return nil
+}
+
+func (c *ImportThrottleConfig) burst() int {
+	if c.Burst == 0 {
+		return 1
+	}
+	return c.Burst
+}
+
+// importThrottle applies an ImportThrottleConfig to the imports made by the import feed.
+type importThrottle struct {
+	config        ImportThrottleConfig
+	slots         chan struct{} // Held by each import in progress, nil for no concurrency limit
+	underPressure func() bool   // Whether low priority imports should yield
+	stats         *base.SharedBucketImportStats
+
+	lock       sync.Mutex
+	tokens     float64   // Imports that can start immediately, for max_per_second
+	lastRefill time.Time // When tokens was last topped up
+}
+
+func newImportThrottle(config ImportThrottleConfig, underPressure func() bool, stats *base.SharedBucketImportStats) *importThrottle {
+	t := &importThrottle{
+		config:        config,
+		underPressure: underPressure,
+		stats:         stats,
+		tokens:        float64(config.burst()),
+		lastRefill:    time.Now(),
+	}
+	if config.MaxConcurrent > 0 {
+		t.slots = make(chan struct{}, config.MaxConcurrent)
+	}
+	return t
+}
+
+// acquire blocks until an import can start.  Returns false without acquiring the throttle if the terminator is closed
+// while waiting.  Each successful acquire must be followed by a release once the import has completed.
+func (t *importThrottle) acquire(terminator chan bool) bool {
+	t.stats.ImportQueueDepth.Add(1)
+	defer t.stats.ImportQueueDepth.Add(-1)
+
+	throttled := false
+	if t.config.LowPriority {
+		for waited := time.Duration(0); waited < importLowPriorityMaxWait && t.underPressure(); waited += importLowPriorityPollInterval {
+			throttled = true
+			if !t.wait(importLowPriorityPollInterval, terminator) {
+				return false
+			}
+		}
+	}
+
+	if t.config.MaxPerSecond > 0 {
+		if delay := t.reserve(time.Now()); delay > 0 {
+			throttled = true
+			if !t.wait(delay, terminator) {
+				return false
+			}
+		}
+	}
+
+	if t.slots != nil {
+		select {
+		case t.slots <- struct{}{}:
+		default:
+			throttled = true
+			select {
+			case t.slots <- struct{}{}:
+			case <-terminator:
+				return false
+			}
+		}
+	}
+
+	if throttled {
+		t.stats.ImportThrottledCount.Add(1)
+	}
+	return true
+}
+
+// release frees the concurrency slot held by an import that has completed.
+func (t *importThrottle) release() {
+	if t.slots != nil {
+		<-t.slots
+	}
+}
+
+// reserve takes a token for an import from the token bucket, returning how long the import must wait for it.
+func (t *importThrottle) reserve(now time.Time) time.Duration {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.tokens = math.Min(float64(t.config.burst()), t.tokens+now.Sub(t.lastRefill).Seconds()*t.config.MaxPerSecond)
+	t.lastRefill = now
+	t.tokens--
+	if t.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-t.tokens / t.config.MaxPerSecond * float64(time.Second))
+}
+
+// wait waits for the given duration, returning false if the terminator is closed first.
+func (t *importThrottle) wait(d time.Duration, terminator chan bool) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-terminator:
+		return false
+	}
+}
+
+// beginAPIWrite records a write made via the REST or BLIP APIs, which low priority imports yield to, until the
+// returned function is called.
+func (context *DatabaseContext) beginAPIWrite() (end func()) {
+	atomic.AddInt64(&context.activeAPIWrites, 1)
+	return func() {
+		atomic.AddInt64(&context.activeAPIWrites, -1)
+	}
+}
+
+// importUnderPressure returns whether low priority imports should yield, because writes are being made via the APIs,
+// or because the change cache has a backlog of pending sequences.
+func (context *DatabaseContext) importUnderPressure() bool {
+	if atomic.LoadInt64(&context.activeAPIWrites) > 0 {
+		return true
+	}
+	return context.DbStats.Cache().PendingSeqLen.Value() > int64(context.changeCache.options.CachePendingSeqMaxNum/2)
+}
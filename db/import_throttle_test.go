@@ -0,0 +1,92 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestImportThrottleStats() *base.SharedBucketImportStats {
+	return &base.SharedBucketImportStats{
+		ImportQueueDepth:     &base.SgwIntStat{},
+		ImportThrottledCount: &base.SgwIntStat{},
+	}
+}
+
+func TestImportThrottleRate(t *testing.T) {
+	throttle := newImportThrottle(ImportThrottleConfig{MaxPerSecond: 10, Burst: 2}, nil, newTestImportThrottleStats())
+	now := throttle.lastRefill
+
+	// The burst can start immediately, then imports are spaced out at the max rate
+	assert.Equal(t, time.Duration(0), throttle.reserve(now))
+	assert.Equal(t, time.Duration(0), throttle.reserve(now))
+	assert.Equal(t, 100*time.Millisecond, throttle.reserve(now))
+	assert.Equal(t, 200*time.Millisecond, throttle.reserve(now))
+
+	// Tokens accumulate over time, up to the burst
+	now = now.Add(time.Hour)
+	assert.Equal(t, time.Duration(0), throttle.reserve(now))
+	assert.Equal(t, time.Duration(0), throttle.reserve(now))
+	assert.Equal(t, 100*time.Millisecond, throttle.reserve(now))
+}
+
+func TestImportThrottleConcurrency(t *testing.T) {
+	stats := newTestImportThrottleStats()
+	throttle := newImportThrottle(ImportThrottleConfig{MaxConcurrent: 1}, nil, stats)
+	terminator := make(chan bool)
+
+	assert.True(t, throttle.acquire(terminator))
+	assert.Equal(t, int64(0), stats.ImportThrottledCount.Value())
+
+	// A second import waits for the first to be released
+	acquired := make(chan bool)
+	go func() {
+		acquired <- throttle.acquire(terminator)
+	}()
+	select {
+	case <-acquired:
+		assert.Fail(t, "Import shouldn't have acquired the throttle while another import is in progress")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.Equal(t, int64(1), stats.ImportQueueDepth.Value())
+
+	throttle.release()
+	assert.True(t, <-acquired)
+	assert.Equal(t, int64(0), stats.ImportQueueDepth.Value())
+	assert.Equal(t, int64(1), stats.ImportThrottledCount.Value())
+
+	// Waiting imports are abandoned when the import feed is stopped
+	go func() {
+		acquired <- throttle.acquire(terminator)
+	}()
+	close(terminator)
+	assert.False(t, <-acquired)
+}
+
+func TestImportThrottleLowPriority(t *testing.T) {
+	stats := newTestImportThrottleStats()
+	underPressure := true
+	throttle := newImportThrottle(ImportThrottleConfig{LowPriority: true}, func() bool { return underPressure }, stats)
+	terminator := make(chan bool)
+	defer close(terminator)
+
+	// Low priority imports yield for a bounded time while under pressure
+	start := time.Now()
+	assert.True(t, throttle.acquire(terminator))
+	assert.GreaterOrEqual(t, time.Since(start), importLowPriorityMaxWait)
+	assert.Equal(t, int64(1), stats.ImportThrottledCount.Value())
+
+	underPressure = false
+	assert.True(t, throttle.acquire(terminator))
+	assert.Equal(t, int64(1), stats.ImportThrottledCount.Value())
+}
@@ -12,9 +12,14 @@ package db
 
 import (
 	"testing"
+
+	"github.com/couchbase/sync_gateway/channels"
 )
 
 func TestMain(m *testing.M) {
+	// The test binary is run as the sandbox of sync functions with resource limits
+	channels.RunSyncSandboxIfRequested()
+
 	memWatermarkThresholdMB := uint64(2048)
 	TestBucketPoolWithIndexes(m, memWatermarkThresholdMB)
 }
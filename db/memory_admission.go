@@ -0,0 +1,143 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package db
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/couchbase/sync_gateway/base"
+)
+
+const (
+	DefaultMemoryAdmissionRetryAfterSecs = 5
+	MaxMemoryAdmissionRetryAfterSecs     = 3600
+)
+
+// Estimates of the memory used by each item accounted for, in addition to any size that's known exactly
+const (
+	requestEstimatedBytes           = 16 * 1024  // In-flight request, excluding its body
+	blipConnectionEstimatedBytes    = 256 * 1024 // BLIP connection's buffers and sync context
+	channelCacheEntryEstimatedBytes = 200        // Channel cache entry, including its doc and rev IDs
+)
+
+// MemoryAdmissionConfig configures the shedding of requests to a database while its estimated memory usage is high, so
+// that one database on a node hosting many can't exhaust the process's memory.
+type MemoryAdmissionConfig struct {
+	HighWatermarkMB *uint32 `json:"high_watermark_mb,omitempty"` // Requests are rejected once the estimated memory usage exceeds this
+	LowWatermarkMB  *uint32 `json:"low_watermark_mb,omitempty"`  // Requests are accepted again once the estimated memory usage falls below this, defaults to 90% of high_watermark_mb
+	RetryAfterSecs  *uint32 `json:"retry_after_secs,omitempty"`  // Retry-After returned with rejected requests
+}
+
+// Validate ensures the config's settings are valid.
+func (c *MemoryAdmissionConfig) Validate() error {
+	if c.HighWatermarkMB == nil || *c.HighWatermarkMB < 1 {
+		return fmt.Errorf("high_watermark_mb must be at least 1")
+	}
+	if c.LowWatermarkMB != nil && (*c.LowWatermarkMB < 1 || *c.LowWatermarkMB >= *c.HighWatermarkMB) {
+		return fmt.Errorf("low_watermark_mb must be at least 1, and less than high_watermark_mb")
+	}
+	if c.RetryAfterSecs != nil && (*c.RetryAfterSecs < 1 || *c.RetryAfterSecs > MaxMemoryAdmissionRetryAfterSecs) {
+		return fmt.Errorf("retry_after_secs must be between 1 and %d", MaxMemoryAdmissionRetryAfterSecs)
+	}
+	return nil
+}
+
+// MemoryAdmissionError is returned for requests rejected while a database's estimated memory usage is high.
+type MemoryAdmissionError struct {
+	RetryAfter time.Duration
+}
+
+func (e *MemoryAdmissionError) Error() string {
+	return "Database memory usage is too high - try again later"
+}
+
+// MemoryAccountant tracks the approximate memory used by a database's caches, in-flight requests and BLIP
+// connections, and when configured, rejects requests while it's above the high watermark.  Once requests are being
+// rejected, they continue to be until usage falls below the low watermark, so that admission doesn't flap around a
+// single threshold.
+type MemoryAccountant struct {
+	cacheStats      *base.CacheStats
+	usageStat       *base.SgwIntStat
+	rejectedStat    *base.SgwIntStat
+	highWatermark   int64 // Zero when requests are never rejected
+	lowWatermark    int64
+	retryAfter      time.Duration
+	requestBytes    int64 // Estimated memory used by in-flight requests, accessed atomically
+	blipConnections int64 // Number of open BLIP connections, accessed atomically
+	shedding        int32 // Non-zero while requests are being rejected, accessed atomically
+}
+
+// NewMemoryAccountant returns an accountant for a database's memory, applying admission control if config is non-nil.
+func NewMemoryAccountant(config *MemoryAdmissionConfig, dbStats *base.DbStats) *MemoryAccountant {
+	m := &MemoryAccountant{
+		cacheStats:   dbStats.Cache(),
+		usageStat:    dbStats.Database().MemoryUsageBytes,
+		rejectedStat: dbStats.Database().MemoryAdmissionRejectedCount,
+	}
+	if config != nil && config.HighWatermarkMB != nil {
+		m.highWatermark = int64(*config.HighWatermarkMB) * 1024 * 1024
+		m.lowWatermark = m.highWatermark * 9 / 10
+		if config.LowWatermarkMB != nil {
+			m.lowWatermark = int64(*config.LowWatermarkMB) * 1024 * 1024
+		}
+		m.retryAfter = DefaultMemoryAdmissionRetryAfterSecs * time.Second
+		if config.RetryAfterSecs != nil {
+			m.retryAfter = time.Duration(*config.RetryAfterSecs) * time.Second
+		}
+	}
+	return m
+}
+
+// Usage returns the database's estimated memory usage in bytes, and updates the memory usage stat.
+func (m *MemoryAccountant) Usage() int64 {
+	usage := m.cacheStats.RevisionCacheBytes.Value() +
+		m.cacheStats.ChannelCacheRevsActive.Value()*channelCacheEntryEstimatedBytes +
+		atomic.LoadInt64(&m.requestBytes) +
+		atomic.LoadInt64(&m.blipConnections)*blipConnectionEstimatedBytes
+	m.usageStat.Set(usage)
+	return usage
+}
+
+// AdmitRequest accounts for a request with a body of the given length, returning a function to be called once it's
+// complete.  Returns a MemoryAdmissionError if the request's rejected.
+func (m *MemoryAccountant) AdmitRequest(contentLength int64) (release func(), err error) {
+	if m.highWatermark > 0 {
+		usage := m.Usage()
+		if atomic.LoadInt32(&m.shedding) != 0 {
+			if usage < m.lowWatermark {
+				atomic.StoreInt32(&m.shedding, 0)
+			}
+		} else if usage > m.highWatermark {
+			atomic.StoreInt32(&m.shedding, 1)
+		}
+		if atomic.LoadInt32(&m.shedding) != 0 {
+			m.rejectedStat.Add(1)
+			return nil, &MemoryAdmissionError{RetryAfter: m.retryAfter}
+		}
+	}
+
+	requestBytes := int64(requestEstimatedBytes)
+	if contentLength > 0 {
+		requestBytes += contentLength
+	}
+	atomic.AddInt64(&m.requestBytes, requestBytes)
+	return func() {
+		atomic.AddInt64(&m.requestBytes, -requestBytes)
+	}, nil
+}
+
+// AddBlipConnection accounts for an open BLIP connection, returning a function to be called once it's closed.
+func (m *MemoryAccountant) AddBlipConnection() (release func()) {
+	atomic.AddInt64(&m.blipConnections, 1)
+	return func() {
+		atomic.AddInt64(&m.blipConnections, -1)
+	}
+}
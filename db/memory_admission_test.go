@@ -0,0 +1,67 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryAdmissionConfigValidate(t *testing.T) {
+	assert.NoError(t, (&MemoryAdmissionConfig{HighWatermarkMB: base.Uint32Ptr(100)}).Validate())
+	assert.NoError(t, (&MemoryAdmissionConfig{HighWatermarkMB: base.Uint32Ptr(100), LowWatermarkMB: base.Uint32Ptr(80), RetryAfterSecs: base.Uint32Ptr(10)}).Validate())
+	assert.Error(t, (&MemoryAdmissionConfig{}).Validate())
+	assert.Error(t, (&MemoryAdmissionConfig{HighWatermarkMB: base.Uint32Ptr(0)}).Validate())
+	assert.Error(t, (&MemoryAdmissionConfig{HighWatermarkMB: base.Uint32Ptr(100), LowWatermarkMB: base.Uint32Ptr(100)}).Validate())
+	assert.Error(t, (&MemoryAdmissionConfig{HighWatermarkMB: base.Uint32Ptr(100), RetryAfterSecs: base.Uint32Ptr(0)}).Validate())
+}
+
+func TestMemoryAccountant(t *testing.T) {
+	dbStats := (base.NewSyncGatewayStats()).NewDBStats("", false, false, false)
+	accountant := NewMemoryAccountant(&MemoryAdmissionConfig{HighWatermarkMB: base.Uint32Ptr(2), LowWatermarkMB: base.Uint32Ptr(1), RetryAfterSecs: base.Uint32Ptr(30)}, dbStats)
+
+	// In-flight requests and BLIP connections are accounted for until they're released
+	release, err := accountant.AdmitRequest(1000)
+	require.NoError(t, err)
+	releaseBlip := accountant.AddBlipConnection()
+	assert.Equal(t, int64(requestEstimatedBytes+1000+blipConnectionEstimatedBytes), accountant.Usage())
+	assert.Equal(t, accountant.Usage(), dbStats.Database().MemoryUsageBytes.Value())
+	release()
+	releaseBlip()
+	assert.Equal(t, int64(0), accountant.Usage())
+
+	// Requests are rejected once usage exceeds the high watermark...
+	dbStats.Cache().RevisionCacheBytes.Set(3 * 1024 * 1024)
+	_, err = accountant.AdmitRequest(0)
+	var admissionErr *MemoryAdmissionError
+	require.True(t, errors.As(err, &admissionErr))
+	assert.Equal(t, 30*time.Second, admissionErr.RetryAfter)
+	assert.Equal(t, int64(1), dbStats.Database().MemoryAdmissionRejectedCount.Value())
+
+	// ...until it falls below the low watermark
+	dbStats.Cache().RevisionCacheBytes.Set(1536 * 1024)
+	_, err = accountant.AdmitRequest(0)
+	assert.Error(t, err)
+	dbStats.Cache().RevisionCacheBytes.Set(512 * 1024)
+	release, err = accountant.AdmitRequest(0)
+	require.NoError(t, err)
+	release()
+
+	// Requests are never rejected without admission control configured
+	accountant = NewMemoryAccountant(nil, dbStats)
+	dbStats.Cache().RevisionCacheBytes.Set(1 << 40)
+	release, err = accountant.AdmitRequest(0)
+	require.NoError(t, err)
+	release()
+}
@@ -0,0 +1,232 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	sgbucket "github.com/couchbase/sg-bucket"
+	"github.com/couchbase/sync_gateway/base"
+)
+
+// Max attempts to migrate a doc that's being concurrently updated
+const metadataMigrationMaxAttempts = 5
+
+// inlineSyncData is a minimal struct to unmarshal into when checking whether a doc body has inline sync metadata
+type inlineSyncData struct {
+	Sync json.RawMessage `json:"_sync"`
+}
+
+// migrateAllMetadata runs a one-shot DCP feed over the bucket, moving the sync metadata of any document that still
+// stores it inline in the document body into the sync xattr.  The feed's checkpoints are persisted under the
+// migration ID, so a stopped migration resumes from where it left off when run again with the same ID.  When
+// maxPerSecond is non-zero, migrations are limited to that rate.
+func migrateAllMetadata(ctx context.Context, db *Database, migrationID string, maxPerSecond uint64, terminator *base.SafeTerminator, docsProcessed, docsMigrated *base.AtomicInt) error {
+	migrationLoggingID := "Metadata Migration: " + migrationID
+	limiter := newMetadataMigrationLimiter(maxPerSecond)
+
+	callback := func(event sgbucket.FeedEvent) bool {
+		docID := string(event.Key)
+		base.TracefCtx(ctx, base.KeyMigrate, "[%s] Received DCP event %d for doc %v", migrationLoggingID, event.Opcode, base.UD(docID))
+
+		// Skip deletions, binary docs and Sync Gateway's own docs
+		if event.Opcode != sgbucket.FeedOpMutation || event.DataType == base.MemcachedDataTypeRaw || len(event.Value) == 0 {
+			return true
+		}
+		if strings.HasPrefix(docID, base.SyncDocPrefix) {
+			return true
+		}
+
+		docsProcessed.Add(1)
+		body := event.Value
+		if event.DataType&base.MemcachedDataTypeXattr != 0 {
+			var syncXattr []byte
+			var err error
+			body, syncXattr, _, err = parseXattrStreamData(base.SyncXattrName, "", event.Value)
+			if err != nil {
+				base.WarnfCtx(ctx, "[%s] Unable to parse xattrs of doc %q - skipping: %v", migrationLoggingID, base.UD(docID), err)
+				return true
+			}
+			// Already has xattr-based metadata
+			if len(syncXattr) > 0 {
+				return true
+			}
+		}
+		if !hasInlineSyncData(body) {
+			return true
+		}
+
+		if !limiter.wait(terminator) {
+			return false
+		}
+
+		migrated, err := db.migrateDocMetadata(ctx, docID, body, event.Cas, event.Expiry)
+		if err != nil {
+			base.WarnfCtx(ctx, "[%s] Unable to migrate metadata of doc %q: %v", migrationLoggingID, base.UD(docID), err)
+			return true
+		}
+		if migrated {
+			docsMigrated.Add(1)
+		}
+		return true
+	}
+
+	collection, err := base.AsCollection(db.Bucket)
+	if err != nil {
+		return err
+	}
+
+	// Reuse the compaction DCP client options, which persist checkpoints to the bucket so the feed can be resumed
+	clientOptions, err := getCompactionDCPClientOptions(collection, db.Options.GroupID)
+	if err != nil {
+		return err
+	}
+
+	base.InfofCtx(ctx, base.KeyAll, "[%s] Starting DCP feed for metadata migration", migrationLoggingID)
+	dcpClient, err := base.NewDCPClient(generateMetadataMigrationDCPStreamName(migrationID), callback, *clientOptions, collection)
+	if err != nil {
+		base.WarnfCtx(ctx, "[%s] Failed to create metadata migration DCP client! %v", migrationLoggingID, err)
+		return err
+	}
+
+	doneChan, err := dcpClient.Start()
+	if err != nil {
+		base.WarnfCtx(ctx, "[%s] Failed to start metadata migration DCP feed! %v", migrationLoggingID, err)
+		_ = dcpClient.Close()
+		return err
+	}
+
+	select {
+	case err = <-doneChan:
+		base.InfofCtx(ctx, base.KeyAll, "[%s] Metadata migration completed. Processed %d docs, migrated %d docs", migrationLoggingID, docsProcessed.Value(), docsMigrated.Value())
+		closeErr := dcpClient.Close()
+		if err == nil {
+			err = closeErr
+		}
+	case <-terminator.Done():
+		base.DebugfCtx(ctx, base.KeyAll, "[%s] Terminator closed. Stopping metadata migration.", migrationLoggingID)
+		err = dcpClient.Close()
+		if err != nil {
+			return err
+		}
+		err = <-doneChan
+		base.InfofCtx(ctx, base.KeyAll, "[%s] Metadata migration was terminated. Processed %d docs, migrated %d docs", migrationLoggingID, docsProcessed.Value(), docsMigrated.Value())
+	}
+	return err
+}
+
+// hasInlineSyncData returns whether a document body has sync metadata stored inline in the _sync property.
+func hasInlineSyncData(body []byte) bool {
+	var data inlineSyncData
+	if err := base.JSONUnmarshal(body, &data); err != nil {
+		return false
+	}
+	return len(data.Sync) > 0 && string(data.Sync) != "null"
+}
+
+// migrateDocMetadata moves a document's inline sync metadata into the sync xattr.  If the doc has been updated since
+// the given body was read, the current version is reloaded and the migration retried.  Returns false if the doc no
+// longer has inline sync metadata, or doesn't have valid sync metadata to migrate.
+func (db *Database) migrateDocMetadata(ctx context.Context, docID string, body []byte, cas uint64, expiry uint32) (migrated bool, err error) {
+	mutationOptions := sgbucket.MutateInOptions{}
+	if db.Bucket.IsSupported(sgbucket.DataStoreFeaturePreserveExpiry) {
+		mutationOptions.PreserveExpiry = true
+	}
+
+	for attempt := 1; ; attempt++ {
+		existingDoc := &sgbucket.BucketDocument{Body: body, Cas: cas, Expiry: expiry}
+		_, requiresImport, err := db.migrateMetadata(ctx, docID, nil, existingDoc, &mutationOptions)
+		if err == nil {
+			return !requiresImport, nil
+		}
+		if err != base.ErrCasFailureShouldRetry || attempt >= metadataMigrationMaxAttempts {
+			return false, err
+		}
+
+		base.DebugfCtx(ctx, base.KeyMigrate, "Doc %q was updated during metadata migration - retrying", base.UD(docID))
+		body, cas, err = db.Bucket.GetRaw(docID)
+		if err != nil {
+			if base.IsDocNotFoundError(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		if !hasInlineSyncData(body) {
+			return false, nil
+		}
+		if !mutationOptions.PreserveExpiry {
+			cbStore, ok := base.AsCouchbaseStore(db.Bucket)
+			if !ok {
+				return false, fmt.Errorf("unable to get expiry of doc %q - not a Couchbase bucket", base.UD(docID))
+			}
+			if expiry, err = cbStore.GetExpiry(docID); err != nil {
+				return false, err
+			}
+		}
+	}
+}
+
+// metadataMigrationLimiter spaces out migrations so they don't exceed a max rate.
+type metadataMigrationLimiter struct {
+	interval time.Duration // Min time between migrations, zero for no limit
+	lock     sync.Mutex
+	next     time.Time // When the next migration can start
+}
+
+func newMetadataMigrationLimiter(maxPerSecond uint64) *metadataMigrationLimiter {
+	limiter := &metadataMigrationLimiter{}
+	if maxPerSecond > 0 {
+		limiter.interval = time.Second / time.Duration(maxPerSecond)
+	}
+	return limiter
+}
+
+// reserve returns how long a migration starting at the given time must wait to stay under the max rate.
+func (l *metadataMigrationLimiter) reserve(now time.Time) time.Duration {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	return delay
+}
+
+// wait blocks until a migration can start, returning false if the terminator is closed first.
+func (l *metadataMigrationLimiter) wait(terminator *base.SafeTerminator) bool {
+	if l.interval == 0 {
+		return true
+	}
+	delay := l.reserve(time.Now())
+	if delay == 0 {
+		return true
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-terminator.Done():
+		return false
+	}
+}
+
+func generateMetadataMigrationDCPStreamName(migrationID string) string {
+	return fmt.Sprintf(
+		"sg-%v:migrate_metadata:%v",
+		base.ProductAPIVersion,
+		migrationID,
+	)
+}
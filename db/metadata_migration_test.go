@@ -0,0 +1,49 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHasInlineSyncData(t *testing.T) {
+	assert.True(t, hasInlineSyncData([]byte(`{"value": 1, "_sync": {"rev": "1-a"}}`)))
+	assert.False(t, hasInlineSyncData([]byte(`{"value": 1}`)))
+	assert.False(t, hasInlineSyncData([]byte(`{"value": 1, "_sync": null}`)))
+	assert.False(t, hasInlineSyncData([]byte(`not JSON`)))
+}
+
+func TestMetadataMigrationLimiter(t *testing.T) {
+	limiter := newMetadataMigrationLimiter(10)
+	now := time.Now()
+
+	// Migrations are spaced out at the max rate
+	assert.Equal(t, time.Duration(0), limiter.reserve(now))
+	assert.Equal(t, 100*time.Millisecond, limiter.reserve(now))
+	assert.Equal(t, 200*time.Millisecond, limiter.reserve(now))
+
+	// Idle time doesn't accumulate into a burst
+	now = now.Add(time.Hour)
+	assert.Equal(t, time.Duration(0), limiter.reserve(now))
+	assert.Equal(t, 100*time.Millisecond, limiter.reserve(now))
+
+	// Waiting migrations are abandoned when the migration is stopped
+	terminator := base.NewSafeTerminator()
+	terminator.Close()
+	limiter = newMetadataMigrationLimiter(1)
+	assert.True(t, limiter.wait(terminator))
+	assert.False(t, limiter.wait(terminator))
+
+	// No limit
+	assert.True(t, newMetadataMigrationLimiter(0).wait(terminator))
+}
@@ -40,6 +40,7 @@ const (
 	QueryTypeTombstones          = "tombstones"
 	QueryTypeResync              = "resync"
 	QueryTypeAllDocs             = "allDocs"
+	QueryTypeCollectionUsage     = "collectionUsage"
 	QueryTypeUsers               = "users"
 	QueryTypeUserPrefix          = "userquery:" // Prefix applied to named user queries from config file
 )
@@ -273,6 +274,25 @@ var QueryAllDocs = SGQuery{
 	adhoc: false,
 }
 
+// QueryCollectionUsage counts the live documents returned by QueryAllDocs, and totals the size of their bodies, to
+// establish a collection's usage of its quota.
+var QueryCollectionUsage = SGQuery{
+	name: QueryTypeCollectionUsage,
+	statement: fmt.Sprintf(
+		"SELECT COUNT(1) AS docs, "+
+			"IFMISSINGORNULL(SUM(ENCODED_SIZE(%s)), 0) AS bytes "+
+			"FROM %s AS %s "+
+			"USE INDEX ($idx) "+
+			"WHERE $sync.sequence > 0 AND "+ // Required to use IndexAllDocs
+			"META(%s).id NOT LIKE '%s' "+
+			"AND $sync IS NOT MISSING "+
+			"AND ($sync.flags IS MISSING OR BITTEST($sync.flags,1) = false)",
+		base.KeyspaceQueryAlias,
+		base.KeyspaceQueryToken, base.KeyspaceQueryAlias,
+		base.KeyspaceQueryAlias, SyncDocWildcard),
+	adhoc: false,
+}
+
 // Query Parameters used as parameters in prepared statements.  Note that these are hardcoded into the query definitions above,
 // for improved query readability.
 const (
@@ -294,24 +314,29 @@ const (
 func (context *DatabaseContext) N1QLQueryWithStats(ctx context.Context, queryName string, statement string, params map[string]interface{}, consistency base.ConsistencyMode, adhoc bool) (results sgbucket.QueryResultIterator, err error) {
 
 	startTime := time.Now()
-	if threshold := context.Options.SlowQueryWarningThreshold; threshold > 0 {
-		defer base.SlowQueryLog(ctx, startTime, threshold, "N1QL Query(%q)", queryName)
-	}
-
 	n1QLStore, ok := base.AsN1QLStore(context.Bucket)
 	if !ok {
 		return nil, errors.New("Cannot perform N1QL query on non-Couchbase bucket.")
 	}
 
 	queryStat := context.DbStats.Query(queryName)
+	if threshold := context.Options.SlowQueryWarningThreshold; threshold > 0 {
+		defer func() {
+			if base.SlowQueryLog(ctx, startTime, threshold, params, "N1QL Query(%q)", queryName) {
+				queryStat.QuerySlowCount.Add(1)
+			}
+		}()
+	}
 
-	results, err = n1QLStore.Query(statement, params, consistency, adhoc)
+	results, err = base.QueryContext(ctx, n1QLStore, statement, params, consistency, adhoc)
 	if err != nil {
 		queryStat.QueryErrorCount.Add(1)
 	}
 
+	elapsed := time.Since(startTime)
 	queryStat.QueryCount.Add(1)
-	queryStat.QueryTime.Add(time.Since(startTime).Nanoseconds())
+	queryStat.QueryTime.Add(elapsed.Nanoseconds())
+	queryStat.QueryDuration.Observe(elapsed.Seconds())
 
 	return results, err
 }
@@ -320,18 +345,23 @@ func (context *DatabaseContext) N1QLQueryWithStats(ctx context.Context, queryNam
 func (context *DatabaseContext) ViewQueryWithStats(ctx context.Context, ddoc string, viewName string, params map[string]interface{}) (results sgbucket.QueryResultIterator, err error) {
 
 	startTime := time.Now()
+	queryStat := context.DbStats.Query(fmt.Sprintf(base.StatViewFormat, ddoc, viewName))
 	if threshold := context.Options.SlowQueryWarningThreshold; threshold > 0 {
-		defer base.SlowQueryLog(ctx, startTime, threshold, "View Query (%s.%s)", ddoc, viewName)
+		defer func() {
+			if base.SlowQueryLog(ctx, startTime, threshold, params, "View Query (%s.%s)", ddoc, viewName) {
+				queryStat.QuerySlowCount.Add(1)
+			}
+		}()
 	}
 
-	queryStat := context.DbStats.Query(fmt.Sprintf(base.StatViewFormat, ddoc, viewName))
-
 	results, err = context.Bucket.ViewQuery(ddoc, viewName, params)
 	if err != nil {
 		queryStat.QueryErrorCount.Add(1)
 	}
+	elapsed := time.Since(startTime)
 	queryStat.QueryCount.Add(1)
-	queryStat.QueryTime.Add(time.Since(startTime).Nanoseconds())
+	queryStat.QueryTime.Add(elapsed.Nanoseconds())
+	queryStat.QueryDuration.Observe(elapsed.Seconds())
 
 	return results, err
 }
@@ -632,6 +662,18 @@ func (context *DatabaseContext) QueryAllDocs(ctx context.Context, startKey strin
 	return context.N1QLQueryWithStats(ctx, QueryTypeAllDocs, allDocsQueryStatement, params, base.RequestPlus, QueryAllDocs.adhoc)
 }
 
+// QueryCollectionUsage returns a single row with the number of live documents in the collection, and the total size of
+// their bodies.  Not supported when using views.
+func (context *DatabaseContext) QueryCollectionUsage(ctx context.Context) (sgbucket.QueryResultIterator, error) {
+	if context.Options.UseViews {
+		return nil, errors.New("collection usage query is not supported when using views")
+	}
+
+	usageQueryStatement := replaceSyncTokensQuery(QueryCollectionUsage.statement, context.UseXattrs())
+	usageQueryStatement = replaceIndexTokensQuery(usageQueryStatement, sgIndexes[IndexAllDocs], context.UseXattrs())
+	return context.N1QLQueryWithStats(ctx, QueryTypeCollectionUsage, usageQueryStatement, nil, base.RequestPlus, QueryCollectionUsage.adhoc)
+}
+
 func (context *DatabaseContext) QueryTombstones(ctx context.Context, olderThan time.Time, limit int) (sgbucket.QueryResultIterator, error) {
 
 	// View Query
@@ -0,0 +1,109 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package db
+
+import (
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression algorithms for the bodies of revisions held in the revision cache
+const (
+	RevCacheCompressionNone   = "none"
+	RevCacheCompressionSnappy = "snappy"
+	RevCacheCompressionZstd   = "zstd"
+)
+
+// Bodies smaller than this aren't compressed, as the saving wouldn't be worth the CPU spent decompressing them on every
+// read.
+const revCacheCompressionMinBytes = 256
+
+// IsValidRevCacheCompression returns true if the given compression algorithm is supported by the revision cache.
+func IsValidRevCacheCompression(compression string) bool {
+	switch compression {
+	case RevCacheCompressionNone, RevCacheCompressionSnappy, RevCacheCompressionZstd:
+		return true
+	}
+	return false
+}
+
+// revCacheCodec compresses and decompresses revision bodies.  Implementations must be safe for concurrent use.
+type revCacheCodec interface {
+	encode(src []byte) []byte
+	decode(src []byte) ([]byte, error)
+}
+
+type snappyRevCacheCodec struct{}
+
+func (snappyRevCacheCodec) encode(src []byte) []byte {
+	return snappy.Encode(nil, src)
+}
+
+func (snappyRevCacheCodec) decode(src []byte) ([]byte, error) {
+	return snappy.Decode(nil, src)
+}
+
+// zstdRevCacheCodec compresses with zstd, which is slower than snappy but typically achieves a better ratio.  The
+// encoder and decoder's EncodeAll and DecodeAll are safe for concurrent use.
+type zstdRevCacheCodec struct {
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+}
+
+func (c *zstdRevCacheCodec) encode(src []byte) []byte {
+	return c.encoder.EncodeAll(src, nil)
+}
+
+func (c *zstdRevCacheCodec) decode(src []byte) ([]byte, error) {
+	return c.decoder.DecodeAll(src, nil)
+}
+
+// revCacheCompressor compresses the bodies stored in a revision cache, recording the compression ratio achieved.
+type revCacheCompressor struct {
+	codec             revCacheCodec
+	uncompressedBytes *base.SgwIntStat // Total size of the bodies compressed
+	compressedBytes   *base.SgwIntStat // Total size of the bodies once compressed
+}
+
+// newRevCacheCompressor returns a compressor for the given algorithm, or nil when bodies aren't to be compressed.
+func newRevCacheCompressor(compression string, cacheStats *base.CacheStats) *revCacheCompressor {
+	var codec revCacheCodec
+	switch compression {
+	case RevCacheCompressionSnappy:
+		codec = snappyRevCacheCodec{}
+	case RevCacheCompressionZstd:
+		// Errors are only returned for invalid options
+		encoder, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest))
+		decoder, _ := zstd.NewReader(nil)
+		codec = &zstdRevCacheCodec{encoder: encoder, decoder: decoder}
+	default:
+		return nil
+	}
+	return &revCacheCompressor{
+		codec:             codec,
+		uncompressedBytes: cacheStats.RevisionCacheUncompressedBodyBytes,
+		compressedBytes:   cacheStats.RevisionCacheCompressedBodyBytes,
+	}
+}
+
+// compress returns the compressed body, or false when there's no compressor, or compression wouldn't reduce the body's
+// size enough to be worthwhile.  Safe to call on a nil compressor.
+func (c *revCacheCompressor) compress(bodyBytes []byte) ([]byte, bool) {
+	if c == nil || len(bodyBytes) < revCacheCompressionMinBytes {
+		return nil, false
+	}
+	compressed := c.codec.encode(bodyBytes)
+	if len(compressed) >= len(bodyBytes) {
+		return nil, false
+	}
+	c.uncompressedBytes.Add(int64(len(bodyBytes)))
+	c.compressedBytes.Add(int64(len(compressed)))
+	return compressed, true
+}
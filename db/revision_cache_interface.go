@@ -82,17 +82,29 @@ func NewRevisionCache(cacheOptions *RevisionCacheOptions, backingStore RevisionC
 
 	cacheHitStat := cacheStats.RevisionCacheHits
 	cacheMissStat := cacheStats.RevisionCacheMisses
+	cacheBytesStat := cacheStats.RevisionCacheBytes
+	cacheEvictedBytesStat := cacheStats.RevisionCacheEvictedBytes
+
+	compressor := newRevCacheCompressor(cacheOptions.Compression, cacheStats)
 
 	if cacheOptions.ShardCount > 1 {
-		return NewShardedLRURevisionCache(cacheOptions.ShardCount, cacheOptions.Size, backingStore, cacheHitStat, cacheMissStat)
+		shardedCache := NewShardedLRURevisionCache(cacheOptions.ShardCount, cacheOptions.Size, cacheOptions.MaxBytes, backingStore, cacheHitStat, cacheMissStat, cacheBytesStat, cacheEvictedBytesStat)
+		for _, cache := range shardedCache.caches {
+			cache.compressor = compressor
+		}
+		return shardedCache
 	}
 
-	return NewLRURevisionCache(cacheOptions.Size, backingStore, cacheHitStat, cacheMissStat)
+	cache := NewLRURevisionCache(cacheOptions.Size, cacheOptions.MaxBytes, backingStore, cacheHitStat, cacheMissStat, cacheBytesStat, cacheEvictedBytesStat)
+	cache.compressor = compressor
+	return cache
 }
 
 type RevisionCacheOptions struct {
-	Size       uint32
-	ShardCount uint16
+	Size        uint32
+	ShardCount  uint16
+	MaxBytes    int64  // Limit on the estimated total size of cached revisions, zero for no limit
+	Compression string // Algorithm cached bodies are compressed with (RevCacheCompressionSnappy or RevCacheCompressionZstd), empty or RevCacheCompressionNone for uncompressed
 }
 
 func DefaultRevisionCacheOptions() *RevisionCacheOptions {
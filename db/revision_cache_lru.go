@@ -25,14 +25,15 @@ type ShardedLRURevisionCache struct {
 	numShards uint16
 }
 
-// Creates a sharded revision cache with the given capacity and an optional loader function.
-func NewShardedLRURevisionCache(shardCount uint16, capacity uint32, backingStore RevisionCacheBackingStore, cacheHitStat, cacheMissStat *base.SgwIntStat) *ShardedLRURevisionCache {
+// Creates a sharded revision cache with the given capacity and memory limit (zero for no limit), and an optional loader function.
+func NewShardedLRURevisionCache(shardCount uint16, capacity uint32, maxBytes int64, backingStore RevisionCacheBackingStore, cacheHitStat, cacheMissStat, cacheBytesStat, cacheEvictedBytesStat *base.SgwIntStat) *ShardedLRURevisionCache {
 
 	caches := make([]*LRURevisionCache, shardCount)
-	// Add 10% to per-shared cache capacity to ensure overall capacity is reached under non-ideal shard hashing
+	// Add 10% to per-shared cache capacity and memory limit to ensure overall capacity is reached under non-ideal shard hashing
 	perCacheCapacity := 1.1 * float32(capacity) / float32(shardCount)
+	perCacheMaxBytes := int64(1.1 * float64(maxBytes) / float64(shardCount))
 	for i := 0; i < int(shardCount); i++ {
-		caches[i] = NewLRURevisionCache(uint32(perCacheCapacity+0.5), backingStore, cacheHitStat, cacheMissStat)
+		caches[i] = NewLRURevisionCache(uint32(perCacheCapacity+0.5), perCacheMaxBytes, backingStore, cacheHitStat, cacheMissStat, cacheBytesStat, cacheEvictedBytesStat)
 	}
 
 	return &ShardedLRURevisionCache{
@@ -73,44 +74,55 @@ func (sc *ShardedLRURevisionCache) Invalidate(ctx context.Context, docID, revID
 	sc.getShard(docID).Invalidate(ctx, docID, revID)
 }
 
-// An LRU cache of document revision bodies, together with their channel access.
+// An LRU cache of document revision bodies, together with their channel access.  Revisions are evicted when either the
+// number of cached revisions exceeds capacity, or their estimated total size exceeds maxBytes.
 type LRURevisionCache struct {
 	cache        map[IDAndRev]*list.Element // Fast lookup of list element by doc/rev ID
 	lruList      *list.List                 // List ordered by most recent access (Front is newest)
 	capacity     uint32                     // Max number of revisions to cache
+	maxBytes     int64                      // Max estimated total size of cached revisions, zero for no limit
+	currentBytes int64                      // Estimated total size of cached revisions
 	backingStore RevisionCacheBackingStore  // provides the methods used by the RevisionCacheLoaderFunc
 	lock         sync.Mutex                 // For thread-safety
 	cacheHits    *base.SgwIntStat
 	cacheMisses  *base.SgwIntStat
+	cacheBytes   *base.SgwIntStat
+	evictedBytes *base.SgwIntStat
+	compressor   *revCacheCompressor // Compresses cached bodies, nil when they're stored uncompressed
 }
 
 // The cache payload data. Stored as the Value of a list Element.
 type revCacheValue struct {
-	key         IDAndRev        // doc/rev IDs
-	bodyBytes   []byte          // Revision body (with no special properties)
-	history     Revisions       // Rev history encoded like a "_revisions" property
-	channels    base.Set        // Set of channels that have access
-	expiry      *time.Time      // Document expiry
-	attachments AttachmentsMeta // Document _attachments property
-	delta       *RevisionDelta  // Available delta *from* this revision
-	deleted     bool            // True if revision is a tombstone
-	err         error           // Error from loaderFunc if it failed
-	lock        sync.RWMutex    // Synchronizes access to this struct
-	body        Body            // unmarshalled body (if available)
-	removed     bool            // True if revision is a removal
-	invalid     bool            // Marks a revision as invalid meaning it won't be used
-}
-
-// Creates a revision cache with the given capacity and an optional loader function.
-func NewLRURevisionCache(capacity uint32, backingStore RevisionCacheBackingStore, cacheHitStat, cacheMissStat *base.SgwIntStat) *LRURevisionCache {
+	key         IDAndRev            // doc/rev IDs
+	bodyBytes   []byte              // Revision body (with no special properties), compressed by compressor if set
+	history     Revisions           // Rev history encoded like a "_revisions" property
+	channels    base.Set            // Set of channels that have access
+	expiry      *time.Time          // Document expiry
+	attachments AttachmentsMeta     // Document _attachments property
+	delta       *RevisionDelta      // Available delta *from* this revision
+	deleted     bool                // True if revision is a tombstone
+	err         error               // Error from loaderFunc if it failed
+	lock        sync.RWMutex        // Synchronizes access to this struct
+	body        Body                // unmarshalled body (if available)
+	removed     bool                // True if revision is a removal
+	invalid     bool                // Marks a revision as invalid meaning it won't be used
+	itemBytes   int64               // Estimated size of the revision, as accounted for by the cache.  Synchronized by the cache's lock.
+	compressor  *revCacheCompressor // Compressor of bodyBytes, nil when they're uncompressed
+}
+
+// Creates a revision cache with the given capacity and memory limit (zero for no limit), and an optional loader function.
+func NewLRURevisionCache(capacity uint32, maxBytes int64, backingStore RevisionCacheBackingStore, cacheHitStat, cacheMissStat, cacheBytesStat, cacheEvictedBytesStat *base.SgwIntStat) *LRURevisionCache {
 
 	return &LRURevisionCache{
 		cache:        map[IDAndRev]*list.Element{},
 		lruList:      list.New(),
 		capacity:     capacity,
+		maxBytes:     maxBytes,
 		backingStore: backingStore,
 		cacheHits:    cacheHitStat,
 		cacheMisses:  cacheMissStat,
+		cacheBytes:   cacheBytesStat,
+		evictedBytes: cacheEvictedBytesStat,
 	}
 }
 
@@ -138,6 +150,7 @@ func (rc *LRURevisionCache) UpdateDelta(ctx context.Context, docID, revID string
 	value := rc.getValue(docID, revID, false)
 	if value != nil {
 		value.updateDelta(toDelta)
+		rc.updateValueSize(value)
 	}
 }
 
@@ -151,11 +164,13 @@ func (rc *LRURevisionCache) getFromCache(ctx context.Context, docID, revID strin
 		return rc.LoadInvalidRevFromBackingStore(ctx, value.key, nil, includeBody, includeDelta)
 	}
 
-	docRev, statEvent, err := value.load(ctx, rc.backingStore, includeBody, includeDelta)
+	docRev, statEvent, err := value.load(ctx, rc.backingStore, rc.compressor, includeBody, includeDelta)
 	rc.statsRecorderFunc(statEvent)
 
 	if err != nil {
 		rc.removeValue(value) // don't keep failed loads in the cache
+	} else if !statEvent {
+		rc.updateValueSize(value)
 	}
 	return docRev, err
 }
@@ -220,11 +235,13 @@ func (rc *LRURevisionCache) GetActive(ctx context.Context, docID string, include
 		return rc.LoadInvalidRevFromBackingStore(ctx, value.key, bucketDoc, includeBody, false)
 	}
 
-	docRev, statEvent, err := value.loadForDoc(ctx, rc.backingStore, bucketDoc, includeBody)
+	docRev, statEvent, err := value.loadForDoc(ctx, rc.backingStore, rc.compressor, bucketDoc, includeBody)
 	rc.statsRecorderFunc(statEvent)
 
 	if err != nil {
 		rc.removeValue(value) // don't keep failed loads in the cache
+	} else if !statEvent {
+		rc.updateValueSize(value)
 	}
 	return docRev, err
 }
@@ -245,7 +262,8 @@ func (rc *LRURevisionCache) Put(ctx context.Context, docRev DocumentRevision) {
 		panic("Missing history for RevisionCache.Put")
 	}
 	value := rc.getValue(docRev.DocID, docRev.RevID, true)
-	value.store(docRev)
+	value.store(docRev, rc.compressor)
+	rc.updateValueSize(value)
 }
 
 // Upsert a revision in the cache.
@@ -256,6 +274,7 @@ func (rc *LRURevisionCache) Upsert(ctx context.Context, docRev DocumentRevision)
 	// If element exists remove from lrulist
 	if elem := rc.cache[key]; elem != nil {
 		rc.lruList.Remove(elem)
+		rc.addBytes_(-elem.Value.(*revCacheValue).itemBytes)
 	}
 
 	// Add new value and overwrite existing cache key, pushing to front to maintain order
@@ -268,7 +287,8 @@ func (rc *LRURevisionCache) Upsert(ctx context.Context, docRev DocumentRevision)
 	}
 	rc.lock.Unlock()
 
-	value.store(docRev)
+	value.store(docRev, rc.compressor)
+	rc.updateValueSize(value)
 }
 
 func (rc *LRURevisionCache) Invalidate(ctx context.Context, docID, revID string) {
@@ -304,6 +324,7 @@ func (rc *LRURevisionCache) removeValue(value *revCacheValue) {
 	if element := rc.cache[value.key]; element != nil && element.Value == value {
 		rc.lruList.Remove(element)
 		delete(rc.cache, value.key)
+		rc.addBytes_(-value.itemBytes)
 	}
 	rc.lock.Unlock()
 }
@@ -311,12 +332,37 @@ func (rc *LRURevisionCache) removeValue(value *revCacheValue) {
 func (rc *LRURevisionCache) purgeOldest_() {
 	value := rc.lruList.Remove(rc.lruList.Back()).(*revCacheValue)
 	delete(rc.cache, value.key)
+	rc.addBytes_(-value.itemBytes)
+	rc.evictedBytes.Add(value.itemBytes)
+}
+
+// updateValueSize updates the cache's accounting of the value's size after it's been loaded or modified, and evicts
+// the least recently used revisions if the cache is then over its memory limit.  The most recently used revision is
+// never evicted for size, so that a single revision larger than the limit is still cached until the next is added.
+func (rc *LRURevisionCache) updateValueSize(value *revCacheValue) {
+	itemBytes := value.size()
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	if element := rc.cache[value.key]; element == nil || element.Value != value {
+		// Already evicted or replaced
+		return
+	}
+	rc.addBytes_(itemBytes - value.itemBytes)
+	value.itemBytes = itemBytes
+	for rc.maxBytes > 0 && rc.currentBytes > rc.maxBytes && rc.lruList.Len() > 1 {
+		rc.purgeOldest_()
+	}
+}
+
+func (rc *LRURevisionCache) addBytes_(delta int64) {
+	rc.currentBytes += delta
+	rc.cacheBytes.Add(delta)
 }
 
 // Gets the body etc. out of a revCacheValue. If they aren't present already, the loader func
-// will be called. This is synchronized so that the loader will only be called once even if
-// multiple goroutines try to load at the same time.
-func (value *revCacheValue) load(ctx context.Context, backingStore RevisionCacheBackingStore, includeBody bool, includeDelta bool) (docRev DocumentRevision, cacheHit bool, err error) {
+// will be called, and the loaded body compressed by the given compressor if non-nil. This is synchronized so that the
+// loader will only be called once even if multiple goroutines try to load at the same time.
+func (value *revCacheValue) load(ctx context.Context, backingStore RevisionCacheBackingStore, compressor *revCacheCompressor, includeBody bool, includeDelta bool) (docRev DocumentRevision, cacheHit bool, err error) {
 
 	// Reading the delta from the revCacheValue requires holding the read lock, so it's managed outside asDocumentRevision,
 	// to reduce locking when includeDelta=false
@@ -338,8 +384,9 @@ func (value *revCacheValue) load(ctx context.Context, backingStore RevisionCache
 
 		// On cache hit, if body is requested and not present in revCacheValue, generate from bytes and update revCacheValue
 		if includeBody && docRev._shallowCopyBody == nil && err == nil {
-			err = value.updateBody(ctx)
-			docRev._shallowCopyBody = value.body.ShallowCopy()
+			var body Body
+			body, err = value.updateBody(ctx, docRev.BodyBytes)
+			docRev._shallowCopyBody = body.ShallowCopy()
 		}
 		return docRev, true, err
 	}
@@ -350,53 +397,99 @@ func (value *revCacheValue) load(ctx context.Context, backingStore RevisionCache
 	if value.bodyBytes != nil || value.err != nil {
 		cacheHit = true
 		// If body is requested and not already present in cache, populate value.body from value.BodyBytes
-		if includeBody && value.body == nil && value.err == nil {
-			if err := value.body.Unmarshal(value.bodyBytes); err != nil {
-				base.WarnfCtx(ctx, "Unable to marshal BodyBytes in revcache for %s %s", base.UD(value.key.DocID), value.key.RevID)
-			}
+		if includeBody && value.err == nil {
+			docRevBody = value.unmarshalBody_(ctx)
 		}
 	} else {
 		cacheHit = false
 		value.bodyBytes, value.body, value.history, value.channels, value.removed, value.attachments, value.deleted, value.expiry, value.err = revCacheLoader(ctx, backingStore, value.key, includeBody)
+		if includeBody {
+			docRevBody = value.body
+		}
+		value.compressBody_(compressor)
 	}
 
 	if includeDelta {
 		delta = value.delta
 	}
-	if includeBody {
-		docRevBody = value.body
-	}
 	value.lock.Unlock()
 
 	docRev, err = value.asDocumentRevision(docRevBody, delta)
 	return docRev, cacheHit, err
 }
 
-// Populate value.Body by unmarshalling value.bodyBytes
-func (value *revCacheValue) updateBody(ctx context.Context) (err error) {
-	var body Body
-	if err := body.Unmarshal(value.bodyBytes); err != nil {
+// Unmarshals the given uncompressed body bytes of the value, and populates value.Body with the result unless the body's
+// stored compressed.
+func (value *revCacheValue) updateBody(ctx context.Context, bodyBytes []byte) (body Body, err error) {
+	if err := body.Unmarshal(bodyBytes); err != nil {
 		// On unmarshal error, warn return docRev without body
 		base.WarnfCtx(ctx, "Unable to marshal BodyBytes in revcache for %s %s", base.UD(value.key.DocID), value.key.RevID)
-		return err
+		return nil, err
 	}
 
 	value.lock.Lock()
-	if value.body == nil {
+	if value.body == nil && value.compressor == nil {
 		value.body = body
 	}
 	value.lock.Unlock()
-	return nil
+	return body, nil
+}
+
+// Returns the unmarshalled body, populating value.body from value.bodyBytes if not already present.  The bodies of
+// compressed values aren't retained, as that would negate the memory saved by compressing them.  Expects callers to
+// hold value.lock.
+func (value *revCacheValue) unmarshalBody_(ctx context.Context) Body {
+	if value.body != nil {
+		return value.body
+	}
+	var body Body
+	bodyBytes, err := value.uncompressedBodyBytes()
+	if err == nil {
+		err = body.Unmarshal(bodyBytes)
+	}
+	if err != nil {
+		base.WarnfCtx(ctx, "Unable to marshal BodyBytes in revcache for %s %s", base.UD(value.key.DocID), value.key.RevID)
+		return nil
+	}
+	if value.compressor == nil {
+		value.body = body
+	}
+	return body
+}
+
+// Compresses value.bodyBytes with the given compressor, if non-nil and worthwhile, dropping the unmarshalled body.
+// Expects callers to hold value.lock.
+func (value *revCacheValue) compressBody_(compressor *revCacheCompressor) {
+	if compressed, ok := compressor.compress(value.bodyBytes); ok {
+		value.bodyBytes = compressed
+		value.compressor = compressor
+		value.body = nil
+	}
+}
+
+// Returns value.bodyBytes, decompressing them if they're compressed.  bodyBytes and compressor aren't modified once
+// the value's loaded, so this doesn't require value.lock to be held for loaded values.
+func (value *revCacheValue) uncompressedBodyBytes() ([]byte, error) {
+	if value.compressor == nil {
+		return value.bodyBytes, nil
+	}
+	return value.compressor.codec.decode(value.bodyBytes)
 }
 
 // asDocumentRevision copies the rev cache value into a DocumentRevision.  Should only be called for non-empty
 // revCacheValues - copies all immutable revCacheValue properties, and adds the provided body/delta.
 func (value *revCacheValue) asDocumentRevision(body Body, delta *RevisionDelta) (DocumentRevision, error) {
 
+	// Compressed bodies are decompressed lazily, as they're requested
+	bodyBytes, err := value.uncompressedBodyBytes()
+	if err != nil {
+		return DocumentRevision{}, err
+	}
+
 	docRev := DocumentRevision{
 		DocID:       value.key.DocID,
 		RevID:       value.key.RevID,
-		BodyBytes:   value.bodyBytes,
+		BodyBytes:   bodyBytes,
 		History:     value.history,
 		Channels:    value.channels,
 		Expiry:      value.expiry,
@@ -414,8 +507,8 @@ func (value *revCacheValue) asDocumentRevision(body Body, delta *RevisionDelta)
 }
 
 // Retrieves the body etc. out of a revCacheValue.  If they aren't already present, loads into the cache value using
-// the provided document.
-func (value *revCacheValue) loadForDoc(ctx context.Context, backingStore RevisionCacheBackingStore, doc *Document, includeBody bool) (docRev DocumentRevision, cacheHit bool, err error) {
+// the provided document, compressing the body with the given compressor if non-nil.
+func (value *revCacheValue) loadForDoc(ctx context.Context, backingStore RevisionCacheBackingStore, compressor *revCacheCompressor, doc *Document, includeBody bool) (docRev DocumentRevision, cacheHit bool, err error) {
 
 	var docRevBody Body
 	value.lock.RLock()
@@ -429,7 +522,7 @@ func (value *revCacheValue) loadForDoc(ctx context.Context, backingStore Revisio
 		if includeBody && docRev._shallowCopyBody == nil {
 			body := doc.Body()
 			value.lock.Lock()
-			if value.body == nil {
+			if value.body == nil && value.compressor == nil {
 				value.body = body
 			}
 			value.lock.Unlock()
@@ -445,25 +538,25 @@ func (value *revCacheValue) loadForDoc(ctx context.Context, backingStore Revisio
 	if value.bodyBytes != nil || value.err != nil {
 		cacheHit = true
 		// If body is requested and not already present in cache, attempt to generate from bytes and insert into cache
-		if includeBody && value.body == nil {
-			if err := value.body.Unmarshal(value.bodyBytes); err != nil {
-				base.WarnfCtx(ctx, "Unable to marshal BodyBytes in revcache for %s %s", base.UD(value.key.DocID), value.key.RevID)
-			}
+		if includeBody {
+			docRevBody = value.unmarshalBody_(ctx)
 		}
 	} else {
 		cacheHit = false
 		value.bodyBytes, value.body, value.history, value.channels, value.removed, value.attachments, value.deleted, value.expiry, value.err = revCacheLoaderForDocument(ctx, backingStore, doc, value.key.RevID)
-	}
-	if includeBody {
-		docRevBody = value.body
+		if includeBody {
+			docRevBody = value.body
+		}
+		value.compressBody_(compressor)
 	}
 	value.lock.Unlock()
 	docRev, err = value.asDocumentRevision(docRevBody, nil)
 	return docRev, cacheHit, err
 }
 
-// Stores a body etc. into a revCacheValue if there isn't one already.
-func (value *revCacheValue) store(docRev DocumentRevision) {
+// Stores a body etc. into a revCacheValue if there isn't one already, compressing the body with the given compressor
+// if non-nil.
+func (value *revCacheValue) store(docRev DocumentRevision, compressor *revCacheCompressor) {
 	value.lock.Lock()
 	if value.bodyBytes == nil {
 		// value already has doc id/rev id in key
@@ -475,10 +568,35 @@ func (value *revCacheValue) store(docRev DocumentRevision) {
 		value.deleted = docRev.Deleted
 		value.err = nil
 		value.body = docRev._shallowCopyBody.ShallowCopy()
+		value.compressBody_(compressor)
 	}
 	value.lock.Unlock()
 }
 
+// revCacheValueOverheadBytes is the estimated size of a revCacheValue and its cache entry, excluding the revision's
+// variable length data.
+const revCacheValueOverheadBytes = 256
+
+// size returns the estimated memory used by the revision, including the body as stored, compressed or otherwise.  The
+// unmarshalled body isn't included, as it's only populated on demand, and can't be measured cheaply.
+func (value *revCacheValue) size() int64 {
+	value.lock.RLock()
+	defer value.lock.RUnlock()
+	size := revCacheValueOverheadBytes + len(value.key.DocID) + len(value.key.RevID) + len(value.bodyBytes)
+	if digests, ok := value.history[RevisionsIds].([]string); ok {
+		for _, digest := range digests {
+			size += len(digest)
+		}
+	}
+	for channelName := range value.channels {
+		size += len(channelName)
+	}
+	if value.delta != nil {
+		size += len(value.delta.DeltaBytes)
+	}
+	return int64(size)
+}
+
 func (value *revCacheValue) updateDelta(toDelta RevisionDelta) {
 	value.lock.Lock()
 	value.delta = &toDelta
@@ -15,6 +15,7 @@ import (
 	"fmt"
 	"math/rand"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 
@@ -79,7 +80,7 @@ func (*noopBackingStore) getRevision(ctx context.Context, doc *Document, revid s
 // Tests the eviction from the LRURevisionCache
 func TestLRURevisionCacheEviction(t *testing.T) {
 	cacheHitCounter, cacheMissCounter := base.SgwIntStat{}, base.SgwIntStat{}
-	cache := NewLRURevisionCache(10, &noopBackingStore{}, &cacheHitCounter, &cacheMissCounter)
+	cache := NewLRURevisionCache(10, 0, &noopBackingStore{}, &cacheHitCounter, &cacheMissCounter, &base.SgwIntStat{}, &base.SgwIntStat{})
 
 	ctx := base.TestCtx(t)
 
@@ -129,10 +130,84 @@ func TestLRURevisionCacheEviction(t *testing.T) {
 	}
 }
 
+// Tests the memory-based eviction from the LRURevisionCache
+func TestLRURevisionCacheMemoryEviction(t *testing.T) {
+	cacheHitCounter, cacheMissCounter, cacheBytes, cacheEvictedBytes := base.SgwIntStat{}, base.SgwIntStat{}, base.SgwIntStat{}, base.SgwIntStat{}
+	smallBody := []byte(`{}`)
+	largeBody := []byte(`{"value":"` + strings.Repeat("a", 1000) + `"}`)
+	smallSize := (&revCacheValue{key: IDAndRev{DocID: "0", RevID: "1-abc"}, bodyBytes: smallBody}).size()
+	largeSize := (&revCacheValue{key: IDAndRev{DocID: "large", RevID: "1-abc"}, bodyBytes: largeBody}).size()
+
+	// Room for 10 small docs by count, but fewer by size once a large doc is added
+	cache := NewLRURevisionCache(10, 5*smallSize+largeSize, &noopBackingStore{}, &cacheHitCounter, &cacheMissCounter, &cacheBytes, &cacheEvictedBytes)
+
+	ctx := base.TestCtx(t)
+
+	for docID := 0; docID < 8; docID++ {
+		cache.Put(ctx, DocumentRevision{BodyBytes: smallBody, DocID: strconv.Itoa(docID), RevID: "1-abc", History: Revisions{"start": 1}})
+	}
+	assert.Equal(t, 8*smallSize, cacheBytes.Value())
+	assert.Equal(t, int64(0), cacheEvictedBytes.Value())
+
+	// Adding the large doc evicts the least recently used small docs until the cache is within its memory limit
+	cache.Put(ctx, DocumentRevision{BodyBytes: largeBody, DocID: "large", RevID: "1-abc", History: Revisions{"start": 1}})
+	assert.Equal(t, 5*smallSize+largeSize, cacheBytes.Value())
+	assert.Equal(t, 3*smallSize, cacheEvictedBytes.Value())
+	for docID := 0; docID < 8; docID++ {
+		_, ok := cache.Peek(ctx, strconv.Itoa(docID), "1-abc")
+		assert.Equal(t, docID >= 3, ok, "doc %d", docID)
+	}
+	_, ok := cache.Peek(ctx, "large", "1-abc")
+	assert.True(t, ok)
+
+	// Removing a revision releases its size
+	cache.removeValue(cache.getValue("large", "1-abc", false))
+	assert.Equal(t, 5*smallSize, cacheBytes.Value())
+}
+
+// Tests that bodies are stored compressed, and decompressed when read from the LRURevisionCache
+func TestLRURevisionCacheCompression(t *testing.T) {
+	for _, compression := range []string{RevCacheCompressionSnappy, RevCacheCompressionZstd} {
+		t.Run(compression, func(t *testing.T) {
+			cacheStats := (base.NewSyncGatewayStats()).NewDBStats("", false, false, false).Cache()
+			cache, ok := NewRevisionCache(&RevisionCacheOptions{Size: 10, ShardCount: 1, Compression: compression}, &noopBackingStore{}, cacheStats).(*LRURevisionCache)
+			require.True(t, ok)
+			ctx := base.TestCtx(t)
+
+			largeBody := []byte(`{"value":"` + strings.Repeat("a", 1000) + `"}`)
+			smallBody := []byte(`{"value":"a"}`)
+			cache.Put(ctx, DocumentRevision{BodyBytes: largeBody, DocID: "large", RevID: "1-abc", History: Revisions{"start": 1}, _shallowCopyBody: Body{"value": strings.Repeat("a", 1000)}})
+			cache.Put(ctx, DocumentRevision{BodyBytes: smallBody, DocID: "small", RevID: "1-abc", History: Revisions{"start": 1}})
+
+			// Only the large body is worth compressing, and its unmarshalled body isn't retained
+			largeValue := cache.getValue("large", "1-abc", false)
+			assert.NotNil(t, largeValue.compressor)
+			assert.Less(t, len(largeValue.bodyBytes), len(largeBody))
+			assert.Nil(t, largeValue.body)
+			assert.Nil(t, cache.getValue("small", "1-abc", false).compressor)
+			assert.Equal(t, int64(len(largeBody)), cacheStats.RevisionCacheUncompressedBodyBytes.Value())
+			assert.Equal(t, int64(len(largeValue.bodyBytes)), cacheStats.RevisionCacheCompressedBodyBytes.Value())
+			assert.Equal(t, largeValue.size()+cache.getValue("small", "1-abc", false).size(), cacheStats.RevisionCacheBytes.Value())
+
+			docRev, err := cache.Get(ctx, "large", "1-abc", RevCacheIncludeBody, RevCacheOmitDelta)
+			require.NoError(t, err)
+			assert.Equal(t, largeBody, docRev.BodyBytes)
+			body, err := docRev.Body()
+			require.NoError(t, err)
+			assert.Equal(t, strings.Repeat("a", 1000), body["value"])
+			assert.Nil(t, largeValue.body)
+
+			docRev, err = cache.Get(ctx, "small", "1-abc", RevCacheOmitBody, RevCacheOmitDelta)
+			require.NoError(t, err)
+			assert.Equal(t, smallBody, docRev.BodyBytes)
+		})
+	}
+}
+
 func TestBackingStore(t *testing.T) {
 
 	cacheHitCounter, cacheMissCounter, getDocumentCounter, getRevisionCounter := base.SgwIntStat{}, base.SgwIntStat{}, base.SgwIntStat{}, base.SgwIntStat{}
-	cache := NewLRURevisionCache(10, &testBackingStore{[]string{"Peter"}, &getDocumentCounter, &getRevisionCounter}, &cacheHitCounter, &cacheMissCounter)
+	cache := NewLRURevisionCache(10, 0, &testBackingStore{[]string{"Peter"}, &getDocumentCounter, &getRevisionCounter}, &cacheHitCounter, &cacheMissCounter, &base.SgwIntStat{}, &base.SgwIntStat{})
 
 	// Get Rev for the first time - miss cache, but fetch the doc and revision to store
 	docRev, err := cache.Get(base.TestCtx(t), "Jens", "1-abc", RevCacheOmitBody, RevCacheOmitDelta)
@@ -374,7 +449,7 @@ func TestPutExistingRevRevisionCacheAttachmentProperty(t *testing.T) {
 // Ensure subsequent updates to delta don't mutate previously retrieved deltas
 func TestRevisionImmutableDelta(t *testing.T) {
 	cacheHitCounter, cacheMissCounter, getDocumentCounter, getRevisionCounter := base.SgwIntStat{}, base.SgwIntStat{}, base.SgwIntStat{}, base.SgwIntStat{}
-	cache := NewLRURevisionCache(10, &testBackingStore{nil, &getDocumentCounter, &getRevisionCounter}, &cacheHitCounter, &cacheMissCounter)
+	cache := NewLRURevisionCache(10, 0, &testBackingStore{nil, &getDocumentCounter, &getRevisionCounter}, &cacheHitCounter, &cacheMissCounter, &base.SgwIntStat{}, &base.SgwIntStat{})
 
 	firstDelta := []byte("delta")
 	secondDelta := []byte("modified delta")
@@ -409,7 +484,7 @@ func TestRevisionImmutableDelta(t *testing.T) {
 // Ensure subsequent updates to delta don't mutate previously retrieved deltas
 func TestSingleLoad(t *testing.T) {
 	cacheHitCounter, cacheMissCounter, getDocumentCounter, getRevisionCounter := base.SgwIntStat{}, base.SgwIntStat{}, base.SgwIntStat{}, base.SgwIntStat{}
-	cache := NewLRURevisionCache(10, &testBackingStore{nil, &getDocumentCounter, &getRevisionCounter}, &cacheHitCounter, &cacheMissCounter)
+	cache := NewLRURevisionCache(10, 0, &testBackingStore{nil, &getDocumentCounter, &getRevisionCounter}, &cacheHitCounter, &cacheMissCounter, &base.SgwIntStat{}, &base.SgwIntStat{})
 
 	cache.Put(base.TestCtx(t), DocumentRevision{BodyBytes: []byte(`{"test":"1234"}`), DocID: "doc123", RevID: "1-abc", History: Revisions{"start": 1}})
 	_, err := cache.Get(base.TestCtx(t), "doc123", "1-abc", true, false)
@@ -419,7 +494,7 @@ func TestSingleLoad(t *testing.T) {
 // Ensure subsequent updates to delta don't mutate previously retrieved deltas
 func TestConcurrentLoad(t *testing.T) {
 	cacheHitCounter, cacheMissCounter, getDocumentCounter, getRevisionCounter := base.SgwIntStat{}, base.SgwIntStat{}, base.SgwIntStat{}, base.SgwIntStat{}
-	cache := NewLRURevisionCache(10, &testBackingStore{nil, &getDocumentCounter, &getRevisionCounter}, &cacheHitCounter, &cacheMissCounter)
+	cache := NewLRURevisionCache(10, 0, &testBackingStore{nil, &getDocumentCounter, &getRevisionCounter}, &cacheHitCounter, &cacheMissCounter, &base.SgwIntStat{}, &base.SgwIntStat{})
 
 	cache.Put(base.TestCtx(t), DocumentRevision{BodyBytes: []byte(`{"test":"1234"}`), DocID: "doc1", RevID: "1-abc", History: Revisions{"start": 1}})
 
@@ -482,7 +557,7 @@ func BenchmarkRevisionCacheRead(b *testing.B) {
 	base.SetUpBenchmarkLogging(b, base.LevelDebug, base.KeyAll)
 
 	cacheHitCounter, cacheMissCounter, getDocumentCounter, getRevisionCounter := base.SgwIntStat{}, base.SgwIntStat{}, base.SgwIntStat{}, base.SgwIntStat{}
-	cache := NewLRURevisionCache(5000, &testBackingStore{nil, &getDocumentCounter, &getRevisionCounter}, &cacheHitCounter, &cacheMissCounter)
+	cache := NewLRURevisionCache(5000, 0, &testBackingStore{nil, &getDocumentCounter, &getRevisionCounter}, &cacheHitCounter, &cacheMissCounter, &base.SgwIntStat{}, &base.SgwIntStat{})
 
 	ctx := base.TestCtx(b)
 
@@ -26,8 +26,13 @@ const (
 	// Maximum time to wait after a reserve before releasing sequences
 	defaultReleaseSequenceWait = 1500 * time.Millisecond
 
-	// Maximum batch size
-	maxBatchSize = 10
+	// DefaultMaxSequenceBatchSize is the default maximum number of sequences reserved by a single increment of the
+	// sequence counter
+	DefaultMaxSequenceBatchSize = 10
+
+	// MaxSequenceBatchSizeLimit is the largest supported maximum batch size.  Reserved sequences that aren't allocated
+	// within releaseSequenceWait are released, so larger batches mostly add release overhead.
+	MaxSequenceBatchSizeLimit = 10000
 
 	// Factor by which to grow the sequence batch size
 	sequenceBatchMultiplier = 2
@@ -41,31 +46,50 @@ const (
 // in batch size.  Defined as var to simplify test usage
 var MaxSequenceIncrFrequency = 1000 * time.Millisecond
 
+// sequenceAllocator allocates sequences from batches reserved by incrementing the _sync:seq counter.  The batch size
+// adapts to the rate of allocation - it grows while batches are used up faster than MaxSequenceIncrFrequency, up to
+// maxBatchSize, and shrinks by the number of sequences left unused when a batch is released.
+//
+// Each reserved batch is leased for releaseSequenceWait.  Sequences that haven't been allocated when the lease expires
+// are released rather than allocated, so that every reserved sequence is either allocated or released within
+// releaseSequenceWait of being reserved.  Other nodes rely on this when waiting for released sequences on startup.
 type sequenceAllocator struct {
-	bucket                  base.Bucket         // Bucket whose counter to use
-	dbStats                 *base.DatabaseStats // For updating per-db sequence allocation stats
-	mutex                   sync.Mutex          // Makes this object thread-safe
-	last                    uint64              // The last sequence allocated by this allocator.
-	max                     uint64              // The range from (last+1) to max represents previously reserved sequences available for use.
-	terminator              chan struct{}       // Terminator for releaseUnusedSequences goroutine
-	reserveNotify           chan struct{}       // Channel for reserve notifications
-	sequenceBatchSize       uint64              // Current sequence allocation batch size
-	lastSequenceReserveTime time.Time           // Time of most recent sequence reserve
-	releaseSequenceWait     time.Duration       // Supports test customization
+	bucket                   base.Bucket                           // Bucket whose counter to use
+	dbStats                  *base.DatabaseStats                   // For updating per-db sequence allocation stats
+	mutex                    sync.Mutex                            // Makes this object thread-safe
+	last                     uint64                                // The last sequence allocated by this allocator.
+	max                      uint64                                // The range from (last+1) to max represents previously reserved sequences available for use.
+	terminator               chan struct{}                         // Terminator for releaseUnusedSequences goroutine
+	reserveNotify            chan struct{}                         // Channel for reserve notifications
+	sequenceBatchSize        uint64                                // Current sequence allocation batch size
+	maxBatchSize             uint64                                // Maximum sequence allocation batch size
+	lastSequenceReserveTime  time.Time                             // Time of most recent sequence reserve
+	leaseExpiry              time.Time                             // Time after which the sequences in the current batch are released rather than allocated
+	releaseSequenceWait      time.Duration                         // Supports test customization
+	releasedSequenceCallback func(fromSequence, toSequence uint64) // Optional callback to report released sequences to the local change cache
+	clock                    base.Clock                            // Times batch leases and the release of unused sequences
 }
 
-func newSequenceAllocator(bucket base.Bucket, dbStatsMap *base.DatabaseStats) (*sequenceAllocator, error) {
+// newSequenceAllocator creates a sequence allocator with the given maximum batch size, or DefaultMaxSequenceBatchSize
+// if zero.  A nil clock uses the system clock.
+func newSequenceAllocator(bucket base.Bucket, dbStatsMap *base.DatabaseStats, maxBatchSize uint64, clock base.Clock) (*sequenceAllocator, error) {
 	if dbStatsMap == nil {
 		return nil, fmt.Errorf("dbStatsMap parameter must be non-nil")
 	}
+	if maxBatchSize == 0 {
+		maxBatchSize = DefaultMaxSequenceBatchSize
+	}
 
 	s := &sequenceAllocator{
-		bucket:  bucket,
-		dbStats: dbStatsMap,
+		bucket:       bucket,
+		dbStats:      dbStatsMap,
+		maxBatchSize: maxBatchSize,
+		clock:        base.ClockOrDefault(clock),
 	}
 	s.terminator = make(chan struct{})
 	s.sequenceBatchSize = idleBatchSize
 	s.releaseSequenceWait = defaultReleaseSequenceWait
+	s.dbStats.SequenceBatchSize.Set(int64(s.sequenceBatchSize))
 
 	// The reserveNotify channel manages communication between the releaseSequenceMonitor goroutine and _reserveSequenceRange invocations.
 	s.reserveNotify = make(chan struct{}, 1)
@@ -84,13 +108,20 @@ func (s *sequenceAllocator) Stop() {
 	s.releaseUnusedSequences()
 }
 
+// setReleasedSequenceCallback sets the callback used to report released sequences to the local change cache.
+func (s *sequenceAllocator) setReleasedSequenceCallback(callback func(fromSequence, toSequence uint64)) {
+	s.mutex.Lock()
+	s.releasedSequenceCallback = callback
+	s.mutex.Unlock()
+}
+
 // Release sequence monitor runs in its own goroutine, and releases allocated sequences
 // that aren't used within 'releaseSequenceTimeout'.
 func (s *sequenceAllocator) releaseSequenceMonitor() {
 
 	// Terminator is only checked while in idle state - ensures sequence allocation drains and
 	// unused sequences are released before exiting.
-	timer := time.NewTimer(math.MaxInt64)
+	timer := s.clock.NewTimer(math.MaxInt64)
 	defer timer.Stop()
 
 	for {
@@ -99,7 +130,7 @@ func (s *sequenceAllocator) releaseSequenceMonitor() {
 			// On reserve, start the timer to release unused sequences. A new reserve resets the timer.
 			// On timeout, release sequences and return to idle state
 			_ = timer.Reset(s.releaseSequenceWait)
-		case <-timer.C:
+		case <-timer.C():
 			s.releaseUnusedSequences()
 		case <-s.terminator:
 			s.releaseUnusedSequences()
@@ -111,15 +142,24 @@ func (s *sequenceAllocator) releaseSequenceMonitor() {
 // Releases any currently reserved, non-allocated sequences.
 func (s *sequenceAllocator) releaseUnusedSequences() {
 	s.mutex.Lock()
-	if s.last == s.max {
-		s.mutex.Unlock()
-		return
+	fromSequence, toSequence, released := s._releaseUnusedSequences()
+	s.mutex.Unlock()
+
+	if released {
+		s.notifyReleasedSequences(fromSequence, toSequence)
 	}
-	if s.last < s.max {
-		err := s.releaseSequenceRange(s.last+1, s.max)
-		if err != nil {
-			base.WarnfCtx(context.TODO(), "Error returned when releasing sequence range [%d-%d]. Falling back to skipped sequence handling.  Error:%v", s.last+1, s.max, err)
-		}
+}
+
+// _releaseUnusedSequences releases any currently reserved, non-allocated sequences, and returns the range released.
+// Requires the mutex - callers must call notifyReleasedSequences for the range after releasing the mutex.
+func (s *sequenceAllocator) _releaseUnusedSequences() (fromSequence, toSequence uint64, released bool) {
+	if s.last >= s.max {
+		return 0, 0, false
+	}
+	fromSequence, toSequence = s.last+1, s.max
+	err := s.releaseSequenceRange(fromSequence, toSequence)
+	if err != nil {
+		base.WarnfCtx(context.TODO(), "Error returned when releasing sequence range [%d-%d]. Falling back to skipped sequence handling.  Error:%v", fromSequence, toSequence, err)
 	}
 	// Reduce batch size for next incr by the unused amount
 	unusedAmount := s.max - s.last
@@ -132,9 +172,18 @@ func (s *sequenceAllocator) releaseUnusedSequences() {
 		// Some sequences were used - reduce batch size by the unused amount.
 		s.sequenceBatchSize = s.sequenceBatchSize - unusedAmount
 	}
+	s.dbStats.SequenceBatchSize.Set(int64(s.sequenceBatchSize))
 
 	s.last = s.max
-	s.mutex.Unlock()
+	return fromSequence, toSequence, err == nil
+}
+
+// notifyReleasedSequences reports released sequences to the local change cache, so that it doesn't have to wait for
+// the unused sequence document to arrive over the cache feed before moving past them.
+func (s *sequenceAllocator) notifyReleasedSequences(fromSequence, toSequence uint64) {
+	if s.releasedSequenceCallback != nil {
+		s.releasedSequenceCallback(fromSequence, toSequence)
+	}
 }
 
 // Retrieves the last allocated sequence.  If there hasn't been an allocation yet by this node,
@@ -160,11 +209,22 @@ func (s *sequenceAllocator) lastSequence() (uint64, error) {
 // and increments s.last.
 // If no previously reserved sequences are available, reserves new batch.
 func (s *sequenceAllocator) nextSequence() (sequence uint64, err error) {
+	startTime := s.clock.Now()
 	s.mutex.Lock()
 	sequencesReserved := false
+
+	// If the current batch's lease has expired, its remaining sequences are released rather than allocated
+	var releasedFrom, releasedTo uint64
+	var released bool
+	if s.last < s.max && startTime.After(s.leaseExpiry) {
+		releasedFrom, releasedTo, released = s._releaseUnusedSequences()
+	}
 	if s.last >= s.max {
 		if err := s._reserveSequenceRange(); err != nil {
 			s.mutex.Unlock()
+			if released {
+				s.notifyReleasedSequences(releasedFrom, releasedTo)
+			}
 			return 0, err
 		}
 		sequencesReserved = true
@@ -173,13 +233,17 @@ func (s *sequenceAllocator) nextSequence() (sequence uint64, err error) {
 	sequence = s.last
 	s.mutex.Unlock()
 
+	// Released sequences are reported, and the release sequence monitor notified, after the mutex is released.
+	if released {
+		s.notifyReleasedSequences(releasedFrom, releasedTo)
+	}
 	// If sequences were reserved, send notification to the release sequence monitor, to start the clock for releasing these sequences.
-	// Must be done after mutex is released.
 	if sequencesReserved {
 		s.reserveNotify <- struct{}{}
 	}
 
 	s.dbStats.SequenceAssignedCount.Add(1)
+	s.dbStats.SequenceWaitTime.Add(s.clock.Since(startTime).Nanoseconds())
 	return sequence, nil
 }
 
@@ -189,11 +253,12 @@ func (s *sequenceAllocator) _reserveSequenceRange() error {
 	// If the time elapsed since the last reserveSequenceRange invocation reserve is shorter than our target frequency,
 	// this indicates we're making an incr call more frequently than we want to.  Triggers an increase in batch size to
 	// reduce incr frequency.
-	if time.Since(s.lastSequenceReserveTime) < MaxSequenceIncrFrequency {
+	if s.clock.Since(s.lastSequenceReserveTime) < MaxSequenceIncrFrequency {
 		s.sequenceBatchSize = uint64(s.sequenceBatchSize * sequenceBatchMultiplier)
-		if s.sequenceBatchSize > maxBatchSize {
-			s.sequenceBatchSize = maxBatchSize
+		if s.sequenceBatchSize > s.maxBatchSize {
+			s.sequenceBatchSize = s.maxBatchSize
 		}
+		s.dbStats.SequenceBatchSize.Set(int64(s.sequenceBatchSize))
 		base.DebugfCtx(context.TODO(), base.KeyCRUD, "Increased sequence batch to %d", s.sequenceBatchSize)
 	}
 
@@ -207,7 +272,8 @@ func (s *sequenceAllocator) _reserveSequenceRange() error {
 	// Sync Gateway nodes
 	s.max = max
 	s.last = max - s.sequenceBatchSize
-	s.lastSequenceReserveTime = time.Now()
+	s.lastSequenceReserveTime = s.clock.Now()
+	s.leaseExpiry = s.lastSequenceReserveTime.Add(s.releaseSequenceWait)
 
 	s.dbStats.SequenceReservedCount.Add(int64(s.sequenceBatchSize))
 	return nil
@@ -263,11 +329,11 @@ func (s *sequenceAllocator) releaseSequenceRange(fromSequence, toSequence uint64
 // Used to guarantee assignment of allocated sequences on other nodes.
 func (s *sequenceAllocator) waitForReleasedSequences(startTime time.Time) (waitedFor time.Duration) {
 
-	requiredWait := s.releaseSequenceWait - time.Since(startTime)
+	requiredWait := s.releaseSequenceWait - s.clock.Since(startTime)
 	if requiredWait < 0 {
 		return 0
 	}
 	base.InfofCtx(context.TODO(), base.KeyCache, "Waiting %v for sequence allocation...", requiredWait)
-	time.Sleep(requiredWait)
+	s.clock.Sleep(requiredWait)
 	return requiredWait
 }
@@ -31,10 +31,12 @@ func TestSequenceAllocator(t *testing.T) {
 	// Create a sequence allocator without using constructor, to test without a releaseSequenceMonitor
 	//   - allows manually triggered release
 	a := &sequenceAllocator{
-		bucket:            bucket,
-		dbStats:           testStats,
-		sequenceBatchSize: idleBatchSize,
-		reserveNotify:     make(chan struct{}, 50), // Buffered to allow multiple allocations without releaseSequenceMonitor
+		bucket:              bucket,
+		dbStats:             testStats,
+		sequenceBatchSize:   idleBatchSize,
+		maxBatchSize:        DefaultMaxSequenceBatchSize,
+		releaseSequenceWait: defaultReleaseSequenceWait,
+		reserveNotify:       make(chan struct{}, 50), // Buffered to allow multiple allocations without releaseSequenceMonitor
 	}
 
 	// Set high incr frequency to force batch size increase
@@ -85,6 +87,57 @@ func TestSequenceAllocator(t *testing.T) {
 
 }
 
+// TestSequenceAllocatorLease ensures sequences remaining in a batch whose lease has expired are released rather than
+// allocated, and reported to the released sequence callback.
+func TestSequenceAllocatorLease(t *testing.T) {
+
+	bucket := base.GetTestBucket(t)
+	defer bucket.Close()
+
+	sgw := base.NewSyncGatewayStats()
+	testStats := sgw.NewDBStats("", false, false, false).Database()
+
+	// Create a sequence allocator without using constructor, to test without a releaseSequenceMonitor
+	var releasedFrom, releasedTo uint64
+	a := &sequenceAllocator{
+		bucket:              bucket,
+		dbStats:             testStats,
+		sequenceBatchSize:   idleBatchSize,
+		maxBatchSize:        100,
+		releaseSequenceWait: time.Hour,
+		reserveNotify:       make(chan struct{}, 50), // Buffered to allow multiple allocations without releaseSequenceMonitor
+		releasedSequenceCallback: func(fromSequence, toSequence uint64) {
+			releasedFrom, releasedTo = fromSequence, toSequence
+		},
+	}
+
+	// Set high incr frequency to force batch size increase
+	oldFrequency := MaxSequenceIncrFrequency
+	defer func() { MaxSequenceIncrFrequency = oldFrequency }()
+	MaxSequenceIncrFrequency = 60 * time.Second
+
+	// Batch sizes grow beyond the default maximum, up to the allocator's maximum: 1, 2, 4, 8, 16, 32, 64
+	var nextSequence uint64
+	var err error
+	for i := 0; i < 64; i++ {
+		nextSequence, err = a.nextSequence()
+		require.NoError(t, err)
+	}
+	assert.Equal(t, uint64(64), nextSequence)
+	assert.Equal(t, int64(64), testStats.SequenceBatchSize.Value())
+	assert.Equal(t, int64(127), testStats.SequenceReservedCount.Value())
+	assert.NotZero(t, testStats.SequenceWaitTime.Value())
+
+	// Expire the lease - the remaining sequences in the batch are released rather than allocated
+	a.leaseExpiry = time.Now().Add(-time.Second)
+	nextSequence, err = a.nextSequence()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(65), releasedFrom)
+	assert.Equal(t, uint64(127), releasedTo)
+	assert.Equal(t, int64(63), testStats.SequenceReleasedCount.Value())
+	assert.Equal(t, uint64(128), nextSequence)
+}
+
 func TestReleaseSequencesOnStop(t *testing.T) {
 
 	bucket := base.GetTestBucket(t)
@@ -97,7 +150,7 @@ func TestReleaseSequencesOnStop(t *testing.T) {
 	defer func() { MaxSequenceIncrFrequency = oldFrequency }()
 	MaxSequenceIncrFrequency = 1000 * time.Millisecond
 
-	a, err := newSequenceAllocator(bucket, testStats)
+	a, err := newSequenceAllocator(bucket, testStats, 0, nil)
 	// Reduce sequence wait for Stop testing
 	a.releaseSequenceWait = 10 * time.Millisecond
 	assert.NoError(t, err, "error creating allocator")
@@ -171,7 +224,7 @@ func TestSequenceAllocatorDeadlock(t *testing.T) {
 	defer func() { MaxSequenceIncrFrequency = oldFrequency }()
 	MaxSequenceIncrFrequency = 1000 * time.Millisecond
 
-	a, err = newSequenceAllocator(bucket, testStats)
+	a, err = newSequenceAllocator(bucket, testStats, 0, nil)
 	// Reduce sequence wait for Stop testing
 	a.releaseSequenceWait = 10 * time.Millisecond
 	assert.NoError(t, err, "error creating allocator")
@@ -196,7 +249,7 @@ func TestReleaseSequenceWait(t *testing.T) {
 	sgw := base.NewSyncGatewayStats()
 	testStats := sgw.NewDBStats("", false, false, false).Database()
 
-	a, err := newSequenceAllocator(bucket, testStats)
+	a, err := newSequenceAllocator(bucket, testStats, 0, nil)
 	require.NoError(t, err)
 	defer a.Stop()
 
@@ -219,3 +272,37 @@ func assertNewAllocatorStats(t *testing.T, stats *base.DatabaseStats, incr, rese
 	assert.Equal(t, assigned, stats.SequenceAssignedCount.Value())
 	assert.Equal(t, released, stats.SequenceReleasedCount.Value())
 }
+
+func TestSequenceLeaseExpiryFakeClock(t *testing.T) {
+	bucket := base.GetTestBucket(t)
+	defer bucket.Close()
+
+	sgw := base.NewSyncGatewayStats()
+	testStats := sgw.NewDBStats("", false, false, false).Database()
+
+	clock := base.NewFakeClock(time.Now())
+	a, err := newSequenceAllocator(bucket, testStats, 0, clock)
+	require.NoError(t, err)
+	defer a.Stop()
+
+	// The second allocation within MaxSequenceIncrFrequency reserves a batch of two
+	nextSequence, err := a.nextSequence()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), nextSequence)
+	nextSequence, err = a.nextSequence()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), nextSequence)
+	assertNewAllocatorStats(t, testStats, 2, 3, 2, 0)
+
+	// Once the lease expires, the unused sequence is released rather than allocated
+	clock.Advance(a.releaseSequenceWait + time.Millisecond)
+	nextSequence, err = a.nextSequence()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), nextSequence)
+	assertNewAllocatorStats(t, testStats, 3, 4, 3, 1)
+
+	// Waiting for released sequences advances the clock rather than sleeping
+	startTime := clock.Now()
+	assert.Equal(t, a.releaseSequenceWait, a.waitForReleasedSequences(startTime))
+	assert.Equal(t, a.releaseSequenceWait, clock.Since(startTime))
+}
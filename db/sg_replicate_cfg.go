@@ -57,6 +57,18 @@ const (
 	ConfigErrorInvalidConflictResolutionTypeFmt = "Conflict resolution type is invalid, valid values are %s/%s/%s/%s"
 	ConfigErrorInvalidDirectionFmt              = "Invalid replication direction %q, valid values are %s/%s/%s"
 	ConfigErrorBadChannelsArray                 = "Bad channels array in query_params for sync_gateway/bychannel filter"
+	ConfigErrorRemoteAndRemotes                 = "Replication can specify remote or remotes, but not both"
+	ConfigErrorFanOutDirection                  = "Replication remotes can only be specified for push replications"
+	ConfigErrorDuplicateRemoteFmt               = "Replication remotes contains duplicate remote %q"
+	ConfigErrorClientCertAndKey                 = "Replication client_cert_path and client_key_path must be specified together"
+	ConfigErrorClientCertNameAndPath            = "Replication can specify client_cert or client_cert_path/client_key_path, but not both"
+	ConfigErrorUnknownClientCertFmt             = "Replication client_cert %q is not defined in replicator client_certs"
+	ConfigErrorScheduleContinuous               = "Replication schedule can only be specified for one-shot replications"
+	ConfigErrorScheduleAdhoc                    = "Replication schedule is invalid for replications specifying adhoc=true"
+	ConfigErrorInvalidScheduleFmt               = "Replication schedule is invalid: %v"
+	ConfigErrorBackfillWorkersDirection         = "Replication backfill_workers can only be specified for push replications"
+	ConfigErrorInvalidCollectionsMappingFmt     = "Replication collections_remote_mapping is invalid: %v"
+	ConfigErrorCollectionsMappingMissingFmt     = "Replication collections_remote_mapping does not include the database keyspace %s"
 )
 
 // ClusterUpdateFunc is callback signature used when updating the cluster configuration
@@ -94,10 +106,14 @@ func NewSGNode(uuid string, host string) *SGNode {
 type ReplicationConfig struct {
 	ID                     string                    `json:"replication_id"`
 	Remote                 string                    `json:"remote"`
+	Remotes                []string                  `json:"remotes,omitempty"`
 	Username               string                    `json:"username,omitempty"` // Deprecated
 	Password               string                    `json:"password,omitempty"` // Deprecated
 	RemoteUsername         string                    `json:"remote_username,omitempty"`
 	RemotePassword         string                    `json:"remote_password,omitempty"`
+	ClientCert             string                    `json:"client_cert,omitempty"` // Name of a cert defined in replicator.client_certs
+	ClientCertPath         string                    `json:"client_cert_path,omitempty"`
+	ClientKeyPath          string                    `json:"client_key_path,omitempty"`
 	Direction              ActiveReplicatorDirection `json:"direction"`
 	ConflictResolutionType ConflictResolverType      `json:"conflict_resolution_type,omitempty"`
 	ConflictResolutionFn   string                    `json:"custom_conflict_resolver,omitempty"`
@@ -111,6 +127,10 @@ type ReplicationConfig struct {
 	Adhoc                  bool                      `json:"adhoc,omitempty"`
 	BatchSize              int                       `json:"batch_size,omitempty"`
 	RunAs                  string                    `json:"run_as,omitempty"`
+	Schedule               string                    `json:"schedule,omitempty"`         // Cron expression for periodic one-shot replications
+	BackfillWorkers        int                       `json:"backfill_workers,omitempty"` // Number of parallel workers used for the initial push backfill
+	// Map of local [scope.]collection to the remote [scope.]collection it's replicated with
+	CollectionsRemoteMapping map[string]string `json:"collections_remote_mapping,omitempty"`
 }
 
 func DefaultReplicationConfig() ReplicationConfig {
@@ -138,10 +158,14 @@ type ReplicationCfg struct {
 type ReplicationUpsertConfig struct {
 	ID                     string      `json:"replication_id"`
 	Remote                 *string     `json:"remote"`
+	Remotes                []string    `json:"remotes,omitempty"`
 	Username               *string     `json:"username,omitempty"` // Deprecated
 	Password               *string     `json:"password,omitempty"` // Deprecated
 	RemoteUsername         *string     `json:"remote_username,omitempty"`
 	RemotePassword         *string     `json:"remote_password,omitempty"`
+	ClientCert             *string     `json:"client_cert,omitempty"`
+	ClientCertPath         *string     `json:"client_cert_path,omitempty"`
+	ClientKeyPath          *string     `json:"client_key_path,omitempty"`
 	Direction              *string     `json:"direction"`
 	ConflictResolutionType *string     `json:"conflict_resolution_type,omitempty"`
 	ConflictResolutionFn   *string     `json:"custom_conflict_resolver,omitempty"`
@@ -155,6 +179,10 @@ type ReplicationUpsertConfig struct {
 	Adhoc                  *bool       `json:"adhoc,omitempty"`
 	BatchSize              *int        `json:"batch_size,omitempty"`
 	RunAs                  *string     `json:"run_as,omitempty"`
+	Schedule               *string     `json:"schedule,omitempty"`
+	BackfillWorkers        *int        `json:"backfill_workers,omitempty"`
+	// CollectionsRemoteMapping replaces the existing mapping when specified
+	CollectionsRemoteMapping map[string]string `json:"collections_remote_mapping,omitempty"`
 }
 
 func (rc *ReplicationConfig) ValidateReplication(fromConfig bool) (err error) {
@@ -190,10 +218,65 @@ func (rc *ReplicationConfig) ValidateReplication(fromConfig bool) (err error) {
 		}
 	}
 
-	if rc.Remote == "" {
+	if rc.Remote == "" && len(rc.Remotes) == 0 {
 		return base.HTTPErrorf(http.StatusBadRequest, ConfigErrorMissingRemote)
 	}
 
+	if len(rc.Remotes) > 0 {
+		if err := rc.validateFanOut(); err != nil {
+			return err
+		}
+	}
+
+	if (rc.ClientCertPath == "") != (rc.ClientKeyPath == "") {
+		return base.HTTPErrorf(http.StatusBadRequest, ConfigErrorClientCertAndKey)
+	}
+
+	if rc.ClientCert != "" && rc.ClientCertPath != "" {
+		return base.HTTPErrorf(http.StatusBadRequest, ConfigErrorClientCertNameAndPath)
+	}
+
+	if rc.Schedule != "" {
+		if rc.Continuous {
+			return base.HTTPErrorf(http.StatusBadRequest, ConfigErrorScheduleContinuous)
+		}
+		if rc.Adhoc {
+			return base.HTTPErrorf(http.StatusBadRequest, ConfigErrorScheduleAdhoc)
+		}
+		schedule, err := parseCronSchedule(rc.Schedule)
+		if err != nil {
+			return base.HTTPErrorf(http.StatusBadRequest, ConfigErrorInvalidScheduleFmt, err)
+		}
+		if schedule.next(time.Now()).IsZero() {
+			return base.HTTPErrorf(http.StatusBadRequest, ConfigErrorInvalidScheduleFmt, "schedule never runs")
+		}
+	}
+
+	if rc.BackfillWorkers < 0 {
+		return base.HTTPErrorf(http.StatusBadRequest, "Replication backfill_workers must not be negative")
+	}
+
+	if rc.BackfillWorkers > 1 && rc.Direction != ActiveReplicatorTypePush && rc.Direction != ActiveReplicatorTypePushAndPull {
+		return base.HTTPErrorf(http.StatusBadRequest, ConfigErrorBackfillWorkersDirection)
+	}
+
+	if len(rc.CollectionsRemoteMapping) > 0 {
+		localKeyspaces := make(map[string]struct{}, len(rc.CollectionsRemoteMapping))
+		for local, remote := range rc.CollectionsRemoteMapping {
+			localKeyspace, err := normalizedKeyspace(local)
+			if err != nil {
+				return base.HTTPErrorf(http.StatusBadRequest, ConfigErrorInvalidCollectionsMappingFmt, err)
+			}
+			if _, err := normalizedKeyspace(remote); err != nil {
+				return base.HTTPErrorf(http.StatusBadRequest, ConfigErrorInvalidCollectionsMappingFmt, err)
+			}
+			if _, ok := localKeyspaces[localKeyspace]; ok {
+				return base.HTTPErrorf(http.StatusBadRequest, ConfigErrorInvalidCollectionsMappingFmt, fmt.Sprintf("duplicate keyspace %q", localKeyspace))
+			}
+			localKeyspaces[localKeyspace] = struct{}{}
+		}
+	}
+
 	if !rc.ConflictResolutionType.IsValid() && rc.ConflictResolutionType != "" {
 		return base.HTTPErrorf(http.StatusBadRequest, ConfigErrorInvalidConflictResolutionTypeFmt,
 			ConflictResolverLocalWins, ConflictResolverRemoteWins, ConflictResolverDefault, ConflictResolverCustom)
@@ -243,6 +326,33 @@ func (rc *ReplicationConfig) ValidateReplication(fromConfig bool) (err error) {
 	return nil
 }
 
+// validateFanOut validates the remotes defined for a fan-out replication.
+func (rc *ReplicationConfig) validateFanOut() error {
+	if rc.Remote != "" {
+		return base.HTTPErrorf(http.StatusBadRequest, ConfigErrorRemoteAndRemotes)
+	}
+	if rc.Direction != ActiveReplicatorTypePush {
+		return base.HTTPErrorf(http.StatusBadRequest, ConfigErrorFanOutDirection)
+	}
+
+	targetKeys := make(map[string]struct{}, len(rc.Remotes))
+	for _, remote := range rc.Remotes {
+		remoteURL, err := url.Parse(remote)
+		if err != nil || remote == "" {
+			return base.HTTPErrorf(http.StatusBadRequest, "Replication remote URL is invalid")
+		}
+		if remoteURL.User.Username() != "" && (rc.RemoteUsername != "" || rc.Username != "") {
+			return base.HTTPErrorf(http.StatusBadRequest, ConfigErrorDuplicateCredentials)
+		}
+		targetKey := fanOutTargetKey(remoteURL)
+		if _, ok := targetKeys[targetKey]; ok {
+			return base.HTTPErrorf(http.StatusBadRequest, ConfigErrorDuplicateRemoteFmt, base.RedactBasicAuthURLPassword(remote))
+		}
+		targetKeys[targetKey] = struct{}{}
+	}
+	return nil
+}
+
 // Upsert updates ReplicationConfig with any non-empty properties specified in the incoming replication config.
 // Note that if the intention is to reset the value to default, empty values must be specified.
 func (rc *ReplicationConfig) Upsert(c *ReplicationUpsertConfig) {
@@ -251,6 +361,11 @@ func (rc *ReplicationConfig) Upsert(c *ReplicationUpsertConfig) {
 		rc.Remote = *c.Remote
 	}
 
+	if c.Remotes != nil {
+		rc.Remotes = make([]string, len(c.Remotes))
+		copy(rc.Remotes, c.Remotes)
+	}
+
 	if c.Username != nil {
 		rc.Username = *c.Username
 	}
@@ -267,6 +382,18 @@ func (rc *ReplicationConfig) Upsert(c *ReplicationUpsertConfig) {
 		rc.RemotePassword = *c.RemotePassword
 	}
 
+	if c.ClientCert != nil {
+		rc.ClientCert = *c.ClientCert
+	}
+
+	if c.ClientCertPath != nil {
+		rc.ClientCertPath = *c.ClientCertPath
+	}
+
+	if c.ClientKeyPath != nil {
+		rc.ClientKeyPath = *c.ClientKeyPath
+	}
+
 	if c.Direction != nil {
 		rc.Direction = ActiveReplicatorDirection(*c.Direction)
 	}
@@ -311,6 +438,21 @@ func (rc *ReplicationConfig) Upsert(c *ReplicationUpsertConfig) {
 		rc.RunAs = *c.RunAs
 	}
 
+	if c.Schedule != nil {
+		rc.Schedule = *c.Schedule
+	}
+
+	if c.BackfillWorkers != nil {
+		rc.BackfillWorkers = *c.BackfillWorkers
+	}
+
+	if c.CollectionsRemoteMapping != nil {
+		rc.CollectionsRemoteMapping = make(map[string]string, len(c.CollectionsRemoteMapping))
+		for local, remote := range c.CollectionsRemoteMapping {
+			rc.CollectionsRemoteMapping[local] = remote
+		}
+	}
+
 	if c.QueryParams != nil {
 		// QueryParams can be either []interface{} or map[string]interface{}, so requires type-specific copying
 		// avoid later mutating c.QueryParams
@@ -356,22 +498,31 @@ func (rc *ReplicationConfig) Redacted() *ReplicationConfig {
 		config.RemotePassword = base.RedactedStr
 	}
 	config.Remote = base.RedactBasicAuthURLPassword(config.Remote)
+	if len(config.Remotes) > 0 {
+		config.Remotes = make([]string, len(rc.Remotes))
+		for i, remote := range rc.Remotes {
+			config.Remotes[i] = base.RedactBasicAuthURLPassword(remote)
+		}
+	}
 	return &config
 }
 
 // sgReplicateManager should be used for all interactions with the stored cluster definition.
 type sgReplicateManager struct {
-	cfg                        cbgt.Cfg                      // Key-value store implementation
-	loggingCtx                 context.Context               // logging context for manager operations	// TODO: eval removing or adding custom LogContext
-	heartbeatListener          *ReplicationHeartbeatListener // node heartbeat listener for replication distribution
-	localNodeUUID              string                        // nodeUUID for this SG node
-	activeReplicators          map[string]*ActiveReplicator  // currently assigned replications
-	activeReplicatorsLock      sync.RWMutex                  // Mutex for activeReplications
-	clusterUpdateTerminator    chan struct{}                 // Terminator for cluster update retry
-	clusterSubscribeTerminator chan struct{}                 // Terminator for cluster change monitoring
-	closeWg                    sync.WaitGroup                // Teardown waitgroup for subscribe and retry goroutines
-	dbContext                  *DatabaseContext              // reference to the parent DatabaseContext
-	CheckpointInterval         time.Duration                 // The value to be used for time-based checkpoints
+	cfg                        cbgt.Cfg                        // Key-value store implementation
+	loggingCtx                 context.Context                 // logging context for manager operations	// TODO: eval removing or adding custom LogContext
+	heartbeatListener          *ReplicationHeartbeatListener   // node heartbeat listener for replication distribution
+	localNodeUUID              string                          // nodeUUID for this SG node
+	activeReplicators          map[string]*ActiveReplicator    // currently assigned replications
+	activeReplicatorsLock      sync.RWMutex                    // Mutex for activeReplications
+	clusterUpdateTerminator    chan struct{}                   // Terminator for cluster update retry
+	clusterSubscribeTerminator chan struct{}                   // Terminator for cluster change monitoring
+	closeWg                    sync.WaitGroup                  // Teardown waitgroup for subscribe and retry goroutines
+	dbContext                  *DatabaseContext                // reference to the parent DatabaseContext
+	CheckpointInterval         time.Duration                   // The value to be used for time-based checkpoints
+	schedules                  map[string]*replicationSchedule // Schedule and run history for scheduled replications assigned to this node
+	schedulesLock              sync.Mutex                      // Mutex for schedules
+	schedulesSaveLock          sync.Mutex                      // Serialises persistence of the run histories in schedules
 }
 
 // alignState attempts to update the current replicator state to align with the provided targetState, if
@@ -466,6 +617,7 @@ func NewSGReplicateManager(ctx context.Context, dbContext *DatabaseContext, cfg
 		dbContext:                  dbContext,
 		activeReplicators:          make(map[string]*ActiveReplicator),
 		CheckpointInterval:         DefaultCheckpointInterval,
+		schedules:                  make(map[string]*replicationSchedule),
 	}, nil
 
 }
@@ -521,6 +673,7 @@ func (m *sgReplicateManager) StartReplications(ctx context.Context) error {
 			}
 		}
 	}
+	m.startScheduler(ctx)
 	return m.SubscribeCfgChanges(ctx)
 }
 
@@ -549,6 +702,8 @@ func (m *sgReplicateManager) NewActiveReplicatorConfig(config *ReplicationCfg) (
 		InsecureSkipVerify: insecureSkipVerify,
 		CheckpointInterval: m.CheckpointInterval,
 		RunAs:              config.RunAs,
+		Schedule:           config.Schedule,
+		BackfillWorkers:    config.BackfillWorkers,
 	}
 
 	rc.MaxReconnectInterval = defaultMaxReconnectInterval
@@ -592,15 +747,10 @@ func (m *sgReplicateManager) NewActiveReplicatorConfig(config *ReplicationCfg) (
 		rc.ConflictResolutionType = config.ConflictResolutionType
 	}
 
-	if config.Remote == "" {
+	if config.Remote == "" && len(config.Remotes) == 0 {
 		return nil, fmt.Errorf("Replication remote must not be empty")
 	}
 
-	rc.RemoteDBURL, err = url.Parse(config.Remote)
-	if err != nil {
-		return nil, err
-	}
-
 	// If auth credentials are explicitly defined in the replication configuration,
 	// enrich remote database URL connection string with the supplied auth credentials.
 	username := config.Username
@@ -612,8 +762,37 @@ func (m *sgReplicateManager) NewActiveReplicatorConfig(config *ReplicationCfg) (
 		username = config.RemoteUsername
 		password = config.RemotePassword
 	}
-	if username != "" {
-		rc.RemoteDBURL.User = url.UserPassword(username, password)
+
+	if len(config.Remotes) > 0 {
+		rc.FanOutRemoteDBURLs = make([]*url.URL, 0, len(config.Remotes))
+		for _, remote := range config.Remotes {
+			remoteDBURL, err := url.Parse(remote)
+			if err != nil {
+				return nil, err
+			}
+			if username != "" {
+				remoteDBURL.User = url.UserPassword(username, password)
+			}
+			rc.FanOutRemoteDBURLs = append(rc.FanOutRemoteDBURLs, remoteDBURL)
+		}
+	} else {
+		rc.RemoteDBURL, err = url.Parse(config.Remote)
+		if err != nil {
+			return nil, err
+		}
+		if username != "" {
+			rc.RemoteDBURL.User = url.UserPassword(username, password)
+		}
+	}
+
+	rc.ClientCertPath, rc.ClientKeyPath, err = m.clientCertPaths(&config.ReplicationConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	rc.RemoteKeyspace, err = m.remoteKeyspace(&config.ReplicationConfig)
+	if err != nil {
+		return nil, err
 	}
 
 	rc.WebsocketPingInterval = m.dbContext.Options.SGReplicateOptions.WebsocketPingInterval
@@ -623,6 +802,56 @@ func (m *sgReplicateManager) NewActiveReplicatorConfig(config *ReplicationCfg) (
 	return rc, nil
 }
 
+// clientCertPaths returns the paths of the TLS client certificate and key the replication should present to the remote,
+// resolving a named client_cert against the certs defined in the replicator config.
+func (m *sgReplicateManager) clientCertPaths(config *ReplicationConfig) (certPath, keyPath string, err error) {
+	if config.ClientCert == "" {
+		return config.ClientCertPath, config.ClientKeyPath, nil
+	}
+	clientCert, ok := m.dbContext.Options.SGReplicateOptions.ClientCerts[config.ClientCert]
+	if !ok {
+		return "", "", base.HTTPErrorf(http.StatusBadRequest, ConfigErrorUnknownClientCertFmt, config.ClientCert)
+	}
+	return clientCert.CertPath, clientCert.KeyPath, nil
+}
+
+// remoteKeyspace returns the remote keyspace mapped to the database's keyspace by the replication's
+// collections_remote_mapping, or an empty string when no mapping is defined.
+func (m *sgReplicateManager) remoteKeyspace(config *ReplicationConfig) (string, error) {
+	if len(config.CollectionsRemoteMapping) == 0 {
+		return "", nil
+	}
+
+	scope, collection := base.DefaultScope, base.DefaultCollection
+	if m.dbContext.BucketSpec.Scope != nil {
+		scope = *m.dbContext.BucketSpec.Scope
+	}
+	if m.dbContext.BucketSpec.Collection != nil {
+		collection = *m.dbContext.BucketSpec.Collection
+	}
+	dbKeyspace := scope + base.ScopeCollectionSeparator + collection
+
+	for local, remote := range config.CollectionsRemoteMapping {
+		localKeyspace, err := normalizedKeyspace(local)
+		if err != nil {
+			return "", base.HTTPErrorf(http.StatusBadRequest, ConfigErrorInvalidCollectionsMappingFmt, err)
+		}
+		if localKeyspace == dbKeyspace {
+			return normalizedKeyspace(remote)
+		}
+	}
+	return "", base.HTTPErrorf(http.StatusBadRequest, ConfigErrorCollectionsMappingMissingFmt, dbKeyspace)
+}
+
+// normalizedKeyspace returns the given [scope.]collection as scope.collection, using the default scope when omitted.
+func normalizedKeyspace(keyspace string) (string, error) {
+	scope, collection, err := parseScopeAndCollection(keyspace)
+	if err != nil {
+		return "", err
+	}
+	return *scope + base.ScopeCollectionSeparator + *collection, nil
+}
+
 func (m *sgReplicateManager) isCfgChanged(newCfg *ReplicationCfg, activeCfg *ActiveReplicatorConfig) (bool, error) {
 	newConfig, err := m.NewActiveReplicatorConfig(newCfg)
 	if err != nil {
@@ -647,19 +876,15 @@ func (m *sgReplicateManager) InitializeReplication(config *ReplicationCfg) (repl
 		return nil, cfgErr
 	}
 
-	checkpointPrefix := ""
-	// ClusterUUID is to prevent collisions between multiple remote replication checkpoints (e.g. two edge replications sharing the same ID)
-	if config.ClusterUUID != "" {
-		checkpointPrefix += config.ClusterUUID + ":"
-	}
-	// GroupID is to prevent collisions between multiple local replication checkpoints within different groups.
-	if m.dbContext.Options.GroupID != "" {
-		checkpointPrefix += m.dbContext.Options.GroupID + ":"
-	}
-	rc.checkpointPrefix = checkpointPrefix
+	rc.checkpointPrefix = m.checkpointPrefix(config)
 
-	// Retrieve or create an entry in db.replications expvar for this replication
-	allReplicationsStatsMap := m.dbContext.DbStats.DBReplicatorStats(rc.ID)
+	// Retrieve or create an entry in db.replications expvar for this replication.  Fan-out replications are labelled
+	// by remote on the stats for each target.
+	remote := ""
+	if rc.RemoteDBURL != nil {
+		remote = replicationStatsRemote(rc.RemoteDBURL)
+	}
+	allReplicationsStatsMap := m.dbContext.DbStats.DBReplicatorStatsForRemote(rc.ID, rc.ID, remote)
 	rc.ReplicationStatsMap = allReplicationsStatsMap
 
 	// disable recovered panic reporting (test only)
@@ -670,8 +895,23 @@ func (m *sgReplicateManager) InitializeReplication(config *ReplicationCfg) (repl
 	return replicator, nil
 }
 
+// checkpointPrefix returns the prefix used for the local and remote checkpoint IDs of the given replication.
+func (m *sgReplicateManager) checkpointPrefix(config *ReplicationCfg) string {
+	checkpointPrefix := ""
+	// ClusterUUID is to prevent collisions between multiple remote replication checkpoints (e.g. two edge replications sharing the same ID)
+	if config.ClusterUUID != "" {
+		checkpointPrefix += config.ClusterUUID + ":"
+	}
+	// GroupID is to prevent collisions between multiple local replication checkpoints within different groups.
+	if m.dbContext.Options.GroupID != "" {
+		checkpointPrefix += m.dbContext.Options.GroupID + ":"
+	}
+	return checkpointPrefix
+}
+
 // replicationComplete updates the replication status.
 func (m *sgReplicateManager) replicationComplete(replicationID string) {
+	m.scheduledRunComplete(replicationID)
 	err := m.UpdateReplicationState(replicationID, ReplicationStateStopped)
 	if err != nil {
 		base.WarnfCtx(m.loggingCtx, "Unable to update replication state to stopped on completion: %v", err)
@@ -1013,7 +1253,8 @@ func (m *sgReplicateManager) PutReplications(replications map[string]*Replicatio
 				replicationCfg.AssignedNode = existingCfg.AssignedNode
 				replicationCfg.TargetState = existingCfg.TargetState
 			} else {
-				if replication.InitialState == ReplicationStateStopped {
+				// Scheduled replications are started by the scheduler, unless initial_state is explicitly running
+				if replication.InitialState == ReplicationStateStopped || (replication.InitialState == "" && replication.Schedule != "") {
 					replicationCfg.TargetState = ReplicationStateStopped
 				} else {
 					replicationCfg.TargetState = ReplicationStateRunning
@@ -1053,8 +1294,11 @@ func (m *sgReplicateManager) UpsertReplication(replication *ReplicationUpsertCon
 			replicationConfig := DefaultReplicationConfig()
 			replicationConfig.ID = replication.ID
 			targetState := ReplicationStateRunning
+			// Scheduled replications are started by the scheduler, unless initial_state is explicitly running
 			if replication.InitialState != nil && *replication.InitialState == ReplicationStateStopped {
 				targetState = ReplicationStateStopped
+			} else if replication.InitialState == nil && replication.Schedule != nil && *replication.Schedule != "" {
+				targetState = ReplicationStateStopped
 			}
 			cluster.Replications[replication.ID] = &ReplicationCfg{
 				ReplicationConfig: replicationConfig,
@@ -1069,6 +1313,14 @@ func (m *sgReplicateManager) UpsertReplication(replication *ReplicationUpsertCon
 			return true, validateErr
 		}
 
+		if _, _, certErr := m.clientCertPaths(&cluster.Replications[replication.ID].ReplicationConfig); certErr != nil {
+			return true, certErr
+		}
+
+		if _, keyspaceErr := m.remoteKeyspace(&cluster.Replications[replication.ID].ReplicationConfig); keyspaceErr != nil {
+			return true, keyspaceErr
+		}
+
 		cluster.RebalanceReplications()
 		return false, nil
 	}
@@ -1147,7 +1399,13 @@ func (m *sgReplicateManager) DeleteReplication(replicationID string) error {
 		cluster.RebalanceReplications()
 		return false, nil
 	}
-	return m.updateCluster(deleteReplicationCallback)
+	if err := m.updateCluster(deleteReplicationCallback); err != nil {
+		return err
+	}
+	if err := m.removeSchedule(replicationID); err != nil {
+		base.WarnfCtx(m.loggingCtx, "Unable to remove run history for replication %s: %v", base.UD(replicationID), err)
+	}
+	return nil
 }
 
 func (c *SGRCluster) GetReplicationIDsForNode(nodeUUID string) (replicationIDs []string) {
@@ -1252,10 +1510,13 @@ func (a NodesByReplicationCount) Less(i, j int) bool {
 type ReplicationStatus struct {
 	PullReplicationStatus
 	PushReplicationStatus
-	ID           string             `json:"replication_id"`
-	Config       *ReplicationConfig `json:"config,omitempty"`
-	Status       string             `json:"status"`
-	ErrorMessage string             `json:"error_message,omitempty"`
+	ID           string                     `json:"replication_id"`
+	Remote       string                     `json:"remote,omitempty"` // Set for the targets of a fan-out replication
+	Config       *ReplicationConfig         `json:"config,omitempty"`
+	Status       string                     `json:"status"`
+	ErrorMessage string                     `json:"error_message,omitempty"`
+	Targets      []*ReplicationStatus       `json:"targets,omitempty"`  // Per-target status for a fan-out replication
+	Schedule     *ReplicationScheduleStatus `json:"schedule,omitempty"` // Run history for a scheduled replication
 }
 
 type PullReplicationStatus struct {
@@ -1335,22 +1596,32 @@ func (m *sgReplicateManager) GetReplicationStatus(replicationID string, options
 	var remoteCfg *ReplicationCfg
 	if isLocal {
 		status = replication.GetStatus()
+		status.Schedule = m.getScheduleStatus(replicationID)
 	} else {
+		// Fan-out targets persist status under their own checkpoints, so the config is needed to locate them
+		var cfgErr error
+		remoteCfg, cfgErr = m.GetReplication(replicationID)
+
 		// Attempt to retrieve persisted status
 		var loadErr error
-		status, loadErr = LoadReplicationStatus(m.dbContext, replicationID)
+		if cfgErr == nil && len(remoteCfg.Remotes) > 0 {
+			status, loadErr = LoadFanOutReplicationStatus(m.dbContext, replicationID, m.checkpointPrefix(remoteCfg), remoteCfg.Remotes)
+		} else {
+			status, loadErr = LoadReplicationStatus(m.dbContext, replicationID)
+		}
 		if loadErr != nil {
 			// Unable to load persisted status.  Create status stub based on config
-			var err error
-			remoteCfg, err = m.GetReplication(replicationID)
-			if err != nil {
-				return nil, err
+			if cfgErr != nil {
+				return nil, cfgErr
 			}
 			status = &ReplicationStatus{
 				ID:     replicationID,
 				Status: remoteCfg.TargetState,
 			}
 		}
+		if cfgErr == nil {
+			status.Schedule = m.loadScheduleStatus(remoteCfg)
+		}
 	}
 
 	// Add the replication config if requested
@@ -1414,6 +1685,249 @@ func (m *sgReplicateManager) PutReplicationStatus(replicationID, action string)
 	return updatedStatus, nil
 }
 
+// ReplicationCheckpoints is the set of local checkpoints for a replication, as returned by the _checkpoint endpoint.
+type ReplicationCheckpoints struct {
+	ID      string                        `json:"replication_id"`
+	Push    *ReplicationCheckpointState   `json:"push,omitempty"`
+	Pull    *ReplicationCheckpointState   `json:"pull,omitempty"`
+	Targets []*ReplicationCheckpointState `json:"targets,omitempty"` // Push checkpoint per target for a fan-out replication
+}
+
+// ReplicationCheckpointState is the local checkpoint for a single direction of a replication.  LastSeq is a
+// local sequence for push checkpoints, and a remote sequence for pull checkpoints.
+type ReplicationCheckpointState struct {
+	CheckpointID string `json:"checkpoint_id"`
+	Remote       string `json:"remote,omitempty"`
+	Rev          string `json:"rev,omitempty"`
+	LastSeq      string `json:"last_sequence,omitempty"`
+	ConfigHash   string `json:"config_hash,omitempty"`
+}
+
+// fanOutCheckpointIDs returns the push checkpoint ID for each target of a fan-out replication, keyed by redacted remote.
+func (m *sgReplicateManager) fanOutCheckpointIDs(replicationCfg *ReplicationCfg) (map[string]string, error) {
+	checkpointPrefix := m.checkpointPrefix(replicationCfg)
+	checkpointIDs := make(map[string]string, len(replicationCfg.Remotes))
+	for _, remote := range replicationCfg.Remotes {
+		remoteURL, err := url.Parse(remote)
+		if err != nil {
+			return nil, err
+		}
+		targetPrefix := fanOutCheckpointPrefix(checkpointPrefix, fanOutTargetKey(remoteURL))
+		checkpointIDs[base.RedactBasicAuthURLPassword(remote)] = targetPrefix + PushCheckpointID(replicationCfg.ID)
+	}
+	return checkpointIDs, nil
+}
+
+// GET _replicationStatus/{replicationID}/_checkpoint
+func (m *sgReplicateManager) GetReplicationCheckpoints(replicationID string) (*ReplicationCheckpoints, error) {
+	replicationCfg, err := m.GetReplication(replicationID)
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoints := &ReplicationCheckpoints{ID: replicationID}
+	if len(replicationCfg.Remotes) > 0 {
+		checkpointIDs, err := m.fanOutCheckpointIDs(replicationCfg)
+		if err != nil {
+			return nil, err
+		}
+		for _, remote := range replicationCfg.Remotes {
+			redactedRemote := base.RedactBasicAuthURLPassword(remote)
+			targetState, err := m.getCheckpointState(checkpointIDs[redactedRemote])
+			if err != nil {
+				return nil, err
+			}
+			targetState.Remote = redactedRemote
+			checkpoints.Targets = append(checkpoints.Targets, targetState)
+		}
+		return checkpoints, nil
+	}
+
+	checkpointPrefix := m.checkpointPrefix(replicationCfg)
+	if replicationCfg.Direction == ActiveReplicatorTypePush || replicationCfg.Direction == ActiveReplicatorTypePushAndPull {
+		checkpoints.Push, err = m.getCheckpointState(checkpointPrefix + PushCheckpointID(replicationID))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if replicationCfg.Direction == ActiveReplicatorTypePull || replicationCfg.Direction == ActiveReplicatorTypePushAndPull {
+		checkpoints.Pull, err = m.getCheckpointState(checkpointPrefix + PullCheckpointID(replicationID))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return checkpoints, nil
+}
+
+func (m *sgReplicateManager) getCheckpointState(checkpointID string) (*ReplicationCheckpointState, error) {
+	checkpoint, err := getLocalCheckpoint(m.dbContext, checkpointID)
+	if err != nil {
+		return nil, err
+	}
+	state := &ReplicationCheckpointState{CheckpointID: checkpointID}
+	if checkpoint != nil {
+		state.Rev = checkpoint.Rev
+		state.LastSeq = checkpoint.LastSeq
+		state.ConfigHash = checkpoint.ConfigHash
+	}
+	return state, nil
+}
+
+// POST _replicationStatus/{replicationID}/_checkpoint/reset
+//
+// ResetReplicationCheckpoints rolls back the local checkpoints of a stopped replication.  When seq is empty the
+// checkpoints are removed, and the replication restarts from zero.  Otherwise the checkpoint for the given direction
+// is rewritten to seq, which must not be later than the currently checkpointed sequence.  The remote checkpoint doesn't
+// need to be modified, as the checkpointer resumes from (and rolls back to) the lower of the local and remote checkpoints.
+// For fan-out replications, the checkpoints of all targets are reset.
+func (m *sgReplicateManager) ResetReplicationCheckpoints(replicationID string, direction ActiveReplicatorDirection, seq string) (*ReplicationCheckpoints, error) {
+	replicationCfg, err := m.GetReplication(replicationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if replicationCfg.TargetState != ReplicationStateStopped {
+		return nil, base.HTTPErrorf(http.StatusBadRequest, "Replication must be stopped before its checkpoints can be reset")
+	}
+	m.activeReplicatorsLock.RLock()
+	activeReplicator, isLocal := m.activeReplicators[replicationID]
+	m.activeReplicatorsLock.RUnlock()
+	if isLocal {
+		if state, _ := activeReplicator.State(); state != ReplicationStateStopped {
+			return nil, base.HTTPErrorf(http.StatusBadRequest, "Replication must be stopped before its checkpoints can be reset")
+		}
+	}
+
+	resetPush := replicationCfg.Direction == ActiveReplicatorTypePush || replicationCfg.Direction == ActiveReplicatorTypePushAndPull
+	resetPull := replicationCfg.Direction == ActiveReplicatorTypePull || replicationCfg.Direction == ActiveReplicatorTypePushAndPull
+	switch direction {
+	case "":
+		// Push and pull sequences aren't comparable, so a sequence can only be applied to a single direction.
+		if seq != "" && resetPush && resetPull {
+			return nil, base.HTTPErrorf(http.StatusBadRequest, "Direction must be specified when resetting a %s replication to a sequence", ActiveReplicatorTypePushAndPull)
+		}
+	case ActiveReplicatorTypePush:
+		if !resetPush {
+			return nil, base.HTTPErrorf(http.StatusBadRequest, "Replication %s does not have a push checkpoint", base.UD(replicationID))
+		}
+		resetPull = false
+	case ActiveReplicatorTypePull:
+		if !resetPull {
+			return nil, base.HTTPErrorf(http.StatusBadRequest, "Replication %s does not have a pull checkpoint", base.UD(replicationID))
+		}
+		resetPush = false
+	default:
+		return nil, base.HTTPErrorf(http.StatusBadRequest, "Invalid direction %q, valid values are %s/%s", direction, ActiveReplicatorTypePush, ActiveReplicatorTypePull)
+	}
+
+	var pushCheckpointIDs, pullCheckpointIDs []string
+	checkpointPrefix := m.checkpointPrefix(replicationCfg)
+	if len(replicationCfg.Remotes) > 0 {
+		fanOutCheckpointIDs, err := m.fanOutCheckpointIDs(replicationCfg)
+		if err != nil {
+			return nil, err
+		}
+		for _, checkpointID := range fanOutCheckpointIDs {
+			pushCheckpointIDs = append(pushCheckpointIDs, checkpointID)
+		}
+	} else {
+		if resetPush {
+			pushCheckpointIDs = append(pushCheckpointIDs, checkpointPrefix+PushCheckpointID(replicationID))
+		}
+		if resetPull {
+			pullCheckpointIDs = append(pullCheckpointIDs, checkpointPrefix+PullCheckpointID(replicationID))
+		}
+	}
+
+	activeDB := &Database{DatabaseContext: m.dbContext}
+	for _, checkpointID := range pushCheckpointIDs {
+		if err := rollbackLocalCheckpoint(activeDB, checkpointID, ActiveReplicatorTypePush, seq); err != nil {
+			return nil, err
+		}
+	}
+	for _, checkpointID := range pullCheckpointIDs {
+		if err := rollbackLocalCheckpoint(activeDB, checkpointID, ActiveReplicatorTypePull, seq); err != nil {
+			return nil, err
+		}
+	}
+	base.InfofCtx(m.loggingCtx, base.KeyReplicate, "Reset checkpoints for replication %s (direction: %q, seq: %q)", base.UD(replicationID), direction, seq)
+
+	return m.GetReplicationCheckpoints(replicationID)
+}
+
+// pushCheckpointIDs returns the push checkpoint IDs of a replication, keyed by redacted remote for fan-out
+// replications, or by an empty remote otherwise.
+func (m *sgReplicateManager) pushCheckpointIDs(replicationCfg *ReplicationCfg) (map[string]string, error) {
+	if len(replicationCfg.Remotes) > 0 {
+		return m.fanOutCheckpointIDs(replicationCfg)
+	}
+	if replicationCfg.Direction != ActiveReplicatorTypePush && replicationCfg.Direction != ActiveReplicatorTypePushAndPull {
+		return nil, base.HTTPErrorf(http.StatusBadRequest, "Replication %s is not a push replication", base.UD(replicationCfg.ID))
+	}
+	return map[string]string{"": m.checkpointPrefix(replicationCfg) + PushCheckpointID(replicationCfg.ID)}, nil
+}
+
+// GET _replicationStatus/{replicationID}/_rejected
+//
+// GetRejectedRevs returns the revisions pushed by the replication that were rejected by the remote, oldest first.
+func (m *sgReplicateManager) GetRejectedRevs(replicationID string) (*ReplicationRejectedRevs, error) {
+	replicationCfg, err := m.GetReplication(replicationID)
+	if err != nil {
+		return nil, err
+	}
+	checkpointIDs, err := m.pushCheckpointIDs(replicationCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Include rejections not yet persisted by a replication running on this node
+	m.activeReplicatorsLock.RLock()
+	activeReplicator, isLocal := m.activeReplicators[replicationID]
+	m.activeReplicatorsLock.RUnlock()
+	if isLocal {
+		activeReplicator.flushRejectedRevs()
+	}
+
+	activeDB := &Database{DatabaseContext: m.dbContext}
+	rejectedRevs := &ReplicationRejectedRevs{ID: replicationID, Rejected: []RejectedRev{}}
+	for remote, checkpointID := range checkpointIDs {
+		doc, err := getRejectedRevs(activeDB, checkpointID)
+		if err != nil {
+			return nil, err
+		}
+		for _, rejected := range doc.Rejected {
+			rejected.Remote = remote
+			rejectedRevs.Rejected = append(rejectedRevs.Rejected, rejected)
+		}
+	}
+	sort.SliceStable(rejectedRevs.Rejected, func(i, j int) bool {
+		return rejectedRevs.Rejected[i].Time.Before(rejectedRevs.Rejected[j].Time)
+	})
+	return rejectedRevs, nil
+}
+
+// POST _replicationStatus/{replicationID}/_rejected/retry
+//
+// RetryRejectedRevs re-pushes the current revision of each rejected document, and returns the revisions that remain
+// rejected.  The replication must be running on this node.
+func (m *sgReplicateManager) RetryRejectedRevs(replicationID string) (*ReplicationRejectedRevs, error) {
+	if _, err := m.GetReplication(replicationID); err != nil {
+		return nil, err
+	}
+
+	m.activeReplicatorsLock.RLock()
+	activeReplicator, isLocal := m.activeReplicators[replicationID]
+	m.activeReplicatorsLock.RUnlock()
+	if !isLocal {
+		return nil, base.HTTPErrorf(http.StatusBadRequest, "Replication %s is not running on this node", base.UD(replicationID))
+	}
+
+	if err := activeReplicator.retryRejectedRevs(); err != nil {
+		return nil, err
+	}
+	return m.GetRejectedRevs(replicationID)
+}
+
 func (m *sgReplicateManager) GetReplicationStatusAll(options ReplicationStatusOptions) ([]*ReplicationStatus, error) {
 
 	statuses := make([]*ReplicationStatus, 0)
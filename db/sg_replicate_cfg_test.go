@@ -715,3 +715,55 @@ func TestReplicateGroupIDAssignedNodes(t *testing.T) {
 	require.True(t, exists, "Replicator not found")
 	assert.Equal(t, "nodeGroupB", cfg.AssignedNode)
 }
+
+func TestReplicationRemoteKeyspace(t *testing.T) {
+	testCases := []struct {
+		name             string
+		scope            *string
+		collection       *string
+		mapping          map[string]string
+		expectedKeyspace string
+		expectError      bool
+	}{
+		{
+			name: "no mapping",
+		},
+		{
+			name:             "default collection",
+			mapping:          map[string]string{"_default": "scope2.collection2"},
+			expectedKeyspace: "scope2.collection2",
+		},
+		{
+			name:             "named collection",
+			scope:            base.StringPtr("scope1"),
+			collection:       base.StringPtr("collection1"),
+			mapping:          map[string]string{"scope1.collection1": "collection2", "scope1.other": "scope2.other"},
+			expectedKeyspace: "_default.collection2",
+		},
+		{
+			name:        "database keyspace not mapped",
+			scope:       base.StringPtr("scope1"),
+			collection:  base.StringPtr("collection1"),
+			mapping:     map[string]string{"collection1": "collection2"},
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dbContext := &DatabaseContext{Name: "test"}
+			dbContext.BucketSpec.Scope = tc.scope
+			dbContext.BucketSpec.Collection = tc.collection
+			mgr := &sgReplicateManager{dbContext: dbContext}
+
+			keyspace, err := mgr.remoteKeyspace(&ReplicationConfig{CollectionsRemoteMapping: tc.mapping})
+			if tc.expectError {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "does not include the database keyspace scope1.collection1")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedKeyspace, keyspace)
+		})
+	}
+}
@@ -108,12 +108,39 @@ func NewConflictResolver(crf ConflictResolverFunc, statsContainer *base.DbReplic
 // Wrapper for ConflictResolverFunc that evaluates whether conflict resolution resulted in
 // localWins, remoteWins, or merge
 func (c *ConflictResolver) Resolve(conflict Conflict) (winner Body, resolutionType ConflictResolutionType, err error) {
+	return c.ResolveWithCRDT(conflict, nil, nil)
+}
+
+// ResolveWithCRDT runs the ConflictResolverFunc as Resolve, and then merges the properties defined by crdt into the
+// winner using ancestor (the body of the common ancestor revision, if available) as the base.  If merging modifies the
+// winner, the conflict is resolved as a merge.  Deletions are resolved as-is.
+func (c *ConflictResolver) ResolveWithCRDT(conflict Conflict, ancestor Body, crdt *CRDTOptions) (winner Body, resolutionType ConflictResolutionType, err error) {
 
 	winner, err = c.crf(conflict)
 	if err != nil {
 		return winner, "", err
 	}
 
+	if crdt != nil && winner != nil {
+		localDeleted, _ := conflict.LocalDocument[BodyDeleted].(bool)
+		remoteDeleted, _ := conflict.RemoteDocument[BodyDeleted].(bool)
+		winnerDeleted, _ := winner[BodyDeleted].(bool)
+		if !localDeleted && !remoteDeleted && !winnerDeleted {
+			mergedBody := winner.DeepCopy()
+			if crdt.mergeCRDTProperties(conflict, ancestor, mergedBody) {
+				// Strip metadata properties from the merged body, as expected for a merge result
+				delete(mergedBody, BodyId)
+				delete(mergedBody, BodyRev)
+				delete(mergedBody, BodyExpiry)
+				delete(mergedBody, BodyDeleted)
+				if atts, _ := mergedBody[BodyAttachments].(map[string]interface{}); len(atts) == 0 {
+					delete(mergedBody, BodyAttachments)
+				}
+				winner = mergedBody
+			}
+		}
+	}
+
 	winningRev, ok := winner[BodyRev]
 	if !ok {
 		c.stats.ConflictResultMergeCount.Add(1)
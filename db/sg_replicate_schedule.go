@@ -0,0 +1,546 @@
+/*
+Copyright 2022-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/couchbase/sync_gateway/base"
+)
+
+const (
+	// How often scheduled replications are checked for a pending run
+	replicationScheduleCheckInterval = 10 * time.Second
+
+	// Number of runs retained in the run history for a scheduled replication
+	replicationScheduleMaxRuns = 10
+
+	// Scheduled run status values
+	ReplicationRunStatusRunning   = "running"
+	ReplicationRunStatusCompleted = "completed"
+	ReplicationRunStatusError     = "error"
+	ReplicationRunStatusSkipped   = "skipped"
+	ReplicationRunStatusStopped   = "stopped"
+
+	// ReplicationScheduleDocIDPrefix is the prefix of the local doc persisting the run history of a scheduled replication
+	ReplicationScheduleDocIDPrefix = "sgr2schedule:"
+)
+
+// cronSchedule is a parsed cron expression, with each field represented as a bitmask of matching values.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool // Whether the day-of-month/day-of-week fields were unrestricted
+}
+
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7}, // 0 and 7 are both Sunday
+}
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// parseCronSchedule parses a standard five field cron expression (minute hour day-of-month month day-of-week).  Fields
+// support *, lists, ranges and steps (e.g. 0,30 1-5 */2).  The predefined schedules @hourly, @daily, @weekly, @monthly
+// and @yearly are also supported.
+func parseCronSchedule(expression string) (*cronSchedule, error) {
+	if descriptor, ok := cronDescriptors[strings.TrimSpace(expression)]; ok {
+		expression = descriptor
+	}
+	fields := strings.Fields(expression)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("expected %d fields in cron expression %q, found %d", len(cronFields), expression, len(fields))
+	}
+
+	masks := make([]uint64, len(fields))
+	for i, field := range fields {
+		var err error
+		masks[i], err = parseCronField(field, cronFields[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	schedule := &cronSchedule{
+		minute:  masks[0],
+		hour:    masks[1],
+		dom:     masks[2],
+		month:   masks[3],
+		dow:     masks[4],
+		domStar: fields[2] == "*",
+		dowStar: fields[4] == "*",
+	}
+	// Treat day-of-week 7 as Sunday
+	if schedule.dow&(1<<7) != 0 {
+		schedule.dow |= 1
+	}
+	return schedule, nil
+}
+
+// parseCronField returns the bitmask of values matched by a single cron field.
+func parseCronField(field string, bounds cronField) (mask uint64, err error) {
+	for _, term := range strings.Split(field, ",") {
+		rangeTerm, step := term, 1
+		if i := strings.Index(term, "/"); i >= 0 {
+			rangeTerm = term[:i]
+			step, err = strconv.Atoi(term[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in cron %s field %q", bounds.name, field)
+			}
+		}
+
+		start, end := bounds.min, bounds.max
+		if rangeTerm != "*" {
+			startStr, endStr := rangeTerm, ""
+			if i := strings.Index(rangeTerm, "-"); i >= 0 {
+				startStr, endStr = rangeTerm[:i], rangeTerm[i+1:]
+			}
+			if start, err = strconv.Atoi(startStr); err != nil {
+				return 0, fmt.Errorf("invalid value in cron %s field %q", bounds.name, field)
+			}
+			end = start
+			if endStr != "" {
+				if end, err = strconv.Atoi(endStr); err != nil {
+					return 0, fmt.Errorf("invalid value in cron %s field %q", bounds.name, field)
+				}
+			} else if step > 1 {
+				// a/n is shorthand for a-max/n
+				end = bounds.max
+			}
+		}
+
+		if start < bounds.min || end > bounds.max || start > end {
+			return 0, fmt.Errorf("cron %s field %q must be within %d-%d", bounds.name, field, bounds.min, bounds.max)
+		}
+		for value := start; value <= end; value += step {
+			mask |= 1 << uint(value)
+		}
+	}
+	return mask, nil
+}
+
+// matchesDay returns whether the schedule matches the day of t.  As in standard cron, when both day-of-month and
+// day-of-week are restricted, a day matching either field matches.
+func (s *cronSchedule) matchesDay(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if !s.domStar && !s.dowStar {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
+
+// next returns the first time after t matching the schedule, or the zero time if the schedule doesn't match any time in
+// the next five years (e.g. 30th February).
+func (s *cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	yearLimit := t.Year() + 5
+
+	for t.Year() <= yearLimit {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// ReplicationRun is an entry in the run history of a scheduled replication.
+type ReplicationRun struct {
+	StartTime time.Time  `json:"start_time"`
+	EndTime   *time.Time `json:"end_time,omitempty"`
+	Status    string     `json:"status"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// ReplicationScheduleStatus is the schedule section of the status of a scheduled replication.
+type ReplicationScheduleStatus struct {
+	Schedule  string           `json:"schedule"`
+	NextRun   time.Time        `json:"next_run"`
+	LastError string           `json:"last_error,omitempty"`
+	Runs      []ReplicationRun `json:"runs,omitempty"` // Most recent first
+}
+
+// replicationSchedule tracks the schedule and run history of a scheduled replication assigned to the local node.  The
+// run history is persisted to a local doc, so that it's retained across restarts and rebalance, and can be reported
+// by nodes the replication isn't assigned to.
+type replicationSchedule struct {
+	expression string
+	schedule   *cronSchedule
+	nextRun    time.Time
+	lastError  string
+	runs       []ReplicationRun
+	rev        string // Revision of the persisted run history
+}
+
+type replicationScheduleDoc struct {
+	Rev       string           `json:"_rev"`
+	LastError string           `json:"last_error,omitempty"`
+	Runs      []ReplicationRun `json:"runs,omitempty"`
+}
+
+// addRun adds a run to the history, discarding the oldest run when the history is full.
+func (rs *replicationSchedule) addRun(run ReplicationRun) {
+	if run.Error != "" {
+		rs.lastError = run.Error
+	}
+	rs.runs = append([]ReplicationRun{run}, rs.runs...)
+	if len(rs.runs) > replicationScheduleMaxRuns {
+		rs.runs = rs.runs[:replicationScheduleMaxRuns]
+	}
+}
+
+// endRun marks the most recent started run as ended, if it's still running.  Skipped runs recorded while the run was in
+// progress are ignored.  Returns true if a run was ended.
+func (rs *replicationSchedule) endRun(status string, errorMessage string, endTime time.Time) bool {
+	for i := range rs.runs {
+		if rs.runs[i].Status == ReplicationRunStatusSkipped {
+			continue
+		}
+		if rs.runs[i].Status != ReplicationRunStatusRunning {
+			return false
+		}
+		rs.runs[i].Status = status
+		rs.runs[i].Error = errorMessage
+		rs.runs[i].EndTime = &endTime
+		if errorMessage != "" {
+			rs.lastError = errorMessage
+		}
+		return true
+	}
+	return false
+}
+
+// getReplicationScheduleDoc returns the persisted run history for replicationID, or an empty history if none exists.
+func getReplicationScheduleDoc(dbContext *DatabaseContext, replicationID string) (*replicationScheduleDoc, error) {
+	docBytes, err := dbContext.GetSpecialBytes(DocTypeLocal, ReplicationScheduleDocIDPrefix+replicationID)
+	if err != nil {
+		if base.IsKeyNotFoundError(dbContext.Bucket, err) {
+			return &replicationScheduleDoc{}, nil
+		}
+		return nil, err
+	}
+	var doc replicationScheduleDoc
+	if err := base.JSONUnmarshal(docBytes, &doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// loadSchedule returns a replicationSchedule initialized with the persisted run history for replicationID.
+func (m *sgReplicateManager) loadSchedule(replicationID string) *replicationSchedule {
+	rs := &replicationSchedule{}
+	doc, err := getReplicationScheduleDoc(m.dbContext, replicationID)
+	if err != nil {
+		base.WarnfCtx(m.loggingCtx, "Unable to load run history for scheduled replication %s: %v", base.UD(replicationID), err)
+		return rs
+	}
+	rs.rev = doc.Rev
+	rs.lastError = doc.LastError
+	rs.runs = doc.Runs
+	return rs
+}
+
+// saveSchedule persists the run history of the schedule for replicationID, if the replication is still scheduled on
+// this node.  The local node owns the replication, so on conflict (e.g. with a node the replication was previously
+// assigned to) the persisted history is replaced.  Must be called without schedulesLock held.  Saves are serialised,
+// and each reads the history when it starts, so that the most recent history is the last to be persisted.
+func (m *sgReplicateManager) saveSchedule(replicationID string) {
+	m.schedulesSaveLock.Lock()
+	defer m.schedulesSaveLock.Unlock()
+
+	m.schedulesLock.Lock()
+	rs, ok := m.schedules[replicationID]
+	if !ok {
+		m.schedulesLock.Unlock()
+		return
+	}
+	body := Body{"runs": append([]ReplicationRun(nil), rs.runs...)}
+	if rs.lastError != "" {
+		body["last_error"] = rs.lastError
+	}
+	rev := rs.rev
+	m.schedulesLock.Unlock()
+
+	activeDB := &Database{DatabaseContext: m.dbContext}
+	for numAttempts := 0; numAttempts < 10; numAttempts++ {
+		newRev, err := activeDB.putSpecial(DocTypeLocal, ReplicationScheduleDocIDPrefix+replicationID, rev, body)
+		if err == nil {
+			m.schedulesLock.Lock()
+			rs.rev = newRev
+			m.schedulesLock.Unlock()
+			return
+		}
+		if status, _ := base.ErrorAsHTTPStatus(err); status != http.StatusConflict && status != http.StatusNotFound {
+			base.WarnfCtx(m.loggingCtx, "Unable to persist run history for scheduled replication %s: %v", base.UD(replicationID), err)
+			return
+		}
+		doc, err := getReplicationScheduleDoc(m.dbContext, replicationID)
+		if err != nil {
+			base.WarnfCtx(m.loggingCtx, "Unable to persist run history for scheduled replication %s: %v", base.UD(replicationID), err)
+			return
+		}
+		rev = doc.Rev
+	}
+	base.WarnfCtx(m.loggingCtx, "Unable to persist run history for scheduled replication %s after 10 attempts", base.UD(replicationID))
+}
+
+// removeSchedule removes the persisted run history for replicationID.
+func (m *sgReplicateManager) removeSchedule(replicationID string) error {
+	key := RealSpecialDocID(DocTypeLocal, ReplicationScheduleDocIDPrefix+replicationID)
+	if err := m.dbContext.Bucket.Delete(key); err != nil && !base.IsDocNotFoundError(err) {
+		return err
+	}
+	return nil
+}
+
+// startScheduler starts the goroutine that runs scheduled replications assigned to the local node.
+func (m *sgReplicateManager) startScheduler(ctx context.Context) {
+	m.closeWg.Add(1)
+	go func() {
+		defer base.FatalPanicHandler()
+		defer m.closeWg.Done()
+		ticker := time.NewTicker(replicationScheduleCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.checkSchedules(ctx, time.Now())
+			case <-m.clusterSubscribeTerminator:
+				return
+			}
+		}
+	}()
+}
+
+// scheduledReplication is the state of a scheduled replication assigned to the local node, read by checkSchedules
+// before it takes schedulesLock.
+type scheduledReplication struct {
+	replicator     *ActiveReplicator
+	state          string
+	errorMessage   string
+	stoppedByAdmin bool                 // Whether the replication was stopped by setting its target state to stopped
+	loaded         *replicationSchedule // Persisted run history, loaded for replications that don't yet have a schedule
+}
+
+// checkSchedules updates the run history of scheduled replications assigned to the local node, and starts any that
+// are due to run.  The replicators' states and persisted run histories are read before taking schedulesLock, and
+// replicators are started and run histories persisted after releasing it, so that schedulesLock is only held while
+// calculating the changes to each schedule.
+func (m *sgReplicateManager) checkSchedules(ctx context.Context, now time.Time) {
+	scheduled := make(map[string]*scheduledReplication)
+	m.activeReplicatorsLock.RLock()
+	for replicationID, replicator := range m.activeReplicators {
+		if replicator.config.Schedule != "" {
+			scheduled[replicationID] = &scheduledReplication{replicator: replicator}
+		}
+	}
+	m.activeReplicatorsLock.RUnlock()
+
+	var toLoad []string
+	m.schedulesLock.Lock()
+	for replicationID := range scheduled {
+		if _, ok := m.schedules[replicationID]; !ok {
+			toLoad = append(toLoad, replicationID)
+		}
+	}
+	m.schedulesLock.Unlock()
+	for _, replicationID := range toLoad {
+		scheduled[replicationID].loaded = m.loadSchedule(replicationID)
+	}
+
+	for replicationID, sr := range scheduled {
+		sr.state, sr.errorMessage = sr.replicator.State()
+		if sr.state == ReplicationStateStopped {
+			// Completed runs are ended before the target state is updated, so a run still in progress for a
+			// replication with a stopped target state was stopped manually.
+			if cfg, err := m.GetReplication(replicationID); err == nil && cfg.TargetState == ReplicationStateStopped {
+				sr.stoppedByAdmin = true
+			}
+		}
+	}
+
+	toSave := make(map[string]struct{})
+	toStart := make(map[string]*scheduledReplication)
+	m.schedulesLock.Lock()
+
+	// Discard schedules for replications that are no longer scheduled on this node
+	for replicationID := range m.schedules {
+		if _, ok := scheduled[replicationID]; !ok {
+			delete(m.schedules, replicationID)
+		}
+	}
+
+	for replicationID, sr := range scheduled {
+		replicator := sr.replicator
+		rs, ok := m.schedules[replicationID]
+		if !ok || rs.expression != replicator.config.Schedule {
+			schedule, err := parseCronSchedule(replicator.config.Schedule)
+			if err != nil {
+				base.WarnfCtx(m.loggingCtx, "Invalid schedule for replication %s: %v", base.UD(replicationID), err)
+				continue
+			}
+			if !ok {
+				if sr.loaded == nil {
+					// The schedule was added and then discarded since the persisted run history was loaded
+					continue
+				}
+				rs = sr.loaded
+				m.schedules[replicationID] = rs
+			}
+			rs.expression = replicator.config.Schedule
+			rs.schedule = schedule
+			rs.nextRun = schedule.next(now)
+		}
+
+		switch {
+		case sr.state == ReplicationStateError:
+			if rs.endRun(ReplicationRunStatusError, sr.errorMessage, now) {
+				toSave[replicationID] = struct{}{}
+			}
+		case sr.stoppedByAdmin:
+			if rs.endRun(ReplicationRunStatusStopped, "", now) {
+				toSave[replicationID] = struct{}{}
+			}
+		}
+
+		if rs.nextRun.IsZero() || now.Before(rs.nextRun) {
+			continue
+		}
+		rs.nextRun = rs.schedule.next(now)
+
+		// Runs are recorded as running before the replicator is started, so that a run that completes straight away is
+		// ended by scheduledRunComplete.
+		run := ReplicationRun{StartTime: now, Status: ReplicationRunStatusRunning}
+		switch sr.state {
+		case ReplicationStateStopped, ReplicationStateError:
+			toStart[replicationID] = sr
+		default:
+			base.InfofCtx(m.loggingCtx, base.KeyReplicate, "Skipping scheduled run of replication %s - previous run is %s", base.UD(replicationID), sr.state)
+			run.Status = ReplicationRunStatusSkipped
+			run.Error = fmt.Sprintf("replication was %s at scheduled start", sr.state)
+		}
+		rs.addRun(run)
+		toSave[replicationID] = struct{}{}
+	}
+	m.schedulesLock.Unlock()
+
+	for replicationID, sr := range toStart {
+		var startErr error
+		if sr.state == ReplicationStateStopped {
+			base.InfofCtx(m.loggingCtx, base.KeyReplicate, "Starting scheduled run of replication %s", base.UD(replicationID))
+			startErr = m.UpdateReplicationState(replicationID, ReplicationStateRunning)
+		} else {
+			// Target state is still running for a replication in error, so restart the replicator directly
+			base.InfofCtx(m.loggingCtx, base.KeyReplicate, "Restarting scheduled run of replication %s after error", base.UD(replicationID))
+			startErr = sr.replicator.Start(ctx)
+		}
+		if startErr != nil {
+			base.WarnfCtx(m.loggingCtx, "Unable to start scheduled run of replication %s: %v", base.UD(replicationID), startErr)
+			m.schedulesLock.Lock()
+			if rs, ok := m.schedules[replicationID]; ok {
+				rs.endRun(ReplicationRunStatusError, startErr.Error(), now)
+			}
+			m.schedulesLock.Unlock()
+		}
+	}
+
+	for replicationID := range toSave {
+		m.saveSchedule(replicationID)
+	}
+}
+
+// scheduledRunComplete records the completion of the current run of a scheduled replication.
+func (m *sgReplicateManager) scheduledRunComplete(replicationID string) {
+	m.schedulesLock.Lock()
+	rs, ok := m.schedules[replicationID]
+	ended := ok && rs.endRun(ReplicationRunStatusCompleted, "", time.Now())
+	m.schedulesLock.Unlock()
+	if ended {
+		m.saveSchedule(replicationID)
+	}
+}
+
+// getScheduleStatus returns the schedule status for a scheduled replication assigned to the local node, or nil if the
+// replication isn't scheduled.
+func (m *sgReplicateManager) getScheduleStatus(replicationID string) *ReplicationScheduleStatus {
+	m.schedulesLock.Lock()
+	defer m.schedulesLock.Unlock()
+	rs, ok := m.schedules[replicationID]
+	if !ok {
+		return nil
+	}
+	status := &ReplicationScheduleStatus{
+		Schedule:  rs.expression,
+		NextRun:   rs.nextRun,
+		LastError: rs.lastError,
+	}
+	if len(rs.runs) > 0 {
+		status.Runs = make([]ReplicationRun, len(rs.runs))
+		copy(status.Runs, rs.runs)
+	}
+	return status
+}
+
+// loadScheduleStatus returns the schedule status for a scheduled replication from its persisted run history, for
+// replications that aren't assigned to the local node.  Returns nil if the replication isn't scheduled.
+func (m *sgReplicateManager) loadScheduleStatus(config *ReplicationCfg) *ReplicationScheduleStatus {
+	if config.Schedule == "" {
+		return nil
+	}
+	status := &ReplicationScheduleStatus{
+		Schedule: config.Schedule,
+	}
+	if schedule, err := parseCronSchedule(config.Schedule); err == nil {
+		status.NextRun = schedule.next(time.Now())
+	}
+	doc, err := getReplicationScheduleDoc(m.dbContext, config.ID)
+	if err != nil {
+		base.WarnfCtx(m.loggingCtx, "Unable to load run history for scheduled replication %s: %v", base.UD(config.ID), err)
+		return status
+	}
+	status.LastError = doc.LastError
+	status.Runs = doc.Runs
+	return status
+}
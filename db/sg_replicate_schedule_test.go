@@ -0,0 +1,238 @@
+/*
+Copyright 2022-Present Couchbase, Inc.
+
+Use of this software is governed by the Business Source License included in
+the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+file, in accordance with the Business Source License, use of this software will
+be governed by the Apache License, Version 2.0, included in the file
+licenses/APL2.txt.
+*/
+
+package db
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCronScheduleNext(t *testing.T) {
+	// Wednesday
+	from := time.Date(2022, time.June, 15, 10, 17, 42, 0, time.UTC)
+
+	testCases := []struct {
+		name       string
+		expression string
+		expected   time.Time
+	}{
+		{
+			name:       "every minute",
+			expression: "* * * * *",
+			expected:   time.Date(2022, time.June, 15, 10, 18, 0, 0, time.UTC),
+		},
+		{
+			name:       "step",
+			expression: "*/15 * * * *",
+			expected:   time.Date(2022, time.June, 15, 10, 30, 0, 0, time.UTC),
+		},
+		{
+			name:       "list and range",
+			expression: "0,30 9-10 * * *",
+			expected:   time.Date(2022, time.June, 15, 10, 30, 0, 0, time.UTC),
+		},
+		{
+			name:       "next day",
+			expression: "0 2 * * *",
+			expected:   time.Date(2022, time.June, 16, 2, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "day of week",
+			expression: "0 0 * * 1-5/2",
+			expected:   time.Date(2022, time.June, 17, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "sunday as 7",
+			expression: "0 0 * * 7",
+			expected:   time.Date(2022, time.June, 19, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "day of month or day of week",
+			expression: "0 0 16 * 0",
+			expected:   time.Date(2022, time.June, 16, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "next year",
+			expression: "@yearly",
+			expected:   time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "never",
+			expression: "0 0 30 2 *",
+			expected:   time.Time{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			schedule, err := parseCronSchedule(tc.expression)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, schedule.next(from))
+		})
+	}
+}
+
+func TestCronScheduleInvalid(t *testing.T) {
+	for _, expression := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *", "@often"} {
+		t.Run(expression, func(t *testing.T) {
+			_, err := parseCronSchedule(expression)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestReplicationScheduleRunHistory(t *testing.T) {
+	rs := &replicationSchedule{}
+	start := time.Now()
+	for i := 0; i < replicationScheduleMaxRuns+2; i++ {
+		rs.addRun(ReplicationRun{StartTime: start.Add(time.Duration(i) * time.Minute), Status: ReplicationRunStatusRunning})
+		rs.endRun(ReplicationRunStatusCompleted, "", start)
+	}
+	require.Len(t, rs.runs, replicationScheduleMaxRuns)
+	assert.Equal(t, start.Add(time.Duration(replicationScheduleMaxRuns+1)*time.Minute), rs.runs[0].StartTime)
+	assert.Equal(t, ReplicationRunStatusCompleted, rs.runs[0].Status)
+
+	rs.addRun(ReplicationRun{StartTime: start, Status: ReplicationRunStatusRunning})
+	rs.endRun(ReplicationRunStatusError, "remote unavailable", start)
+	assert.Equal(t, "remote unavailable", rs.lastError)
+
+	// Ending a run that has already ended is a no-op
+	rs.endRun(ReplicationRunStatusCompleted, "", start)
+	assert.Equal(t, ReplicationRunStatusError, rs.runs[0].Status)
+	assert.Equal(t, "remote unavailable", rs.lastError)
+}
+
+// TestCheckSchedules drives checkSchedules through a sequence of scheduled times for a replication assigned to the
+// local node, and verifies the resulting runs and their persistence.
+func TestCheckSchedules(t *testing.T) {
+	db, ctx := setupTestDB(t)
+	defer db.Close(ctx)
+
+	cfg, err := base.NewCfgSG(db.Bucket, "")
+	require.NoError(t, err)
+	mgr, err := NewSGReplicateManager(ctx, db.DatabaseContext, cfg)
+	require.NoError(t, err)
+	defer mgr.Stop()
+
+	// Remote is unavailable, so restarting the replicator after an error fails to connect
+	srv := httptest.NewServer(nil)
+	remoteURL := srv.URL + "/db"
+	srv.Close()
+
+	const replicationID = "scheduled"
+	require.NoError(t, mgr.PutReplications(map[string]*ReplicationConfig{
+		replicationID: {
+			ID:        replicationID,
+			Remote:    remoteURL,
+			Direction: ActiveReplicatorTypePush,
+			Schedule:  "*/15 * * * *",
+		},
+	}))
+
+	// New scheduled replications don't run until the first scheduled time
+	replicationCfg, err := mgr.GetReplication(replicationID)
+	require.NoError(t, err)
+	assert.Equal(t, ReplicationStateStopped, replicationCfg.TargetState)
+
+	replicator, err := mgr.InitializeReplication(replicationCfg)
+	require.NoError(t, err)
+	// Stopped by the manager on test completion
+	mgr.activeReplicatorsLock.Lock()
+	mgr.activeReplicators[replicationID] = replicator
+	mgr.activeReplicatorsLock.Unlock()
+
+	requireTargetState := func(expected string) {
+		replicationCfg, err := mgr.GetReplication(replicationID)
+		require.NoError(t, err)
+		require.Equal(t, expected, replicationCfg.TargetState)
+	}
+	requireRuns := func(expected ...string) {
+		status := mgr.getScheduleStatus(replicationID)
+		require.NotNil(t, status)
+		statuses := make([]string, 0, len(status.Runs))
+		for _, run := range status.Runs {
+			statuses = append(statuses, run.Status)
+		}
+		require.Equal(t, expected, statuses)
+	}
+	at := func(hour, minute int) time.Time {
+		return time.Date(2022, time.June, 15, hour, minute, 0, 0, time.UTC)
+	}
+
+	// Not yet due
+	mgr.checkSchedules(ctx, at(10, 5))
+	requireRuns()
+	assert.Equal(t, at(10, 15), mgr.getScheduleStatus(replicationID).NextRun)
+
+	// Start when due
+	mgr.checkSchedules(ctx, at(10, 15))
+	requireRuns(ReplicationRunStatusRunning)
+	requireTargetState(ReplicationStateRunning)
+
+	// Skip while the previous run is in progress
+	replicator.Push.setState(ReplicationStateRunning)
+	mgr.checkSchedules(ctx, at(10, 30))
+	requireRuns(ReplicationRunStatusSkipped, ReplicationRunStatusRunning)
+
+	// Completion via replicationComplete ends the in-progress run, not the skipped run
+	replicator.Push.setState(ReplicationStateStopped)
+	mgr.replicationComplete(replicationID)
+	requireRuns(ReplicationRunStatusSkipped, ReplicationRunStatusCompleted)
+	requireTargetState(ReplicationStateStopped)
+
+	// A run stopped manually is ended as stopped
+	mgr.checkSchedules(ctx, at(10, 45))
+	requireRuns(ReplicationRunStatusRunning, ReplicationRunStatusSkipped, ReplicationRunStatusCompleted)
+	require.NoError(t, mgr.UpdateReplicationState(replicationID, ReplicationStateStopped))
+	mgr.checkSchedules(ctx, at(10, 50))
+	requireRuns(ReplicationRunStatusStopped, ReplicationRunStatusSkipped, ReplicationRunStatusCompleted)
+
+	// A run ending in error is recorded, and the replicator is restarted at the next scheduled time
+	mgr.checkSchedules(ctx, at(11, 0))
+	requireRuns(ReplicationRunStatusRunning, ReplicationRunStatusStopped, ReplicationRunStatusSkipped, ReplicationRunStatusCompleted)
+	replicator.Push.setError(errors.New("remote unavailable"))
+	mgr.checkSchedules(ctx, at(11, 5))
+	requireRuns(ReplicationRunStatusError, ReplicationRunStatusStopped, ReplicationRunStatusSkipped, ReplicationRunStatusCompleted)
+	assert.Equal(t, "remote unavailable", mgr.getScheduleStatus(replicationID).LastError)
+
+	mgr.checkSchedules(ctx, at(11, 15))
+	status := mgr.getScheduleStatus(replicationID)
+	require.Len(t, status.Runs, 5)
+	assert.Equal(t, at(11, 15), status.Runs[0].StartTime)
+	assert.NotEqual(t, ReplicationRunStatusSkipped, status.Runs[0].Status)
+
+	// Run history is persisted, and reported by nodes the replication isn't assigned to
+	otherMgr, err := NewSGReplicateManager(ctx, db.DatabaseContext, cfg)
+	require.NoError(t, err)
+	defer otherMgr.Stop()
+	replicationStatus, err := otherMgr.GetReplicationStatus(replicationID, DefaultReplicationStatusOptions())
+	require.NoError(t, err)
+	require.NotNil(t, replicationStatus.Schedule)
+	assert.Equal(t, "*/15 * * * *", replicationStatus.Schedule.Schedule)
+	assert.Equal(t, "remote unavailable", replicationStatus.Schedule.LastError)
+	require.Len(t, replicationStatus.Schedule.Runs, 5)
+	for i, run := range replicationStatus.Schedule.Runs {
+		assert.Equal(t, status.Runs[i].Status, run.Status)
+		assert.True(t, status.Runs[i].StartTime.Equal(run.StartTime))
+	}
+
+	// Run history is removed with the replication
+	require.NoError(t, mgr.DeleteReplication(replicationID))
+	doc, err := getReplicationScheduleDoc(db.DatabaseContext, replicationID)
+	require.NoError(t, err)
+	assert.Empty(t, doc.Runs)
+}
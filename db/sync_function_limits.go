@@ -0,0 +1,50 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/couchbase/sync_gateway/base"
+)
+
+// SyncFunctionLimitsConfig sets ceilings on the resources that a single invocation of the sync function can use.  A
+// function that exceeds them is interrupted, and the write fails, so that a pathological regex or loop can't stall the
+// write path.  Only supported by the goja JavaScript engine.
+//
+// The resources used by one invocation can't be measured while it shares the Sync Gateway process, so a database with
+// limits runs its sync function in sandbox processes - see channels.SandboxSyncRunner.  Each runs one invocation at a
+// time, so its CPU time and heap growth are those of the invocation.
+type SyncFunctionLimitsConfig struct {
+	MaxCPUTimeMs uint32 `json:"max_cpu_time_ms,omitempty"` // Max CPU time of a single invocation - 0 for no limit
+	MaxMemoryMB  uint32 `json:"max_memory_mb,omitempty"`   // Max heap growth during a single invocation, in MB - 0 for no limit
+}
+
+// Validate ensures the config's settings are valid for a database using the given JavaScript engine.
+func (c *SyncFunctionLimitsConfig) Validate(javascriptEngine string) error {
+	if c.MaxCPUTimeMs == 0 && c.MaxMemoryMB == 0 {
+		return nil
+	}
+	if javascriptEngine != base.JSEngineGoja {
+		if javascriptEngine == "" {
+			javascriptEngine = base.JSEngineOtto
+		}
+		return fmt.Errorf("limits aren't supported by javascript_engine %q, only by %q", javascriptEngine, base.JSEngineGoja)
+	}
+	return nil
+}
+
+// JSLimits returns the limits to be enforced by the JavaScript runner.
+func (c *SyncFunctionLimitsConfig) JSLimits() base.JSLimits {
+	return base.JSLimits{
+		MaxCPUTime: time.Duration(c.MaxCPUTimeMs) * time.Millisecond,
+		MaxMemory:  uint64(c.MaxMemoryMB) * 1024 * 1024,
+	}
+}
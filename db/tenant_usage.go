@@ -0,0 +1,117 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package db
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/couchbase/sync_gateway/base"
+)
+
+const (
+	// TenantReadUnitBytes is the size of a read unit - each doc read counts as one read unit per started block.
+	TenantReadUnitBytes = 4096
+	// TenantWriteUnitBytes is the size of a write unit - each doc write counts as one write unit per started block.
+	TenantWriteUnitBytes = 1024
+)
+
+// TenantUsage is a database's resource usage in serverless mode, for billing and throttling its tenant.
+type TenantUsage struct {
+	ActiveConnections   int64 `json:"active_connections"`   // Non-admin requests currently in progress
+	RejectedConnections int64 `json:"rejected_connections"` // Non-admin requests rejected by max_connections_per_database
+	ReadUnits           int64 `json:"read_units"`           // Compute units consumed by doc reads
+	WriteUnits          int64 `json:"write_units"`          // Compute units consumed by doc writes
+	BytesRead           int64 `json:"bytes_read"`           // Size of the doc bodies read
+	BytesWritten        int64 `json:"bytes_written"`        // Size of the docs written
+}
+
+// TenantUsageTracker accounts for the resources used by a database's tenant in serverless mode, and caps the number of
+// concurrent connections to the database.  Methods are safe to call on a nil tracker, which tracks nothing.
+type TenantUsageTracker struct {
+	maxConnections    int64 // Zero when connections aren't limited
+	activeConnections int64 // Accessed atomically
+	stats             *base.DatabaseStats
+}
+
+// newTenantUsageTracker returns the tracker for a database, or nil when not running in serverless mode.
+func newTenantUsageTracker(options DatabaseContextOptions, stats *base.DatabaseStats) *TenantUsageTracker {
+	if !options.Serverless {
+		return nil
+	}
+	return &TenantUsageTracker{
+		maxConnections: int64(options.ServerlessMaxConnections),
+		stats:          stats,
+	}
+}
+
+// AdmitConnection reserves a connection to the database.  Returns a 429 error if the database is at its connection
+// limit, otherwise a function that must be called to release the connection once the request ends.
+func (t *TenantUsageTracker) AdmitConnection() (release func(), err error) {
+	if t == nil {
+		return func() {}, nil
+	}
+	active := atomic.AddInt64(&t.activeConnections, 1)
+	if t.maxConnections > 0 && active > t.maxConnections {
+		atomic.AddInt64(&t.activeConnections, -1)
+		t.stats.ServerlessRejectedConnections.Add(1)
+		return nil, base.HTTPErrorf(http.StatusTooManyRequests, "Database has reached the limit of %d concurrent connections", t.maxConnections)
+	}
+	t.stats.ServerlessActiveConnections.Set(active)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.stats.ServerlessActiveConnections.Set(atomic.AddInt64(&t.activeConnections, -1))
+		})
+	}, nil
+}
+
+// RecordRead accounts for a doc read with a body of the given size.
+func (t *TenantUsageTracker) RecordRead(bytes int) {
+	if t == nil {
+		return
+	}
+	t.stats.ServerlessReadUnits.Add(tenantComputeUnits(bytes, TenantReadUnitBytes))
+	t.stats.ServerlessBytesRead.Add(int64(bytes))
+}
+
+// RecordWrite accounts for a doc write of the given size.
+func (t *TenantUsageTracker) RecordWrite(bytes int) {
+	if t == nil {
+		return
+	}
+	t.stats.ServerlessWriteUnits.Add(tenantComputeUnits(bytes, TenantWriteUnitBytes))
+	t.stats.ServerlessBytesWritten.Add(int64(bytes))
+}
+
+// Usage returns the database's usage since it was started on this node.
+func (t *TenantUsageTracker) Usage() TenantUsage {
+	if t == nil {
+		return TenantUsage{}
+	}
+	return TenantUsage{
+		ActiveConnections:   atomic.LoadInt64(&t.activeConnections),
+		RejectedConnections: t.stats.ServerlessRejectedConnections.Value(),
+		ReadUnits:           t.stats.ServerlessReadUnits.Value(),
+		WriteUnits:          t.stats.ServerlessWriteUnits.Value(),
+		BytesRead:           t.stats.ServerlessBytesRead.Value(),
+		BytesWritten:        t.stats.ServerlessBytesWritten.Value(),
+	}
+}
+
+// tenantComputeUnits returns the number of units of the given size started by an operation on the given number of
+// bytes.  Every operation counts as at least one unit.
+func tenantComputeUnits(bytes int, unitBytes int) int64 {
+	if bytes <= unitBytes {
+		return 1
+	}
+	return int64((bytes + unitBytes - 1) / unitBytes)
+}
@@ -0,0 +1,75 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package db
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTenantUsageTracker(t *testing.T) {
+	stats := base.NewSyncGatewayStats().NewDBStats("", false, false, false).Database()
+	tracker := newTenantUsageTracker(DatabaseContextOptions{Serverless: true, ServerlessMaxConnections: 2}, stats)
+	require.NotNil(t, tracker)
+
+	release1, err := tracker.AdmitConnection()
+	require.NoError(t, err)
+	_, err = tracker.AdmitConnection()
+	require.NoError(t, err)
+
+	// The database is at its connection limit
+	_, err = tracker.AdmitConnection()
+	require.Error(t, err)
+	status, _ := base.ErrorAsHTTPStatus(err)
+	require.Equal(t, http.StatusTooManyRequests, status)
+
+	// Releasing more than once only frees a single connection
+	release1()
+	release1()
+	_, err = tracker.AdmitConnection()
+	require.NoError(t, err)
+	_, err = tracker.AdmitConnection()
+	require.Error(t, err)
+
+	// Small operations count as a single unit, larger ones as one unit per started block
+	tracker.RecordRead(10)
+	tracker.RecordRead(TenantReadUnitBytes + 1)
+	tracker.RecordWrite(TenantWriteUnitBytes)
+	tracker.RecordWrite(3 * TenantWriteUnitBytes)
+
+	assert.Equal(t, TenantUsage{
+		ActiveConnections:   2,
+		RejectedConnections: 2,
+		ReadUnits:           3,
+		WriteUnits:          4,
+		BytesRead:           TenantReadUnitBytes + 11,
+		BytesWritten:        4 * TenantWriteUnitBytes,
+	}, tracker.Usage())
+	assert.Equal(t, int64(2), stats.ServerlessActiveConnections.Value())
+}
+
+func TestTenantUsageTrackerNotServerless(t *testing.T) {
+	stats := base.NewSyncGatewayStats().NewDBStats("", false, false, false).Database()
+	tracker := newTenantUsageTracker(DatabaseContextOptions{ServerlessMaxConnections: 1}, stats)
+	require.Nil(t, tracker)
+
+	// A nil tracker doesn't limit connections or track usage
+	for i := 0; i < 3; i++ {
+		_, err := tracker.AdmitConnection()
+		require.NoError(t, err)
+	}
+	tracker.RecordRead(10)
+	tracker.RecordWrite(10)
+	assert.Equal(t, TenantUsage{}, tracker.Usage())
+	assert.Equal(t, int64(0), stats.ServerlessReadUnits.Value())
+}
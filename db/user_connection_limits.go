@@ -0,0 +1,94 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package db
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/couchbase/sync_gateway/base"
+)
+
+// UserConnectionLimitsConfig limits the number of long-lived connections that a single user can hold open at once.
+// Limits aren't applied to the guest user or to requests made via the admin API.
+type UserConnectionLimitsConfig struct {
+	MaxReplications      int `json:"max_replications,omitempty"`       // Max concurrent BLIP replications per user - 0 for no limit
+	MaxContinuousChanges int `json:"max_continuous_changes,omitempty"` // Max concurrent continuous, longpoll and websocket _changes feeds per user - 0 for no limit
+}
+
+// Validate ensures the config's settings are valid.
+func (c *UserConnectionLimitsConfig) Validate() error {
+	if c.MaxReplications < 0 {
+		return fmt.Errorf("max_replications must not be negative")
+	}
+	if c.MaxContinuousChanges < 0 {
+		return fmt.Errorf("max_continuous_changes must not be negative")
+	}
+	return nil
+}
+
+// UserConnectionLimiter tracks the long-lived connections held open by each user of a database.
+type UserConnectionLimiter struct {
+	maxReplications      int
+	maxContinuousChanges int
+
+	lock              sync.Mutex
+	replications      map[string]int
+	continuousChanges map[string]int
+}
+
+// NewUserConnectionLimiter creates a UserConnectionLimiter enforcing the given config.
+func NewUserConnectionLimiter(config UserConnectionLimitsConfig) *UserConnectionLimiter {
+	return &UserConnectionLimiter{
+		maxReplications:      config.MaxReplications,
+		maxContinuousChanges: config.MaxContinuousChanges,
+		replications:         make(map[string]int),
+		continuousChanges:    make(map[string]int),
+	}
+}
+
+// AcquireReplication reserves a BLIP replication for the user.  Returns a 429 error if the user is at the limit,
+// otherwise a function that must be called to release the reservation once the replication ends.
+func (l *UserConnectionLimiter) AcquireReplication(username string) (release func(), err error) {
+	return l.acquire(l.replications, l.maxReplications, username, "replications")
+}
+
+// AcquireContinuousChanges reserves a continuous, longpoll or websocket _changes feed for the user.  Returns a 429
+// error if the user is at the limit, otherwise a function that must be called to release the reservation once the
+// feed ends.
+func (l *UserConnectionLimiter) AcquireContinuousChanges(username string) (release func(), err error) {
+	return l.acquire(l.continuousChanges, l.maxContinuousChanges, username, "continuous changes feeds")
+}
+
+func (l *UserConnectionLimiter) acquire(active map[string]int, limit int, username string, connectionType string) (release func(), err error) {
+	if limit == 0 || username == "" {
+		return func() {}, nil
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if active[username] >= limit {
+		return nil, base.HTTPErrorf(http.StatusTooManyRequests, "User has reached the limit of %d concurrent %s", limit, connectionType)
+	}
+	active[username]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.lock.Lock()
+			defer l.lock.Unlock()
+			if active[username] <= 1 {
+				delete(active, username)
+			} else {
+				active[username]--
+			}
+		})
+	}, nil
+}
@@ -0,0 +1,66 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package db
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserConnectionLimiter(t *testing.T) {
+	limiter := NewUserConnectionLimiter(UserConnectionLimitsConfig{MaxReplications: 2, MaxContinuousChanges: 1})
+	requireTooManyRequests := func(err error) {
+		require.Error(t, err)
+		status, _ := base.ErrorAsHTTPStatus(err)
+		require.Equal(t, http.StatusTooManyRequests, status)
+	}
+
+	releaseReplication1, err := limiter.AcquireReplication("alice")
+	require.NoError(t, err)
+	releaseReplication2, err := limiter.AcquireReplication("alice")
+	require.NoError(t, err)
+
+	// Alice is at the replication limit, but can still open a changes feed, and other users aren't affected
+	_, err = limiter.AcquireReplication("alice")
+	requireTooManyRequests(err)
+	releaseChanges, err := limiter.AcquireContinuousChanges("alice")
+	require.NoError(t, err)
+	_, err = limiter.AcquireContinuousChanges("alice")
+	requireTooManyRequests(err)
+	_, err = limiter.AcquireReplication("bob")
+	require.NoError(t, err)
+
+	// Releasing more than once only frees a single slot
+	releaseReplication1()
+	releaseReplication1()
+	_, err = limiter.AcquireReplication("alice")
+	require.NoError(t, err)
+	_, err = limiter.AcquireReplication("alice")
+	requireTooManyRequests(err)
+
+	releaseReplication2()
+	releaseChanges()
+	_, err = limiter.AcquireContinuousChanges("alice")
+	assert.NoError(t, err)
+}
+
+func TestUserConnectionLimiterUnlimited(t *testing.T) {
+	limiter := NewUserConnectionLimiter(UserConnectionLimitsConfig{MaxReplications: 1})
+	for i := 0; i < 5; i++ {
+		_, err := limiter.AcquireContinuousChanges("alice")
+		require.NoError(t, err)
+		// The guest user isn't limited
+		_, err = limiter.AcquireReplication("")
+		require.NoError(t, err)
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"reflect"
 
 	"github.com/couchbase/sync_gateway/auth"
 	"github.com/couchbase/sync_gateway/base"
@@ -78,6 +79,11 @@ func (dbc *DatabaseContext) UpdatePrincipal(ctx context.Context, updates *auth.P
 					err = base.HTTPErrorf(http.StatusBadRequest, "Error creating user: %s", reason)
 					return replaced, err
 				}
+				if updates.Password != nil {
+					if err := authenticator.ValidatePassword(*updates.Password); err != nil {
+						return replaced, base.HTTPErrorf(http.StatusBadRequest, "Error creating user: %s", err)
+					}
+				}
 				user, err = authenticator.NewUser(*updates.Name, "", nil)
 				princ = user
 			} else {
@@ -96,6 +102,9 @@ func (dbc *DatabaseContext) UpdatePrincipal(ctx context.Context, updates *auth.P
 				err = base.HTTPErrorf(http.StatusBadRequest, "Error updating user/role: %s", reason)
 				return replaced, err
 			}
+			if err := authenticator.ValidatePassword(*updates.Password); err != nil {
+				return replaced, base.HTTPErrorf(http.StatusBadRequest, "Error updating user: %s", err)
+			}
 		}
 
 		// Ensure the caller isn't trying to set all_channels or roles explicitly - it'll get recomputed automatically.
@@ -115,8 +124,27 @@ func (dbc *DatabaseContext) UpdatePrincipal(ctx context.Context, updates *auth.P
 		if updates.ExplicitChannels != nil && !updatedExplicitChannels.Equals(updates.ExplicitChannels) {
 			changed = true
 		}
+		updatedExplicitChannelExpiry := updates.ExplicitChannelExpiries()
+		if updates.ExplicitChannelExpiry != nil && !reflect.DeepEqual(updatedExplicitChannels.Expiries(), updatedExplicitChannelExpiry) {
+			changed = true
+		}
 
-		var updatedExplicitRoles, updatedJWTRoles, updatedJWTChannels ch.TimedSet
+		var updatedExplicitRoles, updatedJWTRoles, updatedJWTChannels, updatedIncludedRoles ch.TimedSet
+
+		if role, ok := princ.(auth.Role); ok && !isUser {
+			updatedIncludedRoles = role.IncludedRoles()
+			if updatedIncludedRoles == nil {
+				updatedIncludedRoles = ch.TimedSet{}
+			}
+			if updates.IncludedRoles != nil && !updatedIncludedRoles.Equals(updates.IncludedRoles) {
+				if err := authenticator.ValidateIncludedRoles(role.Name(), updates.IncludedRoles); err != nil {
+					return replaced, err
+				}
+				changed = true
+			}
+		} else if updates.IncludedRoles != nil {
+			return false, base.HTTPErrorf(http.StatusBadRequest, "included_roles only applies to roles")
+		}
 
 		// Then the user-specific fields like roles:
 		if isUser {
@@ -187,10 +215,20 @@ func (dbc *DatabaseContext) UpdatePrincipal(ctx context.Context, updates *auth.P
 		princ.SetSequence(nextSeq)
 
 		// Now update the Principal object from the properties in the request, first the channels:
-		if updates.ExplicitChannels != nil && updatedExplicitChannels.UpdateAtSequence(updates.ExplicitChannels, nextSeq) {
+		explicitChannelsChanged := updates.ExplicitChannels != nil && updatedExplicitChannels.UpdateAtSequence(updates.ExplicitChannels, nextSeq)
+		if updates.ExplicitChannelExpiry != nil && updatedExplicitChannels.UpdateExpiry(updatedExplicitChannelExpiry) {
+			explicitChannelsChanged = true
+		}
+		if explicitChannelsChanged {
 			princ.SetExplicitChannels(updatedExplicitChannels, nextSeq)
 		}
 
+		if role, ok := princ.(auth.Role); ok && !isUser {
+			if updates.IncludedRoles != nil && updatedIncludedRoles.UpdateAtSequence(updates.IncludedRoles, nextSeq) {
+				role.SetIncludedRoles(updatedIncludedRoles)
+			}
+		}
+
 		if isUser {
 			if updates.ExplicitRoleNames != nil && updatedExplicitRoles.UpdateAtSequence(updates.ExplicitRoleNames, nextSeq) {
 				user.SetExplicitRoles(updatedExplicitRoles, nextSeq)
@@ -393,6 +393,9 @@ func (dbc *DatabaseContext) GetPrincipalForTest(tb testing.TB, name string, isUs
 		info.RoleNames = user.RoleNames().AllKeys()
 	} else {
 		info.Channels = princ.Channels().AsSet()
+		if role, ok := princ.(auth.Role); ok {
+			info.IncludedRoles = role.IncludedRoles().AsSet()
+		}
 	}
 	return
 }
@@ -67,6 +67,9 @@ func (h *handler) handleCreateDB() error {
 		if config.Bucket != nil {
 			bucket = *config.Bucket
 		}
+		if !h.server.isConfigBucket(bucket) {
+			return base.HTTPErrorf(http.StatusBadRequest, "bucket %q is not one of bootstrap.config_buckets, so the database's config wouldn't be loaded", base.MD(bucket).Redact())
+		}
 
 		// copy config before setup to persist the raw config the user supplied
 		var persistedDbConfig DbConfig
@@ -310,7 +313,9 @@ func (h *handler) handleGetConfig() error {
 
 		allDbNames := h.server.AllDatabaseNames()
 		databaseMap := make(map[string]*DbConfig, len(allDbNames))
+		h.server.reloadableConfigLock.RLock()
 		cfg.StartupConfig, err = h.server.Config.Redacted()
+		h.server.reloadableConfigLock.RUnlock()
 		if err != nil {
 			return err
 		}
@@ -446,6 +451,10 @@ func (h *handler) handlePutConfig() error {
 func (h *handler) handlePutDbConfig() (err error) {
 	h.assertAdminOnly()
 
+	if h.getBoolQuery(paramValidateOnly) {
+		return h.handleValidateDbConfig()
+	}
+
 	var dbConfig *DbConfig
 
 	if h.permissionsResults[PermUpdateDb.PermissionName] {
@@ -525,7 +534,7 @@ func (h *handler) handlePutDbConfig() (err error) {
 	var updatedDbConfig *DatabaseConfig
 	cas, err := h.server.BootstrapContext.Connection.UpdateConfig(
 		bucket, h.server.Config.Bootstrap.ConfigGroupID,
-		func(rawBucketConfig []byte) (newConfig []byte, err error) {
+		recordDatabaseConfigHistory(func(rawBucketConfig []byte) (newConfig []byte, err error) {
 			var bucketDbConfig DatabaseConfig
 			if err := base.JSONUnmarshal(rawBucketConfig, &bucketDbConfig); err != nil {
 				return nil, err
@@ -581,7 +590,7 @@ func (h *handler) handlePutDbConfig() (err error) {
 			}
 
 			return base.JSONMarshal(bucketDbConfig)
-		})
+		}))
 	if err != nil {
 		base.WarnfCtx(h.ctx(), "Couldn't update config for database - rolling back: %v", err)
 		// failed to start the new database config - rollback and return the original error for the user
@@ -627,6 +636,18 @@ func (h *handler) handleGetDbConfigSync() error {
 	return nil
 }
 
+// GET the sync function that applies to each keyspace of the database, taking into account collections that inherit
+// the database-level sync function.
+func (h *handler) handleGetDbConfigEffectiveSync() error {
+	h.assertAdminOnly()
+	dbConfig := h.server.GetDbConfig(h.db.Name)
+	if dbConfig == nil {
+		return base.HTTPErrorf(http.StatusNotFound, "database config not found")
+	}
+	h.writeJSON(dbConfig.effectiveSyncFns())
+	return nil
+}
+
 // DELETE a database config sync function
 func (h *handler) handleDeleteDbConfigSync() error {
 	h.assertAdminOnly()
@@ -640,7 +661,7 @@ func (h *handler) handleDeleteDbConfigSync() error {
 	var updatedDbConfig *DatabaseConfig
 	cas, err := h.server.BootstrapContext.Connection.UpdateConfig(
 		bucket, h.server.Config.Bootstrap.ConfigGroupID,
-		func(rawBucketConfig []byte) (newConfig []byte, err error) {
+		recordDatabaseConfigHistory(func(rawBucketConfig []byte) (newConfig []byte, err error) {
 			var bucketDbConfig DatabaseConfig
 			if err := base.JSONUnmarshal(rawBucketConfig, &bucketDbConfig); err != nil {
 				return nil, err
@@ -660,7 +681,7 @@ func (h *handler) handleDeleteDbConfigSync() error {
 
 			updatedDbConfig = &bucketDbConfig
 			return base.JSONMarshal(bucketDbConfig)
-		})
+		}))
 	if err != nil {
 		return err
 	}
@@ -701,7 +722,7 @@ func (h *handler) handlePutDbConfigSync() error {
 	var updatedDbConfig *DatabaseConfig
 	cas, err := h.server.BootstrapContext.Connection.UpdateConfig(
 		bucket, h.server.Config.Bootstrap.ConfigGroupID,
-		func(rawBucketConfig []byte) (newConfig []byte, err error) {
+		recordDatabaseConfigHistory(func(rawBucketConfig []byte) (newConfig []byte, err error) {
 			var bucketDbConfig DatabaseConfig
 			if err := base.JSONUnmarshal(rawBucketConfig, &bucketDbConfig); err != nil {
 				return nil, err
@@ -726,7 +747,7 @@ func (h *handler) handlePutDbConfigSync() error {
 
 			updatedDbConfig = &bucketDbConfig
 			return base.JSONMarshal(bucketDbConfig)
-		})
+		}))
 	if err != nil {
 		return err
 	}
@@ -790,7 +811,7 @@ func (h *handler) handleDeleteDbConfigImportFilter() error {
 	var updatedDbConfig *DatabaseConfig
 	cas, err := h.server.BootstrapContext.Connection.UpdateConfig(
 		bucket, h.server.Config.Bootstrap.ConfigGroupID,
-		func(rawBucketConfig []byte) (newConfig []byte, err error) {
+		recordDatabaseConfigHistory(func(rawBucketConfig []byte) (newConfig []byte, err error) {
 			var bucketDbConfig DatabaseConfig
 			if err := base.JSONUnmarshal(rawBucketConfig, &bucketDbConfig); err != nil {
 				return nil, err
@@ -810,7 +831,7 @@ func (h *handler) handleDeleteDbConfigImportFilter() error {
 
 			updatedDbConfig = &bucketDbConfig
 			return base.JSONMarshal(bucketDbConfig)
-		})
+		}))
 	if err != nil {
 		return err
 	}
@@ -852,7 +873,7 @@ func (h *handler) handlePutDbConfigImportFilter() error {
 	var updatedDbConfig *DatabaseConfig
 	cas, err := h.server.BootstrapContext.Connection.UpdateConfig(
 		bucket, h.server.Config.Bootstrap.ConfigGroupID,
-		func(rawBucketConfig []byte) (newConfig []byte, err error) {
+		recordDatabaseConfigHistory(func(rawBucketConfig []byte) (newConfig []byte, err error) {
 			var bucketDbConfig DatabaseConfig
 			if err := base.JSONUnmarshal(rawBucketConfig, &bucketDbConfig); err != nil {
 				return nil, err
@@ -877,7 +898,7 @@ func (h *handler) handlePutDbConfigImportFilter() error {
 
 			updatedDbConfig = &bucketDbConfig
 			return base.JSONMarshal(bucketDbConfig)
-		})
+		}))
 	if err != nil {
 		return err
 	}
@@ -901,6 +922,55 @@ func (h *handler) handlePutDbConfigImportFilter() error {
 	return base.HTTPErrorf(http.StatusOK, "updated")
 }
 
+// GET the console log level and log keys overridden for the database
+func (h *handler) handleGetDbConfigLogging() error {
+	h.assertAdminOnly()
+	config := base.GetDbConsoleLoggerConfig(h.db.Name)
+	if config == nil {
+		config = &base.DbConsoleLoggerConfig{}
+	}
+	h.writeJSON(config)
+	return nil
+}
+
+// PUT the console log level and log keys for the database, overriding the node's console log level and log keys for
+// the database's logs.  Only applies to this node, and isn't persisted.
+func (h *handler) handlePutDbConfigLogging() error {
+	h.assertAdminOnly()
+	var config base.DbConsoleLoggerConfig
+	if err := h.readJSONInto(&config); err != nil {
+		return err
+	}
+	if err := base.SetDbConsoleLoggerConfig(h.db.Name, &config); err != nil {
+		return base.HTTPErrorf(http.StatusBadRequest, err.Error())
+	}
+	base.InfofCtx(h.ctx(), base.KeyAll, "Setting console log level to %v and log keys to %v for database %s", config.LogLevel, config.LogKeys, base.MD(h.db.Name))
+	return base.HTTPErrorf(http.StatusOK, "updated")
+}
+
+// DELETE the console log level and log keys overridden for the database, reverting to the node's
+func (h *handler) handleDeleteDbConfigLogging() error {
+	h.assertAdminOnly()
+	if err := base.SetDbConsoleLoggerConfig(h.db.Name, nil); err != nil {
+		return err
+	}
+	return base.HTTPErrorf(http.StatusOK, "logging override removed")
+}
+
+// GET the most recent warnings and errors logged for the database on this node, oldest first
+func (h *handler) handleGetRecentErrors() error {
+	h.assertAdminOnly()
+	h.writeJSON(base.RecentLogEntries(h.db.Name))
+	return nil
+}
+
+// GET the number of requests and replications made to the database on this node by each client build
+func (h *handler) handleGetClients() error {
+	h.assertAdminOnly()
+	h.writeJSON(h.db.ClientTelemetry.Clients())
+	return nil
+}
+
 // handleDeleteDB when running in persistent config mode, deletes a database config from the bucket and removes it from the current node.
 // In non-persistent mode, the endpoint just removes the database from the node.
 func (h *handler) handleDeleteDB() error {
@@ -919,6 +989,8 @@ func (h *handler) handleDeleteDB() error {
 	if !h.server.RemoveDatabase(h.ctx(), h.db.Name) {
 		return base.HTTPErrorf(http.StatusNotFound, "missing")
 	}
+	_ = base.SetDbConsoleLoggerConfig(h.db.Name, nil)
+	base.SetRecentLogEntriesLimit(h.db.Name, 0)
 	_, _ = h.response.Write([]byte("{}"))
 	return nil
 }
@@ -1014,12 +1086,14 @@ type DatabaseStatus struct {
 	State             string                  `json:"state"`
 	ReplicationStatus []*db.ReplicationStatus `json:"replication_status"`
 	SGRCluster        *db.SGRCluster          `json:"cluster"`
+	ConfigConflict    *DatabaseConfigConflict `json:"config_conflict,omitempty"` // Set when nodes in the config group are running different config versions
 }
 
 type Status struct {
-	Databases map[string]DatabaseStatus `json:"databases"`
-	Version   string                    `json:"version"`
-	Vendor    vendor                    `json:"vendor"`
+	Databases        map[string]DatabaseStatus `json:"databases"`
+	DormantDatabases []string                  `json:"dormant_databases,omitempty"` // Databases in cold standby or suspended, which start on their first request
+	Version          string                    `json:"version"`
+	Vendor           vendor                    `json:"vendor"`
 }
 
 func (h *handler) handleGetStatus() error {
@@ -1055,6 +1129,10 @@ func (h *handler) handleGetStatus() error {
 		for _, replication := range cluster.Replications {
 			replication.ReplicationConfig = *replication.Redacted()
 		}
+		configConflict, err := h.server.getConfigConflict(database)
+		if err != nil {
+			base.WarnfCtx(h.ctx(), "Unable to check config versions for database %q: %v", base.MD(database.Name), err)
+		}
 
 		status.Databases[database.Name] = DatabaseStatus{
 			SequenceNumber:    lastSeq,
@@ -1062,13 +1140,83 @@ func (h *handler) handleGetStatus() error {
 			ServerUUID:        database.GetServerUUID(h.ctx()),
 			ReplicationStatus: replicationsStatus,
 			SGRCluster:        cluster,
+			ConfigConflict:    configConflict,
 		}
 	}
 
+	status.DormantDatabases = h.server.DormantDatabaseNames()
+
 	h.writeJSON(status)
 	return nil
 }
 
+// HTTP handler for a GET of _serverless/usage, which returns the resource usage of each database's tenant on this node,
+// keyed by database name, so that hosting platforms can bill and throttle tenants.
+func (h *handler) handleGetServerlessUsage() error {
+	if !h.server.Config.IsServerless() {
+		return base.HTTPErrorf(http.StatusBadRequest, "endpoint only supported in serverless mode")
+	}
+	result := make(map[string]db.TenantUsage)
+	for name, database := range h.server.AllDatabases() {
+		result[name] = database.TenantUsage.Usage()
+	}
+	h.writeJSON(result)
+	return nil
+}
+
+// HTTP handler for a GET of _cluster, which returns the health of the Sync Gateway nodes registered in the buckets of
+// this node's databases, keyed by node ID.
+func (h *handler) handleGetCluster() error {
+	status, err := h.server.clusterStatus()
+	if err != nil {
+		return err
+	}
+	h.writeJSON(status)
+	return nil
+}
+
+// HTTP handler for a GET of _cluster/import_partitions, which returns the assignment of import partitions to nodes for
+// each database running a sharded import feed, keyed by database name.
+func (h *handler) handleGetImportPartitions() error {
+	result := make(map[string]*base.ImportPartitionsStatus)
+	for name, database := range h.server.AllDatabases() {
+		status, err := database.ImportPartitions()
+		if err == base.ErrNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+		result[name] = status
+	}
+	h.writeJSON(result)
+	return nil
+}
+
+// HTTP handler for a PUT of _cluster/import_partitions, which updates the node weights and partition pins used to
+// assign import partitions to nodes.  The body of the request is keyed by database name, and the response is the
+// updated assignment.
+func (h *handler) handlePutImportPartitions() error {
+	var updates map[string]base.ImportPartitionsConfig
+	if err := h.readJSONInto(&updates); err != nil {
+		return err
+	}
+	databases := h.server.AllDatabases()
+	for name := range updates {
+		if _, ok := databases[name]; !ok {
+			return base.HTTPErrorf(http.StatusNotFound, "no such database %q", name)
+		}
+	}
+	for name, update := range updates {
+		err := databases[name].UpdateImportPartitions(h.ctx(), update)
+		if err == base.ErrNotFound {
+			return base.HTTPErrorf(http.StatusBadRequest, "Database %q isn't running a sharded import feed on this node", name)
+		} else if err != nil {
+			return err
+		}
+	}
+	return h.handleGetImportPartitions()
+}
+
 func (h *handler) handleSetLogging() error {
 	base.WarnfCtx(h.ctx(), "Deprecation notice: Current _logging endpoints are now deprecated. Using _config endpoints "+
 		"instead")
@@ -1199,6 +1347,12 @@ func marshalPrincipal(princ auth.Principal, includeDynamicGrantInfo bool) auth.P
 		Name:             &name,
 		ExplicitChannels: princ.ExplicitChannels().AsSet(),
 	}
+	if expiries := princ.ExplicitChannels().Expiries(); len(expiries) > 0 {
+		info.ExplicitChannelExpiry = make(map[string]time.Time, len(expiries))
+		for channel, expiry := range expiries {
+			info.ExplicitChannelExpiry[channel] = time.Unix(int64(expiry), 0).UTC()
+		}
+	}
 	if user, ok := princ.(auth.User); ok {
 		email := user.Email()
 		info.Email = &email
@@ -1216,6 +1370,9 @@ func marshalPrincipal(princ auth.Principal, includeDynamicGrantInfo bool) auth.P
 			}
 		}
 	} else {
+		if role, ok := princ.(auth.Role); ok {
+			info.IncludedRoles = role.IncludedRoles().AsSet()
+		}
 		if includeDynamicGrantInfo {
 			info.Channels = princ.Channels().AsSet()
 		}
@@ -1338,6 +1495,9 @@ func (h *handler) getUserInfo() error {
 				break
 			}
 		}
+		if h.db.LDAPProvider != nil && h.db.LDAPProvider.Issuer() == *info.JWTIssuer {
+			issuerValid = true
+		}
 		if !issuerValid {
 			info.JWTIssuer = nil
 			info.JWTLastUpdated = nil
@@ -1421,6 +1581,30 @@ func (h *handler) getRoles() error {
 	return err
 }
 
+// HTTP handler for a POST to _import, which imports the given docs immediately rather than waiting for the import feed
+// to reach them.  The body of the request looks like {"doc_ids": ["doc1", ...]}, and the response lists the outcome of
+// each doc's import.
+func (h *handler) handleImport() error {
+	h.assertAdminOnly()
+
+	if !h.db.UseXattrs() {
+		return base.HTTPErrorf(http.StatusBadRequest, "_import requires enable_shared_bucket_access")
+	}
+
+	var request struct {
+		DocIDs []string `json:"doc_ids"`
+	}
+	if err := h.readJSONInto(&request); err != nil {
+		return err
+	}
+	if len(request.DocIDs) == 0 {
+		return base.HTTPErrorf(http.StatusBadRequest, "doc_ids must contain at least one doc ID")
+	}
+
+	h.writeJSON(map[string]interface{}{"results": h.db.ImportDocs(h.ctx(), request.DocIDs)})
+	return nil
+}
+
 func (h *handler) handlePurge() error {
 	h.assertAdminOnly()
 
@@ -1613,3 +1797,46 @@ func (h *handler) putReplicationStatus() error {
 	h.writeJSON(updatedStatus)
 	return nil
 }
+
+func (h *handler) getReplicationCheckpoints() error {
+	replicationID := mux.Vars(h.rq)["replicationID"]
+	checkpoints, err := h.db.SGReplicateMgr.GetReplicationCheckpoints(replicationID)
+	if err != nil {
+		return err
+	}
+	h.writeJSON(checkpoints)
+	return nil
+}
+
+func (h *handler) postReplicationCheckpointsReset() error {
+	replicationID := mux.Vars(h.rq)["replicationID"]
+	direction := db.ActiveReplicatorDirection(h.getQuery("direction"))
+	seq := h.getQuery("seq")
+
+	checkpoints, err := h.db.SGReplicateMgr.ResetReplicationCheckpoints(replicationID, direction, seq)
+	if err != nil {
+		return err
+	}
+	h.writeJSON(checkpoints)
+	return nil
+}
+
+func (h *handler) getReplicationRejectedRevs() error {
+	replicationID := mux.Vars(h.rq)["replicationID"]
+	rejectedRevs, err := h.db.SGReplicateMgr.GetRejectedRevs(replicationID)
+	if err != nil {
+		return err
+	}
+	h.writeJSON(rejectedRevs)
+	return nil
+}
+
+func (h *handler) postReplicationRejectedRevsRetry() error {
+	replicationID := mux.Vars(h.rq)["replicationID"]
+	rejectedRevs, err := h.db.SGReplicateMgr.RetryRejectedRevs(replicationID)
+	if err != nil {
+		return err
+	}
+	h.writeJSON(rejectedRevs)
+	return nil
+}
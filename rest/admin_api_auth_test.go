@@ -543,6 +543,10 @@ func TestAdminAPIAuth(t *testing.T) {
 			Method:   "DELETE",
 			DBScoped: true,
 			Endpoint: "/_user/user",
+		}, {
+			Method:   "GET",
+			DBScoped: true,
+			Endpoint: "/_user/user/_session",
 		}, {
 			Method:   "DELETE",
 			DBScoped: true,
@@ -611,6 +615,26 @@ func TestAdminAPIAuth(t *testing.T) {
 			DBScoped: true,
 			Endpoint: "/_replicationStatus/id",
 		},
+		{
+			Method:   "GET",
+			DBScoped: true,
+			Endpoint: "/_replicationStatus/id/_checkpoint",
+		},
+		{
+			Method:   "POST",
+			DBScoped: true,
+			Endpoint: "/_replicationStatus/id/_checkpoint/reset",
+		},
+		{
+			Method:   "GET",
+			DBScoped: true,
+			Endpoint: "/_replicationStatus/id/_rejected",
+		},
+		{
+			Method:   "POST",
+			DBScoped: true,
+			Endpoint: "/_replicationStatus/id/_rejected/retry",
+		},
 		{
 			Method:   "GET",
 			Endpoint: "/_logging",
@@ -1228,6 +1252,11 @@ func TestNewlyCreateSGWPermissions(t *testing.T) {
 			Endpoint: "/db/_user/user",
 			Users:    []string{syncGatewayConfigurator, syncGatewayApp},
 		},
+		{
+			Method:   "GET",
+			Endpoint: "/db/_user/user/_session",
+			Users:    []string{syncGatewayConfigurator, syncGatewayApp, syncGatewayAppRo},
+		},
 		{
 			Method:   "DELETE",
 			Endpoint: "/db/_user/user/_session",
@@ -1278,6 +1307,26 @@ func TestNewlyCreateSGWPermissions(t *testing.T) {
 			Endpoint: "/db/_replicationStatus/repl",
 			Users:    []string{syncGatewayReplicator},
 		},
+		{
+			Method:   "GET",
+			Endpoint: "/db/_replicationStatus/repl/_checkpoint",
+			Users:    []string{syncGatewayReplicator},
+		},
+		{
+			Method:   "POST",
+			Endpoint: "/db/_replicationStatus/repl/_checkpoint/reset",
+			Users:    []string{syncGatewayReplicator},
+		},
+		{
+			Method:   "GET",
+			Endpoint: "/db/_replicationStatus/repl/_rejected",
+			Users:    []string{syncGatewayReplicator},
+		},
+		{
+			Method:   "POST",
+			Endpoint: "/db/_replicationStatus/repl/_rejected/retry",
+			Users:    []string{syncGatewayReplicator},
+		},
 		{
 			Method:   "GET",
 			Endpoint: "/_logging",
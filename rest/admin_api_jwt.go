@@ -0,0 +1,153 @@
+// Copyright 2022-Present Couchbase, Inc.
+//
+// Use of this software is governed by the Business Source License included
+// in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+// in that file, in accordance with the Business Source License, use of this
+// software will be governed by the Apache License, Version 2.0, included in
+// the file licenses/APL2.txt.
+
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/coreos/go-oidc"
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/couchbase/sync_gateway/db"
+)
+
+// DefaultAdminJWTRolesClaim is the claim used for admin roles when api.admin_jwt.roles_claim isn't set.
+const DefaultAdminJWTRolesClaim = "roles"
+
+// newAdminJWTVerifier returns a verifier for JWTs presented to the admin and metrics APIs.  Signing keys are fetched
+// from the configured JWKS URI when first required.
+func newAdminJWTVerifier(ctx context.Context, config *AdminJWTConfig) *oidc.IDTokenVerifier {
+	keySet := oidc.NewRemoteKeySet(ctx, config.JWKSURI)
+	return oidc.NewVerifier(config.Issuer, keySet, &oidc.Config{ClientID: config.Audience})
+}
+
+// validate ensures the issuer, audience and JWKS URI have been provided.
+func (c *AdminJWTConfig) validate() error {
+	if c.Issuer == "" || c.Audience == "" || c.JWKSURI == "" {
+		return fmt.Errorf("issuer, audience and jwks_uri must be provided for api.admin_jwt")
+	}
+	return nil
+}
+
+// verifyAdminJWT verifies the signature, issuer, audience and expiry of a JWT presented to the admin or metrics API,
+// and returns its subject along with the admin roles it grants.
+func (sc *ServerContext) verifyAdminJWT(ctx context.Context, rawToken string) (subject string, roles []string, err error) {
+	if sc.adminJWTVerifier == nil {
+		return "", nil, fmt.Errorf("JWT authentication isn't configured for the admin API")
+	}
+	token, err := sc.adminJWTVerifier.Verify(ctx, rawToken)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := token.Claims(&claims); err != nil {
+		return "", nil, err
+	}
+
+	jwtConfig := sc.Config.API.AdminJWT
+	rolesClaim := jwtConfig.RolesClaim
+	if rolesClaim == "" {
+		rolesClaim = DefaultAdminJWTRolesClaim
+	}
+
+	var claimValues []string
+	switch value := claims[rolesClaim].(type) {
+	case string:
+		claimValues = strings.Fields(value)
+	case []interface{}:
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				claimValues = append(claimValues, s)
+			}
+		}
+	}
+
+	// Claim values are used as admin roles directly, unless a role mapping is defined
+	for _, claimValue := range claimValues {
+		if jwtConfig.RoleMapping == nil {
+			roles = append(roles, claimValue)
+			continue
+		}
+		roles = append(roles, jwtConfig.RoleMapping[claimValue]...)
+	}
+	return token.Subject, roles, nil
+}
+
+// checkAdminJWTRoles returns true if any of the given admin roles grant one of the requested roles.  Roles are of the
+// form role or role[bucket], matching the roles checked against Couchbase Server for basic authentication.
+func checkAdminJWTRoles(roles []string, requestedRoles []RouteRole, bucketName string) bool {
+	return hasAnyRouteRole(parseAdminRoles(roles), requestedRoles, bucketName)
+}
+
+// hasAnyAdminRole returns true if any of the roles grants access to the admin API, either cluster wide or for a
+// bucket.
+func hasAnyAdminRole(roles []adminRole) bool {
+	for _, role := range roles {
+		if role.BucketName == "" {
+			if hasAnyRouteRole([]adminRole{role}, ClusterScopedEndpointRolesRead, "") {
+				return true
+			}
+		} else if hasAnyRouteRole([]adminRole{role}, BucketScopedEndpointRoles, role.BucketName) {
+			return true
+		}
+	}
+	return false
+}
+
+// permissionRouteRoles returns the roles that grant a permission - bucket scoped roles for database permissions, and
+// cluster scoped roles otherwise.
+func permissionRouteRoles(permission Permission) []RouteRole {
+	if permission.DatabaseScoped {
+		return BucketScopedEndpointRoles
+	}
+	if permission == PermStatsExport {
+		return ClusterScopedEndpointRolesRead
+	}
+	return ClusterScopedEndpointRolesWrite
+}
+
+// adminRolesPermissions returns the results of the given permissions for the admin roles, for the given bucket.
+func adminRolesPermissions(roles []adminRole, permissions []Permission, bucketName string) map[string]bool {
+	results := make(map[string]bool, len(permissions))
+	for _, permission := range permissions {
+		results[permission.PermissionName] = hasAnyRouteRole(roles, permissionRouteRoles(permission), bucketName)
+	}
+	return results
+}
+
+// checkAdminJWTAuth authenticates and authorizes an admin or metrics API request made with a JWT bearer token.
+// JWT authorization is role based, including roles granted actions by admin_role_actions.  Response permissions are
+// granted by the roles held by the token, and by the actions admin_role_actions grants those roles.
+func (h *handler) checkAdminJWTAuth(token string, authScope string, dbContext *db.DatabaseContext, accessPermissions []Permission, responsePermissions []Permission) error {
+	subject, roles, err := h.server.verifyAdminJWT(h.ctx(), token)
+	if err != nil {
+		base.InfofCtx(h.ctx(), base.KeyAuth, "%s: Invalid admin JWT: %v", h.formatSerialNumber(), err)
+		h.audit(base.AuditEventAdminAuthenticationFailed, "", http.StatusUnauthorized)
+		return base.HTTPErrorf(http.StatusUnauthorized, "Invalid token")
+	}
+
+	adminRoles := parseAdminRoles(roles)
+	if !hasAnyRouteRole(adminRoles, adminRequestRoles(authScope, h.rq.Method), authScope) &&
+		!h.checkAdminRoleAction(dbContext, accessPermissions, adminRoles) {
+		base.InfofCtx(h.ctx(), base.KeyAuth, "%s: JWT subject %s failed to auth as an admin with roles %v", h.formatSerialNumber(), base.UD(subject), roles)
+		h.audit(base.AuditEventAdminAuthenticationFailed, subject, http.StatusForbidden)
+		return base.HTTPErrorf(http.StatusForbidden, "")
+	}
+
+	h.authorizedAdminUser = subject
+	h.permissionsResults = adminRolesPermissions(adminRoles, responsePermissions, authScope)
+	grantAdminActionPermissions(h.permissionsResults, h.requestAdminActions(dbContext, adminRoles), responsePermissions)
+	h.audit(base.AuditEventAdminAuthenticationSucceeded, subject, http.StatusOK)
+
+	base.InfofCtx(h.ctx(), base.KeyAuth, "%s: JWT subject %s was successfully authorized as an admin", h.formatSerialNumber(), base.UD(subject))
+	return nil
+}
@@ -0,0 +1,266 @@
+// Copyright 2022-Present Couchbase, Inc.
+//
+// Use of this software is governed by the Business Source License included
+// in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+// in that file, in accordance with the Business Source License, use of this
+// software will be governed by the Apache License, Version 2.0, included in
+// the file licenses/APL2.txt.
+
+package rest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/couchbase/sync_gateway/auth"
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+)
+
+func TestCheckAdminJWTRoles(t *testing.T) {
+	testCases := []struct {
+		name           string
+		roles          []string
+		requestedRoles []RouteRole
+		bucketName     string
+		expected       bool
+	}{
+		{
+			name:           "cluster role",
+			roles:          []string{"ro_admin"},
+			requestedRoles: ClusterScopedEndpointRolesRead,
+			expected:       true,
+		},
+		{
+			name:           "cluster role with bucket",
+			roles:          []string{"ro_admin[db]"},
+			requestedRoles: ClusterScopedEndpointRolesRead,
+			expected:       false,
+		},
+		{
+			name:           "bucket role",
+			roles:          []string{"mobile_sync_gateway[db]"},
+			requestedRoles: BucketScopedEndpointRoles,
+			bucketName:     "db",
+			expected:       true,
+		},
+		{
+			name:           "bucket role for other bucket",
+			roles:          []string{"mobile_sync_gateway[other]"},
+			requestedRoles: BucketScopedEndpointRoles,
+			bucketName:     "db",
+			expected:       false,
+		},
+		{
+			name:           "bucket role wildcard",
+			roles:          []string{"bucket_full_access[*]"},
+			requestedRoles: BucketScopedEndpointRoles,
+			bucketName:     "db",
+			expected:       true,
+		},
+		{
+			name:           "bucket role without bucket",
+			roles:          []string{"mobile_sync_gateway"},
+			requestedRoles: BucketScopedEndpointRoles,
+			bucketName:     "db",
+			expected:       false,
+		},
+		{
+			name:           "read only role for write",
+			roles:          []string{"ro_admin"},
+			requestedRoles: ClusterScopedEndpointRolesWrite,
+			expected:       false,
+		},
+		{
+			name:           "no roles",
+			requestedRoles: ClusterScopedEndpointRolesRead,
+			expected:       false,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, checkAdminJWTRoles(test.roles, test.requestedRoles, test.bucketName))
+		})
+	}
+}
+
+func TestHasAnyAdminRole(t *testing.T) {
+	testCases := []struct {
+		name     string
+		roles    []string
+		expected bool
+	}{
+		{name: "cluster role", roles: []string{"ro_admin"}, expected: true},
+		{name: "bucket role", roles: []string{"mobile_sync_gateway[db]"}, expected: true},
+		{name: "bucket role wildcard", roles: []string{"bucket_admin[*]"}, expected: true},
+		{name: "bucket role without bucket", roles: []string{"mobile_sync_gateway"}},
+		{name: "cluster role with bucket", roles: []string{"ro_admin[db]"}},
+		{name: "unknown role", roles: []string{"data_reader[db]"}},
+		{name: "no roles"},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, hasAnyAdminRole(parseAdminRoles(test.roles)))
+		})
+	}
+}
+
+func TestAdminRolesPermissions(t *testing.T) {
+	permissions := []Permission{PermUpdateDb, PermReadPrincipalAppData, PermStatsExport, PermDevOps}
+	testCases := []struct {
+		name     string
+		roles    []string
+		expected map[string]bool
+	}{
+		{
+			name:  "bucket role",
+			roles: []string{"mobile_sync_gateway[db]"},
+			expected: map[string]bool{
+				PermUpdateDb.PermissionName:             true,
+				PermReadPrincipalAppData.PermissionName: true,
+				PermStatsExport.PermissionName:          false,
+				PermDevOps.PermissionName:               false,
+			},
+		},
+		{
+			name:  "bucket role for other bucket",
+			roles: []string{"mobile_sync_gateway[other]"},
+			expected: map[string]bool{
+				PermUpdateDb.PermissionName:             false,
+				PermReadPrincipalAppData.PermissionName: false,
+				PermStatsExport.PermissionName:          false,
+				PermDevOps.PermissionName:               false,
+			},
+		},
+		{
+			name:  "read only cluster role",
+			roles: []string{"ro_admin"},
+			expected: map[string]bool{
+				PermUpdateDb.PermissionName:             false,
+				PermReadPrincipalAppData.PermissionName: false,
+				PermStatsExport.PermissionName:          true,
+				PermDevOps.PermissionName:               false,
+			},
+		},
+		{
+			name:  "full admin",
+			roles: []string{"admin"},
+			expected: map[string]bool{
+				PermUpdateDb.PermissionName:             true,
+				PermReadPrincipalAppData.PermissionName: true,
+				PermStatsExport.PermissionName:          true,
+				PermDevOps.PermissionName:               true,
+			},
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, adminRolesPermissions(parseAdminRoles(test.roles), permissions, "db"))
+		})
+	}
+}
+
+func TestVerifyAdminJWT(t *testing.T) {
+	testKeypair, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	testJWKS := jose.JSONWebKeySet{
+		Keys: []jose.JSONWebKey{{Key: testKeypair.Public(), Use: "sig", Algorithm: "RS256", KeyID: "rsa"}},
+	}
+	testJWKSServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/jwks" {
+			_ = json.NewEncoder(w).Encode(&testJWKS)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer testJWKSServer.Close()
+
+	const (
+		testIssuer   = "testIssuer"
+		testAudience = "sync_gateway"
+	)
+
+	createToken := func(claims map[string]interface{}) string {
+		baseClaims := map[string]interface{}{
+			"iss": testIssuer,
+			"aud": []string{testAudience},
+			"sub": "admin",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+		for k, v := range claims {
+			baseClaims[k] = v
+		}
+		return auth.CreateTestJWT(t, jose.RS256, testKeypair, auth.JWTHeaders{"kid": "rsa"}, baseClaims)
+	}
+
+	testCases := []struct {
+		name          string
+		config        AdminJWTConfig
+		token         string
+		expectedRoles []string
+		expectError   bool
+	}{
+		{
+			name:          "roles array",
+			token:         createToken(map[string]interface{}{"roles": []string{"ro_admin", "mobile_sync_gateway[db]"}}),
+			expectedRoles: []string{"ro_admin", "mobile_sync_gateway[db]"},
+		},
+		{
+			name:          "roles string",
+			token:         createToken(map[string]interface{}{"roles": "ro_admin mobile_sync_gateway[db]"}),
+			expectedRoles: []string{"ro_admin", "mobile_sync_gateway[db]"},
+		},
+		{
+			name:          "custom roles claim",
+			config:        AdminJWTConfig{RolesClaim: "groups"},
+			token:         createToken(map[string]interface{}{"groups": []string{"admin"}}),
+			expectedRoles: []string{"admin"},
+		},
+		{
+			name:          "role mapping",
+			config:        AdminJWTConfig{RoleMapping: map[string][]string{"sgw-admins": {"admin"}, "sgw-readers": {"ro_admin"}}},
+			token:         createToken(map[string]interface{}{"roles": []string{"sgw-admins", "unmapped"}}),
+			expectedRoles: []string{"admin"},
+		},
+		{
+			name:        "wrong audience",
+			token:       createToken(map[string]interface{}{"aud": []string{"other"}}),
+			expectError: true,
+		},
+		{
+			name:        "expired",
+			token:       createToken(map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()}),
+			expectError: true,
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := base.TestCtx(t)
+			config := test.config
+			config.Issuer = testIssuer
+			config.Audience = testAudience
+			config.JWKSURI = testJWKSServer.URL + "/jwks"
+			require.NoError(t, config.validate())
+
+			sc := &ServerContext{
+				Config:           &StartupConfig{API: APIConfig{AdminJWT: &config}},
+				adminJWTVerifier: newAdminJWTVerifier(ctx, &config),
+			}
+			subject, roles, err := sc.verifyAdminJWT(ctx, test.token)
+			if test.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "admin", subject)
+			assert.Equal(t, test.expectedRoles, roles)
+		})
+	}
+}
@@ -0,0 +1,304 @@
+// Copyright 2022-Present Couchbase, Inc.
+//
+// Use of this software is governed by the Business Source License included
+// in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+// in that file, in accordance with the Business Source License, use of this
+// software will be governed by the Apache License, Version 2.0, included in
+// the file licenses/APL2.txt.
+
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/couchbase/sync_gateway/db"
+)
+
+// Admin API actions that Couchbase Server roles can be granted on a database via the database's admin_role_actions
+// config.
+const (
+	AdminActionReadConfig  = "read_config"  // Read the database config, sync function, import filter and functions
+	AdminActionWriteConfig = "write_config" // Update the database config, sync function, import filter and functions
+	AdminActionManageUsers = "manage_users" // Read and write users, roles and sessions
+	AdminActionRunResync   = "run_resync"   // Start, stop and monitor resync
+	AdminActionViewStats   = "view_stats"   // Read the stats endpoints
+)
+
+// AdminActions is the set of actions that can be granted by admin_role_actions.
+var AdminActions = []string{AdminActionReadConfig, AdminActionWriteConfig, AdminActionManageUsers, AdminActionRunResync, AdminActionViewStats}
+
+// adminRole is a role held by an admin user.  BucketName is empty for cluster scoped roles, or "*" for roles that
+// apply to all buckets.
+type adminRole struct {
+	RoleName   string `json:"role"`
+	BucketName string `json:"bucket_name,omitempty"`
+}
+
+func (r adminRole) String() string {
+	if r.BucketName == "" {
+		return r.RoleName
+	}
+	return r.RoleName + "[" + r.BucketName + "]"
+}
+
+// parseAdminRoles parses roles of the form role or role[bucket], as granted by admin JWTs.
+func parseAdminRoles(roles []string) []adminRole {
+	parsed := make([]adminRole, 0, len(roles))
+	for _, role := range roles {
+		roleName, roleBucket := role, ""
+		if i := strings.Index(role, "["); i > 0 && strings.HasSuffix(role, "]") {
+			roleName, roleBucket = role[:i], role[i+1:len(role)-1]
+		}
+		parsed = append(parsed, adminRole{RoleName: roleName, BucketName: roleBucket})
+	}
+	return parsed
+}
+
+// hasAnyRouteRole returns true if any of the roles matches one of the requested roles for the given bucket.
+func hasAnyRouteRole(roles []adminRole, requestedRoles []RouteRole, bucketName string) bool {
+	for _, role := range roles {
+		for _, requestedRole := range requestedRoles {
+			if role.RoleName != requestedRole.RoleName {
+				continue
+			}
+			if !requestedRole.DatabaseScoped {
+				if role.BucketName == "" {
+					return true
+				}
+				continue
+			}
+			if role.BucketName == bucketName || role.BucketName == RoleBucketWildcard {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validateAdminRoleActions ensures that every role is mapped to known actions.
+func validateAdminRoleActions(roleActions map[string][]string) error {
+	for roleName, actions := range roleActions {
+		if roleName == "" {
+			return fmt.Errorf("role name must not be empty")
+		}
+		for _, action := range actions {
+			if !isAdminAction(action) {
+				return fmt.Errorf("role %q: unknown action %q, must be one of %v", roleName, action, AdminActions)
+			}
+		}
+	}
+	return nil
+}
+
+func isAdminAction(action string) bool {
+	for _, adminAction := range AdminActions {
+		if action == adminAction {
+			return true
+		}
+	}
+	return false
+}
+
+// grantedAdminActions returns the actions that admin_role_actions grants the roles on the database with the given
+// bucket.  Bucket scoped roles only apply to their own bucket, or to all buckets for the wildcard.
+func grantedAdminActions(roleActions map[string][]string, roles []adminRole, bucketName string) map[string]bool {
+	granted := make(map[string]bool)
+	for _, role := range roles {
+		if role.BucketName != "" && role.BucketName != bucketName && role.BucketName != RoleBucketWildcard {
+			continue
+		}
+		for _, action := range roleActions[role.RoleName] {
+			granted[action] = true
+		}
+	}
+	return granted
+}
+
+// adminRequestAction returns the action performed by an admin request, or "" for requests that can't be authorized
+// via admin_role_actions.
+func adminRequestAction(accessPermissions []Permission, rq *http.Request) string {
+	for _, permission := range accessPermissions {
+		switch permission {
+		case PermStatsExport:
+			return AdminActionViewStats
+		case PermReadPrincipal, PermWritePrincipal:
+			return AdminActionManageUsers
+		case PermUpdateDb, PermConfigureSyncFn, PermConfigureAuth:
+			if strings.HasSuffix(rq.URL.Path, "/_resync") {
+				return AdminActionRunResync
+			}
+			if strings.Contains(rq.URL.Path, "/_config") {
+				if rq.Method == http.MethodGet || rq.Method == http.MethodHead {
+					return AdminActionReadConfig
+				}
+				return AdminActionWriteConfig
+			}
+		}
+	}
+	return ""
+}
+
+// adminActionPermissions are the response permissions covered by each action, granted to requests authorized via
+// admin_role_actions.
+var adminActionPermissions = map[string][]Permission{
+	AdminActionWriteConfig: {PermUpdateDb, PermConfigureSyncFn, PermConfigureAuth},
+	AdminActionManageUsers: {PermReadPrincipal, PermWritePrincipal, PermReadPrincipalAppData},
+	AdminActionViewStats:   {PermStatsExport},
+}
+
+// grantAdminActionPermissions sets the results of the response permissions covered by the granted actions to true.
+func grantAdminActionPermissions(results map[string]bool, granted map[string]bool, responsePermissions []Permission) {
+	for action := range granted {
+		for _, covered := range adminActionPermissions[action] {
+			for _, responsePermission := range responsePermissions {
+				if responsePermission == covered {
+					results[responsePermission.PermissionName] = true
+				}
+			}
+		}
+	}
+}
+
+// requestAdminActions returns the actions granted to the roles by the admin_role_actions config of the request's
+// database.  The stats endpoints aren't database scoped, so view_stats granted on any database is granted for
+// requests without a database.
+func (h *handler) requestAdminActions(dbContext *db.DatabaseContext, roles []adminRole) map[string]bool {
+	if dbContext != nil {
+		return grantedAdminActions(dbContext.Options.AdminRoleActions, roles, dbContext.Bucket.GetName())
+	}
+	granted := make(map[string]bool)
+	for _, database := range h.server.AllDatabases() {
+		if grantedAdminActions(database.Options.AdminRoleActions, roles, database.Bucket.GetName())[AdminActionViewStats] {
+			granted[AdminActionViewStats] = true
+			break
+		}
+	}
+	return granted
+}
+
+// checkAdminRoleAction returns true if the action performed by the request is granted to the roles by the
+// admin_role_actions config of the request's database.
+func (h *handler) checkAdminRoleAction(dbContext *db.DatabaseContext, accessPermissions []Permission, roles []adminRole) bool {
+	action := adminRequestAction(accessPermissions, h.rq)
+	if action == "" {
+		return false
+	}
+	return h.requestAdminActions(dbContext, roles)[action]
+}
+
+// hasAnyAdminRoleAction returns true if admin_role_actions grants the roles any action on any database.
+func (h *handler) hasAnyAdminRoleAction(roles []adminRole) bool {
+	for _, database := range h.server.AllDatabases() {
+		if len(grantedAdminActions(database.Options.AdminRoleActions, roles, database.Bucket.GetName())) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// WhoAmIResponse is the response body of the admin API's GET /_whoami.
+type WhoAmIResponse struct {
+	Name      string              `json:"name,omitempty"`
+	Roles     []string            `json:"roles"`
+	Databases map[string][]string `json:"databases"`
+}
+
+// handleWhoAmI returns the authenticated admin user along with the actions they're granted on each database, whether
+// through built-in roles, Couchbase Server permissions or admin_role_actions.
+func (h *handler) handleWhoAmI() error {
+	response := WhoAmIResponse{Roles: []string{}, Databases: make(map[string][]string)}
+	databases := h.server.AllDatabases()
+
+	if !*h.server.Config.API.AdminInterfaceAuthentication {
+		for dbName := range databases {
+			response.Databases[dbName] = AdminActions
+		}
+		h.writeJSON(response)
+		return nil
+	}
+
+	var roles []adminRole
+	var checkPermissions func(bucketName string) (map[string]bool, error)
+	if token := h.getBearerToken(); token != "" && h.server.adminJWTVerifier != nil {
+		subject, jwtRoles, err := h.server.verifyAdminJWT(h.ctx(), token)
+		if err != nil {
+			return base.HTTPErrorf(http.StatusUnauthorized, "Invalid token")
+		}
+		response.Name = subject
+		roles = parseAdminRoles(jwtRoles)
+	} else {
+		username, password := h.getBasicAuth()
+		managementEndpoints, httpClient, err := h.server.ObtainManagementEndpointsAndHTTPClient()
+		if err != nil {
+			return base.HTTPErrorf(http.StatusInternalServerError, "Error getting management endpoints: %v", err)
+		}
+		statusCode, cbsRoles, err := getAdminRoles(httpClient, managementEndpoints, username, password)
+		if err != nil {
+			return base.HTTPErrorf(http.StatusInternalServerError, "Error performing HTTP auth request: %v", err)
+		}
+		if statusCode != http.StatusOK {
+			return base.HTTPErrorf(statusCode, "")
+		}
+		response.Name = username
+		roles = cbsRoles
+		if *h.server.Config.API.EnableAdminAuthenticationPermissionsCheck {
+			checkPermissions = func(bucketName string) (map[string]bool, error) {
+				_, results, err := CheckPermissions(httpClient, managementEndpoints, bucketName, username, password, whoAmIResponsePermissions, whoAmIResponsePermissions)
+				return results, err
+			}
+		}
+	}
+
+	for _, role := range roles {
+		response.Roles = append(response.Roles, role.String())
+	}
+
+	viewStats := hasAnyRouteRole(roles, ClusterScopedEndpointRolesRead, "")
+	for dbName, database := range databases {
+		bucketName := database.Bucket.GetName()
+		granted := grantedAdminActions(database.Options.AdminRoleActions, roles, bucketName)
+		if hasAnyRouteRole(roles, BucketScopedEndpointRoles, bucketName) {
+			for _, action := range AdminActions {
+				granted[action] = true
+			}
+		}
+		if viewStats {
+			granted[AdminActionViewStats] = true
+		}
+		if checkPermissions != nil {
+			permissionResults, err := checkPermissions(bucketName)
+			if err != nil {
+				return base.HTTPErrorf(http.StatusInternalServerError, "Error performing HTTP auth request: %v", err)
+			}
+			if permissionResults[PermUpdateDb.PermissionName] {
+				granted[AdminActionReadConfig] = true
+				granted[AdminActionWriteConfig] = true
+				granted[AdminActionRunResync] = true
+			}
+			if permissionResults[PermWritePrincipal.PermissionName] {
+				granted[AdminActionManageUsers] = true
+			}
+			if permissionResults[PermStatsExport.PermissionName] {
+				granted[AdminActionViewStats] = true
+			}
+		}
+
+		actions := make([]string, 0, len(granted))
+		for _, action := range AdminActions {
+			if granted[action] {
+				actions = append(actions, action)
+			}
+		}
+		response.Databases[dbName] = actions
+	}
+
+	h.writeJSON(response)
+	return nil
+}
+
+// whoAmIResponsePermissions are the Couchbase Server permissions checked by GET /_whoami to determine the actions
+// granted on each database.
+var whoAmIResponsePermissions = []Permission{PermUpdateDb, PermWritePrincipal, PermStatsExport}
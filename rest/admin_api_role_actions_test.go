@@ -0,0 +1,150 @@
+// Copyright 2022-Present Couchbase, Inc.
+//
+// Use of this software is governed by the Business Source License included
+// in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+// in that file, in accordance with the Business Source License, use of this
+// software will be governed by the Apache License, Version 2.0, included in
+// the file licenses/APL2.txt.
+
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateAdminRoleActions(t *testing.T) {
+	assert.NoError(t, validateAdminRoleActions(map[string][]string{
+		"sgw_config_readers": {AdminActionReadConfig, AdminActionViewStats},
+		"sgw_operators":      AdminActions,
+	}))
+	assert.Error(t, validateAdminRoleActions(map[string][]string{"sgw_operators": {"delete_everything"}}))
+	assert.Error(t, validateAdminRoleActions(map[string][]string{"": {AdminActionReadConfig}}))
+}
+
+func TestGrantedAdminActions(t *testing.T) {
+	roleActions := map[string][]string{
+		"config_reader": {AdminActionReadConfig},
+		"operator":      {AdminActionRunResync, AdminActionViewStats},
+	}
+	testCases := []struct {
+		name     string
+		roles    []adminRole
+		expected map[string]bool
+	}{
+		{
+			name:     "cluster role",
+			roles:    []adminRole{{RoleName: "config_reader"}},
+			expected: map[string]bool{AdminActionReadConfig: true},
+		},
+		{
+			name:     "bucket role",
+			roles:    []adminRole{{RoleName: "operator", BucketName: "db"}},
+			expected: map[string]bool{AdminActionRunResync: true, AdminActionViewStats: true},
+		},
+		{
+			name:     "bucket role for other bucket",
+			roles:    []adminRole{{RoleName: "operator", BucketName: "other"}},
+			expected: map[string]bool{},
+		},
+		{
+			name:     "bucket role wildcard",
+			roles:    []adminRole{{RoleName: "config_reader", BucketName: "*"}, {RoleName: "operator", BucketName: "db"}},
+			expected: map[string]bool{AdminActionReadConfig: true, AdminActionRunResync: true, AdminActionViewStats: true},
+		},
+		{
+			name:     "unmapped role",
+			roles:    []adminRole{{RoleName: "ro_admin"}},
+			expected: map[string]bool{},
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, grantedAdminActions(roleActions, test.roles, "db"))
+		})
+	}
+}
+
+func TestAdminRequestAction(t *testing.T) {
+	testCases := []struct {
+		method            string
+		path              string
+		accessPermissions []Permission
+		expected          string
+	}{
+		{http.MethodGet, "/db/_config", []Permission{PermUpdateDb}, AdminActionReadConfig},
+		{http.MethodPut, "/db/_config", []Permission{PermUpdateDb, PermConfigureSyncFn, PermConfigureAuth}, AdminActionWriteConfig},
+		{http.MethodPut, "/db/_config/sync", []Permission{PermUpdateDb, PermConfigureSyncFn}, AdminActionWriteConfig},
+		{http.MethodGet, "/db/_config/effective_sync", []Permission{PermUpdateDb, PermConfigureSyncFn}, AdminActionReadConfig},
+		{http.MethodGet, "/db/_config/_history", []Permission{PermUpdateDb}, AdminActionReadConfig},
+		{http.MethodPost, "/db/_config/_rollback/2-abc", []Permission{PermUpdateDb}, AdminActionWriteConfig},
+		{http.MethodPost, "/db/_resync", []Permission{PermUpdateDb}, AdminActionRunResync},
+		{http.MethodGet, "/db/_resync", []Permission{PermUpdateDb}, AdminActionRunResync},
+		{http.MethodGet, "/db/_user/", []Permission{PermReadPrincipal}, AdminActionManageUsers},
+		{http.MethodDelete, "/db/_user/alice", []Permission{PermWritePrincipal}, AdminActionManageUsers},
+		{http.MethodGet, "/_stats", []Permission{PermStatsExport}, AdminActionViewStats},
+		{http.MethodPost, "/db/_offline", []Permission{PermUpdateDb}, ""},
+		{http.MethodGet, "/db/doc", []Permission{PermReadAppData}, ""},
+		{http.MethodGet, "/_config", []Permission{PermDevOps}, ""},
+	}
+	for _, test := range testCases {
+		t.Run(test.method+" "+test.path, func(t *testing.T) {
+			rq := httptest.NewRequest(test.method, test.path, nil)
+			assert.Equal(t, test.expected, adminRequestAction(test.accessPermissions, rq))
+		})
+	}
+}
+
+func TestGrantAdminActionPermissions(t *testing.T) {
+	responsePermissions := []Permission{PermUpdateDb, PermConfigureSyncFn, PermConfigureAuth, PermReadPrincipalAppData}
+	testCases := []struct {
+		name     string
+		granted  map[string]bool
+		expected map[string]bool
+	}{
+		{
+			name:    "write config",
+			granted: map[string]bool{AdminActionWriteConfig: true},
+			expected: map[string]bool{
+				PermUpdateDb.PermissionName:        true,
+				PermConfigureSyncFn.PermissionName: true,
+				PermConfigureAuth.PermissionName:   true,
+			},
+		},
+		{
+			name:     "manage users",
+			granted:  map[string]bool{AdminActionManageUsers: true},
+			expected: map[string]bool{PermReadPrincipalAppData.PermissionName: true},
+		},
+		{
+			name:     "read config and resync",
+			granted:  map[string]bool{AdminActionReadConfig: true, AdminActionRunResync: true},
+			expected: map[string]bool{},
+		},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			results := make(map[string]bool)
+			grantAdminActionPermissions(results, test.granted, responsePermissions)
+			assert.Equal(t, test.expected, results)
+		})
+	}
+}
+
+func TestWhoAmIAdminAuthDisabled(t *testing.T) {
+	rt := NewRestTester(t, nil)
+	defer rt.Close()
+
+	response := rt.SendAdminRequest(http.MethodGet, "/_whoami", "")
+	RequireStatus(t, response, http.StatusOK)
+
+	var whoAmI WhoAmIResponse
+	require.NoError(t, json.Unmarshal(response.BodyBytes(), &whoAmI))
+	assert.Empty(t, whoAmI.Name)
+	assert.Equal(t, map[string][]string{"db": AdminActions}, whoAmI.Databases)
+}
@@ -577,6 +577,78 @@ func TestLoggingCombined(t *testing.T) {
 	assert.Equal(t, map[string]bool{"Changes": true, "Cache": true, "HTTP": true}, logKeys)
 }
 
+func TestDbConfigLogging(t *testing.T) {
+	rt := rest.NewRestTester(t, nil)
+	defer rt.Close()
+
+	// No overrides by default
+	response := rt.SendAdminRequest(http.MethodGet, "/db/_config/logging", "")
+	rest.RequireStatus(t, response, http.StatusOK)
+	assert.JSONEq(t, `{}`, response.Body.String())
+
+	rest.RequireStatus(t, rt.SendAdminRequest(http.MethodPut, "/db/_config/logging", `{"log_level": "verbose"}`), http.StatusBadRequest)
+	rest.RequireStatus(t, rt.SendAdminRequest(http.MethodPut, "/db/_config/logging", `{"log_level": "debug", "log_keys": ["CRUD", "Sync"]}`), http.StatusOK)
+	defer func() { require.NoError(t, base.SetDbConsoleLoggerConfig("db", nil)) }()
+
+	response = rt.SendAdminRequest(http.MethodGet, "/db/_config/logging", "")
+	rest.RequireStatus(t, response, http.StatusOK)
+	assert.JSONEq(t, `{"log_level": "debug", "log_keys": ["CRUD", "Sync"]}`, response.Body.String())
+
+	rest.RequireStatus(t, rt.SendAdminRequest(http.MethodDelete, "/db/_config/logging", ""), http.StatusOK)
+	response = rt.SendAdminRequest(http.MethodGet, "/db/_config/logging", "")
+	rest.RequireStatus(t, response, http.StatusOK)
+	assert.JSONEq(t, `{}`, response.Body.String())
+	assert.Nil(t, base.GetDbConsoleLoggerConfig("db"))
+}
+
+func TestRecentErrors(t *testing.T) {
+	rt := rest.NewRestTester(t, nil)
+	defer rt.Close()
+
+	// Discard entries kept from earlier tests using the same database name
+	base.SetRecentLogEntriesLimit("db", 0)
+	base.SetRecentLogEntriesLimit("db", base.DefaultRecentLogEntriesLimit)
+
+	response := rt.SendAdminRequest(http.MethodGet, "/db/_recent_errors", "")
+	rest.RequireStatus(t, response, http.StatusOK)
+	assert.JSONEq(t, `[]`, response.Body.String())
+
+	base.WarnfCtx(rt.GetDatabase().AddDatabaseLogContext(base.TestCtx(t)), "test warning")
+
+	response = rt.SendAdminRequest(http.MethodGet, "/db/_recent_errors", "")
+	rest.RequireStatus(t, response, http.StatusOK)
+	var entries []base.RecentLogEntry
+	require.NoError(t, base.JSONUnmarshal(response.Body.Bytes(), &entries))
+	require.Len(t, entries, 1)
+	assert.Equal(t, "test warning", entries[0].Message)
+	assert.Equal(t, "warn", entries[0].Level)
+
+	// Discarded when the database is deleted
+	rest.RequireStatus(t, rt.SendAdminRequest(http.MethodDelete, "/db/", ""), http.StatusOK)
+	assert.Empty(t, base.RecentLogEntries("db"))
+}
+
+func TestGetClients(t *testing.T) {
+	rt := rest.NewRestTester(t, nil)
+	defer rt.Close()
+
+	const userAgent = "CouchbaseLite/3.0.2-13 (Java; Android 12; Pixel 6) EE/release, Commit/abc Core/3.0.2"
+	for i := 0; i < 2; i++ {
+		_ = rt.SendRequestWithHeaders(http.MethodGet, "/db/", "", map[string]string{"User-Agent": userAgent})
+	}
+	// Admin API requests aren't counted
+	rest.RequireStatus(t, rt.SendAdminRequestWithHeaders(http.MethodGet, "/db/", "", map[string]string{"User-Agent": "curl/7.79.1"}), http.StatusOK)
+
+	response := rt.SendAdminRequest(http.MethodGet, "/db/_clients", "")
+	rest.RequireStatus(t, response, http.StatusOK)
+	var clients []db.ClientSummary
+	require.NoError(t, base.JSONUnmarshal(response.Body.Bytes(), &clients))
+	require.Len(t, clients, 1)
+	assert.Equal(t, db.ClientInfo{Client: db.ClientCouchbaseLite, Version: "3.0.2", Platform: "Android"}, clients[0].ClientInfo)
+	assert.Equal(t, uint64(2), clients[0].RESTRequests)
+	assert.Equal(t, uint64(0), clients[0].BLIPConnections)
+}
+
 func TestGetStatus(t *testing.T) {
 	rt := rest.NewRestTester(t, nil)
 	defer rt.Close()
@@ -726,6 +798,45 @@ func TestRoleAPI(t *testing.T) {
 	assert.Equal(t, `["hipster","testdeleted"]`, response.Body.String())
 }
 
+func TestNestedRoleAPI(t *testing.T) {
+
+	rt := rest.NewRestTester(t, nil)
+	defer rt.Close()
+
+	rest.RequireStatus(t, rt.SendAdminRequest(http.MethodPut, "/db/_role/project", `{"admin_channels":["specs"]}`), http.StatusCreated)
+	rest.RequireStatus(t, rt.SendAdminRequest(http.MethodPut, "/db/_role/team", `{"admin_channels":["standup"], "included_roles":["project"]}`), http.StatusCreated)
+	rest.RequireStatus(t, rt.SendAdminRequest(http.MethodPut, "/db/_role/org", `{"admin_channels":["announcements"], "included_roles":["team"]}`), http.StatusCreated)
+
+	response := rt.SendAdminRequest(http.MethodGet, "/db/_role/org", "")
+	rest.RequireStatus(t, response, http.StatusOK)
+	var body db.Body
+	require.NoError(t, base.JSONUnmarshal(response.Body.Bytes(), &body))
+	assert.Equal(t, []interface{}{"team"}, body["included_roles"])
+
+	// Cycles are rejected
+	rest.RequireStatus(t, rt.SendAdminRequest(http.MethodPut, "/db/_role/project", `{"included_roles":["org"]}`), http.StatusBadRequest)
+	rest.RequireStatus(t, rt.SendAdminRequest(http.MethodPut, "/db/_role/project", `{"included_roles":["project"]}`), http.StatusBadRequest)
+
+	// included_roles only applies to roles
+	rest.RequireStatus(t, rt.SendAdminRequest(http.MethodPut, "/db/_user/ford", `{"password":"letmein", "included_roles":["org"]}`), http.StatusBadRequest)
+
+	// A user in the top level role gets the channels of every nested role
+	rest.RequireStatus(t, rt.SendAdminRequest(http.MethodPut, "/db/_user/ford", `{"password":"letmein", "admin_roles":["org"]}`), http.StatusCreated)
+	response = rt.SendAdminRequest(http.MethodGet, "/db/_user/ford", "")
+	rest.RequireStatus(t, response, http.StatusOK)
+	body = nil
+	require.NoError(t, base.JSONUnmarshal(response.Body.Bytes(), &body))
+	assert.ElementsMatch(t, []interface{}{"!", "announcements", "standup", "specs"}, body["all_channels"])
+
+	// Removing the inclusion removes the inherited channels
+	rest.RequireStatus(t, rt.SendAdminRequest(http.MethodPut, "/db/_role/team", `{"included_roles":[]}`), http.StatusOK)
+	response = rt.SendAdminRequest(http.MethodGet, "/db/_user/ford", "")
+	rest.RequireStatus(t, response, http.StatusOK)
+	body = nil
+	require.NoError(t, base.JSONUnmarshal(response.Body.Bytes(), &body))
+	assert.ElementsMatch(t, []interface{}{"!", "announcements", "standup"}, body["all_channels"])
+}
+
 func TestGuestUser(t *testing.T) {
 
 	guestUserEndpoint := fmt.Sprintf("/db/_user/%s", base.GuestUsername)
@@ -892,6 +1003,28 @@ func TestSessionAPI(t *testing.T) {
 	response = rt.SendAdminRequest("GET", fmt.Sprintf("/db/_session/%s", user1sessions[0]), "")
 	rest.RequireStatus(t, response, 200)
 
+	// 2. GET all sessions for a user
+	response = rt.SendAdminRequest("GET", "/db/_user/user1/_session", "")
+	rest.RequireStatus(t, response, 200)
+	var userSessions []struct {
+		ID         string `json:"id"`
+		Created    string `json:"created"`
+		LastSeen   string `json:"last_seen"`
+		Expiration string `json:"expiration"`
+	}
+	require.NoError(t, base.JSONUnmarshal(response.Body.Bytes(), &userSessions))
+	require.Len(t, userSessions, 5)
+	for _, session := range userSessions {
+		assert.Contains(t, user1sessions, session.ID)
+		assert.NotEmpty(t, session.Created)
+		assert.NotEmpty(t, session.LastSeen)
+		assert.NotEmpty(t, session.Expiration)
+	}
+
+	// 3. GET sessions for a user that doesn't exist
+	response = rt.SendAdminRequest("GET", "/db/_user/nobody/_session", "")
+	rest.RequireStatus(t, response, 404)
+
 	// DELETE tests
 	// 1. DELETE a session by session id
 	response = rt.SendAdminRequest("DELETE", fmt.Sprintf("/db/_session/%s", user1sessions[0]), "")
@@ -926,6 +1059,9 @@ func TestSessionAPI(t *testing.T) {
 		response = rt.SendAdminRequest("GET", fmt.Sprintf("/db/_session/%s", user2sessions[i]), "")
 		rest.RequireStatus(t, response, 404)
 	}
+	response = rt.SendAdminRequest("GET", "/db/_user/user2/_session", "")
+	rest.RequireStatus(t, response, 200)
+	assert.Equal(t, "[]", response.Body.String())
 
 	// 5. DELETE sessions when password is changed
 	// Change password for user3
@@ -1133,6 +1269,72 @@ func TestDBGetConfigNames(t *testing.T) {
 
 }
 
+func TestDBGetConfigEffectiveSync(t *testing.T) {
+	const syncFn = `function(doc){channel("all");}`
+	rt := rest.NewRestTester(t, &rest.RestTesterConfig{SyncFn: syncFn})
+	defer rt.Close()
+
+	response := rt.SendAdminRequest(http.MethodGet, "/db/_config/effective_sync", "")
+	rest.RequireStatus(t, response, http.StatusOK)
+	var body map[string]rest.EffectiveSyncFn
+	require.NoError(t, base.JSONUnmarshal(response.Body.Bytes(), &body))
+
+	// Every keyspace inherits the database-level sync function
+	require.NotEmpty(t, body)
+	for keyspace, effectiveSyncFn := range body {
+		assert.Equal(t, rest.EffectiveSyncFn{Sync: syncFn, Source: rest.SyncFnSourceDatabase}, effectiveSyncFn, "keyspace %s", keyspace)
+	}
+
+	rest.RequireStatus(t, rt.SendAdminRequest(http.MethodGet, "/notadb/_config/effective_sync", ""), http.StatusNotFound)
+}
+
+func TestGetChannels(t *testing.T) {
+	rt := rest.NewRestTester(t, nil)
+	defer rt.Close()
+
+	rest.RequireStatus(t, rt.SendAdminRequest(http.MethodPut, "/db/doc1", `{"channels": ["a", "b"]}`), http.StatusCreated)
+	rest.RequireStatus(t, rt.SendAdminRequest(http.MethodPut, "/db/doc2", `{"channels": ["a"]}`), http.StatusCreated)
+	require.NoError(t, rt.WaitForPendingChanges())
+
+	var body struct {
+		Channels []db.ChannelStats `json:"channels"`
+	}
+	response := rt.SendAdminRequest(http.MethodGet, "/db/_channels", "")
+	rest.RequireStatus(t, response, http.StatusOK)
+	require.NoError(t, base.JSONUnmarshal(response.Body.Bytes(), &body))
+	require.Len(t, body.Channels, 2)
+	assert.Equal(t, "a", body.Channels[0].Name)
+	assert.Equal(t, int64(2), body.Channels[0].DocCount)
+	assert.Equal(t, "b", body.Channels[1].Name)
+	assert.Equal(t, int64(1), body.Channels[1].DocCount)
+
+	// Not available on the public API
+	rest.RequireStatus(t, rt.SendRequest(http.MethodGet, "/db/_channels", ""), http.StatusNotFound)
+}
+
+func TestGetDCPStatus(t *testing.T) {
+	rt := rest.NewRestTester(t, nil)
+	defer rt.Close()
+
+	rest.RequireStatus(t, rt.SendAdminRequest(http.MethodPut, "/db/doc1", `{"foo":"bar"}`), http.StatusCreated)
+	require.NoError(t, rt.WaitForPendingChanges())
+
+	var status db.DCPStatus
+	response := rt.SendAdminRequest(http.MethodGet, "/db/_dcp", "")
+	rest.RequireStatus(t, response, http.StatusOK)
+	require.NoError(t, base.JSONUnmarshal(response.Body.Bytes(), &status))
+	require.NotNil(t, status.CacheFeed)
+
+	// Walrus feeds don't report per-vbucket stream state
+	if !base.UnitTestUrlIsWalrus() {
+		assert.Greater(t, status.CacheFeed.OpenStreams, 0)
+		assert.Len(t, status.CacheFeed.Vbuckets, status.CacheFeed.OpenStreams)
+	}
+
+	// Not available on the public API
+	rest.RequireStatus(t, rt.SendRequest(http.MethodGet, "/db/_dcp", ""), http.StatusNotFound)
+}
+
 // Take DB offline and ensure can post _resync
 func TestDBOfflinePostResync(t *testing.T) {
 
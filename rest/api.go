@@ -78,8 +78,8 @@ func (h *handler) handleGetCompact() error {
 		compactionType = "tombstone"
 	}
 
-	if compactionType != "tombstone" && compactionType != "attachment" {
-		return base.HTTPErrorf(http.StatusBadRequest, "Unknown parameter for 'type'. Must be 'tombstone' or 'attachment'")
+	if compactionType != "tombstone" && compactionType != "attachment" && compactionType != "channel_history" {
+		return base.HTTPErrorf(http.StatusBadRequest, "Unknown parameter for 'type'. Must be 'tombstone', 'attachment' or 'channel_history'")
 	}
 
 	var status []byte
@@ -92,6 +92,10 @@ func (h *handler) handleGetCompact() error {
 		status, err = h.db.AttachmentCompactionManager.GetStatus()
 	}
 
+	if compactionType == "channel_history" {
+		status, err = h.db.ChannelHistoryCompactionManager.GetStatus()
+	}
+
 	if err != nil {
 		return err
 	}
@@ -115,8 +119,8 @@ func (h *handler) handleCompact() error {
 		compactionType = "tombstone"
 	}
 
-	if compactionType != "tombstone" && compactionType != "attachment" {
-		return base.HTTPErrorf(http.StatusBadRequest, "Unknown parameter for 'type'. Must be 'tombstone' or 'attachment'")
+	if compactionType != "tombstone" && compactionType != "attachment" && compactionType != "channel_history" {
+		return base.HTTPErrorf(http.StatusBadRequest, "Unknown parameter for 'type'. Must be 'tombstone', 'attachment' or 'channel_history'")
 	}
 
 	if compactionType == "tombstone" {
@@ -186,6 +190,28 @@ func (h *handler) handleCompact() error {
 		}
 	}
 
+	if compactionType == "channel_history" {
+		if action == string(db.BackgroundProcessActionStart) {
+			err := h.db.ChannelHistoryCompactionManager.Start(h.ctx(), map[string]interface{}{
+				"database": h.db,
+			})
+			if err != nil {
+				return err
+			}
+		} else if action == string(db.BackgroundProcessActionStop) {
+			err := h.db.ChannelHistoryCompactionManager.Stop()
+			if err != nil {
+				return err
+			}
+		}
+
+		status, err := h.db.ChannelHistoryCompactionManager.GetStatus()
+		if err != nil {
+			return err
+		}
+		h.writeRawJSON(status)
+	}
+
 	return nil
 }
 
@@ -332,6 +358,52 @@ func (h *handler) handlePostResync() error {
 	return nil
 }
 
+func (h *handler) handleGetMigrateMetadata() error {
+	status, err := h.db.MetadataMigrationManager.GetStatus()
+	if err != nil {
+		return err
+	}
+	h.writeRawJSON(status)
+	return nil
+}
+
+func (h *handler) handlePostMigrateMetadata() error {
+	action := h.getQuery("action")
+	if action == "" {
+		action = string(db.BackgroundProcessActionStart)
+	}
+
+	if action != string(db.BackgroundProcessActionStart) && action != string(db.BackgroundProcessActionStop) {
+		return base.HTTPErrorf(http.StatusBadRequest, "Unknown parameter for 'action'. Must be start or stop")
+	}
+
+	if action == string(db.BackgroundProcessActionStart) {
+		if !h.db.UseXattrs() {
+			return base.HTTPErrorf(http.StatusBadRequest, "Metadata migration requires enable_shared_bucket_access")
+		}
+		err := h.db.MetadataMigrationManager.Start(h.ctx(), map[string]interface{}{
+			"database":     h.db,
+			"reset":        h.getBoolQuery("reset"),
+			"maxPerSecond": h.getIntQuery("max_per_second", 0),
+		})
+		if err != nil {
+			return err
+		}
+	} else if action == string(db.BackgroundProcessActionStop) {
+		err := h.db.MetadataMigrationManager.Stop()
+		if err != nil {
+			return err
+		}
+	}
+
+	status, err := h.db.MetadataMigrationManager.GetStatus()
+	if err != nil {
+		return err
+	}
+	h.writeRawJSON(status)
+	return nil
+}
+
 type PostUpgradeResponse struct {
 	Result  PostUpgradeResult `json:"post_upgrade_results"`
 	Preview bool              `json:"preview,omitempty"`
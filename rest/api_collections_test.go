@@ -11,11 +11,13 @@ package rest
 import (
 	"fmt"
 	"net/http"
+	"sync/atomic"
 	"testing"
 
 	"github.com/couchbase/gocb/v2"
 	"github.com/couchbase/sync_gateway/auth"
 	"github.com/couchbase/sync_gateway/base"
+	"github.com/couchbase/sync_gateway/db"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -112,6 +114,56 @@ func TestCollectionsPutDocInKeyspace(t *testing.T) {
 	}
 }
 
+// TestCollectionsChangesInKeyspace ensures that a changes feed can be requested for each keyspace that refers to the
+// database's collection, and only returns that collection's changes.
+func TestCollectionsChangesInKeyspace(t *testing.T) {
+	base.TestRequiresCollections(t)
+
+	tb := base.GetTestBucketNamedCollection(t)
+	defer tb.Close()
+
+	tc, err := base.AsCollection(tb)
+	require.NoError(t, err)
+
+	scopeName := tc.ScopeName()
+	collectionName := tc.Name()
+
+	rt := NewRestTester(t, &RestTesterConfig{
+		DatabaseConfig: &DatabaseConfig{
+			DbConfig: DbConfig{
+				Scopes: ScopesConfig{
+					scopeName: ScopeConfig{
+						Collections: map[string]CollectionConfig{
+							collectionName: {},
+						},
+					},
+				},
+			},
+		},
+	})
+	defer rt.Close()
+
+	resp := rt.SendKeyspaceRequest(http.MethodPut, scopeName, collectionName, "doc1", `{"test":true}`)
+	RequireStatus(t, resp, http.StatusCreated)
+
+	// Docs in the bucket's default collection aren't part of the database
+	_, err = tc.Collection.Bucket().DefaultCollection().Insert("defaultCollectionDoc", map[string]any{"test": true}, nil)
+	require.NoError(t, err)
+	require.NoError(t, rt.WaitForPendingChanges())
+
+	for _, keyspace := range []string{"db", fmt.Sprintf("db.%s", collectionName), fmt.Sprintf("db.%s.%s", scopeName, collectionName)} {
+		t.Run(keyspace, func(t *testing.T) {
+			changes, err := rt.WaitForChanges(1, fmt.Sprintf("/%s/_changes", keyspace), "", true)
+			require.NoError(t, err)
+			require.Len(t, changes.Results, 1)
+			assert.Equal(t, "doc1", changes.Results[0].ID)
+		})
+	}
+
+	resp = rt.SendKeyspaceRequest(http.MethodGet, scopeName, "buzz", "_changes", "")
+	RequireStatus(t, resp, http.StatusNotFound)
+}
+
 func TestSingleCollectionDCP(t *testing.T) {
 	base.TestRequiresCollections(t)
 	if !base.TestUseXattrs() {
@@ -239,9 +291,7 @@ func TestCollectionsBasicIndexQuery(t *testing.T) {
 
 	const docID = "doc1"
 
-	keyspace := "db." + scopeName + "." + collectionName
-
-	resp := rt.SendAdminRequest(http.MethodPut, fmt.Sprintf("/%s/%s", keyspace, docID), `{"test":true}`)
+	resp := rt.SendKeyspaceRequest(http.MethodPut, scopeName, collectionName, docID, `{"test":true}`)
 	RequireStatus(t, resp, http.StatusCreated)
 
 	// use the rt.Bucket which has got the foo.bar scope/collection set up
@@ -313,7 +363,6 @@ func TestCollectionsSGIndexQuery(t *testing.T) {
 
 	scopeName := tc.ScopeName()
 	collectionName := tc.Name()
-	keyspace := "db." + scopeName + "." + collectionName
 
 	rt := NewRestTester(t, &RestTesterConfig{
 		DatabaseConfig: &DatabaseConfig{
@@ -429,3 +478,160 @@ func TestCollectionsChangeConfigScope(t *testing.T) {
 		assert.Contains(t, res.Body, "cannot change scopes after database creation"),
 	)
 }
+
+// TestCollectionsCreateOnDatabaseCreate ensures that scopes and collections missing from the bucket are created when a
+// database is created with create_collections.
+func TestCollectionsCreateOnDatabaseCreate(t *testing.T) {
+	base.TestRequiresCollections(t)
+
+	tb := base.GetTestBucket(t)
+	defer tb.Close()
+	ctx := base.TestCtx(t)
+
+	serverErr := make(chan error)
+	config := BootstrapStartupConfigForTest(t)
+	sc, err := SetupServerContext(ctx, &config, true)
+	require.NoError(t, err)
+	defer func() {
+		sc.Close(ctx)
+		require.NoError(t, <-serverErr)
+	}()
+
+	go func() {
+		serverErr <- StartServer(ctx, &config, sc)
+	}()
+	require.NoError(t, sc.WaitForRESTAPIs())
+
+	res := BootstrapAdminRequest(t, http.MethodPut, "/db/", string(mustMarshalJSON(t, map[string]any{
+		"bucket":                      tb.GetName(),
+		"num_index_replicas":          0,
+		"enable_shared_bucket_access": base.TestUseXattrs(),
+		"use_views":                   base.TestsDisableGSI(),
+		"create_collections":          true,
+		"scopes": ScopesConfig{
+			"createdScope": {
+				Collections: CollectionsConfig{
+					"created": {},
+				},
+			},
+		},
+	})))
+	require.Equal(t, http.StatusCreated, res.StatusCode, "failed to create DB")
+
+	res = BootstrapAdminRequest(t, http.MethodPut, "/db.createdScope.created/doc1", `{"test":true}`)
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	res = BootstrapAdminRequest(t, http.MethodGet, "/db.createdScope.created/doc1", "")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+}
+
+// TestCollectionsResyncAndCompactInKeyspace ensures that resync and compaction can be run on a keyspace, and only
+// process the documents in its collection.
+func TestCollectionsResyncAndCompactInKeyspace(t *testing.T) {
+	base.TestRequiresCollections(t)
+
+	tb := base.GetTestBucketNamedCollection(t)
+	defer tb.Close()
+
+	tc, err := base.AsCollection(tb)
+	require.NoError(t, err)
+
+	scopeName := tc.ScopeName()
+	collectionName := tc.Name()
+
+	rt := NewRestTester(t, &RestTesterConfig{
+		DatabaseConfig: &DatabaseConfig{
+			DbConfig: DbConfig{
+				Scopes: ScopesConfig{
+					scopeName: ScopeConfig{
+						Collections: map[string]CollectionConfig{
+							collectionName: {},
+						},
+					},
+				},
+			},
+		},
+	})
+	defer rt.Close()
+
+	const numDocs = 5
+	for i := 0; i < numDocs; i++ {
+		resp := rt.SendKeyspaceRequest(http.MethodPut, scopeName, collectionName, fmt.Sprintf("doc%d", i), `{"test":true}`)
+		RequireStatus(t, resp, http.StatusCreated)
+	}
+	// Docs in the bucket's default collection aren't part of the database, so mustn't be resynced
+	_, err = tc.Collection.Bucket().DefaultCollection().Insert("defaultCollectionDoc", map[string]any{"test": true}, nil)
+	require.NoError(t, err)
+
+	resp := rt.SendAdminRequest(http.MethodPost, "/db/_offline", "")
+	RequireStatus(t, resp, http.StatusOK)
+	WaitAndAssertCondition(t, func() bool {
+		return atomic.LoadUint32(&rt.GetDatabase().State) == db.DBOffline
+	})
+
+	resp = rt.SendKeyspaceRequest(http.MethodPost, scopeName, "buzz", "_resync?action=start", "")
+	RequireStatus(t, resp, http.StatusNotFound)
+	resp = rt.SendKeyspaceRequest(http.MethodPost, scopeName, collectionName, "_resync?action=start", "")
+	RequireStatus(t, resp, http.StatusOK)
+
+	var resyncStatus db.ResyncManagerResponse
+	WaitAndAssertCondition(t, func() bool {
+		resp := rt.SendKeyspaceRequest(http.MethodGet, scopeName, collectionName, "_resync", "")
+		require.NoError(t, base.JSONUnmarshal(resp.BodyBytes(), &resyncStatus))
+		return resyncStatus.State == db.BackgroundProcessStateCompleted
+	})
+	assert.Equal(t, numDocs, resyncStatus.DocsProcessed)
+
+	resp = rt.SendAdminRequest(http.MethodPost, "/db/_online", "")
+	RequireStatus(t, resp, http.StatusOK)
+	WaitAndAssertCondition(t, func() bool {
+		return atomic.LoadUint32(&rt.GetDatabase().State) == db.DBOnline
+	})
+
+	resp = rt.SendKeyspaceRequest(http.MethodPost, scopeName, collectionName, "_compact", "")
+	RequireStatus(t, resp, http.StatusOK)
+	var compactStatus db.TombstoneManagerResponse
+	WaitAndAssertCondition(t, func() bool {
+		resp := rt.SendKeyspaceRequest(http.MethodGet, scopeName, collectionName, "_compact", "")
+		require.NoError(t, base.JSONUnmarshal(resp.BodyBytes(), &compactStatus))
+		return compactStatus.State == db.BackgroundProcessStateCompleted
+	})
+	assert.Empty(t, compactStatus.LastErrorMessage)
+}
+
+// TestKeyspaceRequests runs the same requests against a database using the default collection and a database using a
+// named collection.
+func TestKeyspaceRequests(t *testing.T) {
+	base.TestRequiresCollections(t)
+
+	tb := base.GetTestBucketNamedCollection(t)
+	defer tb.Close()
+
+	tc, err := base.AsCollection(tb)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name       string
+		scope      string
+		collection string
+	}{
+		{name: "default collection", scope: base.DefaultScope, collection: base.DefaultCollection},
+		{name: "named collection", scope: tc.ScopeName(), collection: tc.Name()},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			rt := NewRestTester(t, &RestTesterConfig{CustomTestBucket: tb.NoCloseClone(), persistentConfig: true})
+			defer rt.Close()
+
+			dbConfig := dbConfigForTestBucket(rt.TestBucket)
+			dbConfig.Scopes = rt.CreateKeyspaces(map[string][]string{test.scope: {test.collection}})
+			resp, err := rt.CreateDatabase("db", dbConfig)
+			require.NoError(t, err)
+			RequireStatus(t, resp, http.StatusCreated)
+
+			resp = rt.SendKeyspaceRequest(http.MethodPut, test.scope, test.collection, "keyspaceDoc", `{"test":true}`)
+			RequireStatus(t, resp, http.StatusCreated)
+			resp = rt.SendKeyspaceRequest(http.MethodGet, test.scope, test.collection, "/keyspaceDoc", "")
+			RequireStatus(t, resp, http.StatusOK)
+		})
+	}
+}
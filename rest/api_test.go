@@ -1044,6 +1044,31 @@ func TestBulkDocsIDGeneration(t *testing.T) {
 	assert.True(t, docs[1]["id"] != "")
 }
 
+// TestBulkDocsConcurrentWrites ensures that results are returned in the order of the request when docs are written
+// concurrently, and that revisions of the same doc are written in the order given.
+func TestBulkDocsConcurrentWrites(t *testing.T) {
+	rt := NewRestTester(t, &RestTesterConfig{DatabaseConfig: &DatabaseConfig{DbConfig: DbConfig{BulkDocsConcurrency: base.IntPtr(4)}}})
+	defer rt.Close()
+
+	docs := []string{`{"_id": "bulk1", "n": 1}`}
+	for i := 0; i < 20; i++ {
+		docs = append(docs, fmt.Sprintf(`{"_id": "doc%d", "n": %d}`, i, i))
+	}
+	docs = append(docs, `{"_id": "bulk1", "_rev": "1-50133ddd8e49efad34ad9ecae4cb9907", "n": 10}`)
+	response := rt.SendAdminRequest("POST", "/db/_bulk_docs", `{"docs": [`+strings.Join(docs, ",")+`]}`)
+	RequireStatus(t, response, 201)
+
+	var results []map[string]interface{}
+	require.NoError(t, base.JSONUnmarshal(response.Body.Bytes(), &results))
+	require.Len(t, results, 22)
+	assert.Equal(t, map[string]interface{}{"rev": "1-50133ddd8e49efad34ad9ecae4cb9907", "id": "bulk1"}, results[0])
+	for i := 0; i < 20; i++ {
+		assert.Equal(t, fmt.Sprintf("doc%d", i), results[i+1]["id"])
+		assert.NotEmpty(t, results[i+1]["rev"])
+	}
+	assert.Equal(t, map[string]interface{}{"rev": "2-7e384b16e63ee3218349ee568f156d6f", "id": "bulk1"}, results[21])
+}
+
 /*
 func TestBulkDocsUnusedSequences(t *testing.T) {
 
@@ -2592,6 +2617,61 @@ func TestSyncFnBodyProperties(t *testing.T) {
 	assert.ElementsMatchf(t, expectedProperties, actualProperties, "Expected sync fn body %q to match expectedProperties: %q", actualProperties, expectedProperties)
 }
 
+// Verify that the sync function can require() the modules of the database's js_library.
+func TestSyncFnJSLibrary(t *testing.T) {
+	syncFn := `function(doc) {
+		var channels = require("channels");
+		channel(channels.forOwner(doc.owner));
+	}`
+	jsLibrary := map[string]string{
+		"channels": `var prefix = require("prefix").value;
+			exports.forOwner = function(owner) { return prefix + owner; };`,
+		"prefix": `module.exports = {value: "user-"};`,
+	}
+	rt := NewRestTester(t, &RestTesterConfig{SyncFn: syncFn, DatabaseConfig: &DatabaseConfig{DbConfig: DbConfig{JSLibrary: jsLibrary}}})
+	defer rt.Close()
+
+	RequireStatus(t, rt.SendAdminRequest(http.MethodPut, "/db/doc1", `{"owner":"alice"}`), http.StatusCreated)
+
+	syncData, err := rt.GetDatabase().GetDocSyncData(base.TestCtx(t), "doc1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user-alice"}, syncData.Channels.KeySet())
+}
+
+// Verify that the machine-readable reason for a sync function rejection is returned to the client, and counted.
+func TestSyncFnRejectionReason(t *testing.T) {
+	syncFn := `function(doc) {
+		if (doc.locked) {
+			throw({forbidden: {message: "document is locked", code: "locked", details: {by: doc.locked}}});
+		}
+		requireAccess(doc.channels);
+	}`
+	rt := NewRestTester(t, &RestTesterConfig{SyncFn: syncFn})
+	defer rt.Close()
+
+	response := rt.SendAdminRequest(http.MethodPut, "/db/_user/user1", `{"password":"letmein", "admin_channels":["alpha"]}`)
+	RequireStatus(t, response, http.StatusCreated)
+
+	response = rt.SendUserRequestWithHeaders(http.MethodPut, "/db/doc1", `{"channels":["beta"]}`, nil, "user1", "letmein")
+	RequireStatus(t, response, http.StatusForbidden)
+	assert.JSONEq(t, `{"error":"Forbidden","reason":"`+base.SyncFnErrorMissingChannelAccess+`",
+		"rejection":{"code":"`+base.SyncFnRejectionCodeMissingChannelAccess+`","details":{"channels":["beta"]}}}`, response.Body.String())
+
+	response = rt.SendUserRequestWithHeaders(http.MethodPost, "/db/_bulk_docs", `{"docs":[{"_id":"doc2","locked":"user2"},{"_id":"doc3","channels":["alpha"]}]}`, nil, "user1", "letmein")
+	RequireStatus(t, response, http.StatusCreated)
+	var bulkDocsResponse []map[string]interface{}
+	require.NoError(t, base.JSONUnmarshal(response.Body.Bytes(), &bulkDocsResponse))
+	require.Len(t, bulkDocsResponse, 2)
+	assert.Equal(t, "document is locked", bulkDocsResponse[0]["reason"])
+	assert.Equal(t, map[string]interface{}{"code": "locked", "details": map[string]interface{}{"by": "user2"}}, bulkDocsResponse[0]["rejection"])
+	assert.NotContains(t, bulkDocsResponse[1], "rejection")
+
+	securityStats := rt.GetDatabase().DbStats.Security()
+	assert.Equal(t, int64(2), securityStats.NumDocsRejected.Value())
+	assert.Equal(t, int64(2), securityStats.NumDocsRejectedWithReason.Value())
+	assert.Equal(t, int64(1), securityStats.NumAccessErrors.Value())
+}
+
 // TestSyncFnBodyPropertiesTombstone puts a document into channels based on which properties are present on the document.
 // It creates a doc, and then tombstones it to see what properties are present in the body of the tombstone.
 func TestSyncFnBodyPropertiesTombstone(t *testing.T) {
@@ -5312,6 +5392,51 @@ func TestHandleHeapProfiling(t *testing.T) {
 	assert.Contains(t, string(response.BodyBytes()), "Internal error: open")
 }
 
+func TestBackgroundProfiler(t *testing.T) {
+	rt := NewRestTester(t, nil)
+	defer rt.Close()
+
+	// Not enabled by default
+	response := rt.SendAdminRequest(http.MethodGet, "/_profile/history", "")
+	RequireStatus(t, response, http.StatusNotFound)
+
+	profiler := rt.ServerContext().profiler
+	profiler.dir = t.TempDir()
+	profiler.cpuDuration = 10 * time.Millisecond
+	profiler.maxProfiles = 2
+	defer func() { profiler.dir = "" }()
+
+	// Only the most recent profiles are kept
+	for i := 0; i < 3; i++ {
+		profiler.captureProfiles(base.TestCtx(t))
+		time.Sleep(5 * time.Millisecond)
+	}
+	files, err := os.ReadDir(profiler.dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 4)
+
+	response = rt.SendAdminRequest(http.MethodGet, "/_profile/history", "")
+	RequireStatus(t, response, http.StatusOK)
+	var entries []ProfileHistoryEntry
+	require.NoError(t, base.JSONUnmarshal(response.BodyBytes(), &entries))
+	require.Len(t, entries, 4)
+	for i, entry := range entries {
+		assert.Greater(t, entry.Size, int64(0))
+		if i > 0 {
+			assert.False(t, entry.Captured.Before(entries[i-1].Captured))
+		}
+	}
+
+	response = rt.SendAdminRequest(http.MethodGet, "/_profile/history/"+entries[0].Name, "")
+	RequireStatus(t, response, http.StatusOK)
+	assert.Equal(t, int(entries[0].Size), len(response.BodyBytes()))
+
+	response = rt.SendAdminRequest(http.MethodGet, "/_profile/history/cpu-20200101T000000.000Z.pprof", "")
+	RequireStatus(t, response, http.StatusNotFound)
+	response = rt.SendAdminRequest(http.MethodGet, "/_profile/history/other.txt", "")
+	RequireStatus(t, response, http.StatusNotFound)
+}
+
 func TestHandlePprofsCmdlineAndSymbol(t *testing.T) {
 	rt := NewRestTester(t, nil)
 	defer rt.Close()
@@ -5444,6 +5569,175 @@ func TestSessionFail(t *testing.T) {
 	RequireStatus(t, response, http.StatusOK)
 }
 
+func TestSessionRefreshToken(t *testing.T) {
+	rt := NewRestTester(t, &RestTesterConfig{DatabaseConfig: &DatabaseConfig{DbConfig: DbConfig{
+		RefreshTokenTTLSecs: base.Uint32Ptr(3600),
+	}}})
+	defer rt.Close()
+
+	response := rt.SendAdminRequest(http.MethodPut, "/db/_user/user1", `{"password":"letmein"}`)
+	RequireStatus(t, response, http.StatusCreated)
+
+	getRefreshToken := func(response *TestResponse) string {
+		var body struct {
+			RefreshToken        string `json:"refresh_token"`
+			RefreshTokenExpires string `json:"refresh_token_expires"`
+		}
+		require.NoError(t, base.JSONUnmarshal(response.Body.Bytes(), &body))
+		require.NotEmpty(t, body.RefreshToken)
+		require.NotEmpty(t, body.RefreshTokenExpires)
+		return body.RefreshToken
+	}
+
+	// Log in with a password and receive a refresh token
+	response = rt.SendRequest(http.MethodPost, "/db/_session", `{"name":"user1", "password":"letmein"}`)
+	RequireStatus(t, response, http.StatusOK)
+	refreshToken := getRefreshToken(response)
+	assert.Equal(t, "no-store", response.Header().Get("Cache-Control"))
+
+	// Exchange the refresh token for a new session and refresh token
+	response = rt.SendRequest(http.MethodPost, "/db/_session", fmt.Sprintf(`{"refresh_token":%q}`, refreshToken))
+	RequireStatus(t, response, http.StatusOK)
+	assert.NotEmpty(t, response.Header().Get("Set-Cookie"))
+	rotatedToken := getRefreshToken(response)
+	assert.NotEqual(t, refreshToken, rotatedToken)
+
+	// The original refresh token can't be used again
+	response = rt.SendRequest(http.MethodPost, "/db/_session", fmt.Sprintf(`{"refresh_token":%q}`, refreshToken))
+	RequireStatus(t, response, http.StatusUnauthorized)
+
+	// Refresh tokens can't be used as session cookies
+	for _, cookieValue := range []string{rotatedToken, "refresh:" + rotatedToken} {
+		headers := map[string]string{"Cookie": fmt.Sprintf("%s=%s", auth.DefaultCookieName, cookieValue)}
+		RequireStatus(t, rt.SendRequestWithHeaders(http.MethodGet, "/db/", "", headers), http.StatusUnauthorized)
+	}
+
+	// Revoking all of the user's sessions revokes their refresh tokens
+	RequireStatus(t, rt.SendAdminRequest(http.MethodDelete, "/db/_user/user1/_session", ""), http.StatusOK)
+	response = rt.SendRequest(http.MethodPost, "/db/_session", fmt.Sprintf(`{"refresh_token":%q}`, rotatedToken))
+	RequireStatus(t, response, http.StatusUnauthorized)
+}
+
+func TestSessionExpiryFakeClock(t *testing.T) {
+	clock := base.NewFakeClock(time.Now())
+	rt := NewRestTester(t, &RestTesterConfig{Clock: clock})
+	defer rt.Close()
+
+	response := rt.SendAdminRequest(http.MethodPut, "/db/_user/user1", `{"password":"letmein"}`)
+	RequireStatus(t, response, http.StatusCreated)
+
+	// Sessions created by users have a 24 hour TTL
+	response = rt.SendRequest(http.MethodPost, "/db/_session", `{"name":"user1", "password":"letmein"}`)
+	RequireStatus(t, response, http.StatusOK)
+	cookie := response.Header().Get("Set-Cookie")
+	require.NotEmpty(t, cookie)
+	reqHeaders := map[string]string{"Cookie": cookie}
+
+	// Within the first 10% of the TTL, the session's expiry isn't extended
+	clock.Advance(time.Hour)
+	response = rt.SendRequestWithHeaders(http.MethodGet, "/db/", "", reqHeaders)
+	RequireStatus(t, response, http.StatusOK)
+	assert.Empty(t, response.Header().Get("Set-Cookie"))
+
+	// After that, using the session extends its expiry to a TTL from now
+	clock.Advance(3 * time.Hour)
+	response = rt.SendRequestWithHeaders(http.MethodGet, "/db/", "", reqHeaders)
+	RequireStatus(t, response, http.StatusOK)
+	assert.NotEmpty(t, response.Header().Get("Set-Cookie"))
+
+	// The session expires once a TTL passes without it being used
+	clock.Advance(25 * time.Hour)
+	RequireStatus(t, rt.SendRequestWithHeaders(http.MethodGet, "/db/", "", reqHeaders), http.StatusUnauthorized)
+}
+
+func TestGuestDeviceSession(t *testing.T) {
+	rt := NewRestTester(t, &RestTesterConfig{DatabaseConfig: &DatabaseConfig{DbConfig: DbConfig{
+		GuestSessions: &auth.GuestSessionConfig{SessionTTLSecs: base.Uint32Ptr(600)},
+	}}})
+	defer rt.Close()
+
+	response := rt.SendRequest(http.MethodPost, "/db/_session", `{"device_id":"phone-1"}`)
+	RequireStatus(t, response, http.StatusOK)
+	cookie := response.Header().Get("Set-Cookie")
+	assert.NotEmpty(t, cookie)
+
+	var body struct {
+		UserCtx struct {
+			Name     string                 `json:"name"`
+			Channels map[string]interface{} `json:"channels"`
+		} `json:"userCtx"`
+	}
+	require.NoError(t, base.JSONUnmarshal(response.Body.Bytes(), &body))
+	assert.Equal(t, "_guest_device_phone-1", body.UserCtx.Name)
+	assert.Contains(t, body.UserCtx.Channels, "guest:phone-1")
+
+	// The session can only see the device's channel
+	RequireStatus(t, rt.SendAdminRequest(http.MethodPut, "/db/doc1", `{"channels":["guest:phone-1"]}`), http.StatusCreated)
+	RequireStatus(t, rt.SendAdminRequest(http.MethodPut, "/db/doc2", `{"channels":["guest:phone-2"]}`), http.StatusCreated)
+	RequireStatus(t, rt.SendRequestWithHeaders(http.MethodGet, "/db/doc1", "", map[string]string{"Cookie": cookie}), http.StatusOK)
+	RequireStatus(t, rt.SendRequestWithHeaders(http.MethodGet, "/db/doc2", "", map[string]string{"Cookie": cookie}), http.StatusForbidden)
+
+	RequireStatus(t, rt.SendRequest(http.MethodPost, "/db/_session", `{"device_id":"bad/device"}`), http.StatusBadRequest)
+
+	// Disabling the device's user prevents new guest sessions
+	RequireStatus(t, rt.SendAdminRequest(http.MethodPut, "/db/_user/_guest_device_phone-1", `{"disabled":true}`), http.StatusOK)
+	RequireStatus(t, rt.SendRequest(http.MethodPost, "/db/_session", `{"device_id":"phone-1"}`), http.StatusUnauthorized)
+}
+
+func TestGuestDeviceSessionCreationLimit(t *testing.T) {
+	rt := NewRestTester(t, &RestTesterConfig{DatabaseConfig: &DatabaseConfig{DbConfig: DbConfig{
+		GuestSessions: &auth.GuestSessionConfig{MaxCreationsPerSource: 2, CreationWindowSecs: 600},
+	}}})
+	defer rt.Close()
+
+	guestSessionFrom := func(deviceID, remoteAddr string) *TestResponse {
+		request := Request(http.MethodPost, "/db/_session", `{"device_id":"`+deviceID+`"}`)
+		request.RemoteAddr = remoteAddr
+		return rt.Send(request)
+	}
+
+	RequireStatus(t, guestSessionFrom("phone-1", "192.0.2.1:1000"), http.StatusOK)
+	RequireStatus(t, guestSessionFrom("phone-2", "192.0.2.1:1001"), http.StatusOK)
+
+	// Further users can't be created from the same source, but existing users can still get sessions
+	RequireStatus(t, guestSessionFrom("phone-3", "192.0.2.1:1002"), http.StatusTooManyRequests)
+	RequireStatus(t, guestSessionFrom("phone-1", "192.0.2.1:1003"), http.StatusOK)
+	RequireStatus(t, guestSessionFrom("phone-3", "192.0.2.2:1000"), http.StatusOK)
+
+	// Guest device users expire after their most recent session
+	user, err := rt.GetDatabase().Authenticator(base.TestCtx(t)).GetUser("_guest_device_phone-1")
+	require.NoError(t, err)
+	require.NotNil(t, user)
+	assert.WithinDuration(t, time.Now().Add(auth.DefaultGuestUserTTLSecs*time.Second), user.GuestExpiry(), time.Minute)
+}
+
+func TestGuestDeviceSessionDisabled(t *testing.T) {
+	rt := NewRestTester(t, nil)
+	defer rt.Close()
+
+	RequireStatus(t, rt.SendRequest(http.MethodPost, "/db/_session", `{"device_id":"phone-1"}`), http.StatusBadRequest)
+}
+
+func TestLoginThrottle(t *testing.T) {
+	rt := NewRestTester(t, &RestTesterConfig{DatabaseConfig: &DatabaseConfig{DbConfig: DbConfig{
+		LoginThrottle: &auth.LoginThrottleConfig{MaxFailures: 2, InitialBackoffMs: 60000, MaxBackoffMs: 60000, LockoutDurationSecs: 600},
+	}}})
+	defer rt.Close()
+
+	RequireStatus(t, rt.SendAdminRequest(http.MethodPut, "/db/_user/alice", `{"password":"letmein"}`), http.StatusCreated)
+
+	// The first failure backs off further attempts, even with the right password
+	RequireStatus(t, rt.SendUserRequestWithHeaders(http.MethodGet, "/db/", "", nil, "alice", "wrong"), http.StatusUnauthorized)
+	response := rt.SendUserRequestWithHeaders(http.MethodGet, "/db/", "", nil, "alice", "letmein")
+	RequireStatus(t, response, http.StatusTooManyRequests)
+	assert.Equal(t, "60", response.Header().Get("Retry-After"))
+	RequireStatus(t, rt.SendRequest(http.MethodPost, "/db/_session", `{"name":"alice","password":"letmein"}`), http.StatusTooManyRequests)
+
+	securityStats := rt.GetDatabase().DbStats.Security()
+	assert.Equal(t, int64(2), securityStats.AuthThrottledCount.Value())
+	assert.Equal(t, int64(0), securityStats.AuthLockoutCount.Value())
+}
+
 func TestImportOnWriteMigration(t *testing.T) {
 	base.SetUpTestLogging(t, base.LevelDebug, base.KeyAll)
 	if base.UnitTestUrlIsWalrus() {
@@ -4672,3 +4672,69 @@ func TestUnsubChanges(t *testing.T) {
 	_, found = btc.WaitForRev("doc2", resp.Rev)
 	assert.True(t, found)
 }
+
+// TestBlipClientReplicatorResume ensures that the simulated Couchbase Lite replicator resumes pulling from its
+// checkpoint after restarting, and pushes the documents written on the client while it was stopped.
+func TestBlipClientReplicatorResume(t *testing.T) {
+	base.SetUpTestLogging(t, base.LevelInfo, base.KeySync, base.KeySyncMsg)
+
+	rt := NewRestTester(t, &RestTesterConfig{GuestEnabled: true})
+	defer rt.Close()
+
+	replicator, err := NewBlipClientReplicator(t, rt, &BlipClientReplicatorOpts{Continuous: true})
+	require.NoError(t, err)
+	defer replicator.Close()
+
+	doc1 := rt.PutDoc("doc1", `{"source":"server"}`)
+	_, found := replicator.Client().WaitForRev("doc1", doc1.Rev)
+	require.True(t, found)
+	seq, err := rt.SequenceForDoc("doc1")
+	require.NoError(t, err)
+	replicator.WaitForSequence(seq)
+	require.NoError(t, replicator.Stop())
+
+	doc2 := rt.PutDoc("doc2", `{"source":"server"}`)
+	require.NoError(t, replicator.PutDoc("doc3", []byte(`{"source":"client"}`)))
+	_, found = replicator.Client().GetRev("doc2", doc2.Rev)
+	assert.False(t, found)
+
+	require.NoError(t, replicator.Start())
+	_, found = replicator.Client().WaitForRev("doc2", doc2.Rev)
+	require.True(t, found)
+	assert.Equal(t, "client", rt.GetDoc("doc3")["source"])
+
+	// doc1 was pulled before the checkpoint, so isn't pulled again
+	for _, msg := range replicator.client.pullReplication.GetMessages() {
+		if msg.Profile() == db.MessageRev {
+			assert.NotEqual(t, "doc1", msg.Properties[db.RevMessageID])
+		}
+	}
+}
+
+// TestBlipClientReplicatorRevocation ensures that the simulated Couchbase Lite replicator purges documents revoked from
+// its user.
+func TestBlipClientReplicatorRevocation(t *testing.T) {
+	base.SetUpTestLogging(t, base.LevelInfo, base.KeySync, base.KeySyncMsg)
+
+	revocationTester, rt := InitScenario(t, nil)
+	defer rt.Close()
+
+	replicator, err := NewBlipClientReplicator(t, rt, &BlipClientReplicatorOpts{
+		BlipTesterClientOpts: BlipTesterClientOpts{Username: "user", SendRevocations: true},
+		Continuous:           true,
+	})
+	require.NoError(t, err)
+	defer replicator.Close()
+
+	revocationTester.addRoleChannel("foo", "A")
+	revocationTester.addRole("user", "foo")
+	revID := rt.CreateDocReturnRev(t, "doc", "", map[string]interface{}{"channels": "A"})
+	_, found := replicator.Client().WaitForRev("doc", revID)
+	require.True(t, found)
+
+	revocationTester.removeRole("user", "foo")
+	require.NoError(t, rt.WaitForCondition(func() bool {
+		_, _, found := replicator.CurrentRev("doc")
+		return !found
+	}))
+}
@@ -0,0 +1,382 @@
+//  Copyright 2022-Present Couchbase, Inc.
+//
+//  Use of this software is governed by the Business Source License included
+//  in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+//  in that file, in accordance with the Business Source License, use of this
+//  software will be governed by the Apache License, Version 2.0, included in
+//  the file licenses/APL2.txt.
+
+package rest
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/couchbase/go-blip"
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/couchbase/sync_gateway/db"
+)
+
+type BlipClientReplicatorOpts struct {
+	BlipTesterClientOpts
+	Collection string // Collection of the client to replicate, from BlipTesterClientOpts.Collections. Defaults to the default collection
+	Continuous bool   // Keep pulling changes after catching up, rather than running a one-shot pull
+	ActiveOnly bool   // Don't pull deleted documents when starting from the beginning
+}
+
+// BlipClientReplicator simulates a Couchbase Lite replicator on top of a BlipTesterClient, so that tests can assert
+// end-to-end replication behaviour.  It pulls changes since its checkpoint, which is saved on Sync Gateway, and pushes
+// the documents written on the client.  Stopping and starting the replicator reconnects to Sync Gateway and resumes
+// from the checkpoint, keeping the documents stored on the client.  Documents revoked from the user are purged from the
+// client.  Delta sync and attachments are handled by the underlying BlipTesterClient.
+type BlipClientReplicator struct {
+	BlipClientReplicatorOpts
+
+	client       *BlipTesterClient
+	collection   *BlipTesterCollectionClient
+	checkpointID string
+
+	pushLock      sync.Mutex // Serializes pushes of pending writes
+	lock          sync.Mutex
+	running       bool
+	checkpointRev string                        // Revision of the checkpoint saved on Sync Gateway
+	lastSeq       string                        // Sequence that all changes have been pulled up to
+	pending       []*blipClientReplicatorChange // Changes pulled since lastSeq, in sequence order
+	pendingWrites []blipClientReplicatorWrite   // Writes made on the client that haven't been pushed
+}
+
+// blipClientReplicatorChange is a change received by the replicator, and whether it's been pulled.
+type blipClientReplicatorChange struct {
+	seq, docID, revID string
+	done              bool
+}
+
+// blipClientReplicatorWrite is a document written on the client that's waiting to be pushed.
+type blipClientReplicatorWrite struct {
+	docID string
+	body  []byte
+}
+
+// NewBlipClientReplicator connects a client to the RestTester and starts replicating.
+func NewBlipClientReplicator(tb testing.TB, rt *RestTester, opts *BlipClientReplicatorOpts) (*BlipClientReplicator, error) {
+	if opts == nil {
+		opts = &BlipClientReplicatorOpts{}
+	}
+	r := &BlipClientReplicator{BlipClientReplicatorOpts: *opts}
+	r.PurgeOnRevocation = true
+
+	var err error
+	if r.client, err = NewBlipTesterClientOptsWithRT(tb, rt, &r.BlipTesterClientOpts); err != nil {
+		return nil, err
+	}
+	if r.collection, err = r.client.Collection(r.Collection); err != nil {
+		r.client.Close()
+		return nil, fmt.Errorf("collection %q isn't replicated by the client: %w", r.Collection, err)
+	}
+	r.checkpointID = "cbl-" + r.client.id
+
+	if err := r.start(); err != nil {
+		r.client.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Client returns the underlying client, whose documents and messages can be inspected.
+func (r *BlipClientReplicator) Client() *BlipTesterCollectionClient {
+	return r.collection
+}
+
+// Start reconnects a stopped replicator, and resumes replication from its checkpoint.
+func (r *BlipClientReplicator) Start() error {
+	r.lock.Lock()
+	running := r.running
+	r.lock.Unlock()
+	if running {
+		return nil
+	}
+	if err := r.client.Reconnect(); err != nil {
+		return err
+	}
+	return r.start()
+}
+
+// start fetches the checkpoint, and starts pulling changes since it before pushing any pending writes.
+func (r *BlipClientReplicator) start() error {
+	r.wrapHandlers()
+
+	since, err := r.getCheckpoint()
+	if err != nil {
+		return err
+	}
+	r.lock.Lock()
+	r.lastSeq = since
+	r.pending = nil
+	r.running = true
+	r.lock.Unlock()
+
+	if err := r.collection.StartPullSince(strconv.FormatBool(r.Continuous), since, strconv.FormatBool(r.ActiveOnly)); err != nil {
+		return err
+	}
+	return r.pushPendingWrites()
+}
+
+// Stop saves the replicator's checkpoint and disconnects from Sync Gateway.
+func (r *BlipClientReplicator) Stop() error {
+	if err := r.SaveCheckpoint(); err != nil {
+		return err
+	}
+	r.Disconnect()
+	return nil
+}
+
+// Disconnect drops the replicator's connections without saving its checkpoint, as happens when a client loses its
+// network connection.  Changes pulled since the last saved checkpoint are pulled again when the replicator restarts.
+func (r *BlipClientReplicator) Disconnect() {
+	r.lock.Lock()
+	r.running = false
+	r.lock.Unlock()
+	r.client.pullReplication.Close()
+	r.client.pushReplication.Close()
+}
+
+// Close stops the replicator and discards the client's documents.
+func (r *BlipClientReplicator) Close() {
+	r.lock.Lock()
+	running := r.running
+	r.lock.Unlock()
+	if running {
+		_ = r.SaveCheckpoint()
+		r.client.Close()
+		return
+	}
+	// The replication connections were closed when the replicator stopped
+	for _, collection := range r.client.CollectionClients {
+		collection.Close()
+	}
+}
+
+// PutDoc writes a new revision of a document on the client, as a child of the client's current revision.  The revision
+// is pushed immediately when the replicator is running, otherwise it's pushed once the replicator is restarted.
+func (r *BlipClientReplicator) PutDoc(docID string, body []byte) error {
+	r.lock.Lock()
+	r.pendingWrites = append(r.pendingWrites, blipClientReplicatorWrite{docID: docID, body: body})
+	running := r.running
+	r.lock.Unlock()
+	if !running {
+		return nil
+	}
+	return r.pushPendingWrites()
+}
+
+// pushPendingWrites pushes the writes made on the client, in the order they were made.
+func (r *BlipClientReplicator) pushPendingWrites() error {
+	r.pushLock.Lock()
+	defer r.pushLock.Unlock()
+	for {
+		r.lock.Lock()
+		if len(r.pendingWrites) == 0 {
+			r.lock.Unlock()
+			return nil
+		}
+		write := r.pendingWrites[0]
+		r.lock.Unlock()
+
+		parentRev, _ := r.collection.getLastReplicatedRev(write.docID)
+		if _, err := r.collection.PushRev(write.docID, parentRev, write.body); err != nil {
+			return fmt.Errorf("error pushing doc %q: %w", write.docID, err)
+		}
+
+		r.lock.Lock()
+		r.pendingWrites = r.pendingWrites[1:]
+		r.lock.Unlock()
+	}
+}
+
+// CurrentRev returns the client's current revision of the given document, and whether the client has the document.
+func (r *BlipClientReplicator) CurrentRev(docID string) (revID string, body []byte, found bool) {
+	revID, found = r.collection.getLastReplicatedRev(docID)
+	if !found {
+		return "", nil, false
+	}
+	body, found = r.collection.GetRev(docID, revID)
+	return revID, body, found
+}
+
+// LastSequence returns the sequence that the replicator has pulled all changes up to.
+func (r *BlipClientReplicator) LastSequence() string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.lastSeq
+}
+
+// WaitForSequence waits until the replicator has pulled all changes up to the given sequence.
+func (r *BlipClientReplicator) WaitForSequence(seq uint64) {
+	rt := r.client.rt
+	err := rt.WaitForCondition(func() bool {
+		lastSeq, err := rt.GetDatabase().ParseSequenceID(r.LastSequence())
+		return err == nil && lastSeq.Seq >= seq
+	})
+	if err != nil {
+		rt.TB.Fatalf("BlipClientReplicator timed out waiting for sequence %d, pulled up to %q", seq, r.LastSequence())
+	}
+}
+
+// getCheckpoint returns the sequence in the replicator's checkpoint on Sync Gateway, or "0" if it hasn't saved one.
+func (r *BlipClientReplicator) getCheckpoint() (since string, err error) {
+	request := db.GetSGR2CheckpointRequest{Client: r.checkpointID, CollectionIdx: r.collectionIdx()}
+	if err := request.Send(r.client.pullReplication.bt.sender); err != nil {
+		return "", err
+	}
+	checkpoint, err := request.Response()
+	if err != nil {
+		return "", err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if checkpoint == nil {
+		r.checkpointRev = ""
+		return "0", nil
+	}
+	r.checkpointRev = checkpoint.RevID
+	var body struct {
+		Remote string `json:"remote"`
+	}
+	if err := base.JSONUnmarshal(checkpoint.BodyBytes, &body); err != nil {
+		return "", err
+	}
+	if body.Remote == "" {
+		return "0", nil
+	}
+	return body.Remote, nil
+}
+
+// SaveCheckpoint saves the sequence that the replicator has pulled all changes up to on Sync Gateway.
+func (r *BlipClientReplicator) SaveCheckpoint() error {
+	r.lock.Lock()
+	request := db.SetSGR2CheckpointRequest{
+		Client:        r.checkpointID,
+		RevID:         base.StringPtr(r.checkpointRev),
+		CollectionIdx: r.collectionIdx(),
+		Checkpoint:    db.Body{"remote": r.lastSeq},
+	}
+	if r.checkpointRev == "" {
+		request.RevID = nil
+	}
+	r.lock.Unlock()
+
+	if err := request.Send(r.client.pullReplication.bt.sender); err != nil {
+		return err
+	}
+	response, err := request.Response()
+	if err != nil {
+		return err
+	}
+	r.lock.Lock()
+	r.checkpointRev = response.RevID
+	r.lock.Unlock()
+	return nil
+}
+
+func (r *BlipClientReplicator) collectionIdx() *int {
+	if r.collection.collection == "" {
+		return nil
+	}
+	return &r.collection.collectionIdx
+}
+
+// wrapHandlers wraps the client's pull replication handlers to track which changes have been pulled, so that the
+// checkpoint only covers changes whose revisions are stored on the client.
+func (r *BlipClientReplicator) wrapHandlers() {
+	handlers := r.client.pullReplication.bt.blipContext.HandlerForProfile
+
+	changesHandler := handlers[db.MessageChanges]
+	handlers[db.MessageChanges] = func(msg *blip.Message) {
+		r.addChanges(msg)
+		changesHandler(msg)
+	}
+
+	revHandler := handlers[db.MessageRev]
+	handlers[db.MessageRev] = func(msg *blip.Message) {
+		revHandler(msg)
+		docID, revID := msg.Properties[db.RevMessageID], msg.Properties[db.RevMessageRev]
+		if _, found := r.collection.GetRev(docID, revID); found {
+			r.completeChange(docID, revID)
+		}
+	}
+
+	noRevHandler := handlers[db.MessageNoRev]
+	handlers[db.MessageNoRev] = func(msg *blip.Message) {
+		noRevHandler(msg)
+		r.completeChange(msg.Properties[db.NorevMessageId], msg.Properties[db.NorevMessageRev])
+	}
+}
+
+// addChanges records the changes in a changes message.  Changes the client already has, and revoked documents that it
+// purges, are complete without pulling a revision.
+func (r *BlipClientReplicator) addChanges(msg *blip.Message) {
+	body, err := msg.Body()
+	if err != nil || string(body) == "null" {
+		return
+	}
+	var changes [][]interface{}
+	if err := base.JSONUnmarshal(body, &changes); err != nil {
+		return
+	}
+
+	r.lock.Lock()
+	for _, change := range changes {
+		if len(change) < 3 {
+			continue
+		}
+		entry := &blipClientReplicatorChange{seq: formatChangeSequence(change[0])}
+		entry.docID, _ = change[1].(string)
+		entry.revID, _ = change[2].(string)
+		if len(change) > 3 {
+			deletedFlags, _ := change[3].(float64)
+			entry.done = int(deletedFlags)&2 == 2 || int(deletedFlags)&4 == 4
+		}
+		if _, found := r.collection.GetRev(entry.docID, entry.revID); found {
+			entry.done = true
+		}
+		r.pending = append(r.pending, entry)
+	}
+	r._advanceLastSeq()
+	r.lock.Unlock()
+}
+
+// completeChange marks the changes for the given revision as pulled.
+func (r *BlipClientReplicator) completeChange(docID, revID string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, change := range r.pending {
+		if change.docID == docID && change.revID == revID {
+			change.done = true
+		}
+	}
+	r._advanceLastSeq()
+}
+
+// _advanceLastSeq moves lastSeq past the changes that have been pulled, up to the first that hasn't.  Requires the
+// lock to be held.
+func (r *BlipClientReplicator) _advanceLastSeq() {
+	for len(r.pending) > 0 && r.pending[0].done {
+		r.lastSeq = r.pending[0].seq
+		r.pending = r.pending[1:]
+	}
+}
+
+// formatChangeSequence returns a sequence from a changes message in the format used for a since value.
+func formatChangeSequence(seq interface{}) string {
+	switch seq := seq.(type) {
+	case float64:
+		return strconv.FormatUint(uint64(seq), 10)
+	case string:
+		return seq
+	default:
+		return fmt.Sprint(seq)
+	}
+}
@@ -35,6 +35,7 @@ type BlipTesterClientOpts struct {
 	SendRevocations        bool
 	SupportedBLIPProtocols []string
 	Collections            []string
+	PurgeOnRevocation      bool // Purge documents revoked or removed from the user's channels rather than pulling them, as Couchbase Lite does
 
 	// a deltaSrc rev ID for which to reject a delta
 	rejectDeltasForSrcRev string
@@ -45,6 +46,7 @@ type BlipTesterClient struct {
 	BlipTesterClientOpts
 
 	rt              *RestTester
+	id              string                // Generated UUID on creation, used to identify the client's replications
 	pullReplication *BlipTesterReplicator // SG -> CBL replications
 	pushReplication *BlipTesterReplicator // CBL -> SG replications
 
@@ -160,6 +162,7 @@ func (btr *BlipTesterReplicator) initHandlers(btc *BlipTesterClient) {
 			}
 
 			knownRevs = make([]interface{}, len(changesReqs))
+			var purgedDocIDs []string
 			// changesReqs == [[sequence, docID, revID, {deleted}, {size (bytes)}], ...]
 			btcr.docsLock.RLock() // TODO: Move locking to accessor methods
 		outer:
@@ -175,6 +178,12 @@ func (btr *BlipTesterReplicator) initHandlers(btc *BlipTesterClient) {
 					}
 				}
 
+				if btc.PurgeOnRevocation && (deletedInt&2 == 2 || deletedInt&4 == 4) {
+					purgedDocIDs = append(purgedDocIDs, docID)
+					knownRevs[i] = nil
+					continue
+				}
+
 				// Build up a list of revisions known to the client for each change
 				// The first element of each revision list must be the parent revision of the change
 				if revs, haveDoc := btcr.docs[docID]; haveDoc {
@@ -210,6 +219,10 @@ func (btr *BlipTesterReplicator) initHandlers(btc *BlipTesterClient) {
 
 			}
 			btcr.docsLock.RUnlock()
+
+			for _, docID := range purgedDocIDs {
+				btcr.purgeDoc(docID)
+			}
 		}
 
 		response := msg.Response()
@@ -483,6 +496,17 @@ func (btc *BlipTesterCollectionClient) updateLastReplicatedRev(docID, revID stri
 	}
 }
 
+// purgeDoc removes all revisions of the given document from the client.
+func (btc *BlipTesterCollectionClient) purgeDoc(docID string) {
+	btc.docsLock.Lock()
+	delete(btc.docs, docID)
+	btc.docsLock.Unlock()
+
+	btc.lastReplicatedRevLock.Lock()
+	delete(btc.lastReplicatedRev, docID)
+	btc.lastReplicatedRevLock.Unlock()
+}
+
 func (btc *BlipTesterCollectionClient) getLastReplicatedRev(docID string) (revID string, ok bool) {
 	btc.lastReplicatedRevLock.RLock()
 	defer btc.lastReplicatedRevLock.RUnlock()
@@ -527,17 +551,39 @@ func createBlipTesterClientOpts(tb testing.TB, rt *RestTester, opts *BlipTesterC
 	if err != nil {
 		return nil, err
 	}
+	btc.id = id.String()
 
-	if btc.pushReplication, err = newBlipTesterReplication(btc.rt.TB, "push"+id.String(), &btc); err != nil {
-		return nil, err
-	}
-	if btc.pullReplication, err = newBlipTesterReplication(btc.rt.TB, "pull"+id.String(), &btc); err != nil {
+	if err := btc.connect(); err != nil {
 		return nil, err
 	}
 
 	btc.CollectionClients = make(map[string]*BlipTesterCollectionClient)
 
-	if len(opts.Collections) != 0 {
+	if len(opts.Collections) == 0 {
+		if err := btc.initCollectionReplication("", -1); err != nil {
+			return nil, err
+		}
+	} else {
+		for i, collection := range opts.Collections {
+			if err := btc.initCollectionReplication(collection, i); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &btc, nil
+}
+
+// connect opens the client's push and pull replication connections, and checks that the client's collections exist.
+func (btc *BlipTesterClient) connect() (err error) {
+	if btc.pushReplication, err = newBlipTesterReplication(btc.rt.TB, "push"+btc.id, btc); err != nil {
+		return err
+	}
+	if btc.pullReplication, err = newBlipTesterReplication(btc.rt.TB, "pull"+btc.id, btc); err != nil {
+		return err
+	}
+
+	if len(btc.Collections) != 0 {
 		getCollectionsRequest := blip.NewRequest()
 		getCollectionsRequest.SetProfile(db.MessageGetCollections)
 
@@ -552,12 +598,12 @@ func createBlipTesterClientOpts(tb testing.TB, rt *RestTester, opts *BlipTesterC
 		}
 		body, err := base.JSONMarshal(requestBody)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		getCollectionsRequest.SetBody(body)
 		if err := btc.pullReplication.sendMsg(getCollectionsRequest); err != nil {
-			return nil, err
+			return err
 		}
 
 		type CollectionsResponseEntry struct {
@@ -567,35 +613,31 @@ func createBlipTesterClientOpts(tb testing.TB, rt *RestTester, opts *BlipTesterC
 
 		response, err := getCollectionsRequest.Response().Body()
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		var collectionResponse []*CollectionsResponseEntry
 		err = base.JSONUnmarshal(response, &collectionResponse)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		for i, perCollectionResponse := range collectionResponse {
 			if perCollectionResponse == nil {
-				return nil, fmt.Errorf("collection doesn't exist on peer %s", opts.Collections[i])
+				return fmt.Errorf("collection doesn't exist on peer %s", btc.Collections[i])
 			}
 		}
 	}
 
-	if len(opts.Collections) == 0 {
-		if err := btc.initCollectionReplication("", -1); err != nil {
-			return nil, err
-		}
-	} else {
-		for i, collection := range opts.Collections {
-			if err := btc.initCollectionReplication(collection, i); err != nil {
-				return nil, err
-			}
-		}
-	}
+	return nil
+}
 
-	return &btc, nil
+// Reconnect closes the client's replication connections and opens new ones.  Documents and attachments stored on the
+// client are kept, as they are when a Couchbase Lite replicator restarts.
+func (btc *BlipTesterClient) Reconnect() error {
+	btc.pullReplication.Close()
+	btc.pushReplication.Close()
+	return btc.connect()
 }
 
 // NewBlipTesterClient returns a client which emulates the behaviour of a CBL client over BLIP.
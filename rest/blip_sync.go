@@ -13,6 +13,7 @@ package rest
 import (
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/couchbase/sync_gateway/db"
 
@@ -22,17 +23,31 @@ import (
 
 // HTTP handler for incoming BLIP sync WebSocket request (/db/_blipsync)
 func (h *handler) handleBLIPSync() error {
+	h.longRunning = true
+
 	// Exit early when the connection can't be switched to websocket protocol.
 	if _, ok := h.response.(http.Hijacker); !ok {
 		base.DebugfCtx(h.ctx(), base.KeyHTTP, "Non-upgradable request received for BLIP+WebSocket protocol")
 		return base.HTTPErrorf(http.StatusUpgradeRequired, "Can't upgrade this request to websocket connection")
 	}
 
+	if limiter := h.db.UserConnectionLimiter; limiter != nil && h.user != nil {
+		release, err := limiter.AcquireReplication(h.user.Name())
+		if err != nil {
+			base.InfofCtx(h.ctx(), base.KeyHTTP, "Rejected BLIP replication for user %s: %v", base.UD(h.user.Name()), err)
+			return err
+		}
+		defer release()
+	}
+
+	releaseMemory := h.db.MemoryAccountant.AddBlipConnection()
+	defer releaseMemory()
+
 	h.db.DatabaseContext.DbStats.Database().NumReplicationsActive.Add(1)
 	h.db.DatabaseContext.DbStats.Database().NumReplicationsTotal.Add(1)
 	defer h.db.DatabaseContext.DbStats.Database().NumReplicationsActive.Add(-1)
 
-	if c := h.server.Config.Replicator.BLIPCompression; c != nil {
+	if c := h.server.blipCompression(); c != nil {
 		blip.CompressionLevel = *c
 	}
 
@@ -42,8 +57,9 @@ func (h *handler) handleBLIPSync() error {
 		return err
 	}
 
-	// Overwrite the existing logging context with the blip context ID
-	h.rqCtx = base.LogContextWith(h.ctx(), &base.LogContext{CorrelationID: base.FormatBlipContextID(blipContext.ID)})
+	// Overwrite the existing logging context with the blip context ID, prefixed by the caller's correlation ID if given,
+	// so that the replication's logs can be found from the caller's
+	h.rqCtx = base.LogContextWith(h.ctx(), &base.LogContext{CorrelationID: h.requestCorrelationID + base.FormatBlipContextID(blipContext.ID)})
 
 	// Create a new BlipSyncContext attached to the given blipContext.
 	ctx := db.NewBlipSyncContext(h.rqCtx, blipContext, h.db, h.formatSerialNumber(), db.BlipSyncStatsForCBL(h.db.DbStats))
@@ -63,6 +79,8 @@ func (h *handler) handleBLIPSync() error {
 			func(w http.ResponseWriter, r *http.Request) {
 				h.logStatus(http.StatusSwitchingProtocols, fmt.Sprintf("[%s] Upgraded to WebSocket protocol %s+%s%s", blipContext.ID, blip.WebSocketSubProtocolPrefix, blipContext.ActiveSubprotocol(), h.formattedEffectiveUserName()))
 				defer base.InfofCtx(h.ctx(), base.KeyHTTP, "%s:    --> BLIP+WebSocket connection closed", h.formatSerialNumber())
+				release := h.db.ClientTelemetry.AddBLIPConnection(h.rq.UserAgent(), offeredBLIPSubprotocols(h.rq))
+				defer release()
 				next.ServeHTTP(w, r)
 			})
 	}
@@ -71,3 +89,18 @@ func (h *handler) handleBLIPSync() error {
 
 	return nil
 }
+
+// offeredBLIPSubprotocols returns the BLIP subprotocols offered by the client in its websocket handshake, such as
+// CBMobile_3.
+func offeredBLIPSubprotocols(rq *http.Request) []string {
+	var protocols []string
+	for _, header := range rq.Header.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(header, ",") {
+			protocol = strings.TrimPrefix(strings.TrimSpace(protocol), blip.WebSocketSubProtocolPrefix+"+")
+			if protocol != "" {
+				protocols = append(protocols, protocol)
+			}
+		}
+	}
+	return protocols
+}
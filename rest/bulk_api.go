@@ -9,6 +9,7 @@
 package rest
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -17,6 +18,7 @@ import (
 	"mime/multipart"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/couchbase/sync_gateway/base"
@@ -331,6 +333,22 @@ func (h *handler) handleDumpChannel() error {
 	return nil
 }
 
+// HTTP handler for GET _channels, listing the channels known to the database along with their stats, so that
+// operators can find hot or orphaned channels.
+func (h *handler) handleGetChannels() error {
+	h.assertAdminOnly()
+	h.writeJSON(map[string]interface{}{"channels": h.db.GetChannelStats()})
+	return nil
+}
+
+// HTTP handler for GET _dcp, reporting the state of each vbucket's stream for the database's DCP feeds on this node,
+// so that feed lag can be investigated without enabling DCP logging.
+func (h *handler) handleGetDCP() error {
+	h.assertAdminOnly()
+	h.writeJSON(h.db.GetDCPStatus(h.ctx()))
+	return nil
+}
+
 // HTTP handler for a POST to _bulk_get
 // Request looks like POST /db/_bulk_get?revs=___&attachments=___
 // where the boolean ?revs parameter adds a revision history to each doc
@@ -438,6 +456,7 @@ func (h *handler) handleBulkGet() error {
 			_ = WriteRevisionAsPart(h.ctx(), h.db.DatabaseContext.DbStats.CBLReplicationPull(), body, err != nil, canCompressParts, writer)
 
 			h.db.DbStats.Database().NumDocReadsRest.Add(1)
+			h.db.CollectionStats.NumDocReadsRest.Add(1)
 		}
 		return nil
 	})
@@ -489,44 +508,7 @@ func (h *handler) handleBulkDocs() error {
 		}
 	}
 
-	result := make([]db.Body, 0, len(docs))
-	for _, item := range docs {
-		doc := item.(map[string]interface{})
-		docid, _ := doc[db.BodyId].(string)
-		var err error
-		var revid string
-		if newEdits {
-			if docid != "" {
-				revid, _, err = h.db.Put(h.ctx(), docid, doc)
-			} else {
-				docid, revid, _, err = h.db.Post(h.ctx(), doc)
-			}
-		} else {
-			revisions := db.ParseRevisions(doc)
-			if revisions == nil {
-				err = base.HTTPErrorf(http.StatusBadRequest, "Bad _revisions")
-			} else {
-				revid = revisions[0]
-				_, _, err = h.db.PutExistingRevWithBody(h.ctx(), docid, doc, revisions, false)
-			}
-		}
-
-		status := db.Body{}
-		if docid != "" {
-			status["id"] = docid
-		}
-		if err != nil {
-			code, msg := base.ErrorAsHTTPStatus(err)
-			status["status"] = code
-			status["error"] = base.CouchHTTPErrorName(code)
-			status["reason"] = msg
-			base.InfofCtx(h.ctx(), base.KeyAll, "\tBulkDocs: Doc %q --> %d %s (%v)", base.UD(docid), code, msg, err)
-			err = nil // wrote it to output already; not going to return it
-		} else {
-			status["rev"] = revid
-		}
-		result = append(result, status)
-	}
+	result := h.bulkDocsWrite(docs, newEdits)
 
 	for _, item := range localDocs {
 		doc := item.(map[string]interface{})
@@ -557,3 +539,98 @@ func (h *handler) handleBulkDocs() error {
 	h.writeJSONStatus(http.StatusCreated, result)
 	return nil
 }
+
+// bulkDocsWrite writes the non-local docs of a _bulk_docs request across a pool of workers, so that their sync function
+// executions, sequence allocations and writes are pipelined rather than made one doc at a time.  Docs with the same ID
+// are written by the same worker, in the order given, so that later revisions in the request build on earlier ones.
+// Returns the status of each doc, in the order the docs were given.
+func (h *handler) bulkDocsWrite(docs []interface{}, newEdits bool) []db.Body {
+
+	// Group the docs by ID, where given, preserving their order
+	groups := make([][]int, 0, len(docs))
+	groupIndexes := make(map[string]int, len(docs))
+	for i, item := range docs {
+		docid, _ := item.(map[string]interface{})[db.BodyId].(string)
+		if docid != "" {
+			if groupIndex, ok := groupIndexes[docid]; ok {
+				groups[groupIndex] = append(groups[groupIndex], i)
+				continue
+			}
+			groupIndexes[docid] = len(groups)
+		}
+		groups = append(groups, []int{i})
+	}
+
+	numWorkers := h.db.Options.BulkDocsConcurrency
+	if numWorkers <= 0 {
+		numWorkers = db.DefaultBulkDocsConcurrency
+	}
+	if numWorkers > len(groups) {
+		numWorkers = len(groups)
+	}
+
+	groupQueue := make(chan []int, len(groups))
+	for _, group := range groups {
+		groupQueue <- group
+	}
+	close(groupQueue)
+
+	// Each doc's status is written to its own index, so results are assembled in order without further synchronization
+	ctx := h.ctx()
+	result := make([]db.Body, len(docs))
+	var wg sync.WaitGroup
+	wg.Add(numWorkers)
+	for i := 0; i < numWorkers; i++ {
+		go func() {
+			defer wg.Done()
+			for group := range groupQueue {
+				for _, docIndex := range group {
+					result[docIndex] = h.bulkDocsWriteDoc(ctx, docs[docIndex].(map[string]interface{}), newEdits)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return result
+}
+
+// bulkDocsWriteDoc writes a single non-local doc of a _bulk_docs request, returning its status.  Errors are reported
+// in the status rather than returned.
+func (h *handler) bulkDocsWriteDoc(ctx context.Context, doc map[string]interface{}, newEdits bool) db.Body {
+	docid, _ := doc[db.BodyId].(string)
+	var err error
+	var revid string
+	if newEdits {
+		if docid != "" {
+			revid, _, err = h.db.Put(ctx, docid, doc)
+		} else {
+			docid, revid, _, err = h.db.Post(ctx, doc)
+		}
+	} else {
+		revisions := db.ParseRevisions(doc)
+		if revisions == nil {
+			err = base.HTTPErrorf(http.StatusBadRequest, "Bad _revisions")
+		} else {
+			revid = revisions[0]
+			_, _, err = h.db.PutExistingRevWithBody(ctx, docid, doc, revisions, false)
+		}
+	}
+
+	status := db.Body{}
+	if docid != "" {
+		status["id"] = docid
+	}
+	if err != nil {
+		code, msg := base.ErrorAsHTTPStatus(err)
+		status["status"] = code
+		status["error"] = base.CouchHTTPErrorName(code)
+		status["reason"] = msg
+		if rejection := base.SyncFnRejectionReasonFromError(err); rejection != nil {
+			status["rejection"] = rejection
+		}
+		base.InfofCtx(ctx, base.KeyAll, "\tBulkDocs: Doc %q --> %d %s (%v)", base.UD(docid), code, msg, err)
+	} else {
+		status["rev"] = revid
+	}
+	return status
+}
@@ -139,7 +139,7 @@ func (h *handler) updateChangesOptionsFromQuery(feed *string, options *db.Change
 			"heartbeat",
 			kDefaultHeartbeatMS,
 			kMinHeartbeatMS,
-			uint64(h.server.Config.Replicator.MaxHeartbeat.Value().Milliseconds()),
+			uint64(h.server.maxHeartbeat().Milliseconds()),
 			true,
 		)
 	}
@@ -205,7 +205,7 @@ func (h *handler) handleChanges() error {
 			"heartbeat",
 			kDefaultHeartbeatMS,
 			kMinHeartbeatMS,
-			uint64(h.server.Config.Replicator.MaxHeartbeat.Value().Milliseconds()),
+			uint64(h.server.maxHeartbeat().Milliseconds()),
 			true,
 		)
 		options.TimeoutMs = base.GetRestrictedIntQuery(
@@ -285,6 +285,15 @@ func (h *handler) handleChanges() error {
 		h.db.DatabaseContext.DbStats.CBLReplicationPull().NumPullReplTotalOneShot.Add(1)
 		defer h.db.DatabaseContext.DbStats.CBLReplicationPull().NumPullReplActiveOneShot.Add(-1)
 	} else {
+		h.longRunning = true
+		if limiter := h.db.UserConnectionLimiter; limiter != nil && h.user != nil {
+			release, err := limiter.AcquireContinuousChanges(h.user.Name())
+			if err != nil {
+				base.InfofCtx(h.ctx(), base.KeyChanges, "Rejected %s changes feed for user %s: %v", feed, base.UD(h.user.Name()), err)
+				return err
+			}
+			defer release()
+		}
 		h.db.DbStats.CBLReplicationPull().NumPullReplActiveContinuous.Add(1)
 		h.db.DbStats.CBLReplicationPull().NumPullReplTotalContinuous.Add(1)
 		defer h.db.DbStats.CBLReplicationPull().NumPullReplActiveContinuous.Add(-1)
@@ -304,11 +313,13 @@ func (h *handler) handleChanges() error {
 
 	switch feed {
 	case "normal":
+		startTime := time.Now()
 		if filter == "_doc_ids" {
 			err, forceClose = h.sendSimpleChanges(userChannels, options, docIdsArray)
 		} else {
 			err, forceClose = h.sendSimpleChanges(userChannels, options, nil)
 		}
+		h.db.DbStats.Database().ChangesRequestDuration.Observe(time.Since(startTime).Seconds())
 	case "longpoll":
 		options.Wait = true
 		err, forceClose = h.sendSimpleChanges(userChannels, options, nil)
@@ -601,7 +612,7 @@ func (h *handler) readChangesOptionsFromJSON(jsonData []byte) (feed string, opti
 		input.HeartbeatMs,
 		kDefaultHeartbeatMS,
 		kMinHeartbeatMS,
-		uint64(h.server.Config.Replicator.MaxHeartbeat.Value().Milliseconds()),
+		uint64(h.server.maxHeartbeat().Milliseconds()),
 		true,
 	)
 
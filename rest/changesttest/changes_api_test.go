@@ -3979,3 +3979,36 @@ func WriteDirectWithKey(testDb *db.DatabaseContext, key string, channelArray []s
 		base.PanicfCtx(context.TODO(), "Error while add ket to bucket: %v", err)
 	}
 }
+
+// TestChangesCoalesceWindow ensures that a longpoll feed woken by a write waits for the coalescing window, so that a
+// burst of writes is returned in a single response.
+func TestChangesCoalesceWindow(t *testing.T) {
+	rtConfig := rest.RestTesterConfig{
+		SyncFn:         `function(doc) {channel(doc.channels)}`,
+		DatabaseConfig: &rest.DatabaseConfig{DbConfig: rest.DbConfig{ChangesCoalesceWindowMs: base.Uint32Ptr(500)}},
+	}
+	rt := rest.NewRestTester(t, &rtConfig)
+	defer rt.Close()
+
+	caughtUpCount := rt.GetDatabase().DbStats.CBLReplicationPull().NumPullReplCaughtUp.Value()
+
+	var longpollWg sync.WaitGroup
+	longpollWg.Add(1)
+	go func() {
+		defer longpollWg.Done()
+		var changes struct {
+			Results  []db.ChangeEntry
+			Last_Seq interface{}
+		}
+		changesResponse := rt.SendAdminRequest("GET", "/db/_changes?feed=longpoll&since=0", "")
+		assert.NoError(t, base.JSONUnmarshal(changesResponse.Body.Bytes(), &changes))
+		assert.Len(t, changes.Results, 3)
+	}()
+	require.NoError(t, rt.GetDatabase().WaitForCaughtUp(caughtUpCount+1))
+
+	for i := 0; i < 3; i++ {
+		response := rt.SendAdminRequest("PUT", fmt.Sprintf("/db/doc%d", i), `{"channels":["ABC"]}`)
+		rest.RequireStatus(t, response, 201)
+	}
+	longpollWg.Wait()
+}
@@ -18,15 +18,20 @@ import (
 	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	_ "net/http/pprof"
 	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
 	"time"
+	"unicode"
 
 	"golang.org/x/crypto/bcrypt"
 	"gopkg.in/square/go-jose.v2"
@@ -34,6 +39,7 @@ import (
 	sgbucket "github.com/couchbase/sg-bucket"
 	"github.com/couchbase/sync_gateway/auth"
 	"github.com/couchbase/sync_gateway/base"
+	"github.com/couchbase/sync_gateway/channels"
 	"github.com/couchbase/sync_gateway/db"
 )
 
@@ -133,6 +139,7 @@ func (bucketConfig *BucketConfig) GetCredentials() (username string, password st
 type DbConfig struct {
 	BucketConfig
 	Scopes                           ScopesConfig                     `json:"scopes,omitempty"`                // Scopes and collection specific config
+	CreateCollections                *bool                            `json:"create_collections,omitempty"`    // Whether scopes and collections missing from the bucket are created when the database is created
 	Name                             string                           `json:"name,omitempty"`                  // Database name in REST API (stored as key in JSON)
 	Sync                             *string                          `json:"sync,omitempty"`                  // The sync function applied to write operations in the _default scope and collection
 	Users                            map[string]*auth.PrincipalConfig `json:"users,omitempty"`                 // Initial user accounts
@@ -151,6 +158,8 @@ type DbConfig struct {
 	Unsupported                      *db.UnsupportedOptions           `json:"unsupported,omitempty"`           // Config for unsupported features
 	OIDCConfig                       *auth.OIDCOptions                `json:"oidc,omitempty"`                  // Config properties for OpenID Connect authentication
 	LocalJWTConfig                   auth.LocalJWTConfig              `json:"local_jwt,omitempty"`
+	LDAPConfig                       *auth.LDAPConfig                 `json:"ldap,omitempty"`                                 // Config properties for LDAP authentication
+	ClientCertAuth                   *auth.ClientCertAuthConfig       `json:"client_cert_auth,omitempty"`                     // Rules mapping TLS client certs presented to the public API to users
 	OldRevExpirySeconds              *uint32                          `json:"old_rev_expiry_seconds,omitempty"`               // The number of seconds before old revs are removed from CBS bucket
 	ViewQueryTimeoutSecs             *uint32                          `json:"view_query_timeout_secs,omitempty"`              // The view query timeout in seconds
 	LocalDocExpirySecs               *uint32                          `json:"local_doc_expiry_secs,omitempty"`                // The _local doc expiry time in seconds
@@ -158,6 +167,7 @@ type DbConfig struct {
 	SecureCookieOverride             *bool                            `json:"session_cookie_secure,omitempty"`                // Override cookie secure flag
 	SessionCookieName                string                           `json:"session_cookie_name,omitempty"`                  // Custom per-database session cookie name
 	SessionCookieHTTPOnly            *bool                            `json:"session_cookie_http_only,omitempty"`             // HTTP only cookies
+	RefreshTokenTTLSecs              *uint32                          `json:"refresh_token_ttl_secs,omitempty"`               // If set, refresh tokens with this time-to-live in seconds are issued with sessions created via _session POST
 	AllowConflicts                   *bool                            `json:"allow_conflicts,omitempty"`                      // Deprecated: False forbids creating conflicts
 	NumIndexReplicas                 *uint                            `json:"num_index_replicas,omitempty"`                   // Number of GSI index replicas used for core indexes
 	UseViews                         *bool                            `json:"use_views,omitempty"`                            // Force use of views instead of GSI
@@ -173,13 +183,41 @@ type DbConfig struct {
 	ServeInsecureAttachmentTypes     *bool                            `json:"serve_insecure_attachment_types,omitempty"`      // Attachment content type will bypass the content-disposition handling, default false
 	QueryPaginationLimit             *int                             `json:"query_pagination_limit,omitempty"`               // Query limit to be used during pagination of large queries
 	UserXattrKey                     string                           `json:"user_xattr_key,omitempty"`                       // Key of user xattr that will be accessible from the Sync Function. If empty the feature will be disabled.
+	UserXattrKeys                    []string                         `json:"user_xattr_keys,omitempty"`                      // Keys of additional user xattrs, or of properties nested within them (e.g. "meta.access"), that will be accessible from the Sync Function
 	ClientPartitionWindowSecs        *int                             `json:"client_partition_window_secs,omitempty"`         // How long clients can remain offline for without losing replication metadata. Default 30 days (in seconds)
 	Guest                            *auth.PrincipalConfig            `json:"guest,omitempty"`                                // Guest user settings
 	JavascriptTimeoutSecs            *uint32                          `json:"javascript_timeout_secs,omitempty"`              // The amount of seconds a Javascript function can run for. Set to 0 for no timeout.
+	JavascriptEngine                 string                           `json:"javascript_engine,omitempty"`                    // The JavaScript engine that runs the sync function and import filter: "otto" (default, ES5) or "goja" (ES2020)
+	JSLibrary                        map[string]string                `json:"js_library,omitempty"`                           // Named JS modules that the sync function and import filter can require()
+	SyncFunctionSlowThresholdMs      *uint32                          `json:"sync_function_slow_threshold_ms,omitempty"`      // Log a warning if the sync function takes longer than this many ms for a document. Set to 0 to disable.
+	SlowRequestThresholdMs           *uint32                          `json:"slow_request_threshold_ms,omitempty"`            // Log a warning if a REST or BLIP request takes longer than this many ms. Set to 0 to disable.
+	RecentErrorsLimit                *uint                            `json:"recent_errors_limit,omitempty"`                  // The number of the database's most recent warnings and errors kept in memory for the _recent_errors endpoint. Set to 0 to disable.
 	UserQueries                      db.UserQueryMap                  `json:"queries,omitempty"`                              // N1QL queries for clients to invoke by name
 	GraphQL                          *db.GraphQLConfig                `json:"graphql,omitempty"`                              // GraphQL configuration & resolver fns
 	UserFunctions                    db.UserFunctionConfigMap         `json:"functions,omitempty"`                            // Named JS fns for clients to call
 	Suspendable                      *bool                            `json:"suspendable,omitempty"`                          // Allow the database to be suspended
+	ColdStandby                      *bool                            `json:"cold_standby,omitempty"`                         // Only load the config and verify indexes until the first request starts the database
+	PasswordPolicy                   *auth.PasswordPolicy             `json:"password_policy,omitempty"`                      // Rules that local user passwords must satisfy
+	GuestSessions                    *auth.GuestSessionConfig         `json:"guest_sessions,omitempty"`                       // If set, unauthenticated clients can create sessions for per-device guest users via _session POST
+	LoginThrottle                    *auth.LoginThrottleConfig        `json:"login_throttle,omitempty"`                       // If set, failed password logins are tracked per user and source IP, with backoff and lockout
+	AdminRoleActions                 map[string][]string              `json:"admin_role_actions,omitempty"`                   // Couchbase Server roles mapped to the admin API actions they're granted on this database
+	UserConnectionLimits             *db.UserConnectionLimitsConfig   `json:"user_connection_limits,omitempty"`               // Limits on the concurrent replications and changes feeds of each user
+	ChannelNamePolicy                *db.ChannelNamePolicyConfig      `json:"channel_name_policy,omitempty"`                  // Restrictions on the names of the channels assigned by the sync function
+	ChannelHistory                   *db.ChannelHistoryConfig         `json:"channel_history,omitempty"`                      // Limits on the channel history kept in each document's sync metadata
+	SyncFunctionLimits               *db.SyncFunctionLimitsConfig     `json:"sync_function_limits,omitempty"`                 // Per-invocation CPU time and memory limits of the sync function
+	SyncWasmModule                   *string                          `json:"sync_wasm_module,omitempty"`                     // Path of a WebAssembly module to run as the sync policy, in place of a JavaScript sync function
+	ImportFilterMetadataOnly         *bool                            `json:"import_filter_metadata_only,omitempty"`          // Whether the import filter is only given documents' metadata, so bodies needn't be unmarshalled to filter them
+	ImportThrottle                   *db.ImportThrottleConfig         `json:"import_throttle,omitempty"`                      // Limits on the rate at which the import feed imports docs
+	ImportConflict                   *db.ImportConflictConfig         `json:"import_conflict,omitempty"`                      // How SDK writes that collide with Sync Gateway writes are handled
+	ImportExpiry                     *db.ImportExpiryConfig           `json:"import_expiry,omitempty"`                        // How the expiry of SDK-written docs is handled when they're imported
+	MaxSequenceBatchSize             *uint64                          `json:"max_sequence_batch_size,omitempty"`              // Maximum number of sequences reserved per increment of the sequence counter
+	ChangesQueryConcurrency          *int                             `json:"changes_query_concurrency,omitempty"`            // Maximum number of channels queried concurrently by a changes request
+	BulkDocsConcurrency              *int                             `json:"bulk_docs_concurrency,omitempty"`                // Maximum number of docs written concurrently by a _bulk_docs request
+	ChangesCoalesceWindowMs          *uint32                          `json:"changes_coalesce_window_ms,omitempty"`           // How long a waiting changes feed delays after being woken by a change, to batch bursts of writes
+	DocResponseCache                 *db.DocResponseCacheConfig       `json:"doc_response_cache,omitempty"`                   // Short-lived caching of the responses to GETs for the current revision of documents
+	MemoryAdmission                  *db.MemoryAdmissionConfig        `json:"memory_admission,omitempty"`                     // Rejection of requests while the database's estimated memory usage is high
+
+	unresolvedConfig map[string]interface{} // The config before ${env:VAR} and ${file:/path} references were resolved, nil if it had none
 }
 
 type ScopesConfig map[string]ScopeConfig
@@ -189,8 +227,102 @@ type ScopeConfig struct {
 
 type CollectionsConfig map[string]CollectionConfig
 type CollectionConfig struct {
-	SyncFn       *string `json:"sync,omitempty"`          // The sync function applied to write operations in this collection.
-	ImportFilter *string `json:"import_filter,omitempty"` // The import filter applied to import operations in this collection.
+	SyncFn        *string                   `json:"sync,omitempty"`           // The sync function applied to write operations in this collection.
+	ImportFilter  *string                   `json:"import_filter,omitempty"`  // The import filter applied to import operations in this collection.
+	ImportEnabled *bool                     `json:"import_enabled,omitempty"` // Whether the import feed imports docs in this collection.  Defaults to the database's import_docs.
+	CRDT          *CRDTConfig               `json:"crdt,omitempty"`           // Properties merged as CRDTs during sg-replicate conflict resolution in this collection.
+	Quota         *db.CollectionQuotaConfig `json:"quota,omitempty"`          // Limits on the number and size of docs in this collection.
+}
+
+// Where the sync function that applies to a keyspace is configured.
+const (
+	SyncFnSourceCollection = "collection" // The collection's own sync function
+	SyncFnSourceDatabase   = "database"   // The database-level sync function, inherited by collections without their own
+	SyncFnSourceDefault    = "default"    // No sync function is configured, so the default sync function applies
+)
+
+// EffectiveSyncFn is the sync function that applies to a keyspace, and where it's configured.
+type EffectiveSyncFn struct {
+	Sync   string `json:"sync"`
+	Source string `json:"source"`
+}
+
+// effectiveSyncFn returns the sync function that applies to the given collection, or to the default collection when
+// scopeName is empty.  Collections inherit the database-level sync function unless they define their own.
+func (dbConfig *DbConfig) effectiveSyncFn(scopeName, collectionName string) EffectiveSyncFn {
+	if scopeName != "" {
+		collectionConfig, ok := dbConfig.Scopes[scopeName].Collections[collectionName]
+		if ok && collectionConfig.SyncFn != nil && strings.TrimSpace(*collectionConfig.SyncFn) != "" {
+			return EffectiveSyncFn{Sync: *collectionConfig.SyncFn, Source: SyncFnSourceCollection}
+		}
+	}
+	if dbConfig.Sync != nil && strings.TrimSpace(*dbConfig.Sync) != "" {
+		return EffectiveSyncFn{Sync: *dbConfig.Sync, Source: SyncFnSourceDatabase}
+	}
+	return EffectiveSyncFn{Sync: channels.DefaultSyncFunction, Source: SyncFnSourceDefault}
+}
+
+// effectiveSyncFns returns the sync function that applies to each keyspace of the database.
+func (dbConfig *DbConfig) effectiveSyncFns() map[string]EffectiveSyncFn {
+	if len(dbConfig.Scopes) == 0 {
+		return map[string]EffectiveSyncFn{dbConfig.Name: dbConfig.effectiveSyncFn("", "")}
+	}
+	syncFns := make(map[string]EffectiveSyncFn)
+	for scopeName, scopeConfig := range dbConfig.Scopes {
+		for collectionName := range scopeConfig.Collections {
+			keyspace := strings.Join([]string{dbConfig.Name, scopeName, collectionName}, base.ScopeCollectionSeparator)
+			syncFns[keyspace] = dbConfig.effectiveSyncFn(scopeName, collectionName)
+		}
+	}
+	return syncFns
+}
+
+// collectionImportEnabled returns whether the import feed imports docs in the given collection.  Collections inherit
+// the database's import_docs setting unless they set import_enabled.
+func (dbConfig *DbConfig) collectionImportEnabled(scopeName, collectionName string) (bool, error) {
+	collectionConfig, ok := dbConfig.Scopes[scopeName].Collections[collectionName]
+	if ok && collectionConfig.ImportEnabled != nil {
+		return *collectionConfig.ImportEnabled, nil
+	}
+	return dbConfig.AutoImportEnabled()
+}
+
+// importEnabled returns whether the database runs an import feed, which it does if any of its collections are
+// imported, or if import_docs is enabled when it only has the default collection.
+func (dbConfig *DbConfig) importEnabled() (bool, error) {
+	if len(dbConfig.Scopes) == 0 {
+		return dbConfig.AutoImportEnabled()
+	}
+	for scopeName, scopeConfig := range dbConfig.Scopes {
+		for collectionName := range scopeConfig.Collections {
+			if enabled, err := dbConfig.collectionImportEnabled(scopeName, collectionName); err != nil || enabled {
+				return enabled, err
+			}
+		}
+	}
+	return false, nil
+}
+
+// isSuspendable returns whether the database can be suspended, which defaults to true in serverless mode or for cold
+// standby databases.
+func (dbConfig *DbConfig) isSuspendable(serverless bool) bool {
+	return base.BoolDefault(dbConfig.Suspendable, serverless || base.BoolDefault(dbConfig.ColdStandby, false))
+}
+
+type CRDTConfig struct {
+	Counters []string `json:"counters,omitempty"` // Top-level numeric properties merged as counters
+	Sets     []string `json:"sets,omitempty"`     // Top-level array properties merged as observed-remove sets
+}
+
+// toCRDTOptions returns the db.CRDTOptions for the config, or nil if no properties are defined.
+func (c *CRDTConfig) toCRDTOptions() *db.CRDTOptions {
+	if c == nil || len(c.Counters)+len(c.Sets) == 0 {
+		return nil
+	}
+	return &db.CRDTOptions{
+		Counters: c.Counters,
+		Sets:     c.Sets,
+	}
 }
 
 type DeltaSyncConfig struct {
@@ -233,22 +365,26 @@ type DeprecatedCacheConfig struct {
 }
 
 type RevCacheConfig struct {
-	Size       *uint32 `json:"size,omitempty"`        // Maximum number of revisions to store in the revision cache
-	ShardCount *uint16 `json:"shard_count,omitempty"` // Number of shards the rev cache should be split into
+	Size        *uint32 `json:"size,omitempty"`          // Maximum number of revisions to store in the revision cache
+	ShardCount  *uint16 `json:"shard_count,omitempty"`   // Number of shards the rev cache should be split into
+	MaxMemoryMB *uint32 `json:"max_memory_mb,omitempty"` // Maximum estimated memory used by revisions in the revision cache, in MB
+	Compression *string `json:"compression,omitempty"`   // Algorithm used to compress the bodies of cached revisions (none, snappy or zstd)
 }
 
 type ChannelCacheConfig struct {
-	MaxNumber            *int    `json:"max_number,omitempty"`                 // Maximum number of channel caches which will exist at any one point
-	HighWatermarkPercent *int    `json:"compact_high_watermark_pct,omitempty"` // High watermark for channel cache eviction (percent)
-	LowWatermarkPercent  *int    `json:"compact_low_watermark_pct,omitempty"`  // Low watermark for channel cache eviction (percent)
-	MaxWaitPending       *uint32 `json:"max_wait_pending,omitempty"`           // Max wait for pending sequence before skipping
-	MaxNumPending        *int    `json:"max_num_pending,omitempty"`            // Max number of pending sequences before skipping
-	MaxWaitSkipped       *uint32 `json:"max_wait_skipped,omitempty"`           // Max wait for skipped sequence before abandoning
-	EnableStarChannel    *bool   `json:"enable_star_channel,omitempty"`        // Enable star channel
-	MaxLength            *int    `json:"max_length,omitempty"`                 // Maximum number of entries maintained in cache per channel
-	MinLength            *int    `json:"min_length,omitempty"`                 // Minimum number of entries maintained in cache per channel
-	ExpirySeconds        *int    `json:"expiry_seconds,omitempty"`             // Time (seconds) to keep entries in cache beyond the minimum retained
-	DeprecatedQueryLimit *int    `json:"query_limit,omitempty"`                // Limit used for channel queries, if not specified by client DEPRECATED in favour of db.QueryPaginationLimit
+	MaxNumber            *int                          `json:"max_number,omitempty"`                 // Maximum number of channel caches which will exist at any one point
+	HighWatermarkPercent *int                          `json:"compact_high_watermark_pct,omitempty"` // High watermark for channel cache eviction (percent)
+	LowWatermarkPercent  *int                          `json:"compact_low_watermark_pct,omitempty"`  // Low watermark for channel cache eviction (percent)
+	MaxWaitPending       *uint32                       `json:"max_wait_pending,omitempty"`           // Max wait for pending sequence before skipping
+	MaxNumPending        *int                          `json:"max_num_pending,omitempty"`            // Max number of pending sequences before skipping
+	MaxWaitSkipped       *uint32                       `json:"max_wait_skipped,omitempty"`           // Max wait for skipped sequence before abandoning
+	EnableStarChannel    *bool                         `json:"enable_star_channel,omitempty"`        // Enable star channel
+	MaxLength            *int                          `json:"max_length,omitempty"`                 // Maximum number of entries maintained in cache per channel
+	MinLength            *int                          `json:"min_length,omitempty"`                 // Minimum number of entries maintained in cache per channel
+	ExpirySeconds        *int                          `json:"expiry_seconds,omitempty"`             // Time (seconds) to keep entries in cache beyond the minimum retained
+	DeprecatedQueryLimit *int                          `json:"query_limit,omitempty"`                // Limit used for channel queries, if not specified by client DEPRECATED in favour of db.QueryPaginationLimit
+	Storage              *db.ChannelCacheStorageConfig `json:"storage,omitempty"`                    // Storage for channel caches evicted by compaction
+	Preload              *db.ChannelCachePreloadConfig `json:"preload,omitempty"`                    // Channels to preload into the channel cache on startup
 }
 
 func GetTLSVersionFromString(stringV *string) uint16 {
@@ -306,6 +442,10 @@ func (dbConfig *DbConfig) setDatabaseCredentials(credentials base.CredentialsCon
 
 // setup populates fields in the dbConfig
 func (dbConfig *DbConfig) setup(dbName string, bootstrapConfig BootstrapConfig, dbCredentials, bucketCredentials *base.CredentialsConfig, forcePerBucketAuth bool) error {
+	if err := dbConfig.resolveConfigReferences(bootstrapConfig.ConfigFileReferenceDirs); err != nil {
+		return err
+	}
+
 	dbConfig.Name = dbName
 	if dbConfig.Bucket == nil {
 		dbConfig.Bucket = &dbConfig.Name
@@ -374,6 +514,19 @@ func (dbConfig *DbConfig) setup(dbName string, bootstrapConfig BootstrapConfig,
 		dbConfig.ImportFilter = &importFilter
 	}
 
+	// Load JavaScript library modules.
+	for name, module := range dbConfig.JSLibrary {
+		moduleSource, err := loadJavaScript(module, insecureSkipVerify)
+		if err != nil {
+			return &JavaScriptLoadError{
+				JSLoadType: JSLibraryModule,
+				Path:       module,
+				Err:        err,
+			}
+		}
+		dbConfig.JSLibrary[name] = moduleSource
+	}
+
 	// Load Conflict Resolution Function.
 	for _, rc := range dbConfig.Replications {
 		if rc.ConflictResolutionFn != "" {
@@ -431,11 +584,12 @@ const (
 	ImportFilter                       // Import filter JavaScript load.
 	ConflictResolver                   // Conflict Resolver JavaScript load.
 	WebhookFilter                      // Webhook filter JavaScript load.
+	JSLibraryModule                    // JavaScript library module load.
 	jsLoadTypeCount                    // Number of JSLoadType constants.
 )
 
 // jsLoadTypes represents the list of different possible JSLoadType.
-var jsLoadTypes = []string{"SyncFunction", "ImportFilter", "ConflictResolver", "WebhookFilter"}
+var jsLoadTypes = []string{"SyncFunction", "ImportFilter", "ConflictResolver", "WebhookFilter", "JSLibraryModule"}
 
 // String returns the string representation of a specific JSLoadType.
 func (t JSLoadType) String() string {
@@ -584,6 +738,88 @@ func (dbConfig *DbConfig) validateVersion(ctx context.Context, isEnterpriseEditi
 			fmt.Sprintf("%g-%g", db.CompactIntervalMinDays, db.CompactIntervalMaxDays)))
 	}
 
+	if val := dbConfig.MaxSequenceBatchSize; val != nil && (*val < 1 || *val > db.MaxSequenceBatchSizeLimit) {
+		multiError = multiError.Append(fmt.Errorf(rangeValueErrorMsg, "max_sequence_batch_size", fmt.Sprintf("1-%d", db.MaxSequenceBatchSizeLimit)))
+	}
+
+	if val := dbConfig.ChangesQueryConcurrency; val != nil && (*val < 1 || *val > db.MaxChangesQueryConcurrency) {
+		multiError = multiError.Append(fmt.Errorf(rangeValueErrorMsg, "changes_query_concurrency", fmt.Sprintf("1-%d", db.MaxChangesQueryConcurrency)))
+	}
+
+	if val := dbConfig.BulkDocsConcurrency; val != nil && (*val < 1 || *val > db.MaxBulkDocsConcurrency) {
+		multiError = multiError.Append(fmt.Errorf(rangeValueErrorMsg, "bulk_docs_concurrency", fmt.Sprintf("1-%d", db.MaxBulkDocsConcurrency)))
+	}
+
+	if val := dbConfig.ChangesCoalesceWindowMs; val != nil && *val > db.MaxChangesCoalesceWindowMs {
+		multiError = multiError.Append(fmt.Errorf(rangeValueErrorMsg, "changes_coalesce_window_ms", fmt.Sprintf("0-%d", db.MaxChangesCoalesceWindowMs)))
+	}
+
+	if dbConfig.PasswordPolicy != nil {
+		if err := dbConfig.PasswordPolicy.Validate(); err != nil {
+			multiError = multiError.Append(fmt.Errorf("password_policy error: %w", err))
+		}
+	}
+
+	if dbConfig.LDAPConfig != nil {
+		if err := dbConfig.LDAPConfig.Validate(); err != nil {
+			multiError = multiError.Append(fmt.Errorf("ldap error: %w", err))
+		}
+	}
+
+	if dbConfig.GuestSessions != nil {
+		if err := dbConfig.GuestSessions.Validate(); err != nil {
+			multiError = multiError.Append(fmt.Errorf("guest_sessions error: %w", err))
+		}
+	}
+
+	if dbConfig.ClientCertAuth != nil {
+		if err := dbConfig.ClientCertAuth.Validate(); err != nil {
+			multiError = multiError.Append(fmt.Errorf("client_cert_auth error: %w", err))
+		}
+	}
+
+	if dbConfig.UserXattrKey != "" || len(dbConfig.UserXattrKeys) > 0 {
+		if err := dbConfig.validateUserXattrKeys(); err != nil {
+			multiError = multiError.Append(fmt.Errorf("user_xattr_keys error: %w", err))
+		}
+	}
+
+	if dbConfig.LoginThrottle != nil {
+		if err := dbConfig.LoginThrottle.Validate(); err != nil {
+			multiError = multiError.Append(fmt.Errorf("login_throttle error: %w", err))
+		}
+	}
+
+	if dbConfig.AdminRoleActions != nil {
+		if err := validateAdminRoleActions(dbConfig.AdminRoleActions); err != nil {
+			multiError = multiError.Append(fmt.Errorf("admin_role_actions error: %w", err))
+		}
+	}
+
+	if dbConfig.UserConnectionLimits != nil {
+		if err := dbConfig.UserConnectionLimits.Validate(); err != nil {
+			multiError = multiError.Append(fmt.Errorf("user_connection_limits error: %w", err))
+		}
+	}
+
+	if dbConfig.ChannelNamePolicy != nil {
+		if err := dbConfig.ChannelNamePolicy.Validate(); err != nil {
+			multiError = multiError.Append(fmt.Errorf("channel_name_policy error: %w", err))
+		}
+	}
+
+	if dbConfig.ChannelHistory != nil {
+		if err := dbConfig.ChannelHistory.Validate(); err != nil {
+			multiError = multiError.Append(fmt.Errorf("channel_history error: %w", err))
+		}
+	}
+
+	if dbConfig.SyncFunctionLimits != nil {
+		if err := dbConfig.SyncFunctionLimits.Validate(dbConfig.JavascriptEngine); err != nil {
+			multiError = multiError.Append(fmt.Errorf("sync_function_limits error: %w", err))
+		}
+	}
+
 	if dbConfig.CacheConfig != nil {
 
 		if dbConfig.CacheConfig.ChannelCacheConfig != nil {
@@ -591,17 +827,21 @@ func (dbConfig *DbConfig) validateVersion(ctx context.Context, isEnterpriseEditi
 			// EE: channel cache
 			if !isEnterpriseEdition {
 				if val := dbConfig.CacheConfig.ChannelCacheConfig.MaxNumber; val != nil {
-					base.WarnfCtx(ctx, eeOnlyWarningMsg, "cache.channel_cache.max_number", *val, db.DefaultChannelCacheMaxNumber)
+					warnConfig(ctx, eeOnlyWarningMsg, "cache.channel_cache.max_number", *val, db.DefaultChannelCacheMaxNumber)
 					dbConfig.CacheConfig.ChannelCacheConfig.MaxNumber = nil
 				}
 				if val := dbConfig.CacheConfig.ChannelCacheConfig.HighWatermarkPercent; val != nil {
-					base.WarnfCtx(ctx, eeOnlyWarningMsg, "cache.channel_cache.compact_high_watermark_pct", *val, db.DefaultCompactHighWatermarkPercent)
+					warnConfig(ctx, eeOnlyWarningMsg, "cache.channel_cache.compact_high_watermark_pct", *val, db.DefaultCompactHighWatermarkPercent)
 					dbConfig.CacheConfig.ChannelCacheConfig.HighWatermarkPercent = nil
 				}
 				if val := dbConfig.CacheConfig.ChannelCacheConfig.LowWatermarkPercent; val != nil {
-					base.WarnfCtx(ctx, eeOnlyWarningMsg, "cache.channel_cache.compact_low_watermark_pct", *val, db.DefaultCompactLowWatermarkPercent)
+					warnConfig(ctx, eeOnlyWarningMsg, "cache.channel_cache.compact_low_watermark_pct", *val, db.DefaultCompactLowWatermarkPercent)
 					dbConfig.CacheConfig.ChannelCacheConfig.LowWatermarkPercent = nil
 				}
+				if val := dbConfig.CacheConfig.ChannelCacheConfig.Storage; val != nil {
+					warnConfig(ctx, eeOnlyWarningMsg, "cache.channel_cache.storage", val.Type, db.ChannelCacheStorageHeap)
+					dbConfig.CacheConfig.ChannelCacheConfig.Storage = nil
+				}
 			}
 
 			if dbConfig.CacheConfig.ChannelCacheConfig.MaxNumPending != nil && *dbConfig.CacheConfig.ChannelCacheConfig.MaxNumPending < 1 {
@@ -645,13 +885,24 @@ func (dbConfig *DbConfig) validateVersion(ctx context.Context, isEnterpriseEditi
 				multiError = multiError.Append(fmt.Errorf("cache.channel_cache.compact_high_watermark_pct (%v) must be greater than cache.channel_cache.compact_low_watermark_pct (%v)", hwm, lwm))
 			}
 
+			if dbConfig.CacheConfig.ChannelCacheConfig.Storage != nil {
+				if err := dbConfig.CacheConfig.ChannelCacheConfig.Storage.Validate(); err != nil {
+					multiError = multiError.Append(fmt.Errorf("cache.channel_cache.storage error: %w", err))
+				}
+			}
+			if dbConfig.CacheConfig.ChannelCacheConfig.Preload != nil {
+				if err := dbConfig.CacheConfig.ChannelCacheConfig.Preload.Validate(); err != nil {
+					multiError = multiError.Append(fmt.Errorf("cache.channel_cache.preload error: %w", err))
+				}
+			}
+
 		}
 
 		if dbConfig.CacheConfig.RevCacheConfig != nil {
 			// EE: disable revcache
 			revCacheSize := dbConfig.CacheConfig.RevCacheConfig.Size
 			if !isEnterpriseEdition && revCacheSize != nil && *revCacheSize == 0 {
-				base.WarnfCtx(ctx, eeOnlyWarningMsg, "cache.rev_cache.size", *revCacheSize, db.DefaultRevisionCacheSize)
+				warnConfig(ctx, eeOnlyWarningMsg, "cache.rev_cache.size", *revCacheSize, db.DefaultRevisionCacheSize)
 				dbConfig.CacheConfig.RevCacheConfig.Size = nil
 			}
 
@@ -660,12 +911,16 @@ func (dbConfig *DbConfig) validateVersion(ctx context.Context, isEnterpriseEditi
 					multiError = multiError.Append(fmt.Errorf(minValueErrorMsg, "cache.rev_cache.shard_count", 1))
 				}
 			}
+
+			if compression := dbConfig.CacheConfig.RevCacheConfig.Compression; compression != nil && !db.IsValidRevCacheCompression(*compression) {
+				multiError = multiError.Append(fmt.Errorf("cache.rev_cache.compression must be one of %q, %q or %q", db.RevCacheCompressionNone, db.RevCacheCompressionSnappy, db.RevCacheCompressionZstd))
+			}
 		}
 	}
 
 	// EE: delta sync
 	if !isEnterpriseEdition && dbConfig.DeltaSync != nil && dbConfig.DeltaSync.Enabled != nil {
-		base.WarnfCtx(ctx, eeOnlyWarningMsg, "delta_sync.enabled", *dbConfig.DeltaSync.Enabled, false)
+		warnConfig(ctx, eeOnlyWarningMsg, "delta_sync.enabled", *dbConfig.DeltaSync.Enabled, false)
 		dbConfig.DeltaSync.Enabled = nil
 	}
 
@@ -684,7 +939,7 @@ func (dbConfig *DbConfig) validateVersion(ctx context.Context, isEnterpriseEditi
 
 	if dbConfig.ImportPartitions != nil {
 		if !isEnterpriseEdition {
-			base.WarnfCtx(ctx, eeOnlyWarningMsg, "import_partitions", *dbConfig.ImportPartitions, nil)
+			warnConfig(ctx, eeOnlyWarningMsg, "import_partitions", *dbConfig.ImportPartitions, nil)
 			dbConfig.ImportPartitions = nil
 		} else if !dbConfig.UseXattrs() {
 			multiError = multiError.Append(fmt.Errorf("Invalid configuration - import_partitions set, but enable_shared_bucket_access not enabled"))
@@ -696,21 +951,90 @@ func (dbConfig *DbConfig) validateVersion(ctx context.Context, isEnterpriseEditi
 	}
 
 	if dbConfig.DeprecatedPool != nil {
-		base.WarnfCtx(ctx, `"pool" config option is not supported. The pool will be set to "default". The option should be removed from config file.`)
+		warnConfig(ctx, `"pool" config option is not supported. The pool will be set to "default". The option should be removed from config file.`)
+	}
+
+	switch dbConfig.JavascriptEngine {
+	case "", base.JSEngineOtto, base.JSEngineGoja:
+	default:
+		multiError = multiError.Append(fmt.Errorf("javascript_engine must be %q or %q", base.JSEngineOtto, base.JSEngineGoja))
+	}
+
+	moduleNames := make([]string, 0, len(dbConfig.JSLibrary))
+	for name := range dbConfig.JSLibrary {
+		moduleNames = append(moduleNames, name)
+	}
+	sort.Strings(moduleNames)
+	for _, name := range moduleNames {
+		if name == "" {
+			multiError = multiError.Append(errors.New("js_library module names must not be empty"))
+			continue
+		}
+		moduleFn := base.JSLibraryModuleFunction(dbConfig.JSLibrary[name])
+		if _, err := validateJavascriptFunction(&moduleFn, dbConfig.JavascriptEngine); err != nil {
+			multiError = multiError.Append(fmt.Errorf("js_library module %q error: %w", name, err))
+		}
 	}
 
-	if isEmpty, err := validateJavascriptFunction(dbConfig.Sync); err != nil {
+	if isEmpty, err := validateJavascriptFunction(dbConfig.Sync, dbConfig.JavascriptEngine); err != nil {
 		multiError = multiError.Append(fmt.Errorf("sync function error: %w", err))
 	} else if isEmpty {
 		dbConfig.Sync = nil
 	}
 
-	if isEmpty, err := validateJavascriptFunction(dbConfig.ImportFilter); err != nil {
+	if dbConfig.SyncWasmModule != nil {
+		if *dbConfig.SyncWasmModule == "" {
+			multiError = multiError.Append(errors.New("sync_wasm_module must not be empty"))
+		}
+		if dbConfig.Sync != nil {
+			multiError = multiError.Append(errors.New("cannot specify both sync_wasm_module and a sync function"))
+		}
+	}
+
+	if isEmpty, err := validateJavascriptFunction(dbConfig.ImportFilter, dbConfig.JavascriptEngine); err != nil {
 		multiError = multiError.Append(fmt.Errorf("import filter error: %w", err))
 	} else if isEmpty {
 		dbConfig.ImportFilter = nil
 	}
 
+	if base.BoolDefault(dbConfig.ImportFilterMetadataOnly, false) && dbConfig.ImportFilter == nil {
+		multiError = multiError.Append(errors.New("import_filter_metadata_only requires an import_filter"))
+	}
+
+	if dbConfig.ImportThrottle != nil {
+		if err := dbConfig.ImportThrottle.Validate(); err != nil {
+			multiError = multiError.Append(fmt.Errorf("import_throttle error: %w", err))
+		}
+	}
+
+	if dbConfig.DocResponseCache != nil {
+		if err := dbConfig.DocResponseCache.Validate(); err != nil {
+			multiError = multiError.Append(fmt.Errorf("doc_response_cache error: %w", err))
+		}
+	}
+
+	if dbConfig.MemoryAdmission != nil {
+		if err := dbConfig.MemoryAdmission.Validate(); err != nil {
+			multiError = multiError.Append(fmt.Errorf("memory_admission error: %w", err))
+		}
+	}
+
+	if dbConfig.ImportConflict != nil {
+		if err := dbConfig.ImportConflict.Validate(); err != nil {
+			multiError = multiError.Append(fmt.Errorf("import_conflict error: %w", err))
+		} else if dbConfig.ImportConflict.Resolver != "" {
+			if _, err := validateJavascriptFunction(&dbConfig.ImportConflict.Resolver, dbConfig.JavascriptEngine); err != nil {
+				multiError = multiError.Append(fmt.Errorf("import_conflict resolver error: %w", err))
+			}
+		}
+	}
+
+	if dbConfig.ImportExpiry != nil {
+		if err := dbConfig.ImportExpiry.Validate(); err != nil {
+			multiError = multiError.Append(fmt.Errorf("import_expiry error: %w", err))
+		}
+	}
+
 	if err := db.ValidateDatabaseName(dbConfig.Name); err != nil {
 		multiError = multiError.Append(err)
 	}
@@ -764,12 +1088,12 @@ func (dbConfig *DbConfig) validateVersion(ctx context.Context, isEnterpriseEditi
 			if oidc.Issuer == "" || base.StringDefault(oidc.ClientID, "") == "" {
 				// TODO: rather than being an error, this skips the current provider to avoid a backwards compatibility issue (previously valid
 				// configs becoming invalid). This also means it's duplicated in NewDatabaseContext.
-				base.WarnfCtx(ctx, "Issuer and Client ID not defined for provider %q - skipping", base.UD(name))
+				warnConfig(ctx, "Issuer and Client ID not defined for provider %q - skipping", base.UD(name))
 				validProviders--
 				continue
 			}
 			if oidc.ValidationKey == nil {
-				base.WarnfCtx(ctx, "Validation Key not defined in config for provider %q - auth code flow will not be supported for this provider", base.UD(name))
+				warnConfig(ctx, "Validation Key not defined in config for provider %q - auth code flow will not be supported for this provider", base.UD(name))
 			}
 			if strings.Contains(name, "_") {
 				multiError = multiError.Append(fmt.Errorf("OpenID Connect provider names cannot contain underscore: %s", name))
@@ -841,7 +1165,7 @@ func (dbConfig *DbConfig) validateVersion(ctx context.Context, isEnterpriseEditi
 	for iss, count := range seenIssuers {
 		if count > 1 {
 			// issuer names are not UD - see https://github.com/couchbase/sync_gateway/pull/5513#discussion_r856335452 for context
-			base.WarnfCtx(ctx, "Found multiple OIDC/JWT providers using the same issuer (%s) - Implicit Grant flow may use incorrect providers.", iss)
+			warnConfig(ctx, "Found multiple OIDC/JWT providers using the same issuer (%s) - Implicit Grant flow may use incorrect providers.", iss)
 		}
 	}
 
@@ -865,26 +1189,41 @@ func (dbConfig *DbConfig) validateVersion(ctx context.Context, isEnterpriseEditi
 				continue
 			}
 
-			if dbConfig.Sync != nil {
-				multiError = multiError.Append(errors.New("cannot specify a database-level sync function with named scopes and collections"))
-			}
 			if dbConfig.ImportFilter != nil {
 				multiError = multiError.Append(errors.New("cannot specify a database-level import filter with named scopes and collections"))
 			}
 
 			// validate each collection's config
 			for collectionName, collectionConfig := range scopeConfig.Collections {
-				if isEmpty, err := validateJavascriptFunction(collectionConfig.SyncFn); err != nil {
+				if isEmpty, err := validateJavascriptFunction(collectionConfig.SyncFn, dbConfig.JavascriptEngine); err != nil {
 					multiError = multiError.Append(fmt.Errorf("collection %q sync function error: %w", collectionName, err))
 				} else if isEmpty {
 					collectionConfig.SyncFn = nil
 				}
+				if collectionConfig.SyncFn != nil && dbConfig.SyncWasmModule != nil {
+					multiError = multiError.Append(fmt.Errorf("collection %q cannot specify a sync function when sync_wasm_module is set", collectionName))
+				}
 
-				if isEmpty, err := validateJavascriptFunction(collectionConfig.ImportFilter); err != nil {
+				if isEmpty, err := validateJavascriptFunction(collectionConfig.ImportFilter, dbConfig.JavascriptEngine); err != nil {
 					multiError = multiError.Append(fmt.Errorf("collection %q import filter error: %w", collectionName, err))
 				} else if isEmpty {
 					collectionConfig.ImportFilter = nil
 				}
+				if base.BoolDefault(collectionConfig.ImportEnabled, false) && !dbConfig.UseXattrs() {
+					multiError = multiError.Append(fmt.Errorf("collection %q import_enabled requires enable_shared_bucket_access", collectionName))
+				}
+
+				if crdtOptions := collectionConfig.CRDT.toCRDTOptions(); crdtOptions != nil {
+					if err := crdtOptions.Validate(); err != nil {
+						multiError = multiError.Append(fmt.Errorf("collection %q crdt error: %w", collectionName, err))
+					}
+				}
+
+				if collectionConfig.Quota != nil {
+					if err := collectionConfig.Quota.Validate(); err != nil {
+						multiError = multiError.Append(fmt.Errorf("collection %q quota error: %w", collectionName, err))
+					}
+				}
 			}
 		}
 	}
@@ -982,10 +1321,34 @@ func (dbConfig *DbConfig) deprecatedConfigCacheFallback() (warnings []string) {
 
 }
 
-// validateJavascriptFunction returns an error if the javascript function was invalid, if set.
-func validateJavascriptFunction(jsFunc *string) (isEmpty bool, err error) {
+// validateJavascriptFunction returns an error if the javascript function was invalid for the given engine, if set.
+// configWarningsContextKey is the context key for the slice that warnings raised while validating a config are
+// collected into.
+type configWarningsContextKey struct{}
+
+// withConfigWarnings returns a context that collects the warnings raised while validating a config into warnings, so
+// that they can be returned to the user as well as logged.
+func withConfigWarnings(ctx context.Context, warnings *[]string) context.Context {
+	return context.WithValue(ctx, configWarningsContextKey{}, warnings)
+}
+
+// warnConfig logs a warning raised while validating a config, and collects it if the context was returned by
+// withConfigWarnings.
+func warnConfig(ctx context.Context, format string, args ...interface{}) {
+	base.WarnfCtx(ctx, format, args...)
+	if warnings, ok := ctx.Value(configWarningsContextKey{}).(*[]string); ok {
+		*warnings = append(*warnings, fmt.Sprintf(format, args...))
+	}
+}
+
+func validateJavascriptFunction(jsFunc *string, engine string) (isEmpty bool, err error) {
 	if jsFunc != nil && strings.TrimSpace(*jsFunc) != "" {
-		if _, err := sgbucket.NewJSRunner(*jsFunc, 0); err != nil {
+		if engine == base.JSEngineGoja {
+			_, err = base.NewGojaRunner(*jsFunc, 0)
+		} else {
+			_, err = sgbucket.NewJSRunner(*jsFunc, 0)
+		}
+		if err != nil {
 			return false, fmt.Errorf("invalid javascript syntax: %w", err)
 		}
 		return false, nil
@@ -1012,10 +1375,44 @@ func (dbConfig *DbConfig) UseXattrs() bool {
 	return base.DefaultUseXattrs
 }
 
+// userXattrKeys returns the user xattr keys configured by user_xattr_key and user_xattr_keys.
+func (dbConfig *DbConfig) userXattrKeys() []string {
+	keys := make([]string, 0, len(dbConfig.UserXattrKeys)+1)
+	if dbConfig.UserXattrKey != "" {
+		keys = append(keys, dbConfig.UserXattrKey)
+	}
+	return append(keys, dbConfig.UserXattrKeys...)
+}
+
+// UserXattrKeySpec returns the user xattr key specification for the configured user xattr keys, or an empty string if
+// there aren't any.
+func (dbConfig *DbConfig) UserXattrKeySpec() string {
+	return base.UserXattrKeySpec(dbConfig.userXattrKeys())
+}
+
+func (dbConfig *DbConfig) validateUserXattrKeys() error {
+	seen := make(map[string]struct{})
+	for _, key := range dbConfig.userXattrKeys() {
+		if err := base.ValidateUserXattrKey(key); err != nil {
+			return err
+		}
+		if _, ok := seen[key]; ok {
+			return fmt.Errorf("key %q is configured more than once", key)
+		}
+		seen[key] = struct{}{}
+	}
+	return nil
+}
+
 func (dbConfig *DbConfig) Redacted() (*DbConfig, error) {
 	var config DbConfig
 
-	err := base.DeepCopyInefficient(&config, dbConfig)
+	// Return the references that values were resolved from, rather than the values
+	dbConfig, err := dbConfig.withConfigReferences()
+	if err != nil {
+		return nil, err
+	}
+	err = base.DeepCopyInefficient(&config, dbConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -1075,7 +1472,10 @@ func expandEnv(config []byte) (value []byte, err error) {
 			base.DebugfCtx(context.Background(), base.KeyConfig, "Skipping environment variable expansion: %s", key)
 			return key
 		}
-		val, err := envDefaultExpansion(key, os.Getenv)
+		val, ok, err := resolveConfigReference(key, os.Getenv, nil)
+		if !ok {
+			val, err = envDefaultExpansion(key, os.Getenv)
+		}
 		if err != nil {
 			multiError = multiError.Append(err)
 		}
@@ -1084,6 +1484,171 @@ func expandEnv(config []byte) (value []byte, err error) {
 	return val, multiError.ErrorOrNil()
 }
 
+// Prefixes of the ${env:VAR} and ${file:/path} references that can be used in config string values.
+const (
+	configReferenceEnvPrefix  = "env:"
+	configReferenceFilePrefix = "file:"
+)
+
+// configReferenceRegexp matches the ${env:VAR} and ${file:/path} references in a config.
+var configReferenceRegexp = regexp.MustCompile(`\$\{(?:` + configReferenceEnvPrefix + `|` + configReferenceFilePrefix + `)[^}]*\}`)
+
+// resolveConfigReference resolves the key of a ${env:VAR} or ${file:/path} reference, returning ok=false when the key
+// isn't a reference.  Env references support defaults in the form ${env:VAR:-default value}, and trailing whitespace
+// is trimmed from files.  checkFilePathFn, if set, is called to check that a file may be read before reading it.  The
+// value is escaped for use within a JSON string.
+func resolveConfigReference(key string, getEnvFn func(string) string, checkFilePathFn func(string) error) (value string, ok bool, err error) {
+	if strings.HasPrefix(key, configReferenceEnvPrefix) {
+		value, err = envDefaultExpansion(strings.TrimPrefix(key, configReferenceEnvPrefix), getEnvFn)
+	} else if strings.HasPrefix(key, configReferenceFilePrefix) {
+		path := strings.TrimPrefix(key, configReferenceFilePrefix)
+		if checkFilePathFn != nil {
+			err = checkFilePathFn(path)
+		}
+		if err == nil {
+			var contents []byte
+			contents, err = ioutil.ReadFile(path)
+			if err != nil {
+				err = fmt.Errorf("unable to read file referenced in config as '${%s}': %w", key, err)
+			}
+			value = strings.TrimRightFunc(string(contents), unicode.IsSpace)
+			base.DebugfCtx(context.Background(), base.KeyConfig, "Replacing config file reference '${%s}'", base.MD(key))
+		}
+	} else {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", true, err
+	}
+
+	escaped, err := base.JSONMarshal(value)
+	if err != nil {
+		return "", true, err
+	}
+	return string(escaped[1 : len(escaped)-1]), true, nil
+}
+
+// checkConfigFileReference returns an error unless the file at path is within one of allowedDirs.  Database configs
+// can be written through the admin API, so only read files from directories allowed by the startup config.
+func checkConfigFileReference(path string, allowedDirs []string) error {
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("file referenced in database config as '${%s%s}' must be an absolute path", configReferenceFilePrefix, path)
+	}
+	// Resolve symlinks so that a link within an allowed directory can't be used to read files outside of it
+	resolvedPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return fmt.Errorf("unable to read file referenced in config as '${%s%s}': %w", configReferenceFilePrefix, path, err)
+	}
+	for _, dir := range allowedDirs {
+		resolvedDir, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(resolvedDir, resolvedPath); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("file referenced in database config as '${%s%s}' is not in a directory allowed by bootstrap.config_file_reference_dirs", configReferenceFilePrefix, path)
+}
+
+// expandConfigReferences replaces the ${env:VAR} and ${file:/path} references in a JSON database config.  Unlike
+// expandEnv, other $ expressions are left as-is, so this can be applied to persisted configs containing JavaScript.
+// Files can only be referenced within allowedFileDirs.
+func expandConfigReferences(config []byte, allowedFileDirs []string) ([]byte, error) {
+	checkFilePathFn := func(path string) error {
+		return checkConfigFileReference(path, allowedFileDirs)
+	}
+	var multiError *base.MultiError
+	expanded := configReferenceRegexp.ReplaceAllFunc(config, func(reference []byte) []byte {
+		value, _, err := resolveConfigReference(string(reference[2:len(reference)-1]), os.Getenv, checkFilePathFn)
+		if err != nil {
+			multiError = multiError.Append(err)
+		}
+		return []byte(value)
+	})
+	return expanded, multiError.ErrorOrNil()
+}
+
+// resolveConfigReferences resolves the ${env:VAR} and ${file:/path} references in the config's string values on this
+// node, so that nodes sharing a persisted config can each use their own certificate paths and secrets.  The unresolved
+// config is kept so that the resolved values aren't returned by the config endpoints.
+func (dbConfig *DbConfig) resolveConfigReferences(allowedFileDirs []string) error {
+	rawConfig, err := base.JSONMarshal(dbConfig)
+	if err != nil {
+		return err
+	}
+	if !configReferenceRegexp.Match(rawConfig) {
+		return nil
+	}
+	var unresolved map[string]interface{}
+	if err := base.JSONUnmarshal(rawConfig, &unresolved); err != nil {
+		return err
+	}
+	rawConfig, err = expandConfigReferences(rawConfig, allowedFileDirs)
+	if err != nil {
+		return err
+	}
+	var resolved DbConfig
+	if err := base.JSONUnmarshal(rawConfig, &resolved); err != nil {
+		return err
+	}
+	*dbConfig = resolved
+	dbConfig.unresolvedConfig = unresolved
+	return nil
+}
+
+// withConfigReferences returns a copy of the config where the string values that were resolved from references are
+// replaced by the references.
+func (dbConfig *DbConfig) withConfigReferences() (*DbConfig, error) {
+	if dbConfig.unresolvedConfig == nil {
+		return dbConfig, nil
+	}
+	rawConfig, err := base.JSONMarshal(dbConfig)
+	if err != nil {
+		return nil, err
+	}
+	var config map[string]interface{}
+	if err := base.JSONUnmarshal(rawConfig, &config); err != nil {
+		return nil, err
+	}
+	restoreConfigReferences(config, dbConfig.unresolvedConfig)
+	if rawConfig, err = base.JSONMarshal(config); err != nil {
+		return nil, err
+	}
+	var restored DbConfig
+	if err := base.JSONUnmarshal(rawConfig, &restored); err != nil {
+		return nil, err
+	}
+	restored.unresolvedConfig = dbConfig.unresolvedConfig
+	return &restored, nil
+}
+
+// restoreConfigReferences replaces the values in config that are references in the unresolved config with the
+// references, returning the updated value.
+func restoreConfigReferences(config, unresolved interface{}) interface{} {
+	switch unresolvedValue := unresolved.(type) {
+	case string:
+		if configReferenceRegexp.MatchString(unresolvedValue) {
+			return unresolvedValue
+		}
+	case map[string]interface{}:
+		if configMap, ok := config.(map[string]interface{}); ok {
+			for key, value := range unresolvedValue {
+				if configValue, ok := configMap[key]; ok {
+					configMap[key] = restoreConfigReferences(configValue, value)
+				}
+			}
+		}
+	case []interface{}:
+		if configSlice, ok := config.([]interface{}); ok && len(configSlice) == len(unresolvedValue) {
+			for i, value := range unresolvedValue {
+				configSlice[i] = restoreConfigReferences(configSlice[i], value)
+			}
+		}
+	}
+	return config
+}
+
 // ErrEnvVarUndefined is returned when a specified variable can’t be resolved from
 // the system environment and no default value is supplied in the configuration.
 type ErrEnvVarUndefined struct {
@@ -1118,6 +1683,10 @@ func (sc *StartupConfig) SetupAndValidateLogging() (err error) {
 
 	base.SetRedaction(sc.Logging.RedactionLevel)
 
+	if err := base.SetLogFormat(sc.Logging.Format); err != nil {
+		return err
+	}
+
 	if sc.Logging.LogFilePath == "" {
 		sc.Logging.LogFilePath = defaultLogFilePath
 	}
@@ -1131,6 +1700,7 @@ func (sc *StartupConfig) SetupAndValidateLogging() (err error) {
 		sc.Logging.Debug,
 		sc.Logging.Trace,
 		sc.Logging.Stats,
+		sc.Logging.Audit,
 	)
 }
 
@@ -1147,7 +1717,9 @@ func SetMaxFileDescriptors(maxP *uint64) error {
 	return nil
 }
 
-func (sc *ServerContext) Serve(config *StartupConfig, addr string, handler http.Handler) error {
+// Serve listens on addr and serves requests using handler.  If clientCACertPath is set, TLS client certs signed by
+// the CAs at that path are accepted.
+func (sc *ServerContext) Serve(config *StartupConfig, addr string, handler http.Handler, clientCACertPath string) error {
 	http2Enabled := false
 	if config.Unsupported.HTTP2 != nil && config.Unsupported.HTTP2.Enabled != nil {
 		http2Enabled = *config.Unsupported.HTTP2.Enabled
@@ -1167,6 +1739,7 @@ func (sc *ServerContext) Serve(config *StartupConfig, addr string, handler http.
 		config.API.IdleTimeout.Value(),
 		http2Enabled,
 		tlsMinVersion,
+		clientCACertPath,
 	)
 	if err != nil {
 		return err
@@ -1205,11 +1778,81 @@ func (sc *StartupConfig) Validate(isEnterpriseEdition bool) (errorMessages error
 		multiError = multiError.Append(fmt.Errorf("cannot skip server TLS validation and use CA Cert"))
 	}
 
+	if sc.Bootstrap.ConfigEncryption != nil {
+		multiError = multiError.Append(sc.Bootstrap.ConfigEncryption.validate())
+	}
+
+	if len(sc.Bootstrap.ConfigBuckets) > 0 && sc.IsServerless() {
+		multiError = multiError.Append(fmt.Errorf("bootstrap.config_buckets cannot be used in serverless mode, which polls the buckets in bucket_credentials"))
+	}
+	for _, bucket := range sc.Bootstrap.ConfigBuckets {
+		if bucket == "" {
+			multiError = multiError.Append(fmt.Errorf("bootstrap.config_buckets cannot contain an empty bucket name"))
+		}
+	}
+
+	if sc.Bootstrap.StartupRetryWindow.Value() < 0 {
+		multiError = multiError.Append(fmt.Errorf("bootstrap.startup_retry_window cannot be negative"))
+	}
+
 	// Make sure if a SSL key or cert is provided, they are both provided
 	if (sc.API.HTTPS.TLSKeyPath != "" || sc.API.HTTPS.TLSCertPath != "") && (sc.API.HTTPS.TLSKeyPath == "" || sc.API.HTTPS.TLSCertPath == "") {
 		multiError = multiError.Append(fmt.Errorf("both TLS Key Path and TLS Cert Path must be provided when using client TLS. Disable client TLS by not providing either of these options"))
 	}
 
+	if sc.API.HTTPS.ClientCACertPath != "" && sc.API.HTTPS.TLSCertPath == "" {
+		multiError = multiError.Append(fmt.Errorf("api.https.client_ca_cert_path requires TLS to be enabled with api.https.tls_cert_path and api.https.tls_key_path"))
+	}
+
+	if err := base.ValidateHistogramBuckets(sc.API.MetricsHistogramBuckets); err != nil {
+		multiError = multiError.Append(fmt.Errorf("api.metrics_histogram_buckets: %w", err))
+	}
+
+	if sc.API.AdminJWT != nil {
+		if err := sc.API.AdminJWT.validate(); err != nil {
+			multiError = multiError.Append(err)
+		}
+	}
+
+	for certName, clientCert := range sc.Replicator.ClientCerts {
+		if clientCert.CertPath == "" || clientCert.KeyPath == "" {
+			multiError = multiError.Append(fmt.Errorf("both cert_path and key_path must be provided for replicator client cert %q", certName))
+		}
+	}
+
+	if sc.Tracing.OTLPEndpoint != "" {
+		if endpoint, err := url.Parse(sc.Tracing.OTLPEndpoint); err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+			multiError = multiError.Append(fmt.Errorf("tracing.otlp_endpoint must be an http or https URL"))
+		}
+	}
+	if sc.Tracing.SampleRate != nil && (*sc.Tracing.SampleRate < 0 || *sc.Tracing.SampleRate > 1) {
+		multiError = multiError.Append(fmt.Errorf("tracing.sample_rate must be between 0 and 1"))
+	}
+
+	if err := sc.Profiling.validate(sc.Logging.LogFilePath); err != nil {
+		multiError = multiError.Append(err)
+	}
+
+	if sc.MetricsExport.Interval.Value() < 0 {
+		multiError = multiError.Append(fmt.Errorf("metrics_export.interval cannot be negative"))
+	}
+	for name, address := range map[string]string{
+		"metrics_export.statsd_address":           sc.MetricsExport.StatsDAddress,
+		"metrics_export.cloudwatch_agent_address": sc.MetricsExport.CloudWatchAgentAddress,
+	} {
+		if address == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			multiError = multiError.Append(fmt.Errorf("%s must be a host:port address: %w", name, err))
+		}
+	}
+	if sc.MetricsExport.OTLPEndpoint != "" {
+		if endpoint, err := url.Parse(sc.MetricsExport.OTLPEndpoint); err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+			multiError = multiError.Append(fmt.Errorf("metrics_export.otlp_endpoint must be an http or https URL"))
+		}
+	}
+
 	if sc.Auth.BcryptCost > 0 && (sc.Auth.BcryptCost < auth.DefaultBcryptCost || sc.Auth.BcryptCost > bcrypt.MaxCost) {
 		multiError = multiError.Append(fmt.Errorf("%v: %d outside allowed range: %d-%d", auth.ErrInvalidBcryptCost, sc.Auth.BcryptCost, auth.DefaultBcryptCost, bcrypt.MaxCost))
 	}
@@ -1278,6 +1921,14 @@ func SetupServerContext(ctx context.Context, config *StartupConfig, persistentCo
 		return nil, err
 	}
 
+	if config.Tracing.OTLPEndpoint != "" {
+		sampleRate := 1.0
+		if config.Tracing.SampleRate != nil {
+			sampleRate = *config.Tracing.SampleRate
+		}
+		base.StartTracing(ctx, config.Tracing.OTLPEndpoint, config.Tracing.ServiceName, sampleRate)
+	}
+
 	sc := NewServerContext(ctx, config, persistentConfig)
 	if !base.ServerIsWalrus(config.Bootstrap.Server) {
 		if err := sc.initializeCouchbaseServerConnections(ctx); err != nil {
@@ -1294,6 +1945,7 @@ func (sc *ServerContext) fetchAndLoadConfigs(ctx context.Context, isInitialStart
 	if err != nil {
 		return 0, err
 	}
+	sc.pruneDatabaseLoadErrors(fetchedConfigs)
 
 	// Check if we need to update the set of databases before we have to acquire the write lock to do so
 	// we don't need to do this two-stage lock on initial startup as the REST APIs aren't even online yet.
@@ -1334,6 +1986,8 @@ func (sc *ServerContext) fetchAndLoadConfigs(ctx context.Context, isInitialStart
 		if !found {
 			base.InfofCtx(ctx, base.KeyConfig, "Database %q was running on this node, but config was not found on the server - removing database", base.MD(dbName))
 			sc._removeDatabase(ctx, dbName)
+			_ = base.SetDbConsoleLoggerConfig(dbName, nil)
+			base.SetRecentLogEntriesLimit(dbName, 0)
 		} else {
 			base.DebugfCtx(ctx, base.KeyConfig, "Found config for database %q after acquiring write lock - not removing database", base.MD(dbName))
 		}
@@ -1372,19 +2026,44 @@ func (sc *ServerContext) _fetchAndLoadDatabase(ctx context.Context, dbName strin
 	return true, nil
 }
 
-func (sc *ServerContext) fetchDatabase(ctx context.Context, dbName string) (found bool, dbConfig *DatabaseConfig, err error) {
-	var buckets []string
+// bootstrapBuckets returns the buckets that database configs can be stored in - those with credentials when running
+// serverless, or else all of the cluster's buckets.
+func (sc *ServerContext) bootstrapBuckets() ([]string, error) {
 	if sc.Config.IsServerless() {
-		buckets = make([]string, 0, len(sc.Config.BucketCredentials))
+		buckets := make([]string, 0, len(sc.Config.BucketCredentials))
 		for bucket, _ := range sc.Config.BucketCredentials {
 			buckets = append(buckets, bucket)
 		}
-	} else {
-		buckets, err = sc.BootstrapContext.Connection.GetConfigBuckets()
-		if err != nil {
-			return false, nil, fmt.Errorf("couldn't get buckets from cluster: %w", err)
+		return buckets, nil
+	}
+	if len(sc.Config.Bootstrap.ConfigBuckets) > 0 {
+		return append([]string(nil), sc.Config.Bootstrap.ConfigBuckets...), nil
+	}
+	buckets, err := sc.BootstrapContext.Connection.GetConfigBuckets()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get buckets from cluster: %w", err)
+	}
+	return buckets, nil
+}
+
+// isConfigBucket returns whether the given bucket is polled for database configs.
+func (sc *ServerContext) isConfigBucket(bucket string) bool {
+	if len(sc.Config.Bootstrap.ConfigBuckets) == 0 {
+		return true
+	}
+	for _, configBucket := range sc.Config.Bootstrap.ConfigBuckets {
+		if configBucket == bucket {
+			return true
 		}
 	}
+	return false
+}
+
+func (sc *ServerContext) fetchDatabase(ctx context.Context, dbName string) (found bool, dbConfig *DatabaseConfig, err error) {
+	buckets, err := sc.bootstrapBuckets()
+	if err != nil {
+		return false, nil, err
+	}
 
 	// move bucket matching dbName to the front so it's searched first
 	for i, bucket := range buckets {
@@ -1416,6 +2095,10 @@ func (sc *ServerContext) fetchDatabase(ctx context.Context, dbName string) (foun
 
 		cnf.cas = cas
 
+		if err := cnf.resolveConfigReferences(sc.Config.Bootstrap.ConfigFileReferenceDirs); err != nil {
+			return false, nil, err
+		}
+
 		// TODO: This code is mostly copied from FetchConfigs, move into shared function with DbConfig REST API work?
 
 		// inherit properties the bootstrap config
@@ -1476,9 +2159,9 @@ func (sc *ServerContext) FetchConfigs(ctx context.Context, isInitialStartup bool
 		//	}
 		// }
 	} else {
-		buckets, err = sc.BootstrapContext.Connection.GetConfigBuckets()
+		buckets, err = sc.bootstrapBuckets()
 		if err != nil {
-			return nil, fmt.Errorf("couldn't get buckets from cluster: %w", err)
+			return nil, err
 		}
 	}
 
@@ -1505,6 +2188,11 @@ func (sc *ServerContext) FetchConfigs(ctx context.Context, isInitialStartup bool
 
 		cnf.cas = cas
 
+		if err := cnf.resolveConfigReferences(sc.Config.Bootstrap.ConfigFileReferenceDirs); err != nil {
+			base.WarnfCtx(ctx, "Unable to resolve references in config for group %q from bucket %q: %v", sc.Config.Bootstrap.ConfigGroupID, bucket, err)
+			continue
+		}
+
 		// inherit properties the bootstrap config
 		cnf.CACertPath = sc.Config.Bootstrap.CACertPath
 
@@ -1535,6 +2223,7 @@ func (sc *ServerContext) FetchConfigs(ctx context.Context, isInitialStartup bool
 func (sc *ServerContext) _applyConfigs(ctx context.Context, dbNameConfigs map[string]DatabaseConfig, isInitialStartup bool) (count int) {
 	for dbName, cnf := range dbNameConfigs {
 		applied, err := sc._applyConfig(ctx, cnf, false, isInitialStartup)
+		sc.setDatabaseLoadError(dbName, err)
 		if err != nil {
 			base.ErrorfCtx(ctx, "Couldn't apply config for database %q: %v", base.MD(dbName), err)
 			continue
@@ -1605,6 +2294,7 @@ func (sc *ServerContext) _applyConfig(ctx context.Context, cnf DatabaseConfig, f
 
 	// Strip out version as we have no use for this locally and we want to prevent it being stored and being returned
 	// by any output
+	cnf.appliedVersion = cnf.Version
 	cnf.Version = ""
 
 	// Prevent database from being unsuspended when it is suspended
@@ -1612,6 +2302,14 @@ func (sc *ServerContext) _applyConfig(ctx context.Context, cnf DatabaseConfig, f
 		return true, nil
 	}
 
+	// Cold standby databases are only started by their first request
+	if base.BoolDefault(cnf.ColdStandby, false) && sc.databases_[cnf.Name] == nil {
+		if err := sc._provisionDormantDatabase(ctx, cnf, failFast); err != nil {
+			return false, fmt.Errorf("couldn't provision cold standby database: %w", err)
+		}
+		return true, nil
+	}
+
 	// TODO: Dynamic update instead of reload
 	if err := sc._reloadDatabaseWithConfig(ctx, cnf, failFast); err != nil {
 		// remove these entries we just created above if the database hasn't loaded properly
@@ -1664,20 +2362,20 @@ func StartServer(ctx context.Context, config *StartupConfig, sc *ServerContext)
 
 	base.Consolef(base.LevelInfo, base.KeyAll, "Starting metrics server on %s", config.API.MetricsInterface)
 	go func() {
-		if err := sc.Serve(config, config.API.MetricsInterface, CreateMetricHandler(sc)); err != nil {
+		if err := sc.Serve(config, config.API.MetricsInterface, CreateMetricHandler(sc), ""); err != nil {
 			base.ErrorfCtx(ctx, "Error serving the Metrics API: %v", err)
 		}
 	}()
 
 	base.Consolef(base.LevelInfo, base.KeyAll, "Starting admin server on %s", config.API.AdminInterface)
 	go func() {
-		if err := sc.Serve(config, config.API.AdminInterface, CreateAdminHandler(sc)); err != nil {
+		if err := sc.Serve(config, config.API.AdminInterface, CreateAdminHandler(sc), ""); err != nil {
 			base.ErrorfCtx(ctx, "Error serving the Admin API: %v", err)
 		}
 	}()
 
 	base.Consolef(base.LevelInfo, base.KeyAll, "Starting server on %s ...", config.API.PublicInterface)
-	return sc.Serve(config, config.API.PublicInterface, CreatePublicHandler(sc))
+	return sc.Serve(config, config.API.PublicInterface, CreatePublicHandler(sc), config.API.HTTPS.ClientCACertPath)
 }
 
 func sharedBucketDatabaseCheck(sc *ServerContext) (errors error) {
@@ -1739,10 +2437,11 @@ func HandleSighup() {
 			base.WarnfCtx(context.Background(), "Error rotating %v: %v", logger, err)
 		}
 	}
+	runSighupHandlers()
 }
 
 // RegisterSignalHandler invokes functions based on the given signals:
-// - SIGHUP causes Sync Gateway to rotate log files.
+// - SIGHUP causes Sync Gateway to rotate log files, and reload the startup config file.
 // - SIGINT or SIGTERM causes Sync Gateway to exit cleanly.
 // - SIGKILL cannot be handled by the application.
 func RegisterSignalHandler(ctx context.Context) {
@@ -0,0 +1,136 @@
+// Copyright 2022-Present Couchbase, Inc.
+//
+// Use of this software is governed by the Business Source License included
+// in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+// in that file, in accordance with the Business Source License, use of this
+// software will be governed by the Apache License, Version 2.0, included in
+// the file licenses/APL2.txt.
+
+package rest
+
+import (
+	"context"
+	"time"
+
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/couchbase/sync_gateway/db"
+)
+
+// configVersionsStaleIntervals is the number of config polling intervals after which a node that hasn't recorded its
+// config version is assumed to have stopped running the database.
+const configVersionsStaleIntervals = 3
+
+// configVersionsDoc records the version of a database's config that each node in the config group is running.  It's
+// stored in the database's bucket, and each node updates its own entry whenever it polls for config changes.
+type configVersionsDoc struct {
+	Nodes map[string]nodeConfigVersion `json:"nodes"` // Keyed by node ID
+}
+
+type nodeConfigVersion struct {
+	Version   string    `json:"version"`
+	AppliedAt time.Time `json:"applied_at"` // When the node applied this version of the config
+	LastSeen  time.Time `json:"last_seen"`  // When the node last recorded its version
+}
+
+// DatabaseConfigConflict reports the nodes in the config group running different versions of a database's config.
+type DatabaseConfigConflict struct {
+	Versions      map[string]string `json:"versions"`       // Config version run by each node, keyed by node ID
+	LatestVersion string            `json:"latest_version"` // The version with the highest generation
+	Since         time.Time         `json:"since"`          // When the latest version was applied by a node
+}
+
+// checkConfigConflicts records the config version this node is running for each of its databases, and logs a warning
+// for each database that nodes have been running different versions of for longer than the polling interval.
+func (sc *ServerContext) checkConfigConflicts(ctx context.Context) {
+	pollInterval := sc.Config.Bootstrap.ConfigUpdateFrequency.Value()
+	for name, database := range sc.AllDatabases() {
+		config := sc.GetDatabaseConfig(name)
+		if config == nil || config.appliedVersion == "" {
+			continue
+		}
+		doc, err := recordConfigVersion(database, sc.nodeID, config.appliedVersion, config.appliedAt, pollInterval)
+		if err != nil {
+			base.DebugfCtx(ctx, base.KeyConfig, "Unable to record config version for database %q: %v", base.MD(name), err)
+			continue
+		}
+		if conflict := doc.conflict(time.Now(), pollInterval); conflict != nil {
+			base.WarnfCtx(ctx, "Nodes in config group %q have been running different versions of the config for database %q since %s - latest version: %s, versions by node: %v",
+				sc.Config.Bootstrap.ConfigGroupID, base.MD(name), conflict.Since.Format(time.RFC3339), conflict.LatestVersion, conflict.Versions)
+		}
+	}
+}
+
+// getConfigConflict returns the conflict between the config versions run by the nodes running the database, or nil
+// when they're running the same version.
+func (sc *ServerContext) getConfigConflict(database *db.DatabaseContext) (*DatabaseConfigConflict, error) {
+	pollInterval := sc.Config.Bootstrap.ConfigUpdateFrequency.Value()
+	if !sc.persistentConfig || pollInterval <= 0 {
+		return nil, nil
+	}
+	var doc configVersionsDoc
+	_, err := database.Bucket.Get(base.ConfigVersionsKeyWithGroupID(database.Options.GroupID), &doc)
+	if base.IsKeyNotFoundError(database.Bucket, err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return doc.conflict(time.Now(), pollInterval), nil
+}
+
+// recordConfigVersion updates the node's entry in the database's config versions doc, removing the entries of nodes
+// that have stopped recording their versions, and returns the updated doc.
+func recordConfigVersion(database *db.DatabaseContext, nodeID, version string, appliedAt time.Time, pollInterval time.Duration) (*configVersionsDoc, error) {
+	var doc configVersionsDoc
+	_, err := database.Bucket.Update(base.ConfigVersionsKeyWithGroupID(database.Options.GroupID), 0, func(currentValue []byte) ([]byte, *uint32, bool, error) {
+		doc = configVersionsDoc{}
+		if currentValue != nil {
+			if err := base.JSONUnmarshal(currentValue, &doc); err != nil {
+				return nil, nil, false, err
+			}
+		}
+		if doc.Nodes == nil {
+			doc.Nodes = make(map[string]nodeConfigVersion)
+		}
+		now := time.Now()
+		for id, node := range doc.Nodes {
+			if now.Sub(node.LastSeen) > configVersionsStaleIntervals*pollInterval {
+				delete(doc.Nodes, id)
+			}
+		}
+		doc.Nodes[nodeID] = nodeConfigVersion{Version: version, AppliedAt: appliedAt, LastSeen: now}
+		updated, err := base.JSONMarshal(doc)
+		return updated, nil, false, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// conflict returns the conflict between the config versions of the nodes that are still recording them, if they've
+// been running different versions for longer than the polling interval, which is long enough for every node to have
+// picked up the latest version.
+func (doc *configVersionsDoc) conflict(now time.Time, pollInterval time.Duration) *DatabaseConfigConflict {
+	conflict := &DatabaseConfigConflict{Versions: make(map[string]string)}
+	latestGeneration := 0
+	for id, node := range doc.Nodes {
+		if now.Sub(node.LastSeen) > configVersionsStaleIntervals*pollInterval {
+			continue
+		}
+		conflict.Versions[id] = node.Version
+		if generation, _ := db.ParseRevID(node.Version); generation > latestGeneration {
+			latestGeneration = generation
+			conflict.LatestVersion = node.Version
+		}
+		if node.AppliedAt.After(conflict.Since) {
+			conflict.Since = node.AppliedAt
+		}
+	}
+
+	for _, version := range conflict.Versions {
+		if version != conflict.LatestVersion && now.Sub(conflict.Since) > pollInterval {
+			return conflict
+		}
+	}
+	return nil
+}
@@ -9,6 +9,8 @@
 package rest
 
 import (
+	"time"
+
 	"github.com/couchbase/sync_gateway/base"
 	"github.com/couchbase/sync_gateway/channels"
 	"github.com/couchbase/sync_gateway/db"
@@ -21,16 +23,73 @@ type DatabaseConfig struct {
 	// This value can be explicitly set to 0 before applyConfig to force reload.
 	cas uint64
 
+	// appliedVersion is the Version of the config when it was applied to this node, which is kept after Version is
+	// stripped, to detect nodes running different versions of the config.
+	appliedVersion string
+
+	// appliedAt is when the config was applied to this node.
+	appliedAt time.Time
+
 	// Version is a generated Rev ID used for optimistic concurrency control using ETags/If-Match headers.
 	Version string `json:"version,omitempty"`
 
 	// SGVersion is a base.ComparableVersion of the Sync Gateway node that wrote the config.
 	SGVersion string `json:"sg_version,omitempty"`
 
+	// History holds the revisions of the config that this one replaced, most recent first.
+	History []DatabaseConfigRevision `json:"history,omitempty"`
+
+	// SecretsKey is the wrapped data key that encrypts the config's secrets, when bootstrap.config_encryption is set.
+	SecretsKey *ConfigSecretsKey `json:"secrets_key,omitempty"`
+
 	// DbConfig embeds database config properties
 	DbConfig
 }
 
+// DatabaseConfigHistoryMaxLength is the number of previous revisions of a database config kept in its history.
+const DatabaseConfigHistoryMaxLength = 10
+
+// DatabaseConfigRevision is a previous revision of a database config, which the config can be rolled back to.
+type DatabaseConfigRevision struct {
+	Version    string    `json:"version"`
+	SGVersion  string    `json:"sg_version,omitempty"`
+	ReplacedAt time.Time `json:"replaced_at"` // When the revision was replaced by the next
+	Config     DbConfig  `json:"config"`
+}
+
+// recordDatabaseConfigHistory wraps a BootstrapConnection.UpdateConfig callback, so that whenever the callback changes
+// the config's version, the revision being replaced is added to the updated config's history.
+func recordDatabaseConfigHistory(updateCallback func(rawBucketConfig []byte) ([]byte, error)) func(rawBucketConfig []byte) ([]byte, error) {
+	return func(rawBucketConfig []byte) ([]byte, error) {
+		newConfig, err := updateCallback(rawBucketConfig)
+		if err != nil || newConfig == nil {
+			return newConfig, err
+		}
+
+		var previous, updated DatabaseConfig
+		if err := base.JSONUnmarshal(rawBucketConfig, &previous); err != nil {
+			return nil, err
+		}
+		if err := base.JSONUnmarshal(newConfig, &updated); err != nil {
+			return nil, err
+		}
+		if updated.Version == previous.Version {
+			return newConfig, nil
+		}
+
+		updated.History = append([]DatabaseConfigRevision{{
+			Version:    previous.Version,
+			SGVersion:  previous.SGVersion,
+			ReplacedAt: time.Now().UTC(),
+			Config:     previous.DbConfig,
+		}}, previous.History...)
+		if len(updated.History) > DatabaseConfigHistoryMaxLength {
+			updated.History = updated.History[:DatabaseConfigHistoryMaxLength]
+		}
+		return base.JSONMarshal(updated)
+	}
+}
+
 func (dbc *DatabaseConfig) Redacted() (*DatabaseConfig, error) {
 	var config DatabaseConfig
 
@@ -73,6 +132,7 @@ func MergeDatabaseConfigWithDefaults(sc *StartupConfig, dbConfig *DbConfig) (*Db
 	if err != nil {
 		return nil, err
 	}
+	defaultDbConfig.unresolvedConfig = dbConfig.unresolvedConfig
 
 	return defaultDbConfig, nil
 }
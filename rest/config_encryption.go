@@ -0,0 +1,262 @@
+// Copyright 2022-Present Couchbase, Inc.
+//
+// Use of this software is governed by the Business Source License included
+// in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+// in that file, in accordance with the Business Source License, use of this
+// software will be governed by the Apache License, Version 2.0, included in
+// the file licenses/APL2.txt.
+
+package rest
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	"github.com/couchbase/sync_gateway/base"
+)
+
+// ConfigEncryptionConfig configures the encryption of secrets in the database configs persisted to buckets.  Secrets
+// are encrypted with a data key generated for each config, which is itself stored wrapped by either a local key or a
+// registered KMS provider.
+type ConfigEncryptionConfig struct {
+	KeyPath     string            `json:"key_path,omitempty"     help:"Path of a file containing the base64-encoded 256-bit key used to wrap the keys that encrypt config secrets"`
+	KMSProvider string            `json:"kms_provider,omitempty" help:"Name of a registered KMS provider used to wrap the keys that encrypt config secrets, in place of key_path"`
+	KMSOptions  map[string]string `json:"kms_options,omitempty"  help:"Options passed to the KMS provider"`
+}
+
+func (c *ConfigEncryptionConfig) validate() error {
+	if (c.KeyPath == "") == (c.KMSProvider == "") {
+		return errors.New("bootstrap.config_encryption requires exactly one of key_path or kms_provider")
+	}
+	if c.KMSOptions != nil && c.KMSProvider == "" {
+		return errors.New("bootstrap.config_encryption.kms_options requires kms_provider")
+	}
+	return nil
+}
+
+// newKeyWrapper returns the ConfigKeyWrapper that wraps the data keys of persisted configs.
+func (c *ConfigEncryptionConfig) newKeyWrapper(ctx context.Context) (base.ConfigKeyWrapper, error) {
+	if c.KMSProvider != "" {
+		return base.NewConfigKeyWrapperFromProvider(ctx, c.KMSProvider, c.KMSOptions)
+	}
+	encodedKey, err := ioutil.ReadFile(c.KeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config encryption key: %w", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encodedKey)))
+	if err != nil {
+		return nil, fmt.Errorf("config encryption key must be base64-encoded: %w", err)
+	}
+	return base.NewLocalConfigKeyWrapper(key)
+}
+
+// ConfigSecretsKey is the wrapped data key that encrypts the secrets in a persisted database config.
+type ConfigSecretsKey struct {
+	KeyID      string `json:"key_id"`      // Identifies the key that wrapped the data key
+	WrappedKey []byte `json:"wrapped_key"` // The data key, wrapped by the key identified by KeyID
+}
+
+// transformSecrets replaces each of the config's secrets with the result of the given transform.
+func (dbConfig *DbConfig) transformSecrets(transform func(string) (string, error)) (err error) {
+	transformSecret := func(secret *string) {
+		if err == nil && secret != nil {
+			*secret, err = transform(*secret)
+		}
+	}
+
+	transformSecret(&dbConfig.Password)
+	if dbConfig.Guest != nil {
+		transformSecret(dbConfig.Guest.Password)
+	}
+	for _, user := range dbConfig.Users {
+		if user != nil {
+			transformSecret(user.Password)
+		}
+	}
+	if dbConfig.LDAPConfig != nil {
+		transformSecret(&dbConfig.LDAPConfig.BindPassword)
+	}
+	if dbConfig.OIDCConfig != nil {
+		for _, provider := range dbConfig.OIDCConfig.Providers {
+			if provider != nil {
+				transformSecret(provider.ValidationKey)
+			}
+		}
+	}
+	for _, replication := range dbConfig.Replications {
+		if replication == nil {
+			continue
+		}
+		transformSecret(&replication.Password)
+		transformSecret(&replication.RemotePassword)
+		if isSecretURL(replication.Remote) {
+			transformSecret(&replication.Remote)
+		}
+		for i := range replication.Remotes {
+			if isSecretURL(replication.Remotes[i]) {
+				transformSecret(&replication.Remotes[i])
+			}
+		}
+	}
+	return err
+}
+
+// isSecretURL returns true if the given URL is an encrypted secret, or has a password that needs encrypting.
+func isSecretURL(value string) bool {
+	if base.IsEncryptedConfigSecret(value) {
+		return true
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return false
+	}
+	_, hasPassword := u.User.Password()
+	return hasPassword
+}
+
+// encryptSecrets encrypts the secrets in the config, and those in its history, with a new data key.
+func (dbc *DatabaseConfig) encryptSecrets(ctx context.Context, keyWrapper base.ConfigKeyWrapper) error {
+	dataKey, err := base.NewConfigDataKey()
+	if err != nil {
+		return err
+	}
+	wrappedKey, err := keyWrapper.WrapKey(ctx, dataKey)
+	if err != nil {
+		return fmt.Errorf("unable to wrap config encryption key: %w", err)
+	}
+	secretCipher, err := base.NewConfigSecretCipher(dataKey)
+	if err != nil {
+		return err
+	}
+
+	if err := dbc.DbConfig.transformSecrets(secretCipher.Encrypt); err != nil {
+		return err
+	}
+	for i := range dbc.History {
+		if err := dbc.History[i].Config.transformSecrets(secretCipher.Encrypt); err != nil {
+			return err
+		}
+	}
+	dbc.SecretsKey = &ConfigSecretsKey{KeyID: keyWrapper.KeyID(), WrappedKey: wrappedKey}
+	return nil
+}
+
+// decryptSecrets decrypts the secrets in the config, and those in its history.  keyWrapper may be nil when config
+// encryption isn't configured, in which case only unencrypted configs can be decrypted.
+func (dbc *DatabaseConfig) decryptSecrets(ctx context.Context, keyWrapper base.ConfigKeyWrapper) error {
+	if dbc.SecretsKey == nil {
+		return nil
+	}
+	if keyWrapper == nil {
+		return errors.New("database config has encrypted secrets, but bootstrap.config_encryption isn't configured")
+	}
+	if dbc.SecretsKey.KeyID != keyWrapper.KeyID() {
+		return fmt.Errorf("database config secrets were encrypted with key %q, but the configured key is %q", dbc.SecretsKey.KeyID, keyWrapper.KeyID())
+	}
+	dataKey, err := keyWrapper.UnwrapKey(ctx, dbc.SecretsKey.WrappedKey)
+	if err != nil {
+		return fmt.Errorf("unable to unwrap config encryption key: %w", err)
+	}
+	secretCipher, err := base.NewConfigSecretCipher(dataKey)
+	if err != nil {
+		return err
+	}
+
+	if err := dbc.DbConfig.transformSecrets(secretCipher.Decrypt); err != nil {
+		return err
+	}
+	for i := range dbc.History {
+		if err := dbc.History[i].Config.transformSecrets(secretCipher.Decrypt); err != nil {
+			return err
+		}
+	}
+	dbc.SecretsKey = nil
+	return nil
+}
+
+// secretEncryptingConnection is a BootstrapConnection that encrypts the secrets in the database configs it saves, and
+// decrypts them in the configs it fetches, so that the rest of Sync Gateway only sees plaintext configs.
+type secretEncryptingConnection struct {
+	base.BootstrapConnection
+	ctx        context.Context
+	keyWrapper base.ConfigKeyWrapper // nil when config encryption isn't configured
+}
+
+var _ base.BootstrapConnection = &secretEncryptingConnection{}
+
+// newSecretEncryptingConnection wraps the given connection to encrypt config secrets as configured in the startup
+// config.  Connections are wrapped even when encryption isn't configured, so that encrypted configs saved by other
+// nodes are rejected rather than loaded with encrypted secrets.
+func newSecretEncryptingConnection(ctx context.Context, config *StartupConfig, connection base.BootstrapConnection) (base.BootstrapConnection, error) {
+	c := &secretEncryptingConnection{BootstrapConnection: connection, ctx: ctx}
+	if config.Bootstrap.ConfigEncryption != nil {
+		keyWrapper, err := config.Bootstrap.ConfigEncryption.newKeyWrapper(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.keyWrapper = keyWrapper
+	}
+	return c, nil
+}
+
+func (c *secretEncryptingConnection) GetConfig(bucket, groupID string, valuePtr interface{}) (cas uint64, err error) {
+	cas, err = c.BootstrapConnection.GetConfig(bucket, groupID, valuePtr)
+	if err != nil {
+		return 0, err
+	}
+	if dbConfig, ok := valuePtr.(*DatabaseConfig); ok {
+		if err := dbConfig.decryptSecrets(c.ctx, c.keyWrapper); err != nil {
+			return 0, err
+		}
+	}
+	return cas, nil
+}
+
+func (c *secretEncryptingConnection) InsertConfig(bucket, groupID string, value interface{}) (newCAS uint64, err error) {
+	if dbConfig, ok := value.(*DatabaseConfig); ok && c.keyWrapper != nil {
+		var encryptedConfig DatabaseConfig
+		if err := base.DeepCopyInefficient(&encryptedConfig, dbConfig); err != nil {
+			return 0, err
+		}
+		if err := encryptedConfig.encryptSecrets(c.ctx, c.keyWrapper); err != nil {
+			return 0, err
+		}
+		value = &encryptedConfig
+	}
+	return c.BootstrapConnection.InsertConfig(bucket, groupID, value)
+}
+
+func (c *secretEncryptingConnection) UpdateConfig(bucket, groupID string, updateCallback func(rawBucketConfig []byte) (updatedConfig []byte, err error)) (newCAS uint64, err error) {
+	return c.BootstrapConnection.UpdateConfig(bucket, groupID, func(rawBucketConfig []byte) ([]byte, error) {
+		var bucketConfig DatabaseConfig
+		if err := base.JSONUnmarshal(rawBucketConfig, &bucketConfig); err != nil {
+			return nil, err
+		}
+		if err := bucketConfig.decryptSecrets(c.ctx, c.keyWrapper); err != nil {
+			return nil, err
+		}
+		rawBucketConfig, err := base.JSONMarshal(bucketConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		updatedConfig, err := updateCallback(rawBucketConfig)
+		if err != nil || updatedConfig == nil || c.keyWrapper == nil {
+			return updatedConfig, err
+		}
+
+		var encryptedConfig DatabaseConfig
+		if err := base.JSONUnmarshal(updatedConfig, &encryptedConfig); err != nil {
+			return nil, err
+		}
+		if err := encryptedConfig.encryptSecrets(c.ctx, c.keyWrapper); err != nil {
+			return nil, err
+		}
+		return base.JSONMarshal(encryptedConfig)
+	})
+}
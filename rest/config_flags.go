@@ -12,6 +12,7 @@ import (
 	"flag"
 	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
 	"time"
 
@@ -28,24 +29,30 @@ type configFlag struct {
 // (which stores the corresponding config field pointer and flag value).
 func registerConfigFlags(config *StartupConfig, fs *flag.FlagSet) map[string]configFlag {
 	return map[string]configFlag{
-		"bootstrap.group_id":                {&config.Bootstrap.ConfigGroupID, fs.String("bootstrap.group_id", "", "The config group ID to use when discovering databases. Allows for non-homogenous configuration")},
-		"bootstrap.config_update_frequency": {&config.Bootstrap.ConfigUpdateFrequency, fs.String("bootstrap.config_update_frequency", persistentConfigDefaultUpdateFrequency.String(), "How often to poll Couchbase Server for new config changes")},
-		"bootstrap.server":                  {&config.Bootstrap.Server, fs.String("bootstrap.server", "", "Couchbase Server connection string/URL")},
-		"bootstrap.username":                {&config.Bootstrap.Username, fs.String("bootstrap.username", "", "Username for authenticating to server")},
-		"bootstrap.password":                {&config.Bootstrap.Password, fs.String("bootstrap.password", "", "Password for authenticating to server")},
-		"bootstrap.ca_cert_path":            {&config.Bootstrap.CACertPath, fs.String("bootstrap.ca_cert_path", "", "Root CA cert path for TLS connection")},
-		"bootstrap.server_tls_skip_verify":  {&config.Bootstrap.ServerTLSSkipVerify, fs.Bool("bootstrap.server_tls_skip_verify", false, "Allow empty server CA Cert Path without attempting to use system root pool")},
-		"bootstrap.x509_cert_path":          {&config.Bootstrap.X509CertPath, fs.String("bootstrap.x509_cert_path", "", "Cert path (public key) for X.509 bucket auth")},
-		"bootstrap.x509_key_path":           {&config.Bootstrap.X509KeyPath, fs.String("bootstrap.x509_key_path", "", "Key path (private key) for X.509 bucket auth")},
-		"bootstrap.use_tls_server":          {&config.Bootstrap.UseTLSServer, fs.Bool("bootstrap.use_tls_server", false, "Forces the connection to Couchbase Server to use TLS")},
+		"bootstrap.group_id":                   {&config.Bootstrap.ConfigGroupID, fs.String("bootstrap.group_id", "", "The config group ID to use when discovering databases. Allows for non-homogenous configuration")},
+		"bootstrap.config_update_frequency":    {&config.Bootstrap.ConfigUpdateFrequency, fs.String("bootstrap.config_update_frequency", persistentConfigDefaultUpdateFrequency.String(), "How often to poll Couchbase Server for new config changes")},
+		"bootstrap.server":                     {&config.Bootstrap.Server, fs.String("bootstrap.server", "", "Couchbase Server connection string/URL")},
+		"bootstrap.username":                   {&config.Bootstrap.Username, fs.String("bootstrap.username", "", "Username for authenticating to server")},
+		"bootstrap.password":                   {&config.Bootstrap.Password, fs.String("bootstrap.password", "", "Password for authenticating to server")},
+		"bootstrap.ca_cert_path":               {&config.Bootstrap.CACertPath, fs.String("bootstrap.ca_cert_path", "", "Root CA cert path for TLS connection")},
+		"bootstrap.server_tls_skip_verify":     {&config.Bootstrap.ServerTLSSkipVerify, fs.Bool("bootstrap.server_tls_skip_verify", false, "Allow empty server CA Cert Path without attempting to use system root pool")},
+		"bootstrap.x509_cert_path":             {&config.Bootstrap.X509CertPath, fs.String("bootstrap.x509_cert_path", "", "Cert path (public key) for X.509 bucket auth")},
+		"bootstrap.x509_key_path":              {&config.Bootstrap.X509KeyPath, fs.String("bootstrap.x509_key_path", "", "Key path (private key) for X.509 bucket auth")},
+		"bootstrap.use_tls_server":             {&config.Bootstrap.UseTLSServer, fs.Bool("bootstrap.use_tls_server", false, "Forces the connection to Couchbase Server to use TLS")},
+		"bootstrap.config_buckets":             {&config.Bootstrap.ConfigBuckets, fs.String("bootstrap.config_buckets", "", "Comma separated buckets to poll for database configs, instead of every bucket on the cluster")},
+		"bootstrap.startup_retry_window":       {&config.Bootstrap.StartupRetryWindow, fs.String("bootstrap.startup_retry_window", "0s", "How long to retry connecting to Couchbase Server and loading databases at startup, with exponential backoff")},
+		"bootstrap.config_encryption":          {&config.Bootstrap.ConfigEncryption, fs.String("bootstrap.config_encryption", "null", "JSON-encoded key path or KMS provider used to encrypt the secrets in database configs persisted to buckets")},
+		"bootstrap.config_file_reference_dirs": {&config.Bootstrap.ConfigFileReferenceDirs, fs.String("bootstrap.config_file_reference_dirs", "", "Comma separated directories that database configs can read files from using ${file:/path} references")},
 
 		"api.public_interface":                              {&config.API.PublicInterface, fs.String("api.public_interface", "", "Network interface to bind public API to")},
 		"api.admin_interface":                               {&config.API.AdminInterface, fs.String("api.admin_interface", "", "Network interface to bind admin API to")},
 		"api.metrics_interface":                             {&config.API.MetricsInterface, fs.String("api.metrics_interface", "", "Network interface to bind metrics API to")},
 		"api.profile_interface":                             {&config.API.ProfileInterface, fs.String("api.profile_interface", "", "Network interface to bind profiling API to")},
+		"api.metrics_histogram_buckets":                     {&config.API.MetricsHistogramBuckets, fs.String("api.metrics_histogram_buckets", "", "Comma separated upper bounds, in seconds, of the buckets of latency histograms reported by the metrics API")},
 		"api.admin_interface_authentication":                {&config.API.AdminInterfaceAuthentication, fs.Bool("api.admin_interface_authentication", false, "Whether the admin API requires authentication")},
 		"api.metrics_interface_authentication":              {&config.API.MetricsInterfaceAuthentication, fs.Bool("api.metrics_interface_authentication", false, "Whether the metrics API requires authentication")},
 		"api.enable_admin_authentication_permissions_check": {&config.API.EnableAdminAuthenticationPermissionsCheck, fs.Bool("api.enable_admin_authentication_permissions_check", false, "Whether to enable the DP permissions check feature of admin auth")},
+		"api.admin_jwt":                                     {&config.API.AdminJWT, fs.String("api.admin_jwt", "null", "JSON-encoded issuer, audience and JWKS URI of signed JWTs accepted as bearer tokens by the admin and metrics APIs")},
 		"api.server_read_timeout":                           {&config.API.ServerReadTimeout, fs.String("api.server_read_timeout", "", "Maximum duration.Second before timing out read of the HTTP(S) request")},
 		"api.server_write_timeout":                          {&config.API.ServerWriteTimeout, fs.String("api.server_write_timeout", "", "Maximum duration.Second before timing out write of the HTTP(S) response")},
 		"api.read_header_timeout":                           {&config.API.ReadHeaderTimeout, fs.String("api.read_header_timeout", "", "The amount of time allowed to read request headers")},
@@ -58,6 +65,7 @@ func registerConfigFlags(config *StartupConfig, fs *flag.FlagSet) map[string]con
 		"api.https.tls_minimum_version": {&config.API.HTTPS.TLSMinimumVersion, fs.String("api.https.tls_minimum_version", "", "The minimum allowable TLS version for the REST APIs")},
 		"api.https.tls_cert_path":       {&config.API.HTTPS.TLSCertPath, fs.String("api.https.tls_cert_path", "", "The TLS cert file to use for the REST APIs")},
 		"api.https.tls_key_path":        {&config.API.HTTPS.TLSKeyPath, fs.String("api.https.tls_key_path", "", "The TLS key file to use for the REST APIs")},
+		"api.https.client_ca_cert_path": {&config.API.HTTPS.ClientCACertPath, fs.String("api.https.client_ca_cert_path", "", "The CA cert file used to verify TLS client certs presented to the public REST API")},
 
 		"api.cors.origin":       {&config.API.CORS.Origin, fs.String("api.cors.origin", "", "List of comma seperated allowed origins. Use '*' to allow access from everywhere")},
 		"api.cors.login_origin": {&config.API.CORS.LoginOrigin, fs.String("api.cors.login_origin", "", "List of comma seperated allowed login origins")},
@@ -66,6 +74,7 @@ func registerConfigFlags(config *StartupConfig, fs *flag.FlagSet) map[string]con
 
 		"logging.log_file_path":   {&config.Logging.LogFilePath, fs.String("logging.log_file_path", "", "Absolute or relative path on the filesystem to the log file directory. A relative path is from the directory that contains the Sync Gateway executable file")},
 		"logging.redaction_level": {&config.Logging.RedactionLevel, fs.String("logging.redaction_level", "", "Redaction level to apply to log output. Options: none, partial, full, unset")},
+		"logging.format":          {&config.Logging.Format, fs.String("logging.format", "", "Format of the logs written to the console and log files. Options: text, json")},
 
 		"logging.console.enabled":                          {&config.Logging.Console.Enabled, fs.Bool("logging.console.enabled", false, "")},
 		"logging.console.rotation.max_size":                {&config.Logging.Console.Rotation.MaxSize, fs.Int("logging.console.rotation.max_size", 0, "")},
@@ -120,16 +129,42 @@ func registerConfigFlags(config *StartupConfig, fs *flag.FlagSet) map[string]con
 		"logging.stats.rotation.rotated_logs_size_limit": {&config.Logging.Stats.Rotation.RotatedLogsSizeLimit, fs.Int("logging.stats.rotation.rotated_logs_size_limit", 0, "")},
 		"logging.stats.collation_buffer_size":            {&config.Logging.Stats.CollationBufferSize, fs.Int("logging.stats.collation_buffer_size", 0, "")},
 
+		"logging.audit.enabled":                          {&config.Logging.Audit.Enabled, fs.Bool("logging.audit.enabled", false, "")},
+		"logging.audit.rotation.max_size":                {&config.Logging.Audit.Rotation.MaxSize, fs.Int("logging.audit.rotation.max_size", 0, "")},
+		"logging.audit.rotation.max_age":                 {&config.Logging.Audit.Rotation.MaxAge, fs.Int("logging.audit.rotation.max_age", 0, "")},
+		"logging.audit.rotation.localtime":               {&config.Logging.Audit.Rotation.LocalTime, fs.Bool("logging.audit.rotation.localtime", false, "")},
+		"logging.audit.rotation.rotated_logs_size_limit": {&config.Logging.Audit.Rotation.RotatedLogsSizeLimit, fs.Int("logging.audit.rotation.rotated_logs_size_limit", 0, "")},
+		"logging.audit.collation_buffer_size":            {&config.Logging.Audit.CollationBufferSize, fs.Int("logging.audit.collation_buffer_size", 0, "")},
+		"logging.audit.enabled_events":                   {&config.Logging.Audit.EnabledEvents, fs.String("logging.audit.enabled_events", "", "Comma separated audit events to record. Defaults to all events")},
+
 		"auth.bcrypt_cost": {&config.Auth.BcryptCost, fs.Int("auth.bcrypt_cost", 0, "Cost to use for bcrypt password hashes")},
 
 		"replicator.max_heartbeat":    {&config.Replicator.MaxHeartbeat, fs.String("replicator.max_heartbeat", "", "Max heartbeat value for _changes request")},
 		"replicator.blip_compression": {&config.Replicator.BLIPCompression, fs.Int("replicator.blip_compression", 0, "BLIP data compression level (0-9)")},
+		"replicator.client_certs":     {&config.Replicator.ClientCerts, fs.String("replicator.client_certs", "null", "JSON-encoded map of names to TLS client certs, that inter-Sync Gateway replications can present to remotes")},
+
+		"tracing.otlp_endpoint": {&config.Tracing.OTLPEndpoint, fs.String("tracing.otlp_endpoint", "", "URL of the OTLP/HTTP collector to export traces to, such as http://localhost:4318")},
+		"tracing.service_name":  {&config.Tracing.ServiceName, fs.String("tracing.service_name", "", "Service name to export traces with")},
+		"tracing.sample_rate":   {&config.Tracing.SampleRate, fs.Float64("tracing.sample_rate", 1, "Fraction of new traces to sample, between 0 and 1")},
+
+		"profiling.enabled":      {&config.Profiling.Enabled, fs.Bool("profiling.enabled", false, "Whether to periodically capture CPU and heap profiles")},
+		"profiling.directory":    {&config.Profiling.Directory, fs.String("profiling.directory", "", "Directory to write profiles to")},
+		"profiling.interval":     {&config.Profiling.Interval, fs.String("profiling.interval", "", "How often to capture profiles")},
+		"profiling.cpu_duration": {&config.Profiling.CPUDuration, fs.String("profiling.cpu_duration", "", "How long each CPU profile samples for")},
+		"profiling.max_profiles": {&config.Profiling.MaxProfiles, fs.Uint("profiling.max_profiles", 0, "Number of the most recent profiles of each type to keep")},
 
-		"unsupported.stats_log_frequency":                  {&config.Unsupported.StatsLogFrequency, fs.String("unsupported.stats_log_frequency", "", "How often should stats be written to stats logs")},
-		"unsupported.use_stdlib_json":                      {&config.Unsupported.UseStdlibJSON, fs.Bool("unsupported.use_stdlib_json", false, "Bypass the jsoniter package and use Go's stdlib instead")},
-		"unsupported.http2.enabled":                        {&config.Unsupported.HTTP2.Enabled, fs.Bool("unsupported.http2.enabled", false, "Whether HTTP2 support is enabled")},
-		"unsupported.serverless.enabled":                   {&config.Unsupported.Serverless.Enabled, fs.Bool("unsupported.serverless.enabled", false, "Settings for running Sync Gateway in serverless mode.")},
-		"unsupported.serverless.min_config_fetch_interval": {&config.Unsupported.Serverless.MinConfigFetchInterval, fs.String("unsupported.serverless.min_config_fetch_interval", "", "How long to cache configs fetched from the buckets for. This cache is used for requested databases that SG does not know about.")},
+		"metrics_export.interval":                 {&config.MetricsExport.Interval, fs.String("metrics_export.interval", "", "How often to push stats")},
+		"metrics_export.statsd_address":           {&config.MetricsExport.StatsDAddress, fs.String("metrics_export.statsd_address", "", "host:port of a StatsD server to push stats to over UDP")},
+		"metrics_export.cloudwatch_agent_address": {&config.MetricsExport.CloudWatchAgentAddress, fs.String("metrics_export.cloudwatch_agent_address", "", "host:port of the CloudWatch agent's Embedded Metric Format TCP listener to push stats to")},
+		"metrics_export.cloudwatch_namespace":     {&config.MetricsExport.CloudWatchNamespace, fs.String("metrics_export.cloudwatch_namespace", "", "CloudWatch namespace to push stats to")},
+		"metrics_export.otlp_endpoint":            {&config.MetricsExport.OTLPEndpoint, fs.String("metrics_export.otlp_endpoint", "", "URL of the OTLP/HTTP collector to push stats to")},
+
+		"unsupported.stats_log_frequency":                     {&config.Unsupported.StatsLogFrequency, fs.String("unsupported.stats_log_frequency", "", "How often should stats be written to stats logs")},
+		"unsupported.use_stdlib_json":                         {&config.Unsupported.UseStdlibJSON, fs.Bool("unsupported.use_stdlib_json", false, "Bypass the jsoniter package and use Go's stdlib instead")},
+		"unsupported.http2.enabled":                           {&config.Unsupported.HTTP2.Enabled, fs.Bool("unsupported.http2.enabled", false, "Whether HTTP2 support is enabled")},
+		"unsupported.serverless.enabled":                      {&config.Unsupported.Serverless.Enabled, fs.Bool("unsupported.serverless.enabled", false, "Settings for running Sync Gateway in serverless mode.")},
+		"unsupported.serverless.max_connections_per_database": {&config.Unsupported.Serverless.MaxConnectionsPerDatabase, fs.Uint("unsupported.serverless.max_connections_per_database", 0, "Max # of concurrent non-admin requests to each database - 0 for no limit")},
+		"unsupported.serverless.min_config_fetch_interval":    {&config.Unsupported.Serverless.MinConfigFetchInterval, fs.String("unsupported.serverless.min_config_fetch_interval", "", "How long to cache configs fetched from the buckets for. This cache is used for requested databases that SG does not know about.")},
 
 		"unsupported.user_queries": {&config.Unsupported.UserQueries, fs.Bool("unsupported.user_queries", false, "Whether user-query APIs are enabled")},
 
@@ -173,6 +208,23 @@ func fillConfigWithFlags(fs *flag.FlagSet, flags map[string]configFlag) error {
 				} else {
 					*val.config.(*int) = *val.flagValue.(*int)
 				}
+			case *float64:
+				if pointer {
+					rval.Set(reflect.ValueOf(val.flagValue))
+				} else {
+					*val.config.(*float64) = *val.flagValue.(*float64)
+				}
+			case *[]float64:
+				var list []float64
+				for _, str := range strings.Split(*val.flagValue.(*string), ",") {
+					bound, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+					if err != nil {
+						errorMessages = errorMessages.Append(fmt.Errorf("flag %s error: %w", f.Name, err))
+						return
+					}
+					list = append(list, bound)
+				}
+				*val.config.(*[]float64) = list
 			case *bool:
 				rval.Set(reflect.ValueOf(val.flagValue))
 			case *base.ConfigDuration:
@@ -229,6 +281,42 @@ func fillConfigWithFlags(fs *flag.FlagSet, flags map[string]configFlag) error {
 					return
 				}
 				*val.config.(*base.PerBucketCredentialsConfig) = bucketCredentials
+			case *AdminJWTConfig:
+				str := *val.flagValue.(*string)
+				var adminJWT *AdminJWTConfig
+				d := base.JSONDecoder(strings.NewReader(str))
+				d.DisallowUnknownFields()
+				err := d.Decode(&adminJWT)
+				if err != nil {
+					err = fmt.Errorf("flag %s for value %q error: %w", f.Name, str, err)
+					errorMessages = errorMessages.Append(err)
+					return
+				}
+				rval.Set(reflect.ValueOf(adminJWT))
+			case *ConfigEncryptionConfig:
+				str := *val.flagValue.(*string)
+				var configEncryption *ConfigEncryptionConfig
+				d := base.JSONDecoder(strings.NewReader(str))
+				d.DisallowUnknownFields()
+				err := d.Decode(&configEncryption)
+				if err != nil {
+					err = fmt.Errorf("flag %s for value %q error: %w", f.Name, str, err)
+					errorMessages = errorMessages.Append(err)
+					return
+				}
+				rval.Set(reflect.ValueOf(configEncryption))
+			case *ReplicatorClientCertsConfig:
+				str := *val.flagValue.(*string)
+				var clientCerts ReplicatorClientCertsConfig
+				d := base.JSONDecoder(strings.NewReader(str))
+				d.DisallowUnknownFields()
+				err := d.Decode(&clientCerts)
+				if err != nil {
+					err = fmt.Errorf("flag %s for value %q error: %w", f.Name, str, err)
+					errorMessages = errorMessages.Append(err)
+					return
+				}
+				*val.config.(*ReplicatorClientCertsConfig) = clientCerts
 			default:
 				errorMessages = errorMessages.Append(fmt.Errorf("Unknown type %v for flag %v\n", rval.Type(), f.Name))
 			}
@@ -48,6 +48,14 @@ func TestAllConfigFlags(t *testing.T) {
 				val = `{"db1":{"password":"foo"}}`
 			case *base.PerBucketCredentialsConfig:
 				val = `{"bucket":{"password":"foo"}}`
+			case *ReplicatorClientCertsConfig:
+				val = `{"cert":{"cert_path":"cert.pem","key_path":"key.pem"}}`
+			case *AdminJWTConfig:
+				val = `{"issuer":"https://issuer","audience":"sync_gateway","jwks_uri":"https://issuer/jwks"}`
+			case *ConfigEncryptionConfig:
+				val = `{"key_path":"config.key"}`
+			case *[]float64:
+				val = "0.1,1,10"
 			}
 			flags = append(flags, "-"+name, val)
 		case bool:
@@ -84,6 +92,7 @@ func TestFillConfigWithFlagsValidVals(t *testing.T) {
 		"-logging.console.log_level", "warn", // *LogLevel
 		"-replicator.max_heartbeat", "5h2m33s", // base.ConfigDuration
 		"-max_file_descriptors", "12345", // uint64
+		"-api.metrics_histogram_buckets", "0.01, 0.1,1", // []float64
 	})
 	require.NoError(t, err)
 
@@ -101,6 +110,7 @@ func TestFillConfigWithFlagsValidVals(t *testing.T) {
 	assert.Equal(t, "warn", config.Logging.Console.LogLevel.String())
 	assert.Equal(t, base.NewConfigDuration(time.Hour*5+time.Minute*2+time.Second*33), config.Replicator.MaxHeartbeat)
 	assert.Equal(t, uint64(12345), config.MaxFileDescriptors)
+	assert.Equal(t, []float64{0.01, 0.1, 1}, config.API.MetricsHistogramBuckets)
 }
 
 // Manually test different types of flags with invalid values
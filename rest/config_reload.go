@@ -0,0 +1,285 @@
+// Copyright 2022-Present Couchbase, Inc.
+//
+// Use of this software is governed by the Business Source License included
+// in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+// in that file, in accordance with the Business Source License, use of this
+// software will be governed by the Apache License, Version 2.0, included in
+// the file licenses/APL2.txt.
+
+package rest
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/couchbase/sync_gateway/base"
+)
+
+// reloadableStartupConfigFields are the startup config fields, and parents of fields, that can be applied to a running
+// node by reloading the startup config.  All other fields require a restart.
+var reloadableStartupConfigFields = []string{
+	"api.cors",
+	"logging.redaction_level",
+	"logging.console.log_level",
+	"logging.console.log_keys",
+	"logging.error.enabled",
+	"logging.warn.enabled",
+	"logging.info.enabled",
+	"logging.debug.enabled",
+	"logging.trace.enabled",
+	"logging.stats.enabled",
+	"replicator.max_heartbeat",
+	"replicator.blip_compression",
+}
+
+// StartupConfigReloadResponse reports the startup config fields changed by a reload.
+type StartupConfigReloadResponse struct {
+	Applied         []string `json:"applied"`          // Changed fields that were applied to the running node
+	RequiresRestart []string `json:"requires_restart"` // Changed fields that only take effect when the node is restarted
+}
+
+// ReloadStartupConfig re-reads the startup config file, and applies the fields that have changed since the previous
+// reload that can be changed on a running node.  Changes to other fields since startup are reported as requiring a
+// restart.  Flags continue to take precedence over the file.
+func (sc *ServerContext) ReloadStartupConfig(ctx context.Context) (*StartupConfigReloadResponse, error) {
+	if sc.startupConfigPath == "" {
+		return nil, base.HTTPErrorf(http.StatusBadRequest, "Sync Gateway wasn't started with a startup config file to reload")
+	}
+
+	sc.reloadLock.Lock()
+	defer sc.reloadLock.Unlock()
+
+	fileStartupConfig, err := LoadStartupConfigFromPath(sc.startupConfigPath)
+	if err != nil {
+		return nil, base.HTTPErrorf(http.StatusBadRequest, "Couldn't load startup config file: %v", err)
+	}
+	loadedStartupConfig, err := getInitialStartupConfig(fileStartupConfig, sc.flagStartupConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	updatedConfig := DefaultStartupConfig(defaultLogFilePath)
+	if err := updatedConfig.Merge(loadedStartupConfig); err != nil {
+		return nil, err
+	}
+	if err := updatedConfig.Validate(base.IsEnterpriseEdition()); err != nil {
+		return nil, base.HTTPErrorf(http.StatusBadRequest, "Invalid startup config: %v", err)
+	}
+
+	// Reloadable fields were applied by the previous reload, but other fields remain as they were at startup
+	previousStartupConfig := sc.reloadedStartupConfig
+	if previousStartupConfig == nil {
+		previousStartupConfig = sc.initialStartupConfig
+	}
+	changedSinceReload, err := changedStartupConfigFields(previousStartupConfig, loadedStartupConfig)
+	if err != nil {
+		return nil, err
+	}
+	changedSinceStartup, err := changedStartupConfigFields(sc.initialStartupConfig, loadedStartupConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &StartupConfigReloadResponse{Applied: []string{}, RequiresRestart: []string{}}
+	for _, field := range changedSinceReload {
+		if isReloadableStartupConfigField(field) {
+			response.Applied = append(response.Applied, field)
+		}
+	}
+	for _, field := range changedSinceStartup {
+		if !isReloadableStartupConfigField(field) {
+			response.RequiresRestart = append(response.RequiresRestart, field)
+		}
+	}
+	sc.applyReloadableStartupConfig(ctx, &updatedConfig, response.Applied)
+	sc.reloadedStartupConfig = loadedStartupConfig
+
+	base.InfofCtx(ctx, base.KeyConfig, "Reloaded startup config from %s - applied: %v, requires restart: %v",
+		base.MD(sc.startupConfigPath), response.Applied, response.RequiresRestart)
+	return response, nil
+}
+
+// applyReloadableStartupConfig applies the given fields of the updated config to the running node.  Fields of Config
+// are replaced while holding reloadableConfigLock, so must be read through the accessors below by running requests.
+func (sc *ServerContext) applyReloadableStartupConfig(ctx context.Context, updatedConfig *StartupConfig, fields []string) {
+	sc.reloadableConfigLock.Lock()
+	defer sc.reloadableConfigLock.Unlock()
+
+	logging := updatedConfig.Logging
+	fileLoggers := map[string]struct {
+		config *base.FileLoggerConfig
+		enable func(bool)
+	}{
+		"error": {logging.Error, base.EnableErrorLogger},
+		"warn":  {logging.Warn, base.EnableWarnLogger},
+		"info":  {logging.Info, base.EnableInfoLogger},
+		"debug": {logging.Debug, base.EnableDebugLogger},
+		"trace": {logging.Trace, base.EnableTraceLogger},
+		"stats": {logging.Stats, base.EnableStatsLogger},
+	}
+
+	for _, field := range fields {
+		switch {
+		case strings.HasPrefix(field, "api.cors"):
+			sc.Config.API.CORS = updatedConfig.API.CORS
+		case field == "logging.redaction_level":
+			base.SetRedaction(logging.RedactionLevel)
+		case field == "logging.console.log_level":
+			if logging.Console != nil && logging.Console.LogLevel != nil {
+				base.ConsoleLogLevel().Set(*logging.Console.LogLevel)
+			}
+		case field == "logging.console.log_keys":
+			logKeys := make(map[string]bool)
+			if logging.Console != nil {
+				for _, key := range logging.Console.LogKeys {
+					logKeys[key] = true
+				}
+			}
+			base.UpdateLogKeys(logKeys, true)
+		case strings.HasPrefix(field, "logging.") && strings.HasSuffix(field, ".enabled"):
+			fileLogger := fileLoggers[strings.TrimSuffix(strings.TrimPrefix(field, "logging."), ".enabled")]
+			if fileLogger.config != nil && fileLogger.config.Enabled != nil {
+				fileLogger.enable(*fileLogger.config.Enabled)
+			}
+		case field == "replicator.max_heartbeat":
+			sc.Config.Replicator.MaxHeartbeat = updatedConfig.Replicator.MaxHeartbeat
+		case field == "replicator.blip_compression":
+			sc.Config.Replicator.BLIPCompression = updatedConfig.Replicator.BLIPCompression
+		default:
+			base.WarnfCtx(ctx, "Unable to apply reloaded startup config field %q", field)
+		}
+	}
+}
+
+// corsConfig returns the node's CORS config, which is nil if CORS isn't enabled.
+func (sc *ServerContext) corsConfig() *CORSConfig {
+	sc.reloadableConfigLock.RLock()
+	defer sc.reloadableConfigLock.RUnlock()
+	return sc.Config.API.CORS
+}
+
+// maxHeartbeat returns the upper limit on the heartbeat interval requested by changes feeds.
+func (sc *ServerContext) maxHeartbeat() time.Duration {
+	sc.reloadableConfigLock.RLock()
+	defer sc.reloadableConfigLock.RUnlock()
+	return sc.Config.Replicator.MaxHeartbeat.Value()
+}
+
+// blipCompression returns the configured BLIP compression level, nil if not set.
+func (sc *ServerContext) blipCompression() *int {
+	sc.reloadableConfigLock.RLock()
+	defer sc.reloadableConfigLock.RUnlock()
+	return sc.Config.Replicator.BLIPCompression
+}
+
+// isReloadableStartupConfigField returns true if the given field can be applied to a running node.
+func isReloadableStartupConfigField(field string) bool {
+	for _, reloadable := range reloadableStartupConfigFields {
+		if field == reloadable || strings.HasPrefix(field, reloadable+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// changedStartupConfigFields returns the sorted dotted paths of the fields that differ between the two configs.
+// Arrays are compared as a single field.
+func changedStartupConfigFields(previous, updated *StartupConfig) ([]string, error) {
+	previousFields, err := flattenStartupConfig(previous)
+	if err != nil {
+		return nil, err
+	}
+	updatedFields, err := flattenStartupConfig(updated)
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	for field, value := range updatedFields {
+		if !reflect.DeepEqual(previousFields[field], value) {
+			changed = append(changed, field)
+		}
+	}
+	for field := range previousFields {
+		if _, ok := updatedFields[field]; !ok {
+			changed = append(changed, field)
+		}
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// flattenStartupConfig returns the values of the fields set in the config, keyed by their dotted paths.
+func flattenStartupConfig(config *StartupConfig) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+	if config == nil {
+		return fields, nil
+	}
+	rawConfig, err := base.JSONMarshal(config)
+	if err != nil {
+		return nil, err
+	}
+	var configMap map[string]interface{}
+	if err := base.JSONUnmarshal(rawConfig, &configMap); err != nil {
+		return nil, err
+	}
+
+	var flatten func(prefix string, value interface{})
+	flatten = func(prefix string, value interface{}) {
+		if m, ok := value.(map[string]interface{}); ok {
+			for key, child := range m {
+				flatten(prefix+key+".", child)
+			}
+			return
+		}
+		fields[strings.TrimSuffix(prefix, ".")] = value
+	}
+	flatten("", configMap)
+	return fields, nil
+}
+
+var (
+	sighupHandlers     = map[*ServerContext]func(){}
+	sighupHandlersLock sync.Mutex
+)
+
+// registerSighupStartupConfigReload reloads the server context's startup config on SIGHUP, until the returned
+// function is called.
+func registerSighupStartupConfigReload(ctx context.Context, sc *ServerContext) (unregister func()) {
+	sighupHandlersLock.Lock()
+	defer sighupHandlersLock.Unlock()
+	sighupHandlers[sc] = func() {
+		if _, err := sc.ReloadStartupConfig(ctx); err != nil {
+			base.WarnfCtx(ctx, "Error reloading startup config: %v", err)
+		}
+	}
+	return func() {
+		sighupHandlersLock.Lock()
+		defer sighupHandlersLock.Unlock()
+		delete(sighupHandlers, sc)
+	}
+}
+
+// runSighupHandlers runs the handlers registered for SIGHUP.
+func runSighupHandlers() {
+	sighupHandlersLock.Lock()
+	defer sighupHandlersLock.Unlock()
+	for _, handler := range sighupHandlers {
+		handler()
+	}
+}
+
+// POST to re-read the startup config file, and apply the changed fields that can be applied to a running node.
+func (h *handler) handlePostReloadStartupConfig() error {
+	response, err := h.server.ReloadStartupConfig(h.ctx())
+	if err != nil {
+		return err
+	}
+	h.writeJSON(response)
+	return nil
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/couchbase/go-couchbase"
 	"github.com/couchbase/sync_gateway/auth"
 	"github.com/couchbase/sync_gateway/base"
+	"github.com/couchbase/sync_gateway/db"
 )
 
 const (
@@ -71,12 +72,15 @@ func DefaultStartupConfig(defaultLogFilePath string) StartupConfig {
 
 // StartupConfig is the config file used by Sync Gateway in 3.0+ to start up with node-specific settings, and then bootstrap databases via Couchbase Server.
 type StartupConfig struct {
-	Bootstrap   BootstrapConfig    `json:"bootstrap,omitempty"`
-	API         APIConfig          `json:"api,omitempty"`
-	Logging     base.LoggingConfig `json:"logging,omitempty"`
-	Auth        AuthConfig         `json:"auth,omitempty"`
-	Replicator  ReplicatorConfig   `json:"replicator,omitempty"`
-	Unsupported UnsupportedConfig  `json:"unsupported,omitempty"`
+	Bootstrap     BootstrapConfig     `json:"bootstrap,omitempty"`
+	API           APIConfig           `json:"api,omitempty"`
+	Logging       base.LoggingConfig  `json:"logging,omitempty"`
+	Auth          AuthConfig          `json:"auth,omitempty"`
+	Replicator    ReplicatorConfig    `json:"replicator,omitempty"`
+	Tracing       TracingConfig       `json:"tracing,omitempty"`
+	Profiling     ProfilingConfig     `json:"profiling,omitempty"`
+	MetricsExport MetricsExportConfig `json:"metrics_export,omitempty"`
+	Unsupported   UnsupportedConfig   `json:"unsupported,omitempty"`
 
 	DatabaseCredentials PerDatabaseCredentialsConfig    `json:"database_credentials,omitempty" help:"A map of database name to credentials, that can be used instead of the bootstrap ones. Cannot be used in conjunction with bucket_credentials."`
 	BucketCredentials   base.PerBucketCredentialsConfig `json:"bucket_credentials,omitempty" help:"A map of bucket names to credentials, that can be used instead of the bootstrap ones. Cannot be used in conjunction with database_credentials."`
@@ -99,6 +103,12 @@ type BootstrapConfig struct {
 	X509CertPath          string               `json:"x509_cert_path,omitempty"          help:"Cert path (public key) for X.509 bucket auth"`
 	X509KeyPath           string               `json:"x509_key_path,omitempty"           help:"Key path (private key) for X.509 bucket auth"`
 	UseTLSServer          *bool                `json:"use_tls_server,omitempty"          help:"Enforces a secure or non-secure server scheme"`
+	ConfigBuckets         []string             `json:"config_buckets,omitempty"          help:"Buckets to poll for database configs, instead of every bucket on the cluster"`
+	StartupRetryWindow    *base.ConfigDuration `json:"startup_retry_window,omitempty"    help:"How long to retry connecting to Couchbase Server and loading databases at startup, with exponential backoff. Default: 0 (no retries)"`
+
+	ConfigEncryption *ConfigEncryptionConfig `json:"config_encryption,omitempty" help:"Encryption of the secrets in database configs persisted to buckets"`
+
+	ConfigFileReferenceDirs []string `json:"config_file_reference_dirs,omitempty" help:"Directories that database configs can read files from using ${file:/path} references. Default: none"`
 }
 
 type APIConfig struct {
@@ -107,10 +117,14 @@ type APIConfig struct {
 	MetricsInterface string `json:"metrics_interface,omitempty" help:"Network interface to bind metrics API to"`
 	ProfileInterface string `json:"profile_interface,omitempty" help:"Network interface to bind profiling API to"`
 
+	MetricsHistogramBuckets []float64 `json:"metrics_histogram_buckets,omitempty" help:"Upper bounds, in seconds, of the buckets of latency histograms reported by the metrics API"`
+
 	AdminInterfaceAuthentication              *bool `json:"admin_interface_authentication,omitempty" help:"Whether the admin API requires authentication"`
 	MetricsInterfaceAuthentication            *bool `json:"metrics_interface_authentication,omitempty" help:"Whether the metrics API requires authentication"`
 	EnableAdminAuthenticationPermissionsCheck *bool `json:"enable_advanced_auth_dp,omitempty" help:"Whether to enable the DP permissions check feature of admin auth"`
 
+	AdminJWT *AdminJWTConfig `json:"admin_jwt,omitempty" help:"Signed JWTs accepted as bearer tokens by the admin and metrics APIs"`
+
 	ServerReadTimeout  *base.ConfigDuration `json:"server_read_timeout,omitempty"  help:"Maximum duration.Second before timing out read of the HTTP(S) request"`
 	ServerWriteTimeout *base.ConfigDuration `json:"server_write_timeout,omitempty" help:"Maximum duration.Second before timing out write of the HTTP(S) response"`
 	ReadHeaderTimeout  *base.ConfigDuration `json:"read_header_timeout,omitempty"  help:"The amount of time allowed to read request headers"`
@@ -125,10 +139,19 @@ type APIConfig struct {
 	CORS  *CORSConfig `json:"cors,omitempty"`
 }
 
+type AdminJWTConfig struct {
+	Issuer      string              `json:"issuer"                 help:"The issuer (iss claim) of accepted JWTs"`
+	Audience    string              `json:"audience"               help:"The audience (aud claim) accepted JWTs must include"`
+	JWKSURI     string              `json:"jwks_uri"               help:"The URI of the JSON Web Key Set used to verify JWT signatures"`
+	RolesClaim  string              `json:"roles_claim,omitempty"  help:"The claim containing admin roles, defaults to roles"`
+	RoleMapping map[string][]string `json:"role_mapping,omitempty" help:"Maps roles claim values to admin roles. When not set, claim values are used as admin roles"`
+}
+
 type HTTPSConfig struct {
 	TLSMinimumVersion string `json:"tls_minimum_version,omitempty" help:"The minimum allowable TLS version for the REST APIs"`
 	TLSCertPath       string `json:"tls_cert_path,omitempty"       help:"The TLS cert file to use for the REST APIs"`
 	TLSKeyPath        string `json:"tls_key_path,omitempty"        help:"The TLS key file to use for the REST APIs"`
+	ClientCACertPath  string `json:"client_ca_cert_path,omitempty" help:"The CA cert file used to verify TLS client certs presented to the public REST API"`
 }
 
 type CORSConfig struct {
@@ -143,10 +166,42 @@ type AuthConfig struct {
 }
 
 type ReplicatorConfig struct {
-	MaxHeartbeat    *base.ConfigDuration `json:"max_heartbeat,omitempty"    help:"Max heartbeat value for _changes request"`
-	BLIPCompression *int                 `json:"blip_compression,omitempty" help:"BLIP data compression level (0-9)"`
+	MaxHeartbeat    *base.ConfigDuration        `json:"max_heartbeat,omitempty"    help:"Max heartbeat value for _changes request"`
+	BLIPCompression *int                        `json:"blip_compression,omitempty" help:"BLIP data compression level (0-9)"`
+	ClientCerts     ReplicatorClientCertsConfig `json:"client_certs,omitempty"     help:"A map of names to TLS client certs, that inter-Sync Gateway replications can present to remotes"`
+}
+
+// TracingConfig configures the export of OpenTelemetry traces of requests, database operations and Couchbase Server
+// operations.
+type TracingConfig struct {
+	OTLPEndpoint string   `json:"otlp_endpoint,omitempty" help:"URL of the OTLP/HTTP collector to export traces to, such as http://localhost:4318. Tracing is disabled when not set"`
+	ServiceName  string   `json:"service_name,omitempty"  help:"Service name to export traces with. Default: sync_gateway"`
+	SampleRate   *float64 `json:"sample_rate,omitempty"   help:"Fraction of new traces to sample, between 0 and 1. Traces continued from a traceparent header follow the caller's sampling decision. Default: 1"`
 }
 
+// ProfilingConfig configures the background profiler, which periodically captures CPU and heap profiles to a bounded
+// number of files on disk, so that they're available for analysis after an incident.
+type ProfilingConfig struct {
+	Enabled     *bool                `json:"enabled,omitempty"      help:"Whether to periodically capture CPU and heap profiles"`
+	Directory   string               `json:"directory,omitempty"    help:"Directory to write profiles to. Default: the profiles directory in the log file path"`
+	Interval    *base.ConfigDuration `json:"interval,omitempty"     help:"How often to capture profiles. Default: 5m"`
+	CPUDuration *base.ConfigDuration `json:"cpu_duration,omitempty" help:"How long each CPU profile samples for. Default: 10s"`
+	MaxProfiles uint                 `json:"max_profiles,omitempty" help:"Number of the most recent profiles of each type to keep. Default: 24"`
+}
+
+// MetricsExportConfig configures periodically pushing stats to remote sinks, for environments where the metrics API
+// can't be scraped.  Each sink is used when its address is set.
+type MetricsExportConfig struct {
+	Interval               *base.ConfigDuration `json:"interval,omitempty"                 help:"How often to push stats. Default: 1m"`
+	StatsDAddress          string               `json:"statsd_address,omitempty"           help:"host:port of a StatsD server to push stats to over UDP, with labels as DogStatsD tags"`
+	CloudWatchAgentAddress string               `json:"cloudwatch_agent_address,omitempty" help:"host:port of the CloudWatch agent's Embedded Metric Format TCP listener to push stats to, such as 127.0.0.1:25888"`
+	CloudWatchNamespace    string               `json:"cloudwatch_namespace,omitempty"     help:"CloudWatch namespace to push stats to. Default: SyncGateway"`
+	OTLPEndpoint           string               `json:"otlp_endpoint,omitempty"            help:"URL of the OTLP/HTTP collector to push stats to, such as http://localhost:4318"`
+}
+
+// ReplicatorClientCertsConfig is a map of cert name to the TLS client cert that replications referencing it by name use.
+type ReplicatorClientCertsConfig map[string]db.ReplicationClientCertConfig
+
 type UnsupportedConfig struct {
 	StatsLogFrequency *base.ConfigDuration `json:"stats_log_frequency,omitempty"    help:"How often should stats be written to stats logs"`
 	UseStdlibJSON     *bool                `json:"use_stdlib_json,omitempty"        help:"Bypass the jsoniter package and use Go's stdlib instead"`
@@ -156,8 +211,9 @@ type UnsupportedConfig struct {
 }
 
 type ServerlessConfig struct {
-	Enabled                *bool                `json:"enabled,omitempty" help:"Enable Sync Gateway serverless mode."`
-	MinConfigFetchInterval *base.ConfigDuration `json:"min_config_fetch_interval,omitempty" help:"How long to cache configs fetched from the buckets for. This cache is used for requested databases that SG does not know about."`
+	Enabled                   *bool                `json:"enabled,omitempty" help:"Enable Sync Gateway serverless mode."`
+	MinConfigFetchInterval    *base.ConfigDuration `json:"min_config_fetch_interval,omitempty" help:"How long to cache configs fetched from the buckets for. This cache is used for requested databases that SG does not know about."`
+	MaxConnectionsPerDatabase uint                 `json:"max_connections_per_database,omitempty" help:"Max # of concurrent non-admin requests to each database - 0 for no limit"`
 }
 
 type HTTP2Config struct {
@@ -229,6 +285,7 @@ func NewEmptyStartupConfig() StartupConfig {
 			Debug:   &base.FileLoggerConfig{},
 			Trace:   &base.FileLoggerConfig{},
 			Stats:   &base.FileLoggerConfig{},
+			Audit:   &base.AuditLoggerConfig{},
 		},
 		Unsupported: UnsupportedConfig{
 			HTTP2: &HTTP2Config{},
@@ -259,6 +316,11 @@ func setGlobalConfig(sc *StartupConfig) error {
 		couchbase.SetTcpKeepalive(true, *sc.CouchbaseKeepaliveInterval)
 	}
 
+	// Histograms are created with the database stats, which aren't scoped to a ServerContext.
+	if err := base.SetLatencyHistogramBuckets(sc.API.MetricsHistogramBuckets); err != nil {
+		return err
+	}
+
 	// Given unscoped usage of base.JSON functions, this can't be scoped.
 	if base.BoolDefault(sc.Unsupported.UseStdlibJSON, false) {
 		base.InfofCtx(context.Background(), base.KeyAll, "Using the stdlib JSON package")
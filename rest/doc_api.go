@@ -24,6 +24,15 @@ import (
 )
 
 // HTTP handler for a GET of a document
+// canWriteRawDocJSON returns whether a document's marshalled body can be written to the response as-is, which requires
+// the response to be non-multipart JSON without pretty-printing.
+func (h *handler) canWriteRawDocJSON() bool {
+	if base.BoolDefault(h.server.Config.API.Pretty, false) {
+		return false
+	}
+	return h.requestAccepts("application/json")
+}
+
 func (h *handler) handleGetDoc() error {
 	docid := h.PathVar("docid")
 	revid := h.getQuery("rev")
@@ -67,7 +76,23 @@ func (h *handler) handleGetDoc() error {
 
 	if openRevs == "" {
 		// Single-revision GET:
-		value, err := h.db.Get1xRevBodyWithHistory(h.ctx(), docid, revid, revsLimit, revsFrom, attachmentsSince, showExp)
+		var value db.Body
+		var err error
+		if revid == "" && revsLimit == 0 && attachmentsSince == nil && !showExp && h.canWriteRawDocJSON() {
+			// GETs for the current revision without options can be served from the doc response cache, when enabled
+			var currentRevID string
+			var bodyBytes []byte
+			currentRevID, bodyBytes, err = h.db.GetCurrentRev1xBodyBytes(h.ctx(), docid)
+			if err == nil {
+				h.setEtag(currentRevID)
+				h.db.DbStats.Database().NumDocReadsRest.Add(1)
+				h.db.CollectionStats.NumDocReadsRest.Add(1)
+				h.writeRawJSON(bodyBytes)
+				return nil
+			}
+		} else {
+			value, err = h.db.Get1xRevBodyWithHistory(h.ctx(), docid, revid, revsLimit, revsFrom, attachmentsSince, showExp)
+		}
 		if err != nil {
 			if err == base.ErrImportCancelledPurged {
 				base.DebugfCtx(h.ctx(), base.KeyImport, fmt.Sprintf("Import cancelled as document %v is purged", base.UD(docid)))
@@ -89,6 +114,7 @@ func (h *handler) handleGetDoc() error {
 		h.setEtag(value[db.BodyRev].(string))
 
 		h.db.DbStats.Database().NumDocReadsRest.Add(1)
+		h.db.CollectionStats.NumDocReadsRest.Add(1)
 		hasBodies := attachmentsSince != nil && value[db.BodyAttachments] != nil
 		if h.requestAccepts("multipart/") && (hasBodies || !h.requestAccepts("application/json")) {
 			canCompress := strings.Contains(h.rq.Header.Get("X-Accept-Part-Encoding"), "gzip")
@@ -130,6 +156,7 @@ func (h *handler) handleGetDoc() error {
 					}
 					_ = WriteRevisionAsPart(h.ctx(), h.db.DatabaseContext.DbStats.CBLReplicationPull(), revBody, err != nil, false, writer)
 					h.db.DbStats.Database().NumDocReadsRest.Add(1)
+					h.db.CollectionStats.NumDocReadsRest.Add(1)
 				}
 				return nil
 			})
@@ -155,6 +182,7 @@ func (h *handler) handleGetDoc() error {
 			}
 			_, _ = h.response.Write([]byte(`]`))
 			h.db.DbStats.Database().NumDocReadsRest.Add(1)
+			h.db.CollectionStats.NumDocReadsRest.Add(1)
 		}
 	}
 	return nil
@@ -182,6 +210,7 @@ func (h *handler) handleGetDocReplicator2(docid, revid string) error {
 	h.setHeader("Content-Type", "application/json")
 	_, _ = h.response.Write(bodyBytes)
 	h.db.DbStats.Database().NumDocReadsRest.Add(1)
+	h.db.CollectionStats.NumDocReadsRest.Add(1)
 
 	return nil
 }
@@ -20,6 +20,7 @@ import (
 	"math"
 	"mime"
 	"mime/multipart"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
@@ -97,12 +98,16 @@ type handler struct {
 	startTime             time.Time
 	serialNumber          uint64
 	formattedSerialNumber string
+	requestCorrelationID  string // Correlation ID from the request's X-Correlation-ID header, if it's valid
 	loggedDuration        bool
+	longRunning           bool // Set for feeds and connections that are expected to outlast the slow request threshold
 	runOffline            bool
 	queryValues           url.Values // Copy of results of rq.URL.Query()
 	permissionsResults    map[string]bool
 	authScopeFunc         authScopeFunc
+	authenticationOnly    bool // If true, admin requests only need to be authenticated, rather than authorized
 	rqCtx                 context.Context
+	span                  *base.Span // Traces the request, nil when tracing is disabled or the trace isn't sampled
 }
 
 type authScopeFunc func(bodyJSON []byte) (string, error)
@@ -126,6 +131,8 @@ func makeHandler(server *ServerContext, privs handlerPrivs, accessPermissions []
 		err := h.invoke(method, accessPermissions, responsePermissions)
 		h.writeError(err)
 		h.logDuration(true)
+		h.endSpan()
+		h.auditAdminMutation()
 	})
 }
 
@@ -137,6 +144,8 @@ func makeOfflineHandler(server *ServerContext, privs handlerPrivs, accessPermiss
 		err := h.invoke(method, accessPermissions, responsePermissions)
 		h.writeError(err)
 		h.logDuration(true)
+		h.endSpan()
+		h.auditAdminMutation()
 	})
 }
 
@@ -150,6 +159,23 @@ func makeHandlerSpecificAuthScope(server *ServerContext, privs handlerPrivs, acc
 		err := h.invoke(method, accessPermissions, responsePermissions)
 		h.writeError(err)
 		h.logDuration(true)
+		h.endSpan()
+		h.auditAdminMutation()
+	})
+}
+
+// Creates an http.Handler for an admin API endpoint that any authenticated admin user can call, regardless of their
+// roles and permissions.
+func makeAuthenticationOnlyHandler(server *ServerContext, privs handlerPrivs, method handlerMethod) http.Handler {
+	return http.HandlerFunc(func(r http.ResponseWriter, rq *http.Request) {
+		runOffline := false
+		h := newHandler(server, privs, r, rq, runOffline)
+		h.authenticationOnly = true
+		err := h.invoke(method, nil, nil)
+		h.writeError(err)
+		h.logDuration(true)
+		h.endSpan()
+		h.auditAdminMutation()
 	})
 }
 
@@ -165,16 +191,81 @@ func newHandler(server *ServerContext, privs handlerPrivs, r http.ResponseWriter
 		runOffline:   runOffline,
 	}
 
+	// Use the caller's correlation ID in the request's logs, and return the ID that was used
+	if id := rq.Header.Get(base.CorrelationIDHeader); base.IsValidCorrelationID(id) {
+		h.requestCorrelationID = id
+	}
+	r.Header().Set(base.CorrelationIDHeader, h.correlationID())
+
 	// initialize h.rqCtx
 	_ = h.ctx()
 
+	// Continue the caller's trace when the request has a traceparent header.  Spans are named after the route rather
+	// than the resource, so that the spans of an endpoint can be aggregated.
+	spanName := rq.Method
+	routeTemplate := h.routeTemplate()
+	if routeTemplate != "" {
+		spanName += " " + routeTemplate
+	}
+	h.rqCtx, h.span = base.StartServerSpan(h.rqCtx, spanName, rq.Header.Get(base.TraceparentHeader))
+	h.span.SetAttribute("http.method", rq.Method)
+	h.span.SetAttribute("sg.correlation_id", h.correlationID())
+	if routeTemplate != "" {
+		h.span.SetAttribute("http.route", routeTemplate)
+	}
+
 	return h
 }
 
+// routeTemplate returns the path template of the route matching the request, or an empty string if none matched.
+func (h *handler) routeTemplate() string {
+	if route := mux.CurrentRoute(h.rq); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return ""
+}
+
+// endSpan ends the request's span, marking it as failed for server errors.
+func (h *handler) endSpan() {
+	h.span.SetAttribute("http.status_code", h.status)
+	var err error
+	if h.status >= http.StatusInternalServerError {
+		err = fmt.Errorf("%d %s", h.status, h.statusMessage)
+	}
+	h.span.End(err)
+}
+
+// auditAdminMutation records completed requests to the admin API that may have changed something in the audit log.
+func (h *handler) auditAdminMutation() {
+	if h.privs != adminPrivs || !base.AuditEnabled(base.AuditEventAdminAPIMutation) {
+		return
+	}
+	switch h.rq.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return
+	}
+	h.audit(base.AuditEventAdminAPIMutation, h.authorizedAdminUser, h.status)
+}
+
+// audit records the event in the audit log, for the request and the given user and response status.
+func (h *handler) audit(event base.AuditEvent, username string, status int) {
+	base.Audit(event, base.AuditFields{
+		User:          username,
+		SourceIP:      h.clientIP(),
+		Database:      h.PathVar("db"),
+		Method:        h.rq.Method,
+		Path:          h.rq.URL.Path,
+		Status:        status,
+		CorrelationID: h.correlationID(),
+	})
+}
+
 // ctx returns the request-scoped context for logging/cancellation.
 func (h *handler) ctx() context.Context {
 	if h.rqCtx == nil {
-		h.rqCtx = base.LogContextWith(h.rq.Context(), &base.LogContext{CorrelationID: h.formatSerialNumber()})
+		h.rqCtx = base.LogContextWith(h.rq.Context(), &base.LogContext{CorrelationID: h.correlationID()})
 	}
 	return h.rqCtx
 }
@@ -182,6 +273,7 @@ func (h *handler) ctx() context.Context {
 func (h *handler) addDatabaseLogContext(dbName string) {
 	if dbName != "" {
 		h.rqCtx = base.LogContextWith(h.ctx(), &base.DatabaseLogContext{DatabaseName: dbName})
+		h.span.SetAttribute("db.name", dbName)
 	}
 }
 
@@ -288,6 +380,11 @@ func (h *handler) invoke(method handlerMethod, accessPermissions []Permission, r
 		}
 	}
 
+	// Count the clients of the public API.  Websocket requests are counted by their handlers once upgraded.
+	if dbContext != nil && (h.privs == regularPrivs || h.privs == publicPrivs) && !strings.EqualFold(h.rq.Header.Get("Upgrade"), "websocket") {
+		dbContext.ClientTelemetry.RecordRequest(h.rq.UserAgent())
+	}
+
 	// If this call is in the context of a DB make sure the DB is in a valid state
 	if dbContext != nil {
 		// Named collections handling
@@ -343,6 +440,29 @@ func (h *handler) invoke(method handlerMethod, accessPermissions []Permission, r
 				// DB is in transition state, no calls will be accepted until it is Online or Offline state
 				return base.HTTPErrorf(http.StatusServiceUnavailable, fmt.Sprintf("DB is %v - try again later", db.RunStateString[dbState]))
 			}
+
+			// Shed load while the database's estimated memory usage is high, other than on the admin API, so that the
+			// database can still be managed
+			if h.privs != adminPrivs {
+				release, err := dbContext.MemoryAccountant.AdmitRequest(h.rq.ContentLength)
+				if err != nil {
+					var admissionErr *db.MemoryAdmissionError
+					if errors.As(err, &admissionErr) {
+						h.setHeader("Retry-After", strconv.Itoa(int(math.Ceil(admissionErr.RetryAfter.Seconds()))))
+					}
+					base.InfofCtx(h.ctx(), base.KeyHTTP, "Rejected request: %v", err)
+					return base.HTTPErrorf(http.StatusServiceUnavailable, err.Error())
+				}
+				defer release()
+
+				// In serverless mode, cap each tenant's concurrent requests so one database can't starve the others
+				releaseConnection, err := dbContext.TenantUsage.AdmitConnection()
+				if err != nil {
+					base.InfofCtx(h.ctx(), base.KeyHTTP, "Rejected request: %v", err)
+					return err
+				}
+				defer releaseConnection()
+			}
 		}
 	}
 
@@ -373,7 +493,29 @@ func (h *handler) invoke(method handlerMethod, accessPermissions []Permission, r
 		}
 	}
 
-	if shouldCheckAdminAuth {
+	// Requests to the admin and metrics APIs can authenticate with a JWT when api.admin_jwt is configured
+	adminJWT := ""
+	if shouldCheckAdminAuth && h.server.adminJWTVerifier != nil {
+		adminJWT = h.getBearerToken()
+	}
+
+	if shouldCheckAdminAuth && h.authenticationOnly {
+		authorized, err := h.checkAdminAuthenticationOnly()
+		if err != nil {
+			return err
+		}
+		if !authorized {
+			return base.HTTPErrorf(http.StatusUnauthorized, "")
+		}
+	} else if adminJWT != "" {
+		authScope, err := h.getAdminAuthScope(dbContext)
+		if err != nil {
+			return err
+		}
+		if err := h.checkAdminJWTAuth(adminJWT, authScope, dbContext, accessPermissions, responsePermissions); err != nil {
+			return err
+		}
+	} else if shouldCheckAdminAuth {
 		// If server is walrus but auth is enabled we should just kick the user out as invalid as we have nothing to
 		// validate credentials against
 		if base.ServerIsWalrus(h.server.Config.Bootstrap.Server) {
@@ -391,35 +533,20 @@ func (h *handler) invoke(method handlerMethod, accessPermissions []Permission, r
 
 		var managementEndpoints []string
 		var httpClient *http.Client
-		var authScope string
 
 		if dbContext != nil {
 			managementEndpoints, httpClient, err = dbContext.ObtainManagementEndpointsAndHTTPClient(h.ctx())
-			authScope = dbContext.Bucket.GetName()
 		} else {
 			managementEndpoints, httpClient, err = h.server.ObtainManagementEndpointsAndHTTPClient()
-			authScope = ""
 		}
 		if err != nil {
 			base.WarnfCtx(h.ctx(), "An error occurred whilst obtaining management endpoints: %v", err)
 			return base.HTTPErrorf(http.StatusInternalServerError, "")
 		}
 
-		if h.authScopeFunc != nil {
-			body, err := h.readBody()
-			if err != nil {
-				return base.HTTPErrorf(http.StatusInternalServerError, "Unable to read body: %v", err)
-			}
-			// The above readBody() will end up clearing the body which the later handler will require. Re-populate this
-			// for the later handler.
-			h.requestBody = ioutil.NopCloser(bytes.NewReader(body))
-			authScope, err = h.authScopeFunc(body)
-			if err != nil {
-				return base.HTTPErrorf(http.StatusInternalServerError, "Unable to read body: %v", err)
-			}
-			if authScope == "" {
-				return base.HTTPErrorf(http.StatusBadRequest, "Unable to determine auth scope for endpoint")
-			}
+		authScope, err := h.getAdminAuthScope(dbContext)
+		if err != nil {
+			return err
 		}
 
 		permissions, statusCode, err := checkAdminAuth(authScope, username, password, h.rq.Method, httpClient,
@@ -430,13 +557,34 @@ func (h *handler) invoke(method handlerMethod, accessPermissions []Permission, r
 			return base.HTTPErrorf(http.StatusInternalServerError, "")
 		}
 
+		// Users without the required roles or permissions may still be granted the request's action by the
+		// database's admin_role_actions
+		if statusCode == http.StatusForbidden && adminRequestAction(accessPermissions, h.rq) != "" {
+			rolesStatusCode, roles, err := getAdminRoles(httpClient, managementEndpoints, username, password)
+			if err != nil {
+				base.WarnfCtx(h.ctx(), "An error occurred whilst obtaining the roles of a user: %v", err)
+				return base.HTTPErrorf(http.StatusInternalServerError, "")
+			}
+			if rolesStatusCode == http.StatusOK && h.checkAdminRoleAction(dbContext, accessPermissions, roles) {
+				statusCode = http.StatusOK
+				// Only the response permissions covered by the granted actions are granted, in addition to any the
+				// user holds directly
+				if permissions == nil {
+					permissions = make(map[string]bool, len(responsePermissions))
+				}
+				grantAdminActionPermissions(permissions, h.requestAdminActions(dbContext, roles), responsePermissions)
+			}
+		}
+
 		if statusCode != http.StatusOK {
 			base.InfofCtx(h.ctx(), base.KeyAuth, "%s: User %s failed to auth as an admin statusCode: %d", h.formatSerialNumber(), base.UD(username), statusCode)
+			h.audit(base.AuditEventAdminAuthenticationFailed, username, statusCode)
 			return base.HTTPErrorf(statusCode, "")
 		}
 
 		h.authorizedAdminUser = username
 		h.permissionsResults = permissions
+		h.audit(base.AuditEventAdminAuthenticationSucceeded, username, http.StatusOK)
 
 		base.InfofCtx(h.ctx(), base.KeyAuth, "%s: User %s was successfully authorized as an admin", h.formatSerialNumber(), base.UD(username))
 	} else {
@@ -500,6 +648,13 @@ func (h *handler) logDuration(realTime bool) {
 		h.formatSerialNumber(), h.status, h.statusMessage,
 		float64(duration)/float64(time.Millisecond),
 	)
+
+	if realTime && h.db != nil && !h.longRunning {
+		h.db.CheckSlowRequest(h.ctx(), duration, func() string {
+			queryValues := h.getQueryValues()
+			return fmt.Sprintf("%s %s %s --> %d", h.formatSerialNumber(), h.rq.Method, base.SanitizeRequestURL(h.rq, &queryValues), h.status)
+		})
+	}
 }
 
 // logStatusWithDuration will log the request status and the duration of the request.
@@ -534,7 +689,7 @@ func (h *handler) checkAuth(dbCtx *db.DatabaseContext) (err error) {
 		} else {
 			dbCtx.DbStats.Security().AuthSuccessCount.Add(1)
 		}
-
+		h.auditAuthentication(err)
 	}(time.Now())
 
 	// If oidc enabled, check for bearer ID token
@@ -578,10 +733,21 @@ func (h *handler) checkAuth(dbCtx *db.DatabaseContext) (err error) {
 		}
 	}
 
+	// Check for a verified TLS client cert
+	if dbCtx.ClientCertMapper != nil && h.rq.TLS != nil && len(h.rq.TLS.VerifiedChains) > 0 {
+		h.user, err = dbCtx.Authenticator(h.ctx()).AuthenticateClientCert(dbCtx.ClientCertMapper, h.rq.TLS.VerifiedChains[0][0])
+		if err != nil {
+			return err
+		}
+		if h.user != nil {
+			return nil
+		}
+	}
+
 	// Check basic auth first
 	if !dbCtx.Options.DisablePasswordAuthentication {
 		if userName, password := h.getBasicAuth(); userName != "" {
-			h.user, err = dbCtx.Authenticator(h.ctx()).AuthenticateUser(userName, password)
+			h.user, err = h.authenticatePassword(dbCtx, userName, password)
 			if err != nil {
 				return err
 			}
@@ -618,6 +784,89 @@ func (h *handler) checkAuth(dbCtx *db.DatabaseContext) (err error) {
 	return nil
 }
 
+// auditAuthentication records the result of authenticating a request with a database in the audit log.  Requests that
+// fall back to guest access aren't recorded, unless they failed.
+func (h *handler) auditAuthentication(err error) {
+	if err != nil {
+		if base.AuditEnabled(base.AuditEventAuthenticationFailed) {
+			username, _ := h.getBasicAuth()
+			status, _ := base.ErrorAsHTTPStatus(err)
+			h.audit(base.AuditEventAuthenticationFailed, username, status)
+		}
+		return
+	}
+	if h.user != nil && h.user.Name() != "" && base.AuditEnabled(base.AuditEventAuthenticationSucceeded) {
+		h.audit(base.AuditEventAuthenticationSucceeded, h.user.Name(), http.StatusOK)
+	}
+}
+
+// authenticatePassword verifies a user's password, falling back to the database's LDAP directory if configured.
+// Returns a nil user if the credentials aren't valid.  When the database has a login throttle, attempts for users or
+// source IPs that are backing off or locked out are rejected with a 429 without checking the password.
+func (h *handler) authenticatePassword(dbCtx *db.DatabaseContext, username, password string) (auth.User, error) {
+	throttle := dbCtx.LoginThrottle
+	sourceIP := h.clientIP()
+	if throttle != nil {
+		if err := throttle.CheckLogin(username, sourceIP); err != nil {
+			dbCtx.DbStats.Security().AuthThrottledCount.Add(1)
+			base.InfofCtx(h.ctx(), base.KeyAuth, "Rejected login for username=%q: %v", base.UD(username), err)
+			var throttledErr *auth.LoginThrottledError
+			if errors.As(err, &throttledErr) {
+				h.setHeader("Retry-After", strconv.Itoa(int(math.Ceil(throttledErr.RetryAfter.Seconds()))))
+			}
+			return nil, base.HTTPErrorf(http.StatusTooManyRequests, "Too many failed login attempts")
+		}
+	}
+
+	user, err := dbCtx.Authenticator(h.ctx()).AuthenticateUser(username, password)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil && dbCtx.LDAPProvider != nil {
+		user, err = authenticateLDAPUser(h.ctx(), dbCtx, username, password)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if throttle != nil {
+		if user != nil {
+			throttle.RecordSuccess(username)
+		} else if throttle.RecordFailure(username, sourceIP) {
+			dbCtx.DbStats.Security().AuthLockoutCount.Add(1)
+			base.WarnfCtx(h.ctx(), "Too many failed logins for username=%q or its source address - locking out further attempts", base.UD(username))
+		}
+	}
+	return user, nil
+}
+
+// clientIP returns the IP address the request was received from, without the port.
+func (h *handler) clientIP() string {
+	host, _, err := net.SplitHostPort(h.rq.RemoteAddr)
+	if err != nil {
+		return h.rq.RemoteAddr
+	}
+	return host
+}
+
+// authenticateLDAPUser verifies the given credentials against the database's LDAP directory, and updates the user's
+// roles from their directory groups.  Returns a nil user if the credentials aren't valid.  Errors querying the
+// directory are logged and treated as invalid credentials.
+func authenticateLDAPUser(ctx context.Context, dbCtx *db.DatabaseContext, username, password string) (auth.User, error) {
+	user, updates, err := dbCtx.Authenticator(ctx).AuthenticateLDAP(dbCtx.LDAPProvider, username, password)
+	if err != nil {
+		base.WarnfCtx(ctx, "Error authenticating user %q with LDAP: %v", base.UD(username), err)
+		return nil, nil
+	}
+	if user == nil {
+		return nil, nil
+	}
+	if _, err := dbCtx.UpdatePrincipal(ctx, &updates, true, true); err != nil {
+		return nil, fmt.Errorf("failed to update LDAP user after sign-in: %w", err)
+	}
+	return dbCtx.Authenticator(ctx).GetUser(user.Name())
+}
+
 func checkJWTIssuerStillValid(ctx context.Context, dbCtx *db.DatabaseContext, user auth.User) *auth.PrincipalConfig {
 	issuer := user.JWTIssuer()
 	if issuer == "" {
@@ -637,6 +886,9 @@ func checkJWTIssuerStillValid(ctx context.Context, dbCtx *db.DatabaseContext, us
 			break
 		}
 	}
+	if dbCtx.LDAPProvider != nil && dbCtx.LDAPProvider.Issuer() == issuer {
+		providerStillValid = true
+	}
 	if !providerStillValid {
 		base.InfofCtx(ctx, base.KeyAuth, "User %v uses OIDC issuer %v which is no longer configured. Revoking OIDC roles/channels.", base.UD(user.Name()), base.UD(issuer))
 		return &auth.PrincipalConfig{
@@ -649,9 +901,45 @@ func checkJWTIssuerStillValid(ctx context.Context, dbCtx *db.DatabaseContext, us
 	return nil
 }
 
+// getAdminAuthScope returns the bucket that admin auth is checked against for the request - the bucket of the
+// request's database, the bucket determined by the handler's authScopeFunc, or empty for cluster scoped requests.
+func (h *handler) getAdminAuthScope(dbContext *db.DatabaseContext) (authScope string, err error) {
+	if dbContext != nil {
+		authScope = dbContext.Bucket.GetName()
+	}
+
+	if h.authScopeFunc != nil {
+		body, err := h.readBody()
+		if err != nil {
+			return "", base.HTTPErrorf(http.StatusInternalServerError, "Unable to read body: %v", err)
+		}
+		// The above readBody() will end up clearing the body which the later handler will require. Re-populate this
+		// for the later handler.
+		h.requestBody = ioutil.NopCloser(bytes.NewReader(body))
+		authScope, err = h.authScopeFunc(body)
+		if err != nil {
+			return "", base.HTTPErrorf(http.StatusInternalServerError, "Unable to read body: %v", err)
+		}
+		if authScope == "" {
+			return "", base.HTTPErrorf(http.StatusBadRequest, "Unable to determine auth scope for endpoint")
+		}
+	}
+	return authScope, nil
+}
+
 // checkAdminAuthenticationOnly simply checks whether a username / password combination is authenticated pulling the
-// credentials from the handler
+// credentials from the handler.  JWTs are only authenticated when they grant at least one admin role, or a role that
+// admin_role_actions grants actions to.
 func (h *handler) checkAdminAuthenticationOnly() (bool, error) {
+	if token := h.getBearerToken(); token != "" && h.server.adminJWTVerifier != nil {
+		_, roles, err := h.server.verifyAdminJWT(h.ctx(), token)
+		if err != nil {
+			return false, nil
+		}
+		adminRoles := parseAdminRoles(roles)
+		return hasAnyAdminRole(adminRoles) || h.hasAnyAdminRoleAction(adminRoles), nil
+	}
+
 	managementEndpoints, httpClient, err := h.server.ObtainManagementEndpointsAndHTTPClient()
 	if err != nil {
 		return false, base.HTTPErrorf(http.StatusInternalServerError, "Error getting management endpoints: %v", err)
@@ -712,17 +1000,7 @@ func checkAdminAuth(bucketName, basicAuthUsername, basicAuthPassword string, att
 		}
 	}
 
-	var requestRoles []RouteRole
-	if bucketName != "" {
-		requestRoles = BucketScopedEndpointRoles
-	} else {
-		if attemptedHTTPOperation == http.MethodGet || attemptedHTTPOperation == http.MethodHead || attemptedHTTPOperation == http.MethodOptions {
-			requestRoles = ClusterScopedEndpointRolesRead
-		} else {
-			requestRoles = ClusterScopedEndpointRolesWrite
-		}
-	}
-
+	requestRoles := adminRequestRoles(bucketName, attemptedHTTPOperation)
 	rolesStatusCode, err := CheckRoles(httpClient, managementEndpoints, basicAuthUsername, basicAuthPassword, requestRoles, bucketName)
 	if err != nil {
 		return nil, http.StatusInternalServerError, err
@@ -755,6 +1033,17 @@ func checkAdminAuth(bucketName, basicAuthUsername, basicAuthPassword string, att
 	return permResults, resultStatusCode, nil
 }
 
+// adminRequestRoles returns the roles that grant access to an admin request for the given bucket and HTTP operation.
+func adminRequestRoles(bucketName string, attemptedHTTPOperation string) []RouteRole {
+	if bucketName != "" {
+		return BucketScopedEndpointRoles
+	}
+	if attemptedHTTPOperation == http.MethodGet || attemptedHTTPOperation == http.MethodHead || attemptedHTTPOperation == http.MethodOptions {
+		return ClusterScopedEndpointRolesRead
+	}
+	return ClusterScopedEndpointRolesWrite
+}
+
 func (h *handler) assertAdminOnly() {
 	if h.privs != adminPrivs {
 		// TODO: CBG-1948
@@ -1214,7 +1503,7 @@ func (h *handler) flush() {
 func (h *handler) writeError(err error) {
 	if err != nil {
 		status, message := base.ErrorAsHTTPStatus(err)
-		h.writeStatus(status, message)
+		h.writeStatusWithRejection(status, message, base.SyncFnRejectionReasonFromError(err))
 		if status >= 500 {
 			// Log additional context when the handler has a database reference
 			if h.db != nil {
@@ -1228,6 +1517,12 @@ func (h *handler) writeError(err error) {
 
 // Writes the response status code, and if it's an error writes a JSON description to the body.
 func (h *handler) writeStatus(status int, message string) {
+	h.writeStatusWithRejection(status, message, nil)
+}
+
+// Like writeStatus, but also includes the machine-readable reason for a sync function rejection (if any) in the
+// JSON description of an error.
+func (h *handler) writeStatusWithRejection(status int, message string, rejection *base.SyncFnRejectionReason) {
 	if status < 300 {
 		h.response.WriteHeader(status)
 		h.setStatus(status, message)
@@ -1252,7 +1547,13 @@ func (h *handler) writeStatus(status int, message string) {
 	h.response.WriteHeader(status)
 	h.setStatus(status, message)
 
-	_, _ = h.response.Write([]byte(`{"error":"` + errorStr + `","reason":` + base.ConvertToJSONString(message) + `}`))
+	body := `{"error":"` + errorStr + `","reason":` + base.ConvertToJSONString(message)
+	if rejection != nil {
+		if rejectionJSON, err := base.JSONMarshal(rejection); err == nil {
+			body += `,"rejection":` + string(rejectionJSON)
+		}
+	}
+	_, _ = h.response.Write([]byte(body + `}`))
 }
 
 var kRangeRegex = regexp.MustCompile("^bytes=(\\d+)?-(\\d+)?$")
@@ -1357,6 +1658,15 @@ func (h *handler) formatSerialNumber() string {
 	return h.formattedSerialNumber
 }
 
+// correlationID returns the ID that correlates the request's logs: the caller's X-Correlation-ID when given, otherwise
+// the request's serial number.
+func (h *handler) correlationID() string {
+	if h.requestCorrelationID != "" {
+		return h.requestCorrelationID
+	}
+	return h.formatSerialNumber()
+}
+
 // shouldShowProductVersion returns whether the handler should show detailed product info (version).
 // Admin requests can always see this, regardless of the HideProductVersion setting.
 func (h *handler) shouldShowProductVersion() bool {
@@ -49,7 +49,7 @@ func (h *handler) mutateDbConfig(mutator func(*DbConfig) error) error {
 		var updatedDbConfig *DatabaseConfig
 		cas, err := h.server.BootstrapContext.Connection.UpdateConfig(
 			bucket, h.server.Config.Bootstrap.ConfigGroupID,
-			func(rawBucketConfig []byte) (newConfig []byte, err error) {
+			recordDatabaseConfigHistory(func(rawBucketConfig []byte) (newConfig []byte, err error) {
 				var bucketDbConfig DatabaseConfig
 				if err := base.JSONUnmarshal(rawBucketConfig, &bucketDbConfig); err != nil {
 					return nil, err
@@ -75,7 +75,7 @@ func (h *handler) mutateDbConfig(mutator func(*DbConfig) error) error {
 
 				updatedDbConfig = &bucketDbConfig
 				return base.JSONMarshal(bucketDbConfig)
-			})
+			}))
 		if err != nil {
 			return err
 		}
@@ -101,3 +101,118 @@ func (h *handler) mutateDbConfig(mutator func(*DbConfig) error) error {
 		return base.HTTPErrorf(http.StatusServiceUnavailable, "Unavailable")
 	}
 }
+
+// DatabaseConfigHistoryResponse is the response to a request for a database config's history.
+type DatabaseConfigHistoryResponse struct {
+	Version string                   `json:"version"` // Version of the current config
+	History []DatabaseConfigRevision `json:"history"` // Previous revisions of the config, most recent first
+}
+
+// GET the previous revisions of the database config, which can be rolled back to.
+func (h *handler) handleGetDbConfigHistory() error {
+	h.assertAdminOnly()
+
+	if !h.server.persistentConfig {
+		return base.HTTPErrorf(http.StatusBadRequest, "endpoint only supports persistent config mode")
+	}
+
+	found, dbConfig, err := h.server.fetchDatabase(h.ctx(), h.db.Name)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return base.HTTPErrorf(http.StatusNotFound, "database config not found")
+	}
+
+	response := DatabaseConfigHistoryResponse{
+		Version: dbConfig.Version,
+		History: make([]DatabaseConfigRevision, 0, len(dbConfig.History)),
+	}
+	for _, revision := range dbConfig.History {
+		redactedConfig, err := revision.Config.Redacted()
+		if err != nil {
+			return err
+		}
+		revision.Config = *redactedConfig
+		response.History = append(response.History, revision)
+	}
+
+	h.setEtag(dbConfig.Version)
+	h.writeJSON(response)
+	return nil
+}
+
+// POST to roll the database config back to a previous revision in its history.  The rollback is applied as a new
+// revision, so can itself be rolled back.
+func (h *handler) handlePostDbConfigRollback() error {
+	h.assertAdminOnly()
+
+	if !h.server.persistentConfig {
+		return base.HTTPErrorf(http.StatusBadRequest, "endpoint only supports persistent config mode")
+	}
+
+	version := h.PathVar("version")
+	validateOIDC := !h.getBoolQuery(paramDisableOIDCValidation)
+	bucket := h.db.Bucket.GetName()
+
+	var updatedDbConfig *DatabaseConfig
+	cas, err := h.server.BootstrapContext.Connection.UpdateConfig(
+		bucket, h.server.Config.Bootstrap.ConfigGroupID,
+		recordDatabaseConfigHistory(func(rawBucketConfig []byte) (newConfig []byte, err error) {
+			var bucketDbConfig DatabaseConfig
+			if err := base.JSONUnmarshal(rawBucketConfig, &bucketDbConfig); err != nil {
+				return nil, err
+			}
+
+			if h.headerDoesNotMatchEtag(bucketDbConfig.Version) {
+				return nil, base.HTTPErrorf(http.StatusPreconditionFailed, "Provided If-Match header does not match current config version")
+			}
+
+			var revision *DatabaseConfigRevision
+			for i := range bucketDbConfig.History {
+				if bucketDbConfig.History[i].Version == version {
+					revision = &bucketDbConfig.History[i]
+					break
+				}
+			}
+			if revision == nil {
+				return nil, base.HTTPErrorf(http.StatusNotFound, "config version %q not found in the database's config history", version)
+			}
+
+			oldBucketDbConfig := bucketDbConfig.DbConfig
+			bucketDbConfig.DbConfig = revision.Config
+			if err := bucketDbConfig.validateConfigUpdate(h.ctx(), oldBucketDbConfig, validateOIDC); err != nil {
+				return nil, base.HTTPErrorf(http.StatusBadRequest, err.Error())
+			}
+
+			bucketDbConfig.Version, err = GenerateDatabaseConfigVersionID(bucketDbConfig.Version, &bucketDbConfig.DbConfig)
+			if err != nil {
+				return nil, err
+			}
+
+			bucketDbConfig.SGVersion = base.ProductVersion.String()
+
+			updatedDbConfig = &bucketDbConfig
+			return base.JSONMarshal(bucketDbConfig)
+		}))
+	if err != nil {
+		return err
+	}
+	updatedDbConfig.cas = cas
+
+	dbName := h.db.Name
+	dbCreds := h.server.Config.DatabaseCredentials[dbName]
+	bucketCreds := h.server.Config.BucketCredentials[bucket]
+	if err := updatedDbConfig.setup(dbName, h.server.Config.Bootstrap, dbCreds, bucketCreds, h.server.Config.IsServerless()); err != nil {
+		return err
+	}
+
+	h.server.lock.Lock()
+	defer h.server.lock.Unlock()
+
+	if err := h.server._reloadDatabaseWithConfig(h.ctx(), *updatedDbConfig, false); err != nil {
+		return err
+	}
+	h.setEtag(updatedDbConfig.Version)
+	return base.HTTPErrorf(http.StatusOK, "rolled back")
+}
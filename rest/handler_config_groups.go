@@ -0,0 +1,189 @@
+// Copyright 2022-Present Couchbase, Inc.
+//
+// Use of this software is governed by the Business Source License included
+// in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+// in that file, in accordance with the Business Source License, use of this
+// software will be governed by the Apache License, Version 2.0, included in
+// the file licenses/APL2.txt.
+
+package rest
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/couchbase/sync_gateway/base"
+)
+
+// Results of copying a database config between config groups
+const (
+	configGroupCopyStatusCopied   = "copied"   // The config was copied to the target group
+	configGroupCopyStatusReplaced = "replaced" // The config replaced an existing config in the target group
+	configGroupCopyStatusSkipped  = "skipped"  // The target group already had a config, which wasn't overwritten
+	configGroupCopyStatusFailed   = "failed"   // The config couldn't be copied
+)
+
+// ConfigGroupDatabase is a database config found in a config group.
+type ConfigGroupDatabase struct {
+	Bucket    string `json:"bucket"`
+	Name      string `json:"name"`
+	Version   string `json:"version,omitempty"`
+	SGVersion string `json:"sg_version,omitempty"` // Version of the Sync Gateway node that saved the config
+}
+
+// ConfigGroupsResponse is the response to a request for the config groups in the cluster.
+type ConfigGroupsResponse struct {
+	Groups map[string][]ConfigGroupDatabase `json:"groups"`           // Databases in each config group, keyed by group ID
+	Errors map[string]string                `json:"errors,omitempty"` // Buckets that couldn't be searched for config groups
+}
+
+// ConfigGroupCopyResult is the result of copying a single database config between config groups.
+type ConfigGroupCopyResult struct {
+	Bucket string `json:"bucket"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ConfigGroupCopyResponse is the response to a request to copy database configs between config groups.
+type ConfigGroupCopyResponse struct {
+	DryRun    bool                    `json:"dry_run"`
+	Databases []ConfigGroupCopyResult `json:"databases"`
+}
+
+// GET the config groups that have database configs in the cluster's buckets, and the databases in each, so that the
+// databases of different groups can be compared.
+func (h *handler) handleGetConfigGroups() error {
+	if !h.server.persistentConfig {
+		return base.HTTPErrorf(http.StatusBadRequest, "endpoint only supports persistent config mode")
+	}
+
+	buckets, err := h.server.bootstrapBuckets()
+	if err != nil {
+		return err
+	}
+
+	response := ConfigGroupsResponse{Groups: make(map[string][]ConfigGroupDatabase)}
+	for _, bucket := range buckets {
+		groupIDs, err := h.server.BootstrapContext.Connection.GetConfigGroupIDs(bucket)
+		if err != nil {
+			base.InfofCtx(h.ctx(), base.KeyConfig, "Unable to find config groups in bucket %q: %v", base.MD(bucket), err)
+			if response.Errors == nil {
+				response.Errors = make(map[string]string)
+			}
+			response.Errors[bucket] = err.Error()
+			continue
+		}
+		for _, groupID := range groupIDs {
+			var dbConfig DatabaseConfig
+			if _, err := h.server.BootstrapContext.Connection.GetConfig(bucket, groupID, &dbConfig); err != nil {
+				base.DebugfCtx(h.ctx(), base.KeyConfig, "Unable to fetch config for group %q from bucket %q: %v", groupID, base.MD(bucket), err)
+				continue
+			}
+			name := dbConfig.Name
+			if name == "" {
+				name = bucket
+			}
+			response.Groups[groupID] = append(response.Groups[groupID], ConfigGroupDatabase{
+				Bucket:    bucket,
+				Name:      name,
+				Version:   dbConfig.Version,
+				SGVersion: dbConfig.SGVersion,
+			})
+		}
+	}
+
+	h.writeJSON(response)
+	return nil
+}
+
+// POST to copy the database configs of one config group to another, for example to start a new version of Sync
+// Gateway with a distinct group ID alongside the current one.  Configs that already exist in the target group are only
+// replaced when overwrite=true, and dry_run=true reports what would be copied without copying anything.  Copied configs
+// don't include the source config's history.
+func (h *handler) handlePostConfigGroupCopy() error {
+	if !h.server.persistentConfig {
+		return base.HTTPErrorf(http.StatusBadRequest, "endpoint only supports persistent config mode")
+	}
+
+	sourceGroupID := h.PathVar("group")
+	targetGroupID := h.getQuery("target")
+	if targetGroupID == "" {
+		return base.HTTPErrorf(http.StatusBadRequest, "target group ID must be specified")
+	}
+	if len(targetGroupID) > persistentConfigGroupIDMaxLength {
+		return base.HTTPErrorf(http.StatusBadRequest, "target group ID must be at most %d characters in length", persistentConfigGroupIDMaxLength)
+	}
+	if targetGroupID == sourceGroupID {
+		return base.HTTPErrorf(http.StatusBadRequest, "target group ID must differ from the source group ID")
+	}
+	dryRun := h.getBoolQuery("dry_run")
+	overwrite := h.getBoolQuery("overwrite")
+
+	buckets, err := h.server.bootstrapBuckets()
+	if err != nil {
+		return err
+	}
+
+	connection := h.server.BootstrapContext.Connection
+	response := ConfigGroupCopyResponse{DryRun: dryRun, Databases: []ConfigGroupCopyResult{}}
+	for _, bucket := range buckets {
+		var dbConfig DatabaseConfig
+		if _, err := connection.GetConfig(bucket, sourceGroupID, &dbConfig); err != nil {
+			if err != base.ErrNotFound {
+				base.DebugfCtx(h.ctx(), base.KeyConfig, "Unable to fetch config for group %q from bucket %q: %v", sourceGroupID, base.MD(bucket), err)
+			}
+			continue
+		}
+		dbConfig.History = nil
+		result := ConfigGroupCopyResult{Bucket: bucket, Name: dbConfig.Name}
+		if result.Name == "" {
+			result.Name = bucket
+		}
+		result.Status, err = copyConfigToGroup(connection, bucket, targetGroupID, &dbConfig, overwrite, dryRun)
+		if err != nil {
+			result.Status = configGroupCopyStatusFailed
+			result.Error = err.Error()
+		}
+		base.InfofCtx(h.ctx(), base.KeyConfig, "Copy of database %q config from group %q to group %q: %s (dry run: %t)",
+			base.MD(result.Name), sourceGroupID, targetGroupID, result.Status, dryRun)
+		response.Databases = append(response.Databases, result)
+	}
+
+	h.writeJSON(response)
+	return nil
+}
+
+// copyConfigToGroup saves the database config in the given bucket for the target group, returning the status of the
+// copy.  When dryRun is set, the status is determined without saving the config.
+func copyConfigToGroup(connection base.BootstrapConnection, bucket, targetGroupID string, dbConfig *DatabaseConfig, overwrite, dryRun bool) (status string, err error) {
+	if dryRun {
+		var existing DatabaseConfig
+		_, err := connection.GetConfig(bucket, targetGroupID, &existing)
+		if err == base.ErrNotFound {
+			return configGroupCopyStatusCopied, nil
+		} else if err != nil {
+			return "", err
+		} else if overwrite {
+			return configGroupCopyStatusReplaced, nil
+		}
+		return configGroupCopyStatusSkipped, nil
+	}
+
+	_, err = connection.InsertConfig(bucket, targetGroupID, dbConfig)
+	if err == nil {
+		return configGroupCopyStatusCopied, nil
+	} else if !errors.Is(err, base.ErrAlreadyExists) {
+		return "", err
+	} else if !overwrite {
+		return configGroupCopyStatusSkipped, nil
+	}
+
+	_, err = connection.UpdateConfig(bucket, targetGroupID, recordDatabaseConfigHistory(func(rawBucketConfig []byte) ([]byte, error) {
+		return base.JSONMarshal(dbConfig)
+	}))
+	if err != nil {
+		return "", err
+	}
+	return configGroupCopyStatusReplaced, nil
+}
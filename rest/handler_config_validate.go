@@ -0,0 +1,116 @@
+// Copyright 2022-Present Couchbase, Inc.
+//
+// Use of this software is governed by the Business Source License included
+// in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+// in that file, in accordance with the Business Source License, use of this
+// software will be governed by the Apache License, Version 2.0, included in
+// the file licenses/APL2.txt.
+
+package rest
+
+import (
+	"net/http"
+
+	"github.com/couchbase/sync_gateway/base"
+	pkgerrors "github.com/pkg/errors"
+)
+
+const paramValidateOnly = "validate_only"
+
+// ConfigValidationResponse is the result of validating a config without applying it.
+type ConfigValidationResponse struct {
+	Valid    bool     `json:"valid"`
+	Errors   []string `json:"errors,omitempty"`
+	Warnings []string `json:"warnings,omitempty"` // Warnings that would be logged when applying the config, such as EE-only options on CE
+}
+
+// newConfigValidationResponse returns the response for a config validated with the given result.
+func newConfigValidationResponse(validationErr error, warnings []string) ConfigValidationResponse {
+	response := ConfigValidationResponse{Valid: validationErr == nil, Warnings: warnings}
+	if multiErr, ok := validationErr.(*base.MultiError); ok {
+		for _, err := range multiErr.Errors {
+			response.Errors = append(response.Errors, err.Error())
+		}
+	} else if validationErr != nil {
+		response.Errors = []string{validationErr.Error()}
+	}
+	return response
+}
+
+// readConfigForValidation reads a config from the request body, returning a validation error for unknown fields, which
+// are a config problem rather than a bad request.
+func (h *handler) readConfigForValidation(config interface{}) (validationErr error, err error) {
+	err = h.readSanitizeJSON(config)
+	if err != nil && pkgerrors.Cause(base.WrapJSONUnknownFieldErr(err)) == base.ErrUnknownField {
+		return err, nil
+	}
+	return nil, err
+}
+
+// handleValidateDbConfig validates the database config in the body of a PUT or POST to /{db}/_config with
+// validate_only=true, returning every error and warning found, without applying the config.
+func (h *handler) handleValidateDbConfig() error {
+	var dbConfig DbConfig
+	validationErr, err := h.readConfigForValidation(&dbConfig)
+	if err != nil {
+		return err
+	} else if validationErr != nil {
+		h.writeJSON(newConfigValidationResponse(validationErr, nil))
+		return nil
+	}
+
+	currentConfig, _, err := h.getDBConfig()
+	if err != nil {
+		return err
+	} else if currentConfig == nil {
+		return base.HTTPErrorf(http.StatusNotFound, "database config not found")
+	}
+
+	var multiError *base.MultiError
+	if dbConfig.Name != "" && dbConfig.Name != h.PathVar("db") {
+		multiError = multiError.Append(base.HTTPErrorf(http.StatusBadRequest, "Cannot update database name. "+
+			"This requires removing and re-creating the database with a new name"))
+	}
+	if h.server.persistentConfig {
+		multiError = multiError.Append(dbConfig.validatePersistentDbConfig())
+	}
+
+	// POST merges the config into the current config, as when applying it
+	updatedConfig := &dbConfig
+	if h.rq.Method == http.MethodPost {
+		updatedConfig = &DbConfig{}
+		if err := base.DeepCopyInefficient(updatedConfig, currentConfig); err != nil {
+			return err
+		}
+		if err := base.ConfigMerge(updatedConfig, &dbConfig); err != nil {
+			return err
+		}
+	}
+
+	var warnings []string
+	ctx := withConfigWarnings(h.ctx(), &warnings)
+	multiError = multiError.Append(updatedConfig.validateConfigUpdate(ctx, *currentConfig, !h.getBoolQuery(paramDisableOIDCValidation)))
+
+	h.writeJSON(newConfigValidationResponse(multiError.ErrorOrNil(), warnings))
+	return nil
+}
+
+// POST a startup config to validate it, returning every error found, without applying it.
+func (h *handler) handlePostValidateStartupConfig() error {
+	var startupConfig StartupConfig
+	validationErr, err := h.readConfigForValidation(&startupConfig)
+	if err != nil {
+		return err
+	} else if validationErr != nil {
+		h.writeJSON(newConfigValidationResponse(validationErr, nil))
+		return nil
+	}
+
+	// Validate the config as it would be run with, once defaults are applied
+	config := DefaultStartupConfig(defaultLogFilePath)
+	if err := config.Merge(&startupConfig); err != nil {
+		return err
+	}
+	h.writeJSON(newConfigValidationResponse(config.Validate(base.IsEnterpriseEdition()), nil))
+	return nil
+}
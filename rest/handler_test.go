@@ -240,3 +240,27 @@ func Benchmark_parseKeyspace(b *testing.B) {
 		_, _, _, _ = parseKeyspace("d.s.c")
 	}
 }
+
+func TestCorrelationIDHeader(t *testing.T) {
+	base.SetUpTestLogging(t, base.LevelInfo, base.KeyHTTP)
+
+	rt := NewRestTester(t, nil)
+	defer rt.Close()
+
+	// The request's serial number is used and returned when the caller doesn't give a correlation ID
+	resp := rt.SendAdminRequest(http.MethodGet, "/db/", "")
+	RequireStatus(t, resp, http.StatusOK)
+	assert.Regexp(t, `^#\d{3,}$`, resp.Header().Get(base.CorrelationIDHeader))
+
+	// The caller's correlation ID is used in the request's logs and returned
+	base.AssertLogContains(t, "c:client-req.42 ", func() {
+		resp = rt.SendAdminRequestWithHeaders(http.MethodGet, "/db/", "", map[string]string{base.CorrelationIDHeader: "client-req.42"})
+	})
+	RequireStatus(t, resp, http.StatusOK)
+	assert.Equal(t, "client-req.42", resp.Header().Get(base.CorrelationIDHeader))
+
+	// Correlation IDs that could break up log lines are ignored
+	resp = rt.SendAdminRequestWithHeaders(http.MethodGet, "/db/", "", map[string]string{base.CorrelationIDHeader: "bad id\tc:forged"})
+	RequireStatus(t, resp, http.StatusOK)
+	assert.Regexp(t, `^#\d{3,}$`, resp.Header().Get(base.CorrelationIDHeader))
+}
@@ -1002,6 +1002,65 @@ func TestMigrateTombstone(t *testing.T) {
 
 }
 
+// Test migration of 1.4 docs by the _migrate_metadata background job, without triggering import or on-demand migrate.
+func TestMigrateMetadataBackgroundJob(t *testing.T) {
+
+	SkipImportTestsIfNotEnabled(t)
+
+	rtConfig := rest.RestTesterConfig{
+		DatabaseConfig: &rest.DatabaseConfig{DbConfig: rest.DbConfig{
+			AutoImport: false,
+		}},
+	}
+	rt := rest.NewRestTester(t, &rtConfig)
+	defer rt.Close()
+	bucket := rt.Bucket()
+
+	base.SetUpTestLogging(t, base.LevelDebug, base.KeyMigrate)
+
+	// Write docs in SG format directly to the bucket, along with a doc that has no sync metadata
+	bodyFormat := `{"value": "%s", "_sync": {"rev": "1-a", "sequence": %d, "recent_sequences": [%d],
+		"history": {"revs": ["1-a"], "parents": [-1], "channels": [null]}, "time_saved": "2017-11-22T13:24:33.115313269-08:00"}}`
+	const numDocs = 5
+	for i := 1; i <= numDocs; i++ {
+		key := fmt.Sprintf("TestMigrateMetadataBackgroundJob%d", i)
+		_, err := bucket.Add(key, 0, []byte(fmt.Sprintf(bodyFormat, key, i, i)))
+		require.NoError(t, err)
+	}
+	_, err := bucket.Add("TestMigrateMetadataBackgroundJobSDK", 0, []byte(`{"value": "sdk"}`))
+	require.NoError(t, err)
+
+	response := rt.SendAdminRequest(http.MethodPost, "/db/_migrate_metadata?max_per_second=100", "")
+	rest.RequireStatus(t, response, http.StatusOK)
+
+	var status db.MetadataMigrationManagerResponse
+	err = rt.WaitForCondition(func() bool {
+		response := rt.SendAdminRequest(http.MethodGet, "/db/_migrate_metadata", "")
+		rest.RequireStatus(t, response, http.StatusOK)
+		require.NoError(t, base.JSONUnmarshal(response.Body.Bytes(), &status))
+		return status.State == db.BackgroundProcessStateCompleted
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(numDocs), status.DocsMigrated)
+	assert.Equal(t, int64(numDocs+1), status.DocsProcessed)
+	assert.Equal(t, uint64(100), status.MaxPerSecond)
+
+	// Validate metadata has been moved to the xattr
+	for i := 1; i <= numDocs; i++ {
+		key := fmt.Sprintf("TestMigrateMetadataBackgroundJob%d", i)
+		body, _, err := bucket.GetRaw(key)
+		require.NoError(t, err)
+		assert.NotContains(t, string(body), base.SyncPropertyName)
+
+		rawResponse := rt.SendAdminRequest(http.MethodGet, "/db/_raw/"+key, "")
+		rest.RequireStatus(t, rawResponse, http.StatusOK)
+		var doc treeDoc
+		require.NoError(t, base.JSONUnmarshal(rawResponse.Body.Bytes(), &doc))
+		assert.Equal(t, "1-a", doc.Meta.CurrentRev)
+		assert.Equal(t, uint64(i), doc.Meta.Sequence)
+	}
+}
+
 // Test migration of a 1.5 doc that already includes some external revision storage from docmeta to xattr.
 func TestMigrateWithExternalRevisions(t *testing.T) {
 
@@ -1364,6 +1423,70 @@ func TestXattrFeedBasedImportPreservesExpiry(t *testing.T) {
 	assert.True(t, expiry == 0)
 }
 
+// Test import_expiry modes that replace the expiry of SDK-written docs on feed-based import.
+func TestXattrFeedBasedImportExpiryModes(t *testing.T) {
+
+	SkipImportTestsIfNotEnabled(t)
+
+	testCases := []struct {
+		name           string
+		config         db.ImportExpiryConfig
+		expectedExpiry func() uint32
+	}{
+		{
+			name:           "clear",
+			config:         db.ImportExpiryConfig{Mode: db.ImportExpiryClear},
+			expectedExpiry: func() uint32 { return 0 },
+		},
+		{
+			name:   "extend",
+			config: db.ImportExpiryConfig{Mode: db.ImportExpiryExtend, ExtendSecs: base.Uint32Ptr(3600)},
+			expectedExpiry: func() uint32 {
+				return uint32(time.Now().Add(time.Hour).Unix())
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			importExpiry := testCase.config
+			rtConfig := rest.RestTesterConfig{
+				SyncFn: `function(doc, oldDoc) { channel(doc.channels) }`,
+				DatabaseConfig: &rest.DatabaseConfig{DbConfig: rest.DbConfig{
+					AutoImport:   true,
+					ImportExpiry: &importExpiry,
+				}},
+			}
+			rt := rest.NewRestTester(t, &rtConfig)
+			defer rt.Close()
+			bucket := rt.Bucket()
+
+			mobileKey := "TestXattrImportExpiryModes"
+			mobileKeyNoExpiry := fmt.Sprintf("%s-noexpiry", mobileKey)
+			mobileBody := map[string]interface{}{"type": "mobile", "channels": "ABC"}
+
+			_, err := bucket.Add(mobileKey, uint32(time.Now().Add(time.Second*30).Unix()), mobileBody)
+			require.NoError(t, err, "Error writing SDK doc")
+			_, err = bucket.Add(mobileKeyNoExpiry, 0, mobileBody)
+			require.NoError(t, err, "Error writing SDK doc")
+
+			_, err = rt.WaitForChanges(2, "/db/_changes", "", true)
+			require.NoError(t, err, "Error waiting for changes")
+			base.RequireWaitForStat(t, rt.GetDatabase().DbStats.SharedBucketImport().ImportWithExpiryCount.Value, 1)
+
+			cbStore, _ := base.AsCouchbaseStore(bucket)
+			afterExpiry, err := cbStore.GetExpiry(mobileKey)
+			require.NoError(t, err, "Error calling GetExpiry()")
+			assertExpiry(t, testCase.expectedExpiry(), afterExpiry)
+
+			// Docs without an expiry aren't given one
+			noExpiry, err := cbStore.GetExpiry(mobileKeyNoExpiry)
+			require.NoError(t, err, "Error calling GetExpiry()")
+			assert.Equal(t, uint32(0), noExpiry)
+		})
+	}
+}
+
 // Test migration of a 1.5 doc that has an expiry value.
 func TestFeedBasedMigrateWithExpiry(t *testing.T) {
 
@@ -2427,3 +2550,87 @@ func TestImportTouch(t *testing.T) {
 	require.NoError(t, err, "Unable to unmarshal raw response")
 	require.Equal(t, initialRev, rawUpdateResponse.Sync.Rev)
 }
+
+// Test importing a set of docs on demand via the _import endpoint.
+func TestImportDocsEndpoint(t *testing.T) {
+	SkipImportTestsIfNotEnabled(t)
+
+	importFilter := `function (doc) { return doc.type == "mobile"; }`
+	rtConfig := rest.RestTesterConfig{
+		SyncFn: `function(doc, oldDoc) { channel(doc.channels) }`,
+		DatabaseConfig: &rest.DatabaseConfig{DbConfig: rest.DbConfig{
+			ImportFilter: &importFilter,
+			AutoImport:   false,
+		}},
+	}
+	rt := rest.NewRestTester(t, &rtConfig)
+	defer rt.Close()
+
+	bucket := rt.Bucket()
+	_, err := bucket.Add("mobileDoc", 0, map[string]interface{}{"type": "mobile", "channels": "ABC"})
+	require.NoError(t, err)
+	_, err = bucket.Add("serverDoc", 0, map[string]interface{}{"type": "server"})
+	require.NoError(t, err)
+
+	type importResponse struct {
+		Results []db.ImportDocResult `json:"results"`
+	}
+	importDocs := func() importResponse {
+		response := rt.SendAdminRequest("POST", "/db/_import", `{"doc_ids": ["mobileDoc", "serverDoc", "missingDoc"]}`)
+		rest.RequireStatus(t, response, http.StatusOK)
+		var result importResponse
+		require.NoError(t, base.JSONUnmarshal(response.Body.Bytes(), &result))
+		require.Len(t, result.Results, 3)
+		return result
+	}
+
+	result := importDocs()
+	assert.Equal(t, db.ImportStatusImported, result.Results[0].Status)
+	assert.Equal(t, "1-", result.Results[0].RevID[:2])
+	assert.Equal(t, db.ImportStatusFiltered, result.Results[1].Status)
+	assert.Equal(t, db.ImportStatusNotFound, result.Results[2].Status)
+
+	// Docs that have already been imported are left unchanged
+	importedRevID := result.Results[0].RevID
+	result = importDocs()
+	assert.Equal(t, db.ImportStatusAlreadyImported, result.Results[0].Status)
+	assert.Equal(t, importedRevID, result.Results[0].RevID)
+
+	response := rt.SendAdminRequest("POST", "/db/_import", `{"doc_ids": []}`)
+	rest.RequireStatus(t, response, http.StatusBadRequest)
+}
+
+// Test that an SDK write colliding with a Sync Gateway write is discarded when the import conflict strategy prefers
+// Sync Gateway writes.
+func TestImportConflictPreferSG(t *testing.T) {
+	SkipImportTestsIfNotEnabled(t)
+
+	rtConfig := rest.RestTesterConfig{
+		SyncFn: `function(doc, oldDoc) { channel(doc.channels) }`,
+		DatabaseConfig: &rest.DatabaseConfig{DbConfig: rest.DbConfig{
+			AutoImport:     false,
+			ImportConflict: &db.ImportConflictConfig{Strategy: db.ImportConflictPreferSG},
+		}},
+	}
+	rt := rest.NewRestTester(t, &rtConfig)
+	defer rt.Close()
+
+	key := "TestImportConflictPreferSG"
+	response := rt.SendAdminRequest("PUT", "/db/"+key, `{"channels": "ABC", "value": "sg1"}`)
+	rest.RequireStatus(t, response, http.StatusCreated)
+	revID := rest.RespRevID(t, response)
+
+	// Update the doc via the SDK, then via Sync Gateway based on the revision that the SDK write replaced
+	err := rt.Bucket().Set(key, 0, nil, map[string]interface{}{"channels": "ABC", "value": "sdk"})
+	require.NoError(t, err)
+	response = rt.SendAdminRequest("PUT", "/db/"+key+"?rev="+revID, `{"channels": "ABC", "value": "sg2"}`)
+	rest.RequireStatus(t, response, http.StatusCreated)
+	assert.Equal(t, "2-", rest.RespRevID(t, response)[:2])
+
+	var body db.Body
+	response = rt.SendAdminRequest("GET", "/db/"+key, "")
+	rest.RequireStatus(t, response, http.StatusOK)
+	require.NoError(t, base.JSONUnmarshal(response.Body.Bytes(), &body))
+	assert.Equal(t, "sg2", body["value"])
+	assert.Equal(t, int64(1), rt.GetDatabase().DbStats.SharedBucketImport().ImportConflictPreferSGCount.Value())
+}
@@ -23,6 +23,7 @@ import (
 
 	"github.com/couchbase/sync_gateway/auth"
 	"github.com/couchbase/sync_gateway/base"
+	"github.com/couchbase/sync_gateway/channels"
 	pkgerrors "github.com/pkg/errors"
 )
 
@@ -30,6 +31,9 @@ import (
 // function directly calls this. It registers both signal and fatal panic handlers,
 // does the initial setup and finally starts the server.
 func ServerMain() {
+	// The executable is also run as the sandbox of sync functions with resource limits
+	channels.RunSyncSandboxIfRequested()
+
 	if err := serverMain(context.Background(), os.Args); err != nil {
 		base.FatalfCtx(context.TODO(), "Couldn't start Sync Gateway: %v", err)
 	}
@@ -149,6 +153,11 @@ func serverMainPersistentConfig(ctx context.Context, fs *flag.FlagSet, flagStart
 	}
 
 	svrctx.initialStartupConfig = initialStartupConfig
+	svrctx.flagStartupConfig = flagStartupConfig
+	if len(configPath) == 1 {
+		svrctx.startupConfigPath = configPath[0]
+		defer registerSighupStartupConfigReload(ctx, svrctx)()
+	}
 
 	svrctx.addLegacyPrincipals(ctx, legacyDbUsers, legacyDbRoles)
 
@@ -206,7 +215,11 @@ func automaticConfigUpgrade(configPath string) (sc *StartupConfig, disablePersis
 	}
 
 	// Attempt to establish connection to server
-	cluster, err := CreateCouchbaseClusterFromStartupConfig(startupConfig)
+	couchbaseCluster, err := CreateCouchbaseClusterFromStartupConfig(startupConfig)
+	if err != nil {
+		return nil, false, nil, nil, err
+	}
+	cluster, err := newSecretEncryptingConnection(context.Background(), startupConfig, couchbaseCluster)
 	if err != nil {
 		return nil, false, nil, nil, err
 	}
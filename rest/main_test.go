@@ -14,12 +14,16 @@ import (
 	"testing"
 
 	"github.com/couchbase/sync_gateway/base"
+	"github.com/couchbase/sync_gateway/channels"
 	"github.com/couchbase/sync_gateway/db"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func TestMain(m *testing.M) {
+	// The test binary is run as the sandbox of sync functions with resource limits
+	channels.RunSyncSandboxIfRequested()
+
 	memWatermarkThresholdMB := uint64(8192)
 	db.TestBucketPoolWithIndexes(m, memWatermarkThresholdMB)
 }
@@ -0,0 +1,203 @@
+// Copyright 2022-Present Couchbase, Inc.
+//
+// Use of this software is governed by the Business Source License included
+// in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+// in that file, in accordance with the Business Source License, use of this
+// software will be governed by the Apache License, Version 2.0, included in
+// the file licenses/APL2.txt.
+
+package rest
+
+import (
+	"context"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/couchbase/sync_gateway/db"
+)
+
+const (
+	// nodeRegistryHeartbeatInterval is how often each node updates its registration in the buckets of its databases.
+	nodeRegistryHeartbeatInterval = 10 * time.Second
+	// nodeRegistryUnhealthyIntervals is the number of missed heartbeats after which a node is reported as unhealthy.
+	nodeRegistryUnhealthyIntervals = 3
+	// nodeRegistryExpiryIntervals is the number of missed heartbeats after which a node is removed from the registry.
+	nodeRegistryExpiryIntervals = 30
+)
+
+const (
+	NodeStatusHealthy   = "healthy"
+	NodeStatusUnhealthy = "unhealthy"
+)
+
+// nodeRegistryDoc is the registry of the nodes running databases on a bucket, stored in the bucket.
+type nodeRegistryDoc struct {
+	Nodes map[string]NodeRegistration `json:"nodes"` // Keyed by node ID
+}
+
+// NodeRegistration describes a Sync Gateway node, as of its last heartbeat.
+type NodeRegistration struct {
+	Host             string         `json:"host"`
+	Version          string         `json:"version"`
+	ConfigGroupID    string         `json:"config_group_id,omitempty"`
+	Databases        []string       `json:"databases"`                   // Databases running on the node
+	ImportPartitions map[string]int `json:"import_partitions,omitempty"` // Import partitions assigned to the node, keyed by database
+	StartedAt        time.Time      `json:"started_at"`
+	LastHeartbeat    time.Time      `json:"last_heartbeat"`
+}
+
+// ClusterNodeStatus is the health of a node in the cluster.
+type ClusterNodeStatus struct {
+	NodeRegistration
+	Uptime string `json:"uptime"`
+	Status string `json:"status"` // healthy or unhealthy
+}
+
+// ClusterStatus is the set of nodes known to this node, from the registries of the buckets of its databases.
+type ClusterStatus struct {
+	NodeID string                       `json:"node_id"` // ID of the node that returned the status
+	Nodes  map[string]ClusterNodeStatus `json:"nodes"`   // Keyed by node ID
+}
+
+type nodeRegistryContext struct {
+	terminator chan struct{} // Used to stop the goroutine sending heartbeats
+	doneChan   chan struct{} // doneChan is closed when the heartbeat goroutine finishes
+}
+
+// startNodeRegistryHeartbeat starts the goroutine that periodically registers this node in the buckets of its databases.
+func (sc *ServerContext) startNodeRegistryHeartbeat(ctx context.Context) {
+	sc.nodeRegistry.terminator = make(chan struct{})
+	sc.nodeRegistry.doneChan = make(chan struct{})
+	go func() {
+		defer close(sc.nodeRegistry.doneChan)
+		t := time.NewTicker(nodeRegistryHeartbeatInterval)
+		for {
+			select {
+			case <-t.C:
+				sc.heartbeatNodeRegistry(ctx)
+			case <-sc.nodeRegistry.terminator:
+				base.DebugfCtx(ctx, base.KeyAll, "Stopping node registry heartbeat goroutine")
+				t.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// nodeRegistration returns this node's current registration.
+func (sc *ServerContext) nodeRegistration() NodeRegistration {
+	host, _ := os.Hostname()
+	registration := NodeRegistration{
+		Host:          host,
+		Version:       base.LongVersionString,
+		ConfigGroupID: sc.Config.Bootstrap.ConfigGroupID,
+		Databases:     []string{},
+		StartedAt:     sc.startedAt,
+		LastHeartbeat: time.Now(),
+	}
+	for name, database := range sc.AllDatabases() {
+		registration.Databases = append(registration.Databases, name)
+		if partitions := assignedImportPartitions(database); partitions > 0 {
+			if registration.ImportPartitions == nil {
+				registration.ImportPartitions = make(map[string]int)
+			}
+			registration.ImportPartitions[name] = partitions
+		}
+	}
+	sort.Strings(registration.Databases)
+	return registration
+}
+
+// assignedImportPartitions returns the number of the database's import partitions assigned to this node.
+func assignedImportPartitions(database *db.DatabaseContext) int {
+	status, err := database.ImportPartitions()
+	if err != nil {
+		return 0
+	}
+	for _, node := range status.Nodes {
+		if node.UUID == database.UUID {
+			return node.Partitions
+		}
+	}
+	return 0
+}
+
+// heartbeatNodeRegistry updates this node's registration in the registry of each bucket used by its databases.
+func (sc *ServerContext) heartbeatNodeRegistry(ctx context.Context) {
+	registration := sc.nodeRegistration()
+	for _, bucket := range sc.databaseBuckets() {
+		_, err := bucket.Update(base.NodeRegistryKey, 0, func(currentValue []byte) ([]byte, *uint32, bool, error) {
+			var registry nodeRegistryDoc
+			if currentValue != nil {
+				if err := base.JSONUnmarshal(currentValue, &registry); err != nil {
+					return nil, nil, false, err
+				}
+			}
+			if registry.Nodes == nil {
+				registry.Nodes = make(map[string]NodeRegistration)
+			}
+			for id, node := range registry.Nodes {
+				if registration.LastHeartbeat.Sub(node.LastHeartbeat) > nodeRegistryExpiryIntervals*nodeRegistryHeartbeatInterval {
+					delete(registry.Nodes, id)
+				}
+			}
+			registry.Nodes[sc.nodeID] = registration
+			updated, err := base.JSONMarshal(registry)
+			return updated, nil, false, err
+		})
+		if err != nil {
+			base.DebugfCtx(ctx, base.KeyAll, "Unable to update node registry in bucket %s: %v", base.MD(bucket.GetName()), err)
+		}
+	}
+}
+
+// clusterStatus returns the health of the nodes in the registries of the buckets used by this node's databases.
+func (sc *ServerContext) clusterStatus() (*ClusterStatus, error) {
+	now := time.Now()
+	nodes := map[string]NodeRegistration{sc.nodeID: sc.nodeRegistration()}
+	for _, bucket := range sc.databaseBuckets() {
+		var registry nodeRegistryDoc
+		_, err := bucket.Get(base.NodeRegistryKey, &registry)
+		if base.IsKeyNotFoundError(bucket, err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		for id, node := range registry.Nodes {
+			if existing, ok := nodes[id]; !ok || node.LastHeartbeat.After(existing.LastHeartbeat) {
+				nodes[id] = node
+			}
+		}
+	}
+
+	status := &ClusterStatus{NodeID: sc.nodeID, Nodes: make(map[string]ClusterNodeStatus, len(nodes))}
+	for id, node := range nodes {
+		nodeStatus := ClusterNodeStatus{
+			NodeRegistration: node,
+			Uptime:           node.LastHeartbeat.Sub(node.StartedAt).Round(time.Second).String(),
+			Status:           NodeStatusHealthy,
+		}
+		if now.Sub(node.LastHeartbeat) > nodeRegistryUnhealthyIntervals*nodeRegistryHeartbeatInterval {
+			nodeStatus.Status = NodeStatusUnhealthy
+		}
+		status.Nodes[id] = nodeStatus
+	}
+	return status, nil
+}
+
+// databaseBuckets returns the buckets used by this node's databases.
+func (sc *ServerContext) databaseBuckets() []base.Bucket {
+	var buckets []base.Bucket
+	seen := make(map[string]struct{})
+	for _, database := range sc.AllDatabases() {
+		name := database.Bucket.GetName()
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		buckets = append(buckets, database.Bucket)
+	}
+	return buckets
+}
@@ -30,6 +30,11 @@ const (
 	requestParamScope        = "scope"
 	requestParamRedirectURI  = "redirect_uri"
 
+	requestParamIDTokenHint           = "id_token_hint"
+	requestParamPostLogoutRedirectURI = "post_logout_redirect_uri"
+	requestParamClientID              = "client_id"
+	requestParamLogoutToken           = "logout_token"
+
 	// stateCookieName is the name of state cookie to prevent cross-site request forgery (CSRF).
 	stateCookieName = "sg-oidc-state"
 
@@ -263,6 +268,85 @@ func (h *handler) handleOIDCRefresh() error {
 	return nil
 }
 
+// handleOIDCLogout performs RP-initiated logout.  The Sync Gateway session for the request, and any other sessions
+// for the authenticated user, are deleted.  When the provider advertises an end_session_endpoint the request is
+// redirected there to end the provider session, otherwise the logout is local only.
+func (h *handler) handleOIDCLogout() error {
+	providerName := h.getQuery(requestParamProvider)
+	provider, err := h.getOIDCProvider(providerName)
+	if err != nil {
+		return err
+	}
+
+	client, err := provider.GetClient(h.ctx(), h.getOIDCCallbackURL)
+	if err != nil {
+		return base.HTTPErrorf(http.StatusInternalServerError, "Unable to obtain client for provider: %s - %v", providerName, err)
+	}
+
+	if cookie := h.db.Authenticator(h.ctx()).DeleteSessionForCookie(h.rq); cookie != nil {
+		http.SetCookie(h.response, cookie)
+	}
+	if h.user != nil && h.user.Name() != "" {
+		if err := h.db.DeleteUserSessions(h.ctx(), h.user.Name()); err != nil {
+			return err
+		}
+		base.InfofCtx(h.ctx(), base.KeyAuth, "Deleted sessions for user %s on OIDC logout", base.UD(h.user.Name()))
+	}
+
+	endSessionEndpoint := provider.EndSessionEndpoint()
+	if endSessionEndpoint == "" {
+		base.DebugfCtx(h.ctx(), base.KeyAuth, "Provider %s has no end_session_endpoint, OIDC logout is local only", base.UD(provider.Name))
+		return nil
+	}
+
+	logoutURL, err := url.Parse(endSessionEndpoint)
+	if err != nil {
+		return base.HTTPErrorf(http.StatusInternalServerError, "Invalid end_session_endpoint for provider %s: %v", providerName, err)
+	}
+	query := logoutURL.Query()
+	query.Set(requestParamClientID, client.Config().ClientID)
+	for _, param := range []string{requestParamIDTokenHint, requestParamPostLogoutRedirectURI, requestParamState} {
+		if value := h.getQuery(param); value != "" {
+			query.Set(param, value)
+		}
+	}
+	logoutURL.RawQuery = query.Encode()
+
+	http.Redirect(h.response, h.rq, logoutURL.String(), http.StatusFound)
+	return nil
+}
+
+// handleOIDCBackchannelLogout handles a back-channel logout request from the provider, deleting all Sync Gateway
+// sessions for the user identified by the logout token.
+// See: https://openid.net/specs/openid-connect-backchannel-1_0.html#BCRequest
+func (h *handler) handleOIDCBackchannelLogout() error {
+	// Responses must not be cached
+	h.setHeader("Cache-Control", "no-store")
+
+	logoutToken := h.rq.PostFormValue(requestParamLogoutToken)
+	if logoutToken == "" {
+		return base.HTTPErrorf(http.StatusBadRequest, "logout_token must be present for oidc backchannel logout")
+	}
+
+	providerName := h.getQuery(requestParamProvider)
+	provider, err := h.getOIDCProvider(providerName)
+	if err != nil {
+		return err
+	}
+
+	username, err := provider.VerifyLogoutToken(h.ctx(), logoutToken, h.getOIDCCallbackURL)
+	if err != nil {
+		base.InfofCtx(h.ctx(), base.KeyAuth, "Invalid OIDC logout token: %v", err)
+		return base.HTTPErrorf(http.StatusBadRequest, "Invalid logout token")
+	}
+
+	if err := h.db.DeleteUserSessions(h.ctx(), username); err != nil {
+		return err
+	}
+	base.InfofCtx(h.ctx(), base.KeyAuth, "Deleted sessions for user %s on OIDC backchannel logout", base.UD(username))
+	return nil
+}
+
 func (h *handler) createSessionForTrustedIdToken(rawIDToken string, provider *auth.OIDCProvider) (username string, sessionID string, err error) {
 	user, updates, tokenExpiryTime, err := h.db.Authenticator(h.ctx()).AuthenticateTrustedJWT(rawIDToken, provider, h.getOIDCCallbackURL)
 	if err != nil {
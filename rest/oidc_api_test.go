@@ -221,6 +221,7 @@ func (s *mockAuthServer) discoveryHandler(w http.ResponseWriter, r *http.Request
 		TokenEndpoint:                    issuer + "/token",
 		JwksUri:                          issuer + "/keys",
 		AuthorizationEndpoint:            issuer + "/auth",
+		EndSessionEndpoint:               issuer + "/logout",
 		IdTokenSigningAlgValuesSupported: []string{"RS256"},
 		TokenEndpointAuthMethodsSupported: []string{
 			"client_secret_basic",
@@ -1810,6 +1811,120 @@ func TestCallbackStateClientCookies(t *testing.T) {
 	})
 }
 
+// TestOpenIDConnectLogout verifies that RP-initiated logout and back-channel logout delete the user's
+// Sync Gateway sessions, and that RP-initiated logout redirects to the provider's end_session_endpoint.
+func TestOpenIDConnectLogout(t *testing.T) {
+	providers := auth.OIDCProviderMap{
+		"foo": mockProviderWith("foo", mockProviderRegister{}, mockProviderUserPrefix{"foo"}, mockProviderDisableCallbackState{}),
+	}
+	defaultProvider := "foo"
+	mockAuthServer, err := newMockAuthServer()
+	require.NoError(t, err, "Error creating mock oauth2 server")
+	mockAuthServer.Start()
+	defer mockAuthServer.Shutdown()
+	mockAuthServer.options.issuer = mockAuthServer.URL + "/" + defaultProvider
+	refreshProviderConfig(providers, mockAuthServer.URL)
+
+	restTester := NewRestTester(t, &RestTesterConfig{
+		DatabaseConfig: &DatabaseConfig{DbConfig: DbConfig{
+			OIDCConfig: &auth.OIDCOptions{
+				Providers:       providers,
+				DefaultProvider: &defaultProvider,
+			},
+		}},
+	})
+	require.NoError(t, restTester.SetAdminParty(false))
+	defer restTester.Close()
+
+	mockSyncGateway := httptest.NewServer(restTester.TestPublicHandler())
+	defer mockSyncGateway.Close()
+	mockSyncGatewayURL := mockSyncGateway.URL
+
+	// Authenticate via the auth code flow, to create the user and an initial session
+	response, err := http.Get(mockSyncGatewayURL + "/db/_oidc?provider=foo")
+	require.NoError(t, err, "Error sending request")
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	var authResponse OIDCTokenResponse
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&authResponse))
+	require.NoError(t, response.Body.Close(), "Error closing response body")
+	require.Equal(t, "foo_noah", authResponse.Username)
+	require.NotEmpty(t, authResponse.SessionID)
+
+	createSession := func() string {
+		response := restTester.SendAdminRequest(http.MethodPost, "/db/_session", `{"name":"foo_noah"}`)
+		RequireStatus(t, response, http.StatusOK)
+		var session struct {
+			SessionID string `json:"session_id"`
+		}
+		require.NoError(t, base.JSONUnmarshal(response.Body.Bytes(), &session))
+		return session.SessionID
+	}
+	requireSessionDeleted := func(sessionID string) {
+		response := restTester.SendAdminRequest(http.MethodGet, "/db/_session/"+sessionID, "")
+		RequireStatus(t, response, http.StatusNotFound)
+	}
+
+	t.Run("RP-initiated logout", func(t *testing.T) {
+		otherSessionID := createSession()
+
+		request, err := http.NewRequest(http.MethodGet, mockSyncGatewayURL+"/db/_oidc_logout?provider=foo&id_token_hint="+authResponse.IDToken+"&state=xyz", nil)
+		require.NoError(t, err, "Error creating new request")
+		request.AddCookie(&http.Cookie{Name: auth.DefaultCookieName, Value: authResponse.SessionID})
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}
+		response, err := client.Do(request)
+		require.NoError(t, err, "Error sending request")
+		require.NoError(t, response.Body.Close(), "Error closing response body")
+		require.Equal(t, http.StatusFound, response.StatusCode)
+
+		location, err := url.Parse(response.Header.Get("Location"))
+		require.NoError(t, err)
+		assert.Equal(t, mockAuthServer.options.issuer+"/logout", location.Scheme+"://"+location.Host+location.Path)
+		assert.Equal(t, "baz", location.Query().Get(requestParamClientID))
+		assert.Equal(t, authResponse.IDToken, location.Query().Get(requestParamIDTokenHint))
+		assert.Equal(t, "xyz", location.Query().Get(requestParamState))
+
+		sessionCookie := getCookie(response.Cookies(), auth.DefaultCookieName)
+		require.NotNil(t, sessionCookie)
+		assert.Empty(t, sessionCookie.Value)
+
+		requireSessionDeleted(authResponse.SessionID)
+		requireSessionDeleted(otherSessionID)
+	})
+
+	t.Run("backchannel logout", func(t *testing.T) {
+		sessionIDs := []string{createSession(), createSession()}
+
+		sendLogoutToken := func(claims claimSet) *http.Response {
+			logoutToken, err := mockAuthServer.makeToken(claims)
+			require.NoError(t, err)
+			form := url.Values{requestParamLogoutToken: {logoutToken}}
+			response, err := http.PostForm(mockSyncGatewayURL+"/db/_oidc_backchannel_logout?provider=foo", form)
+			require.NoError(t, err, "Error sending request")
+			require.NoError(t, response.Body.Close(), "Error closing response body")
+			assert.Equal(t, "no-store", response.Header.Get("Cache-Control"))
+			return response
+		}
+
+		// Logout tokens without the back-channel logout event are rejected
+		response := sendLogoutToken(claimsAuthentic())
+		require.Equal(t, http.StatusBadRequest, response.StatusCode)
+		for _, sessionID := range sessionIDs {
+			response := restTester.SendAdminRequest(http.MethodGet, "/db/_session/"+sessionID, "")
+			RequireStatus(t, response, http.StatusOK)
+		}
+
+		response = sendLogoutToken(claimsAuthenticWithExtraClaims(map[string]interface{}{
+			"events": map[string]interface{}{auth.BackchannelLogoutEvent: map[string]interface{}{}},
+		}))
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		for _, sessionID := range sessionIDs {
+			requireSessionDeleted(sessionID)
+		}
+	})
+}
+
 // E2E test that checks OpenID Connect Authorization Code Flow with the specified username_claim
 // as Sync Gateway username.
 func TestOpenIDConnectAuthCodeFlowWithUsernameClaim(t *testing.T) {
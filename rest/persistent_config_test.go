@@ -364,3 +364,163 @@ func TestImportFilterEndpoint(t *testing.T) {
 	resp = BootstrapAdminRequest(t, http.MethodGet, "/db1/importDoc3", "")
 	resp.RequireStatus(http.StatusOK)
 }
+
+func TestDbConfigHistoryAndRollback(t *testing.T) {
+	if base.UnitTestUrlIsWalrus() {
+		t.Skip("Bootstrap works with Couchbase Server only")
+	}
+
+	base.SetUpTestLogging(t, base.LevelInfo, base.KeyHTTP, base.KeyConfig)
+
+	serverErr := make(chan error, 0)
+
+	// Start SG with no databases
+	ctx := base.TestCtx(t)
+	config := BootstrapStartupConfigForTest(t)
+	sc, err := SetupServerContext(ctx, &config, true)
+	require.NoError(t, err)
+	defer func() {
+		sc.Close(ctx)
+		require.NoError(t, <-serverErr)
+	}()
+
+	go func() {
+		serverErr <- StartServer(ctx, &config, sc)
+	}()
+	require.NoError(t, sc.WaitForRESTAPIs())
+
+	tb := base.GetTestBucket(t)
+	defer tb.Close()
+	resp := BootstrapAdminRequest(t, http.MethodPut, "/db1/",
+		fmt.Sprintf(
+			`{"bucket": "%s", "num_index_replicas": 0, "enable_shared_bucket_access": %t, "use_views": %t}`,
+			tb.GetName(), base.TestUseXattrs(), base.TestsDisableGSI(),
+		),
+	)
+	resp.RequireStatus(http.StatusCreated)
+
+	var history DatabaseConfigHistoryResponse
+	resp = BootstrapAdminRequest(t, http.MethodGet, "/db1/_config/_history", "")
+	resp.RequireStatus(http.StatusOK)
+	require.NoError(t, json.Unmarshal([]byte(resp.Body), &history))
+	assert.Empty(t, history.History)
+	createdVersion := history.Version
+
+	syncFunc1 := `function(doc){channel("one")}`
+	syncFunc2 := `function(doc){channel("two")}`
+	resp = BootstrapAdminRequest(t, http.MethodPut, "/db1/_config/sync", syncFunc1)
+	resp.RequireStatus(http.StatusOK)
+	resp = BootstrapAdminRequest(t, http.MethodPut, "/db1/_config/sync", syncFunc2)
+	resp.RequireStatus(http.StatusOK)
+
+	resp = BootstrapAdminRequest(t, http.MethodGet, "/db1/_config/_history", "")
+	resp.RequireStatus(http.StatusOK)
+	require.NoError(t, json.Unmarshal([]byte(resp.Body), &history))
+	require.Len(t, history.History, 2)
+	assert.Equal(t, createdVersion, history.History[1].Version)
+	assert.Nil(t, history.History[1].Config.Sync)
+	require.NotNil(t, history.History[0].Config.Sync)
+	assert.Equal(t, syncFunc1, *history.History[0].Config.Sync)
+
+	// Roll back to the first sync function, which is applied as a new revision
+	resp = BootstrapAdminRequest(t, http.MethodPost, "/db1/_config/_rollback/"+history.History[0].Version, "")
+	resp.RequireStatus(http.StatusOK)
+	resp = BootstrapAdminRequest(t, http.MethodGet, "/db1/_config/sync", "")
+	resp.RequireStatus(http.StatusOK)
+	assert.Equal(t, syncFunc1, resp.Body)
+
+	resp = BootstrapAdminRequest(t, http.MethodGet, "/db1/_config/_history", "")
+	resp.RequireStatus(http.StatusOK)
+	require.NoError(t, json.Unmarshal([]byte(resp.Body), &history))
+	require.Len(t, history.History, 3)
+	require.NotNil(t, history.History[0].Config.Sync)
+	assert.Equal(t, syncFunc2, *history.History[0].Config.Sync)
+
+	resp = BootstrapAdminRequest(t, http.MethodPost, "/db1/_config/_rollback/1-unknown", "")
+	resp.RequireStatus(http.StatusNotFound)
+}
+
+func TestConfigGroupsListAndCopy(t *testing.T) {
+	if base.UnitTestUrlIsWalrus() {
+		t.Skip("Bootstrap works with Couchbase Server only")
+	}
+	if base.TestsDisableGSI() {
+		t.Skip("Listing config groups requires GSI")
+	}
+
+	base.SetUpTestLogging(t, base.LevelInfo, base.KeyHTTP, base.KeyConfig)
+
+	serverErr := make(chan error, 0)
+
+	// Start SG with no databases
+	ctx := base.TestCtx(t)
+	config := BootstrapStartupConfigForTest(t)
+	sc, err := SetupServerContext(ctx, &config, true)
+	require.NoError(t, err)
+	defer func() {
+		sc.Close(ctx)
+		require.NoError(t, <-serverErr)
+	}()
+
+	go func() {
+		serverErr <- StartServer(ctx, &config, sc)
+	}()
+	require.NoError(t, sc.WaitForRESTAPIs())
+
+	tb := base.GetTestBucketDefaultCollection(t)
+	defer tb.Close()
+	resp := BootstrapAdminRequest(t, http.MethodPut, "/db1/",
+		fmt.Sprintf(
+			`{"bucket": "%s", "num_index_replicas": 0, "enable_shared_bucket_access": %t}`,
+			tb.GetName(), base.TestUseXattrs(),
+		),
+	)
+	resp.RequireStatus(http.StatusCreated)
+
+	sourceGroupID := config.Bootstrap.ConfigGroupID
+	targetGroupID := sourceGroupID + "_blue"
+
+	var groups ConfigGroupsResponse
+	resp = BootstrapAdminRequest(t, http.MethodGet, "/_config/groups", "")
+	resp.RequireStatus(http.StatusOK)
+	require.NoError(t, json.Unmarshal([]byte(resp.Body), &groups))
+	require.Len(t, groups.Groups[sourceGroupID], 1)
+	assert.Equal(t, "db1", groups.Groups[sourceGroupID][0].Name)
+	assert.Equal(t, tb.GetName(), groups.Groups[sourceGroupID][0].Bucket)
+	assert.NotContains(t, groups.Groups, targetGroupID)
+
+	copyPath := "/_config/groups/" + sourceGroupID + "/_copy?target=" + targetGroupID
+	requireCopyStatus := func(path, expectedStatus string) {
+		resp := BootstrapAdminRequest(t, http.MethodPost, path, "")
+		resp.RequireStatus(http.StatusOK)
+		var copyResponse ConfigGroupCopyResponse
+		require.NoError(t, json.Unmarshal([]byte(resp.Body), &copyResponse))
+		require.Len(t, copyResponse.Databases, 1)
+		assert.Equal(t, "db1", copyResponse.Databases[0].Name)
+		assert.Equal(t, expectedStatus, copyResponse.Databases[0].Status)
+	}
+
+	// A dry run doesn't copy the config
+	requireCopyStatus(copyPath+"&dry_run=true", configGroupCopyStatusCopied)
+	var targetConfig DatabaseConfig
+	_, err = sc.BootstrapContext.Connection.GetConfig(tb.GetName(), targetGroupID, &targetConfig)
+	require.Equal(t, base.ErrNotFound, err)
+
+	requireCopyStatus(copyPath, configGroupCopyStatusCopied)
+	_, err = sc.BootstrapContext.Connection.GetConfig(tb.GetName(), targetGroupID, &targetConfig)
+	require.NoError(t, err)
+	assert.Equal(t, "db1", targetConfig.Name)
+
+	// Existing configs are only replaced when overwrite is set
+	requireCopyStatus(copyPath, configGroupCopyStatusSkipped)
+	requireCopyStatus(copyPath+"&overwrite=true", configGroupCopyStatusReplaced)
+
+	resp = BootstrapAdminRequest(t, http.MethodGet, "/_config/groups", "")
+	resp.RequireStatus(http.StatusOK)
+	require.NoError(t, json.Unmarshal([]byte(resp.Body), &groups))
+	require.Len(t, groups.Groups[targetGroupID], 1)
+	assert.Equal(t, "db1", groups.Groups[targetGroupID][0].Name)
+
+	resp = BootstrapAdminRequest(t, http.MethodPost, "/_config/groups/"+sourceGroupID+"/_copy?target="+sourceGroupID, "")
+	resp.RequireStatus(http.StatusBadRequest)
+}
@@ -0,0 +1,287 @@
+// Copyright 2022-Present Couchbase, Inc.
+//
+// Use of this software is governed by the Business Source License included
+// in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+// in that file, in accordance with the Business Source License, use of this
+// software will be governed by the Apache License, Version 2.0, included in
+// the file licenses/APL2.txt.
+
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/couchbase/sync_gateway/base"
+)
+
+const (
+	DefaultProfilingInterval    = 5 * time.Minute
+	DefaultProfilingCPUDuration = 10 * time.Second
+	DefaultProfilingMaxProfiles = 24
+
+	// profilingDirName is the directory in the log file path that profiles are written to by default.
+	profilingDirName = "profiles"
+	// profileTimeFormat is used in profile file names, so that they sort in the order they were captured.
+	profileTimeFormat = "20060102T150405.000Z"
+	profileFileExt    = ".pprof"
+)
+
+// The types of profile captured by the background profiler.
+const (
+	profileTypeCPU  = "cpu"
+	profileTypeHeap = "heap"
+)
+
+var profileTypes = []string{profileTypeCPU, profileTypeHeap}
+
+// ProfileHistoryEntry describes a profile captured by the background profiler.
+type ProfileHistoryEntry struct {
+	Name     string    `json:"name"` // File name, used to download the profile
+	Type     string    `json:"type"` // cpu or heap
+	Captured time.Time `json:"captured"`
+	Size     int64     `json:"size"` // In bytes
+}
+
+type profilerContext struct {
+	dir         string        // Directory profiles are written to, empty when the background profiler isn't enabled
+	interval    time.Duration // How often profiles are captured
+	cpuDuration time.Duration // How long each CPU profile samples for
+	maxProfiles int           // Number of profiles of each type to keep
+	terminator  chan struct{} // Used to stop the profiling goroutine
+	doneChan    chan struct{} // doneChan is closed when the profiling goroutine finishes
+}
+
+// profilingDir returns the directory the background profiler writes profiles to.
+func (c *ProfilingConfig) profilingDir(logFilePath string) string {
+	if c.Directory != "" {
+		return c.Directory
+	}
+	return filepath.Join(logFilePath, profilingDirName)
+}
+
+// validate returns an error if the profiling config is invalid.
+func (c *ProfilingConfig) validate(logFilePath string) error {
+	if !base.BoolDefault(c.Enabled, false) {
+		return nil
+	}
+	var multiError *base.MultiError
+	if c.Directory == "" && logFilePath == "" {
+		multiError = multiError.Append(fmt.Errorf("profiling.directory must be set when logging.log_file_path isn't"))
+	}
+	interval := c.Interval.Value()
+	if interval == 0 {
+		interval = DefaultProfilingInterval
+	}
+	cpuDuration := c.CPUDuration.Value()
+	if cpuDuration == 0 {
+		cpuDuration = DefaultProfilingCPUDuration
+	}
+	if interval < 0 || cpuDuration < 0 {
+		multiError = multiError.Append(fmt.Errorf("profiling.interval and profiling.cpu_duration cannot be negative"))
+	} else if cpuDuration >= interval {
+		multiError = multiError.Append(fmt.Errorf("profiling.cpu_duration must be shorter than profiling.interval"))
+	}
+	return multiError.ErrorOrNil()
+}
+
+// startBackgroundProfiler starts the goroutine that periodically captures CPU and heap profiles, when enabled.
+func (sc *ServerContext) startBackgroundProfiler(ctx context.Context) {
+	config := sc.Config.Profiling
+	if !base.BoolDefault(config.Enabled, false) {
+		return
+	}
+
+	dir := config.profilingDir(sc.Config.Logging.LogFilePath)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		base.WarnfCtx(ctx, "Couldn't create profiling directory %s, background profiling is disabled: %v", base.UD(dir), err)
+		return
+	}
+
+	sc.profiler.dir = dir
+	sc.profiler.interval = DefaultProfilingInterval
+	if config.Interval.Value() > 0 {
+		sc.profiler.interval = config.Interval.Value()
+	}
+	sc.profiler.cpuDuration = DefaultProfilingCPUDuration
+	if config.CPUDuration.Value() > 0 {
+		sc.profiler.cpuDuration = config.CPUDuration.Value()
+	}
+	sc.profiler.maxProfiles = DefaultProfilingMaxProfiles
+	if config.MaxProfiles > 0 {
+		sc.profiler.maxProfiles = int(config.MaxProfiles)
+	}
+
+	sc.profiler.terminator = make(chan struct{})
+	sc.profiler.doneChan = make(chan struct{})
+	go func() {
+		defer close(sc.profiler.doneChan)
+		t := time.NewTicker(sc.profiler.interval)
+		for {
+			select {
+			case <-t.C:
+				sc.profiler.captureProfiles(ctx)
+			case <-sc.profiler.terminator:
+				base.DebugfCtx(ctx, base.KeyAll, "Stopping background profiling goroutine")
+				t.Stop()
+				return
+			}
+		}
+	}()
+	base.InfofCtx(ctx, base.KeyAll, "Capturing CPU and heap profiles to %s every %v", base.UD(dir), sc.profiler.interval)
+}
+
+// captureProfiles captures a CPU and a heap profile, then removes the oldest profiles beyond maxProfiles.
+func (p *profilerContext) captureProfiles(ctx context.Context) {
+	if err := p.captureCPUProfile(); err != nil {
+		base.InfofCtx(ctx, base.KeyAll, "Skipped background CPU profile: %v", err)
+	}
+	if err := p.captureHeapProfile(); err != nil {
+		base.WarnfCtx(ctx, "Error capturing background heap profile: %v", err)
+	}
+	for _, profileType := range profileTypes {
+		if err := p.pruneProfiles(profileType); err != nil {
+			base.WarnfCtx(ctx, "Error removing old %s profiles: %v", profileType, err)
+		}
+	}
+}
+
+// captureCPUProfile samples the CPU for cpuDuration, unless profiling is stopped first.  Fails when a CPU profile
+// requested through the admin API is already running.
+func (p *profilerContext) captureCPUProfile() error {
+	path := p.profilePath(profileTypeCPU, time.Now())
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+		return err
+	}
+	t := time.NewTimer(p.cpuDuration)
+	select {
+	case <-t.C:
+	case <-p.terminator:
+		t.Stop()
+	}
+	pprof.StopCPUProfile()
+	return f.Close()
+}
+
+func (p *profilerContext) captureHeapProfile() error {
+	f, err := os.Create(p.profilePath(profileTypeHeap, time.Now()))
+	if err != nil {
+		return err
+	}
+	err = pprof.Lookup(profileTypeHeap).WriteTo(f, 0)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (p *profilerContext) profilePath(profileType string, captured time.Time) string {
+	return filepath.Join(p.dir, profileType+"-"+captured.UTC().Format(profileTimeFormat)+profileFileExt)
+}
+
+// pruneProfiles removes the oldest profiles of the given type, keeping the most recent maxProfiles.
+func (p *profilerContext) pruneProfiles(profileType string) error {
+	entries, err := p.history()
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.Type == profileType {
+			names = append(names, entry.Name)
+		}
+	}
+	for len(names) > p.maxProfiles {
+		if err := os.Remove(filepath.Join(p.dir, names[0])); err != nil {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// history returns the profiles in the profiling directory, oldest first.  Files that weren't written by the profiler
+// are ignored.
+func (p *profilerContext) history() ([]ProfileHistoryEntry, error) {
+	files, err := os.ReadDir(p.dir)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]ProfileHistoryEntry, 0, len(files))
+	for _, file := range files {
+		entry, ok := parseProfileName(file.Name())
+		if !ok || file.IsDir() {
+			continue
+		}
+		if info, err := file.Info(); err == nil {
+			entry.Size = info.Size()
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Captured.Before(entries[j].Captured)
+	})
+	return entries, nil
+}
+
+// parseProfileName returns the type and capture time of a profile from its file name.
+func parseProfileName(name string) (entry ProfileHistoryEntry, ok bool) {
+	profileType, captured, found := strings.Cut(strings.TrimSuffix(name, profileFileExt), "-")
+	if !found || !strings.HasSuffix(name, profileFileExt) || (profileType != profileTypeCPU && profileType != profileTypeHeap) {
+		return entry, false
+	}
+	capturedTime, err := time.Parse(profileTimeFormat, captured)
+	if err != nil {
+		return entry, false
+	}
+	return ProfileHistoryEntry{Name: name, Type: profileType, Captured: capturedTime}, true
+}
+
+// handleGetProfileHistory returns the profiles captured by the background profiler, oldest first.
+func (h *handler) handleGetProfileHistory() error {
+	if h.server.profiler.dir == "" {
+		return base.HTTPErrorf(http.StatusNotFound, "Background profiling is not enabled")
+	}
+	entries, err := h.server.profiler.history()
+	if err != nil {
+		return err
+	}
+	h.writeJSON(entries)
+	return nil
+}
+
+// handleGetProfileHistoryEntry downloads a profile captured by the background profiler, for use with go tool pprof.
+func (h *handler) handleGetProfileHistoryEntry() error {
+	if h.server.profiler.dir == "" {
+		return base.HTTPErrorf(http.StatusNotFound, "Background profiling is not enabled")
+	}
+	// Only serve files named like profiles, which can't refer to other directories
+	name := h.PathVar("profile")
+	if _, ok := parseProfileName(name); !ok || filepath.Base(name) != name {
+		return base.HTTPErrorf(http.StatusNotFound, "No such profile %q", name)
+	}
+	data, err := os.ReadFile(filepath.Join(h.server.profiler.dir, name))
+	if os.IsNotExist(err) {
+		return base.HTTPErrorf(http.StatusNotFound, "No such profile %q", name)
+	} else if err != nil {
+		return err
+	}
+	h.setHeader("Content-Type", "application/octet-stream")
+	h.setHeader("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	h.response.WriteHeader(http.StatusOK)
+	_, _ = h.response.Write(data)
+	return nil
+}
@@ -0,0 +1,145 @@
+// Copyright 2022-Present Couchbase, Inc.
+//
+// Use of this software is governed by the Business Source License included
+// in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+// in that file, in accordance with the Business Source License, use of this
+// software will be governed by the Apache License, Version 2.0, included in
+// the file licenses/APL2.txt.
+
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/couchbase/sync_gateway/base"
+)
+
+const (
+	// startupRetryInitialDelay is the delay before the first retry of a failed startup step.
+	startupRetryInitialDelay = time.Second
+	// startupRetryMaxDelay caps the exponential backoff between retries of a failed startup step.
+	startupRetryMaxDelay = 30 * time.Second
+)
+
+const (
+	ReadinessStarting = "starting" // The node is still starting its databases
+	ReadinessDegraded = "degraded" // The node has started, but some databases couldn't be loaded
+	ReadinessReady    = "ready"    // The node has started and all of its databases are loaded
+)
+
+// ReadinessStatus is the response to a GET of _ready.
+type ReadinessStatus struct {
+	State           string            `json:"state"`
+	FailedDatabases map[string]string `json:"failed_databases,omitempty"` // Databases that couldn't be loaded, with the error
+}
+
+// retryStartupStep calls fn with exponential backoff until it succeeds, or until the next retry would be after the
+// deadline, in which case the last error is returned.  A deadline in the past means fn is only called once.
+func retryStartupStep(ctx context.Context, description string, deadline time.Time, fn func() error) error {
+	delay := startupRetryInitialDelay
+	for {
+		err := fn()
+		if err == nil || time.Now().Add(delay).After(deadline) {
+			return err
+		}
+		base.WarnfCtx(ctx, "Couldn't %s, retrying in %v: %v", description, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+		delay *= 2
+		if delay > startupRetryMaxDelay {
+			delay = startupRetryMaxDelay
+		}
+	}
+}
+
+// setDatabaseLoadError records why the database's config couldn't be loaded, or clears it when err is nil.
+func (sc *ServerContext) setDatabaseLoadError(dbName string, err error) {
+	sc.databaseLoadErrorsLock.Lock()
+	defer sc.databaseLoadErrorsLock.Unlock()
+	if err == nil {
+		delete(sc.databaseLoadErrors, dbName)
+		return
+	}
+	if sc.databaseLoadErrors == nil {
+		sc.databaseLoadErrors = make(map[string]error)
+	}
+	sc.databaseLoadErrors[dbName] = err
+}
+
+// pruneDatabaseLoadErrors forgets the load errors of databases whose configs are no longer found.
+func (sc *ServerContext) pruneDatabaseLoadErrors(fetchedConfigs map[string]DatabaseConfig) {
+	sc.databaseLoadErrorsLock.Lock()
+	defer sc.databaseLoadErrorsLock.Unlock()
+	for dbName := range sc.databaseLoadErrors {
+		if _, ok := fetchedConfigs[dbName]; !ok {
+			delete(sc.databaseLoadErrors, dbName)
+		}
+	}
+}
+
+// DatabaseLoadErrors returns the errors of the databases whose configs couldn't be loaded, keyed by database name.
+func (sc *ServerContext) DatabaseLoadErrors() map[string]error {
+	sc.databaseLoadErrorsLock.Lock()
+	defer sc.databaseLoadErrorsLock.Unlock()
+	loadErrors := make(map[string]error, len(sc.databaseLoadErrors))
+	for dbName, err := range sc.databaseLoadErrors {
+		loadErrors[dbName] = err
+	}
+	return loadErrors
+}
+
+// databaseLoadError returns an error listing the databases whose configs couldn't be loaded, or nil if they all were.
+func (sc *ServerContext) databaseLoadError() error {
+	loadErrors := sc.DatabaseLoadErrors()
+	if len(loadErrors) == 0 {
+		return nil
+	}
+	dbNames := make([]string, 0, len(loadErrors))
+	for dbName := range loadErrors {
+		dbNames = append(dbNames, dbName)
+	}
+	sort.Strings(dbNames)
+	return fmt.Errorf("couldn't load databases: %s", strings.Join(dbNames, ", "))
+}
+
+// readiness returns whether the node has finished starting, and which of its databases couldn't be loaded.
+func (sc *ServerContext) readiness() ReadinessStatus {
+	select {
+	case <-sc.hasStarted:
+	default:
+		return ReadinessStatus{State: ReadinessStarting}
+	}
+	loadErrors := sc.DatabaseLoadErrors()
+	if len(loadErrors) == 0 {
+		return ReadinessStatus{State: ReadinessReady}
+	}
+	status := ReadinessStatus{State: ReadinessDegraded, FailedDatabases: make(map[string]string, len(loadErrors))}
+	for dbName, err := range loadErrors {
+		status.FailedDatabases[dbName] = err.Error()
+	}
+	return status
+}
+
+// HTTP handler for a GET of _ready, which reports whether the node is ready to serve requests.  Returns a 503 while the
+// node is starting, so that orchestration systems can hold back traffic until it's ready.  The databases that couldn't
+// be loaded are only reported on the admin API.
+func (h *handler) handleGetReady() error {
+	status := h.server.readiness()
+	if h.privs != adminPrivs {
+		status.FailedDatabases = nil
+	}
+	if status.State == ReadinessStarting {
+		h.writeJSONStatus(http.StatusServiceUnavailable, status)
+		return nil
+	}
+	h.writeJSON(status)
+	return nil
+}
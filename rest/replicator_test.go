@@ -3676,6 +3676,102 @@ func TestActiveReplicatorReconnectOnStartEventualSuccess(t *testing.T) {
 	}, "Expecting replication state to be running")
 }
 
+// TestActiveReplicatorReconnectAndCheckpointLagStats ensures the reconnect and checkpoint lag replication stats are
+// updated as the replicator reconnects and checkpoints.
+func TestActiveReplicatorReconnectAndCheckpointLagStats(t *testing.T) {
+
+	base.RequireNumTestBuckets(t, 2)
+
+	base.SetUpTestLogging(t, base.LevelInfo, base.KeyReplicate, base.KeyHTTP, base.KeyHTTPResp)
+
+	// Passive
+	tb2 := base.GetTestBucket(t)
+	rt2 := NewRestTester(t, &RestTesterConfig{
+		CustomTestBucket: tb2,
+	})
+	defer rt2.Close()
+
+	// Make rt2 listen on an actual HTTP port, so it can receive the blipsync request from rt1
+	srv := httptest.NewServer(rt2.TestPublicHandler())
+	defer srv.Close()
+
+	// Build remoteDBURL with basic auth creds for a user that doesn't exist yet
+	remoteDBURL, err := url.Parse(srv.URL + "/db")
+	require.NoError(t, err)
+	remoteDBURL.User = url.UserPassword("alice", "pass")
+
+	// Active
+	tb1 := base.GetTestBucket(t)
+	rt1 := NewRestTester(t, &RestTesterConfig{
+		CustomTestBucket: tb1,
+	})
+	defer rt1.Close()
+	ctx1 := rt1.Context()
+
+	replicationStats := base.SyncGatewayStats.NewDBStats(t.Name(), false, false, false).DBReplicatorStats(t.Name())
+	arConfig := db.ActiveReplicatorConfig{
+		ID:          t.Name(),
+		Direction:   db.ActiveReplicatorTypePushAndPull,
+		RemoteDBURL: remoteDBURL,
+		ActiveDB: &db.Database{
+			DatabaseContext: rt1.GetDatabase(),
+		},
+		Continuous: true,
+		// aggressive reconnect intervals for testing purposes
+		InitialReconnectInterval: time.Millisecond,
+		MaxReconnectInterval:     time.Millisecond * 50,
+		ReplicationStatsMap:      replicationStats,
+	}
+
+	ar := db.NewActiveReplicator(ctx1, &arConfig)
+	assert.Equal(t, int64(0), replicationStats.NumReconnectsPush.Value())
+	assert.Equal(t, int64(0), replicationStats.NumReconnectsPull.Value())
+
+	// Initial connection fails with 401, so the replicator reconnects until the user is created
+	err = ar.Start(ctx1)
+	defer func() { assert.NoError(t, ar.Stop()) }()
+	require.Error(t, err)
+
+	waitAndRequireCondition(t, func() bool {
+		return replicationStats.NumReconnectsPush.Value() > 1 && replicationStats.NumReconnectsPull.Value() > 1
+	}, "Expecting sgr_num_reconnects_push and sgr_num_reconnects_pull > 1")
+
+	resp := rt2.SendAdminRequest(http.MethodPut, "/db/_user/alice", `{"password":"pass", "admin_channels":["*"]}`)
+	RequireStatus(t, resp, http.StatusCreated)
+
+	waitAndRequireCondition(t, func() bool {
+		state, _ := ar.State()
+		return state == db.ReplicationStateRunning
+	}, "Expecting replication state to be running")
+
+	// Reconnects stop once connected
+	numReconnectsPush := replicationStats.NumReconnectsPush.Value()
+	assert.Equal(t, int64(0), replicationStats.NumReconnectsAbortedPush.Value())
+
+	resp = rt1.SendAdminRequest(http.MethodPut, "/db/doc1", `{"source":"rt1"}`)
+	RequireStatus(t, resp, http.StatusCreated)
+	_ = rt2.RequireWaitChanges(1, "0")
+
+	// Nothing is pending once the pushed sequence has been checkpointed
+	ar.Push.Checkpointer.CheckpointNow()
+	assert.Equal(t, int64(0), replicationStats.CheckpointLagPush.Value())
+
+	// Lag reflects sequences sent but not yet processed by the remote
+	ar.Push.Checkpointer.AddExpectedSeqs("1000", "1001")
+	ar.Push.Checkpointer.CheckpointNow()
+	assert.Equal(t, int64(2), replicationStats.CheckpointLagPush.Value())
+
+	ar.Push.Checkpointer.AddProcessedSeq("1000")
+	ar.Push.Checkpointer.CheckpointNow()
+	assert.Equal(t, int64(1), replicationStats.CheckpointLagPush.Value())
+
+	ar.Push.Checkpointer.AddProcessedSeq("1001")
+	ar.Push.Checkpointer.CheckpointNow()
+	assert.Equal(t, int64(0), replicationStats.CheckpointLagPush.Value())
+
+	assert.Equal(t, numReconnectsPush, replicationStats.NumReconnectsPush.Value())
+}
+
 // TestActiveReplicatorReconnectSendActions ensures ActiveReplicator reconnect retry loops exit when the replicator is stopped
 func TestActiveReplicatorReconnectSendActions(t *testing.T) {
 
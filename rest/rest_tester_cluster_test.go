@@ -222,3 +222,34 @@ func TestPersistentDbConfigWithInvalidUpsert(t *testing.T) {
 	})
 
 }
+
+func TestRestTesterNumNodes(t *testing.T) {
+	rt := NewRestTester(t, &RestTesterConfig{NumNodes: 2})
+	defer rt.Close()
+
+	require.Len(t, rt.Nodes(), 2)
+	assert.Same(t, rt, rt.Node(0))
+	assert.NotSame(t, rt.ServerContext(), rt.Node(1).ServerContext())
+
+	// A document written through one node can be read through the other
+	rt.PutDoc("doc1", `{"foo":"bar"}`)
+	body := rt.Node(1).GetDoc("doc1")
+	assert.Equal(t, "bar", body["foo"])
+}
+
+func TestRestTesterNumNodesPersistentConfig(t *testing.T) {
+	if base.UnitTestUrlIsWalrus() {
+		t.Skip("Persistent config requires Couchbase Server")
+	}
+
+	rt := NewRestTester(t, &RestTesterConfig{NumNodes: 2, persistentConfig: true})
+	defer rt.Close()
+
+	resp, err := rt.CreateDatabase("db", dbConfigForTestBucket(rt.TestBucket))
+	require.NoError(t, err)
+	RequireStatus(t, resp, http.StatusCreated)
+
+	// The database is loaded on demand by the other node in the config group
+	resp = rt.Node(1).SendAdminRequest(http.MethodGet, "/db/", "")
+	RequireStatus(t, resp, http.StatusOK)
+}
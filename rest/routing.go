@@ -41,6 +41,7 @@ func createCommonRouter(sc *ServerContext, privs handlerPrivs) (root, db, keyspa
 	root.StrictSlash(true)
 	// Global operations:
 	root.Handle("/", makeHandler(sc, privs, nil, nil, (*handler).handleRoot)).Methods("GET", "HEAD")
+	root.Handle("/_ready", makeHandler(sc, privs, nil, nil, (*handler).handleGetReady)).Methods("GET", "HEAD")
 
 	// Operations on databases:
 	root.Handle("/{db:"+dbRegex+"}/", makeOfflineHandler(sc, privs, []Permission{PermDevOps}, nil, (*handler).handleGetDB)).Methods("GET", "HEAD")
@@ -63,12 +64,12 @@ func createCommonRouter(sc *ServerContext, privs handlerPrivs) (root, db, keyspa
 	keyspace.Handle("/_bulk_docs", makeHandler(sc, privs, []Permission{PermWriteAppData}, nil, (*handler).handleBulkDocs)).Methods("POST")
 	keyspace.Handle("/_bulk_get", makeHandler(sc, privs, []Permission{PermReadAppData}, nil, (*handler).handleBulkGet)).Methods("POST")
 	keyspace.Handle("/_revs_diff", makeHandler(sc, privs, []Permission{PermWriteAppData}, nil, (*handler).handleRevsDiff)).Methods("POST")
+	keyspace.Handle("/_changes", makeHandler(sc, privs, []Permission{PermReadAppData}, nil, (*handler).handleChanges)).Methods("GET", "HEAD", "POST")
 
 	// Database operations (i.e. multi-collection):
 	dbr := root.PathPrefix("/{db:" + dbRegex + "}/").Subrouter()
 	dbr.StrictSlash(true)
 	dbr.Handle("/_all_docs", makeHandler(sc, privs, []Permission{PermReadAppData}, nil, (*handler).handleAllDocs)).Methods("GET", "HEAD", "POST")
-	dbr.Handle("/_changes", makeHandler(sc, privs, []Permission{PermReadAppData}, nil, (*handler).handleChanges)).Methods("GET", "HEAD", "POST")
 	dbr.Handle("/_design/{ddoc}", makeHandler(sc, privs, []Permission{PermReadAppData}, nil, (*handler).handleGetDesignDoc)).Methods("GET", "HEAD")
 	dbr.Handle("/_design/{ddoc}", makeHandler(sc, privs, []Permission{PermWriteAppData}, nil, (*handler).handlePutDesignDoc)).Methods("PUT")
 	dbr.Handle("/_design/{ddoc}", makeHandler(sc, privs, []Permission{PermWriteAppData}, nil, (*handler).handleDeleteDesignDoc)).Methods("DELETE")
@@ -93,6 +94,8 @@ func createCommonRouter(sc *ServerContext, privs handlerPrivs) (root, db, keyspa
 	dbr.Handle("/_oidc_callback", makeHandler(sc, publicPrivs, nil, nil, (*handler).handleOIDCCallback)).Methods("GET")
 	dbr.Handle("/_oidc_refresh", makeHandler(sc, publicPrivs, nil, nil, (*handler).handleOIDCRefresh)).Methods("GET")
 	dbr.Handle("/_oidc_challenge", makeHandler(sc, publicPrivs, nil, nil, (*handler).handleOIDCChallenge)).Methods("GET")
+	dbr.Handle("/_oidc_logout", makeHandler(sc, publicPrivs, nil, nil, (*handler).handleOIDCLogout)).Methods("GET")
+	dbr.Handle("/_oidc_backchannel_logout", makeHandler(sc, publicPrivs, nil, nil, (*handler).handleOIDCBackchannelLogout)).Methods("POST")
 
 	oidcr := dbr.PathPrefix("/_oidc_testing").Subrouter()
 
@@ -153,6 +156,8 @@ func CreateAdminRouter(sc *ServerContext) *mux.Router {
 		makeOfflineHandler(sc, adminPrivs, []Permission{PermUpdateDb}, nil, (*handler).handlePostResync)).Methods("POST")
 	keyspace.Handle("/_purge",
 		makeHandler(sc, adminPrivs, []Permission{PermWriteAppData}, nil, (*handler).handlePurge)).Methods("POST")
+	keyspace.Handle("/_import",
+		makeHandler(sc, adminPrivs, []Permission{PermWriteAppData}, nil, (*handler).handleImport)).Methods("POST")
 	keyspace.Handle("/_raw/{docid:"+docRegex+"}",
 		makeHandler(sc, adminPrivs, []Permission{PermReadAppData}, nil, (*handler).handleGetRawDoc)).Methods("GET", "HEAD")
 	keyspace.Handle("/_revtree/{docid:"+docRegex+"}",
@@ -181,11 +186,40 @@ func CreateAdminRouter(sc *ServerContext) *mux.Router {
 	dbr.Handle("/_user/{name}",
 		makeHandler(sc, adminPrivs, []Permission{PermWritePrincipal}, nil, (*handler).deleteUser)).Methods("DELETE")
 
+	dbr.Handle("/_user/{name}/_session",
+		makeHandler(sc, adminPrivs, []Permission{PermReadPrincipal}, nil, (*handler).getUserSessions)).Methods("GET", "HEAD")
 	dbr.Handle("/_user/{name}/_session",
 		makeHandler(sc, adminPrivs, []Permission{PermWritePrincipal}, nil, (*handler).deleteUserSessions)).Methods("DELETE")
 	dbr.Handle("/_user/{name}/_session/{sessionid}",
 		makeHandler(sc, adminPrivs, []Permission{PermWritePrincipal}, nil, (*handler).deleteUserSession)).Methods("DELETE")
 
+	dbr.Handle("/_scim/v2/ServiceProviderConfig",
+		makeHandler(sc, adminPrivs, []Permission{PermReadPrincipal}, nil, scimHandler((*handler).handleGetSCIMServiceProviderConfig))).Methods("GET")
+	dbr.Handle("/_scim/v2/Users",
+		makeHandler(sc, adminPrivs, []Permission{PermReadPrincipal}, nil, scimHandler((*handler).handleGetSCIMUsers))).Methods("GET")
+	dbr.Handle("/_scim/v2/Users",
+		makeHandler(sc, adminPrivs, []Permission{PermWritePrincipal}, nil, scimHandler((*handler).handlePostSCIMUser))).Methods("POST")
+	dbr.Handle("/_scim/v2/Users/{name}",
+		makeHandler(sc, adminPrivs, []Permission{PermReadPrincipal}, nil, scimHandler((*handler).handleGetSCIMUser))).Methods("GET")
+	dbr.Handle("/_scim/v2/Users/{name}",
+		makeHandler(sc, adminPrivs, []Permission{PermWritePrincipal}, nil, scimHandler((*handler).handlePutSCIMUser))).Methods("PUT")
+	dbr.Handle("/_scim/v2/Users/{name}",
+		makeHandler(sc, adminPrivs, []Permission{PermWritePrincipal}, nil, scimHandler((*handler).handlePatchSCIMUser))).Methods("PATCH")
+	dbr.Handle("/_scim/v2/Users/{name}",
+		makeHandler(sc, adminPrivs, []Permission{PermWritePrincipal}, nil, scimHandler((*handler).handleDeleteSCIMUser))).Methods("DELETE")
+	dbr.Handle("/_scim/v2/Groups",
+		makeHandler(sc, adminPrivs, []Permission{PermReadPrincipal}, nil, scimHandler((*handler).handleGetSCIMGroups))).Methods("GET")
+	dbr.Handle("/_scim/v2/Groups",
+		makeHandler(sc, adminPrivs, []Permission{PermWritePrincipal}, nil, scimHandler((*handler).handlePostSCIMGroup))).Methods("POST")
+	dbr.Handle("/_scim/v2/Groups/{name}",
+		makeHandler(sc, adminPrivs, []Permission{PermReadPrincipal}, nil, scimHandler((*handler).handleGetSCIMGroup))).Methods("GET")
+	dbr.Handle("/_scim/v2/Groups/{name}",
+		makeHandler(sc, adminPrivs, []Permission{PermWritePrincipal}, nil, scimHandler((*handler).handlePutSCIMGroup))).Methods("PUT")
+	dbr.Handle("/_scim/v2/Groups/{name}",
+		makeHandler(sc, adminPrivs, []Permission{PermWritePrincipal}, nil, scimHandler((*handler).handlePatchSCIMGroup))).Methods("PATCH")
+	dbr.Handle("/_scim/v2/Groups/{name}",
+		makeHandler(sc, adminPrivs, []Permission{PermWritePrincipal}, nil, scimHandler((*handler).handleDeleteSCIMGroup))).Methods("DELETE")
+
 	dbr.Handle("/_role/",
 		makeHandler(sc, adminPrivs, []Permission{PermReadPrincipal}, nil, (*handler).getRoles)).Methods("GET", "HEAD")
 	dbr.Handle("/_role/",
@@ -214,6 +248,14 @@ func CreateAdminRouter(sc *ServerContext) *mux.Router {
 		makeHandler(sc, adminPrivs, []Permission{PermReadReplications}, nil, (*handler).getReplicationStatus)).Methods("GET", "HEAD")
 	dbr.Handle("/_replicationStatus/{replicationID}",
 		makeHandler(sc, adminPrivs, []Permission{PermWriteReplications}, nil, (*handler).putReplicationStatus)).Methods("PUT")
+	dbr.Handle("/_replicationStatus/{replicationID}/_checkpoint",
+		makeHandler(sc, adminPrivs, []Permission{PermReadReplications}, nil, (*handler).getReplicationCheckpoints)).Methods("GET", "HEAD")
+	dbr.Handle("/_replicationStatus/{replicationID}/_checkpoint/reset",
+		makeHandler(sc, adminPrivs, []Permission{PermWriteReplications}, nil, (*handler).postReplicationCheckpointsReset)).Methods("POST")
+	dbr.Handle("/_replicationStatus/{replicationID}/_rejected",
+		makeHandler(sc, adminPrivs, []Permission{PermReadReplications}, nil, (*handler).getReplicationRejectedRevs)).Methods("GET", "HEAD")
+	dbr.Handle("/_replicationStatus/{replicationID}/_rejected/retry",
+		makeHandler(sc, adminPrivs, []Permission{PermWriteReplications}, nil, (*handler).postReplicationRejectedRevsRetry)).Methods("POST")
 	dbr.Handle("/_config",
 		makeOfflineHandler(sc, adminPrivs, []Permission{PermUpdateDb}, nil, (*handler).handleGetDbConfig)).Methods("GET")
 	dbr.Handle("/_config",
@@ -225,12 +267,28 @@ func CreateAdminRouter(sc *ServerContext) *mux.Router {
 		makeOfflineHandler(sc, adminPrivs, []Permission{PermUpdateDb, PermConfigureSyncFn}, nil, (*handler).handlePutDbConfigSync)).Methods("PUT")
 	dbr.Handle("/_config/sync",
 		makeOfflineHandler(sc, adminPrivs, []Permission{PermUpdateDb, PermConfigureSyncFn}, nil, (*handler).handleDeleteDbConfigSync)).Methods("DELETE")
+	dbr.Handle("/_config/effective_sync",
+		makeOfflineHandler(sc, adminPrivs, []Permission{PermUpdateDb, PermConfigureSyncFn}, nil, (*handler).handleGetDbConfigEffectiveSync)).Methods("GET")
 	dbr.Handle("/_config/import_filter",
 		makeOfflineHandler(sc, adminPrivs, []Permission{PermUpdateDb}, nil, (*handler).handleGetDbConfigImportFilter)).Methods("GET")
 	dbr.Handle("/_config/import_filter",
 		makeOfflineHandler(sc, adminPrivs, []Permission{PermUpdateDb}, nil, (*handler).handlePutDbConfigImportFilter)).Methods("PUT")
 	dbr.Handle("/_config/import_filter",
 		makeOfflineHandler(sc, adminPrivs, []Permission{PermUpdateDb}, nil, (*handler).handleDeleteDbConfigImportFilter)).Methods("DELETE")
+	dbr.Handle("/_config/logging",
+		makeOfflineHandler(sc, adminPrivs, []Permission{PermDevOps}, nil, (*handler).handleGetDbConfigLogging)).Methods("GET")
+	dbr.Handle("/_config/logging",
+		makeOfflineHandler(sc, adminPrivs, []Permission{PermDevOps}, nil, (*handler).handlePutDbConfigLogging)).Methods("PUT")
+	dbr.Handle("/_config/logging",
+		makeOfflineHandler(sc, adminPrivs, []Permission{PermDevOps}, nil, (*handler).handleDeleteDbConfigLogging)).Methods("DELETE")
+	dbr.Handle("/_recent_errors",
+		makeOfflineHandler(sc, adminPrivs, []Permission{PermDevOps}, nil, (*handler).handleGetRecentErrors)).Methods("GET")
+	dbr.Handle("/_clients",
+		makeOfflineHandler(sc, adminPrivs, []Permission{PermDevOps}, nil, (*handler).handleGetClients)).Methods("GET")
+	dbr.Handle("/_config/_history",
+		makeOfflineHandler(sc, adminPrivs, []Permission{PermUpdateDb}, nil, (*handler).handleGetDbConfigHistory)).Methods("GET")
+	dbr.Handle("/_config/_rollback/{version}",
+		makeOfflineHandler(sc, adminPrivs, []Permission{PermUpdateDb}, nil, (*handler).handlePostDbConfigRollback)).Methods("POST")
 
 	dbr.Handle("/_flush",
 		makeHandler(sc, adminPrivs, []Permission{PermDevOps}, nil, (*handler).handleFlush)).Methods("POST")
@@ -244,6 +302,14 @@ func CreateAdminRouter(sc *ServerContext) *mux.Router {
 		makeHandler(sc, adminPrivs, []Permission{PermReadAppData}, nil, (*handler).handleView)).Methods("GET")
 	dbr.Handle("/_dumpchannel/{channel}",
 		makeHandler(sc, adminPrivs, []Permission{PermReadAppData}, nil, (*handler).handleDumpChannel)).Methods("GET")
+	dbr.Handle("/_channels",
+		makeHandler(sc, adminPrivs, []Permission{PermReadAppData}, nil, (*handler).handleGetChannels)).Methods("GET")
+	dbr.Handle("/_dcp",
+		makeHandler(sc, adminPrivs, []Permission{PermDevOps}, nil, (*handler).handleGetDCP)).Methods("GET")
+	dbr.Handle("/_migrate_metadata",
+		makeHandler(sc, adminPrivs, []Permission{PermUpdateDb}, nil, (*handler).handleGetMigrateMetadata)).Methods("GET")
+	dbr.Handle("/_migrate_metadata",
+		makeHandler(sc, adminPrivs, []Permission{PermUpdateDb}, nil, (*handler).handlePostMigrateMetadata)).Methods("POST")
 	dbr.Handle("/_repair",
 		makeHandler(sc, adminPrivs, []Permission{PermUpdateDb}, nil, (*handler).handleRepair)).Methods("POST")
 
@@ -256,10 +322,31 @@ func CreateAdminRouter(sc *ServerContext) *mux.Router {
 		makeHandler(sc, adminPrivs, []Permission{PermDevOps}, nil, (*handler).handleGetConfig)).Methods("GET")
 	r.Handle("/_config",
 		makeHandler(sc, adminPrivs, []Permission{PermDevOps}, nil, (*handler).handlePutConfig)).Methods("PUT")
+	r.Handle("/_config/_reload",
+		makeHandler(sc, adminPrivs, []Permission{PermDevOps}, nil, (*handler).handlePostReloadStartupConfig)).Methods("POST")
+	r.Handle("/_config/_validate",
+		makeHandler(sc, adminPrivs, []Permission{PermDevOps}, nil, (*handler).handlePostValidateStartupConfig)).Methods("POST")
+	r.Handle("/_config/groups",
+		makeHandler(sc, adminPrivs, []Permission{PermDevOps}, nil, (*handler).handleGetConfigGroups)).Methods("GET")
+	r.Handle("/_config/groups/{group}/_copy",
+		makeHandler(sc, adminPrivs, []Permission{PermDevOps}, nil, (*handler).handlePostConfigGroupCopy)).Methods("POST")
 
 	r.Handle("/_status",
 		makeHandler(sc, adminPrivs, []Permission{PermDevOps}, nil, (*handler).handleGetStatus)).Methods("GET")
 
+	r.Handle("/_cluster",
+		makeHandler(sc, adminPrivs, []Permission{PermDevOps}, nil, (*handler).handleGetCluster)).Methods("GET")
+	r.Handle("/_cluster/import_partitions",
+		makeHandler(sc, adminPrivs, []Permission{PermDevOps}, nil, (*handler).handleGetImportPartitions)).Methods("GET")
+	r.Handle("/_cluster/import_partitions",
+		makeHandler(sc, adminPrivs, []Permission{PermDevOps}, nil, (*handler).handlePutImportPartitions)).Methods("PUT")
+
+	r.Handle("/_serverless/usage",
+		makeHandler(sc, adminPrivs, []Permission{PermDevOps}, nil, (*handler).handleGetServerlessUsage)).Methods("GET")
+
+	r.Handle("/_whoami",
+		makeAuthenticationOnlyHandler(sc, adminPrivs, (*handler).handleWhoAmI)).Methods("GET")
+
 	r.Handle("/_sgcollect_info",
 		makeHandler(sc, adminPrivs, []Permission{PermDevOps}, nil, (*handler).handleSGCollectStatus)).Methods("GET")
 	r.Handle("/_sgcollect_info",
@@ -272,6 +359,10 @@ func CreateAdminRouter(sc *ServerContext) *mux.Router {
 		makeHandler(sc, adminPrivs, []Permission{PermStatsExport}, nil, (*handler).handleStats)).Methods("GET")
 	r.Handle(kDebugURLPathPrefix,
 		makeHandler(sc, adminPrivs, []Permission{PermStatsExport}, nil, (*handler).handleExpvar)).Methods("GET")
+	r.Handle("/_profile/history",
+		makeHandler(sc, adminPrivs, []Permission{PermDevOps}, nil, (*handler).handleGetProfileHistory)).Methods("GET")
+	r.Handle("/_profile/history/{profile}",
+		makeHandler(sc, adminPrivs, []Permission{PermDevOps}, nil, (*handler).handleGetProfileHistoryEntry)).Methods("GET")
 	r.Handle("/_profile/{profilename}",
 		makeHandler(sc, adminPrivs, []Permission{PermDevOps}, nil, (*handler).handleProfiling)).Methods("POST")
 	r.Handle("/_profile",
@@ -369,11 +460,12 @@ func wrapRouter(sc *ServerContext, privs handlerPrivs, router *mux.Router) http.
 
 		// Inject CORS if enabled and requested and not admin port
 		originHeader := rq.Header["Origin"]
-		if privs != adminPrivs && sc.Config.API.CORS != nil && len(originHeader) > 0 {
-			origin := matchedOrigin(sc.Config.API.CORS.Origin, originHeader)
+		cors := sc.corsConfig()
+		if privs != adminPrivs && cors != nil && len(originHeader) > 0 {
+			origin := matchedOrigin(cors.Origin, originHeader)
 			response.Header().Add("Access-Control-Allow-Origin", origin)
 			response.Header().Add("Access-Control-Allow-Credentials", "true")
-			response.Header().Add("Access-Control-Allow-Headers", strings.Join(sc.Config.API.CORS.Headers, ", "))
+			response.Header().Add("Access-Control-Allow-Headers", strings.Join(cors.Headers, ", "))
 		}
 
 		if router.Match(rq, &match) {
@@ -394,8 +486,8 @@ func wrapRouter(sc *ServerContext, privs handlerPrivs, router *mux.Router) http.
 				h.writeStatus(http.StatusNotFound, "unknown URL")
 			} else {
 				response.Header().Add("Allow", strings.Join(options, ", "))
-				if privs != adminPrivs && sc.Config.API.CORS != nil && len(originHeader) > 0 {
-					response.Header().Add("Access-Control-Max-Age", strconv.Itoa(sc.Config.API.CORS.MaxAge))
+				if privs != adminPrivs && cors != nil && len(originHeader) > 0 {
+					response.Header().Add("Access-Control-Max-Age", strconv.Itoa(cors.MaxAge))
 					response.Header().Add("Access-Control-Allow-Methods", strings.Join(options, ", "))
 				}
 				if rq.Method != "OPTIONS" {
@@ -405,6 +497,7 @@ func wrapRouter(sc *ServerContext, privs handlerPrivs, router *mux.Router) http.
 				}
 			}
 			h.logDuration(true)
+			h.endSpan()
 		}
 	})
 }
@@ -0,0 +1,937 @@
+// Copyright 2022-Present Couchbase, Inc.
+//
+// Use of this software is governed by the Business Source License included
+// in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+// in that file, in accordance with the Business Source License, use of this
+// software will be governed by the Apache License, Version 2.0, included in
+// the file licenses/APL2.txt.
+
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/couchbase/sync_gateway/auth"
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/couchbase/sync_gateway/db"
+	"github.com/gorilla/mux"
+)
+
+// SCIM 2.0 (RFC 7643, RFC 7644) provisioning of users and roles.  SCIM Users map onto Sync Gateway users, and SCIM
+// Groups onto roles, with group membership stored as each member's explicit roles.  Explicit channels are carried in
+// the Sync Gateway extension schema.
+//
+// The members of each group are also recorded alongside the role, so that a group can be read without scanning every
+// user.  Users granted a role through other APIs aren't members of the corresponding group until added via SCIM.
+
+const (
+	scimContentType = "application/scim+json"
+
+	scimSchemaUser                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimSchemaGroup                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimSchemaListResponse          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimSchemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	scimSchemaSyncGateway           = "urn:ietf:params:scim:schemas:extension:syncgateway:2.0:Principal"
+	scimSchemaError                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+
+	scimResourceTypeUser  = "User"
+	scimResourceTypeGroup = "Group"
+
+	scimDefaultCount = 100
+
+	scimGroupDocType     = "scim"   // Special doc type of the docs recording group membership
+	scimGroupDocIDPrefix = "group:" // Prefix of the IDs of the docs recording group membership, followed by the role name
+)
+
+type scimMultiValued struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+type scimSyncGatewayExtension struct {
+	Channels []string `json:"channels"`
+}
+
+type scimMeta struct {
+	ResourceType string `json:"resourceType"`
+	Location     string `json:"location"`
+}
+
+type scimUser struct {
+	Schemas     []string                  `json:"schemas"`
+	ID          string                    `json:"id,omitempty"`
+	UserName    string                    `json:"userName"`
+	Active      *bool                     `json:"active,omitempty"`
+	Emails      []scimMultiValued         `json:"emails,omitempty"`
+	Password    *string                   `json:"password,omitempty"` // Write-only
+	Groups      []scimMultiValued         `json:"groups,omitempty"`   // Read-only
+	SyncGateway *scimSyncGatewayExtension `json:"urn:ietf:params:scim:schemas:extension:syncgateway:2.0:Principal,omitempty"`
+	Meta        *scimMeta                 `json:"meta,omitempty"`
+}
+
+type scimGroup struct {
+	Schemas     []string                  `json:"schemas"`
+	ID          string                    `json:"id,omitempty"`
+	DisplayName string                    `json:"displayName"`
+	Members     []scimMultiValued         `json:"members,omitempty"`
+	SyncGateway *scimSyncGatewayExtension `json:"urn:ietf:params:scim:schemas:extension:syncgateway:2.0:Principal,omitempty"`
+	Meta        *scimMeta                 `json:"meta,omitempty"`
+}
+
+type scimListResponse struct {
+	Schemas      []string      `json:"schemas"`
+	TotalResults int           `json:"totalResults"`
+	StartIndex   int           `json:"startIndex"`
+	ItemsPerPage int           `json:"itemsPerPage"`
+	Resources    []interface{} `json:"Resources"`
+}
+
+type scimError struct {
+	Schemas []string `json:"schemas"`
+	Status  string   `json:"status"`
+	Detail  string   `json:"detail,omitempty"`
+}
+
+// scimGroupMembership records the members of a group.  Members being removed are kept in PendingRemovals until their
+// roles have been updated, so that an update that fails part way through is completed when retried.
+type scimGroupMembership struct {
+	Rev             string   `json:"_rev,omitempty"`
+	Members         []string `json:"members,omitempty"`
+	PendingRemovals []string `json:"pending_removals,omitempty"`
+}
+
+type scimPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []scimPatchOperation `json:"Operations"`
+}
+
+type scimPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// scimFilterRegexp matches the equality filters used by identity providers to look up an existing resource, e.g.
+// userName eq "alice"
+var scimFilterRegexp = regexp.MustCompile(`^\s*([A-Za-z.]+)\s+eq\s+"((?:[^"\\]|\\.)*)"\s*$`)
+
+// scimMemberFilterPathRegexp matches a path removing a single group member, e.g. members[value eq "alice"]
+var scimMemberFilterPathRegexp = regexp.MustCompile(`^members\[\s*value\s+eq\s+"((?:[^"\\]|\\.)*)"\s*\]$`)
+
+// GET /{db}/_scim/v2/ServiceProviderConfig
+func (h *handler) handleGetSCIMServiceProviderConfig() error {
+	supported := func(b bool) map[string]interface{} { return map[string]interface{}{"supported": b} }
+	return h.writeSCIMResponse(http.StatusOK, map[string]interface{}{
+		"schemas":        []string{scimSchemaServiceProviderConfig},
+		"patch":          supported(true),
+		"bulk":           map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]interface{}{"supported": true, "maxResults": scimDefaultCount},
+		"changePassword": supported(true),
+		"sort":           supported(false),
+		"etag":           supported(false),
+		"authenticationSchemes": []map[string]interface{}{
+			{"type": "httpbasic", "name": "HTTP Basic", "description": "Authentication using Couchbase Server RBAC credentials"},
+		},
+	})
+}
+
+// GET /{db}/_scim/v2/Users
+func (h *handler) handleGetSCIMUsers() error {
+	users, _, err := h.db.AllPrincipalIDs(h.ctx())
+	if err != nil {
+		return err
+	}
+	names, err := h.filterSCIMNames(users, "userName")
+	if err != nil {
+		return err
+	}
+	return h.writeSCIMList(names, func(name string) (interface{}, error) {
+		return h.getSCIMUser(name)
+	})
+}
+
+// POST /{db}/_scim/v2/Users
+func (h *handler) handlePostSCIMUser() error {
+	var resource scimUser
+	if err := h.readSCIMJSON(&resource); err != nil {
+		return err
+	}
+	if resource.UserName == "" {
+		return base.HTTPErrorf(http.StatusBadRequest, "Missing userName")
+	}
+	if err := h.putSCIMUser(&resource, false); err != nil {
+		return err
+	}
+	return h.respondWithSCIMUser(http.StatusCreated, resource.UserName)
+}
+
+// GET /{db}/_scim/v2/Users/{name}
+func (h *handler) handleGetSCIMUser() error {
+	user, err := h.getSCIMUser(mux.Vars(h.rq)["name"])
+	if err != nil {
+		return err
+	}
+	return h.writeSCIMResponse(http.StatusOK, user)
+}
+
+// PUT /{db}/_scim/v2/Users/{name} replaces the user's attributes.  Explicit channels are only replaced when the Sync
+// Gateway extension is present.
+func (h *handler) handlePutSCIMUser() error {
+	name := mux.Vars(h.rq)["name"]
+	if _, err := h.getSCIMUser(name); err != nil {
+		return err
+	}
+	var resource scimUser
+	if err := h.readSCIMJSON(&resource); err != nil {
+		return err
+	}
+	if resource.UserName != name {
+		return base.HTTPErrorf(http.StatusBadRequest, "userName mismatch (can't change userName)")
+	}
+	if err := h.putSCIMUser(&resource, true); err != nil {
+		return err
+	}
+	return h.respondWithSCIMUser(http.StatusOK, name)
+}
+
+// PATCH /{db}/_scim/v2/Users/{name}
+func (h *handler) handlePatchSCIMUser() error {
+	name := mux.Vars(h.rq)["name"]
+	resource, err := h.getSCIMUser(name)
+	if err != nil {
+		return err
+	}
+	var patch scimPatchRequest
+	if err := h.readSCIMJSON(&patch); err != nil {
+		return err
+	}
+	for _, op := range patch.Operations {
+		if err := resource.applyPatchOperation(op); err != nil {
+			return err
+		}
+	}
+	if resource.UserName != name {
+		return base.HTTPErrorf(http.StatusBadRequest, "userName mismatch (can't change userName)")
+	}
+	if err := h.putSCIMUser(resource, true); err != nil {
+		return err
+	}
+	return h.respondWithSCIMUser(http.StatusOK, name)
+}
+
+// DELETE /{db}/_scim/v2/Users/{name}
+func (h *handler) handleDeleteSCIMUser() error {
+	name := mux.Vars(h.rq)["name"]
+	if name == base.GuestUsername {
+		return kNotFoundError
+	}
+	authenticator := h.db.Authenticator(h.ctx())
+	user, err := authenticator.GetUser(name)
+	if user == nil {
+		if err == nil {
+			err = kNotFoundError
+		}
+		return err
+	}
+	if err := authenticator.DeleteUser(user); err != nil {
+		return err
+	}
+	h.writeStatus(http.StatusNoContent, "")
+	return nil
+}
+
+// GET /{db}/_scim/v2/Groups
+func (h *handler) handleGetSCIMGroups() error {
+	roles, err := h.db.GetRoleIDs(h.ctx())
+	if err != nil {
+		return err
+	}
+	names, err := h.filterSCIMNames(roles, "displayName")
+	if err != nil {
+		return err
+	}
+	includeMembers := !h.scimMembersExcluded()
+	return h.writeSCIMList(names, func(name string) (interface{}, error) {
+		return h.getSCIMGroup(name, includeMembers)
+	})
+}
+
+// POST /{db}/_scim/v2/Groups
+func (h *handler) handlePostSCIMGroup() error {
+	var resource scimGroup
+	if err := h.readSCIMJSON(&resource); err != nil {
+		return err
+	}
+	if resource.DisplayName == "" {
+		return base.HTTPErrorf(http.StatusBadRequest, "Missing displayName")
+	}
+	if err := h.putSCIMGroup(&resource, false); err != nil {
+		return err
+	}
+	return h.respondWithSCIMGroup(http.StatusCreated, resource.DisplayName)
+}
+
+// GET /{db}/_scim/v2/Groups/{name}
+func (h *handler) handleGetSCIMGroup() error {
+	group, err := h.getSCIMGroup(mux.Vars(h.rq)["name"], !h.scimMembersExcluded())
+	if err != nil {
+		return err
+	}
+	return h.writeSCIMResponse(http.StatusOK, group)
+}
+
+// PUT /{db}/_scim/v2/Groups/{name} replaces the group's members.  Explicit channels are only replaced when the Sync
+// Gateway extension is present.
+func (h *handler) handlePutSCIMGroup() error {
+	name := mux.Vars(h.rq)["name"]
+	if _, err := h.getSCIMGroup(name, false); err != nil {
+		return err
+	}
+	var resource scimGroup
+	if err := h.readSCIMJSON(&resource); err != nil {
+		return err
+	}
+	if resource.DisplayName != name {
+		return base.HTTPErrorf(http.StatusBadRequest, "displayName mismatch (can't change displayName)")
+	}
+	if err := h.putSCIMGroup(&resource, true); err != nil {
+		return err
+	}
+	return h.respondWithSCIMGroup(http.StatusOK, name)
+}
+
+// PATCH /{db}/_scim/v2/Groups/{name}
+func (h *handler) handlePatchSCIMGroup() error {
+	name := mux.Vars(h.rq)["name"]
+	resource, err := h.getSCIMGroup(name, true)
+	if err != nil {
+		return err
+	}
+	var patch scimPatchRequest
+	if err := h.readSCIMJSON(&patch); err != nil {
+		return err
+	}
+	for _, op := range patch.Operations {
+		if err := resource.applyPatchOperation(op); err != nil {
+			return err
+		}
+	}
+	if resource.DisplayName != name {
+		return base.HTTPErrorf(http.StatusBadRequest, "displayName mismatch (can't change displayName)")
+	}
+	if err := h.putSCIMGroup(resource, true); err != nil {
+		return err
+	}
+	return h.respondWithSCIMGroup(http.StatusOK, name)
+}
+
+// DELETE /{db}/_scim/v2/Groups/{name}
+func (h *handler) handleDeleteSCIMGroup() error {
+	name := mux.Vars(h.rq)["name"]
+	if err := h.db.DeleteRole(h.ctx(), name, false); err != nil {
+		return err
+	}
+	membership, err := h.getSCIMGroupMembership(name)
+	if err != nil {
+		return err
+	}
+	if membership.Rev != "" {
+		if err := h.db.DeleteSpecial(scimGroupDocType, scimGroupDocIDPrefix+name, membership.Rev); err != nil {
+			return err
+		}
+	}
+	h.writeStatus(http.StatusNoContent, "")
+	return nil
+}
+
+// getSCIMUser returns the SCIM representation of the given user.
+func (h *handler) getSCIMUser(name string) (*scimUser, error) {
+	if name == base.GuestUsername {
+		return nil, kNotFoundError
+	}
+	user, err := h.db.Authenticator(h.ctx()).GetUser(name)
+	if user == nil {
+		if err == nil {
+			err = kNotFoundError
+		}
+		return nil, err
+	}
+
+	resource := &scimUser{
+		Schemas:     []string{scimSchemaUser, scimSchemaSyncGateway},
+		ID:          user.Name(),
+		UserName:    user.Name(),
+		Active:      base.BoolPtr(!user.Disabled()),
+		SyncGateway: &scimSyncGatewayExtension{Channels: user.ExplicitChannels().AsSet().ToArray()},
+		Meta:        &scimMeta{ResourceType: scimResourceTypeUser, Location: h.scimLocation("Users", user.Name())},
+	}
+	sort.Strings(resource.SyncGateway.Channels)
+	if email := user.Email(); email != "" {
+		resource.Emails = []scimMultiValued{{Value: email, Primary: true}}
+	}
+	roles := user.ExplicitRoles().AsSet().ToArray()
+	sort.Strings(roles)
+	for _, role := range roles {
+		resource.Groups = append(resource.Groups, scimMultiValued{Value: role, Display: role, Ref: h.scimLocation("Groups", role)})
+	}
+	return resource, nil
+}
+
+// putSCIMUser creates or replaces a user from its SCIM representation.
+func (h *handler) putSCIMUser(resource *scimUser, allowReplace bool) error {
+	if resource.UserName == base.GuestUsername {
+		return base.HTTPErrorf(http.StatusBadRequest, "The %s user can't be provisioned", base.GuestUsername)
+	}
+	if err := auth.ValidatePrincipalName(resource.UserName); err != nil {
+		return base.HTTPErrorf(http.StatusBadRequest, err.Error())
+	}
+
+	email := ""
+	for i, e := range resource.Emails {
+		if i == 0 || e.Primary {
+			email = e.Value
+		}
+	}
+	active := resource.Active == nil || *resource.Active
+	password := resource.Password
+	if password == nil && !allowReplace {
+		// Users provisioned without a password are expected to authenticate via OpenID Connect, so are given a
+		// random password in the same way as users registered on first OpenID Connect login.
+		secret, err := base.GenerateRandomSecret()
+		if err != nil {
+			return err
+		}
+		password = &secret
+	}
+	principal := auth.PrincipalConfig{
+		Name:     base.StringPtr(resource.UserName),
+		Email:    &email,
+		Disabled: base.BoolPtr(!active),
+		Password: password,
+	}
+	if resource.SyncGateway != nil {
+		principal.ExplicitChannels = base.SetFromArray(resource.SyncGateway.Channels)
+	}
+
+	replaced, err := h.db.UpdatePrincipal(h.ctx(), &principal, true, allowReplace)
+	if err != nil {
+		return err
+	}
+	// on update with a new password, remove previous user sessions
+	if replaced && resource.Password != nil {
+		return h.db.DeleteUserSessions(h.ctx(), resource.UserName)
+	}
+	return nil
+}
+
+func (h *handler) respondWithSCIMUser(status int, name string) error {
+	resource, err := h.getSCIMUser(name)
+	if err != nil {
+		return err
+	}
+	return h.writeSCIMResponse(status, resource)
+}
+
+// getSCIMGroup returns the SCIM representation of the given role, including its members when includeMembers is set.
+func (h *handler) getSCIMGroup(name string, includeMembers bool) (*scimGroup, error) {
+	role, err := h.db.Authenticator(h.ctx()).GetRole(name)
+	if role == nil {
+		if err == nil {
+			err = kNotFoundError
+		}
+		return nil, err
+	}
+
+	resource := &scimGroup{
+		Schemas:     []string{scimSchemaGroup, scimSchemaSyncGateway},
+		ID:          role.Name(),
+		DisplayName: role.Name(),
+		SyncGateway: &scimSyncGatewayExtension{Channels: role.ExplicitChannels().AsSet().ToArray()},
+		Meta:        &scimMeta{ResourceType: scimResourceTypeGroup, Location: h.scimLocation("Groups", role.Name())},
+	}
+	sort.Strings(resource.SyncGateway.Channels)
+	if includeMembers {
+		if resource.Members, err = h.getSCIMGroupMembers(role.Name()); err != nil {
+			return nil, err
+		}
+	}
+	return resource, nil
+}
+
+// getSCIMGroupMembers returns the members recorded for the group that are still users with the role as an explicit
+// role, so reading a group only loads its own members.
+func (h *handler) getSCIMGroupMembers(roleName string) ([]scimMultiValued, error) {
+	membership, err := h.getSCIMGroupMembership(roleName)
+	if err != nil {
+		return nil, err
+	}
+	authenticator := h.db.Authenticator(h.ctx())
+	var members []scimMultiValued
+	for _, name := range membership.Members {
+		user, err := authenticator.GetUser(name)
+		if err != nil {
+			return nil, err
+		}
+		if user == nil || !user.ExplicitRoles().Contains(roleName) {
+			continue
+		}
+		members = append(members, scimMultiValued{Value: name, Display: name, Ref: h.scimLocation("Users", name)})
+	}
+	return members, nil
+}
+
+// getSCIMGroupMembership returns the recorded membership of the group, which is empty if none has been recorded.
+func (h *handler) getSCIMGroupMembership(roleName string) (*scimGroupMembership, error) {
+	docBytes, err := h.db.GetSpecialBytes(scimGroupDocType, scimGroupDocIDPrefix+roleName)
+	if err != nil {
+		if base.IsKeyNotFoundError(h.db.Bucket, err) {
+			return &scimGroupMembership{}, nil
+		}
+		return nil, err
+	}
+	var membership scimGroupMembership
+	if err := base.JSONUnmarshal(docBytes, &membership); err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+// putSCIMGroupMembership records the membership of the group.  Fails with a conflict if the membership was updated
+// since it was read, in which case the request can be retried.
+func (h *handler) putSCIMGroupMembership(roleName string, membership *scimGroupMembership) error {
+	body := db.Body{db.BodyRev: membership.Rev, "members": membership.Members}
+	if membership.Rev == "" {
+		delete(body, db.BodyRev)
+	}
+	if len(membership.PendingRemovals) > 0 {
+		body["pending_removals"] = membership.PendingRemovals
+	}
+	rev, err := h.db.PutSpecial(scimGroupDocType, scimGroupDocIDPrefix+roleName, body)
+	if err != nil {
+		return err
+	}
+	membership.Rev = rev
+	return nil
+}
+
+// putSCIMGroup creates or replaces a role from its SCIM representation, and updates the explicit roles of its members.
+func (h *handler) putSCIMGroup(resource *scimGroup, allowReplace bool) error {
+	if err := auth.ValidatePrincipalName(resource.DisplayName); err != nil {
+		return base.HTTPErrorf(http.StatusBadRequest, err.Error())
+	}
+
+	authenticator := h.db.Authenticator(h.ctx())
+	newMembers := make(base.Set, len(resource.Members))
+	for _, member := range resource.Members {
+		if user, err := authenticator.GetUser(member.Value); err != nil {
+			return err
+		} else if user == nil || member.Value == base.GuestUsername {
+			return base.HTTPErrorf(http.StatusBadRequest, "No such user %q", member.Value)
+		}
+		newMembers.Add(member.Value)
+	}
+
+	principal := auth.PrincipalConfig{Name: base.StringPtr(resource.DisplayName)}
+	if resource.SyncGateway != nil {
+		principal.ExplicitChannels = base.SetFromArray(resource.SyncGateway.Channels)
+	}
+	if _, err := h.db.UpdatePrincipal(h.ctx(), &principal, false, allowReplace); err != nil {
+		return err
+	}
+	return h.updateSCIMGroupMembers(resource.DisplayName, newMembers)
+}
+
+// updateSCIMGroupMembers sets the members of the group.  The new membership is recorded before the members' roles are
+// updated, along with the members being removed, and each role update is idempotent - so if an update fails, retrying
+// the request completes it.
+func (h *handler) updateSCIMGroupMembers(roleName string, newMembers base.Set) error {
+	membership, err := h.getSCIMGroupMembership(roleName)
+	if err != nil {
+		return err
+	}
+	removals := base.Set{}
+	for _, name := range append(membership.Members, membership.PendingRemovals...) {
+		if !newMembers.Contains(name) {
+			removals.Add(name)
+		}
+	}
+	membership.Members = newMembers.ToArray()
+	sort.Strings(membership.Members)
+	membership.PendingRemovals = removals.ToArray()
+	sort.Strings(membership.PendingRemovals)
+	if err := h.putSCIMGroupMembership(roleName, membership); err != nil {
+		return err
+	}
+
+	for _, name := range membership.Members {
+		if err := h.updateSCIMMemberRoles(name, roleName, true); err != nil {
+			return err
+		}
+	}
+	if len(membership.PendingRemovals) == 0 {
+		return nil
+	}
+	for _, name := range membership.PendingRemovals {
+		if err := h.updateSCIMMemberRoles(name, roleName, false); err != nil {
+			return err
+		}
+	}
+	membership.PendingRemovals = nil
+	return h.putSCIMGroupMembership(roleName, membership)
+}
+
+// updateSCIMMemberRoles adds or removes a role from a user's explicit roles.  Users that already have the requested
+// roles, or that no longer exist, aren't updated.
+func (h *handler) updateSCIMMemberRoles(userName, roleName string, add bool) error {
+	user, err := h.db.Authenticator(h.ctx()).GetUser(userName)
+	if err != nil || user == nil {
+		return err
+	}
+	roles := user.ExplicitRoles().AsSet()
+	if roles == nil {
+		roles = base.Set{}
+	}
+	if roles.Contains(roleName) == add {
+		return nil
+	}
+	if add {
+		roles.Add(roleName)
+	} else {
+		delete(roles, roleName)
+	}
+	_, err = h.db.UpdatePrincipal(h.ctx(), &auth.PrincipalConfig{Name: base.StringPtr(userName), ExplicitRoleNames: roles}, true, true)
+	return err
+}
+
+func (h *handler) respondWithSCIMGroup(status int, name string) error {
+	resource, err := h.getSCIMGroup(name, true)
+	if err != nil {
+		return err
+	}
+	return h.writeSCIMResponse(status, resource)
+}
+
+// applyPatchOperation applies a SCIM PATCH operation to the user.
+func (u *scimUser) applyPatchOperation(op scimPatchOperation) error {
+	opName := strings.ToLower(op.Op)
+	if opName != "add" && opName != "replace" && opName != "remove" {
+		return base.HTTPErrorf(http.StatusBadRequest, "Unsupported PATCH op %q", op.Op)
+	}
+
+	// Without a path, the value is an object containing the attributes to add or replace
+	if op.Path == "" {
+		if opName == "remove" {
+			return base.HTTPErrorf(http.StatusBadRequest, "PATCH remove requires a path")
+		}
+		var attributes map[string]json.RawMessage
+		if err := base.JSONUnmarshal(op.Value, &attributes); err != nil {
+			return base.HTTPErrorf(http.StatusBadRequest, "Invalid PATCH value: %v", err)
+		}
+		for path, value := range attributes {
+			if err := u.applyPatchOperation(scimPatchOperation{Op: op.Op, Path: path, Value: value}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var err error
+	switch strings.ToLower(op.Path) {
+	case "username":
+		if opName != "remove" {
+			err = base.JSONUnmarshal(op.Value, &u.UserName)
+		}
+	case "active":
+		if opName == "remove" {
+			u.Active = nil
+		} else {
+			err = unmarshalSCIMBool(op.Value, &u.Active)
+		}
+	case "password":
+		if opName == "remove" {
+			u.Password = base.StringPtr("")
+		} else {
+			err = base.JSONUnmarshal(op.Value, &u.Password)
+		}
+	case "emails", `emails[primary eq true].value`, `emails[type eq "work"].value`:
+		if opName == "remove" {
+			u.Emails = nil
+		} else if strings.HasSuffix(op.Path, ".value") {
+			var email string
+			err = base.JSONUnmarshal(op.Value, &email)
+			u.Emails = []scimMultiValued{{Value: email, Primary: true}}
+		} else {
+			err = base.JSONUnmarshal(op.Value, &u.Emails)
+		}
+	case strings.ToLower(scimSchemaSyncGateway):
+		if opName == "remove" {
+			u.SyncGateway = &scimSyncGatewayExtension{Channels: []string{}}
+		} else {
+			err = base.JSONUnmarshal(op.Value, &u.SyncGateway)
+		}
+	case strings.ToLower(scimSchemaSyncGateway + ":channels"):
+		u.SyncGateway, err = patchSCIMChannels(opName, u.SyncGateway, op.Value)
+	default:
+		// Attributes that aren't stored by Sync Gateway (e.g. name, displayName) are ignored
+		return nil
+	}
+	if err != nil {
+		return base.HTTPErrorf(http.StatusBadRequest, "Invalid PATCH value for %s: %v", op.Path, err)
+	}
+	return nil
+}
+
+// applyPatchOperation applies a SCIM PATCH operation to the group.
+func (g *scimGroup) applyPatchOperation(op scimPatchOperation) error {
+	opName := strings.ToLower(op.Op)
+	if opName != "add" && opName != "replace" && opName != "remove" {
+		return base.HTTPErrorf(http.StatusBadRequest, "Unsupported PATCH op %q", op.Op)
+	}
+
+	if op.Path == "" {
+		if opName == "remove" {
+			return base.HTTPErrorf(http.StatusBadRequest, "PATCH remove requires a path")
+		}
+		var attributes map[string]json.RawMessage
+		if err := base.JSONUnmarshal(op.Value, &attributes); err != nil {
+			return base.HTTPErrorf(http.StatusBadRequest, "Invalid PATCH value: %v", err)
+		}
+		for path, value := range attributes {
+			if err := g.applyPatchOperation(scimPatchOperation{Op: op.Op, Path: path, Value: value}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Removal of a single member, e.g. members[value eq "alice"]
+	if match := scimMemberFilterPathRegexp.FindStringSubmatch(op.Path); match != nil {
+		if opName != "remove" {
+			return base.HTTPErrorf(http.StatusBadRequest, "Unsupported PATCH path %q for op %q", op.Path, op.Op)
+		}
+		g.removeMembers(match[1])
+		return nil
+	}
+
+	var err error
+	switch strings.ToLower(op.Path) {
+	case "displayname":
+		if opName != "remove" {
+			err = base.JSONUnmarshal(op.Value, &g.DisplayName)
+		}
+	case "members":
+		var members []scimMultiValued
+		if len(op.Value) > 0 {
+			if err = base.JSONUnmarshal(op.Value, &members); err != nil {
+				break
+			}
+		}
+		switch opName {
+		case "add":
+			g.removeMembers(scimMemberValues(members)...)
+			g.Members = append(g.Members, members...)
+		case "replace":
+			g.Members = members
+		case "remove":
+			if len(members) == 0 {
+				g.Members = nil
+			} else {
+				g.removeMembers(scimMemberValues(members)...)
+			}
+		}
+	case strings.ToLower(scimSchemaSyncGateway):
+		if opName == "remove" {
+			g.SyncGateway = &scimSyncGatewayExtension{Channels: []string{}}
+		} else {
+			err = base.JSONUnmarshal(op.Value, &g.SyncGateway)
+		}
+	case strings.ToLower(scimSchemaSyncGateway + ":channels"):
+		g.SyncGateway, err = patchSCIMChannels(opName, g.SyncGateway, op.Value)
+	default:
+		return nil
+	}
+	if err != nil {
+		return base.HTTPErrorf(http.StatusBadRequest, "Invalid PATCH value for %s: %v", op.Path, err)
+	}
+	return nil
+}
+
+func (g *scimGroup) removeMembers(values ...string) {
+	remove := base.SetFromArray(values)
+	members := make([]scimMultiValued, 0, len(g.Members))
+	for _, member := range g.Members {
+		if !remove.Contains(member.Value) {
+			members = append(members, member)
+		}
+	}
+	g.Members = members
+}
+
+func scimMemberValues(members []scimMultiValued) []string {
+	values := make([]string, 0, len(members))
+	for _, member := range members {
+		values = append(values, member.Value)
+	}
+	return values
+}
+
+// patchSCIMChannels applies a PATCH operation to the channels of the Sync Gateway extension.
+func patchSCIMChannels(opName string, extension *scimSyncGatewayExtension, value json.RawMessage) (*scimSyncGatewayExtension, error) {
+	var channels []string
+	if len(value) > 0 {
+		if err := base.JSONUnmarshal(value, &channels); err != nil {
+			return extension, err
+		}
+	}
+	current := base.Set{}
+	if extension != nil {
+		current = base.SetFromArray(extension.Channels)
+	}
+	switch opName {
+	case "add":
+		current = current.Update(base.SetFromArray(channels))
+	case "replace":
+		current = base.SetFromArray(channels)
+	case "remove":
+		if len(channels) == 0 {
+			current = base.Set{}
+		}
+		for _, channel := range channels {
+			delete(current, channel)
+		}
+	}
+	return &scimSyncGatewayExtension{Channels: current.ToArray()}, nil
+}
+
+// unmarshalSCIMBool unmarshals a boolean, accepting the string values sent by some identity providers.
+func unmarshalSCIMBool(value json.RawMessage, into **bool) error {
+	var b bool
+	if err := base.JSONUnmarshal(value, &b); err != nil {
+		var s string
+		if base.JSONUnmarshal(value, &s) != nil {
+			return err
+		}
+		if b, err = strconv.ParseBool(s); err != nil {
+			return err
+		}
+	}
+	*into = &b
+	return nil
+}
+
+// filterSCIMNames applies the request's filter query parameter to the given principal names.  Only equality filters
+// on the given attribute are supported.
+func (h *handler) filterSCIMNames(names []string, attribute string) ([]string, error) {
+	sort.Strings(names)
+	filter := h.getQuery("filter")
+	if filter == "" {
+		return names, nil
+	}
+	match := scimFilterRegexp.FindStringSubmatch(filter)
+	if match == nil || !strings.EqualFold(match[1], attribute) {
+		return nil, base.HTTPErrorf(http.StatusBadRequest, "Unsupported filter %q - only %s eq \"value\" is supported", filter, attribute)
+	}
+	value := strings.ReplaceAll(match[2], `\"`, `"`)
+	for _, name := range names {
+		if name == value {
+			return []string{name}, nil
+		}
+	}
+	return []string{}, nil
+}
+
+// scimMembersExcluded returns true if the request excludes group members via excludedAttributes.
+func (h *handler) scimMembersExcluded() bool {
+	for _, attribute := range strings.Split(h.getQuery("excludedAttributes"), ",") {
+		if strings.EqualFold(strings.TrimSpace(attribute), "members") {
+			return true
+		}
+	}
+	return false
+}
+
+// writeSCIMList writes a ListResponse for the page of names given by the startIndex and count query parameters.
+func (h *handler) writeSCIMList(names []string, getResource func(name string) (interface{}, error)) error {
+	startIndex := int(h.getIntQuery("startIndex", 1))
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	count := int(h.getIntQuery("count", scimDefaultCount))
+
+	resources := make([]interface{}, 0)
+	for i := startIndex - 1; i < len(names) && len(resources) < count; i++ {
+		resource, err := getResource(names[i])
+		if err != nil {
+			if base.IsDocNotFoundError(err) {
+				continue
+			}
+			return err
+		}
+		resources = append(resources, resource)
+	}
+	return h.writeSCIMResponse(http.StatusOK, scimListResponse{
+		Schemas:      []string{scimSchemaListResponse},
+		TotalResults: len(names),
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+// readSCIMJSON reads a SCIM request body.  Unknown attributes are permitted, as identity providers commonly send
+// attributes that aren't stored by Sync Gateway.
+func (h *handler) readSCIMJSON(into interface{}) error {
+	contentType := h.rq.Header.Get("Content-Type")
+	if contentType != "" && !strings.HasPrefix(contentType, scimContentType) && !strings.HasPrefix(contentType, "application/json") {
+		return base.HTTPErrorf(http.StatusUnsupportedMediaType, "Invalid content type %s - expected %s", contentType, scimContentType)
+	}
+	body, err := h.readBody()
+	if err != nil {
+		return err
+	}
+	if err := base.JSONUnmarshal(body, into); err != nil {
+		return base.HTTPErrorf(http.StatusBadRequest, "Bad JSON: %s", err.Error())
+	}
+	return nil
+}
+
+// scimHandler wraps a SCIM handler method so that errors are written in the SCIM error format (RFC 7644 3.12).
+func scimHandler(method handlerMethod) handlerMethod {
+	return func(h *handler) error {
+		err := method(h)
+		if err == nil {
+			return nil
+		}
+		status, message := base.ErrorAsHTTPStatus(err)
+		base.InfofCtx(h.ctx(), base.KeyHTTP, "%s: SCIM request failed with status %d: %v", h.formatSerialNumber(), status, err)
+		return h.writeSCIMResponse(status, scimError{Schemas: []string{scimSchemaError}, Status: strconv.Itoa(status), Detail: message})
+	}
+}
+
+// writeSCIMResponse writes a SCIM resource with the application/scim+json content type.
+func (h *handler) writeSCIMResponse(status int, value interface{}) error {
+	bytes, err := base.JSONMarshal(value)
+	if err != nil {
+		return err
+	}
+	h.setHeader("Content-Type", scimContentType)
+	h.setHeader("Content-Length", fmt.Sprintf("%d", len(bytes)))
+	h.response.WriteHeader(status)
+	h.setStatus(status, "")
+	_, _ = h.response.Write(bytes)
+	return nil
+}
+
+// scimLocation returns the location of a SCIM resource on the admin API.
+func (h *handler) scimLocation(resourceType, name string) string {
+	return "/" + url.PathEscape(h.db.Name) + "/_scim/v2/" + resourceType + "/" + url.PathEscape(name)
+}
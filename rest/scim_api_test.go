@@ -0,0 +1,462 @@
+// Copyright 2022-Present Couchbase, Inc.
+//
+// Use of this software is governed by the Business Source License included
+// in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+// in that file, in accordance with the Business Source License, use of this
+// software will be governed by the Apache License, Version 2.0, included in
+// the file licenses/APL2.txt.
+
+package rest
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/couchbase/sync_gateway/base"
+	"github.com/couchbase/sync_gateway/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSCIMUsers(t *testing.T) {
+	rt := NewRestTester(t, nil)
+	defer rt.Close()
+	ctx := rt.Context()
+
+	scimHeaders := map[string]string{"Content-Type": scimContentType, "Accept": scimContentType}
+
+	// Create a user
+	response := rt.SendAdminRequestWithHeaders(http.MethodPost, "/db/_scim/v2/Users", `{
+		"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+		"userName": "alice",
+		"name": {"givenName": "Alice"},
+		"emails": [{"value": "alice@example.com", "primary": true}],
+		"active": true,
+		"urn:ietf:params:scim:schemas:extension:syncgateway:2.0:Principal": {"channels": ["a", "b"]}
+	}`, scimHeaders)
+	RequireStatus(t, response, http.StatusCreated)
+	assert.Equal(t, scimContentType, response.Header().Get("Content-Type"))
+
+	var user scimUser
+	require.NoError(t, base.JSONUnmarshal(response.Body.Bytes(), &user))
+	assert.Equal(t, "alice", user.ID)
+	assert.Equal(t, []scimMultiValued{{Value: "alice@example.com", Primary: true}}, user.Emails)
+	assert.Equal(t, []string{"a", "b"}, user.SyncGateway.Channels)
+	assert.Nil(t, user.Password)
+
+	// Creating the same user again conflicts
+	response = rt.SendAdminRequestWithHeaders(http.MethodPost, "/db/_scim/v2/Users", `{"userName": "alice"}`, scimHeaders)
+	RequireStatus(t, response, http.StatusConflict)
+
+	// Look up the user by filter
+	response = rt.SendAdminRequestWithHeaders(http.MethodGet, `/db/_scim/v2/Users?filter=userName%20eq%20%22alice%22`, "", scimHeaders)
+	RequireStatus(t, response, http.StatusOK)
+	var list scimListResponse
+	require.NoError(t, base.JSONUnmarshal(response.Body.Bytes(), &list))
+	assert.Equal(t, 1, list.TotalResults)
+	require.Len(t, list.Resources, 1)
+
+	response = rt.SendAdminRequestWithHeaders(http.MethodGet, `/db/_scim/v2/Users?filter=userName%20eq%20%22bob%22`, "", scimHeaders)
+	RequireStatus(t, response, http.StatusOK)
+	require.NoError(t, base.JSONUnmarshal(response.Body.Bytes(), &list))
+	assert.Equal(t, 0, list.TotalResults)
+
+	// Deactivate the user and add a channel via PATCH
+	response = rt.SendAdminRequestWithHeaders(http.MethodPatch, "/db/_scim/v2/Users/alice", `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [
+			{"op": "Replace", "path": "active", "value": "False"},
+			{"op": "add", "path": "urn:ietf:params:scim:schemas:extension:syncgateway:2.0:Principal:channels", "value": ["c"]}
+		]
+	}`, scimHeaders)
+	RequireStatus(t, response, http.StatusOK)
+
+	authUser, err := rt.GetDatabase().Authenticator(ctx).GetUser("alice")
+	require.NoError(t, err)
+	assert.True(t, authUser.Disabled())
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, authUser.ExplicitChannels().AsSet().ToArray())
+
+	// Replacing the user without the extension leaves channels unchanged
+	response = rt.SendAdminRequestWithHeaders(http.MethodPut, "/db/_scim/v2/Users/alice", `{"userName": "alice", "active": true}`, scimHeaders)
+	RequireStatus(t, response, http.StatusOK)
+	authUser, err = rt.GetDatabase().Authenticator(ctx).GetUser("alice")
+	require.NoError(t, err)
+	assert.False(t, authUser.Disabled())
+	assert.Equal(t, "", authUser.Email())
+	assert.Len(t, authUser.ExplicitChannels(), 3)
+
+	// The user name can't be changed
+	response = rt.SendAdminRequestWithHeaders(http.MethodPut, "/db/_scim/v2/Users/alice", `{"userName": "bob"}`, scimHeaders)
+	RequireStatus(t, response, http.StatusBadRequest)
+
+	response = rt.SendAdminRequestWithHeaders(http.MethodDelete, "/db/_scim/v2/Users/alice", "", scimHeaders)
+	RequireStatus(t, response, http.StatusNoContent)
+	RequireStatus(t, rt.SendAdminRequest(http.MethodGet, "/db/_scim/v2/Users/alice", ""), http.StatusNotFound)
+}
+
+func TestSCIMGroups(t *testing.T) {
+	rt := NewRestTester(t, nil)
+	defer rt.Close()
+	ctx := rt.Context()
+
+	scimHeaders := map[string]string{"Content-Type": scimContentType, "Accept": scimContentType}
+
+	for _, name := range []string{"alice", "bob"} {
+		response := rt.SendAdminRequestWithHeaders(http.MethodPost, "/db/_scim/v2/Users", `{"userName": "`+name+`"}`, scimHeaders)
+		RequireStatus(t, response, http.StatusCreated)
+	}
+
+	// Create a group with a member
+	response := rt.SendAdminRequestWithHeaders(http.MethodPost, "/db/_scim/v2/Groups", `{
+		"schemas": ["urn:ietf:params:scim:schemas:core:2.0:Group"],
+		"displayName": "editors",
+		"members": [{"value": "alice"}],
+		"urn:ietf:params:scim:schemas:extension:syncgateway:2.0:Principal": {"channels": ["drafts"]}
+	}`, scimHeaders)
+	RequireStatus(t, response, http.StatusCreated)
+	var group scimGroup
+	require.NoError(t, base.JSONUnmarshal(response.Body.Bytes(), &group))
+	assert.Equal(t, "editors", group.ID)
+	require.Len(t, group.Members, 1)
+	assert.Equal(t, "alice", group.Members[0].Value)
+	assert.Equal(t, []string{"drafts"}, group.SyncGateway.Channels)
+
+	// Membership is stored as the user's explicit roles
+	alice, err := rt.GetDatabase().Authenticator(ctx).GetUser("alice")
+	require.NoError(t, err)
+	assert.True(t, alice.ExplicitRoles().Contains("editors"))
+
+	// Add bob and remove alice via PATCH
+	response = rt.SendAdminRequestWithHeaders(http.MethodPatch, "/db/_scim/v2/Groups/editors", `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [
+			{"op": "add", "path": "members", "value": [{"value": "bob"}]},
+			{"op": "remove", "path": "members[value eq \"alice\"]"}
+		]
+	}`, scimHeaders)
+	RequireStatus(t, response, http.StatusOK)
+	require.NoError(t, base.JSONUnmarshal(response.Body.Bytes(), &group))
+	require.Len(t, group.Members, 1)
+	assert.Equal(t, "bob", group.Members[0].Value)
+
+	alice, err = rt.GetDatabase().Authenticator(ctx).GetUser("alice")
+	require.NoError(t, err)
+	assert.False(t, alice.ExplicitRoles().Contains("editors"))
+	bob, err := rt.GetDatabase().Authenticator(ctx).GetUser("bob")
+	require.NoError(t, err)
+	assert.True(t, bob.ExplicitRoles().Contains("editors"))
+
+	// Unknown members are rejected
+	response = rt.SendAdminRequestWithHeaders(http.MethodPatch, "/db/_scim/v2/Groups/editors", `{
+		"Operations": [{"op": "add", "path": "members", "value": [{"value": "nobody"}]}]
+	}`, scimHeaders)
+	RequireStatus(t, response, http.StatusBadRequest)
+
+	// The user's groups are included in the user resource
+	response = rt.SendAdminRequestWithHeaders(http.MethodGet, "/db/_scim/v2/Users/bob", "", scimHeaders)
+	RequireStatus(t, response, http.StatusOK)
+	var user scimUser
+	require.NoError(t, base.JSONUnmarshal(response.Body.Bytes(), &user))
+	require.Len(t, user.Groups, 1)
+	assert.Equal(t, "editors", user.Groups[0].Value)
+
+	response = rt.SendAdminRequestWithHeaders(http.MethodGet, `/db/_scim/v2/Groups?filter=displayName%20eq%20%22editors%22&excludedAttributes=members`, "", scimHeaders)
+	RequireStatus(t, response, http.StatusOK)
+	var list scimListResponse
+	require.NoError(t, base.JSONUnmarshal(response.Body.Bytes(), &list))
+	assert.Equal(t, 1, list.TotalResults)
+
+	// Unsupported filters are rejected
+	response = rt.SendAdminRequestWithHeaders(http.MethodGet, `/db/_scim/v2/Groups?filter=displayName%20sw%20%22ed%22`, "", scimHeaders)
+	RequireStatus(t, response, http.StatusBadRequest)
+
+	response = rt.SendAdminRequestWithHeaders(http.MethodDelete, "/db/_scim/v2/Groups/editors", "", scimHeaders)
+	RequireStatus(t, response, http.StatusNoContent)
+	RequireStatus(t, rt.SendAdminRequest(http.MethodGet, "/db/_scim/v2/Groups/editors", ""), http.StatusNotFound)
+}
+
+func TestSCIMGroupPatchMembers(t *testing.T) {
+	testCases := []struct {
+		name            string
+		operations      string
+		expectedMembers []string
+	}{
+		{
+			name:            "add",
+			operations:      `[{"op": "add", "path": "members", "value": [{"value": "carol"}]}]`,
+			expectedMembers: []string{"alice", "bob", "carol"},
+		},
+		{
+			name:            "add existing member",
+			operations:      `[{"op": "add", "path": "members", "value": [{"value": "alice"}]}]`,
+			expectedMembers: []string{"alice", "bob"},
+		},
+		{
+			name:            "remove by filter",
+			operations:      `[{"op": "remove", "path": "members[value eq \"alice\"]"}]`,
+			expectedMembers: []string{"bob"},
+		},
+		{
+			name:            "remove by value",
+			operations:      `[{"op": "remove", "path": "members", "value": [{"value": "bob"}]}]`,
+			expectedMembers: []string{"alice"},
+		},
+		{
+			name:            "remove all",
+			operations:      `[{"op": "remove", "path": "members"}]`,
+			expectedMembers: nil,
+		},
+		{
+			name:            "replace",
+			operations:      `[{"op": "replace", "path": "members", "value": [{"value": "carol"}]}]`,
+			expectedMembers: []string{"carol"},
+		},
+		{
+			name:            "replace without path",
+			operations:      `[{"op": "replace", "value": {"members": [{"value": "bob"}, {"value": "carol"}]}}]`,
+			expectedMembers: []string{"bob", "carol"},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			rt := NewRestTester(t, nil)
+			defer rt.Close()
+			ctx := rt.Context()
+
+			scimHeaders := map[string]string{"Content-Type": scimContentType, "Accept": scimContentType}
+			for _, name := range []string{"alice", "bob", "carol"} {
+				response := rt.SendAdminRequestWithHeaders(http.MethodPost, "/db/_scim/v2/Users", `{"userName": "`+name+`"}`, scimHeaders)
+				RequireStatus(t, response, http.StatusCreated)
+			}
+			response := rt.SendAdminRequestWithHeaders(http.MethodPost, "/db/_scim/v2/Groups", `{"displayName": "editors", "members": [{"value": "alice"}, {"value": "bob"}]}`, scimHeaders)
+			RequireStatus(t, response, http.StatusCreated)
+
+			response = rt.SendAdminRequestWithHeaders(http.MethodPatch, "/db/_scim/v2/Groups/editors", `{"Operations": `+testCase.operations+`}`, scimHeaders)
+			RequireStatus(t, response, http.StatusOK)
+			var group scimGroup
+			require.NoError(t, base.JSONUnmarshal(response.Body.Bytes(), &group))
+			assert.ElementsMatch(t, testCase.expectedMembers, scimMemberValues(group.Members))
+
+			// The members' explicit roles match the group's members
+			expectedMembers := base.SetFromArray(testCase.expectedMembers)
+			for _, name := range []string{"alice", "bob", "carol"} {
+				user, err := rt.GetDatabase().Authenticator(ctx).GetUser(name)
+				require.NoError(t, err)
+				assert.Equal(t, expectedMembers.Contains(name), user.ExplicitRoles().Contains("editors"), "Unexpected roles for user %s", name)
+			}
+		})
+	}
+}
+
+func TestSCIMGroupPendingRemovals(t *testing.T) {
+	rt := NewRestTester(t, nil)
+	defer rt.Close()
+	ctx := rt.Context()
+
+	scimHeaders := map[string]string{"Content-Type": scimContentType, "Accept": scimContentType}
+	for _, name := range []string{"alice", "bob"} {
+		response := rt.SendAdminRequestWithHeaders(http.MethodPost, "/db/_scim/v2/Users", `{"userName": "`+name+`"}`, scimHeaders)
+		RequireStatus(t, response, http.StatusCreated)
+	}
+	response := rt.SendAdminRequestWithHeaders(http.MethodPost, "/db/_scim/v2/Groups", `{"displayName": "editors", "members": [{"value": "alice"}, {"value": "bob"}]}`, scimHeaders)
+	RequireStatus(t, response, http.StatusCreated)
+
+	// Simulate a request that recorded alice's removal but failed before updating her roles
+	database, err := db.CreateDatabase(rt.GetDatabase())
+	require.NoError(t, err)
+	docBytes, err := database.GetSpecialBytes(scimGroupDocType, scimGroupDocIDPrefix+"editors")
+	require.NoError(t, err)
+	var membership scimGroupMembership
+	require.NoError(t, base.JSONUnmarshal(docBytes, &membership))
+	_, err = database.PutSpecial(scimGroupDocType, scimGroupDocIDPrefix+"editors", db.Body{
+		db.BodyRev:         membership.Rev,
+		"members":          []string{"bob"},
+		"pending_removals": []string{"alice"},
+	})
+	require.NoError(t, err)
+
+	// alice still has the role, but is no longer listed as a member
+	alice, err := rt.GetDatabase().Authenticator(ctx).GetUser("alice")
+	require.NoError(t, err)
+	assert.True(t, alice.ExplicitRoles().Contains("editors"))
+	response = rt.SendAdminRequestWithHeaders(http.MethodGet, "/db/_scim/v2/Groups/editors", "", scimHeaders)
+	RequireStatus(t, response, http.StatusOK)
+	var group scimGroup
+	require.NoError(t, base.JSONUnmarshal(response.Body.Bytes(), &group))
+	assert.Equal(t, []string{"bob"}, scimMemberValues(group.Members))
+
+	// Retrying the update completes the removal
+	response = rt.SendAdminRequestWithHeaders(http.MethodPut, "/db/_scim/v2/Groups/editors", `{"displayName": "editors", "members": [{"value": "bob"}]}`, scimHeaders)
+	RequireStatus(t, response, http.StatusOK)
+	alice, err = rt.GetDatabase().Authenticator(ctx).GetUser("alice")
+	require.NoError(t, err)
+	assert.False(t, alice.ExplicitRoles().Contains("editors"))
+
+	docBytes, err = database.GetSpecialBytes(scimGroupDocType, scimGroupDocIDPrefix+"editors")
+	require.NoError(t, err)
+	membership = scimGroupMembership{}
+	require.NoError(t, base.JSONUnmarshal(docBytes, &membership))
+	assert.Equal(t, []string{"bob"}, membership.Members)
+	assert.Empty(t, membership.PendingRemovals)
+
+	// Roles granted outside SCIM don't make a user a member
+	response = rt.SendAdminRequest(http.MethodPut, "/db/_user/alice", `{"admin_roles": ["editors"]}`)
+	RequireStatus(t, response, http.StatusOK)
+	response = rt.SendAdminRequestWithHeaders(http.MethodGet, "/db/_scim/v2/Groups/editors", "", scimHeaders)
+	RequireStatus(t, response, http.StatusOK)
+	require.NoError(t, base.JSONUnmarshal(response.Body.Bytes(), &group))
+	assert.Equal(t, []string{"bob"}, scimMemberValues(group.Members))
+
+	// Deleting the group deletes its membership
+	response = rt.SendAdminRequestWithHeaders(http.MethodDelete, "/db/_scim/v2/Groups/editors", "", scimHeaders)
+	RequireStatus(t, response, http.StatusNoContent)
+	_, err = database.GetSpecialBytes(scimGroupDocType, scimGroupDocIDPrefix+"editors")
+	assert.True(t, base.IsKeyNotFoundError(rt.GetDatabase().Bucket, err))
+}
+
+func TestSCIMGroupFilters(t *testing.T) {
+	rt := NewRestTester(t, nil)
+	defer rt.Close()
+
+	scimHeaders := map[string]string{"Content-Type": scimContentType, "Accept": scimContentType}
+	for _, name := range []string{"editors", "readers"} {
+		response := rt.SendAdminRequestWithHeaders(http.MethodPost, "/db/_scim/v2/Groups", `{"displayName": "`+name+`"}`, scimHeaders)
+		RequireStatus(t, response, http.StatusCreated)
+	}
+
+	testCases := []struct {
+		name           string
+		filter         string
+		expectedStatus int
+		expectedGroups []string
+	}{
+		{
+			name:           "no filter",
+			expectedStatus: http.StatusOK,
+			expectedGroups: []string{"editors", "readers"},
+		},
+		{
+			name:           "displayName eq",
+			filter:         `displayName eq "readers"`,
+			expectedStatus: http.StatusOK,
+			expectedGroups: []string{"readers"},
+		},
+		{
+			name:           "no match",
+			filter:         `displayName eq "writers"`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "unsupported attribute",
+			filter:         `userName eq "editors"`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unsupported operator",
+			filter:         `displayName sw "ed"`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid filter",
+			filter:         `displayName eq`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			path := "/db/_scim/v2/Groups"
+			if testCase.filter != "" {
+				path += "?filter=" + url.QueryEscape(testCase.filter)
+			}
+			response := rt.SendAdminRequestWithHeaders(http.MethodGet, path, "", scimHeaders)
+			RequireStatus(t, response, testCase.expectedStatus)
+			if testCase.expectedStatus != http.StatusOK {
+				return
+			}
+			var list scimListResponse
+			require.NoError(t, base.JSONUnmarshal(response.Body.Bytes(), &list))
+			assert.Equal(t, len(testCase.expectedGroups), list.TotalResults)
+			var names []string
+			for _, resource := range list.Resources {
+				group, ok := resource.(map[string]interface{})
+				require.True(t, ok)
+				names = append(names, group["displayName"].(string))
+			}
+			assert.ElementsMatch(t, testCase.expectedGroups, names)
+		})
+	}
+}
+
+func TestSCIMErrorResponses(t *testing.T) {
+	rt := NewRestTester(t, nil)
+	defer rt.Close()
+
+	scimHeaders := map[string]string{"Content-Type": scimContentType, "Accept": scimContentType}
+	response := rt.SendAdminRequestWithHeaders(http.MethodPost, "/db/_scim/v2/Groups", `{"displayName": "editors"}`, scimHeaders)
+	RequireStatus(t, response, http.StatusCreated)
+
+	testCases := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+	}{
+		{
+			name:           "missing user",
+			method:         http.MethodGet,
+			path:           "/db/_scim/v2/Users/nobody",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "missing group",
+			method:         http.MethodPatch,
+			path:           "/db/_scim/v2/Groups/writers",
+			body:           `{"Operations": [{"op": "add", "path": "members", "value": []}]}`,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "existing group",
+			method:         http.MethodPost,
+			path:           "/db/_scim/v2/Groups",
+			body:           `{"displayName": "editors"}`,
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "unknown member",
+			method:         http.MethodPut,
+			path:           "/db/_scim/v2/Groups/editors",
+			body:           `{"displayName": "editors", "members": [{"value": "nobody"}]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unsupported op",
+			method:         http.MethodPatch,
+			path:           "/db/_scim/v2/Groups/editors",
+			body:           `{"Operations": [{"op": "move", "path": "members"}]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid JSON",
+			method:         http.MethodPost,
+			path:           "/db/_scim/v2/Users",
+			body:           `{"userName": `,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			response := rt.SendAdminRequestWithHeaders(testCase.method, testCase.path, testCase.body, scimHeaders)
+			RequireStatus(t, response, testCase.expectedStatus)
+			assert.Equal(t, scimContentType, response.Header().Get("Content-Type"))
+
+			var scimErr scimError
+			require.NoError(t, base.JSONUnmarshal(response.Body.Bytes(), &scimErr))
+			assert.Equal(t, []string{scimSchemaError}, scimErr.Schemas)
+			assert.Equal(t, strconv.Itoa(testCase.expectedStatus), scimErr.Status)
+			assert.NotEmpty(t, scimErr.Detail)
+		})
+	}
+}
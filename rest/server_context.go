@@ -20,6 +20,7 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -28,6 +29,8 @@ import (
 
 	"github.com/couchbase/sync_gateway/auth"
 
+	"github.com/coreos/go-oidc"
+	"github.com/couchbase/cbgt"
 	"github.com/couchbase/gocbcore/v10"
 	sgbucket "github.com/couchbase/sg-bucket"
 	"github.com/couchbase/sync_gateway/base"
@@ -38,6 +41,8 @@ import (
 const kStatsReportURL = "http://localhost:9999/stats"
 const kStatsReportInterval = time.Hour
 const kDefaultSlowQueryWarningThreshold = 500 // ms
+const kDefaultSyncFunctionSlowThreshold = 0   // ms - disabled
+const kDefaultSlowRequestThreshold = 0        // ms - disabled
 const KDefaultNumShards = 16
 
 var errCollectionsUnsupported = base.HTTPErrorf(http.StatusBadRequest, "Named collections specified in database config, but not supported by connected Couchbase Server.")
@@ -51,6 +56,11 @@ var ErrSuspendingDisallowed = errors.New("database does not allow suspending")
 type ServerContext struct {
 	Config                 *StartupConfig // The current runtime configuration of the node
 	initialStartupConfig   *StartupConfig // The configuration at startup of the node. Built from config file + flags
+	startupConfigPath      string         // Path of the startup config file, re-read when the startup config is reloaded
+	flagStartupConfig      *StartupConfig // The configuration from flags, which takes precedence over a reloaded config file
+	reloadedStartupConfig  *StartupConfig // The configuration from the most recent reload, nil until the startup config is first reloaded
+	reloadLock             sync.Mutex     // Serialises startup config reloads, and guards reloadedStartupConfig
+	reloadableConfigLock   sync.RWMutex   // Guards the fields of Config that can be changed by reloading the startup config
 	persistentConfig       bool
 	bucketDbName           map[string]string              // bucketDbName is a map of bucket to database name
 	dbConfigs              map[string]*DatabaseConfig     // dbConfigs is a map of db name to DatabaseConfig
@@ -59,14 +69,24 @@ type ServerContext struct {
 	statsContext           *statsContext
 	BootstrapContext       *bootstrapContext
 	HTTPClient             *http.Client
-	cpuPprofFileMutex      sync.Mutex      // Protect cpuPprofFile from concurrent Start and Stop CPU profiling requests
-	cpuPprofFile           *os.File        // An open file descriptor holds the reference during CPU profiling
-	_httpServers           []*http.Server  // A list of HTTP servers running under the ServerContext
-	GoCBAgent              *gocbcore.Agent // GoCB Agent to use when obtaining management endpoints
-	NoX509HTTPClient       *http.Client    // httpClient for the cluster that doesn't include x509 credentials, even if they are configured for the cluster
-	hasStarted             chan struct{}   // A channel that is closed via PostStartup once the ServerContext has fully started
-	LogContextID           string          // ID to differentiate log messages from different server context
-	fetchConfigsLastUpdate time.Time       // The last time fetchConfigsWithTTL() updated dbConfigs
+	cpuPprofFileMutex      sync.Mutex            // Protect cpuPprofFile from concurrent Start and Stop CPU profiling requests
+	cpuPprofFile           *os.File              // An open file descriptor holds the reference during CPU profiling
+	_httpServers           []*http.Server        // A list of HTTP servers running under the ServerContext
+	GoCBAgent              *gocbcore.Agent       // GoCB Agent to use when obtaining management endpoints
+	NoX509HTTPClient       *http.Client          // httpClient for the cluster that doesn't include x509 credentials, even if they are configured for the cluster
+	hasStarted             chan struct{}         // A channel that is closed via PostStartup once the ServerContext has fully started
+	LogContextID           string                // ID to differentiate log messages from different server context
+	fetchConfigsLastUpdate time.Time             // The last time fetchConfigsWithTTL() updated dbConfigs
+	adminJWTVerifier       *oidc.IDTokenVerifier // Verifies JWTs presented to the admin and metrics APIs, when api.admin_jwt is configured
+	nodeID                 string                // Identifies this node to the other nodes in the config group
+	startedAt              time.Time             // When the ServerContext was created
+	nodeRegistry           *nodeRegistryContext
+	profiler               *profilerContext
+	metricsExporter        *base.MetricsExporter // Pushes stats to remote sinks, nil when metrics_export isn't configured
+	databaseLoadErrors     map[string]error      // Why the configs of databases that couldn't be loaded failed, keyed by db name
+	databaseLoadErrorsLock sync.Mutex
+	clock                  base.Clock   // Source of time for the databases' sequence allocation, cache expiry, sessions and heartbeats
+	chaos                  *ServerChaos // Test only - fault injection hooks for DCP feeds and the bootstrap connection, nil unless EnableChaos was called
 }
 
 type bootstrapContext struct {
@@ -112,6 +132,11 @@ func NewServerContext(ctx context.Context, config *StartupConfig, persistentConf
 		statsContext:     &statsContext{},
 		BootstrapContext: &bootstrapContext{},
 		hasStarted:       make(chan struct{}),
+		nodeID:           cbgt.NewUUID(),
+		startedAt:        time.Now(),
+		nodeRegistry:     &nodeRegistryContext{},
+		profiler:         &profilerContext{},
+		clock:            base.SystemClock,
 	}
 
 	if base.ServerIsWalrus(sc.Config.Bootstrap.Server) {
@@ -125,7 +150,14 @@ func NewServerContext(ctx context.Context, config *StartupConfig, persistentConf
 		}
 	}
 
+	if sc.Config.API.AdminJWT != nil {
+		sc.adminJWTVerifier = newAdminJWTVerifier(context.Background(), sc.Config.API.AdminJWT)
+	}
+
 	sc.startStatsLogger(ctx)
+	sc.startNodeRegistryHeartbeat(ctx)
+	sc.startBackgroundProfiler(ctx)
+	sc.startMetricsExporter(ctx)
 
 	return sc
 }
@@ -171,6 +203,21 @@ func (sc *ServerContext) Close(ctx context.Context) {
 		base.InfofCtx(ctx, base.KeyAll, "Couldn't stop background config update worker: %v", err)
 	}
 
+	err = base.TerminateAndWaitForClose(sc.nodeRegistry.terminator, sc.nodeRegistry.doneChan, serverContextStopMaxWait)
+	if err != nil {
+		base.InfofCtx(ctx, base.KeyAll, "Couldn't stop node registry heartbeat: %v", err)
+	}
+
+	err = base.TerminateAndWaitForClose(sc.profiler.terminator, sc.profiler.doneChan, serverContextStopMaxWait)
+	if err != nil {
+		base.InfofCtx(ctx, base.KeyAll, "Couldn't stop background profiler: %v", err)
+	}
+
+	// Push the final stats before the databases are closed and their stats removed
+	if sc.metricsExporter != nil {
+		sc.metricsExporter.Stop(ctx)
+	}
+
 	sc.lock.Lock()
 	defer sc.lock.Unlock()
 
@@ -193,6 +240,11 @@ func (sc *ServerContext) Close(ctx context.Context) {
 			base.WarnfCtx(ctx, "Error closing agent connection: %v", err)
 		}
 	}
+
+	// Export the spans of the requests that have just been closed
+	if sc.Config.Tracing.OTLPEndpoint != "" {
+		base.StopTracing(ctx)
+	}
 }
 
 // Returns the DatabaseContext with the given name
@@ -337,6 +389,36 @@ func (sc *ServerContext) _reloadDatabaseWithConfig(ctx context.Context, config D
 	return err
 }
 
+// initializeDatabaseIndexes creates the views or GSI indexes the database needs in its bucket, if they don't already
+// exist, and waits for them to come online.  Returns whether the database uses views.
+func initializeDatabaseIndexes(ctx context.Context, bucket base.Bucket, spec base.BucketSpec, config *DatabaseConfig) (useViews bool, err error) {
+	// If using a walrus bucket, force use of views
+	useViews = base.BoolDefault(config.UseViews, false)
+	if !useViews && spec.IsWalrusBucket() {
+		base.WarnfCtx(ctx, "Using GSI is not supported when using a walrus bucket - switching to use views.  Set 'use_views':true in Sync Gateway's database config to avoid this warning.")
+		useViews = true
+	}
+
+	if useViews {
+		return true, db.InitializeViews(bucket)
+	}
+
+	gsiSupported := bucket.IsSupported(sgbucket.DataStoreFeatureN1ql)
+	if !gsiSupported {
+		return false, errors.New("Sync Gateway was unable to connect to a query node on the provided Couchbase Server cluster.  Ensure a query node is accessible, or set 'use_views':true in Sync Gateway's database config.")
+	}
+
+	numReplicas := DefaultNumIndexReplicas
+	if config.NumIndexReplicas != nil {
+		numReplicas = *config.NumIndexReplicas
+	}
+	n1qlStore, ok := base.AsN1QLStore(bucket)
+	if !ok {
+		return false, errors.New("Cannot create indexes on non-Couchbase data store.")
+	}
+	return false, db.InitializeIndexes(n1qlStore, config.UseXattrs(), numReplicas, false)
+}
+
 // Adds a database to the ServerContext.  Attempts a read after it gets the write
 // lock to see if it's already been added by another process. If so, returns either the
 // existing DatabaseContext or an error based on the useExisting flag.
@@ -379,6 +461,25 @@ func GetBucketSpec(ctx context.Context, config *DatabaseConfig, serverConfig *St
 	return spec, nil
 }
 
+// createScopesAndCollections creates any of the database's configured scopes and collections that don't exist in its
+// bucket.
+func createScopesAndCollections(ctx context.Context, bucket base.Bucket, scopes ScopesConfig) error {
+	collection, err := base.AsCollection(bucket)
+	if err != nil {
+		return fmt.Errorf("create_collections requires a Couchbase Server bucket: %w", err)
+	}
+	collectionNamesByScope := make(map[string][]string, len(scopes))
+	for scopeName, scopeConfig := range scopes {
+		for collectionName := range scopeConfig.Collections {
+			collectionNamesByScope[scopeName] = append(collectionNamesByScope[scopeName], collectionName)
+		}
+	}
+	if err := collection.CreateScopesAndCollections(ctx, collectionNamesByScope); err != nil {
+		return fmt.Errorf("unable to create scopes and collections for database: %w", err)
+	}
+	return nil
+}
+
 // Adds a database to the ServerContext.  Attempts a read after it gets the write
 // lock to see if it's already been added by another process. If so, returns either the
 // existing DatabaseContext or an error based on the useExisting flag.
@@ -420,44 +521,20 @@ func (sc *ServerContext) _getOrAddDatabaseFromConfig(ctx context.Context, config
 		return nil, err
 	}
 
-	// If using a walrus bucket, force use of views
-	useViews := base.BoolDefault(config.UseViews, false)
-	if !useViews && spec.IsWalrusBucket() {
-		base.WarnfCtx(ctx, "Using GSI is not supported when using a walrus bucket - switching to use views.  Set 'use_views':true in Sync Gateway's database config to avoid this warning.")
-		useViews = true
-	}
-
 	if len(config.Scopes) > 0 {
 		if !bucket.IsSupported(sgbucket.DataStoreFeatureCollections) {
 			return nil, errCollectionsUnsupported
 		}
-	}
-
-	// Initialize Views or GSI indexes for the bucket
-	if !useViews {
-		gsiSupported := bucket.IsSupported(sgbucket.DataStoreFeatureN1ql)
-		if !gsiSupported {
-			return nil, errors.New("Sync Gateway was unable to connect to a query node on the provided Couchbase Server cluster.  Ensure a query node is accessible, or set 'use_views':true in Sync Gateway's database config.")
-		}
-
-		numReplicas := DefaultNumIndexReplicas
-		if config.NumIndexReplicas != nil {
-			numReplicas = *config.NumIndexReplicas
+		if base.BoolDefault(config.CreateCollections, false) {
+			if err := createScopesAndCollections(ctx, bucket, config.Scopes); err != nil {
+				return nil, err
+			}
 		}
-		n1qlStore, ok := base.AsN1QLStore(bucket)
-		if !ok {
-			return nil, errors.New("Cannot create indexes on non-Couchbase data store.")
+	}
 
-		}
-		indexErr := db.InitializeIndexes(n1qlStore, config.UseXattrs(), numReplicas, false)
-		if indexErr != nil {
-			return nil, indexErr
-		}
-	} else {
-		viewErr := db.InitializeViews(bucket)
-		if viewErr != nil {
-			return nil, viewErr
-		}
+	useViews, err := initializeDatabaseIndexes(ctx, bucket, spec, &config)
+	if err != nil {
+		return nil, err
 	}
 
 	// Process unsupported config options or store runtime defaults if not set
@@ -506,7 +583,7 @@ func (sc *ServerContext) _getOrAddDatabaseFromConfig(ctx context.Context, config
 		config.Unsupported.WarningThresholds.ChannelNameSize = &base.DefaultWarnThresholdChannelNameSize
 	}
 
-	autoImport, err := config.AutoImportEnabled()
+	autoImport, err := config.importEnabled()
 	if err != nil {
 		return nil, err
 	}
@@ -524,8 +601,16 @@ func (sc *ServerContext) _getOrAddDatabaseFromConfig(ctx context.Context, config
 			contextOptions.Scopes[scopeName] = db.ScopeOptions{
 				Collections: make(map[string]db.CollectionOptions, len(scopeCfg.Collections)),
 			}
-			for collName := range scopeCfg.Collections {
-				contextOptions.Scopes[scopeName].Collections[collName] = db.CollectionOptions{}
+			for collName, collCfg := range scopeCfg.Collections {
+				importEnabled, err := config.collectionImportEnabled(scopeName, collName)
+				if err != nil {
+					return nil, err
+				}
+				contextOptions.Scopes[scopeName].Collections[collName] = db.CollectionOptions{
+					CRDT:          collCfg.CRDT.toCRDTOptions(),
+					ImportEnabled: importEnabled,
+					Quota:         collCfg.Quota,
+				}
 			}
 		}
 	}
@@ -543,6 +628,15 @@ func (sc *ServerContext) _getOrAddDatabaseFromConfig(ctx context.Context, config
 	if config.Sync != nil {
 		syncFn = *config.Sync
 	}
+	// WIP: Collections Phase 1 - the single collection's sync function runs for the database, unless the collection
+	// inherits the database-level sync function.
+	for scopeName, scopeConfig := range config.Scopes {
+		for collectionName := range scopeConfig.Collections {
+			if effectiveSyncFn := config.effectiveSyncFn(scopeName, collectionName); effectiveSyncFn.Source == SyncFnSourceCollection {
+				syncFn = effectiveSyncFn.Sync
+			}
+		}
+	}
 	if err := sc.applySyncFunction(ctx, dbcontext, syncFn); err != nil {
 		return nil, err
 	}
@@ -599,6 +693,10 @@ func (sc *ServerContext) _getOrAddDatabaseFromConfig(ctx context.Context, config
 
 	// Register it so HTTP handlers can find it:
 	sc.databases_[dbcontext.Name] = dbcontext
+	if config.Version != "" {
+		config.appliedVersion = config.Version
+	}
+	config.appliedAt = time.Now()
 	sc.dbConfigs[dbcontext.Name] = &config
 	sc.bucketDbName[spec.BucketName] = dbName
 
@@ -625,10 +723,36 @@ func dbcOptionsFromConfig(ctx context.Context, sc *ServerContext, config *DbConf
 
 	// Identify import options
 	importOptions := db.ImportOptions{}
-	if config.ImportFilter != nil {
-		importOptions.ImportFilter = db.NewImportFilterFunction(*config.ImportFilter, javascriptTimeout)
+	importFilterSource := config.ImportFilter
+	// WIP: Collections Phase 1 - the single collection's import filter runs for the database
+	for _, scopeConfig := range config.Scopes {
+		for _, collectionConfig := range scopeConfig.Collections {
+			if collectionConfig.ImportFilter != nil && strings.TrimSpace(*collectionConfig.ImportFilter) != "" {
+				importFilterSource = collectionConfig.ImportFilter
+			}
+		}
+	}
+	if importFilterSource != nil {
+		importFilter := base.WrapJSFunctionWithLibrary(*importFilterSource, config.JSLibrary)
+		importOptions.ImportFilter = db.NewImportFilterFunctionWithEngine(config.JavascriptEngine, importFilter, javascriptTimeout)
 	}
 	importOptions.BackupOldRev = base.BoolDefault(config.ImportBackupOldRev, false)
+	importOptions.ImportFilterMetadataOnly = base.BoolDefault(config.ImportFilterMetadataOnly, false)
+	importOptions.Throttle = config.ImportThrottle
+	importOptions.Conflict = config.ImportConflict
+	importOptions.Expiry = config.ImportExpiry
+	if config.ImportConflict != nil && config.ImportConflict.Strategy == db.ImportConflictCustom {
+		resolver := base.WrapJSFunctionWithLibrary(config.ImportConflict.Resolver, config.JSLibrary)
+		importOptions.ConflictResolver = db.NewImportConflictResolverFunction(config.JavascriptEngine, resolver, javascriptTimeout)
+	}
+
+	var syncWasmModule []byte
+	if config.SyncWasmModule != nil {
+		var err error
+		if syncWasmModule, err = os.ReadFile(*config.SyncWasmModule); err != nil {
+			return db.DatabaseContextOptions{}, fmt.Errorf("unable to read sync_wasm_module: %w", err)
+		}
+	}
 
 	if config.ImportPartitions == nil {
 		importOptions.ImportPartitions = base.DefaultImportPartitions
@@ -677,6 +801,8 @@ func dbcOptionsFromConfig(ctx context.Context, sc *ServerContext, config *DbConf
 			if config.CacheConfig.ChannelCacheConfig.HighWatermarkPercent != nil && *config.CacheConfig.ChannelCacheConfig.HighWatermarkPercent > 0 {
 				cacheOptions.CompactLowWatermarkPercent = *config.CacheConfig.ChannelCacheConfig.HighWatermarkPercent
 			}
+			cacheOptions.Storage = config.CacheConfig.ChannelCacheConfig.Storage
+			cacheOptions.Preload = config.CacheConfig.ChannelCacheConfig.Preload
 		}
 
 		if config.CacheConfig.RevCacheConfig != nil {
@@ -686,6 +812,12 @@ func dbcOptionsFromConfig(ctx context.Context, sc *ServerContext, config *DbConf
 			if config.CacheConfig.RevCacheConfig.ShardCount != nil {
 				revCacheOptions.ShardCount = *config.CacheConfig.RevCacheConfig.ShardCount
 			}
+			if config.CacheConfig.RevCacheConfig.MaxMemoryMB != nil {
+				revCacheOptions.MaxBytes = int64(*config.CacheConfig.RevCacheConfig.MaxMemoryMB) * 1024 * 1024
+			}
+			if config.CacheConfig.RevCacheConfig.Compression != nil {
+				revCacheOptions.Compression = *config.CacheConfig.RevCacheConfig.Compression
+			}
 		}
 	}
 
@@ -726,6 +858,26 @@ func dbcOptionsFromConfig(ctx context.Context, sc *ServerContext, config *DbConf
 		compactIntervalSecs = uint32(*config.CompactIntervalDays * 60 * 60 * 24)
 	}
 
+	var maxSequenceBatchSize uint64
+	if config.MaxSequenceBatchSize != nil {
+		maxSequenceBatchSize = *config.MaxSequenceBatchSize
+	}
+
+	var changesQueryConcurrency int
+	if config.ChangesQueryConcurrency != nil {
+		changesQueryConcurrency = *config.ChangesQueryConcurrency
+	}
+
+	var bulkDocsConcurrency int
+	if config.BulkDocsConcurrency != nil {
+		bulkDocsConcurrency = *config.BulkDocsConcurrency
+	}
+
+	var changesCoalesceWindow time.Duration
+	if config.ChangesCoalesceWindowMs != nil {
+		changesCoalesceWindow = time.Duration(*config.ChangesCoalesceWindowMs) * time.Millisecond
+	}
+
 	var queryPaginationLimit int
 
 	// If QueryPaginationLimit has been set use that first
@@ -774,13 +926,19 @@ func dbcOptionsFromConfig(ctx context.Context, sc *ServerContext, config *DbConf
 		localDocExpirySecs = *config.LocalDocExpirySecs
 	}
 
-	if config.UserXattrKey != "" {
+	var refreshTokenTTL time.Duration
+	if config.RefreshTokenTTLSecs != nil {
+		refreshTokenTTL = time.Duration(*config.RefreshTokenTTLSecs) * time.Second
+	}
+
+	userXattrKey := config.UserXattrKeySpec()
+	if userXattrKey != "" {
 		if !base.IsEnterpriseEdition() {
-			return db.DatabaseContextOptions{}, fmt.Errorf("user_xattr_key is only supported in enterpise edition")
+			return db.DatabaseContextOptions{}, fmt.Errorf("user_xattr_key and user_xattr_keys are only supported in enterprise edition")
 		}
 
 		if !config.UseXattrs() {
-			return db.DatabaseContextOptions{}, fmt.Errorf("use of user_xattr_key requires shared_bucket_access to be enabled")
+			return db.DatabaseContextOptions{}, fmt.Errorf("use of user_xattr_key or user_xattr_keys requires shared_bucket_access to be enabled")
 		}
 	}
 
@@ -799,6 +957,21 @@ func dbcOptionsFromConfig(ctx context.Context, sc *ServerContext, config *DbConf
 		slowQueryWarningThreshold = time.Duration(*config.SlowQueryWarningThresholdMs) * time.Millisecond
 	}
 
+	syncFunctionSlowThreshold := kDefaultSyncFunctionSlowThreshold * time.Millisecond
+	if config.SyncFunctionSlowThresholdMs != nil {
+		syncFunctionSlowThreshold = time.Duration(*config.SyncFunctionSlowThresholdMs) * time.Millisecond
+	}
+
+	slowRequestThreshold := kDefaultSlowRequestThreshold * time.Millisecond
+	if config.SlowRequestThresholdMs != nil {
+		slowRequestThreshold = time.Duration(*config.SlowRequestThresholdMs) * time.Millisecond
+	}
+
+	recentErrorsLimit := base.DefaultRecentLogEntriesLimit
+	if config.RecentErrorsLimit != nil {
+		recentErrorsLimit = int(*config.RecentErrorsLimit)
+	}
+
 	groupID := ""
 	if sc.Config.Bootstrap.ConfigGroupID != PersistentConfigDefaultGroupID {
 		groupID = sc.Config.Bootstrap.ConfigGroupID
@@ -815,37 +988,63 @@ func dbcOptionsFromConfig(ctx context.Context, sc *ServerContext, config *DbConf
 	}
 
 	contextOptions := db.DatabaseContextOptions{
+		Clock:                         sc.clock,
 		CacheOptions:                  &cacheOptions,
 		RevisionCacheOptions:          revCacheOptions,
+		MaxSequenceBatchSize:          maxSequenceBatchSize,
+		ChangesQueryConcurrency:       changesQueryConcurrency,
+		BulkDocsConcurrency:           bulkDocsConcurrency,
+		ChangesCoalesceWindow:         changesCoalesceWindow,
+		DocResponseCacheConfig:        config.DocResponseCache,
+		MemoryAdmissionConfig:         config.MemoryAdmission,
 		OldRevExpirySeconds:           oldRevExpirySeconds,
 		LocalDocExpirySecs:            localDocExpirySecs,
 		AdminInterface:                &sc.Config.API.AdminInterface,
 		UnsupportedOptions:            config.Unsupported,
 		OIDCOptions:                   config.OIDCConfig,
 		LocalJWTConfig:                config.LocalJWTConfig,
+		LDAPConfig:                    config.LDAPConfig,
+		ClientCertAuth:                config.ClientCertAuth,
 		DBOnlineCallback:              dbOnlineCallback,
 		ImportOptions:                 importOptions,
 		EnableXattr:                   config.UseXattrs(),
 		SecureCookieOverride:          secureCookieOverride,
 		SessionCookieName:             config.SessionCookieName,
 		SessionCookieHttpOnly:         base.BoolDefault(config.SessionCookieHTTPOnly, false),
+		RefreshTokenTTL:               refreshTokenTTL,
 		AllowConflicts:                config.ConflictsAllowed(),
 		SendWWWAuthenticateHeader:     sendWWWAuthenticate,
 		DisablePasswordAuthentication: base.BoolDefault(config.DisablePasswordAuth, false),
 		DeltaSyncOptions:              deltaSyncOptions,
 		CompactInterval:               compactIntervalSecs,
 		QueryPaginationLimit:          queryPaginationLimit,
-		UserXattrKey:                  config.UserXattrKey,
+		UserXattrKey:                  userXattrKey,
 		SGReplicateOptions: db.SGReplicateOptions{
 			Enabled:               sgReplicateEnabled,
 			WebsocketPingInterval: sgReplicateWebsocketPingInterval,
+			ClientCerts:           sc.Config.Replicator.ClientCerts,
 		},
 		SlowQueryWarningThreshold: slowQueryWarningThreshold,
 		ClientPartitionWindow:     clientPartitionWindow,
 		BcryptCost:                bcryptCost,
+		PasswordPolicy:            config.PasswordPolicy,
+		GuestSessions:             config.GuestSessions,
+		LoginThrottle:             config.LoginThrottle,
+		AdminRoleActions:          config.AdminRoleActions,
+		UserConnectionLimits:      config.UserConnectionLimits,
+		ChannelNamePolicy:         config.ChannelNamePolicy,
+		ChannelHistory:            config.ChannelHistory,
+		SyncFunctionLimits:        config.SyncFunctionLimits,
+		SyncWasmModule:            syncWasmModule,
 		GroupID:                   groupID,
 		JavascriptTimeout:         javascriptTimeout,
+		JavascriptEngine:          config.JavascriptEngine,
+		JSLibrary:                 config.JSLibrary,
+		SyncFunctionSlowThreshold: syncFunctionSlowThreshold,
+		SlowRequestThreshold:      slowRequestThreshold,
+		RecentErrorsLimit:         recentErrorsLimit,
 		Serverless:                sc.Config.IsServerless(),
+		ServerlessMaxConnections:  sc.Config.Unsupported.Serverless.MaxConnectionsPerDatabase,
 		// UserQueries:               config.UserQueries,   // behind feature flag (see below)
 		// UserFunctions:             config.UserFunctions, // behind feature flag (see below)
 		// GraphQL:                   config.GraphQL,       // behind feature flag (see below)
@@ -859,6 +1058,11 @@ func dbcOptionsFromConfig(ctx context.Context, sc *ServerContext, config *DbConf
 		base.WarnfCtx(context.TODO(), `Database config options "queries", "functions", "graphql" ignored because unsupported.user_queries feature flag is not enabled`)
 	}
 
+	if sc.chaos != nil {
+		contextOptions.CacheFeedChaos = sc.chaos.CacheFeed(dbName)
+		contextOptions.ImportFeedChaos = sc.chaos.ImportFeed(dbName)
+	}
+
 	return contextOptions, nil
 }
 
@@ -1039,6 +1243,14 @@ func (sc *ServerContext) _unloadDatabase(ctx context.Context, dbName string) boo
 func (sc *ServerContext) _removeDatabase(ctx context.Context, dbName string) bool {
 	dbCtx := sc.databases_[dbName]
 	if dbCtx == nil {
+		// Databases in cold standby or suspended only have their config to remove
+		if config, ok := sc.dbConfigs[dbName]; ok {
+			delete(sc.dbConfigs, dbName)
+			if config.Bucket != nil {
+				delete(sc.bucketDbName, *config.Bucket)
+			}
+			return true
+		}
 		return false
 	}
 	bucket := dbCtx.Bucket.GetName()
@@ -1063,7 +1275,7 @@ func (sc *ServerContext) _suspendDatabase(ctx context.Context, dbName string) er
 		return base.ErrNotFound
 	}
 
-	if config, exists := sc.dbConfigs[dbName]; exists && !base.BoolDefault(config.Suspendable, sc.Config.IsServerless()) {
+	if config, exists := sc.dbConfigs[dbName]; exists && !config.isSuspendable(sc.Config.IsServerless()) {
 		return ErrSuspendingDisallowed
 	}
 
@@ -1076,6 +1288,55 @@ func (sc *ServerContext) _suspendDatabase(ctx context.Context, dbName string) er
 	return nil
 }
 
+// _provisionDormantDatabase loads the config of a cold standby database and verifies its indexes, without starting
+// it.  The database is left suspended, to be started by its first request.
+func (sc *ServerContext) _provisionDormantDatabase(ctx context.Context, config DatabaseConfig, failFast bool) error {
+	spec, err := GetBucketSpec(ctx, &config, sc.Config)
+	if err != nil {
+		return err
+	}
+	if spec.Server == "" {
+		spec.Server = sc.Config.Bootstrap.Server
+	}
+	dbName := config.Name
+	if dbName == "" {
+		dbName = spec.BucketName
+	}
+	if err := db.ValidateDatabaseName(dbName); err != nil {
+		return err
+	}
+
+	base.InfofCtx(ctx, base.KeyAll, "Provisioning cold standby db /%s in bucket %q", base.MD(dbName), base.MD(spec.BucketName))
+	bucket, err := db.GetConnectToBucketFn(failFast)(ctx, spec)
+	if err != nil {
+		return err
+	}
+	defer bucket.Close()
+	if _, err := initializeDatabaseIndexes(ctx, bucket, spec, &config); err != nil {
+		return err
+	}
+
+	sc.dbConfigs[dbName] = &config
+	sc.bucketDbName[spec.BucketName] = dbName
+	return nil
+}
+
+// DormantDatabaseNames returns the names of the databases whose configs are loaded, but that haven't been started
+// because they're in cold standby or have been suspended.
+func (sc *ServerContext) DormantDatabaseNames() []string {
+	sc.lock.RLock()
+	defer sc.lock.RUnlock()
+
+	names := make([]string, 0)
+	for name := range sc.dbConfigs {
+		if sc._isDatabaseSuspended(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
 func (sc *ServerContext) unsuspendDatabase(ctx context.Context, dbName string) (*db.DatabaseContext, error) {
 	sc.lock.Lock()
 	defer sc.lock.Unlock()
@@ -1091,7 +1352,7 @@ func (sc *ServerContext) _unsuspendDatabase(ctx context.Context, dbName string)
 
 	// Check if database is in dbConfigs so no need to search through buckets
 	if dbConfig, ok := sc.dbConfigs[dbName]; ok {
-		if !base.BoolDefault(dbConfig.Suspendable, sc.Config.IsServerless()) {
+		if !dbConfig.isSuspendable(sc.Config.IsServerless()) {
 			base.InfofCtx(context.TODO(), base.KeyAll, "attempting to unsuspend db %q while not configured to be suspendable", base.MD(dbName))
 		}
 
@@ -1109,10 +1370,14 @@ func (sc *ServerContext) _unsuspendDatabase(ctx context.Context, dbName string)
 			return nil, fmt.Errorf("unsuspending db %q failed due to an error while trying to retrieve latest config from bucket %q: %w", base.MD(dbName).Redact(), base.MD(bucket).Redact(), err)
 		}
 		dbConfig.cas = cas
+		activationStart := time.Now()
 		dbCtx, err = sc._getOrAddDatabaseFromConfig(ctx, *dbConfig, false, db.GetConnectToBucketFn(false))
 		if err != nil {
 			return nil, err
 		}
+		activationTime := time.Since(activationStart)
+		dbCtx.DbStats.Database().ActivationTime.Set(activationTime.Nanoseconds())
+		base.InfofCtx(ctx, base.KeyAll, "Activated db %q (bucket %q) in %v", base.MD(dbName), base.MD(bucket), activationTime)
 		return dbCtx, nil
 	}
 
@@ -1211,6 +1476,27 @@ func (sc *ServerContext) startStatsLogger(ctx context.Context) {
 
 }
 
+// startMetricsExporter starts periodically pushing stats to the sinks configured in metrics_export, if any.
+func (sc *ServerContext) startMetricsExporter(ctx context.Context) {
+	config := sc.Config.MetricsExport
+	exporter, err := base.NewMetricsExporter(base.MetricsExporterOptions{
+		Interval:               config.Interval.Value(),
+		StatsDAddress:          config.StatsDAddress,
+		CloudWatchAgentAddress: config.CloudWatchAgentAddress,
+		CloudWatchNamespace:    config.CloudWatchNamespace,
+		OTLPEndpoint:           config.OTLPEndpoint,
+		ServiceName:            sc.Config.Tracing.ServiceName,
+	})
+	if err != nil {
+		base.WarnfCtx(ctx, "Couldn't start pushing stats: %v", err)
+		return
+	} else if exporter == nil {
+		return
+	}
+	exporter.Start(ctx)
+	sc.metricsExporter = exporter
+}
+
 func (sc *ServerContext) logStats(ctx context.Context) error {
 
 	AddGoRuntimeStats()
@@ -1497,8 +1783,9 @@ func CheckPermissions(httpClient *http.Client, managementEndpoints []string, buc
 	return http.StatusForbidden, nil, nil
 }
 
+// CheckRoles is used for Admin authentication to check whether a CBS RBAC user has any ONE of the requestedRoles.
 func CheckRoles(httpClient *http.Client, managementEndpoints []string, username, password string, requestedRoles []RouteRole, bucketName string) (statusCode int, err error) {
-	statusCode, bodyResponse, err := doHTTPAuthRequest(httpClient, username, password, "GET", "/whoami", managementEndpoints, nil)
+	statusCode, roles, err := getAdminRoles(httpClient, managementEndpoints, username, password)
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
@@ -1507,34 +1794,34 @@ func CheckRoles(httpClient *http.Client, managementEndpoints []string, username,
 		return statusCode, nil
 	}
 
-	var whoAmIResults struct {
-		Roles []struct {
-			RoleName   string `json:"role"`
-			BucketName string `json:"bucket_name"`
-		} `json:"roles"`
+	if hasAnyRouteRole(roles, requestedRoles, bucketName) {
+		return http.StatusOK, nil
 	}
 
-	err = base.JSONUnmarshal(bodyResponse, &whoAmIResults)
+	return http.StatusForbidden, nil
+}
+
+// getAdminRoles returns the roles of a CBS RBAC user, via the cluster's /whoami endpoint.
+func getAdminRoles(httpClient *http.Client, managementEndpoints []string, username, password string) (statusCode int, roles []adminRole, err error) {
+	statusCode, bodyResponse, err := doHTTPAuthRequest(httpClient, username, password, "GET", "/whoami", managementEndpoints, nil)
 	if err != nil {
-		return http.StatusInternalServerError, err
+		return http.StatusInternalServerError, nil, err
 	}
 
-	for _, roleResult := range whoAmIResults.Roles {
-		for _, requireRole := range requestedRoles {
-			requireBucketOptions := []string{""}
-			if requireRole.DatabaseScoped {
-				requireBucketOptions = []string{bucketName, RoleBucketWildcard}
-			}
+	if statusCode != http.StatusOK {
+		return statusCode, nil, nil
+	}
 
-			for _, requireBucket := range requireBucketOptions {
-				if (roleResult.BucketName == requireBucket) && roleResult.RoleName == requireRole.RoleName {
-					return http.StatusOK, nil
-				}
-			}
-		}
+	var whoAmIResults struct {
+		Roles []adminRole `json:"roles"`
 	}
 
-	return http.StatusForbidden, nil
+	err = base.JSONUnmarshal(bodyResponse, &whoAmIResults)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	return http.StatusOK, whoAmIResults.Roles, nil
 }
 
 func doHTTPAuthRequest(httpClient *http.Client, username, password, method, path string, endpoints []string, requestBody []byte) (statusCode int, responseBody []byte, err error) {
@@ -1597,36 +1884,71 @@ func (sc *ServerContext) Database(ctx context.Context, name string) *db.Database
 }
 
 func (sc *ServerContext) initializeCouchbaseServerConnections(ctx context.Context) error {
-	goCBAgent, err := sc.initializeGoCBAgent(ctx)
-	if err != nil {
-		return err
-	}
-	sc.GoCBAgent = goCBAgent
+	// Retry failures to connect to Couchbase Server or to load databases until bootstrap.startup_retry_window has passed
+	retryDeadline := time.Now().Add(sc.Config.Bootstrap.StartupRetryWindow.Value())
 
-	sc.NoX509HTTPClient, err = sc.initializeNoX509HttpClient()
-	if err != nil {
-		return err
-	}
+	var count int
+	err := retryStartupStep(ctx, "connect to Couchbase Server", retryDeadline, func() (err error) {
+		if sc.GoCBAgent == nil {
+			sc.GoCBAgent, err = sc.initializeGoCBAgent(ctx)
+			if err != nil {
+				return err
+			}
+		}
 
-	// Fetch database configs from bucket and start polling for new buckets and config updates.
-	if sc.persistentConfig {
-		couchbaseCluster, err := CreateCouchbaseClusterFromStartupConfig(sc.Config)
+		sc.NoX509HTTPClient, err = sc.initializeNoX509HttpClient()
 		if err != nil {
 			return err
 		}
-		sc.BootstrapContext.Connection = couchbaseCluster
 
-		count, err := sc.fetchAndLoadConfigs(ctx, true)
-		if err != nil {
-			return err
+		// Fetch database configs from bucket
+		if sc.persistentConfig {
+			if sc.BootstrapContext.Connection == nil {
+				couchbaseCluster, err := CreateCouchbaseClusterFromStartupConfig(sc.Config)
+				if err != nil {
+					return err
+				}
+				sc.BootstrapContext.Connection, err = newSecretEncryptingConnection(ctx, sc.Config, couchbaseCluster)
+				if err != nil {
+					return err
+				}
+			}
+
+			count, err = sc.fetchAndLoadConfigs(ctx, true)
+			if err != nil {
+				return err
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
 
+	// Start polling for new buckets and config updates.
+	if sc.persistentConfig {
 		if count > 0 {
 			base.InfofCtx(ctx, base.KeyConfig, "Successfully fetched %d database configs from buckets in cluster", count)
-		} else {
+		} else if sc.databaseLoadError() == nil {
 			base.WarnfCtx(ctx, "Config: No database configs for group %q. Continuing startup to allow REST API database creation", sc.Config.Bootstrap.ConfigGroupID)
 		}
 
+		// Databases can fail to load while their indexes are being built
+		if time.Now().Before(retryDeadline) {
+			err := retryStartupStep(ctx, "load all databases", retryDeadline, func() error {
+				if err := sc.databaseLoadError(); err == nil {
+					return nil
+				}
+				if _, err := sc.fetchAndLoadConfigs(ctx, false); err != nil {
+					return err
+				}
+				return sc.databaseLoadError()
+			})
+			if err != nil {
+				base.WarnfCtx(ctx, "Continuing startup in a degraded state: %v", err)
+			}
+		}
+
 		if sc.Config.Bootstrap.ConfigUpdateFrequency.Value() > 0 {
 			sc.BootstrapContext.terminator = make(chan struct{})
 			sc.BootstrapContext.doneChan = make(chan struct{})
@@ -1650,6 +1972,7 @@ func (sc *ServerContext) initializeCouchbaseServerConnections(ctx context.Contex
 						if count > 0 {
 							base.InfofCtx(ctx, base.KeyConfig, "Successfully fetched %d database configs from buckets in cluster", count)
 						}
+						sc.checkConfigConflicts(ctx)
 					}
 				}
 			}()
@@ -750,3 +750,97 @@ func TestLogFlush(t *testing.T) {
 	}
 
 }
+
+func TestClusterStatus(t *testing.T) {
+	rt := NewRestTester(t, nil)
+	defer rt.Close()
+
+	sc := rt.ServerContext()
+	sc.heartbeatNodeRegistry(base.TestCtx(t))
+
+	// Register a node that has stopped sending heartbeats
+	staleNode := NodeRegistration{
+		Host:          "stale-host",
+		Version:       base.LongVersionString,
+		Databases:     []string{"db"},
+		StartedAt:     time.Now().Add(-2 * time.Hour),
+		LastHeartbeat: time.Now().Add(-time.Hour),
+	}
+	_, err := rt.Bucket().Update(base.NodeRegistryKey, 0, func(currentValue []byte) ([]byte, *uint32, bool, error) {
+		var registry nodeRegistryDoc
+		require.NoError(t, base.JSONUnmarshal(currentValue, &registry))
+		registry.Nodes["stale-node"] = staleNode
+		updated, err := base.JSONMarshal(registry)
+		return updated, nil, false, err
+	})
+	require.NoError(t, err)
+
+	response := rt.SendAdminRequest(http.MethodGet, "/_cluster", "")
+	RequireStatus(t, response, http.StatusOK)
+	var status ClusterStatus
+	require.NoError(t, base.JSONUnmarshal(response.BodyBytes(), &status))
+	assert.Equal(t, sc.nodeID, status.NodeID)
+	require.Len(t, status.Nodes, 2)
+
+	node := status.Nodes[sc.nodeID]
+	assert.Equal(t, NodeStatusHealthy, node.Status)
+	assert.Equal(t, []string{"db"}, node.Databases)
+	assert.Equal(t, base.LongVersionString, node.Version)
+
+	stale := status.Nodes["stale-node"]
+	assert.Equal(t, NodeStatusUnhealthy, stale.Status)
+	assert.Equal(t, "stale-host", stale.Host)
+	assert.Equal(t, "1h0m0s", stale.Uptime)
+}
+
+func TestReadiness(t *testing.T) {
+	sc := &ServerContext{hasStarted: make(chan struct{})}
+	assert.Equal(t, ReadinessStatus{State: ReadinessStarting}, sc.readiness())
+
+	rt := NewRestTester(t, nil)
+	defer rt.Close()
+
+	response := rt.SendRequest(http.MethodGet, "/_ready", "")
+	RequireStatus(t, response, http.StatusOK)
+	assert.JSONEq(t, `{"state":"ready"}`, response.Body.String())
+
+	// Databases that failed to load are only listed on the admin API
+	rt.ServerContext().setDatabaseLoadError("db2", fmt.Errorf("index not ready"))
+	response = rt.SendRequest(http.MethodGet, "/_ready", "")
+	RequireStatus(t, response, http.StatusOK)
+	assert.JSONEq(t, `{"state":"degraded"}`, response.Body.String())
+	response = rt.SendAdminRequest(http.MethodGet, "/_ready", "")
+	RequireStatus(t, response, http.StatusOK)
+	assert.JSONEq(t, `{"state":"degraded","failed_databases":{"db2":"index not ready"}}`, response.Body.String())
+
+	// Load errors are forgotten once the database's config is gone
+	rt.ServerContext().pruneDatabaseLoadErrors(map[string]DatabaseConfig{})
+	response = rt.SendAdminRequest(http.MethodGet, "/_ready", "")
+	RequireStatus(t, response, http.StatusOK)
+	assert.JSONEq(t, `{"state":"ready"}`, response.Body.String())
+}
+
+func TestRetryStartupStep(t *testing.T) {
+	ctx := base.TestCtx(t)
+
+	// Without a retry window, the step is only attempted once
+	attempts := 0
+	err := retryStartupStep(ctx, "fail", time.Now(), func() error {
+		attempts++
+		return fmt.Errorf("failed attempt %d", attempts)
+	})
+	assert.EqualError(t, err, "failed attempt 1")
+	assert.Equal(t, 1, attempts)
+
+	// Retries until the step succeeds
+	attempts = 0
+	err = retryStartupStep(ctx, "succeed", time.Now().Add(time.Minute), func() error {
+		attempts++
+		if attempts < 2 {
+			return fmt.Errorf("failed attempt %d", attempts)
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+}
@@ -499,3 +499,59 @@ func TestSuspendingFlags(t *testing.T) {
 		})
 	}
 }
+
+// Ensures a cold standby database is only provisioned when its config is loaded, and is started by its first request
+func TestColdStandbyDatabase(t *testing.T) {
+	if base.UnitTestUrlIsWalrus() {
+		t.Skip("This test only works against Couchbase Server due to loading configs from the bucket")
+	}
+	tb := base.GetTestBucket(t)
+	defer tb.Close()
+
+	rt := NewRestTester(t, &RestTesterConfig{
+		CustomTestBucket: tb,
+		persistentConfig: true,
+		MutateStartupConfig: func(config *StartupConfig) {
+			config.Bootstrap.ConfigUpdateFrequency = base.NewConfigDuration(0)
+		},
+	})
+	defer rt.Close()
+	sc := rt.ServerContext()
+
+	resp := rt.SendAdminRequest(http.MethodPut, "/db/", fmt.Sprintf(`{
+		"bucket": "%s",
+		"use_views": %t,
+		"num_index_replicas": 0,
+		"cold_standby": true
+	}`, tb.GetName(), base.TestsDisableGSI()))
+	RequireStatus(t, resp, http.StatusCreated)
+	assert.True(t, sc.isDatabaseSuspended(t, "db"))
+	assert.Equal(t, []string{"db"}, sc.DormantDatabaseNames())
+
+	resp = rt.SendAdminRequest(http.MethodGet, "/_status", "")
+	RequireStatus(t, resp, http.StatusOK)
+	var status Status
+	require.NoError(t, base.JSONUnmarshal(resp.BodyBytes(), &status))
+	assert.Equal(t, []string{"db"}, status.DormantDatabases)
+	assert.NotContains(t, status.Databases, "db")
+
+	// The first request starts the database, recording how long it took
+	resp = rt.SendAdminRequest(http.MethodGet, "/db/", "")
+	RequireStatus(t, resp, http.StatusOK)
+	assert.False(t, sc.isDatabaseSuspended(t, "db"))
+	assert.Empty(t, sc.DormantDatabaseNames())
+	dbCtx := sc.Database(rt.Context(), "db")
+	assert.Greater(t, dbCtx.DbStats.Database().ActivationTime.Value(), int64(0))
+
+	// Loading the config from the bucket, as another node would, leaves the database dormant
+	require.True(t, sc.RemoveDatabase(rt.Context(), "db"))
+	count, err := sc.fetchAndLoadConfigs(rt.Context(), false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, []string{"db"}, sc.DormantDatabaseNames())
+
+	// Dormant databases can be removed without being started
+	require.True(t, sc.RemoveDatabase(rt.Context(), "db"))
+	assert.Empty(t, sc.DormantDatabaseNames())
+	assert.Empty(t, sc.bucketDbName[tb.GetName()])
+}
@@ -40,8 +40,8 @@ func (h *handler) handleSessionPOST() error {
 	originHeader := h.rq.Header["Origin"]
 	if len(originHeader) > 0 {
 		matched := ""
-		if h.server.Config.API.CORS != nil {
-			matched = matchedOrigin(h.server.Config.API.CORS.LoginOrigin, originHeader)
+		if cors := h.server.corsConfig(); cors != nil {
+			matched = matchedOrigin(cors.LoginOrigin, originHeader)
 		}
 		if matched == "" {
 			return base.HTTPErrorf(http.StatusBadRequest, "No CORS")
@@ -57,12 +57,12 @@ func (h *handler) handleSessionPOST() error {
 
 	// If we fail to get a user from the body and we've got a non-GUEST authenticated user, create the session based on that user
 	if user == nil && h.user != nil && h.user.Name() != "" {
-		return h.makeSession(h.user)
+		return h.makeLoginSession(h.user)
 	} else {
 		if err != nil {
 			return err
 		}
-		return h.makeSession(user)
+		return h.makeLoginSession(user)
 	}
 
 }
@@ -70,24 +70,33 @@ func (h *handler) handleSessionPOST() error {
 func (h *handler) getUserFromSessionRequestBody() (auth.User, error) {
 
 	var params struct {
-		Name     string `json:"name"`
-		Password string `json:"password"`
+		Name         string `json:"name"`
+		Password     string `json:"password"`
+		RefreshToken string `json:"refresh_token"`
+		DeviceID     string `json:"device_id"`
 	}
 	err := h.readJSONInto(&params)
 	if err != nil {
 		return nil, err
 	}
 
-	var user auth.User
-	user, err = h.db.Authenticator(h.ctx()).GetUser(params.Name)
-	if err != nil {
-		return nil, err
+	// Exchange a refresh token for a new session, when refresh tokens are enabled
+	if params.RefreshToken != "" {
+		if h.db.Options.RefreshTokenTTL == 0 {
+			return nil, base.HTTPErrorf(http.StatusBadRequest, "Refresh tokens are not enabled")
+		}
+		return h.db.Authenticator(h.ctx()).RedeemRefreshToken(params.RefreshToken)
 	}
 
-	if user != nil && !user.Authenticate(params.Password) {
-		user = nil
+	// Without a name, a device ID requests a session for the device's guest user, when guest sessions are enabled
+	if params.DeviceID != "" && params.Name == "" {
+		if h.db.Options.GuestSessions == nil {
+			return nil, base.HTTPErrorf(http.StatusBadRequest, "Guest sessions are not enabled")
+		}
+		return h.db.Authenticator(h.ctx()).GetGuestDeviceUser(params.DeviceID, h.db.Options.GuestSessions, h.db.GuestUserLimiter, h.clientIP())
 	}
-	return user, err
+
+	return h.authenticatePassword(h.db.DatabaseContext, params.Name, params.Password)
 }
 
 // DELETE /_session logs out the current session
@@ -96,14 +105,29 @@ func (h *handler) handleSessionDELETE() error {
 	originHeader := h.rq.Header["Origin"]
 	if len(originHeader) > 0 {
 		matched := ""
-		if h.server.Config.API.CORS != nil {
-			matched = matchedOrigin(h.server.Config.API.CORS.LoginOrigin, originHeader)
+		if cors := h.server.corsConfig(); cors != nil {
+			matched = matchedOrigin(cors.LoginOrigin, originHeader)
 		}
 		if matched == "" {
 			return base.HTTPErrorf(http.StatusBadRequest, "No CORS")
 		}
 	}
 
+	// Revoke the refresh token issued with the session, if provided
+	if h.rq.ContentLength > 0 && h.user != nil && h.user.Name() != "" {
+		var params struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		if err := h.readJSONInto(&params); err != nil {
+			return err
+		}
+		if params.RefreshToken != "" {
+			if err := h.db.Authenticator(h.ctx()).DeleteRefreshToken(params.RefreshToken, h.user.Name()); err != nil && !base.IsDocNotFoundError(err) {
+				return err
+			}
+		}
+	}
+
 	cookie := h.db.Authenticator(h.ctx()).DeleteSessionForCookie(h.rq)
 	if cookie == nil {
 		return base.HTTPErrorf(http.StatusNotFound, "no session")
@@ -121,6 +145,42 @@ func (h *handler) makeSession(user auth.User) error {
 	return h.respondWithSessionInfo()
 }
 
+// makeLoginSession creates a session for a user logging in via _session POST.  When refresh tokens are enabled for
+// the database, a refresh token is issued alongside the session cookie and returned in the session info response.
+func (h *handler) makeLoginSession(user auth.User) error {
+	// Guest device sessions use their own TTL, and aren't issued refresh tokens since a new session can be requested
+	// with just the device ID.
+	if guestSessions := h.db.Options.GuestSessions; guestSessions != nil && user != nil && auth.IsGuestDeviceUserName(user.Name()) {
+		ttl := kDefaultSessionTTL
+		if guestSessions.SessionTTLSecs != nil {
+			ttl = time.Duration(*guestSessions.SessionTTLSecs) * time.Second
+		}
+		if _, err := h.makeSessionWithTTL(user, ttl); err != nil {
+			return err
+		}
+		return h.respondWithSessionInfo()
+	}
+
+	if h.db.Options.RefreshTokenTTL == 0 {
+		return h.makeSession(user)
+	}
+
+	if _, err := h.makeSessionWithTTL(user, kDefaultSessionTTL); err != nil {
+		return err
+	}
+	refreshToken, err := h.db.Authenticator(h.ctx()).CreateRefreshToken(user.Name(), h.db.Options.RefreshTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	response := h.formatSessionResponse(h.user)
+	response["refresh_token"] = refreshToken.Token
+	response["refresh_token_expires"] = refreshToken.Expiration.UTC().Format(time.RFC3339)
+	h.setHeader("Cache-Control", "no-store")
+	h.writeJSON(response)
+	return nil
+}
+
 // Creates a session with TTL and adds to the response.  Does NOT return the session info response.
 func (h *handler) makeSessionWithTTL(user auth.User, expiry time.Duration) (sessionID string, err error) {
 	if user == nil {
@@ -128,7 +188,7 @@ func (h *handler) makeSessionWithTTL(user auth.User, expiry time.Duration) (sess
 	}
 	h.user = user
 	auth := h.db.Authenticator(h.ctx())
-	session, err := auth.CreateSession(user.Name(), expiry)
+	session, err := auth.CreateSessionForRequest(h.rq, user.Name(), expiry)
 	if err != nil {
 		return "", err
 	}
@@ -255,6 +315,51 @@ func (h *handler) deleteUserSession() error {
 	}
 }
 
+// ADMIN API: Lists the active sessions for a user
+func (h *handler) getUserSessions() error {
+	h.assertAdminOnly()
+	userName := h.PathVar("name")
+	if user, err := h.db.Authenticator(h.ctx()).GetUser(userName); user == nil {
+		if err == nil {
+			err = kNotFoundError
+		}
+		return err
+	}
+
+	sessions, err := h.db.GetUserSessions(h.ctx(), userName)
+	if err != nil {
+		return err
+	}
+
+	type sessionInfo struct {
+		ID         string `json:"id"`
+		Created    string `json:"created,omitempty"`
+		LastSeen   string `json:"last_seen,omitempty"`
+		Expiration string `json:"expiration"`
+		UserAgent  string `json:"user_agent,omitempty"`
+		IPAddress  string `json:"ip_address,omitempty"`
+	}
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+	response := make([]sessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, sessionInfo{
+			ID:         session.ID,
+			Created:    formatTime(session.Created),
+			LastSeen:   formatTime(session.LastSeen),
+			Expiration: formatTime(session.Expiration),
+			UserAgent:  session.UserAgent,
+			IPAddress:  session.IPAddress,
+		})
+	}
+	h.writeJSON(response)
+	return nil
+}
+
 // ADMIN API: Deletes all sessions for a user
 func (h *handler) deleteUserSessions() error {
 	h.assertAdminOnly()
@@ -11,6 +11,7 @@ package rest
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"testing"
 
 	"github.com/couchbase/sync_gateway/auth"
@@ -414,3 +415,28 @@ func TestUserAPI(t *testing.T) {
 	RequireStatus(t, rt.SendAdminRequest("DELETE", "/db/_user/0%257C%4059", ""), 200)
 
 }
+
+func TestUserAPIPasswordPolicy(t *testing.T) {
+	rt := NewRestTester(t, &RestTesterConfig{DatabaseConfig: &DatabaseConfig{DbConfig: DbConfig{
+		PasswordPolicy: &auth.PasswordPolicy{MinLength: 8, RequireDigit: true, DisallowCommon: true},
+	}}})
+	defer rt.Close()
+
+	response := rt.SendAdminRequest(http.MethodPut, "/db/_user/alice", `{"password":"short1"}`)
+	RequireStatus(t, response, http.StatusBadRequest)
+	assert.Contains(t, response.Body.String(), auth.PasswordRuleMinLength)
+
+	response = rt.SendAdminRequest(http.MethodPut, "/db/_user/alice", `{"password":"password123"}`)
+	RequireStatus(t, response, http.StatusBadRequest)
+	assert.Contains(t, response.Body.String(), auth.PasswordRuleDisallowCommon)
+
+	RequireStatus(t, rt.SendAdminRequest(http.MethodPut, "/db/_user/alice", `{"password":"correcthorse1"}`), http.StatusCreated)
+
+	// Updating the password is subject to the same policy
+	response = rt.SendAdminRequest(http.MethodPut, "/db/_user/alice", `{"password":"nodigitshere"}`)
+	RequireStatus(t, response, http.StatusBadRequest)
+	assert.Contains(t, response.Body.String(), auth.PasswordRuleRequireDigit)
+
+	// Updates that don't change the password aren't checked
+	RequireStatus(t, rt.SendAdminRequest(http.MethodPut, "/db/_user/alice", `{"email":"alice@example.com"}`), http.StatusOK)
+}
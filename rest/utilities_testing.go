@@ -63,7 +63,12 @@ type RestTesterConfig struct {
 	useTLSServer                    bool // If true, TLS will be required for communications with CBS. Default: false
 	persistentConfig                bool
 	groupID                         *string
-	serverless                      bool // Runs SG in serverless mode. Must be used in conjunction with persistent config
+	serverless                      bool       // Runs SG in serverless mode. Must be used in conjunction with persistent config
+	NumNodes                        int        // Number of Sync Gateway nodes to run against the test bucket, each with its own ServerContext. Defaults to one.
+	Clock                           base.Clock // Source of time for the databases, such as a base.FakeClock shared by the test.  Defaults to the system clock.
+	ScenarioFile                    string     // Path that the requests made to the RestTester are recorded to on Close, for replay with Scenario.Replay
+	EnableChaos                     bool       // Enables the ServerChaos hooks returned by Chaos before the databases are loaded
+	IsolatedCollection              bool       // Use a new collection in a bucket shared with other tests, rather than a whole pooled bucket
 }
 
 // RestTester provides a fake server for testing endpoints
@@ -78,6 +83,8 @@ type RestTester struct {
 	publicHandlerOnce       sync.Once
 	MetricsHandler          http.Handler
 	metricsHandlerOnce      sync.Once
+	nodes                   []*RestTester     // Additional nodes when NumNodes is greater than one
+	scenarioRecorder        *scenarioRecorder // Records requests when ScenarioFile or SG_TEST_RECORD_SCENARIOS is set
 	closed                  bool
 }
 
@@ -93,6 +100,7 @@ func NewRestTester(tb testing.TB, restConfig *RestTesterConfig) *RestTester {
 		rt.RestTesterConfig = &RestTesterConfig{}
 	}
 	rt.RestTesterConfig.useTLSServer = base.ServerIsTLS(base.UnitTestUrl())
+	rt.scenarioRecorder = newScenarioRecorder(tb.Name(), rt.ScenarioFile)
 	return &rt
 }
 
@@ -110,7 +118,11 @@ func (rt *RestTester) Bucket() base.Bucket {
 	// If we have a TestBucket defined on the RestTesterConfig, use that instead of requesting a new one.
 	testBucket := rt.RestTesterConfig.CustomTestBucket
 	if testBucket == nil {
-		testBucket = base.GetTestBucket(rt.TB)
+		if rt.IsolatedCollection {
+			testBucket = base.GetTestBucketIsolatedCollection(rt.TB)
+		} else {
+			testBucket = base.GetTestBucket(rt.TB)
+		}
 		if rt.leakyBucketConfig != nil {
 			leakyConfig := *rt.leakyBucketConfig
 			// Ignore closures to avoid double closing panics
@@ -199,6 +211,12 @@ func (rt *RestTester) Bucket() base.Bucket {
 	sc.Auth.BcryptCost = bcrypt.MinCost
 
 	rt.RestTesterServerContext = NewServerContext(base.TestCtx(rt.TB), &sc, rt.RestTesterConfig.persistentConfig)
+	if rt.Clock != nil {
+		rt.RestTesterServerContext.clock = rt.Clock
+	}
+	if rt.EnableChaos {
+		rt.RestTesterServerContext.EnableChaos()
+	}
 	ctx := rt.Context()
 
 	if !base.ServerIsWalrus(sc.Bootstrap.Server) {
@@ -318,9 +336,76 @@ func (rt *RestTester) Bucket() base.Bucket {
 
 	// PostStartup (without actually waiting 5 seconds)
 	close(rt.RestTesterServerContext.hasStarted)
+
+	for i := 1; i < rt.NumNodes; i++ {
+		rt.nodes = append(rt.nodes, rt.newNode(rt.RestTesterServerContext.initialStartupConfig))
+	}
 	return rt.TestBucket.Bucket
 }
 
+// newNode starts an additional Sync Gateway node for a RestTester with NumNodes set.  The node has its own
+// ServerContext, started from a copy of the given startup config so that it's in the same config group as rt, and uses
+// the same test bucket.  In non-persistent mode the node also runs rt's database, otherwise databases are loaded on the
+// node from the bucket on demand, as for any other node in the config group.
+func (rt *RestTester) newNode(startupConfig StartupConfig) *RestTester {
+	node := &RestTester{
+		RestTesterConfig: rt.RestTesterConfig,
+		TB:               rt.TB,
+		TestBucket:       rt.TestBucket.NoCloseClone(),
+	}
+
+	var sc StartupConfig
+	if err := base.DeepCopyInefficient(&sc, &startupConfig); err != nil {
+		rt.TB.Fatalf("Unable to copy startup config for node: %v", err)
+	}
+	node.RestTesterServerContext = NewServerContext(base.TestCtx(rt.TB), &sc, rt.persistentConfig)
+	if rt.Clock != nil {
+		node.RestTesterServerContext.clock = rt.Clock
+	}
+	if rt.EnableChaos {
+		node.RestTesterServerContext.EnableChaos()
+	}
+	ctx := node.Context()
+
+	if !base.ServerIsWalrus(sc.Bootstrap.Server) {
+		if err := node.RestTesterServerContext.initializeCouchbaseServerConnections(ctx); err != nil {
+			panic("Couldn't initialize Couchbase Server connection: " + err.Error())
+		}
+	}
+
+	if err := base.DeepCopyInefficient(&node.RestTesterServerContext.initialStartupConfig, &sc); err != nil {
+		rt.TB.Fatalf("Unable to copy initial startup config for node: %v", err)
+	}
+
+	if !rt.persistentConfig {
+		// The node's database uses the bucket of rt's database, so that leaky bucket callbacks apply to every node.
+		if _, err := node.RestTesterServerContext.AddDatabaseFromConfigWithBucket(ctx, rt.TB, *rt.DatabaseConfig, node.TestBucket.Bucket); err != nil {
+			rt.TB.Fatalf("Error from AddDatabaseFromConfig for node: %v", err)
+		}
+	}
+
+	close(node.RestTesterServerContext.hasStarted)
+	return node
+}
+
+// Node returns the given node of a RestTester with NumNodes set.  Node 0 is rt itself.
+func (rt *RestTester) Node(i int) *RestTester {
+	rt.Bucket()
+	if i == 0 {
+		return rt
+	}
+	if i < 0 || i > len(rt.nodes) {
+		rt.TB.Fatalf("RestTester node %d doesn't exist, the RestTester has %d nodes", i, len(rt.nodes)+1)
+	}
+	return rt.nodes[i-1]
+}
+
+// Nodes returns all of the nodes of the RestTester, starting with rt itself.
+func (rt *RestTester) Nodes() []*RestTester {
+	rt.Bucket()
+	return append([]*RestTester{rt}, rt.nodes...)
+}
+
 // LeakyBucket gets the bucket from the RestTester as a leaky bucket allowing for callbacks to be set on the fly.
 // The RestTester must have been set up to create and use a leaky bucket by setting leakyBucketConfig in the RT
 // config when calling NewRestTester.
@@ -370,6 +455,53 @@ func (rt *RestTester) UpsertDbConfig(dbName string, config DbConfig) (*TestRespo
 	return resp, nil
 }
 
+// CreateKeyspaces creates the given scopes and collections, keyed by scope name, in the RestTester's bucket if they
+// don't already exist, and returns the ScopesConfig for a database using them.  The default collection always exists
+// and isn't included in the ScopesConfig, so the same test can be run against the default collection and named
+// collections.
+func (rt *RestTester) CreateKeyspaces(scopes map[string][]string) ScopesConfig {
+	var scopesConfig ScopesConfig
+	for scopeName, collectionNames := range scopes {
+		for _, collectionName := range collectionNames {
+			if scopeName == base.DefaultScope && collectionName == base.DefaultCollection {
+				continue
+			}
+			if scopesConfig == nil {
+				scopesConfig = make(ScopesConfig)
+			}
+			if _, ok := scopesConfig[scopeName]; !ok {
+				scopesConfig[scopeName] = ScopeConfig{Collections: make(map[string]CollectionConfig)}
+			}
+			scopesConfig[scopeName].Collections[collectionName] = CollectionConfig{}
+		}
+	}
+	if scopesConfig == nil {
+		return nil
+	}
+
+	collection, err := base.AsCollection(rt.Bucket())
+	require.NoError(rt.TB, err, "Named collections require a Couchbase Server bucket")
+	require.NoError(rt.TB, collection.CreateScopesAndCollections(rt.Context(), scopes))
+	return scopesConfig
+}
+
+// KeyspacePath returns the path of a request to the given scope and collection of the "db" database, followed by the
+// given path.  The default scope and collection are addressed by the database name alone, so the path also works for
+// databases that aren't configured with scopes.
+func (rt *RestTester) KeyspacePath(scope, collection, path string) string {
+	keyspace := "db"
+	if scope != base.DefaultScope || collection != base.DefaultCollection {
+		keyspace = strings.Join([]string{keyspace, scope, collection}, base.ScopeCollectionSeparator)
+	}
+	return "/" + keyspace + "/" + strings.TrimPrefix(path, "/")
+}
+
+// SendKeyspaceRequest sends an admin request to the given path within the given scope and collection of the "db"
+// database.
+func (rt *RestTester) SendKeyspaceRequest(method, scope, collection, path, body string) *TestResponse {
+	return rt.SendAdminRequest(method, rt.KeyspacePath(scope, collection, path), body)
+}
+
 // Returns first database found for server context.
 func (rt *RestTester) GetDatabase() *db.DatabaseContext {
 
@@ -442,6 +574,14 @@ func (rt *RestTester) Close() {
 		panic("RestTester not properly initialized please use NewRestTester function")
 	}
 	ctx := rt.Context() // capture ctx before closing rt
+	rt.saveScenario()
+
+	// Additional nodes share rt's bucket, so are closed first
+	for _, node := range rt.nodes {
+		node.Close()
+	}
+	rt.nodes = nil
+
 	rt.closed = true
 	if rt.RestTesterServerContext != nil {
 		rt.RestTesterServerContext.Close(ctx)
@@ -501,21 +641,21 @@ func (rt *RestTester) TestAdminHandlerNoConflictsMode() http.Handler {
 
 func (rt *RestTester) TestAdminHandler() http.Handler {
 	rt.adminHandlerOnce.Do(func() {
-		rt.AdminHandler = CreateAdminHandler(rt.ServerContext())
+		rt.AdminHandler = rt.scenarioRecorder.wrap(ScenarioAPIAdmin, CreateAdminHandler(rt.ServerContext()))
 	})
 	return rt.AdminHandler
 }
 
 func (rt *RestTester) TestPublicHandler() http.Handler {
 	rt.publicHandlerOnce.Do(func() {
-		rt.PublicHandler = CreatePublicHandler(rt.ServerContext())
+		rt.PublicHandler = rt.scenarioRecorder.wrap(ScenarioAPIPublic, CreatePublicHandler(rt.ServerContext()))
 	})
 	return rt.PublicHandler
 }
 
 func (rt *RestTester) TestMetricsHandler() http.Handler {
 	rt.metricsHandlerOnce.Do(func() {
-		rt.MetricsHandler = CreateMetricHandler(rt.ServerContext())
+		rt.MetricsHandler = rt.scenarioRecorder.wrap(ScenarioAPIMetrics, CreateMetricHandler(rt.ServerContext()))
 	})
 	return rt.MetricsHandler
 }
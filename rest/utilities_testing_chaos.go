@@ -0,0 +1,158 @@
+// Copyright 2022-Present Couchbase, Inc.
+//
+// Use of this software is governed by the Business Source License included
+// in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+// in that file, in accordance with the Business Source License, use of this
+// software will be governed by the Apache License, Version 2.0, included in
+// the file licenses/APL2.txt.
+
+package rest
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/couchbase/sync_gateway/base"
+)
+
+// ErrBootstrapConnectionDropped is returned by every bootstrap connection operation while the connection is dropped by
+// ServerChaos.DropBootstrapConnection.
+var ErrBootstrapConnectionDropped = errors.New("bootstrap connection dropped by chaos testing")
+
+// ServerChaos lets tests pause, resume and kill the caching and import DCP feeds of a ServerContext's databases, and
+// drop its bootstrap connection, so that reconnect, rollback and config re-fetch behaviour can be verified.  For
+// testing use only.
+type ServerChaos struct {
+	sc               *ServerContext
+	lock             sync.Mutex
+	cacheFeeds       map[string]*base.FeedChaos // Keyed by database name
+	importFeeds      map[string]*base.FeedChaos // Keyed by database name
+	bootstrapDropped base.AtomicBool
+}
+
+// EnableChaos returns the ServerContext's chaos hooks, enabling them if necessary.  The feed hooks only apply to
+// databases loaded after they're enabled, so RestTesterConfig.EnableChaos should be used to enable them before the
+// RestTester's database is created.
+func (sc *ServerContext) EnableChaos() *ServerChaos {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+	if sc.chaos == nil {
+		sc.chaos = &ServerChaos{
+			sc:          sc,
+			cacheFeeds:  make(map[string]*base.FeedChaos),
+			importFeeds: make(map[string]*base.FeedChaos),
+		}
+	}
+	return sc.chaos
+}
+
+// Chaos returns the chaos hooks of the RestTester's ServerContext.
+func (rt *RestTester) Chaos() *ServerChaos {
+	return rt.ServerContext().EnableChaos()
+}
+
+// CacheFeed returns the hook that pauses and resumes the given database's caching feed.
+func (c *ServerChaos) CacheFeed(dbName string) *base.FeedChaos {
+	return c.feed(c.cacheFeeds, dbName)
+}
+
+// ImportFeed returns the hook that pauses and resumes the given database's import feed.
+func (c *ServerChaos) ImportFeed(dbName string) *base.FeedChaos {
+	return c.feed(c.importFeeds, dbName)
+}
+
+func (c *ServerChaos) feed(feeds map[string]*base.FeedChaos, dbName string) *base.FeedChaos {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	feed, ok := feeds[dbName]
+	if !ok {
+		feed = base.NewFeedChaos()
+		feeds[dbName] = feed
+	}
+	return feed
+}
+
+// KillCacheFeed drops the given database's caching feed, discarding any events held back while it was paused, then
+// restarts it.  A paused feed is still paused once restarted.
+func (c *ServerChaos) KillCacheFeed(ctx context.Context, dbName string) error {
+	dbc, err := c.sc.GetDatabase(ctx, dbName)
+	if err != nil {
+		return err
+	}
+	return dbc.KillCacheFeed()
+}
+
+// KillImportFeed drops the given database's import feed, discarding any events held back while it was paused, then
+// restarts it from its checkpoints.  A paused feed is still paused once restarted.
+func (c *ServerChaos) KillImportFeed(ctx context.Context, dbName string) error {
+	dbc, err := c.sc.GetDatabase(ctx, dbName)
+	if err != nil {
+		return err
+	}
+	return dbc.KillImportFeed(ctx)
+}
+
+// DropBootstrapConnection makes every operation on the bootstrap connection fail with ErrBootstrapConnectionDropped
+// until RestoreBootstrapConnection is called, as for a lost connection to the cluster.
+func (c *ServerChaos) DropBootstrapConnection() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	connection := c.sc.BootstrapContext.Connection
+	if connection == nil {
+		return errors.New("server has no bootstrap connection")
+	}
+	if _, ok := connection.(*chaosBootstrapConnection); !ok {
+		c.sc.BootstrapContext.Connection = &chaosBootstrapConnection{BootstrapConnection: connection, dropped: &c.bootstrapDropped}
+	}
+	c.bootstrapDropped.Set(true)
+	return nil
+}
+
+// RestoreBootstrapConnection reconnects a bootstrap connection dropped by DropBootstrapConnection.
+func (c *ServerChaos) RestoreBootstrapConnection() {
+	c.bootstrapDropped.Set(false)
+}
+
+// chaosBootstrapConnection fails every operation while dropped.
+type chaosBootstrapConnection struct {
+	base.BootstrapConnection
+	dropped *base.AtomicBool
+}
+
+var _ base.BootstrapConnection = &chaosBootstrapConnection{}
+
+func (c *chaosBootstrapConnection) GetConfigBuckets() ([]string, error) {
+	if c.dropped.IsTrue() {
+		return nil, ErrBootstrapConnectionDropped
+	}
+	return c.BootstrapConnection.GetConfigBuckets()
+}
+
+func (c *chaosBootstrapConnection) GetConfig(bucket, groupID string, valuePtr interface{}) (cas uint64, err error) {
+	if c.dropped.IsTrue() {
+		return 0, ErrBootstrapConnectionDropped
+	}
+	return c.BootstrapConnection.GetConfig(bucket, groupID, valuePtr)
+}
+
+func (c *chaosBootstrapConnection) InsertConfig(bucket, groupID string, value interface{}) (newCAS uint64, err error) {
+	if c.dropped.IsTrue() {
+		return 0, ErrBootstrapConnectionDropped
+	}
+	return c.BootstrapConnection.InsertConfig(bucket, groupID, value)
+}
+
+func (c *chaosBootstrapConnection) UpdateConfig(bucket, groupID string, updateCallback func(rawBucketConfig []byte) (updatedConfig []byte, err error)) (newCAS uint64, err error) {
+	if c.dropped.IsTrue() {
+		return 0, ErrBootstrapConnectionDropped
+	}
+	return c.BootstrapConnection.UpdateConfig(bucket, groupID, updateCallback)
+}
+
+func (c *chaosBootstrapConnection) GetConfigGroupIDs(bucket string) ([]string, error) {
+	if c.dropped.IsTrue() {
+		return nil, ErrBootstrapConnectionDropped
+	}
+	return c.BootstrapConnection.GetConfigGroupIDs(bucket)
+}
@@ -0,0 +1,336 @@
+// Copyright 2022-Present Couchbase, Inc.
+//
+// Use of this software is governed by the Business Source License included
+// in the file licenses/BSL-Couchbase.txt.  As of the Change Date specified
+// in that file, in accordance with the Business Source License, use of this
+// software will be governed by the Apache License, Version 2.0, included in
+// the file licenses/APL2.txt.
+
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	// TestEnvRecordScenarios is the directory that every RestTester's requests are recorded to, as a scenario named
+	// after the test.  When unset, only RestTesters with RestTesterConfig.ScenarioFile are recorded.
+	TestEnvRecordScenarios = "SG_TEST_RECORD_SCENARIOS"
+
+	// Env variables for TestReplayScenario, which replays a recorded scenario against a running Sync Gateway
+	TestEnvReplayScenario      = "SG_TEST_REPLAY_SCENARIO"       // Path of the scenario to replay
+	TestEnvReplayAdminURL      = "SG_TEST_REPLAY_ADMIN_URL"      // Defaults to http://localhost:4985
+	TestEnvReplayPublicURL     = "SG_TEST_REPLAY_PUBLIC_URL"     // Defaults to http://localhost:4984
+	TestEnvReplayMetricsURL    = "SG_TEST_REPLAY_METRICS_URL"    // Defaults to http://localhost:4986
+	TestEnvReplayDatabase      = "SG_TEST_REPLAY_DATABASE"       // Database that requests to the RestTester's "db" are sent to
+	TestEnvReplayAdminUsername = "SG_TEST_REPLAY_ADMIN_USERNAME" // Credentials for admin requests that weren't authenticated in the test
+	TestEnvReplayAdminPassword = "SG_TEST_REPLAY_ADMIN_PASSWORD"
+
+	// Names of the APIs that scenario steps are sent to
+	ScenarioAPIAdmin   = "admin"
+	ScenarioAPIPublic  = "public"
+	ScenarioAPIMetrics = "metrics"
+
+	// scenarioBodyBase64 is the encoding of request and response bodies that aren't valid UTF-8
+	scenarioBodyBase64 = "base64"
+)
+
+// Scenario is a recording of the requests made to a RestTester and the responses returned, saved as a JSON fixture so
+// that a bug reproduction captured by a test can be replayed against a running Sync Gateway.
+type Scenario struct {
+	Name  string         `json:"name"`
+	Steps []ScenarioStep `json:"steps"`
+}
+
+// ScenarioStep is a request made during a scenario, and its response.
+type ScenarioStep struct {
+	API              string            `json:"api"` // ScenarioAPIAdmin, ScenarioAPIPublic or ScenarioAPIMetrics
+	Method           string            `json:"method"`
+	Path             string            `json:"path"` // Path and query string
+	Headers          map[string]string `json:"headers,omitempty"`
+	Body             string            `json:"body,omitempty"`
+	BodyEncoding     string            `json:"body_encoding,omitempty"` // "base64" when the body isn't valid UTF-8
+	Status           int               `json:"status"`
+	Response         string            `json:"response,omitempty"`
+	ResponseEncoding string            `json:"response_encoding,omitempty"` // "base64" when the response isn't valid UTF-8
+}
+
+// ScenarioMismatch is a step whose response status differed when a scenario was replayed.
+type ScenarioMismatch struct {
+	Step     int // Index of the step in the scenario
+	Method   string
+	Path     string
+	Expected int
+	Actual   int
+	Response string
+}
+
+func (m ScenarioMismatch) String() string {
+	return fmt.Sprintf("step %d %s %s: expected status %d, got %d: %s", m.Step, m.Method, m.Path, m.Expected, m.Actual, m.Response)
+}
+
+// ScenarioReplayOptions are the Sync Gateway that a scenario is replayed against.
+type ScenarioReplayOptions struct {
+	AdminURL      string
+	PublicURL     string
+	MetricsURL    string
+	Database      string // Replaces the RestTester's database name in request paths, when set
+	AdminUsername string // Credentials for admin requests that weren't authenticated when recorded
+	AdminPassword string
+	Client        *http.Client // Defaults to http.DefaultClient
+}
+
+// LoadScenario reads a scenario saved by a RestTester.
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var scenario Scenario
+	if err := json.Unmarshal(data, &scenario); err != nil {
+		return nil, fmt.Errorf("invalid scenario %s: %w", path, err)
+	}
+	return &scenario, nil
+}
+
+// Save writes the scenario to the given path as indented JSON.
+func (s *Scenario) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Replay sends each step of the scenario in order, and returns the steps whose response status didn't match the
+// recorded status.  Response bodies aren't compared, as they include sequences and timestamps that differ between runs.
+func (s *Scenario) Replay(ctx context.Context, options ScenarioReplayOptions) ([]ScenarioMismatch, error) {
+	client := options.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	var mismatches []ScenarioMismatch
+	for i, step := range s.Steps {
+		var baseURL string
+		switch step.API {
+		case ScenarioAPIAdmin:
+			baseURL = options.AdminURL
+		case ScenarioAPIPublic:
+			baseURL = options.PublicURL
+		case ScenarioAPIMetrics:
+			baseURL = options.MetricsURL
+		default:
+			return mismatches, fmt.Errorf("step %d has unknown API %q", i, step.API)
+		}
+
+		body, err := decodeScenarioBody(step.Body, step.BodyEncoding)
+		if err != nil {
+			return mismatches, fmt.Errorf("step %d: %w", i, err)
+		}
+		path := step.Path
+		if options.Database != "" {
+			path = replaceScenarioDatabase(path, options.Database)
+		}
+		request, err := http.NewRequestWithContext(ctx, step.Method, strings.TrimSuffix(baseURL, "/")+path, bytes.NewReader(body))
+		if err != nil {
+			return mismatches, fmt.Errorf("step %d: %w", i, err)
+		}
+		for name, value := range step.Headers {
+			request.Header.Set(name, value)
+		}
+		if step.API != ScenarioAPIPublic && options.AdminUsername != "" && request.Header.Get("Authorization") == "" {
+			request.SetBasicAuth(options.AdminUsername, options.AdminPassword)
+		}
+
+		response, err := client.Do(request)
+		if err != nil {
+			return mismatches, fmt.Errorf("step %d %s %s: %w", i, step.Method, path, err)
+		}
+		responseBody, err := io.ReadAll(response.Body)
+		_ = response.Body.Close()
+		if err != nil {
+			return mismatches, fmt.Errorf("step %d %s %s: %w", i, step.Method, path, err)
+		}
+		if response.StatusCode != step.Status {
+			mismatches = append(mismatches, ScenarioMismatch{
+				Step:     i,
+				Method:   step.Method,
+				Path:     path,
+				Expected: step.Status,
+				Actual:   response.StatusCode,
+				Response: string(responseBody),
+			})
+		}
+	}
+	return mismatches, nil
+}
+
+// replaceScenarioDatabase replaces the RestTester's database name at the start of the given path, keeping any keyspace
+// suffix.
+func replaceScenarioDatabase(path, database string) string {
+	remainder := strings.TrimPrefix(path, "/db")
+	if remainder == path || (remainder != "" && !strings.ContainsAny(remainder[:1], "/.?")) {
+		return path
+	}
+	return "/" + database + remainder
+}
+
+// encodeScenarioBody returns the body as a string, base64 encoded when it isn't valid UTF-8.
+func encodeScenarioBody(body []byte) (encoded string, encoding string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), scenarioBodyBase64
+}
+
+func decodeScenarioBody(body, encoding string) ([]byte, error) {
+	switch encoding {
+	case "":
+		return []byte(body), nil
+	case scenarioBodyBase64:
+		return base64.StdEncoding.DecodeString(body)
+	default:
+		return nil, fmt.Errorf("unknown body encoding %q", encoding)
+	}
+}
+
+// scenarioRecorder records the requests made to a RestTester's handlers.
+type scenarioRecorder struct {
+	lock     sync.Mutex
+	scenario Scenario
+	path     string // Where the scenario is saved when the RestTester is closed
+}
+
+// newScenarioRecorder returns a recorder for the given test, or nil if the test's requests aren't being recorded.
+func newScenarioRecorder(testName, path string) *scenarioRecorder {
+	if path == "" {
+		dir := os.Getenv(TestEnvRecordScenarios)
+		if dir == "" {
+			return nil
+		}
+		path = filepath.Join(dir, strings.NewReplacer("/", "_", "\\", "_").Replace(testName)+".json")
+	}
+	return &scenarioRecorder{scenario: Scenario{Name: testName}, path: path}
+}
+
+// wrap returns a handler that records the requests made to the given API.  Websocket upgrades, such as BLIP
+// replications, aren't recorded.
+func (r *scenarioRecorder) wrap(api string, handler http.Handler) http.Handler {
+	if r == nil {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, rq *http.Request) {
+		if strings.EqualFold(rq.Header.Get("Upgrade"), "websocket") {
+			handler.ServeHTTP(w, rq)
+			return
+		}
+		var body []byte
+		if rq.Body != nil {
+			body, _ = io.ReadAll(rq.Body)
+			_ = rq.Body.Close()
+			rq.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		recorder := &scenarioResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		handler.ServeHTTP(recorder, rq)
+
+		step := ScenarioStep{
+			API:    api,
+			Method: rq.Method,
+			Path:   rq.URL.RequestURI(),
+			Status: recorder.status,
+		}
+		for name, values := range rq.Header {
+			if len(values) > 0 {
+				if step.Headers == nil {
+					step.Headers = make(map[string]string, len(rq.Header))
+				}
+				step.Headers[name] = values[0]
+			}
+		}
+		step.Body, step.BodyEncoding = encodeScenarioBody(body)
+		step.Response, step.ResponseEncoding = encodeScenarioBody(recorder.body.Bytes())
+
+		r.lock.Lock()
+		r.scenario.Steps = append(r.scenario.Steps, step)
+		r.lock.Unlock()
+	})
+}
+
+// snapshot returns a copy of the scenario recorded so far.
+func (r *scenarioRecorder) snapshot() *Scenario {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return &Scenario{Name: r.scenario.Name, Steps: append([]ScenarioStep(nil), r.scenario.Steps...)}
+}
+
+// scenarioResponseWriter captures the status and body written to a response.
+type scenarioResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (w *scenarioResponseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *scenarioResponseWriter) Write(data []byte) (int, error) {
+	w.wroteHeader = true
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *scenarioResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// CloseNotify is implemented for continuous changes feeds, which stop when the client disconnects.
+func (w *scenarioResponseWriter) CloseNotify() <-chan bool {
+	if notifier, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return notifier.CloseNotify()
+	}
+	return nil
+}
+
+// Scenario returns the requests made to the RestTester so far, or nil if they aren't being recorded.
+func (rt *RestTester) Scenario() *Scenario {
+	if rt.scenarioRecorder == nil {
+		return nil
+	}
+	return rt.scenarioRecorder.snapshot()
+}
+
+// saveScenario writes the recorded scenario to its file, if the RestTester's requests are being recorded.
+func (rt *RestTester) saveScenario() {
+	if rt.scenarioRecorder == nil {
+		return
+	}
+	if err := rt.scenarioRecorder.snapshot().Save(rt.scenarioRecorder.path); err != nil {
+		rt.TB.Errorf("Unable to save scenario to %s: %v", rt.scenarioRecorder.path, err)
+		return
+	}
+	rt.TB.Logf("Saved scenario to %s", rt.scenarioRecorder.path)
+}
@@ -12,7 +12,12 @@ package rest
 
 import (
 	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/couchbase/sync_gateway/base"
 	"github.com/couchbase/sync_gateway/db"
@@ -99,3 +104,159 @@ func TestAttachmentRoundTrip(t *testing.T) {
 	assert.Equal(t, []byte{}, attachments["baz"].Data) // data field is explicitly ignored
 
 }
+
+func TestScenarioRecordAndReplay(t *testing.T) {
+	scenarioFile := filepath.Join(t.TempDir(), "scenario.json")
+	rt := NewRestTester(t, &RestTesterConfig{ScenarioFile: scenarioFile})
+
+	RequireStatus(t, rt.SendAdminRequest(http.MethodPut, "/db/_user/alice", `{"password":"letmein", "admin_channels":["A"]}`), http.StatusCreated)
+	RequireStatus(t, rt.SendAdminRequest(http.MethodPut, "/db/doc1", `{"channels":["A"]}`), http.StatusCreated)
+	RequireStatus(t, rt.SendUserRequestWithHeaders(http.MethodGet, "/db/doc1", "", nil, "alice", "letmein"), http.StatusOK)
+	RequireStatus(t, rt.SendAdminRequest(http.MethodGet, "/db/missing", ""), http.StatusNotFound)
+
+	recorded := rt.Scenario()
+	require.NotNil(t, recorded)
+	require.Len(t, recorded.Steps, 4)
+	assert.Equal(t, ScenarioAPIAdmin, recorded.Steps[0].API)
+	assert.Equal(t, "/db/_user/alice", recorded.Steps[0].Path)
+	assert.Equal(t, http.StatusCreated, recorded.Steps[0].Status)
+	assert.Equal(t, ScenarioAPIPublic, recorded.Steps[2].API)
+	assert.NotEmpty(t, recorded.Steps[2].Headers["Authorization"])
+	assert.Contains(t, recorded.Steps[2].Response, `"_id":"doc1"`)
+	assert.Equal(t, http.StatusNotFound, recorded.Steps[3].Status)
+
+	// The scenario is saved when the RestTester is closed
+	rt.Close()
+	scenario, err := LoadScenario(scenarioFile)
+	require.NoError(t, err)
+	assert.Equal(t, t.Name(), scenario.Name)
+	assert.Equal(t, recorded.Steps, scenario.Steps)
+
+	// Replaying against a fresh database returns the same statuses
+	rt2 := NewRestTester(t, nil)
+	defer rt2.Close()
+	adminServer := httptest.NewServer(rt2.TestAdminHandler())
+	defer adminServer.Close()
+	publicServer := httptest.NewServer(rt2.TestPublicHandler())
+	defer publicServer.Close()
+
+	options := ScenarioReplayOptions{AdminURL: adminServer.URL, PublicURL: publicServer.URL}
+	mismatches, err := scenario.Replay(rt2.Context(), options)
+	require.NoError(t, err)
+	assert.Empty(t, mismatches)
+
+	// Replaying again finds the user and document already exist
+	mismatches, err = scenario.Replay(rt2.Context(), options)
+	require.NoError(t, err)
+	require.Len(t, mismatches, 2)
+	assert.Equal(t, 0, mismatches[0].Step)
+	assert.Equal(t, http.StatusOK, mismatches[0].Actual)
+	assert.Equal(t, 1, mismatches[1].Step)
+	assert.Equal(t, http.StatusConflict, mismatches[1].Actual)
+}
+
+func TestReplaceScenarioDatabase(t *testing.T) {
+	assert.Equal(t, "/other/doc1", replaceScenarioDatabase("/db/doc1", "other"))
+	assert.Equal(t, "/other.scope1.collection1/doc1", replaceScenarioDatabase("/db.scope1.collection1/doc1", "other"))
+	assert.Equal(t, "/other", replaceScenarioDatabase("/db", "other"))
+	assert.Equal(t, "/other?x=1", replaceScenarioDatabase("/db?x=1", "other"))
+	assert.Equal(t, "/dbx/doc1", replaceScenarioDatabase("/dbx/doc1", "other"))
+	assert.Equal(t, "/_config", replaceScenarioDatabase("/_config", "other"))
+}
+
+// TestReplayScenario replays the scenario at SG_TEST_REPLAY_SCENARIO against a running Sync Gateway, so that a bug
+// reproduction recorded by a test can be checked against a candidate build.
+func TestReplayScenario(t *testing.T) {
+	scenarioFile := os.Getenv(TestEnvReplayScenario)
+	if scenarioFile == "" {
+		t.Skipf("Set %s to the path of a recorded scenario to replay it", TestEnvReplayScenario)
+	}
+	scenario, err := LoadScenario(scenarioFile)
+	require.NoError(t, err)
+
+	urlFromEnv := func(env, defaultURL string) string {
+		if url := os.Getenv(env); url != "" {
+			return url
+		}
+		return defaultURL
+	}
+	mismatches, err := scenario.Replay(base.TestCtx(t), ScenarioReplayOptions{
+		AdminURL:      urlFromEnv(TestEnvReplayAdminURL, "http://localhost:4985"),
+		PublicURL:     urlFromEnv(TestEnvReplayPublicURL, "http://localhost:4984"),
+		MetricsURL:    urlFromEnv(TestEnvReplayMetricsURL, "http://localhost:4986"),
+		Database:      os.Getenv(TestEnvReplayDatabase),
+		AdminUsername: os.Getenv(TestEnvReplayAdminUsername),
+		AdminPassword: os.Getenv(TestEnvReplayAdminPassword),
+	})
+	require.NoError(t, err)
+	for _, mismatch := range mismatches {
+		t.Errorf("%s", mismatch)
+	}
+	t.Logf("Replayed %d steps of scenario %s with %d mismatches", len(scenario.Steps), scenario.Name, len(mismatches))
+}
+
+func TestChaosCacheFeed(t *testing.T) {
+	rt := NewRestTester(t, &RestTesterConfig{EnableChaos: true})
+	defer rt.Close()
+	feed := rt.Chaos().CacheFeed("db")
+	waitForHeld := func() {
+		require.Eventually(t, func() bool { return feed.Held() > 0 }, 10*time.Second, 10*time.Millisecond)
+	}
+
+	// Mutations are held back while the feed is paused, and reach the cache once resumed
+	feed.Pause()
+	rt.PutDoc("doc1", `{"foo":"bar"}`)
+	waitForHeld()
+	feed.Resume()
+	require.NoError(t, rt.WaitForPendingChanges())
+
+	// Killing the feed discards the held mutations, and the restarted feed stays paused until resumed
+	feed.Pause()
+	rt.PutDoc("doc2", `{"foo":"bar"}`)
+	waitForHeld()
+	require.NoError(t, rt.Chaos().KillCacheFeed(rt.Context(), "db"))
+	assert.NotZero(t, feed.Discarded())
+	assert.True(t, feed.Paused())
+	feed.Resume()
+
+	// The cache recovers once later mutations arrive on the restarted feed
+	rt.PutDoc("doc3", `{"foo":"bar"}`)
+	require.NoError(t, rt.WaitForPendingChanges())
+}
+
+func TestChaosBootstrapConnection(t *testing.T) {
+	if base.UnitTestUrlIsWalrus() {
+		t.Skip("Persistent config requires Couchbase Server")
+	}
+
+	rt := NewRestTester(t, &RestTesterConfig{NumNodes: 2, persistentConfig: true})
+	defer rt.Close()
+
+	resp, err := rt.CreateDatabase("db", dbConfigForTestBucket(rt.TestBucket))
+	require.NoError(t, err)
+	RequireStatus(t, resp, http.StatusCreated)
+
+	// The other node can't fetch the database config while its bootstrap connection is dropped
+	node := rt.Node(1)
+	require.NoError(t, node.Chaos().DropBootstrapConnection())
+	resp = node.SendAdminRequest(http.MethodGet, "/db/", "")
+	RequireStatus(t, resp, http.StatusNotFound)
+
+	node.Chaos().RestoreBootstrapConnection()
+	resp = node.SendAdminRequest(http.MethodGet, "/db/", "")
+	RequireStatus(t, resp, http.StatusOK)
+}
+
+func TestRestTesterIsolatedCollection(t *testing.T) {
+	rt1 := NewRestTester(t, &RestTesterConfig{IsolatedCollection: true})
+	defer rt1.Close()
+	rt2 := NewRestTester(t, &RestTesterConfig{IsolatedCollection: true})
+	defer rt2.Close()
+
+	// Each RestTester's database only sees the documents in its own collection
+	rt1.PutDoc("doc1", `{"foo":"bar"}`)
+	resp := rt1.SendAdminRequest(http.MethodGet, "/db/doc1", "")
+	RequireStatus(t, resp, http.StatusOK)
+	resp = rt2.SendAdminRequest(http.MethodGet, "/db/doc1", "")
+	RequireStatus(t, resp, http.StatusNotFound)
+}